@@ -73,7 +73,7 @@ func main() {
 	fmt.Printf("Workflow ID: %s\n", wCtx.WorkflowID)
 	fmt.Printf("Start time: %v\n", wCtx.StartTime)
 	fmt.Printf("Final status: %v\n", wCtx.Status)
-	fmt.Printf("Tags: %v\n", wCtx.Metadata.GetTags())
+	fmt.Printf("Tags: %v\n", wCtx.GetMetadata().GetTags())
 
 	// Print step results
 	fmt.Printf("\n=== Step Results ===\n")
@@ -181,6 +181,10 @@ func processLargePaymentStep(workflowCtx *core.WorkflowContext) (*string, error)
 
 	workflowCtx.SetData("processing_fee", amount*0.03) // 3% fee for large payments
 	workflowCtx.SetData("requires_approval", true)
+	workflowCtx.LogInfo("Large payment requires approval", map[string]interface{}{
+		"order_id": orderID,
+		"amount": amount,
+	})
 
 	workflowCtx.SetStepResult("process_large_payment", map[string]interface{}{
 		"payment_type": "large",
@@ -80,8 +80,8 @@ func (wb *WorkflowBuilder) AddWaitStep(name, description, triggerKey, nextStep s
 }
 
 // AddParallelStep adds a parallel step to the workflow
-func (wb *WorkflowBuilder) AddParallelStep(name, description string, steps []string, nextStep string) *WorkflowBuilder {
-	step := core.NewParallelStep(name, description, steps, nextStep)
+func (wb *WorkflowBuilder) AddParallelStep(name, description string, steps []string, nextStep string, strategy ...core.ResultAggregationStrategy) *WorkflowBuilder {
+	step := core.NewParallelStep(name, description, steps, nextStep, strategy...)
 	return wb.AddStep(step)
 }
 
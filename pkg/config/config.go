@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/truongtu268/magic-flow/pkg/encryption"
 	"github.com/truongtu268/magic-flow/pkg/messaging"
 	"github.com/truongtu268/magic-flow/pkg/storage"
 )
@@ -76,7 +78,13 @@ type SecurityConfig struct {
 	AuthProvider     string            `json:"auth_provider"` // jwt, oauth2, etc.
 	AuthConfig       map[string]interface{} `json:"auth_config"`
 	EnableEncryption bool              `json:"enable_encryption"`
+	// EncryptionKey is the base64 encoded key new data is encrypted with,
+	// and EncryptionKeyID its ID, prefixed to the data it encrypts
 	EncryptionKey    string            `json:"encryption_key"`
+	EncryptionKeyID  string            `json:"encryption_key_id"`
+	// EncryptionKeys are the historical keys by ID, kept after a rotation
+	// to decrypt the data encrypted with them
+	EncryptionKeys   map[string]string `json:"encryption_keys,omitempty"`
 	TLSEnabled       bool              `json:"tls_enabled"`
 	TLSCertFile      string            `json:"tls_cert_file"`
 	TLSKeyFile       string            `json:"tls_key_file"`
@@ -132,6 +140,7 @@ func DefaultConfig() *Config {
 			AuthProvider:     "jwt",
 			AuthConfig:       make(map[string]interface{}),
 			EnableEncryption: false,
+			EncryptionKeyID:  "v1",
 			TLSEnabled:       false,
 			CORSEnabled:      true,
 			CORSOrigins:      []string{"*"},
@@ -236,6 +245,18 @@ func LoadFromEnv() *Config {
 	if val := getEnvString("MAGIC_FLOW_ENCRYPTION_KEY", config.Security.EncryptionKey); val != config.Security.EncryptionKey {
 		config.Security.EncryptionKey = val
 	}
+	if val := getEnvString("MAGIC_FLOW_ENCRYPTION_KEY_ID", config.Security.EncryptionKeyID); val != config.Security.EncryptionKeyID {
+		config.Security.EncryptionKeyID = val
+	}
+	// Historical keys are listed as id:key pairs separated by commas
+	if val := getEnvString("MAGIC_FLOW_ENCRYPTION_KEYS", ""); val != "" {
+		config.Security.EncryptionKeys = make(map[string]string)
+		for _, pair := range strings.Split(val, ",") {
+			if id, key, ok := strings.Cut(strings.TrimSpace(pair), ":"); ok {
+				config.Security.EncryptionKeys[id] = key
+			}
+		}
+	}
 	config.Security.TLSEnabled = getEnvBool("MAGIC_FLOW_TLS_ENABLED", config.Security.TLSEnabled)
 	if val := getEnvString("MAGIC_FLOW_TLS_CERT_FILE", config.Security.TLSCertFile); val != config.Security.TLSCertFile {
 		config.Security.TLSCertFile = val
@@ -354,6 +375,15 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("security configuration is required")
 	}
 	
+	if c.Security.EnableEncryption {
+		if c.Security.EncryptionKey == "" {
+			return fmt.Errorf("encryption_key is required when encryption is enabled")
+		}
+		if _, err := c.Security.Keyring(); err != nil {
+			return fmt.Errorf("invalid encryption keys: %w", err)
+		}
+	}
+
 	if c.Security.TLSEnabled {
 		if c.Security.TLSCertFile == "" {
 			return fmt.Errorf("tls_cert_file is required when TLS is enabled")
@@ -366,6 +396,36 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// Keyring returns the keyring of the encryption keys, encrypting with
+// EncryptionKey and decrypting the data of the historical EncryptionKeys.
+// Rotating a key moves the current key to EncryptionKeys under its ID and
+// sets EncryptionKey and EncryptionKeyID to the new key.
+func (s *SecurityConfig) Keyring() (*encryption.Keyring, error) {
+	id := s.EncryptionKeyID
+	if id == "" {
+		id = "v1"
+	}
+	active, err := encryption.ParseKey(id, s.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(s.EncryptionKeys))
+	for historicalID := range s.EncryptionKeys {
+		ids = append(ids, historicalID)
+	}
+	sort.Strings(ids)
+	historical := make([]encryption.Key, 0, len(ids))
+	for _, historicalID := range ids {
+		key, err := encryption.ParseKey(historicalID, s.EncryptionKeys[historicalID])
+		if err != nil {
+			return nil, err
+		}
+		historical = append(historical, key)
+	}
+	return encryption.NewKeyring(active, historical...)
+}
+
 // Merge merges another configuration into this one
 func (c *Config) Merge(other *Config) {
 	if other.Engine != nil {
@@ -636,6 +696,17 @@ func mergeSecurityConfig(dst, src *SecurityConfig) {
 	if src.EncryptionKey != "" {
 		dst.EncryptionKey = src.EncryptionKey
 	}
+	if src.EncryptionKeyID != "" {
+		dst.EncryptionKeyID = src.EncryptionKeyID
+	}
+	if src.EncryptionKeys != nil {
+		if dst.EncryptionKeys == nil {
+			dst.EncryptionKeys = make(map[string]string)
+		}
+		for id, key := range src.EncryptionKeys {
+			dst.EncryptionKeys[id] = key
+		}
+	}
 	dst.TLSEnabled = src.TLSEnabled
 	if src.TLSCertFile != "" {
 		dst.TLSCertFile = src.TLSCertFile
@@ -286,6 +286,58 @@ func TestValidate(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "invalid log format")
 	})
+
+	t.Run("InvalidEncryptionConfig", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Security.EnableEncryption = true
+		err := cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "encryption_key is required when encryption is enabled")
+
+		cfg.Security.EncryptionKey = "c2hvcnQ="
+		err = cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid encryption keys: invalid encryption key v1")
+	})
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	const keyV1 = "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	const keyV2 = "AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="
+
+	cfg := DefaultConfig()
+	cfg.Security.EnableEncryption = true
+	cfg.Security.EncryptionKey = keyV1
+	require.NoError(t, cfg.Validate())
+	keyring, err := cfg.Security.Keyring()
+	require.NoError(t, err)
+	v1Data, err := keyring.Encrypt([]byte("order data"))
+	require.NoError(t, err)
+
+	// Rotate to v2, keeping v1 as a historical key
+	cfg.Security.EncryptionKeys = map[string]string{"v1": cfg.Security.EncryptionKey}
+	cfg.Security.EncryptionKey = keyV2
+	cfg.Security.EncryptionKeyID = "v2"
+	require.NoError(t, cfg.Validate())
+	keyring, err = cfg.Security.Keyring()
+	require.NoError(t, err)
+	assert.Equal(t, "v2", keyring.ActiveKeyID())
+
+	plaintext, err := keyring.Decrypt(v1Data)
+	require.NoError(t, err)
+	assert.Equal(t, "order data", string(plaintext))
+
+	// Historical keys are read from the environment as id:key pairs
+	t.Setenv("MAGIC_FLOW_ENCRYPTION_KEY", keyV2)
+	t.Setenv("MAGIC_FLOW_ENCRYPTION_KEY_ID", "v2")
+	t.Setenv("MAGIC_FLOW_ENCRYPTION_KEYS", "v1:"+keyV1)
+	envConfig := LoadFromEnv()
+	assert.Equal(t, map[string]string{"v1": keyV1}, envConfig.Security.EncryptionKeys)
+	keyring, err = envConfig.Security.Keyring()
+	require.NoError(t, err)
+	plaintext, err = keyring.Decrypt(v1Data)
+	require.NoError(t, err)
+	assert.Equal(t, "order data", string(plaintext))
 }
 
 func TestMerge(t *testing.T) {
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ResultAggregationStrategy decides how a value produced by a parallel branch
+// is combined with the value already collected for the same key
+type ResultAggregationStrategy interface {
+	// Combine returns the combined value for key. It is only called when an
+	// earlier branch already produced a value for key.
+	Combine(key string, existing, incoming interface{}) (interface{}, error)
+}
+
+// MergeStrategy keeps the value of the last branch that wrote a key
+type MergeStrategy struct{}
+
+// Combine returns the incoming value
+func (MergeStrategy) Combine(key string, existing, incoming interface{}) (interface{}, error) {
+	return incoming, nil
+}
+
+// ConcatStrategy appends the values of all branches that wrote a key. Slice
+// values are flattened, other values are appended as single elements.
+type ConcatStrategy struct{}
+
+// Combine appends the incoming value to the existing one
+func (ConcatStrategy) Combine(key string, existing, incoming interface{}) (interface{}, error) {
+	return append(toInterfaceSlice(existing), toInterfaceSlice(incoming)...), nil
+}
+
+// SumStrategy sums the numeric values of all branches that wrote a key
+type SumStrategy struct{}
+
+// Combine adds the incoming value to the existing one
+func (SumStrategy) Combine(key string, existing, incoming interface{}) (interface{}, error) {
+	a := reflect.ValueOf(existing)
+	b := reflect.ValueOf(incoming)
+	if !isNumeric(a) || !isNumeric(b) {
+		return nil, fmt.Errorf("cannot sum key '%s': %T and %T are not both numeric", key, existing, incoming)
+	}
+
+	switch {
+	case a.Kind() == reflect.Int && b.Kind() == reflect.Int:
+		return int(a.Int() + b.Int()), nil
+	case isInteger(a) && isInteger(b):
+		return toInt64(a) + toInt64(b), nil
+	default:
+		return toFloat64(a) + toFloat64(b), nil
+	}
+}
+
+// CustomStrategy combines values with a user supplied function
+type CustomStrategy func(a, b interface{}) interface{}
+
+// Combine calls the wrapped function
+func (f CustomStrategy) Combine(key string, existing, incoming interface{}) (interface{}, error) {
+	return f(existing, incoming), nil
+}
+
+// StepResultAggregator merges the outputs of parallel branches
+type StepResultAggregator struct {
+	Strategy ResultAggregationStrategy
+}
+
+// NewStepResultAggregator creates a new aggregator. A nil strategy defaults
+// to MergeStrategy.
+func NewStepResultAggregator(strategy ResultAggregationStrategy) *StepResultAggregator {
+	if strategy == nil {
+		strategy = MergeStrategy{}
+	}
+	return &StepResultAggregator{Strategy: strategy}
+}
+
+// Aggregate merges branch outputs in order. Keys written by a single branch
+// are copied unchanged; keys written by several branches are combined with
+// the strategy.
+func (a *StepResultAggregator) Aggregate(outputs []map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for _, output := range outputs {
+		for key, value := range output {
+			existing, exists := result[key]
+			if !exists {
+				result[key] = value
+				continue
+			}
+
+			combined, err := a.Strategy.Combine(key, existing, value)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = combined
+		}
+	}
+	return result, nil
+}
+
+func toInterfaceSlice(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+
+	result := make([]interface{}, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		result[i] = v.Index(i).Interface()
+	}
+	return result
+}
+
+func isInteger(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isNumeric(v reflect.Value) bool {
+	return isInteger(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+func toInt64(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
+
+func toFloat64(v reflect.Value) float64 {
+	switch {
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return v.Float()
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return float64(v.Int())
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepResultAggregator(t *testing.T) {
+	branches := []map[string]interface{}{
+		{"count": 1, "items": []string{"a"}, "source": "left"},
+		{"count": 2, "items": []string{"b", "c"}, "source": "right", "extra": true},
+	}
+
+	t.Run("MergeStrategy is last-write-wins", func(t *testing.T) {
+		result, err := NewStepResultAggregator(MergeStrategy{}).Aggregate(branches)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, result["count"])
+		assert.Equal(t, "right", result["source"])
+		assert.Equal(t, true, result["extra"])
+	})
+
+	t.Run("nil strategy defaults to MergeStrategy", func(t *testing.T) {
+		result, err := NewStepResultAggregator(nil).Aggregate(branches)
+		require.NoError(t, err)
+
+		assert.Equal(t, "right", result["source"])
+	})
+
+	t.Run("ConcatStrategy appends slice values", func(t *testing.T) {
+		result, err := NewStepResultAggregator(ConcatStrategy{}).Aggregate(branches)
+		require.NoError(t, err)
+
+		assert.Equal(t, []interface{}{"a", "b", "c"}, result["items"])
+		assert.Equal(t, []interface{}{"left", "right"}, result["source"])
+		assert.Equal(t, true, result["extra"])
+	})
+
+	t.Run("SumStrategy sums numeric values", func(t *testing.T) {
+		result, err := NewStepResultAggregator(SumStrategy{}).Aggregate([]map[string]interface{}{
+			{"count": 1, "total": int64(10), "score": 0.5},
+			{"count": 2, "total": int32(5), "score": 1},
+			{"count": 3},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, 6, result["count"])
+		assert.Equal(t, int64(15), result["total"])
+		assert.Equal(t, 1.5, result["score"])
+	})
+
+	t.Run("SumStrategy rejects non-numeric conflicts", func(t *testing.T) {
+		_, err := NewStepResultAggregator(SumStrategy{}).Aggregate(branches)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("CustomStrategy", func(t *testing.T) {
+		longest := CustomStrategy(func(a, b interface{}) interface{} {
+			if len(b.(string)) > len(a.(string)) {
+				return b
+			}
+			return a
+		})
+
+		result, err := NewStepResultAggregator(longest).Aggregate([]map[string]interface{}{
+			{"name": "bob"}, {"name": "alice"}, {"name": "eve"},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "alice", result["name"])
+	})
+}
+
+func TestParallelStepAggregation(t *testing.T) {
+	t.Run("merges branch results into step result", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+		wCtx.SetStepResult("left", map[string]interface{}{"count": 1})
+		wCtx.SetStepResult("right", map[string]interface{}{"count": 2})
+		wCtx.SetStepResult("flag", "done")
+
+		step := NewParallelStep("fan-in", "", []string{"left", "right", "flag", "pending"}, "next", SumStrategy{})
+		next, err := step.Execute(wCtx)
+		require.NoError(t, err)
+		require.NotNil(t, next)
+		assert.Equal(t, "next", *next)
+		_, exists := wCtx.GetStepResult("fan-in")
+		assert.False(t, exists, "branches are aggregated once they ran, not when the step runs")
+
+		require.NoError(t, step.AggregateResults(wCtx))
+
+		result, exists := wCtx.GetStepResult("fan-in")
+		require.True(t, exists)
+		assert.Equal(t, map[string]interface{}{"count": 3, "flag": "done"}, result)
+	})
+
+	t.Run("returns aggregation errors", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+		wCtx.SetStepResult("left", map[string]interface{}{"count": "one"})
+		wCtx.SetStepResult("right", map[string]interface{}{"count": 2})
+
+		step := NewParallelStep("fan-in", "", []string{"left", "right"}, "", SumStrategy{})
+		err := step.AggregateResults(wCtx)
+
+		assert.Error(t, err)
+		_, exists := wCtx.GetStepResult("fan-in")
+		assert.False(t, exists)
+	})
+}
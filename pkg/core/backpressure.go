@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BackpressureDelayMetric is the name of the gauge reporting the current
+// backpressure delay in milliseconds
+const BackpressureDelayMetric = "magicflow_backpressure_delay_ms"
+
+// backpressureBaseDelay is the first delay applied once the queue is
+// overloaded; later delays double up to the maximum delay
+const backpressureBaseDelay = time.Millisecond
+
+// Gauge is a metric that can be set to an arbitrary value. A Prometheus
+// gauge satisfies it:
+//
+//	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: core.BackpressureDelayMetric})
+//	prometheus.MustRegister(gauge)
+//	middleware := core.NewBackpressureMiddleware(queue.Len, 1000, time.Second).WithGauge(gauge)
+type Gauge interface {
+	Set(value float64)
+}
+
+// BackpressureMiddleware admits steps more slowly while the engine is
+// overloaded. When the queue depth exceeds the high watermark, a step waits
+// with exponentially growing delays until the queue drains below the
+// watermark or it has waited the maximum delay, and is then executed.
+type BackpressureMiddleware struct {
+	queueDepth    func() int
+	highWatermark int
+	maxDelay      time.Duration
+	gauge         Gauge
+
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+// NewBackpressureMiddleware creates a backpressure middleware slowing down
+// steps while queueDepthFn reports more than highWatermark queued items
+func NewBackpressureMiddleware(queueDepthFn func() int, highWatermark int, maxDelay time.Duration) *BackpressureMiddleware {
+	return &BackpressureMiddleware{
+		queueDepth:    queueDepthFn,
+		highWatermark: highWatermark,
+		maxDelay:      maxDelay,
+	}
+}
+
+// WithGauge reports the current delay, in milliseconds, to gauge
+func (m *BackpressureMiddleware) WithGauge(gauge Gauge) *BackpressureMiddleware {
+	m.gauge = gauge
+	m.setDelay(m.CurrentDelay())
+	return m
+}
+
+// CurrentDelay returns the delay applied to the next step while the queue
+// stays overloaded, or zero when it is not overloaded
+func (m *BackpressureMiddleware) CurrentDelay() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.delay
+}
+
+// Handle delays the step while the queue is overloaded. A step whose context
+// is cancelled while waiting is not executed.
+func (m *BackpressureMiddleware) Handle(ctx *WorkflowContext, next StepHandler) (*string, error) {
+	var waited time.Duration
+	for m.queueDepth() > m.highWatermark {
+		if waited >= m.maxDelay {
+			return next(ctx)
+		}
+
+		delay := m.increaseDelay()
+		if remaining := m.maxDelay - waited; delay > remaining {
+			delay = remaining
+		}
+		if err := sleepContext(ctx.GetContext(), delay); err != nil {
+			return nil, err
+		}
+		waited += delay
+	}
+
+	m.setDelay(0)
+	return next(ctx)
+}
+
+// increaseDelay doubles the delay, starting from the base delay and capped
+// at the maximum delay, and returns it
+func (m *BackpressureMiddleware) increaseDelay() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.delay == 0 {
+		m.delay = backpressureBaseDelay
+	} else {
+		m.delay *= 2
+	}
+	if m.delay > m.maxDelay {
+		m.delay = m.maxDelay
+	}
+	m.reportDelay()
+	return m.delay
+}
+
+func (m *BackpressureMiddleware) setDelay(delay time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.delay = delay
+	m.reportDelay()
+}
+
+// reportDelay sets the gauge to the current delay; m.mu must be held
+func (m *BackpressureMiddleware) reportDelay() {
+	if m.gauge != nil {
+		m.gauge.Set(float64(m.delay) / float64(time.Millisecond))
+	}
+}
+
+// sleepContext sleeps for d or until ctx is done, returning the context
+// error in the latter case
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
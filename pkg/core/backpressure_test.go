@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingGauge records the values it is set to
+type recordingGauge struct {
+	mu     sync.Mutex
+	values []float64
+}
+
+func (g *recordingGauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values = append(g.values, value)
+}
+
+func (g *recordingGauge) Values() []float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]float64(nil), g.values...)
+}
+
+func nextStepHandler(ctx *WorkflowContext) (*string, error) {
+	next := "ship"
+	return &next, nil
+}
+
+func TestBackpressureMiddleware(t *testing.T) {
+	t.Run("queue below the watermark", func(t *testing.T) {
+		gauge := &recordingGauge{}
+		middleware := NewBackpressureMiddleware(func() int { return 10 }, 10, time.Second).WithGauge(gauge)
+
+		start := time.Now()
+		next, err := middleware.Handle(newTestWorkflowContext(), nextStepHandler)
+		require.NoError(t, err)
+		assert.Equal(t, "ship", *next)
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+		assert.Equal(t, time.Duration(0), middleware.CurrentDelay())
+		assert.Equal(t, []float64{0, 0}, gauge.Values())
+	})
+
+	t.Run("delays grow exponentially while overloaded", func(t *testing.T) {
+		gauge := &recordingGauge{}
+		middleware := NewBackpressureMiddleware(func() int { return 11 }, 10, 8*time.Millisecond).WithGauge(gauge)
+
+		start := time.Now()
+		next, err := middleware.Handle(newTestWorkflowContext(), nextStepHandler)
+		require.NoError(t, err)
+		assert.Equal(t, "ship", *next, "the step is admitted after the maximum delay")
+		assert.GreaterOrEqual(t, time.Since(start), 8*time.Millisecond)
+		assert.Equal(t, []float64{0, 1, 2, 4, 8}, gauge.Values())
+
+		_, err = middleware.Handle(newTestWorkflowContext(), nextStepHandler)
+		require.NoError(t, err)
+		assert.Equal(t, 8*time.Millisecond, middleware.CurrentDelay(), "the delay is capped at the maximum delay")
+	})
+
+	t.Run("queue draining", func(t *testing.T) {
+		var depth int32 = 100
+		gauge := &recordingGauge{}
+		middleware := NewBackpressureMiddleware(func() int {
+			return int(atomic.AddInt32(&depth, -40))
+		}, 10, time.Second).WithGauge(gauge)
+
+		_, err := middleware.Handle(newTestWorkflowContext(), nextStepHandler)
+		require.NoError(t, err)
+		assert.Equal(t, []float64{0, 1, 2, 0}, gauge.Values(), "the delay resets once the queue drains")
+		assert.Equal(t, time.Duration(0), middleware.CurrentDelay())
+	})
+
+	t.Run("cancelled while waiting", func(t *testing.T) {
+		middleware := NewBackpressureMiddleware(func() int { return 11 }, 10, time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		wCtx := newTestWorkflowContext()
+		wCtx.SetContext(ctx)
+
+		executed := false
+		_, err := middleware.Handle(wCtx, func(ctx *WorkflowContext) (*string, error) {
+			executed = true
+			return nil, nil
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, executed)
+	})
+}
@@ -13,6 +13,8 @@ type WorkflowContext struct {
 	CurrentStep  string                 `json:"current_step"`
 	NextStep     *string                `json:"next_step"`
 	Data         WorkflowData           `json:"data"`
+	// Deprecated: use GetMetadata and SetMetadata. The field will be
+	// unexported in the next major version.
 	Metadata     WorkflowMetadata       `json:"metadata"`
 	StepResults  map[string]interface{} `json:"step_results"`
 	StartTime    time.Time              `json:"start_time"`
@@ -20,7 +22,11 @@ type WorkflowContext struct {
 	Status       WorkflowStatus         `json:"status"`
 	Error        error                  `json:"error,omitempty"`
 	StepOrder    int                    `json:"step_order"`
+	executionID  string                 `json:"-"`
+	logger       Logger                 `json:"-"`
 	ctx          context.Context        `json:"-"`
+	timers       map[string]time.Time   `json:"-"`
+	annotations  sync.Map               `json:"-"`
 	mu           sync.RWMutex           `json:"-"`
 }
 
@@ -176,14 +182,34 @@ func (wc *WorkflowContext) SetWaiting(triggerKey string) {
 	wc.Metadata.SetExecutionMetric("waiting_since", time.Now())
 }
 
+// GetMetadata returns the workflow metadata
+func (wc *WorkflowContext) GetMetadata() WorkflowMetadata {
+	wc.mu.RLock()
+	defer wc.mu.RUnlock()
+	return wc.Metadata
+}
+
+// SetMetadata replaces the workflow metadata
+func (wc *WorkflowContext) SetMetadata(metadata WorkflowMetadata) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.Metadata = metadata
+}
+
 // GetData returns the workflow data
 func (wc *WorkflowContext) GetData(key string) (interface{}, bool) {
 	return wc.Data.Get(key)
 }
 
-// SetData sets workflow data
-func (wc *WorkflowContext) SetData(key string, value interface{}) {
+// SetData sets workflow data. It returns a *SchemaViolationError, and stores
+// nothing, if the data is a CheckedWorkflowData and the value violates its
+// schema.
+func (wc *WorkflowContext) SetData(key string, value interface{}) error {
+	if checked, ok := wc.Data.(CheckedWorkflowData); ok {
+		return checked.SetChecked(key, value)
+	}
 	wc.Data.Set(key, value)
+	return nil
 }
 
 // GetStepResult returns a step result
@@ -225,4 +251,149 @@ func (wc *WorkflowContext) GetStepOrder() int {
 	wc.mu.RLock()
 	defer wc.mu.RUnlock()
 	return wc.StepOrder
-}
\ No newline at end of file
+}
+
+// GetElapsed returns the wall-clock time since the workflow started
+func (wc *WorkflowContext) GetElapsed() time.Duration {
+	wc.mu.RLock()
+	defer wc.mu.RUnlock()
+	return time.Since(wc.StartTime)
+}
+
+// StartTimer starts a named timer
+func (wc *WorkflowContext) StartTimer(name string) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if wc.timers == nil {
+		wc.timers = make(map[string]time.Time)
+	}
+	wc.timers[name] = time.Now()
+}
+
+// StopTimer stops a named timer, records its duration as the "timer_<name>"
+// execution metric and returns it. It returns zero if the timer was not started.
+func (wc *WorkflowContext) StopTimer(name string) time.Duration {
+	wc.mu.Lock()
+	start, exists := wc.timers[name]
+	if exists {
+		delete(wc.timers, name)
+	}
+	wc.mu.Unlock()
+
+	if !exists {
+		return 0
+	}
+
+	duration := time.Since(start)
+	wc.GetMetadata().SetExecutionMetric("timer_"+name, duration)
+	return duration
+}
+
+// MeasureBlock times fn as the named timer and returns fn's error unchanged.
+// The timer is stopped even if fn panics.
+func (wc *WorkflowContext) MeasureBlock(name string, fn func() error) error {
+	wc.StartTimer(name)
+	defer wc.StopTimer(name)
+	return fn()
+}
+
+// MeasureVoid times fn as the named timer
+func (wc *WorkflowContext) MeasureVoid(name string, fn func()) {
+	wc.StartTimer(name)
+	defer wc.StopTimer(name)
+	fn()
+}
+
+// Annotate attaches a label to the current step. Telemetry middleware reads
+// the labels after the step ran; the engine clears them before the next step.
+func (wc *WorkflowContext) Annotate(key, value string) {
+	wc.annotations.Store(key, value)
+}
+
+// GetAnnotations returns a copy of the labels attached to the current step
+func (wc *WorkflowContext) GetAnnotations() map[string]string {
+	annotations := make(map[string]string)
+	wc.annotations.Range(func(key, value interface{}) bool {
+		annotations[key.(string)] = value.(string)
+		return true
+	})
+	return annotations
+}
+
+// ResetAnnotations removes the labels attached to the current step
+func (wc *WorkflowContext) ResetAnnotations() {
+	wc.annotations.Range(func(key, value interface{}) bool {
+		wc.annotations.Delete(key)
+		return true
+	})
+}
+
+// GetExecutionID returns the ID of the engine execution running the workflow
+func (wc *WorkflowContext) GetExecutionID() string {
+	wc.mu.RLock()
+	defer wc.mu.RUnlock()
+	return wc.executionID
+}
+
+// SetLogger sets the logger used by LogDebug, LogInfo, LogWarn and
+// LogError. The engine sets its own logger; steps run outside the engine can
+// set one to log.
+func (wc *WorkflowContext) SetLogger(logger Logger) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.logger = logger
+}
+
+// LogDebug logs a message at DEBUG level with the workflow, step and execution
+// IDs added to the fields
+func (wc *WorkflowContext) LogDebug(message string, fields map[string]interface{}) {
+	if logger, fields := wc.logFields(fields); logger != nil {
+		logger.Debug(message, fields)
+	}
+}
+
+// LogInfo logs a message at INFO level with the workflow, step and execution IDs
+// added to the fields
+func (wc *WorkflowContext) LogInfo(message string, fields map[string]interface{}) {
+	if logger, fields := wc.logFields(fields); logger != nil {
+		logger.Info(message, fields)
+	}
+}
+
+// LogWarn logs a message at WARN level with the workflow, step and execution IDs
+// added to the fields
+func (wc *WorkflowContext) LogWarn(message string, fields map[string]interface{}) {
+	if logger, fields := wc.logFields(fields); logger != nil {
+		logger.Warn(message, fields)
+	}
+}
+
+// LogError logs a message at ERROR level with the workflow, step and execution
+// IDs added to the fields
+func (wc *WorkflowContext) LogError(message string, fields map[string]interface{}) {
+	if logger, fields := wc.logFields(fields); logger != nil {
+		logger.Error(message, fields)
+	}
+}
+
+// logFields returns the logger and a copy of fields with the context IDs.
+// The context IDs win over caller fields of the same name. The logger is nil
+// when none was set, and the message is dropped.
+func (wc *WorkflowContext) logFields(fields map[string]interface{}) (Logger, map[string]interface{}) {
+	wc.mu.RLock()
+	defer wc.mu.RUnlock()
+	if wc.logger == nil {
+		return nil, nil
+	}
+
+	augmented := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		augmented[key] = value
+	}
+	augmented["workflow_id"] = wc.WorkflowID
+	augmented["step_id"] = wc.CurrentStep
+	if wc.executionID != "" {
+		augmented["execution_id"] = wc.executionID
+	}
+	return wc.logger, augmented
+}
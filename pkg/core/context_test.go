@@ -0,0 +1,175 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWorkflowContext() *WorkflowContext {
+	return NewWorkflowContext(context.Background(), "wf-1", "test", nil, nil)
+}
+
+func TestWorkflowContextTimers(t *testing.T) {
+	t.Run("StartTimer and StopTimer", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+
+		wCtx.StartTimer("load")
+		time.Sleep(time.Millisecond)
+		duration := wCtx.StopTimer("load")
+
+		assert.Greater(t, duration, time.Duration(0))
+		metric, exists := wCtx.GetMetadata().GetExecutionMetric("timer_load")
+		require.True(t, exists)
+		assert.Equal(t, duration, metric)
+	})
+
+	t.Run("StopTimer without StartTimer", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+
+		assert.Equal(t, time.Duration(0), wCtx.StopTimer("missing"))
+		_, exists := wCtx.GetMetadata().GetExecutionMetric("timer_missing")
+		assert.False(t, exists)
+	})
+
+	t.Run("MeasureBlock returns error unchanged", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+		expected := errors.New("boom")
+
+		err := wCtx.MeasureBlock("block", func() error {
+			return expected
+		})
+
+		assert.Same(t, expected, err)
+		_, exists := wCtx.GetMetadata().GetExecutionMetric("timer_block")
+		assert.True(t, exists)
+	})
+
+	t.Run("MeasureBlock stops timer on panic", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+
+		assert.Panics(t, func() {
+			_ = wCtx.MeasureBlock("panicky", func() error {
+				panic("boom")
+			})
+		})
+
+		_, exists := wCtx.GetMetadata().GetExecutionMetric("timer_panicky")
+		assert.True(t, exists)
+	})
+
+	t.Run("MeasureVoid", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+		called := false
+
+		wCtx.MeasureVoid("void", func() {
+			called = true
+		})
+
+		assert.True(t, called)
+		_, exists := wCtx.GetMetadata().GetExecutionMetric("timer_void")
+		assert.True(t, exists)
+	})
+}
+
+func TestWorkflowContextGetElapsed(t *testing.T) {
+	wCtx := newTestWorkflowContext()
+	wCtx.StartTime = time.Now().Add(-time.Minute)
+
+	elapsed := wCtx.GetElapsed()
+
+	assert.GreaterOrEqual(t, elapsed, time.Minute)
+	assert.Less(t, elapsed, 2*time.Minute)
+}
+
+func TestWorkflowContextMetadata(t *testing.T) {
+	wCtx := newTestWorkflowContext()
+	require.NotNil(t, wCtx.GetMetadata())
+
+	metadata := NewDefaultWorkflowMetadata()
+	metadata.AddTag("billing")
+	wCtx.SetMetadata(metadata)
+
+	assert.Same(t, metadata, wCtx.GetMetadata())
+	assert.Equal(t, []string{"billing"}, wCtx.GetMetadata().GetTags())
+
+	t.Run("concurrent access", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				wCtx.SetMetadata(NewDefaultWorkflowMetadata())
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			assert.NotNil(t, wCtx.GetMetadata())
+		}
+		<-done
+	})
+}
+
+func TestWorkflowContextAnnotations(t *testing.T) {
+	wCtx := newTestWorkflowContext()
+	assert.Empty(t, wCtx.GetAnnotations())
+
+	wCtx.Annotate("tenant", "acme")
+	wCtx.Annotate("region", "eu")
+	wCtx.Annotate("tenant", "globex")
+
+	annotations := wCtx.GetAnnotations()
+	assert.Equal(t, map[string]string{"tenant": "globex", "region": "eu"}, annotations)
+
+	annotations["tenant"] = "changed"
+	assert.Equal(t, "globex", wCtx.GetAnnotations()["tenant"], "GetAnnotations must return a copy")
+
+	wCtx.ResetAnnotations()
+	assert.Empty(t, wCtx.GetAnnotations())
+}
+
+func TestWorkflowContextError(t *testing.T) {
+	wCtx := newTestWorkflowContext()
+	err := errors.New("payment declined")
+	wCtx.SetError(err)
+
+	// The error stays readable from the exported field next to the logging
+	// methods
+	assert.Equal(t, err, wCtx.Error)
+	assert.Equal(t, err, wCtx.GetError())
+	assert.Equal(t, WorkflowStatusFailed, wCtx.GetStatus())
+}
+
+func TestWorkflowContextLogging(t *testing.T) {
+	t.Run("levels and fields", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+		logger := &recordingLogger{}
+		wCtx.SetLogger(logger)
+		wCtx.SetCurrentStep("fetch")
+
+		fields := map[string]interface{}{"attempt": 2}
+		wCtx.LogDebug("debug", fields)
+		wCtx.LogInfo("info", nil)
+		wCtx.LogWarn("warn", nil)
+		wCtx.LogError("error", nil)
+
+		require.Len(t, logger.entries, 4)
+		for i, level := range []string{"debug", "info", "warn", "error"} {
+			assert.Equal(t, level, logger.entries[i].level)
+			assert.Equal(t, level, logger.entries[i].message)
+			assert.Equal(t, "wf-1", logger.entries[i].fields["workflow_id"])
+			assert.Equal(t, "fetch", logger.entries[i].fields["step_id"])
+			assert.NotContains(t, logger.entries[i].fields, "execution_id", "contexts created outside the engine have no execution")
+		}
+		assert.Equal(t, 2, logger.entries[0].fields["attempt"])
+		assert.Equal(t, map[string]interface{}{"attempt": 2}, fields, "caller fields must not be modified")
+	})
+
+	t.Run("without logger", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			newTestWorkflowContext().LogInfo("dropped", nil)
+		})
+	})
+}
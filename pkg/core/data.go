@@ -9,8 +9,12 @@ import (
 
 // DefaultWorkflowData is the default implementation of WorkflowData
 type DefaultWorkflowData struct {
-	data map[string]interface{}
-	mu   sync.RWMutex
+	data   map[string]interface{}
+	schema WorkflowDataSchema
+	// violations holds the violations of the stored values set without a
+	// check, by key
+	violations map[string]error
+	mu         sync.RWMutex
 }
 
 // NewDefaultWorkflowData creates a new default workflow data instance
@@ -20,6 +24,15 @@ func NewDefaultWorkflowData() WorkflowData {
 	}
 }
 
+// NewDefaultWorkflowDataWithSchema creates a new default workflow data
+// instance enforcing a schema
+func NewDefaultWorkflowDataWithSchema(schema WorkflowDataSchema) *DefaultWorkflowData {
+	return &DefaultWorkflowData{
+		data:   make(map[string]interface{}),
+		schema: schema,
+	}
+}
+
 // NewDefaultWorkflowDataWithMap creates a new default workflow data instance with initial data
 func NewDefaultWorkflowDataWithMap(data map[string]interface{}) WorkflowData {
 	wd := &DefaultWorkflowData{
@@ -40,7 +53,7 @@ func (d *DefaultWorkflowData) Validate() error {
 	if d.data == nil {
 		return fmt.Errorf("workflow data is nil")
 	}
-	return nil
+	return joinViolations(d.violations)
 }
 
 // Convert converts the data to the target type
@@ -83,15 +96,45 @@ func (d *DefaultWorkflowData) Get(key string) (interface{}, bool) {
 	return value, exists
 }
 
-// Set stores a value by key
+// WithSchema sets the schema that SetChecked and FromMapChecked enforce, and
+// that Validate reports the values set without a check against, and returns
+// the data. A nil schema disables the checks. Values already stored are not
+// checked.
+func (d *DefaultWorkflowData) WithSchema(schema WorkflowDataSchema) *DefaultWorkflowData {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.schema = schema
+	return d
+}
+
+// Set stores a value by key. Values that do not match the schema are stored
+// and reported by Validate until they are replaced or deleted.
 func (d *DefaultWorkflowData) Set(key string, value interface{}) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+
+	d.violations = trackViolation(d.violations, d.schema, key, value)
+	if d.data == nil {
+		d.data = make(map[string]interface{})
+	}
+	d.data[key] = value
+}
+
+// SetChecked stores a value by key. It returns a *SchemaViolationError, and
+// stores nothing, if the value does not match the schema.
+func (d *DefaultWorkflowData) SetChecked(key string, value interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
+	if err := d.schema.Check(key, value); err != nil {
+		return err
+	}
+	delete(d.violations, key)
 	if d.data == nil {
 		d.data = make(map[string]interface{})
 	}
 	d.data[key] = value
+	return nil
 }
 
 // Delete removes a value by key
@@ -99,6 +142,7 @@ func (d *DefaultWorkflowData) Delete(key string) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	delete(d.data, key)
+	delete(d.violations, key)
 }
 
 // Has checks if a key exists
@@ -125,6 +169,7 @@ func (d *DefaultWorkflowData) Clear() {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.data = make(map[string]interface{})
+	d.violations = nil
 }
 
 // Size returns the number of items
@@ -145,16 +190,36 @@ func (d *DefaultWorkflowData) ToMap() map[string]interface{} {
 	return result
 }
 
-// FromMap loads data from a map
+// FromMap loads data from a map. Values that do not match the schema are
+// loaded and reported by Validate.
 func (d *DefaultWorkflowData) FromMap(data map[string]interface{}) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.data = make(map[string]interface{})
+	d.violations = nil
 	for k, v := range data {
+		d.violations = trackViolation(d.violations, d.schema, k, v)
 		d.data[k] = v
 	}
 }
 
+// FromMapChecked loads data from a map. It returns the
+// *SchemaViolationError of every value that does not match the schema, and
+// loads nothing, if any does.
+func (d *DefaultWorkflowData) FromMapChecked(data map[string]interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.schema.CheckAll(data); err != nil {
+		return err
+	}
+	d.data = make(map[string]interface{})
+	d.violations = nil
+	for k, v := range data {
+		d.data[k] = v
+	}
+	return nil
+}
+
 // MustGet retrieves a value by key, panics if not found
 func (d *DefaultWorkflowData) MustGet(key string) interface{} {
 	d.mu.RLock()
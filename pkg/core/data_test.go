@@ -373,4 +373,125 @@ func TestWorkflowDataHelpers(t *testing.T) {
 		assert.Error(t, err)
 		assert.Nil(t, value)
 	})
-}
\ No newline at end of file
+}
+func TestWorkflowDataSchema(t *testing.T) {
+	newData := func() *DefaultWorkflowData {
+		return NewDefaultWorkflowDataWithSchema(WorkflowDataSchema{
+			"order_id": DataTypeString,
+			"quantity": DataTypeInt,
+			"amount":   DataTypeFloat64,
+			"paid":     DataTypeBool,
+			"customer": DataTypeMap,
+			"items":    DataTypeSlice,
+		})
+	}
+
+	t.Run("accepts declared types", func(t *testing.T) {
+		data := newData()
+		assert.NoError(t, data.SetChecked("order_id", "ORD-1"))
+		assert.NoError(t, data.SetChecked("quantity", 3))
+		assert.NoError(t, data.SetChecked("quantity", int64(3)))
+		assert.NoError(t, data.SetChecked("amount", 99.99))
+		assert.NoError(t, data.SetChecked("amount", float32(1.5)))
+		assert.NoError(t, data.SetChecked("paid", true))
+		assert.NoError(t, data.SetChecked("customer", map[string]interface{}{"id": "c-1"}))
+		assert.NoError(t, data.SetChecked("items", []string{"a", "b"}))
+		assert.Equal(t, 6, data.Size())
+	})
+
+	t.Run("rejects mismatched types", func(t *testing.T) {
+		data := newData()
+		require.NoError(t, data.SetChecked("amount", 10.0))
+
+		err := data.SetChecked("amount", "10.00")
+		var violation *SchemaViolationError
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, "amount", violation.Key)
+		assert.Equal(t, DataTypeFloat64, violation.Expected)
+		assert.Equal(t, "string", violation.Actual)
+		assert.Equal(t, 10.0, data.MustGet("amount"), "a rejected value must not be stored")
+
+		assert.Error(t, data.SetChecked("quantity", 2.5))
+		assert.Error(t, data.SetChecked("amount", 10))
+		assert.Error(t, data.SetChecked("items", "a,b"))
+		assert.Error(t, data.SetChecked("order_id", nil))
+	})
+
+	t.Run("Validate reports violations of Set", func(t *testing.T) {
+		data := newData()
+		require.NoError(t, data.Validate())
+
+		// Set keeps the signature of WorkflowData, stores the value and
+		// reports it until it is replaced
+		data.Set("amount", "12.00")
+		assert.Equal(t, "12.00", data.MustGet("amount"))
+		var violation *SchemaViolationError
+		require.ErrorAs(t, data.Validate(), &violation)
+		assert.Equal(t, "amount", violation.Key)
+
+		data.Set("amount", 12.0)
+		assert.NoError(t, data.Validate())
+
+		data.Set("paid", "yes")
+		data.Delete("paid")
+		assert.NoError(t, data.Validate())
+	})
+
+	t.Run("FromMap", func(t *testing.T) {
+		tests := map[string]struct {
+			data       map[string]interface{}
+			violations []string
+		}{
+			"matching values": {data: map[string]interface{}{"amount": 10.0, "note": 1}},
+			"one violation":   {data: map[string]interface{}{"amount": "10.00", "paid": true}, violations: []string{"amount"}},
+			"every violation": {data: map[string]interface{}{"quantity": "3", "amount": "10.00"}, violations: []string{"amount", "quantity"}},
+		}
+
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				checked := newData()
+				require.NoError(t, checked.SetChecked("order_id", "ORD-1"))
+				err := checked.FromMapChecked(tt.data)
+
+				unchecked := newData()
+				unchecked.FromMap(tt.data)
+				assert.Equal(t, tt.data, unchecked.GetAll(), "FromMap loads every value")
+
+				if len(tt.violations) == 0 {
+					assert.NoError(t, err)
+					assert.Equal(t, tt.data, checked.GetAll())
+					assert.NoError(t, unchecked.Validate())
+					return
+				}
+				assert.Equal(t, map[string]interface{}{"order_id": "ORD-1"}, checked.GetAll(), "a rejected map must not be loaded")
+				for _, reported := range []error{err, unchecked.Validate()} {
+					for _, key := range tt.violations {
+						assert.ErrorContains(t, reported, "workflow data key '"+key+"'")
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("undeclared keys accept any value", func(t *testing.T) {
+		assert.NoError(t, newData().SetChecked("note", 42))
+	})
+
+	t.Run("no-op without schema", func(t *testing.T) {
+		data := NewDefaultWorkflowDataWithSchema(nil)
+		assert.NoError(t, data.SetChecked("amount", "10.00"))
+
+		data.WithSchema(WorkflowDataSchema{"amount": DataTypeFloat64}).WithSchema(nil)
+		assert.NoError(t, data.SetChecked("amount", "10.00"))
+	})
+
+	t.Run("SetData reports violations", func(t *testing.T) {
+		ctx := NewWorkflowContextSimple("wf-1", "orders", newData())
+		assert.Error(t, ctx.SetData("paid", "yes"))
+		assert.NoError(t, ctx.SetData("paid", false))
+
+		// Data without a schema takes any value
+		plain := NewWorkflowContextSimple("wf-1", "orders", NewDefaultWorkflowDataWithMap(nil))
+		assert.NoError(t, plain.SetData("paid", "yes"))
+	})
+}
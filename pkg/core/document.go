@@ -0,0 +1,582 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/truongtu268/magic-flow/pkg/storage"
+)
+
+// DefaultDocumentThreshold is the encoded size in bytes above which
+// DecodeWorkflowData keeps workflow data as a Document
+const DefaultDocumentThreshold = 1 << 20
+
+// Document is workflow data kept as gzip compressed JSON instead of decoded
+// maps. A top-level value is decoded the first time it is read and then
+// cached, and LookupPath decodes only the value at the path. Set, Delete and
+// the schema behave as for DefaultWorkflowData.
+//
+// GetAll and ToMap decode the whole document on every call, so steps
+// handling large inputs should read the keys they need instead.
+type Document struct {
+	compressed []byte
+	size       int64
+	digest     string
+	fields     []documentField
+	// index maps each key to its last field, which wins for duplicate keys
+	index map[string]int
+	// values holds decoded and set values
+	values map[string]interface{}
+	// changed marks keys that were set or deleted, whose encoded value no
+	// longer applies
+	changed map[string]bool
+	schema  WorkflowDataSchema
+	// violations holds the violations of the values set without a check,
+	// by key
+	violations map[string]error
+	mu         sync.Mutex
+}
+
+// DecodeWorkflowData decodes a JSON object read from r. Objects of at most
+// threshold bytes are decoded into a DefaultWorkflowData; larger ones are
+// compressed into a Document while their syntax is checked, without
+// decoding any value. A threshold of zero or less selects
+// DefaultDocumentThreshold.
+func DecodeWorkflowData(r io.Reader, threshold int64) (WorkflowData, error) {
+	if threshold <= 0 {
+		threshold = DefaultDocumentThreshold
+	}
+
+	head, err := io.ReadAll(io.LimitReader(r, threshold+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow data: %w", err)
+	}
+	if int64(len(head)) <= threshold {
+		var data map[string]interface{}
+		if err := json.Unmarshal(head, &data); err != nil {
+			return nil, fmt.Errorf("failed to decode workflow data: %w", err)
+		}
+		if data == nil {
+			return nil, fmt.Errorf("workflow data must be a JSON object")
+		}
+		return NewDefaultWorkflowDataWithMap(data), nil
+	}
+
+	doc, err := newDocument(io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode workflow data: %w", err)
+	}
+	return doc, nil
+}
+
+func newDocument(r io.Reader) (*Document, error) {
+	var compressed bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&compressed, gzip.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+
+	s := newJSONScanner(io.TeeReader(r, io.MultiWriter(zw, hash)))
+	fields, err := s.indexObject()
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		compressed: compressed.Bytes(),
+		size:       s.offset,
+		digest:     "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		fields:     fields,
+		index:      make(map[string]int, len(fields)),
+		values:     make(map[string]interface{}),
+		changed:    make(map[string]bool),
+	}
+	for i, field := range fields {
+		doc.index[field.key] = i
+	}
+	return doc, nil
+}
+
+// EncodedSize returns the size of the JSON the document was decoded from
+func (d *Document) EncodedSize() int64 {
+	return d.size
+}
+
+// Ref returns a reference to the document for events
+func (d *Document) Ref() *DataRef {
+	return &DataRef{Size: d.size, Digest: d.digest, Keys: d.Keys()}
+}
+
+// Validate checks if the data structure is valid
+func (d *Document) Validate() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return joinViolations(d.violations)
+}
+
+// Convert converts the data to the target type, decoding straight from the
+// encoded document when it has not been changed
+func (d *Document) Convert(target interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var r io.Reader
+	if len(d.changed) == 0 {
+		zr, err := d.open()
+		if err != nil {
+			return err
+		}
+		r = zr
+	} else {
+		var buf bytes.Buffer
+		if _, err := d.writeTo(&buf); err != nil {
+			return fmt.Errorf("failed to marshal data: %w", err)
+		}
+		r = &buf
+	}
+
+	if err := json.NewDecoder(r).Decode(target); err != nil {
+		return fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+	return nil
+}
+
+// GetAll returns all data as a map
+func (d *Document) GetAll() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make(map[string]interface{})
+	if zr, err := d.open(); err == nil {
+		json.NewDecoder(zr).Decode(&result)
+	}
+	for key := range d.changed {
+		delete(result, key)
+	}
+	for key, value := range d.values {
+		result[key] = value
+	}
+	return result
+}
+
+// Get retrieves a value by key
+func (d *Document) Get(key string) (interface{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.get(key)
+}
+
+func (d *Document) get(key string) (interface{}, bool) {
+	if value, exists := d.values[key]; exists {
+		return value, true
+	}
+	i, exists := d.index[key]
+	if !exists || d.changed[key] {
+		return nil, false
+	}
+
+	s, err := d.scan(d.fields[i])
+	if err != nil {
+		return nil, false
+	}
+	value, err := s.readValue()
+	if err != nil {
+		return nil, false
+	}
+	d.values[key] = value
+	return value, true
+}
+
+// lookup returns the value at path, decoding only that value
+func (d *Document) lookup(path []string) (interface{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := path[0]
+	if value, exists := d.values[key]; exists || len(path) == 1 {
+		if !exists {
+			value, exists = d.get(key)
+		}
+		if !exists {
+			return nil, false
+		}
+		return lookupValue(value, path[1:])
+	}
+	i, exists := d.index[key]
+	if !exists || d.changed[key] {
+		return nil, false
+	}
+
+	s, err := d.scan(d.fields[i])
+	if err != nil {
+		return nil, false
+	}
+	if found, err := s.walk(path[1:]); err != nil || !found {
+		return nil, false
+	}
+	value, err := s.readValue()
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// WithSchema sets the schema that SetChecked and FromMapChecked enforce, and
+// that Validate reports the values set without a check against, and returns
+// the document. A nil schema disables the checks. Values already stored are
+// not checked.
+func (d *Document) WithSchema(schema WorkflowDataSchema) *Document {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.schema = schema
+	return d
+}
+
+// Set stores a value by key. Values that do not match the schema are stored
+// and reported by Validate until they are replaced or deleted.
+func (d *Document) Set(key string, value interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.violations = trackViolation(d.violations, d.schema, key, value)
+	d.values[key] = value
+	d.changed[key] = true
+}
+
+// SetChecked stores a value by key. It returns a *SchemaViolationError, and
+// stores nothing, if the value does not match the schema.
+func (d *Document) SetChecked(key string, value interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.schema.Check(key, value); err != nil {
+		return err
+	}
+	delete(d.violations, key)
+	d.values[key] = value
+	d.changed[key] = true
+	return nil
+}
+
+// Delete removes a value by key
+func (d *Document) Delete(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.values, key)
+	delete(d.violations, key)
+	d.changed[key] = true
+}
+
+// Has checks if a key exists
+func (d *Document) Has(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.values[key]; exists {
+		return true
+	}
+	_, exists := d.index[key]
+	return exists && !d.changed[key]
+}
+
+// Keys returns all keys, the encoded ones in document order followed by the
+// set ones
+func (d *Document) Keys() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keys := make([]string, 0, len(d.index))
+	for i, field := range d.fields {
+		if d.index[field.key] == i && !d.changed[field.key] {
+			keys = append(keys, field.key)
+		}
+	}
+	return append(keys, d.setKeys()...)
+}
+
+// setKeys returns the keys of set values in sorted order
+func (d *Document) setKeys() []string {
+	var keys []string
+	for key := range d.changed {
+		if _, exists := d.values[key]; exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Clear removes all data
+func (d *Document) Clear() {
+	d.FromMap(nil)
+}
+
+// Size returns the number of items
+func (d *Document) Size() int {
+	return len(d.Keys())
+}
+
+// ToMap returns data as a map
+func (d *Document) ToMap() map[string]interface{} {
+	return d.GetAll()
+}
+
+// FromMap loads data from a map, dropping the encoded document. Values that
+// do not match the schema are loaded and reported by Validate.
+func (d *Document) FromMap(data map[string]interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.load(data)
+	for k, v := range data {
+		d.violations = trackViolation(d.violations, d.schema, k, v)
+	}
+}
+
+// FromMapChecked loads data from a map, dropping the encoded document. It
+// returns the *SchemaViolationError of every value that does not match the
+// schema, and loads nothing, if any does.
+func (d *Document) FromMapChecked(data map[string]interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.schema.CheckAll(data); err != nil {
+		return err
+	}
+	d.load(data)
+	return nil
+}
+
+// load replaces the document with the values of data
+func (d *Document) load(data map[string]interface{}) {
+	d.compressed = nil
+	d.fields = nil
+	d.index = make(map[string]int)
+	d.values = make(map[string]interface{})
+	d.changed = make(map[string]bool)
+	d.violations = nil
+	for k, v := range data {
+		d.values[k] = v
+		d.changed[k] = true
+	}
+}
+
+// MustGet retrieves a value by key, panics if not found
+func (d *Document) MustGet(key string) interface{} {
+	value, exists := d.Get(key)
+	if !exists {
+		panic(fmt.Sprintf("key '%s' not found in workflow data", key))
+	}
+	return value
+}
+
+// MarshalJSON implements json.Marshaler
+func (d *Document) MarshalJSON() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var buf bytes.Buffer
+	buf.Grow(int(d.size))
+	if _, err := d.writeTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the document as JSON. Values that were not set are copied
+// from the encoded document without being decoded.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.writeTo(w)
+}
+
+func (d *Document) writeTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	if len(d.changed) == 0 {
+		zr, err := d.open()
+		if err != nil {
+			return 0, err
+		}
+		_, err = io.Copy(cw, zr)
+		return cw.n, err
+	}
+
+	var zr io.Reader = bytes.NewReader(nil)
+	if d.compressed != nil {
+		r, err := d.open()
+		if err != nil {
+			return 0, err
+		}
+		zr = r
+	}
+
+	cw.WriteString("{")
+	var pos int64
+	first := true
+	member := func(key string) {
+		if !first {
+			cw.WriteString(",")
+		}
+		first = false
+		encoded, _ := json.Marshal(key)
+		cw.Write(encoded)
+		cw.WriteString(":")
+	}
+
+	for i, field := range d.fields {
+		if d.index[field.key] != i || d.changed[field.key] {
+			continue
+		}
+		if _, err := io.CopyN(io.Discard, zr, field.start-pos); err != nil {
+			return cw.n, err
+		}
+		member(field.key)
+		if _, err := io.CopyN(cw, zr, field.end-field.start); err != nil {
+			return cw.n, err
+		}
+		pos = field.end
+	}
+	for _, key := range d.setKeys() {
+		encoded, err := json.Marshal(d.values[key])
+		if err != nil {
+			return cw.n, fmt.Errorf("failed to marshal %s: %w", key, err)
+		}
+		member(key)
+		cw.Write(encoded)
+	}
+	cw.WriteString("}")
+	return cw.n, cw.err
+}
+
+// open returns a reader of the encoded document
+func (d *Document) open() (io.Reader, error) {
+	if d.compressed == nil {
+		return strings.NewReader("{}"), nil
+	}
+	return gzip.NewReader(bytes.NewReader(d.compressed))
+}
+
+// scan returns a scanner positioned at the value of field
+func (d *Document) scan(field documentField) (*jsonScanner, error) {
+	zr, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, zr, field.start); err != nil {
+		return nil, err
+	}
+	return newJSONScanner(io.LimitReader(zr, field.end-field.start)), nil
+}
+
+// countingWriter counts the bytes written and keeps the first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (c *countingWriter) WriteString(s string) {
+	c.Write([]byte(s))
+}
+
+// LookupPath returns the value at a dot separated path such as
+// "order.items.0.sku", where numeric segments index arrays. A Document
+// decodes only the value at the path.
+func LookupPath(data WorkflowData, path string) (interface{}, bool) {
+	segments := strings.Split(path, ".")
+	if doc, ok := data.(*Document); ok {
+		return doc.lookup(segments)
+	}
+	value, exists := data.Get(segments[0])
+	if !exists {
+		return nil, false
+	}
+	return lookupValue(value, segments[1:])
+}
+
+func lookupValue(value interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			element := v.MapIndex(reflect.ValueOf(segment).Convert(v.Type().Key()))
+			if !element.IsValid() {
+				return nil, false
+			}
+			value = element.Interface()
+		case reflect.Slice, reflect.Array:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= v.Len() {
+				return nil, false
+			}
+			value = v.Index(index).Interface()
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// ApplyMapping builds a map with a value for each key of mapping, taken
+// from the path the key maps to. It fails if a path does not exist.
+func ApplyMapping(data WorkflowData, mapping map[string]string) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(mapping))
+	for key, path := range mapping {
+		value, exists := LookupPath(data, path)
+		if !exists {
+			return nil, fmt.Errorf("mapping for '%s': path '%s' not found", key, path)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// SetRecordData stores data in a workflow record, as RawData for a
+// Document and as Data otherwise
+func SetRecordData(record *storage.WorkflowRecord, data WorkflowData) error {
+	if doc, ok := data.(*Document); ok {
+		raw, err := doc.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to encode workflow data: %w", err)
+		}
+		record.Data = nil
+		record.RawData = raw
+		return nil
+	}
+	record.Data = data.GetAll()
+	record.RawData = nil
+	return nil
+}
+
+// RecordData returns the workflow data stored in a record
+func RecordData(record *storage.WorkflowRecord) (WorkflowData, error) {
+	if record.RawData != nil {
+		return DecodeWorkflowData(bytes.NewReader(record.RawData), DefaultDocumentThreshold)
+	}
+	return NewDefaultWorkflowDataWithMap(record.Data), nil
+}
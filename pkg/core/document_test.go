@@ -0,0 +1,414 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/truongtu268/magic-flow/pkg/storage"
+)
+
+const documentInput = `{
+	"order_id": "ord-1",
+	"quantity": 3,
+	"amount": 99.5,
+	"rush": true,
+	"ratio": -1.25e-3,
+	"customer": {"name": "Zoë \"Z\" Ng", "tags": ["vip", "eu"], "address": {"city": "Oslo", "zip": null}},
+	"items": [{"sku": "a-1", "qty": 1}, {"sku": "bé-2", "qty": 2, "dims": [1, 2.5, 0]}],
+	"empty": {},
+	"none": [],
+	"we.ird\\key": "x"
+}`
+
+func decodeDocument(t *testing.T, input string) *Document {
+	t.Helper()
+	data, err := DecodeWorkflowData(strings.NewReader(input), 16)
+	require.NoError(t, err)
+	doc, ok := data.(*Document)
+	require.True(t, ok, "input above the threshold must be kept as a document")
+	return doc
+}
+
+func TestDecodeWorkflowData(t *testing.T) {
+	t.Run("small input is decoded eagerly", func(t *testing.T) {
+		data, err := DecodeWorkflowData(strings.NewReader(documentInput), 0)
+		require.NoError(t, err)
+		require.IsType(t, &DefaultWorkflowData{}, data)
+
+		var expected map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(documentInput), &expected))
+		assert.Equal(t, expected, data.GetAll())
+	})
+
+	t.Run("large input is kept as a document", func(t *testing.T) {
+		doc := decodeDocument(t, documentInput)
+		assert.Equal(t, int64(len(documentInput)), doc.EncodedSize())
+		assert.Equal(t, []string{"order_id", "quantity", "amount", "rush", "ratio", "customer", "items", "empty", "none", "we.ird\\key"}, doc.Keys())
+		assert.Equal(t, 10, doc.Size())
+
+		var expected map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(documentInput), &expected))
+		assert.Equal(t, expected, doc.GetAll())
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		for _, input := range []string{
+			`[1, 2, 3]`,
+			`null`,
+			`{"a": 1,}`,
+			`{"a": 01}`,
+			`{"a": 1.}`,
+			`{"a": -}`,
+			`{"a": "unterminated}`,
+			`{"a": "bad \q escape"}`,
+			`{"a": tru}`,
+			`{"a": [1 2]}`,
+			`{"a": 1} trailing`,
+			`{"a": 1`,
+			`{a: 1}`,
+		} {
+			padded := input + strings.Repeat(" ", 32)
+			_, eagerErr := DecodeWorkflowData(strings.NewReader(padded), 1<<10)
+			_, lazyErr := DecodeWorkflowData(strings.NewReader(padded), 8)
+			assert.Error(t, eagerErr, input)
+			assert.Error(t, lazyErr, input)
+		}
+	})
+}
+
+func TestDocumentMatchesEagerData(t *testing.T) {
+	eager, err := DecodeWorkflowData(strings.NewReader(documentInput), 0)
+	require.NoError(t, err)
+
+	paths := []string{
+		"order_id", "quantity", "amount", "rush", "ratio",
+		"customer", "customer.name", "customer.tags", "customer.tags.1", "customer.address.city", "customer.address.zip",
+		"items.0", "items.1.sku", "items.1.dims.1", "items.1.dims.2", "empty", "none", "we",
+		"missing", "customer.missing", "items.2", "items.-1", "items.sku", "order_id.0", "none.0", "customer.tags.x",
+	}
+	for _, path := range paths {
+		lazy := decodeDocument(t, documentInput)
+		expected, expectedFound := LookupPath(eager, path)
+		actual, found := LookupPath(lazy, path)
+		assert.Equal(t, expectedFound, found, path)
+		assert.Equal(t, expected, actual, path)
+	}
+
+	mapping := map[string]string{
+		"id":    "order_id",
+		"city":  "customer.address.city",
+		"sku":   "items.1.sku",
+		"width": "items.1.dims.1",
+		"tags":  "customer.tags",
+	}
+	expected, err := ApplyMapping(eager, mapping)
+	require.NoError(t, err)
+	actual, err := ApplyMapping(decodeDocument(t, documentInput), mapping)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	_, err = ApplyMapping(decodeDocument(t, documentInput), map[string]string{"zip": "customer.address.postcode"})
+	assert.EqualError(t, err, "mapping for 'zip': path 'customer.address.postcode' not found")
+}
+
+func TestDocument(t *testing.T) {
+	t.Run("typed getters", func(t *testing.T) {
+		doc := decodeDocument(t, documentInput)
+
+		str, err := GetString(doc, "order_id")
+		require.NoError(t, err)
+		assert.Equal(t, "ord-1", str)
+		n, err := GetInt(doc, "quantity")
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+		f, err := GetFloat64(doc, "amount")
+		require.NoError(t, err)
+		assert.Equal(t, 99.5, f)
+		b, err := GetBool(doc, "rush")
+		require.NoError(t, err)
+		assert.True(t, b)
+		slice, err := GetSlice(doc, "items")
+		require.NoError(t, err)
+		assert.Len(t, slice, 2)
+		m, err := GetMap(doc, "customer")
+		require.NoError(t, err)
+		assert.Equal(t, "Oslo", m["address"].(map[string]interface{})["city"])
+
+		_, err = GetString(doc, "missing")
+		assert.Error(t, err)
+		_, err = GetString(doc, "quantity")
+		assert.Error(t, err)
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		doc := decodeDocument(t, documentInput)
+		doc.WithSchema(WorkflowDataSchema{"amount": DataTypeFloat64})
+
+		err := doc.SetChecked("amount", "99.99")
+		var violation *SchemaViolationError
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, "amount", violation.Key)
+
+		amount, err := GetFloat64(doc, "amount")
+		require.NoError(t, err)
+		assert.Equal(t, 99.5, amount)
+
+		require.NoError(t, doc.SetChecked("amount", 12.5))
+		amount, err = GetFloat64(doc, "amount")
+		require.NoError(t, err)
+		assert.Equal(t, 12.5, amount)
+
+		doc.Set("amount", "13.00")
+		require.ErrorAs(t, doc.Validate(), &violation, "values set without a check are reported")
+		doc.Set("amount", 13.0)
+		assert.NoError(t, doc.Validate())
+
+		err = doc.FromMapChecked(map[string]interface{}{"amount": "13.00"})
+		require.ErrorAs(t, err, &violation)
+		amount, err = GetFloat64(doc, "amount")
+		require.NoError(t, err)
+		assert.Equal(t, 13.0, amount, "a rejected map must not be loaded")
+	})
+
+	t.Run("set and delete", func(t *testing.T) {
+		doc := decodeDocument(t, documentInput)
+		require.NoError(t, doc.SetChecked("quantity", 4))
+		require.NoError(t, doc.SetChecked("note", "fragile"))
+		doc.Delete("customer")
+		doc.Delete("missing")
+
+		assert.False(t, doc.Has("customer"))
+		assert.True(t, doc.Has("note"))
+		_, exists := LookupPath(doc, "customer.name")
+		assert.False(t, exists)
+		assert.Equal(t, []string{"order_id", "amount", "rush", "ratio", "items", "empty", "none", "we.ird\\key", "note", "quantity"}, doc.Keys())
+
+		var expected map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(documentInput), &expected))
+		expected["quantity"] = 4
+		expected["note"] = "fragile"
+		delete(expected, "customer")
+		assert.Equal(t, expected, doc.GetAll())
+
+		encoded, err := doc.MarshalJSON()
+		require.NoError(t, err)
+		expectedJSON, err := json.Marshal(expected)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(expectedJSON), string(encoded))
+	})
+
+	t.Run("unchanged document encodes to its input", func(t *testing.T) {
+		doc := decodeDocument(t, documentInput)
+		_, _ = doc.Get("customer")
+
+		encoded, err := doc.MarshalJSON()
+		require.NoError(t, err)
+		assert.Equal(t, documentInput, string(encoded))
+	})
+
+	t.Run("duplicate keys keep the last value", func(t *testing.T) {
+		doc := decodeDocument(t, `{"a": 1, "b": 2, "a": 3}`)
+		assert.Equal(t, []string{"b", "a"}, doc.Keys())
+		value, _ := doc.Get("a")
+		assert.Equal(t, float64(3), value)
+	})
+
+	t.Run("convert", func(t *testing.T) {
+		type order struct {
+			OrderID  string `json:"order_id"`
+			Quantity int    `json:"quantity"`
+		}
+		doc := decodeDocument(t, documentInput)
+		var o order
+		require.NoError(t, doc.Convert(&o))
+		assert.Equal(t, order{OrderID: "ord-1", Quantity: 3}, o)
+
+		require.NoError(t, doc.SetChecked("quantity", 7))
+		require.NoError(t, doc.Convert(&o))
+		assert.Equal(t, 7, o.Quantity)
+	})
+
+	t.Run("clear and from map", func(t *testing.T) {
+		doc := decodeDocument(t, documentInput)
+		doc.Clear()
+		assert.Equal(t, 0, doc.Size())
+		assert.Equal(t, map[string]interface{}{}, doc.GetAll())
+
+		doc.FromMap(map[string]interface{}{"a": "b"})
+		assert.Equal(t, []string{"a"}, doc.Keys())
+		encoded, err := doc.MarshalJSON()
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"a": "b"}`, string(encoded))
+	})
+
+	t.Run("concurrent reads", func(t *testing.T) {
+		doc := decodeDocument(t, documentInput)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value, exists := LookupPath(doc, "items.1.sku")
+				assert.True(t, exists)
+				assert.Equal(t, "bé-2", value)
+				_, exists = doc.Get("customer")
+				assert.True(t, exists)
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestRecordData(t *testing.T) {
+	t.Run("document", func(t *testing.T) {
+		doc := decodeDocument(t, documentInput)
+		record := &storage.WorkflowRecord{}
+		require.NoError(t, SetRecordData(record, doc))
+		assert.Nil(t, record.Data)
+		assert.Equal(t, documentInput, string(record.RawData))
+
+		data, err := RecordData(record)
+		require.NoError(t, err)
+		assert.Equal(t, doc.GetAll(), data.GetAll())
+	})
+
+	t.Run("small data", func(t *testing.T) {
+		record := &storage.WorkflowRecord{}
+		require.NoError(t, SetRecordData(record, NewDefaultWorkflowDataWithMap(map[string]interface{}{"a": "b"})))
+		assert.Nil(t, record.RawData)
+		assert.Equal(t, map[string]interface{}{"a": "b"}, record.Data)
+
+		data, err := RecordData(record)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": "b"}, data.GetAll())
+	})
+}
+
+func TestRecordDataJSONRoundTrip(t *testing.T) {
+	tests := map[string]WorkflowData{
+		"document":   decodeDocument(t, documentInput),
+		"small data": NewDefaultWorkflowDataWithMap(map[string]interface{}{"a": "b"}),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			record := &storage.WorkflowRecord{}
+			require.NoError(t, SetRecordData(record, data))
+
+			encoded, err := json.Marshal(record)
+			require.NoError(t, err)
+			var decoded storage.WorkflowRecord
+			require.NoError(t, json.Unmarshal(encoded, &decoded))
+
+			restored, err := RecordData(&decoded)
+			require.NoError(t, err)
+			assert.Equal(t, data.GetAll(), restored.GetAll())
+		})
+	}
+}
+
+func TestWorkflowEngineDocumentEvents(t *testing.T) {
+	engine := newTestEngine()
+	events := make(chan *WorkflowEvent, 1)
+	engine.AddEventHandler(WorkflowEventCompleted, func(event *WorkflowEvent) error {
+		events <- event
+		return nil
+	})
+
+	doc := decodeDocument(t, documentInput)
+	err := engine.Execute(context.Background(), "wf-doc", []Step{
+		NewFunctionStep("noop", "", func(ctx *WorkflowContext) (*string, error) { return nil, nil }),
+	}, doc)
+	require.NoError(t, err)
+
+	event := <-events
+	assert.Nil(t, event.Data)
+	require.NotNil(t, event.DataRef)
+	assert.Equal(t, int64(len(documentInput)), event.DataRef.Size)
+	assert.True(t, strings.HasPrefix(event.DataRef.Digest, "sha256:"))
+	assert.Equal(t, doc.Keys(), event.DataRef.Keys)
+}
+
+// largeInput is a JSON object of about 50MB: a small header and a large
+// array of line items
+var (
+	largeInput     []byte
+	largeInputOnce sync.Once
+)
+
+func benchmarkInput(b *testing.B) []byte {
+	largeInputOnce.Do(func() {
+		var buf bytes.Buffer
+		buf.WriteString(`{"order_id":"ord-1","customer":{"name":"Zoë","tier":"gold"},"items":[`)
+		for i := 0; buf.Len() < 50<<20; i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, `{"sku":"sku-%d","qty":%d,"price":%d.25,"note":"line item %d of a very large order","tags":["a","b"]}`, i, i%7, i%100, i)
+		}
+		buf.WriteString(`]}`)
+		largeInput = buf.Bytes()
+	})
+	b.SetBytes(int64(len(largeInput)))
+	return largeInput
+}
+
+var benchmarkMapping = map[string]string{
+	"id":   "order_id",
+	"tier": "customer.tier",
+	"sku":  "items.2.sku",
+}
+
+// BenchmarkLargeInputEager measures submit, one mapping and persist of a
+// 50MB input decoded into maps
+func BenchmarkLargeInputEager(b *testing.B) {
+	input := benchmarkInput(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var m map[string]interface{}
+		if err := json.Unmarshal(input, &m); err != nil {
+			b.Fatal(err)
+		}
+		data := NewDefaultWorkflowDataWithMap(m)
+		if _, err := ApplyMapping(data, benchmarkMapping); err != nil {
+			b.Fatal(err)
+		}
+		record := &storage.WorkflowRecord{}
+		if err := SetRecordData(record, data); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := json.Marshal(record.Data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLargeInputDocument measures submit, one mapping and persist of a
+// 50MB input kept as a Document
+func BenchmarkLargeInputDocument(b *testing.B) {
+	input := benchmarkInput(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := DecodeWorkflowData(bytes.NewReader(input), DefaultDocumentThreshold)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ApplyMapping(data, benchmarkMapping); err != nil {
+			b.Fatal(err)
+		}
+		record := &storage.WorkflowRecord{}
+		if err := SetRecordData(record, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
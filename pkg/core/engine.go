@@ -80,6 +80,10 @@ func (e *WorkflowEngine) Execute(ctx context.Context, workflowID string, steps [
 	
 	// Create workflow context
 	workflowCtx := NewWorkflowContext(ctx, workflowID, "default", data, NewDefaultWorkflowMetadata())
+	workflowCtx.executionID = uuid.New().String()
+	workflowCtx.logger = e.logger
+	// Start the workflow clock before any middleware runs
+	workflowCtx.StartTime = time.Now()
 	workflowCtx.SetStatus(WorkflowStatusRunning)
 	
 	// Store workflow in running workflows
@@ -118,8 +122,9 @@ func (e *WorkflowEngine) Execute(ctx context.Context, workflowID string, steps [
 
 // ExecuteStep executes a single step
 func (e *WorkflowEngine) ExecuteStep(ctx context.Context, step Step, workflowCtx *WorkflowContext) error {
-	// Set current step
+	// Set current step, dropping the annotations of the previous one
 	workflowCtx.SetCurrentStep(step.GetName())
+	workflowCtx.ResetAnnotations()
 	
 	// Execute step through middleware chain
 	stepHandler := func(ctx *WorkflowContext) (*string, error) {
@@ -132,6 +137,7 @@ func (e *WorkflowEngine) ExecuteStep(ctx context.Context, step Step, workflowCtx
 			"workflow_id": workflowCtx.GetWorkflowID(),
 			"step_name":   step.GetName(),
 			"error":       err.Error(),
+			"annotations": workflowCtx.GetAnnotations(),
 		})
 		return errors.NewStepFailedError(step.GetName(), err)
 	}
@@ -139,6 +145,7 @@ func (e *WorkflowEngine) ExecuteStep(ctx context.Context, step Step, workflowCtx
 	e.logger.Debug("Step executed successfully", map[string]interface{}{
 		"workflow_id": workflowCtx.GetWorkflowID(),
 		"step_name":   step.GetName(),
+		"annotations": workflowCtx.GetAnnotations(),
 	})
 	
 	return nil
@@ -186,8 +193,6 @@ func (e *WorkflowEngine) GetWorkflowStatus(workflowID string) (WorkflowStatus, e
 		return WorkflowStatusUnknown, errors.NewWorkflowNotFoundError(workflowID)
 	}
 	return record.Status, nil
-	
-	return WorkflowStatusUnknown, errors.NewWorkflowNotFoundError(workflowID)
 }
 
 // CancelWorkflow cancels a running workflow
@@ -263,6 +268,7 @@ func (e *WorkflowEngine) Shutdown(ctx context.Context) error {
 // Private methods
 
 func (e *WorkflowEngine) executeWorkflow(ctx context.Context, workflowCtx *WorkflowContext, steps []Step) error {
+	joins := newParallelJoins(steps)
 	for i, step := range steps {
 		select {
 		case <-ctx.Done():
@@ -285,6 +291,9 @@ func (e *WorkflowEngine) executeWorkflow(ctx context.Context, workflowCtx *Workf
 			// TODO: Add recovery mechanism when needed
 			return err
 		}
+		if err := joins.completed(workflowCtx, step.GetName()); err != nil {
+			return err
+		}
 		
 		// Set next step if not the last step
 		if i < len(steps)-1 {
@@ -295,6 +304,65 @@ func (e *WorkflowEngine) executeWorkflow(ctx context.Context, workflowCtx *Workf
 	return nil
 }
 
+// parallelJoin is a parallel step of a workflow waiting for its branches
+type parallelJoin struct {
+	step    *ParallelStep
+	started bool
+	done    bool
+	// pending holds the branches of the workflow that have not run yet
+	pending map[string]bool
+}
+
+// parallelJoins aggregates the results of the parallel steps of a workflow
+// once the step and every branch the workflow runs have completed, in
+// whichever order they run
+type parallelJoins []*parallelJoin
+
+func newParallelJoins(steps []Step) parallelJoins {
+	names := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		names[step.GetName()] = true
+	}
+	
+	var joins parallelJoins
+	for _, step := range steps {
+		parallel, ok := step.(*ParallelStep)
+		if !ok {
+			continue
+		}
+		join := &parallelJoin{step: parallel, pending: make(map[string]bool)}
+		for _, branch := range parallel.Steps {
+			if names[branch] {
+				join.pending[branch] = true
+			}
+		}
+		joins = append(joins, join)
+	}
+	return joins
+}
+
+// completed records a completed step and aggregates the results of the
+// parallel steps it completes
+func (j parallelJoins) completed(workflowCtx *WorkflowContext, name string) error {
+	for _, join := range j {
+		if join.done {
+			continue
+		}
+		if join.step.GetName() == name {
+			join.started = true
+		}
+		delete(join.pending, name)
+		if !join.started || len(join.pending) > 0 {
+			continue
+		}
+		join.done = true
+		if err := join.step.AggregateResults(workflowCtx); err != nil {
+			return errors.NewStepFailedError(join.step.GetName(), err)
+		}
+	}
+	return nil
+}
+
 func (e *WorkflowEngine) emitEvent(eventType WorkflowEventType, workflowCtx *WorkflowContext) {
 	e.mu.RLock()
 	handlers := e.eventHandlers[eventType]
@@ -309,7 +377,12 @@ func (e *WorkflowEngine) emitEvent(eventType WorkflowEventType, workflowCtx *Wor
 		Type:        eventType,
 		WorkflowID:  workflowCtx.GetWorkflowID(),
 		Timestamp:   time.Now(),
-		Data:        workflowCtx.Data.GetAll(),
+	}
+	// Oversized data is referenced rather than copied into every event
+	if doc, ok := workflowCtx.Data.(*Document); ok {
+		event.DataRef = doc.Ref()
+	} else {
+		event.Data = workflowCtx.Data.GetAll()
 	}
 	
 	// Execute handlers in goroutines to avoid blocking
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/truongtu268/magic-flow/pkg/config"
+)
+
+type middlewareFunc func(ctx *WorkflowContext, next StepHandler) (*string, error)
+
+func (f middlewareFunc) Handle(ctx *WorkflowContext, next StepHandler) (*string, error) {
+	return f(ctx, next)
+}
+
+func newTestEngine() *WorkflowEngine {
+	return &WorkflowEngine{
+		config:          config.DefaultConfig(),
+		logger:          &DefaultLogger{},
+		eventHandlers:   make(map[WorkflowEventType][]WorkflowEventHandler),
+		shutdownChan:    make(chan struct{}),
+		middlewareChain: NewMiddlewareChain(),
+	}
+}
+
+func TestWorkflowEngineStartTime(t *testing.T) {
+	engine := newTestEngine()
+	before := time.Now()
+
+	var middlewareStart time.Time
+	engine.AddMiddleware(middlewareFunc(func(ctx *WorkflowContext, next StepHandler) (*string, error) {
+		if middlewareStart.IsZero() {
+			middlewareStart = ctx.StartTime
+		}
+		return next(ctx)
+	}))
+
+	var elapsed []time.Duration
+	step := func(ctx *WorkflowContext) (*string, error) {
+		time.Sleep(time.Millisecond)
+		elapsed = append(elapsed, ctx.GetElapsed())
+		return nil, nil
+	}
+
+	err := engine.Execute(context.Background(), "wf-1", []Step{
+		NewFunctionStep("first", "", step),
+		NewFunctionStep("second", "", step),
+	}, NewDefaultWorkflowData())
+	require.NoError(t, err)
+
+	assert.False(t, middlewareStart.Before(before), "start time must be set when Execute is called")
+	require.Len(t, elapsed, 2)
+	assert.Greater(t, elapsed[1], elapsed[0], "elapsed time must cover the whole workflow")
+}
+
+func TestWorkflowEngineAnnotations(t *testing.T) {
+	engine := newTestEngine()
+
+	seen := map[string]map[string]string{}
+	engine.AddMiddleware(middlewareFunc(func(ctx *WorkflowContext, next StepHandler) (*string, error) {
+		ctx.Annotate("middleware", "before")
+		nextStep, err := next(ctx)
+		seen[ctx.GetCurrentStep()] = ctx.GetAnnotations()
+		return nextStep, err
+	}))
+
+	err := engine.Execute(context.Background(), "wf-1", []Step{
+		NewFunctionStep("first", "", func(ctx *WorkflowContext) (*string, error) {
+			ctx.Annotate("customer", "c-1")
+			return nil, nil
+		}),
+		NewFunctionStep("second", "", func(ctx *WorkflowContext) (*string, error) {
+			return nil, nil
+		}),
+	}, NewDefaultWorkflowData())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"middleware": "before", "customer": "c-1"}, seen["first"])
+	assert.Equal(t, map[string]string{"middleware": "before"}, seen["second"], "annotations must not leak into the next step")
+}
+
+// logEntry is a message captured by recordingLogger
+type logEntry struct {
+	level   string
+	message string
+	fields  map[string]interface{}
+}
+
+// recordingLogger captures the messages it is asked to log
+type recordingLogger struct {
+	entries []logEntry
+}
+
+func (l *recordingLogger) record(level, message string, fields map[string]interface{}) {
+	l.entries = append(l.entries, logEntry{level: level, message: message, fields: fields})
+}
+
+func (l *recordingLogger) Debug(message string, fields map[string]interface{}) {
+	l.record("debug", message, fields)
+}
+
+func (l *recordingLogger) Info(message string, fields map[string]interface{}) {
+	l.record("info", message, fields)
+}
+
+func (l *recordingLogger) Warn(message string, fields map[string]interface{}) {
+	l.record("warn", message, fields)
+}
+
+func (l *recordingLogger) Error(message string, fields map[string]interface{}) {
+	l.record("error", message, fields)
+}
+
+// entriesWithMessage returns the entries logged with the given message
+func (l *recordingLogger) entriesWithMessage(message string) []logEntry {
+	var entries []logEntry
+	for _, entry := range l.entries {
+		if entry.message == message {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestWorkflowEngineStepLogging(t *testing.T) {
+	engine := newTestEngine()
+	logger := &recordingLogger{}
+	engine.logger = logger
+
+	step := func(ctx *WorkflowContext) (*string, error) {
+		ctx.LogWarn("Stock is low", map[string]interface{}{"sku": "sku-1", "step_id": "spoofed"})
+		return nil, nil
+	}
+	err := engine.Execute(context.Background(), "wf-1", []Step{
+		NewFunctionStep("reserve", "", step),
+		NewFunctionStep("ship", "", step),
+	}, NewDefaultWorkflowData())
+	require.NoError(t, err)
+
+	entries := logger.entriesWithMessage("Stock is low")
+	require.Len(t, entries, 2)
+	for i, stepID := range []string{"reserve", "ship"} {
+		assert.Equal(t, "warn", entries[i].level)
+		assert.Equal(t, "wf-1", entries[i].fields["workflow_id"])
+		assert.Equal(t, stepID, entries[i].fields["step_id"], "the context IDs win over caller fields")
+		assert.Equal(t, "sku-1", entries[i].fields["sku"])
+		assert.NotEmpty(t, entries[i].fields["execution_id"])
+	}
+	assert.Equal(t, entries[0].fields["execution_id"], entries[1].fields["execution_id"])
+}
+
+func TestWorkflowEngineParallelAggregation(t *testing.T) {
+	branch := func(name string, count int) Step {
+		return NewFunctionStep(name, "", func(ctx *WorkflowContext) (*string, error) {
+			ctx.SetStepResult(name, map[string]interface{}{"count": count})
+			return nil, nil
+		})
+	}
+
+	tests := map[string]struct {
+		steps    func(fanIn Step) []Step
+		strategy ResultAggregationStrategy
+		result   interface{}
+		err      bool
+	}{
+		"branches after the parallel step": {
+			steps: func(fanIn Step) []Step {
+				return []Step{fanIn, branch("left", 1), branch("right", 2)}
+			},
+			strategy: SumStrategy{},
+			result:   map[string]interface{}{"count": 3},
+		},
+		"branches before the parallel step": {
+			steps: func(fanIn Step) []Step {
+				return []Step{branch("left", 1), branch("right", 2), fanIn}
+			},
+			strategy: SumStrategy{},
+			result:   map[string]interface{}{"count": 3},
+		},
+		"default merge": {
+			steps: func(fanIn Step) []Step {
+				return []Step{fanIn, branch("left", 1), branch("right", 2)}
+			},
+			result: map[string]interface{}{"count": 2},
+		},
+		"aggregation error fails the workflow": {
+			steps: func(fanIn Step) []Step {
+				return []Step{fanIn, branch("left", 1), NewFunctionStep("right", "", func(ctx *WorkflowContext) (*string, error) {
+					ctx.SetStepResult("right", map[string]interface{}{"count": "two"})
+					return nil, nil
+				})}
+			},
+			strategy: SumStrategy{},
+			err:      true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			fanIn := NewParallelStep("fan-in", "", []string{"left", "right"}, "", tt.strategy)
+			// The step after the branches sees the aggregated result
+			var joined interface{}
+			report := NewFunctionStep("report", "", func(ctx *WorkflowContext) (*string, error) {
+				joined, _ = ctx.GetStepResult("fan-in")
+				return nil, nil
+			})
+
+			err := newTestEngine().Execute(context.Background(), "wf-1", append(tt.steps(fanIn), report), NewDefaultWorkflowData())
+			if tt.err {
+				assert.Error(t, err)
+				assert.Nil(t, joined)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.result, joined)
+		})
+	}
+}
@@ -81,12 +81,14 @@ func (lm *LoggingMiddleware) Handle(ctx *WorkflowContext, next StepHandler) (*st
 			"workflow_id": ctx.GetWorkflowID(),
 			"step_order":  ctx.StepOrder,
 			"error":       err.Error(),
+			"annotations": ctx.GetAnnotations(),
 		})
 	} else {
 		lm.Logger.Info("Step execution completed", map[string]interface{}{
 			"workflow_id": ctx.GetWorkflowID(),
 			"step_order":  ctx.StepOrder,
 			"result":      result,
+			"annotations": ctx.GetAnnotations(),
 		})
 	}
 	
@@ -179,6 +181,7 @@ type Engine interface {
 type WorkflowEventType = events.WorkflowEventType
 type WorkflowEvent = events.WorkflowEvent
 type WorkflowEventHandler = events.WorkflowEventHandler
+type DataRef = events.DataRef
 
 // Re-export status types for convenience
 type WorkflowStatus = events.WorkflowStatus
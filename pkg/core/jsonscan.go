@@ -0,0 +1,467 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxDocumentDepth is the nesting depth above which documents are rejected,
+// the same limit encoding/json applies
+const maxDocumentDepth = 10000
+
+// jsonScanner validates and skips JSON values read from a stream without
+// decoding them, tracking the offset of every byte it consumes
+type jsonScanner struct {
+	r      *bufio.Reader
+	offset int64
+	// record, when set, receives a copy of every consumed byte
+	record *bytes.Buffer
+}
+
+// documentField is the byte range of a top-level value in a document
+type documentField struct {
+	key        string
+	start, end int64
+}
+
+func newJSONScanner(r io.Reader) *jsonScanner {
+	return &jsonScanner{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (s *jsonScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSON at offset %d: %s", s.offset, fmt.Sprintf(format, args...))
+}
+
+// next consumes one byte
+func (s *jsonScanner) next() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err == io.EOF {
+		return 0, s.errorf("unexpected end of input")
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.offset++
+	if s.record != nil {
+		s.record.WriteByte(c)
+	}
+	return c, nil
+}
+
+// peek returns the next byte without consuming it, or io.EOF at the end of
+// the input
+func (s *jsonScanner) peek() (byte, error) {
+	b, err := s.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// skipSpace consumes whitespace and returns the next byte without consuming
+// it
+func (s *jsonScanner) skipSpace() (byte, error) {
+	for {
+		c, err := s.peek()
+		if err == io.EOF {
+			return 0, s.errorf("unexpected end of input")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return c, nil
+		}
+		s.next()
+	}
+}
+
+func (s *jsonScanner) expect(want byte) error {
+	if _, err := s.skipSpace(); err != nil {
+		return err
+	}
+	c, err := s.next()
+	if err != nil {
+		return err
+	}
+	if c != want {
+		return s.errorf("expected %q, got %q", want, c)
+	}
+	return nil
+}
+
+// end checks that only whitespace is left in the input
+func (s *jsonScanner) end() error {
+	for {
+		c, err := s.peek()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return s.errorf("unexpected %q after top-level value", c)
+		}
+		s.next()
+	}
+}
+
+// indexObject scans a top-level object and returns the byte range of each of
+// its values
+func (s *jsonScanner) indexObject() ([]documentField, error) {
+	c, err := s.skipSpace()
+	if err != nil {
+		return nil, err
+	}
+	if c != '{' {
+		return nil, fmt.Errorf("workflow data must be a JSON object")
+	}
+	s.next()
+
+	var fields []documentField
+	if c, err = s.skipSpace(); err != nil {
+		return nil, err
+	}
+	if c == '}' {
+		s.next()
+		return fields, s.end()
+	}
+	for {
+		key, err := s.readKey()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.skipSpace(); err != nil {
+			return nil, err
+		}
+		field := documentField{key: key, start: s.offset}
+		if err := s.skipValue(1); err != nil {
+			return nil, err
+		}
+		field.end = s.offset
+		fields = append(fields, field)
+
+		done, err := s.nextMember('}')
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return fields, s.end()
+		}
+	}
+}
+
+// readKey reads an object key and the colon that follows it
+func (s *jsonScanner) readKey() (string, error) {
+	if _, err := s.skipSpace(); err != nil {
+		return "", err
+	}
+	record := s.record
+	var raw bytes.Buffer
+	s.record = &raw
+	err := s.skipString()
+	s.record = record
+	if err != nil {
+		return "", err
+	}
+	if record != nil {
+		record.Write(raw.Bytes())
+	}
+
+	var key string
+	if err := json.Unmarshal(raw.Bytes(), &key); err != nil {
+		return "", s.errorf("invalid object key: %v", err)
+	}
+	return key, s.expect(':')
+}
+
+// nextMember consumes the separator after an object member or array
+// element and reports whether it was the closing delimiter
+func (s *jsonScanner) nextMember(closing byte) (bool, error) {
+	if _, err := s.skipSpace(); err != nil {
+		return false, err
+	}
+	c, err := s.next()
+	if err != nil {
+		return false, err
+	}
+	switch c {
+	case ',':
+		return false, nil
+	case closing:
+		return true, nil
+	default:
+		return false, s.errorf("expected ',' or %q, got %q", closing, c)
+	}
+}
+
+// skipValue consumes one value, checking its syntax
+func (s *jsonScanner) skipValue(depth int) error {
+	if depth > maxDocumentDepth {
+		return s.errorf("exceeded max depth")
+	}
+	c, err := s.skipSpace()
+	if err != nil {
+		return err
+	}
+	switch {
+	case c == '{':
+		s.next()
+		if c, err = s.skipSpace(); err != nil {
+			return err
+		}
+		if c == '}' {
+			s.next()
+			return nil
+		}
+		for {
+			if _, err := s.skipSpace(); err != nil {
+				return err
+			}
+			if err := s.skipString(); err != nil {
+				return err
+			}
+			if err := s.expect(':'); err != nil {
+				return err
+			}
+			if err := s.skipValue(depth + 1); err != nil {
+				return err
+			}
+			done, err := s.nextMember('}')
+			if err != nil || done {
+				return err
+			}
+		}
+	case c == '[':
+		s.next()
+		if c, err = s.skipSpace(); err != nil {
+			return err
+		}
+		if c == ']' {
+			s.next()
+			return nil
+		}
+		for {
+			if err := s.skipValue(depth + 1); err != nil {
+				return err
+			}
+			done, err := s.nextMember(']')
+			if err != nil || done {
+				return err
+			}
+		}
+	case c == '"':
+		return s.skipString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return s.skipNumber()
+	case c == 't':
+		return s.skipLiteral("true")
+	case c == 'f':
+		return s.skipLiteral("false")
+	case c == 'n':
+		return s.skipLiteral("null")
+	default:
+		return s.errorf("unexpected %q", c)
+	}
+}
+
+func (s *jsonScanner) skipString() error {
+	if c, err := s.next(); err != nil {
+		return err
+	} else if c != '"' {
+		return s.errorf("expected string, got %q", c)
+	}
+	for {
+		c, err := s.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '"':
+			return nil
+		case c == '\\':
+			e, err := s.next()
+			if err != nil {
+				return err
+			}
+			switch e {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				for i := 0; i < 4; i++ {
+					h, err := s.next()
+					if err != nil {
+						return err
+					}
+					if !isHexDigit(h) {
+						return s.errorf("invalid unicode escape")
+					}
+				}
+			default:
+				return s.errorf("invalid escape %q", e)
+			}
+		case c < 0x20:
+			return s.errorf("control character in string")
+		}
+	}
+}
+
+func (s *jsonScanner) skipNumber() error {
+	if c, _ := s.peek(); c == '-' {
+		s.next()
+	}
+	c, err := s.next()
+	if err != nil {
+		return err
+	}
+	switch {
+	case c == '0':
+	case c >= '1' && c <= '9':
+		s.skipDigits()
+	default:
+		return s.errorf("invalid number")
+	}
+	if c, _ := s.peek(); c == '.' {
+		s.next()
+		if s.skipDigits() == 0 {
+			return s.errorf("invalid number")
+		}
+	}
+	if c, _ := s.peek(); c == 'e' || c == 'E' {
+		s.next()
+		if c, _ := s.peek(); c == '+' || c == '-' {
+			s.next()
+		}
+		if s.skipDigits() == 0 {
+			return s.errorf("invalid number")
+		}
+	}
+	return nil
+}
+
+func (s *jsonScanner) skipDigits() int {
+	n := 0
+	for {
+		c, err := s.peek()
+		if err != nil || c < '0' || c > '9' {
+			return n
+		}
+		s.next()
+		n++
+	}
+}
+
+func (s *jsonScanner) skipLiteral(literal string) error {
+	for i := 0; i < len(literal); i++ {
+		c, err := s.next()
+		if err != nil {
+			return err
+		}
+		if c != literal[i] {
+			return s.errorf("invalid literal")
+		}
+	}
+	return nil
+}
+
+// readValue consumes one value and decodes it
+func (s *jsonScanner) readValue() (interface{}, error) {
+	var raw bytes.Buffer
+	s.record = &raw
+	err := s.skipValue(1)
+	s.record = nil
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw.Bytes(), &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// walk descends from the value at the scanner's position to the value at
+// path, consuming everything before it. It reports false if the path does
+// not exist.
+func (s *jsonScanner) walk(path []string) (bool, error) {
+	for _, segment := range path {
+		c, err := s.skipSpace()
+		if err != nil {
+			return false, err
+		}
+		switch c {
+		case '{':
+			found, err := s.enterMember(segment)
+			if err != nil || !found {
+				return false, err
+			}
+		case '[':
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 {
+				return false, nil
+			}
+			found, err := s.enterElement(index)
+			if err != nil || !found {
+				return false, err
+			}
+		default:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// enterMember consumes an object up to the value of key
+func (s *jsonScanner) enterMember(key string) (bool, error) {
+	s.next()
+	c, err := s.skipSpace()
+	if err != nil || c == '}' {
+		return false, err
+	}
+	for {
+		name, err := s.readKey()
+		if err != nil {
+			return false, err
+		}
+		if name == key {
+			return true, nil
+		}
+		if err := s.skipValue(1); err != nil {
+			return false, err
+		}
+		done, err := s.nextMember('}')
+		if err != nil || done {
+			return false, err
+		}
+	}
+}
+
+// enterElement consumes an array up to the element at index
+func (s *jsonScanner) enterElement(index int) (bool, error) {
+	s.next()
+	c, err := s.skipSpace()
+	if err != nil || c == ']' {
+		return false, err
+	}
+	for i := 0; ; i++ {
+		if i == index {
+			return true, nil
+		}
+		if err := s.skipValue(1); err != nil {
+			return false, err
+		}
+		done, err := s.nextMember(']')
+		if err != nil || done {
+			return false, err
+		}
+	}
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,11 @@
+//go:build magicflow_deprecations
+
+package core
+
+import "log"
+
+// Building with the magicflow_deprecations tag reports APIs that change in
+// the next major version, so users can migrate ahead of the release.
+func init() {
+	log.Println("magic-flow: WorkflowContext.Metadata is deprecated and will be unexported in the next major version; use GetMetadata and SetMetadata instead")
+}
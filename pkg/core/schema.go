@@ -0,0 +1,141 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DataType is the type a WorkflowDataSchema declares for a key
+type DataType string
+
+const (
+	DataTypeString  DataType = "string"
+	DataTypeInt     DataType = "int"
+	DataTypeFloat64 DataType = "float64"
+	DataTypeBool    DataType = "bool"
+	DataTypeMap     DataType = "map"
+	DataTypeSlice   DataType = "slice"
+)
+
+// WorkflowDataSchema declares the type of workflow data keys. Keys it does
+// not declare accept any value.
+type WorkflowDataSchema map[string]DataType
+
+// CheckedWorkflowData is workflow data that reports the values violating
+// its schema. DefaultWorkflowData and Document implement it. Set and FromMap
+// store values violating the schema and Validate reports them; SetChecked
+// and FromMapChecked reject them.
+type CheckedWorkflowData interface {
+	WorkflowData
+	// SetChecked stores a value by key, failing with a
+	// *SchemaViolationError if it violates the schema
+	SetChecked(key string, value interface{}) error
+	// FromMapChecked loads data from a map, failing with the
+	// *SchemaViolationError of every value violating the schema, in which
+	// case nothing is loaded
+	FromMapChecked(data map[string]interface{}) error
+}
+
+// SchemaViolationError is returned by CheckedWorkflowData.SetChecked when a
+// value does not have the type the schema declares for its key
+type SchemaViolationError struct {
+	Key      string
+	Expected DataType
+	Actual   string
+}
+
+// Error implements the error interface
+func (e *SchemaViolationError) Error() string {
+	return fmt.Sprintf("workflow data key '%s' expects %s, got %s", e.Key, e.Expected, e.Actual)
+}
+
+// Check returns a *SchemaViolationError if value does not have the type
+// declared for key
+func (s WorkflowDataSchema) Check(key string, value interface{}) error {
+	expected, declared := s[key]
+	if !declared {
+		return nil
+	}
+	if matchesDataType(expected, value) {
+		return nil
+	}
+
+	actual := "nil"
+	if value != nil {
+		actual = reflect.TypeOf(value).String()
+	}
+	return &SchemaViolationError{Key: key, Expected: expected, Actual: actual}
+}
+
+// CheckAll returns the violations of the values of data, joined in the
+// order of their keys, or nil if every value matches the schema
+func (s WorkflowDataSchema) CheckAll(data map[string]interface{}) error {
+	violations := make(map[string]error)
+	for key, value := range data {
+		if err := s.Check(key, value); err != nil {
+			violations[key] = err
+		}
+	}
+	return joinViolations(violations)
+}
+
+// trackViolation records whether the value stored for key violates the
+// schema, replacing the violation of the value it overwrites
+func trackViolation(violations map[string]error, schema WorkflowDataSchema, key string, value interface{}) map[string]error {
+	err := schema.Check(key, value)
+	if err == nil {
+		delete(violations, key)
+		return violations
+	}
+	if violations == nil {
+		violations = make(map[string]error)
+	}
+	violations[key] = err
+	return violations
+}
+
+// joinViolations joins violations in the order of their keys
+func joinViolations(violations map[string]error) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(violations))
+	for key := range violations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = violations[key]
+	}
+	return errors.Join(errs...)
+}
+
+// matchesDataType reports whether value has the given type. Integer types
+// of any size match DataTypeInt and float32 matches DataTypeFloat64, but
+// integers and floats do not match each other.
+func matchesDataType(dataType DataType, value interface{}) bool {
+	if value == nil {
+		return false
+	}
+
+	v := reflect.ValueOf(value)
+	switch dataType {
+	case DataTypeString:
+		return v.Kind() == reflect.String
+	case DataTypeInt:
+		return isInteger(v)
+	case DataTypeFloat64:
+		return v.Kind() == reflect.Float64 || v.Kind() == reflect.Float32
+	case DataTypeBool:
+		return v.Kind() == reflect.Bool
+	case DataTypeMap:
+		return v.Kind() == reflect.Map
+	case DataTypeSlice:
+		return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	default:
+		return false
+	}
+}
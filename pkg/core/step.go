@@ -1,7 +1,11 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"time"
+
+	"github.com/truongtu268/magic-flow/pkg/errors"
 )
 
 // BaseStep provides a base implementation for steps
@@ -125,15 +129,17 @@ func NewWaitStep(name, description, triggerKey, nextStep string) *WaitStep {
 // ParallelStep executes multiple steps in parallel
 type ParallelStep struct {
 	*BaseStep
-	Steps    []string
-	NextStep string
+	Steps      []string
+	NextStep   string
+	Aggregator *StepResultAggregator
 }
 
-// Execute marks the step for parallel execution
+// Execute marks the step for parallel execution. The engine aggregates the
+// results of the branches with AggregateResults once they have all run.
 func (s *ParallelStep) Execute(ctx *WorkflowContext) (*string, error) {
 	// Store parallel steps in metadata for the engine to handle
-	ctx.Metadata.SetExecutionMetric("parallel_steps", s.Steps)
-	ctx.Metadata.SetExecutionMetric("parallel_next_step", s.NextStep)
+	ctx.GetMetadata().SetExecutionMetric("parallel_steps", s.Steps)
+	ctx.GetMetadata().SetExecutionMetric("parallel_next_step", s.NextStep)
 	
 	if s.NextStep != "" {
 		return &s.NextStep, nil
@@ -141,12 +147,50 @@ func (s *ParallelStep) Execute(ctx *WorkflowContext) (*string, error) {
 	return nil, nil
 }
 
-// NewParallelStep creates a new parallel step
-func NewParallelStep(name, description string, steps []string, nextStep string) *ParallelStep {
+// AggregateResults merges the results of the branches that have completed
+// into the result of this step. Branches without a result are left out.
+func (s *ParallelStep) AggregateResults(ctx *WorkflowContext) error {
+	outputs := make([]map[string]interface{}, 0, len(s.Steps))
+	for _, branch := range s.Steps {
+		result, exists := ctx.GetStepResult(branch)
+		if !exists {
+			continue
+		}
+		if output, ok := result.(map[string]interface{}); ok {
+			outputs = append(outputs, output)
+		} else {
+			outputs = append(outputs, map[string]interface{}{branch: result})
+		}
+	}
+	if len(outputs) == 0 {
+		return nil
+	}
+	
+	aggregator := s.Aggregator
+	if aggregator == nil {
+		aggregator = NewStepResultAggregator(nil)
+	}
+	aggregated, err := aggregator.Aggregate(outputs)
+	if err != nil {
+		return fmt.Errorf("result aggregation failed for step %s: %w", s.Name, err)
+	}
+	ctx.SetStepResult(s.Name, aggregated)
+	return nil
+}
+
+// NewParallelStep creates a new parallel step. Branch results are merged with
+// MergeStrategy unless a ResultAggregationStrategy is given.
+func NewParallelStep(name, description string, steps []string, nextStep string, strategy ...ResultAggregationStrategy) *ParallelStep {
+	var aggregation ResultAggregationStrategy
+	if len(strategy) > 0 {
+		aggregation = strategy[0]
+	}
+	
 	return &ParallelStep{
-		BaseStep: NewBaseStep(name, description),
-		Steps:    steps,
-		NextStep: nextStep,
+		BaseStep:   NewBaseStep(name, description),
+		Steps:      steps,
+		NextStep:   nextStep,
+		Aggregator: NewStepResultAggregator(aggregation),
 	}
 }
 
@@ -172,7 +216,7 @@ func (s *RetryStep) Execute(ctx *WorkflowContext) (*string, error) {
 		lastErr = err
 		if attempt < s.MaxRetries {
 			// Store retry attempt in metadata
-			ctx.Metadata.SetExecutionMetric(fmt.Sprintf("retry_attempt_%d", attempt+1), err.Error())
+			ctx.GetMetadata().SetExecutionMetric(fmt.Sprintf("retry_attempt_%d", attempt+1), err.Error())
 		}
 	}
 	
@@ -188,4 +232,60 @@ func NewRetryStep(name, description string, wrappedStep Step, maxRetries int) *R
 		MaxRetries:  maxRetries,
 		RetryCount:  0,
 	}
-}
\ No newline at end of file
+}
+
+// TimeoutStep runs a wrapped step with a deadline of its own, for steps that
+// need a tighter deadline than the engine-level step timeout. The wrapped step
+// must honour the context returned by ctx.GetContext().
+type TimeoutStep struct {
+	*BaseStep
+	WrappedStep Step
+	Timeout     time.Duration
+}
+
+// GetName returns the step name, defaulting to the wrapped step's name
+func (s *TimeoutStep) GetName() string {
+	if s.Name == "" {
+		return s.WrappedStep.GetName()
+	}
+	return s.Name
+}
+
+// GetDescription returns the step description, defaulting to the wrapped
+// step's description
+func (s *TimeoutStep) GetDescription() string {
+	if s.Description == "" {
+		return s.WrappedStep.GetDescription()
+	}
+	return s.Description
+}
+
+// Execute runs the wrapped step with the timeout. A step failing because its
+// deadline passed returns a step timeout error.
+func (s *TimeoutStep) Execute(ctx *WorkflowContext) (*string, error) {
+	parent := ctx.GetContext()
+	if parent == nil {
+		parent = context.Background()
+	}
+	timeoutCtx, cancel := context.WithTimeout(parent, s.Timeout)
+	defer cancel()
+
+	ctx.SetContext(timeoutCtx)
+	defer ctx.SetContext(parent)
+
+	nextStep, err := s.WrappedStep.Execute(ctx)
+	if err != nil && timeoutCtx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		return nil, errors.NewStepTimeoutError(s.GetName(), s.Timeout).WithCause(err)
+	}
+	return nextStep, err
+}
+
+// NewTimeoutStep creates a new timeout step. An empty name or description
+// delegates to the wrapped step.
+func NewTimeoutStep(name, description string, wrappedStep Step, timeout time.Duration) *TimeoutStep {
+	return &TimeoutStep{
+		BaseStep:    NewBaseStep(name, description),
+		WrappedStep: wrappedStep,
+		Timeout:     timeout,
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mferrors "github.com/truongtu268/magic-flow/pkg/errors"
+)
+
+// blockingStep waits for its context to end or for a delay to pass
+func blockingStep(delay time.Duration) *FunctionStep {
+	return NewFunctionStep("fetch", "Fetches the order", func(ctx *WorkflowContext) (*string, error) {
+		select {
+		case <-ctx.GetContext().Done():
+			return nil, ctx.GetContext().Err()
+		case <-time.After(delay):
+			next := "ship"
+			return &next, nil
+		}
+	})
+}
+
+func TestTimeoutStep(t *testing.T) {
+	t.Run("step finishing in time", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+		step := NewTimeoutStep("", "", blockingStep(time.Millisecond), time.Second)
+
+		next, err := step.Execute(wCtx)
+		require.NoError(t, err)
+		assert.Equal(t, "ship", *next)
+		assert.Equal(t, context.Background(), wCtx.GetContext(), "the workflow context is restored")
+	})
+
+	t.Run("step exceeding the timeout", func(t *testing.T) {
+		wCtx := newTestWorkflowContext()
+		step := NewTimeoutStep("", "", blockingStep(time.Second), 10*time.Millisecond)
+
+		next, err := step.Execute(wCtx)
+		assert.Nil(t, next)
+		require.Error(t, err)
+		assert.True(t, mferrors.Is(err, mferrors.ErrStepTimeout))
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.NoError(t, wCtx.GetContext().Err())
+	})
+
+	t.Run("cancelled workflow is not a timeout", func(t *testing.T) {
+		parent, cancel := context.WithCancel(context.Background())
+		cancel()
+		wCtx := NewWorkflowContext(parent, "wf-1", "test", nil, nil)
+
+		_, err := NewTimeoutStep("", "", blockingStep(time.Second), time.Second).Execute(wCtx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.False(t, mferrors.Is(err, mferrors.ErrStepTimeout))
+	})
+
+	t.Run("name and description", func(t *testing.T) {
+		wrapped := blockingStep(0)
+
+		step := NewTimeoutStep("", "", wrapped, time.Second)
+		assert.Equal(t, "fetch", step.GetName())
+		assert.Equal(t, "Fetches the order", step.GetDescription())
+
+		step = NewTimeoutStep("fetch-fast", "Fetches the order within a second", wrapped, time.Second)
+		assert.Equal(t, "fetch-fast", step.GetName())
+		assert.Equal(t, "Fetches the order within a second", step.GetDescription())
+	})
+}
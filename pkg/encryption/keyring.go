@@ -0,0 +1,173 @@
+// Package encryption encrypts the data magic-flow stores when encryption is
+// enabled. Data is encrypted with AES-GCM under the active key of a
+// keyring, and each ciphertext is prefixed with the ID of its key, so that
+// data encrypted before a key rotation is still decrypted with the key it
+// was encrypted with.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// KeySeparator separates the key ID prefix of a ciphertext from the
+// encrypted data: "v2:<base64 nonce and sealed data>"
+const KeySeparator = ":"
+
+// ErrUnknownKey is returned for ciphertexts encrypted with a key the
+// keyring does not hold
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// ErrMalformedCiphertext is returned for values that are not ciphertexts of
+// a keyring
+var ErrMalformedCiphertext = errors.New("malformed ciphertext")
+
+// Key is an AES key of a keyring, 16, 24 or 32 bytes long
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKey parses a base64 encoded key
+func ParseKey(id, encoded string) (Key, error) {
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return Key{}, fmt.Errorf("encryption key %s is not base64 encoded: %w", id, err)
+	}
+	return Key{ID: id, Secret: secret}, nil
+}
+
+// Keyring holds the keys data was encrypted with. New data is encrypted
+// with the active key, data encrypted with historical keys is decrypted
+// with the key named by its prefix.
+type Keyring struct {
+	mu     sync.RWMutex
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring encrypting with the active key. The other
+// keys are historical keys, only decrypting.
+func NewKeyring(active Key, historical ...Key) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, key := range historical {
+		if err := k.add(key); err != nil {
+			return nil, err
+		}
+	}
+	if err := k.Rotate(active); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// add adds a key to the keyring
+func (k *Keyring) add(key Key) error {
+	if key.ID == "" {
+		return errors.New("encryption key ID is required")
+	}
+	if strings.Contains(key.ID, KeySeparator) {
+		return fmt.Errorf("encryption key ID %q must not contain %q", key.ID, KeySeparator)
+	}
+	block, err := aes.NewCipher(key.Secret)
+	if err != nil {
+		return fmt.Errorf("invalid encryption key %s: %w", key.ID, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("invalid encryption key %s: %w", key.ID, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, exists := k.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate encryption key ID %s", key.ID)
+	}
+	k.keys[key.ID] = aead
+	return nil
+}
+
+// Rotate adds a key and makes it the active key. The previous active key
+// stays in the keyring to decrypt the data encrypted with it.
+func (k *Keyring) Rotate(key Key) error {
+	if err := k.add(key); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active = key.ID
+	return nil
+}
+
+// ActiveKeyID returns the ID of the key new data is encrypted with
+func (k *Keyring) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Encrypt encrypts data with the active key
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	k.mu.RLock()
+	id, aead := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	// The key ID is authenticated with the data, so that ciphertexts cannot
+	// be relabelled
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(id))
+	return id + KeySeparator + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts data with the key named by its prefix
+func (k *Keyring) Decrypt(ciphertext string) ([]byte, error) {
+	id, data, err := split(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	aead, ok := k.keys[id]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: too short", ErrMalformedCiphertext)
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with key %s: %w", id, err)
+	}
+	return plaintext, nil
+}
+
+// KeyID returns the ID of the key a ciphertext was encrypted with
+func KeyID(ciphertext string) (string, error) {
+	id, _, err := split(ciphertext)
+	return id, err
+}
+
+// split splits a ciphertext into its key ID and encrypted data
+func split(ciphertext string) (string, []byte, error) {
+	id, encoded, ok := strings.Cut(ciphertext, KeySeparator)
+	if !ok || id == "" {
+		return "", nil, fmt.Errorf("%w: no key ID prefix", ErrMalformedCiphertext)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrMalformedCiphertext, err)
+	}
+	return id, data, nil
+}
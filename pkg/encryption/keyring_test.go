@@ -0,0 +1,153 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(id string, fill byte) Key {
+	return Key{ID: id, Secret: bytes.Repeat([]byte{fill}, 32)}
+}
+
+// memoryCiphertexts is a store of ciphertexts by ID
+type memoryCiphertexts map[string]string
+
+func (m memoryCiphertexts) Scan(ctx context.Context, fn func(id, ciphertext string) error) error {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := fn(id, m[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m memoryCiphertexts) Replace(ctx context.Context, id, ciphertext string) error {
+	m[id] = ciphertext
+	return nil
+}
+
+func TestKeyRotation(t *testing.T) {
+	keyring, err := NewKeyring(testKey("v1", 1))
+	require.NoError(t, err)
+
+	v1Data, err := keyring.Encrypt([]byte(`{"card":"4242"}`))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(v1Data, "v1:"))
+
+	// Rotating to v2 encrypts new data with v2
+	require.NoError(t, keyring.Rotate(testKey("v2", 2)))
+	assert.Equal(t, "v2", keyring.ActiveKeyID())
+	v2Data, err := keyring.Encrypt([]byte(`{"card":"5555"}`))
+	require.NoError(t, err)
+	id, err := KeyID(v2Data)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", id)
+
+	// and still reads v1 data
+	plaintext, err := keyring.Decrypt(v1Data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"card":"4242"}`, string(plaintext))
+	plaintext, err = keyring.Decrypt(v2Data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"card":"5555"}`, string(plaintext))
+
+	// A keyring restarted with v2 active and v1 historical reads both
+	restarted, err := NewKeyring(testKey("v2", 2), testKey("v1", 1))
+	require.NoError(t, err)
+	plaintext, err = restarted.Decrypt(v1Data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"card":"4242"}`, string(plaintext))
+
+	// Without v1 it cannot
+	withoutV1, err := NewKeyring(testKey("v2", 2))
+	require.NoError(t, err)
+	_, err = withoutV1.Decrypt(v1Data)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeyringRejectsTampering(t *testing.T) {
+	keyring, err := NewKeyring(testKey("v2", 2), testKey("v1", 2))
+	require.NoError(t, err)
+	ciphertext, err := keyring.Encrypt([]byte("secret"))
+	require.NoError(t, err)
+
+	// Relabelling a ciphertext with another key ID fails, even when both
+	// keys are equal
+	_, err = keyring.Decrypt("v1:" + strings.TrimPrefix(ciphertext, "v2:"))
+	assert.ErrorContains(t, err, "failed to decrypt with key v1")
+
+	_, err = keyring.Decrypt("plaintext")
+	assert.ErrorIs(t, err, ErrMalformedCiphertext)
+	_, err = keyring.Decrypt("v2:not base64!")
+	assert.ErrorIs(t, err, ErrMalformedCiphertext)
+}
+
+func TestNewKeyringValidation(t *testing.T) {
+	_, err := NewKeyring(Key{ID: "v1", Secret: []byte("short")})
+	assert.ErrorContains(t, err, "invalid encryption key v1")
+
+	_, err = NewKeyring(testKey("", 1))
+	assert.EqualError(t, err, "encryption key ID is required")
+
+	_, err = NewKeyring(testKey("v:1", 1))
+	assert.EqualError(t, err, `encryption key ID "v:1" must not contain ":"`)
+
+	_, err = NewKeyring(testKey("v1", 1), testKey("v1", 2))
+	assert.EqualError(t, err, "duplicate encryption key ID v1")
+
+	key, err := ParseKey("v1", "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+	require.NoError(t, err)
+	assert.Equal(t, testKey("v1", 1), key)
+	_, err = ParseKey("v1", "not base64!")
+	assert.ErrorContains(t, err, "encryption key v1 is not base64 encoded")
+}
+
+func TestReEncrypt(t *testing.T) {
+	keyring, err := NewKeyring(testKey("v1", 1))
+	require.NoError(t, err)
+	store := memoryCiphertexts{}
+	for _, id := range []string{"wf-1", "wf-2"} {
+		store[id], err = keyring.Encrypt([]byte("data of " + id))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, keyring.Rotate(testKey("v2", 2)))
+	store["wf-3"], err = keyring.Encrypt([]byte("data of wf-3"))
+	require.NoError(t, err)
+
+	report, err := ReEncrypt(context.Background(), store, keyring)
+	require.NoError(t, err)
+	assert.Equal(t, &MigrationReport{Scanned: 3, ReEncrypted: 2, Current: 1}, report)
+
+	// Every value is readable with v2 alone
+	v2Only, err := NewKeyring(testKey("v2", 2))
+	require.NoError(t, err)
+	for _, id := range []string{"wf-1", "wf-2", "wf-3"} {
+		plaintext, err := v2Only.Decrypt(store[id])
+		require.NoError(t, err)
+		assert.Equal(t, "data of "+id, string(plaintext))
+	}
+
+	// Running the migration again changes nothing
+	report, err = ReEncrypt(context.Background(), store, keyring)
+	require.NoError(t, err)
+	assert.Equal(t, &MigrationReport{Scanned: 3, Current: 3}, report)
+
+	// Values of unknown keys stop the migration
+	store["wf-4"] = "v0:AAAA"
+	_, err = ReEncrypt(context.Background(), store, keyring)
+	assert.True(t, errors.Is(err, ErrUnknownKey))
+	assert.ErrorContains(t, err, "re-encryption stopped after 4 values: value wf-4")
+}
@@ -0,0 +1,66 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+)
+
+// Ciphertexts are the encrypted values of a store, walked by ReEncrypt
+type Ciphertexts interface {
+	// Scan calls fn with the ID and ciphertext of each encrypted value,
+	// stopping at the first error fn returns
+	Scan(ctx context.Context, fn func(id, ciphertext string) error) error
+	// Replace replaces the ciphertext of a value
+	Replace(ctx context.Context, id, ciphertext string) error
+}
+
+// MigrationReport counts the values of a re-encrypt migration
+type MigrationReport struct {
+	Scanned     int `json:"scanned"`
+	ReEncrypted int `json:"re_encrypted"`
+	// Current values were already encrypted with the active key
+	Current int `json:"current"`
+}
+
+// ReEncrypt re-encrypts the values of a store encrypted with historical
+// keys with the active key, after which the historical keys can be
+// removed from the keyring. Values already encrypted with the active key
+// are left as they are, so an interrupted migration can be run again.
+func ReEncrypt(ctx context.Context, store Ciphertexts, keyring *Keyring) (*MigrationReport, error) {
+	report := &MigrationReport{}
+	active := keyring.ActiveKeyID()
+
+	err := store.Scan(ctx, func(id, ciphertext string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.Scanned++
+
+		keyID, err := KeyID(ciphertext)
+		if err != nil {
+			return fmt.Errorf("value %s: %w", id, err)
+		}
+		if keyID == active {
+			report.Current++
+			return nil
+		}
+
+		plaintext, err := keyring.Decrypt(ciphertext)
+		if err != nil {
+			return fmt.Errorf("value %s: %w", id, err)
+		}
+		reEncrypted, err := keyring.Encrypt(plaintext)
+		if err != nil {
+			return fmt.Errorf("value %s: %w", id, err)
+		}
+		if err := store.Replace(ctx, id, reEncrypted); err != nil {
+			return fmt.Errorf("failed to replace value %s: %w", id, err)
+		}
+		report.ReEncrypted++
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("re-encryption stopped after %d values: %w", report.Scanned, err)
+	}
+	return report, nil
+}
@@ -26,6 +26,19 @@ type WorkflowEvent struct {
 	WorkflowID string                 `json:"workflow_id"`
 	Timestamp  time.Time              `json:"timestamp"`
 	Data       map[string]interface{} `json:"data"`
+	// DataRef replaces Data for workflow data too large to copy into every
+	// event. Handlers that need the values load them from storage.
+	DataRef    *DataRef               `json:"data_ref,omitempty"`
+}
+
+// DataRef identifies the workflow data of an event without carrying it
+type DataRef struct {
+	// Size is the size of the JSON encoded data in bytes
+	Size int64 `json:"size"`
+	// Digest is the SHA-256 digest of the encoded data, as "sha256:<hex>"
+	Digest string `json:"digest"`
+	// Keys are the top-level keys of the data
+	Keys []string `json:"keys"`
 }
 
 // WorkflowEventHandler is a function type for handling workflow events
@@ -32,12 +32,12 @@ func (m *TimingMiddleware) Handle(ctx *core.WorkflowContext, next core.StepHandl
 	duration := time.Since(startTime)
 	
 	// Store timing information in metadata
-	ctx.Metadata.SetExecutionMetric(fmt.Sprintf("step_%s_duration", stepName), duration.String())
-	ctx.Metadata.SetExecutionMetric(fmt.Sprintf("step_%s_start_time", stepName), startTime)
-	ctx.Metadata.SetExecutionMetric(fmt.Sprintf("step_%s_end_time", stepName), time.Now())
+	ctx.GetMetadata().SetExecutionMetric(fmt.Sprintf("step_%s_duration", stepName), duration.String())
+	ctx.GetMetadata().SetExecutionMetric(fmt.Sprintf("step_%s_start_time", stepName), startTime)
+	ctx.GetMetadata().SetExecutionMetric(fmt.Sprintf("step_%s_end_time", stepName), time.Now())
 	
 	if m.Logger != nil {
-		m.Logger.Info("Step timing", map[string]interface{}{"workflow_id": workflowID, "step": stepName, "duration": duration.String()})
+		m.Logger.Info("Step timing", map[string]interface{}{"workflow_id": workflowID, "step": stepName, "duration": duration.String(), "annotations": ctx.GetAnnotations()})
 	}
 	
 	return nextStep, err
@@ -92,14 +92,14 @@ func (m *ErrorHandlingMiddleware) Handle(ctx *core.WorkflowContext, next core.St
 		// Check if error should trigger retry
 		for _, retryErr := range m.RetryOnErrors {
 			if err.Error() == retryErr {
-				retryCount, _ := ctx.Metadata.GetExecutionMetric(fmt.Sprintf("step_%s_retry_count", stepName))
+				retryCount, _ := ctx.GetMetadata().GetExecutionMetric(fmt.Sprintf("step_%s_retry_count", stepName))
 				count, ok := retryCount.(int)
 				if !ok {
 					count = 0
 				}
 				
 				if count < m.MaxRetries {
-					ctx.Metadata.SetExecutionMetric(fmt.Sprintf("step_%s_retry_count", stepName), count+1)
+					ctx.GetMetadata().SetExecutionMetric(fmt.Sprintf("step_%s_retry_count", stepName), count+1)
 					if m.Logger != nil {
 						m.Logger.Warn("Retrying step", map[string]interface{}{"workflow_id": workflowID, "step": stepName, "retry_count": count+1, "error": err.Error()})
 					}
@@ -195,9 +195,9 @@ func (m *MetricsMiddleware) Handle(ctx *core.WorkflowContext, next core.StepHand
 	success := err == nil
 	
 	// Store metrics in context
-	ctx.Metadata.SetExecutionMetric(fmt.Sprintf("step_%s_execution_count", stepName), 1)
-	ctx.Metadata.SetExecutionMetric(fmt.Sprintf("step_%s_success", stepName), success)
-	ctx.Metadata.SetExecutionMetric(fmt.Sprintf("step_%s_duration_ms", stepName), duration.Milliseconds())
+	ctx.GetMetadata().SetExecutionMetric(fmt.Sprintf("step_%s_execution_count", stepName), 1)
+	ctx.GetMetadata().SetExecutionMetric(fmt.Sprintf("step_%s_success", stepName), success)
+	ctx.GetMetadata().SetExecutionMetric(fmt.Sprintf("step_%s_duration_ms", stepName), duration.Milliseconds())
 	
 	// Call custom metrics function if provided
 	if m.MetricsFunc != nil {
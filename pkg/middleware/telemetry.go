@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/truongtu268/magic-flow/pkg/core"
+)
+
+// Span is the span of a step execution in a tracing system
+type Span interface {
+	SetAttribute(key, value string)
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts the spans of steps. An OpenTelemetry tracer satisfies it
+// through a small adapter:
+//
+//	type otelTracer struct{ tracer trace.Tracer }
+//
+//	func (t otelTracer) StartSpan(ctx context.Context, name string) (context.Context, middleware.Span) {
+//		ctx, span := t.tracer.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) SetAttribute(key, value string) { s.SetAttributes(attribute.String(key, value)) }
+//	func (s otelSpan) RecordError(err error)           { s.Span.RecordError(err) }
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// TracingMiddleware runs each step in a span. Once the step ran, the
+// annotations it attached to the workflow context are set as attributes of
+// the span.
+type TracingMiddleware struct {
+	Logger core.Logger
+	Tracer Tracer
+}
+
+// NewTracingMiddleware creates a new tracing middleware
+func NewTracingMiddleware(logger core.Logger, tracer Tracer) *TracingMiddleware {
+	return &TracingMiddleware{
+		Logger: logger,
+		Tracer: tracer,
+	}
+}
+
+// Handle runs the step in a span. The step sees the context of its span, and
+// the next step the context the span was started from.
+func (m *TracingMiddleware) Handle(ctx *core.WorkflowContext, next core.StepHandler) (*string, error) {
+	stepName := ctx.GetCurrentStep()
+	parent := ctx.GetContext()
+
+	spanCtx, span := m.Tracer.StartSpan(parent, "step "+stepName)
+	ctx.SetContext(spanCtx)
+	defer ctx.SetContext(parent)
+	defer span.End()
+
+	nextStep, err := next(ctx)
+
+	span.SetAttribute("workflow.id", ctx.GetWorkflowID())
+	span.SetAttribute("workflow.step", stepName)
+	for key, value := range ctx.GetAnnotations() {
+		span.SetAttribute(key, value)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	return nextStep, err
+}
+
+// AuditRecord is the record of a step execution
+type AuditRecord struct {
+	WorkflowID  string
+	ExecutionID string
+	Step        string
+	StartedAt   time.Time
+	Duration    time.Duration
+	Error       string
+	Annotations map[string]string
+}
+
+// AuditSink stores the records of step executions
+type AuditSink interface {
+	RecordStep(record AuditRecord) error
+}
+
+// AuditMiddleware writes a record of each step, with the annotations the
+// step attached to the workflow context, to an audit sink
+type AuditMiddleware struct {
+	Logger core.Logger
+	Sink   AuditSink
+}
+
+// NewAuditMiddleware creates a new audit middleware
+func NewAuditMiddleware(logger core.Logger, sink AuditSink) *AuditMiddleware {
+	return &AuditMiddleware{
+		Logger: logger,
+		Sink:   sink,
+	}
+}
+
+// Handle records the step once it ran. Failing to record it is logged and
+// does not fail the step.
+func (m *AuditMiddleware) Handle(ctx *core.WorkflowContext, next core.StepHandler) (*string, error) {
+	stepName := ctx.GetCurrentStep()
+	startTime := time.Now()
+
+	nextStep, err := next(ctx)
+
+	record := AuditRecord{
+		WorkflowID:  ctx.GetWorkflowID(),
+		ExecutionID: ctx.GetExecutionID(),
+		Step:        stepName,
+		StartedAt:   startTime,
+		Duration:    time.Since(startTime),
+		Annotations: ctx.GetAnnotations(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if sinkErr := m.Sink.RecordStep(record); sinkErr != nil && m.Logger != nil {
+		m.Logger.Warn("Failed to record step audit", map[string]interface{}{"workflow_id": record.WorkflowID, "step": stepName, "error": sinkErr.Error()})
+	}
+
+	return nextStep, err
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/truongtu268/magic-flow/pkg/core"
+)
+
+type spanKey struct{}
+
+// recordingSpan records the attributes and errors set on it
+type recordingSpan struct {
+	name       string
+	attributes map[string]string
+	errors     []error
+	ended      bool
+}
+
+func (s *recordingSpan) SetAttribute(key, value string) { s.attributes[key] = value }
+func (s *recordingSpan) RecordError(err error)          { s.errors = append(s.errors, err) }
+func (s *recordingSpan) End()                           { s.ended = true }
+
+// recordingTracer starts recording spans, carrying them in the context
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	span := &recordingSpan{name: name, attributes: map[string]string{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+type recordingSink struct {
+	records []AuditRecord
+	err     error
+}
+
+func (s *recordingSink) RecordStep(record AuditRecord) error {
+	s.records = append(s.records, record)
+	return s.err
+}
+
+// recordingLogger records the messages of the warnings it logs
+type recordingLogger struct {
+	warnings []string
+}
+
+func (l *recordingLogger) Info(msg string, fields map[string]interface{})  {}
+func (l *recordingLogger) Error(msg string, fields map[string]interface{}) {}
+func (l *recordingLogger) Debug(msg string, fields map[string]interface{}) {}
+func (l *recordingLogger) Warn(msg string, fields map[string]interface{}) {
+	l.warnings = append(l.warnings, msg)
+}
+
+// chargeStep annotates the current step and fails with err
+func chargeStep(err error) core.StepHandler {
+	return func(ctx *core.WorkflowContext) (*string, error) {
+		ctx.Annotate("customer", "c-42")
+		ctx.Annotate("region", "eu")
+		return nil, err
+	}
+}
+
+func newChargeContext() *core.WorkflowContext {
+	ctx := core.NewWorkflowContext(context.Background(), "wf-1", "orders", core.NewDefaultWorkflowData(), nil)
+	ctx.SetCurrentStep("charge")
+	return ctx
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	declined := errors.New("card declined")
+	tests := map[string]struct {
+		err error
+	}{
+		"succeeded": {},
+		"failed":    {err: declined},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tracer := &recordingTracer{}
+			ctx := newChargeContext()
+			parent := ctx.GetContext()
+
+			var stepSpan interface{}
+			_, err := NewTracingMiddleware(nil, tracer).Handle(ctx, func(ctx *core.WorkflowContext) (*string, error) {
+				stepSpan = ctx.GetContext().Value(spanKey{})
+				return chargeStep(tt.err)(ctx)
+			})
+			assert.Equal(t, tt.err, err)
+
+			require.Len(t, tracer.spans, 1)
+			span := tracer.spans[0]
+			assert.Equal(t, "step charge", span.name)
+			assert.Same(t, span, stepSpan, "the step runs in the context of its span")
+			assert.Equal(t, parent, ctx.GetContext(), "the next step runs in the parent context")
+			assert.True(t, span.ended)
+			assert.Equal(t, map[string]string{
+				"workflow.id":   "wf-1",
+				"workflow.step": "charge",
+				"customer":      "c-42",
+				"region":        "eu",
+			}, span.attributes)
+			if tt.err != nil {
+				assert.Equal(t, []error{tt.err}, span.errors)
+			} else {
+				assert.Empty(t, span.errors)
+			}
+		})
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		stepErr  error
+		sinkErr  error
+		recorded string
+		warnings int
+	}{
+		"succeeded":        {},
+		"failed":           {stepErr: errors.New("card declined"), recorded: "card declined"},
+		"sink unavailable": {sinkErr: errors.New("audit log full"), warnings: 1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			sink := &recordingSink{err: tt.sinkErr}
+			logger := &recordingLogger{}
+
+			_, err := NewAuditMiddleware(logger, sink).Handle(newChargeContext(), chargeStep(tt.stepErr))
+			assert.Equal(t, tt.stepErr, err, "the sink does not fail the step")
+
+			require.Len(t, sink.records, 1)
+			record := sink.records[0]
+			assert.Equal(t, "wf-1", record.WorkflowID)
+			assert.Equal(t, "charge", record.Step)
+			assert.Equal(t, tt.recorded, record.Error)
+			assert.Equal(t, map[string]string{"customer": "c-42", "region": "eu"}, record.Annotations)
+			assert.False(t, record.StartedAt.IsZero())
+			assert.Len(t, logger.warnings, tt.warnings)
+		})
+	}
+}
@@ -137,7 +137,10 @@ func (rm *WorkflowRecoveryManager) RecoverWorkflow(ctx context.Context, workflow
 	policy := rm.getPolicy(record.WorkflowName)
 	
 	// Create workflow context from record
-	workflowCtx := rm.createWorkflowContextFromRecord(ctx, record)
+	workflowCtx, err := rm.createWorkflowContextFromRecord(ctx, record)
+	if err != nil {
+		return err
+	}
 	
 	// Attempt recovery
 	attempt := &RecoveryAttempt{
@@ -238,8 +241,11 @@ func (rm *WorkflowRecoveryManager) getPolicy(workflowName string) *RecoveryPolic
 	return rm.defaultPolicy
 }
 
-func (rm *WorkflowRecoveryManager) createWorkflowContextFromRecord(ctx context.Context, record *storage.WorkflowRecord) *core.WorkflowContext {
-	data := core.NewDefaultWorkflowDataWithMap(record.Data)
+func (rm *WorkflowRecoveryManager) createWorkflowContextFromRecord(ctx context.Context, record *storage.WorkflowRecord) (*core.WorkflowContext, error) {
+	data, err := core.RecordData(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore data of workflow %s: %w", record.ID, err)
+	}
 	metadata := core.NewDefaultWorkflowMetadataWithMap(record.Metadata)
 	
 	workflowCtx := core.NewWorkflowContext(ctx, record.ID, record.WorkflowName, data, metadata)
@@ -254,12 +260,12 @@ func (rm *WorkflowRecoveryManager) createWorkflowContextFromRecord(ctx context.C
 		workflowCtx.SetStepResult(stepName, result)
 	}
 	
-	return workflowCtx
+	return workflowCtx, nil
 }
 
 func (rm *WorkflowRecoveryManager) retryWorkflow(ctx context.Context, workflowCtx *core.WorkflowContext, policy *RecoveryPolicy) error {
 	// Get retry count from metadata
-	retryCount, _ := workflowCtx.Metadata.GetExecutionMetric("recovery_retry_count")
+	retryCount, _ := workflowCtx.GetMetadata().GetExecutionMetric("recovery_retry_count")
 	count, ok := retryCount.(int)
 	if !ok {
 		count = 0
@@ -281,7 +287,7 @@ func (rm *WorkflowRecoveryManager) retryWorkflow(ctx context.Context, workflowCt
 	}
 	
 	// Update retry count
-	workflowCtx.Metadata.SetExecutionMetric("recovery_retry_count", count+1)
+	workflowCtx.GetMetadata().SetExecutionMetric("recovery_retry_count", count+1)
 	workflowCtx.SetStatus(core.WorkflowStatusRunning)
 	
 	// Execute the failed step again
@@ -329,12 +335,12 @@ func (rm *WorkflowRecoveryManager) restartWorkflow(ctx context.Context, workflow
 		workflowCtx.SetStepResult(stepName, nil)
 	}
 	
-	restartCount, _ := workflowCtx.Metadata.GetExecutionMetric("restart_count")
+	restartCount, _ := workflowCtx.GetMetadata().GetExecutionMetric("restart_count")
 	count, ok := restartCount.(int)
 	if !ok {
 		count = 0
 	}
-	workflowCtx.Metadata.SetExecutionMetric("restart_count", count + 1)
+	workflowCtx.GetMetadata().SetExecutionMetric("restart_count", count + 1)
 	
 	return rm.updateWorkflowRecord(ctx, workflowCtx)
 }
@@ -371,11 +377,13 @@ func (rm *WorkflowRecoveryManager) updateWorkflowRecord(ctx context.Context, wor
 		CurrentStep:  workflowCtx.GetCurrentStep(),
 		NextStep:     workflowCtx.GetNextStep(),
 		Status:       workflowCtx.GetStatus(),
-		Data:         workflowCtx.Data.GetAll(),
-		Metadata:     workflowCtx.Metadata.GetExecutionMetrics(),
+		Metadata:     workflowCtx.GetMetadata().GetExecutionMetrics(),
 		StepResults:  workflowCtx.GetAllStepResults(),
 		UpdatedAt:    time.Now(),
 	}
+	if err := core.SetRecordData(record, workflowCtx.Data); err != nil {
+		return err
+	}
 	
 	if workflowCtx.GetError() != nil {
 		errorMsg := workflowCtx.GetError().Error()
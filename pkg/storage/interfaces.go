@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/truongtu268/magic-flow/pkg/events"
@@ -15,6 +16,10 @@ type WorkflowRecord struct {
 	NextStep     *string                `json:"next_step" db:"next_step"`
 	Status       events.WorkflowStatus    `json:"status" db:"status"`
 	Data         map[string]interface{} `json:"data" db:"data"`
+	// RawData holds the JSON encoded data of oversized workflow data, in
+	// which case Data is nil. It is stored as is instead of marshalling
+	// Data.
+	RawData      json.RawMessage        `json:"raw_data,omitempty" db:"raw_data"`
 	Metadata     map[string]interface{} `json:"metadata" db:"metadata"`
 	StepResults  map[string]interface{} `json:"step_results" db:"step_results"`
 	StartTime    time.Time              `json:"start_time" db:"start_time"`
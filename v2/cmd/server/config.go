@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	appconfig "github.com/magic-flow/v2/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCommand() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage configuration files",
+	}
+
+	validateCmd := &cobra.Command{
+		Use:   "validate [file]",
+		Short: "Validate a configuration file and print every error",
+		Long: "Loads a configuration file with the environment variables and environment defaults of the config manager, " +
+			"and prints every validation error and warning rather than stopping at the first one. " +
+			"The command fails when the configuration has errors.",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE:         runConfigValidate,
+	}
+	validateCmd.Flags().StringVarP(&configFile, "config", "c", "config.yaml", "Configuration file path, when no file is given")
+
+	configCmd.AddCommand(validateCmd)
+	return configCmd
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	path := configFile
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	cfg, err := appconfig.ReadConfig(path)
+	if err != nil {
+		return err
+	}
+	errs := appconfig.ValidateAll(cfg)
+	writeValidationErrors(cmd.OutOrStdout(), path, errs, cfg.Warnings)
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %d error(s)", len(errs))
+	}
+	return nil
+}
+
+func writeValidationErrors(w io.Writer, path string, errs []error, warnings []string) {
+	for _, err := range errs {
+		fmt.Fprintf(w, "error: %v\n", err)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	if len(errs) == 0 {
+		fmt.Fprintf(w, "%s is valid\n", path)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/magic-flow/v2/internal/debugbundle"
+	"github.com/magic-flow/v2/internal/devmode"
+	"github.com/magic-flow/v2/internal/engine"
+	"github.com/magic-flow/v2/internal/metrics"
+	"github.com/magic-flow/v2/internal/versioning"
+	"github.com/magic-flow/v2/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// devMaxConcurrent bounds the executions of the playground engine
+const devMaxConcurrent = 10
+
+var (
+	workflowDir       string
+	overwriteWorkflow bool
+)
+
+func newDevCommand() *cobra.Command {
+	devCmd := &cobra.Command{
+		Use:   "dev",
+		Short: "Run a development playground for a directory of workflow definitions",
+		Long: "Runs the engine in memory with the workflows defined by the YAML files of a directory, " +
+			"reloading them as the files change, and serves a playground UI to execute them.",
+		Run: runDev,
+	}
+
+	devCmd.Flags().StringVar(&workflowDir, "dir", "./workflows", "Directory of YAML workflow definitions")
+	devCmd.Flags().StringVarP(&configFile, "config", "c", "config.yaml", "Configuration file path")
+	devCmd.Flags().StringVarP(&logLevel, "log-level", "l", "info", "Log level (debug, info, warn, error)")
+	devCmd.Flags().IntVarP(&port, "port", "p", 8080, "Server port")
+
+	importCmd := &cobra.Command{
+		Use:   "import-bundle <bundle.zip>",
+		Short: "Import the workflow definition and input of an execution debug bundle",
+		Long: "Writes the workflow definition of a debug bundle to the workflow directory, with the input " +
+			"of the execution next to it, so the execution can be reproduced in the playground.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runDevImport,
+	}
+	importCmd.Flags().StringVar(&workflowDir, "dir", "./workflows", "Directory of YAML workflow definitions")
+	importCmd.Flags().BoolVar(&overwriteWorkflow, "force", false, "Replace an existing definition of the workflow")
+	devCmd.AddCommand(importCmd)
+	return devCmd
+}
+
+func runDevImport(cmd *cobra.Command, args []string) error {
+	bundle, err := debugbundle.Open(args[0])
+	if err != nil {
+		return err
+	}
+	imported, err := devmode.ImportBundle(bundle, workflowDir, overwriteWorkflow)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Imported workflow %s of execution %s (%s bundle)\n", imported.Workflow, bundle.Manifest.ExecutionID, bundle.Manifest.Level)
+	fmt.Fprintf(out, "  definition: %s\n", imported.DefinitionPath)
+	if imported.InputPath != "" {
+		fmt.Fprintf(out, "  input:      %s\n", imported.InputPath)
+	}
+	for _, warning := range imported.Warnings {
+		fmt.Fprintf(out, "  warning: %s\n", warning)
+	}
+	return nil
+}
+
+func runDev(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %v", err)
+	}
+	setupLogging(logLevel, cfg.Logging)
+
+	// The playground engine keeps everything in memory, nothing is persisted
+	logger := logrus.StandardLogger()
+	workflowEngine := engine.NewEngine(devMaxConcurrent, metrics.NewCollector(cfg.Metrics), logger)
+	workflowEngine.RegisterStepExecutor("http", engine.NewHTTPExecutor(logger))
+	workflowEngine.RegisterStepExecutor("script", engine.NewScriptExecutor(logger))
+	workflowEngine.RegisterStepExecutor("transform", engine.NewTransformExecutor(logger))
+	workflowEngine.RegisterStepExecutor("delay", engine.NewDelayExecutor(logger))
+	workflowEngine.RegisterStepExecutor("condition", engine.NewConditionalExecutor(logger))
+
+	playground, err := devmode.New(devmode.Options{
+		Dir:         workflowDir,
+		Environment: cfg.Environment,
+	}, workflowEngine, versioning.NewValidator(validationConfig(cfg)), logger)
+	if err != nil {
+		logrus.Fatalf("Failed to start dev mode: %v", err)
+	}
+	workflowEngine.RegisterEventHandler(playground.Stream())
+
+	if err := playground.Start(context.Background()); err != nil {
+		logrus.Fatalf("Failed to load workflows: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	handlers := devmode.NewHandlers(playground)
+	handlers.RegisterRoutes(router.Group("/api"))
+	handlers.RegisterUI(router)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: router,
+	}
+	go func() {
+		logrus.Infof("Playground for %s running at http://localhost:%d", workflowDir, port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	playground.Stop()
+	if err := workflowEngine.Shutdown(ctx); err != nil {
+		logrus.Errorf("Error stopping workflow engine: %v", err)
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		logrus.Errorf("Server forced to shutdown: %v", err)
+	}
+}
@@ -11,16 +11,58 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/magic-flow/v2/internal/admission"
+	"github.com/magic-flow/v2/internal/analytics"
 	"github.com/magic-flow/v2/internal/api"
+	"github.com/magic-flow/v2/internal/approvals"
+	"github.com/magic-flow/v2/internal/artifacts"
+	"github.com/magic-flow/v2/internal/attachments"
+	"github.com/magic-flow/v2/internal/backfill"
+	"github.com/magic-flow/v2/internal/branding"
+	"github.com/magic-flow/v2/internal/changesets"
+	"github.com/magic-flow/v2/internal/codegen"
+	"github.com/magic-flow/v2/internal/compression"
+	"github.com/magic-flow/v2/internal/correlation"
 	"github.com/magic-flow/v2/internal/database"
+	"github.com/magic-flow/v2/internal/debugbundle"
+	"github.com/magic-flow/v2/internal/delivery"
+	"github.com/magic-flow/v2/internal/dependencies"
+	"github.com/magic-flow/v2/internal/deprecation"
 	"github.com/magic-flow/v2/internal/engine"
+	"github.com/magic-flow/v2/internal/flags"
+	"github.com/magic-flow/v2/internal/freeze"
+	"github.com/magic-flow/v2/internal/groups"
+	"github.com/magic-flow/v2/internal/locks"
 	"github.com/magic-flow/v2/internal/metrics"
+	"github.com/magic-flow/v2/internal/negotiation"
+	"github.com/magic-flow/v2/internal/nodes"
+	"github.com/magic-flow/v2/internal/policies"
+	"github.com/magic-flow/v2/internal/quotas"
+	"github.com/magic-flow/v2/internal/reservations"
+	"github.com/magic-flow/v2/internal/scheduler"
+	"github.com/magic-flow/v2/internal/scratch"
+	"github.com/magic-flow/v2/internal/scripting"
+	"github.com/magic-flow/v2/internal/scripting/gojs"
+	"github.com/magic-flow/v2/internal/secrets"
 	"github.com/magic-flow/v2/internal/services"
+	"github.com/magic-flow/v2/internal/slo"
+	"github.com/magic-flow/v2/internal/spikes"
+	"github.com/magic-flow/v2/internal/tenancy"
+	"github.com/magic-flow/v2/internal/triage"
+	"github.com/magic-flow/v2/internal/triggers"
+	"github.com/magic-flow/v2/internal/warmup"
+	"github.com/magic-flow/v2/internal/watch"
 	"github.com/magic-flow/v2/pkg/config"
+	"github.com/magic-flow/v2/pkg/models"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
+// version is the server version reported by worker nodes
+const version = "2.0.0"
+
 var (
 	configFile string
 	logLevel   string
@@ -38,6 +80,10 @@ func main() {
 	rootCmd.Flags().StringVarP(&configFile, "config", "c", "config.yaml", "Configuration file path")
 	rootCmd.Flags().StringVarP(&logLevel, "log-level", "l", "info", "Log level (debug, info, warn, error)")
 	rootCmd.Flags().IntVarP(&port, "port", "p", 8080, "Server port")
+	rootCmd.AddCommand(newDevCommand())
+	rootCmd.AddCommand(newWorkflowCommand())
+	rootCmd.AddCommand(newValidateConfigCommand())
+	rootCmd.AddCommand(newConfigCommand())
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
@@ -45,11 +91,17 @@ func main() {
 }
 
 func runServer(cmd *cobra.Command, args []string) {
-	// Load configuration
-	cfg, err := config.Load(configFile)
+	// Load configuration, reporting every issue before exiting on errors
+	cfg, report, err := config.Diagnose(configFile)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if len(report.Issues) > 0 {
+		report.WriteText(os.Stderr)
+	}
+	if report.HasErrors() {
+		log.Fatalf("Invalid configuration: %s", report.Summary())
+	}
 
 	// Override port if specified
 	if port != 8080 {
@@ -61,26 +113,517 @@ func runServer(cmd *cobra.Command, args []string) {
 
 	logrus.Info("Starting Magic Flow v2 Server...")
 
+	// Resolve the secret references of the configuration, such as
+	// secret:database_password, from the secret provider
+	secretProvider, err := secrets.New(secrets.Config{
+		Provider:  cfg.Secrets.Provider,
+		EnvPrefix: cfg.Secrets.EnvPrefix,
+		Vault: secrets.VaultConfig{
+			Address: cfg.Secrets.Vault.Address,
+			Token:   cfg.Secrets.Vault.Token,
+			Mount:   cfg.Secrets.Vault.Mount,
+			Path:    cfg.Secrets.Vault.Path,
+			Timeout: cfg.Secrets.Vault.Timeout,
+		},
+	})
+	if err != nil {
+		logrus.Fatalf("Failed to initialize secret provider: %v", err)
+	}
+	if err := cfg.ResolveSecrets(context.Background(), secretProvider); err != nil {
+		logrus.Fatalf("Failed to resolve configuration secrets: %v", err)
+	}
+
 	// Initialize database
 	db, err := database.Initialize(cfg.Database)
 	if err != nil {
 		logrus.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Scope workflows and executions to the tenant of their query context
+	// in multi-tenant deployments. The server components act for every
+	// tenant, the API handlers scope the services of each request to its
+	// tenant with WithContext.
+	if cfg.Tenancy.MultiTenant {
+		if err := database.EnableTenancy(db); err != nil {
+			logrus.Fatalf("Failed to enable tenant isolation: %v", err)
+		}
+		db = db.WithContext(tenancy.WithSystem(context.Background()))
+	}
+
 	// Initialize metrics
 	metricsCollector := metrics.NewCollector(cfg.Metrics)
 	if err := metricsCollector.Start(); err != nil {
 		logrus.Fatalf("Failed to start metrics collector: %v", err)
 	}
 
+	// Compress the large execution payloads written from now on. Rows
+	// written uncompressed are migrated by recompression backfill jobs.
+	payloadCompressor, err := compression.NewCompressor(compression.Config{
+		Enabled:   cfg.Database.Compression.Enabled,
+		Algorithm: cfg.Database.Compression.Algorithm,
+		Threshold: cfg.Database.Compression.Threshold,
+		Skip:      cfg.Database.Compression.Skip,
+	})
+	if err != nil {
+		logrus.Fatalf("Failed to setup payload compression: %v", err)
+	}
+	payloadCompressor.SetMetrics(metricsCollector)
+	database.EnableCompression(payloadCompressor)
+
+	// The engine, scheduler, API and metrics read the time from one clock
+	clock := scheduler.NewRealClock()
+
 	// Initialize services
 	serviceContainer := services.NewContainer(db, cfg)
+	serviceContainer.MetricsService.SetClock(clock)
 
 	// Initialize workflow engine
 	workflowEngine := engine.New(serviceContainer, cfg.Engine)
+	workflowEngine.SetClock(clock)
 	if err := workflowEngine.Start(); err != nil {
 		logrus.Fatalf("Failed to start workflow engine: %v", err)
 	}
+	// Steps read secrets with secret() from the same provider
+	workflowEngine.SetSecrets(secretProvider)
+	// Sample the entries of successful steps, failed and slow steps are
+	// always logged
+	workflowEngine.SetStepLogSampling(engine.StepLogSampling{
+		Every:         cfg.Logging.StepSampling.Every,
+		SlowThreshold: cfg.Logging.StepSampling.SlowThreshold,
+	})
+
+	// Deliver events to handlers through retrying queues, parking events a
+	// handler keeps failing
+	parkedEventStore := delivery.NewGormStore(db)
+	if err := parkedEventStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate parked event store: %v", err)
+	}
+	// Bound the events buffered for each handler, so handlers that cannot
+	// keep up slow executions down or drop events instead of exhausting
+	// memory
+	eventBuffers := make([]delivery.BufferConfig, 0, len(cfg.Delivery.HandlerBuffers))
+	for _, buffer := range cfg.Delivery.HandlerBuffers {
+		eventBuffers = append(eventBuffers, delivery.BufferConfig{
+			Handler:        buffer.Handler,
+			Size:           buffer.Size,
+			OverflowPolicy: delivery.OverflowPolicy(buffer.OverflowPolicy),
+		})
+	}
+	eventDispatcher := delivery.NewDispatcher(delivery.Config{
+		MaxAttempts:     cfg.Delivery.MaxAttempts,
+		RetryBackoff:    cfg.Delivery.RetryBackoff,
+		MaxRetryBackoff: cfg.Delivery.MaxRetryBackoff,
+		OrderingPolicy:  delivery.OrderingPolicy(cfg.Delivery.OrderingPolicy),
+		Acknowledged:    cfg.Delivery.AcknowledgedHandlers,
+		BufferSize:      cfg.Delivery.BufferSize,
+		OverflowPolicy:  delivery.OverflowPolicy(cfg.Delivery.OverflowPolicy),
+		Buffers:         eventBuffers,
+	}, parkedEventStore, metricsCollector, delivery.NewLogNotifier(logrus.StandardLogger()), logrus.StandardLogger())
+	// Journal the events of acknowledged handlers until they are processed
+	eventDispatcher.SetJournal(parkedEventStore)
+
+	// Initialize analytics exporter
+	analyticsExporter, err := setupAnalytics(cfg.Analytics, db, metricsCollector)
+	if err != nil {
+		logrus.Fatalf("Failed to initialize analytics exporter: %v", err)
+	}
+	workflowEngine.RegisterEventHandler(eventDispatcher.Wrap("analytics", analytics.NewEventHandler(analyticsExporter)))
+	analyticsExporter.Start(context.Background())
+
+	// Register this worker node, the engine stops accepting executions once
+	// the node is cordoned
+	nodeStore := nodes.NewGormStore(db)
+	if err := nodeStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate node store: %v", err)
+	}
+	nodeAgent := nodes.NewAgent(nodeStore, cfg.Cluster.NodeID, version, workflowEngine, logrus.StandardLogger())
+	workflowEngine.SetPlacement(nodeAgent)
+	workflowEngine.SetMaxConcurrentSteps(cfg.Cluster.MaxConcurrentSteps)
+	workflowEngine.SetFastLane(cfg.Cluster.FastLaneConcurrency)
+	workflowEngine.SetMaxVariableBytes(cfg.Cluster.MaxVariableBytes)
+	if err := nodeAgent.Start(context.Background(), cfg.Cluster.HeartbeatInterval); err != nil {
+		logrus.Fatalf("Failed to register worker node: %v", err)
+	}
+	nodeManager := nodes.NewManager(nodeStore, cfg.Cluster.HeartbeatTimeout, nil, logrus.StandardLogger())
+	nodeManager.Start(context.Background(), cfg.Cluster.HeartbeatInterval)
+	workflowEngine.RegisterEventHandler(eventDispatcher.Wrap("nodes", nodes.NewEventHandler(nodeManager)))
+
+	// Initialize execution locks, released automatically when executions end
+	lockStore := locks.NewGormStore(db)
+	if err := lockStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate lock store: %v", err)
+	}
+	lockManager := locks.NewManager(lockStore, logrus.StandardLogger())
+	workflowEngine.RegisterStepExecutor("lock", locks.NewLockExecutor(lockManager))
+	workflowEngine.RegisterStepExecutor("unlock", locks.NewUnlockExecutor(lockManager))
+	workflowEngine.RegisterEventHandler(eventDispatcher.Wrap("locks", locks.NewEventHandler(lockManager)))
+
+	// Initialize approval steps, notifying approvers through the routes of
+	// approval events
+	approvalStore := approvals.NewGormStore(db)
+	if err := approvalStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate approval store: %v", err)
+	}
+	approvalManager := approvals.NewManager(approvals.Config{
+		Timeout:       cfg.Approvals.Timeout,
+		SweepInterval: cfg.Approvals.SweepInterval,
+	}, approvalStore, approvals.NewStaticDirectory(cfg.Approvals.Groups, cfg.Approvals.Roles), workflowEngine, logrus.StandardLogger())
+	approvalManager.Start(context.Background())
+	workflowEngine.RegisterStepExecutor("approval", approvals.NewExecutor(approvalManager, database.NewExecutionRepository(db)))
+
+	// Initialize execution groups, whose members share a fate policy applied
+	// as their executions end
+	groupStore := groups.NewGormStore(db)
+	if err := groupStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate execution group store: %v", err)
+	}
+	groupManager := groups.NewManager(groupStore, database.NewWorkflowRepository(db), workflowEngine, workflowEngine, logrus.StandardLogger())
+	workflowEngine.RegisterEventHandler(eventDispatcher.Wrap("groups", groups.NewEventHandler(groupManager)))
+
+	// Initialize the artifact store of the large payloads steps exchange,
+	// such as the rows of parse_table steps
+	artifactStore, err := artifacts.NewFileStore(cfg.Artifacts.Dir)
+	if err != nil {
+		logrus.Fatalf("Failed to initialize artifact store: %v", err)
+	}
+	workflowEngine.RegisterStepExecutor("parse_table", engine.NewParseTableExecutor(artifactStore, logrus.StandardLogger()))
+
+	// Extract the binaries clients embed in execution inputs into artifacts
+	attachmentManager := attachments.NewManager(attachments.Config{
+		Enabled:     cfg.Artifacts.Extraction.Enabled,
+		Threshold:   cfg.Artifacts.Extraction.Threshold,
+		Allow:       cfg.Artifacts.Extraction.Allow,
+		Deny:        cfg.Artifacts.Extraction.Deny,
+		InlineLimit: cfg.Artifacts.Extraction.InlineLimit,
+	}, artifactStore, logrus.StandardLogger())
+	attachmentManager.SetMetrics(metricsCollector)
+
+	// Give each execution a scratch area in the artifact directory for the
+	// intermediate files its steps share, removed once the execution ended
+	scratchSpace, err := scratch.NewSpace(artifactStore.ScratchDir(), cfg.Artifacts.Scratch.MaxBytes)
+	if err != nil {
+		logrus.Fatalf("Failed to initialize scratch space: %v", err)
+	}
+	scratchReaper := scratch.NewReaper(scratchSpace, database.NewExecutionRepository(db), scratch.Config{
+		GracePeriod:      cfg.Artifacts.Scratch.GracePeriod,
+		DebugSampleEvery: cfg.Artifacts.Scratch.DebugSampleEvery,
+		DebugRetention:   cfg.Artifacts.Scratch.DebugRetention,
+		CleanupInterval:  cfg.Artifacts.Scratch.CleanupInterval,
+	}, logrus.StandardLogger())
+	scratchReaper.SetMetrics(metricsCollector)
+	scratchReaper.Start(context.Background())
+
+	// Initialize the script sandbox of javascript script steps
+	moduleStore := scripting.NewGormModuleStore(db)
+	if err := moduleStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate script module store: %v", err)
+	}
+	moduleRegistry := scripting.NewModuleRegistry(moduleStore)
+	hostFunctions := scripting.DefaultHostFunctions(logrus.StandardLogger())
+	scripting.RegisterArtifactFunctions(hostFunctions, artifactStore, cfg.Artifacts.MaxScriptReadBytes)
+	scripting.RegisterScratchFunctions(hostFunctions, scratchSpace, cfg.Artifacts.MaxScriptReadBytes, engine.ExecutionIDFromContext)
+	scriptRuntime := scripting.NewRuntime(
+		gojs.New(),
+		hostFunctions,
+		moduleRegistry,
+		scriptLimits(cfg.Scripts),
+	)
+	scriptExecutor := engine.NewScriptExecutor(logrus.StandardLogger())
+	scriptExecutor.SetRuntime(scriptRuntime)
+	workflowEngine.RegisterStepExecutor("script", scriptExecutor)
+
+	// Warm the executors of activated versions up: http steps share a
+	// transport keeping connections alive and javascript steps run on
+	// interpreters initialized ahead
+	warmupConfig := warmup.Config{
+		Enabled:             cfg.Warmup.Enabled,
+		ConnectionsPerHost:  cfg.Warmup.ConnectionsPerHost,
+		MaxIdleConnsPerHost: cfg.Warmup.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.Warmup.IdleConnTimeout,
+		InterpreterPoolSize: cfg.Warmup.InterpreterPoolSize,
+		InterpreterTTL:      cfg.Warmup.InterpreterTTL,
+		Timeout:             cfg.Warmup.Timeout,
+	}
+	workflowEngine.SetWarmup(warmupConfig)
+	scriptRuntime.SetPool(scripting.NewPool(gojs.New(), scripting.PoolConfig{
+		Size: cfg.Warmup.InterpreterPoolSize,
+		TTL:  cfg.Warmup.InterpreterTTL,
+	}))
+	scriptExecutor.SetMetrics(metricsCollector)
+	httpExecutor := engine.NewHTTPExecutor(logrus.StandardLogger())
+	httpExecutor.SetWarmup(warmupConfig)
+	httpExecutor.SetMetrics(metricsCollector)
+	httpExecutor.SetArtifacts(artifactStore)
+	httpExecutor.SetScratch(scratchSpace)
+	workflowEngine.RegisterStepExecutor("http", httpExecutor)
+
+	// Resolve the branding and localized strings of generated client
+	// READMEs and notifications per namespace
+	brandingStore := branding.NewGormStore(db)
+	if err := brandingStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate branding store: %v", err)
+	}
+	brandingManager := branding.NewManager(brandingStore, logrus.StandardLogger())
+	if err := brandingManager.Refresh(context.Background()); err != nil {
+		logrus.Fatalf("Failed to load branding: %v", err)
+	}
+
+	// Apply workflow deprecations to executions and send the callers of
+	// deprecated workflows digests of their deprecated dependencies
+	callerUsageStore := deprecation.NewGormStore(db)
+	if err := callerUsageStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate workflow caller usage store: %v", err)
+	}
+	deprecationNotifier := deprecation.NewLogNotifier(logrus.StandardLogger())
+	deprecationNotifier.SetMessages(brandingManager)
+	deprecationManager := deprecation.NewManager(deprecation.Config{
+		NotifyWindow: cfg.Deprecation.NotifyWindow,
+	}, database.NewWorkflowRepository(db), database.NewWorkflowVersionRepository(db), callerUsageStore, deprecationNotifier, logrus.StandardLogger())
+	deprecationManager.Start(context.Background(), cfg.Deprecation.DigestInterval)
+
+	// Evaluate the admission policies of executions and version activations
+	policyStore := policies.NewGormStore(db)
+	if err := policyStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate policy store: %v", err)
+	}
+	policyManager := policies.NewManager(policyStore, policies.Config{
+		DefaultTimeout: cfg.Policies.DefaultTimeout,
+	}, logrus.StandardLogger())
+
+	// Reserve capacity for known bursts of executions. Reserved slots are
+	// released when their executions end.
+	reservationStore := reservations.NewGormStore(db)
+	if err := reservationStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate reservation store: %v", err)
+	}
+	reservationManager := reservations.NewManager(reservations.Config{
+		GracePeriod:      cfg.Reservations.GracePeriod,
+		ReleasePeriod:    cfg.Reservations.ReleasePeriod,
+		MaxReservedShare: cfg.Reservations.MaxReservedShare,
+	}, reservationStore, workflowEngine, logrus.StandardLogger())
+	workflowEngine.RegisterEventHandler(eventDispatcher.Wrap("reservations", reservations.NewEventHandler(reservationManager)))
+	nodeManager.SetReservations(reservationManager)
+
+	// Deliver the events acknowledged handlers had not processed when the
+	// server last stopped, before executions are resumed
+	recoveredEvents, err := eventDispatcher.Recover(context.Background())
+	if err != nil {
+		logrus.Fatalf("Failed to recover pending events: %v", err)
+	}
+	if recoveredEvents > 0 {
+		logrus.WithField("events", recoveredEvents).Info("Recovered pending events")
+	}
+
+	// Admit executions through the checks pre-flight requests run. Quotas,
+	// rollouts and circuit breakers are consulted when deployments provide
+	// them.
+	maintenanceWindows, err := setupMaintenanceWindows(cfg.Admission)
+	if err != nil {
+		logrus.Fatalf("Failed to load maintenance windows: %v", err)
+	}
+	admissionChecker := admission.NewAdmissionChecker(admission.Config{
+		AverageExecutionTime: cfg.Admission.AverageExecutionTime,
+	}, admission.Sources{
+		Engine:       workflowEngine,
+		Maintenance:  maintenanceWindows,
+		Deprecations: deprecationManager,
+		Policies:     policyManager,
+		Reservations: reservationManager,
+	})
+	serviceContainer.WorkflowService.SetAdmissionChecker(admissionChecker)
+
+	// Limit the executions each tenant may start per period
+	var quotaLimiter *quotas.Limiter
+	if cfg.Quotas.Enabled {
+		quotaLimiter = setupQuotas(cfg.Quotas)
+		serviceContainer.WorkflowService.SetQuotas(quotaLimiter)
+	}
+
+	// Guard against submission spikes of workflows and API keys.
+	// Capacity reservations pre-authorize the bursts of their workflows.
+	var spikeManager *spikes.Manager
+	if cfg.Spikes.Enabled {
+		spikeManager, err = setupSpikes(cfg.Spikes, db)
+		if err != nil {
+			logrus.Fatalf("Failed to set up spike guards: %v", err)
+		}
+		spikeManager.SetReservations(reservationManager)
+		spikeManager.SetNotifier(spikes.NewEventNotifier(workflowEngine))
+		spikeManager.Start(context.Background())
+	}
+
+	// Freeze writes during incidents. Freezes are shared through the
+	// database, so every server enforces the freezes made on any of them.
+	freezeStore := freeze.NewGormStore(db)
+	if err := freezeStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate freeze store: %v", err)
+	}
+	freezeManager := freeze.NewManager(freezeStore, logrus.StandardLogger())
+	if err := freezeManager.Refresh(context.Background()); err != nil {
+		logrus.Fatalf("Failed to load freezes: %v", err)
+	}
+	freezeManager.Start(context.Background(), cfg.Freeze.RefreshInterval)
+
+	// Initialize scheduler
+	schedulerService := scheduler.NewService(clock, func(ctx context.Context, schedule *scheduler.Schedule, fireTime time.Time) error {
+		_, err := serviceContainer.WorkflowService.ExecuteWorkflow(&services.ExecuteWorkflowRequest{
+			WorkflowID:  schedule.WorkflowID,
+			TriggerType: string(models.TriggerTypeScheduled),
+			TriggerData: map[string]interface{}{
+				"schedule_id": schedule.ID,
+				"fire_time":   fireTime,
+			},
+			Input:     schedule.Input,
+			CreatedBy: "scheduler",
+		})
+		return err
+	}, logrus.StandardLogger())
+	// Schedules hold their fires while executions are frozen, and catch up
+	// a bounded number of missed or held fires
+	schedulerService.SetHold(freezeManager.Hold(freeze.OperationExecution))
+	schedulerService.SetCatchUpLimit(cfg.Freeze.ScheduleCatchUpLimit)
+	schedulerService.Start(context.Background())
+
+	// Expressions look up the business calendars of addBusinessDays in the
+	// scheduler calendars
+	workflowEngine.SetCalendars(schedulerService)
+	// Persisted step executions are the recordings replays use, and those
+	// parked executions resume from
+	workflowEngine.SetStepStore(database.NewStepExecutionRepository(db))
+
+	// Resume the executions parked by the drain of other nodes while this
+	// node has free capacity
+	parkedResumer := engine.NewResumer(workflowEngine, database.NewExecutionRepository(db), database.NewWorkflowRepository(db), logrus.StandardLogger())
+	parkedResumer.Start(context.Background(), cfg.Cluster.ResumeInterval)
+
+	// Evaluate the feature flags definitions reference as executions start,
+	// and check production versions for references to undefined flags
+	flagStore := flags.NewGormStore(db)
+	if err := flagStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate flag store: %v", err)
+	}
+	flagManager := flags.NewManager(flagStore, database.NewWorkflowVersionRepository(db), logrus.StandardLogger())
+	workflowEngine.SetFlags(flagManager)
+	flagManager.Start(context.Background(), cfg.Flags.StaleCheckInterval)
+
+	// Apply changesets of workflow, version and schedule operations all or
+	// nothing
+	changesetStore := changesets.NewGormStore(db)
+	if err := changesetStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate changeset store: %v", err)
+	}
+	changesetService := changesets.NewService(changesetStore, schedulerService, logrus.StandardLogger())
+	changesetService.SetPolicies(policyManager)
+
+	// Build execution debug bundles for support tickets, in jobs for
+	// executions with many events
+	bundleBuilder := debugbundle.NewBuilder(debugbundle.Sources{
+		Executions: database.NewExecutionRepository(db),
+		Events:     database.NewExecutionEventRepository(db),
+		Workflows:  database.NewWorkflowRepository(db),
+		Versions:   database.NewWorkflowVersionRepository(db),
+		Approvals:  approvalManager,
+		Branding:   brandingManager,
+	}, debugbundle.Config{
+		Version:     version,
+		NodeID:      nodeAgent.NodeID(),
+		Environment: cfg.Environment,
+		Limits: map[string]interface{}{
+			"delivery_max_attempts":   cfg.Delivery.MaxAttempts,
+			"script_max_memory_bytes": cfg.Scripts.Limits.MaxMemoryBytes,
+			"script_max_ops":          cfg.Scripts.Limits.MaxOps,
+			"script_timeout":          cfg.Scripts.Limits.Timeout.String(),
+		},
+		AsyncEventThreshold: cfg.DebugBundles.AsyncEventThreshold,
+	})
+	bundleJobs := debugbundle.NewJobs(bundleBuilder, cfg.DebugBundles.JobTTL, logrus.StandardLogger())
+
+	// Classify failed executions for on-call, with the rules of the
+	// namespace of their workflow before the default rules
+	var triageClassifier *triage.Classifier
+	if cfg.Triage.Enabled {
+		triageClassifier, err = setupTriage(cfg.Triage, db)
+		if err != nil {
+			logrus.Fatalf("Failed to load triage rules: %v", err)
+		}
+		workflowEngine.SetClassifier(triageClassifier)
+	}
+
+	// Apply processors such as triage to historical executions in the
+	// background, yielding to live executions, and resume the jobs
+	// interrupted by the last shutdown
+	backfillRunner, err := setupBackfill(cfg.Backfill, db)
+	if err != nil {
+		logrus.Fatalf("Failed to setup backfill runner: %v", err)
+	}
+	backfillRunner.SetLoad(workflowEngine)
+	backfillRunner.Register(database.NewRecompressionProcessor(db, payloadCompressor))
+	if triageClassifier != nil {
+		backfillRunner.Register(triage.NewBackfillProcessor(triageClassifier))
+	}
+	if err := backfillRunner.Recover(context.Background()); err != nil {
+		logrus.Errorf("Failed to resume backfill jobs: %v", err)
+	}
+
+	// Evaluate the SLOs of workflows and notify their burn alerts through
+	// the event handlers, except during maintenance windows
+	sloManager, err := setupSLOs(cfg.SLO, db)
+	if err != nil {
+		logrus.Fatalf("Failed to setup SLOs: %v", err)
+	}
+	sloManager.SetNotifier(slo.NewEventNotifier(workflowEngine))
+	sloManager.SetMaintenance(maintenanceWindows)
+	sloManager.SetMetrics(metricsCollector)
+	sloManager.Start(context.Background())
+
+	// Start workflows from the signed webhooks of external services
+	webhookTriggers, err := setupTriggers(cfg.Triggers)
+	if err != nil {
+		logrus.Fatalf("Failed to setup webhook triggers: %v", err)
+	}
+
+	// Record the workflows depending on one another as changesets create
+	// them, so changes and deprecations warn about their dependents
+	dependencyStore := dependencies.NewGormStore(db)
+	if err := dependencyStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate dependency store: %v", err)
+	}
+	dependencyGraph := dependencies.NewGraph(dependencies.Config{
+		ServerURLs: cfg.Dependencies.ServerURLs,
+		MaxDepth:   cfg.Dependencies.MaxDepth,
+	}, dependencyStore, database.NewWorkflowRepository(db), logrus.StandardLogger())
+	dependencyGraph.SetSchedules(schedulerService)
+	dependencyGraph.SetWebhooks(webhookTriggers)
+	changesetService.SetDependencies(dependencyGraph)
+	deprecationManager.SetDependents(dependencyGraph)
+
+	// Record the changes to workflow definitions for their watchers and
+	// deliver them to webhook subscriptions through the event dispatcher
+	watchStore := watch.NewGormStore(db)
+	if err := watchStore.Migrate(); err != nil {
+		logrus.Fatalf("Failed to migrate watch store: %v", err)
+	}
+	watchHub := watch.NewHub(watch.Config{
+		PollInterval: cfg.Watch.PollInterval,
+		BatchSize:    cfg.Watch.BatchSize,
+	}, watchStore, logrus.StandardLogger())
+	watchHub.SetSubscriptions(watchStore, eventDispatcher)
+	if err := watchHub.RegisterSubscriptions(context.Background()); err != nil {
+		logrus.Fatalf("Failed to register watch subscriptions: %v", err)
+	}
+	changesetService.SetWatch(watchHub)
+	deprecationManager.SetWatch(watchHub)
+	serviceContainer.WorkflowService.SetWatch(watchHub)
+
+	// Regenerate the configured clients as their workflows change
+	if cfg.Codegen.AutoRegenerate.Enabled {
+		regenerator := setupRegenerator(cfg.Codegen.AutoRegenerate, watchHub, db, brandingManager)
+		go func() {
+			if err := regenerator.Run(context.Background()); err != nil {
+				logrus.Errorf("Client regeneration stopped: %v", err)
+			}
+		}()
+	}
 
 	// Setup Gin router
 	if cfg.Server.Mode == "production" {
@@ -90,10 +633,95 @@ func runServer(cmd *cobra.Command, args []string) {
 	router := gin.New()
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
+	router.Use(correlation.Middleware(logrus.StandardLogger()))
+	if cfg.Tenancy.MultiTenant {
+		// Webhook triggers are authenticated by their signature
+		router.Use(tenancy.Middleware(cfg.Security.API.Header, setupTenancy(cfg.Tenancy), "/api/v1/triggers/"))
+	}
+	router.Use(freeze.Middleware(freezeManager, freeze.DefaultRules))
 
 	// Setup API routes
 	apiHandler := api.NewHandler(serviceContainer, workflowEngine, metricsCollector)
+	apiHandler.SetClock(clock)
+	apiHandler.SetDeprecations(deprecationManager, cfg.Security.API.Header)
+	if quotaLimiter != nil {
+		apiHandler.SetQuotas(quotaLimiter)
+	}
+	if spikeManager != nil {
+		apiHandler.SetSpikes(spikeManager, cfg.Security.API.Header)
+	}
+	apiHandler.SetPolicies(policyManager)
+	apiHandler.SetFreezes(freezeManager)
+	apiHandler.SetAttachments(attachmentManager)
+	apiHandler.SetNegotiation(negotiation.Config{
+		MaxBodyBytes:     cfg.Server.MaxBodyBytes,
+		CompressMinBytes: cfg.Server.CompressMinBytes,
+	})
 	apiHandler.SetupRoutes(router)
+	attachments.NewHandlers(attachmentManager).RegisterRoutes(router.Group("/api"))
+	scheduler.NewHandlers(schedulerService).RegisterRoutes(router.Group("/api"))
+	analytics.NewHandlers(analyticsExporter).RegisterRoutes(router.Group("/api"))
+	locks.NewHandlers(lockManager).RegisterRoutes(router.Group("/api"))
+	scripting.NewHandlers(moduleRegistry).RegisterRoutes(router.Group("/api"))
+	nodes.NewHandlers(nodeManager).RegisterRoutes(router.Group("/api"))
+	reservations.NewHandlers(reservationManager).RegisterRoutes(router.Group("/api"))
+	approvals.NewHandlers(approvalManager).RegisterRoutes(router.Group("/api"))
+	groups.NewHandlers(groupManager).RegisterRoutes(router.Group("/api"))
+	delivery.NewHandlers(eventDispatcher).RegisterRoutes(router.Group("/api"))
+	admission.NewHandlers(admissionChecker, database.NewWorkflowRepository(db)).RegisterRoutes(router.Group("/api"))
+	deprecation.NewHandlers(deprecationManager).RegisterRoutes(router.Group("/api"))
+	changesets.NewHandlers(changesetService).RegisterRoutes(router.Group("/api"))
+	dependencies.NewHandlers(dependencyGraph).RegisterRoutes(router.Group("/api"))
+	watch.NewHandlers(watchHub).RegisterRoutes(router.Group("/api"))
+	policies.NewHandlers(policyManager).RegisterRoutes(router.Group("/api"))
+	flags.NewHandlers(flagManager).RegisterRoutes(router.Group("/api"))
+	branding.NewHandlers(brandingManager).RegisterRoutes(router.Group("/api"))
+	if triageClassifier != nil {
+		triage.NewHandlers(triageClassifier).RegisterRoutes(router.Group("/api"))
+	}
+	backfill.NewHandlers(backfillRunner).RegisterRoutes(router.Group("/api"))
+	slo.NewHandlers(sloManager).RegisterRoutes(router.Group("/api"))
+	freeze.NewHandlers(freezeManager).RegisterRoutes(router.Group("/api"))
+	if spikeManager != nil {
+		spikes.NewHandlers(spikeManager).RegisterRoutes(router.Group("/api"))
+	}
+	triggerHandlers := triggers.NewHandlers(triggers.Config{
+		MaxBodyBytes: cfg.Triggers.MaxBodyBytes,
+	}, webhookTriggers, func(ctx context.Context, trigger *triggers.Trigger, input map[string]interface{}) (uuid.UUID, error) {
+		execution, err := serviceContainer.WorkflowService.ExecuteWorkflow(&services.ExecuteWorkflowRequest{
+			WorkflowID:  trigger.WorkflowID,
+			TriggerType: string(models.TriggerTypeWebhook),
+			TriggerData: map[string]interface{}{
+				"trigger": trigger.Name,
+			},
+			Input:     input,
+			CreatedBy: "webhook:" + trigger.Name,
+		})
+		if err != nil {
+			return uuid.Nil, err
+		}
+		return execution.ID, nil
+	})
+	// Webhooks received while executions are frozen are held in the
+	// database and started by the servers seeing the freeze end, or by the
+	// next server starting when none did
+	executionHold := freezeManager.Hold(freeze.OperationExecution)
+	triggerHandlers.SetHold(executionHold, freezeStore, cfg.Freeze.HeldWebhookLimit)
+	releaseHeldWebhooks := func(ctx context.Context) {
+		started, err := triggerHandlers.Release(ctx)
+		if err != nil {
+			logrus.Errorf("Failed to start held webhook executions: %v", err)
+		}
+		if started > 0 {
+			logrus.Infof("Started %d held webhook executions", started)
+		}
+	}
+	freezeManager.OnRelease(freeze.OperationExecution, releaseHeldWebhooks)
+	if !executionHold.Held() {
+		go releaseHeldWebhooks(context.Background())
+	}
+	triggerHandlers.RegisterRoutes(router.Group("/api"))
+	debugbundle.NewHandlers(bundleBuilder, bundleJobs, debugbundle.DebugKeys(cfg.Security.API.Header, cfg.DebugBundles.DebugKeys)).RegisterRoutes(router.Group("/api"))
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -123,11 +751,59 @@ func runServer(cmd *cobra.Command, args []string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Stop scheduler before the engine so no new executions are triggered
+	schedulerService.Stop()
+	deprecationManager.Stop()
+	flagManager.Stop()
+	sloManager.Stop()
+	if spikeManager != nil {
+		spikeManager.Stop()
+	}
+	approvalManager.Stop()
+	scratchReaper.Stop()
+	freezeManager.Stop()
+
+	// Checkpointed backfill jobs resume on the next start
+	backfillRunner.Stop()
+
+	// Drain the workflow engine: running executions follow the shutdown
+	// policy of their workflow, those still running after the drain
+	// deadline are checkpointed after their current step
+	parkedResumer.Stop()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Cluster.DrainTimeout)
+	drainStatus, err := workflowEngine.Drain(drainCtx, cfg.Cluster.DrainDeadline)
+	cancelDrain()
+	if err != nil {
+		logrus.Errorf("Workflow engine did not drain: %v", err)
+	}
+	if drainStatus != nil {
+		for policy, progress := range drainStatus.Policies {
+			logrus.WithFields(logrus.Fields{
+				"shutdown_policy": policy,
+				"ended":           progress.Ended,
+				"parked":          progress.Parked,
+				"interrupted":     progress.Interrupted,
+				"running":         progress.Running,
+			}).Info("Drained workflow executions")
+		}
+	}
+
 	// Shutdown workflow engine
 	if err := workflowEngine.Stop(); err != nil {
 		logrus.Errorf("Error stopping workflow engine: %v", err)
 	}
 
+	// Drain queued events after the engine emitted its last ones
+	eventDispatcher.Stop()
+
+	// Stop heartbeats after the engine so the node reports its executions
+	// until they end
+	nodeManager.Stop()
+	nodeAgent.Stop()
+
+	// Stop analytics exporter after the engine so terminal events are flushed
+	analyticsExporter.Stop()
+
 	// Shutdown metrics collector
 	if err := metricsCollector.Stop(); err != nil {
 		logrus.Errorf("Error stopping metrics collector: %v", err)
@@ -141,6 +817,263 @@ func runServer(cmd *cobra.Command, args []string) {
 	logrus.Info("Server exited")
 }
 
+func setupAnalytics(cfg config.AnalyticsConfig, db *gorm.DB, metricsCollector analytics.MetricsRecorder) (*analytics.Exporter, error) {
+	exporterConfig := analytics.DefaultConfig()
+	if cfg.BufferSize > 0 {
+		exporterConfig.BufferSize = cfg.BufferSize
+	}
+	if cfg.BatchSize > 0 {
+		exporterConfig.BatchSize = cfg.BatchSize
+	}
+	if cfg.FlushInterval > 0 {
+		exporterConfig.FlushInterval = cfg.FlushInterval
+	}
+
+	spillStore := analytics.NewGormSpillStore(db)
+	if err := spillStore.Migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate analytics spill store: %w", err)
+	}
+
+	exporter := analytics.NewExporter(exporterConfig, spillStore, metricsCollector, logrus.StandardLogger())
+	if !cfg.Enabled {
+		return exporter, nil
+	}
+
+	for _, sinkConfig := range cfg.Sinks {
+		filter := analytics.Filter{
+			Namespaces:    sinkConfig.Namespaces,
+			Workflows:     sinkConfig.Workflows,
+			IncludeFields: sinkConfig.IncludeFields,
+			ExcludeFields: sinkConfig.ExcludeFields,
+		}
+
+		switch sinkConfig.Type {
+		case "jsonl":
+			sink := analytics.NewJSONLSink(sinkConfig.Name, analytics.NewFileObjectStore(sinkConfig.Path), sinkConfig.Prefix)
+			if err := exporter.AddSink(sink, filter); err != nil {
+				return nil, err
+			}
+		case "kafka":
+			// Kafka sinks need a producer client, which is wired in by
+			// deployments that ship one
+			logrus.Warnf("Analytics sink %s skipped: no Kafka producer configured", sinkConfig.Name)
+		}
+	}
+
+	return exporter, nil
+}
+
+func setupMaintenanceWindows(cfg config.AdmissionConfig) (admission.MaintenanceWindows, error) {
+	windows := make(admission.MaintenanceWindows, 0, len(cfg.MaintenanceWindows))
+	for _, window := range cfg.MaintenanceWindows {
+		start, end, err := window.Period()
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, admission.MaintenanceWindow{
+			Name:   window.Name,
+			Start:  start,
+			End:    end,
+			Reason: window.Reason,
+		})
+	}
+	return windows, nil
+}
+
+func setupBackfill(cfg config.BackfillConfig, db *gorm.DB) (*backfill.Runner, error) {
+	store := backfill.NewGormStore(db)
+	if err := store.Migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate backfill job store: %w", err)
+	}
+
+	runnerConfig := backfill.Config{
+		DefaultBatchSize: cfg.BatchSize,
+		MaxConcurrency:   cfg.MaxConcurrency,
+		Share:            cfg.Share,
+		PollInterval:     cfg.PollInterval,
+	}
+	return backfill.NewRunner(runnerConfig, store, database.NewExecutionRepository(db), logrus.StandardLogger()), nil
+}
+
+func setupSLOs(cfg config.SLOConfig, db *gorm.DB) (*slo.Manager, error) {
+	store := slo.NewGormStore(db)
+	if err := store.Migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate SLO store: %w", err)
+	}
+
+	managerConfig := slo.Config{
+		EvaluationInterval: cfg.EvaluationInterval,
+		FastBurnWindow:     cfg.FastBurnWindow,
+		FastBurnRate:       cfg.FastBurnRate,
+		SlowBurnWindow:     cfg.SlowBurnWindow,
+		SlowBurnRate:       cfg.SlowBurnRate,
+	}
+	return slo.NewManager(managerConfig, store, database.NewWorkflowRepository(db), database.NewExecutionRepository(db), logrus.StandardLogger()), nil
+}
+
+// setupTriggers creates the webhook triggers, verifying signatures with the
+// scheme preset of each trigger overridden by its own settings
+func setupTriggers(cfg config.TriggersConfig) ([]*triggers.Trigger, error) {
+	webhookTriggers := make([]*triggers.Trigger, 0, len(cfg.Webhooks))
+	for _, webhook := range cfg.Webhooks {
+		var scheme triggers.Scheme
+		if webhook.Scheme != "" {
+			preset, exists := triggers.Schemes[webhook.Scheme]
+			if !exists {
+				return nil, fmt.Errorf("unknown signature scheme %s of webhook trigger %s", webhook.Scheme, webhook.Name)
+			}
+			scheme = preset
+		}
+		if webhook.Header != "" {
+			scheme.Header = webhook.Header
+		}
+		if webhook.Algorithm != "" {
+			scheme.Algorithm = triggers.Algorithm(webhook.Algorithm)
+		}
+		if webhook.Encoding != "" {
+			scheme.Encoding = triggers.Encoding(webhook.Encoding)
+		}
+		if webhook.Prefix != "" {
+			scheme.Prefix = webhook.Prefix
+		}
+		if webhook.Tolerance > 0 {
+			scheme.Tolerance = webhook.Tolerance
+		}
+
+		verifier, err := triggers.NewVerifier(scheme, webhook.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("webhook trigger %s: %w", webhook.Name, err)
+		}
+		webhookTriggers = append(webhookTriggers, &triggers.Trigger{
+			Name:       webhook.Name,
+			WorkflowID: uuid.MustParse(webhook.WorkflowID),
+			Verifier:   verifier,
+		})
+	}
+	return webhookTriggers, nil
+}
+
+// setupRegenerator creates the regenerator of the clients of the configured
+// workflows and languages
+func setupRegenerator(cfg config.AutoRegenerateConfig, watchHub *watch.Hub, db *gorm.DB, messages branding.Resolver) *codegen.Regenerator {
+	targets := make([]codegen.RegenerateTarget, 0, len(cfg.Targets))
+	for _, target := range cfg.Targets {
+		targets = append(targets, codegen.RegenerateTarget{
+			Workflow:    target.Workflow,
+			Language:    codegen.Language(target.Language),
+			PackageName: target.PackageName,
+		})
+	}
+	generator := codegen.NewCodeGenerator()
+	generator.SetMessages(messages)
+	return codegen.NewRegenerator(cfg.OutputDir, targets, watchHub, database.NewWorkflowRepository(db), generator, logrus.StandardLogger())
+}
+
+// setupTenancy maps the API keys of the tenants to their tenant
+func setupTenancy(cfg config.TenancyConfig) map[string]string {
+	keys := make(map[string]string)
+	for _, tenant := range cfg.Tenants {
+		for _, key := range tenant.APIKeys {
+			keys[key] = tenant.Name
+		}
+	}
+	return keys
+}
+
+func setupQuotas(cfg config.QuotasConfig) *quotas.Limiter {
+	toLimit := func(limit config.QuotaLimit) quotas.Limit {
+		return quotas.Limit{
+			Executions: limit.Executions,
+			Period:     limit.Period,
+			Burst:      limit.Burst,
+		}
+	}
+
+	quotasConfig := quotas.Config{
+		Default: toLimit(cfg.Default),
+		Tenants: make(map[string]quotas.Limit, len(cfg.Tenants)),
+	}
+	for tenant, limit := range cfg.Tenants {
+		quotasConfig.Tenants[tenant] = toLimit(limit)
+	}
+	return quotas.NewLimiter(quotasConfig)
+}
+
+func setupSpikes(cfg config.SpikesConfig, db *gorm.DB) (*spikes.Manager, error) {
+	store := spikes.NewGormStore(db)
+	if err := store.Migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate spike guard store: %w", err)
+	}
+	manager := spikes.NewManager(spikes.Config{
+		Action:         spikes.Action(cfg.Action),
+		Multiplier:     cfg.Multiplier,
+		MinRate:        cfg.MinRate,
+		Window:         cfg.Window,
+		BaselineWindow: cfg.BaselineWindow,
+		CoolDown:       cfg.CoolDown,
+		SweepInterval:  cfg.SweepInterval,
+	}, store, logrus.StandardLogger())
+	if err := manager.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+func setupTriage(cfg config.TriageConfig, db *gorm.DB) (*triage.Classifier, error) {
+	executions := database.NewExecutionRepository(db)
+	classifier := triage.NewClassifier(triage.Config{
+		RecentWindow: cfg.RecentWindow,
+		RecentLimit:  cfg.RecentLimit,
+		Timeout:      cfg.Timeout,
+	}, triage.Sources{
+		Executions: executions,
+		Stats:      executions,
+		Workflows:  database.NewWorkflowRepository(db),
+	})
+
+	for namespace, rules := range cfg.Namespaces {
+		triageRules := make([]triage.Rule, 0, len(rules))
+		for _, rule := range rules {
+			boosts := make([]triage.Boost, 0, len(rule.Boosts))
+			for _, boost := range rule.Boosts {
+				boosts = append(boosts, triage.Boost{When: boost.When, Weight: boost.Weight})
+			}
+			triageRules = append(triageRules, triage.Rule{
+				Name:       rule.Name,
+				Class:      rule.Class,
+				When:       rule.When,
+				Confidence: rule.Confidence,
+				Boosts:     boosts,
+				Action:     rule.Action,
+				Priority:   rule.Priority,
+			})
+		}
+		if err := classifier.SetRules(namespace, triageRules); err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+	}
+	return classifier, nil
+}
+
+func scriptLimits(cfg config.ScriptsConfig) scripting.LimitsConfig {
+	toLimits := func(limits config.ScriptLimits) scripting.Limits {
+		return scripting.Limits{
+			MaxMemoryBytes: limits.MaxMemoryBytes,
+			MaxOps:         limits.MaxOps,
+			Timeout:        limits.Timeout,
+		}
+	}
+
+	limitsConfig := scripting.LimitsConfig{
+		Default:    toLimits(cfg.Limits),
+		Namespaces: make(map[string]scripting.Limits, len(cfg.Namespaces)),
+	}
+	for namespace, limits := range cfg.Namespaces {
+		limitsConfig.Namespaces[namespace] = toLimits(limits)
+	}
+	return limitsConfig
+}
+
 func setupLogging(level string, cfg config.LoggingConfig) {
 	// Set log level
 	logLevel, err := logrus.ParseLevel(level)
@@ -170,4 +1103,4 @@ func setupLogging(level string, cfg config.LoggingConfig) {
 			logrus.SetOutput(file)
 		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/magic-flow/v2/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateProbe        bool
+	validateProbeTimeout time.Duration
+	validateFormat       string
+)
+
+func newValidateConfigCommand() *cobra.Command {
+	validateCmd := &cobra.Command{
+		Use:   "validate-config",
+		Short: "Validate a configuration file and report every issue",
+		Long: "Loads the configuration like the server, with its profile overlay and environment variables, " +
+			"and reports every error and warning it finds rather than the first one. " +
+			"With --probe the database, cache, TLS files and artifact directory it references are checked as well. " +
+			"The command fails when the configuration has errors.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runValidateConfig,
+	}
+	validateCmd.Flags().StringVarP(&configFile, "config", "c", "config.yaml", "Configuration file path")
+	validateCmd.Flags().BoolVar(&validateProbe, "probe", false, "Check that the external resources the configuration references can be used")
+	validateCmd.Flags().DurationVar(&validateProbeTimeout, "probe-timeout", 5*time.Second, "Maximum time each probe may take")
+	validateCmd.Flags().StringVarP(&validateFormat, "output", "o", "text", "Report format (text, json)")
+	return validateCmd
+}
+
+func runValidateConfig(cmd *cobra.Command, args []string) error {
+	if validateFormat != "text" && validateFormat != "json" {
+		return fmt.Errorf("unsupported report format %q, expected text or json", validateFormat)
+	}
+
+	cfg, report, err := config.Diagnose(configFile)
+	if err != nil {
+		return err
+	}
+	if validateProbe {
+		report.Add(config.Probe(cmd.Context(), cfg, validateProbeTimeout)...)
+	}
+
+	if err := writeConfigReport(cmd.OutOrStdout(), report, validateFormat); err != nil {
+		return err
+	}
+	if report.HasErrors() {
+		return fmt.Errorf("invalid configuration: %s", report.Summary())
+	}
+	return nil
+}
+
+func writeConfigReport(w io.Writer, report *config.Report, format string) error {
+	if format == "json" {
+		return report.WriteJSON(w)
+	}
+	return report.WriteText(w)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/magic-flow/v2/internal/database"
+	"github.com/magic-flow/v2/internal/importer"
+	"github.com/magic-flow/v2/internal/runner"
+	"github.com/magic-flow/v2/internal/services"
+	"github.com/magic-flow/v2/internal/versioning"
+	"github.com/magic-flow/v2/pkg/config"
+	"github.com/magic-flow/v2/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importDryRun    bool
+	importCreatedBy string
+
+	runInput        string
+	runWait         bool
+	runTimeout      time.Duration
+	runPollInterval time.Duration
+	runCreatedBy    string
+)
+
+func newWorkflowCommand() *cobra.Command {
+	workflowCmd := &cobra.Command{
+		Use:   "workflow",
+		Short: "Manage workflows",
+	}
+
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import a workflow definition from a YAML or JSON file",
+		Long: "Validates a workflow definition file and creates its workflow with version " + importer.Version + ". " +
+			"With --dry-run the definition is only validated and nothing is written to the database.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runWorkflowImport,
+	}
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Validate the definition without creating the workflow")
+	importCmd.Flags().StringVar(&importCreatedBy, "created-by", "cli", "Creator recorded on the imported workflow")
+	importCmd.Flags().StringVarP(&configFile, "config", "c", "config.yaml", "Configuration file path")
+	importCmd.Flags().StringVarP(&logLevel, "log-level", "l", "warn", "Log level (debug, info, warn, error)")
+
+	runCmd := &cobra.Command{
+		Use:   "run <workflow_id>",
+		Short: "Start an execution of a workflow",
+		Long: "Starts an execution of a workflow with the JSON object in the --input file (\"-\" reads standard input). " +
+			"With --wait the command waits for the execution to finish, or only for its critical path when background steps remain, " +
+			"prints its output and fails unless it completed.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runWorkflowRun,
+	}
+	runCmd.Flags().StringVarP(&runInput, "input", "i", "", "JSON file with the execution input")
+	runCmd.Flags().BoolVar(&runWait, "wait", false, "Wait for the execution to finish")
+	runCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "Maximum time to wait for the execution, no limit if zero")
+	runCmd.Flags().DurationVar(&runPollInterval, "poll-interval", runner.DefaultPollInterval, "How often to check the execution while waiting")
+	runCmd.Flags().StringVar(&runCreatedBy, "created-by", "cli", "Creator recorded on the execution")
+	runCmd.Flags().StringVarP(&configFile, "config", "c", "config.yaml", "Configuration file path")
+	runCmd.Flags().StringVarP(&logLevel, "log-level", "l", "warn", "Log level (debug, info, warn, error)")
+
+	workflowCmd.AddCommand(importCmd)
+	workflowCmd.AddCommand(runCmd)
+	return workflowCmd
+}
+
+func runWorkflowImport(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	setupLogging(logLevel, cfg.Logging)
+
+	// Dry runs only validate, so they never connect to the database
+	var create importer.CreateFunc
+	if !importDryRun {
+		db, err := database.Initialize(cfg.Database)
+		if err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		serviceContainer := services.NewContainer(db, cfg)
+		create = func(ctx context.Context, definition *importer.Definition) (*models.Workflow, error) {
+			content, err := definition.JSON()
+			if err != nil {
+				return nil, err
+			}
+			return serviceContainer.WorkflowService.CreateWorkflow(&services.CreateWorkflowRequest{
+				Name:           definition.Name,
+				Description:    definition.Description,
+				JSONDefinition: string(content),
+				CreatedBy:      importCreatedBy,
+			})
+		}
+	}
+
+	result, err := importer.New(versioning.NewValidator(validationConfig(cfg)), create).Import(cmd.Context(), args[0], importDryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", warning)
+	}
+	if importDryRun {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s is valid: workflow %s would be created with version %s\n", args[0], result.Name, result.Version)
+		return nil
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Imported workflow %s version %s (%s)\n", result.Name, result.Version, result.Workflow.ID)
+	return nil
+}
+
+func runWorkflowRun(cmd *cobra.Command, args []string) error {
+	workflowID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid workflow ID %q", args[0])
+	}
+	input, err := runner.ReadInput(runInput)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	setupLogging(logLevel, cfg.Logging)
+
+	db, err := database.Initialize(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	serviceContainer := services.NewContainer(db, cfg)
+
+	// Executions are started the way the scheduler starts them, through the
+	// workflow service
+	start := func(ctx context.Context, workflowID uuid.UUID, input map[string]interface{}) (*models.Execution, error) {
+		return serviceContainer.WorkflowService.ExecuteWorkflow(&services.ExecuteWorkflowRequest{
+			WorkflowID:  workflowID,
+			TriggerType: string(models.TriggerTypeManual),
+			TriggerData: map[string]interface{}{"source": "cli"},
+			Input:       input,
+			CreatedBy:   runCreatedBy,
+		})
+	}
+	get := func(ctx context.Context, executionID uuid.UUID) (*models.Execution, error) {
+		return serviceContainer.ExecutionService.GetExecution(executionID)
+	}
+
+	ctx := cmd.Context()
+	if runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, runTimeout)
+		defer cancel()
+	}
+
+	execution, err := runner.New(start, get).WithPollInterval(runPollInterval).Run(ctx, workflowID, input, runWait)
+	if err != nil {
+		return err
+	}
+	if !runWait {
+		fmt.Fprintf(cmd.OutOrStdout(), "Started execution %s\n", execution.ID)
+		return nil
+	}
+
+	if execution.IsFinished() {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Execution %s %s\n", execution.ID, execution.Status)
+	} else {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Execution %s responded, background steps are still running\n", execution.ID)
+	}
+	output, err := json.MarshalIndent(execution.OutputData, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode execution output: %w", err)
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(output))
+	return nil
+}
+
+// validationConfig returns the validation config of workflow definitions,
+// with the limits and strict mode set in the versioning config
+func validationConfig(cfg *config.Config) *versioning.ValidationConfig {
+	validation := versioning.DefaultValidationConfig()
+	validation.MaxStepsPerWorkflow = cfg.Versioning.MaxSteps
+	validation.MaxNestingDepth = cfg.Versioning.MaxNestingDepth
+	validation.StrictMode = cfg.Versioning.StrictMode
+	validation.Complexity = complexityConfig(cfg.Versioning)
+	return validation
+}
+
+// complexityConfig returns the complexity limits of definitions set in the
+// versioning config
+func complexityConfig(cfg config.VersioningConfig) versioning.ComplexityConfig {
+	toLimit := func(limit config.ComplexityLimit) versioning.Limit {
+		return versioning.Limit{Soft: limit.Soft, Hard: limit.Hard}
+	}
+	toLimits := func(limits config.ComplexityLimits) versioning.ComplexityLimits {
+		return versioning.ComplexityLimits{
+			NestingDepth:     toLimit(limits.NestingDepth),
+			ExpandedSteps:    toLimit(limits.ExpandedSteps),
+			ParallelBranches: toLimit(limits.ParallelBranches),
+			DefinitionBytes:  toLimit(limits.DefinitionBytes),
+			ExpressionLength: toLimit(limits.ExpressionLength),
+		}
+	}
+
+	complexity := versioning.ComplexityConfig{
+		Default:    toLimits(cfg.Complexity),
+		Namespaces: make(map[string]versioning.ComplexityLimits, len(cfg.Namespaces)),
+	}
+	for namespace, limits := range cfg.Namespaces {
+		complexity.Namespaces[namespace] = toLimits(limits)
+	}
+	return complexity
+}
@@ -11,6 +11,7 @@ require (
 	gorm.io/gorm v1.25.5
 	gorm.io/driver/postgres v1.5.4
 	gorm.io/driver/mysql v1.5.2
+	gorm.io/driver/sqlite v1.5.4
 	
 	// Redis for caching
 	github.com/redis/go-redis/v9 v9.3.0
@@ -18,6 +19,7 @@ require (
 	// Configuration
 	github.com/spf13/viper v1.17.0
 	github.com/spf13/cobra v1.8.0
+	github.com/fsnotify/fsnotify v1.7.0
 	
 	// YAML processing
 	gopkg.in/yaml.v3 v3.0.1
@@ -54,6 +56,18 @@ require (
 	github.com/tidwall/gjson v1.17.0
 	github.com/tidwall/sjson v1.2.5
 	
+	// Compression of persisted execution payloads
+	github.com/klauspost/compress v1.17.4
+	
+	// MessagePack encoding of the execution APIs
+	github.com/ugorji/go/codec v1.2.11
+	
+	// JavaScript engine for script steps
+	github.com/dop251/goja v0.0.0-20231027120936-b396bb4c349d
+	
+	// Protocol Buffers for gRPC code generation
+	google.golang.org/protobuf v1.34.1
+	
 	// Context and cancellation
 	context
 	time
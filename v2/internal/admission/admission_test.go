@@ -0,0 +1,634 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/deprecation"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+type fakeEngine struct {
+	accepting bool
+	running   int
+	capacity  int
+	stepTypes []string
+}
+
+func (e *fakeEngine) Accepting() bool        { return e.accepting }
+func (e *fakeEngine) RunningExecutions() int { return e.running }
+func (e *fakeEngine) Capacity() int          { return e.capacity }
+func (e *fakeEngine) StepTypes() []string    { return e.stepTypes }
+
+type fakeFastLane struct {
+	fakeEngine
+	free bool
+}
+
+func (e *fakeFastLane) FastLaneAvailable(definition models.WorkflowDefinition) bool {
+	return e.free && definition.Spec.Mode() == models.ExecutionModeLightweight
+}
+
+type fakeVersions map[uuid.UUID]*models.WorkflowVersion
+
+func (v fakeVersions) GetVersion(ctx context.Context, versionID uuid.UUID) (*models.WorkflowVersion, error) {
+	version, ok := v[versionID]
+	if !ok {
+		return nil, errors.New("version not found")
+	}
+	return version, nil
+}
+
+type fakeRollouts struct {
+	rollout *Rollout
+}
+
+func (r *fakeRollouts) ActiveRollout(ctx context.Context, workflowID uuid.UUID) (*Rollout, error) {
+	return r.rollout, nil
+}
+
+type fakeQuotas struct {
+	remaining int
+}
+
+func (q *fakeQuotas) RemainingExecutions(ctx context.Context, workflow *models.Workflow) (int, bool, error) {
+	return q.remaining, true, nil
+}
+
+type fakeBreakers map[string]bool
+
+func (b fakeBreakers) IsOpen(stepType string) bool {
+	return b[stepType]
+}
+
+type fakeDeprecations struct {
+	resolution *deprecation.Resolution
+	err        error
+}
+
+func (d *fakeDeprecations) Resolve(ctx context.Context, workflow *models.Workflow, versionID *uuid.UUID, input map[string]interface{}) (*deprecation.Resolution, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.resolution != nil {
+		return d.resolution, nil
+	}
+	return &deprecation.Resolution{Workflow: workflow, Input: input}, nil
+}
+
+type fakePolicies struct {
+	result   *policies.Result
+	requests []*policies.ExecutionRequest
+}
+
+func (p *fakePolicies) EvaluateExecution(ctx context.Context, request *policies.ExecutionRequest) (*policies.Result, error) {
+	p.requests = append(p.requests, request)
+	if p.result != nil {
+		return p.result, nil
+	}
+	return &policies.Result{Hook: policies.HookExecutionAdmission, Decision: policies.DecisionAllow}, nil
+}
+
+func policyResult(decision policies.Decision, reason string) *policies.Result {
+	return &policies.Result{
+		Hook:     policies.HookExecutionAdmission,
+		Decision: decision,
+		Policies: []policies.PolicyResult{{Name: "payments", Decision: decision, Reasons: []string{reason}}},
+	}
+}
+
+type fakeReservations struct {
+	reservation *Reservation
+	held        int
+	claims      []uuid.UUID
+}
+
+func (r *fakeReservations) Match(ctx context.Context, workflow *models.Workflow, token string, at time.Time) (*Reservation, error) {
+	if r.reservation == nil || (token != "" && token != "rsv_campaign") {
+		return nil, nil
+	}
+	return r.reservation, nil
+}
+
+func (r *fakeReservations) Held(ctx context.Context, at time.Time) (int, error) {
+	return r.held, nil
+}
+
+func (r *fakeReservations) Claim(ctx context.Context, reservationID, executionID uuid.UUID, at time.Time) error {
+	r.claims = append(r.claims, executionID)
+	return nil
+}
+
+type fakeWorkflows map[uuid.UUID]*models.Workflow
+
+func (w fakeWorkflows) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	workflow, ok := w[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return workflow, nil
+}
+
+var checkedAt = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newWorkflow() *models.Workflow {
+	return &models.Workflow{
+		ID:      uuid.New(),
+		Name:    "orders",
+		Version: "1.0.0",
+		Status:  models.WorkflowStatusActive,
+		Definition: models.WorkflowDefinition{Spec: models.WorkflowSpec{Steps: []models.WorkflowStep{
+			{Name: "charge", Type: "http"},
+			{Name: "notify", Type: "script"},
+		}}},
+		InputSchema: models.JSONSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"order_id": map[string]interface{}{"type": "string"},
+				"quantity": map[string]interface{}{"type": "integer"},
+			},
+			Required: []string{"order_id"},
+		},
+	}
+}
+
+func newSources() Sources {
+	return Sources{
+		Engine:       &fakeEngine{accepting: true, running: 1, capacity: 4, stepTypes: []string{"http", "script"}},
+		Versions:     fakeVersions{},
+		Rollouts:     &fakeRollouts{},
+		Quotas:       &fakeQuotas{remaining: 10},
+		Breakers:     fakeBreakers{},
+		Maintenance:  MaintenanceWindows{},
+		Deprecations: &fakeDeprecations{},
+		Policies:     &fakePolicies{},
+		Reservations: &fakeReservations{},
+	}
+}
+
+func newChecker(sources Sources) *AdmissionChecker {
+	checker := NewAdmissionChecker(Config{AverageExecutionTime: time.Minute}, sources)
+	checker.now = func() time.Time { return checkedAt }
+	return checker
+}
+
+func newRequest(workflow *models.Workflow) *Request {
+	return &Request{Workflow: workflow, Input: map[string]interface{}{"order_id": "o-1", "quantity": float64(2)}}
+}
+
+func checkResult(t *testing.T, report *Report, name string) CheckResult {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatalf("report has no %s check", name)
+	return CheckResult{}
+}
+
+func TestPreflight(t *testing.T) {
+	t.Run("execution that would start", func(t *testing.T) {
+		workflow := newWorkflow()
+		report := newChecker(newSources()).Preflight(context.Background(), newRequest(workflow))
+
+		assert.Equal(t, VerdictOK, report.Verdict)
+		assert.Equal(t, workflow.ID, report.WorkflowID)
+		assert.Equal(t, "1.0.0", report.Version)
+		assert.Equal(t, checkedAt, report.CheckedAt)
+		assert.Empty(t, report.Rejections())
+		for _, check := range report.Checks {
+			assert.Equal(t, CheckPassed, check.Status, check.Name)
+		}
+	})
+
+	rejections := []struct {
+		name   string
+		check  string
+		setup  func(sources *Sources, request *Request)
+		reason string
+	}{
+		{
+			name:  "workflow sunset",
+			check: "deprecation",
+			setup: func(sources *Sources, request *Request) {
+				sunsetAt := checkedAt.Add(-time.Hour)
+				notice := deprecation.NewNotice(request.Workflow, nil, &models.Deprecation{SunsetAt: &sunsetAt, SunsetPolicy: models.SunsetPolicyReject}, checkedAt)
+				sources.Deprecations = &fakeDeprecations{err: &deprecation.SunsetError{Notice: notice}}
+			},
+			reason: "workflow orders was sunset on 2024-03-01T11:00:00Z",
+		},
+		{
+			name:   "workflow disabled",
+			check:  "workflow_status",
+			setup:  func(sources *Sources, request *Request) { request.Workflow.Status = models.WorkflowStatusInactive },
+			reason: "workflow is inactive",
+		},
+		{
+			name:  "maintenance window active",
+			check: "maintenance_window",
+			setup: func(sources *Sources, request *Request) {
+				sources.Maintenance = MaintenanceWindows{{Name: "db-upgrade", Start: checkedAt.Add(-time.Hour), End: checkedAt.Add(time.Hour), Reason: "database upgrade"}}
+			},
+			reason: "maintenance window db-upgrade is active until 2024-03-01T13:00:00Z: database upgrade",
+		},
+		{
+			name:  "rollout paused",
+			check: "version",
+			setup: func(sources *Sources, request *Request) {
+				sources.Rollouts = &fakeRollouts{rollout: &Rollout{Version: "1.1.0", Paused: true, Reason: "error rate above threshold"}}
+			},
+			reason: "rollout of version 1.1.0 is paused: error rate above threshold",
+		},
+		{
+			name:  "pinned version of another workflow",
+			check: "version",
+			setup: func(sources *Sources, request *Request) {
+				version := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: uuid.New(), Version: "0.9.0"}
+				sources.Versions = fakeVersions{version.ID: version}
+				request.Options.VersionID = &version.ID
+			},
+			reason: "does not belong to the workflow",
+		},
+		{
+			name:   "input schema invalid",
+			check:  "input_schema",
+			setup:  func(sources *Sources, request *Request) { request.Input = map[string]interface{}{"quantity": 1.5} },
+			reason: "invalid input: missing required field order_id; field quantity must be of type integer",
+		},
+		{
+			name:  "policy denies",
+			check: "policies",
+			setup: func(sources *Sources, request *Request) {
+				sources.Policies = &fakePolicies{result: policyResult(policies.DecisionDeny, "amount above limit")}
+			},
+			reason: "denied by policy: payments: amount above limit",
+		},
+		{
+			name:   "quota exhausted",
+			check:  "quota",
+			setup:  func(sources *Sources, request *Request) { sources.Quotas = &fakeQuotas{remaining: 0} },
+			reason: "execution quota exhausted",
+		},
+		{
+			name:  "missing executors",
+			check: "executors",
+			setup: func(sources *Sources, request *Request) {
+				sources.Engine = &fakeEngine{accepting: true, capacity: 4, stepTypes: []string{"http"}}
+			},
+			reason: "no executor for step types script",
+		},
+		{
+			name:   "circuit breaker open",
+			check:  "circuit_breakers",
+			setup:  func(sources *Sources, request *Request) { sources.Breakers = fakeBreakers{"http": true} },
+			reason: "circuit breakers open for step types http",
+		},
+		{
+			name:  "node cordoned",
+			check: "capacity",
+			setup: func(sources *Sources, request *Request) {
+				sources.Engine = &fakeEngine{accepting: false, capacity: 4, stepTypes: []string{"http", "script"}}
+			},
+			reason: "node is not accepting new executions",
+		},
+	}
+	for _, tc := range rejections {
+		t.Run(tc.name, func(t *testing.T) {
+			sources := newSources()
+			request := newRequest(newWorkflow())
+			tc.setup(&sources, request)
+
+			report := newChecker(sources).Preflight(context.Background(), request)
+			assert.Equal(t, VerdictWouldReject, report.Verdict)
+			result := checkResult(t, report, tc.check)
+			assert.Equal(t, CheckRejected, result.Status)
+			assert.Contains(t, result.Reason, tc.reason)
+			assert.Len(t, report.Rejections(), 1, "only the %s check rejects the execution", tc.check)
+		})
+	}
+
+	t.Run("execution that would queue", func(t *testing.T) {
+		sources := newSources()
+		sources.Engine = &fakeEngine{accepting: true, running: 9, capacity: 4, stepTypes: []string{"http", "script"}}
+
+		report := newChecker(sources).Preflight(context.Background(), newRequest(newWorkflow()))
+		assert.Equal(t, VerdictWouldQueue, report.Verdict)
+		assert.Equal(t, CheckQueued, checkResult(t, report, "capacity").Status)
+		assert.Equal(t, 6, report.QueueDepth)
+		assert.Equal(t, 2*time.Minute, report.EstimatedQueueWait)
+	})
+
+	t.Run("lightweight execution in the fast lane", func(t *testing.T) {
+		sources := newSources()
+		engine := &fakeFastLane{fakeEngine: fakeEngine{accepting: true, running: 9, capacity: 4, stepTypes: []string{"http", "script"}}, free: true}
+		sources.Engine = engine
+		workflow := newWorkflow()
+		workflow.Definition.Spec.ExecutionMode = models.ExecutionModeLightweight
+
+		report := newChecker(sources).Preflight(context.Background(), newRequest(workflow))
+		assert.Equal(t, VerdictOK, report.Verdict)
+		assert.Equal(t, "fast lane slot free for lightweight execution", checkResult(t, report, "capacity").Reason)
+
+		// A full fast lane leaves lightweight executions to the regular slots
+		engine.free = false
+		report = newChecker(sources).Preflight(context.Background(), newRequest(workflow))
+		assert.Equal(t, VerdictWouldQueue, report.Verdict)
+	})
+
+	t.Run("version selection", func(t *testing.T) {
+		workflow := newWorkflow()
+		pinned := &models.WorkflowVersion{
+			ID:         uuid.New(),
+			WorkflowID: workflow.ID,
+			Version:    "0.9.0",
+			Definition: models.WorkflowDefinition{Spec: models.WorkflowSpec{Steps: []models.WorkflowStep{{Name: "legacy", Type: "legacy"}}}},
+		}
+		sources := newSources()
+		sources.Versions = fakeVersions{pinned.ID: pinned}
+		sources.Rollouts = &fakeRollouts{rollout: &Rollout{Version: "1.1.0"}}
+		checker := newChecker(sources)
+
+		report := checker.Preflight(context.Background(), newRequest(workflow))
+		assert.Equal(t, "1.1.0", report.Version, "executions run the rollout version")
+		assert.Nil(t, report.VersionID)
+
+		request := newRequest(workflow)
+		request.Options.VersionID = &pinned.ID
+		report = checker.Preflight(context.Background(), request)
+		assert.Equal(t, "0.9.0", report.Version, "pinned executions bypass the rollout")
+		assert.Equal(t, &pinned.ID, report.VersionID)
+		assert.Contains(t, checkResult(t, report, "executors").Reason, "no executor for step types legacy", "checks use the pinned definition")
+	})
+
+	t.Run("deprecated workflow", func(t *testing.T) {
+		workflow := newWorkflow()
+		sunsetAt := checkedAt.Add(24 * time.Hour)
+		notice := deprecation.NewNotice(workflow, nil, &models.Deprecation{SunsetAt: &sunsetAt, SunsetPolicy: models.SunsetPolicyReject}, checkedAt)
+		request := newRequest(workflow)
+		sources := newSources()
+		sources.Deprecations = &fakeDeprecations{resolution: &deprecation.Resolution{Workflow: workflow, Input: request.Input, Notice: notice}}
+
+		report := newChecker(sources).Preflight(context.Background(), request)
+		assert.Equal(t, VerdictOK, report.Verdict)
+		assert.Same(t, notice, report.Deprecation)
+		assert.Contains(t, checkResult(t, report, "deprecation").Reason, "workflow orders is deprecated and will be sunset on")
+		assert.Nil(t, report.ForwardedFrom)
+	})
+
+	t.Run("forwarded execution", func(t *testing.T) {
+		workflow := newWorkflow()
+		replacement := newWorkflow()
+		replacement.Name = "orders-v2"
+		replacement.Version = "2.0.0"
+		replacement.InputSchema = models.JSONSchema{
+			Properties: map[string]interface{}{"id": map[string]interface{}{"type": "string"}},
+			Required:   []string{"id"},
+		}
+		sunsetAt := checkedAt.Add(-time.Hour)
+		notice := deprecation.NewNotice(workflow, nil, &models.Deprecation{SunsetAt: &sunsetAt, SunsetPolicy: models.SunsetPolicyForward}, checkedAt)
+		resolution := &deprecation.Resolution{
+			Workflow:      replacement,
+			Input:         map[string]interface{}{"id": "o-1"},
+			Notice:        notice,
+			ForwardedFrom: &workflow.ID,
+		}
+		sources := newSources()
+		sources.Deprecations = &fakeDeprecations{resolution: resolution}
+
+		report := newChecker(sources).Preflight(context.Background(), newRequest(workflow))
+		assert.Equal(t, VerdictOK, report.Verdict, report.Rejections())
+		assert.Equal(t, replacement.ID, report.WorkflowID)
+		assert.Equal(t, "2.0.0", report.Version)
+		assert.Equal(t, &workflow.ID, report.ForwardedFrom)
+		assert.Same(t, resolution, report.Resolution)
+		assert.Equal(t, "workflow orders is sunset, forwarded to workflow orders-v2", checkResult(t, report, "deprecation").Reason)
+		assert.Equal(t, CheckPassed, checkResult(t, report, "input_schema").Status, "checks check the replacement")
+
+		replacement.Status = models.WorkflowStatusInactive
+		report = newChecker(sources).Preflight(context.Background(), newRequest(workflow))
+		assert.Equal(t, VerdictWouldReject, report.Verdict)
+		assert.Equal(t, "workflow is inactive", checkResult(t, report, "workflow_status").Reason)
+	})
+
+	t.Run("unconfigured sources", func(t *testing.T) {
+		report := newChecker(Sources{}).Preflight(context.Background(), newRequest(newWorkflow()))
+		assert.Equal(t, VerdictOK, report.Verdict)
+		for _, name := range []string{"deprecation", "maintenance_window", "policies", "reservation", "quota", "executors", "circuit_breakers", "capacity"} {
+			assert.Equal(t, CheckSkipped, checkResult(t, report, name).Status, name)
+		}
+	})
+}
+
+func TestAdmit(t *testing.T) {
+	t.Run("rejected execution", func(t *testing.T) {
+		sources := newSources()
+		sources.Quotas = &fakeQuotas{remaining: 0}
+
+		report, err := newChecker(sources).Admit(context.Background(), newRequest(newWorkflow()))
+		assert.ErrorIs(t, err, ErrRejected)
+		assert.Contains(t, err.Error(), "quota: execution quota exhausted")
+		assert.Equal(t, VerdictWouldReject, report.Verdict)
+	})
+
+	t.Run("queued execution is admitted", func(t *testing.T) {
+		sources := newSources()
+		sources.Engine = &fakeEngine{accepting: true, running: 4, capacity: 4, stepTypes: []string{"http", "script"}}
+
+		report, err := newChecker(sources).Admit(context.Background(), newRequest(newWorkflow()))
+		require.NoError(t, err)
+		assert.Equal(t, VerdictWouldQueue, report.Verdict)
+	})
+}
+
+func TestPolicies(t *testing.T) {
+	t.Run("warned execution is admitted", func(t *testing.T) {
+		sources := newSources()
+		sources.Policies = &fakePolicies{result: policyResult(policies.DecisionWarn, "large payment")}
+
+		report, err := newChecker(sources).Admit(context.Background(), newRequest(newWorkflow()))
+		require.NoError(t, err)
+		assert.Equal(t, VerdictOK, report.Verdict)
+		assert.Equal(t, CheckResult{Name: "policies", Status: CheckWarned, Reason: "payments: large payment"}, checkResult(t, report, "policies"))
+		assert.Equal(t, policies.DecisionWarn, report.Policy.Decision)
+	})
+
+	t.Run("policies see the selected version", func(t *testing.T) {
+		workflow := newWorkflow()
+		pinned := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: workflow.ID, Version: "0.9.0", Definition: workflow.Definition}
+		pinned.Definition.Metadata.Labels = map[string]string{"namespace": "payments"}
+		evaluator := &fakePolicies{}
+		sources := newSources()
+		sources.Versions = fakeVersions{pinned.ID: pinned}
+		sources.Policies = evaluator
+		checker := newChecker(sources)
+
+		request := newRequest(workflow)
+		request.Options.VersionID = &pinned.ID
+		request.Actor = "alice"
+		checker.Preflight(context.Background(), request)
+		_, err := checker.Admit(context.Background(), request)
+		require.NoError(t, err)
+
+		require.Len(t, evaluator.requests, 2)
+		assert.True(t, evaluator.requests[0].DryRun, "pre-flight decisions are not recorded")
+		assert.False(t, evaluator.requests[1].DryRun)
+		assert.Equal(t, "0.9.0", evaluator.requests[1].Version)
+		assert.Equal(t, "payments", policies.Namespace(evaluator.requests[1].Definition))
+		assert.Equal(t, "alice", evaluator.requests[1].Actor)
+		assert.Equal(t, request.Input, evaluator.requests[1].Input)
+	})
+}
+
+func TestReservations(t *testing.T) {
+	campaign := &Reservation{ID: uuid.New(), Name: "spring-campaign", FreeSlots: 2, RemainingExecutions: 100}
+
+	t.Run("reserved execution starts in a reserved slot past its quota", func(t *testing.T) {
+		reservations := &fakeReservations{reservation: campaign, held: 2}
+		sources := newSources()
+		sources.Engine = &fakeEngine{accepting: true, running: 2, capacity: 4, stepTypes: []string{"http", "script"}}
+		sources.Quotas = &fakeQuotas{remaining: 0}
+		sources.Reservations = reservations
+		checker := newChecker(sources)
+
+		request := newRequest(newWorkflow())
+		request.Options.ReservationToken = "rsv_campaign"
+		request.ExecutionID = uuid.New()
+		report := checker.Preflight(context.Background(), request)
+		assert.Equal(t, VerdictOK, report.Verdict, report.Rejections())
+		assert.Same(t, campaign, report.Reservation)
+		assert.Equal(t, 2, report.ReservedSlots)
+		assert.Equal(t, "reserved by reservation spring-campaign", checkResult(t, report, "quota").Reason)
+		assert.Equal(t, "reserved slot of reservation spring-campaign, 2 of 4 execution slots in use", checkResult(t, report, "capacity").Reason)
+		assert.Empty(t, reservations.claims, "pre-flight requests claim no slot")
+
+		_, err := checker.Admit(context.Background(), request)
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{request.ExecutionID}, reservations.claims)
+	})
+
+	t.Run("unreserved execution queues behind reserved slots", func(t *testing.T) {
+		sources := newSources()
+		sources.Engine = &fakeEngine{accepting: true, running: 2, capacity: 4, stepTypes: []string{"http", "script"}}
+		sources.Reservations = &fakeReservations{held: 2}
+
+		report := newChecker(sources).Preflight(context.Background(), newRequest(newWorkflow()))
+		assert.Equal(t, VerdictWouldQueue, report.Verdict)
+		assert.Nil(t, report.Reservation)
+		assert.Equal(t, 1, report.QueueDepth)
+		assert.Equal(t, "all 4 execution slots in use or reserved (2 reserved), 1 executions ahead", checkResult(t, report, "capacity").Reason)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		reservations := &fakeReservations{reservation: campaign}
+		sources := newSources()
+		sources.Reservations = reservations
+
+		request := newRequest(newWorkflow())
+		request.Options.ReservationToken = "rsv_unknown"
+		report, err := newChecker(sources).Admit(context.Background(), request)
+		require.NoError(t, err)
+		assert.Equal(t, CheckWarned, checkResult(t, report, "reservation").Status)
+		assert.Nil(t, report.Reservation)
+		assert.Empty(t, reservations.claims)
+	})
+
+	t.Run("rejected execution claims no slot", func(t *testing.T) {
+		reservations := &fakeReservations{reservation: campaign}
+		sources := newSources()
+		sources.Reservations = reservations
+		sources.Breakers = fakeBreakers{"http": true}
+
+		_, err := newChecker(sources).Admit(context.Background(), newRequest(newWorkflow()))
+		assert.ErrorIs(t, err, ErrRejected)
+		assert.Empty(t, reservations.claims)
+	})
+}
+
+// TestPreflightSharesAdmissionChecks guards that pre-flight reports cannot
+// drift from admission: both run the same registered checks, in the same
+// order, with the same results
+func TestPreflightSharesAdmissionChecks(t *testing.T) {
+	checker := newChecker(newSources())
+	assert.Equal(t, []string{
+		"deprecation",
+		"workflow_status",
+		"maintenance_window",
+		"version",
+		"input_schema",
+		"policies",
+		"reservation",
+		"quota",
+		"executors",
+		"circuit_breakers",
+		"capacity",
+	}, checker.Checks())
+
+	request := newRequest(newWorkflow())
+	request.Input = map[string]interface{}{}
+	preflight := checker.Preflight(context.Background(), request)
+	admitted, err := checker.Admit(context.Background(), request)
+	assert.ErrorIs(t, err, ErrRejected)
+
+	names := func(report *Report) []string {
+		var names []string
+		for _, check := range report.Checks {
+			names = append(names, check.Name)
+		}
+		return names
+	}
+	assert.Equal(t, checker.Checks(), names(preflight))
+	assert.Equal(t, checker.Checks(), names(admitted))
+	assert.Equal(t, preflight, admitted)
+
+	for i, check := range defaultChecks() {
+		assert.Equal(t, reflect.ValueOf(check.run).Pointer(), reflect.ValueOf(checker.checks[i].run).Pointer(), check.name)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	workflow := newWorkflow()
+	router := gin.New()
+	NewHandlers(newChecker(newSources()), fakeWorkflows{workflow.ID: workflow}).RegisterRoutes(router.Group("/api"))
+
+	preflight := func(id string, body interface{}) *httptest.ResponseRecorder {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/workflows/"+id+"/preflight", bytes.NewReader(payload)))
+		return recorder
+	}
+
+	t.Run("report", func(t *testing.T) {
+		recorder := preflight(workflow.ID.String(), PreflightRequest{Input: map[string]interface{}{"quantity": 1}})
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var report Report
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+		assert.Equal(t, VerdictWouldReject, report.Verdict)
+		assert.Equal(t, []string{"input_schema: invalid input: missing required field order_id"}, report.Rejections())
+	})
+
+	t.Run("unknown workflow", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, preflight(uuid.New().String(), PreflightRequest{}).Code)
+	})
+
+	t.Run("invalid workflow ID", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, preflight("not-a-uuid", PreflightRequest{}).Code)
+	})
+}
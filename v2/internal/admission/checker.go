@@ -0,0 +1,258 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/deprecation"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrRejected is returned by Admit when an execution fails an admission check
+var ErrRejected = errors.New("execution rejected")
+
+// Verdict is the outcome of the admission checks of an execution
+type Verdict string
+
+const (
+	// VerdictOK means the execution would start right away
+	VerdictOK Verdict = "ok"
+	// VerdictWouldQueue means the execution would be admitted but wait for
+	// running executions to finish
+	VerdictWouldQueue Verdict = "would_queue"
+	// VerdictWouldReject means the execution would be rejected
+	VerdictWouldReject Verdict = "would_reject"
+)
+
+// CheckStatus is the outcome of one admission check
+type CheckStatus string
+
+const (
+	CheckPassed   CheckStatus = "passed"
+	CheckQueued   CheckStatus = "queued"
+	CheckRejected CheckStatus = "rejected"
+	// CheckWarned means the check admits the execution with a warning, such
+	// as a policy warning about it
+	CheckWarned CheckStatus = "warned"
+	// CheckSkipped means the check has nothing to check against, such as the
+	// quota check of a deployment without quotas
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// CheckResult is the outcome of one admission check
+type CheckResult struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+// Report is the outcome of the admission checks of an execution
+type Report struct {
+	WorkflowID uuid.UUID     `json:"workflow_id"`
+	Verdict    Verdict       `json:"verdict"`
+	Checks     []CheckResult `json:"checks"`
+	// QueueDepth is the number of executions the execution would wait for
+	QueueDepth         int           `json:"queue_depth"`
+	EstimatedQueueWait time.Duration `json:"estimated_queue_wait"`
+	// Version is the workflow version the execution would run
+	Version   string     `json:"version"`
+	VersionID *uuid.UUID `json:"version_id,omitempty"`
+	// Deprecation describes the deprecation of the requested workflow
+	Deprecation *deprecation.Notice `json:"deprecation,omitempty"`
+	// ForwardedFrom is the sunset workflow the execution is forwarded from,
+	// WorkflowID being its replacement
+	ForwardedFrom *uuid.UUID `json:"forwarded_from,omitempty"`
+	// Policy is the decision of the admission policies of the workflow
+	Policy *policies.Result `json:"policy,omitempty"`
+	// Reservation is the capacity reservation the execution draws on
+	Reservation *Reservation `json:"reservation,omitempty"`
+	// ReservedSlots is the number of free slots reservations keep for
+	// their executions, which other executions cannot use
+	ReservedSlots int       `json:"reserved_slots"`
+	CheckedAt     time.Time `json:"checked_at"`
+	// Resolution is the workflow and input the execution runs once the
+	// deprecation of the requested workflow is applied
+	Resolution *deprecation.Resolution `json:"-"`
+}
+
+// Rejections returns the reasons of the rejected checks
+func (r *Report) Rejections() []string {
+	var reasons []string
+	for _, check := range r.Checks {
+		if check.Status == CheckRejected {
+			reasons = append(reasons, check.Name+": "+check.Reason)
+		}
+	}
+	return reasons
+}
+
+// Options are the execution options that affect admission
+type Options struct {
+	// VersionID pins the execution to a workflow version, bypassing rollouts
+	VersionID *uuid.UUID `json:"version_id,omitempty"`
+	// ReservationToken selects the capacity reservation the execution
+	// draws on among those of its workflow
+	ReservationToken string `json:"reservation_token,omitempty"`
+}
+
+// Request describes an execution about to be admitted
+type Request struct {
+	Workflow *models.Workflow
+	Input    map[string]interface{}
+	Options  Options
+	// Actor is who requested the execution, recorded with the policy
+	// decisions
+	Actor string
+	// ExecutionID is the ID of the execution being admitted, which holds
+	// its reserved slot until it ends. Pre-flight requests leave it unset.
+	ExecutionID uuid.UUID
+}
+
+// Config contains the admission settings
+type Config struct {
+	// AverageExecutionTime estimates how long an execution waits for each
+	// execution queued ahead of it
+	AverageExecutionTime time.Duration
+}
+
+// DefaultConfig returns the default admission settings
+func DefaultConfig() Config {
+	return Config{AverageExecutionTime: 30 * time.Second}
+}
+
+// Sources are the components admission checks consult. Checks whose source
+// is nil are skipped.
+type Sources struct {
+	Engine       Engine
+	Versions     VersionLoader
+	Rollouts     RolloutSource
+	Quotas       QuotaSource
+	Breakers     CircuitBreakers
+	Maintenance  MaintenanceSchedule
+	Deprecations DeprecationResolver
+	Policies     PolicyEvaluator
+	Reservations ReservationSource
+}
+
+// AdmissionChecker runs the admission checks of executions. Execution
+// requests are admitted through Admit and pre-flight requests evaluated
+// through Preflight, which run the same checks, so a pre-flight report
+// predicts the outcome of the execution request.
+type AdmissionChecker struct {
+	config  Config
+	sources Sources
+	checks  []check
+	now     func() time.Time
+}
+
+// NewAdmissionChecker creates an admission checker
+func NewAdmissionChecker(config Config, sources Sources) *AdmissionChecker {
+	return &AdmissionChecker{
+		config:  config,
+		sources: sources,
+		checks:  defaultChecks(),
+		now:     time.Now,
+	}
+}
+
+// Checks returns the names of the admission checks, in the order they run
+func (c *AdmissionChecker) Checks() []string {
+	names := make([]string, len(c.checks))
+	for i, check := range c.checks {
+		names[i] = check.name
+	}
+	return names
+}
+
+// Preflight runs every admission check of an execution without admitting
+// it. Policy decisions of pre-flight requests are not recorded.
+func (c *AdmissionChecker) Preflight(ctx context.Context, request *Request) *Report {
+	return c.evaluate(ctx, request, true)
+}
+
+// Admit runs every admission check of an execution about to be created. It
+// returns an error wrapping ErrRejected when a check rejects the execution.
+// Executions that would queue are admitted. Admitted executions are counted
+// against the reservation they draw on.
+func (c *AdmissionChecker) Admit(ctx context.Context, request *Request) (*Report, error) {
+	report := c.evaluate(ctx, request, false)
+	if report.Verdict == VerdictWouldReject {
+		return report, fmt.Errorf("%w: %s", ErrRejected, strings.Join(report.Rejections(), "; "))
+	}
+	if report.Reservation != nil {
+		if err := c.sources.Reservations.Claim(ctx, report.Reservation.ID, request.ExecutionID, report.CheckedAt); err != nil {
+			return report, fmt.Errorf("failed to claim reservation %s: %w", report.Reservation.Name, err)
+		}
+	}
+	return report, nil
+}
+
+// evaluate runs the checks. Every check runs even after one rejected the
+// execution, so the report lists all the reasons at once.
+func (c *AdmissionChecker) evaluate(ctx context.Context, request *Request, dryRun bool) *Report {
+	e := &evaluation{
+		checker: c,
+		request: request,
+		dryRun:  dryRun,
+		report: &Report{
+			WorkflowID: request.Workflow.ID,
+			Verdict:    VerdictOK,
+			Checks:     make([]CheckResult, 0, len(c.checks)),
+			Version:    request.Workflow.Version,
+			CheckedAt:  c.now().UTC(),
+		},
+		definition: request.Workflow.Definition,
+		schema:     request.Workflow.InputSchema,
+	}
+
+	for _, check := range c.checks {
+		result := check.run(ctx, e)
+		result.Name = check.name
+		e.report.Checks = append(e.report.Checks, result)
+
+		switch {
+		case result.Status == CheckRejected:
+			e.report.Verdict = VerdictWouldReject
+		case result.Status == CheckQueued && e.report.Verdict == VerdictOK:
+			e.report.Verdict = VerdictWouldQueue
+		}
+	}
+
+	return e.report
+}
+
+// evaluation is the state shared by the checks of one request
+type evaluation struct {
+	checker *AdmissionChecker
+	request *Request
+	report  *Report
+	// dryRun is set for pre-flight requests
+	dryRun bool
+	// definition and schema are those of the selected workflow version
+	definition models.WorkflowDefinition
+	schema     models.JSONSchema
+}
+
+// check is a registered admission check
+type check struct {
+	name string
+	run  func(ctx context.Context, e *evaluation) CheckResult
+}
+
+func passed(reason string) CheckResult {
+	return CheckResult{Status: CheckPassed, Reason: reason}
+}
+
+func rejected(format string, args ...interface{}) CheckResult {
+	return CheckResult{Status: CheckRejected, Reason: fmt.Sprintf(format, args...)}
+}
+
+func skipped(reason string) CheckResult {
+	return CheckResult{Status: CheckSkipped, Reason: reason}
+}
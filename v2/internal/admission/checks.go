@@ -0,0 +1,370 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"magic-flow/v2/internal/deprecation"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// defaultChecks returns the admission checks in the order they run. The
+// deprecation check runs first, the following checks checking the
+// replacement of executions it forwards. The version check runs before the
+// checks of the workflow definition, which check the definition of the
+// selected version. The reservation check runs before the quota and
+// capacity checks, which executions of reservations bypass.
+func defaultChecks() []check {
+	return []check{
+		{name: "deprecation", run: checkDeprecation},
+		{name: "workflow_status", run: checkWorkflowStatus},
+		{name: "maintenance_window", run: checkMaintenanceWindow},
+		{name: "version", run: checkVersion},
+		{name: "input_schema", run: checkInputSchema},
+		{name: "policies", run: checkPolicies},
+		{name: "reservation", run: checkReservation},
+		{name: "quota", run: checkQuota},
+		{name: "executors", run: checkExecutors},
+		{name: "circuit_breakers", run: checkCircuitBreakers},
+		{name: "capacity", run: checkCapacity},
+	}
+}
+
+// checkDeprecation rejects executions of sunset workflows whose sunset
+// policy rejects them, and forwards those whose policy forwards them to the
+// replacement, which the following checks check
+func checkDeprecation(ctx context.Context, e *evaluation) CheckResult {
+	resolver := e.checker.sources.Deprecations
+	if resolver == nil {
+		return skipped("no deprecations configured")
+	}
+
+	request := e.request
+	resolution, err := resolver.Resolve(ctx, request.Workflow, request.Options.VersionID, request.Input)
+	if err != nil {
+		var sunset *deprecation.SunsetError
+		if errors.As(err, &sunset) {
+			e.report.Deprecation = sunset.Notice
+			return CheckResult{Status: CheckRejected, Reason: err.Error()}
+		}
+		return rejected("failed to resolve the deprecation of the workflow: %v", err)
+	}
+	e.report.Resolution = resolution
+	e.report.Deprecation = resolution.Notice
+	if resolution.Notice == nil {
+		return passed("workflow is not deprecated")
+	}
+	if resolution.ForwardedFrom == nil {
+		return passed(resolution.Notice.Warning())
+	}
+
+	// Check the replacement from here on
+	options := request.Options
+	options.VersionID = nil
+	if resolution.Version != nil {
+		options.VersionID = &resolution.Version.ID
+	}
+	e.request = &Request{Workflow: resolution.Workflow, Input: resolution.Input, Options: options}
+	e.report.WorkflowID = resolution.Workflow.ID
+	e.report.Version = resolution.Workflow.Version
+	e.report.ForwardedFrom = resolution.ForwardedFrom
+	e.definition = resolution.Workflow.Definition
+	e.schema = resolution.Workflow.InputSchema
+	return passed(fmt.Sprintf("%s is sunset, forwarded to workflow %s", resolution.Notice.Subject(), resolution.Workflow.Name))
+}
+
+// checkWorkflowStatus rejects executions of workflows that are not active
+func checkWorkflowStatus(ctx context.Context, e *evaluation) CheckResult {
+	workflow := e.request.Workflow
+	if !workflow.IsActive() {
+		return rejected("workflow is %s", workflow.Status)
+	}
+	return passed("workflow is active")
+}
+
+// checkMaintenanceWindow rejects executions during maintenance windows
+func checkMaintenanceWindow(ctx context.Context, e *evaluation) CheckResult {
+	schedule := e.checker.sources.Maintenance
+	if schedule == nil {
+		return skipped("no maintenance windows configured")
+	}
+
+	window, active := schedule.ActiveWindow(e.report.CheckedAt)
+	if !active {
+		return passed("no maintenance window active")
+	}
+	reason := fmt.Sprintf("maintenance window %s is active until %s", window.Name, window.End.UTC().Format(time.RFC3339))
+	if window.Reason != "" {
+		reason += ": " + window.Reason
+	}
+	return CheckResult{Status: CheckRejected, Reason: reason}
+}
+
+// checkVersion selects the workflow version the execution runs: the pinned
+// version, the version of the workflow's rollout, or the current version.
+// Executions are rejected while the rollout of their workflow is paused,
+// unless they are pinned to a version.
+func checkVersion(ctx context.Context, e *evaluation) CheckResult {
+	workflow := e.request.Workflow
+
+	if versionID := e.request.Options.VersionID; versionID != nil {
+		if e.checker.sources.Versions == nil {
+			return rejected("workflow versions are not available to pin version %s", versionID)
+		}
+		version, err := e.checker.sources.Versions.GetVersion(ctx, *versionID)
+		if err != nil {
+			return rejected("failed to load version %s: %v", versionID, err)
+		}
+		if version.WorkflowID != workflow.ID {
+			return rejected("version %s does not belong to the workflow", versionID)
+		}
+
+		e.report.Version = version.Version
+		e.report.VersionID = &version.ID
+		e.definition = version.Definition
+		e.schema = version.InputSchema
+		return passed(fmt.Sprintf("pinned to version %s", version.Version))
+	}
+
+	if e.checker.sources.Rollouts == nil {
+		return passed(fmt.Sprintf("current version %s", workflow.Version))
+	}
+	rollout, err := e.checker.sources.Rollouts.ActiveRollout(ctx, workflow.ID)
+	if err != nil {
+		return rejected("failed to load the rollout of the workflow: %v", err)
+	}
+	if rollout == nil {
+		return passed(fmt.Sprintf("current version %s", workflow.Version))
+	}
+	if rollout.Paused {
+		reason := fmt.Sprintf("rollout of version %s is paused", rollout.Version)
+		if rollout.Reason != "" {
+			reason += ": " + rollout.Reason
+		}
+		return CheckResult{Status: CheckRejected, Reason: reason}
+	}
+
+	e.report.Version = rollout.Version
+	return passed(fmt.Sprintf("rollout version %s", rollout.Version))
+}
+
+// checkInputSchema rejects inputs that do not match the input schema of the
+// selected version
+func checkInputSchema(ctx context.Context, e *evaluation) CheckResult {
+	if errs := e.schema.Validate(e.request.Input); len(errs) > 0 {
+		return rejected("invalid input: %s", strings.Join(errs, "; "))
+	}
+	return passed("input matches the input schema")
+}
+
+// checkPolicies rejects executions the admission policies of the workflow
+// deny, and warns about those they warn about
+func checkPolicies(ctx context.Context, e *evaluation) CheckResult {
+	evaluator := e.checker.sources.Policies
+	if evaluator == nil {
+		return skipped("no policies configured")
+	}
+
+	result, err := evaluator.EvaluateExecution(ctx, &policies.ExecutionRequest{
+		Workflow:   e.request.Workflow,
+		Definition: e.definition,
+		Version:    e.report.Version,
+		Input:      e.request.Input,
+		Actor:      e.request.Actor,
+		DryRun:     e.dryRun,
+	})
+	if err != nil {
+		return rejected("failed to evaluate the admission policies: %v", err)
+	}
+	e.report.Policy = result
+
+	switch result.Decision {
+	case policies.DecisionDeny:
+		return rejected("denied by policy: %s", strings.Join(result.Reasons(policies.DecisionDeny), "; "))
+	case policies.DecisionWarn:
+		return CheckResult{Status: CheckWarned, Reason: strings.Join(result.Reasons(policies.DecisionWarn), "; ")}
+	}
+	if len(result.Policies) == 0 {
+		return passed("no policy applies")
+	}
+	return passed(fmt.Sprintf("allowed by %d policies", len(result.Policies)))
+}
+
+// checkReservation selects the capacity reservation the execution draws
+// on: the active reservation of the workflow with the token passed with
+// the execution, or else any active reservation of the workflow. Tokens
+// matching no active reservation are warned about, the execution running
+// unreserved.
+func checkReservation(ctx context.Context, e *evaluation) CheckResult {
+	source := e.checker.sources.Reservations
+	if source == nil {
+		return skipped("no reservations configured")
+	}
+
+	token := e.request.Options.ReservationToken
+	reservation, err := source.Match(ctx, e.request.Workflow, token, e.report.CheckedAt)
+	if err != nil {
+		return rejected("failed to match the capacity reservations: %v", err)
+	}
+	if reservation == nil {
+		if token != "" {
+			return CheckResult{Status: CheckWarned, Reason: "reservation token matches no active reservation of the workflow, the execution is unreserved"}
+		}
+		return passed("no active reservation of the workflow")
+	}
+
+	e.report.Reservation = reservation
+	return passed(fmt.Sprintf("reservation %s admits %d more executions", reservation.Name, reservation.RemainingExecutions))
+}
+
+// checkQuota rejects executions of workflows whose quota is exhausted.
+// Executions of reservations are not limited by the quota.
+func checkQuota(ctx context.Context, e *evaluation) CheckResult {
+	quotas := e.checker.sources.Quotas
+	if quotas == nil {
+		return skipped("no quotas configured")
+	}
+	if e.report.Reservation != nil {
+		return passed(fmt.Sprintf("reserved by reservation %s", e.report.Reservation.Name))
+	}
+
+	remaining, ok, err := quotas.RemainingExecutions(ctx, e.request.Workflow)
+	if err != nil {
+		return rejected("failed to check the quota: %v", err)
+	}
+	if !ok {
+		return skipped("workflow has no quota")
+	}
+	if remaining <= 0 {
+		return rejected("execution quota exhausted")
+	}
+	return passed(fmt.Sprintf("%d executions remaining", remaining))
+}
+
+// checkExecutors rejects executions of workflows with steps of a type no
+// executor is registered for
+func checkExecutors(ctx context.Context, e *evaluation) CheckResult {
+	engine := e.checker.sources.Engine
+	if engine == nil {
+		return skipped("no engine configured")
+	}
+
+	registered := make(map[string]bool)
+	for _, stepType := range engine.StepTypes() {
+		registered[stepType] = true
+	}
+
+	var missing []string
+	for _, stepType := range stepTypes(e.definition) {
+		if !registered[stepType] {
+			missing = append(missing, stepType)
+		}
+	}
+	if len(missing) > 0 {
+		return rejected("no executor for step types %s", strings.Join(missing, ", "))
+	}
+	return passed("every step type has an executor")
+}
+
+// checkCircuitBreakers rejects executions of workflows with steps whose
+// circuit breaker is open
+func checkCircuitBreakers(ctx context.Context, e *evaluation) CheckResult {
+	breakers := e.checker.sources.Breakers
+	if breakers == nil {
+		return skipped("no circuit breakers configured")
+	}
+
+	var open []string
+	for _, stepType := range stepTypes(e.definition) {
+		if breakers.IsOpen(stepType) {
+			open = append(open, stepType)
+		}
+	}
+	if len(open) > 0 {
+		return rejected("circuit breakers open for step types %s", strings.Join(open, ", "))
+	}
+	return passed("no circuit breaker open")
+}
+
+// checkCapacity rejects executions while the engine does not accept new
+// executions and queues them while it runs as many executions as it can.
+// The free slots of reservations are kept from executions outside them,
+// which queue while only reserved slots are left. The queue wait is
+// estimated from the average execution time.
+func checkCapacity(ctx context.Context, e *evaluation) CheckResult {
+	engine := e.checker.sources.Engine
+	if engine == nil {
+		return skipped("no engine configured")
+	}
+	if !engine.Accepting() {
+		return rejected("node is not accepting new executions")
+	}
+	// Lightweight executions starting in the fast lane take no regular slot
+	if lane, ok := engine.(FastLane); ok && lane.FastLaneAvailable(e.definition) {
+		return passed("fast lane slot free for lightweight execution")
+	}
+
+	held := 0
+	if source := e.checker.sources.Reservations; source != nil {
+		var err error
+		if held, err = source.Held(ctx, e.report.CheckedAt); err != nil {
+			return rejected("failed to load the capacity reservations: %v", err)
+		}
+		e.report.ReservedSlots = held
+	}
+
+	// Executions of a reservation start in its free slots
+	reservation := e.report.Reservation
+	reserved := reservation != nil && reservation.FreeSlots > 0
+	if reserved {
+		held -= reservation.FreeSlots
+		if held < 0 {
+			held = 0
+		}
+	}
+
+	running, capacity := engine.RunningExecutions(), engine.Capacity()
+	if capacity <= 0 || running+held < capacity {
+		switch {
+		case reserved:
+			return passed(fmt.Sprintf("reserved slot of reservation %s, %d of %d execution slots in use", reservation.Name, running, capacity))
+		case held > 0:
+			return passed(fmt.Sprintf("%d of %d execution slots in use, %d reserved", running, capacity, held))
+		}
+		return passed(fmt.Sprintf("%d of %d execution slots in use", running, capacity))
+	}
+
+	depth := running + held - capacity + 1
+	e.report.QueueDepth = depth
+	e.report.EstimatedQueueWait = time.Duration(math.Ceil(float64(depth)/float64(capacity))) * e.checker.config.AverageExecutionTime
+	if held > 0 {
+		return CheckResult{
+			Status: CheckQueued,
+			Reason: fmt.Sprintf("all %d execution slots in use or reserved (%d reserved), %d executions ahead", capacity, held, depth),
+		}
+	}
+	return CheckResult{
+		Status: CheckQueued,
+		Reason: fmt.Sprintf("all %d execution slots in use, %d executions ahead", capacity, depth),
+	}
+}
+
+// stepTypes returns the distinct step types of a workflow definition, sorted
+func stepTypes(definition models.WorkflowDefinition) []string {
+	seen := make(map[string]bool)
+	var types []string
+	for _, step := range definition.Spec.Steps {
+		if step.Type != "" && !seen[step.Type] {
+			seen[step.Type] = true
+			types = append(types, step.Type)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
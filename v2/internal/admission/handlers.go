@@ -0,0 +1,85 @@
+package admission
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// WorkflowGetter loads workflows. The workflow repository implements it.
+type WorkflowGetter interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+}
+
+// PreflightRequest is the execution a pre-flight check evaluates
+type PreflightRequest struct {
+	Input   map[string]interface{} `json:"input"`
+	Options Options                `json:"options"`
+}
+
+// Handlers provides HTTP handlers for pre-flight checks
+type Handlers struct {
+	checker   *AdmissionChecker
+	workflows WorkflowGetter
+}
+
+// NewHandlers creates new pre-flight check handlers
+func NewHandlers(checker *AdmissionChecker, workflows WorkflowGetter) *Handlers {
+	return &Handlers{checker: checker, workflows: workflows}
+}
+
+// RegisterRoutes registers pre-flight check routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		v1.POST("/workflows/:id/preflight", h.Preflight)
+	}
+}
+
+// Preflight runs the admission checks of an execution without creating it
+// @Summary Pre-flight check an execution
+// @Description Reports whether an execution with the input and options would start, queue or be rejected
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param request body PreflightRequest true "Intended execution"
+// @Success 200 {object} Report
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/preflight [post]
+func (h *Handlers) Preflight(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workflow ID"})
+		return
+	}
+
+	var request PreflightRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workflow, err := h.workflows.GetByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := h.checker.Preflight(c.Request.Context(), &Request{
+		Workflow: workflow,
+		Input:    request.Input,
+		Options:  request.Options,
+	})
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,128 @@
+package admission
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/deprecation"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// Engine is the workflow engine executions are admitted to. The engine
+// implements it.
+type Engine interface {
+	// Accepting reports whether the engine accepts new executions
+	Accepting() bool
+	RunningExecutions() int
+	// Capacity returns the maximum number of concurrent executions
+	Capacity() int
+	// StepTypes returns the step types with a registered executor
+	StepTypes() []string
+}
+
+// FastLane is implemented by engines running lightweight executions in a
+// fast lane whose slots are not counted against their capacity
+type FastLane interface {
+	// FastLaneAvailable reports whether an execution of a definition would
+	// start in the fast lane right away
+	FastLaneAvailable(definition models.WorkflowDefinition) bool
+}
+
+// VersionLoader loads workflow versions executions are pinned to. The
+// versioning Manager implements it.
+type VersionLoader interface {
+	GetVersion(ctx context.Context, versionID uuid.UUID) (*models.WorkflowVersion, error)
+}
+
+// Rollout is the rollout of a new version of a workflow
+type Rollout struct {
+	// Version is the version new executions of the workflow run
+	Version string
+	Paused  bool
+	// Reason explains why the rollout is paused
+	Reason string
+}
+
+// RolloutSource returns the rollout in progress of a workflow, or nil when
+// it has none
+type RolloutSource interface {
+	ActiveRollout(ctx context.Context, workflowID uuid.UUID) (*Rollout, error)
+}
+
+// QuotaSource returns how many more executions of a workflow its quota
+// allows. Workflows without a quota report ok false.
+type QuotaSource interface {
+	RemainingExecutions(ctx context.Context, workflow *models.Workflow) (remaining int, ok bool, err error)
+}
+
+// CircuitBreakers reports the circuit breakers guarding step types, which
+// open after repeated failures of the steps of a type
+type CircuitBreakers interface {
+	IsOpen(stepType string) bool
+}
+
+// DeprecationResolver applies the deprecation of workflows to executions,
+// which may reject them or forward them to a replacement. The deprecation
+// Manager implements it.
+type DeprecationResolver interface {
+	Resolve(ctx context.Context, workflow *models.Workflow, versionID *uuid.UUID, input map[string]interface{}) (*deprecation.Resolution, error)
+}
+
+// PolicyEvaluator evaluates the execution admission policies of
+// workflows. The policies Manager implements it.
+type PolicyEvaluator interface {
+	EvaluateExecution(ctx context.Context, request *policies.ExecutionRequest) (*policies.Result, error)
+}
+
+// Reservation is the capacity reservation an execution draws on
+type Reservation struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// FreeSlots is the number of reserved slots free for the execution
+	FreeSlots           int `json:"free_slots"`
+	RemainingExecutions int `json:"remaining_executions"`
+}
+
+// ReservationSource sets capacity aside for the reservations of known
+// bursts of executions. The reservations Manager implements it.
+type ReservationSource interface {
+	// Match returns the reservation active at a time an execution of the
+	// workflow draws on, selected by token when one is passed, or nil when
+	// none does
+	Match(ctx context.Context, workflow *models.Workflow, token string, at time.Time) (*Reservation, error)
+	// Held returns the number of free slots the reservations active at a
+	// time keep for their executions
+	Held(ctx context.Context, at time.Time) (int, error)
+	// Claim counts an admitted execution against its reservation. The
+	// execution takes a free reserved slot until it ends.
+	Claim(ctx context.Context, reservationID, executionID uuid.UUID, at time.Time) error
+}
+
+// MaintenanceWindow is a period during which new executions are rejected
+type MaintenanceWindow struct {
+	Name   string
+	Start  time.Time
+	End    time.Time
+	Reason string
+}
+
+// MaintenanceSchedule returns the maintenance window active at a time
+type MaintenanceSchedule interface {
+	ActiveWindow(at time.Time) (*MaintenanceWindow, bool)
+}
+
+// MaintenanceWindows is a fixed list of maintenance windows
+type MaintenanceWindows []MaintenanceWindow
+
+// ActiveWindow returns the maintenance window active at a time
+func (w MaintenanceWindows) ActiveWindow(at time.Time) (*MaintenanceWindow, bool) {
+	for i := range w {
+		if !at.Before(w[i].Start) && at.Before(w[i].End) {
+			return &w[i], true
+		}
+	}
+	return nil, false
+}
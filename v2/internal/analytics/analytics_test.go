@@ -0,0 +1,410 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// memorySink records delivered batches and can be made to fail
+type memorySink struct {
+	name string
+
+	mu      sync.Mutex
+	batches []*Batch
+	failing bool
+}
+
+func newMemorySink(name string) *memorySink {
+	return &memorySink{name: name}
+}
+
+func (s *memorySink) Name() string {
+	return s.name
+}
+
+func (s *memorySink) Write(ctx context.Context, batch *Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func (s *memorySink) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *memorySink) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sizes := make([]int, 0, len(s.batches))
+	for _, batch := range s.batches {
+		sizes = append(sizes, len(batch.Records))
+	}
+	return sizes
+}
+
+func (s *memorySink) sequences() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequences := make([]uint64, 0)
+	for _, batch := range s.batches {
+		for _, record := range batch.Records {
+			sequences = append(sequences, record.Sequence)
+		}
+	}
+	return sequences
+}
+
+func (s *memorySink) records() []ExportedRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]ExportedRecord, 0)
+	for _, batch := range s.batches {
+		records = append(records, batch.Records...)
+	}
+	return records
+}
+
+func newTestRecord(workflow, namespace string) *ExecutionRecord {
+	completedAt := time.Now().UTC()
+	return &ExecutionRecord{
+		ExecutionID:     uuid.New(),
+		WorkflowID:      uuid.New(),
+		WorkflowName:    workflow,
+		WorkflowVersion: "1.0.0",
+		Namespace:       namespace,
+		Status:          "completed",
+		TriggerType:     "api",
+		Labels:          map[string]string{NamespaceLabel: namespace},
+		StartedAt:       completedAt.Add(-time.Second),
+		CompletedAt:     completedAt,
+		DurationMs:      1000,
+	}
+}
+
+func newQuietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func newTestExporter(t *testing.T, config Config, spill SpillStore) *Exporter {
+	exporter := NewExporter(config, spill, nil, newQuietLogger())
+	t.Cleanup(exporter.Stop)
+	return exporter
+}
+
+func TestExporterBatching(t *testing.T) {
+	sink := newMemorySink("warehouse")
+	exporter := newTestExporter(t, Config{BatchSize: 3, FlushInterval: 20 * time.Millisecond}, nil)
+	require.NoError(t, exporter.AddSink(sink, Filter{}))
+	exporter.Start(context.Background())
+
+	for i := 0; i < 7; i++ {
+		exporter.Publish(context.Background(), newTestRecord("orders", "sales"))
+	}
+
+	require.Eventually(t, func() bool {
+		return len(sink.sequences()) == 7
+	}, time.Second, 5*time.Millisecond)
+
+	// Two full batches followed by the remainder on the flush interval
+	assert.Equal(t, []int{3, 3, 1}, sink.batchSizes())
+
+	sequences := sink.sequences()
+	for i := 1; i < len(sequences); i++ {
+		assert.Equal(t, sequences[i-1]+1, sequences[i])
+	}
+
+	status, err := exporter.SinkStatus("warehouse")
+	require.NoError(t, err)
+	assert.True(t, status.Healthy)
+	assert.Equal(t, uint64(7), status.Exported)
+	assert.Equal(t, sequences[6], status.LastExportedSequence)
+}
+
+func TestExporterFiltering(t *testing.T) {
+	sales := newMemorySink("sales")
+	orders := newMemorySink("orders")
+	exporter := newTestExporter(t, Config{BatchSize: 10, FlushInterval: 10 * time.Millisecond}, nil)
+	require.NoError(t, exporter.AddSink(sales, Filter{
+		Namespaces:    []string{"sales"},
+		IncludeFields: []string{"workflow_name", "duration_ms", "labels"},
+		ExcludeFields: []string{"labels", "sequence"},
+	}))
+	require.NoError(t, exporter.AddSink(orders, Filter{
+		Workflows:     []string{"orders"},
+		ExcludeFields: []string{"cost"},
+	}))
+	exporter.Start(context.Background())
+
+	exporter.Publish(context.Background(), newTestRecord("orders", "sales"))
+	exporter.Publish(context.Background(), newTestRecord("invoices", "sales"))
+	exporter.Publish(context.Background(), newTestRecord("orders", "ops"))
+	exporter.Publish(context.Background(), newTestRecord("payroll", "hr"))
+
+	require.Eventually(t, func() bool {
+		return len(sales.records()) == 2 && len(orders.records()) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	for _, record := range sales.records() {
+		// Reserved fields cannot be excluded
+		assert.ElementsMatch(t,
+			[]string{"schema_version", "sequence", "execution_id", "workflow_name", "duration_ms"},
+			fieldNames(record.Fields))
+	}
+	for _, record := range orders.records() {
+		assert.Equal(t, "orders", record.Fields["workflow_name"])
+		assert.NotContains(t, record.Fields, "cost")
+		assert.Contains(t, record.Fields, "namespace")
+	}
+
+	status, err := exporter.SinkStatus("sales")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), status.Filtered)
+}
+
+func TestExporterSpillAndRecovery(t *testing.T) {
+	t.Run("slow sink spills and catches up in order", func(t *testing.T) {
+		sink := newMemorySink("warehouse")
+		sink.setFailing(true)
+		spill := NewMemorySpillStore()
+		exporter := newTestExporter(t, Config{
+			BufferSize:    2,
+			BatchSize:     2,
+			FlushInterval: 10 * time.Millisecond,
+			RetryBackoff:  5 * time.Millisecond,
+		}, spill)
+		require.NoError(t, exporter.AddSink(sink, Filter{}))
+		exporter.Start(context.Background())
+
+		published := make([]uint64, 0)
+		start := time.Now()
+		for i := 0; i < 20; i++ {
+			record := newTestRecord("orders", "sales")
+			exporter.Publish(context.Background(), record)
+			published = append(published, record.Sequence)
+		}
+		// Publishing never waits for the failing sink
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+		require.Eventually(t, func() bool {
+			count, _ := spill.Count(context.Background(), "warehouse")
+			return count > 0
+		}, time.Second, 5*time.Millisecond)
+
+		status, err := exporter.SinkStatus("warehouse")
+		require.NoError(t, err)
+		assert.False(t, status.Healthy)
+		assert.Equal(t, "sink unavailable", status.LastError)
+		assert.Positive(t, status.Spilled)
+
+		sink.setFailing(false)
+
+		require.Eventually(t, func() bool {
+			return len(sink.sequences()) == len(published)
+		}, 2*time.Second, 5*time.Millisecond)
+		assert.Equal(t, published, sink.sequences())
+
+		require.Eventually(t, func() bool {
+			status, _ := exporter.SinkStatus("warehouse")
+			return status.Healthy && status.Spilled == 0
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("undelivered records survive a restart", func(t *testing.T) {
+		spill := NewMemorySpillStore()
+		config := Config{BatchSize: 100, FlushInterval: time.Hour}
+
+		first := NewExporter(config, spill, nil, newQuietLogger())
+		require.NoError(t, first.AddSink(newMemorySink("warehouse"), Filter{}))
+		first.Start(context.Background())
+		published := make([]uint64, 0)
+		for i := 0; i < 5; i++ {
+			record := newTestRecord("orders", "sales")
+			first.Publish(context.Background(), record)
+			published = append(published, record.Sequence)
+		}
+		// The partial batch is never flushed before shutdown
+		first.Stop()
+
+		count, err := spill.Count(context.Background(), "warehouse")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), count)
+
+		sink := newMemorySink("warehouse")
+		second := newTestExporter(t, Config{BatchSize: 100, FlushInterval: 10 * time.Millisecond}, spill)
+		require.NoError(t, second.AddSink(sink, Filter{}))
+		second.Start(context.Background())
+
+		require.Eventually(t, func() bool {
+			return len(sink.sequences()) == len(published)
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, published, sink.sequences())
+
+		// Sequence numbers keep increasing after the restart
+		record := newTestRecord("orders", "sales")
+		second.Publish(context.Background(), record)
+		assert.Greater(t, record.Sequence, published[len(published)-1])
+	})
+}
+
+func TestRecordFromEvent(t *testing.T) {
+	executionID := uuid.New()
+	workflowID := uuid.New()
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	record, err := RecordFromEvent("execution.failed", executionID, workflowID, startedAt.Add(1500*time.Millisecond), map[string]interface{}{
+		"workflow_name":    "orders",
+		"workflow_version": "2.1.0",
+		"trigger_type":     "scheduled",
+		"started_at":       startedAt,
+		"duration_ms":      int64(1500),
+		"labels":           map[string]string{"namespace": "sales", "team": "checkout"},
+		"cost":             0.25,
+		"error_code":       "TIMEOUT",
+		"output":           map[string]interface{}{"secret": "payload"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "failed", record.Status)
+	assert.Equal(t, "sales", record.Namespace)
+	assert.Equal(t, int64(1500), record.DurationMs)
+	assert.Equal(t, 0.25, record.Cost)
+
+	fields, err := record.Fields()
+	require.NoError(t, err)
+	assert.NotContains(t, fields, "output")
+
+	_, err = RecordFromEvent("execution.started", executionID, workflowID, startedAt, nil)
+	assert.Error(t, err)
+
+	record, err = RecordFromEvent("execution.completed", executionID, workflowID, startedAt, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNamespace, record.Namespace)
+}
+
+func TestJSONLSink(t *testing.T) {
+	root := t.TempDir()
+	sink := NewJSONLSink("warehouse", NewFileObjectStore(root), "executions")
+
+	day1 := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	day2 := time.Date(2024, 5, 2, 0, 1, 0, 0, time.UTC)
+	batch := &Batch{Sink: "warehouse", Records: []ExportedRecord{
+		{Sequence: 1, CompletedAt: day1, Fields: map[string]interface{}{"sequence": 1}},
+		{Sequence: 2, CompletedAt: day1, Fields: map[string]interface{}{"sequence": 2}},
+		{Sequence: 3, CompletedAt: day2, Fields: map[string]interface{}{"sequence": 3}},
+	}}
+
+	require.NoError(t, sink.Write(context.Background(), batch))
+	// Retrying the same batch overwrites the same objects
+	require.NoError(t, sink.Write(context.Background(), batch))
+
+	files, err := filepath.Glob(filepath.Join(root, "executions", "dt=*", "*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	data, err := os.ReadFile(filepath.Join(root, "executions", "dt=2024-05-01", "00000000000000000001-00000000000000000002.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"sequence\":1}\n{\"sequence\":2}\n", string(data))
+}
+
+func TestKafkaSink(t *testing.T) {
+	producer := &memoryProducer{}
+	sink := NewKafkaSink("stream", "executions", producer)
+
+	executionID := uuid.New().String()
+	require.NoError(t, sink.Write(context.Background(), &Batch{Records: []ExportedRecord{
+		{Sequence: 42, ExecutionID: executionID, Fields: map[string]interface{}{"sequence": 42}},
+	}}))
+
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, "executions", producer.topic)
+	assert.Equal(t, executionID, string(producer.messages[0].Key))
+	assert.Equal(t, "42", producer.messages[0].Headers["sequence"])
+	assert.Equal(t, "1", producer.messages[0].Headers["schema_version"])
+}
+
+func TestExecutionRecordSchemaGolden(t *testing.T) {
+	record := &ExecutionRecord{
+		SchemaVersion:   SchemaVersion,
+		Sequence:        1714557600000001,
+		ExecutionID:     uuid.MustParse("6f1c2a7e-4d0b-4f5e-9a3b-2c1d0e9f8a7b"),
+		WorkflowID:      uuid.MustParse("0b7e6c5d-3a2f-4e1d-8c9b-7a6f5e4d3c2b"),
+		WorkflowName:    "orders",
+		WorkflowVersion: "2.1.0",
+		Namespace:       "sales",
+		Status:          "completed",
+		TriggerType:     "scheduled",
+		Labels:          map[string]string{"namespace": "sales", "team": "checkout"},
+		StartedAt:       time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		CompletedAt:     time.Date(2024, 5, 1, 10, 0, 1, 500000000, time.UTC),
+		DurationMs:      1500,
+		Cost:            0.25,
+	}
+
+	fields, err := (&Filter{}).Project(record)
+	require.NoError(t, err)
+	actual, err := json.MarshalIndent(fields, "", "  ")
+	require.NoError(t, err)
+
+	golden := filepath.Join("testdata", "execution_record_v1.golden.json")
+	if *update {
+		require.NoError(t, os.WriteFile(golden, append(actual, '\n'), 0644))
+	}
+
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(actual), "exported record schema changed; bump SchemaVersion and add a new golden file")
+}
+
+type memoryProducer struct {
+	topic    string
+	messages []KafkaMessage
+}
+
+func (p *memoryProducer) Produce(ctx context.Context, topic string, messages []KafkaMessage) error {
+	p.topic = topic
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func (p *memoryProducer) Close() error {
+	return nil
+}
+
+func fieldNames(fields map[string]interface{}) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	return names
+}
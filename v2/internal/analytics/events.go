@@ -0,0 +1,37 @@
+package analytics
+
+import (
+	"context"
+
+	"magic-flow/v2/internal/engine"
+)
+
+// EventHandler feeds terminal engine events into the exporter
+type EventHandler struct {
+	exporter *Exporter
+}
+
+// NewEventHandler creates an engine event handler for the exporter
+func NewEventHandler(exporter *Exporter) *EventHandler {
+	return &EventHandler{exporter: exporter}
+}
+
+// Handle converts terminal execution events into analytics records
+func (h *EventHandler) Handle(event *engine.WorkflowEvent) error {
+	if !IsTerminalEvent(event.Type) {
+		return nil
+	}
+
+	record, err := RecordFromEvent(event.Type, event.ExecutionID, event.WorkflowID, event.Timestamp, event.Data)
+	if err != nil {
+		return err
+	}
+
+	h.exporter.Publish(context.Background(), record)
+	return nil
+}
+
+// GetEventTypes returns the event types handled
+func (h *EventHandler) GetEventTypes() []string {
+	return []string{"execution.completed", "execution.failed", "execution.cancelled"}
+}
@@ -0,0 +1,538 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MetricsRecorder records exporter metrics. It is satisfied by the engine
+// metrics collector.
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// Config configures the exporter
+type Config struct {
+	// BufferSize is the number of records buffered in memory per sink before
+	// further records are spilled to the spill store
+	BufferSize int
+	// BatchSize is the maximum number of records per sink write
+	BatchSize int
+	// FlushInterval is the longest a partial batch waits before being written
+	FlushInterval time.Duration
+	// RetryBackoff is the initial delay between failed writes
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps the delay between failed writes
+	MaxRetryBackoff time.Duration
+}
+
+// DefaultConfig returns the default exporter configuration
+func DefaultConfig() Config {
+	return Config{
+		BufferSize:      1000,
+		BatchSize:       100,
+		FlushInterval:   5 * time.Second,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: time.Minute,
+	}
+}
+
+// SinkStatus describes the health and lag of a sink
+type SinkStatus struct {
+	Name                 string     `json:"name"`
+	Healthy              bool       `json:"healthy"`
+	LastError            string     `json:"last_error,omitempty"`
+	LastSuccessAt        *time.Time `json:"last_success_at,omitempty"`
+	LastExportedSequence uint64     `json:"last_exported_sequence"`
+	Buffered             int        `json:"buffered"`
+	Spilled              int64      `json:"spilled"`
+	// LagSeconds is the age of the oldest record the sink has not yet
+	// acknowledged, measured from the execution completion time
+	LagSeconds float64 `json:"lag_seconds"`
+	Exported   uint64  `json:"exported"`
+	Filtered   uint64  `json:"filtered"`
+	Dropped    uint64  `json:"dropped"`
+}
+
+// Exporter fans finished execution records out to analytics sinks. Each sink
+// has its own bounded buffer and worker so a slow or failing sink never
+// blocks the caller or other sinks: once a buffer is full, records are
+// spilled to the spill store and delivered after the sink catches up.
+//
+// Delivery is at-least-once. Every record carries a sequence number that
+// increases monotonically, including across restarts, so consumers can
+// deduplicate redelivered records.
+type Exporter struct {
+	config   Config
+	spill    SpillStore
+	metrics  MetricsRecorder
+	logger   *logrus.Logger
+	now      func() time.Time
+	sequence uint64
+
+	mu      sync.RWMutex
+	workers map[string]*sinkWorker
+	names   []string
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewExporter creates a new exporter
+func NewExporter(config Config, spill SpillStore, metrics MetricsRecorder, logger *logrus.Logger) *Exporter {
+	defaults := DefaultConfig()
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaults.BufferSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaults.FlushInterval
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaults.RetryBackoff
+	}
+	if config.MaxRetryBackoff < config.RetryBackoff {
+		config.MaxRetryBackoff = config.RetryBackoff
+	}
+	if spill == nil {
+		spill = NewMemorySpillStore()
+	}
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	return &Exporter{
+		config:  config,
+		spill:   spill,
+		metrics: metrics,
+		logger:  logger,
+		now:     time.Now,
+		// Seeding from the clock keeps sequence numbers increasing across
+		// restarts without a shared counter
+		sequence: uint64(time.Now().UnixMicro()),
+		workers:  make(map[string]*sinkWorker),
+	}
+}
+
+// AddSink registers a sink with its filter. Sinks must be added before Start.
+func (e *Exporter) AddSink(sink Sink, filter Filter) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, exists := e.workers[sink.Name()]; exists {
+		return fmt.Errorf("analytics sink already registered: %s", sink.Name())
+	}
+
+	e.workers[sink.Name()] = &sinkWorker{
+		exporter: e,
+		sink:     sink,
+		filter:   filter,
+		buffer:   make(chan *ExecutionRecord, e.config.BufferSize),
+		status:   SinkStatus{Name: sink.Name(), Healthy: true},
+	}
+	e.names = append(e.names, sink.Name())
+	return nil
+}
+
+// Start starts one worker per sink. Records spilled before a restart are
+// delivered before new records.
+func (e *Exporter) Start(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ctx, e.cancel = context.WithCancel(ctx)
+	for _, worker := range e.workers {
+		worker.recover(ctx)
+
+		e.wg.Add(1)
+		go func(w *sinkWorker) {
+			defer e.wg.Done()
+			w.run(ctx)
+		}(worker)
+	}
+
+	e.logger.WithField("sinks", len(e.workers)).Info("Analytics exporter started")
+}
+
+// Stop stops the workers, spills undelivered records and closes the sinks
+func (e *Exporter) Stop() {
+	e.mu.RLock()
+	cancel := e.cancel
+	e.mu.RUnlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	e.wg.Wait()
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, name := range e.names {
+		if err := e.workers[name].sink.Close(); err != nil {
+			e.logger.WithFields(logrus.Fields{
+				"sink":  name,
+				"error": err.Error(),
+			}).Error("Failed to close analytics sink")
+		}
+	}
+
+	e.logger.Info("Analytics exporter stopped")
+}
+
+// Publish assigns the record a sequence number and queues it for every sink
+// whose filter matches. It never waits for a sink.
+func (e *Exporter) Publish(ctx context.Context, record *ExecutionRecord) {
+	if record.SchemaVersion == 0 {
+		record.SchemaVersion = SchemaVersion
+	}
+	record.Sequence = atomic.AddUint64(&e.sequence, 1)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, name := range e.names {
+		e.workers[name].publish(ctx, record)
+	}
+}
+
+// Status returns the status of all sinks
+func (e *Exporter) Status() []SinkStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	statuses := make([]SinkStatus, 0, len(e.names))
+	for _, name := range e.names {
+		statuses = append(statuses, e.workers[name].snapshot())
+	}
+	return statuses
+}
+
+// SinkStatus returns the status of a single sink
+func (e *Exporter) SinkStatus(name string) (*SinkStatus, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	worker, exists := e.workers[name]
+	if !exists {
+		return nil, fmt.Errorf("analytics sink not found: %s", name)
+	}
+	status := worker.snapshot()
+	return &status, nil
+}
+
+// sinkWorker delivers records to a single sink
+type sinkWorker struct {
+	exporter *Exporter
+	sink     Sink
+	filter   Filter
+	buffer   chan *ExecutionRecord
+
+	mu sync.Mutex
+	// spilling is set once the buffer overflows; new records then go to the
+	// spill store until it has been drained so that ordering is preserved
+	spilling bool
+	status   SinkStatus
+	// inFlightSince is the completion time of the oldest record being delivered
+	inFlightSince time.Time
+}
+
+// recover resumes delivery of records spilled before a restart
+func (w *sinkWorker) recover(ctx context.Context) {
+	count, err := w.exporter.spill.Count(ctx, w.sink.Name())
+	if err != nil {
+		w.exporter.logger.WithFields(logrus.Fields{
+			"sink":  w.sink.Name(),
+			"error": err.Error(),
+		}).Error("Failed to count spilled analytics records")
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Spilled = count
+	w.spilling = count > 0
+}
+
+// publish queues a record without blocking
+func (w *sinkWorker) publish(ctx context.Context, record *ExecutionRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.filter.Matches(record) {
+		w.status.Filtered++
+		return
+	}
+
+	if !w.spilling {
+		select {
+		case w.buffer <- record:
+			return
+		default:
+			w.spilling = true
+		}
+	}
+
+	if err := w.exporter.spill.Save(ctx, w.sink.Name(), []*ExecutionRecord{record}); err != nil {
+		w.status.Dropped++
+		w.exporter.logger.WithFields(logrus.Fields{
+			"sink":     w.sink.Name(),
+			"sequence": record.Sequence,
+			"error":    err.Error(),
+		}).Error("Failed to spill analytics record, record dropped")
+		return
+	}
+	w.status.Spilled++
+}
+
+// run collects buffered records into batches until the context is cancelled
+func (w *sinkWorker) run(ctx context.Context) {
+	ticker := time.NewTicker(w.exporter.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*ExecutionRecord, 0, w.exporter.config.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			w.shutdown(batch)
+			return
+		case record := <-w.buffer:
+			batch = append(batch, record)
+			if len(batch) >= w.exporter.config.BatchSize {
+				if !w.deliver(ctx, batch) {
+					continue
+				}
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				if !w.deliver(ctx, batch) {
+					continue
+				}
+				batch = batch[:0]
+			}
+			w.drainSpill(ctx)
+			w.reportMetrics()
+		}
+	}
+}
+
+// drainSpill delivers spilled records once the in-memory buffer is empty
+func (w *sinkWorker) drainSpill(ctx context.Context) {
+	for ctx.Err() == nil {
+		w.mu.Lock()
+		spilling := w.spilling
+		w.mu.Unlock()
+
+		// Buffered records are older than spilled ones and go first
+		if !spilling || len(w.buffer) > 0 {
+			return
+		}
+
+		records, err := w.exporter.spill.Load(ctx, w.sink.Name(), w.exporter.config.BatchSize)
+		if err != nil {
+			w.exporter.logger.WithFields(logrus.Fields{
+				"sink":  w.sink.Name(),
+				"error": err.Error(),
+			}).Error("Failed to load spilled analytics records")
+			return
+		}
+
+		if len(records) == 0 {
+			w.mu.Lock()
+			// publish spills under the same lock, so an empty count here
+			// means no record can be left behind
+			count, err := w.exporter.spill.Count(ctx, w.sink.Name())
+			if err == nil && count == 0 {
+				w.spilling = false
+				w.status.Spilled = 0
+			}
+			w.mu.Unlock()
+			return
+		}
+
+		if !w.deliver(ctx, records) {
+			return
+		}
+
+		sequences := make([]uint64, 0, len(records))
+		for _, record := range records {
+			sequences = append(sequences, record.Sequence)
+		}
+		if err := w.exporter.spill.Delete(ctx, w.sink.Name(), sequences); err != nil {
+			// The records will be delivered again, which at-least-once allows
+			w.exporter.logger.WithFields(logrus.Fields{
+				"sink":  w.sink.Name(),
+				"error": err.Error(),
+			}).Error("Failed to delete delivered analytics records")
+			return
+		}
+
+		w.mu.Lock()
+		w.status.Spilled -= int64(len(records))
+		if w.status.Spilled < 0 {
+			w.status.Spilled = 0
+		}
+		w.mu.Unlock()
+	}
+}
+
+// deliver writes records to the sink, retrying with backoff until it
+// succeeds or the context is cancelled
+func (w *sinkWorker) deliver(ctx context.Context, records []*ExecutionRecord) bool {
+	batch := w.buildBatch(records)
+	if len(batch.Records) == 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	w.inFlightSince = batch.Records[0].CompletedAt
+	for _, record := range batch.Records {
+		if record.CompletedAt.Before(w.inFlightSince) {
+			w.inFlightSince = record.CompletedAt
+		}
+	}
+	w.mu.Unlock()
+
+	backoff := w.exporter.config.RetryBackoff
+	for {
+		err := w.sink.Write(ctx, batch)
+		if err == nil {
+			now := w.exporter.now()
+			w.mu.Lock()
+			w.status.Healthy = true
+			w.status.LastError = ""
+			w.status.LastSuccessAt = &now
+			w.status.LastExportedSequence = batch.LastSequence()
+			w.status.Exported += uint64(len(batch.Records))
+			w.inFlightSince = time.Time{}
+			w.mu.Unlock()
+			w.reportMetrics()
+			return true
+		}
+
+		w.mu.Lock()
+		w.status.Healthy = false
+		w.status.LastError = err.Error()
+		w.mu.Unlock()
+		w.reportMetrics()
+
+		w.exporter.logger.WithFields(logrus.Fields{
+			"sink":           w.sink.Name(),
+			"first_sequence": batch.FirstSequence(),
+			"last_sequence":  batch.LastSequence(),
+			"retry_in":       backoff.String(),
+			"error":          err.Error(),
+		}).Warn("Failed to write analytics batch")
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > w.exporter.config.MaxRetryBackoff {
+			backoff = w.exporter.config.MaxRetryBackoff
+		}
+	}
+}
+
+// buildBatch applies the field filter and orders records by sequence
+func (w *sinkWorker) buildBatch(records []*ExecutionRecord) *Batch {
+	batch := &Batch{
+		Sink:    w.sink.Name(),
+		Records: make([]ExportedRecord, 0, len(records)),
+	}
+
+	for _, record := range records {
+		fields, err := w.filter.Project(record)
+		if err != nil {
+			w.mu.Lock()
+			w.status.Dropped++
+			w.mu.Unlock()
+			w.exporter.logger.WithFields(logrus.Fields{
+				"sink":     w.sink.Name(),
+				"sequence": record.Sequence,
+				"error":    err.Error(),
+			}).Error("Failed to encode analytics record, record dropped")
+			continue
+		}
+
+		batch.Records = append(batch.Records, ExportedRecord{
+			Sequence:    record.Sequence,
+			ExecutionID: record.ExecutionID.String(),
+			CompletedAt: record.CompletedAt,
+			Fields:      fields,
+		})
+	}
+
+	sort.Slice(batch.Records, func(i, j int) bool {
+		return batch.Records[i].Sequence < batch.Records[j].Sequence
+	})
+	return batch
+}
+
+// shutdown spills the pending batch and buffer so nothing is lost on exit
+func (w *sinkWorker) shutdown(batch []*ExecutionRecord) {
+	for len(w.buffer) > 0 {
+		batch = append(batch, <-w.buffer)
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.exporter.spill.Save(context.Background(), w.sink.Name(), batch); err != nil {
+		w.status.Dropped += uint64(len(batch))
+		w.exporter.logger.WithFields(logrus.Fields{
+			"sink":    w.sink.Name(),
+			"records": len(batch),
+			"error":   err.Error(),
+		}).Error("Failed to spill analytics records on shutdown, records dropped")
+		return
+	}
+	w.status.Spilled += int64(len(batch))
+	w.spilling = true
+}
+
+// snapshot returns a copy of the sink status
+func (w *sinkWorker) snapshot() SinkStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := w.status
+	status.Buffered = len(w.buffer)
+	if !w.inFlightSince.IsZero() {
+		status.LagSeconds = w.exporter.now().Sub(w.inFlightSince).Seconds()
+	}
+	return status
+}
+
+// reportMetrics publishes the sink status as metrics
+func (w *sinkWorker) reportMetrics() {
+	if w.exporter.metrics == nil {
+		return
+	}
+
+	status := w.snapshot()
+	labels := map[string]string{"sink": status.Name}
+
+	healthy := 0.0
+	if status.Healthy {
+		healthy = 1
+	}
+
+	w.exporter.metrics.RecordMetric("analytics_sink_healthy", healthy, labels)
+	w.exporter.metrics.RecordMetric("analytics_sink_lag_seconds", status.LagSeconds, labels)
+	w.exporter.metrics.RecordMetric("analytics_sink_pending_records", float64(status.Buffered)+float64(status.Spilled), labels)
+	w.exporter.metrics.RecordMetric("analytics_sink_exported_records", float64(status.Exported), labels)
+	w.exporter.metrics.RecordMetric("analytics_sink_dropped_records", float64(status.Dropped), labels)
+}
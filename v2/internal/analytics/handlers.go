@@ -0,0 +1,57 @@
+package analytics
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers provides admin HTTP handlers for the analytics exporter
+type Handlers struct {
+	exporter *Exporter
+}
+
+// NewHandlers creates new analytics handlers
+func NewHandlers(exporter *Exporter) *Handlers {
+	return &Handlers{exporter: exporter}
+}
+
+// RegisterRoutes registers analytics admin routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		sinks := v1.Group("/admin/analytics/sinks")
+		{
+			sinks.GET("", h.ListSinks)
+			sinks.GET("/:name", h.GetSink)
+		}
+	}
+}
+
+// ListSinks returns the health and lag of all analytics sinks
+// @Summary List analytics sinks
+// @Tags analytics
+// @Produce json
+// @Success 200 {array} SinkStatus
+// @Router /api/v1/admin/analytics/sinks [get]
+func (h *Handlers) ListSinks(c *gin.Context) {
+	c.JSON(http.StatusOK, h.exporter.Status())
+}
+
+// GetSink returns the health and lag of an analytics sink
+// @Summary Get analytics sink
+// @Tags analytics
+// @Produce json
+// @Param name path string true "Sink name"
+// @Success 200 {object} SinkStatus
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/admin/analytics/sinks/{name} [get]
+func (h *Handlers) GetSink(c *gin.Context) {
+	status, err := h.exporter.SinkStatus(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
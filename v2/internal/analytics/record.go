@@ -0,0 +1,212 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SchemaVersion is the version of the exported record schema. It must be
+// bumped whenever a field is renamed, removed or changes meaning so that
+// warehouse loaders can route records to the right table definition.
+const SchemaVersion = 1
+
+// DefaultNamespace is used for workflows without a namespace label
+const DefaultNamespace = "default"
+
+// NamespaceLabel is the workflow label holding the workflow namespace
+const NamespaceLabel = "namespace"
+
+// ExecutionRecord is the analytics view of a finished execution. It carries
+// metadata, timings, labels and cost but never input or output payloads.
+type ExecutionRecord struct {
+	SchemaVersion   int               `json:"schema_version"`
+	Sequence        uint64            `json:"sequence"`
+	ExecutionID     uuid.UUID         `json:"execution_id"`
+	WorkflowID      uuid.UUID         `json:"workflow_id"`
+	WorkflowName    string            `json:"workflow_name"`
+	WorkflowVersion string            `json:"workflow_version"`
+	Namespace       string            `json:"namespace"`
+	Status          string            `json:"status"`
+	TriggerType     string            `json:"trigger_type"`
+	Labels          map[string]string `json:"labels"`
+	StartedAt       time.Time         `json:"started_at"`
+	CompletedAt     time.Time         `json:"completed_at"`
+	DurationMs      int64             `json:"duration_ms"`
+	Cost            float64           `json:"cost"`
+	ErrorCode       string            `json:"error_code"`
+}
+
+// reservedFields are always exported regardless of field filters so that
+// downstream consumers can deduplicate and route records
+var reservedFields = map[string]bool{
+	"schema_version": true,
+	"sequence":       true,
+	"execution_id":   true,
+}
+
+// terminalStatuses maps terminal engine event types to execution statuses
+var terminalStatuses = map[string]string{
+	"execution.completed": "completed",
+	"execution.failed":    "failed",
+	"execution.cancelled": "cancelled",
+}
+
+// IsTerminalEvent reports whether an engine event type ends an execution
+func IsTerminalEvent(eventType string) bool {
+	_, ok := terminalStatuses[eventType]
+	return ok
+}
+
+// RecordFromEvent builds an execution record from the data attached to a
+// terminal engine event. Payload keys such as output are ignored.
+func RecordFromEvent(eventType string, executionID, workflowID uuid.UUID, timestamp time.Time, data map[string]interface{}) (*ExecutionRecord, error) {
+	status, ok := terminalStatuses[eventType]
+	if !ok {
+		return nil, fmt.Errorf("event type %s is not a terminal execution event", eventType)
+	}
+
+	record := &ExecutionRecord{
+		SchemaVersion:   SchemaVersion,
+		ExecutionID:     executionID,
+		WorkflowID:      workflowID,
+		WorkflowName:    stringValue(data["workflow_name"]),
+		WorkflowVersion: stringValue(data["workflow_version"]),
+		Status:          status,
+		TriggerType:     stringValue(data["trigger_type"]),
+		Labels:          labelsValue(data["labels"]),
+		CompletedAt:     timestamp.UTC(),
+		DurationMs:      int64(floatValue(data["duration_ms"])),
+		Cost:            floatValue(data["cost"]),
+		ErrorCode:       stringValue(data["error_code"]),
+	}
+
+	if startedAt, ok := data["started_at"].(time.Time); ok {
+		record.StartedAt = startedAt.UTC()
+	}
+
+	record.Namespace = record.Labels[NamespaceLabel]
+	if record.Namespace == "" {
+		record.Namespace = DefaultNamespace
+	}
+
+	return record, nil
+}
+
+// Fields returns the record as a field map keyed by JSON name
+func (r *ExecutionRecord) Fields() (map[string]interface{}, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// UseNumber keeps large sequence numbers exact
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	fields := make(map[string]interface{})
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Filter selects the records and fields exported to a sink. Empty lists
+// match everything.
+type Filter struct {
+	Namespaces    []string `json:"namespaces,omitempty"`
+	Workflows     []string `json:"workflows,omitempty"`
+	IncludeFields []string `json:"include_fields,omitempty"`
+	ExcludeFields []string `json:"exclude_fields,omitempty"`
+}
+
+// Matches reports whether the record belongs to the filtered namespaces and
+// workflows. Workflows may be given by name or ID.
+func (f *Filter) Matches(record *ExecutionRecord) bool {
+	if len(f.Namespaces) > 0 && !contains(f.Namespaces, record.Namespace) {
+		return false
+	}
+	if len(f.Workflows) > 0 && !contains(f.Workflows, record.WorkflowName) && !contains(f.Workflows, record.WorkflowID.String()) {
+		return false
+	}
+	return true
+}
+
+// Project returns the exported fields of a record
+func (f *Filter) Project(record *ExecutionRecord) (map[string]interface{}, error) {
+	fields, err := record.Fields()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f.IncludeFields) > 0 {
+		for name := range fields {
+			if !reservedFields[name] && !contains(f.IncludeFields, name) {
+				delete(fields, name)
+			}
+		}
+	}
+	for _, name := range f.ExcludeFields {
+		if !reservedFields[name] {
+			delete(fields, name)
+		}
+	}
+
+	return fields, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+func floatValue(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	default:
+		return 0
+	}
+}
+
+func labelsValue(value interface{}) map[string]string {
+	labels := make(map[string]string)
+	switch v := value.(type) {
+	case map[string]string:
+		for key, label := range v {
+			labels[key] = label
+		}
+	case map[string]interface{}:
+		for key, label := range v {
+			labels[key] = stringValue(label)
+		}
+	}
+	return labels
+}
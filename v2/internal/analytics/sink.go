@@ -0,0 +1,214 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportedRecord is a record after the sink's field filter has been applied
+type ExportedRecord struct {
+	Sequence    uint64
+	ExecutionID string
+	CompletedAt time.Time
+	Fields      map[string]interface{}
+}
+
+// Batch is a group of records delivered to a sink in one write. Records are
+// ordered by sequence number.
+type Batch struct {
+	Sink    string
+	Records []ExportedRecord
+}
+
+// FirstSequence returns the sequence number of the first record
+func (b *Batch) FirstSequence() uint64 {
+	if len(b.Records) == 0 {
+		return 0
+	}
+	return b.Records[0].Sequence
+}
+
+// LastSequence returns the sequence number of the last record
+func (b *Batch) LastSequence() uint64 {
+	if len(b.Records) == 0 {
+		return 0
+	}
+	return b.Records[len(b.Records)-1].Sequence
+}
+
+// Sink receives batches of exported records. Write may be retried with the
+// same batch after a failure, so implementations must tolerate duplicates;
+// consumers deduplicate using the record sequence number.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, batch *Batch) error
+	Close() error
+}
+
+// ObjectStore stores objects by key, e.g. an S3 or GCS bucket
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+// FileObjectStore is an object store backed by a local directory
+type FileObjectStore struct {
+	root string
+}
+
+// NewFileObjectStore creates an object store writing below root
+func NewFileObjectStore(root string) *FileObjectStore {
+	return &FileObjectStore{root: root}
+}
+
+// Put writes an object atomically
+func (s *FileObjectStore) Put(ctx context.Context, key string, data []byte) error {
+	path := filepath.Join(s.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// JSONLSink writes batches as JSON lines objects partitioned by the
+// completion date of the records, e.g. prefix/dt=2024-05-01/<first>-<last>.jsonl
+type JSONLSink struct {
+	name   string
+	store  ObjectStore
+	prefix string
+}
+
+// NewJSONLSink creates a JSON lines sink
+func NewJSONLSink(name string, store ObjectStore, prefix string) *JSONLSink {
+	return &JSONLSink{
+		name:   name,
+		store:  store,
+		prefix: strings.Trim(prefix, "/"),
+	}
+}
+
+// Name returns the sink name
+func (s *JSONLSink) Name() string {
+	return s.name
+}
+
+// Write writes one object per date partition. Object keys are derived from
+// the sequence range so a retried batch overwrites instead of duplicating.
+func (s *JSONLSink) Write(ctx context.Context, batch *Batch) error {
+	partitions := make(map[string][]ExportedRecord)
+	dates := make([]string, 0)
+	for _, record := range batch.Records {
+		date := record.CompletedAt.UTC().Format("2006-01-02")
+		if _, exists := partitions[date]; !exists {
+			dates = append(dates, date)
+		}
+		partitions[date] = append(partitions[date], record)
+	}
+
+	for _, date := range dates {
+		records := partitions[date]
+
+		var buf bytes.Buffer
+		for _, record := range records {
+			line, err := json.Marshal(record.Fields)
+			if err != nil {
+				return fmt.Errorf("failed to encode record %d: %w", record.Sequence, err)
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+
+		key := s.objectKey(date, records[0].Sequence, records[len(records)-1].Sequence)
+		if err := s.store.Put(ctx, key, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the sink
+func (s *JSONLSink) Close() error {
+	return nil
+}
+
+func (s *JSONLSink) objectKey(date string, first, last uint64) string {
+	key := fmt.Sprintf("dt=%s/%020d-%020d.jsonl", date, first, last)
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	return key
+}
+
+// KafkaMessage is a message produced to a Kafka topic
+type KafkaMessage struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// KafkaProducer produces messages to Kafka. It is satisfied by a thin
+// wrapper around the Kafka client used by the deployment.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, messages []KafkaMessage) error
+	Close() error
+}
+
+// KafkaSink produces one message per record keyed by execution ID, so all
+// records of an execution land in the same partition
+type KafkaSink struct {
+	name     string
+	topic    string
+	producer KafkaProducer
+}
+
+// NewKafkaSink creates a Kafka topic sink
+func NewKafkaSink(name, topic string, producer KafkaProducer) *KafkaSink {
+	return &KafkaSink{
+		name:     name,
+		topic:    topic,
+		producer: producer,
+	}
+}
+
+// Name returns the sink name
+func (s *KafkaSink) Name() string {
+	return s.name
+}
+
+// Write produces the batch to the topic
+func (s *KafkaSink) Write(ctx context.Context, batch *Batch) error {
+	messages := make([]KafkaMessage, 0, len(batch.Records))
+	for _, record := range batch.Records {
+		value, err := json.Marshal(record.Fields)
+		if err != nil {
+			return fmt.Errorf("failed to encode record %d: %w", record.Sequence, err)
+		}
+		messages = append(messages, KafkaMessage{
+			Key:   []byte(record.ExecutionID),
+			Value: value,
+			Headers: map[string]string{
+				"schema_version": strconv.Itoa(SchemaVersion),
+				"sequence":       strconv.FormatUint(record.Sequence, 10),
+			},
+		})
+	}
+
+	return s.producer.Produce(ctx, s.topic, messages)
+}
+
+// Close closes the producer
+func (s *KafkaSink) Close() error {
+	return s.producer.Close()
+}
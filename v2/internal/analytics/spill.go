@@ -0,0 +1,175 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SpillStore holds records that did not fit in a sink's buffer until the
+// sink catches up. Records are returned in sequence order.
+type SpillStore interface {
+	Save(ctx context.Context, sink string, records []*ExecutionRecord) error
+	Load(ctx context.Context, sink string, limit int) ([]*ExecutionRecord, error)
+	Delete(ctx context.Context, sink string, sequences []uint64) error
+	Count(ctx context.Context, sink string) (int64, error)
+}
+
+// MemorySpillStore is a SpillStore kept in memory. Spilled records are lost
+// on restart, so it is only suitable for tests and development.
+type MemorySpillStore struct {
+	mu      sync.Mutex
+	records map[string]map[uint64]*ExecutionRecord
+}
+
+// NewMemorySpillStore creates an in-memory spill store
+func NewMemorySpillStore() *MemorySpillStore {
+	return &MemorySpillStore{records: make(map[string]map[uint64]*ExecutionRecord)}
+}
+
+// Save stores records for a sink
+func (s *MemorySpillStore) Save(ctx context.Context, sink string, records []*ExecutionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records[sink] == nil {
+		s.records[sink] = make(map[uint64]*ExecutionRecord)
+	}
+	for _, record := range records {
+		s.records[sink][record.Sequence] = record
+	}
+	return nil
+}
+
+// Load returns the oldest records of a sink
+func (s *MemorySpillStore) Load(ctx context.Context, sink string, limit int) ([]*ExecutionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]*ExecutionRecord, 0, len(s.records[sink]))
+	for _, record := range s.records[sink] {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Sequence < records[j].Sequence
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// Delete removes delivered records
+func (s *MemorySpillStore) Delete(ctx context.Context, sink string, sequences []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sequence := range sequences {
+		delete(s.records[sink], sequence)
+	}
+	return nil
+}
+
+// Count returns the number of spilled records of a sink
+func (s *MemorySpillStore) Count(ctx context.Context, sink string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.records[sink])), nil
+}
+
+// SpilledRecord is the database row of a spilled record
+type SpilledRecord struct {
+	ID        uint   `gorm:"primaryKey"`
+	Sink      string `gorm:"not null;uniqueIndex:idx_analytics_spill_sink_sequence"`
+	Sequence  uint64 `gorm:"not null;uniqueIndex:idx_analytics_spill_sink_sequence"`
+	Record    string `gorm:"type:text;not null"`
+	CreatedAt time.Time
+}
+
+// TableName returns the table name for the SpilledRecord model
+func (SpilledRecord) TableName() string {
+	return "analytics_spill"
+}
+
+// GormSpillStore is a SpillStore backed by the application database
+type GormSpillStore struct {
+	db *gorm.DB
+}
+
+// NewGormSpillStore creates a database spill store
+func NewGormSpillStore(db *gorm.DB) *GormSpillStore {
+	return &GormSpillStore{db: db}
+}
+
+// Migrate creates the spill table
+func (s *GormSpillStore) Migrate() error {
+	return s.db.AutoMigrate(&SpilledRecord{})
+}
+
+// Save stores records for a sink
+func (s *GormSpillStore) Save(ctx context.Context, sink string, records []*ExecutionRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	rows := make([]*SpilledRecord, 0, len(records))
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode record %d: %w", record.Sequence, err)
+		}
+		rows = append(rows, &SpilledRecord{
+			Sink:     sink,
+			Sequence: record.Sequence,
+			Record:   string(data),
+		})
+	}
+
+	return s.db.WithContext(ctx).Create(&rows).Error
+}
+
+// Load returns the oldest records of a sink
+func (s *GormSpillStore) Load(ctx context.Context, sink string, limit int) ([]*ExecutionRecord, error) {
+	var rows []*SpilledRecord
+	err := s.db.WithContext(ctx).
+		Where("sink = ?", sink).
+		Order("sequence ASC").
+		Limit(limit).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*ExecutionRecord, 0, len(rows))
+	for _, row := range rows {
+		var record ExecutionRecord
+		if err := json.Unmarshal([]byte(row.Record), &record); err != nil {
+			return nil, fmt.Errorf("failed to decode spilled record %d: %w", row.Sequence, err)
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+// Delete removes delivered records
+func (s *GormSpillStore) Delete(ctx context.Context, sink string, sequences []uint64) error {
+	if len(sequences) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).
+		Where("sink = ? AND sequence IN ?", sink, sequences).
+		Delete(&SpilledRecord{}).Error
+}
+
+// Count returns the number of spilled records of a sink
+func (s *GormSpillStore) Count(ctx context.Context, sink string) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&SpilledRecord{}).Where("sink = ?", sink).Count(&count).Error
+	return count, err
+}
@@ -2,7 +2,6 @@ package api
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -17,14 +16,14 @@ func (h *Handler) generateCode(c *gin.Context) {
 	}
 
 	// Validate workflow exists
-	workflow, err := h.services.WorkflowService.GetByID(request.WorkflowID)
+	workflow, err := h.workflows(c).GetByID(request.WorkflowID)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Workflow not found", err)
 		return
 	}
 
 	// Validate language
-	supportedLanguages := []string{"go", "typescript", "python", "java", "csharp"}
+	supportedLanguages := []string{"go", "typescript", "python", "java", "kotlin", "swift", "ruby", "grpc", "csharp"}
 	validLanguage := false
 	for _, lang := range supportedLanguages {
 		if request.Language == lang {
@@ -45,7 +44,7 @@ func (h *Handler) generateCode(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"job_id":      job.ID,
 		"workflow_id": request.WorkflowID,
 		"language":    request.Language,
@@ -56,7 +55,7 @@ func (h *Handler) generateCode(c *gin.Context) {
 		"job_id":    job.ID,
 		"status":     job.Status,
 		"message":    "Code generation job started",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -80,7 +79,7 @@ func (h *Handler) getCodeGenStatus(c *gin.Context) {
 		"progress":    job.Progress,
 		"created_at":  job.CreatedAt,
 		"updated_at":  job.UpdatedAt,
-		"timestamp":   time.Now().UTC(),
+		"timestamp":   h.now(),
 	}
 
 	if job.CompletedAt != nil {
@@ -140,7 +139,7 @@ func (h *Handler) downloadGeneratedCode(c *gin.Context) {
 	// Write file data
 	c.Data(http.StatusOK, "application/zip", archiveData)
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"job_id":   id,
 		"filename": filename,
 		"user_id":  h.getUserID(c),
@@ -201,7 +200,7 @@ func (h *Handler) listCodeGenJobs(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
 
@@ -228,7 +227,7 @@ func (h *Handler) createWorkflowVersion(c *gin.Context) {
 	}
 
 	// Validate workflow exists
-	workflow, err := h.services.WorkflowService.GetByID(workflowID)
+	workflow, err := h.workflows(c).GetByID(workflowID)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Workflow not found", err)
 		return
@@ -241,7 +240,7 @@ func (h *Handler) createWorkflowVersion(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"version_id":  version.ID,
 		"workflow_id": workflowID,
 		"version":     versionData.Version,
@@ -250,7 +249,7 @@ func (h *Handler) createWorkflowVersion(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"data":      version,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -286,7 +285,7 @@ func (h *Handler) listWorkflowVersions(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
 
@@ -313,6 +312,23 @@ func (h *Handler) getWorkflowVersion(c *gin.Context) {
 	h.successResponse(c, version)
 }
 
+// getWorkflowVersionExamples returns the example inputs and outputs of a
+// workflow version
+func (h *Handler) getWorkflowVersionExamples(c *gin.Context) {
+	workflowID, err := h.parseUUID(c, "id")
+	if err != nil {
+		return
+	}
+
+	version, err := h.services.VersionService.GetVersion(workflowID, c.Param("version"))
+	if err != nil {
+		h.errorResponse(c, http.StatusNotFound, "Workflow version not found", err)
+		return
+	}
+
+	h.successResponse(c, examplesResponse(version.Definition.Spec.Examples))
+}
+
 // rollbackWorkflowVersion rolls back to a specific workflow version
 func (h *Handler) rollbackWorkflowVersion(c *gin.Context) {
 	workflowID, err := h.parseUUID(c, "id")
@@ -342,7 +358,7 @@ func (h *Handler) rollbackWorkflowVersion(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"workflow_id": workflowID,
 		"version":     versionStr,
 		"reason":      rollbackData.Reason,
@@ -352,7 +368,7 @@ func (h *Handler) rollbackWorkflowVersion(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"data":      rollbackInfo,
 		"message":   "Workflow version rolled back successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -411,7 +427,7 @@ func (h *Handler) deployWorkflowVersion(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"deployment_id": deployment.ID,
 		"workflow_id":   workflowID,
 		"version":       versionStr,
@@ -422,6 +438,6 @@ func (h *Handler) deployWorkflowVersion(c *gin.Context) {
 	c.JSON(http.StatusAccepted, gin.H{
 		"data":      deployment,
 		"message":   "Workflow version deployment started",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
\ No newline at end of file
@@ -15,12 +15,12 @@ func (h *Handler) getDashboardOverview(c *gin.Context) {
 	start, end, err := h.parseTimeRange(c)
 	if err != nil {
 		// Default to last 24 hours
-		end = time.Now().UTC()
+		end = h.now()
 		start = end.Add(-24 * time.Hour)
 	}
 
 	// Get overview data
-	overview, err := h.services.DashboardService.GetOverview(start, end)
+	overview, err := h.dashboards(c).GetOverview(start, end)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get dashboard overview", err)
 		return
@@ -35,12 +35,12 @@ func (h *Handler) getWorkflowStatus(c *gin.Context) {
 	start, end, err := h.parseTimeRange(c)
 	if err != nil {
 		// Default to last 24 hours
-		end = time.Now().UTC()
+		end = h.now()
 		start = end.Add(-24 * time.Hour)
 	}
 
 	// Get workflow status
-	status, err := h.services.DashboardService.GetWorkflowStatus(start, end)
+	status, err := h.dashboards(c).GetWorkflowStatus(start, end)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get workflow status", err)
 		return
@@ -52,7 +52,7 @@ func (h *Handler) getWorkflowStatus(c *gin.Context) {
 // getSystemHealth gets system health metrics
 func (h *Handler) getSystemHealth(c *gin.Context) {
 	// Get system health
-	health, err := h.services.DashboardService.GetSystemHealth()
+	health, err := h.dashboards(c).GetSystemHealth()
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get system health", err)
 		return
@@ -71,7 +71,7 @@ func (h *Handler) getLiveMetrics(c *gin.Context) {
 	}
 
 	// Get live metrics
-	metrics, err := h.services.DashboardService.GetLiveMetrics(metricTypes)
+	metrics, err := h.dashboards(c).GetLiveMetrics(metricTypes)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get live metrics", err)
 		return
@@ -98,7 +98,7 @@ func (h *Handler) createDashboard(c *gin.Context) {
 	}
 
 	// Create dashboard
-	createdDashboard, err := h.services.DashboardService.CreateDashboard(
+	createdDashboard, err := h.dashboards(c).CreateDashboard(
 		dashboard.Name,
 		dashboard.Description,
 		dashboard.Layout,
@@ -114,7 +114,7 @@ func (h *Handler) createDashboard(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"dashboard_id": createdDashboard.ID,
 		"name":         dashboard.Name,
 		"user_id":      h.getUserID(c),
@@ -122,7 +122,7 @@ func (h *Handler) createDashboard(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"data":      createdDashboard,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -146,7 +146,7 @@ func (h *Handler) listDashboards(c *gin.Context) {
 	}
 
 	// Get dashboards
-	dashboards, total, err := h.services.DashboardService.ListDashboards(page, limit, filters)
+	dashboards, total, err := h.dashboards(c).ListDashboards(page, limit, filters)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to list dashboards", err)
 		return
@@ -160,7 +160,7 @@ func (h *Handler) listDashboards(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
 
@@ -172,7 +172,7 @@ func (h *Handler) getDashboard(c *gin.Context) {
 	}
 
 	// Get dashboard
-	dashboard, err := h.services.DashboardService.GetDashboard(id)
+	dashboard, err := h.dashboards(c).GetDashboard(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Dashboard not found", err)
 		return
@@ -204,13 +204,13 @@ func (h *Handler) updateDashboard(c *gin.Context) {
 	}
 
 	// Update dashboard
-	updatedDashboard, err := h.services.DashboardService.UpdateDashboard(id, updates, h.getUserID(c))
+	updatedDashboard, err := h.dashboards(c).UpdateDashboard(id, updates, h.getUserID(c))
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to update dashboard", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"dashboard_id": id,
 		"user_id":      h.getUserID(c),
 	}).Info("Dashboard updated")
@@ -226,19 +226,19 @@ func (h *Handler) deleteDashboard(c *gin.Context) {
 	}
 
 	// Delete dashboard
-	if err := h.services.DashboardService.DeleteDashboard(id, h.getUserID(c)); err != nil {
+	if err := h.dashboards(c).DeleteDashboard(id, h.getUserID(c)); err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to delete dashboard", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"dashboard_id": id,
 		"user_id":      h.getUserID(c),
 	}).Info("Dashboard deleted")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Dashboard deleted successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -260,13 +260,13 @@ func (h *Handler) shareDashboard(c *gin.Context) {
 	}
 
 	// Share dashboard
-	shareInfo, err := h.services.DashboardService.ShareDashboard(id, shareData.Users, shareData.Permissions, shareData.ExpiresAt, h.getUserID(c))
+	shareInfo, err := h.dashboards(c).ShareDashboard(id, shareData.Users, shareData.Permissions, shareData.ExpiresAt, h.getUserID(c))
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to share dashboard", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"dashboard_id": id,
 		"users":        shareData.Users,
 		"permissions":  shareData.Permissions,
@@ -276,7 +276,7 @@ func (h *Handler) shareDashboard(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"data":      shareInfo,
 		"message":   "Dashboard shared successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -293,7 +293,7 @@ func (h *Handler) exportDashboard(c *gin.Context) {
 	}
 
 	// Export dashboard
-	exportData, filename, contentType, err := h.services.DashboardService.ExportDashboard(id, format)
+	exportData, filename, contentType, err := h.dashboards(c).ExportDashboard(id, format)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to export dashboard", err)
 		return
@@ -307,7 +307,7 @@ func (h *Handler) exportDashboard(c *gin.Context) {
 	// Write file data
 	c.Data(http.StatusOK, contentType, exportData)
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"dashboard_id": id,
 		"format":       format,
 		"filename":     filename,
@@ -327,13 +327,13 @@ func (h *Handler) importDashboard(c *gin.Context) {
 	overwrite := c.PostForm("overwrite") == "true"
 
 	// Import dashboard
-	dashboard, err := h.services.DashboardService.ImportDashboard(file, header.Filename, overwrite, h.getUserID(c))
+	dashboard, err := h.dashboards(c).ImportDashboard(file, header.Filename, overwrite, h.getUserID(c))
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to import dashboard", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"dashboard_id": dashboard.ID,
 		"filename":     header.Filename,
 		"overwrite":    overwrite,
@@ -343,6 +343,6 @@ func (h *Handler) importDashboard(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"data":      dashboard,
 		"message":   "Dashboard imported successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
\ No newline at end of file
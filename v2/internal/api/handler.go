@@ -7,9 +7,18 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/magic-flow/v2/internal/attachments"
+	"github.com/magic-flow/v2/internal/correlation"
+	"github.com/magic-flow/v2/internal/deprecation"
 	"github.com/magic-flow/v2/internal/engine"
+	"github.com/magic-flow/v2/internal/freeze"
 	"github.com/magic-flow/v2/internal/metrics"
+	"github.com/magic-flow/v2/internal/negotiation"
+	"github.com/magic-flow/v2/internal/policies"
+	"github.com/magic-flow/v2/internal/quotas"
+	"github.com/magic-flow/v2/internal/scheduler"
 	"github.com/magic-flow/v2/internal/services"
+	"github.com/magic-flow/v2/internal/spikes"
 	"github.com/magic-flow/v2/pkg/models"
 	"github.com/sirupsen/logrus"
 )
@@ -19,6 +28,15 @@ type Handler struct {
 	services        *services.Container
 	workflowEngine  *engine.Engine
 	metricsCollector *metrics.Collector
+	deprecations    *deprecation.Manager
+	apiKeyHeader    string
+	policies        *policies.Manager
+	quotas          *quotas.Limiter
+	spikes          *spikes.Manager
+	negotiation     negotiation.Config
+	freezes         *freeze.Manager
+	attachments     *attachments.Manager
+	clock           scheduler.Clock
 }
 
 // NewHandler creates a new API handler
@@ -27,9 +45,87 @@ func NewHandler(services *services.Container, workflowEngine *engine.Engine, met
 		services:        services,
 		workflowEngine:  workflowEngine,
 		metricsCollector: metricsCollector,
+		negotiation:     negotiation.DefaultConfig(),
+		clock:           scheduler.NewRealClock(),
 	}
 }
 
+// SetClock sets the clock default time ranges and response timestamps are
+// read from, the clock of the engine and scheduler
+func (h *Handler) SetClock(clock scheduler.Clock) {
+	h.clock = clock
+}
+
+// now returns the current time of the handler clock, in UTC
+func (h *Handler) now() time.Time {
+	return h.clock.Now().UTC()
+}
+
+// workflows returns the workflow service scoped to the request. In
+// multi-tenant deployments it only finds the workflows of the tenant of the
+// request, and assigns the workflows it creates to it.
+func (h *Handler) workflows(c *gin.Context) *services.WorkflowService {
+	return h.services.WorkflowService.WithContext(c.Request.Context())
+}
+
+// executions returns the execution service scoped to the request
+func (h *Handler) executions(c *gin.Context) *services.ExecutionService {
+	return h.services.ExecutionService.WithContext(c.Request.Context())
+}
+
+// metrics returns the metrics service scoped to the request
+func (h *Handler) metrics(c *gin.Context) *services.MetricsService {
+	return h.services.MetricsService.WithContext(c.Request.Context())
+}
+
+// dashboards returns the dashboard service scoped to the request
+func (h *Handler) dashboards(c *gin.Context) *services.DashboardService {
+	return h.services.DashboardService.WithContext(c.Request.Context())
+}
+
+// SetDeprecations sets the manager applying workflow deprecations to
+// executions. Callers are identified by the API key sent in apiKeyHeader.
+func (h *Handler) SetDeprecations(manager *deprecation.Manager, apiKeyHeader string) {
+	h.deprecations = manager
+	h.apiKeyHeader = apiKeyHeader
+}
+
+// SetPolicies sets the manager evaluating the admission policies of
+// executions
+func (h *Handler) SetPolicies(manager *policies.Manager) {
+	h.policies = manager
+}
+
+// SetQuotas sets the limiter of the executions each tenant may start
+func (h *Handler) SetQuotas(limiter *quotas.Limiter) {
+	h.quotas = limiter
+}
+
+// SetSpikes sets the guards against submission spikes of workflows and of
+// the API keys, sent in apiKeyHeader, submitting them
+func (h *Handler) SetSpikes(manager *spikes.Manager, apiKeyHeader string) {
+	h.spikes = manager
+	h.apiKeyHeader = apiKeyHeader
+}
+
+// SetFreezes sets the manager of system freezes, whose freezes in effect
+// are reported by the health check
+func (h *Handler) SetFreezes(manager *freeze.Manager) {
+	h.freezes = manager
+}
+
+// SetAttachments sets the manager extracting the binaries embedded in
+// execution inputs into artifacts, and restoring them on read
+func (h *Handler) SetAttachments(manager *attachments.Manager) {
+	h.attachments = manager
+}
+
+// SetNegotiation sets the content negotiation of the execution endpoints,
+// which accept and return MessagePack and gzip bodies
+func (h *Handler) SetNegotiation(config negotiation.Config) {
+	h.negotiation = config
+}
+
 // SetupRoutes sets up all API routes
 func (h *Handler) SetupRoutes(router *gin.Engine) {
 	// Health check
@@ -45,22 +141,27 @@ func (h *Handler) SetupRoutes(router *gin.Engine) {
 			workflows.POST("", h.createWorkflow)
 			workflows.GET("", h.listWorkflows)
 			workflows.GET("/:id", h.getWorkflow)
+			workflows.GET("/:id/examples", h.getWorkflowExamples)
 			workflows.PUT("/:id", h.updateWorkflow)
 			workflows.DELETE("/:id", h.deleteWorkflow)
 			workflows.POST("/:id/validate", h.validateWorkflow)
+			workflows.POST("/:id/steps/:step/contract-test", h.testStepContract)
 		}
 
 		// Workflow execution
 		executions := v1.Group("/executions")
 		{
-			executions.POST("/workflows/:id/execute", h.executeWorkflow)
+			executions.POST("/workflows/:id/execute", negotiation.Middleware(h.negotiation), h.executeWorkflow)
 			executions.GET("/:id", h.getExecution)
 			executions.GET("/:id/status", h.getExecutionStatus)
-			executions.GET("/:id/results", h.getExecutionResults)
+			executions.GET("/:id/results", negotiation.Middleware(h.negotiation), h.getExecutionResults)
 			executions.GET("/:id/events", h.streamExecutionEvents)
 			executions.GET("", h.listExecutions)
+			executions.GET("/running", h.listRunningExecutions)
+			executions.GET("/drain", h.getDrainStatus)
 			executions.POST("/:id/cancel", h.cancelExecution)
 			executions.POST("/:id/retry", h.retryExecution)
+			executions.POST("/:id/replay", h.replayExecution)
 			executions.GET("/:id/logs", h.getExecutionLogs)
 		}
 
@@ -91,6 +192,7 @@ func (h *Handler) SetupRoutes(router *gin.Engine) {
 			versions.POST("/workflows/:id/versions", h.createWorkflowVersion)
 			versions.GET("/workflows/:id/versions", h.listWorkflowVersions)
 			versions.GET("/workflows/:id/versions/:version", h.getWorkflowVersion)
+			versions.GET("/workflows/:id/versions/:version/examples", h.getWorkflowVersionExamples)
 			versions.POST("/workflows/:id/versions/:version/rollback", h.rollbackWorkflowVersion)
 			versions.GET("/workflows/:id/versions/:from/compare/:to", h.compareWorkflowVersions)
 			versions.POST("/workflows/:id/versions/:version/deploy", h.deployWorkflowVersion)
@@ -140,11 +242,15 @@ func (h *Handler) SetupRoutes(router *gin.Engine) {
 
 // Health check endpoint
 func (h *Handler) healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	health := gin.H{
 		"status":    "healthy",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 		"version":   "2.0.0",
-	})
+	}
+	if h.freezes != nil {
+		health["freeze"] = h.freezes.Banner()
+	}
+	c.JSON(http.StatusOK, health)
 }
 
 // Readiness check endpoint
@@ -169,16 +275,16 @@ func (h *Handler) readinessCheck(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "ready",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
 // Error response helper
 func (h *Handler) errorResponse(c *gin.Context, statusCode int, message string, err error) {
-	logrus.WithError(err).Error(message)
-	c.JSON(statusCode, gin.H{
+	h.logger(c).WithError(err).Error(message)
+	negotiation.Render(c, statusCode, gin.H{
 		"error":     message,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -186,7 +292,7 @@ func (h *Handler) errorResponse(c *gin.Context, statusCode int, message string,
 func (h *Handler) successResponse(c *gin.Context, data interface{}) {
 	c.JSON(http.StatusOK, gin.H{
 		"data":      data,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -223,6 +329,7 @@ func (h *Handler) parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
 	
 	var start, end time.Time
 	var err error
+	now := h.now()
 	
 	if startStr != "" {
 		start, err = time.Parse(time.RFC3339, startStr)
@@ -230,7 +337,7 @@ func (h *Handler) parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
 			return time.Time{}, time.Time{}, err
 		}
 	} else {
-		start = time.Now().Add(-24 * time.Hour) // Default to last 24 hours
+		start = now.Add(-24 * time.Hour) // Default to last 24 hours
 	}
 	
 	if endStr != "" {
@@ -239,16 +346,17 @@ func (h *Handler) parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
 			return time.Time{}, time.Time{}, err
 		}
 	} else {
-		end = time.Now()
+		end = now
 	}
 	
 	return start, end, nil
 }
 
-// Validate request body
+// Validate request body. Bodies are JSON, or MessagePack on the routes
+// negotiating it.
 func (h *Handler) validateRequestBody(c *gin.Context, obj interface{}) error {
-	if err := c.ShouldBindJSON(obj); err != nil {
-		h.errorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+	if err := negotiation.Bind(c, obj); err != nil {
+		h.errorResponse(c, negotiation.BindStatus(err), "Invalid request body", err)
 		return err
 	}
 	return nil
@@ -261,6 +369,12 @@ func (h *Handler) getUserID(c *gin.Context) string {
 	return c.GetHeader("X-User-ID")
 }
 
+// logger returns the request-scoped logger, tagged with the correlation ID
+// of the request
+func (h *Handler) logger(c *gin.Context) *logrus.Entry {
+	return correlation.Logger(c.Request.Context(), logrus.StandardLogger())
+}
+
 // Response structures
 type ListResponse struct {
 	Data       interface{} `json:"data"`
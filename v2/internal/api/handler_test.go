@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/magic-flow/v2/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		query string
+		start time.Time
+		end   time.Time
+	}{
+		"defaults to the last 24 hours": {
+			start: now.Add(-24 * time.Hour),
+			end:   now,
+		},
+		"start only": {
+			query: "?start=2024-02-01T00:00:00Z",
+			start: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			end:   now,
+		},
+		"start and end": {
+			query: "?start=2024-02-01T00:00:00Z&end=2024-02-02T00:00:00Z",
+			start: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := NewHandler(nil, nil, nil)
+			h.SetClock(scheduler.NewFakeClock(now))
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/v1/metrics"+tt.query, nil)
+
+			start, end, err := h.parseTimeRange(c)
+			require.NoError(t, err)
+			assert.True(t, tt.start.Equal(start), "start %s, want %s", start, tt.start)
+			assert.True(t, tt.end.Equal(end), "end %s, want %s", end, tt.end)
+		})
+	}
+}
@@ -2,7 +2,6 @@ package api
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -43,7 +42,7 @@ func (h *Handler) getWorkflowMetrics(c *gin.Context) {
 	interval := c.DefaultQuery("interval", "5m")
 
 	// Get workflow metrics
-	metrics, err := h.services.MetricsService.GetWorkflowMetrics(filters, aggregation, interval)
+	metrics, err := h.metrics(c).GetWorkflowMetrics(filters, aggregation, interval)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get workflow metrics", err)
 		return
@@ -67,14 +66,14 @@ func (h *Handler) getWorkflowMetricsById(c *gin.Context) {
 	}
 
 	// Get workflow metrics
-	metrics, err := h.services.MetricsService.GetWorkflowMetricsByID(id, start, end)
+	metrics, err := h.metrics(c).GetWorkflowMetricsByID(id, start, end)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get workflow metrics", err)
 		return
 	}
 
 	// Get workflow statistics
-	stats, err := h.services.MetricsService.GetWorkflowStats(id, start, end)
+	stats, err := h.metrics(c).GetWorkflowStats(id, start, end)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get workflow stats", err)
 		return
@@ -83,7 +82,7 @@ func (h *Handler) getWorkflowMetricsById(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"metrics":   metrics,
 		"stats":     stats,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -122,7 +121,7 @@ func (h *Handler) getSystemMetrics(c *gin.Context) {
 	interval := c.DefaultQuery("interval", "5m")
 
 	// Get system metrics
-	metrics, err := h.services.MetricsService.GetSystemMetrics(filters, aggregation, interval)
+	metrics, err := h.metrics(c).GetSystemMetrics(filters, aggregation, interval)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get system metrics", err)
 		return
@@ -154,16 +153,16 @@ func (h *Handler) recordCustomMetric(c *gin.Context) {
 		Metadata:    request.Metadata,
 		WorkflowID:  request.WorkflowID,
 		ExecutionID: request.ExecutionID,
-		Timestamp:   time.Now(),
+		Timestamp:   h.now(),
 	}
 
 	// Record metric
-	if err := h.services.MetricsService.RecordBusinessMetric(metric); err != nil {
+	if err := h.metrics(c).RecordBusinessMetric(metric); err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to record metric", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"metric_name": request.Name,
 		"value":       request.Value,
 		"user_id":     h.getUserID(c),
@@ -171,7 +170,7 @@ func (h *Handler) recordCustomMetric(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":   "Metric recorded successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -219,7 +218,7 @@ func (h *Handler) getCustomMetrics(c *gin.Context) {
 	interval := c.DefaultQuery("interval", "5m")
 
 	// Get custom metrics
-	metrics, err := h.services.MetricsService.GetBusinessMetrics(filters, aggregation, interval)
+	metrics, err := h.metrics(c).GetBusinessMetrics(filters, aggregation, interval)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get custom metrics", err)
 		return
@@ -263,7 +262,7 @@ func (h *Handler) getMetricAggregations(c *gin.Context) {
 	page, limit := h.parsePagination(c)
 
 	// Get metric aggregations
-	aggregations, total, err := h.services.MetricsService.GetMetricAggregations(filters, page, limit)
+	aggregations, total, err := h.metrics(c).GetMetricAggregations(filters, page, limit)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get metric aggregations", err)
 		return
@@ -277,14 +276,14 @@ func (h *Handler) getMetricAggregations(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
 
 // getDashboardOverview gets dashboard overview data
 func (h *Handler) getDashboardOverview(c *gin.Context) {
 	// Get overview data from services
-	overview, err := h.services.DashboardService.GetOverview()
+	overview, err := h.dashboards(c).GetOverview()
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get dashboard overview", err)
 		return
@@ -303,7 +302,7 @@ func (h *Handler) getWorkflowStatusSummary(c *gin.Context) {
 	}
 
 	// Get workflow status summary
-	summary, err := h.services.DashboardService.GetWorkflowStatusSummary(start, end)
+	summary, err := h.dashboards(c).GetWorkflowStatusSummary(start, end)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get workflow status summary", err)
 		return
@@ -315,7 +314,7 @@ func (h *Handler) getWorkflowStatusSummary(c *gin.Context) {
 // getSystemHealth gets system health status
 func (h *Handler) getSystemHealth(c *gin.Context) {
 	// Get system health from services
-	health, err := h.services.DashboardService.GetSystemHealth()
+	health, err := h.dashboards(c).GetSystemHealth()
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get system health", err)
 		return
@@ -331,7 +330,7 @@ func (h *Handler) getLiveMetrics(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"metrics":   metrics,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -352,7 +351,7 @@ func (h *Handler) createAlert(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"alert_id": createdAlert.ID,
 		"name":     createdAlert.Name,
 		"user_id":  h.getUserID(c),
@@ -360,7 +359,7 @@ func (h *Handler) createAlert(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"data":      createdAlert,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -395,7 +394,7 @@ func (h *Handler) listAlerts(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
 
@@ -436,7 +435,7 @@ func (h *Handler) updateAlert(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"alert_id": id,
 		"name":     updatedAlert.Name,
 		"user_id":  h.getUserID(c),
@@ -458,14 +457,14 @@ func (h *Handler) deleteAlert(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"alert_id": id,
 		"user_id":  h.getUserID(c),
 	}).Info("Alert deleted")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Alert deleted successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -482,14 +481,14 @@ func (h *Handler) enableAlert(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"alert_id": id,
 		"user_id":  h.getUserID(c),
 	}).Info("Alert enabled")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Alert enabled successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -506,14 +505,14 @@ func (h *Handler) disableAlert(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"alert_id": id,
 		"user_id":  h.getUserID(c),
 	}).Info("Alert disabled")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Alert disabled successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -548,6 +547,6 @@ func (h *Handler) getAlertEvents(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
\ No newline at end of file
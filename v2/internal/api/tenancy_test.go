@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/magic-flow/v2/internal/database"
+	"github.com/magic-flow/v2/internal/services"
+	"github.com/magic-flow/v2/internal/tenancy"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// tenantWorkflow is the part of a workflow record the workflow endpoints
+// read, the schema of models.Workflow needs a postgres database
+type tenantWorkflow struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Name     string
+	Version  string
+	Status   string
+	TenantID string `gorm:"index"`
+}
+
+func (tenantWorkflow) TableName() string {
+	return "workflows"
+}
+
+// tenantWorkflowVersion is the part of a version record preloaded with its
+// workflow
+type tenantWorkflowVersion struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	WorkflowID uuid.UUID
+}
+
+func (tenantWorkflowVersion) TableName() string {
+	return "workflow_versions"
+}
+
+func TestTenantCannotReadAnotherTenantsWorkflow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "tenancy.db")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&tenantWorkflow{}, &tenantWorkflowVersion{}))
+	require.NoError(t, database.EnableTenancy(db))
+
+	// The server queries with a system context, like main does
+	db = db.WithContext(tenancy.WithSystem(context.Background()))
+	payments, shipping := uuid.New(), uuid.New()
+	require.NoError(t, db.Create(&[]tenantWorkflow{
+		{ID: payments, Name: "orders", Version: "1.0.0", Status: "active", TenantID: "payments"},
+		{ID: shipping, Name: "orders", Version: "1.0.0", Status: "active", TenantID: "shipping"},
+	}).Error)
+
+	repos := database.NewRepositoryManager(db)
+	h := NewHandler(&services.Container{
+		WorkflowService: services.NewWorkflowService(repos, nil, logrus.New()),
+	}, nil, nil)
+
+	router := gin.New()
+	router.Use(tenancy.Middleware("X-API-Key", map[string]string{
+		"pk_payments": "payments",
+		"pk_shipping": "shipping",
+	}))
+	h.SetupRoutes(router)
+
+	tests := map[string]struct {
+		key      string
+		workflow uuid.UUID
+		status   int
+	}{
+		"own workflow":                {key: "pk_payments", workflow: payments, status: http.StatusOK},
+		"other tenant's workflow":     {key: "pk_payments", workflow: shipping, status: http.StatusNotFound},
+		"other tenant reads its own":  {key: "pk_shipping", workflow: shipping, status: http.StatusOK},
+		"without the key of a tenant": {workflow: payments, status: http.StatusUnauthorized},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/workflows/"+tt.workflow.String(), nil)
+			if tt.key != "" {
+				request.Header.Set("X-API-Key", tt.key)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.status, recorder.Code, recorder.Body.String())
+			if tt.status == http.StatusNotFound {
+				assert.NotContains(t, recorder.Body.String(), tt.workflow.String())
+			}
+		})
+	}
+}
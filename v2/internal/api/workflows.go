@@ -1,12 +1,22 @@
 package api
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/magic-flow/v2/internal/correlation"
+	"github.com/magic-flow/v2/internal/deprecation"
+	"github.com/magic-flow/v2/internal/engine"
+	"github.com/magic-flow/v2/internal/negotiation"
+	"github.com/magic-flow/v2/internal/policies"
+	"github.com/magic-flow/v2/internal/quotas"
+	"github.com/magic-flow/v2/internal/replay"
+	"github.com/magic-flow/v2/internal/spikes"
 	"github.com/magic-flow/v2/pkg/models"
 	"github.com/sirupsen/logrus"
 )
@@ -29,13 +39,13 @@ func (h *Handler) createWorkflow(c *gin.Context) {
 	}
 
 	// Create workflow
-	createdWorkflow, err := h.services.WorkflowService.Create(&workflow)
+	createdWorkflow, err := h.workflows(c).Create(&workflow)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to create workflow", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"workflow_id": createdWorkflow.ID,
 		"name":        createdWorkflow.Name,
 		"user_id":     userID,
@@ -43,7 +53,7 @@ func (h *Handler) createWorkflow(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"data":      createdWorkflow,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -67,7 +77,7 @@ func (h *Handler) listWorkflows(c *gin.Context) {
 	}
 
 	// Get workflows
-	workflows, total, err := h.services.WorkflowService.List(page, limit, filters)
+	workflows, total, err := h.workflows(c).List(page, limit, filters)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to list workflows", err)
 		return
@@ -81,7 +91,7 @@ func (h *Handler) listWorkflows(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
 
@@ -92,7 +102,7 @@ func (h *Handler) getWorkflow(c *gin.Context) {
 		return
 	}
 
-	workflow, err := h.services.WorkflowService.GetByID(id)
+	workflow, err := h.workflows(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Workflow not found", err)
 		return
@@ -101,6 +111,31 @@ func (h *Handler) getWorkflow(c *gin.Context) {
 	h.successResponse(c, workflow)
 }
 
+// getWorkflowExamples returns the example inputs and outputs of a workflow,
+// used in generated docs and to simulate executions
+func (h *Handler) getWorkflowExamples(c *gin.Context) {
+	id, err := h.parseUUID(c, "id")
+	if err != nil {
+		return
+	}
+
+	workflow, err := h.workflows(c).GetByID(id)
+	if err != nil {
+		h.errorResponse(c, http.StatusNotFound, "Workflow not found", err)
+		return
+	}
+
+	h.successResponse(c, examplesResponse(workflow.Definition.Spec.Examples))
+}
+
+// examplesResponse lists examples, empty rather than null without any
+func examplesResponse(examples []models.WorkflowExample) gin.H {
+	if examples == nil {
+		examples = []models.WorkflowExample{}
+	}
+	return gin.H{"examples": examples}
+}
+
 // updateWorkflow updates an existing workflow
 func (h *Handler) updateWorkflow(c *gin.Context) {
 	id, err := h.parseUUID(c, "id")
@@ -114,7 +149,7 @@ func (h *Handler) updateWorkflow(c *gin.Context) {
 	}
 
 	// Get existing workflow
-	existingWorkflow, err := h.services.WorkflowService.GetByID(id)
+	existingWorkflow, err := h.workflows(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Workflow not found", err)
 		return
@@ -133,13 +168,13 @@ func (h *Handler) updateWorkflow(c *gin.Context) {
 	}
 
 	// Update workflow
-	updatedWorkflow, err := h.services.WorkflowService.Update(&updateData)
+	updatedWorkflow, err := h.workflows(c).Update(&updateData)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to update workflow", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"workflow_id": id,
 		"name":        updatedWorkflow.Name,
 		"user_id":     h.getUserID(c),
@@ -156,7 +191,7 @@ func (h *Handler) deleteWorkflow(c *gin.Context) {
 	}
 
 	// Check if workflow has active executions
-	activeExecutions, err := h.services.ExecutionService.CountActiveByWorkflowID(id)
+	activeExecutions, err := h.executions(c).CountActiveByWorkflowID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to check active executions", err)
 		return
@@ -168,19 +203,19 @@ func (h *Handler) deleteWorkflow(c *gin.Context) {
 	}
 
 	// Delete workflow
-	if err := h.services.WorkflowService.Delete(id); err != nil {
+	if err := h.workflows(c).Delete(id); err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to delete workflow", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"workflow_id": id,
 		"user_id":     h.getUserID(c),
 	}).Info("Workflow deleted")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Workflow deleted successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -192,7 +227,7 @@ func (h *Handler) validateWorkflow(c *gin.Context) {
 	}
 
 	// Get workflow
-	workflow, err := h.services.WorkflowService.GetByID(id)
+	workflow, err := h.workflows(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Workflow not found", err)
 		return
@@ -209,10 +244,59 @@ func (h *Handler) validateWorkflow(c *gin.Context) {
 		"valid":      validationResult.Valid,
 		"errors":     validationResult.Errors,
 		"warnings":   validationResult.Warnings,
-		"timestamp":  time.Now().UTC(),
+		"timestamp":  h.now(),
 	})
 }
 
+// testStepContract calls one step of a workflow with sample variables,
+// optionally against another environment, and reports whether the response
+// conforms to the response contract of the step
+func (h *Handler) testStepContract(c *gin.Context) {
+	id, err := h.parseUUID(c, "id")
+	if err != nil {
+		return
+	}
+
+	var request engine.ContractTest
+	if c.Request.ContentLength != 0 {
+		if err := h.validateRequestBody(c, &request); err != nil {
+			return
+		}
+	}
+
+	workflow, err := h.workflows(c).GetByID(id)
+	if err != nil {
+		h.errorResponse(c, http.StatusNotFound, "Workflow not found", err)
+		return
+	}
+
+	report, err := h.workflowEngine.TestStepContract(c.Request.Context(), workflow, c.Param("step"), &request)
+	var statusErr *engine.HTTPStatusError
+	switch {
+	case errors.Is(err, engine.ErrStepNotFound):
+		h.errorResponse(c, http.StatusNotFound, "Step not found", err)
+		return
+	case errors.Is(err, engine.ErrNoContract), errors.Is(err, engine.ErrInvalidBaseURL):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"timestamp": h.now(),
+		})
+		return
+	case errors.As(err, &statusErr):
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":       err.Error(),
+			"status_code": statusErr.StatusCode,
+			"timestamp":   h.now(),
+		})
+		return
+	case err != nil:
+		h.errorResponse(c, http.StatusBadGateway, "Failed to call the step", err)
+		return
+	}
+
+	h.successResponse(c, report)
+}
+
 // executeWorkflow executes a workflow
 func (h *Handler) executeWorkflow(c *gin.Context) {
 	id, err := h.parseUUID(c, "id")
@@ -226,29 +310,143 @@ func (h *Handler) executeWorkflow(c *gin.Context) {
 	}
 
 	// Get workflow
-	workflow, err := h.services.WorkflowService.GetByID(id)
+	workflow, err := h.workflows(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Workflow not found", err)
 		return
 	}
 
+	// Extract the binaries embedded in the input into artifacts, keeping
+	// them out of the execution
+	input := request.Input
+	if h.attachments != nil {
+		input, _, err = h.attachments.Extract(c.Request.Context(), workflow.ID.String(), request.Input)
+		if err != nil {
+			h.errorResponse(c, http.StatusInternalServerError, "Failed to extract embedded binaries", err)
+			return
+		}
+	}
+
+	// Apply the deprecation of the workflow, which rejects executions after
+	// the sunset date or forwards them to the replacement
+	resolution := &deprecation.Resolution{Workflow: workflow, Input: input}
+	if h.deprecations != nil {
+		resolution, err = h.deprecations.Resolve(c.Request.Context(), workflow, nil, input)
+		var sunset *deprecation.SunsetError
+		if errors.As(err, &sunset) {
+			sunset.Notice.SetHeaders(c.Writer.Header())
+			negotiation.Render(c, http.StatusGone, gin.H{
+				"error":       err.Error(),
+				"deprecation": sunset.Notice,
+				"replacement": sunset.Notice.Replacement,
+				"timestamp":   h.now(),
+			})
+			return
+		}
+		if err != nil {
+			h.errorResponse(c, http.StatusInternalServerError, "Failed to resolve workflow deprecation", err)
+			return
+		}
+	}
+
 	// Check if workflow is active
-	if workflow.Status != models.WorkflowStatusActive {
+	if resolution.Workflow.Status != models.WorkflowStatusActive {
 		h.errorResponse(c, http.StatusBadRequest, "Workflow is not active", nil)
 		return
 	}
 
+	// Evaluate the admission policies of the workflow, which may deny the
+	// execution or warn about it
+	var policyResult *policies.Result
+	if h.policies != nil {
+		policyResult, err = h.policies.EvaluateExecution(c.Request.Context(), &policies.ExecutionRequest{
+			Workflow:   resolution.Workflow,
+			Definition: resolution.Workflow.Definition,
+			Version:    resolution.Workflow.Version,
+			Input:      resolution.Input,
+			Actor:      h.getUserID(c),
+		})
+		if err != nil {
+			h.errorResponse(c, http.StatusInternalServerError, "Failed to evaluate admission policies", err)
+			return
+		}
+		if err := policyResult.Err(); err != nil {
+			negotiation.Render(c, http.StatusForbidden, gin.H{
+				"error":     err.Error(),
+				"policy":    policyResult,
+				"timestamp": h.now(),
+			})
+			return
+		}
+	}
+
+	// Count the submission against the spike guards of the requested
+	// workflow and of the API key, which may reject it until confirmed or
+	// throttle it
+	var spikeDecision *spikes.Decision
+	if h.spikes != nil {
+		spikeDecision, err = h.spikes.Check(c.Request.Context(), &spikes.Submission{
+			Workflow:     workflow,
+			APIKey:       c.GetHeader(h.apiKeyHeader),
+			Confirmation: c.GetHeader(spikes.ConfirmHeader),
+		})
+		var confirmation *spikes.ConfirmationError
+		var throttled *spikes.ThrottledError
+		switch {
+		case errors.As(err, &confirmation):
+			c.Header(spikes.ChallengeHeader, confirmation.Challenge)
+			negotiation.Render(c, http.StatusTooManyRequests, gin.H{
+				"error":     err.Error(),
+				"guard":     confirmation.Guard,
+				"challenge": confirmation.Challenge,
+				"timestamp": h.now(),
+			})
+			return
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			negotiation.Render(c, http.StatusTooManyRequests, gin.H{
+				"error":       err.Error(),
+				"guard":       throttled.Guard,
+				"retry_after": throttled.RetryAfter.Seconds(),
+				"timestamp":   h.now(),
+			})
+			return
+		case err != nil:
+			h.errorResponse(c, http.StatusInternalServerError, "Failed to check submission spike guards", err)
+			return
+		}
+	}
+
+	// Count the execution against the quota of the tenant of the requested
+	// workflow
+	if h.quotas != nil {
+		err := h.quotas.TakeWorkflow(workflow)
+		var exceeded *quotas.ExceededError
+		if errors.As(err, &exceeded) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(exceeded.RetryAfter.Seconds()))))
+			negotiation.Render(c, http.StatusTooManyRequests, gin.H{
+				"error":       err.Error(),
+				"tenant":      exceeded.Tenant,
+				"retry_after": exceeded.RetryAfter.Seconds(),
+				"timestamp":   h.now(),
+			})
+			return
+		}
+	}
+
 	// Create execution
 	execution := &models.Execution{
-		WorkflowID:    id,
-		WorkflowName:  workflow.Name,
+		WorkflowID:    resolution.Workflow.ID,
+		WorkflowName:  resolution.Workflow.Name,
+		TenantID:      resolution.Workflow.TenantID,
 		Status:        models.ExecutionStatusPending,
-		Input:         request.Input,
+		Input:         resolution.Input,
 		Environment:   request.Environment,
 		Tags:          request.Tags,
 		Priority:      request.Priority,
 		TriggeredBy:   h.getUserID(c),
 		TriggerType:   models.TriggerTypeManual,
+		CorrelationID: correlation.FromContext(c.Request.Context()),
 	}
 
 	if request.ScheduledAt != nil {
@@ -256,50 +454,95 @@ func (h *Handler) executeWorkflow(c *gin.Context) {
 		execution.TriggerType = models.TriggerTypeScheduled
 	}
 
+	// Annotate the executions submitted during a spike with the guards of
+	// the spike
+	if spikeDecision != nil && len(spikeDecision.Guards) > 0 {
+		if execution.Labels == nil {
+			execution.Labels = make(map[string]string)
+		}
+		execution.Labels["spike_guard"] = strings.Join(spikeDecision.Subjects(), ",")
+	}
+
 	// Save execution
-	createdExecution, err := h.services.ExecutionService.Create(execution)
+	createdExecution, err := h.executions(c).Create(execution)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to create execution", err)
 		return
 	}
 
 	// Submit to workflow engine
-	if request.ScheduledAt == nil || request.ScheduledAt.Before(time.Now()) {
+	if request.ScheduledAt == nil || request.ScheduledAt.Before(h.now()) {
 		if err := h.workflowEngine.SubmitExecution(createdExecution); err != nil {
 			// Update execution status to failed
 			createdExecution.Fail(err, "ENGINE_SUBMIT_ERROR")
-			h.services.ExecutionService.Update(createdExecution)
+			h.executions(c).Update(createdExecution)
 			
 			h.errorResponse(c, http.StatusInternalServerError, "Failed to submit execution", err)
 			return
 		}
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"execution_id": createdExecution.ID,
 		"workflow_id":  id,
 		"user_id":      h.getUserID(c),
 	}).Info("Workflow execution started")
 
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"data":      createdExecution,
-		"timestamp": time.Now().UTC(),
-	})
+		"timestamp": h.now(),
+	}
+	if h.deprecations != nil {
+		// Record the caller of the requested workflow, to notify it once the
+		// workflow is deprecated
+		caller := deprecation.CallerFromAPIKey(c.GetHeader(h.apiKeyHeader))
+		if err := h.deprecations.RecordExecution(c.Request.Context(), caller, workflow.ID, workflow.Version); err != nil {
+			h.logger(c).WithError(err).Warn("Failed to record workflow caller")
+		}
+	}
+	if notice := resolution.Notice; notice != nil {
+		notice.SetHeaders(c.Writer.Header())
+		response["warning"] = notice.Warning()
+		response["deprecation"] = notice
+		if resolution.ForwardedFrom != nil {
+			response["forwarded_from"] = resolution.ForwardedFrom
+		}
+	}
+	if policyResult != nil && policyResult.Decision == policies.DecisionWarn {
+		response["policy"] = policyResult
+	}
+	if spikeDecision != nil && len(spikeDecision.Guards) > 0 {
+		response["spike_guards"] = spikeDecision.Guards
+	}
+
+	negotiation.Render(c, http.StatusCreated, response)
 }
 
-// getExecution gets an execution by ID
+// getExecution gets an execution by ID. The binaries extracted from its
+// input are returned with their download URL, or inlined again with
+// ?inline=true when they are small enough.
 func (h *Handler) getExecution(c *gin.Context) {
 	id, err := h.parseUUID(c, "id")
 	if err != nil {
 		return
 	}
 
-	execution, err := h.services.ExecutionService.GetByID(id)
+	execution, err := h.executions(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Execution not found", err)
 		return
 	}
 
+	if h.attachments != nil && execution.Input != nil {
+		inline, _ := strconv.ParseBool(c.Query("inline"))
+		input, err := h.attachments.Restore(c.Request.Context(), execution.Input, inline)
+		if err != nil {
+			h.errorResponse(c, http.StatusInternalServerError, "Failed to restore embedded binaries", err)
+			return
+		}
+		execution.Input = input.(map[string]interface{})
+	}
+
 	h.successResponse(c, execution)
 }
 
@@ -310,24 +553,56 @@ func (h *Handler) getExecutionStatus(c *gin.Context) {
 		return
 	}
 
-	execution, err := h.services.ExecutionService.GetByID(id)
+	execution, err := h.executions(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Execution not found", err)
 		return
 	}
 
 	// Get step executions
-	stepExecutions, err := h.services.ExecutionService.GetStepExecutions(id)
+	stepExecutions, err := h.executions(c).GetStepExecutions(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get step executions", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"execution":       execution,
 		"step_executions": stepExecutions,
 		"progress":        execution.GetProgress(),
-		"timestamp":       time.Now().UTC(),
+		"timestamp":       h.now(),
+	}
+	// Running executions report the status snapshot of the engine, never its
+	// live execution context
+	if status, err := h.workflowEngine.GetExecutionStatus(id); err == nil {
+		response["live"] = status
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// listRunningExecutions lists the status snapshots of the executions the
+// engine is running. Variables and step results are read from the persisted
+// execution instead.
+func (h *Handler) listRunningExecutions(c *gin.Context) {
+	executions := h.workflowEngine.ListExecutions()
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      executions,
+		"total":     len(executions),
+		"timestamp": h.now(),
+	})
+}
+
+// getDrainStatus reports the progress of the drain of the engine of this
+// node, per shutdown policy of the drained executions
+func (h *Handler) getDrainStatus(c *gin.Context) {
+	status := h.workflowEngine.DrainStatus()
+
+	c.JSON(http.StatusOK, gin.H{
+		"draining":  status != nil,
+		"data":      status,
+		"timestamp": h.now(),
 	})
 }
 
@@ -338,7 +613,7 @@ func (h *Handler) getExecutionResults(c *gin.Context) {
 		return
 	}
 
-	execution, err := h.services.ExecutionService.GetByID(id)
+	execution, err := h.executions(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Execution not found", err)
 		return
@@ -349,11 +624,11 @@ func (h *Handler) getExecutionResults(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	negotiation.Render(c, http.StatusOK, gin.H{
 		"execution": execution,
 		"output":    execution.Output,
 		"error":     execution.Error,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -377,6 +652,12 @@ func (h *Handler) listExecutions(c *gin.Context) {
 	if environment := c.Query("environment"); environment != "" {
 		filters["environment"] = environment
 	}
+	if correlationID := c.Query("correlation_id"); correlationID != "" {
+		filters["correlation_id"] = correlationID
+	}
+	if nodeID := c.Query("node_id"); nodeID != "" {
+		filters["node_id"] = nodeID
+	}
 
 	// Parse time range
 	if start, end, err := h.parseTimeRange(c); err == nil {
@@ -385,7 +666,7 @@ func (h *Handler) listExecutions(c *gin.Context) {
 	}
 
 	// Get executions
-	executions, total, err := h.services.ExecutionService.List(page, limit, filters)
+	executions, total, err := h.executions(c).List(page, limit, filters)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to list executions", err)
 		return
@@ -399,7 +680,7 @@ func (h *Handler) listExecutions(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
 
@@ -410,7 +691,7 @@ func (h *Handler) cancelExecution(c *gin.Context) {
 		return
 	}
 
-	execution, err := h.services.ExecutionService.GetByID(id)
+	execution, err := h.executions(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Execution not found", err)
 		return
@@ -427,14 +708,14 @@ func (h *Handler) cancelExecution(c *gin.Context) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"execution_id": id,
 		"user_id":      h.getUserID(c),
 	}).Info("Execution cancelled")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Execution cancelled successfully",
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
 	})
 }
 
@@ -445,7 +726,7 @@ func (h *Handler) retryExecution(c *gin.Context) {
 		return
 	}
 
-	execution, err := h.services.ExecutionService.GetByID(id)
+	execution, err := h.executions(c).GetByID(id)
 	if err != nil {
 		h.errorResponse(c, http.StatusNotFound, "Execution not found", err)
 		return
@@ -460,6 +741,7 @@ func (h *Handler) retryExecution(c *gin.Context) {
 	retryExecution := &models.Execution{
 		WorkflowID:       execution.WorkflowID,
 		WorkflowName:     execution.WorkflowName,
+		TenantID:         execution.TenantID,
 		WorkflowVersionID: execution.WorkflowVersionID,
 		Status:           models.ExecutionStatusPending,
 		Input:            execution.Input,
@@ -469,10 +751,11 @@ func (h *Handler) retryExecution(c *gin.Context) {
 		TriggeredBy:      h.getUserID(c),
 		TriggerType:      models.TriggerTypeRetry,
 		ParentExecutionID: &execution.ID,
+		CorrelationID:    execution.CorrelationID,
 	}
 
 	// Save retry execution
-	createdExecution, err := h.services.ExecutionService.Create(retryExecution)
+	createdExecution, err := h.executions(c).Create(retryExecution)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to create retry execution", err)
 		return
@@ -481,13 +764,13 @@ func (h *Handler) retryExecution(c *gin.Context) {
 	// Submit to workflow engine
 	if err := h.workflowEngine.SubmitExecution(createdExecution); err != nil {
 		createdExecution.Fail(err, "ENGINE_SUBMIT_ERROR")
-		h.services.ExecutionService.Update(createdExecution)
+		h.executions(c).Update(createdExecution)
 		
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to submit retry execution", err)
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	h.logger(c).WithFields(logrus.Fields{
 		"execution_id":       createdExecution.ID,
 		"original_execution": id,
 		"user_id":            h.getUserID(c),
@@ -495,7 +778,37 @@ func (h *Handler) retryExecution(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"data":      createdExecution,
-		"timestamp": time.Now().UTC(),
+		"timestamp": h.now(),
+	})
+}
+
+// replayExecution replays a finished execution against the current
+// definition of its workflow, with the step outputs the execution recorded
+func (h *Handler) replayExecution(c *gin.Context) {
+	id, err := h.parseUUID(c, "id")
+	if err != nil {
+		return
+	}
+
+	if _, err := h.executions(c).GetByID(id); err != nil {
+		h.errorResponse(c, http.StatusNotFound, "Execution not found", err)
+		return
+	}
+
+	replayExecution, err := h.executions(c).ReplayExecution(c.Request.Context(), id, h.getUserID(c))
+	if err != nil {
+		if errors.Is(err, replay.ErrNotReplayable) {
+			h.errorResponse(c, http.StatusBadRequest, "Only finished executions can be replayed", err)
+			return
+		}
+		h.errorResponse(c, http.StatusInternalServerError, "Failed to replay execution", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data":      replayExecution,
+		"replay_of": id,
+		"timestamp": h.now(),
 	})
 }
 
@@ -511,7 +824,7 @@ func (h *Handler) getExecutionLogs(c *gin.Context) {
 	level := c.Query("level") // debug, info, warn, error
 
 	// Get logs from execution service
-	logs, total, err := h.services.ExecutionService.GetLogs(id, page, limit, level)
+	logs, total, err := h.executions(c).GetLogs(id, page, limit, level)
 	if err != nil {
 		h.errorResponse(c, http.StatusInternalServerError, "Failed to get execution logs", err)
 		return
@@ -525,6 +838,6 @@ func (h *Handler) getExecutionLogs(c *gin.Context) {
 		Page:       page,
 		Limit:      limit,
 		TotalPages: totalPages,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  h.now(),
 	})
 }
\ No newline at end of file
@@ -0,0 +1,236 @@
+// Package approvals implements approval steps, which pause an execution
+// until the approvals required by their policy are recorded. A policy names
+// the eligible approvers by user, group or role, resolved through the RBAC
+// directory, the number of approvals required and separation-of-duties
+// constraints: the submitter of the execution may not approve, and the
+// approvals may have to come from distinct groups. Eligible approvers may
+// delegate their approvals to another user for a time window. Reminders are
+// sent through the notification routes of approval events before the step
+// times out.
+package approvals
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types published for approval requests, delivered to the webhooks
+// and notifications subscribed to them
+const (
+	EventRequested = "approval.requested"
+	EventReminder  = "approval.reminder"
+	EventExpired   = "approval.expired"
+)
+
+var (
+	// ErrNotPending is returned when approving a request that was approved,
+	// expired or cancelled
+	ErrNotPending = errors.New("approval request is not pending")
+	// ErrNotEligible is returned when the approver is not eligible under
+	// the policy of the request, directly or through a delegation
+	ErrNotEligible = errors.New("approver is not eligible")
+	// ErrSeparationOfDuties is returned when the submitter of the
+	// execution approves it
+	ErrSeparationOfDuties = errors.New("separation of duties: the submitter of the execution may not approve it")
+	// ErrAlreadyApproved is returned when an approver approves a request
+	// twice, directly or on behalf of a delegator
+	ErrAlreadyApproved = errors.New("approver already approved the request")
+	// ErrExpired is returned to the approval step when its request timed
+	// out
+	ErrExpired = errors.New("approval request expired")
+	// ErrCancelled is returned to the approval step when its request was
+	// cancelled
+	ErrCancelled = errors.New("approval request cancelled")
+	// ErrInvalidDelegation is returned for delegations without a delegate
+	// or a window
+	ErrInvalidDelegation = errors.New("invalid delegation")
+)
+
+// Reference prefixes of approvers
+const (
+	UserPrefix  = "user:"
+	GroupPrefix = "group:"
+	RolePrefix  = "role:"
+)
+
+// validReference reports whether an approver reference names a user, a
+// group or a role
+func validReference(reference string) bool {
+	for _, prefix := range []string{UserPrefix, GroupPrefix, RolePrefix} {
+		if strings.HasPrefix(reference, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(reference, prefix)) != ""
+		}
+	}
+	return false
+}
+
+// Policy is the approval policy of an approval step
+type Policy struct {
+	// Approvers are the eligible approvers, as user:, group: and role:
+	// references
+	Approvers []string `json:"approvers"`
+	// Required is the number of approvals completing the step
+	Required int `json:"required"`
+	// DistinctGroups requires each approval to come through a different
+	// approver reference
+	DistinctGroups bool `json:"distinct_groups,omitempty"`
+	// AllowSubmitter lets the submitter of the execution approve it
+	AllowSubmitter bool `json:"allow_submitter,omitempty"`
+	// Reminders are the durations before the expiry at which reminders are
+	// sent, longest first
+	Reminders []time.Duration `json:"reminders,omitempty"`
+}
+
+// Status is the state of an approval request
+type Status string
+
+const (
+	// StatusPending means the request waits for approvals
+	StatusPending Status = "pending"
+	// StatusApproved means the policy of the request is satisfied
+	StatusApproved Status = "approved"
+	// StatusExpired means the request timed out before it was approved
+	StatusExpired Status = "expired"
+	// StatusCancelled means the execution ended while the request was
+	// pending
+	StatusCancelled Status = "cancelled"
+)
+
+// Approval is an approval recorded on a request
+type Approval struct {
+	// Approver is the user who approved
+	Approver string `json:"approver"`
+	// OnBehalfOf is the eligible approver who delegated to Approver
+	OnBehalfOf   string     `json:"on_behalf_of,omitempty"`
+	DelegationID *uuid.UUID `json:"delegation_id,omitempty"`
+	// Via is the approver reference of the policy the approval counts for
+	Via        string    `json:"via"`
+	Comment    string    `json:"comment,omitempty"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// principal returns the eligible approver the approval was given for
+func (a *Approval) principal() string {
+	if a.OnBehalfOf != "" {
+		return a.OnBehalfOf
+	}
+	return a.Approver
+}
+
+// Request is the approval an approval step waits for
+type Request struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	ExecutionID uuid.UUID `json:"execution_id" gorm:"type:uuid;not null;index"`
+	WorkflowID  uuid.UUID `json:"workflow_id" gorm:"type:uuid;index"`
+	Step        string    `json:"step" gorm:"not null"`
+	Message     string    `json:"message,omitempty"`
+	// Submitter is the user who triggered the execution, empty when the
+	// execution was not triggered by a user
+	Submitter     string     `json:"submitter,omitempty"`
+	Policy        Policy     `json:"policy" gorm:"type:jsonb;serializer:json"`
+	Approvals     []Approval `json:"approvals" gorm:"type:jsonb;serializer:json"`
+	Status        Status     `json:"status" gorm:"not null;index"`
+	RemindersSent int        `json:"reminders_sent"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null;index"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+}
+
+// TableName returns the table name for the Request model
+func (Request) TableName() string {
+	return "approval_requests"
+}
+
+// Remaining returns the number of approvals the request still needs
+func (r *Request) Remaining() int {
+	remaining := r.Policy.Required - len(r.Approvals)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// approvedBy reports whether a user approved the request, directly or on
+// behalf of a delegator, or was approved for through a delegation
+func (r *Request) approvedBy(user string) bool {
+	for _, approval := range r.Approvals {
+		if approval.Approver == user || approval.OnBehalfOf == user {
+			return true
+		}
+	}
+	return false
+}
+
+// usedVia reports whether an approval already counts for an approver
+// reference
+func (r *Request) usedVia(reference string) bool {
+	for _, approval := range r.Approvals {
+		if approval.Via == reference {
+			return true
+		}
+	}
+	return false
+}
+
+// Delegation lets a delegate approve on behalf of a delegator during a time
+// window. Revoked delegations are kept for the audit trail.
+type Delegation struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	Delegator string     `json:"delegator" gorm:"not null;index"`
+	Delegate  string     `json:"delegate" gorm:"not null;index"`
+	StartsAt  time.Time  `json:"starts_at" gorm:"not null"`
+	EndsAt    time.Time  `json:"ends_at" gorm:"not null"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy string     `json:"revoked_by,omitempty"`
+}
+
+// TableName returns the table name for the Delegation model
+func (Delegation) TableName() string {
+	return "approval_delegations"
+}
+
+// ActiveAt reports whether the delegation applies at a time
+func (d *Delegation) ActiveAt(at time.Time) bool {
+	return d.RevokedAt == nil && !at.Before(d.StartsAt) && at.Before(d.EndsAt)
+}
+
+// validate checks the fields of a new delegation
+func (d *Delegation) validate(now time.Time) error {
+	switch {
+	case d.Delegator == "":
+		return fmt.Errorf("%w: the delegator is required", ErrInvalidDelegation)
+	case strings.TrimSpace(d.Delegate) == "":
+		return fmt.Errorf("%w: the delegate is required", ErrInvalidDelegation)
+	case d.Delegate == d.Delegator:
+		return fmt.Errorf("%w: approvers cannot delegate to themselves", ErrInvalidDelegation)
+	case !d.EndsAt.After(d.StartsAt):
+		return fmt.Errorf("%w: the window must end after it starts", ErrInvalidDelegation)
+	case !d.EndsAt.After(now):
+		return fmt.Errorf("%w: the window has already ended", ErrInvalidDelegation)
+	}
+	return nil
+}
+
+// Config contains the approval settings
+type Config struct {
+	// Timeout is how long approval steps wait for their approvals when
+	// they set no timeout
+	Timeout time.Duration
+	// SweepInterval is how often reminders due are sent and requests past
+	// their timeout are expired
+	SweepInterval time.Duration
+}
+
+// DefaultConfig returns the default approval settings
+func DefaultConfig() Config {
+	return Config{
+		Timeout:       24 * time.Hour,
+		SweepInterval: time.Minute,
+	}
+}
@@ -0,0 +1,528 @@
+package approvals
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+type publishedEvent struct {
+	eventType string
+	data      map[string]interface{}
+}
+
+// recordingPublisher records the events it publishes
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []publishedEvent
+}
+
+func (p *recordingPublisher) PublishEvent(eventType string, workflowID uuid.UUID, data map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, publishedEvent{eventType: eventType, data: data})
+}
+
+func (p *recordingPublisher) types() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	types := make([]string, len(p.events))
+	for i, event := range p.events {
+		types[i] = event.eventType
+	}
+	return types
+}
+
+type executionStore map[uuid.UUID]*models.Execution
+
+func (s executionStore) GetByID(id uuid.UUID) (*models.Execution, error) {
+	execution, ok := s[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return execution, nil
+}
+
+var opened = time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)
+
+// newTestManager creates a manager of the finance and treasury groups and
+// the controller role, on a fake clock
+func newTestManager() (*Manager, *scheduler.FakeClock, *recordingPublisher) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clock := scheduler.NewFakeClock(opened)
+	publisher := &recordingPublisher{}
+	directory := NewStaticDirectory(map[string][]string{
+		"finance":  {"alice", "bob"},
+		"treasury": {"carol", "dave"},
+	}, map[string][]string{
+		"controller": {"erin"},
+	})
+	manager := NewManager(DefaultConfig(), NewMemoryStore(), directory, publisher, logger)
+	manager.now = clock.Now
+	manager.pollInterval = time.Millisecond
+	return manager, clock, publisher
+}
+
+// open opens a request of an approval step of the config
+func open(t *testing.T, manager *Manager, submitter string, config *stepconfig.ApprovalConfig) *Request {
+	t.Helper()
+	policy, timeout, err := manager.policy(config)
+	require.NoError(t, err)
+	request, err := manager.Open(context.Background(), &Request{
+		ExecutionID: uuid.New(),
+		Step:        "sign-off",
+		Submitter:   submitter,
+		Policy:      policy,
+	}, timeout)
+	require.NoError(t, err)
+	return request
+}
+
+func TestTwoOfTwo(t *testing.T) {
+	ctx := context.Background()
+	manager, _, publisher := newTestManager()
+
+	execution := &models.Execution{ID: uuid.New(), WorkflowID: uuid.New(), TriggerBy: "mallory"}
+	executor := NewExecutor(manager, executionStore{execution.ID: execution})
+	step := &models.WorkflowStep{
+		Name: "payment-release",
+		Type: "approval",
+		Config: map[string]interface{}{
+			"approvers":       []interface{}{"group:finance", "group:treasury"},
+			"required":        2,
+			"distinct_groups": true,
+			"message":         "Release the supplier payment run",
+		},
+	}
+	require.NoError(t, executor.Validate(step))
+
+	type result struct {
+		output map[string]interface{}
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := executor.Execute(engine.WithExecutionID(ctx, execution.ID), step, nil)
+		done <- result{output, err}
+	}()
+
+	var request *Request
+	require.Eventually(t, func() bool {
+		requests, err := manager.ForExecution(ctx, execution.ID)
+		require.NoError(t, err)
+		if len(requests) == 0 {
+			return false
+		}
+		request = requests[0]
+		return true
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "mallory", request.Submitter)
+	assert.Equal(t, execution.WorkflowID, request.WorkflowID)
+	assert.Equal(t, "payment-release", request.Step)
+	assert.Equal(t, []string{EventRequested}, publisher.types())
+
+	approved, err := manager.Approve(ctx, request.ID, "alice", "invoices checked")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, approved.Status)
+	assert.Equal(t, 1, approved.Remaining())
+
+	_, err = manager.Approve(ctx, request.ID, "bob", "")
+	assert.ErrorIs(t, err, ErrNotEligible, "finance already approved")
+	_, err = manager.Approve(ctx, request.ID, "alice", "")
+	assert.ErrorIs(t, err, ErrAlreadyApproved)
+	_, err = manager.Approve(ctx, request.ID, "erin", "")
+	assert.ErrorIs(t, err, ErrNotEligible, "controllers are not approvers of the step")
+
+	select {
+	case <-done:
+		t.Fatal("the step completed with one of two approvals")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	approved, err = manager.Approve(ctx, request.ID, "carol", "funds available")
+	require.NoError(t, err)
+	assert.Equal(t, StatusApproved, approved.Status)
+	require.NotNil(t, approved.CompletedAt)
+
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the step did not complete once approved")
+	}
+	require.NoError(t, r.err)
+	assert.Equal(t, []string{"alice", "carol"}, r.output["approved_by"])
+	approvals := r.output["approvals"].([]Approval)
+	require.Len(t, approvals, 2)
+	assert.Equal(t, "group:finance", approvals[0].Via)
+	assert.Equal(t, "invoices checked", approvals[0].Comment)
+	assert.Equal(t, "group:treasury", approvals[1].Via)
+
+	_, err = manager.Approve(ctx, request.ID, "dave", "")
+	assert.ErrorIs(t, err, ErrNotPending)
+}
+
+func TestSeparationOfDuties(t *testing.T) {
+	ctx := context.Background()
+	finance := stepconfig.ApprovalConfig{Approvers: []string{"group:finance"}}
+	tests := map[string]struct {
+		config   stepconfig.ApprovalConfig
+		delegate string
+		approver string
+		err      error
+	}{
+		"others approve":                              {config: finance, approver: "bob"},
+		"submitter cannot approve":                    {config: finance, approver: "alice", err: ErrSeparationOfDuties},
+		"submitter cannot approve through a delegate": {config: finance, delegate: "zed", approver: "zed", err: ErrNotEligible},
+		"policies may allow the submitter": {
+			config:   stepconfig.ApprovalConfig{Approvers: []string{"group:finance"}, AllowSubmitter: true},
+			approver: "alice",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager, clock, _ := newTestManager()
+			if tt.delegate != "" {
+				_, err := manager.Delegate(ctx, &Delegation{Delegate: tt.delegate, StartsAt: clock.Now(), EndsAt: clock.Now().Add(time.Hour)}, "alice")
+				require.NoError(t, err)
+			}
+			config := tt.config
+			request := open(t, manager, "alice", &config)
+
+			approved, err := manager.Approve(ctx, request.ID, tt.approver, "")
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, StatusApproved, approved.Status)
+		})
+	}
+}
+
+func TestDelegation(t *testing.T) {
+	ctx := context.Background()
+	manager, clock, _ := newTestManager()
+	config := &stepconfig.ApprovalConfig{Approvers: []string{"group:treasury", "role:controller"}, Required: 2}
+
+	_, err := manager.Delegate(ctx, &Delegation{Delegate: "dave", StartsAt: clock.Now(), EndsAt: clock.Now().Add(time.Hour)}, "dave")
+	assert.ErrorIs(t, err, ErrInvalidDelegation)
+
+	delegation, err := manager.Delegate(ctx, &Delegation{
+		Delegate: "zed",
+		StartsAt: clock.Now(),
+		EndsAt:   clock.Now().Add(2 * time.Hour),
+		Reason:   "annual leave",
+	}, "dave")
+	require.NoError(t, err)
+	assert.Equal(t, "dave", delegation.Delegator)
+
+	request := open(t, manager, "mallory", config)
+	approved, err := manager.Approve(ctx, request.ID, "zed", "approving for dave")
+	require.NoError(t, err)
+	require.Len(t, approved.Approvals, 1)
+	approval := approved.Approvals[0]
+	assert.Equal(t, "zed", approval.Approver)
+	assert.Equal(t, "dave", approval.OnBehalfOf)
+	assert.Equal(t, delegation.ID, *approval.DelegationID)
+	assert.Equal(t, "group:treasury", approval.Via)
+
+	_, err = manager.Approve(ctx, request.ID, "dave", "")
+	assert.ErrorIs(t, err, ErrAlreadyApproved, "the delegator was approved for")
+
+	// The delegation expires
+	clock.Advance(2 * time.Hour)
+	expired := open(t, manager, "mallory", config)
+	_, err = manager.Approve(ctx, expired.ID, "zed", "")
+	assert.ErrorIs(t, err, ErrNotEligible)
+	_, err = manager.Approve(ctx, expired.ID, "dave", "")
+	assert.NoError(t, err, "the delegator approves again once the delegation expired")
+
+	// Revoked delegations no longer apply but stay on record
+	revocable, err := manager.Delegate(ctx, &Delegation{Delegate: "zed", StartsAt: clock.Now(), EndsAt: clock.Now().Add(time.Hour)}, "erin")
+	require.NoError(t, err)
+	_, err = manager.RevokeDelegation(ctx, revocable.ID, "zed")
+	assert.ErrorIs(t, err, ErrInvalidDelegation, "only the delegator revokes")
+	revoked, err := manager.RevokeDelegation(ctx, revocable.ID, "erin")
+	require.NoError(t, err)
+	require.NotNil(t, revoked.RevokedAt)
+	_, err = manager.Approve(ctx, expired.ID, "zed", "")
+	assert.ErrorIs(t, err, ErrNotEligible)
+
+	delegations, err := manager.Delegations(ctx, "zed")
+	require.NoError(t, err)
+	assert.Len(t, delegations, 2)
+}
+
+func TestReminders(t *testing.T) {
+	ctx := context.Background()
+	manager, clock, publisher := newTestManager()
+	request := open(t, manager, "mallory", &stepconfig.ApprovalConfig{
+		Approvers: []string{"group:finance"},
+		Timeout:   "4h",
+		Reminders: []string{"30m", "2h"},
+	})
+	assert.Equal(t, []time.Duration{2 * time.Hour, 30 * time.Minute}, request.Policy.Reminders)
+	assert.Equal(t, opened.Add(4*time.Hour), request.ExpiresAt)
+
+	sweeps := []struct {
+		advance time.Duration
+		events  []string
+		reason  string
+	}{
+		{time.Hour, []string{EventRequested}, "no reminder is due"},
+		{time.Hour, []string{EventRequested, EventReminder}, "2h before the timeout"},
+		{time.Minute, []string{EventRequested, EventReminder}, "reminders are sent once"},
+		{89 * time.Minute, []string{EventRequested, EventReminder, EventReminder}, "30m before the timeout"},
+		{30 * time.Minute, []string{EventRequested, EventReminder, EventReminder, EventExpired}, "the timeout"},
+	}
+	for _, sweep := range sweeps {
+		clock.Advance(sweep.advance)
+		require.NoError(t, manager.Sweep(ctx))
+		assert.Equal(t, sweep.events, publisher.types(), sweep.reason)
+	}
+
+	reminder := publisher.events[2].data
+	assert.Equal(t, "30m0s", reminder["reminder"])
+	assert.Equal(t, "30m0s", reminder["expires_in"])
+	assert.Equal(t, []string{"group:finance"}, reminder["approvers"])
+
+	_, err := manager.Wait(ctx, request.ID)
+	assert.ErrorIs(t, err, ErrExpired)
+	_, err = manager.Approve(ctx, request.ID, "bob", "")
+	assert.ErrorIs(t, err, ErrNotPending)
+}
+
+func TestMissedReminders(t *testing.T) {
+	ctx := context.Background()
+	manager, clock, publisher := newTestManager()
+	open(t, manager, "mallory", &stepconfig.ApprovalConfig{
+		Approvers: []string{"group:finance"},
+		Timeout:   "4h",
+		Reminders: []string{"2h", "30m"},
+	})
+
+	// Only the last reminder due is sent
+	clock.Advance(3*time.Hour + 45*time.Minute)
+	require.NoError(t, manager.Sweep(ctx))
+	require.NoError(t, manager.Sweep(ctx))
+	assert.Equal(t, []string{EventRequested, EventReminder}, publisher.types())
+	assert.Equal(t, "30m0s", publisher.events[1].data["reminder"])
+}
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	tests := map[string]struct {
+		ctx     context.Context
+		timeout string
+		advance time.Duration
+		err     error
+		status  Status
+	}{
+		"waiting steps expire without a sweep": {ctx: ctx, timeout: "1h", advance: time.Hour, err: ErrExpired},
+		"cancelled steps cancel their request": {ctx: cancelled, err: context.Canceled, status: StatusCancelled},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager, clock, _ := newTestManager()
+			request := open(t, manager, "mallory", &stepconfig.ApprovalConfig{Approvers: []string{"group:finance"}, Timeout: tt.timeout})
+			clock.Advance(tt.advance)
+
+			_, err := manager.Wait(tt.ctx, request.ID)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.status != "" {
+				stored, err := manager.Get(ctx, request.ID)
+				require.NoError(t, err)
+				assert.Equal(t, tt.status, stored.Status)
+			}
+		})
+	}
+}
+
+func TestWaitGivesUpStepPoolSlot(t *testing.T) {
+	ctx := context.Background()
+	manager, _, _ := newTestManager()
+	execution := &models.Execution{ID: uuid.New(), WorkflowID: uuid.New(), TriggerBy: "mallory"}
+	executor := NewExecutor(manager, executionStore{execution.ID: execution})
+	step := &models.WorkflowStep{
+		Name:   "sign-off",
+		Type:   "approval",
+		Config: map[string]interface{}{"approvers": []interface{}{"group:finance"}},
+	}
+
+	// One slot for the steps of every execution
+	pool := dataflow.NewPool(1)
+	approval, err := dataflow.NewGraph([]dataflow.Step{{Name: "sign-off"}}, nil)
+	require.NoError(t, err)
+	waiting := dataflow.StartWithPool(engine.WithExecutionID(ctx, execution.ID), approval, 0, pool, func(ctx context.Context, name string) error {
+		_, err := executor.Execute(ctx, step, nil)
+		return err
+	})
+
+	var request *Request
+	require.Eventually(t, func() bool {
+		requests, err := manager.ForExecution(ctx, execution.ID)
+		require.NoError(t, err)
+		if len(requests) == 0 {
+			return false
+		}
+		request = requests[0]
+		return pool.Running() == 0
+	}, time.Second, time.Millisecond, "the waiting step gives up its slot")
+
+	shipping, err := dataflow.NewGraph([]dataflow.Step{{Name: "ship"}}, nil)
+	require.NoError(t, err)
+	other := dataflow.StartWithPool(ctx, shipping, 0, pool, func(ctx context.Context, name string) error {
+		return nil
+	})
+	select {
+	case <-other.Done():
+	case <-time.After(time.Second):
+		t.Fatal("another execution waited for the approval")
+	}
+	assert.Equal(t, models.ExecutionStatusCompleted, other.Result().Status)
+
+	_, err = manager.Approve(ctx, request.ID, "alice", "")
+	require.NoError(t, err)
+	select {
+	case <-waiting.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the step did not complete once approved")
+	}
+	assert.Equal(t, models.ExecutionStatusCompleted, waiting.Result().Status)
+	assert.Zero(t, pool.Running())
+	assert.Equal(t, 1, pool.Peak())
+}
+
+func TestPolicy(t *testing.T) {
+	manager, _, _ := newTestManager()
+
+	policy, timeout, err := manager.policy(&stepconfig.ApprovalConfig{Approvers: []string{"user:alice"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, policy.Required)
+	assert.Equal(t, 24*time.Hour, timeout)
+
+	tests := map[string]struct {
+		config stepconfig.ApprovalConfig
+		err    string
+	}{
+		"no approvers":          {config: stepconfig.ApprovalConfig{}, err: "require approvers"},
+		"bare approver":         {config: stepconfig.ApprovalConfig{Approvers: []string{"alice"}}, err: `invalid approver "alice"`},
+		"empty group":           {config: stepconfig.ApprovalConfig{Approvers: []string{"group:"}}, err: `invalid approver "group:"`},
+		"too few groups":        {config: stepconfig.ApprovalConfig{Approvers: []string{"group:finance"}, Required: 2, DistinctGroups: true}, err: "distinct groups"},
+		"bad timeout":           {config: stepconfig.ApprovalConfig{Approvers: []string{"user:alice"}, Timeout: "soon"}, err: "invalid timeout"},
+		"reminder past timeout": {config: stepconfig.ApprovalConfig{Approvers: []string{"user:alice"}, Timeout: "1h", Reminders: []string{"2h"}}, err: "within the timeout"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := manager.policy(&tt.config)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager, clock, _ := newTestManager()
+	router := gin.New()
+	NewHandlers(manager).RegisterRoutes(router.Group("/api"))
+
+	request := func(method, path, user string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			var err error
+			payload, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if user != "" {
+			req.Header.Set("X-User-ID", user)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	approval := open(t, manager, "alice", &stepconfig.ApprovalConfig{Approvers: []string{"group:finance", "group:treasury"}, Required: 2, DistinctGroups: true})
+	approve := "/api/v1/approvals/" + approval.ID.String() + "/approve"
+
+	rejected := map[string]struct {
+		user string
+		code int
+	}{
+		"anonymous":    {code: http.StatusUnauthorized},
+		"submitter":    {user: "alice", code: http.StatusForbidden},
+		"not approver": {user: "erin", code: http.StatusForbidden},
+	}
+	for name, tt := range rejected {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.code, request(http.MethodPost, approve, tt.user, nil).Code)
+		})
+	}
+
+	rec := request(http.MethodPost, approve, "bob", ApproveRequest{Comment: "looks right"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, http.StatusConflict, request(http.MethodPost, approve, "bob", nil).Code)
+
+	rec = request(http.MethodPost, "/api/v1/approvals/delegations", "carol", DelegationRequest{
+		Delegate: "zed",
+		StartsAt: clock.Now(),
+		EndsAt:   clock.Now().Add(time.Hour),
+		Reason:   "travelling",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var delegation Delegation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &delegation))
+	assert.Equal(t, "carol", delegation.Delegator)
+
+	rec = request(http.MethodPost, approve, "zed", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = request(http.MethodGet, "/api/v1/approvals?execution_id="+approval.ExecutionID.String(), "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var requests []Request
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &requests))
+	require.Len(t, requests, 1)
+	assert.Equal(t, StatusApproved, requests[0].Status)
+	require.Len(t, requests[0].Approvals, 2)
+	assert.Equal(t, "looks right", requests[0].Approvals[0].Comment)
+	assert.Equal(t, "carol", requests[0].Approvals[1].OnBehalfOf)
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/approvals/"+approval.ID.String(), "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/api/v1/approvals/"+uuid.NewString(), "", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/api/v1/approvals", "", nil).Code)
+
+	rec = request(http.MethodGet, "/api/v1/approvals/delegations", "zed", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var delegations []Delegation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &delegations))
+	assert.Len(t, delegations, 1)
+
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodDelete, "/api/v1/approvals/delegations/"+delegation.ID.String(), "zed", nil).Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodDelete, "/api/v1/approvals/delegations/"+delegation.ID.String(), "carol", nil).Code)
+}
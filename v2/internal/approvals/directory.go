@@ -0,0 +1,40 @@
+package approvals
+
+import (
+	"context"
+	"sort"
+)
+
+// Directory resolves the groups and roles of users through the RBAC layer.
+// StaticDirectory implements it from the configuration.
+type Directory interface {
+	// Memberships returns the group: and role: references of a user
+	Memberships(ctx context.Context, user string) ([]string, error)
+}
+
+// StaticDirectory is a Directory of configured groups and roles, mapped to
+// their members
+type StaticDirectory struct {
+	memberships map[string][]string
+}
+
+// NewStaticDirectory creates a directory of groups and roles
+func NewStaticDirectory(groups, roles map[string][]string) *StaticDirectory {
+	memberships := make(map[string][]string)
+	for prefix, members := range map[string]map[string][]string{GroupPrefix: groups, RolePrefix: roles} {
+		for name, users := range members {
+			for _, user := range users {
+				memberships[user] = append(memberships[user], prefix+name)
+			}
+		}
+	}
+	for _, references := range memberships {
+		sort.Strings(references)
+	}
+	return &StaticDirectory{memberships: memberships}
+}
+
+// Memberships returns the groups and roles of a user
+func (d *StaticDirectory) Memberships(ctx context.Context, user string) ([]string, error) {
+	return d.memberships[user], nil
+}
@@ -0,0 +1,186 @@
+package approvals
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+// ExecutionStore reads executions. It is implemented by
+// database.ExecutionRepository.
+type ExecutionStore interface {
+	GetByID(id uuid.UUID) (*models.Execution, error)
+}
+
+// Executor executes approval steps. The step waits until the approvals
+// required by its policy are recorded, and fails when it times out.
+type Executor struct {
+	manager    *Manager
+	executions ExecutionStore
+}
+
+// NewExecutor creates an approval executor reading the submitters of
+// executions from the store
+func NewExecutor(manager *Manager, executions ExecutionStore) *Executor {
+	return &Executor{manager: manager, executions: executions}
+}
+
+// Execute opens an approval request and waits for its approvals. The output
+// holds the ID of the request, its approvals and the approvers.
+func (e *Executor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
+	config, err := approvalConfig(ctx, step)
+	if err != nil {
+		return nil, err
+	}
+	policy, timeout, err := e.manager.policy(config)
+	if err != nil {
+		return nil, err
+	}
+
+	executionID, ok := engine.ExecutionIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("approval steps must run within an execution")
+	}
+	request := &Request{
+		ExecutionID: executionID,
+		Step:        step.Name,
+		Message:     config.Message,
+		Policy:      policy,
+	}
+	if workflow, ok := engine.WorkflowFromContext(ctx); ok {
+		request.WorkflowID = workflow.ID
+	}
+	execution, err := e.executions.GetByID(executionID)
+	switch {
+	case err == nil:
+		request.WorkflowID = execution.WorkflowID
+		request.Submitter = execution.TriggerBy
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, fmt.Errorf("failed to get the submitter of the execution: %w", err)
+	}
+
+	request, err = e.manager.Open(ctx, request, timeout)
+	if err != nil {
+		return nil, err
+	}
+	// Approvals take days at times: the step gives up its slot of the step
+	// pool while it waits, so that other executions keep running
+	err = dataflow.Idle(ctx, func() error {
+		var waitErr error
+		request, waitErr = e.manager.Wait(ctx, request.ID)
+		return waitErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	approvers := make([]string, len(request.Approvals))
+	for i, approval := range request.Approvals {
+		approvers[i] = approval.Approver
+	}
+	return map[string]interface{}{
+		"approval_id": request.ID.String(),
+		"approvals":   request.Approvals,
+		"approved_by": approvers,
+	}, nil
+}
+
+func (e *Executor) Validate(step *models.WorkflowStep) error {
+	if _, err := stepconfig.ApprovalSchema.Validate(stepconfig.Section("approval", step.Config), false); err != nil {
+		return err
+	}
+	config, err := approvalConfig(context.Background(), step)
+	if err != nil {
+		return err
+	}
+	_, _, err = e.manager.policy(config)
+	return err
+}
+
+func (e *Executor) GetType() string {
+	return "approval"
+}
+
+func (e *Executor) ConfigSchema() *stepconfig.Schema {
+	return stepconfig.ApprovalSchema
+}
+
+// approvalConfig returns the typed config the engine decoded for a step,
+// decoding the raw config when the step runs outside the engine
+func approvalConfig(ctx context.Context, step *models.WorkflowStep) (*stepconfig.ApprovalConfig, error) {
+	if typed, ok := engine.StepConfigFromContext(ctx); ok {
+		if config, ok := typed.(*stepconfig.ApprovalConfig); ok {
+			return config, nil
+		}
+		return nil, fmt.Errorf("invalid approval configuration")
+	}
+	typed, err := stepconfig.ApprovalSchema.Decode(stepconfig.Section("approval", step.Config))
+	if err != nil {
+		return nil, err
+	}
+	return typed.(*stepconfig.ApprovalConfig), nil
+}
+
+// policy returns the approval policy and the timeout of an approval step
+func (m *Manager) policy(config *stepconfig.ApprovalConfig) (Policy, time.Duration, error) {
+	policy := Policy{
+		Approvers:      config.Approvers,
+		Required:       config.Required,
+		DistinctGroups: config.DistinctGroups,
+		AllowSubmitter: config.AllowSubmitter,
+	}
+	if len(policy.Approvers) == 0 {
+		return Policy{}, 0, fmt.Errorf("approval steps require approvers")
+	}
+	for _, approver := range policy.Approvers {
+		if !validReference(approver) {
+			return Policy{}, 0, fmt.Errorf("invalid approver %q: must be a user:, group: or role: reference", approver)
+		}
+	}
+	if policy.Required == 0 {
+		policy.Required = 1
+	}
+	if policy.Required < 0 {
+		return Policy{}, 0, fmt.Errorf("invalid required approvals %d: must be positive", policy.Required)
+	}
+	if policy.DistinctGroups && policy.Required > len(policy.Approvers) {
+		return Policy{}, 0, fmt.Errorf("%d approvals from distinct groups cannot be given by %d approver references", policy.Required, len(policy.Approvers))
+	}
+
+	timeout := m.config.Timeout
+	if config.Timeout != "" {
+		parsed, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return Policy{}, 0, fmt.Errorf("invalid timeout %q: %w", config.Timeout, err)
+		}
+		timeout = parsed
+	}
+	if timeout <= 0 {
+		return Policy{}, 0, fmt.Errorf("invalid timeout %q: must be positive", config.Timeout)
+	}
+
+	for _, value := range config.Reminders {
+		reminder, err := time.ParseDuration(value)
+		if err != nil {
+			return Policy{}, 0, fmt.Errorf("invalid reminder %q: %w", value, err)
+		}
+		if reminder <= 0 || reminder >= timeout {
+			return Policy{}, 0, fmt.Errorf("invalid reminder %q: must be within the timeout of %s", value, timeout)
+		}
+		policy.Reminders = append(policy.Reminders, reminder)
+	}
+	sort.Slice(policy.Reminders, func(i, j int) bool {
+		return policy.Reminders[i] > policy.Reminders[j]
+	})
+	return policy, timeout, nil
+}
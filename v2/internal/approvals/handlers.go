@@ -0,0 +1,247 @@
+package approvals
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Handlers provides HTTP handlers for approvals
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new approval handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers approval routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		approvals := v1.Group("/approvals")
+		{
+			approvals.GET("", h.ListApprovals)
+			approvals.GET("/:id", h.GetApproval)
+			approvals.POST("/:id/approve", h.Approve)
+
+			approvals.POST("/delegations", h.CreateDelegation)
+			approvals.GET("/delegations", h.ListDelegations)
+			approvals.DELETE("/delegations/:id", h.RevokeDelegation)
+		}
+	}
+}
+
+// ListApprovals returns the approval state of an execution
+// @Summary List the approvals of an execution
+// @Description Returns the approval requests of the approval steps of an execution, with their policy, status and recorded approvals.
+// @Tags approvals
+// @Produce json
+// @Param execution_id query string true "Execution ID"
+// @Success 200 {array} Request
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/approvals [get]
+func (h *Handlers) ListApprovals(c *gin.Context) {
+	executionID, err := uuid.Parse(c.Query("execution_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution ID"})
+		return
+	}
+
+	requests, err := h.manager.ForExecution(c.Request.Context(), executionID)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// GetApproval returns an approval request
+// @Summary Get approval request
+// @Tags approvals
+// @Produce json
+// @Param id path string true "Approval request ID"
+// @Success 200 {object} Request
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/approvals/{id} [get]
+func (h *Handlers) GetApproval(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approval request ID"})
+		return
+	}
+
+	request, err := h.manager.Get(c.Request.Context(), id)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// ApproveRequest is the request body of an approval
+type ApproveRequest struct {
+	Comment string `json:"comment"`
+}
+
+// Approve records the approval of the user of the request
+// @Summary Approve approval request
+// @Description Records the approval of the user of the request, for themselves or on behalf of a delegator. The approval step completes once its policy is satisfied.
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Param id path string true "Approval request ID"
+// @Param request body ApproveRequest false "Approval"
+// @Success 200 {object} Request
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/approvals/{id}/approve [post]
+func (h *Handlers) Approve(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approval request ID"})
+		return
+	}
+	approver := c.GetHeader("X-User-ID")
+	if approver == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "the approver is required in the X-User-ID header"})
+		return
+	}
+
+	var req ApproveRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	request, err := h.manager.Approve(c.Request.Context(), id, approver, req.Comment)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// DelegationRequest is the request body of a delegation
+type DelegationRequest struct {
+	Delegate string    `json:"delegate" binding:"required"`
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+	Reason   string    `json:"reason"`
+}
+
+// CreateDelegation delegates the approvals of the user of the request
+// @Summary Delegate approvals
+// @Description Lets the delegate approve on behalf of the user of the request during a window, for the approval steps the user is eligible for.
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Param request body DelegationRequest true "Delegation"
+// @Success 201 {object} Delegation
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /api/v1/approvals/delegations [post]
+func (h *Handlers) CreateDelegation(c *gin.Context) {
+	delegator := c.GetHeader("X-User-ID")
+	if delegator == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "the delegator is required in the X-User-ID header"})
+		return
+	}
+
+	var req DelegationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	delegation, err := h.manager.Delegate(c.Request.Context(), &Delegation{
+		Delegate: req.Delegate,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		Reason:   req.Reason,
+	}, delegator)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, delegation)
+}
+
+// ListDelegations returns the delegations the user of the request gave or
+// received, revoked ones included
+// @Summary List approval delegations
+// @Tags approvals
+// @Produce json
+// @Success 200 {array} Delegation
+// @Failure 401 {object} map[string]interface{}
+// @Router /api/v1/approvals/delegations [get]
+func (h *Handlers) ListDelegations(c *gin.Context) {
+	user := c.GetHeader("X-User-ID")
+	if user == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "the user is required in the X-User-ID header"})
+		return
+	}
+
+	delegations, err := h.manager.Delegations(c.Request.Context(), user)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, delegations)
+}
+
+// RevokeDelegation revokes a delegation of the user of the request
+// @Summary Revoke approval delegation
+// @Tags approvals
+// @Produce json
+// @Param id path string true "Delegation ID"
+// @Success 200 {object} Delegation
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/approvals/delegations/{id} [delete]
+func (h *Handlers) RevokeDelegation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delegation ID"})
+		return
+	}
+
+	delegation, err := h.manager.RevokeDelegation(c.Request.Context(), id, c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, delegation)
+}
+
+func (h *Handlers) errorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotEligible), errors.Is(err, ErrSeparationOfDuties):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAlreadyApproved), errors.Is(err, ErrNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidDelegation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,492 @@
+package approvals
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultPollInterval = time.Second
+
+// errNoReminder tells that no reminder is due for a request
+var errNoReminder = errors.New("no reminder due")
+
+// EventPublisher publishes events to the engine event handlers, which
+// deliver them to the webhooks and notifications subscribed to their type.
+// The engine implements it.
+type EventPublisher interface {
+	PublishEvent(eventType string, workflowID uuid.UUID, data map[string]interface{})
+}
+
+// Manager opens the approval requests of approval steps, records their
+// approvals and sends their reminders
+type Manager struct {
+	config       Config
+	store        Store
+	directory    Directory
+	publisher    EventPublisher
+	logger       *logrus.Logger
+	now          func() time.Time
+	pollInterval time.Duration
+
+	// mu serializes the changes of requests, so that concurrent approvals
+	// are counted against each other
+	mu sync.Mutex
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager creates an approval manager resolving approvers through the
+// directory. The publisher may be nil, in which case no notification is
+// sent.
+func NewManager(config Config, store Store, directory Directory, publisher EventPublisher, logger *logrus.Logger) *Manager {
+	return &Manager{
+		config:       config,
+		store:        store,
+		directory:    directory,
+		publisher:    publisher,
+		logger:       logger,
+		now:          time.Now,
+		pollInterval: defaultPollInterval,
+	}
+}
+
+// Open stores a pending request expiring after the timeout and notifies its
+// approvers
+func (m *Manager) Open(ctx context.Context, request *Request, timeout time.Duration) (*Request, error) {
+	now := m.now().UTC()
+	request.ID = uuid.New()
+	request.Status = StatusPending
+	request.Approvals = []Approval{}
+	request.ExpiresAt = now.Add(timeout)
+	request.CreatedAt = now
+	if err := m.store.Create(ctx, request); err != nil {
+		return nil, fmt.Errorf("failed to store approval request: %w", err)
+	}
+
+	m.publish(EventRequested, request, nil)
+	m.requestLogger(request).WithField("expires_at", request.ExpiresAt).Info("Approval requested")
+	return request, nil
+}
+
+// Wait waits until a request is approved, returning ErrExpired once it
+// times out and ErrCancelled when it was cancelled. The request is
+// cancelled when ctx is done.
+func (m *Manager) Wait(ctx context.Context, id uuid.UUID) (*Request, error) {
+	for {
+		request, err := m.store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if request.Status == StatusPending && !m.now().Before(request.ExpiresAt) {
+			if request, err = m.expire(ctx, id); err != nil && !errors.Is(err, ErrNotPending) {
+				return nil, err
+			}
+		}
+
+		switch request.Status {
+		case StatusApproved:
+			return request, nil
+		case StatusExpired:
+			return request, fmt.Errorf("%w: %d of %d approvals recorded", ErrExpired, len(request.Approvals), request.Policy.Required)
+		case StatusCancelled:
+			return request, ErrCancelled
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := m.Cancel(context.Background(), id); err != nil && !errors.Is(err, ErrNotPending) {
+				m.logger.WithError(err).WithField("approval_id", id).Error("Failed to cancel approval request")
+			}
+			return nil, ctx.Err()
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// Approve records the approval of a request by a user, for themselves when
+// the policy makes them eligible, else on behalf of a delegator of an
+// active delegation. The request is approved once the policy is satisfied.
+func (m *Manager) Approve(ctx context.Context, id uuid.UUID, approver, comment string) (*Request, error) {
+	now := m.now().UTC()
+	var approval *Approval
+	request, err := m.update(ctx, id, func(request *Request) error {
+		if !now.Before(request.ExpiresAt) {
+			return fmt.Errorf("%w: it expired at %s", ErrNotPending, request.ExpiresAt.Format(time.RFC3339))
+		}
+
+		var err error
+		approval, err = m.eligible(ctx, request, approver, now)
+		if err != nil {
+			return err
+		}
+		approval.Comment = comment
+		approval.ApprovedAt = now
+		request.Approvals = append(request.Approvals, *approval)
+		if request.Remaining() == 0 {
+			request.Status = StatusApproved
+			request.CompletedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger := m.requestLogger(request).WithFields(logrus.Fields{
+		"approver":  approval.Approver,
+		"via":       approval.Via,
+		"remaining": request.Remaining(),
+	})
+	if approval.OnBehalfOf != "" {
+		logger = logger.WithFields(logrus.Fields{
+			"on_behalf_of":  approval.OnBehalfOf,
+			"delegation_id": *approval.DelegationID,
+		})
+	}
+	logger.Info("Approval recorded")
+	return request, nil
+}
+
+// eligible returns the approval a user may give on a request
+func (m *Manager) eligible(ctx context.Context, request *Request, user string, at time.Time) (*Approval, error) {
+	policy := request.Policy
+	switch {
+	case user == "":
+		return nil, fmt.Errorf("%w: the approver is unknown", ErrNotEligible)
+	case !policy.AllowSubmitter && user == request.Submitter:
+		return nil, ErrSeparationOfDuties
+	case request.approvedBy(user):
+		return nil, ErrAlreadyApproved
+	}
+
+	via, err := m.eligibleVia(ctx, request, user)
+	if err != nil {
+		return nil, err
+	}
+	if via != "" {
+		return &Approval{Approver: user, Via: via}, nil
+	}
+
+	delegations, err := m.store.DelegationsTo(ctx, user, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delegations: %w", err)
+	}
+	for _, delegation := range delegations {
+		delegator := delegation.Delegator
+		if request.approvedBy(delegator) || (!policy.AllowSubmitter && delegator == request.Submitter) {
+			continue
+		}
+		via, err := m.eligibleVia(ctx, request, delegator)
+		if err != nil {
+			return nil, err
+		}
+		if via != "" {
+			delegationID := delegation.ID
+			return &Approval{Approver: user, OnBehalfOf: delegator, DelegationID: &delegationID, Via: via}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s cannot approve for %s", ErrNotEligible, user, strings.Join(m.openReferences(request), ", "))
+}
+
+// eligibleVia returns the approver reference of the policy a user may
+// approve for, or "" when the user is not eligible. When approvals must
+// come from distinct groups, references already approved for are skipped.
+func (m *Manager) eligibleVia(ctx context.Context, request *Request, user string) (string, error) {
+	memberships, err := m.directory.Memberships(ctx, user)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the groups of %s: %w", user, err)
+	}
+	references := map[string]bool{UserPrefix + user: true}
+	for _, reference := range memberships {
+		references[reference] = true
+	}
+
+	for _, reference := range m.openReferences(request) {
+		if references[reference] {
+			return reference, nil
+		}
+	}
+	return "", nil
+}
+
+// openReferences returns the approver references approvals may still be
+// given for
+func (m *Manager) openReferences(request *Request) []string {
+	if !request.Policy.DistinctGroups {
+		return request.Policy.Approvers
+	}
+	var open []string
+	for _, reference := range request.Policy.Approvers {
+		if !request.usedVia(reference) {
+			open = append(open, reference)
+		}
+	}
+	return open
+}
+
+// Cancel cancels a pending request, failing the step waiting for it
+func (m *Manager) Cancel(ctx context.Context, id uuid.UUID) error {
+	now := m.now().UTC()
+	request, err := m.update(ctx, id, func(request *Request) error {
+		request.Status = StatusCancelled
+		request.CompletedAt = &now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.requestLogger(request).Info("Approval request cancelled")
+	return nil
+}
+
+// expire expires a pending request and notifies its approvers
+func (m *Manager) expire(ctx context.Context, id uuid.UUID) (*Request, error) {
+	now := m.now().UTC()
+	request, err := m.update(ctx, id, func(request *Request) error {
+		request.Status = StatusExpired
+		request.CompletedAt = &now
+		return nil
+	})
+	if err != nil {
+		return request, err
+	}
+
+	m.publish(EventExpired, request, nil)
+	m.requestLogger(request).WithField("approved", len(request.Approvals)).Warn("Approval request expired")
+	return request, nil
+}
+
+// remind sends the latest reminder due for a request, once. Earlier
+// reminders missed while no sweep ran are skipped.
+func (m *Manager) remind(ctx context.Context, id uuid.UUID, now time.Time) error {
+	var before time.Duration
+	request, err := m.update(ctx, id, func(request *Request) error {
+		reminders := request.Policy.Reminders
+		sent := request.RemindersSent
+		for sent < len(reminders) && !now.Before(request.ExpiresAt.Add(-reminders[sent])) {
+			sent++
+		}
+		if sent == request.RemindersSent {
+			return errNoReminder
+		}
+		request.RemindersSent = sent
+		before = reminders[sent-1]
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errNoReminder) {
+			return nil
+		}
+		return err
+	}
+
+	m.publish(EventReminder, request, map[string]interface{}{
+		"reminder":   before.String(),
+		"expires_in": request.ExpiresAt.Sub(now).String(),
+	})
+	m.requestLogger(request).WithField("reminder", before.String()).Info("Approval reminder sent")
+	return nil
+}
+
+// update applies a change to a pending request and saves it. Requests that
+// are no longer pending are returned with ErrNotPending.
+func (m *Manager) update(ctx context.Context, id uuid.UUID, change func(*Request) error) (*Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != StatusPending {
+		return request, fmt.Errorf("%w: it is %s", ErrNotPending, request.Status)
+	}
+	if err := change(request); err != nil {
+		return nil, err
+	}
+	if err := m.store.Save(ctx, request); err != nil {
+		return nil, fmt.Errorf("failed to store approval request: %w", err)
+	}
+	return request, nil
+}
+
+// Get returns a request
+func (m *Manager) Get(ctx context.Context, id uuid.UUID) (*Request, error) {
+	return m.store.Get(ctx, id)
+}
+
+// ForExecution returns the approval requests of an execution
+func (m *Manager) ForExecution(ctx context.Context, executionID uuid.UUID) ([]*Request, error) {
+	return m.store.ForExecution(ctx, executionID)
+}
+
+// ExecutionApprovals returns the approval requests of an execution for its
+// debug bundle
+func (m *Manager) ExecutionApprovals(ctx context.Context, executionID uuid.UUID) (interface{}, error) {
+	requests, err := m.store.ForExecution(ctx, executionID)
+	if err != nil {
+		return nil, err
+	}
+	if requests == nil {
+		requests = []*Request{}
+	}
+	return requests, nil
+}
+
+// Delegate stores a delegation of the approvals of the actor
+func (m *Manager) Delegate(ctx context.Context, delegation *Delegation, actor string) (*Delegation, error) {
+	now := m.now().UTC()
+	delegation.Delegator = actor
+	if err := delegation.validate(now); err != nil {
+		return nil, err
+	}
+	delegation.ID = uuid.New()
+	delegation.StartsAt = delegation.StartsAt.UTC()
+	delegation.EndsAt = delegation.EndsAt.UTC()
+	delegation.CreatedAt = now
+	if err := m.store.CreateDelegation(ctx, delegation); err != nil {
+		return nil, err
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"delegation_id": delegation.ID,
+		"delegator":     delegation.Delegator,
+		"delegate":      delegation.Delegate,
+		"starts_at":     delegation.StartsAt,
+		"ends_at":       delegation.EndsAt,
+		"reason":        delegation.Reason,
+	}).Info("Approval delegation created")
+	return delegation, nil
+}
+
+// RevokeDelegation ends a delegation before its window does. Only the
+// delegator may revoke it.
+func (m *Manager) RevokeDelegation(ctx context.Context, id uuid.UUID, actor string) (*Delegation, error) {
+	delegation, err := m.store.GetDelegation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if delegation.Delegator != actor {
+		return nil, fmt.Errorf("%w: only the delegator may revoke it", ErrInvalidDelegation)
+	}
+	if delegation.RevokedAt != nil {
+		return delegation, nil
+	}
+
+	now := m.now().UTC()
+	delegation.RevokedAt = &now
+	delegation.RevokedBy = actor
+	if err := m.store.SaveDelegation(ctx, delegation); err != nil {
+		return nil, err
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"delegation_id": delegation.ID,
+		"delegator":     delegation.Delegator,
+		"delegate":      delegation.Delegate,
+	}).Info("Approval delegation revoked")
+	return delegation, nil
+}
+
+// Delegations returns the delegations a user gave or received
+func (m *Manager) Delegations(ctx context.Context, user string) ([]*Delegation, error) {
+	return m.store.Delegations(ctx, user)
+}
+
+// Sweep sends the reminders due and expires the requests past their
+// timeout
+func (m *Manager) Sweep(ctx context.Context) error {
+	pending, err := m.store.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := m.now()
+	for _, request := range pending {
+		if !now.Before(request.ExpiresAt) {
+			_, err = m.expire(ctx, request.ID)
+		} else {
+			err = m.remind(ctx, request.ID, now)
+		}
+		if err != nil && !errors.Is(err, ErrNotPending) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start sweeps requests at the configured interval until Stop is called
+func (m *Manager) Start(ctx context.Context) {
+	m.stopCh = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.config.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Sweep(ctx); err != nil {
+					m.logger.WithError(err).Error("Failed to sweep approval requests")
+				}
+			case <-m.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops sweeping requests
+func (m *Manager) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.stopCh = nil
+}
+
+// publish notifies the approvers of a request through the routes of an
+// event type
+func (m *Manager) publish(eventType string, request *Request, extra map[string]interface{}) {
+	if m.publisher == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"approval_id":  request.ID,
+		"execution_id": request.ExecutionID,
+		"step":         request.Step,
+		"message":      request.Message,
+		"approvers":    request.Policy.Approvers,
+		"required":     request.Policy.Required,
+		"approved":     len(request.Approvals),
+		"remaining":    request.Remaining(),
+		"expires_at":   request.ExpiresAt,
+		"submitter":    request.Submitter,
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+	m.publisher.PublishEvent(eventType, request.WorkflowID, data)
+}
+
+func (m *Manager) requestLogger(request *Request) *logrus.Entry {
+	return m.logger.WithFields(logrus.Fields{
+		"approval_id":  request.ID,
+		"execution_id": request.ExecutionID,
+		"step":         request.Step,
+	})
+}
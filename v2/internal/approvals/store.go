@@ -0,0 +1,260 @@
+package approvals
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store persists approval requests and delegations. Get and GetDelegation
+// return gorm.ErrRecordNotFound for unknown records.
+type Store interface {
+	Create(ctx context.Context, request *Request) error
+	Get(ctx context.Context, id uuid.UUID) (*Request, error)
+	Save(ctx context.Context, request *Request) error
+	// ForExecution returns the requests of an execution, oldest first
+	ForExecution(ctx context.Context, executionID uuid.UUID) ([]*Request, error)
+	// Pending returns the pending requests, oldest first
+	Pending(ctx context.Context) ([]*Request, error)
+
+	CreateDelegation(ctx context.Context, delegation *Delegation) error
+	GetDelegation(ctx context.Context, id uuid.UUID) (*Delegation, error)
+	SaveDelegation(ctx context.Context, delegation *Delegation) error
+	// Delegations returns the delegations a user gave or received, oldest
+	// first
+	Delegations(ctx context.Context, user string) ([]*Delegation, error)
+	// DelegationsTo returns the delegations a user received active at a
+	// time, oldest first
+	DelegationsTo(ctx context.Context, delegate string, at time.Time) ([]*Delegation, error)
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu          sync.Mutex
+	requests    map[uuid.UUID]*Request
+	delegations map[uuid.UUID]*Delegation
+}
+
+// NewMemoryStore creates an in-memory approval store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		requests:    make(map[uuid.UUID]*Request),
+		delegations: make(map[uuid.UUID]*Delegation),
+	}
+}
+
+// Create stores a request
+func (s *MemoryStore) Create(ctx context.Context, request *Request) error {
+	return s.Save(ctx, request)
+}
+
+// Get returns a request
+func (s *MemoryStore) Get(ctx context.Context, id uuid.UUID) (*Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return copyRequest(request), nil
+}
+
+// Save stores the new state of a request
+func (s *MemoryStore) Save(ctx context.Context, request *Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[request.ID] = copyRequest(request)
+	return nil
+}
+
+// ForExecution returns the requests of an execution
+func (s *MemoryStore) ForExecution(ctx context.Context, executionID uuid.UUID) ([]*Request, error) {
+	return s.filter(func(r *Request) bool { return r.ExecutionID == executionID }), nil
+}
+
+// Pending returns the pending requests
+func (s *MemoryStore) Pending(ctx context.Context) ([]*Request, error) {
+	return s.filter(func(r *Request) bool { return r.Status == StatusPending }), nil
+}
+
+// CreateDelegation stores a delegation
+func (s *MemoryStore) CreateDelegation(ctx context.Context, delegation *Delegation) error {
+	return s.SaveDelegation(ctx, delegation)
+}
+
+// GetDelegation returns a delegation
+func (s *MemoryStore) GetDelegation(ctx context.Context, id uuid.UUID) (*Delegation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delegation, ok := s.delegations[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	stored := *delegation
+	return &stored, nil
+}
+
+// SaveDelegation stores the new state of a delegation
+func (s *MemoryStore) SaveDelegation(ctx context.Context, delegation *Delegation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *delegation
+	s.delegations[delegation.ID] = &stored
+	return nil
+}
+
+// Delegations returns the delegations a user gave or received
+func (s *MemoryStore) Delegations(ctx context.Context, user string) ([]*Delegation, error) {
+	return s.filterDelegations(func(d *Delegation) bool {
+		return d.Delegator == user || d.Delegate == user
+	}), nil
+}
+
+// DelegationsTo returns the active delegations a user received
+func (s *MemoryStore) DelegationsTo(ctx context.Context, delegate string, at time.Time) ([]*Delegation, error) {
+	return s.filterDelegations(func(d *Delegation) bool {
+		return d.Delegate == delegate && d.ActiveAt(at)
+	}), nil
+}
+
+func (s *MemoryStore) filter(keep func(*Request) bool) []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requests []*Request
+	for _, request := range s.requests {
+		if keep(request) {
+			requests = append(requests, copyRequest(request))
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests
+}
+
+func (s *MemoryStore) filterDelegations(keep func(*Delegation) bool) []*Delegation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var delegations []*Delegation
+	for _, delegation := range s.delegations {
+		if keep(delegation) {
+			stored := *delegation
+			delegations = append(delegations, &stored)
+		}
+	}
+	sort.Slice(delegations, func(i, j int) bool {
+		return delegations[i].CreatedAt.Before(delegations[j].CreatedAt)
+	})
+	return delegations
+}
+
+func copyRequest(request *Request) *Request {
+	stored := *request
+	stored.Approvals = append([]Approval(nil), request.Approvals...)
+	return &stored
+}
+
+// GormStore keeps requests in the approval_requests table, with their policy
+// and approvals as JSON columns, and delegations in the approval_delegations
+// table, revoked ones included
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database approval store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the approval tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Request{}, &Delegation{})
+}
+
+// Create stores a request
+func (s *GormStore) Create(ctx context.Context, request *Request) error {
+	return s.db.WithContext(ctx).Create(request).Error
+}
+
+// Get returns a request
+func (s *GormStore) Get(ctx context.Context, id uuid.UUID) (*Request, error) {
+	var request Request
+	if err := s.db.WithContext(ctx).First(&request, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// Save stores the new state of a request
+func (s *GormStore) Save(ctx context.Context, request *Request) error {
+	return s.db.WithContext(ctx).Save(request).Error
+}
+
+// ForExecution returns the requests of an execution
+func (s *GormStore) ForExecution(ctx context.Context, executionID uuid.UUID) ([]*Request, error) {
+	var requests []*Request
+	err := s.db.WithContext(ctx).
+		Where("execution_id = ?", executionID).
+		Order("created_at").
+		Find(&requests).Error
+	return requests, err
+}
+
+// Pending returns the pending requests
+func (s *GormStore) Pending(ctx context.Context) ([]*Request, error) {
+	var requests []*Request
+	err := s.db.WithContext(ctx).
+		Where("status = ?", StatusPending).
+		Order("created_at").
+		Find(&requests).Error
+	return requests, err
+}
+
+// CreateDelegation stores a delegation
+func (s *GormStore) CreateDelegation(ctx context.Context, delegation *Delegation) error {
+	return s.db.WithContext(ctx).Create(delegation).Error
+}
+
+// GetDelegation returns a delegation
+func (s *GormStore) GetDelegation(ctx context.Context, id uuid.UUID) (*Delegation, error) {
+	var delegation Delegation
+	if err := s.db.WithContext(ctx).First(&delegation, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &delegation, nil
+}
+
+// SaveDelegation stores the new state of a delegation
+func (s *GormStore) SaveDelegation(ctx context.Context, delegation *Delegation) error {
+	return s.db.WithContext(ctx).Save(delegation).Error
+}
+
+// Delegations returns the delegations a user gave or received
+func (s *GormStore) Delegations(ctx context.Context, user string) ([]*Delegation, error) {
+	var delegations []*Delegation
+	err := s.db.WithContext(ctx).
+		Where("delegator = ? OR delegate = ?", user, user).
+		Order("created_at").
+		Find(&delegations).Error
+	return delegations, err
+}
+
+// DelegationsTo returns the active delegations a user received
+func (s *GormStore) DelegationsTo(ctx context.Context, delegate string, at time.Time) ([]*Delegation, error) {
+	var delegations []*Delegation
+	err := s.db.WithContext(ctx).
+		Where("delegate = ? AND revoked_at IS NULL AND starts_at <= ? AND ends_at > ?", delegate, at, at).
+		Order("created_at").
+		Find(&delegations).Error
+	return delegations, err
+}
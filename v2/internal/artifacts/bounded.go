@@ -0,0 +1,51 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTooLarge is returned when opening an artifact larger than the reader
+// of its content accepts
+var ErrTooLarge = errors.New("artifact too large")
+
+// boundedContent is the content of an artifact read up to a size known when
+// it was opened
+type boundedContent struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// OpenBounded opens an artifact for random access, failing with ErrTooLarge
+// when it holds more than limit bytes, so readers consuming it, such as a
+// table parser or a script, cannot be fed more than they accept. A limit of
+// 0 accepts any size.
+func OpenBounded(ctx context.Context, store Store, ref string, limit int64) (Content, error) {
+	content, err := store.OpenAt(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	size := content.Size()
+	if limit > 0 && size > limit {
+		content.Close()
+		return nil, fmt.Errorf("%w: %s holds %d bytes, more than the limit of %d", ErrTooLarge, ref, size, limit)
+	}
+	return &boundedContent{SectionReader: io.NewSectionReader(content, 0, size), Closer: content}, nil
+}
+
+// ReadAll reads the content of an artifact holding at most limit bytes
+func ReadAll(ctx context.Context, store Store, ref string, limit int64) ([]byte, error) {
+	content, err := OpenBounded(ctx, store, ref, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact %s: %w", ref, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,119 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+)
+
+// RefKey is the key of the artifact reference in reference objects
+const RefKey = "$artifact"
+
+// Reference is an artifact standing for a value of a JSON document, such
+// as a base64 string of an execution input extracted into an artifact.
+// Documents hold it as a reference object:
+//
+//	{"$artifact": "artifact://<id>/<name>", "content_type": "application/pdf", "size": 1024, "sha256": "..."}
+type Reference struct {
+	Ref         string `json:"$artifact"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+	// Encoding is how the value was encoded before it was extracted,
+	// restoring it when it is inlined again
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Object returns the reference object of a reference
+func (r Reference) Object() map[string]interface{} {
+	object := map[string]interface{}{
+		RefKey: r.Ref,
+		"size": r.Size,
+	}
+	if r.ContentType != "" {
+		object["content_type"] = r.ContentType
+	}
+	if r.SHA256 != "" {
+		object["sha256"] = r.SHA256
+	}
+	if r.Encoding != "" {
+		object["encoding"] = r.Encoding
+	}
+	return object
+}
+
+// AsReference returns the reference of a reference object, whether built by
+// Object or decoded from JSON
+func AsReference(value interface{}) (Reference, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return Reference{}, false
+	}
+	ref, ok := object[RefKey].(string)
+	if !ok || !IsRef(ref) {
+		return Reference{}, false
+	}
+
+	reference := Reference{Ref: ref}
+	reference.ContentType, _ = object["content_type"].(string)
+	reference.SHA256, _ = object["sha256"].(string)
+	reference.Encoding, _ = object["encoding"].(string)
+	switch size := object["size"].(type) {
+	case int64:
+		reference.Size = size
+	case int:
+		reference.Size = int64(size)
+	case float64:
+		reference.Size = int64(size)
+	}
+	return reference, true
+}
+
+// RefOf returns the artifact reference a value holds, as a reference
+// string or a reference object
+func RefOf(value interface{}) (string, bool) {
+	if ref, ok := value.(string); ok && IsRef(ref) {
+		return ref, true
+	}
+	if reference, ok := AsReference(value); ok {
+		return reference.Ref, true
+	}
+	return "", false
+}
+
+// Describe returns the reference of a reference string or object. The size,
+// checksum and content type of reference strings, and of reference objects
+// declaring no content type, are those of the artifact.
+func Describe(ctx context.Context, store Store, value interface{}) (Reference, error) {
+	ref, ok := RefOf(value)
+	if !ok {
+		return Reference{}, fmt.Errorf("%w: %v is not an artifact reference", ErrInvalidRef, value)
+	}
+	reference, ok := AsReference(value)
+	if ok && reference.ContentType != "" {
+		return reference, nil
+	}
+	info, err := store.Stat(ctx, ref)
+	if err != nil {
+		return Reference{}, err
+	}
+	reference.Ref = ref
+	reference.Size = info.Size
+	reference.SHA256 = info.SHA256
+	reference.ContentType = info.ContentType
+	return reference, nil
+}
+
+// OpenReference opens the artifact of a reference string or object for
+// random access, describing it as a reference. Executors use it on the
+// values of their input standing for binaries.
+func OpenReference(ctx context.Context, store Store, value interface{}) (Content, Reference, error) {
+	reference, err := Describe(ctx, store, value)
+	if err != nil {
+		return nil, Reference{}, err
+	}
+	content, err := store.OpenAt(ctx, reference.Ref)
+	if err != nil {
+		return nil, Reference{}, err
+	}
+	return content, reference, nil
+}
@@ -0,0 +1,302 @@
+// Package artifacts stores the large payloads steps produce or consume,
+// such as parsed tables, outside of execution variables. Steps pass them
+// around as artifact://<id>/<name> references.
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Scheme prefixes artifact references
+const Scheme = "artifact://"
+
+var (
+	// ErrNotFound is returned when opening an artifact that does not exist
+	ErrNotFound = errors.New("artifact not found")
+	// ErrInvalidRef is returned for malformed artifact references
+	ErrInvalidRef = errors.New("invalid artifact reference")
+)
+
+// infoFile is the file holding the Info of an artifact, next to its content
+const infoFile = ".info.json"
+
+// scratchDir is the directory of the store holding the scratch areas of
+// executions. References never address it, their first segment being an
+// artifact ID.
+const scratchDir = "scratch"
+
+// Info describes the content of an artifact
+type Info struct {
+	Ref  string `json:"ref"`
+	Size int64  `json:"size"`
+	// SHA256 is the hex encoded checksum of the content, computed while it
+	// was written. It is empty for artifacts written without one.
+	SHA256 string `json:"sha256,omitempty"`
+	// ContentType is the media type declared for the content, empty when
+	// none was
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// Writer writes the content of a new artifact. The artifact can be opened
+// once the writer is closed.
+type Writer interface {
+	io.WriteCloser
+	// Ref returns the reference of the artifact
+	Ref() string
+	// Info returns the size and checksum of the content written so far,
+	// those of the artifact once the writer is closed
+	Info() Info
+	// Discard abandons the artifact instead of closing the writer
+	Discard() error
+	// SetContentType declares the media type of the content, recorded when
+	// the writer is closed
+	SetContentType(contentType string)
+}
+
+// Content is the content of an artifact, read in sequence or at any offset
+// without loading it, such as by a request body retried from the start
+type Content interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	// Size returns the size of the content in bytes
+	Size() int64
+}
+
+// Store stores artifacts
+type Store interface {
+	// Create creates an artifact. name is a file name describing the
+	// content, such as rows.json.
+	Create(ctx context.Context, name string) (Writer, error)
+	// Put streams the content of a reader into a new artifact, returning
+	// its reference, size and checksum
+	Put(ctx context.Context, name string, r io.Reader) (Info, error)
+	// Open opens the content of an artifact
+	Open(ctx context.Context, ref string) (io.ReadCloser, error)
+	// OpenAt opens the content of an artifact for random access
+	OpenAt(ctx context.Context, ref string) (Content, error)
+	// Stat returns the size and checksum of an artifact
+	Stat(ctx context.Context, ref string) (Info, error)
+}
+
+// IsRef reports whether a value is an artifact reference
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, Scheme)
+}
+
+// FileStore stores artifacts as files of a directory. The files it opens
+// are *os.File, so readers needing random access, such as xlsx parsing, do
+// not have to copy them.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a store keeping artifacts in dir, creating it if
+// needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// ScratchDir returns the directory of the scratch areas of executions
+// within the store, out of reach of artifact references
+func (s *FileStore) ScratchDir() string {
+	return filepath.Join(s.dir, scratchDir)
+}
+
+// Create creates an artifact, written to a temporary file renamed into
+// place when the writer is closed
+func (s *FileStore) Create(ctx context.Context, name string) (Writer, error) {
+	name = filepath.Base(name)
+	if name == "." || name == string(filepath.Separator) || name == infoFile {
+		return nil, fmt.Errorf("invalid artifact name %q", name)
+	}
+
+	id := uuid.New().String()
+	if err := os.MkdirAll(filepath.Join(s.dir, id), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Join(s.dir, id), ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact: %w", err)
+	}
+	return &fileWriter{
+		file: file,
+		hash: sha256.New(),
+		path: filepath.Join(s.dir, id, name),
+		ref:  Scheme + id + "/" + name,
+	}, nil
+}
+
+// Put streams the content of a reader into a new artifact, discarding the
+// artifact when the reader fails
+func (s *FileStore) Put(ctx context.Context, name string, r io.Reader) (Info, error) {
+	return PutTyped(ctx, s, name, "", r)
+}
+
+// PutTyped streams the content of a reader into a new artifact of a
+// declared media type, discarding the artifact when the reader fails
+func PutTyped(ctx context.Context, store Store, name, contentType string, r io.Reader) (Info, error) {
+	writer, err := store.Create(ctx, name)
+	if err != nil {
+		return Info{}, err
+	}
+	writer.SetContentType(contentType)
+	if _, err := io.Copy(writer, r); err != nil {
+		writer.Discard()
+		return Info{}, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return Info{}, err
+	}
+	return writer.Info(), nil
+}
+
+// Open opens an artifact
+func (s *FileStore) Open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	return s.OpenAt(ctx, ref)
+}
+
+// OpenAt opens an artifact for random access
+func (s *FileStore) OpenAt(ctx context.Context, ref string) (Content, error) {
+	path, err := s.path(ref)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact %s: %w", ref, err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open artifact %s: %w", ref, err)
+	}
+	return &fileContent{File: file, size: stat.Size()}, nil
+}
+
+// Stat returns the size and checksum of an artifact. Artifacts written
+// before checksums were recorded have their size only.
+func (s *FileStore) Stat(ctx context.Context, ref string) (Info, error) {
+	path, err := s.path(ref)
+	if err != nil {
+		return Info{}, err
+	}
+	stat, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Info{}, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to stat artifact %s: %w", ref, err)
+	}
+
+	info := Info{Ref: ref, Size: stat.Size()}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), infoFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return info, nil
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to stat artifact %s: %w", ref, err)
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return Info{}, fmt.Errorf("failed to stat artifact %s: %w", ref, err)
+	}
+	return info, nil
+}
+
+// path returns the file of a reference, rejecting references escaping the
+// store directory
+func (s *FileStore) path(ref string) (string, error) {
+	if !IsRef(ref) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRef, ref)
+	}
+	parts := strings.Split(strings.TrimPrefix(ref, Scheme), "/")
+	if len(parts) != 2 || parts[1] == "" || filepath.Base(parts[1]) != parts[1] {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRef, ref)
+	}
+	if _, err := uuid.Parse(parts[0]); err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRef, ref)
+	}
+	return filepath.Join(s.dir, parts[0], parts[1]), nil
+}
+
+// fileContent is the file of an artifact, with the size it had when opened
+type fileContent struct {
+	*os.File
+	size int64
+}
+
+func (c *fileContent) Size() int64 {
+	return c.size
+}
+
+// fileWriter writes an artifact file, computing its checksum as it goes.
+// It has no ReadFrom, so copies to it go through Write.
+type fileWriter struct {
+	file        *os.File
+	hash        hash.Hash
+	size        int64
+	path        string
+	ref         string
+	contentType string
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *fileWriter) Ref() string {
+	return w.ref
+}
+
+func (w *fileWriter) Info() Info {
+	return Info{Ref: w.ref, Size: w.size, SHA256: hex.EncodeToString(w.hash.Sum(nil)), ContentType: w.contentType}
+}
+
+func (w *fileWriter) SetContentType(contentType string) {
+	w.contentType = contentType
+}
+
+func (w *fileWriter) Discard() error {
+	w.file.Close()
+	return os.RemoveAll(filepath.Dir(w.path))
+}
+
+func (w *fileWriter) Close() error {
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	data, err := json.Marshal(w.Info())
+	if err == nil {
+		err = os.WriteFile(filepath.Join(filepath.Dir(w.path), infoFile), data, 0o644)
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := os.Rename(w.file.Name(), w.path); err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Package attachments moves the binaries clients embed in execution inputs,
+// as base64 strings or data URIs, into artifacts when executions are
+// submitted. The fields are replaced with reference objects, which steps
+// open as artifacts and the API inlines again on read.
+package attachments
+
+import "strings"
+
+const (
+	// DefaultThreshold is the length of the encoded strings above which
+	// they are extracted
+	DefaultThreshold = 64 << 10
+	// DefaultInlineLimit is the size of the largest artifacts inlined again
+	// on read
+	DefaultInlineLimit = 1 << 20
+
+	// EncodingDataURI marks the references of data URIs
+	EncodingDataURI = "data_uri"
+	// EncodingBase64 marks the references of bare base64 strings
+	EncodingBase64 = "base64"
+)
+
+// Config configures the extraction of embedded binaries
+type Config struct {
+	Enabled bool
+	// Threshold is the length of the encoded strings above which they are
+	// extracted
+	Threshold int
+	// Allow restricts the extraction to the fields matched by one of its
+	// paths when it is not empty
+	Allow []string
+	// Deny excludes the fields matched by one of its paths
+	Deny []string
+	// InlineLimit is the size of the largest artifacts inlined again on
+	// read; larger ones are returned as download URLs
+	InlineLimit int64
+}
+
+// extracted reports whether the field of a path may be extracted. Paths
+// are the dot separated keys from the root of the input, without array
+// indexes, so documents.content names the content of every document. A
+// configured path matches the fields it names and every field within
+// them; * matches any key.
+func (c Config) extracted(path []string) bool {
+	for _, pattern := range c.Deny {
+		if matchPath(pattern, path) {
+			return false
+		}
+	}
+	if len(c.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range c.Allow {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(pattern string, path []string) bool {
+	segments := strings.Split(pattern, ".")
+	if len(segments) > len(path) {
+		return false
+	}
+	for i, segment := range segments {
+		if segment != "*" && segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,258 @@
+package attachments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/artifacts"
+	"magic-flow/v2/pkg/models"
+)
+
+// recordingMetrics records the metrics it is given
+type recordingMetrics struct {
+	values map[string]float64
+	labels []map[string]string
+}
+
+func (m *recordingMetrics) RecordMetric(name string, value float64, labels map[string]string) {
+	if m.values == nil {
+		m.values = make(map[string]float64)
+	}
+	m.values[name] += value
+	m.labels = append(m.labels, labels)
+}
+
+func newManager(t *testing.T, config Config) (*Manager, *artifacts.FileStore) {
+	store, err := artifacts.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	config.Enabled = true
+	return NewManager(config, store, logger), store
+}
+
+// pdf returns size bytes starting with the PDF signature
+func pdf(size int) []byte {
+	data := make([]byte, size)
+	copy(data, "%PDF-1.7\n")
+	for i := 9; i < size; i++ {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func encoded(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestExtractThreshold(t *testing.T) {
+	manager, store := newManager(t, Config{Threshold: 1024})
+	metrics := &recordingMetrics{}
+	manager.SetMetrics(metrics)
+	ctx := context.Background()
+
+	small := encoded(pdf(600))
+	large := "data:application/pdf;base64," + encoded(pdf(4096))
+	input := map[string]interface{}{
+		"small":   small,
+		"invoice": large,
+		"note":    strings.Repeat("not base64! ", 200),
+		"count":   float64(3),
+	}
+
+	extracted, extractions, err := manager.Extract(ctx, "workflow-1", input)
+	require.NoError(t, err)
+	require.Len(t, extractions, 1)
+	assert.Equal(t, "invoice", extractions[0].Field)
+
+	assert.Equal(t, small, extracted["small"], "strings up to the threshold are left untouched")
+	assert.Equal(t, input["note"], extracted["note"], "strings that are not base64 are left untouched")
+	assert.Equal(t, float64(3), extracted["count"])
+	assert.Equal(t, large, input["invoice"], "the submitted input is not modified")
+
+	reference, ok := artifacts.AsReference(extracted["invoice"])
+	require.True(t, ok, "the field is replaced with a reference object")
+	assert.Equal(t, "application/pdf", reference.ContentType, "the declared content type is kept")
+	assert.Equal(t, EncodingDataURI, reference.Encoding)
+	assert.Equal(t, int64(4096), reference.Size)
+	sum := sha256.Sum256(pdf(4096))
+	assert.Equal(t, hex.EncodeToString(sum[:]), reference.SHA256)
+
+	info, err := store.Stat(ctx, reference.Ref)
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", info.ContentType, "the content type is stored with the artifact")
+
+	assert.Equal(t, map[string]float64{"execution_input_extracted_bytes_total": 4096}, metrics.values)
+	assert.Equal(t, []map[string]string{{"workflow_id": "workflow-1"}}, metrics.labels)
+
+	// Bare base64 is extracted with the content type of its first bytes
+	extracted, _, err = manager.Extract(ctx, "workflow-1", map[string]interface{}{"scan": encoded(pdf(2048))})
+	require.NoError(t, err)
+	reference, ok = artifacts.AsReference(extracted["scan"])
+	require.True(t, ok)
+	assert.Equal(t, "application/pdf", reference.ContentType)
+	assert.Equal(t, EncodingBase64, reference.Encoding)
+
+	// Base64 that re-encoding would not restore, such as wrapped lines, is
+	// left untouched
+	wrapped := strings.Join([]string{encoded(pdf(1500)), encoded(pdf(1500))}, "\n")
+	extracted, extractions, err = manager.Extract(ctx, "workflow-1", map[string]interface{}{"scan": wrapped})
+	require.NoError(t, err)
+	assert.Empty(t, extractions)
+	assert.Equal(t, wrapped, extracted["scan"])
+}
+
+func TestExtractAllowAndDeny(t *testing.T) {
+	manager, _ := newManager(t, Config{
+		Threshold: 512,
+		Allow:     []string{"documents", "attachments.*.content"},
+		Deny:      []string{"documents.signature"},
+	})
+	ctx := context.Background()
+
+	blob := encoded(pdf(1024))
+	input := map[string]interface{}{
+		"documents": []interface{}{
+			map[string]interface{}{"content": blob, "signature": blob},
+			map[string]interface{}{"content": blob, "signature": blob},
+		},
+		"attachments": map[string]interface{}{
+			"cover": map[string]interface{}{"content": blob, "thumbnail": blob},
+		},
+		"raw": blob,
+	}
+
+	extracted, extractions, err := manager.Extract(ctx, "workflow-1", input)
+	require.NoError(t, err)
+
+	var fields []string
+	for _, extraction := range extractions {
+		fields = append(fields, extraction.Field)
+	}
+	assert.ElementsMatch(t, []string{"documents[0].content", "documents[1].content", "attachments.cover.content"}, fields)
+
+	for _, document := range extracted["documents"].([]interface{}) {
+		document := document.(map[string]interface{})
+		_, ok := artifacts.AsReference(document["content"])
+		assert.True(t, ok, "allowed fields are extracted")
+		assert.Equal(t, blob, document["signature"], "denied fields are left untouched")
+	}
+	cover := extracted["attachments"].(map[string]interface{})["cover"].(map[string]interface{})
+	assert.Equal(t, blob, cover["thumbnail"], "fields outside the allowlist are left untouched")
+	assert.Equal(t, blob, extracted["raw"])
+
+	// Disabled extraction leaves inputs untouched
+	manager.config.Enabled = false
+	extracted, extractions, err = manager.Extract(ctx, "workflow-1", input)
+	require.NoError(t, err)
+	assert.Empty(t, extractions)
+	assert.Equal(t, blob, extracted["raw"])
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	manager, _ := newManager(t, Config{Threshold: 256, InlineLimit: 8192})
+	ctx := context.Background()
+
+	input := map[string]interface{}{
+		"invoice": "data:application/pdf;name=invoice.pdf;base64," + encoded(pdf(3000)),
+		"untyped": "data:;base64," + encoded(pdf(1000)),
+		"photos": []interface{}{
+			encoded(append([]byte("\x89PNG\r\n\x1a\n"), pdf(2001)...)),
+			encoded(pdf(2002)),
+		},
+		"archive": encoded(pdf(20000)),
+		"name":    "report",
+	}
+	extracted, extractions, err := manager.Extract(ctx, "workflow-1", input)
+	require.NoError(t, err)
+	assert.Len(t, extractions, 5)
+
+	// Inlined references restore the submitted strings exactly, up to the
+	// inline limit
+	restored, err := manager.Restore(ctx, extracted, true)
+	require.NoError(t, err)
+	restoredInput := restored.(map[string]interface{})
+	for _, field := range []string{"invoice", "untyped", "photos", "name"} {
+		assert.Equal(t, input[field], restoredInput[field], field)
+	}
+
+	archive := restoredInput["archive"].(map[string]interface{})
+	reference, ok := artifacts.AsReference(archive)
+	require.True(t, ok, "references above the inline limit stay references")
+	assert.Equal(t, DownloadURL(reference.Ref), archive["download_url"])
+
+	// Without inline, every reference is returned with its download URL
+	restored, err = manager.Restore(ctx, extracted, false)
+	require.NoError(t, err)
+	invoice := restored.(map[string]interface{})["invoice"].(map[string]interface{})
+	assert.Contains(t, invoice["download_url"], DownloadPrefix)
+	assert.NotContains(t, extracted["invoice"], "download_url", "the stored input is not modified")
+
+	// References decoded from JSON, as stored with executions, restore too
+	decoded := map[string]interface{}{}
+	for key, value := range extracted["invoice"].(map[string]interface{}) {
+		decoded[key] = value
+	}
+	decoded["size"] = float64(3000)
+	restored, err = manager.Restore(ctx, map[string]interface{}{"invoice": decoded}, true)
+	require.NoError(t, err)
+	assert.Equal(t, input["invoice"], restored.(map[string]interface{})["invoice"])
+}
+
+func TestBinarySchemaFormat(t *testing.T) {
+	manager, _ := newManager(t, Config{Threshold: 256})
+	extracted, _, err := manager.Extract(context.Background(), "workflow-1", map[string]interface{}{
+		"document": "data:application/pdf;base64," + encoded(pdf(1024)),
+		"preview":  encoded(pdf(1024)),
+	})
+	require.NoError(t, err)
+
+	schema := models.JSONSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"document": map[string]interface{}{"type": "string", "format": "binary"},
+			"preview":  map[string]interface{}{"type": "string"},
+		},
+	}
+	assert.Equal(t, []string{"field preview must be of type string"}, schema.Validate(extracted),
+		"references satisfy string fields of the binary format only")
+}
+
+func TestDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager, _ := newManager(t, Config{Threshold: 256})
+	extracted, _, err := manager.Extract(context.Background(), "workflow-1", map[string]interface{}{
+		"scan": "data:image/png;base64," + encoded(pdf(2048)),
+	})
+	require.NoError(t, err)
+	reference, _ := artifacts.AsReference(extracted["scan"])
+
+	router := gin.New()
+	NewHandlers(manager).RegisterRoutes(router.Group("/api"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DownloadURL(reference.Ref), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, pdf(2048), w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/artifacts/not-an-id/scan", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/artifacts/7c3bd5d4-54b4-4b89-9c8c-1f1f0a3a7b4e/scan", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,65 @@
+package attachments
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"magic-flow/v2/internal/artifacts"
+)
+
+// Handlers provides HTTP handlers for the download of artifacts
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new attachment handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers attachment routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		v1.GET("/artifacts/:id/:name", h.Download)
+	}
+}
+
+// Download streams the content of an artifact with its content type
+// @Summary Download an artifact
+// @Description Streams the content of an artifact, such as a binary extracted from an execution input, with the content type it was stored with
+// @Tags executions
+// @Produce octet-stream
+// @Param id path string true "Artifact ID"
+// @Param name path string true "Artifact name"
+// @Success 200 {file} binary
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/artifacts/{id}/{name} [get]
+func (h *Handlers) Download(c *gin.Context) {
+	ref := artifacts.Scheme + c.Param("id") + "/" + c.Param("name")
+	content, reference, err := h.manager.Open(c.Request.Context(), ref)
+	switch {
+	case errors.Is(err, artifacts.ErrInvalidRef):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, artifacts.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+
+	contentType := reference.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, content.Size(), contentType, content, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": c.Param("name")}),
+	})
+}
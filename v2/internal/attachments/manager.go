@@ -0,0 +1,326 @@
+package attachments
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/artifacts"
+)
+
+// sniffLength is the length of the base64 prefix decoded to detect the
+// content type of bare base64 strings, covering the 512 bytes
+// http.DetectContentType considers
+const sniffLength = 684
+
+// DownloadPrefix is the path artifacts are downloaded from
+const DownloadPrefix = "/api/v1/artifacts/"
+
+// MetricsRecorder records extraction metrics. It is satisfied by the engine
+// metrics collectors.
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// Extraction is a field of an input extracted into an artifact
+type Extraction struct {
+	// Field is the path of the field, with the indexes of its arrays
+	Field     string              `json:"field"`
+	Reference artifacts.Reference `json:"reference"`
+}
+
+// Manager extracts the binaries of execution inputs into artifacts and
+// restores them on read
+type Manager struct {
+	config  Config
+	store   artifacts.Store
+	metrics MetricsRecorder
+	logger  *logrus.Logger
+}
+
+// NewManager creates a manager storing extracted binaries in store
+func NewManager(config Config, store artifacts.Store, logger *logrus.Logger) *Manager {
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultThreshold
+	}
+	if config.InlineLimit <= 0 {
+		config.InlineLimit = DefaultInlineLimit
+	}
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &Manager{config: config, store: store, logger: logger}
+}
+
+// SetMetrics sets the recorder of the execution_input_extracted_bytes_total
+// metric
+func (m *Manager) SetMetrics(metrics MetricsRecorder) {
+	m.metrics = metrics
+}
+
+// Extract replaces the base64 strings and data URIs of an input longer than
+// the threshold with the reference objects of artifacts holding their
+// decoded content. The input is not modified: the returned input shares the
+// values left untouched. Strings that are not canonical base64, which
+// could not be restored as submitted, are left untouched too. The bytes
+// extracted are counted for the workflow in the
+// execution_input_extracted_bytes_total metric.
+func (m *Manager) Extract(ctx context.Context, workflowID string, input map[string]interface{}) (map[string]interface{}, []Extraction, error) {
+	if !m.config.Enabled || input == nil {
+		return input, nil, nil
+	}
+
+	var extractions []Extraction
+	value, changed, err := m.extractValue(ctx, input, nil, "", &extractions)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !changed {
+		return input, nil, nil
+	}
+
+	var extracted int64
+	for _, extraction := range extractions {
+		extracted += extraction.Reference.Size
+	}
+	if m.metrics != nil {
+		m.metrics.RecordMetric("execution_input_extracted_bytes_total", float64(extracted), map[string]string{
+			"workflow_id": workflowID,
+		})
+	}
+	m.logger.WithFields(logrus.Fields{
+		"workflow_id": workflowID,
+		"fields":      len(extractions),
+		"bytes":       extracted,
+	}).Debug("Extracted embedded binaries from execution input")
+	return value.(map[string]interface{}), extractions, nil
+}
+
+// extractValue extracts the binaries of a value at a path, reporting
+// whether it changed. Changed maps and arrays are copies.
+func (m *Manager) extractValue(ctx context.Context, value interface{}, path []string, field string, extractions *[]Extraction) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var copied map[string]interface{}
+		for key, item := range v {
+			childField := key
+			if field != "" {
+				childField = field + "." + key
+			}
+			extracted, changed, err := m.extractValue(ctx, item, append(path[:len(path):len(path)], key), childField, extractions)
+			if err != nil {
+				return nil, false, err
+			}
+			if !changed {
+				continue
+			}
+			if copied == nil {
+				copied = make(map[string]interface{}, len(v))
+				for k, i := range v {
+					copied[k] = i
+				}
+			}
+			copied[key] = extracted
+		}
+		if copied == nil {
+			return v, false, nil
+		}
+		return copied, true, nil
+	case []interface{}:
+		var copied []interface{}
+		for i, item := range v {
+			extracted, changed, err := m.extractValue(ctx, item, path, field+"["+strconv.Itoa(i)+"]", extractions)
+			if err != nil {
+				return nil, false, err
+			}
+			if !changed {
+				continue
+			}
+			if copied == nil {
+				copied = append([]interface{}{}, v...)
+			}
+			copied[i] = extracted
+		}
+		if copied == nil {
+			return v, false, nil
+		}
+		return copied, true, nil
+	case string:
+		if len(v) <= m.config.Threshold || len(path) == 0 || !m.config.extracted(path) {
+			return v, false, nil
+		}
+		reference, ok, err := m.extractString(ctx, path[len(path)-1], v)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to extract field %s: %w", field, err)
+		}
+		if !ok {
+			return v, false, nil
+		}
+		*extractions = append(*extractions, Extraction{Field: field, Reference: reference})
+		return reference.Object(), true, nil
+	default:
+		return value, false, nil
+	}
+}
+
+// extractString stores the content of a data URI or bare base64 string in
+// an artifact named after its field. It reports false for other strings.
+func (m *Manager) extractString(ctx context.Context, key, value string) (artifacts.Reference, bool, error) {
+	reference := artifacts.Reference{Encoding: EncodingBase64}
+	data := value
+	if mediaType, uriData, ok := parseDataURI(value); ok {
+		reference.Encoding = EncodingDataURI
+		reference.ContentType = mediaType
+		data = uriData
+	}
+	if !isBase64(data) {
+		return artifacts.Reference{}, false, nil
+	}
+	if reference.Encoding == EncodingBase64 {
+		reference.ContentType = sniff(data)
+	}
+
+	decoder := base64.NewDecoder(base64.StdEncoding.Strict(), strings.NewReader(data))
+	info, err := artifacts.PutTyped(ctx, m.store, artifactName(key), reference.ContentType, decoder)
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		return artifacts.Reference{}, false, nil
+	}
+	if err != nil {
+		return artifacts.Reference{}, false, err
+	}
+	reference.Ref = info.Ref
+	reference.Size = info.Size
+	reference.SHA256 = info.SHA256
+	return reference, true, nil
+}
+
+// parseDataURI splits a base64 data URI into the media type it declares,
+// as written, and its data
+func parseDataURI(value string) (string, string, bool) {
+	if !strings.HasPrefix(value, "data:") {
+		return "", "", false
+	}
+	comma := strings.IndexByte(value, ',')
+	if comma < 0 {
+		return "", "", false
+	}
+	header := value[len("data:"):comma]
+	if !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(header, ";base64"), value[comma+1:], true
+}
+
+// isBase64 reports whether a string is padded standard base64 without line
+// breaks, the only form re-encoding restores as it was
+func isBase64(data string) bool {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return false
+	}
+	end := len(data)
+	for end > len(data)-2 && data[end-1] == '=' {
+		end--
+	}
+	for i := 0; i < end; i++ {
+		c := data[i]
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '+' || c == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+// sniff detects the content type of base64 data from its first bytes
+func sniff(data string) string {
+	if len(data) > sniffLength {
+		data = data[:sniffLength]
+	}
+	head, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(head)
+}
+
+// artifactName names the artifact of a field after its key
+func artifactName(key string) string {
+	name := filepath.Base(strings.NewReplacer("/", "_", "\\", "_").Replace(key))
+	if name == "." || name == ".." || strings.HasPrefix(name, ".") {
+		return "attachment"
+	}
+	return name
+}
+
+// Restore prepares the references of an input extracted by Extract for a
+// reader. With inline, references to artifacts up to the inline limit are
+// replaced with the string they were extracted from. The other references
+// are returned with the download_url of their artifact.
+func (m *Manager) Restore(ctx context.Context, value interface{}, inline bool) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if reference, ok := artifacts.AsReference(v); ok && reference.Encoding != "" {
+			return m.restoreReference(ctx, reference, v, inline)
+		}
+		restored := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			value, err := m.Restore(ctx, item, inline)
+			if err != nil {
+				return nil, err
+			}
+			restored[key] = value
+		}
+		return restored, nil
+	case []interface{}:
+		restored := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := m.Restore(ctx, item, inline)
+			if err != nil {
+				return nil, err
+			}
+			restored[i] = value
+		}
+		return restored, nil
+	default:
+		return value, nil
+	}
+}
+
+func (m *Manager) restoreReference(ctx context.Context, reference artifacts.Reference, object map[string]interface{}, inline bool) (interface{}, error) {
+	if inline && reference.Size <= m.config.InlineLimit {
+		data, err := artifacts.ReadAll(ctx, m.store, reference.Ref, m.config.InlineLimit)
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(data)
+		if reference.Encoding == EncodingDataURI {
+			return "data:" + reference.ContentType + ";base64," + encoded, nil
+		}
+		return encoded, nil
+	}
+
+	restored := make(map[string]interface{}, len(object)+1)
+	for key, item := range object {
+		restored[key] = item
+	}
+	restored["download_url"] = DownloadURL(reference.Ref)
+	return restored, nil
+}
+
+// DownloadURL returns the path the artifact of a reference is downloaded
+// from
+func DownloadURL(ref string) string {
+	return DownloadPrefix + strings.TrimPrefix(ref, artifacts.Scheme)
+}
+
+// Open opens an artifact for download
+func (m *Manager) Open(ctx context.Context, ref string) (artifacts.Content, artifacts.Reference, error) {
+	return artifacts.OpenReference(ctx, m.store, ref)
+}
@@ -0,0 +1,164 @@
+// Package backfill applies processors to historical executions, such as
+// classifying the failures that ended before triage was enabled. Derived
+// data only applies to the executions that run after it is added; a
+// backfill job walks the executions of a time window or of a set of
+// workflows in batches, oldest first, checkpointing its position after
+// every batch so it resumes where it stopped after a restart. Processors
+// are idempotent, so the executions of an interrupted batch, or of a range
+// backfilled before, are skipped when processed again.
+package backfill
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+var (
+	// ErrJobNotFound is returned for backfill jobs that do not exist
+	ErrJobNotFound = errors.New("backfill job not found")
+	// ErrUnknownProcessor is returned for jobs naming a processor that is
+	// not registered
+	ErrUnknownProcessor = errors.New("unknown backfill processor")
+	// ErrInvalidState is returned when pausing, resuming or cancelling a
+	// job in a state that does not allow it
+	ErrInvalidState = errors.New("invalid backfill job state")
+	// ErrInvalidRequest is returned for job requests with invalid settings
+	ErrInvalidRequest = errors.New("invalid backfill request")
+)
+
+// Processor derives data from a historical execution. Processing must be
+// idempotent: an execution processed before is skipped.
+type Processor interface {
+	// Name is the name jobs select the processor by
+	Name() string
+	// Process processes an execution. It returns false for executions it
+	// skipped, such as those processed before.
+	Process(ctx context.Context, execution *models.Execution) (bool, error)
+}
+
+// Status is the status of a backfill job
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusPaused    Status = "paused"
+	StatusCompleted Status = "completed"
+	StatusCancelled Status = "cancelled"
+	StatusFailed    Status = "failed"
+)
+
+// MaxErrorSamples is the number of processing errors a report keeps
+const MaxErrorSamples = 10
+
+// Target selects the executions of a job. Zero fields select every
+// execution.
+type Target struct {
+	// From and To bound the creation of the executions. To defaults to
+	// the submission of the job: later executions are processed live.
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// WorkflowIDs limits the job to the executions of some workflows
+	WorkflowIDs []uuid.UUID `json:"workflow_ids,omitempty"`
+}
+
+// Cursor is the position of a job: the creation time and ID of the last
+// execution of its last completed batch
+type Cursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// ErrorSample is an execution a processor failed to process
+type ErrorSample struct {
+	ExecutionID uuid.UUID `json:"execution_id"`
+	Error       string    `json:"error"`
+}
+
+// Report counts the executions of a job by outcome
+type Report struct {
+	Processed int `json:"processed"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	// Errors samples the first processing errors
+	Errors []ErrorSample `json:"errors,omitempty"`
+}
+
+func (r *Report) record(executionID uuid.UUID, processed bool, err error) {
+	switch {
+	case err != nil:
+		r.Failed++
+		if len(r.Errors) < MaxErrorSamples {
+			r.Errors = append(r.Errors, ErrorSample{ExecutionID: executionID, Error: err.Error()})
+		}
+	case processed:
+		r.Processed++
+	default:
+		r.Skipped++
+	}
+}
+
+// add adds the counts and error samples of a batch
+func (r *Report) add(batch Report) {
+	r.Processed += batch.Processed
+	r.Skipped += batch.Skipped
+	r.Failed += batch.Failed
+	for _, sample := range batch.Errors {
+		if len(r.Errors) >= MaxErrorSamples {
+			break
+		}
+		r.Errors = append(r.Errors, sample)
+	}
+}
+
+// Request is the request of a backfill job
+type Request struct {
+	Processor string `json:"processor" binding:"required"`
+	Target    Target `json:"target"`
+	// BatchSize is the number of executions loaded and checkpointed at once
+	BatchSize int `json:"batch_size,omitempty"`
+	// RateLimit caps the executions processed per second, unlimited when
+	// zero
+	RateLimit int    `json:"rate_limit,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+}
+
+// Job is a backfill job and its progress
+type Job struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Processor string    `json:"processor" gorm:"not null"`
+	Target    Target    `json:"target" gorm:"type:jsonb;serializer:json"`
+	BatchSize int       `json:"batch_size"`
+	RateLimit int       `json:"rate_limit,omitempty"`
+	Status    Status    `json:"status" gorm:"index"`
+	// Cursor is the checkpoint the job resumes from, nil before its first
+	// batch completed
+	Cursor *Cursor `json:"cursor,omitempty" gorm:"type:jsonb;serializer:json"`
+	Report Report  `json:"report" gorm:"type:jsonb;serializer:json"`
+	// Error is why a failed job stopped
+	Error       string     `json:"error,omitempty" gorm:"type:text"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// TableName returns the table name for the Job model
+func (Job) TableName() string {
+	return "backfill_jobs"
+}
+
+func (job *Job) copy() *Job {
+	copied := *job
+	if job.Cursor != nil {
+		cursor := *job.Cursor
+		copied.Cursor = &cursor
+	}
+	copied.Target.WorkflowIDs = append([]uuid.UUID(nil), job.Target.WorkflowIDs...)
+	copied.Report.Errors = append([]ErrorSample(nil), job.Report.Errors...)
+	return &copied
+}
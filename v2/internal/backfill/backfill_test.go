@@ -0,0 +1,372 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+type fakeExecutions struct {
+	executions []*models.Execution
+}
+
+func newFakeExecutions(n int) *fakeExecutions {
+	base := time.Now().UTC().Add(-time.Hour)
+	f := &fakeExecutions{}
+	for i := 0; i < n; i++ {
+		f.executions = append(f.executions, &models.Execution{
+			ID:         uuid.New(),
+			WorkflowID: uuid.New(),
+			CreatedAt:  base.Add(time.Duration(i) * time.Second),
+		})
+	}
+	return f
+}
+
+func (f *fakeExecutions) ListAfter(from, to time.Time, workflowIDs []uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]*models.Execution, error) {
+	var executions []*models.Execution
+	for _, execution := range f.executions {
+		if !from.IsZero() && execution.CreatedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && execution.CreatedAt.After(to) {
+			continue
+		}
+		if len(workflowIDs) > 0 && !containsID(workflowIDs, execution.WorkflowID) {
+			continue
+		}
+		if !afterCreatedAt.IsZero() && !execution.CreatedAt.After(afterCreatedAt) &&
+			!(execution.CreatedAt.Equal(afterCreatedAt) && execution.ID.String() > afterID.String()) {
+			continue
+		}
+		executions = append(executions, execution)
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].CreatedAt.Before(executions[j].CreatedAt)
+	})
+	if len(executions) > limit {
+		executions = executions[:limit]
+	}
+	return executions, nil
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeProcessor marks executions processed, skipping those it marked before
+type fakeProcessor struct {
+	mu   sync.Mutex
+	done map[uuid.UUID]bool
+	fail map[uuid.UUID]bool
+	// block, when set, holds every execution until closed
+	block chan struct{}
+	// started receives the executions entering Process
+	started chan uuid.UUID
+}
+
+func newFakeProcessor() *fakeProcessor {
+	return &fakeProcessor{
+		done:    make(map[uuid.UUID]bool),
+		fail:    make(map[uuid.UUID]bool),
+		started: make(chan uuid.UUID, 100),
+	}
+}
+
+func (p *fakeProcessor) Name() string {
+	return "fake"
+}
+
+func (p *fakeProcessor) Process(ctx context.Context, execution *models.Execution) (bool, error) {
+	select {
+	case p.started <- execution.ID:
+	default:
+	}
+	if p.block != nil {
+		select {
+		case <-p.block:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[execution.ID] {
+		return false, errors.New("boom")
+	}
+	if p.done[execution.ID] {
+		return false, nil
+	}
+	p.done[execution.ID] = true
+	return true, nil
+}
+
+func (p *fakeProcessor) processed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.done)
+}
+
+type fakeLoad struct {
+	running  atomic.Int64
+	capacity int
+}
+
+func (l *fakeLoad) RunningExecutions() int {
+	return int(l.running.Load())
+}
+
+func (l *fakeLoad) Capacity() int {
+	return l.capacity
+}
+
+func newTestRunner(store Store, executions ExecutionCursor, processor Processor) *Runner {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runner := NewRunner(Config{
+		DefaultBatchSize: 2,
+		MaxConcurrency:   1,
+		Share:            0.2,
+		PollInterval:     10 * time.Millisecond,
+	}, store, executions, logger)
+	runner.Register(processor)
+	return runner
+}
+
+func waitFor(t *testing.T, store Store, id uuid.UUID, status Status) *Job {
+	t.Helper()
+	var job *Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = store.Get(context.Background(), id)
+		require.NoError(t, err)
+		return job.Status == status
+	}, 5*time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("completes with a report", func(t *testing.T) {
+		executions := newFakeExecutions(15)
+		processor := newFakeProcessor()
+		for _, execution := range executions.executions[:12] {
+			processor.fail[execution.ID] = true
+		}
+		store := NewMemoryStore()
+		runner := newTestRunner(store, executions, processor)
+
+		job, err := runner.Submit(ctx, Request{Processor: "fake", CreatedBy: "alice"})
+		require.NoError(t, err)
+		assert.Equal(t, StatusRunning, job.Status)
+		assert.NotNil(t, job.Target.To, "the target ends at the submission")
+
+		job = waitFor(t, store, job.ID, StatusCompleted)
+		assert.Equal(t, 3, job.Report.Processed)
+		assert.Equal(t, 12, job.Report.Failed)
+		assert.Len(t, job.Report.Errors, MaxErrorSamples)
+		assert.Equal(t, executions.executions[0].ID, job.Report.Errors[0].ExecutionID)
+		assert.Equal(t, executions.executions[14].ID, job.Cursor.ID)
+		assert.NotNil(t, job.CompletedAt)
+	})
+
+	t.Run("selects the executions of the target", func(t *testing.T) {
+		executions := newFakeExecutions(6)
+		processor := newFakeProcessor()
+		store := NewMemoryStore()
+		runner := newTestRunner(store, executions, processor)
+
+		from := executions.executions[1].CreatedAt
+		job, err := runner.Submit(ctx, Request{Processor: "fake", Target: Target{
+			From:        &from,
+			WorkflowIDs: []uuid.UUID{executions.executions[0].WorkflowID, executions.executions[2].WorkflowID, executions.executions[3].WorkflowID},
+		}})
+		require.NoError(t, err)
+
+		job = waitFor(t, store, job.ID, StatusCompleted)
+		assert.Equal(t, 2, job.Report.Processed)
+		assert.True(t, processor.done[executions.executions[2].ID])
+		assert.True(t, processor.done[executions.executions[3].ID])
+	})
+
+	t.Run("re-running a backfilled range skips every execution", func(t *testing.T) {
+		executions := newFakeExecutions(5)
+		processor := newFakeProcessor()
+		store := NewMemoryStore()
+		runner := newTestRunner(store, executions, processor)
+
+		first, err := runner.Submit(ctx, Request{Processor: "fake"})
+		require.NoError(t, err)
+		waitFor(t, store, first.ID, StatusCompleted)
+
+		second, err := runner.Submit(ctx, Request{Processor: "fake"})
+		require.NoError(t, err)
+		report := waitFor(t, store, second.ID, StatusCompleted).Report
+		assert.Equal(t, 0, report.Processed)
+		assert.Equal(t, 5, report.Skipped)
+	})
+
+	t.Run("rejects unknown processors and invalid requests", func(t *testing.T) {
+		runner := newTestRunner(NewMemoryStore(), newFakeExecutions(1), newFakeProcessor())
+
+		_, err := runner.Submit(ctx, Request{Processor: "stats"})
+		assert.ErrorIs(t, err, ErrUnknownProcessor)
+		_, err = runner.Submit(ctx, Request{Processor: "fake", RateLimit: -1})
+		assert.ErrorIs(t, err, ErrInvalidRequest)
+		from := time.Now().Add(time.Hour)
+		_, err = runner.Submit(ctx, Request{Processor: "fake", Target: Target{From: &from}})
+		assert.ErrorIs(t, err, ErrInvalidRequest)
+		assert.Equal(t, []string{"fake"}, runner.Processors())
+	})
+}
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+	executions := newFakeExecutions(5)
+	processor := newFakeProcessor()
+	processor.block = make(chan struct{})
+	store := NewMemoryStore()
+
+	runner := newTestRunner(store, executions, processor)
+	job, err := runner.Submit(ctx, Request{Processor: "fake"})
+	require.NoError(t, err)
+
+	// Let the first batch and the first execution of the second through,
+	// then crash while the fourth execution is processed
+	for i := 0; i < 3; i++ {
+		<-processor.started
+		processor.block <- struct{}{}
+	}
+	<-processor.started
+	runner.Stop()
+
+	stopped, err := store.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, stopped.Status, "jobs stopped with the runner stay running")
+	assert.Equal(t, 2, stopped.Report.Processed, "the checkpoint covers the first batch")
+	assert.Equal(t, executions.executions[1].ID, stopped.Cursor.ID)
+	assert.Equal(t, 3, processor.processed())
+
+	processor.block = nil
+	restarted := newTestRunner(store, executions, processor)
+	require.NoError(t, restarted.Recover(ctx))
+
+	report := waitFor(t, store, job.ID, StatusCompleted).Report
+	assert.Equal(t, 4, report.Processed)
+	assert.Equal(t, 1, report.Skipped, "the execution processed before the crash is skipped")
+	assert.Equal(t, 5, processor.processed())
+}
+
+func TestControl(t *testing.T) {
+	ctx := context.Background()
+	executions := newFakeExecutions(3)
+	processor := newFakeProcessor()
+	block := make(chan struct{})
+	processor.block = block
+	store := NewMemoryStore()
+	runner := newTestRunner(store, executions, processor)
+
+	job, err := runner.Submit(ctx, Request{Processor: "fake"})
+	require.NoError(t, err)
+	<-processor.started
+
+	_, err = runner.Resume(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrInvalidState, "running jobs cannot be resumed")
+
+	paused, err := runner.Pause(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPaused, paused.Status)
+	assert.Equal(t, 0, paused.Report.Processed)
+	_, err = runner.Pause(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrInvalidState)
+
+	close(block)
+	resumed, err := runner.Resume(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, resumed.Status)
+	completed := waitFor(t, store, job.ID, StatusCompleted)
+	assert.Equal(t, 3, completed.Report.Processed)
+
+	_, err = runner.Cancel(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrInvalidState, "completed jobs cannot be cancelled")
+	_, err = runner.Pause(ctx, uuid.New())
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	t.Run("cancel", func(t *testing.T) {
+		processor := newFakeProcessor()
+		processor.block = make(chan struct{})
+		runner := newTestRunner(store, newFakeExecutions(3), processor)
+
+		running, err := runner.Submit(ctx, Request{Processor: "fake"})
+		require.NoError(t, err)
+		<-processor.started
+		cancelled, err := runner.Cancel(ctx, running.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusCancelled, cancelled.Status)
+		assert.NotNil(t, cancelled.CompletedAt)
+
+		paused, err := runner.Submit(ctx, Request{Processor: "fake"})
+		require.NoError(t, err)
+		<-processor.started
+		_, err = runner.Pause(ctx, paused.ID)
+		require.NoError(t, err)
+		cancelled, err = runner.Cancel(ctx, paused.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusCancelled, cancelled.Status)
+		_, err = runner.Resume(ctx, paused.ID)
+		assert.ErrorIs(t, err, ErrInvalidState)
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	executions := newFakeExecutions(5)
+	store := NewMemoryStore()
+	runner := newTestRunner(store, executions, newFakeProcessor())
+
+	start := time.Now()
+	job, err := runner.Submit(context.Background(), Request{Processor: "fake", RateLimit: 20})
+	require.NoError(t, err)
+	waitFor(t, store, job.ID, StatusCompleted)
+
+	// The first execution is processed at once, the others every 50ms
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestLoadShedding(t *testing.T) {
+	executions := newFakeExecutions(3)
+	processor := newFakeProcessor()
+	store := NewMemoryStore()
+	runner := newTestRunner(store, executions, processor)
+	load := &fakeLoad{capacity: 10}
+	load.running.Store(9)
+	runner.SetLoad(load)
+
+	job, err := runner.Submit(context.Background(), Request{Processor: "fake"})
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, processor.processed(), "live executions use more than 80% of the capacity")
+
+	load.running.Store(8)
+	report := waitFor(t, store, job.ID, StatusCompleted).Report
+	assert.Equal(t, 3, report.Processed)
+}
@@ -0,0 +1,167 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Handlers provides HTTP handlers for backfill jobs
+type Handlers struct {
+	runner *Runner
+}
+
+// NewHandlers creates new backfill handlers
+func NewHandlers(runner *Runner) *Handlers {
+	return &Handlers{runner: runner}
+}
+
+// RegisterRoutes registers backfill routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		backfills := v1.Group("/backfills")
+		{
+			backfills.POST("", h.SubmitJob)
+			backfills.GET("", h.ListJobs)
+			backfills.GET("/processors", h.ListProcessors)
+			backfills.GET("/:id", h.GetJob)
+			backfills.POST("/:id/pause", h.PauseJob)
+			backfills.POST("/:id/resume", h.ResumeJob)
+			backfills.POST("/:id/cancel", h.CancelJob)
+		}
+	}
+}
+
+// SubmitJob starts a backfill job
+// @Summary Start a backfill job
+// @Description Applies a processor to the executions of a time window or of a set of workflows in the background
+// @Tags backfills
+// @Accept json
+// @Produce json
+// @Param request body Request true "Backfill job"
+// @Success 202 {object} Job
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/backfills [post]
+func (h *Handlers) SubmitJob(c *gin.Context) {
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.runner.Submit(c.Request.Context(), req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListJobs returns the backfill jobs, the most recent first
+// @Summary List backfill jobs
+// @Tags backfills
+// @Produce json
+// @Success 200 {array} Job
+// @Router /api/v1/backfills [get]
+func (h *Handlers) ListJobs(c *gin.Context) {
+	jobs, err := h.runner.List(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// ListProcessors returns the names of the processors jobs can use
+// @Summary List backfill processors
+// @Tags backfills
+// @Produce json
+// @Success 200 {array} string
+// @Router /api/v1/backfills/processors [get]
+func (h *Handlers) ListProcessors(c *gin.Context) {
+	c.JSON(http.StatusOK, h.runner.Processors())
+}
+
+// GetJob returns a backfill job with its progress
+// @Summary Get a backfill job
+// @Tags backfills
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} Job
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/backfills/{id} [get]
+func (h *Handlers) GetJob(c *gin.Context) {
+	h.control(c, h.runner.Get)
+}
+
+// PauseJob pauses a running backfill job at its last checkpoint
+// @Summary Pause a backfill job
+// @Tags backfills
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} Job
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/backfills/{id}/pause [post]
+func (h *Handlers) PauseJob(c *gin.Context) {
+	h.control(c, h.runner.Pause)
+}
+
+// ResumeJob resumes a paused backfill job from its checkpoint
+// @Summary Resume a backfill job
+// @Tags backfills
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} Job
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/backfills/{id}/resume [post]
+func (h *Handlers) ResumeJob(c *gin.Context) {
+	h.control(c, h.runner.Resume)
+}
+
+// CancelJob cancels a running or paused backfill job
+// @Summary Cancel a backfill job
+// @Tags backfills
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} Job
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/backfills/{id}/cancel [post]
+func (h *Handlers) CancelJob(c *gin.Context) {
+	h.control(c, h.runner.Cancel)
+}
+
+// control applies an operation to the job of the request
+func (h *Handlers) control(c *gin.Context, operation func(context.Context, uuid.UUID) (*Job, error)) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := operation(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownProcessor), errors.Is(err, ErrInvalidRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
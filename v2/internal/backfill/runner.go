@@ -0,0 +1,532 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/quotas"
+	"magic-flow/v2/pkg/models"
+)
+
+// Config configures the runner of backfill jobs
+type Config struct {
+	// DefaultBatchSize is the batch size of jobs that do not set one
+	DefaultBatchSize int
+	// MaxConcurrency caps the executions processed at once by all jobs
+	MaxConcurrency int
+	// Share is the share of the engine capacity backfills may use. Jobs
+	// wait while live executions use more than the rest.
+	Share float64
+	// PollInterval is how often jobs waiting for live traffic to drop
+	// check the load again
+	PollInterval time.Duration
+}
+
+// DefaultConfig returns the default backfill config
+func DefaultConfig() Config {
+	return Config{
+		DefaultBatchSize: 100,
+		MaxConcurrency:   4,
+		Share:            0.2,
+		PollInterval:     time.Second,
+	}
+}
+
+// ExecutionCursor lists executions in the order of their creation, after
+// the execution created at afterCreatedAt with afterID. Zero bounds and an
+// empty workflow list select every execution. It is implemented by
+// database.ExecutionRepository.
+type ExecutionCursor interface {
+	ListAfter(from, to time.Time, workflowIDs []uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]*models.Execution, error)
+}
+
+// LoadSignal reports the live load of the engine. It is implemented by
+// engine.Engine.
+type LoadSignal interface {
+	RunningExecutions() int
+	// Capacity returns the maximum number of concurrent executions
+	Capacity() int
+}
+
+// Runner runs backfill jobs in the background
+type Runner struct {
+	config     Config
+	store      Store
+	executions ExecutionCursor
+	logger     *logrus.Logger
+	now        func() time.Time
+	// slots holds a token per execution processed by any job
+	slots chan struct{}
+	// control serializes the state changes of jobs
+	control sync.Mutex
+
+	mu         sync.Mutex
+	load       LoadSignal
+	processors map[string]Processor
+	running    map[uuid.UUID]*run
+	wg         sync.WaitGroup
+}
+
+// run is a job running in the background
+type run struct {
+	cancel context.CancelFunc
+	// stop is the status the job stops with once cancelled. Jobs stopped
+	// with the runner stay running, to be recovered on restart.
+	stop Status
+	done chan struct{}
+}
+
+// NewRunner creates a runner of the backfill jobs of store over executions
+func NewRunner(config Config, store Store, executions ExecutionCursor, logger *logrus.Logger) *Runner {
+	if config.DefaultBatchSize <= 0 {
+		config.DefaultBatchSize = DefaultConfig().DefaultBatchSize
+	}
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = DefaultConfig().MaxConcurrency
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultConfig().PollInterval
+	}
+	return &Runner{
+		config:     config,
+		store:      store,
+		executions: executions,
+		logger:     logger,
+		now:        time.Now,
+		slots:      make(chan struct{}, config.MaxConcurrency),
+		processors: make(map[string]Processor),
+		running:    make(map[uuid.UUID]*run),
+	}
+}
+
+// SetLoad sets the load signal backfills yield to live traffic by. Jobs
+// use their full concurrency until set.
+func (r *Runner) SetLoad(load LoadSignal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.load = load
+}
+
+// Register registers a processor under its name
+func (r *Runner) Register(processor Processor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processors[processor.Name()] = processor
+}
+
+// Processors returns the names of the registered processors
+func (r *Runner) Processors() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.processors))
+	for name := range r.processors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Runner) processor(name string) Processor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.processors[name]
+}
+
+// Submit creates a job and starts it
+func (r *Runner) Submit(ctx context.Context, request Request) (*Job, error) {
+	if r.processor(request.Processor) == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProcessor, request.Processor)
+	}
+	if request.BatchSize < 0 || request.RateLimit < 0 {
+		return nil, fmt.Errorf("%w: batch size and rate limit cannot be negative", ErrInvalidRequest)
+	}
+
+	now := r.now().UTC()
+	target := request.Target
+	if target.To == nil {
+		target.To = &now
+	}
+	if target.From != nil && target.From.After(*target.To) {
+		return nil, fmt.Errorf("%w: target starts after it ends", ErrInvalidRequest)
+	}
+	batchSize := request.BatchSize
+	if batchSize == 0 {
+		batchSize = r.config.DefaultBatchSize
+	}
+
+	job := &Job{
+		ID:        uuid.New(),
+		Processor: request.Processor,
+		Target:    target,
+		BatchSize: batchSize,
+		RateLimit: request.RateLimit,
+		Status:    StatusRunning,
+		CreatedBy: request.CreatedBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	r.control.Lock()
+	defer r.control.Unlock()
+	if err := r.store.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to create backfill job: %w", err)
+	}
+	r.start(job)
+	return job.copy(), nil
+}
+
+// Get returns a job
+func (r *Runner) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	return r.store.Get(ctx, id)
+}
+
+// List returns every job, the most recent first
+func (r *Runner) List(ctx context.Context) ([]*Job, error) {
+	return r.store.List(ctx, "")
+}
+
+// Pause stops a running job after checkpointing it. The executions of the
+// batch it was processing are processed again on resume.
+func (r *Runner) Pause(ctx context.Context, id uuid.UUID) (*Job, error) {
+	r.control.Lock()
+	defer r.control.Unlock()
+
+	if !r.stop(id, StatusPaused) {
+		return nil, r.invalidState(ctx, id, "pause")
+	}
+	return r.store.Get(ctx, id)
+}
+
+// Resume restarts a paused job from its checkpoint
+func (r *Runner) Resume(ctx context.Context, id uuid.UUID) (*Job, error) {
+	r.control.Lock()
+	defer r.control.Unlock()
+
+	job, err := r.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != StatusPaused {
+		return nil, fmt.Errorf("%w: cannot resume a %s job", ErrInvalidState, job.Status)
+	}
+	job.Status = StatusRunning
+	job.UpdatedAt = r.now().UTC()
+	if err := r.store.Update(ctx, job); err != nil {
+		return nil, err
+	}
+	r.start(job)
+	return job.copy(), nil
+}
+
+// Cancel stops a running or paused job for good
+func (r *Runner) Cancel(ctx context.Context, id uuid.UUID) (*Job, error) {
+	r.control.Lock()
+	defer r.control.Unlock()
+
+	if r.stop(id, StatusCancelled) {
+		return r.store.Get(ctx, id)
+	}
+	job, err := r.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != StatusPaused {
+		return nil, fmt.Errorf("%w: cannot cancel a %s job", ErrInvalidState, job.Status)
+	}
+	now := r.now().UTC()
+	job.Status = StatusCancelled
+	job.UpdatedAt = now
+	job.CompletedAt = &now
+	if err := r.store.Update(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Recover restarts the jobs that were running when the runner last
+// stopped, such as on a crash, from their checkpoint
+func (r *Runner) Recover(ctx context.Context) error {
+	r.control.Lock()
+	defer r.control.Unlock()
+
+	jobs, err := r.store.List(ctx, StatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to list running backfill jobs: %w", err)
+	}
+	for _, job := range jobs {
+		r.mu.Lock()
+		_, running := r.running[job.ID]
+		r.mu.Unlock()
+		if running {
+			continue
+		}
+		r.logger.WithFields(logrus.Fields{
+			"job_id":    job.ID,
+			"processor": job.Processor,
+		}).Info("Resuming backfill job")
+		r.start(job)
+	}
+	return nil
+}
+
+// Stop stops the running jobs and waits for them. They stay running, to
+// be recovered on restart.
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	for _, handle := range r.running {
+		handle.cancel()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// stop stops a running job with a status and waits for it, reporting
+// whether the job was running
+func (r *Runner) stop(id uuid.UUID, status Status) bool {
+	r.mu.Lock()
+	handle, ok := r.running[id]
+	if ok {
+		handle.stop = status
+		handle.cancel()
+	}
+	r.mu.Unlock()
+
+	if ok {
+		<-handle.done
+	}
+	return ok
+}
+
+func (r *Runner) invalidState(ctx context.Context, id uuid.UUID, action string) error {
+	job, err := r.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: cannot %s a %s job", ErrInvalidState, action, job.Status)
+}
+
+// start runs a job in the background
+func (r *Runner) start(job *Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handle := &run{cancel: cancel, stop: StatusRunning, done: make(chan struct{})}
+
+	r.mu.Lock()
+	r.running[job.ID] = handle
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go r.run(ctx, job.copy(), handle)
+}
+
+// run processes the batches of a job until its executions are exhausted
+// or it is stopped, checkpointing it after every batch
+func (r *Runner) run(ctx context.Context, job *Job, handle *run) {
+	defer func() {
+		handle.cancel()
+		r.mu.Lock()
+		delete(r.running, job.ID)
+		r.mu.Unlock()
+		close(handle.done)
+		r.wg.Done()
+	}()
+
+	processor := r.processor(job.Processor)
+	if processor == nil {
+		r.finish(job, StatusFailed, fmt.Sprintf("%v: %s", ErrUnknownProcessor, job.Processor))
+		return
+	}
+
+	// Jobs are rate limited by a token bucket of one execution at once,
+	// refilled at their rate limit
+	var limiter *quotas.Limiter
+	if job.RateLimit > 0 {
+		limiter = quotas.NewLimiter(quotas.Config{
+			Default: quotas.Limit{Executions: job.RateLimit, Period: time.Second, Burst: 1},
+		})
+	}
+
+	var from time.Time
+	if job.Target.From != nil {
+		from = *job.Target.From
+	}
+	for {
+		if ctx.Err() != nil {
+			r.stopped(job, handle)
+			return
+		}
+
+		var after Cursor
+		if job.Cursor != nil {
+			after = *job.Cursor
+		}
+		executions, err := r.executions.ListAfter(from, *job.Target.To, job.Target.WorkflowIDs, after.CreatedAt, after.ID, job.BatchSize)
+		if err != nil {
+			r.finish(job, StatusFailed, fmt.Sprintf("failed to load executions: %v", err))
+			return
+		}
+		if len(executions) == 0 {
+			r.finish(job, StatusCompleted, "")
+			return
+		}
+
+		report, err := r.processBatch(ctx, job, processor, limiter, executions)
+		if err != nil {
+			r.stopped(job, handle)
+			return
+		}
+		job.Report.add(report)
+		last := executions[len(executions)-1]
+		job.Cursor = &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		job.UpdatedAt = r.now().UTC()
+		if err := r.store.Update(context.Background(), job); err != nil {
+			// The batch is processed again from the previous checkpoint
+			// after a restart, which idempotent processors skip
+			r.logger.WithError(err).WithField("job_id", job.ID).Warn("Failed to checkpoint backfill job")
+		}
+	}
+}
+
+// processBatch processes the executions of a batch, as many at once as
+// the runner allows. It returns an error when the job was stopped before
+// the batch completed.
+func (r *Runner) processBatch(ctx context.Context, job *Job, processor Processor, limiter *quotas.Limiter, executions []*models.Execution) (Report, error) {
+	var (
+		mu     sync.Mutex
+		report Report
+		wg     sync.WaitGroup
+	)
+	for _, execution := range executions {
+		if limiter != nil {
+			if err := waitRate(ctx, limiter, job.ID.String()); err != nil {
+				break
+			}
+		}
+		if err := r.acquire(ctx); err != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(execution *models.Execution) {
+			defer wg.Done()
+			defer func() { <-r.slots }()
+
+			processed, err := processor.Process(ctx, execution)
+			if ctx.Err() != nil {
+				return
+			}
+			mu.Lock()
+			report.record(execution.ID, processed, err)
+			mu.Unlock()
+		}(execution)
+	}
+	wg.Wait()
+	return report, ctx.Err()
+}
+
+// acquire waits for a slot to process an execution in, while live
+// executions leave backfills their share of the engine capacity
+func (r *Runner) acquire(ctx context.Context) error {
+	for {
+		if !r.shed() {
+			select {
+			case r.slots <- struct{}{}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := sleep(ctx, r.config.PollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// shed reports whether live executions use more of the engine capacity
+// than backfills leave them
+func (r *Runner) shed() bool {
+	r.mu.Lock()
+	load := r.load
+	r.mu.Unlock()
+	if load == nil {
+		return false
+	}
+	capacity := load.Capacity()
+	if capacity <= 0 {
+		return false
+	}
+	return float64(load.RunningExecutions()) > float64(capacity)*(1-r.config.Share)
+}
+
+// stopped records the status a job was stopped with. Jobs stopped with the
+// runner keep their last checkpoint as is.
+func (r *Runner) stopped(job *Job, handle *run) {
+	r.mu.Lock()
+	status := handle.stop
+	r.mu.Unlock()
+	if status == StatusRunning {
+		return
+	}
+
+	now := r.now().UTC()
+	job.Status = status
+	job.UpdatedAt = now
+	if status == StatusCancelled {
+		job.CompletedAt = &now
+	}
+	if err := r.store.Update(context.Background(), job); err != nil {
+		r.logger.WithError(err).WithField("job_id", job.ID).Error("Failed to save backfill job")
+	}
+}
+
+// finish records the final status of a job
+func (r *Runner) finish(job *Job, status Status, message string) {
+	now := r.now().UTC()
+	job.Status = status
+	job.Error = message
+	job.UpdatedAt = now
+	job.CompletedAt = &now
+	if err := r.store.Update(context.Background(), job); err != nil {
+		r.logger.WithError(err).WithField("job_id", job.ID).Error("Failed to save backfill job")
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"job_id":    job.ID,
+		"processor": job.Processor,
+		"status":    status,
+		"processed": job.Report.Processed,
+		"skipped":   job.Report.Skipped,
+		"failed":    job.Report.Failed,
+	}).Info("Backfill job finished")
+}
+
+// waitRate waits for the rate limit of a job to allow an execution
+func waitRate(ctx context.Context, limiter *quotas.Limiter, key string) error {
+	for {
+		err := limiter.Take(key)
+		var exceeded *quotas.ExceededError
+		if !errors.As(err, &exceeded) {
+			return nil
+		}
+		if err := sleep(ctx, exceeded.RetryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
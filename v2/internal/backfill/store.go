@@ -0,0 +1,139 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store persists backfill jobs and their checkpoints
+type Store interface {
+	Create(ctx context.Context, job *Job) error
+	Update(ctx context.Context, job *Job) error
+	Get(ctx context.Context, id uuid.UUID) (*Job, error)
+	// List returns the jobs of a status, every job when status is empty,
+	// the most recent first
+	List(ctx context.Context, status Status) ([]*Job, error)
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[uuid.UUID]*Job
+}
+
+// NewMemoryStore creates an in-memory backfill job store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[uuid.UUID]*Job)}
+}
+
+// Create stores a new job
+func (s *MemoryStore) Create(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job.copy()
+	return nil
+}
+
+// Update replaces a job
+func (s *MemoryStore) Update(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.ID]; !exists {
+		return ErrJobNotFound
+	}
+	s.jobs[job.ID] = job.copy()
+	return nil
+}
+
+// Get returns a job
+func (s *MemoryStore) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	return job.copy(), nil
+}
+
+// List returns the jobs of a status, every job when status is empty, the
+// most recent first
+func (s *MemoryStore) List(ctx context.Context, status Status) ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job.copy())
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// GormStore is a database Store
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database backfill job store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the backfill job table
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Job{})
+}
+
+// Create stores a new job
+func (s *GormStore) Create(ctx context.Context, job *Job) error {
+	return s.db.WithContext(ctx).Create(job).Error
+}
+
+// Update replaces a job
+func (s *GormStore) Update(ctx context.Context, job *Job) error {
+	result := s.db.WithContext(ctx).Model(&Job{}).Where("id = ?", job.ID).Select("*").Updates(job)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Get returns a job
+func (s *GormStore) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	var job Job
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// List returns the jobs of a status, every job when status is empty, the
+// most recent first
+func (s *GormStore) List(ctx context.Context, status Status) ([]*Job, error) {
+	query := s.db.WithContext(ctx).Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var jobs []*Job
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
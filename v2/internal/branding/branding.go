@@ -0,0 +1,300 @@
+// Package branding lets namespaces replace the product branding and the
+// English text of generated client READMEs and notifications. A namespace
+// stores a branding profile, the product name, support URL, logo and
+// default locale, and a message catalog of localized strings. Strings are
+// resolved through the catalogs of the namespace and of the default
+// namespace, falling back to the embedded English defaults.
+package branding
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the locale of the embedded default strings
+const DefaultLocale = "en"
+
+// DefaultNamespace is the namespace whose profile and catalog apply to
+// every namespace that does not override them
+const DefaultNamespace = "default"
+
+// Placeholders every string can use, filled in from the branding profile
+const (
+	PlaceholderProduct    = "product"
+	PlaceholderSupportURL = "support_url"
+)
+
+var (
+	// ErrProfileNotFound is returned for namespaces without a profile
+	ErrProfileNotFound = errors.New("branding profile not found")
+	// ErrEntryNotFound is returned for catalog entries that do not exist
+	ErrEntryNotFound = errors.New("catalog entry not found")
+	// ErrInvalidProfile is returned for profiles that fail validation
+	ErrInvalidProfile = errors.New("invalid branding profile")
+	// ErrInvalidEntry is returned for catalog entries that fail validation
+	ErrInvalidEntry = errors.New("invalid catalog entry")
+	// ErrInvalidLocale is returned for malformed locales
+	ErrInvalidLocale = errors.New("invalid locale")
+)
+
+//go:embed messages/en.json
+var defaultMessagesJSON []byte
+
+// defaults holds the embedded English strings by key
+var defaults map[string]string
+
+func init() {
+	if err := json.Unmarshal(defaultMessagesJSON, &defaults); err != nil {
+		panic(fmt.Sprintf("branding: invalid default messages: %v", err))
+	}
+}
+
+// Defaults returns the embedded English strings by key
+func Defaults() map[string]string {
+	messages := make(map[string]string, len(defaults))
+	for key, value := range defaults {
+		messages[key] = value
+	}
+	return messages
+}
+
+// Profile is the branding of a namespace. Empty fields inherit the profile
+// of the default namespace, then the built-in Magic Flow branding.
+type Profile struct {
+	Namespace    string `json:"namespace" gorm:"primaryKey"`
+	ProductName  string `json:"product_name,omitempty"`
+	SupportURL   string `json:"support_url,omitempty"`
+	ContactEmail string `json:"contact_email,omitempty"`
+	// LogoRef is the URL or path of the logo shown atop generated READMEs
+	LogoRef string `json:"logo_ref,omitempty"`
+	// DefaultLocale is the locale of READMEs and notifications that do not
+	// ask for one
+	DefaultLocale string    `json:"default_locale,omitempty"`
+	UpdatedBy     string    `json:"updated_by,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the Profile model
+func (Profile) TableName() string {
+	return "branding_profiles"
+}
+
+// BuiltinProfile returns the branding of namespaces without a profile
+func BuiltinProfile() Profile {
+	return Profile{
+		Namespace:     DefaultNamespace,
+		ProductName:   "Magic Flow",
+		SupportURL:    "https://magicflow.dev",
+		ContactEmail:  "contact@magicflow.dev",
+		DefaultLocale: DefaultLocale,
+	}
+}
+
+// Validate checks the fields of a profile
+func (p *Profile) Validate() error {
+	if strings.TrimSpace(p.Namespace) == "" {
+		return fmt.Errorf("%w: namespace is required", ErrInvalidProfile)
+	}
+	if p.SupportURL != "" && !strings.HasPrefix(p.SupportURL, "https://") && !strings.HasPrefix(p.SupportURL, "http://") {
+		return fmt.Errorf("%w: support_url must be an http or https URL", ErrInvalidProfile)
+	}
+	if p.ContactEmail != "" && !strings.Contains(p.ContactEmail, "@") {
+		return fmt.Errorf("%w: contact_email must be an email address", ErrInvalidProfile)
+	}
+	if p.DefaultLocale != "" {
+		if err := ValidateLocale(p.DefaultLocale); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+	}
+	return nil
+}
+
+// inherit fills the empty fields of a profile from a parent profile
+func (p Profile) inherit(parent Profile) Profile {
+	if p.ProductName == "" {
+		p.ProductName = parent.ProductName
+	}
+	if p.SupportURL == "" {
+		p.SupportURL = parent.SupportURL
+	}
+	if p.ContactEmail == "" {
+		p.ContactEmail = parent.ContactEmail
+	}
+	if p.LogoRef == "" {
+		p.LogoRef = parent.LogoRef
+	}
+	if p.DefaultLocale == "" {
+		p.DefaultLocale = parent.DefaultLocale
+	}
+	return p
+}
+
+// Entry is a localized string of the message catalog of a namespace
+type Entry struct {
+	Namespace string    `json:"namespace" gorm:"primaryKey"`
+	Locale    string    `json:"locale" gorm:"primaryKey"`
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Value     string    `json:"value" gorm:"type:text;not null"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the Entry model
+func (Entry) TableName() string {
+	return "message_catalog_entries"
+}
+
+// localePattern matches locales such as en, pt-BR or zh-Hant-TW
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ValidateLocale checks that a locale is a language tag such as fr or pt-BR
+func ValidateLocale(locale string) error {
+	if !localePattern.MatchString(locale) {
+		return fmt.Errorf("%w: %q, expected a language tag such as fr or pt-BR", ErrInvalidLocale, locale)
+	}
+	return nil
+}
+
+// placeholderPattern matches the {name} placeholders of strings
+var placeholderPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// Placeholders returns the placeholders of a string, sorted
+func Placeholders(value string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(value, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that an entry localizes a known key in a valid locale and
+// uses exactly the placeholders of the default string, so no value is
+// dropped from the localized text and none is left unfilled
+func (e *Entry) Validate() error {
+	if err := ValidateLocale(e.Locale); err != nil {
+		return err
+	}
+	def, ok := defaults[e.Key]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidEntry, e.Key)
+	}
+	if strings.TrimSpace(e.Value) == "" {
+		return fmt.Errorf("%w: %s: value is required", ErrInvalidEntry, e.Key)
+	}
+
+	expected := Placeholders(def)
+	actual := make(map[string]bool)
+	for _, name := range Placeholders(e.Value) {
+		actual[name] = true
+	}
+	var missing []string
+	for _, name := range expected {
+		if !actual[name] {
+			missing = append(missing, "{"+name+"}")
+		}
+		delete(actual, name)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s: missing placeholders %s", ErrInvalidEntry, e.Key, strings.Join(missing, ", "))
+	}
+	var unknown []string
+	for name := range actual {
+		if name != PlaceholderProduct && name != PlaceholderSupportURL {
+			unknown = append(unknown, "{"+name+"}")
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: %s: unknown placeholders %s", ErrInvalidEntry, e.Key, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// baseLanguage returns the language of a locale, pt for pt-BR, or an empty
+// string for locales without a region
+func baseLanguage(locale string) string {
+	if i := strings.Index(locale, "-"); i > 0 {
+		return locale[:i]
+	}
+	return ""
+}
+
+// Messages resolves the strings of a namespace in a locale. A nil Messages
+// resolves the built-in branding and the embedded English strings.
+type Messages struct {
+	profile Profile
+	locale  string
+	// layers are the catalogs strings are looked up in, in fallback order
+	layers []map[string]string
+}
+
+// Profile returns the resolved branding profile
+func (m *Messages) Profile() Profile {
+	if m == nil {
+		return BuiltinProfile()
+	}
+	return m.profile
+}
+
+// Locale returns the locale strings are resolved in
+func (m *Messages) Locale() string {
+	if m == nil {
+		return DefaultLocale
+	}
+	return m.locale
+}
+
+// Lookup returns the string of a key, unformatted
+func (m *Messages) Lookup(key string) string {
+	if m != nil {
+		for _, layer := range m.layers {
+			if value, ok := layer[key]; ok {
+				return value
+			}
+		}
+	}
+	if value, ok := defaults[key]; ok {
+		return value
+	}
+	return key
+}
+
+// Format returns the string of a key with its placeholders filled from
+// name, value pairs, such as Format("readme.intro", "language", "Java",
+// "workflow", "orders"). {product} and {support_url} are filled from the
+// profile.
+func (m *Messages) Format(key string, pairs ...interface{}) string {
+	profile := m.Profile()
+	values := map[string]string{
+		PlaceholderProduct:    profile.ProductName,
+		PlaceholderSupportURL: profile.SupportURL,
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		values[fmt.Sprint(pairs[i])] = fmt.Sprint(pairs[i+1])
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(m.Lookup(key), func(placeholder string) string {
+		if value, ok := values[placeholder[1:len(placeholder)-1]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// Resolver resolves the strings of a namespace in a locale. The locale
+// defaults to the default locale of the namespace profile. Manager
+// implements it.
+type Resolver interface {
+	Messages(namespace, locale string) *Messages
+}
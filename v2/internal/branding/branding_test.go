@@ -0,0 +1,245 @@
+package branding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+var updatedAt = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+func newManager(t *testing.T) (*Manager, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	manager := NewManager(store, logrus.New())
+	manager.now = func() time.Time { return updatedAt }
+	return manager, store
+}
+
+func setEntry(t *testing.T, manager *Manager, namespace, locale, key, value string) {
+	t.Helper()
+	_, err := manager.SetEntry(context.Background(), &Entry{Namespace: namespace, Locale: locale, Key: key, Value: value}, "tester")
+	require.NoError(t, err)
+}
+
+func TestDefaults(t *testing.T) {
+	var messages *Messages
+	assert.Equal(t, "Workflow checkout: execution.failed", messages.Format("notification.title", "workflow", "checkout", "event", "execution.failed"))
+	assert.Equal(t, "For help with Magic Flow, visit https://magicflow.dev.", messages.Format("readme.support"))
+	assert.Equal(t, "unknown.key", messages.Lookup("unknown.key"))
+	assert.Equal(t, DefaultLocale, messages.Locale())
+
+	// Placeholders without a value are left in place
+	assert.Equal(t, "Step: {step}", messages.Format("notification.step"))
+
+	for key, value := range Defaults() {
+		for _, name := range Placeholders(value) {
+			assert.Regexp(t, `^[a-z_]+$`, name, key)
+		}
+	}
+}
+
+func TestFallbackChain(t *testing.T) {
+	manager, _ := newManager(t)
+	setEntry(t, manager, DefaultNamespace, "pt", "notification.fact.status", "Estado")
+	setEntry(t, manager, DefaultNamespace, "pt", "notification.fact.step", "Etapa")
+	setEntry(t, manager, "acme", "pt", "notification.fact.step", "Passo")
+	setEntry(t, manager, "acme", "pt-BR", "notification.fact.execution", "Execução")
+	setEntry(t, manager, DefaultNamespace, DefaultLocale, "notification.fact.time", "When")
+
+	messages := manager.Messages("acme", "pt-BR")
+	assert.Equal(t, "pt-BR", messages.Locale())
+	// The locale of the namespace
+	assert.Equal(t, "Execução", messages.Lookup("notification.fact.execution"))
+	// The language of the locale, in the namespace before the default namespace
+	assert.Equal(t, "Passo", messages.Lookup("notification.fact.step"))
+	assert.Equal(t, "Estado", messages.Lookup("notification.fact.status"))
+	// English of the default namespace, then the embedded defaults
+	assert.Equal(t, "When", messages.Lookup("notification.fact.time"))
+	assert.Equal(t, "Duration", messages.Lookup("notification.fact.duration"))
+
+	// Other namespaces only see the default namespace
+	other := manager.Messages("billing", "pt-BR")
+	assert.Equal(t, "Etapa", other.Lookup("notification.fact.step"))
+	assert.Equal(t, "Execution", other.Lookup("notification.fact.execution"))
+
+	// Deleted entries fall back again
+	require.NoError(t, manager.DeleteEntry(context.Background(), "acme", "pt", "notification.fact.step"))
+	assert.Equal(t, "Etapa", manager.Messages("acme", "pt-BR").Lookup("notification.fact.step"))
+	// Messages already resolved keep their strings
+	assert.Equal(t, "Passo", messages.Lookup("notification.fact.step"))
+
+	err := manager.DeleteEntry(context.Background(), "acme", "pt", "notification.fact.step")
+	assert.True(t, errors.Is(err, ErrEntryNotFound))
+}
+
+func TestProfileInheritance(t *testing.T) {
+	manager, store := newManager(t)
+	ctx := context.Background()
+
+	_, err := manager.SaveProfile(ctx, &Profile{Namespace: DefaultNamespace, SupportURL: "https://help.example.com", DefaultLocale: "de"}, "admin")
+	require.NoError(t, err)
+	_, err = manager.SaveProfile(ctx, &Profile{Namespace: "acme", ProductName: "Acme Orchestrator", LogoRef: "https://acme.io/logo.png"}, "admin")
+	require.NoError(t, err)
+
+	messages := manager.Messages("acme", "")
+	profile := messages.Profile()
+	assert.Equal(t, "acme", profile.Namespace)
+	assert.Equal(t, "Acme Orchestrator", profile.ProductName)
+	assert.Equal(t, "https://help.example.com", profile.SupportURL)
+	assert.Equal(t, "contact@magicflow.dev", profile.ContactEmail)
+	assert.Equal(t, "https://acme.io/logo.png", profile.LogoRef)
+	// The locale defaults to that of the profile
+	assert.Equal(t, "de", messages.Locale())
+	assert.Equal(t, "For help with Acme Orchestrator, visit https://help.example.com.", messages.Format("readme.support"))
+
+	// Profiles are loaded from the store on refresh
+	reloaded := NewManager(store, logrus.New())
+	require.NoError(t, reloaded.Refresh(ctx))
+	stored, err := reloaded.Profile("acme")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", stored.UpdatedBy)
+	assert.Equal(t, updatedAt, stored.UpdatedAt)
+	assert.Equal(t, profile, reloaded.Messages("acme", "").Profile())
+
+	require.NoError(t, manager.DeleteProfile(ctx, "acme"))
+	assert.Equal(t, "Magic Flow", manager.Messages("acme", "").Profile().ProductName)
+	assert.True(t, errors.Is(manager.DeleteProfile(ctx, "acme"), ErrProfileNotFound))
+
+	for name, profile := range map[string]*Profile{
+		"namespace": {},
+		"url":       {Namespace: "acme", SupportURL: "help.example.com"},
+		"email":     {Namespace: "acme", ContactEmail: "support"},
+		"locale":    {Namespace: "acme", DefaultLocale: "French"},
+	} {
+		_, err := manager.SaveProfile(ctx, profile, "admin")
+		assert.True(t, errors.Is(err, ErrInvalidProfile), name)
+	}
+}
+
+func TestEntryValidation(t *testing.T) {
+	manager, _ := newManager(t)
+	tests := map[string]struct {
+		entry Entry
+		err   string
+	}{
+		"valid": {
+			entry: Entry{Locale: "fr", Key: "notification.title", Value: "{workflow} : {event}"},
+		},
+		"profile placeholders": {
+			entry: Entry{Locale: "fr", Key: "notification.step", Value: "Étape {product} : {step}"},
+		},
+		"missing placeholder": {
+			entry: Entry{Locale: "fr", Key: "notification.summary", Value: "Workflow {workflow} : {status}"},
+			err:   "notification.summary: missing placeholders {execution}",
+		},
+		"unknown placeholder": {
+			entry: Entry{Locale: "fr", Key: "notification.step", Value: "Étape {step} {stepp} {id}"},
+			err:   "notification.step: unknown placeholders {id}, {stepp}",
+		},
+		"unknown key": {
+			entry: Entry{Locale: "fr", Key: "notification.subtitle", Value: "Sous-titre"},
+			err:   `unknown key "notification.subtitle"`,
+		},
+		"empty value": {
+			entry: Entry{Locale: "fr", Key: "notification.fact.time", Value: " "},
+			err:   "value is required",
+		},
+		"invalid locale": {
+			entry: Entry{Locale: "FR_fr", Key: "notification.fact.time", Value: "Heure"},
+			err:   `invalid locale: "FR_fr"`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			entry := tt.entry
+			entry.Namespace = "acme"
+			_, err := manager.SetEntry(context.Background(), &entry, "tester")
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	assert.Len(t, manager.Catalog("acme", "fr"), 2)
+}
+
+func TestNamespace(t *testing.T) {
+	assert.Equal(t, DefaultNamespace, Namespace(nil))
+	assert.Equal(t, DefaultNamespace, Namespace(&models.Workflow{}))
+
+	workflow := &models.Workflow{}
+	workflow.Definition.Metadata.Labels = map[string]string{"namespace": "acme"}
+	assert.Equal(t, "acme", Namespace(workflow))
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager, _ := newManager(t)
+	router := gin.New()
+	NewHandlers(manager).RegisterRoutes(router.Group("/api"))
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		request.Header.Set("X-User-ID", "admin")
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := send(http.MethodPut, "/api/v1/branding/profiles/acme", ProfileRequest{ProductName: "Acme Orchestrator", DefaultLocale: "fr"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var profile Profile
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &profile))
+	assert.Equal(t, "admin", profile.UpdatedBy)
+
+	recorder = send(http.MethodPut, "/api/v1/branding/catalogs/acme/fr/notification.title", EntryRequest{Value: "Workflow {workflow} : {event}"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	t.Run("invalid entry", func(t *testing.T) {
+		recorder := send(http.MethodPut, "/api/v1/branding/catalogs/acme/fr/notification.title", EntryRequest{Value: "Workflow {workflow}"})
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "missing placeholders {event}")
+	})
+
+	t.Run("resolved messages", func(t *testing.T) {
+		recorder := send(http.MethodGet, "/api/v1/branding/messages/acme", nil)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var resolved struct {
+			Profile  Profile           `json:"profile"`
+			Locale   string            `json:"locale"`
+			Messages map[string]string `json:"messages"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resolved))
+		assert.Equal(t, "Acme Orchestrator", resolved.Profile.ProductName)
+		assert.Equal(t, "fr", resolved.Locale)
+		assert.Equal(t, "Workflow {workflow} : {event}", resolved.Messages["notification.title"])
+		assert.Equal(t, "Step: {step}", resolved.Messages["notification.step"])
+
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/api/v1/branding/messages/acme?locale=fr_FR", nil).Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/api/v1/branding/profiles/billing", nil).Code)
+		assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, "/api/v1/branding/catalogs/acme/de/notification.title", nil).Code)
+	})
+}
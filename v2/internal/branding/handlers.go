@@ -0,0 +1,246 @@
+package branding
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers provides HTTP handlers managing branding profiles and message
+// catalogs
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new branding handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers branding routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		branding := v1.Group("/branding")
+		{
+			branding.GET("/defaults", h.GetDefaults)
+			branding.GET("/profiles", h.ListProfiles)
+			branding.GET("/profiles/:namespace", h.GetProfile)
+			branding.PUT("/profiles/:namespace", h.PutProfile)
+			branding.DELETE("/profiles/:namespace", h.DeleteProfile)
+			branding.GET("/catalogs/:namespace", h.GetCatalog)
+			branding.PUT("/catalogs/:namespace/:locale/:key", h.PutEntry)
+			branding.DELETE("/catalogs/:namespace/:locale/:key", h.DeleteEntry)
+			branding.GET("/messages/:namespace", h.GetMessages)
+		}
+	}
+}
+
+// ProfileRequest is the request body of a branding profile
+type ProfileRequest struct {
+	ProductName   string `json:"product_name"`
+	SupportURL    string `json:"support_url"`
+	ContactEmail  string `json:"contact_email"`
+	LogoRef       string `json:"logo_ref"`
+	DefaultLocale string `json:"default_locale"`
+}
+
+// EntryRequest is the request body of a catalog entry
+type EntryRequest struct {
+	Value string `json:"value" binding:"required"`
+}
+
+// GetDefaults returns the embedded English strings
+// @Summary Get default strings
+// @Description Returns the embedded English strings by key, the keys catalogs can localize and the placeholders they must keep
+// @Tags branding
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/branding/defaults [get]
+func (h *Handlers) GetDefaults(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"locale":   DefaultLocale,
+		"messages": Defaults(),
+		"profile":  BuiltinProfile(),
+	})
+}
+
+// ListProfiles returns the branding profiles of namespaces
+// @Summary List branding profiles
+// @Tags branding
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/branding/profiles [get]
+func (h *Handlers) ListProfiles(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"profiles": h.manager.Profiles()})
+}
+
+// GetProfile returns the branding profile of a namespace
+// @Summary Get branding profile
+// @Tags branding
+// @Produce json
+// @Param namespace path string true "Namespace"
+// @Success 200 {object} Profile
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/branding/profiles/{namespace} [get]
+func (h *Handlers) GetProfile(c *gin.Context) {
+	profile, err := h.manager.Profile(c.Param("namespace"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// PutProfile stores the branding profile of a namespace
+// @Summary Save branding profile
+// @Description Stores the product name, support URL, contact email, logo and default locale of a namespace. Empty fields inherit the profile of the default namespace.
+// @Tags branding
+// @Accept json
+// @Produce json
+// @Param namespace path string true "Namespace"
+// @Param request body ProfileRequest true "Profile"
+// @Success 200 {object} Profile
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/branding/profiles/{namespace} [put]
+func (h *Handlers) PutProfile(c *gin.Context) {
+	var req ProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, err := h.manager.SaveProfile(c.Request.Context(), &Profile{
+		Namespace:     c.Param("namespace"),
+		ProductName:   req.ProductName,
+		SupportURL:    req.SupportURL,
+		ContactEmail:  req.ContactEmail,
+		LogoRef:       req.LogoRef,
+		DefaultLocale: req.DefaultLocale,
+	}, c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteProfile removes the branding profile of a namespace
+// @Summary Delete branding profile
+// @Tags branding
+// @Param namespace path string true "Namespace"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/branding/profiles/{namespace} [delete]
+func (h *Handlers) DeleteProfile(c *gin.Context) {
+	if err := h.manager.DeleteProfile(c.Request.Context(), c.Param("namespace")); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetCatalog returns the message catalog of a namespace
+// @Summary Get message catalog
+// @Tags branding
+// @Produce json
+// @Param namespace path string true "Namespace"
+// @Param locale query string false "Locale"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/branding/catalogs/{namespace} [get]
+func (h *Handlers) GetCatalog(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"entries": h.manager.Catalog(c.Param("namespace"), c.Query("locale"))})
+}
+
+// PutEntry stores a localized string in the catalog of a namespace
+// @Summary Save catalog entry
+// @Description Stores the string of a key in a locale. The string must keep the placeholders of the default string.
+// @Tags branding
+// @Accept json
+// @Produce json
+// @Param namespace path string true "Namespace"
+// @Param locale path string true "Locale"
+// @Param key path string true "Key"
+// @Param request body EntryRequest true "Entry"
+// @Success 200 {object} Entry
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/branding/catalogs/{namespace}/{locale}/{key} [put]
+func (h *Handlers) PutEntry(c *gin.Context) {
+	var req EntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.manager.SetEntry(c.Request.Context(), &Entry{
+		Namespace: c.Param("namespace"),
+		Locale:    c.Param("locale"),
+		Key:       c.Param("key"),
+		Value:     req.Value,
+	}, c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// DeleteEntry removes a localized string from the catalog of a namespace
+// @Summary Delete catalog entry
+// @Tags branding
+// @Param namespace path string true "Namespace"
+// @Param locale path string true "Locale"
+// @Param key path string true "Key"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/branding/catalogs/{namespace}/{locale}/{key} [delete]
+func (h *Handlers) DeleteEntry(c *gin.Context) {
+	if err := h.manager.DeleteEntry(c.Request.Context(), c.Param("namespace"), c.Param("locale"), c.Param("key")); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetMessages returns the strings of a namespace resolved in a locale
+// @Summary Resolve messages
+// @Description Returns the resolved profile and every string of a namespace in a locale, after fallback, to preview a catalog
+// @Tags branding
+// @Produce json
+// @Param namespace path string true "Namespace"
+// @Param locale query string false "Locale, the default locale of the namespace when empty"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/branding/messages/{namespace} [get]
+func (h *Handlers) GetMessages(c *gin.Context) {
+	locale := c.Query("locale")
+	if locale != "" {
+		if err := ValidateLocale(locale); err != nil {
+			h.handleError(c, err)
+			return
+		}
+	}
+
+	messages := h.manager.Messages(c.Param("namespace"), locale)
+	resolved := make(map[string]string, len(defaults))
+	for key := range defaults {
+		resolved[key] = messages.Lookup(key)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"profile":  messages.Profile(),
+		"locale":   messages.Locale(),
+		"messages": resolved,
+	})
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidProfile), errors.Is(err, ErrInvalidEntry), errors.Is(err, ErrInvalidLocale):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrProfileNotFound), errors.Is(err, ErrEntryNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
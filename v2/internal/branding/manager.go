@@ -0,0 +1,265 @@
+package branding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// Namespace returns the namespace of a workflow, whose branding its READMEs
+// and notifications use
+func Namespace(workflow *models.Workflow) string {
+	if workflow == nil {
+		return DefaultNamespace
+	}
+	return policies.Namespace(workflow.Definition)
+}
+
+// Manager manages the branding profiles and message catalogs of namespaces.
+// They are cached, so strings are resolved without reading the store.
+type Manager struct {
+	store  Store
+	logger *logrus.Logger
+	now    func() time.Time
+
+	mu       sync.RWMutex
+	profiles map[string]*Profile
+	// catalogs holds the catalog entries by namespace, locale and key
+	catalogs map[string]map[string]map[string]string
+}
+
+// NewManager creates a branding manager. Call Refresh to load the stored
+// profiles and catalogs.
+func NewManager(store Store, logger *logrus.Logger) *Manager {
+	return &Manager{
+		store:    store,
+		logger:   logger,
+		now:      time.Now,
+		profiles: make(map[string]*Profile),
+		catalogs: make(map[string]map[string]map[string]string),
+	}
+}
+
+// Refresh loads the stored profiles and catalogs
+func (m *Manager) Refresh(ctx context.Context) error {
+	profiles, err := m.store.ListProfiles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load branding profiles: %w", err)
+	}
+	entries, err := m.store.ListEntries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load message catalogs: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.profiles = make(map[string]*Profile, len(profiles))
+	for _, profile := range profiles {
+		m.profiles[profile.Namespace] = profile
+	}
+	m.catalogs = make(map[string]map[string]map[string]string)
+	for _, entry := range entries {
+		m.setEntryLocked(entry.Namespace, entry.Locale, entry.Key, entry.Value)
+	}
+	return nil
+}
+
+// Profile returns the stored profile of a namespace
+func (m *Manager) Profile(namespace string) (*Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	profile, ok := m.profiles[namespace]
+	if !ok {
+		return nil, ErrProfileNotFound
+	}
+	stored := *profile
+	return &stored, nil
+}
+
+// Profiles returns the stored profiles, ordered by namespace
+func (m *Manager) Profiles() []*Profile {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	profiles := make([]*Profile, 0, len(m.profiles))
+	for _, profile := range m.profiles {
+		stored := *profile
+		profiles = append(profiles, &stored)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Namespace < profiles[j].Namespace })
+	return profiles
+}
+
+// SaveProfile stores the profile of a namespace, replacing its previous one
+func (m *Manager) SaveProfile(ctx context.Context, profile *Profile, actor string) (*Profile, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	profile.UpdatedBy = actor
+	profile.UpdatedAt = m.now().UTC()
+	if err := m.store.SaveProfile(ctx, profile); err != nil {
+		return nil, fmt.Errorf("failed to save branding profile: %w", err)
+	}
+
+	m.mu.Lock()
+	stored := *profile
+	m.profiles[profile.Namespace] = &stored
+	m.mu.Unlock()
+
+	m.logger.WithFields(logrus.Fields{
+		"namespace": profile.Namespace,
+		"actor":     actor,
+	}).Info("Branding profile saved")
+	return profile, nil
+}
+
+// DeleteProfile removes the profile of a namespace, which inherits the
+// branding of the default namespace again
+func (m *Manager) DeleteProfile(ctx context.Context, namespace string) error {
+	if err := m.store.DeleteProfile(ctx, namespace); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.profiles, namespace)
+	m.mu.Unlock()
+	return nil
+}
+
+// Catalog returns the catalog entries of a namespace, of one locale unless
+// locale is empty, ordered by locale and key
+func (m *Manager) Catalog(namespace, locale string) []*Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]*Entry, 0)
+	for entryLocale, values := range m.catalogs[namespace] {
+		if locale != "" && entryLocale != locale {
+			continue
+		}
+		for key, value := range values {
+			entries = append(entries, &Entry{Namespace: namespace, Locale: entryLocale, Key: key, Value: value})
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+// SetEntry validates and stores a catalog entry
+func (m *Manager) SetEntry(ctx context.Context, entry *Entry, actor string) (*Entry, error) {
+	if strings.TrimSpace(entry.Namespace) == "" {
+		return nil, fmt.Errorf("%w: namespace is required", ErrInvalidEntry)
+	}
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	entry.UpdatedBy = actor
+	entry.UpdatedAt = m.now().UTC()
+	if err := m.store.SaveEntry(ctx, entry); err != nil {
+		return nil, fmt.Errorf("failed to save catalog entry: %w", err)
+	}
+
+	m.mu.Lock()
+	m.setEntryLocked(entry.Namespace, entry.Locale, entry.Key, entry.Value)
+	m.mu.Unlock()
+	return entry, nil
+}
+
+// DeleteEntry removes a catalog entry, whose key falls back again
+func (m *Manager) DeleteEntry(ctx context.Context, namespace, locale, key string) error {
+	if err := m.store.DeleteEntry(ctx, namespace, locale, key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if values := m.catalogs[namespace][locale]; values != nil {
+		delete(values, key)
+	}
+	return nil
+}
+
+func (m *Manager) setEntryLocked(namespace, locale, key, value string) {
+	locales, ok := m.catalogs[namespace]
+	if !ok {
+		locales = make(map[string]map[string]string)
+		m.catalogs[namespace] = locales
+	}
+	values, ok := locales[locale]
+	if !ok {
+		values = make(map[string]string)
+		locales[locale] = values
+	}
+	values[key] = value
+}
+
+// Messages resolves the strings of a namespace in a locale, the default
+// locale of its profile when empty. Strings fall back from the locale to
+// its language, pt-BR to pt, then to English, each looked up in the
+// catalog of the namespace before that of the default namespace, and
+// finally to the embedded English defaults.
+func (m *Manager) Messages(namespace, locale string) *Messages {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	profile := BuiltinProfile()
+	if stored, ok := m.profiles[DefaultNamespace]; ok {
+		profile = stored.inherit(profile)
+	}
+	if stored, ok := m.profiles[namespace]; ok && namespace != DefaultNamespace {
+		profile = stored.inherit(profile)
+	}
+	profile.Namespace = namespace
+	profile.UpdatedBy = ""
+	profile.UpdatedAt = time.Time{}
+	if locale == "" {
+		locale = profile.DefaultLocale
+	}
+
+	namespaces := []string{namespace}
+	if namespace != DefaultNamespace {
+		namespaces = append(namespaces, DefaultNamespace)
+	}
+	var layers []map[string]string
+	for _, candidate := range localeChain(locale) {
+		for _, ns := range namespaces {
+			if values := m.catalogs[ns][candidate]; len(values) > 0 {
+				// Copied, so later catalog changes do not race with
+				// renders using these messages
+				layer := make(map[string]string, len(values))
+				for key, value := range values {
+					layer[key] = value
+				}
+				layers = append(layers, layer)
+			}
+		}
+	}
+
+	return &Messages{profile: profile, locale: locale, layers: layers}
+}
+
+// localeChain returns the locales strings of a locale are looked up in
+func localeChain(locale string) []string {
+	chain := []string{locale}
+	if language := baseLanguage(locale); language != "" {
+		chain = append(chain, language)
+	}
+	if locale != DefaultLocale && baseLanguage(locale) != DefaultLocale {
+		chain = append(chain, DefaultLocale)
+	}
+	return chain
+}
@@ -0,0 +1,201 @@
+package branding
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists the branding profiles and message catalogs of namespaces
+type Store interface {
+	// SaveProfile stores a profile, replacing that of its namespace
+	SaveProfile(ctx context.Context, profile *Profile) error
+	// DeleteProfile returns ErrProfileNotFound for namespaces without one
+	DeleteProfile(ctx context.Context, namespace string) error
+	ListProfiles(ctx context.Context) ([]*Profile, error)
+
+	// SaveEntry stores a catalog entry, replacing that of its namespace,
+	// locale and key
+	SaveEntry(ctx context.Context, entry *Entry) error
+	// DeleteEntry returns ErrEntryNotFound for entries that do not exist
+	DeleteEntry(ctx context.Context, namespace, locale, key string) error
+	// ListEntries returns every catalog entry, ordered by namespace, locale
+	// and key
+	ListEntries(ctx context.Context) ([]*Entry, error)
+}
+
+type entryKey struct {
+	namespace string
+	locale    string
+	key       string
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu       sync.Mutex
+	profiles map[string]*Profile
+	entries  map[entryKey]*Entry
+}
+
+// NewMemoryStore creates an in-memory branding store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		profiles: make(map[string]*Profile),
+		entries:  make(map[entryKey]*Entry),
+	}
+}
+
+// SaveProfile stores a profile
+func (s *MemoryStore) SaveProfile(ctx context.Context, profile *Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *profile
+	s.profiles[profile.Namespace] = &stored
+	return nil
+}
+
+// DeleteProfile removes the profile of a namespace
+func (s *MemoryStore) DeleteProfile(ctx context.Context, namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.profiles[namespace]; !ok {
+		return ErrProfileNotFound
+	}
+	delete(s.profiles, namespace)
+	return nil
+}
+
+// ListProfiles returns every profile, ordered by namespace
+func (s *MemoryStore) ListProfiles(ctx context.Context) ([]*Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := make([]*Profile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		stored := *profile
+		profiles = append(profiles, &stored)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Namespace < profiles[j].Namespace })
+	return profiles, nil
+}
+
+// SaveEntry stores a catalog entry
+func (s *MemoryStore) SaveEntry(ctx context.Context, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *entry
+	s.entries[entryKey{namespace: entry.Namespace, locale: entry.Locale, key: entry.Key}] = &stored
+	return nil
+}
+
+// DeleteEntry removes a catalog entry
+func (s *MemoryStore) DeleteEntry(ctx context.Context, namespace, locale, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := entryKey{namespace: namespace, locale: locale, key: key}
+	if _, ok := s.entries[k]; !ok {
+		return ErrEntryNotFound
+	}
+	delete(s.entries, k)
+	return nil
+}
+
+// ListEntries returns every catalog entry
+func (s *MemoryStore) ListEntries(ctx context.Context) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		stored := *entry
+		entries = append(entries, &stored)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// sortEntries orders entries by namespace, locale and key
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Locale != b.Locale {
+			return a.Locale < b.Locale
+		}
+		return a.Key < b.Key
+	})
+}
+
+// GormStore keeps one row per namespace in the branding_profiles table and
+// one per namespace, locale and key in the message_catalog_entries table,
+// overwriting them when saved again
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database branding store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the profile and catalog tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Profile{}, &Entry{})
+}
+
+// SaveProfile stores a profile
+func (s *GormStore) SaveProfile(ctx context.Context, profile *Profile) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(profile).Error
+}
+
+// DeleteProfile removes the profile of a namespace
+func (s *GormStore) DeleteProfile(ctx context.Context, namespace string) error {
+	result := s.db.WithContext(ctx).Delete(&Profile{}, "namespace = ?", namespace)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrProfileNotFound
+	}
+	return nil
+}
+
+// ListProfiles returns every profile, ordered by namespace
+func (s *GormStore) ListProfiles(ctx context.Context) ([]*Profile, error) {
+	var profiles []*Profile
+	err := s.db.WithContext(ctx).Order("namespace").Find(&profiles).Error
+	return profiles, err
+}
+
+// SaveEntry stores a catalog entry
+func (s *GormStore) SaveEntry(ctx context.Context, entry *Entry) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(entry).Error
+}
+
+// DeleteEntry removes a catalog entry
+func (s *GormStore) DeleteEntry(ctx context.Context, namespace, locale, key string) error {
+	result := s.db.WithContext(ctx).Delete(&Entry{}, "namespace = ? AND locale = ? AND key = ?", namespace, locale, key)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// ListEntries returns every catalog entry
+func (s *GormStore) ListEntries(ctx context.Context) ([]*Entry, error) {
+	var entries []*Entry
+	err := s.db.WithContext(ctx).Order("namespace, locale, key").Find(&entries).Error
+	return entries, err
+}
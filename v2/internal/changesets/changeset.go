@@ -0,0 +1,124 @@
+package changesets
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrInvalidChangeset is returned when an operation of a changeset fails
+// validation
+var ErrInvalidChangeset = errors.New("invalid changeset")
+
+// ErrChangesetNotFound is returned when a changeset does not exist
+var ErrChangesetNotFound = errors.New("changeset not found")
+
+// SubWorkflowStepType is the type of the steps that start another workflow.
+// They name the workflow with their workflow_id config, or with workflow_ref
+// when the workflow is created earlier in the same changeset.
+const SubWorkflowStepType = "sub_workflow"
+
+// OperationType is the kind of change an operation makes
+type OperationType string
+
+const (
+	OperationCreateWorkflow  OperationType = "create_workflow"
+	OperationCreateVersion   OperationType = "create_version"
+	OperationActivateVersion OperationType = "activate_version"
+	OperationUpdateConfig    OperationType = "update_config"
+	OperationCreateSchedule  OperationType = "create_schedule"
+)
+
+// Operation is a single change of a changeset. The workflow and version an
+// operation targets are given either by ID or by the ref of the operation
+// that creates them earlier in the changeset.
+type Operation struct {
+	Type OperationType `json:"type"`
+	// Ref names the workflow or version created by the operation so later
+	// operations can target it before it is persisted
+	Ref string `json:"ref,omitempty"`
+
+	WorkflowID  *uuid.UUID `json:"workflow_id,omitempty"`
+	WorkflowRef string     `json:"workflow_ref,omitempty"`
+	VersionID   *uuid.UUID `json:"version_id,omitempty"`
+	VersionRef  string     `json:"version_ref,omitempty"`
+
+	// Workflow is the workflow created by create_workflow
+	Workflow *models.Workflow `json:"workflow,omitempty"`
+	// Version is the version created by create_version
+	Version *models.WorkflowVersion `json:"version,omitempty"`
+	// Config replaces the workflow configuration in update_config
+	Config *models.WorkflowConfig `json:"config,omitempty"`
+	// Schedule is the schedule created by create_schedule
+	Schedule *scheduler.Schedule `json:"schedule,omitempty"`
+}
+
+// Request is a changeset submitted for validation or application
+type Request struct {
+	Description string      `json:"description"`
+	Author      string      `json:"author"`
+	Operations  []Operation `json:"operations"`
+}
+
+// OperationResult is the outcome of validating an operation. The IDs are
+// those of the workflow, version or schedule the operation creates or
+// changes, assigned before anything is persisted. Warnings are those of the
+// activation policies of activate_version operations.
+type OperationResult struct {
+	Index      int           `json:"index"`
+	Type       OperationType `json:"type"`
+	Ref        string        `json:"ref,omitempty"`
+	Valid      bool          `json:"valid"`
+	Errors     []string      `json:"errors,omitempty"`
+	Warnings   []string      `json:"warnings,omitempty"`
+	WorkflowID *uuid.UUID    `json:"workflow_id,omitempty"`
+	VersionID  *uuid.UUID    `json:"version_id,omitempty"`
+	ScheduleID *uuid.UUID    `json:"schedule_id,omitempty"`
+}
+
+func (r *OperationResult) fail(format string, args ...interface{}) {
+	r.Valid = false
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Changeset is the audit entry of an applied changeset. It groups the
+// operations applied together with their results.
+type Changeset struct {
+	ID          uuid.UUID         `json:"id" gorm:"type:uuid;primaryKey"`
+	Description string            `json:"description" gorm:"type:text"`
+	Author      string            `json:"author" gorm:"index"`
+	Operations  []Operation       `json:"operations" gorm:"type:jsonb;serializer:json"`
+	Results     []OperationResult `json:"results" gorm:"type:jsonb;serializer:json"`
+	AppliedAt   time.Time         `json:"applied_at" gorm:"index"`
+}
+
+// TableName returns the table name for the Changeset model
+func (Changeset) TableName() string {
+	return "changesets"
+}
+
+// ValidationError is returned when a changeset is rejected. It carries the
+// result of every operation.
+type ValidationError struct {
+	Results []OperationResult
+}
+
+// Error returns the error message, naming the first invalid operation
+func (e *ValidationError) Error() string {
+	for _, result := range e.Results {
+		if !result.Valid {
+			return fmt.Sprintf("invalid changeset: operation %d (%s): %s", result.Index, result.Type, result.Errors[0])
+		}
+	}
+	return ErrInvalidChangeset.Error()
+}
+
+// Unwrap returns ErrInvalidChangeset
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidChangeset
+}
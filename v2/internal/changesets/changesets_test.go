@@ -0,0 +1,531 @@
+package changesets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+func newDefinition(steps ...models.WorkflowStep) models.WorkflowDefinition {
+	return models.WorkflowDefinition{Spec: models.WorkflowSpec{Steps: steps}}
+}
+
+func httpStep(name string) models.WorkflowStep {
+	return models.WorkflowStep{Name: name, Type: "http", Config: map[string]interface{}{"url": "https://example.com/" + name}}
+}
+
+func subWorkflowStep(name string, config map[string]interface{}) models.WorkflowStep {
+	return models.WorkflowStep{Name: name, Type: SubWorkflowStepType, Config: config}
+}
+
+func newWorkflow(name string, steps ...models.WorkflowStep) *models.Workflow {
+	return &models.Workflow{
+		Name:       name,
+		Version:    "1.0.0",
+		Owner:      "payments",
+		CreatedBy:  "alice",
+		Definition: newDefinition(steps...),
+	}
+}
+
+func newVersion(version string, steps ...models.WorkflowStep) *models.WorkflowVersion {
+	return &models.WorkflowVersion{
+		Version:    version,
+		CreatedBy:  "alice",
+		Definition: newDefinition(steps...),
+	}
+}
+
+var (
+	checkoutID   = uuid.MustParse("3c6e0b2a-8f41-4d7e-a9c5-2b1d0e9f8a7c")
+	checkoutV1ID = uuid.MustParse("9a4f2e1d-6c3b-4a58-b7e0-5d2c1b0a9f8e")
+	missingID    = uuid.MustParse("5e7d9c1b-3a2f-4e60-8d4c-7b6a5f4e3d2c")
+)
+
+// newCheckoutStore returns a store holding the active checkout workflow,
+// its version 1.0.0 in production
+func newCheckoutStore(t *testing.T) *MemoryStore {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	checkout := newWorkflow("checkout", httpStep("reserve"), httpStep("charge"), httpStep("notify"))
+	checkout.ID = checkoutID
+	checkout.Status = models.WorkflowStatusActive
+	require.NoError(t, store.CreateWorkflow(ctx, checkout))
+	version := newVersion("1.0.0", checkout.Definition.Spec.Steps...)
+	version.ID = checkoutV1ID
+	version.WorkflowID = checkoutID
+	version.Status = models.VersionStatusProduction
+	require.NoError(t, store.CreateVersion(ctx, version))
+	return store
+}
+
+// newTestService returns a service applying changesets to store, with the
+// scheduler it creates schedules in
+func newTestService(store Store) (*Service, *scheduler.Service) {
+	schedules := scheduler.NewService(scheduler.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)), nil, logrus.New())
+	return NewService(store, schedules, logrus.New()), schedules
+}
+
+// extractBilling splits the charge step of the checkout workflow into a
+// billing workflow the new checkout version starts as a sub-workflow
+func extractBilling() *Request {
+	return &Request{
+		Description: "Extract billing from checkout",
+		Author:      "alice",
+		Operations: []Operation{
+			{Type: OperationCreateWorkflow, Ref: "billing", Workflow: newWorkflow("billing", httpStep("charge"))},
+			{Type: OperationCreateVersion, Ref: "billing-v1", WorkflowRef: "billing", Version: newVersion("1.0.0", httpStep("charge"))},
+			{Type: OperationActivateVersion, VersionRef: "billing-v1"},
+			{Type: OperationCreateVersion, Ref: "checkout-v2", WorkflowID: &checkoutID, Version: newVersion("2.0.0",
+				httpStep("reserve"),
+				subWorkflowStep("bill", map[string]interface{}{"workflow_ref": "billing"}),
+				httpStep("notify"),
+			)},
+			{Type: OperationActivateVersion, VersionRef: "checkout-v2"},
+			{Type: OperationUpdateConfig, WorkflowRef: "billing", Config: &models.WorkflowConfig{Timeout: "5m", MaxConcurrency: 10}},
+			{Type: OperationCreateSchedule, WorkflowRef: "billing", Schedule: &scheduler.Schedule{Name: "nightly-billing", CronExpression: "0 2 * * *"}},
+		},
+	}
+}
+
+func TestApplyChangeset(t *testing.T) {
+	ctx := context.Background()
+	store := newCheckoutStore(t)
+	service, schedules := newTestService(store)
+
+	changeset, err := service.Apply(ctx, extractBilling())
+	require.NoError(t, err)
+	require.Len(t, changeset.Results, 7)
+	for _, result := range changeset.Results {
+		assert.True(t, result.Valid, "operation %d: %v", result.Index, result.Errors)
+	}
+
+	billingID := *changeset.Results[0].WorkflowID
+	billing, err := store.GetWorkflow(ctx, billingID)
+	require.NoError(t, err)
+	assert.Equal(t, "billing", billing.Name)
+	assert.Equal(t, models.WorkflowStatusActive, billing.Status)
+	assert.Equal(t, "5m", billing.Config.Timeout)
+
+	t.Run("activates the new parent version", func(t *testing.T) {
+		parent, err := store.GetWorkflow(ctx, checkoutID)
+		require.NoError(t, err)
+		assert.Equal(t, "2.0.0", parent.Version)
+		require.Len(t, parent.Definition.Spec.Steps, 3)
+		assert.Equal(t, map[string]interface{}{"workflow_id": billingID.String()}, parent.Definition.Spec.Steps[1].Config)
+
+		previous, err := store.GetVersion(ctx, checkoutV1ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.VersionStatusDeprecated, previous.Status)
+
+		current, err := store.GetVersion(ctx, *changeset.Results[3].VersionID)
+		require.NoError(t, err)
+		assert.Equal(t, models.VersionStatusProduction, current.Status)
+	})
+
+	t.Run("creates the schedule", func(t *testing.T) {
+		schedules := schedules.ListSchedules()
+		require.Len(t, schedules, 1)
+		assert.Equal(t, billingID, schedules[0].WorkflowID)
+		assert.Equal(t, *changeset.Results[6].ScheduleID, schedules[0].ID)
+	})
+
+	t.Run("records one audit entry", func(t *testing.T) {
+		changesets, total, err := service.ListChangesets(ctx, 10, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, changeset.ID, changesets[0].ID)
+		assert.Equal(t, "alice", changesets[0].Author)
+		assert.Len(t, changesets[0].Operations, 7)
+		assert.False(t, changesets[0].AppliedAt.IsZero())
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	store := newCheckoutStore(t)
+	service, schedules := newTestService(store)
+
+	results, err := service.Validate(ctx, extractBilling())
+	require.NoError(t, err)
+	require.Len(t, results, 7)
+	for _, result := range results {
+		assert.True(t, result.Valid, "operation %d: %v", result.Index, result.Errors)
+	}
+
+	// Cross-references resolve to the IDs the operations would create
+	require.NotNil(t, results[0].WorkflowID)
+	assert.Equal(t, results[0].WorkflowID, results[1].WorkflowID)
+	assert.Equal(t, results[1].VersionID, results[2].VersionID)
+	assert.Equal(t, &checkoutID, results[3].WorkflowID)
+	assert.Equal(t, results[0].WorkflowID, results[6].WorkflowID)
+
+	_, err = store.GetWorkflow(ctx, *results[0].WorkflowID)
+	assert.Error(t, err, "dry run must not persist the workflow")
+	_, err = store.GetVersion(ctx, *results[3].VersionID)
+	assert.Error(t, err, "dry run must not persist the version")
+	parent, err := store.GetWorkflow(ctx, checkoutID)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", parent.Version)
+	assert.Empty(t, schedules.ListSchedules())
+	_, total, err := service.ListChangesets(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+}
+
+func TestInvalidPayloadTemplate(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newTestService(newCheckoutStore(t))
+
+	request := extractBilling()
+	request.Operations[5].Config.Webhooks = []models.Webhook{
+		{URL: "https://events.pagerduty.com/v2/enqueue", Template: &models.PayloadTemplate{Name: "pagerduty-v2"}},
+	}
+
+	results, err := service.Validate(ctx, request)
+	require.NoError(t, err)
+	require.Len(t, results, 7)
+	assert.False(t, results[5].Valid)
+	require.Len(t, results[5].Errors, 1)
+	assert.Contains(t, results[5].Errors[0], "webhooks[0].template")
+	assert.Contains(t, results[5].Errors[0], "routing_key param is required")
+}
+
+func TestRollbackOnInvalidOperation(t *testing.T) {
+	ctx := context.Background()
+	store := newCheckoutStore(t)
+	service, schedules := newTestService(store)
+
+	request := extractBilling()
+	missing := uuid.New()
+	// The billing workflow and version are written before the invalid
+	// activation is reached
+	request.Operations[4] = Operation{Type: OperationActivateVersion, VersionID: &missing}
+
+	_, err := service.Apply(ctx, request)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrInvalidChangeset))
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+	require.Len(t, invalid.Results, 7)
+	for i, result := range invalid.Results {
+		if i == 4 {
+			assert.False(t, result.Valid)
+			assert.Equal(t, []string{"version " + missing.String() + " does not exist"}, result.Errors)
+			continue
+		}
+		assert.True(t, result.Valid, "operation %d: %v", i, result.Errors)
+	}
+
+	_, err = store.GetWorkflowByName(ctx, "billing")
+	assert.Error(t, err, "the billing workflow must be rolled back")
+	versions, err := store.ListVersions(ctx, checkoutID)
+	require.NoError(t, err)
+	require.Len(t, versions, 1, "the checkout version must be rolled back")
+	assert.Equal(t, models.VersionStatusProduction, versions[0].Status)
+	assert.Empty(t, schedules.ListSchedules())
+	_, total, err := service.ListChangesets(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+}
+
+func TestActivationPolicies(t *testing.T) {
+	ctx := context.Background()
+	store := newCheckoutStore(t)
+	service, _ := newTestService(store)
+	policyStore := policies.NewMemoryStore()
+	manager := policies.NewManager(policyStore, policies.DefaultConfig(), logrus.New())
+	for _, policy := range []*policies.Policy{
+		{
+			Name:  "no-inline-notifications",
+			Hooks: []policies.Hook{policies.HookVersionActivation},
+			Rules: []policies.Rule{{
+				Decision: policies.DecisionDeny,
+				When:     `workflow.name == "checkout" && any(definition.spec.steps, step, step.name == "notify")`,
+				Reason:   "checkout must not notify inline",
+			}},
+		},
+		{
+			Name:  "billing-review",
+			Hooks: []policies.Hook{policies.HookVersionActivation},
+			Rules: []policies.Rule{{Decision: policies.DecisionWarn, When: `workflow.name == "billing"`, Reason: "billing changes need a review"}},
+		},
+	} {
+		policy.FailureMode = policies.FailClosed
+		policy.Enabled = true
+		_, err := manager.CreatePolicy(ctx, policy)
+		require.NoError(t, err)
+	}
+	service.SetPolicies(manager)
+
+	results, err := service.Validate(ctx, extractBilling())
+	require.NoError(t, err)
+	assert.True(t, results[2].Valid)
+	assert.Equal(t, []string{"billing-review: billing changes need a review"}, results[2].Warnings)
+	assert.False(t, results[4].Valid)
+	assert.Equal(t, []string{"denied by policy: no-inline-notifications: checkout must not notify inline"}, results[4].Errors)
+	decisions, err := policyStore.ListDecisions(ctx, policies.DecisionFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, decisions, "dry runs do not record decisions")
+
+	_, err = service.Apply(ctx, extractBilling())
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+	parent, err := store.GetWorkflow(ctx, checkoutID)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", parent.Version)
+	decisions, err = policyStore.ListDecisions(ctx, policies.DecisionFilter{Decision: policies.DecisionDeny})
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	assert.Equal(t, "alice", decisions[0].Actor)
+}
+
+// recordingGraph is a dependency graph where checkout closes a cycle and
+// the storefront workflow depends on checkout
+type recordingGraph struct {
+	checkoutID uuid.UUID
+	workflows  []string
+	versions   []string
+}
+
+func (g *recordingGraph) WorkflowCycles(ctx context.Context, workflow *models.Workflow) ([]string, error) {
+	return nil, nil
+}
+
+func (g *recordingGraph) VersionCycles(ctx context.Context, version *models.WorkflowVersion) ([]string, error) {
+	if version.WorkflowID == g.checkoutID {
+		return []string{"dependency cycle: checkout (steps.bill) -> billing (steps.refund) -> checkout"}, nil
+	}
+	return nil, nil
+}
+
+func (g *recordingGraph) DependentWarnings(ctx context.Context, workflowID uuid.UUID) ([]string, error) {
+	if workflowID == g.checkoutID {
+		return []string{"workflow storefront depends on checkout through its http reference at steps.checkout"}, nil
+	}
+	return nil, nil
+}
+
+func (g *recordingGraph) RecordWorkflow(ctx context.Context, workflow *models.Workflow) error {
+	g.workflows = append(g.workflows, workflow.Name)
+	return nil
+}
+
+func (g *recordingGraph) RecordVersion(ctx context.Context, version *models.WorkflowVersion) error {
+	g.versions = append(g.versions, version.Version)
+	return nil
+}
+
+func TestDependencies(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newTestService(newCheckoutStore(t))
+	graph := &recordingGraph{checkoutID: checkoutID}
+	service.SetDependencies(graph)
+
+	request := extractBilling()
+	request.Operations[3].Version.BreakingChanges = true
+	results, err := service.Validate(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dependency cycle: checkout (steps.bill) -> billing (steps.refund) -> checkout"}, results[3].Warnings)
+	assert.Equal(t, []string{"breaking changes: workflow storefront depends on checkout through its http reference at steps.checkout"}, results[4].Warnings)
+	assert.True(t, results[4].Valid, "dependents of breaking changes are warned about")
+	assert.Empty(t, graph.workflows, "dry runs record no dependencies")
+	assert.Empty(t, graph.versions)
+
+	_, err = service.Apply(ctx, extractBilling())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"billing"}, graph.workflows)
+	assert.Equal(t, []string{"1.0.0", "2.0.0"}, graph.versions)
+}
+
+// failingStore fails to record changesets, after every other write of the
+// transaction succeeded
+type failingStore struct {
+	*MemoryStore
+}
+
+func (s failingStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.MemoryStore.Transaction(ctx, func(tx Store) error {
+		return fn(failingStore{tx.(*MemoryStore)})
+	})
+}
+
+func (s failingStore) CreateChangeset(ctx context.Context, changeset *Changeset) error {
+	return errors.New("connection reset")
+}
+
+func TestRollbackOnStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	store := newCheckoutStore(t)
+	service, schedules := newTestService(failingStore{store})
+
+	_, err := service.Apply(ctx, extractBilling())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection reset")
+
+	_, err = store.GetWorkflowByName(ctx, "billing")
+	assert.Error(t, err)
+	assert.Empty(t, schedules.ListSchedules(), "schedules of a rolled back changeset are deleted")
+}
+
+func TestCrossReferences(t *testing.T) {
+	bill := subWorkflowStep("bill", map[string]interface{}{"workflow_ref": "billing"})
+	tests := map[string]struct {
+		operations []Operation
+		// errors lists the errors of each operation, none for valid ones
+		errors [][]string
+	}{
+		"sub-workflow created later": {
+			operations: []Operation{
+				{Type: OperationCreateVersion, WorkflowID: &checkoutID, Version: newVersion("2.0.0", bill)},
+				{Type: OperationCreateWorkflow, Ref: "billing", Workflow: newWorkflow("billing", httpStep("charge"))},
+			},
+			errors: [][]string{
+				{`step "bill": workflow ref "billing" is created by operation 1, not by an earlier one`},
+				nil,
+			},
+		},
+		"sub-workflow of an invalid operation": {
+			operations: []Operation{
+				{Type: OperationCreateWorkflow, Ref: "billing", Workflow: newWorkflow("checkout", httpStep("charge"))},
+				{Type: OperationCreateVersion, WorkflowID: &checkoutID, Version: newVersion("2.0.0", bill)},
+			},
+			errors: [][]string{
+				{`workflow "checkout" already exists as ` + checkoutID.String()},
+				{`step "bill": workflow ref "billing" is created by operation 0, which is invalid`},
+			},
+		},
+		"sub-workflow by ID": {
+			operations: []Operation{
+				{Type: OperationCreateWorkflow, Workflow: newWorkflow("refund",
+					subWorkflowStep("checkout", map[string]interface{}{"workflow_id": checkoutID.String()}),
+					subWorkflowStep("missing", map[string]interface{}{"workflow_id": missingID.String()}),
+					subWorkflowStep("unnamed", nil),
+				)},
+			},
+			errors: [][]string{{
+				`step "missing": workflow ` + missingID.String() + ` does not exist`,
+				`step "unnamed": workflow_id or workflow_ref is required`,
+			}},
+		},
+		"refs": {
+			operations: []Operation{
+				{Type: OperationCreateVersion, Ref: "v2", WorkflowID: &checkoutID, Version: newVersion("2.0.0", httpStep("charge"))},
+				{Type: OperationUpdateConfig, WorkflowRef: "v2", Config: &models.WorkflowConfig{}},
+				{Type: OperationActivateVersion, VersionRef: "unknown"},
+				{Type: OperationCreateVersion, Ref: "v2", WorkflowID: &checkoutID, Version: newVersion("3.0.0", httpStep("charge"))},
+				{Type: OperationUpdateConfig, Ref: "config", WorkflowID: &checkoutID, Config: &models.WorkflowConfig{}},
+				{Type: OperationUpdateConfig, WorkflowID: &checkoutID, WorkflowRef: "v2", Config: &models.WorkflowConfig{}},
+			},
+			errors: [][]string{
+				nil,
+				{`ref "v2" does not name a workflow`},
+				{`unknown version ref "unknown"`},
+				{`ref "v2" is already declared by operation 0`},
+				{"only create_workflow and create_version operations declare refs"},
+				{"workflow_id and workflow_ref are mutually exclusive"},
+			},
+		},
+		"validates against earlier operations": {
+			operations: []Operation{
+				{Type: OperationCreateVersion, WorkflowID: &checkoutID, Version: newVersion("2.0.0", httpStep("charge"))},
+				{Type: OperationCreateVersion, WorkflowID: &checkoutID, Version: newVersion("2.0.0", httpStep("charge"))},
+				{Type: OperationCreateSchedule, WorkflowID: &checkoutID, Schedule: &scheduler.Schedule{Name: "broken", CronExpression: "every day"}},
+			},
+			errors: [][]string{
+				nil,
+				{`workflow "checkout" already has version 2.0.0`},
+				{"invalid cron expression: cron expression must have 5 fields, got 2"},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			service, _ := newTestService(newCheckoutStore(t))
+			results, err := service.Validate(context.Background(), &Request{Author: "alice", Operations: tt.operations})
+			require.NoError(t, err)
+			require.Len(t, results, len(tt.errors))
+			for i, result := range results {
+				assert.Equal(t, tt.errors[i], result.Errors, "operation %d", i)
+				assert.Equal(t, tt.errors[i] == nil, result.Valid, "operation %d", i)
+			}
+		})
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service, _ := newTestService(newCheckoutStore(t))
+	router := gin.New()
+	NewHandlers(service).RegisterRoutes(router.Group("/api"))
+
+	post := func(path string, request *Request) *httptest.ResponseRecorder {
+		body, err := json.Marshal(request)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return recorder
+	}
+
+	invalid := extractBilling()
+	invalid.Operations[2].VersionRef = "billing"
+	rejected := map[string]struct {
+		request *Request
+		code    int
+		body    string
+	}{
+		"invalid": {request: invalid, code: http.StatusUnprocessableEntity, body: `ref \"billing\" does not name a version`},
+		"empty":   {request: &Request{}, code: http.StatusBadRequest},
+	}
+	for name, tt := range rejected {
+		t.Run(name, func(t *testing.T) {
+			recorder := post("/api/v1/changesets", tt.request)
+			require.Equal(t, tt.code, recorder.Code, recorder.Body.String())
+			assert.Contains(t, recorder.Body.String(), tt.body)
+		})
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		recorder := post("/api/v1/changesets?dry_run=true", extractBilling())
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var response struct {
+			Valid   bool              `json:"valid"`
+			Results []OperationResult `json:"results"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.True(t, response.Valid)
+		assert.Len(t, response.Results, 7)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		recorder := post("/api/v1/changesets", extractBilling())
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		var changeset Changeset
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &changeset))
+
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/changesets/"+changeset.ID.String(), nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/changesets/"+uuid.NewString(), nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
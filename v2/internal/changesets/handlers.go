@@ -0,0 +1,140 @@
+package changesets
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Handlers provides HTTP handlers for changesets
+type Handlers struct {
+	service *Service
+}
+
+// NewHandlers creates new changeset handlers
+func NewHandlers(service *Service) *Handlers {
+	return &Handlers{service: service}
+}
+
+// RegisterRoutes registers changeset routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		v1.POST("/changesets", h.ApplyChangeset)
+		v1.GET("/changesets", h.ListChangesets)
+		v1.GET("/changesets/:id", h.GetChangeset)
+	}
+}
+
+// ApplyChangeset validates and applies a changeset
+// @Summary Apply a changeset
+// @Description Applies an ordered list of operations in one transaction, all or nothing. With dry_run=true the operations are only validated.
+// @Tags changesets
+// @Accept json
+// @Produce json
+// @Param dry_run query bool false "Validate without applying"
+// @Param changeset body Request true "Changeset"
+// @Success 200 {object} map[string]interface{}
+// @Success 201 {object} Changeset
+// @Failure 400 {object} map[string]interface{}
+// @Failure 422 {object} map[string]interface{}
+// @Router /api/v1/changesets [post]
+func (h *Handlers) ApplyChangeset(c *gin.Context) {
+	var request Request
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if dryRun, _ := strconv.ParseBool(c.Query("dry_run")); dryRun {
+		results, err := h.service.Validate(c.Request.Context(), &request)
+		if err != nil {
+			h.handleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"valid": valid(results), "results": results})
+		return
+	}
+
+	changeset, err := h.service.Apply(c.Request.Context(), &request)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, changeset)
+}
+
+// ListChangesets lists the applied changesets
+// @Summary List changesets
+// @Tags changesets
+// @Produce json
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/changesets [get]
+func (h *Handlers) ListChangesets(c *gin.Context) {
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	offset := 0
+	if o, err := strconv.Atoi(c.Query("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	changesets, total, err := h.service.ListChangesets(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"changesets": changesets, "total": total})
+}
+
+// GetChangeset returns an applied changeset
+// @Summary Get a changeset
+// @Tags changesets
+// @Produce json
+// @Param id path string true "Changeset ID"
+// @Success 200 {object} Changeset
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/changesets/{id} [get]
+func (h *Handlers) GetChangeset(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid changeset ID"})
+		return
+	}
+
+	changeset, err := h.service.GetChangeset(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, changeset)
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "results": invalid.Results})
+	case errors.Is(err, ErrInvalidChangeset):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrChangesetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "changeset not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func valid(results []OperationResult) bool {
+	for _, result := range results {
+		if !result.Valid {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,757 @@
+package changesets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/payloads"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// Scheduler creates the schedules of changesets. The scheduler service
+// implements it.
+type Scheduler interface {
+	ValidateSchedule(schedule *scheduler.Schedule) error
+	CreateSchedule(schedule *scheduler.Schedule) (*scheduler.Schedule, error)
+	DeleteSchedule(id uuid.UUID) error
+}
+
+// ActivationPolicies evaluates the version activation policies. The
+// policies Manager implements it.
+type ActivationPolicies interface {
+	EvaluateActivation(ctx context.Context, request *policies.ActivationRequest) (*policies.Result, error)
+}
+
+// Dependencies checks changesets against the workflow dependency graph and
+// records the dependencies of the workflows and versions they create. The
+// dependencies Graph implements it.
+type Dependencies interface {
+	WorkflowCycles(ctx context.Context, workflow *models.Workflow) ([]string, error)
+	VersionCycles(ctx context.Context, version *models.WorkflowVersion) ([]string, error)
+	DependentWarnings(ctx context.Context, workflowID uuid.UUID) ([]string, error)
+	RecordWorkflow(ctx context.Context, workflow *models.Workflow) error
+	RecordVersion(ctx context.Context, version *models.WorkflowVersion) error
+}
+
+// Watch publishes the definition changes of applied changesets to the
+// watchers of workflow definitions. The watch Hub implements it.
+type Watch interface {
+	WorkflowCreated(ctx context.Context, workflow *models.Workflow)
+	VersionCreated(ctx context.Context, version *models.WorkflowVersion)
+	VersionActivated(ctx context.Context, version *models.WorkflowVersion)
+}
+
+// Service validates changesets as a whole and applies them atomically.
+//
+// A changeset runs its operations in order inside one transaction, each
+// operation validated against the changes of the operations before it. Dry
+// runs take the same path and always roll back, so they report exactly what
+// applying would. Schedules are not stored in the database; they are created
+// once every other operation succeeded and deleted again if the transaction
+// fails to commit.
+type Service struct {
+	store     Store
+	schedules Scheduler
+	policies  ActivationPolicies
+	// dependencies is consulted for the cycles and breaking changes of a
+	// changeset
+	dependencies Dependencies
+	watch        Watch
+	logger       *logrus.Logger
+	now          func() time.Time
+}
+
+// NewService creates a changeset service. schedules may be nil, in which
+// case create_schedule operations are rejected.
+func NewService(store Store, schedules Scheduler, logger *logrus.Logger) *Service {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &Service{
+		store:     store,
+		schedules: schedules,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// SetPolicies sets the version activation policies activate_version
+// operations are evaluated against. Operations the policies deny are
+// invalid.
+func (s *Service) SetPolicies(policies ActivationPolicies) {
+	s.policies = policies
+}
+
+// SetDependencies sets the dependency graph changesets are checked against.
+// Workflows and versions closing a dependency cycle, and activations of
+// versions with breaking changes that other workflows depend on, are valid
+// but warned about.
+func (s *Service) SetDependencies(dependencies Dependencies) {
+	s.dependencies = dependencies
+}
+
+// SetWatch sets where the workflows and versions created and the versions
+// activated by applied changesets are published
+func (s *Service) SetWatch(watch Watch) {
+	s.watch = watch
+}
+
+// Validate validates a changeset without applying it and returns the result
+// of every operation
+func (s *Service) Validate(ctx context.Context, request *Request) ([]OperationResult, error) {
+	changeset, err := s.run(ctx, request, true)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return invalid.Results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return changeset.Results, nil
+}
+
+// Apply validates a changeset and applies all of its operations, or none of
+// them. A rejected changeset returns a *ValidationError.
+func (s *Service) Apply(ctx context.Context, request *Request) (*Changeset, error) {
+	changeset, err := s.run(ctx, request, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"changeset_id": changeset.ID,
+		"author":       changeset.Author,
+		"operations":   len(changeset.Operations),
+	}).Info("Changeset applied")
+	return changeset, nil
+}
+
+// GetChangeset returns an applied changeset
+func (s *Service) GetChangeset(ctx context.Context, id uuid.UUID) (*Changeset, error) {
+	return s.store.GetChangeset(ctx, id)
+}
+
+// ListChangesets returns the applied changesets, most recent first
+func (s *Service) ListChangesets(ctx context.Context, limit, offset int) ([]*Changeset, int64, error) {
+	return s.store.ListChangesets(ctx, limit, offset)
+}
+
+func (s *Service) run(ctx context.Context, request *Request, dryRun bool) (*Changeset, error) {
+	if len(request.Operations) == 0 {
+		return nil, fmt.Errorf("%w: no operations", ErrInvalidChangeset)
+	}
+
+	changeset := &Changeset{
+		ID:          uuid.New(),
+		Description: request.Description,
+		Author:      request.Author,
+		Operations:  request.Operations,
+	}
+
+	var created []uuid.UUID
+	var applied *plan
+	err := s.store.Transaction(ctx, func(tx Store) error {
+		plan := newPlan(tx, s.schedules, request.Operations)
+		plan.policies = s.policies
+		plan.dependencies = s.dependencies
+		plan.author = request.Author
+		plan.dryRun = dryRun
+		changeset.Results = plan.apply(ctx)
+		if plan.err != nil {
+			return plan.err
+		}
+		for _, result := range changeset.Results {
+			if !result.Valid {
+				return &ValidationError{Results: changeset.Results}
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		applied = plan
+
+		for _, schedule := range plan.pending {
+			if _, err := s.schedules.CreateSchedule(schedule); err != nil {
+				return fmt.Errorf("failed to create schedule %q: %w", schedule.Name, err)
+			}
+			created = append(created, schedule.ID)
+		}
+
+		changeset.AppliedAt = s.now().UTC()
+		if err := tx.CreateChangeset(ctx, changeset); err != nil {
+			return fmt.Errorf("failed to record changeset: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, id := range created {
+			if err := s.schedules.DeleteSchedule(id); err != nil {
+				s.logger.WithError(err).WithField("schedule_id", id).Error("Failed to delete schedule of rolled back changeset")
+			}
+		}
+	}
+	if dryRun && errors.Is(err, errDryRun) {
+		return changeset, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.recordDependencies(ctx, applied)
+	s.publishChanges(ctx, applied)
+	return changeset, nil
+}
+
+// recordDependencies records the dependencies of the workflows and versions
+// of an applied changeset. The changeset is applied regardless of failures,
+// which are logged.
+func (s *Service) recordDependencies(ctx context.Context, plan *plan) {
+	if s.dependencies == nil {
+		return
+	}
+	for _, workflow := range plan.workflows {
+		if err := s.dependencies.RecordWorkflow(ctx, workflow); err != nil {
+			s.logger.WithError(err).WithField("workflow_id", workflow.ID).Error("Failed to record workflow dependencies")
+		}
+	}
+	for _, version := range plan.versions {
+		if err := s.dependencies.RecordVersion(ctx, version); err != nil {
+			s.logger.WithError(err).WithField("version_id", version.ID).Error("Failed to record version dependencies")
+		}
+	}
+}
+
+// publishChanges publishes the workflows and versions created and the
+// versions activated by an applied changeset
+func (s *Service) publishChanges(ctx context.Context, plan *plan) {
+	if s.watch == nil {
+		return
+	}
+	for _, workflow := range plan.workflows {
+		s.watch.WorkflowCreated(ctx, workflow)
+	}
+	for _, version := range plan.versions {
+		s.watch.VersionCreated(ctx, version)
+	}
+	for _, version := range plan.activated {
+		s.watch.VersionActivated(ctx, version)
+	}
+}
+
+// target is a workflow or version created by an operation of the changeset
+type target struct {
+	id       uuid.UUID
+	workflow bool
+}
+
+// plan applies the operations of a changeset to a transaction, recording
+// the result of each. Invalid operations are skipped so the operations
+// after them are still validated.
+type plan struct {
+	tx         Store
+	schedules  Scheduler
+	operations []Operation
+	// policies evaluates activations on behalf of author. The decisions of
+	// dry runs are not recorded.
+	policies ActivationPolicies
+	author   string
+	dryRun   bool
+	// dependencies warns about dependency cycles and breaking changes
+	dependencies Dependencies
+
+	refs map[string]target
+	// declared maps every ref to the operation declaring it, so references
+	// to later or failed operations are reported as such
+	declared map[string]int
+	failed   map[string]bool
+
+	// pending holds the schedules created once the other operations
+	// succeeded
+	pending []*scheduler.Schedule
+	// workflows and versions are those created, whose dependencies are
+	// recorded once the changeset is applied
+	workflows []*models.Workflow
+	versions  []*models.WorkflowVersion
+	// activated holds the versions put in production
+	activated []*models.WorkflowVersion
+	// err is a store failure, which aborts the changeset
+	err error
+}
+
+func newPlan(tx Store, schedules Scheduler, operations []Operation) *plan {
+	p := &plan{
+		tx:         tx,
+		schedules:  schedules,
+		operations: operations,
+		refs:       make(map[string]target),
+		declared:   make(map[string]int),
+		failed:     make(map[string]bool),
+	}
+	for i, op := range operations {
+		if _, exists := p.declared[op.Ref]; op.Ref != "" && !exists {
+			p.declared[op.Ref] = i
+		}
+	}
+	return p
+}
+
+func (p *plan) apply(ctx context.Context) []OperationResult {
+	results := make([]OperationResult, len(p.operations))
+	for i := range p.operations {
+		op := &p.operations[i]
+		result := &results[i]
+		*result = OperationResult{Index: i, Type: op.Type, Ref: op.Ref, Valid: true}
+
+		if op.Ref != "" && p.declared[op.Ref] != i {
+			result.fail("ref %q is already declared by operation %d", op.Ref, p.declared[op.Ref])
+		} else if op.Ref != "" && op.Type != OperationCreateWorkflow && op.Type != OperationCreateVersion {
+			result.fail("only create_workflow and create_version operations declare refs")
+		} else if p.err == nil {
+			p.applyOperation(ctx, i, op, result)
+		}
+
+		if !result.Valid && op.Ref != "" && p.declared[op.Ref] == i {
+			p.failed[op.Ref] = true
+		}
+	}
+	return results
+}
+
+func (p *plan) applyOperation(ctx context.Context, index int, op *Operation, result *OperationResult) {
+	switch op.Type {
+	case OperationCreateWorkflow:
+		p.createWorkflow(ctx, index, op, result)
+	case OperationCreateVersion:
+		p.createVersion(ctx, index, op, result)
+	case OperationActivateVersion:
+		p.activateVersion(ctx, index, op, result)
+	case OperationUpdateConfig:
+		p.updateConfig(ctx, index, op, result)
+	case OperationCreateSchedule:
+		p.createSchedule(ctx, index, op, result)
+	default:
+		result.fail("unknown operation type %q", op.Type)
+	}
+}
+
+func (p *plan) createWorkflow(ctx context.Context, index int, op *Operation, result *OperationResult) {
+	workflow := op.Workflow
+	if workflow == nil {
+		result.fail("workflow is required")
+		return
+	}
+	if err := workflow.Validate(); err != nil {
+		result.fail("%v", err)
+	}
+	if err := payloads.ValidateConfig(&workflow.Config); err != nil {
+		result.fail("%v", err)
+	}
+	if workflow.ID == uuid.Nil {
+		workflow.ID = uuid.New()
+	} else if _, err := p.tx.GetWorkflow(ctx, workflow.ID); err == nil {
+		result.fail("workflow %s already exists", workflow.ID)
+	} else if !p.check(err) {
+		return
+	}
+	if existing, err := p.tx.GetWorkflowByName(ctx, workflow.Name); err == nil {
+		result.fail("workflow %q already exists as %s", workflow.Name, existing.ID)
+	} else if !p.check(err) {
+		return
+	}
+	p.linkSubWorkflows(ctx, index, &workflow.Definition, result)
+	if !result.Valid {
+		return
+	}
+
+	if p.dependencies != nil {
+		warnings, err := p.dependencies.WorkflowCycles(ctx, workflow)
+		p.warn(warnings, err, result)
+	}
+
+	if workflow.Status == "" {
+		workflow.Status = models.WorkflowStatusDraft
+	}
+	if !p.write(p.tx.CreateWorkflow(ctx, workflow)) {
+		return
+	}
+	p.workflows = append(p.workflows, workflow)
+	result.WorkflowID = &workflow.ID
+	if op.Ref != "" {
+		p.refs[op.Ref] = target{id: workflow.ID, workflow: true}
+	}
+}
+
+func (p *plan) createVersion(ctx context.Context, index int, op *Operation, result *OperationResult) {
+	version := op.Version
+	if version == nil {
+		result.fail("version is required")
+		return
+	}
+	workflowID := op.WorkflowID
+	if workflowID == nil && op.WorkflowRef == "" && version.WorkflowID != uuid.Nil {
+		workflowID = &version.WorkflowID
+	}
+	workflow, ok := p.workflow(ctx, index, workflowID, op.WorkflowRef, result)
+	if !ok {
+		return
+	}
+	version.WorkflowID = workflow.ID
+	result.WorkflowID = &workflow.ID
+
+	if err := version.Validate(); err != nil {
+		result.fail("%v", err)
+	}
+	if version.ID == uuid.Nil {
+		version.ID = uuid.New()
+	} else if _, err := p.tx.GetVersion(ctx, version.ID); err == nil {
+		result.fail("version %s already exists", version.ID)
+	} else if !p.check(err) {
+		return
+	}
+	existing, err := p.tx.ListVersions(ctx, workflow.ID)
+	if !p.check(err) {
+		return
+	}
+	for _, other := range existing {
+		if other.Version == version.Version {
+			result.fail("workflow %q already has version %s", workflow.Name, version.Version)
+		}
+	}
+	p.linkSubWorkflows(ctx, index, &version.Definition, result)
+	if !result.Valid {
+		return
+	}
+
+	if p.dependencies != nil {
+		warnings, err := p.dependencies.VersionCycles(ctx, version)
+		p.warn(warnings, err, result)
+	}
+
+	if version.Status == "" {
+		version.Status = models.VersionStatusDevelopment
+	}
+	if !p.write(p.tx.CreateVersion(ctx, version)) {
+		return
+	}
+	p.versions = append(p.versions, version)
+	result.VersionID = &version.ID
+	if op.Ref != "" {
+		p.refs[op.Ref] = target{id: version.ID}
+	}
+}
+
+// activateVersion puts a version in production. The version becomes the
+// current definition of its workflow and the version it replaces is
+// deprecated.
+func (p *plan) activateVersion(ctx context.Context, index int, op *Operation, result *OperationResult) {
+	version, ok := p.version(ctx, index, op.VersionID, op.VersionRef, result)
+	if !ok {
+		return
+	}
+	result.VersionID = &version.ID
+
+	workflowID := &version.WorkflowID
+	if op.WorkflowID != nil || op.WorkflowRef != "" {
+		workflowID = op.WorkflowID
+	}
+	workflow, ok := p.workflow(ctx, index, workflowID, op.WorkflowRef, result)
+	if !ok {
+		return
+	}
+	result.WorkflowID = &workflow.ID
+	if workflow.ID != version.WorkflowID {
+		result.fail("version %s belongs to workflow %s", version.ID, version.WorkflowID)
+		return
+	}
+	p.linkSubWorkflows(ctx, index, &version.Definition, result)
+	if !result.Valid {
+		return
+	}
+	if !p.admitActivation(ctx, workflow, version, result) {
+		return
+	}
+	if p.dependencies != nil && version.BreakingChanges {
+		warnings, err := p.dependencies.DependentWarnings(ctx, workflow.ID)
+		for i := range warnings {
+			warnings[i] = "breaking changes: " + warnings[i]
+		}
+		p.warn(warnings, err, result)
+	}
+
+	versions, err := p.tx.ListVersions(ctx, workflow.ID)
+	if !p.check(err) {
+		return
+	}
+	for _, current := range versions {
+		if current.ID != version.ID && current.IsProduction() {
+			current.Status = models.VersionStatusDeprecated
+			if !p.write(p.tx.UpdateVersion(ctx, current)) {
+				return
+			}
+		}
+	}
+
+	version.Status = models.VersionStatusProduction
+	if !p.write(p.tx.UpdateVersion(ctx, version)) {
+		return
+	}
+
+	workflow.Version = version.Version
+	workflow.Definition = version.Definition
+	workflow.InputSchema = version.InputSchema
+	workflow.OutputSchema = version.OutputSchema
+	workflow.Status = models.WorkflowStatusActive
+	if p.write(p.tx.UpdateWorkflow(ctx, workflow)) {
+		p.activated = append(p.activated, version)
+	}
+}
+
+// admitActivation evaluates the activation policies of a version. It
+// reports whether they allow the activation, recording their warnings.
+func (p *plan) admitActivation(ctx context.Context, workflow *models.Workflow, version *models.WorkflowVersion, result *OperationResult) bool {
+	if p.policies == nil {
+		return true
+	}
+	decision, err := p.policies.EvaluateActivation(ctx, &policies.ActivationRequest{
+		Workflow: workflow,
+		Version:  version,
+		Actor:    p.author,
+		DryRun:   p.dryRun,
+	})
+	if err != nil {
+		result.fail("failed to evaluate activation policies: %v", err)
+		return false
+	}
+	if err := decision.Err(); err != nil {
+		result.fail("%v", err)
+		return false
+	}
+	result.Warnings = append(result.Warnings, decision.Reasons(policies.DecisionWarn)...)
+	return true
+}
+
+// warn records the warnings of the dependency graph. The graph failing to
+// answer does not invalidate the operation.
+func (p *plan) warn(warnings []string, err error, result *OperationResult) {
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("failed to check dependencies: %v", err))
+		return
+	}
+	result.Warnings = append(result.Warnings, warnings...)
+}
+
+func (p *plan) updateConfig(ctx context.Context, index int, op *Operation, result *OperationResult) {
+	if op.Config == nil {
+		result.fail("config is required")
+		return
+	}
+	workflow, ok := p.workflow(ctx, index, op.WorkflowID, op.WorkflowRef, result)
+	if !ok {
+		return
+	}
+	result.WorkflowID = &workflow.ID
+
+	if op.Config.Timeout != "" {
+		if _, err := time.ParseDuration(op.Config.Timeout); err != nil {
+			result.fail("invalid timeout %q", op.Config.Timeout)
+		}
+	}
+	if op.Config.MaxConcurrency < 0 {
+		result.fail("max_concurrency must not be negative")
+	}
+	if err := payloads.ValidateConfig(op.Config); err != nil {
+		result.fail("%v", err)
+	}
+	if !result.Valid {
+		return
+	}
+
+	workflow.Config = *op.Config
+	p.write(p.tx.UpdateWorkflow(ctx, workflow))
+}
+
+func (p *plan) createSchedule(ctx context.Context, index int, op *Operation, result *OperationResult) {
+	schedule := op.Schedule
+	if schedule == nil {
+		result.fail("schedule is required")
+		return
+	}
+	if p.schedules == nil {
+		result.fail("schedules are not available")
+		return
+	}
+	workflowID := op.WorkflowID
+	if workflowID == nil && op.WorkflowRef == "" && schedule.WorkflowID != uuid.Nil {
+		workflowID = &schedule.WorkflowID
+	}
+	workflow, ok := p.workflow(ctx, index, workflowID, op.WorkflowRef, result)
+	if !ok {
+		return
+	}
+	schedule.WorkflowID = workflow.ID
+	result.WorkflowID = &workflow.ID
+
+	if schedule.ID == uuid.Nil {
+		schedule.ID = uuid.New()
+	}
+	if err := p.schedules.ValidateSchedule(schedule); err != nil {
+		result.fail("%v", err)
+		return
+	}
+	for _, pending := range p.pending {
+		if pending.ID == schedule.ID {
+			result.fail("schedule %s is created twice", schedule.ID)
+			return
+		}
+	}
+	result.ScheduleID = &schedule.ID
+	p.pending = append(p.pending, schedule)
+}
+
+// linkSubWorkflows resolves the workflows started by the sub-workflow steps
+// of a definition. Refs are replaced by the ID of the workflow they name,
+// which must be created by an earlier operation.
+func (p *plan) linkSubWorkflows(ctx context.Context, index int, definition *models.WorkflowDefinition, result *OperationResult) {
+	for i := range definition.Spec.Steps {
+		step := &definition.Spec.Steps[i]
+		if step.Type != SubWorkflowStepType {
+			continue
+		}
+
+		if ref, ok := step.Config["workflow_ref"].(string); ok {
+			id, err := p.resolve(index, ref, true)
+			if err != nil {
+				result.fail("step %q: %v", step.Name, err)
+				continue
+			}
+			step.Config["workflow_id"] = id.String()
+			delete(step.Config, "workflow_ref")
+			continue
+		}
+
+		raw, _ := step.Config["workflow_id"].(string)
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			result.fail("step %q: workflow_id or workflow_ref is required", step.Name)
+			continue
+		}
+		if _, err := p.tx.GetWorkflow(ctx, id); errors.Is(err, gorm.ErrRecordNotFound) {
+			result.fail("step %q: workflow %s does not exist", step.Name, id)
+		} else if !p.check(err) {
+			return
+		}
+	}
+}
+
+// workflow loads the workflow an operation targets by ID or ref
+func (p *plan) workflow(ctx context.Context, index int, id *uuid.UUID, ref string, result *OperationResult) (*models.Workflow, bool) {
+	workflowID, ok := p.targetID(index, id, ref, true, result)
+	if !ok {
+		return nil, false
+	}
+	workflow, err := p.tx.GetWorkflow(ctx, workflowID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		result.fail("workflow %s does not exist", workflowID)
+		return nil, false
+	}
+	if !p.check(err) {
+		return nil, false
+	}
+	return workflow, true
+}
+
+// version loads the version an operation targets by ID or ref
+func (p *plan) version(ctx context.Context, index int, id *uuid.UUID, ref string, result *OperationResult) (*models.WorkflowVersion, bool) {
+	versionID, ok := p.targetID(index, id, ref, false, result)
+	if !ok {
+		return nil, false
+	}
+	version, err := p.tx.GetVersion(ctx, versionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		result.fail("version %s does not exist", versionID)
+		return nil, false
+	}
+	if !p.check(err) {
+		return nil, false
+	}
+	return version, true
+}
+
+func (p *plan) targetID(index int, id *uuid.UUID, ref string, workflow bool, result *OperationResult) (uuid.UUID, bool) {
+	kind := "version"
+	if workflow {
+		kind = "workflow"
+	}
+	switch {
+	case id != nil && ref != "":
+		result.fail("%s_id and %s_ref are mutually exclusive", kind, kind)
+		return uuid.Nil, false
+	case id != nil:
+		return *id, true
+	case ref != "":
+		resolved, err := p.resolve(index, ref, workflow)
+		if err != nil {
+			result.fail("%v", err)
+			return uuid.Nil, false
+		}
+		return resolved, true
+	default:
+		result.fail("%s_id or %s_ref is required", kind, kind)
+		return uuid.Nil, false
+	}
+}
+
+// resolve returns the ID of the workflow or version created under a ref by
+// an operation before index
+func (p *plan) resolve(index int, ref string, workflow bool) (uuid.UUID, error) {
+	kind := "version"
+	if workflow {
+		kind = "workflow"
+	}
+
+	declared, exists := p.declared[ref]
+	switch {
+	case !exists:
+		return uuid.Nil, fmt.Errorf("unknown %s ref %q", kind, ref)
+	case declared >= index:
+		return uuid.Nil, fmt.Errorf("%s ref %q is created by operation %d, not by an earlier one", kind, ref, declared)
+	case p.failed[ref]:
+		return uuid.Nil, fmt.Errorf("%s ref %q is created by operation %d, which is invalid", kind, ref, declared)
+	}
+
+	target := p.refs[ref]
+	if target.workflow != workflow {
+		return uuid.Nil, fmt.Errorf("ref %q does not name a %s", ref, kind)
+	}
+	return target.id, nil
+}
+
+// check records a store failure. It reports whether err is nil or a
+// missing record.
+func (p *plan) check(err error) bool {
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	}
+	if p.err == nil {
+		p.err = err
+	}
+	return false
+}
+
+// write records a failed write. It reports whether err is nil.
+func (p *plan) write(err error) bool {
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	return err == nil
+}
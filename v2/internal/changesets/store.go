@@ -0,0 +1,335 @@
+package changesets
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// Store reads and writes the workflows and versions changed by changesets,
+// and records the applied changesets. Missing workflows and versions are
+// reported as gorm.ErrRecordNotFound.
+type Store interface {
+	GetWorkflow(ctx context.Context, id uuid.UUID) (*models.Workflow, error)
+	GetWorkflowByName(ctx context.Context, name string) (*models.Workflow, error)
+	CreateWorkflow(ctx context.Context, workflow *models.Workflow) error
+	UpdateWorkflow(ctx context.Context, workflow *models.Workflow) error
+
+	GetVersion(ctx context.Context, id uuid.UUID) (*models.WorkflowVersion, error)
+	ListVersions(ctx context.Context, workflowID uuid.UUID) ([]*models.WorkflowVersion, error)
+	CreateVersion(ctx context.Context, version *models.WorkflowVersion) error
+	UpdateVersion(ctx context.Context, version *models.WorkflowVersion) error
+
+	CreateChangeset(ctx context.Context, changeset *Changeset) error
+	GetChangeset(ctx context.Context, id uuid.UUID) (*Changeset, error)
+	ListChangesets(ctx context.Context, limit, offset int) ([]*Changeset, int64, error)
+
+	// Transaction runs fn with a store whose writes are committed together
+	// when fn returns nil and discarded when it returns an error
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+}
+
+// MemoryStore is a Store kept in memory, for tests and development.
+// Transactions are serialized with each other but not with writes made
+// outside a transaction.
+type MemoryStore struct {
+	txMu       sync.Mutex
+	mu         sync.Mutex
+	workflows  map[uuid.UUID]models.Workflow
+	versions   map[uuid.UUID]models.WorkflowVersion
+	changesets []*Changeset
+}
+
+// NewMemoryStore creates an in-memory changeset store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		workflows: make(map[uuid.UUID]models.Workflow),
+		versions:  make(map[uuid.UUID]models.WorkflowVersion),
+	}
+}
+
+// GetWorkflow returns a workflow
+func (s *MemoryStore) GetWorkflow(ctx context.Context, id uuid.UUID) (*models.Workflow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workflow, ok := s.workflows[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &workflow, nil
+}
+
+// GetWorkflowByName returns the workflow with a name
+func (s *MemoryStore) GetWorkflowByName(ctx context.Context, name string) (*models.Workflow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, workflow := range s.workflows {
+		if workflow.Name == name {
+			return &workflow, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// CreateWorkflow stores a new workflow
+func (s *MemoryStore) CreateWorkflow(ctx context.Context, workflow *models.Workflow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if workflow.ID == uuid.Nil {
+		workflow.ID = uuid.New()
+	}
+	s.workflows[workflow.ID] = *workflow
+	return nil
+}
+
+// UpdateWorkflow saves a workflow
+func (s *MemoryStore) UpdateWorkflow(ctx context.Context, workflow *models.Workflow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workflows[workflow.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	s.workflows[workflow.ID] = *workflow
+	return nil
+}
+
+// GetVersion returns a workflow version
+func (s *MemoryStore) GetVersion(ctx context.Context, id uuid.UUID) (*models.WorkflowVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, ok := s.versions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &version, nil
+}
+
+// ListVersions returns the versions of a workflow, oldest first
+func (s *MemoryStore) ListVersions(ctx context.Context, workflowID uuid.UUID) ([]*models.WorkflowVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var versions []*models.WorkflowVersion
+	for _, version := range s.versions {
+		if version.WorkflowID == workflowID {
+			version := version
+			versions = append(versions, &version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].CreatedAt.Before(versions[j].CreatedAt) })
+	return versions, nil
+}
+
+// CreateVersion stores a new workflow version
+func (s *MemoryStore) CreateVersion(ctx context.Context, version *models.WorkflowVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version.ID == uuid.Nil {
+		version.ID = uuid.New()
+	}
+	s.versions[version.ID] = *version
+	return nil
+}
+
+// UpdateVersion saves a workflow version
+func (s *MemoryStore) UpdateVersion(ctx context.Context, version *models.WorkflowVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.versions[version.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	s.versions[version.ID] = *version
+	return nil
+}
+
+// CreateChangeset records an applied changeset
+func (s *MemoryStore) CreateChangeset(ctx context.Context, changeset *Changeset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.changesets = append(s.changesets, changeset)
+	return nil
+}
+
+// GetChangeset returns an applied changeset
+func (s *MemoryStore) GetChangeset(ctx context.Context, id uuid.UUID) (*Changeset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, changeset := range s.changesets {
+		if changeset.ID == id {
+			return changeset, nil
+		}
+	}
+	return nil, ErrChangesetNotFound
+}
+
+// ListChangesets returns the applied changesets, most recent first
+func (s *MemoryStore) ListChangesets(ctx context.Context, limit, offset int) ([]*Changeset, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changesets := make([]*Changeset, 0, len(s.changesets))
+	for i := len(s.changesets) - 1; i >= 0; i-- {
+		changesets = append(changesets, s.changesets[i])
+	}
+	total := int64(len(changesets))
+	if offset >= len(changesets) {
+		return []*Changeset{}, total, nil
+	}
+	changesets = changesets[offset:]
+	if limit > 0 && limit < len(changesets) {
+		changesets = changesets[:limit]
+	}
+	return changesets, total, nil
+}
+
+// Transaction runs fn on a copy of the store that replaces it when fn
+// returns nil
+func (s *MemoryStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	tx := NewMemoryStore()
+	for id, workflow := range s.workflows {
+		tx.workflows[id] = workflow
+	}
+	for id, version := range s.versions {
+		tx.versions[id] = version
+	}
+	tx.changesets = append(tx.changesets, s.changesets...)
+	s.mu.Unlock()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workflows = tx.workflows
+	s.versions = tx.versions
+	s.changesets = tx.changesets
+	return nil
+}
+
+// GormStore applies changesets to the workflow and version tables and
+// records them next to them, all in one database transaction
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database changeset store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the changeset table
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Changeset{})
+}
+
+// GetWorkflow returns a workflow
+func (s *GormStore) GetWorkflow(ctx context.Context, id uuid.UUID) (*models.Workflow, error) {
+	var workflow models.Workflow
+	if err := s.db.WithContext(ctx).First(&workflow, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// GetWorkflowByName returns the workflow with a name
+func (s *GormStore) GetWorkflowByName(ctx context.Context, name string) (*models.Workflow, error) {
+	var workflow models.Workflow
+	if err := s.db.WithContext(ctx).First(&workflow, "name = ?", name).Error; err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// CreateWorkflow stores a new workflow
+func (s *GormStore) CreateWorkflow(ctx context.Context, workflow *models.Workflow) error {
+	return s.db.WithContext(ctx).Create(workflow).Error
+}
+
+// UpdateWorkflow saves a workflow
+func (s *GormStore) UpdateWorkflow(ctx context.Context, workflow *models.Workflow) error {
+	return s.db.WithContext(ctx).Save(workflow).Error
+}
+
+// GetVersion returns a workflow version
+func (s *GormStore) GetVersion(ctx context.Context, id uuid.UUID) (*models.WorkflowVersion, error) {
+	var version models.WorkflowVersion
+	if err := s.db.WithContext(ctx).First(&version, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// ListVersions returns the versions of a workflow, oldest first
+func (s *GormStore) ListVersions(ctx context.Context, workflowID uuid.UUID) ([]*models.WorkflowVersion, error) {
+	var versions []*models.WorkflowVersion
+	err := s.db.WithContext(ctx).Where("workflow_id = ?", workflowID).Order("created_at").Find(&versions).Error
+	return versions, err
+}
+
+// CreateVersion stores a new workflow version
+func (s *GormStore) CreateVersion(ctx context.Context, version *models.WorkflowVersion) error {
+	return s.db.WithContext(ctx).Create(version).Error
+}
+
+// UpdateVersion saves a workflow version
+func (s *GormStore) UpdateVersion(ctx context.Context, version *models.WorkflowVersion) error {
+	return s.db.WithContext(ctx).Save(version).Error
+}
+
+// CreateChangeset records an applied changeset
+func (s *GormStore) CreateChangeset(ctx context.Context, changeset *Changeset) error {
+	return s.db.WithContext(ctx).Create(changeset).Error
+}
+
+// GetChangeset returns an applied changeset
+func (s *GormStore) GetChangeset(ctx context.Context, id uuid.UUID) (*Changeset, error) {
+	var changeset Changeset
+	err := s.db.WithContext(ctx).First(&changeset, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrChangesetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &changeset, nil
+}
+
+// ListChangesets returns the applied changesets, most recent first
+func (s *GormStore) ListChangesets(ctx context.Context, limit, offset int) ([]*Changeset, int64, error) {
+	var changesets []*Changeset
+	var total int64
+
+	query := s.db.WithContext(ctx).Model(&Changeset{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Limit(limit).Offset(offset).Order("applied_at DESC").Find(&changesets).Error
+	return changesets, total, err
+}
+
+// Transaction runs fn in a database transaction
+func (s *GormStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormStore{db: tx})
+	})
+}
@@ -0,0 +1,408 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// ExampleInput generates an example workflow input from its input schema.
+// Values honour the default, examples, enum and format of each property and
+// fall back to a value of the property's type. Schemas without properties
+// get a placeholder input.
+func ExampleInput(schema models.JSONSchema) map[string]interface{} {
+	if len(schema.Properties) == 0 {
+		return map[string]interface{}{"key": "value"}
+	}
+
+	input := make(map[string]interface{}, len(schema.Properties))
+	for name, property := range schema.Properties {
+		input[name] = exampleValue(name, property)
+	}
+	return input
+}
+
+// WorkflowExampleInput returns the example input shown in the docs of a
+// workflow: the input of its first stored example, validated against its
+// inputs when the version was published, or one generated from its input
+// schema.
+func WorkflowExampleInput(workflow *models.Workflow) map[string]interface{} {
+	for _, example := range workflow.Definition.Spec.Examples {
+		if len(example.Input) > 0 {
+			return example.Input
+		}
+	}
+	return ExampleInput(workflow.InputSchema)
+}
+
+// exampleValue generates an example value for a property schema
+func exampleValue(name string, property interface{}) interface{} {
+	schema, _ := property.(map[string]interface{})
+
+	if value, exists := schema["default"]; exists {
+		return value
+	}
+	if value, exists := schema["const"]; exists {
+		return value
+	}
+	if examples, ok := schema["examples"].([]interface{}); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	switch schemaType(schema) {
+	case "object":
+		properties, _ := schema["properties"].(map[string]interface{})
+		object := make(map[string]interface{}, len(properties))
+		for key, value := range properties {
+			object[key] = exampleValue(key, value)
+		}
+		return object
+	case "array":
+		count := 1
+		if minItems, ok := numberValue(schema["minItems"]); ok && int(minItems) > count {
+			count = int(minItems)
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			items[i] = exampleValue(name, schema["items"])
+		}
+		return items
+	case "integer":
+		return int64(clamp(schema, 1))
+	case "number":
+		return clamp(schema, 9.99)
+	case "boolean":
+		return true
+	case "null":
+		return nil
+	default:
+		return exampleString(name, schema)
+	}
+}
+
+// schemaType returns the type of a schema, inferring it when missing. Type
+// unions use their first non-null type.
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, candidate := range t {
+			if s, ok := candidate.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	if _, ok := schema["items"]; ok {
+		return "array"
+	}
+	return "string"
+}
+
+// exampleString generates a string from the format of the schema or, when
+// it has none, from the property name
+func exampleString(name string, schema map[string]interface{}) string {
+	format, _ := schema["format"].(string)
+	lowerName := strings.ToLower(name)
+
+	var value string
+	switch {
+	case format == "email" || strings.Contains(lowerName, "email"):
+		value = "jane.doe@example.com"
+	case format == "uri" || format == "url" || strings.HasSuffix(lowerName, "url") || strings.HasSuffix(lowerName, "uri"):
+		value = "https://example.com"
+	case format == "date-time":
+		value = "2024-01-15T09:30:00Z"
+	case format == "date":
+		value = "2024-01-15"
+	case format == "time":
+		value = "09:30:00"
+	case format == "uuid":
+		value = "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case format == "ipv4":
+		value = "192.0.2.1"
+	case format == "hostname":
+		value = "example.com"
+	case lowerName == "id" || strings.HasSuffix(lowerName, "_id") || strings.HasSuffix(name, "Id"):
+		prefix := strings.Join(splitWords(name[:len(name)-2]), "-")
+		if prefix == "" {
+			prefix = "id"
+		}
+		value = prefix + "-123"
+	case strings.HasSuffix(lowerName, "name"):
+		value = "Jane Doe"
+	default:
+		value = "example " + strings.Join(splitWords(name), " ")
+	}
+
+	if minLength, ok := numberValue(schema["minLength"]); ok && len(value) < int(minLength) {
+		value += strings.Repeat("x", int(minLength)-len(value))
+	}
+	if maxLength, ok := numberValue(schema["maxLength"]); ok && len(value) > int(maxLength) {
+		value = value[:int(maxLength)]
+	}
+	return value
+}
+
+// clamp moves a value into the minimum and maximum of the schema
+func clamp(schema map[string]interface{}, value float64) float64 {
+	if minimum, ok := numberValue(schema["minimum"]); ok && value < minimum {
+		value = minimum
+	}
+	if minimum, ok := numberValue(schema["exclusiveMinimum"]); ok && value <= minimum {
+		value = minimum + 1
+	}
+	if maximum, ok := numberValue(schema["maximum"]); ok && value > maximum {
+		value = maximum
+	}
+	if maximum, ok := numberValue(schema["exclusiveMaximum"]); ok && value >= maximum {
+		value = maximum - 1
+	}
+	return value
+}
+
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// literalStyle describes how a language writes value literals
+type literalStyle struct {
+	mapOpen, mapClose   string
+	listOpen, listClose string
+	indent              string
+	trailingComma       bool
+	null, yes, no       string
+	entry               func(key, value string) string
+	str                 func(string) string
+	// emptyMap is the literal of an empty map when it is not mapOpen
+	// followed by mapClose
+	emptyMap string
+}
+
+var goLiteralStyle = literalStyle{
+	mapOpen: "map[string]interface{}{", mapClose: "}",
+	listOpen: "[]interface{}{", listClose: "}",
+	indent: "\t", trailingComma: true,
+	null: "nil", yes: "true", no: "false",
+	entry: func(key, value string) string { return strconv.Quote(key) + ": " + value },
+	str:   strconv.Quote,
+}
+
+var pythonLiteralStyle = literalStyle{
+	mapOpen: "{", mapClose: "}",
+	listOpen: "[", listClose: "]",
+	indent: "    ",
+	null:   "None", yes: "True", no: "False",
+	entry: func(key, value string) string { return jsonQuote(key) + ": " + value },
+	str:   jsonQuote,
+}
+
+var typeScriptIdentifier = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+
+var typeScriptLiteralStyle = literalStyle{
+	mapOpen: "{", mapClose: "}",
+	listOpen: "[", listClose: "]",
+	indent: "  ",
+	null:   "null", yes: "true", no: "false",
+	entry: func(key, value string) string {
+		if !typeScriptIdentifier.MatchString(key) {
+			key = singleQuote(key)
+		}
+		return key + ": " + value
+	},
+	str: singleQuote,
+}
+
+var javaLiteralStyle = literalStyle{
+	mapOpen: "Map.ofEntries(", mapClose: ")",
+	listOpen: "List.of(", listClose: ")",
+	indent: "    ",
+	null:   "null", yes: "true", no: "false",
+	entry: func(key, value string) string { return "Map.entry(" + strconv.Quote(key) + ", " + value + ")" },
+	str:   strconv.Quote,
+}
+
+var kotlinLiteralStyle = literalStyle{
+	mapOpen: "mapOf<String, Any?>(", mapClose: ")",
+	listOpen: "listOf<Any?>(", listClose: ")",
+	indent: "    ", trailingComma: true,
+	null: "null", yes: "true", no: "false",
+	entry: func(key, value string) string { return kotlinQuote(key) + " to " + value },
+	str:   kotlinQuote,
+}
+
+var swiftLiteralStyle = literalStyle{
+	mapOpen: "[", mapClose: "]", emptyMap: "[:]",
+	listOpen: "[", listClose: "]",
+	indent: "    ", trailingComma: true,
+	null: "nil", yes: "true", no: "false",
+	entry: func(key, value string) string { return swiftQuote(key) + ": " + value },
+	str:   swiftQuote,
+}
+
+var rubyLiteralStyle = literalStyle{
+	mapOpen: "{", mapClose: "}",
+	listOpen: "[", listClose: "]",
+	indent: "  ", trailingComma: true,
+	null: "nil", yes: "true", no: "false",
+	entry: func(key, value string) string { return rubyQuote(key) + " => " + value },
+	str:   rubyQuote,
+}
+
+// GoLiteral renders a value as a Go literal. Multi-line literals are
+// indented from indent, the indentation of the line the literal starts on.
+func GoLiteral(value interface{}, indent string) string {
+	return goLiteralStyle.render(value, indent)
+}
+
+// PythonLiteral renders a value as a Python literal
+func PythonLiteral(value interface{}, indent string) string {
+	return pythonLiteralStyle.render(value, indent)
+}
+
+// TypeScriptLiteral renders a value as a TypeScript literal
+func TypeScriptLiteral(value interface{}, indent string) string {
+	return typeScriptLiteralStyle.render(value, indent)
+}
+
+// JavaLiteral renders a value as a Java expression built from Map.ofEntries
+// and List.of
+func JavaLiteral(value interface{}, indent string) string {
+	return javaLiteralStyle.render(value, indent)
+}
+
+// KotlinLiteral renders a value as a Kotlin expression built from mapOf and
+// listOf
+func KotlinLiteral(value interface{}, indent string) string {
+	return kotlinLiteralStyle.render(value, indent)
+}
+
+// SwiftLiteral renders a value as a Swift literal of JSONValues
+func SwiftLiteral(value interface{}, indent string) string {
+	return swiftLiteralStyle.render(value, indent)
+}
+
+// RubyLiteral renders a value as a Ruby literal of hashes with string keys
+func RubyLiteral(value interface{}, indent string) string {
+	return rubyLiteralStyle.render(value, indent)
+}
+
+func (s literalStyle) render(value interface{}, indent string) string {
+	switch v := value.(type) {
+	case nil:
+		return s.null
+	case bool:
+		if v {
+			return s.yes
+		}
+		return s.no
+	case string:
+		return s.str(v)
+	case map[string]interface{}:
+		if len(v) == 0 {
+			if s.emptyMap != "" {
+				return s.emptyMap
+			}
+			return s.mapOpen + s.mapClose
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		entries := make([]string, len(keys))
+		for i, key := range keys {
+			entries[i] = indent + s.indent + s.entry(key, s.render(v[key], indent+s.indent))
+		}
+		closing := "\n"
+		if s.trailingComma {
+			closing = ",\n"
+		}
+		return s.mapOpen + "\n" + strings.Join(entries, ",\n") + closing + indent + s.mapClose
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = s.render(item, indent)
+		}
+		return s.listOpen + strings.Join(items, ", ") + s.listClose
+	default:
+		if number, ok := numberValue(v); ok {
+			return strconv.FormatFloat(number, 'f', -1, 64)
+		}
+		return s.str(fmt.Sprint(v))
+	}
+}
+
+func jsonQuote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func singleQuote(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
+	return "'" + replacer.Replace(s) + "'"
+}
+
+// kotlinQuote quotes a Kotlin string literal, escaping the $ of string
+// templates
+func kotlinQuote(s string) string {
+	return strings.ReplaceAll(jsonQuote(s), "$", `\$`)
+}
+
+// swiftQuote quotes a Swift string literal. Swift writes unicode escapes as
+// \u{...} rather than the \uXXXX of JSON.
+func swiftQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u{%x}`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// rubyQuote quotes a double quoted Ruby string literal, escaping the # of
+// interpolations
+func rubyQuote(s string) string {
+	return strings.ReplaceAll(jsonQuote(s), "#", `\#`)
+}
@@ -0,0 +1,191 @@
+package codegen
+
+import (
+	"encoding/json"
+	"go/parser"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func newOrderInputSchema(t *testing.T) models.JSONSchema {
+	var schema models.JSONSchema
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["customer_id", "items"],
+		"properties": {
+			"customer_id": {"type": "string"},
+			"email": {"type": "string", "format": "email"},
+			"priority": {"type": "string", "enum": ["standard", "express"]},
+			"quantity": {"type": "integer", "minimum": 5, "maximum": 10},
+			"discount": {"type": "number", "maximum": 0.5},
+			"gift": {"type": "boolean"},
+			"currency": {"type": "string", "default": "EUR"},
+			"note": {"type": ["string", "null"], "maxLength": 8},
+			"items": {
+				"type": "array",
+				"minItems": 2,
+				"items": {
+					"type": "object",
+					"properties": {
+						"sku": {"type": "string"},
+						"price": {"type": "number"}
+					}
+				}
+			}
+		}
+	}`), &schema))
+	return schema
+}
+
+// matchesSchema reports whether a decoded JSON value has the types the
+// schema declares
+func matchesSchema(t *testing.T, path string, value interface{}, schema map[string]interface{}) {
+	switch schemaType(schema) {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		require.True(t, ok, "%s: expected object, got %T", path, value)
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, property := range properties {
+			matchesSchema(t, path+"."+key, object[key], property.(map[string]interface{}))
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		require.True(t, ok, "%s: expected array, got %T", path, value)
+		for _, item := range items {
+			matchesSchema(t, path+"[]", item, schema["items"].(map[string]interface{}))
+		}
+	case "integer":
+		number, ok := value.(float64)
+		require.True(t, ok, "%s: expected integer, got %T", path, value)
+		assert.Equal(t, float64(int64(number)), number, path)
+	case "number":
+		_, ok := value.(float64)
+		assert.True(t, ok, "%s: expected number, got %T", path, value)
+	case "boolean":
+		_, ok := value.(bool)
+		assert.True(t, ok, "%s: expected boolean, got %T", path, value)
+	default:
+		_, ok := value.(string)
+		assert.True(t, ok, "%s: expected string, got %T", path, value)
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		assert.Contains(t, enum, value, path)
+	}
+}
+
+func TestExampleInput(t *testing.T) {
+	schema := newOrderInputSchema(t)
+	example := ExampleInput(schema)
+
+	// Round trip through JSON so the example is checked as the API sees it
+	data, err := json.Marshal(example)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	matchesSchema(t, "input", decoded, map[string]interface{}{
+		"type":       schema.Type,
+		"properties": schema.Properties,
+	})
+
+	assert.Equal(t, "customer-123", example["customer_id"])
+	assert.Equal(t, "jane.doe@example.com", example["email"])
+	assert.Equal(t, "standard", example["priority"])
+	assert.Equal(t, int64(5), example["quantity"])
+	assert.Equal(t, 0.5, example["discount"])
+	assert.Equal(t, "EUR", example["currency"])
+	assert.Len(t, example["note"], 8)
+	assert.Len(t, example["items"], 2)
+
+	t.Run("placeholder without schema", func(t *testing.T) {
+		assert.Equal(t, map[string]interface{}{"key": "value"}, ExampleInput(models.JSONSchema{}))
+	})
+}
+
+func TestExampleLiterals(t *testing.T) {
+	example := ExampleInput(newOrderInputSchema(t))
+
+	t.Run("go", func(t *testing.T) {
+		literal := GoLiteral(example, "\t")
+		_, err := parser.ParseExpr(literal)
+		require.NoError(t, err, literal)
+		assert.Contains(t, literal, "\t\t\"customer_id\": \"customer-123\",\n")
+	})
+
+	t.Run("typescript", func(t *testing.T) {
+		literal := TypeScriptLiteral(map[string]interface{}{"order-id": "o'1", "count": int64(2)}, "")
+		assert.Equal(t, "{\n  count: 2,\n  'order-id': 'o\\'1'\n}", literal)
+	})
+
+	t.Run("java", func(t *testing.T) {
+		literal := JavaLiteral(map[string]interface{}{"tags": []interface{}{"a"}, "gift": true}, "")
+		assert.Equal(t, "Map.ofEntries(\n    Map.entry(\"gift\", true),\n    Map.entry(\"tags\", List.of(\"a\"))\n)", literal)
+	})
+
+	t.Run("kotlin", func(t *testing.T) {
+		literal := KotlinLiteral(map[string]interface{}{"price": "$5", "tags": []interface{}{"a", nil}}, "")
+		assert.Equal(t, "mapOf<String, Any?>(\n    \"price\" to \"\\$5\",\n    \"tags\" to listOf<Any?>(\"a\", null),\n)", literal)
+	})
+
+	t.Run("swift", func(t *testing.T) {
+		literal := SwiftLiteral(map[string]interface{}{"note": "a\"b", "tags": []interface{}{"a", nil}, "meta": map[string]interface{}{}}, "")
+		assert.Equal(t, "[\n    \"meta\": [:],\n    \"note\": \"a\\\"b\",\n    \"tags\": [\"a\", nil],\n]", literal)
+	})
+
+	t.Run("ruby", func(t *testing.T) {
+		literal := RubyLiteral(map[string]interface{}{"note": "#{x}", "tags": []interface{}{"a", nil}, "meta": map[string]interface{}{}}, "")
+		assert.Equal(t, "{\n  \"meta\" => {},\n  \"note\" => \"\\#{x}\",\n  \"tags\" => [\"a\", nil],\n}", literal)
+	})
+
+	t.Run("python", func(t *testing.T) {
+		literal := PythonLiteral(example, "")
+		assert.Contains(t, literal, `"gift": True`)
+
+		assert.NoError(t, CheckSyntax([]GeneratedFile{{Path: "example.py", Content: "example = " + literal + "\n"}}))
+	})
+}
+
+func TestGeneratedUsageUsesExampleInput(t *testing.T) {
+	workflow := &models.Workflow{ID: uuid.New(), Name: "orders", InputSchema: newOrderInputSchema(t)}
+
+	result, err := NewCodeGenerator().Generate(workflow, &GenerationRequest{
+		WorkflowID:     workflow.ID,
+		Language:       LanguageGo,
+		IncludeTests:   true,
+		ValidateOutput: true,
+	})
+	require.NoError(t, err)
+
+	var readme, test string
+	for _, file := range result.Files {
+		switch filepath.Base(file.Path) {
+		case "README.md":
+			readme = file.Content
+		case "client_test.go":
+			test = file.Content
+		}
+	}
+
+	for name, content := range map[string]string{"README.md": readme, "client_test.go": test} {
+		assert.Contains(t, content, `"customer_id": "customer-123",`, name)
+		assert.Contains(t, content, `"priority": "standard",`, name)
+		assert.NotContains(t, content, `"key": "value"`, name)
+	}
+}
+
+func TestWorkflowExampleInput(t *testing.T) {
+	workflow := &models.Workflow{Name: "orders", InputSchema: newOrderInputSchema(t)}
+	assert.Equal(t, ExampleInput(workflow.InputSchema), WorkflowExampleInput(workflow))
+
+	workflow.Definition.Spec.Examples = []models.WorkflowExample{
+		{Name: "empty"},
+		{Name: "paid order", Input: map[string]interface{}{"customer_id": "c-42"}},
+	}
+	assert.Equal(t, map[string]interface{}{"customer_id": "c-42"}, WorkflowExampleInput(workflow))
+}
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/google/uuid"
 
+	"magic-flow/v2/internal/branding"
 	"magic-flow/v2/pkg/models"
 )
 
@@ -21,6 +23,10 @@ const (
 	LanguageTypeScript Language = "typescript"
 	LanguagePython     Language = "python"
 	LanguageJava       Language = "java"
+	LanguageKotlin     Language = "kotlin"
+	LanguageSwift      Language = "swift"
+	LanguageRuby       Language = "ruby"
+	LanguageGRPC       Language = "grpc"
 )
 
 // GenerationRequest represents a code generation request
@@ -31,7 +37,22 @@ type GenerationRequest struct {
 	Namespace    string    `json:"namespace,omitempty"`
 	OutputDir    string    `json:"output_dir,omitempty"`
 	IncludeTests bool      `json:"include_tests,omitempty"`
-	Options      map[string]interface{} `json:"options,omitempty"`
+	// ValidateOutput runs a syntax check over the generated files and fails
+	// the generation if any of them does not parse
+	ValidateOutput bool `json:"validate_output,omitempty"`
+	// Naming overrides the casing of generated method and field names
+	Naming *NamingConvention `json:"naming_convention,omitempty"`
+	// VersionID pins the generated client to a historical version of the
+	// workflow instead of its current definition
+	VersionID *uuid.UUID `json:"version_id,omitempty"`
+	// Existing holds the previously generated files of the client as they
+	// are in the user's project, keyed by path. Config files such as pom.xml
+	// or package.json are merged with it instead of overwritten.
+	Existing map[string]ExistingFile `json:"existing_files,omitempty"`
+	// Locale overrides the default locale of the workflow namespace's
+	// branding profile for the generated README
+	Locale  string                 `json:"locale,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
 }
 
 // GenerationResult represents the result of code generation
@@ -46,6 +67,36 @@ type GenerationResult struct {
 	Error       string                 `json:"error,omitempty"`
 }
 
+// MultiGenerationResult groups the results of generating several languages
+// in one call. Languages that failed are listed in Errors instead of Results.
+type MultiGenerationResult struct {
+	WorkflowID  uuid.UUID                      `json:"workflow_id"`
+	Results     map[Language]*GenerationResult `json:"results"`
+	Errors      map[Language]string            `json:"errors,omitempty"`
+	GeneratedAt time.Time                      `json:"generated_at"`
+	Status      string                         `json:"status"` // "success", "partial" or "failed"
+}
+
+// MultiGenerationError reports the languages that failed in GenerateMulti
+type MultiGenerationError struct {
+	Errors map[Language]error
+}
+
+// Error implements the error interface
+func (e *MultiGenerationError) Error() string {
+	languages := make([]string, 0, len(e.Errors))
+	for language := range e.Errors {
+		languages = append(languages, string(language))
+	}
+	sort.Strings(languages)
+
+	messages := make([]string, 0, len(languages))
+	for _, language := range languages {
+		messages = append(messages, fmt.Sprintf("%s: %v", language, e.Errors[Language(language)]))
+	}
+	return fmt.Sprintf("code generation failed for %d language(s): %s", len(messages), strings.Join(messages, "; "))
+}
+
 // GeneratedFile represents a generated code file
 type GeneratedFile struct {
 	Path     string `json:"path"`
@@ -56,15 +107,21 @@ type GeneratedFile struct {
 
 // TemplateData represents data passed to templates
 type TemplateData struct {
-	Workflow    *models.Workflow
-	PackageName string
-	Namespace   string
-	ClassName   string
-	Imports     []string
-	Methods     []MethodData
-	Models      []ModelData
-	Options     map[string]interface{}
-	GeneratedAt time.Time
+	Workflow     *models.Workflow
+	PackageName  string
+	Namespace    string
+	ClassName    string
+	Imports      []string
+	Methods      []MethodData
+	Models       []ModelData
+	Options      map[string]interface{}
+	GeneratedAt  time.Time
+	// ExampleInput is an example workflow input generated from the input
+	// schema, used in usage snippets and test fixtures
+	ExampleInput map[string]interface{}
+	// Messages resolves the branding and the README text of the workflow's
+	// namespace. Nil resolves the built-in branding in English.
+	Messages *branding.Messages
 }
 
 // MethodData represents method information for templates
@@ -114,6 +171,8 @@ type Generator interface {
 type CodeGenerator struct {
 	templateManager *TemplateManager
 	languageHandlers map[Language]LanguageHandler
+	versions         VersionLoader
+	messages         branding.Resolver
 }
 
 // LanguageHandler interface for language-specific code generation
@@ -125,6 +184,20 @@ type LanguageHandler interface {
 	GetDefaultPackageName() string
 }
 
+// prepareTemplateData prepares the template data of a request with the
+// handler of its language, then renames methods and model fields to the
+// requested naming convention. gRPC clients keep the protobuf style.
+func prepareTemplateData(handler LanguageHandler, workflow *models.Workflow, request *GenerationRequest) (*TemplateData, error) {
+	templateData, err := handler.PrepareTemplateData(workflow, request)
+	if err != nil {
+		return nil, err
+	}
+	if request.Language != LanguageGRPC {
+		applyNamingConvention(templateData, ResolveNamingConvention(request.Language, request.Naming))
+	}
+	return templateData, nil
+}
+
 // NewCodeGenerator creates a new code generator
 func NewCodeGenerator() *CodeGenerator {
 	templateManager := NewTemplateManager()
@@ -139,10 +212,21 @@ func NewCodeGenerator() *CodeGenerator {
 	generator.languageHandlers[LanguageTypeScript] = NewTypeScriptHandler(templateManager)
 	generator.languageHandlers[LanguagePython] = NewPythonHandler(templateManager)
 	generator.languageHandlers[LanguageJava] = NewJavaHandler(templateManager)
+	generator.languageHandlers[LanguageKotlin] = NewKotlinHandler(templateManager)
+	generator.languageHandlers[LanguageSwift] = NewSwiftHandler(templateManager)
+	generator.languageHandlers[LanguageRuby] = NewRubyHandler(templateManager)
+	generator.languageHandlers[LanguageGRPC] = NewGRPCHandler(templateManager)
 
 	return generator
 }
 
+// SetMessages sets the resolver of the branding and localized strings of
+// namespaces. Without it clients are generated with the built-in branding
+// in English.
+func (g *CodeGenerator) SetMessages(resolver branding.Resolver) {
+	g.messages = resolver
+}
+
 // Generate generates code for a workflow
 func (g *CodeGenerator) Generate(workflow *models.Workflow, request *GenerationRequest) (*GenerationResult, error) {
 	// Validate the request
@@ -156,11 +240,20 @@ func (g *CodeGenerator) Generate(workflow *models.Workflow, request *GenerationR
 		return nil, fmt.Errorf("unsupported language: %s", request.Language)
 	}
 
+	// Use the pinned version of the workflow, if any
+	workflow, err := g.workflowAtVersion(workflow, request)
+	if err != nil {
+		return nil, err
+	}
+
 	// Prepare template data
-	templateData, err := handler.PrepareTemplateData(workflow, request)
+	templateData, err := prepareTemplateData(handler, workflow, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare template data: %w", err)
 	}
+	if g.messages != nil {
+		templateData.Messages = g.messages.Messages(branding.Namespace(workflow), request.Locale)
+	}
 
 	// Generate files
 	files, err := handler.Generate(workflow, request, templateData)
@@ -168,6 +261,16 @@ func (g *CodeGenerator) Generate(workflow *models.Workflow, request *GenerationR
 		return nil, fmt.Errorf("failed to generate code: %w", err)
 	}
 
+	// Keep the user's edits to previously generated config files
+	merged, conflicts := mergeExistingFiles(files, request.Existing)
+
+	// Catch template bugs that produce code which does not parse
+	if request.ValidateOutput {
+		if err := CheckSyntax(files); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create result
 	result := &GenerationResult{
 		ID:          uuid.New(),
@@ -182,14 +285,84 @@ func (g *CodeGenerator) Generate(workflow *models.Workflow, request *GenerationR
 			"class_name":     templateData.ClassName,
 			"file_count":     len(files),
 			"include_tests":  request.IncludeTests,
+			"syntax_checked": request.ValidateOutput,
 			"workflow_name":  workflow.Name,
 			"workflow_steps": len(workflow.Definition.Steps),
+			"workflow_version": workflow.Version,
 		},
 	}
+	if request.VersionID != nil {
+		result.Metadata["version_id"] = request.VersionID.String()
+	}
+	if templateData.Messages != nil {
+		result.Metadata["locale"] = templateData.Messages.Locale()
+		result.Metadata["branding"] = templateData.Messages.Profile()
+	}
+	if len(merged) > 0 {
+		result.Metadata["merged_files"] = merged
+	}
+	if len(conflicts) > 0 {
+		result.Metadata["merge_conflicts"] = conflicts
+	}
 
 	return result, nil
 }
 
+// GenerateMulti generates code for a workflow in several languages. Each
+// language is generated from its own copy of the request, with Language set
+// accordingly. If some languages fail, the result still holds the languages
+// that succeeded and a *MultiGenerationError is returned alongside it.
+func (g *CodeGenerator) GenerateMulti(workflow *models.Workflow, languages []string, request *GenerationRequest) (*MultiGenerationResult, error) {
+	if len(languages) == 0 {
+		return nil, fmt.Errorf("at least one language is required")
+	}
+	if request == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	result := &MultiGenerationResult{
+		WorkflowID:  request.WorkflowID,
+		Results:     make(map[Language]*GenerationResult),
+		Errors:      make(map[Language]string),
+		GeneratedAt: time.Now().UTC(),
+	}
+	failures := make(map[Language]error)
+
+	for _, name := range languages {
+		language := Language(strings.ToLower(name))
+		if _, done := result.Results[language]; done {
+			continue
+		}
+		if _, failed := failures[language]; failed {
+			continue
+		}
+
+		// Handlers may fill in defaults such as the package name, so every
+		// language gets its own request
+		languageRequest := *request
+		languageRequest.Language = language
+
+		languageResult, err := g.Generate(workflow, &languageRequest)
+		if err != nil {
+			failures[language] = err
+			result.Errors[language] = err.Error()
+			continue
+		}
+		result.Results[language] = languageResult
+	}
+
+	switch {
+	case len(failures) == 0:
+		result.Status = "success"
+		return result, nil
+	case len(result.Results) == 0:
+		result.Status = "failed"
+	default:
+		result.Status = "partial"
+	}
+	return result, &MultiGenerationError{Errors: failures}
+}
+
 // ValidateRequest validates a generation request
 func (g *CodeGenerator) ValidateRequest(request *GenerationRequest) error {
 	if request == nil {
@@ -209,6 +382,16 @@ func (g *CodeGenerator) ValidateRequest(request *GenerationRequest) error {
 		return fmt.Errorf("unsupported language: %s", request.Language)
 	}
 
+	if err := request.Naming.Validate(); err != nil {
+		return err
+	}
+
+	if request.Locale != "" {
+		if err := branding.ValidateLocale(request.Locale); err != nil {
+			return err
+		}
+	}
+
 	// Validate language-specific requirements
 	handler := g.languageHandlers[request.Language]
 	if err := handler.ValidateRequest(request); err != nil {
@@ -303,6 +486,14 @@ func GetFileNameForLanguage(baseName string, language Language) string {
 		return ToSnakeCase(baseName) + ".py"
 	case LanguageJava:
 		return ToPascalCase(baseName) + ".java"
+	case LanguageKotlin:
+		return ToPascalCase(baseName) + ".kt"
+	case LanguageSwift:
+		return ToPascalCase(baseName) + ".swift"
+	case LanguageRuby:
+		return ToSnakeCase(baseName) + ".rb"
+	case LanguageGRPC:
+		return ToSnakeCase(baseName) + ".proto"
 	default:
 		return baseName
 	}
@@ -319,6 +510,17 @@ func RenderTemplate(templateContent string, data interface{}) (string, error) {
 		"title":        strings.Title,
 		"lower":        strings.ToLower,
 		"upper":        strings.ToUpper,
+		"goLiteral":    GoLiteral,
+		"pyLiteral":    PythonLiteral,
+		"tsLiteral":    TypeScriptLiteral,
+		"javaLiteral":  JavaLiteral,
+		"kotlinLiteral": KotlinLiteral,
+		"kotlinName":   escapeKotlinIdentifier,
+		"swiftLiteral": SwiftLiteral,
+		"swiftName":    escapeSwiftIdentifier,
+		"swiftCodingKey": swiftCodingKey,
+		"rubyLiteral":  RubyLiteral,
+		"rubyName":     escapeRubyIdentifier,
 	}).Parse(templateContent)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
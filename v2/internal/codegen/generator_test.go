@@ -0,0 +1,72 @@
+package codegen
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func TestGenerateMulti(t *testing.T) {
+	workflow := &models.Workflow{ID: uuid.New(), Name: "order-processing"}
+
+	t.Run("java, python and typescript together", func(t *testing.T) {
+		generator := NewCodeGenerator()
+		request := &GenerationRequest{WorkflowID: workflow.ID}
+
+		result, err := generator.GenerateMulti(workflow, []string{"java", "python", "typescript"}, request)
+		require.NoError(t, err)
+
+		assert.Equal(t, "success", result.Status)
+		assert.Empty(t, result.Errors)
+		require.Len(t, result.Results, 3)
+		for _, language := range []Language{LanguageJava, LanguagePython, LanguageTypeScript} {
+			languageResult := result.Results[language]
+			require.NotNil(t, languageResult, language)
+			assert.Equal(t, language, languageResult.Language)
+			assert.NotEmpty(t, languageResult.Files, language)
+			assert.Equal(t, "OrderProcessingClient", languageResult.Metadata["class_name"], language)
+		}
+
+		assert.NotEqual(t, result.Results[LanguageJava].Metadata["package_name"], result.Results[LanguagePython].Metadata["package_name"],
+			"each language must get its own default package name")
+		assert.Empty(t, request.PackageName, "the caller's request must not be modified")
+		assert.Empty(t, request.Language, "the caller's request must not be modified")
+	})
+
+	t.Run("partial results when some languages fail", func(t *testing.T) {
+		generator := NewCodeGenerator()
+
+		result, err := generator.GenerateMulti(workflow, []string{"python", "cobol", "TypeScript", "python"}, &GenerationRequest{WorkflowID: workflow.ID})
+		require.Error(t, err)
+		require.NotNil(t, result)
+
+		var multiErr *MultiGenerationError
+		require.True(t, errors.As(err, &multiErr))
+		assert.Contains(t, multiErr.Errors, Language("cobol"))
+
+		assert.Equal(t, "partial", result.Status)
+		assert.Len(t, result.Results, 2)
+		assert.Contains(t, result.Errors["cobol"], "unsupported language")
+	})
+
+	t.Run("all languages fail", func(t *testing.T) {
+		generator := NewCodeGenerator()
+
+		result, err := generator.GenerateMulti(workflow, []string{"python"}, &GenerationRequest{})
+		require.Error(t, err)
+
+		assert.Equal(t, "failed", result.Status)
+		assert.Empty(t, result.Results)
+		assert.Contains(t, result.Errors[LanguagePython], "workflow ID is required")
+	})
+
+	t.Run("no languages", func(t *testing.T) {
+		_, err := NewCodeGenerator().GenerateMulti(workflow, nil, &GenerationRequest{WorkflowID: workflow.ID})
+		assert.Error(t, err)
+	})
+}
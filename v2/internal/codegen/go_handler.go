@@ -11,12 +11,14 @@ import (
 // GoHandler implements LanguageHandler for Go code generation
 type GoHandler struct {
 	templateManager *TemplateManager
+	namer           *ClientNamer
 }
 
 // NewGoHandler creates a new Go language handler
 func NewGoHandler(templateManager *TemplateManager) *GoHandler {
 	return &GoHandler{
 		templateManager: templateManager,
+		namer:           NewClientNamer(),
 	}
 }
 
@@ -82,6 +84,13 @@ func (h *GoHandler) ValidateRequest(request *GenerationRequest) error {
 		return fmt.Errorf("invalid Go package name: %s", request.PackageName)
 	}
 
+	// Lowercase names would leave the client's methods and model fields
+	// unexported
+	naming := ResolveNamingConvention(LanguageGo, request.Naming)
+	if naming.Methods != CasePascal || naming.Fields != CasePascal {
+		return fmt.Errorf("Go clients only support %s method and field names", CasePascal)
+	}
+
 	return nil
 }
 
@@ -92,7 +101,7 @@ func (h *GoHandler) PrepareTemplateData(workflow *models.Workflow, request *Gene
 		packageName = h.GetDefaultPackageName()
 	}
 
-	className := ToPascalCase(workflow.Name) + "Client"
+	className := h.namer.ClientClassName(workflow.Name)
 
 	// Extract methods from workflow steps
 	methods := ExtractStepMethods(workflow)
@@ -104,14 +113,15 @@ func (h *GoHandler) PrepareTemplateData(workflow *models.Workflow, request *Gene
 	models := h.generateModels(workflow)
 
 	templateData := &TemplateData{
-		Workflow:    workflow,
-		PackageName: packageName,
-		ClassName:   className,
-		Imports:     imports,
-		Methods:     methods,
-		Models:      models,
-		Options:     request.Options,
-		GeneratedAt: workflow.CreatedAt,
+		Workflow:     workflow,
+		PackageName:  packageName,
+		ClassName:    className,
+		Imports:      imports,
+		Methods:      methods,
+		Models:       models,
+		Options:      request.Options,
+		GeneratedAt:  workflow.CreatedAt,
+		ExampleInput: WorkflowExampleInput(workflow),
 	}
 
 	return templateData, nil
@@ -223,6 +233,7 @@ go 1.21
 require (
 	github.com/google/uuid v1.3.0
 	github.com/stretchr/testify v1.8.4
+	github.com/ugorji/go/codec v1.2.11
 )
 
 require (
@@ -230,6 +241,9 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// magic-flow:user-begin requires
+// magic-flow:user-end requires
 `, moduleName)
 
 	return GeneratedFile{
@@ -242,20 +256,14 @@ require (
 
 // generateReadmeFile generates the README file
 func (h *GoHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, error) {
-	content := fmt.Sprintf(`# %s Go Client
-
-Generated Go client library for the %s workflow.
-
-## Installation
-
-` + "```bash" + `
-go get %s
-` + "```" + `
+	readme := &ReadmeBuilder{
+		Language:  "Go",
+		CodeFence: "go",
+	}
 
-## Usage
+	readme.Installation = codeBlock("bash", fmt.Sprintf("go get %s", data.PackageName))
 
-` + "```go" + `
-package main
+	readme.Usage = readme.CodeBlock(fmt.Sprintf(`package main
 
 import (
 	"context"
@@ -269,9 +277,7 @@ func main() {
 	client := %s.New%s("http://localhost:8080", "your-api-key")
 	
 	ctx := context.Background()
-	input := map[string]interface{}{
-		"key": "value",
-	}
+	input := %s
 	
 	result, err := client.ExecuteWorkflow(ctx, input)
 	if err != nil {
@@ -280,87 +286,54 @@ func main() {
 	
 	fmt.Printf("Execution ID: %%s\n", result.ID)
 	fmt.Printf("Status: %%s\n", result.Status)
-}
-` + "```" + `
-
-## API Reference
-
-### Client Methods
-
-#### ExecuteWorkflow
-
-Executes the %s workflow with the provided input.
-
-` + "```go" + `
-func (c *%s) ExecuteWorkflow(ctx context.Context, input map[string]interface{}) (*ExecutionResult, error)
-` + "```" + `
-
-#### GetExecutionStatus
-
-Retrieves the status of a workflow execution.
-
-` + "```go" + `
-func (c *%s) GetExecutionStatus(ctx context.Context, executionID uuid.UUID) (*ExecutionStatus, error)
-` + "```" + `
-
-%s
-
-## Models
-
-### ExecutionResult
-
-Represents the result of a workflow execution.
-
-### ExecutionStatus
-
-Represents the status of a workflow execution.
-
-### StepStatus
-
-Represents the status of a workflow step.
-
-## Constants
-
-- ` + "`WORKFLOW_ID`" + `: The ID of the workflow
-- ` + "`WORKFLOW_NAME`" + `: The name of the workflow
-- ` + "`Status.*`" + `: Execution status constants
-- ` + "`Steps.*`" + `: Step ID constants
-
-## Error Handling
-
-All methods return an error as the second return value. Always check for errors:
-
-` + "```go" + `
-result, err := client.ExecuteWorkflow(ctx, input)
-if err != nil {
-	// Handle error
-	log.Printf("Error executing workflow: %%v", err)
-	return
-}
-` + "```" + `
-
-## License
-
-Generated code - see original workflow license.
-`,
-		data.Workflow.Name,
-		data.Workflow.Name,
-		data.PackageName,
+}`,
 		data.PackageName,
 		data.PackageName,
 		data.ClassName,
-		data.Workflow.Name,
-		data.ClassName,
-		data.ClassName,
-		h.generateMethodDocs(data.Methods),
-	)
+		GoLiteral(data.ExampleInput, "\t"),
+	))
+
+	readme.ClientMethods = []ReadmeEntry{
+		{
+			Name:        "ExecuteWorkflow",
+			Description: fmt.Sprintf("Executes the %s workflow with the provided input.", data.Workflow.Name),
+			Code:        fmt.Sprintf("func (c *%s) ExecuteWorkflow(ctx context.Context, input map[string]interface{}) (*ExecutionResult, error)", data.ClassName),
+		},
+		{
+			Name:        "Preflight",
+			Description: "Reports whether an execution with the provided input would start, queue or be rejected, without starting it.",
+			Code:        fmt.Sprintf("func (c *%s) Preflight(ctx context.Context, input map[string]interface{}, options PreflightOptions) (*PreflightReport, error)", data.ClassName),
+		},
+		{
+			Name:        "GetExecutionStatus",
+			Description: "Retrieves the status of a workflow execution.",
+			Code:        fmt.Sprintf("func (c *%s) GetExecutionStatus(ctx context.Context, executionID uuid.UUID) (*ExecutionStatus, error)", data.ClassName),
+		},
+	}
+	readme.MethodDocs = h.generateMethodDocs(data.Methods)
+
+	readme.Types = []ReadmeEntry{
+		{Name: "ExecutionResult", Description: "Represents the result of a workflow execution."},
+		{Name: "ExecutionStatus", Description: "Represents the status of a workflow execution."},
+		{Name: "StepStatus", Description: "Represents the status of a workflow step."},
+		{Name: "PreflightReport", Description: "Represents the outcome of the admission checks of an execution."},
+	}
+
+	readme.Constants = "- `WORKFLOW_ID`: The ID of the workflow\n" +
+		"- `WORKFLOW_NAME`: The name of the workflow\n" +
+		"- `WORKFLOW_VERSION`: The workflow version the client was generated against\n" +
+		"- `Status.*`: Execution status constants\n" +
+		"- `Steps.*`: Step ID constants"
+
+	readme.ErrorHandling = "All methods return an error as the second return value. Always check for errors:\n\n" +
+		readme.CodeBlock(`result, err := client.ExecuteWorkflow(ctx, input)
+if err != nil {
+	// Handle error
+	log.Printf("Error executing workflow: %v", err)
+	return
+}`)
 
-	return GeneratedFile{
-		Path:     "README.md",
-		Content:  content,
-		Language: "markdown",
-		Type:     "documentation",
-	}, nil
+	return readme.Build(data)
 }
 
 // generateImports generates the list of imports needed
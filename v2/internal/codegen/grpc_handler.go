@@ -0,0 +1,1123 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	gengo "google.golang.org/protobuf/cmd/protoc-gen-go/internal_gengo"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/pluginpb"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// protoPackagePattern matches dot separated protobuf package names
+var protoPackagePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// protoVersionPattern matches the version suffix of a package, e.g. v1beta1
+var protoVersionPattern = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]*)?$`)
+
+// protoWellKnownFiles are the well-known type files generated definitions
+// may import
+var protoWellKnownFiles = map[string]protoreflect.FileDescriptor{
+	"google/protobuf/duration.proto":  durationpb.File_google_protobuf_duration_proto,
+	"google/protobuf/struct.proto":    structpb.File_google_protobuf_struct_proto,
+	"google/protobuf/timestamp.proto": timestamppb.File_google_protobuf_timestamp_proto,
+}
+
+// protoScalarTypes maps protobuf scalar types to their descriptor types
+var protoScalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"double": descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"int32":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+}
+
+// protoExecutionStatuses are the execution statuses of the ExecutionStatus
+// enum, in the order of their enum numbers
+var protoExecutionStatuses = []models.ExecutionStatus{
+	models.ExecutionStatusPending,
+	models.ExecutionStatusRunning,
+	models.ExecutionStatusCompleted,
+	models.ExecutionStatusFailed,
+	models.ExecutionStatusCancelled,
+	models.ExecutionStatusTimeout,
+	models.ExecutionStatusPaused,
+}
+
+// Import paths of the Go packages the generated gRPC stubs use
+const (
+	grpcPackage    = protogen.GoImportPath("google.golang.org/grpc")
+	codesPackage   = protogen.GoImportPath("google.golang.org/grpc/codes")
+	statusPackage  = protogen.GoImportPath("google.golang.org/grpc/status")
+	contextPackage = protogen.GoImportPath("context")
+)
+
+// GRPCHandler implements LanguageHandler for gRPC service definitions. It
+// generates a .proto file declaring a service with the workflow's execute,
+// status and cancel operations and messages for its input and output
+// schemas. With the go_stubs option it also generates the Go message and
+// gRPC stubs, so Go users need no protoc toolchain. The package name is the
+// protobuf package.
+type GRPCHandler struct {
+	templateManager *TemplateManager
+	namer           *ClientNamer
+}
+
+// NewGRPCHandler creates a new gRPC handler
+func NewGRPCHandler(templateManager *TemplateManager) *GRPCHandler {
+	return &GRPCHandler{
+		templateManager: templateManager,
+		namer:           NewClientNamer(),
+	}
+}
+
+// protoFile is a protobuf file definition, rendered both as .proto source
+// and as a file descriptor so the two never disagree
+type protoFile struct {
+	Path      string
+	Package   string
+	GoPackage string
+	Comments  []string
+	Imports   []string
+	Services  []*protoService
+	Messages  []*protoMessage
+	Enums     []*protoEnum
+}
+
+type protoService struct {
+	Name     string
+	Comments []string
+	Methods  []*protoMethod
+}
+
+type protoMethod struct {
+	Name     string
+	Input    string
+	Output   string
+	Comments []string
+}
+
+type protoMessage struct {
+	Name          string
+	Comments      []string
+	Fields        []*protoField
+	Reserved      []int32
+	ReservedNames []string
+}
+
+type protoField struct {
+	Name string
+	// JSONName is the name of the field in JSON, the property name of the
+	// schema or the snake_case name used by the REST API
+	JSONName string
+	// Type is a scalar type, a well-known type such as
+	// google.protobuf.Struct or the name of a message or enum of the file
+	Type     string
+	Number   int32
+	Optional bool
+	Repeated bool
+	Comments []string
+}
+
+type protoEnum struct {
+	Name     string
+	Comments []string
+	Values   []protoEnumValue
+}
+
+type protoEnumValue struct {
+	Name   string
+	Number int32
+}
+
+// Generate generates the gRPC service definition of a workflow. Field
+// numbers of messages already present in the existing .proto file are kept,
+// and those of removed fields are reserved, so regenerated definitions stay
+// wire compatible.
+func (h *GRPCHandler) Generate(workflow *models.Workflow, request *GenerationRequest, templateData *TemplateData) ([]GeneratedFile, error) {
+	var files []GeneratedFile
+
+	file := h.buildProtoFile(templateData)
+	if existing, ok := request.Existing[file.Path]; ok {
+		file.keepFieldNumbers(existing.Content)
+	}
+
+	// Catch definitions protoc would reject before handing them out
+	if _, err := protodesc.NewFile(file.descriptor(), protoregistry.GlobalFiles); err != nil {
+		return nil, fmt.Errorf("invalid service definition: %w", err)
+	}
+
+	files = append(files, GeneratedFile{
+		Path:     file.Path,
+		Content:  file.render(templateData),
+		Language: "protobuf",
+		Type:     "schema",
+	})
+
+	// Generate Go stubs if requested
+	if h.goStubs(templateData) {
+		stubs, err := h.generateGoStubs(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Go stubs: %w", err)
+		}
+		files = append(files, stubs...)
+	}
+
+	// Generate README file
+	readmeFile, err := h.generateReadmeFile(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate README file: %w", err)
+	}
+	files = append(files, readmeFile)
+
+	return files, nil
+}
+
+// ValidateRequest validates gRPC-specific generation request. The package
+// name is the protobuf package.
+func (h *GRPCHandler) ValidateRequest(request *GenerationRequest) error {
+	if request.PackageName == "" {
+		request.PackageName = h.GetDefaultPackageName()
+	}
+
+	if !protoPackagePattern.MatchString(request.PackageName) {
+		return fmt.Errorf("invalid protobuf package name: %s", request.PackageName)
+	}
+
+	if goPackage, ok := request.Options["go_package"]; ok {
+		if s, isString := goPackage.(string); !isString || strings.TrimSpace(s) == "" {
+			return fmt.Errorf("go_package option must be a non-empty string")
+		}
+	}
+
+	return nil
+}
+
+// PrepareTemplateData prepares template data for gRPC code generation.
+// Protobuf fields are always snake_case and RPCs PascalCase, as the protobuf
+// style guide requires, so naming conventions do not apply.
+func (h *GRPCHandler) PrepareTemplateData(workflow *models.Workflow, request *GenerationRequest) (*TemplateData, error) {
+	packageName := request.PackageName
+	if packageName == "" {
+		packageName = h.GetDefaultPackageName()
+	}
+
+	className := h.namer.ClientClassName(workflow.Name)
+
+	templateData := &TemplateData{
+		Workflow:     workflow,
+		PackageName:  packageName,
+		Namespace:    packageName,
+		ClassName:    className,
+		Models:       schemaModels(workflow, strings.TrimSuffix(className, "Client"), h.mapFieldTypeToProto),
+		Options:      request.Options,
+		GeneratedAt:  workflow.CreatedAt,
+		ExampleInput: WorkflowExampleInput(workflow),
+	}
+
+	return templateData, nil
+}
+
+// GetFileExtension returns the file extension for protobuf files
+func (h *GRPCHandler) GetFileExtension() string {
+	return ".proto"
+}
+
+// GetDefaultPackageName returns the default protobuf package
+func (h *GRPCHandler) GetDefaultPackageName() string {
+	return "magicflow.client.v1"
+}
+
+// serviceName returns the name of the gRPC service of a workflow
+func (h *GRPCHandler) serviceName(data *TemplateData) string {
+	return strings.TrimSuffix(data.ClassName, "Client") + "Service"
+}
+
+// protoPath returns the path of the .proto file, in the directory of its
+// package as buf and protoc expect
+func (h *GRPCHandler) protoPath(data *TemplateData) string {
+	name := CaseSnake.Apply(strings.TrimSuffix(data.ClassName, "Client"))
+	return path.Join(strings.ReplaceAll(data.PackageName, ".", "/"), name+".proto")
+}
+
+// goPackage returns the go_package option of the file, the import path of
+// the Go stubs followed by their package name. The stubs are placed under
+// gen/go of the module_name option unless the go_package option sets it.
+func (h *GRPCHandler) goPackage(data *TemplateData) string {
+	if goPackage, ok := data.Options["go_package"].(string); ok && goPackage != "" {
+		return goPackage
+	}
+
+	segments := strings.Split(strings.ToLower(data.PackageName), ".")
+	name := segments[len(segments)-1]
+	if len(segments) > 1 && protoVersionPattern.MatchString(name) {
+		name = segments[len(segments)-2] + name
+	}
+	name = strings.ReplaceAll(name, "_", "")
+
+	module := "github.com/your-org/" + CaseSnake.Apply(data.Workflow.Name) + "-client"
+	if m, ok := data.Options["module_name"].(string); ok && m != "" {
+		module = m
+	}
+	return path.Join(module, "gen/go", strings.Join(segments, "/")) + ";" + name
+}
+
+// goStubs reports whether the go_stubs option requests the Go stubs
+func (h *GRPCHandler) goStubs(data *TemplateData) bool {
+	stubs, _ := data.Options["go_stubs"].(bool)
+	return stubs
+}
+
+// buildProtoFile builds the service definition of a workflow
+func (h *GRPCHandler) buildProtoFile(data *TemplateData) *protoFile {
+	workflow := data.Workflow
+	file := &protoFile{
+		Path:      h.protoPath(data),
+		Package:   data.PackageName,
+		GoPackage: h.goPackage(data),
+		Comments: []string{
+			fmt.Sprintf("Service definition of the %s workflow (%s).", workflow.Name, workflow.ID),
+		},
+	}
+	if workflow.Description != "" {
+		file.Comments = append(file.Comments, "", workflow.Description)
+	}
+
+	// Messages of the input and output schemas, or structs when the schema
+	// declares no properties
+	inputType, outputType := "google.protobuf.Struct", "google.protobuf.Struct"
+	for _, model := range data.Models {
+		message := &protoMessage{Name: model.Name, Comments: commentLines(model.Description)}
+		used := make(map[string]bool)
+		for i, field := range model.Fields {
+			name := uniqueProtoName(protoFieldName(field.Name), used)
+			message.Fields = append(message.Fields, &protoField{
+				Name:     name,
+				JSONName: field.Name,
+				Type:     field.Type,
+				Number:   int32(i + 1),
+				Optional: !field.Required && protoScalarTypes[field.Type] != 0,
+				Comments: commentLines(field.Description),
+			})
+		}
+		file.Messages = append(file.Messages, message)
+
+		switch {
+		case strings.HasSuffix(model.Name, "Input"):
+			inputType = model.Name
+		case strings.HasSuffix(model.Name, "Output"):
+			outputType = model.Name
+		}
+	}
+
+	file.Messages = append(file.Messages,
+		&protoMessage{
+			Name:     "ExecuteRequest",
+			Comments: []string{fmt.Sprintf("ExecuteRequest starts an execution of the %s workflow.", workflow.Name)},
+			Fields: []*protoField{
+				{Name: "input", Type: inputType, Number: 1},
+				{Name: "version_id", Type: "string", Number: 2, Optional: true, Comments: []string{"Pins the execution to a workflow version."}},
+				{Name: "correlation_id", Type: "string", Number: 3, Optional: true, Comments: []string{"Correlation ID of the business transaction, generated when empty."}},
+			},
+		},
+		&protoMessage{
+			Name:   "ExecuteResponse",
+			Fields: []*protoField{{Name: "execution", Type: "Execution", Number: 1}},
+		},
+		&protoMessage{
+			Name:   "GetStatusRequest",
+			Fields: []*protoField{{Name: "execution_id", Type: "string", Number: 1}},
+		},
+		&protoMessage{
+			Name: "GetStatusResponse",
+			Fields: []*protoField{
+				{Name: "execution", Type: "Execution", Number: 1},
+				{Name: "progress", Type: "double", Number: 2, Comments: []string{"Share of the steps that finished, between 0 and 1."}},
+				{Name: "message", Type: "string", Number: 3},
+				{Name: "steps", Type: "StepStatus", Number: 4, Repeated: true},
+			},
+		},
+		&protoMessage{
+			Name:   "CancelRequest",
+			Fields: []*protoField{{Name: "execution_id", Type: "string", Number: 1}},
+		},
+		&protoMessage{
+			Name:   "CancelResponse",
+			Fields: []*protoField{{Name: "execution", Type: "Execution", Number: 1}},
+		},
+		&protoMessage{
+			Name:     "Execution",
+			Comments: []string{fmt.Sprintf("Execution is an execution of the %s workflow.", workflow.Name)},
+			Fields: []*protoField{
+				{Name: "id", Type: "string", Number: 1},
+				{Name: "workflow_id", Type: "string", Number: 2},
+				{Name: "correlation_id", Type: "string", Number: 3},
+				{Name: "status", Type: "ExecutionStatus", Number: 4},
+				{Name: "output", Type: outputType, Number: 5},
+				{Name: "error", Type: "string", Number: 6},
+				{Name: "started_at", Type: "google.protobuf.Timestamp", Number: 7},
+				{Name: "completed_at", Type: "google.protobuf.Timestamp", Number: 8},
+				{Name: "duration", Type: "google.protobuf.Duration", Number: 9},
+			},
+		},
+		&protoMessage{
+			Name:     "StepStatus",
+			Comments: []string{"StepStatus is the status of a step of an execution."},
+			Fields: []*protoField{
+				{Name: "id", Type: "string", Number: 1},
+				{Name: "name", Type: "string", Number: 2},
+				{Name: "status", Type: "string", Number: 3},
+				{Name: "started_at", Type: "google.protobuf.Timestamp", Number: 4},
+				{Name: "completed_at", Type: "google.protobuf.Timestamp", Number: 5},
+				{Name: "error", Type: "string", Number: 6},
+			},
+		},
+	)
+
+	// Fields of the fixed messages use the snake_case names of the REST API
+	// in JSON too
+	for _, message := range file.Messages {
+		for _, field := range message.Fields {
+			if field.JSONName == "" {
+				field.JSONName = field.Name
+			}
+		}
+	}
+
+	statuses := &protoEnum{
+		Name:     "ExecutionStatus",
+		Comments: []string{"ExecutionStatus is the status of a workflow execution."},
+		Values:   []protoEnumValue{{Name: "EXECUTION_STATUS_UNSPECIFIED", Number: 0}},
+	}
+	for i, status := range protoExecutionStatuses {
+		statuses.Values = append(statuses.Values, protoEnumValue{
+			Name:   "EXECUTION_STATUS_" + strings.ToUpper(string(status)),
+			Number: int32(i + 1),
+		})
+	}
+	file.Enums = append(file.Enums, statuses)
+
+	file.Services = append(file.Services, &protoService{
+		Name:     h.serviceName(data),
+		Comments: []string{fmt.Sprintf("%s executes the %s workflow.", h.serviceName(data), workflow.Name)},
+		Methods: []*protoMethod{
+			{Name: "Execute", Input: "ExecuteRequest", Output: "ExecuteResponse", Comments: []string{"Execute starts an execution of the workflow."}},
+			{Name: "GetStatus", Input: "GetStatusRequest", Output: "GetStatusResponse", Comments: []string{"GetStatus returns the status of an execution and its steps."}},
+			{Name: "Cancel", Input: "CancelRequest", Output: "CancelResponse", Comments: []string{"Cancel cancels a running execution."}},
+		},
+	})
+
+	file.Imports = file.wellKnownImports()
+	return file
+}
+
+// wellKnownImports returns the well-known type files the messages use
+func (f *protoFile) wellKnownImports() []string {
+	imports := make(map[string]bool)
+	for _, message := range f.Messages {
+		for _, field := range message.Fields {
+			switch field.Type {
+			case "google.protobuf.Struct", "google.protobuf.ListValue", "google.protobuf.Value":
+				imports["google/protobuf/struct.proto"] = true
+			case "google.protobuf.Timestamp":
+				imports["google/protobuf/timestamp.proto"] = true
+			case "google.protobuf.Duration":
+				imports["google/protobuf/duration.proto"] = true
+			}
+		}
+	}
+
+	result := make([]string, 0, len(imports))
+	for file := range imports {
+		result = append(result, file)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// existingProtoFields matches the field declarations of a generated .proto
+// file, capturing the field name and number
+var existingProtoFields = regexp.MustCompile(`^\s*(?:optional |repeated )?[\w.]+ (\w+) = (\d+)`)
+
+// existingProtoReserved matches the reserved statements of a generated
+// .proto file
+var existingProtoReserved = regexp.MustCompile(`^\s*reserved (.+);`)
+
+// keepFieldNumbers assigns the fields of messages declared in the existing
+// .proto source the numbers they had there. New fields get numbers no
+// earlier field used, and the numbers and names of removed fields are
+// reserved.
+func (f *protoFile) keepFieldNumbers(existing string) {
+	type previousMessage struct {
+		fields   map[string]int32
+		reserved []int32
+		names    []string
+		max      int32
+	}
+	previous := make(map[string]*previousMessage)
+
+	var current *previousMessage
+	for _, line := range strings.Split(existing, "\n") {
+		if strings.HasPrefix(line, "message ") {
+			current = &previousMessage{fields: make(map[string]int32)}
+			previous[strings.Fields(line)[1]] = current
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if strings.HasPrefix(line, "}") {
+			current = nil
+			continue
+		}
+
+		if match := existingProtoReserved.FindStringSubmatch(line); match != nil {
+			for _, item := range strings.Split(match[1], ",") {
+				item = strings.TrimSpace(item)
+				if name, err := strconv.Unquote(item); err == nil {
+					current.names = append(current.names, name)
+				} else if number, err := strconv.ParseInt(item, 10, 32); err == nil {
+					current.reserved = append(current.reserved, int32(number))
+					if int32(number) > current.max {
+						current.max = int32(number)
+					}
+				}
+			}
+			continue
+		}
+		if match := existingProtoFields.FindStringSubmatch(line); match != nil {
+			number, err := strconv.ParseInt(match[2], 10, 32)
+			if err != nil {
+				continue
+			}
+			current.fields[match[1]] = int32(number)
+			if int32(number) > current.max {
+				current.max = int32(number)
+			}
+		}
+	}
+
+	for _, message := range f.Messages {
+		old, ok := previous[message.Name]
+		if !ok {
+			continue
+		}
+
+		next := old.max
+		kept := make(map[string]bool)
+		for _, field := range message.Fields {
+			if number, found := old.fields[field.Name]; found {
+				field.Number = number
+				kept[field.Name] = true
+			}
+		}
+		for _, field := range message.Fields {
+			if !kept[field.Name] {
+				next++
+				field.Number = next
+			}
+		}
+		sort.SliceStable(message.Fields, func(i, j int) bool {
+			return message.Fields[i].Number < message.Fields[j].Number
+		})
+
+		// Names of removed fields may be taken again, their numbers may not
+		message.Reserved = append(message.Reserved, old.reserved...)
+		for _, name := range old.names {
+			if !message.hasField(name) {
+				message.ReservedNames = append(message.ReservedNames, name)
+			}
+		}
+		for name, number := range old.fields {
+			if !kept[name] {
+				message.Reserved = append(message.Reserved, number)
+				message.ReservedNames = append(message.ReservedNames, name)
+			}
+		}
+		sort.Slice(message.Reserved, func(i, j int) bool { return message.Reserved[i] < message.Reserved[j] })
+		sort.Strings(message.ReservedNames)
+	}
+}
+
+// hasField reports whether the message has a field of the given name
+func (m *protoMessage) hasField(name string) bool {
+	for _, field := range m.Fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// render renders the file as .proto source
+func (f *protoFile) render(data *TemplateData) string {
+	var b strings.Builder
+
+	b.WriteString("// Code generated by Magic Flow v2. DO NOT EDIT.\n")
+	b.WriteString(fmt.Sprintf("// Generated at: %s\n", data.GeneratedAt.Format("2006-01-02 15:04:05")))
+	b.WriteString("//\n")
+	writeProtoComments(&b, "", f.Comments)
+	b.WriteString("\nsyntax = \"proto3\";\n\n")
+	b.WriteString(fmt.Sprintf("package %s;\n", f.Package))
+	if len(f.Imports) > 0 {
+		b.WriteString("\n")
+		for _, file := range f.Imports {
+			b.WriteString(fmt.Sprintf("import %s;\n", strconv.Quote(file)))
+		}
+	}
+	b.WriteString(fmt.Sprintf("\noption go_package = %s;\n", strconv.Quote(f.GoPackage)))
+
+	for _, service := range f.Services {
+		b.WriteString("\n")
+		writeProtoComments(&b, "", service.Comments)
+		b.WriteString(fmt.Sprintf("service %s {\n", service.Name))
+		for i, method := range service.Methods {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			writeProtoComments(&b, "  ", method.Comments)
+			b.WriteString(fmt.Sprintf("  rpc %s(%s) returns (%s);\n", method.Name, method.Input, method.Output))
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, message := range f.Messages {
+		b.WriteString("\n")
+		writeProtoComments(&b, "", message.Comments)
+		b.WriteString(fmt.Sprintf("message %s {\n", message.Name))
+		if len(message.Reserved) > 0 {
+			numbers := make([]string, len(message.Reserved))
+			for i, number := range message.Reserved {
+				numbers[i] = strconv.Itoa(int(number))
+			}
+			b.WriteString(fmt.Sprintf("  reserved %s;\n", strings.Join(numbers, ", ")))
+		}
+		if len(message.ReservedNames) > 0 {
+			names := make([]string, len(message.ReservedNames))
+			for i, name := range message.ReservedNames {
+				names[i] = strconv.Quote(name)
+			}
+			b.WriteString(fmt.Sprintf("  reserved %s;\n", strings.Join(names, ", ")))
+		}
+		for _, field := range message.Fields {
+			writeProtoComments(&b, "  ", field.Comments)
+			label := ""
+			switch {
+			case field.Repeated:
+				label = "repeated "
+			case field.Optional:
+				label = "optional "
+			}
+			options := ""
+			if field.JSONName != protoJSONName(field.Name) {
+				options = fmt.Sprintf(" [json_name = %s]", strconv.Quote(field.JSONName))
+			}
+			b.WriteString(fmt.Sprintf("  %s%s %s = %d%s;\n", label, field.Type, field.Name, field.Number, options))
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, enum := range f.Enums {
+		b.WriteString("\n")
+		writeProtoComments(&b, "", enum.Comments)
+		b.WriteString(fmt.Sprintf("enum %s {\n", enum.Name))
+		for _, value := range enum.Values {
+			b.WriteString(fmt.Sprintf("  %s = %d;\n", value.Name, value.Number))
+		}
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+// descriptor returns the file descriptor of the file, with its comments as
+// source code info so generated stubs carry them
+func (f *protoFile) descriptor() *descriptorpb.FileDescriptorProto {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(f.Path),
+		Package:    proto.String(f.Package),
+		Dependency: f.Imports,
+		Syntax:     proto.String("proto3"),
+		Options:    &descriptorpb.FileOptions{GoPackage: proto.String(f.GoPackage)},
+	}
+	info := &descriptorpb.SourceCodeInfo{}
+	comment := func(lines []string, location ...int32) {
+		if len(lines) == 0 {
+			return
+		}
+		var leading strings.Builder
+		for _, line := range lines {
+			if line != "" {
+				leading.WriteString(" ")
+			}
+			leading.WriteString(line + "\n")
+		}
+		info.Location = append(info.Location, &descriptorpb.SourceCodeInfo_Location{
+			Path:            location,
+			Span:            []int32{0, 0, 0},
+			LeadingComments: proto.String(leading.String()),
+		})
+	}
+
+	enums := make(map[string]bool)
+	for _, enum := range f.Enums {
+		enums[enum.Name] = true
+	}
+
+	// Field numbers of FileDescriptorProto, DescriptorProto and friends, as
+	// source code info paths refer to them
+	const (
+		fileMessages, fileEnums, fileServices = 4, 5, 6
+		messageFields, enumValues, methods    = 2, 2, 2
+	)
+
+	for i, message := range f.Messages {
+		descriptor := &descriptorpb.DescriptorProto{Name: proto.String(message.Name)}
+		comment(message.Comments, fileMessages, int32(i))
+		for j, field := range message.Fields {
+			fieldDescriptor := &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(field.Name),
+				Number:   proto.Int32(field.Number),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				JsonName: proto.String(field.JSONName),
+			}
+			if field.Repeated {
+				fieldDescriptor.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			}
+			switch scalar, isScalar := protoScalarTypes[field.Type]; {
+			case isScalar:
+				fieldDescriptor.Type = scalar.Enum()
+			case enums[field.Type]:
+				fieldDescriptor.Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+				fieldDescriptor.TypeName = proto.String("." + f.Package + "." + field.Type)
+			case strings.HasPrefix(field.Type, "google.protobuf."):
+				fieldDescriptor.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				fieldDescriptor.TypeName = proto.String("." + field.Type)
+			default:
+				fieldDescriptor.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				fieldDescriptor.TypeName = proto.String("." + f.Package + "." + field.Type)
+			}
+			// Optional fields live in a synthetic oneof, as protoc declares them
+			if field.Optional {
+				fieldDescriptor.Proto3Optional = proto.Bool(true)
+				fieldDescriptor.OneofIndex = proto.Int32(int32(len(descriptor.OneofDecl)))
+				descriptor.OneofDecl = append(descriptor.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String("_" + field.Name)})
+			}
+			descriptor.Field = append(descriptor.Field, fieldDescriptor)
+			comment(field.Comments, fileMessages, int32(i), messageFields, int32(j))
+		}
+		for _, number := range message.Reserved {
+			descriptor.ReservedRange = append(descriptor.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+				Start: proto.Int32(number),
+				End:   proto.Int32(number + 1),
+			})
+		}
+		descriptor.ReservedName = message.ReservedNames
+		file.MessageType = append(file.MessageType, descriptor)
+	}
+
+	for i, enum := range f.Enums {
+		descriptor := &descriptorpb.EnumDescriptorProto{Name: proto.String(enum.Name)}
+		comment(enum.Comments, fileEnums, int32(i))
+		for _, value := range enum.Values {
+			descriptor.Value = append(descriptor.Value, &descriptorpb.EnumValueDescriptorProto{
+				Name:   proto.String(value.Name),
+				Number: proto.Int32(value.Number),
+			})
+		}
+		file.EnumType = append(file.EnumType, descriptor)
+	}
+
+	for i, service := range f.Services {
+		descriptor := &descriptorpb.ServiceDescriptorProto{Name: proto.String(service.Name)}
+		comment(service.Comments, fileServices, int32(i))
+		for j, method := range service.Methods {
+			descriptor.Method = append(descriptor.Method, &descriptorpb.MethodDescriptorProto{
+				Name:       proto.String(method.Name),
+				InputType:  proto.String("." + f.Package + "." + method.Input),
+				OutputType: proto.String("." + f.Package + "." + method.Output),
+			})
+			comment(method.Comments, fileServices, int32(i), methods, int32(j))
+		}
+		file.Service = append(file.Service, descriptor)
+	}
+
+	file.SourceCodeInfo = info
+	return file
+}
+
+// generateGoStubs generates the Go messages and gRPC stubs of the file, as
+// protoc-gen-go and protoc-gen-go-grpc would with paths=source_relative
+func (h *GRPCHandler) generateGoStubs(file *protoFile) ([]GeneratedFile, error) {
+	request := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{file.Path},
+		Parameter:      proto.String("paths=source_relative"),
+	}
+	for _, name := range file.Imports {
+		request.ProtoFile = append(request.ProtoFile, protodesc.ToFileDescriptorProto(protoWellKnownFiles[name]))
+	}
+	request.ProtoFile = append(request.ProtoFile, file.descriptor())
+
+	plugin, err := protogen.Options{}.New(request)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range plugin.Files {
+		if !f.Generate {
+			continue
+		}
+		gengo.GenerateFile(plugin, f)
+		generateGRPCStubs(plugin, f)
+	}
+
+	response := plugin.Response()
+	if response.Error != nil {
+		return nil, fmt.Errorf("%s", response.GetError())
+	}
+
+	var files []GeneratedFile
+	for _, generated := range response.File {
+		fileType := "model"
+		if strings.HasSuffix(generated.GetName(), "_grpc.pb.go") {
+			fileType = "client"
+		}
+		files = append(files, GeneratedFile{
+			Path:     path.Join("gen/go", generated.GetName()),
+			Content:  generated.GetContent(),
+			Language: "go",
+			Type:     fileType,
+		})
+	}
+	return files, nil
+}
+
+// generateGRPCStubs generates the gRPC client and server stubs of a file,
+// the code protoc-gen-go-grpc generates
+func generateGRPCStubs(plugin *protogen.Plugin, file *protogen.File) {
+	if len(file.Services) == 0 {
+		return
+	}
+
+	g := plugin.NewGeneratedFile(file.GeneratedFilenamePrefix+"_grpc.pb.go", file.GoImportPath)
+	g.P("// Code generated by Magic Flow v2. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	g.P()
+	g.P("// This is a compile-time assertion to ensure that this generated file")
+	g.P("// is compatible with the grpc package it is being compiled against.")
+	g.P("const _ = ", grpcPackage.Ident("SupportPackageIsVersion7"))
+
+	for _, service := range file.Services {
+		generateGRPCService(g, file, service)
+	}
+}
+
+// generateGRPCService generates the client, server interface, registration
+// and method handlers of a service
+func generateGRPCService(g *protogen.GeneratedFile, file *protogen.File, service *protogen.Service) {
+	clientName := service.GoName + "Client"
+	serverName := service.GoName + "Server"
+	unexportedClient := strings.ToLower(clientName[:1]) + clientName[1:]
+	fullMethodName := func(method *protogen.Method) string {
+		return service.GoName + "_" + method.GoName + "_FullMethodName"
+	}
+	signature := func(method *protogen.Method) string {
+		return method.GoName + "(ctx " + g.QualifiedGoIdent(contextPackage.Ident("Context")) +
+			", in *" + g.QualifiedGoIdent(method.Input.GoIdent)
+	}
+
+	g.P()
+	g.P("const (")
+	for _, method := range service.Methods {
+		g.P(fullMethodName(method), ` = "/`, service.Desc.FullName(), "/", method.Desc.Name(), `"`)
+	}
+	g.P(")")
+	g.P()
+
+	// Client
+	g.P("// ", clientName, " is the client API for ", service.Desc.Name(), " service.")
+	g.P("//")
+	g.P("// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.")
+	g.P("type ", clientName, " interface {")
+	for _, method := range service.Methods {
+		g.P(method.Comments.Leading, signature(method), ", opts ...", grpcPackage.Ident("CallOption"), ") (*", method.Output.GoIdent, ", error)")
+	}
+	g.P("}")
+	g.P()
+	g.P("type ", unexportedClient, " struct {")
+	g.P("cc ", grpcPackage.Ident("ClientConnInterface"))
+	g.P("}")
+	g.P()
+	g.P("func New", clientName, "(cc ", grpcPackage.Ident("ClientConnInterface"), ") ", clientName, " {")
+	g.P("return &", unexportedClient, "{cc}")
+	g.P("}")
+	for _, method := range service.Methods {
+		g.P()
+		g.P("func (c *", unexportedClient, ") ", signature(method), ", opts ...", grpcPackage.Ident("CallOption"), ") (*", method.Output.GoIdent, ", error) {")
+		g.P("out := new(", method.Output.GoIdent, ")")
+		g.P("err := c.cc.Invoke(ctx, ", fullMethodName(method), ", in, out, opts...)")
+		g.P("if err != nil {")
+		g.P("return nil, err")
+		g.P("}")
+		g.P("return out, nil")
+		g.P("}")
+	}
+	g.P()
+
+	// Server
+	g.P("// ", serverName, " is the server API for ", service.Desc.Name(), " service.")
+	g.P("// All implementations must embed Unimplemented", serverName)
+	g.P("// for forward compatibility")
+	g.P("type ", serverName, " interface {")
+	for _, method := range service.Methods {
+		g.P(method.Comments.Leading, signature(method), ") (*", method.Output.GoIdent, ", error)")
+	}
+	g.P("mustEmbedUnimplemented", serverName, "()")
+	g.P("}")
+	g.P()
+	g.P("// Unimplemented", serverName, " must be embedded to have forward compatible implementations.")
+	g.P("type Unimplemented", serverName, " struct {")
+	g.P("}")
+	g.P()
+	for _, method := range service.Methods {
+		g.P("func (Unimplemented", serverName, ") ", signature(method), ") (*", method.Output.GoIdent, ", error) {")
+		g.P("return nil, ", statusPackage.Ident("Errorf"), "(", codesPackage.Ident("Unimplemented"), `, "method `, method.GoName, ` not implemented")`)
+		g.P("}")
+	}
+	g.P("func (Unimplemented", serverName, ") mustEmbedUnimplemented", serverName, "() {}")
+	g.P()
+	g.P("// Unsafe", serverName, " may be embedded to opt out of forward compatibility for this service.")
+	g.P("// Use of this interface is not recommended, as added methods to ", serverName, " will")
+	g.P("// result in compilation errors.")
+	g.P("type Unsafe", serverName, " interface {")
+	g.P("mustEmbedUnimplemented", serverName, "()")
+	g.P("}")
+	g.P()
+	g.P("func Register", serverName, "(s ", grpcPackage.Ident("ServiceRegistrar"), ", srv ", serverName, ") {")
+	g.P("s.RegisterService(&", service.GoName, "_ServiceDesc, srv)")
+	g.P("}")
+
+	// Method handlers
+	for _, method := range service.Methods {
+		handlerName := "_" + service.GoName + "_" + method.GoName + "_Handler"
+		g.P()
+		g.P("func ", handlerName, "(srv interface{}, ctx ", contextPackage.Ident("Context"), ", dec func(interface{}) error, interceptor ", grpcPackage.Ident("UnaryServerInterceptor"), ") (interface{}, error) {")
+		g.P("in := new(", method.Input.GoIdent, ")")
+		g.P("if err := dec(in); err != nil {")
+		g.P("return nil, err")
+		g.P("}")
+		g.P("if interceptor == nil {")
+		g.P("return srv.(", serverName, ").", method.GoName, "(ctx, in)")
+		g.P("}")
+		g.P("info := &", grpcPackage.Ident("UnaryServerInfo"), "{")
+		g.P("Server:     srv,")
+		g.P("FullMethod: ", fullMethodName(method), ",")
+		g.P("}")
+		g.P("handler := func(ctx ", contextPackage.Ident("Context"), ", req interface{}) (interface{}, error) {")
+		g.P("return srv.(", serverName, ").", method.GoName, "(ctx, req.(*", method.Input.GoIdent, "))")
+		g.P("}")
+		g.P("return interceptor(ctx, in, info, handler)")
+		g.P("}")
+	}
+	g.P()
+
+	// Service descriptor
+	g.P("// ", service.GoName, "_ServiceDesc is the ", grpcPackage.Ident("ServiceDesc"), " for ", service.Desc.Name(), " service.")
+	g.P("// It's only intended for direct use with ", grpcPackage.Ident("RegisterService"), ",")
+	g.P("// and not to be introspected or modified (even as a copy)")
+	g.P("var ", service.GoName, "_ServiceDesc = ", grpcPackage.Ident("ServiceDesc"), "{")
+	g.P("ServiceName: ", strconv.Quote(string(service.Desc.FullName())), ",")
+	g.P("HandlerType: (*", serverName, ")(nil),")
+	g.P("Methods: []", grpcPackage.Ident("MethodDesc"), "{")
+	for _, method := range service.Methods {
+		g.P("{")
+		g.P("MethodName: ", strconv.Quote(string(method.Desc.Name())), ",")
+		g.P("Handler:    _", service.GoName, "_", method.GoName, "_Handler,")
+		g.P("},")
+	}
+	g.P("},")
+	g.P("Streams:  []", grpcPackage.Ident("StreamDesc"), "{},")
+	g.P("Metadata: ", strconv.Quote(file.Desc.Path()), ",")
+	g.P("}")
+}
+
+// generateReadmeFile generates the README of the service definition
+func (h *GRPCHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, error) {
+	protoPath := h.protoPath(data)
+	service := data.PackageName + "." + h.serviceName(data)
+
+	readme := &ReadmeBuilder{
+		Language:  "gRPC",
+		CodeFence: "protobuf",
+	}
+
+	readme.Installation = fmt.Sprintf("Copy `%s` into your project and generate the stubs of your language with `protoc` or `buf`:\n\n", protoPath) +
+		codeBlock("bash", fmt.Sprintf("protoc -I . \\\n  --go_out=gen/go --go_opt=paths=source_relative \\\n  --go-grpc_out=gen/go --go-grpc_opt=paths=source_relative \\\n  %s", protoPath)) +
+		"\n\nGo stubs can be generated with the definition by setting the `go_stubs` option; they are written to `gen/go`."
+
+	request, _ := json.MarshalIndent(map[string]interface{}{"input": data.ExampleInput}, "", "  ")
+	readme.Usage = "Call a server implementing the service with any gRPC client, e.g. `grpcurl`:\n\n" +
+		codeBlock("bash", fmt.Sprintf("grpcurl -proto %s -d '%s' \\\n  -H 'x-api-key: your-api-key' localhost:9090 %s/Execute",
+			protoPath, strings.ReplaceAll(string(request), "'", `'\''`), service)) +
+		"\n\nOr with the Go stubs:\n\n" +
+		codeBlock("go", fmt.Sprintf(`conn, err := grpc.Dial("localhost:9090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+if err != nil {
+    log.Fatal(err)
+}
+defer conn.Close()
+
+client := pb.New%sClient(conn)
+execution, err := client.Execute(ctx, &pb.ExecuteRequest{Input: input})`, h.serviceName(data)))
+
+	readme.ClientMethods = []ReadmeEntry{
+		{
+			Name:        "Execute",
+			Description: fmt.Sprintf("Starts an execution of the %s workflow with the provided input.", data.Workflow.Name),
+			Code:        "rpc Execute(ExecuteRequest) returns (ExecuteResponse);",
+		},
+		{
+			Name:        "GetStatus",
+			Description: "Retrieves the status of a workflow execution and its steps.",
+			Code:        "rpc GetStatus(GetStatusRequest) returns (GetStatusResponse);",
+		},
+		{
+			Name:        "Cancel",
+			Description: "Cancels a running workflow execution.",
+			Code:        "rpc Cancel(CancelRequest) returns (CancelResponse);",
+		},
+	}
+
+	readme.TypesTitle = "Messages"
+	readme.Types = []ReadmeEntry{
+		{Name: "Execution", Description: "Represents a workflow execution, its status and output."},
+		{Name: "StepStatus", Description: "Represents the status of a step of an execution."},
+		{Name: "ExecutionStatus", Description: "Enumerates the statuses of a workflow execution."},
+	}
+	for _, model := range data.Models {
+		readme.Types = append(readme.Types, ReadmeEntry{Name: model.Name, Description: model.Description})
+	}
+
+	readme.ErrorHandling = "Servers report failures with the gRPC status codes matching the errors of the REST API:\n\n" +
+		"- `INVALID_ARGUMENT`: the input does not match the workflow's input schema\n" +
+		"- `NOT_FOUND`: the workflow or execution does not exist\n" +
+		"- `UNAUTHENTICATED`: the API key is missing or invalid\n" +
+		"- `FAILED_PRECONDITION`: the execution cannot be cancelled or the workflow was sunset\n" +
+		"- `UNAVAILABLE`: the service is unreachable; retry with backoff"
+
+	readme.Development = "Field numbers are kept when the definition is regenerated with the previous file passed as an existing file, and the numbers of removed fields are reserved, so regenerated definitions stay wire compatible. Check it with:\n\n" +
+		codeBlock("bash", "buf breaking --against '.git#branch=main'")
+
+	readme.Requirements = []string{
+		"protoc 3.15 or higher, or buf",
+		"protoc-gen-go and protoc-gen-go-grpc for Go stubs",
+	}
+
+	return readme.Build(data)
+}
+
+// mapFieldTypeToProto maps JSON schema types to protobuf types. Arrays and
+// objects of unknown shape map to the struct well-known types.
+func (h *GRPCHandler) mapFieldTypeToProto(fieldType string) string {
+	switch fieldType {
+	case "string":
+		return "string"
+	case "integer", "int":
+		return "int64"
+	case "number", "float", "double":
+		return "double"
+	case "boolean", "bool":
+		return "bool"
+	case "array", "list":
+		return "google.protobuf.ListValue"
+	case "object", "map":
+		return "google.protobuf.Struct"
+	default:
+		return "google.protobuf.Value"
+	}
+}
+
+// protoFieldName returns the snake_case field name of a schema property,
+// dropping characters protobuf identifiers cannot hold
+func protoFieldName(property string) string {
+	var name strings.Builder
+	for _, r := range CaseSnake.Apply(property) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			name.WriteRune(r)
+		}
+	}
+
+	result := strings.Trim(name.String(), "_")
+	switch {
+	case result == "":
+		return "field"
+	case result[0] >= '0' && result[0] <= '9':
+		return "field_" + result
+	}
+	return result
+}
+
+// uniqueProtoName suffixes names already used in a message with a number
+func uniqueProtoName(name string, used map[string]bool) string {
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// protoJSONName returns the JSON name protoc derives from a field name,
+// the lowerCamelCase name
+func protoJSONName(name string) string {
+	var result strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper && r >= 'a' && r <= 'z':
+			result.WriteRune(r - 'a' + 'A')
+			upper = false
+		default:
+			result.WriteRune(r)
+			upper = false
+		}
+	}
+	return result.String()
+}
+
+// commentLines splits a description into comment lines
+func commentLines(description string) []string {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return nil
+	}
+	return strings.Split(description, "\n")
+}
+
+// writeProtoComments writes comment lines with the given indent
+func writeProtoComments(b *strings.Builder, indent string, lines []string) {
+	for _, line := range lines {
+		if line == "" {
+			b.WriteString(indent + "//\n")
+			continue
+		}
+		b.WriteString(indent + "// " + line + "\n")
+	}
+}
@@ -0,0 +1,200 @@
+package codegen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestGRPCHandler(t *testing.T) {
+	handler := NewGRPCHandler(NewTemplateManager())
+	workflow := newKotlinWorkflow()
+	request := &GenerationRequest{
+		WorkflowID:  workflow.ID,
+		Language:    LanguageGRPC,
+		PackageName: "example.orders.v1",
+		Options:     map[string]interface{}{"go_stubs": true, "module_name": "github.com/example/orders"},
+	}
+	require.NoError(t, handler.ValidateRequest(request))
+
+	data, err := handler.PrepareTemplateData(workflow, request)
+	require.NoError(t, err)
+
+	files, err := handler.Generate(workflow, request, data)
+	require.NoError(t, err)
+	byPath := make(map[string]GeneratedFile)
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+
+	definition := byPath["example/orders/v1/orders.proto"]
+	require.NotEmpty(t, definition.Content)
+
+	t.Run("service definition", func(t *testing.T) {
+		assertGolden(t, "grpc/orders.proto", definition.Content)
+
+		assert.Equal(t, "schema", definition.Type)
+		assert.Contains(t, definition.Content, "package example.orders.v1;\n")
+		assert.Contains(t, definition.Content, `option go_package = "github.com/example/orders/gen/go/example/orders/v1;ordersv1";`)
+		assert.Contains(t, definition.Content, "service OrdersService {\n")
+		assert.Contains(t, definition.Content, "  rpc Execute(ExecuteRequest) returns (ExecuteResponse);\n")
+		assert.Contains(t, definition.Content, "  rpc GetStatus(GetStatusRequest) returns (GetStatusResponse);\n")
+		assert.Contains(t, definition.Content, "  rpc Cancel(CancelRequest) returns (CancelResponse);\n")
+		assert.Contains(t, definition.Content, "  OrdersInput input = 1;\n")
+		assert.Contains(t, definition.Content, "  OrdersOutput output = 5;\n")
+		assert.Contains(t, definition.Content, "  string workflow_id = 2 [json_name = \"workflow_id\"];\n")
+	})
+
+	t.Run("schema messages", func(t *testing.T) {
+		assert.Contains(t, definition.Content, "// Input of the orders workflow\nmessage OrdersInput {\n")
+		assert.Contains(t, definition.Content, "  // Customer placing the order\n  string customer_id = 1 [json_name = \"customer_id\"];\n")
+		assert.Contains(t, definition.Content, "  optional bool gift = 2;\n")
+		assert.Contains(t, definition.Content, "  google.protobuf.ListValue items = 3;\n")
+		assert.Contains(t, definition.Content, "  google.protobuf.Struct object = 4;\n")
+		assert.Contains(t, definition.Content, "  optional int64 quantity = 5;\n")
+		assert.Contains(t, definition.Content, "message OrdersOutput {\n  double total = 1;\n}\n")
+		assert.Contains(t, definition.Content, "  EXECUTION_STATUS_UNSPECIFIED = 0;\n  EXECUTION_STATUS_PENDING = 1;\n")
+	})
+
+	t.Run("compiles with protoc", func(t *testing.T) {
+		protoc, err := exec.LookPath("protoc")
+		if err != nil {
+			t.Skip("protoc not available")
+		}
+
+		dir := t.TempDir()
+		source := filepath.Join(dir, filepath.FromSlash(definition.Path))
+		require.NoError(t, os.MkdirAll(filepath.Dir(source), 0o755))
+		require.NoError(t, os.WriteFile(source, []byte(definition.Content), 0o644))
+
+		descriptorSet := filepath.Join(dir, "descriptor.pb")
+		output, err := exec.Command(protoc, "-I", dir, "--descriptor_set_out="+descriptorSet, source).CombinedOutput()
+		require.NoError(t, err, string(output))
+
+		raw, err := os.ReadFile(descriptorSet)
+		require.NoError(t, err)
+		var set descriptorpb.FileDescriptorSet
+		require.NoError(t, proto.Unmarshal(raw, &set))
+		require.Len(t, set.File, 1)
+
+		// The Go stubs are generated from the descriptor, which must
+		// describe the same file protoc compiles
+		compiled := set.File[0]
+		built := handler.buildProtoFile(data).descriptor()
+		built.SourceCodeInfo = nil
+		assert.Equal(t, built.GetPackage(), compiled.GetPackage())
+		assert.Equal(t, built.GetDependency(), compiled.GetDependency())
+		assert.True(t, proto.Equal(built.Service[0], compiled.Service[0]), "services differ")
+		assert.True(t, proto.Equal(built.EnumType[0], compiled.EnumType[0]), "enums differ")
+		require.Len(t, compiled.MessageType, len(built.MessageType))
+		for i := range built.MessageType {
+			assert.True(t, proto.Equal(built.MessageType[i], compiled.MessageType[i]), "message %s differs", built.MessageType[i].GetName())
+		}
+	})
+
+	t.Run("go stubs", func(t *testing.T) {
+		messages := byPath["gen/go/example/orders/v1/orders.pb.go"]
+		stubs := byPath["gen/go/example/orders/v1/orders_grpc.pb.go"]
+		require.NotEmpty(t, messages.Content)
+		require.NotEmpty(t, stubs.Content)
+		assert.NoError(t, CheckSyntax([]GeneratedFile{messages, stubs}))
+
+		assert.Contains(t, messages.Content, "package ordersv1\n")
+		assert.Contains(t, messages.Content, "type OrdersInput struct {")
+		assert.Regexp(t, `// Customer placing the order\n\tCustomerId +string +`+"`"+`protobuf:"bytes,1,opt,name=customer_id,proto3" json:"customer_id,omitempty"`, messages.Content)
+		assert.Regexp(t, `\tQuantity +\*int64 `, messages.Content)
+
+		assert.Equal(t, "client", stubs.Type)
+		assert.Contains(t, stubs.Content, "package ordersv1\n")
+		assert.Regexp(t, `OrdersService_Execute_FullMethodName += "/example.orders.v1.OrdersService/Execute"`, stubs.Content)
+		assert.Contains(t, stubs.Content, "func NewOrdersServiceClient(cc grpc.ClientConnInterface) OrdersServiceClient {")
+		assert.Contains(t, stubs.Content, "\t// Execute starts an execution of the workflow.\n\tExecute(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecuteResponse, error)")
+		assert.Contains(t, stubs.Content, "func RegisterOrdersServiceServer(s grpc.ServiceRegistrar, srv OrdersServiceServer) {")
+		assert.Regexp(t, `Metadata: +"example/orders/v1/orders.proto",`, stubs.Content)
+	})
+
+	t.Run("readme", func(t *testing.T) {
+		readme := byPath["README.md"]
+		assert.Contains(t, readme.Content, "# orders gRPC Client\n")
+		assert.Contains(t, readme.Content, "example.orders.v1.OrdersService/Execute")
+		assert.Contains(t, readme.Content, "\n### OrdersInput\n")
+		assert.NotContains(t, readme.Content, "%!")
+	})
+
+	t.Run("without go stubs", func(t *testing.T) {
+		request := &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageGRPC}
+		require.NoError(t, handler.ValidateRequest(request))
+		data, err := handler.PrepareTemplateData(workflow, request)
+		require.NoError(t, err)
+
+		files, err := handler.Generate(workflow, request, data)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		assert.Equal(t, "magicflow/client/v1/orders.proto", files[0].Path)
+		assert.Contains(t, files[0].Content, `option go_package = "github.com/your-org/orders-client/gen/go/magicflow/client/v1;clientv1";`)
+		assert.Equal(t, "README.md", files[1].Path)
+	})
+}
+
+func TestGRPCFieldNumbers(t *testing.T) {
+	handler := NewGRPCHandler(nil)
+	workflow := newKotlinWorkflow()
+	request := &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageGRPC, PackageName: "orders"}
+
+	generate := func(existing map[string]ExistingFile) string {
+		request.Existing = existing
+		data, err := handler.PrepareTemplateData(workflow, request)
+		require.NoError(t, err)
+		files, err := handler.Generate(workflow, request, data)
+		require.NoError(t, err)
+		return files[0].Content
+	}
+
+	first := generate(nil)
+
+	// Drop gift, add a coupon that sorts before every existing property
+	workflow.InputSchema.Properties["coupon"] = map[string]interface{}{"type": "string"}
+	delete(workflow.InputSchema.Properties, "gift")
+	second := generate(map[string]ExistingFile{"orders/orders.proto": {Content: first}})
+
+	assert.Contains(t, second, "message OrdersInput {\n  reserved 2;\n  reserved \"gift\";\n")
+	assert.Contains(t, second, "  string customer_id = 1 [json_name = \"customer_id\"];\n")
+	assert.Contains(t, second, "  google.protobuf.ListValue items = 3;\n")
+	assert.Contains(t, second, "  optional int64 quantity = 5;\n")
+	assert.Contains(t, second, "  optional string coupon = 6;\n")
+
+	// Reserved numbers stay reserved, reserved names may be used again
+	workflow.InputSchema.Properties["gift"] = map[string]interface{}{"type": "boolean"}
+	third := generate(map[string]ExistingFile{"orders/orders.proto": {Content: second}})
+
+	assert.Contains(t, third, "message OrdersInput {\n  reserved 2;\n  // Customer placing the order\n")
+	assert.Contains(t, third, "  optional bool gift = 7;\n")
+	assert.Contains(t, third, "  optional string coupon = 6;\n")
+}
+
+func TestGRPCPackageName(t *testing.T) {
+	handler := NewGRPCHandler(nil)
+
+	for _, name := range []string{"orders", "example.orders.v1", "Example.Orders", "_internal.orders"} {
+		assert.NoError(t, handler.ValidateRequest(&GenerationRequest{PackageName: name}), name)
+	}
+	for _, name := range []string{"1orders", "example..orders", ".orders", "orders.", "orders-client", "orders client"} {
+		assert.Error(t, handler.ValidateRequest(&GenerationRequest{PackageName: name}), name)
+	}
+	assert.Error(t, handler.ValidateRequest(&GenerationRequest{PackageName: "orders", Options: map[string]interface{}{"go_package": 1}}))
+
+	request := &GenerationRequest{}
+	require.NoError(t, handler.ValidateRequest(request))
+	assert.Equal(t, "magicflow.client.v1", request.PackageName)
+
+	assert.Equal(t, "customer_id", protoFieldName("customerId"))
+	assert.Equal(t, "field_2fa", protoFieldName("2fa"))
+	assert.Equal(t, "field", protoFieldName("!!"))
+	assert.Equal(t, "customerId", protoJSONName("customer_id"))
+}
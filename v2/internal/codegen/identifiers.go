@@ -0,0 +1,76 @@
+package codegen
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// defaultClientBaseName is used when a workflow name has no usable characters
+const defaultClientBaseName = "Workflow"
+
+// ClientNamer assigns client class names to workflows. Names are sanitized
+// to valid identifiers in every supported language, and when two different
+// workflow names normalize to the same identifier the later one receives a
+// short hash suffix so generated clients never collide.
+type ClientNamer struct {
+	mu      sync.Mutex
+	claimed map[string]string // identifier -> workflow name
+	names   map[string]string // workflow name -> identifier
+}
+
+// NewClientNamer creates a new client namer
+func NewClientNamer() *ClientNamer {
+	return &ClientNamer{
+		claimed: make(map[string]string),
+		names:   make(map[string]string),
+	}
+}
+
+// ClientClassName returns the client class name for a workflow name. The
+// same workflow name always yields the same class name.
+func (n *ClientNamer) ClientClassName(workflowName string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if className, exists := n.names[workflowName]; exists {
+		return className
+	}
+
+	base := ClientBaseName(workflowName)
+	className := base + "Client"
+	for attempt := 0; ; attempt++ {
+		owner, taken := n.claimed[className]
+		if !taken || owner == workflowName {
+			break
+		}
+		className = base + shortHash(workflowName, attempt) + "Client"
+	}
+
+	n.claimed[className] = workflowName
+	n.names[workflowName] = className
+	return className
+}
+
+// ClientBaseName converts a workflow name to a PascalCase identifier that
+// starts with a letter and contains only ASCII letters and digits
+func ClientBaseName(workflowName string) string {
+	base := ToPascalCase(SanitizeIdentifier(workflowName))
+	if base == "" {
+		return defaultClientBaseName
+	}
+	if base[0] >= '0' && base[0] <= '9' {
+		return defaultClientBaseName + base
+	}
+	return base
+}
+
+// shortHash returns a six character hex hash of a workflow name
+func shortHash(workflowName string, attempt int) string {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(workflowName))
+	if attempt > 0 {
+		fmt.Fprintf(hasher, "#%d", attempt)
+	}
+	return fmt.Sprintf("%08x", hasher.Sum32())[:6]
+}
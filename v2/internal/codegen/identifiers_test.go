@@ -0,0 +1,70 @@
+package codegen
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+var validClassName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+func TestClientNamer(t *testing.T) {
+	t.Run("sanitizes unusual characters", func(t *testing.T) {
+		namer := NewClientNamer()
+
+		assert.Equal(t, "MyFlowClient", namer.ClientClassName("my-flow!"))
+	})
+
+	t.Run("names that normalize identically", func(t *testing.T) {
+		namer := NewClientNamer()
+
+		first := namer.ClientClassName("order flow")
+		second := namer.ClientClassName("order-flow")
+
+		assert.Equal(t, "OrderFlowClient", first)
+		assert.NotEqual(t, first, second)
+		assert.Regexp(t, `^OrderFlow[0-9a-f]{6}Client$`, second)
+		assert.Equal(t, second, namer.ClientClassName("order-flow"), "names must be stable")
+		assert.Equal(t, first, namer.ClientClassName("order flow"), "names must be stable")
+	})
+
+	t.Run("invalid identifiers", func(t *testing.T) {
+		namer := NewClientNamer()
+
+		assert.Equal(t, "WorkflowClient", namer.ClientClassName("!!!"))
+		assert.Equal(t, "Workflow2faClient", namer.ClientClassName("2fa"))
+	})
+}
+
+func TestHandlersUseClientNamer(t *testing.T) {
+	handlers := map[string]LanguageHandler{
+		"go":         NewGoHandler(nil),
+		"grpc":       NewGRPCHandler(nil),
+		"java":       NewJavaHandler(nil),
+		"kotlin":     NewKotlinHandler(nil),
+		"python":     NewPythonHandler(nil),
+		"ruby":       NewRubyHandler(nil),
+		"swift":      NewSwiftHandler(nil),
+		"typescript": NewTypeScriptHandler(nil),
+	}
+
+	for language, handler := range handlers {
+		t.Run(language, func(t *testing.T) {
+			request := &GenerationRequest{WorkflowID: uuid.New(), PackageName: "com.example.flows"}
+
+			first, err := handler.PrepareTemplateData(&models.Workflow{ID: uuid.New(), Name: "my-flow!"}, request)
+			require.NoError(t, err)
+			second, err := handler.PrepareTemplateData(&models.Workflow{ID: uuid.New(), Name: "my flow"}, request)
+			require.NoError(t, err)
+
+			assert.Equal(t, "MyFlowClient", first.ClassName)
+			assert.Regexp(t, validClassName, second.ClassName)
+			assert.NotEqual(t, first.ClassName, second.ClassName)
+		})
+	}
+}
@@ -2,21 +2,25 @@ package codegen
 
 import (
 	"fmt"
+	"html"
 	"path/filepath"
 	"strings"
 
+	"magic-flow/v2/internal/branding"
 	"magic-flow/v2/pkg/models"
 )
 
 // JavaHandler implements LanguageHandler for Java code generation
 type JavaHandler struct {
 	templateManager *TemplateManager
+	namer           *ClientNamer
 }
 
 // NewJavaHandler creates a new Java language handler
 func NewJavaHandler(templateManager *TemplateManager) *JavaHandler {
 	return &JavaHandler{
 		templateManager: templateManager,
+		namer:           NewClientNamer(),
 	}
 }
 
@@ -106,7 +110,7 @@ func (h *JavaHandler) PrepareTemplateData(workflow *models.Workflow, request *Ge
 		packageName = h.GetDefaultPackageName()
 	}
 
-	className := ToPascalCase(workflow.Name) + "Client"
+	className := h.namer.ClientClassName(workflow.Name)
 
 	// Extract methods from workflow steps
 	methods := ExtractStepMethods(workflow)
@@ -118,14 +122,15 @@ func (h *JavaHandler) PrepareTemplateData(workflow *models.Workflow, request *Ge
 	models := h.generateModels(workflow)
 
 	templateData := &TemplateData{
-		Workflow:    workflow,
-		PackageName: packageName,
-		ClassName:   className,
-		Imports:     imports,
-		Methods:     methods,
-		Models:      models,
-		Options:     request.Options,
-		GeneratedAt: workflow.CreatedAt,
+		Workflow:     workflow,
+		PackageName:  packageName,
+		ClassName:    className,
+		Imports:      imports,
+		Methods:      methods,
+		Models:       models,
+		Options:      request.Options,
+		GeneratedAt:  workflow.CreatedAt,
+		ExampleInput: WorkflowExampleInput(workflow),
 	}
 
 	return templateData, nil
@@ -245,6 +250,7 @@ import java.time.Duration;
 public class ClientConfig {
     public static final String WORKFLOW_ID = "%s";
     public static final String WORKFLOW_NAME = "%s";
+    public static final String WORKFLOW_VERSION = "%s";
     public static final String DEFAULT_BASE_URL = "http://localhost:8080";
     public static final Duration DEFAULT_TIMEOUT = Duration.ofSeconds(30);
     public static final int DEFAULT_RETRY_ATTEMPTS = 3;
@@ -296,6 +302,7 @@ public class ClientConfig {
 		data.GeneratedAt.Format("2006-01-02 15:04:05"),
 		data.Workflow.ID.String(),
 		data.Workflow.Name,
+		data.Workflow.Version,
 	)
 
 	packagePath = strings.ReplaceAll(data.PackageName, ".", "/")
@@ -380,10 +387,7 @@ func (h *JavaHandler) generatePomFile(data *TemplateData) (GeneratedFile, error)
 
     <developers>
         <developer>
-            <name>Magic Flow</name>
-            <email>contact@magicflow.dev</email>
-            <organization>Magic Flow</organization>
-            <organizationUrl>https://magicflow.dev</organizationUrl>
+%s
         </developer>
     </developers>
 
@@ -455,6 +459,9 @@ func (h *JavaHandler) generatePomFile(data *TemplateData) (GeneratedFile, error)
             <version>${okhttp.version}</version>
             <scope>test</scope>
         </dependency>
+
+        <!-- magic-flow:user-begin dependencies -->
+        <!-- magic-flow:user-end dependencies -->
     </dependencies>
 
     <build>
@@ -531,6 +538,7 @@ func (h *JavaHandler) generatePomFile(data *TemplateData) (GeneratedFile, error)
 		version,
 		data.Workflow.Name,
 		data.Workflow.Name,
+		pomDeveloper(data.Messages.Profile()),
 	)
 
 	return GeneratedFile{
@@ -581,6 +589,9 @@ dependencies {
     testImplementation 'org.mockito:mockito-core:5.5.0'
     testImplementation 'org.mockito:mockito-junit-jupiter:5.5.0'
     testImplementation 'com.squareup.okhttp3:mockwebserver:4.11.0'
+
+    // magic-flow:user-begin dependencies
+    // magic-flow:user-end dependencies
 }
 
 tasks.named('test') {
@@ -620,10 +631,7 @@ publishing {
                 
                 developers {
                     developer {
-                        name = 'Magic Flow'
-                        email = 'contact@magicflow.dev'
-                        organization = 'Magic Flow'
-                        organizationUrl = 'https://magicflow.dev'
+%s
                     }
                 }
                 
@@ -652,6 +660,7 @@ tasks.withType(Javadoc) {
 		version,
 		data.Workflow.Name,
 		data.Workflow.Name,
+		gradleDeveloper(data.Messages.Profile()),
 	)
 
 	return GeneratedFile{
@@ -662,6 +671,35 @@ tasks.withType(Javadoc) {
 	}, nil
 }
 
+// pomDeveloper renders the developer of the pom.xml from the branding
+// profile, leaving out the fields it does not set
+func pomDeveloper(profile branding.Profile) string {
+	lines := []string{fmt.Sprintf("            <name>%s</name>", html.EscapeString(profile.ProductName))}
+	if profile.ContactEmail != "" {
+		lines = append(lines, fmt.Sprintf("            <email>%s</email>", html.EscapeString(profile.ContactEmail)))
+	}
+	lines = append(lines, fmt.Sprintf("            <organization>%s</organization>", html.EscapeString(profile.ProductName)))
+	if profile.SupportURL != "" {
+		lines = append(lines, fmt.Sprintf("            <organizationUrl>%s</organizationUrl>", html.EscapeString(profile.SupportURL)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// gradleDeveloper renders the developer of the build.gradle publication
+// from the branding profile
+func gradleDeveloper(profile branding.Profile) string {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace
+	lines := []string{fmt.Sprintf("                        name = '%s'", quote(profile.ProductName))}
+	if profile.ContactEmail != "" {
+		lines = append(lines, fmt.Sprintf("                        email = '%s'", quote(profile.ContactEmail)))
+	}
+	lines = append(lines, fmt.Sprintf("                        organization = '%s'", quote(profile.ProductName)))
+	if profile.SupportURL != "" {
+		lines = append(lines, fmt.Sprintf("                        organizationUrl = '%s'", quote(profile.SupportURL)))
+	}
+	return strings.Join(lines, "\n")
+}
+
 // generateReadmeFile generates the README file
 func (h *JavaHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, error) {
 	groupId := "com.magicflow"
@@ -685,36 +723,21 @@ func (h *JavaHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, err
 		}
 	}
 
-	content := fmt.Sprintf(`# %s Java Client
-
-Generated Java client library for the %s workflow.
-
-## Installation
-
-### Maven
-
-Add the following dependency to your ` + "`pom.xml`" + `:
+	readme := &ReadmeBuilder{
+		Language:  "Java",
+		CodeFence: "java",
+	}
 
-` + "```xml" + `
-<dependency>
+	readme.Installation = "### Maven\n\nAdd the following dependency to your `pom.xml`:\n\n" +
+		codeBlock("xml", fmt.Sprintf(`<dependency>
     <groupId>%s</groupId>
     <artifactId>%s</artifactId>
     <version>%s</version>
-</dependency>
-` + "```" + `
-
-### Gradle
-
-Add the following dependency to your ` + "`build.gradle`" + `:
-
-` + "```gradle" + `
-implementation '%s:%s:%s'
-` + "```" + `
+</dependency>`, groupId, artifactId, version)) +
+		"\n\n### Gradle\n\nAdd the following dependency to your `build.gradle`:\n\n" +
+		codeBlock("gradle", fmt.Sprintf("implementation '%s:%s:%s'", groupId, artifactId, version))
 
-## Quick Start
-
-` + "```java" + `
-import %s.%s;
+	readme.Usage = readme.CodeBlock(fmt.Sprintf(`import %s.%s;
 import %s.config.ClientConfig;
 import %s.models.*;
 import %s.exceptions.*;
@@ -731,8 +754,7 @@ public class Example {
         
         try {
             // Execute workflow
-            Map<String, Object> inputData = new HashMap<>();
-            inputData.put("key", "value");
+            Map<String, Object> inputData = %s;
             
             ExecutionResult result = client.executeWorkflow(inputData);
             System.out.println("Execution ID: " + result.getId());
@@ -753,71 +775,59 @@ public class Example {
             System.err.println("Error: " + e.getMessage());
         }
     }
-}
-` + "```" + `
-
-## API Reference
-
-### Client Methods
-
-#### executeWorkflow
-
-Executes the %s workflow with the provided input.
-
-` + "```java" + `
-public ExecutionResult executeWorkflow(Map<String, Object> inputData) 
-    throws MagicFlowException
-` + "```" + `
-
-#### getExecutionStatus
-
-Retrieves the status of a workflow execution.
-
-` + "```java" + `
-public ExecutionStatus getExecutionStatus(UUID executionId) 
-    throws MagicFlowException
-` + "```" + `
-
-#### cancelExecution
-
-Cancels a running workflow execution.
-
-` + "```java" + `
-public void cancelExecution(UUID executionId) 
-    throws MagicFlowException
-` + "```" + `
-
-#### getExecutionResult
-
-Retrieves the result of a completed workflow execution.
-
-` + "```java" + `
-public ExecutionResult getExecutionResult(UUID executionId) 
-    throws MagicFlowException
-` + "```" + `
-
-#### waitForCompletion
-
-Waits for a workflow execution to complete.
-
-` + "```java" + `
-public ExecutionResult waitForCompletion(
+}`,
+		data.PackageName,
+		data.ClassName,
+		data.PackageName,
+		data.PackageName,
+		data.PackageName,
+		data.ClassName,
+		data.ClassName,
+		JavaLiteral(data.ExampleInput, "            "),
+	))
+
+	readme.ClientMethods = []ReadmeEntry{
+		{
+			Name:        "executeWorkflow",
+			Description: fmt.Sprintf("Executes the %s workflow with the provided input.", data.Workflow.Name),
+			Code: `public ExecutionResult executeWorkflow(Map<String, Object> inputData) 
+    throws MagicFlowException`,
+		},
+		{
+			Name:        "getExecutionStatus",
+			Description: "Retrieves the status of a workflow execution.",
+			Code: `public ExecutionStatus getExecutionStatus(UUID executionId) 
+    throws MagicFlowException`,
+		},
+		{
+			Name:        "cancelExecution",
+			Description: "Cancels a running workflow execution.",
+			Code: `public void cancelExecution(UUID executionId) 
+    throws MagicFlowException`,
+		},
+		{
+			Name:        "getExecutionResult",
+			Description: "Retrieves the result of a completed workflow execution.",
+			Code: `public ExecutionResult getExecutionResult(UUID executionId) 
+    throws MagicFlowException`,
+		},
+		{
+			Name:        "waitForCompletion",
+			Description: "Waits for a workflow execution to complete.",
+			Code: `public ExecutionResult waitForCompletion(
     UUID executionId, 
     Duration timeout, 
     Duration pollInterval
-) throws MagicFlowException
-` + "```" + `
-
-%s
-
-## Models
-
-### ExecutionResult
-
-Represents the result of a workflow execution.
+) throws MagicFlowException`,
+		},
+	}
+	readme.MethodDocs = h.generateMethodDocs(data.Methods)
 
-` + "```java" + `
-public class ExecutionResult {
+	readme.Types = []ReadmeEntry{
+		{
+			Name:        "ExecutionResult",
+			Description: "Represents the result of a workflow execution.",
+			Code: `public class ExecutionResult {
     private UUID id;
     private UUID workflowId;
     private ExecutionStatus status;
@@ -829,15 +839,12 @@ public class ExecutionResult {
     private Duration duration;
     
     // Getters and setters...
-}
-` + "```" + `
-
-### ExecutionStatus
-
-Represents the status of a workflow execution.
-
-` + "```java" + `
-public class ExecutionStatus {
+}`,
+		},
+		{
+			Name:        "ExecutionStatus",
+			Description: "Represents the status of a workflow execution.",
+			Code: `public class ExecutionStatus {
     private UUID id;
     private Status status;
     private int progress;
@@ -851,15 +858,12 @@ public class ExecutionStatus {
     }
     
     // Getters and setters...
-}
-` + "```" + `
-
-### StepStatus
-
-Represents the status of a workflow step.
-
-` + "```java" + `
-public class StepStatus {
+}`,
+		},
+		{
+			Name:        "StepStatus",
+			Description: "Represents the status of a workflow step.",
+			Code: `public class StepStatus {
     private String id;
     private String name;
     private Status status;
@@ -875,15 +879,12 @@ public class StepStatus {
     }
     
     // Getters and setters...
-}
-` + "```" + `
-
-## Configuration
-
-### ClientConfig
+}`,
+		},
+	}
 
-` + "```java" + `
-ClientConfig config = new ClientConfig()
+	readme.Configuration = "### ClientConfig\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`ClientConfig config = new ClientConfig()
     .setBaseUrl("http://localhost:8080")
     .setApiKey("your-api-key")
     .setTimeout(Duration.ofSeconds(30))
@@ -891,31 +892,11 @@ ClientConfig config = new ClientConfig()
     .setRetryDelay(Duration.ofSeconds(1))
     .setDebug(false);
 
-%s client = new %s(config);
-` + "```" + `
-
-### Environment Variables
-
-` + "```bash" + `
-# Set default base URL
-export MAGICFLOW_BASE_URL="http://localhost:8080"
+%s client = new %s(config);`, data.ClassName, data.ClassName)) +
+		"\n\n### Environment Variables\n\n" + readmeEnvironmentVariables
 
-# Set default API key
-export MAGICFLOW_API_KEY="your-api-key"
-
-# Set default timeout (seconds)
-export MAGICFLOW_TIMEOUT="30"
-
-# Enable debug logging
-export MAGICFLOW_DEBUG="true"
-` + "```" + `
-
-## Exception Handling
-
-The client provides several exception types for different error scenarios:
-
-` + "```java" + `
-try {
+	readme.ErrorHandling = "The client provides several exception types for different error scenarios:\n\n" +
+		readme.CodeBlock(`try {
     ExecutionResult result = client.executeWorkflow(inputData);
 } catch (AuthenticationException e) {
     // Invalid API key
@@ -941,111 +922,42 @@ try {
 } catch (MagicFlowException e) {
     // Base exception for all client errors
     System.err.println("General error: " + e.getMessage());
-}
-` + "```" + `
-
-## Logging
-
-The client uses SLF4J for logging. Add a logging implementation to your project:
-
-### Logback (recommended)
-
-` + "```xml" + `
-<dependency>
+}`)
+
+	readme.Sections = []ReadmeSection{
+		{
+			Title: "Logging",
+			Content: "The client uses SLF4J for logging. Add a logging implementation to your project:\n\n" +
+				"### Logback (recommended)\n\n" +
+				codeBlock("xml", `<dependency>
     <groupId>ch.qos.logback</groupId>
     <artifactId>logback-classic</artifactId>
     <version>1.4.11</version>
-</dependency>
-` + "```" + `
-
-### Log4j2
-
-` + "```xml" + `
-<dependency>
+</dependency>`) +
+				"\n\n### Log4j2\n\n" +
+				codeBlock("xml", `<dependency>
     <groupId>org.apache.logging.log4j</groupId>
     <artifactId>log4j-slf4j2-impl</artifactId>
     <version>2.20.0</version>
-</dependency>
-` + "```" + `
-
-## Development
-
-### Building the Project
-
-` + "```bash" + `
-# Using Maven
-mvn clean compile
-
-# Using Gradle
-./gradlew build
-` + "```" + `
-
-### Running Tests
-
-` + "```bash" + `
-# Using Maven
-mvn test
-
-# Using Gradle
-./gradlew test
-` + "```" + `
-
-### Generating Documentation
-
-` + "```bash" + `
-# Using Maven
-mvn javadoc:javadoc
-
-# Using Gradle
-./gradlew javadoc
-` + "```" + `
-
-### Code Coverage
-
-` + "```bash" + `
-# Using Maven
-mvn jacoco:report
-
-# Using Gradle
-./gradlew jacocoTestReport
-` + "```" + `
-
-## Requirements
-
-- Java 11 or higher
-- Maven 3.6+ or Gradle 7.0+
-
-## License
+</dependency>`),
+		},
+	}
 
-Generated code - see original workflow license.
-`,
-		data.Workflow.Name,
-		data.Workflow.Name,
-		groupId,
-		artifactId,
-		version,
-		groupId,
-		artifactId,
-		version,
-		data.PackageName,
-		data.ClassName,
-		data.PackageName,
-		data.PackageName,
-		data.PackageName,
-		data.ClassName,
-		data.ClassName,
-		data.Workflow.Name,
-		h.generateMethodDocs(data.Methods),
-		data.ClassName,
-		data.ClassName,
-	)
+	readme.Development = "### Building the Project\n\n" +
+		codeBlock("bash", "# Using Maven\nmvn clean compile\n\n# Using Gradle\n./gradlew build") +
+		"\n\n### Running Tests\n\n" +
+		codeBlock("bash", "# Using Maven\nmvn test\n\n# Using Gradle\n./gradlew test") +
+		"\n\n### Generating Documentation\n\n" +
+		codeBlock("bash", "# Using Maven\nmvn javadoc:javadoc\n\n# Using Gradle\n./gradlew javadoc") +
+		"\n\n### Code Coverage\n\n" +
+		codeBlock("bash", "# Using Maven\nmvn jacoco:report\n\n# Using Gradle\n./gradlew jacocoTestReport")
+
+	readme.Requirements = []string{
+		"Java 11 or higher",
+		"Maven 3.6+ or Gradle 7.0+",
+	}
 
-	return GeneratedFile{
-		Path:     "README.md",
-		Content:  content,
-		Language: "markdown",
-		Type:     "documentation",
-	}, nil
+	return readme.Build(data)
 }
 
 // generateBaseModelContent generates content for base model classes
@@ -0,0 +1,670 @@
+package codegen
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// kotlinHardKeywords cannot be used as identifiers in Kotlin without
+// backticks
+var kotlinHardKeywords = map[string]bool{
+	"as": true, "break": true, "class": true, "continue": true,
+	"do": true, "else": true, "false": true, "for": true,
+	"fun": true, "if": true, "in": true, "interface": true,
+	"is": true, "null": true, "object": true, "package": true,
+	"return": true, "super": true, "this": true, "throw": true,
+	"true": true, "try": true, "typealias": true, "typeof": true,
+	"val": true, "var": true, "when": true, "while": true,
+}
+
+// KotlinHandler implements LanguageHandler for Kotlin code generation. The
+// generated client exposes suspend functions on top of OkHttp and uses data
+// classes for the workflow models.
+type KotlinHandler struct {
+	templateManager *TemplateManager
+	namer           *ClientNamer
+}
+
+// kotlinTemplateData is the template data of the Kotlin client, which also
+// needs the name of the typed input model
+type kotlinTemplateData struct {
+	*TemplateData
+	InputModel string
+}
+
+// NewKotlinHandler creates a new Kotlin language handler
+func NewKotlinHandler(templateManager *TemplateManager) *KotlinHandler {
+	return &KotlinHandler{
+		templateManager: templateManager,
+		namer:           NewClientNamer(),
+	}
+}
+
+// Generate generates Kotlin code for a workflow
+func (h *KotlinHandler) Generate(workflow *models.Workflow, request *GenerationRequest, templateData *TemplateData) ([]GeneratedFile, error) {
+	var files []GeneratedFile
+
+	// Generate client file
+	clientFile, err := h.generateClientFile(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client file: %w", err)
+	}
+	files = append(files, clientFile)
+
+	// Generate models file
+	modelsFile, err := h.generateTemplateFile(templateData, "models", filepath.Join("models", "Models.kt"), "model")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate models file: %w", err)
+	}
+	files = append(files, modelsFile)
+
+	// Generate constants file
+	typesFile, err := h.generateTemplateFile(templateData, "types", "Constants.kt", "types")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate constants file: %w", err)
+	}
+	files = append(files, typesFile)
+
+	files = append(files, h.generateExceptionFile(templateData))
+	files = append(files, h.generateConfigFile(templateData))
+
+	// Generate test file if requested
+	if request.IncludeTests {
+		testFile, err := h.generateTestFile(templateData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate test file: %w", err)
+		}
+		files = append(files, testFile)
+	}
+
+	// Generate gradle build files
+	files = append(files, h.generateGradleFiles(templateData)...)
+
+	// Generate README file
+	readmeFile, err := h.generateReadmeFile(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate README file: %w", err)
+	}
+	files = append(files, readmeFile)
+
+	return files, nil
+}
+
+// ValidateRequest validates Kotlin-specific generation request
+func (h *KotlinHandler) ValidateRequest(request *GenerationRequest) error {
+	if request.PackageName == "" {
+		request.PackageName = h.GetDefaultPackageName()
+	}
+
+	if !isValidKotlinPackageName(request.PackageName) {
+		return fmt.Errorf("invalid Kotlin package name: %s", request.PackageName)
+	}
+
+	return nil
+}
+
+// PrepareTemplateData prepares template data for Kotlin code generation
+func (h *KotlinHandler) PrepareTemplateData(workflow *models.Workflow, request *GenerationRequest) (*TemplateData, error) {
+	packageName := request.PackageName
+	if packageName == "" {
+		packageName = h.GetDefaultPackageName()
+	}
+
+	className := h.namer.ClientClassName(workflow.Name)
+
+	// Step methods return the workflow output
+	methods := ExtractStepMethods(workflow)
+	for i := range methods {
+		methods[i].ReturnType = "Map<String, Any?>?"
+		for j := range methods[i].Parameters {
+			methods[i].Parameters[j].Type = h.mapFieldTypeToKotlin(methods[i].Parameters[j].Type)
+		}
+	}
+
+	templateData := &TemplateData{
+		Workflow:     workflow,
+		PackageName:  packageName,
+		ClassName:    className,
+		Methods:      methods,
+		Models:       h.generateModels(workflow, strings.TrimSuffix(className, "Client")),
+		Options:      request.Options,
+		GeneratedAt:  workflow.CreatedAt,
+		ExampleInput: WorkflowExampleInput(workflow),
+	}
+
+	return templateData, nil
+}
+
+// GetFileExtension returns the file extension for Kotlin files
+func (h *KotlinHandler) GetFileExtension() string {
+	return ".kt"
+}
+
+// GetDefaultPackageName returns the default package name for Kotlin
+func (h *KotlinHandler) GetDefaultPackageName() string {
+	return "com.magicflow.client"
+}
+
+// sourcePath returns the path of a file in the main source set
+func (h *KotlinHandler) sourcePath(data *TemplateData, name string) string {
+	return filepath.Join("src", "main", "kotlin", strings.ReplaceAll(data.PackageName, ".", "/"), name)
+}
+
+// generateClientFile generates the main client file
+func (h *KotlinHandler) generateClientFile(data *TemplateData) (GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("kotlin", "client")
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	clientData := &kotlinTemplateData{TemplateData: data}
+	for _, model := range data.Models {
+		if model.Name == strings.TrimSuffix(data.ClassName, "Client")+"Input" {
+			clientData.InputModel = model.Name
+		}
+	}
+
+	content, err := RenderTemplate(template, clientData)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	return GeneratedFile{
+		Path:     h.sourcePath(data, data.ClassName+".kt"),
+		Content:  content,
+		Language: "kotlin",
+		Type:     "client",
+	}, nil
+}
+
+// generateTemplateFile renders a template into a file of the main source set
+func (h *KotlinHandler) generateTemplateFile(data *TemplateData, templateName, name, fileType string) (GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("kotlin", templateName)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	content, err := RenderTemplate(template, data)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	return GeneratedFile{
+		Path:     h.sourcePath(data, name),
+		Content:  content,
+		Language: "kotlin",
+		Type:     fileType,
+	}, nil
+}
+
+// generateExceptionFile generates the sealed exception hierarchy. A sealed
+// class lets callers handle every error case in an exhaustive when.
+func (h *KotlinHandler) generateExceptionFile(data *TemplateData) GeneratedFile {
+	content := fmt.Sprintf(`package %s.exceptions
+
+/**
+ * Base exception for Magic Flow client errors
+ * Generated at: %s
+ */
+sealed class MagicFlowException(message: String, cause: Throwable? = null) : Exception(message, cause)
+
+/** The server rejected the request */
+class ApiException(
+    message: String,
+    val statusCode: Int,
+    val responseBody: String? = null,
+) : MagicFlowException(message)
+
+/** The API key is missing or invalid */
+class AuthenticationException(message: String) : MagicFlowException(message)
+
+/** The workflow input is invalid */
+class ValidationException(message: String) : MagicFlowException(message)
+
+/** The workflow execution failed or was cancelled */
+class ExecutionException(
+    message: String,
+    val executionId: String? = null,
+    val stepId: String? = null,
+) : MagicFlowException(message)
+
+/** A request or an execution did not complete in time */
+class TimeoutException(message: String, cause: Throwable? = null) : MagicFlowException(message, cause)
+
+/** The server could not be reached */
+class NetworkException(message: String, cause: Throwable? = null) : MagicFlowException(message, cause)
+`,
+		data.PackageName,
+		data.GeneratedAt.Format("2006-01-02 15:04:05"),
+	)
+
+	return GeneratedFile{
+		Path:     h.sourcePath(data, filepath.Join("exceptions", "MagicFlowException.kt")),
+		Content:  content,
+		Language: "kotlin",
+		Type:     "exception",
+	}
+}
+
+// generateConfigFile generates the configuration file
+func (h *KotlinHandler) generateConfigFile(data *TemplateData) GeneratedFile {
+	content := fmt.Sprintf(`package %s.config
+
+import kotlin.time.Duration
+import kotlin.time.Duration.Companion.seconds
+
+/**
+ * Configuration for the %s client. The base URL and API key default to the
+ * MAGICFLOW_BASE_URL and MAGICFLOW_API_KEY environment variables.
+ * Generated at: %s
+ */
+data class ClientConfig(
+    val baseUrl: String = System.getenv("MAGICFLOW_BASE_URL") ?: DEFAULT_BASE_URL,
+    val apiKey: String = System.getenv("MAGICFLOW_API_KEY").orEmpty(),
+    val timeout: Duration = DEFAULT_TIMEOUT,
+    val retryAttempts: Int = DEFAULT_RETRY_ATTEMPTS,
+    val retryDelay: Duration = DEFAULT_RETRY_DELAY,
+    val debug: Boolean = false,
+) {
+    companion object {
+        const val DEFAULT_BASE_URL = "http://localhost:8080"
+        const val DEFAULT_RETRY_ATTEMPTS = 3
+        val DEFAULT_TIMEOUT = 30.seconds
+        val DEFAULT_RETRY_DELAY = 1.seconds
+    }
+}
+`,
+		data.PackageName,
+		data.Workflow.Name,
+		data.GeneratedAt.Format("2006-01-02 15:04:05"),
+	)
+
+	return GeneratedFile{
+		Path:     h.sourcePath(data, filepath.Join("config", "ClientConfig.kt")),
+		Content:  content,
+		Language: "kotlin",
+		Type:     "config",
+	}
+}
+
+// generateTestFile generates the test file
+func (h *KotlinHandler) generateTestFile(data *TemplateData) (GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("kotlin", "test")
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	content, err := RenderTemplate(template, data)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	packagePath := strings.ReplaceAll(data.PackageName, ".", "/")
+	filePath := filepath.Join("src", "test", "kotlin", packagePath, data.ClassName+"Test.kt")
+
+	return GeneratedFile{
+		Path:     filePath,
+		Content:  content,
+		Language: "kotlin",
+		Type:     "test",
+	}, nil
+}
+
+// buildCoordinates returns the group, artifact and version of the client
+func (h *KotlinHandler) buildCoordinates(data *TemplateData) (string, string, string) {
+	groupId := "com.magicflow"
+	artifactId := ToSnakeCase(data.Workflow.Name) + "-client"
+	version := "1.0.0"
+	if data.Options != nil {
+		if g, ok := data.Options["group_id"].(string); ok && g != "" {
+			groupId = g
+		}
+		if a, ok := data.Options["artifact_id"].(string); ok && a != "" {
+			artifactId = a
+		}
+		if v, ok := data.Options["version"].(string); ok && v != "" {
+			version = v
+		}
+	}
+	return groupId, artifactId, version
+}
+
+// generateGradleFiles generates the build.gradle.kts and settings.gradle.kts
+// files
+func (h *KotlinHandler) generateGradleFiles(data *TemplateData) []GeneratedFile {
+	groupId, artifactId, version := h.buildCoordinates(data)
+
+	build := fmt.Sprintf(`plugins {
+    kotlin("jvm") version "1.9.22"
+    `+"`java-library`"+`
+    `+"`maven-publish`"+`
+}
+
+group = "%s"
+version = "%s"
+
+repositories {
+    mavenCentral()
+}
+
+dependencies {
+    // HTTP Client
+    implementation("com.squareup.okhttp3:okhttp:4.12.0")
+
+    // Coroutines
+    implementation("org.jetbrains.kotlinx:kotlinx-coroutines-core:1.7.3")
+
+    // JSON Processing
+    implementation("com.fasterxml.jackson.module:jackson-module-kotlin:2.15.2")
+    implementation("com.fasterxml.jackson.datatype:jackson-datatype-jsr310:2.15.2")
+
+    // Test Dependencies
+    testImplementation(kotlin("test"))
+    testImplementation("org.jetbrains.kotlinx:kotlinx-coroutines-test:1.7.3")
+    testImplementation("com.squareup.okhttp3:mockwebserver:4.12.0")
+
+    // magic-flow:user-begin dependencies
+    // magic-flow:user-end dependencies
+}
+
+kotlin {
+    jvmToolchain(11)
+}
+
+java {
+    withSourcesJar()
+}
+
+tasks.test {
+    useJUnitPlatform()
+}
+
+publishing {
+    publications {
+        create<MavenPublication>("maven") {
+            from(components["java"])
+
+            pom {
+                name.set("%s Kotlin Client")
+                description.set("Kotlin client library for %s workflow")
+                licenses {
+                    license {
+                        name.set("MIT License")
+                        url.set("https://opensource.org/licenses/MIT")
+                    }
+                }
+            }
+        }
+    }
+}
+`,
+		groupId,
+		version,
+		data.Workflow.Name,
+		data.Workflow.Name,
+	)
+
+	return []GeneratedFile{
+		{
+			Path:     "build.gradle.kts",
+			Content:  build,
+			Language: "gradle",
+			Type:     "config",
+		},
+		{
+			Path:     "settings.gradle.kts",
+			Content:  fmt.Sprintf("rootProject.name = %q\n", artifactId),
+			Language: "gradle",
+			Type:     "config",
+		},
+	}
+}
+
+// generateReadmeFile generates the README file
+func (h *KotlinHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, error) {
+	groupId, artifactId, version := h.buildCoordinates(data)
+
+	readme := &ReadmeBuilder{
+		Language:  "Kotlin",
+		CodeFence: "kotlin",
+	}
+
+	readme.Installation = "### Gradle (Kotlin DSL)\n\nAdd the following dependency to your `build.gradle.kts`:\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`implementation("%s:%s:%s")`, groupId, artifactId, version))
+
+	readme.Usage = readme.CodeBlock(fmt.Sprintf(`import %s.%s
+import %s.config.ClientConfig
+import %s.exceptions.*
+import kotlinx.coroutines.runBlocking
+
+fun main() = runBlocking {
+    val client = %s(ClientConfig(baseUrl = "http://localhost:8080", apiKey = "your-api-key"))
+
+    try {
+        // Execute workflow
+        val result = client.executeWorkflow(
+            %s
+        )
+        println("Execution ID: ${result.id}")
+
+        // Wait for the execution to complete
+        val completed = client.waitForCompletion(result.id)
+        println("Output: ${completed.output}")
+    } catch (e: MagicFlowException) {
+        println("Error: ${e.message}")
+    }
+}`,
+		data.PackageName,
+		data.ClassName,
+		data.PackageName,
+		data.PackageName,
+		data.ClassName,
+		KotlinLiteral(data.ExampleInput, "            "),
+	))
+
+	readme.ClientMethods = []ReadmeEntry{
+		{
+			Name:        "executeWorkflow",
+			Description: fmt.Sprintf("Executes the %s workflow with the provided input.", data.Workflow.Name),
+			Code:        "suspend fun executeWorkflow(input: Map<String, Any?>): ExecutionResult",
+		},
+		{
+			Name:        "getExecutionStatus",
+			Description: "Retrieves the status of a workflow execution.",
+			Code:        "suspend fun getExecutionStatus(executionId: String): ExecutionStatus",
+		},
+		{
+			Name:        "cancelExecution",
+			Description: "Cancels a running workflow execution.",
+			Code:        "suspend fun cancelExecution(executionId: String)",
+		},
+		{
+			Name:        "getExecutionResult",
+			Description: "Retrieves the result of a completed workflow execution.",
+			Code:        "suspend fun getExecutionResult(executionId: String): ExecutionResult",
+		},
+		{
+			Name:        "waitForCompletion",
+			Description: "Polls a workflow execution until it completes.",
+			Code: `suspend fun waitForCompletion(
+    executionId: String,
+    timeout: Duration = 5.minutes,
+    pollInterval: Duration = 1.seconds,
+): ExecutionResult`,
+		},
+	}
+	readme.MethodDocs = h.generateMethodDocs(data.Methods)
+
+	readme.Types = []ReadmeEntry{
+		{
+			Name:        "ExecutionResult",
+			Description: "Represents the result of a workflow execution.",
+			Code: `data class ExecutionResult(
+    val id: String,
+    val workflowId: String,
+    val status: String,
+    val input: Map<String, Any?>?,
+    val output: Map<String, Any?>?,
+    val error: String?,
+    val startedAt: Instant?,
+    val completedAt: Instant?,
+    val duration: Long?,
+)`,
+		},
+		{
+			Name:        "ExecutionStatus",
+			Description: "Represents the status of a workflow execution.",
+			Code: `data class ExecutionStatus(
+    val id: String,
+    val status: String,
+    val progress: Double,
+    val message: String?,
+    val currentStep: String?,
+    val steps: List<StepStatus>,
+)`,
+		},
+	}
+	for _, model := range data.Models {
+		readme.Types = append(readme.Types, ReadmeEntry{Name: model.Name, Description: model.Description})
+	}
+
+	readme.Configuration = "### ClientConfig\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`val config = ClientConfig(
+    baseUrl = "http://localhost:8080",
+    apiKey = "your-api-key",
+    timeout = 30.seconds,
+    retryAttempts = 3,
+    retryDelay = 1.seconds,
+)
+
+val client = %s(config)`, data.ClassName)) +
+		"\n\n### Environment Variables\n\n" + readmeEnvironmentVariables
+
+	readme.ErrorHandling = "Errors are reported with a sealed `MagicFlowException` hierarchy, so a `when` over it is exhaustive:\n\n" +
+		readme.CodeBlock(`try {
+    client.executeWorkflow(input)
+} catch (e: MagicFlowException) {
+    when (e) {
+        is AuthenticationException -> println("Authentication failed: ${e.message}")
+        is ValidationException -> println("Validation error: ${e.message}")
+        is ExecutionException -> println("Execution ${e.executionId} failed at step ${e.stepId}")
+        is TimeoutException -> println("Request timed out: ${e.message}")
+        is NetworkException -> println("Network error: ${e.message}")
+        is ApiException -> println("API error ${e.statusCode}: ${e.message}")
+    }
+}`)
+
+	readme.Development = "### Building the Project\n\n" +
+		codeBlock("bash", "./gradlew build") +
+		"\n\n### Running Tests\n\n" +
+		codeBlock("bash", "./gradlew test")
+
+	readme.Requirements = []string{
+		"Kotlin 1.9 or higher",
+		"Java 11 or higher",
+		"Gradle 7.0+",
+	}
+
+	return readme.Build(data)
+}
+
+// generateModels generates data classes for the workflow input and output
+// schemas
+func (h *KotlinHandler) generateModels(workflow *models.Workflow, baseName string) []ModelData {
+	return schemaModels(workflow, baseName, h.mapFieldTypeToKotlin)
+}
+
+// mapFieldTypeToKotlin maps field types to Kotlin types
+func (h *KotlinHandler) mapFieldTypeToKotlin(fieldType string) string {
+	switch fieldType {
+	case "string":
+		return "String"
+	case "integer", "int":
+		return "Long"
+	case "number", "float", "double":
+		return "Double"
+	case "boolean", "bool":
+		return "Boolean"
+	case "array", "list":
+		return "List<Any?>"
+	case "object", "map":
+		return "Map<String, Any?>"
+	default:
+		return "Any"
+	}
+}
+
+// generateMethodDocs generates documentation for methods
+func (h *KotlinHandler) generateMethodDocs(methods []MethodData) string {
+	if len(methods) == 0 {
+		return ""
+	}
+
+	docs := "\n### Workflow Methods\n\n"
+	for _, method := range methods {
+		parameters := make([]string, len(method.Parameters))
+		for i, param := range method.Parameters {
+			parameters[i] = escapeKotlinIdentifier(param.Name) + ": " + param.Type
+		}
+		docs += fmt.Sprintf("#### %s\n\n%s\n\n```kotlin\nsuspend fun %s(%s): Map<String, Any?>?\n```\n\n",
+			method.Name,
+			method.Description,
+			escapeKotlinIdentifier(method.Name),
+			strings.Join(parameters, ", "),
+		)
+	}
+
+	return docs
+}
+
+// escapeKotlinIdentifier quotes identifiers that are Kotlin hard keywords
+// with backticks
+func escapeKotlinIdentifier(identifier string) string {
+	if kotlinHardKeywords[identifier] {
+		return "`" + identifier + "`"
+	}
+	return identifier
+}
+
+// isValidKotlinPackageName validates Kotlin package name. Every segment must
+// be an identifier that is usable without backticks.
+func isValidKotlinPackageName(packageName string) bool {
+	if packageName == "" {
+		return false
+	}
+
+	for _, part := range strings.Split(packageName, ".") {
+		if !isValidKotlinIdentifier(part) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isValidKotlinIdentifier validates Kotlin identifier
+func isValidKotlinIdentifier(identifier string) bool {
+	if identifier == "" || kotlinHardKeywords[identifier] {
+		return false
+	}
+
+	// Names made only of underscores are reserved
+	if strings.Trim(identifier, "_") == "" {
+		return false
+	}
+
+	for i, r := range identifier {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && unicode.IsDigit(r):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,141 @@
+package codegen
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func newKotlinWorkflow() *models.Workflow {
+	return &models.Workflow{
+		ID:        uuid.MustParse("7d5e2a0c-3f1b-4c8e-9a6d-2b4f8e1c0a57"),
+		Name:      "orders",
+		Version:   "1.2.0",
+		CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		InputSchema: models.JSONSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"customer_id": map[string]interface{}{"type": "string", "description": "Customer placing the order"},
+				"items":       map[string]interface{}{"type": "array"},
+				"quantity":    map[string]interface{}{"type": "integer"},
+				"gift":        map[string]interface{}{"type": "boolean"},
+				"object":      map[string]interface{}{"type": "object"},
+			},
+			Required: []string{"customer_id", "items"},
+		},
+		OutputSchema: models.JSONSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"total": map[string]interface{}{"type": "number"},
+			},
+			Required: []string{"total"},
+		},
+	}
+}
+
+// assertGolden compares generated content with a golden file under testdata.
+// Run the tests with -update to rewrite the golden files.
+func assertGolden(t *testing.T, name, actual string) {
+	t.Helper()
+	golden := filepath.Join("testdata", name+".golden")
+	if *update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0755))
+		require.NoError(t, os.WriteFile(golden, []byte(actual), 0644))
+	}
+
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), actual, "generated %s changed; rerun with -update if intended", name)
+}
+
+func TestKotlinHandler(t *testing.T) {
+	handler := NewKotlinHandler(NewTemplateManager())
+	workflow := newKotlinWorkflow()
+	request := &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageKotlin, PackageName: "com.example.orders", IncludeTests: true}
+	require.NoError(t, handler.ValidateRequest(request))
+
+	data, err := prepareTemplateData(handler, workflow, request)
+	require.NoError(t, err)
+	data.Methods = []MethodData{{
+		Name:        "validateOrder",
+		Description: "Validate order",
+		StepID:      "validate_order",
+		ReturnType:  "Map<String, Any?>?",
+		Parameters: []ParameterData{
+			{Name: "strict", Type: "Boolean"},
+			{Name: "in", Type: "String"},
+		},
+	}}
+
+	files, err := handler.Generate(workflow, request, data)
+	require.NoError(t, err)
+	byPath := make(map[string]GeneratedFile)
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+
+	source := "src/main/kotlin/com/example/orders/"
+	client := byPath[source+"OrdersClient.kt"]
+	modelsFile := byPath[source+"models/Models.kt"]
+	require.NotEmpty(t, client.Content)
+	require.NotEmpty(t, modelsFile.Content)
+
+	t.Run("data classes", func(t *testing.T) {
+		assertGolden(t, "kotlin/Models.kt", modelsFile.Content)
+
+		assert.Contains(t, modelsFile.Content, "data class OrdersInput(\n")
+		assert.Contains(t, modelsFile.Content, `@JsonProperty("customer_id") val customerId: String,`)
+		assert.Contains(t, modelsFile.Content, `@JsonProperty("quantity") val quantity: Long? = null,`)
+		assert.Contains(t, modelsFile.Content, "@JsonProperty(\"object\") val `object`: Map<String, Any?>? = null,")
+		assert.Contains(t, modelsFile.Content, "data class OrdersOutput(\n")
+	})
+
+	t.Run("suspend functions", func(t *testing.T) {
+		assertGolden(t, "kotlin/OrdersClient.kt", client.Content)
+
+		assert.Contains(t, client.Content, "suspend fun executeWorkflow(input: Map<String, Any?>): ExecutionResult")
+		assert.Contains(t, client.Content, "suspend fun executeWorkflow(input: OrdersInput): ExecutionResult")
+		assert.Contains(t, client.Content, "suspend fun validateOrder(strict: Boolean, `in`: String): Map<String, Any?>?")
+		assert.Contains(t, client.Content, "suspend fun getExecutionStatus(executionId: String): ExecutionStatus")
+		assert.Contains(t, client.Content, "suspendCancellableCoroutine")
+	})
+
+	t.Run("sealed errors and build files", func(t *testing.T) {
+		exceptions := byPath[source+"exceptions/MagicFlowException.kt"]
+		assert.Contains(t, exceptions.Content, "sealed class MagicFlowException(")
+		assert.Contains(t, exceptions.Content, "class AuthenticationException(message: String) : MagicFlowException(message)")
+
+		build := byPath["build.gradle.kts"]
+		assert.Equal(t, "config", build.Type)
+		assert.Contains(t, build.Content, `kotlin("jvm")`)
+		assert.Contains(t, build.Content, "// magic-flow:user-begin dependencies")
+		assert.Contains(t, byPath["settings.gradle.kts"].Content, `rootProject.name = "orders-client"`)
+
+		assert.Contains(t, byPath["src/test/kotlin/com/example/orders/OrdersClientTest.kt"].Content, `"customer_id" to "customer-123",`)
+	})
+}
+
+func TestKotlinPackageName(t *testing.T) {
+	handler := NewKotlinHandler(nil)
+
+	for _, name := range []string{"com.example.orders", "orders", "com.example._internal", "com.exämple.v2"} {
+		assert.NoError(t, handler.ValidateRequest(&GenerationRequest{PackageName: name}), name)
+	}
+	for _, name := range []string{"com..example", "com.example.", "com.2fa", "com.example.fun", "com.object.orders", "com.my-flow", "com._", "com.`orders`"} {
+		assert.Error(t, handler.ValidateRequest(&GenerationRequest{PackageName: name}), name)
+	}
+
+	request := &GenerationRequest{}
+	require.NoError(t, handler.ValidateRequest(request))
+	assert.Equal(t, "com.magicflow.client", request.PackageName)
+}
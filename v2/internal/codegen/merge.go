@@ -0,0 +1,289 @@
+package codegen
+
+import "strings"
+
+// Markers fencing the sections of generated config files that belong to the
+// user, e.g. "<!-- magic-flow:user-begin dependencies -->" in pom.xml. The
+// content between the markers of a section survives regeneration.
+const (
+	userSectionBegin = "magic-flow:user-begin"
+	userSectionEnd   = "magic-flow:user-end"
+)
+
+// ExistingFile is a previously generated file as it is in the user's project
+type ExistingFile struct {
+	// Content is the file including the user's edits
+	Content string `json:"content"`
+	// Base is the file as it was generated before the user edited it. When
+	// set, the file is three-way merged with the regenerated one, otherwise
+	// only its user sections are kept.
+	Base string `json:"base,omitempty"`
+}
+
+// MergeFile merges a regenerated file with the existing one. With a base,
+// changes made by the user and by the generator since the base are both
+// applied; where they overlap the file gets conflict markers and conflict is
+// true. Without a base, the user sections of the existing file replace those
+// of the regenerated one.
+func MergeFile(existing ExistingFile, generated string) (merged string, conflict bool) {
+	if existing.Base != "" {
+		return merge3(existing.Base, existing.Content, generated)
+	}
+	return keepUserSections(existing.Content, generated), false
+}
+
+// mergeExistingFiles merges the generated config files with their existing
+// versions in place. It returns the paths of the merged files and of those
+// with conflicts.
+func mergeExistingFiles(files []GeneratedFile, existing map[string]ExistingFile) (merged, conflicts []string) {
+	if len(existing) == 0 {
+		return nil, nil
+	}
+
+	for i := range files {
+		if files[i].Type != "config" {
+			continue
+		}
+		previous, ok := existing[files[i].Path]
+		if !ok {
+			continue
+		}
+
+		content, conflict := MergeFile(previous, files[i].Content)
+		files[i].Content = content
+		merged = append(merged, files[i].Path)
+		if conflict {
+			conflicts = append(conflicts, files[i].Path)
+		}
+	}
+	return merged, conflicts
+}
+
+// keepUserSections replaces the user sections of the generated content with
+// those of the existing content. Sections the generator no longer emits are
+// dropped.
+func keepUserSections(existing, generated string) string {
+	sections := userSections(splitLines(existing))
+
+	var out []string
+	var skipping bool
+	for _, line := range splitLines(generated) {
+		if skipping {
+			if _, ok := sectionName(line, userSectionEnd); !ok {
+				continue
+			}
+			skipping = false
+		}
+		out = append(out, line)
+
+		if name, ok := sectionName(line, userSectionBegin); ok {
+			if body, found := sections[name]; found {
+				out = append(out, body...)
+				skipping = true
+			}
+		}
+	}
+	return strings.Join(out, "")
+}
+
+// userSections returns the lines between the markers of each terminated
+// user section, by section name
+func userSections(lines []string) map[string][]string {
+	sections := make(map[string][]string)
+
+	var name string
+	var body []string
+	var open bool
+	for _, line := range lines {
+		if end, ok := sectionName(line, userSectionEnd); ok {
+			if open && end == name {
+				sections[name] = body
+			}
+			open = false
+			continue
+		}
+		if begin, ok := sectionName(line, userSectionBegin); ok {
+			name, body, open = begin, nil, true
+			continue
+		}
+		if open {
+			body = append(body, line)
+		}
+	}
+	return sections
+}
+
+// sectionName returns the name following a section marker on a line
+func sectionName(line, marker string) (string, bool) {
+	idx := strings.Index(line, marker)
+	if idx < 0 {
+		return "", false
+	}
+	fields := strings.Fields(line[idx+len(marker):])
+	if len(fields) == 0 || fields[0] == "-->" {
+		return "", true
+	}
+	return fields[0], true
+}
+
+// hunk replaces the base lines [start, end) with lines
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// merge3 merges the changes from base to ours and from base to theirs line by
+// line. Changes touching the same or adjacent base lines conflict unless both
+// sides made the same change.
+func merge3(base, ours, theirs string) (string, bool) {
+	baseLines := splitLines(base)
+	ourHunks := diffLines(baseLines, splitLines(ours))
+	theirHunks := diffLines(baseLines, splitLines(theirs))
+
+	var out []string
+	var conflict bool
+	pos := 0
+	for len(ourHunks) > 0 || len(theirHunks) > 0 {
+		// Start a group with the earliest hunk and grow it with the hunks of
+		// either side that touch it
+		start, end := len(baseLines)+1, -1
+		if len(ourHunks) > 0 {
+			start, end = ourHunks[0].start, ourHunks[0].end
+		}
+		if len(theirHunks) > 0 && theirHunks[0].start < start {
+			start, end = theirHunks[0].start, theirHunks[0].end
+		}
+
+		var ourGroup, theirGroup []hunk
+		for grown := true; grown; {
+			grown = false
+			if len(ourHunks) > 0 && ourHunks[0].start <= end {
+				end = max(end, ourHunks[0].end)
+				ourGroup, ourHunks = append(ourGroup, ourHunks[0]), ourHunks[1:]
+				grown = true
+			}
+			if len(theirHunks) > 0 && theirHunks[0].start <= end {
+				end = max(end, theirHunks[0].end)
+				theirGroup, theirHunks = append(theirGroup, theirHunks[0]), theirHunks[1:]
+				grown = true
+			}
+		}
+
+		out = append(out, baseLines[pos:start]...)
+		ourLines := applyHunks(baseLines, start, end, ourGroup)
+		theirLines := applyHunks(baseLines, start, end, theirGroup)
+		switch {
+		case len(ourGroup) == 0:
+			out = append(out, theirLines...)
+		case len(theirGroup) == 0 || equalLines(ourLines, theirLines):
+			out = append(out, ourLines...)
+		default:
+			conflict = true
+			out = append(out, "<<<<<<< existing\n")
+			out = append(out, terminateLines(ourLines)...)
+			out = append(out, "=======\n")
+			out = append(out, terminateLines(theirLines)...)
+			out = append(out, ">>>>>>> generated\n")
+		}
+		pos = end
+	}
+	out = append(out, baseLines[pos:]...)
+
+	return strings.Join(out, ""), conflict
+}
+
+// diffLines returns the hunks turning base into other, following a longest
+// common subsequence of their lines
+func diffLines(base, other []string) []hunk {
+	n, m := len(base), len(other)
+
+	// lcs[i][j] is the length of the longest common subsequence of base[i:]
+	// and other[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if base[i] == other[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var hunks []hunk
+	var current *hunk
+	i, j := 0, 0
+	for i < n || j < m {
+		if i < n && j < m && base[i] == other[j] {
+			if current != nil {
+				hunks = append(hunks, *current)
+				current = nil
+			}
+			i++
+			j++
+			continue
+		}
+
+		if current == nil {
+			current = &hunk{start: i, end: i}
+		}
+		if j < m && (i == n || lcs[i][j+1] >= lcs[i+1][j]) {
+			current.lines = append(current.lines, other[j])
+			j++
+		} else {
+			i++
+			current.end = i
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+	return hunks
+}
+
+// applyHunks returns the base lines [start, end) with the hunks applied
+func applyHunks(base []string, start, end int, hunks []hunk) []string {
+	var out []string
+	pos := start
+	for _, h := range hunks {
+		out = append(out, base[pos:h.start]...)
+		out = append(out, h.lines...)
+		pos = h.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+// splitLines splits content into lines keeping their line endings
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// terminateLines makes sure the last line ends with a newline, so conflict
+// markers start on their own line
+func terminateLines(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	terminated := append([]string(nil), lines...)
+	terminated[len(terminated)-1] += "\n"
+	return terminated
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
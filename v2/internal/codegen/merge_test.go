@@ -0,0 +1,102 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+const userDependency = `        <dependency>
+            <groupId>org.postgresql</groupId>
+            <artifactId>postgresql</artifactId>
+            <version>42.6.0</version>
+        </dependency>
+`
+
+func TestRegenerateKeepsUserEdits(t *testing.T) {
+	workflow := &models.Workflow{ID: uuid.New(), Name: "orders"}
+	generator := NewCodeGenerator()
+
+	generate := func(version string, existing map[string]ExistingFile) *GenerationResult {
+		result, err := generator.Generate(workflow, &GenerationRequest{
+			WorkflowID:     workflow.ID,
+			Language:       LanguageJava,
+			ValidateOutput: true,
+			Options:        map[string]interface{}{"version": version},
+			Existing:       existing,
+		})
+		require.NoError(t, err)
+		return result
+	}
+	base := generatedFile(t, generate("1.0.0", nil), "pom.xml")
+
+	t.Run("user section", func(t *testing.T) {
+		edited := strings.Replace(base, "        <!-- magic-flow:user-end dependencies -->\n",
+			userDependency+"        <!-- magic-flow:user-end dependencies -->\n", 1)
+		require.NotEqual(t, base, edited)
+
+		result := generate("1.1.0", map[string]ExistingFile{"pom.xml": {Content: edited}})
+		pom := generatedFile(t, result, "pom.xml")
+
+		assert.Contains(t, pom, userDependency)
+		assert.Contains(t, pom, "<version>1.1.0</version>")
+		assert.Equal(t, 1, strings.Count(pom, "<artifactId>postgresql</artifactId>"))
+		assert.Equal(t, []string{"pom.xml"}, result.Metadata["merged_files"])
+		assert.NotContains(t, result.Metadata, "merge_conflicts")
+	})
+
+	t.Run("three-way merge", func(t *testing.T) {
+		// The dependency is added outside of the user section
+		edited := strings.Replace(base, "    </dependencies>\n", userDependency+"    </dependencies>\n", 1)
+
+		result := generate("1.1.0", map[string]ExistingFile{"pom.xml": {Content: edited, Base: base}})
+		pom := generatedFile(t, result, "pom.xml")
+
+		assert.Contains(t, pom, userDependency)
+		assert.Contains(t, pom, "<version>1.1.0</version>")
+		assert.NotContains(t, pom, "<version>1.0.0</version>")
+		assert.NotContains(t, result.Metadata, "merge_conflicts")
+	})
+
+	t.Run("only config files are merged", func(t *testing.T) {
+		result := generate("1.1.0", map[string]ExistingFile{"README.md": {Content: "my notes\n"}})
+		assert.NotEqual(t, "my notes\n", generatedFile(t, result, "README.md"))
+		assert.NotContains(t, result.Metadata, "merged_files")
+	})
+}
+
+func TestMergeFile(t *testing.T) {
+	base := "a\nb\nc\nd\n"
+
+	t.Run("independent changes", func(t *testing.T) {
+		merged, conflict := MergeFile(ExistingFile{Base: base, Content: "a\nuser\nb\nc\nd\n"}, "a\nb\nc\nD\n")
+		assert.False(t, conflict)
+		assert.Equal(t, "a\nuser\nb\nc\nD\n", merged)
+	})
+
+	t.Run("same change on both sides", func(t *testing.T) {
+		merged, conflict := MergeFile(ExistingFile{Base: base, Content: "a\nB\nc\nd\n"}, "a\nB\nc\nd\n")
+		assert.False(t, conflict)
+		assert.Equal(t, "a\nB\nc\nd\n", merged)
+	})
+
+	t.Run("conflicting changes", func(t *testing.T) {
+		merged, conflict := MergeFile(ExistingFile{Base: base, Content: "a\nuser\nc\nd\n"}, "a\ngenerated\nc\nd\n")
+		assert.True(t, conflict)
+		assert.Equal(t, "a\n<<<<<<< existing\nuser\n=======\ngenerated\n>>>>>>> generated\nc\nd\n", merged)
+	})
+
+	t.Run("user sections without a base", func(t *testing.T) {
+		existing := "old\n# magic-flow:user-begin deps\nmine\n# magic-flow:user-end deps\n"
+		generated := "new\n# magic-flow:user-begin deps\n# magic-flow:user-end deps\n"
+
+		merged, conflict := MergeFile(ExistingFile{Content: existing}, generated)
+		assert.False(t, conflict)
+		assert.Equal(t, "new\n# magic-flow:user-begin deps\nmine\n# magic-flow:user-end deps\n", merged)
+	})
+}
@@ -0,0 +1,152 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// CaseStyle is the casing of generated identifiers
+type CaseStyle string
+
+const (
+	CaseCamel  CaseStyle = "camelCase"
+	CaseSnake  CaseStyle = "snake_case"
+	CasePascal CaseStyle = "PascalCase"
+)
+
+// NamingConvention controls the casing of generated method and field names.
+// Styles left empty fall back to the idiom of the target language.
+type NamingConvention struct {
+	Methods CaseStyle `json:"methods,omitempty"`
+	Fields  CaseStyle `json:"fields,omitempty"`
+}
+
+// DefaultNamingConvention returns the idiomatic naming convention of a
+// language
+func DefaultNamingConvention(language Language) NamingConvention {
+	switch language {
+	case LanguageGo:
+		return NamingConvention{Methods: CasePascal, Fields: CasePascal}
+	case LanguagePython, LanguageRuby:
+		return NamingConvention{Methods: CaseSnake, Fields: CaseSnake}
+	default:
+		return NamingConvention{Methods: CaseCamel, Fields: CaseCamel}
+	}
+}
+
+// ResolveNamingConvention fills the styles a request leaves empty with the
+// defaults of the language
+func ResolveNamingConvention(language Language, convention *NamingConvention) NamingConvention {
+	resolved := DefaultNamingConvention(language)
+	if convention == nil {
+		return resolved
+	}
+	if convention.Methods != "" {
+		resolved.Methods = convention.Methods
+	}
+	if convention.Fields != "" {
+		resolved.Fields = convention.Fields
+	}
+	return resolved
+}
+
+// Validate checks that the styles are known
+func (c *NamingConvention) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, style := range []CaseStyle{c.Methods, c.Fields} {
+		switch style {
+		case "", CaseCamel, CaseSnake, CasePascal:
+		default:
+			return fmt.Errorf("unsupported naming style: %s", style)
+		}
+	}
+	return nil
+}
+
+// Apply converts a name to the style. Words are split on separators and on
+// case changes, so names already in another style convert cleanly.
+func (s CaseStyle) Apply(name string) string {
+	words := splitWords(name)
+	if len(words) == 0 {
+		return name
+	}
+
+	switch s {
+	case CaseSnake:
+		return strings.Join(words, "_")
+	case CasePascal:
+		var result strings.Builder
+		for _, word := range words {
+			result.WriteString(capitalize(word))
+		}
+		return result.String()
+	case CaseCamel:
+		var result strings.Builder
+		result.WriteString(words[0])
+		for _, word := range words[1:] {
+			result.WriteString(capitalize(word))
+		}
+		return result.String()
+	default:
+		return name
+	}
+}
+
+// applyNamingConvention renames the methods and model fields of template
+// data. Method names are derived from the step ID they call.
+func applyNamingConvention(data *TemplateData, convention NamingConvention) {
+	for i := range data.Methods {
+		source := data.Methods[i].StepID
+		if source == "" {
+			source = data.Methods[i].Name
+		}
+		data.Methods[i].Name = convention.Methods.Apply(SanitizeIdentifier(source))
+	}
+	for i := range data.Models {
+		for j := range data.Models[i].Fields {
+			data.Models[i].Fields[j].Name = convention.Fields.Apply(data.Models[i].Fields[j].Name)
+		}
+	}
+}
+
+// splitWords splits an identifier into lowercase words
+func splitWords(name string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(name)
+
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == ' ' || r == '.':
+			flush()
+			continue
+		case unicode.IsUpper(r) && len(current) > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			// Split fooBar and the Bar of HTTPBar, but keep HTTP together
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+
+	return words
+}
+
+func capitalize(word string) string {
+	runes := []rune(word)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,98 @@
+package codegen
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func TestCaseStyleApply(t *testing.T) {
+	cases := []struct {
+		input  string
+		camel  string
+		snake  string
+		pascal string
+	}{
+		{"process-order", "processOrder", "process_order", "ProcessOrder"},
+		{"process_order", "processOrder", "process_order", "ProcessOrder"},
+		{"processOrder", "processOrder", "process_order", "ProcessOrder"},
+		{"ProcessOrder", "processOrder", "process_order", "ProcessOrder"},
+		{"fetchHTTPResponse", "fetchHttpResponse", "fetch_http_response", "FetchHttpResponse"},
+		{"step 2 retry", "step2Retry", "step_2_retry", "Step2Retry"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.camel, CaseCamel.Apply(tc.input))
+			assert.Equal(t, tc.snake, CaseSnake.Apply(tc.input))
+			assert.Equal(t, tc.pascal, CasePascal.Apply(tc.input))
+		})
+	}
+}
+
+func TestResolveNamingConvention(t *testing.T) {
+	assert.Equal(t, NamingConvention{Methods: CaseSnake, Fields: CaseSnake}, ResolveNamingConvention(LanguagePython, nil))
+	assert.Equal(t, NamingConvention{Methods: CaseCamel, Fields: CaseCamel}, ResolveNamingConvention(LanguageTypeScript, nil))
+	assert.Equal(t, NamingConvention{Methods: CasePascal, Fields: CasePascal}, ResolveNamingConvention(LanguageGo, nil))
+	assert.Equal(t, NamingConvention{Methods: CaseCamel, Fields: CaseSnake},
+		ResolveNamingConvention(LanguagePython, &NamingConvention{Methods: CaseCamel}))
+
+	assert.Error(t, (&NamingConvention{Methods: "kebab-case"}).Validate())
+	assert.NoError(t, (&NamingConvention{Fields: CasePascal}).Validate())
+}
+
+func TestPythonClientNamingConvention(t *testing.T) {
+	handler := NewPythonHandler(NewTemplateManager())
+	workflow := &models.Workflow{ID: uuid.New(), Name: "orders"}
+
+	render := func(t *testing.T, naming *NamingConvention) (client, modelsFile string) {
+		data := &TemplateData{
+			Workflow:    workflow,
+			PackageName: "orders_client",
+			ClassName:   "OrdersClient",
+			Methods: []MethodData{
+				{Name: ToCamelCase("process-order"), StepID: "process-order", Description: "Process order"},
+				{Name: ToCamelCase("notify_customer"), StepID: "notify_customer", Description: "Notify customer"},
+			},
+			Models: []ModelData{
+				{Name: "OrderInput", Fields: []FieldData{{Name: "customer_id", Type: "str"}}},
+			},
+		}
+		applyNamingConvention(data, ResolveNamingConvention(LanguagePython, naming))
+
+		clientFile, err := handler.generateClientFile(data)
+		require.NoError(t, err)
+		models, err := handler.generateModelsFile(data)
+		require.NoError(t, err)
+		return clientFile.Content, models.Content
+	}
+
+	t.Run("snake_case by default", func(t *testing.T) {
+		client, modelsFile := render(t, nil)
+
+		assert.Contains(t, client, "def process_order(self")
+		assert.Contains(t, client, "def notify_customer(self")
+		assert.NotContains(t, client, "def processOrder(")
+		assert.Contains(t, modelsFile, "customer_id: str")
+	})
+
+	t.Run("camelCase when requested", func(t *testing.T) {
+		client, modelsFile := render(t, &NamingConvention{Methods: CaseCamel, Fields: CaseCamel})
+
+		assert.Contains(t, client, "def processOrder(self")
+		assert.Contains(t, client, "def notifyCustomer(self")
+		assert.NotContains(t, client, "def process_order(")
+		assert.Contains(t, modelsFile, "customerId: str")
+	})
+}
+
+func TestGoHandlerRejectsUnexportedNaming(t *testing.T) {
+	handler := NewGoHandler(NewTemplateManager())
+
+	assert.NoError(t, handler.ValidateRequest(&GenerationRequest{}))
+	assert.Error(t, handler.ValidateRequest(&GenerationRequest{Naming: &NamingConvention{Methods: CaseCamel}}))
+	assert.Error(t, handler.ValidateRequest(&GenerationRequest{Naming: &NamingConvention{Fields: CaseSnake}}))
+}
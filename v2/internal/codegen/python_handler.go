@@ -11,12 +11,14 @@ import (
 // PythonHandler implements LanguageHandler for Python code generation
 type PythonHandler struct {
 	templateManager *TemplateManager
+	namer           *ClientNamer
 }
 
 // NewPythonHandler creates a new Python language handler
 func NewPythonHandler(templateManager *TemplateManager) *PythonHandler {
 	return &PythonHandler{
 		templateManager: templateManager,
+		namer:           NewClientNamer(),
 	}
 }
 
@@ -120,7 +122,7 @@ func (h *PythonHandler) PrepareTemplateData(workflow *models.Workflow, request *
 		packageName = h.GetDefaultPackageName()
 	}
 
-	className := ToPascalCase(workflow.Name) + "Client"
+	className := h.namer.ClientClassName(workflow.Name)
 
 	// Extract methods from workflow steps
 	methods := ExtractStepMethods(workflow)
@@ -132,14 +134,15 @@ func (h *PythonHandler) PrepareTemplateData(workflow *models.Workflow, request *
 	models := h.generateModels(workflow)
 
 	templateData := &TemplateData{
-		Workflow:    workflow,
-		PackageName: packageName,
-		ClassName:   className,
-		Imports:     imports,
-		Methods:     methods,
-		Models:      models,
-		Options:     request.Options,
-		GeneratedAt: workflow.CreatedAt,
+		Workflow:     workflow,
+		PackageName:  packageName,
+		ClassName:    className,
+		Imports:      imports,
+		Methods:      methods,
+		Models:       models,
+		Options:      request.Options,
+		GeneratedAt:  workflow.CreatedAt,
+		ExampleInput: WorkflowExampleInput(workflow),
 	}
 
 	return templateData, nil
@@ -342,14 +345,15 @@ func (h *PythonHandler) generateSetupFile(data *TemplateData) (GeneratedFile, er
 		}
 	}
 
-	author := "Magic Flow"
+	profile := data.Messages.Profile()
+	author := profile.ProductName
 	if data.Options != nil {
 		if a, ok := data.Options["author"].(string); ok && a != "" {
 			author = a
 		}
 	}
 
-	email := "contact@magicflow.dev"
+	email := profile.ContactEmail
 	if data.Options != nil {
 		if e, ok := data.Options["email"].(string); ok && e != "" {
 			email = e
@@ -418,6 +422,9 @@ setup(
             "sphinx>=6.0.0",
             "sphinx-rtd-theme>=1.2.0",
         ],
+        "msgpack": [
+            "msgpack>=1.0.0",
+        ],
     },
     keywords=["magic-flow", "workflow", "client", "api"],
     include_package_data=True,
@@ -451,6 +458,9 @@ typing-extensions>=4.5.0
 # Optional dependencies for async support
 aiohttp>=3.8.0
 
+# Optional dependencies for MessagePack support (install with pip install -e ".[msgpack]")
+# msgpack>=1.0.0
+
 # Development dependencies (install with pip install -e ".[dev]")
 # pytest>=7.0.0
 # pytest-cov>=4.0.0
@@ -459,6 +469,9 @@ aiohttp>=3.8.0
 # flake8>=6.0.0
 # mypy>=1.0.0
 # isort>=5.12.0
+
+# magic-flow:user-begin requirements
+# magic-flow:user-end requirements
 `
 
 	return GeneratedFile{
@@ -478,14 +491,15 @@ func (h *PythonHandler) generatePyprojectFile(data *TemplateData) (GeneratedFile
 		}
 	}
 
-	author := "Magic Flow"
+	profile := data.Messages.Profile()
+	author := profile.ProductName
 	if data.Options != nil {
 		if a, ok := data.Options["author"].(string); ok && a != "" {
 			author = a
 		}
 	}
 
-	email := "contact@magicflow.dev"
+	email := profile.ContactEmail
 	if data.Options != nil {
 		if e, ok := data.Options["email"].(string); ok && e != "" {
 			email = e
@@ -542,6 +556,9 @@ docs = [
 async = [
     "aiohttp>=3.8.0",
 ]
+msgpack = [
+    "msgpack>=1.0.0",
+]
 
 [project.urls]
 "Homepage" = "https://github.com/your-org/your-repo"
@@ -660,20 +677,14 @@ exclude_lines = [
 
 // generateReadmeFile generates the README file
 func (h *PythonHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, error) {
-	content := fmt.Sprintf(`# %s Python Client
-
-Generated Python client library for the %s workflow.
-
-## Installation
-
-` + "```bash" + `
-pip install %s
-` + "```" + `
+	readme := &ReadmeBuilder{
+		Language:  "Python",
+		CodeFence: "python",
+	}
 
-## Quick Start
+	readme.Installation = codeBlock("bash", fmt.Sprintf("pip install %s", data.PackageName))
 
-` + "```python" + `
-from %s import %s
+	readme.Usage = readme.CodeBlock(fmt.Sprintf(`from %s import %s
 
 # Initialize the client
 client = %s(
@@ -682,9 +693,7 @@ client = %s(
 )
 
 # Execute workflow
-input_data = {
-    "key": "value"
-}
+input_data = %s
 
 try:
     result = client.execute_workflow(input_data)
@@ -697,13 +706,17 @@ try:
     print(f"Progress: {status.progress}%%")
     
 except Exception as e:
-    print(f"Error executing workflow: {e}")
-` + "```" + `
-
-## Async Usage
+    print(f"Error executing workflow: {e}")`,
+		data.PackageName,
+		data.ClassName,
+		data.ClassName,
+		PythonLiteral(data.ExampleInput, ""),
+	))
 
-` + "```python" + `
-import asyncio
+	readme.UsageSections = []ReadmeSection{
+		{
+			Title: "Async Usage",
+			Content: readme.CodeBlock(fmt.Sprintf(`import asyncio
 from %s import %s
 
 async def main():
@@ -711,9 +724,7 @@ async def main():
         base_url="http://localhost:8080",
         api_key="your-api-key"
     ) as client:
-        input_data = {
-            "key": "value"
-        }
+        input_data = %s
         
         try:
             result = await client.execute_workflow(input_data)
@@ -727,61 +738,53 @@ async def main():
             print(f"Error: {e}")
 
 # Run async example
-asyncio.run(main())
-` + "```" + `
-
-## API Reference
-
-### Client Methods
-
-#### execute_workflow
-
-Executes the %s workflow with the provided input.
+asyncio.run(main())`,
+				data.PackageName,
+				data.ClassName,
+				data.ClassName,
+				PythonLiteral(data.ExampleInput, "        "),
+			)),
+		},
+	}
 
-` + "```python" + `
-def execute_workflow(self, input_data: Dict[str, Any]) -> ExecutionResult:
+	readme.ClientMethods = []ReadmeEntry{
+		{
+			Name:        "execute_workflow",
+			Description: fmt.Sprintf("Executes the %s workflow with the provided input.", data.Workflow.Name),
+			Code: `def execute_workflow(self, input_data: Dict[str, Any]) -> ExecutionResult:
     """Execute workflow with input data."""
     pass
 
 async def execute_workflow(self, input_data: Dict[str, Any]) -> ExecutionResult:
     """Execute workflow with input data (async version)."""
-    pass
-` + "```" + `
-
-#### get_execution_status
-
-Retrieves the status of a workflow execution.
-
-` + "```python" + `
-def get_execution_status(self, execution_id: str) -> ExecutionStatus:
+    pass`,
+		},
+		{
+			Name:        "get_execution_status",
+			Description: "Retrieves the status of a workflow execution.",
+			Code: `def get_execution_status(self, execution_id: str) -> ExecutionStatus:
     """Get execution status by ID."""
     pass
 
 async def get_execution_status(self, execution_id: str) -> ExecutionStatus:
     """Get execution status by ID (async version)."""
-    pass
-` + "```" + `
-
-#### cancel_execution
-
-Cancels a running workflow execution.
-
-` + "```python" + `
-def cancel_execution(self, execution_id: str) -> None:
+    pass`,
+		},
+		{
+			Name:        "cancel_execution",
+			Description: "Cancels a running workflow execution.",
+			Code: `def cancel_execution(self, execution_id: str) -> None:
     """Cancel a running execution."""
     pass
 
 async def cancel_execution(self, execution_id: str) -> None:
     """Cancel a running execution (async version)."""
-    pass
-` + "```" + `
-
-#### wait_for_completion
-
-Waits for a workflow execution to complete.
-
-` + "```python" + `
-def wait_for_completion(
+    pass`,
+		},
+		{
+			Name:        "wait_for_completion",
+			Description: "Waits for a workflow execution to complete.",
+			Code: `def wait_for_completion(
     self, 
     execution_id: str, 
     timeout: int = 300,
@@ -797,19 +800,16 @@ async def wait_for_completion(
     poll_interval: int = 5
 ) -> ExecutionResult:
     """Wait for execution to complete (async version)."""
-    pass
-` + "```" + `
-
-%s
-
-## Models
-
-### ExecutionResult
-
-Represents the result of a workflow execution.
+    pass`,
+		},
+	}
+	readme.MethodDocs = h.generateMethodDocs(data.Methods)
 
-` + "```python" + `
-class ExecutionResult:
+	readme.Types = []ReadmeEntry{
+		{
+			Name:        "ExecutionResult",
+			Description: "Represents the result of a workflow execution.",
+			Code: `class ExecutionResult:
     id: str
     workflow_id: str
     status: ExecutionStatus
@@ -818,30 +818,24 @@ class ExecutionResult:
     error: Optional[str]
     started_at: datetime
     completed_at: Optional[datetime]
-    duration: Optional[int]
-` + "```" + `
-
-### ExecutionStatus
-
-Represents the status of a workflow execution.
-
-` + "```python" + `
-class ExecutionStatus:
+    duration: Optional[int]`,
+		},
+		{
+			Name:        "ExecutionStatus",
+			Description: "Represents the status of a workflow execution.",
+			Code: `class ExecutionStatus:
     id: str
     status: Literal['pending', 'running', 'completed', 'failed', 'cancelled']
     progress: int
     current_step: Optional[str]
     steps: List[StepStatus]
     started_at: datetime
-    updated_at: datetime
-` + "```" + `
-
-### StepStatus
-
-Represents the status of a workflow step.
-
-` + "```python" + `
-class StepStatus:
+    updated_at: datetime`,
+		},
+		{
+			Name:        "StepStatus",
+			Description: "Represents the status of a workflow step.",
+			Code: `class StepStatus:
     id: str
     name: str
     status: Literal['pending', 'running', 'completed', 'failed', 'skipped']
@@ -850,15 +844,14 @@ class StepStatus:
     error: Optional[str]
     started_at: Optional[datetime]
     completed_at: Optional[datetime]
-    duration: Optional[int]
-` + "```" + `
-
-## Constants
+    duration: Optional[int]`,
+		},
+	}
 
-` + "```python" + `
-# Workflow information
+	readme.Constants = readme.CodeBlock(fmt.Sprintf(`# Workflow information
 WORKFLOW_ID = "%s"
 WORKFLOW_NAME = "%s"
+WORKFLOW_VERSION = "%s"
 
 # Execution statuses
 class ExecutionStatus:
@@ -871,15 +864,21 @@ class ExecutionStatus:
 # Step IDs
 class StepIds:
     # Add step constants here based on workflow definition
-    pass
-` + "```" + `
-
-## Error Handling
+    pass`, data.Workflow.ID.String(), data.Workflow.Name, data.Workflow.Version))
 
-The client provides several exception types for different error scenarios:
+	readme.Configuration = "### Environment Variables\n\n" + readmeEnvironmentVariables +
+		"\n\n### Client Configuration\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`client = %s(
+    base_url="http://localhost:8080",
+    api_key="your-api-key",
+    timeout=30,
+    retry_attempts=3,
+    retry_delay=1.0,
+    debug=False
+)`, data.ClassName))
 
-` + "```python" + `
-from %s.exceptions import (
+	readme.ErrorHandling = "The client provides several exception types for different error scenarios:\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`from %s.exceptions import (
     MagicFlowError,
     APIError,
     AuthenticationError,
@@ -902,46 +901,10 @@ except APIError as e:
 except NetworkError:
     print("Network connection failed")
 except MagicFlowError as e:
-    print(f"General error: {e}")
-` + "```" + `
-
-## Configuration
-
-### Environment Variables
-
-` + "```bash" + `
-# Set default base URL
-export MAGICFLOW_BASE_URL="http://localhost:8080"
-
-# Set default API key
-export MAGICFLOW_API_KEY="your-api-key"
+    print(f"General error: {e}")`, data.PackageName))
 
-# Set default timeout (seconds)
-export MAGICFLOW_TIMEOUT="30"
-
-# Enable debug logging
-export MAGICFLOW_DEBUG="true"
-` + "```" + `
-
-### Client Configuration
-
-` + "```python" + `
-client = %s(
-    base_url="http://localhost:8080",
-    api_key="your-api-key",
-    timeout=30,
-    retry_attempts=3,
-    retry_delay=1.0,
-    debug=False
-)
-` + "```" + `
-
-## Development
-
-### Setup Development Environment
-
-` + "```bash" + `
-# Clone the repository
+	readme.Development = "### Setup Development Environment\n\n" +
+		codeBlock("bash", `# Clone the repository
 git clone https://github.com/your-org/your-repo.git
 cd your-repo
 
@@ -950,13 +913,9 @@ python -m venv venv
 source venv/bin/activate  # On Windows: venv\Scripts\activate
 
 # Install development dependencies
-pip install -e ".[dev]"
-` + "```" + `
-
-### Running Tests
-
-` + "```bash" + `
-# Run all tests
+pip install -e ".[dev]"`) +
+		"\n\n### Running Tests\n\n" +
+		codeBlock("bash", fmt.Sprintf(`# Run all tests
 pytest
 
 # Run with coverage
@@ -966,13 +925,9 @@ pytest --cov=%s --cov-report=html
 pytest tests/test_client.py
 
 # Run with verbose output
-pytest -v
-` + "```" + `
-
-### Code Quality
-
-` + "```bash" + `
-# Format code
+pytest -v`, data.PackageName)) +
+		"\n\n### Code Quality\n\n" +
+		codeBlock("bash", fmt.Sprintf(`# Format code
 black %s
 
 # Sort imports
@@ -982,41 +937,9 @@ isort %s
 flake8 %s
 
 # Type checking
-mypy %s
-` + "```" + `
+mypy %s`, data.PackageName, data.PackageName, data.PackageName, data.PackageName))
 
-## License
-
-Generated code - see original workflow license.
-`,
-		data.Workflow.Name,
-		data.Workflow.Name,
-		data.PackageName,
-		data.PackageName,
-		data.ClassName,
-		data.ClassName,
-		data.PackageName,
-		data.ClassName,
-		data.ClassName,
-		data.Workflow.Name,
-		h.generateMethodDocs(data.Methods),
-		data.Workflow.ID.String(),
-		data.Workflow.Name,
-		data.PackageName,
-		data.ClassName,
-		data.PackageName,
-		data.PackageName,
-		data.PackageName,
-		data.PackageName,
-		data.PackageName,
-	)
-
-	return GeneratedFile{
-		Path:     "README.md",
-		Content:  content,
-		Language: "markdown",
-		Type:     "documentation",
-	}, nil
+	return readme.Build(data)
 }
 
 // generateImports generates the list of imports needed
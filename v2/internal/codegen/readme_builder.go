@@ -0,0 +1,238 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+// ReadmeSection is a titled block of markdown in a generated README
+type ReadmeSection struct {
+	Title   string
+	Content string
+}
+
+// ReadmeEntry documents a single client method or type. Code is rendered as a
+// code block in the language of the README and may be left empty.
+type ReadmeEntry struct {
+	Name        string
+	Description string
+	Code        string
+}
+
+// ReadmeBuilder renders the README of a generated client. Language handlers
+// only provide the snippets that differ between languages; the builder owns the
+// section layout so every client gets the same structure.
+type ReadmeBuilder struct {
+	// Language is the display name used in the title, e.g. "TypeScript"
+	Language string
+	// CodeFence is the info string of the language's code blocks, e.g. "typescript"
+	CodeFence string
+
+	Installation string
+	Usage        string
+	// UsageSections follow the usage section, e.g. async usage
+	UsageSections []ReadmeSection
+
+	ClientMethods []ReadmeEntry
+	// MethodDocs documents the workflow specific step methods
+	MethodDocs string
+
+	// TypesTitle defaults to "Models"
+	TypesTitle string
+	Types      []ReadmeEntry
+	Constants  string
+
+	Configuration string
+	// StepSchemas document the config of the workflow's step types and
+	// default to the built-in schemas
+	StepSchemas   *stepconfig.Registry
+	ErrorHandling string
+	// Sections follow the error handling section, e.g. logging setup
+	Sections []ReadmeSection
+
+	Development  string
+	Requirements []string
+}
+
+// readmeTroubleshooting names the troubleshooting entries shared by every
+// generated client. Their titles and content are the
+// readme.troubleshooting.<name>.title and .body strings of the catalog.
+var readmeTroubleshooting = []string{"connection", "unauthorized", "timeouts", "debug"}
+
+// readmeEnvironmentVariables documents the environment variables read by the clients
+var readmeEnvironmentVariables = codeBlock("bash", `# Set default base URL
+export MAGICFLOW_BASE_URL="http://localhost:8080"
+
+# Set default API key
+export MAGICFLOW_API_KEY="your-api-key"
+
+# Set default timeout (seconds)
+export MAGICFLOW_TIMEOUT="30"
+
+# Enable debug logging
+export MAGICFLOW_DEBUG="true"`)
+
+// Build renders the README file. The shared text and the section titles are
+// resolved through data.Messages, in the branding and locale of the
+// workflow's namespace.
+func (b *ReadmeBuilder) Build(data *TemplateData) (GeneratedFile, error) {
+	required := []ReadmeSection{
+		{Title: "Installation", Content: b.Installation},
+		{Title: "Usage", Content: b.Usage},
+		{Title: "Error Handling", Content: b.ErrorHandling},
+	}
+	for _, section := range required {
+		if strings.TrimSpace(section.Content) == "" {
+			return GeneratedFile{}, fmt.Errorf("%s README is missing the %s section", b.Language, section.Title)
+		}
+	}
+
+	messages := data.Messages
+	title := func(section string) string {
+		return messages.Format("readme.section." + section)
+	}
+	profile := messages.Profile()
+
+	var content strings.Builder
+	content.WriteString("# " + messages.Format("readme.title", "workflow", data.Workflow.Name, "language", b.Language) + "\n\n")
+	if profile.LogoRef != "" {
+		content.WriteString(fmt.Sprintf("![%s](%s)\n\n", profile.ProductName, profile.LogoRef))
+	}
+	content.WriteString(messages.Format("readme.intro", "language", b.Language, "workflow", data.Workflow.Name) + "\n")
+	b.writeSection(&content, title("deprecation"), deprecationNotice(data.Workflow))
+
+	b.writeSection(&content, title("installation"), b.Installation)
+	b.writeSection(&content, title("usage"), b.Usage)
+	for _, section := range b.UsageSections {
+		b.writeSection(&content, section.Title, section.Content)
+	}
+
+	b.writeSection(&content, title("api_reference"), b.apiReference(title("client_methods")))
+
+	typesTitle := b.TypesTitle
+	if typesTitle == "" {
+		typesTitle = title("models")
+	}
+	b.writeSection(&content, typesTitle, b.renderEntries("###", b.Types))
+	b.writeSection(&content, title("constants"), b.Constants)
+
+	b.writeSection(&content, title("configuration"), b.Configuration)
+	stepSchemas := b.StepSchemas
+	if stepSchemas == nil {
+		stepSchemas = stepconfig.Builtin()
+	}
+	b.writeSection(&content, title("step_configuration"), StepConfigReference(data.Workflow, stepSchemas))
+	b.writeSection(&content, title("error_handling"), b.ErrorHandling)
+	for _, section := range b.Sections {
+		b.writeSection(&content, section.Title, section.Content)
+	}
+
+	b.writeSection(&content, title("development"), b.Development)
+	if len(b.Requirements) > 0 {
+		b.writeSection(&content, title("requirements"), "- "+strings.Join(b.Requirements, "\n- "))
+	}
+
+	var troubleshooting strings.Builder
+	for _, name := range readmeTroubleshooting {
+		key := "readme.troubleshooting." + name
+		troubleshooting.WriteString(fmt.Sprintf("### %s\n\n%s\n\n", messages.Format(key+".title"), messages.Format(key+".body")))
+	}
+	b.writeSection(&content, title("troubleshooting"), troubleshooting.String())
+
+	if profile.SupportURL != "" {
+		b.writeSection(&content, title("support"), messages.Format("readme.support"))
+	}
+	b.writeSection(&content, title("license"), messages.Format("readme.license"))
+
+	return GeneratedFile{
+		Path:     "README.md",
+		Content:  content.String(),
+		Language: "markdown",
+		Type:     "documentation",
+	}, nil
+}
+
+// deprecationNotice describes the deprecation of a workflow and what
+// happens to executions after its sunset date, or returns an empty string
+// when the workflow is not deprecated
+func deprecationNotice(workflow *models.Workflow) string {
+	deprecation := workflow.Deprecation
+	if deprecation == nil {
+		return ""
+	}
+
+	var notice strings.Builder
+	notice.WriteString(fmt.Sprintf("> **Deprecated:** the %s workflow is deprecated since %s", workflow.Name, deprecation.DeprecatedAt.UTC().Format(time.RFC3339)))
+	if deprecation.SunsetAt != nil {
+		notice.WriteString(fmt.Sprintf(" and will be sunset on %s", deprecation.SunsetAt.UTC().Format(time.RFC3339)))
+	}
+	notice.WriteString(".\n")
+	if deprecation.Reason != "" {
+		notice.WriteString(fmt.Sprintf("> %s\n", deprecation.Reason))
+	}
+
+	notice.WriteString("\nExecute responses carry `Deprecation` and `Sunset` headers and a `warning` field.")
+	if deprecation.Replacement != nil {
+		notice.WriteString(fmt.Sprintf(" Migrate to workflow `%s`.", deprecation.Replacement.WorkflowID))
+	}
+	if deprecation.SunsetAt != nil {
+		switch deprecation.SunsetPolicy {
+		case models.SunsetPolicyReject:
+			notice.WriteString(" After the sunset date executions are rejected with `410 Gone`.")
+		case models.SunsetPolicyForward:
+			notice.WriteString(" After the sunset date executions are forwarded to the replacement workflow.")
+		default:
+			notice.WriteString(" After the sunset date executions keep running with a warning.")
+		}
+	}
+	return notice.String()
+}
+
+// CodeBlock renders code as a fenced block in the README's language
+func (b *ReadmeBuilder) CodeBlock(code string) string {
+	return codeBlock(b.CodeFence, code)
+}
+
+// apiReference renders the client methods followed by the step method docs
+func (b *ReadmeBuilder) apiReference(clientMethodsTitle string) string {
+	var reference strings.Builder
+	if len(b.ClientMethods) > 0 {
+		reference.WriteString("### " + clientMethodsTitle + "\n\n")
+		reference.WriteString(b.renderEntries("####", b.ClientMethods))
+	}
+	reference.WriteString(strings.TrimSpace(b.MethodDocs))
+	return reference.String()
+}
+
+// renderEntries renders each entry under a heading of the given level
+func (b *ReadmeBuilder) renderEntries(heading string, entries []ReadmeEntry) string {
+	var rendered strings.Builder
+	for _, entry := range entries {
+		rendered.WriteString(fmt.Sprintf("%s %s\n\n", heading, entry.Name))
+		if entry.Description != "" {
+			rendered.WriteString(entry.Description + "\n\n")
+		}
+		if entry.Code != "" {
+			rendered.WriteString(b.CodeBlock(entry.Code) + "\n\n")
+		}
+	}
+	return rendered.String()
+}
+
+// writeSection writes a level two section, skipping empty content
+func (b *ReadmeBuilder) writeSection(content *strings.Builder, title, body string) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return
+	}
+	content.WriteString(fmt.Sprintf("\n## %s\n\n%s\n", title, body))
+}
+
+// codeBlock renders code as a fenced markdown block
+func codeBlock(language, code string) string {
+	return "```" + language + "\n" + strings.Trim(code, "\n") + "\n```"
+}
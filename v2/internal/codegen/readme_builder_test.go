@@ -0,0 +1,215 @@
+package codegen
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/branding"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+func newReadmeTemplateData() *TemplateData {
+	return &TemplateData{
+		Workflow:    &models.Workflow{ID: uuid.New(), Name: "order-processing"},
+		PackageName: "orderprocessing",
+		ClassName:   "OrderProcessingClient",
+		Methods: []MethodData{
+			{Name: "validateOrder", Description: "Validate order", StepID: "validate_order", ReturnType: "interface{}"},
+		},
+	}
+}
+
+func TestLanguageReadmes(t *testing.T) {
+	handlers := map[string]func(*TemplateData) (GeneratedFile, error){
+		"go":         NewGoHandler(nil).generateReadmeFile,
+		"java":       NewJavaHandler(nil).generateReadmeFile,
+		"kotlin":     NewKotlinHandler(nil).generateReadmeFile,
+		"python":     NewPythonHandler(nil).generateReadmeFile,
+		"ruby":       NewRubyHandler(nil).generateReadmeFile,
+		"swift":      NewSwiftHandler(nil).generateReadmeFile,
+		"typescript": NewTypeScriptHandler(nil).generateReadmeFile,
+	}
+
+	for language, generate := range handlers {
+		t.Run(language, func(t *testing.T) {
+			file, err := generate(newReadmeTemplateData())
+			require.NoError(t, err)
+
+			assert.Equal(t, "README.md", file.Path)
+			assert.Equal(t, "markdown", file.Language)
+			for _, section := range []string{"## Installation", "## Usage", "## API Reference", "## Error Handling", "## Troubleshooting", "## License"} {
+				assert.Contains(t, file.Content, "\n"+section+"\n", section)
+			}
+			assert.Contains(t, file.Content, "validateOrder")
+			assert.Equal(t, 0, strings.Count(file.Content, "```")%2, "unbalanced code fences")
+			assert.NotContains(t, file.Content, "%!")
+		})
+	}
+}
+
+func TestReadmeBuilder(t *testing.T) {
+	t.Run("section order", func(t *testing.T) {
+		readme := &ReadmeBuilder{
+			Language:      "Go",
+			CodeFence:     "go",
+			Installation:  "install",
+			Usage:         "usage",
+			ErrorHandling: "errors",
+			Sections:      []ReadmeSection{{Title: "Logging", Content: "logging"}},
+		}
+
+		file, err := readme.Build(newReadmeTemplateData())
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(file.Content, "# order-processing Go Client\n"))
+		previous := -1
+		for _, section := range []string{"## Installation", "## Usage", "## Error Handling", "## Logging", "## Troubleshooting", "## License"} {
+			index := strings.Index(file.Content, section)
+			require.NotEqual(t, -1, index, section)
+			assert.Greater(t, index, previous, section)
+			previous = index
+		}
+	})
+
+	t.Run("empty sections are omitted", func(t *testing.T) {
+		readme := &ReadmeBuilder{Language: "Go", Installation: "install", Usage: "usage", ErrorHandling: "errors"}
+
+		file, err := readme.Build(newReadmeTemplateData())
+		require.NoError(t, err)
+
+		assert.NotContains(t, file.Content, "## Configuration")
+		assert.NotContains(t, file.Content, "## Models")
+		assert.NotContains(t, file.Content, "## Requirements")
+	})
+
+	t.Run("required sections", func(t *testing.T) {
+		readme := &ReadmeBuilder{Language: "Go", Installation: "install", Usage: "usage"}
+
+		_, err := readme.Build(newReadmeTemplateData())
+		assert.EqualError(t, err, "Go README is missing the Error Handling section")
+	})
+
+	t.Run("deprecated workflow", func(t *testing.T) {
+		readme := &ReadmeBuilder{Language: "Go", Installation: "install", Usage: "usage", ErrorHandling: "errors"}
+		data := newReadmeTemplateData()
+
+		file, err := readme.Build(data)
+		require.NoError(t, err)
+		assert.NotContains(t, file.Content, "## Deprecation")
+
+		sunsetAt := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+		replacementID := uuid.New()
+		data.Workflow.Deprecation = &models.Deprecation{
+			DeprecatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			SunsetAt:     &sunsetAt,
+			Reason:       "Orders moved to the v2 pipeline.",
+			Replacement:  &models.Replacement{WorkflowID: replacementID},
+			SunsetPolicy: models.SunsetPolicyReject,
+		}
+		file, err = readme.Build(data)
+		require.NoError(t, err)
+
+		assert.Contains(t, file.Content, "\n## Deprecation\n\n> **Deprecated:** the order-processing workflow is deprecated since 2024-05-01T00:00:00Z and will be sunset on 2024-07-01T00:00:00Z.\n> Orders moved to the v2 pipeline.\n")
+		assert.Contains(t, file.Content, "Migrate to workflow `"+replacementID.String()+"`.")
+		assert.Contains(t, file.Content, "executions are rejected with `410 Gone`")
+		assert.Less(t, strings.Index(file.Content, "## Deprecation"), strings.Index(file.Content, "## Installation"))
+	})
+
+	t.Run("code blocks", func(t *testing.T) {
+		readme := &ReadmeBuilder{CodeFence: "python"}
+		assert.Equal(t, "```python\nprint()\n```", readme.CodeBlock("\nprint()\n"))
+	})
+}
+
+func TestStepConfigReference(t *testing.T) {
+	reference := renderStepConfigReference([]string{"http", "custom", "http", "transform"}, stepconfig.Builtin())
+
+	assert.Equal(t, 1, strings.Count(reference, "### http\n"))
+	assert.Contains(t, reference, "### transform\n")
+	assert.NotContains(t, reference, "### custom")
+	assert.Less(t, strings.Index(reference, "### http"), strings.Index(reference, "### transform"))
+	assert.Contains(t, reference, "| `url` | string | yes |  | Request URL |\n")
+	assert.Contains(t, reference, "| `method` | string (GET, POST, PUT, PATCH, DELETE) | no | GET | HTTP method |\n")
+	assert.Contains(t, reference, "| `headers` | object of string | no |  | Request headers |\n")
+
+	assert.Empty(t, renderStepConfigReference([]string{"custom"}, stepconfig.Builtin()))
+}
+
+func TestBrandedJavaClient(t *testing.T) {
+	ctx := context.Background()
+	manager := branding.NewManager(branding.NewMemoryStore(), logrus.New())
+	_, err := manager.SaveProfile(ctx, &branding.Profile{
+		Namespace:    "acme",
+		ProductName:  "Acme Orchestrator",
+		SupportURL:   "https://support.acme.io",
+		ContactEmail: "dev@acme.io",
+		LogoRef:      "https://acme.io/logo.png",
+	}, "admin")
+	require.NoError(t, err)
+	for key, value := range map[string]string{
+		"readme.title":                "Client {language} du workflow {workflow}",
+		"readme.section.installation": "Installation",
+		"readme.section.usage":        "Utilisation",
+		"readme.section.support":      "Assistance",
+	} {
+		_, err := manager.SetEntry(ctx, &branding.Entry{Namespace: "acme", Locale: "fr", Key: key, Value: value}, "admin")
+		require.NoError(t, err)
+	}
+
+	workflow := &models.Workflow{ID: uuid.New(), Name: "order-processing"}
+	workflow.Definition.Metadata.Labels = map[string]string{"namespace": "acme"}
+	generator := NewCodeGenerator()
+	generator.SetMessages(manager)
+
+	generate := func(locale string) (map[string]string, *GenerationResult) {
+		result, err := generator.Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageJava, Locale: locale})
+		require.NoError(t, err)
+		files := make(map[string]string, len(result.Files))
+		for _, file := range result.Files {
+			files[file.Path] = file.Content
+		}
+		return files, result
+	}
+
+	t.Run("default locale", func(t *testing.T) {
+		files, result := generate("")
+		readme := files["README.md"]
+
+		assert.True(t, strings.HasPrefix(readme, "# order-processing Java Client\n\n![Acme Orchestrator](https://acme.io/logo.png)\n"))
+		assert.Contains(t, readme, "Check that the Acme Orchestrator server is running")
+		assert.Contains(t, readme, "\n## Support\n\nFor help with Acme Orchestrator, visit https://support.acme.io.\n")
+		assert.NotContains(t, readme, "Magic Flow")
+		assert.Equal(t, "en", result.Metadata["locale"])
+
+		pom := files["pom.xml"]
+		assert.Contains(t, pom, "<name>Acme Orchestrator</name>")
+		assert.Contains(t, pom, "<email>dev@acme.io</email>")
+		assert.Contains(t, pom, "<organizationUrl>https://support.acme.io</organizationUrl>")
+		assert.NotContains(t, files["build.gradle"], "Magic Flow")
+	})
+
+	t.Run("requested locale", func(t *testing.T) {
+		files, result := generate("fr-CA")
+		readme := files["README.md"]
+
+		assert.True(t, strings.HasPrefix(readme, "# Client Java du workflow order-processing\n"))
+		assert.Contains(t, readme, "\n## Utilisation\n")
+		assert.Contains(t, readme, "\n## Assistance\n")
+		// Strings without a French entry fall back to English
+		assert.Contains(t, readme, "\n## Error Handling\n")
+		assert.Equal(t, "fr-CA", result.Metadata["locale"])
+	})
+
+	t.Run("invalid locale", func(t *testing.T) {
+		_, err := generator.Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageJava, Locale: "french"})
+		assert.ErrorIs(t, err, branding.ErrInvalidLocale)
+	})
+}
@@ -0,0 +1,226 @@
+package codegen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/watch"
+	"magic-flow/v2/pkg/models"
+)
+
+// tokenFile holds the resume token of auto-regeneration in its output
+// directory, so changes made while the server was down are caught up
+const tokenFile = ".magic-flow-watch"
+
+// retryDelay is how long auto-regeneration waits after failing to read
+// definition changes
+const retryDelay = 5 * time.Second
+
+// Watcher returns the definition changes after a resume token, waiting
+// until there is one. The watch Hub implements it.
+type Watcher interface {
+	Next(ctx context.Context, filter watch.Filter, after uint64) ([]*watch.Event, uint64, error)
+	Latest(ctx context.Context) (uint64, error)
+}
+
+// WorkflowLoader loads the current definition of workflows. The workflow
+// repository implements it.
+type WorkflowLoader interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+}
+
+// RegenerateTarget is a client regenerated when its workflow changes
+type RegenerateTarget struct {
+	// Workflow is the name or ID of the workflow
+	Workflow    string
+	Language    Language
+	PackageName string
+}
+
+// Regenerator regenerates clients into an output directory as their
+// workflows are created and versions of them are activated. Each client is
+// written to <output dir>/<workflow name>/<language>, merging its config
+// files with the edits made since they were generated.
+type Regenerator struct {
+	outputDir string
+	targets   []RegenerateTarget
+	watcher   Watcher
+	workflows WorkflowLoader
+	generator Generator
+	logger    *logrus.Logger
+}
+
+// NewRegenerator creates a regenerator of clients
+func NewRegenerator(outputDir string, targets []RegenerateTarget, watcher Watcher, workflows WorkflowLoader, generator Generator, logger *logrus.Logger) *Regenerator {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &Regenerator{
+		outputDir: outputDir,
+		targets:   targets,
+		watcher:   watcher,
+		workflows: workflows,
+		generator: generator,
+		logger:    logger,
+	}
+}
+
+// Run regenerates clients until ctx ends. It resumes after the last change
+// it handled, or starts at the current end of the changes the first time.
+func (r *Regenerator) Run(ctx context.Context) error {
+	after, err := r.resumeFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := watch.Filter{Types: []string{watch.EventWorkflowCreated, watch.EventVersionActivated}}
+	for {
+		events, next, err := r.watcher.Next(ctx, filter, after)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			r.logger.WithError(err).Error("Failed to read definition changes for client regeneration")
+			select {
+			case <-time.After(retryDelay):
+				continue
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		for _, event := range events {
+			r.Regenerate(ctx, event)
+		}
+		after = next
+		if err := r.saveToken(after); err != nil {
+			r.logger.WithError(err).Warn("Failed to save the resume token of client regeneration")
+		}
+	}
+}
+
+// resumeFrom returns the sequence saved in the output directory, or the
+// current end of the changes, which is saved
+func (r *Regenerator) resumeFrom(ctx context.Context) (uint64, error) {
+	if err := os.MkdirAll(r.outputDir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	token, err := os.ReadFile(filepath.Join(r.outputDir, tokenFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		latest, err := r.watcher.Latest(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the latest definition change: %w", err)
+		}
+		return latest, r.saveToken(latest)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read resume token: %w", err)
+	}
+	return watch.ParseToken(strings.TrimSpace(string(token)))
+}
+
+// saveToken saves the resume token in the output directory
+func (r *Regenerator) saveToken(sequence uint64) error {
+	return os.WriteFile(filepath.Join(r.outputDir, tokenFile), []byte(watch.FormatToken(sequence)), 0o644)
+}
+
+// Regenerate regenerates the clients of the workflow of a change. Failures
+// are logged, so one client does not hold the others back.
+func (r *Regenerator) Regenerate(ctx context.Context, event *watch.Event) {
+	var workflow *models.Workflow
+	for _, target := range r.targets {
+		if target.Workflow != event.WorkflowName && target.Workflow != event.WorkflowID.String() {
+			continue
+		}
+		logger := r.logger.WithFields(logrus.Fields{
+			"workflow_id": event.WorkflowID,
+			"language":    target.Language,
+			"event_type":  event.Type,
+		})
+
+		if workflow == nil {
+			loaded, err := r.workflows.GetByID(event.WorkflowID)
+			if err != nil {
+				logger.WithError(err).Error("Failed to load workflow for client regeneration")
+				return
+			}
+			workflow = loaded
+		}
+
+		files, err := r.generate(workflow, target)
+		if err != nil {
+			logger.WithError(err).Error("Failed to regenerate client")
+			continue
+		}
+		logger.WithField("files", files).Info("Client regenerated")
+	}
+}
+
+// generate generates a client into its directory and returns the number of
+// files written
+func (r *Regenerator) generate(workflow *models.Workflow, target RegenerateTarget) (int, error) {
+	dir := filepath.Join(r.outputDir, workflow.Name, string(target.Language))
+	existing, err := readExisting(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.generator.Generate(workflow, &GenerationRequest{
+		WorkflowID:  workflow.ID,
+		Language:    target.Language,
+		PackageName: target.PackageName,
+		Existing:    existing,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range result.Files {
+		path := filepath.Join(dir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(path, []byte(file.Content), 0o644); err != nil {
+			return 0, err
+		}
+	}
+	return len(result.Files), nil
+}
+
+// readExisting reads the files of a client directory, keyed by their path
+// in the directory
+func readExisting(dir string) (map[string]ExistingFile, error) {
+	existing := make(map[string]ExistingFile)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return fs.SkipDir
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		existing[filepath.ToSlash(relative)] = ExistingFile{Content: string(content)}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing client files: %w", err)
+	}
+	return existing, nil
+}
@@ -0,0 +1,128 @@
+package codegen
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/changesets"
+	"magic-flow/v2/internal/watch"
+	"magic-flow/v2/pkg/models"
+)
+
+// changesetWorkflows loads workflows from a changeset store
+type changesetWorkflows struct {
+	store *changesets.MemoryStore
+}
+
+func (w changesetWorkflows) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	return w.store.GetWorkflow(context.Background(), id)
+}
+
+func ordersVersion(version string) *models.WorkflowVersion {
+	return &models.WorkflowVersion{
+		Version:   version,
+		CreatedBy: "alice",
+		Definition: models.WorkflowDefinition{
+			Metadata: models.WorkflowMetadata{Name: "orders"},
+			Spec: models.WorkflowSpec{Steps: []models.WorkflowStep{
+				{Name: "place", Type: "http", Config: map[string]interface{}{"url": "https://example.com/orders"}},
+			}},
+		},
+	}
+}
+
+func TestAutoRegenerateOnVersionActivation(t *testing.T) {
+	ctx := context.Background()
+	store := changesets.NewMemoryStore()
+	hub := watch.NewHub(watch.Config{PollInterval: 10 * time.Millisecond}, watch.NewMemoryStore(), logrus.New())
+	service := changesets.NewService(store, nil, logrus.New())
+	service.SetWatch(hub)
+
+	workflow := &models.Workflow{
+		Name:       "orders",
+		Version:    "1.0.0",
+		Owner:      "payments",
+		CreatedBy:  "alice",
+		Definition: ordersVersion("1.0.0").Definition,
+	}
+	created, err := service.Apply(ctx, &changesets.Request{Author: "alice", Operations: []changesets.Operation{
+		{Type: changesets.OperationCreateWorkflow, Ref: "orders", Workflow: workflow},
+		{Type: changesets.OperationCreateVersion, Ref: "v1", WorkflowRef: "orders", Version: ordersVersion("1.0.0")},
+		{Type: changesets.OperationActivateVersion, VersionRef: "v1"},
+	}})
+	require.NoError(t, err)
+	workflowID := *created.Results[0].WorkflowID
+
+	outputDir := t.TempDir()
+	regenerator := NewRegenerator(outputDir, []RegenerateTarget{
+		{Workflow: "orders", Language: LanguageGo, PackageName: "orders"},
+		{Workflow: workflowID.String(), Language: LanguageJava},
+		{Workflow: "billing", Language: LanguageGo},
+	}, hub, changesetWorkflows{store: store}, NewCodeGenerator(), logrus.New())
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- regenerator.Run(runCtx) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	readFile := func(path ...string) string {
+		content, err := os.ReadFile(filepath.Join(append([]string{outputDir}, path...)...))
+		if err != nil {
+			return ""
+		}
+		return string(content)
+	}
+	latest, err := hub.Latest(ctx)
+	require.NoError(t, err)
+
+	// Without a resume token the regenerator starts after the changes made
+	// so far, then saves the token of the last change it handled
+	require.Eventually(t, func() bool {
+		return readFile(tokenFile) == watch.FormatToken(latest)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoDirExists(t, filepath.Join(outputDir, "orders"))
+
+	activated, err := service.Apply(ctx, &changesets.Request{Author: "alice", Operations: []changesets.Operation{
+		{Type: changesets.OperationCreateVersion, Ref: "v2", WorkflowID: &workflowID, Version: ordersVersion("2.0.0")},
+		{Type: changesets.OperationActivateVersion, VersionRef: "v2"},
+	}})
+	require.NoError(t, err)
+	require.True(t, activated.Results[1].Valid)
+
+	require.Eventually(t, func() bool {
+		return readFile(tokenFile) == watch.FormatToken(latest+2)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, readFile("orders", "go", "orders", "types.go"), `WorkflowVersion = "2.0.0"`)
+	pom := readFile("orders", "java", "pom.xml")
+	require.NotEmpty(t, pom, "targets name workflows by name or ID")
+	assert.NoDirExists(t, filepath.Join(outputDir, "billing"))
+
+	// Edits to the config files of a client survive its regeneration
+	edited := strings.Replace(pom, "        <!-- magic-flow:user-end dependencies -->\n",
+		userDependency+"        <!-- magic-flow:user-end dependencies -->\n", 1)
+	require.NotEqual(t, pom, edited)
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "orders", "java", "pom.xml"), []byte(edited), 0o644))
+
+	_, err = service.Apply(ctx, &changesets.Request{Author: "alice", Operations: []changesets.Operation{
+		{Type: changesets.OperationCreateVersion, Ref: "v3", WorkflowID: &workflowID, Version: ordersVersion("3.0.0")},
+		{Type: changesets.OperationActivateVersion, VersionRef: "v3"},
+	}})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(readFile("orders", "go", "orders", "types.go"), `WorkflowVersion = "3.0.0"`)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, readFile("orders", "java", "pom.xml"), userDependency)
+}
@@ -0,0 +1,742 @@
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// rubyKeywords cannot be used as local variable names in Ruby
+var rubyKeywords = map[string]bool{
+	"BEGIN": true, "END": true, "alias": true, "and": true, "begin": true,
+	"break": true, "case": true, "class": true, "def": true, "defined?": true,
+	"do": true, "else": true, "elsif": true, "end": true, "ensure": true,
+	"false": true, "for": true, "if": true, "in": true, "module": true,
+	"next": true, "nil": true, "not": true, "or": true, "redo": true,
+	"rescue": true, "retry": true, "return": true, "self": true, "super": true,
+	"then": true, "true": true, "undef": true, "unless": true, "until": true,
+	"when": true, "while": true, "yield": true, "__FILE__": true,
+	"__LINE__": true, "__ENCODING__": true,
+}
+
+// rubyReservedMethods are methods of Object and of the generated models that
+// attributes must not override
+var rubyReservedMethods = map[string]bool{
+	"clone": true, "display": true, "dup": true, "freeze": true, "hash": true,
+	"initialize": true, "inspect": true, "method": true, "object_id": true,
+	"send": true, "to_h": true, "to_s": true,
+}
+
+// RubyHandler implements LanguageHandler for Ruby code generation. The
+// generated gem talks to the API through Faraday and maps workflow data to
+// plain model classes.
+type RubyHandler struct {
+	templateManager *TemplateManager
+	namer           *ClientNamer
+}
+
+// rubyTemplateData is the template data of the Ruby client, which also
+// needs the name of the typed input model
+type rubyTemplateData struct {
+	*TemplateData
+	InputModel string
+}
+
+// NewRubyHandler creates a new Ruby language handler
+func NewRubyHandler(templateManager *TemplateManager) *RubyHandler {
+	return &RubyHandler{
+		templateManager: templateManager,
+		namer:           NewClientNamer(),
+	}
+}
+
+// Generate generates Ruby code for a workflow
+func (h *RubyHandler) Generate(workflow *models.Workflow, request *GenerationRequest, templateData *TemplateData) ([]GeneratedFile, error) {
+	var files []GeneratedFile
+
+	files = append(files, h.generateEntryFile(templateData))
+
+	// Generate client file
+	clientFile, err := h.generateClientFile(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client file: %w", err)
+	}
+	files = append(files, clientFile)
+
+	// Generate models file
+	modelsFile, err := h.generateTemplateFile(templateData, "models", "models.rb", "model")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate models file: %w", err)
+	}
+	files = append(files, modelsFile)
+
+	// Generate constants file
+	typesFile, err := h.generateTemplateFile(templateData, "types", "constants.rb", "types")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate constants file: %w", err)
+	}
+	files = append(files, typesFile)
+
+	files = append(files, h.generateErrorsFile(templateData))
+	files = append(files, h.generateConfigFile(templateData))
+	files = append(files, h.generateVersionFile(templateData))
+
+	// Generate test files if requested
+	if request.IncludeTests {
+		testFiles, err := h.generateTestFiles(templateData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate test files: %w", err)
+		}
+		files = append(files, testFiles...)
+	}
+
+	// Generate gem files
+	files = append(files, h.generateGemspecFile(templateData))
+	files = append(files, h.generateGemfile(templateData))
+
+	// Generate README file
+	readmeFile, err := h.generateReadmeFile(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate README file: %w", err)
+	}
+	files = append(files, readmeFile)
+
+	return files, nil
+}
+
+// ValidateRequest validates Ruby-specific generation request. The package
+// name is the name of the gem.
+func (h *RubyHandler) ValidateRequest(request *GenerationRequest) error {
+	if request.PackageName == "" {
+		request.PackageName = h.GetDefaultPackageName()
+	}
+
+	if !isValidRubyGemName(request.PackageName) {
+		return fmt.Errorf("invalid Ruby gem name: %s", request.PackageName)
+	}
+
+	return nil
+}
+
+// PrepareTemplateData prepares template data for Ruby code generation. The
+// gem's module is named after the gem.
+func (h *RubyHandler) PrepareTemplateData(workflow *models.Workflow, request *GenerationRequest) (*TemplateData, error) {
+	packageName := request.PackageName
+	if packageName == "" {
+		packageName = h.GetDefaultPackageName()
+	}
+
+	className := h.namer.ClientClassName(workflow.Name)
+
+	// Step methods return the workflow output
+	methods := ExtractStepMethods(workflow)
+	for i := range methods {
+		methods[i].ReturnType = "Hash"
+		for j := range methods[i].Parameters {
+			methods[i].Parameters[j].Type = h.mapFieldTypeToRuby(methods[i].Parameters[j].Type)
+		}
+	}
+
+	templateData := &TemplateData{
+		Workflow:     workflow,
+		PackageName:  packageName,
+		Namespace:    rubyModuleName(packageName),
+		ClassName:    className,
+		Methods:      methods,
+		Models:       schemaModels(workflow, strings.TrimSuffix(className, "Client"), h.mapFieldTypeToRuby),
+		Options:      request.Options,
+		GeneratedAt:  workflow.CreatedAt,
+		ExampleInput: WorkflowExampleInput(workflow),
+	}
+
+	return templateData, nil
+}
+
+// GetFileExtension returns the file extension for Ruby files
+func (h *RubyHandler) GetFileExtension() string {
+	return ".rb"
+}
+
+// GetDefaultPackageName returns the default gem name for Ruby
+func (h *RubyHandler) GetDefaultPackageName() string {
+	return "magic_flow_client"
+}
+
+// libPath returns the path of a file in the gem's lib directory
+func (h *RubyHandler) libPath(data *TemplateData, name string) string {
+	return path.Join("lib", data.PackageName, name)
+}
+
+// clientFileName returns the name of the client file, the snake_case class
+// name of the client
+func (h *RubyHandler) clientFileName(data *TemplateData) string {
+	return ToSnakeCase(data.ClassName) + ".rb"
+}
+
+// generateEntryFile generates the file required by users of the gem, which
+// loads the rest of the gem
+func (h *RubyHandler) generateEntryFile(data *TemplateData) GeneratedFile {
+	var requires strings.Builder
+	for _, name := range []string{"version", "configuration", "errors", "constants", "models", strings.TrimSuffix(h.clientFileName(data), ".rb")} {
+		requires.WriteString(fmt.Sprintf("require_relative %s\n", rubyQuote(path.Join(data.PackageName, name))))
+	}
+
+	content := fmt.Sprintf(`# frozen_string_literal: true
+
+# Code generated by Magic Flow v2. DO NOT EDIT.
+# Generated at: %s
+
+%s`,
+		data.GeneratedAt.Format("2006-01-02 15:04:05"),
+		requires.String(),
+	)
+
+	return GeneratedFile{
+		Path:     path.Join("lib", data.PackageName+".rb"),
+		Content:  content,
+		Language: "ruby",
+		Type:     "client",
+	}
+}
+
+// generateClientFile generates the main client file
+func (h *RubyHandler) generateClientFile(data *TemplateData) (GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("ruby", "client")
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	clientData := &rubyTemplateData{TemplateData: data}
+	for _, model := range data.Models {
+		if model.Name == strings.TrimSuffix(data.ClassName, "Client")+"Input" {
+			clientData.InputModel = model.Name
+		}
+	}
+
+	content, err := RenderTemplate(template, clientData)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	return GeneratedFile{
+		Path:     h.libPath(data, h.clientFileName(data)),
+		Content:  content,
+		Language: "ruby",
+		Type:     "client",
+	}, nil
+}
+
+// generateTemplateFile renders a template into a file of the gem's lib
+// directory
+func (h *RubyHandler) generateTemplateFile(data *TemplateData, templateName, name, fileType string) (GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("ruby", templateName)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	content, err := RenderTemplate(template, data)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	return GeneratedFile{
+		Path:     h.libPath(data, name),
+		Content:  content,
+		Language: "ruby",
+		Type:     fileType,
+	}, nil
+}
+
+// generateErrorsFile generates the error hierarchy. Every error derives from
+// the gem's Error, so callers can rescue all of them at once.
+func (h *RubyHandler) generateErrorsFile(data *TemplateData) GeneratedFile {
+	content := fmt.Sprintf(`# frozen_string_literal: true
+
+# Code generated by Magic Flow v2. DO NOT EDIT.
+# Generated at: %s
+
+module %s
+  # Base class of the errors raised by the client
+  class Error < StandardError; end
+
+  # The server rejected a request
+  class ApiError < Error
+    attr_reader :status, :body
+
+    def initialize(message = nil, status: nil, body: nil)
+      super(message)
+      @status = status
+      @body = body
+    end
+  end
+
+  # The API key is missing or invalid
+  class AuthenticationError < ApiError; end
+
+  # The workflow input is invalid
+  class ValidationError < ApiError; end
+
+  # A workflow execution failed or was cancelled
+  class ExecutionError < Error
+    attr_reader :execution_id, :step_id
+
+    def initialize(message = nil, execution_id: nil, step_id: nil)
+      super(message)
+      @execution_id = execution_id
+      @step_id = step_id
+    end
+  end
+
+  # A request or an execution did not complete in time
+  class TimeoutError < Error; end
+
+  # The server could not be reached
+  class NetworkError < Error; end
+
+  # A response could not be parsed
+  class DecodingError < Error; end
+end
+`,
+		data.GeneratedAt.Format("2006-01-02 15:04:05"),
+		data.Namespace,
+	)
+
+	return GeneratedFile{
+		Path:     h.libPath(data, "errors.rb"),
+		Content:  content,
+		Language: "ruby",
+		Type:     "exception",
+	}
+}
+
+// generateConfigFile generates the configuration file
+func (h *RubyHandler) generateConfigFile(data *TemplateData) GeneratedFile {
+	content := fmt.Sprintf(`# frozen_string_literal: true
+
+# Code generated by Magic Flow v2. DO NOT EDIT.
+# Generated at: %s
+
+module %s
+  # Configuration of the %s client. The base URL and API key default to the
+  # MAGICFLOW_BASE_URL and MAGICFLOW_API_KEY environment variables.
+  class Configuration
+    DEFAULT_BASE_URL = "http://localhost:8080"
+
+    attr_accessor :base_url, :api_key
+    # Timeout of a single request, in seconds
+    attr_accessor :timeout
+    attr_accessor :retry_attempts
+    # Delay between retries of a failed request, in seconds
+    attr_accessor :retry_delay
+
+    def initialize(base_url: nil, api_key: nil, timeout: 30, retry_attempts: 3, retry_delay: 1)
+      @base_url = base_url || ENV.fetch("MAGICFLOW_BASE_URL", DEFAULT_BASE_URL)
+      @api_key = api_key || ENV.fetch("MAGICFLOW_API_KEY", "")
+      @timeout = timeout
+      @retry_attempts = retry_attempts
+      @retry_delay = retry_delay
+    end
+  end
+
+  class << self
+    # The configuration clients use unless they are given one
+    def configuration
+      @configuration ||= Configuration.new
+    end
+
+    # Yields the default configuration to change it
+    def configure
+      yield configuration
+    end
+  end
+end
+`,
+		data.GeneratedAt.Format("2006-01-02 15:04:05"),
+		data.Namespace,
+		data.Workflow.Name,
+	)
+
+	return GeneratedFile{
+		Path:     h.libPath(data, "configuration.rb"),
+		Content:  content,
+		Language: "ruby",
+		Type:     "config",
+	}
+}
+
+// generateVersionFile generates the file defining the gem version, which the
+// gemspec loads
+func (h *RubyHandler) generateVersionFile(data *TemplateData) GeneratedFile {
+	_, version, _ := h.gemCoordinates(data)
+
+	content := fmt.Sprintf(`# frozen_string_literal: true
+
+module %s
+  VERSION = %s
+end
+`,
+		data.Namespace,
+		rubyQuote(version),
+	)
+
+	return GeneratedFile{
+		Path:     h.libPath(data, "version.rb"),
+		Content:  content,
+		Language: "ruby",
+		Type:     "config",
+	}
+}
+
+// generateTestFiles generates the RSpec helper and the client spec, which
+// stubs the API with WebMock
+func (h *RubyHandler) generateTestFiles(data *TemplateData) ([]GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("ruby", "test")
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := RenderTemplate(template, data)
+	if err != nil {
+		return nil, err
+	}
+
+	helper := fmt.Sprintf(`# frozen_string_literal: true
+
+require "json"
+require "webmock/rspec"
+require %s
+
+RSpec.configure do |config|
+  config.expect_with :rspec do |expectations|
+    expectations.syntax = :expect
+  end
+  config.disable_monkey_patching!
+end
+`,
+		rubyQuote(data.PackageName),
+	)
+
+	return []GeneratedFile{
+		{
+			Path:     "spec/spec_helper.rb",
+			Content:  helper,
+			Language: "ruby",
+			Type:     "test",
+		},
+		{
+			Path:     path.Join("spec", strings.TrimSuffix(h.clientFileName(data), ".rb")+"_spec.rb"),
+			Content:  content,
+			Language: "ruby",
+			Type:     "test",
+		},
+	}, nil
+}
+
+// gemCoordinates returns the authors, version and homepage of the gem
+func (h *RubyHandler) gemCoordinates(data *TemplateData) (string, string, string) {
+	authors := "Magic Flow"
+	version := "1.0.0"
+	homepage := "https://github.com/your-org/" + strings.ReplaceAll(data.PackageName, "_", "-")
+	if data.Options != nil {
+		if a, ok := data.Options["authors"].(string); ok && a != "" {
+			authors = a
+		}
+		if v, ok := data.Options["version"].(string); ok && v != "" {
+			version = v
+		}
+		if u, ok := data.Options["homepage"].(string); ok && u != "" {
+			homepage = u
+		}
+	}
+	return authors, version, homepage
+}
+
+// generateGemspecFile generates the gemspec. Faraday 1.10 and later 1.x
+// releases share the API the client uses with Faraday 2.
+func (h *RubyHandler) generateGemspecFile(data *TemplateData) GeneratedFile {
+	authors, _, homepage := h.gemCoordinates(data)
+
+	content := fmt.Sprintf(`# frozen_string_literal: true
+
+require_relative %s
+
+Gem::Specification.new do |spec|
+  spec.name = %s
+  spec.version = %s::VERSION
+  spec.authors = [%s]
+  spec.summary = %s
+  spec.homepage = %s
+  spec.required_ruby_version = ">= 2.7"
+
+  spec.files = Dir["lib/**/*.rb", "README.md"]
+  spec.require_paths = ["lib"]
+
+  spec.add_dependency "faraday", ">= 1.10", "< 3"
+
+  spec.add_development_dependency "rspec", "~> 3.12"
+  spec.add_development_dependency "webmock", "~> 3.18"
+
+  # magic-flow:user-begin dependencies
+  # magic-flow:user-end dependencies
+end
+`,
+		rubyQuote(path.Join("lib", data.PackageName, "version")),
+		rubyQuote(data.PackageName),
+		data.Namespace,
+		rubyQuote(authors),
+		rubyQuote(fmt.Sprintf("Client library for the %s workflow", data.Workflow.Name)),
+		rubyQuote(homepage),
+	)
+
+	return GeneratedFile{
+		Path:     data.PackageName + ".gemspec",
+		Content:  content,
+		Language: "ruby",
+		Type:     "config",
+	}
+}
+
+// generateGemfile generates the Gemfile, which installs the dependencies of
+// the gemspec
+func (h *RubyHandler) generateGemfile(data *TemplateData) GeneratedFile {
+	return GeneratedFile{
+		Path: "Gemfile",
+		Content: `# frozen_string_literal: true
+
+source "https://rubygems.org"
+
+gemspec
+
+# magic-flow:user-begin gems
+# magic-flow:user-end gems
+`,
+		Language: "ruby",
+		Type:     "config",
+	}
+}
+
+// generateReadmeFile generates the README file
+func (h *RubyHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, error) {
+	namespace := data.Namespace
+	if namespace == "" {
+		namespace = rubyModuleName(data.PackageName)
+	}
+	_, version, _ := h.gemCoordinates(data)
+
+	readme := &ReadmeBuilder{
+		Language:  "Ruby",
+		CodeFence: "ruby",
+	}
+
+	readme.Installation = "### Bundler\n\nAdd the gem to your `Gemfile`:\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`gem %s, "~> %s"`, rubyQuote(data.PackageName), version)) +
+		"\n\n### RubyGems\n\n" +
+		codeBlock("bash", "gem install "+data.PackageName)
+
+	readme.Usage = readme.CodeBlock(fmt.Sprintf(`require %s
+
+client = %s::%s.new(
+  config: %s::Configuration.new(base_url: "http://localhost:8080", api_key: "your-api-key"),
+)
+
+begin
+  # Execute workflow
+  result = client.execute_workflow(%s)
+  puts "Execution ID: #{result.id}"
+
+  # Wait for the execution to complete
+  completed = client.wait_for_completion(result.id)
+  puts "Output: #{completed.output}"
+rescue %s::Error => e
+  puts "Error: #{e.message}"
+end`,
+		rubyQuote(data.PackageName),
+		namespace,
+		data.ClassName,
+		namespace,
+		RubyLiteral(data.ExampleInput, "  "),
+		namespace,
+	))
+
+	readme.ClientMethods = []ReadmeEntry{
+		{
+			Name:        "execute_workflow",
+			Description: fmt.Sprintf("Executes the %s workflow with the provided input, a hash or an input model.", data.Workflow.Name),
+			Code:        "def execute_workflow(input) # => ExecutionResult",
+		},
+		{
+			Name:        "get_execution_status",
+			Description: "Retrieves the status of a workflow execution.",
+			Code:        "def get_execution_status(execution_id) # => ExecutionStatus",
+		},
+		{
+			Name:        "cancel_execution",
+			Description: "Cancels a running workflow execution.",
+			Code:        "def cancel_execution(execution_id) # => nil",
+		},
+		{
+			Name:        "get_execution_result",
+			Description: "Retrieves the result of a completed workflow execution.",
+			Code:        "def get_execution_result(execution_id) # => ExecutionResult",
+		},
+		{
+			Name:        "wait_for_completion",
+			Description: "Polls a workflow execution until it completes.",
+			Code:        "def wait_for_completion(execution_id, timeout: 300, poll_interval: 1) # => ExecutionResult",
+		},
+	}
+	readme.MethodDocs = h.generateMethodDocs(data.Methods)
+
+	readme.Types = []ReadmeEntry{
+		{
+			Name:        "ExecutionResult",
+			Description: "Represents the result of a workflow execution.",
+			Code:        "attr_accessor :id, :workflow_id, :status, :input, :output, :error, :started_at, :completed_at, :duration",
+		},
+		{
+			Name:        "ExecutionStatus",
+			Description: "Represents the status of a workflow execution.",
+			Code:        "attr_accessor :id, :status, :progress, :message, :current_step, :steps",
+		},
+	}
+	for _, model := range data.Models {
+		readme.Types = append(readme.Types, ReadmeEntry{Name: model.Name, Description: model.Description})
+	}
+
+	readme.Configuration = "### Configuration\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`%s.configure do |config|
+  config.base_url = "http://localhost:8080"
+  config.api_key = "your-api-key"
+  config.timeout = 30
+  config.retry_attempts = 3
+  config.retry_delay = 1
+end
+
+client = %s::%s.new`, namespace, namespace, data.ClassName)) +
+		"\n\n### Environment Variables\n\n" + readmeEnvironmentVariables
+
+	readme.ErrorHandling = fmt.Sprintf("Every error derives from `%s::Error`; API errors carry the response `status` and `body`:\n\n", namespace) +
+		readme.CodeBlock(fmt.Sprintf(`begin
+  client.execute_workflow(input)
+rescue %[1]s::AuthenticationError => e
+  puts "Authentication failed: #{e.message}"
+rescue %[1]s::ValidationError => e
+  puts "Validation error: #{e.message}"
+rescue %[1]s::ExecutionError => e
+  puts "Execution #{e.execution_id} failed at step #{e.step_id}: #{e.message}"
+rescue %[1]s::TimeoutError => e
+  puts "Request timed out: #{e.message}"
+rescue %[1]s::NetworkError => e
+  puts "Network error: #{e.message}"
+rescue %[1]s::ApiError => e
+  puts "API error #{e.status}: #{e.message}"
+end`, namespace))
+
+	readme.Development = "### Installing Dependencies\n\n" +
+		codeBlock("bash", "bundle install") +
+		"\n\n### Running Tests\n\n" +
+		codeBlock("bash", "bundle exec rspec") +
+		"\n\n### Building the Gem\n\n" +
+		codeBlock("bash", "gem build "+data.PackageName+".gemspec")
+
+	readme.Requirements = []string{
+		"Ruby 2.7 or higher",
+		"Faraday 1.10 or higher",
+	}
+
+	return readme.Build(data)
+}
+
+// mapFieldTypeToRuby maps field types to the Ruby classes documented on
+// attributes and parameters
+func (h *RubyHandler) mapFieldTypeToRuby(fieldType string) string {
+	switch fieldType {
+	case "string":
+		return "String"
+	case "integer", "int":
+		return "Integer"
+	case "number", "float", "double":
+		return "Float"
+	case "boolean", "bool":
+		return "Boolean"
+	case "array", "list":
+		return "Array"
+	case "object", "map":
+		return "Hash"
+	default:
+		return "Object"
+	}
+}
+
+// generateMethodDocs generates documentation for methods
+func (h *RubyHandler) generateMethodDocs(methods []MethodData) string {
+	if len(methods) == 0 {
+		return ""
+	}
+
+	docs := "\n### Workflow Methods\n\n"
+	for _, method := range methods {
+		parameters := make([]string, len(method.Parameters))
+		for i, param := range method.Parameters {
+			parameters[i] = escapeRubyIdentifier(param.Name) + ":"
+		}
+		signature := "def " + escapeRubyIdentifier(method.Name)
+		if len(parameters) > 0 {
+			signature += "(" + strings.Join(parameters, ", ") + ")"
+		}
+		docs += fmt.Sprintf("#### %s\n\n%s\n\n```ruby\n%s # => Hash\n```\n\n",
+			method.Name,
+			method.Description,
+			signature,
+		)
+	}
+
+	return docs
+}
+
+// escapeRubyIdentifier appends an underscore to identifiers that are Ruby
+// keywords or would override methods the generated classes rely on
+func escapeRubyIdentifier(identifier string) string {
+	if rubyKeywords[identifier] || rubyReservedMethods[identifier] {
+		return identifier + "_"
+	}
+	return identifier
+}
+
+// rubyModuleName returns the module of a gem, the PascalCase gem name
+func rubyModuleName(gemName string) string {
+	return ToPascalCase(gemName)
+}
+
+// isValidRubyGemName validates Ruby gem name. Gem names are restricted to
+// lowercase words separated by single dashes or underscores, which are also
+// valid require paths and map to a valid module name.
+func isValidRubyGemName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	separator := true
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z':
+			separator = false
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				return false
+			}
+			separator = false
+		case r == '-' || r == '_':
+			if separator {
+				return false
+			}
+			separator = true
+		default:
+			return false
+		}
+	}
+
+	return !separator
+}
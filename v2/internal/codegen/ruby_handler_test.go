@@ -0,0 +1,124 @@
+package codegen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRubyHandler(t *testing.T) {
+	handler := NewRubyHandler(NewTemplateManager())
+	workflow := newKotlinWorkflow()
+	request := &GenerationRequest{
+		WorkflowID:   workflow.ID,
+		Language:     LanguageRuby,
+		PackageName:  "orders-client",
+		IncludeTests: true,
+		Options:      map[string]interface{}{"authors": "Orders Team", "version": "1.2.0"},
+	}
+	require.NoError(t, handler.ValidateRequest(request))
+
+	data, err := prepareTemplateData(handler, workflow, request)
+	require.NoError(t, err)
+	data.Methods = []MethodData{{
+		Name:        "validateOrder",
+		Description: "Validate order",
+		StepID:      "validateOrder",
+		ReturnType:  "Hash",
+		Parameters: []ParameterData{
+			{Name: "strict", Type: "Boolean"},
+			{Name: "in", Type: "String"},
+		},
+	}}
+	applyNamingConvention(data, ResolveNamingConvention(LanguageRuby, request.Naming))
+
+	files, err := handler.Generate(workflow, request, data)
+	require.NoError(t, err)
+	byPath := make(map[string]GeneratedFile)
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+
+	lib := "lib/orders-client/"
+	client := byPath[lib+"orders_client.rb"]
+	modelsFile := byPath[lib+"models.rb"]
+	require.NotEmpty(t, client.Content)
+	require.NotEmpty(t, modelsFile.Content)
+
+	t.Run("snake_case methods", func(t *testing.T) {
+		assert.Equal(t, NamingConvention{Methods: CaseSnake, Fields: CaseSnake}, ResolveNamingConvention(LanguageRuby, nil))
+
+		assert.Contains(t, client.Content, "module OrdersClient\n")
+		assert.Contains(t, client.Content, "class OrdersClient\n")
+		assert.Contains(t, client.Content, "def initialize(config: ::OrdersClient.configuration, connection: nil)\n")
+		assert.Contains(t, client.Content, "def execute_workflow(input)\n")
+		assert.Contains(t, client.Content, "def validate_order(strict:, in_:)\n")
+		assert.Contains(t, client.Content, `"in" => in_,`)
+		assert.Contains(t, client.Content, "def get_execution_status(execution_id)\n")
+		assert.Contains(t, client.Content, "def wait_for_completion(execution_id, timeout: 300, poll_interval: 1)\n")
+		assert.Contains(t, client.Content, "@connection.run_request(method, path, body && JSON.generate(body), nil)")
+		assert.NotContains(t, client.Content, "validateOrder")
+	})
+
+	t.Run("model classes", func(t *testing.T) {
+		assertGolden(t, "ruby/models.rb", modelsFile.Content)
+
+		assert.Contains(t, modelsFile.Content, "class OrdersInput\n    include Model\n")
+		assert.Contains(t, modelsFile.Content, "    # @return [String] Customer placing the order\n    attr_accessor :customer_id\n")
+		assert.Contains(t, modelsFile.Content, "    # @return [Integer, nil]\n    attr_accessor :quantity\n")
+		assert.Contains(t, modelsFile.Content, "def initialize(customer_id:, gift: nil, items:, object: nil, quantity: nil)")
+		assert.Contains(t, modelsFile.Content, `customer_id: "customer_id",`)
+	})
+
+	t.Run("gemspec", func(t *testing.T) {
+		gemspec := byPath["orders-client.gemspec"]
+		assertGolden(t, "ruby/orders-client.gemspec", gemspec.Content)
+
+		assert.Equal(t, "config", gemspec.Type)
+		assert.Contains(t, gemspec.Content, `require_relative "lib/orders-client/version"`)
+		assert.Contains(t, gemspec.Content, `spec.name = "orders-client"`)
+		assert.Contains(t, gemspec.Content, "spec.version = OrdersClient::VERSION")
+		assert.Contains(t, gemspec.Content, `spec.authors = ["Orders Team"]`)
+		assert.Contains(t, gemspec.Content, `spec.add_dependency "faraday", ">= 1.10", "< 3"`)
+		assert.Contains(t, gemspec.Content, `spec.add_development_dependency "rspec", "~> 3.12"`)
+		assert.Contains(t, gemspec.Content, "# magic-flow:user-begin dependencies\n  # magic-flow:user-end dependencies")
+
+		version := byPath[lib+"version.rb"]
+		assert.Contains(t, version.Content, "module OrdersClient\n  VERSION = \"1.2.0\"\nend\n")
+
+		entry := byPath["lib/orders-client.rb"]
+		assert.Contains(t, entry.Content, "require_relative \"orders-client/version\"\n")
+		assert.Contains(t, entry.Content, "require_relative \"orders-client/orders_client\"\n")
+	})
+
+	t.Run("errors and specs", func(t *testing.T) {
+		errors := byPath[lib+"errors.rb"]
+		assert.Equal(t, "exception", errors.Type)
+		assert.Contains(t, errors.Content, "class Error < StandardError; end")
+		assert.Contains(t, errors.Content, "class AuthenticationError < ApiError; end")
+		assert.Contains(t, errors.Content, "class ExecutionError < Error")
+
+		spec := byPath["spec/orders_client_spec.rb"]
+		assert.Contains(t, spec.Content, "RSpec.describe OrdersClient::OrdersClient do")
+		assert.Contains(t, spec.Content, `describe "#validate_order" do`)
+		assert.Contains(t, spec.Content, `"customer_id" => "customer-123",`)
+		assert.Contains(t, byPath["spec/spec_helper.rb"].Content, `require "orders-client"`)
+	})
+}
+
+func TestRubyGemName(t *testing.T) {
+	handler := NewRubyHandler(nil)
+
+	for _, name := range []string{"orders", "orders-client", "orders_client", "orders2"} {
+		assert.NoError(t, handler.ValidateRequest(&GenerationRequest{PackageName: name}), name)
+	}
+	for _, name := range []string{"Orders", "2orders", "orders--client", "-orders", "orders_", "orders.client", "orders client", "ördersclient"} {
+		assert.Error(t, handler.ValidateRequest(&GenerationRequest{PackageName: name}), name)
+	}
+
+	request := &GenerationRequest{}
+	require.NoError(t, handler.ValidateRequest(request))
+	assert.Equal(t, "magic_flow_client", request.PackageName)
+	assert.Equal(t, "MagicFlowClient", rubyModuleName(request.PackageName))
+}
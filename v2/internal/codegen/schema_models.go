@@ -0,0 +1,69 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// schemaModels generates the models of the workflow input and output
+// schemas, named baseName followed by Input or Output. mapType maps JSON
+// schema types to the types of the target language. Schemas without
+// properties get no model.
+func schemaModels(workflow *models.Workflow, baseName string, mapType func(string) string) []ModelData {
+	var result []ModelData
+
+	schemas := []struct {
+		suffix string
+		schema models.JSONSchema
+	}{
+		{"Input", workflow.InputSchema},
+		{"Output", workflow.OutputSchema},
+	}
+	for _, s := range schemas {
+		fields := schemaFields(s.schema, mapType)
+		if len(fields) == 0 {
+			continue
+		}
+		result = append(result, ModelData{
+			Name:        baseName + s.suffix,
+			Description: fmt.Sprintf("%s of the %s workflow", s.suffix, workflow.Name),
+			Fields:      fields,
+		})
+	}
+
+	return result
+}
+
+// schemaFields generates field definitions from schema, sorted by name so the
+// generated code is stable. The json tag of a field keeps its property name
+// when naming conventions rename the field.
+func schemaFields(schema models.JSONSchema, mapType func(string) string) []FieldData {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]FieldData, 0, len(names))
+	for _, name := range names {
+		property, _ := schema.Properties[name].(map[string]interface{})
+		description, _ := property["description"].(string)
+		propertyType, _ := property["type"].(string)
+		fields = append(fields, FieldData{
+			Name:        name,
+			Type:        mapType(propertyType),
+			Description: description,
+			Required:    required[name],
+			Tags:        map[string]string{"json": name},
+		})
+	}
+
+	return fields
+}
@@ -31,6 +31,10 @@ func NewService() (*Service, error) {
 	service.handlers[LanguageTypeScript] = NewTypeScriptHandler(templateManager)
 	service.handlers[LanguagePython] = NewPythonHandler(templateManager)
 	service.handlers[LanguageJava] = NewJavaHandler(templateManager)
+	service.handlers[LanguageKotlin] = NewKotlinHandler(templateManager)
+	service.handlers[LanguageSwift] = NewSwiftHandler(templateManager)
+	service.handlers[LanguageRuby] = NewRubyHandler(templateManager)
+	service.handlers[LanguageGRPC] = NewGRPCHandler(templateManager)
 
 	return service, nil
 }
@@ -57,7 +61,7 @@ func (s *Service) GenerateCode(workflow *models.Workflow, request *GenerationReq
 	}
 
 	// Prepare template data
-	templateData, err := handler.PrepareTemplateData(workflow, request)
+	templateData, err := prepareTemplateData(handler, workflow, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare template data: %w", err)
 	}
@@ -68,6 +72,13 @@ func (s *Service) GenerateCode(workflow *models.Workflow, request *GenerationReq
 		return nil, fmt.Errorf("failed to generate code: %w", err)
 	}
 
+	// Catch template bugs that produce code which does not parse
+	if request.ValidateOutput {
+		if err := CheckSyntax(files); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create result
 	result := &GenerationResult{
 		WorkflowID:   workflow.ID,
@@ -80,6 +91,7 @@ func (s *Service) GenerateCode(workflow *models.Workflow, request *GenerationReq
 			"workflow_version": workflow.Version,
 			"file_count":       len(files),
 			"include_tests":    request.IncludeTests,
+			"syntax_checked":   request.ValidateOutput,
 			"options":          request.Options,
 		},
 	}
@@ -156,10 +168,20 @@ func (s *Service) GetDefaultRequest(language Language, workflowName string) (*Ge
 	case LanguagePython:
 		request.Options["package_name"] = ToSnakeCase(workflowName) + "_client"
 		request.Options["version"] = "1.0.0"
-	case LanguageJava:
+	case LanguageJava, LanguageKotlin:
 		request.Options["group_id"] = "com.magicflow"
 		request.Options["artifact_id"] = ToSnakeCase(workflowName) + "-client"
 		request.Options["version"] = "1.0.0"
+	case LanguageSwift:
+		request.Options["repository_url"] = "https://github.com/your-org/" + ToSnakeCase(workflowName) + "-client.git"
+		request.Options["version"] = "1.0.0"
+	case LanguageRuby:
+		request.Options["authors"] = "Magic Flow"
+		request.Options["homepage"] = "https://github.com/your-org/" + ToSnakeCase(workflowName) + "-client"
+		request.Options["version"] = "1.0.0"
+	case LanguageGRPC:
+		request.Options["module_name"] = "github.com/your-org/" + ToSnakeCase(workflowName) + "-client"
+		request.Options["go_stubs"] = false
 	}
 
 	return request, nil
@@ -224,6 +246,55 @@ func (s *Service) GetFileStructure(language Language, packageName string) (map[s
 		if packageName != "" {
 			structure[filepath.Join("src/test/java", packagePath, "ClientTest.java")] = "Client tests"
 		}
+
+	case LanguageKotlin:
+		packagePath := strings.ReplaceAll(packageName, ".", "/")
+		structure[filepath.Join("src/main/kotlin", packagePath, "Client.kt")] = "Main client implementation"
+		structure[filepath.Join("src/main/kotlin", packagePath, "Constants.kt")] = "Workflow constants"
+		structure[filepath.Join("src/main/kotlin", packagePath, "models", "Models.kt")] = "Data classes"
+		structure[filepath.Join("src/main/kotlin", packagePath, "exceptions", "MagicFlowException.kt")] = "Sealed exception hierarchy"
+		structure[filepath.Join("src/main/kotlin", packagePath, "config", "ClientConfig.kt")] = "Client configuration"
+		structure["build.gradle.kts"] = "Gradle build script"
+		structure["settings.gradle.kts"] = "Gradle settings"
+		structure["README.md"] = "Documentation"
+		if packageName != "" {
+			structure[filepath.Join("src/test/kotlin", packagePath, "ClientTest.kt")] = "Client tests"
+		}
+
+	case LanguageSwift:
+		sourcesPath := filepath.Join("Sources", packageName)
+		structure[filepath.Join(sourcesPath, "Client.swift")] = "Main client implementation"
+		structure[filepath.Join(sourcesPath, "Models.swift")] = "Codable models"
+		structure[filepath.Join(sourcesPath, "Constants.swift")] = "Workflow constants"
+		structure[filepath.Join(sourcesPath, "MagicFlowError.swift")] = "Error enum"
+		structure[filepath.Join(sourcesPath, "ClientConfig.swift")] = "Client configuration"
+		structure["Package.swift"] = "Swift package manifest"
+		structure["README.md"] = "Documentation"
+		if packageName != "" {
+			structure[filepath.Join("Tests", packageName+"Tests", "ClientTests.swift")] = "Client tests"
+		}
+
+	case LanguageRuby:
+		libPath := filepath.Join("lib", packageName)
+		structure[filepath.Join("lib", packageName+".rb")] = "Gem entry point"
+		structure[filepath.Join(libPath, "client.rb")] = "Main client implementation"
+		structure[filepath.Join(libPath, "models.rb")] = "Model classes"
+		structure[filepath.Join(libPath, "constants.rb")] = "Workflow constants"
+		structure[filepath.Join(libPath, "errors.rb")] = "Error hierarchy"
+		structure[filepath.Join(libPath, "configuration.rb")] = "Client configuration"
+		structure[filepath.Join(libPath, "version.rb")] = "Gem version"
+		structure[packageName+".gemspec"] = "Gem specification"
+		structure["Gemfile"] = "Bundler dependencies"
+		structure["README.md"] = "Documentation"
+		structure["spec/spec_helper.rb"] = "RSpec configuration"
+		structure["spec/client_spec.rb"] = "Client tests"
+
+	case LanguageGRPC:
+		packagePath := strings.ReplaceAll(packageName, ".", "/")
+		structure[filepath.Join(packagePath, "service.proto")] = "Service and message definitions"
+		structure[filepath.Join("gen/go", packagePath, "service.pb.go")] = "Go messages, with the go_stubs option"
+		structure[filepath.Join("gen/go", packagePath, "service_grpc.pb.go")] = "Go client and server stubs, with the go_stubs option"
+		structure["README.md"] = "Documentation"
 	}
 
 	return structure, nil
@@ -282,7 +353,7 @@ func (s *Service) GetGenerationStats(workflow *models.Workflow, language Languag
 		IncludeTests: true,
 	}
 
-	templateData, err := handler.PrepareTemplateData(workflow, request)
+	templateData, err := prepareTemplateData(handler, workflow, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare template data: %w", err)
 	}
@@ -374,6 +445,14 @@ func (s *Service) getSupportedFeatures(language Language) []string {
 		features = append(features, "pip_package", "type_hints", "async_support")
 	case LanguageJava:
 		features = append(features, "maven_support", "gradle_support", "annotations")
+	case LanguageKotlin:
+		features = append(features, "gradle_support", "coroutines", "data_classes")
+	case LanguageSwift:
+		features = append(features, "swift_package_manager", "async_await", "codable")
+	case LanguageRuby:
+		features = append(features, "rubygems", "faraday", "rspec")
+	case LanguageGRPC:
+		features = append(features, "protobuf", "wire_compatibility", "go_stubs")
 	}
 
 	return features
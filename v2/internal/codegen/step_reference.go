@@ -0,0 +1,81 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+// StepConfigReference renders a config reference table for each step type
+// used by the workflow that has a registered schema
+func StepConfigReference(workflow *models.Workflow, schemas *stepconfig.Registry) string {
+	stepTypes := make([]string, 0, len(workflow.Definition.Steps))
+	for _, step := range workflow.Definition.Steps {
+		stepTypes = append(stepTypes, step.Type)
+	}
+	return renderStepConfigReference(stepTypes, schemas)
+}
+
+// renderStepConfigReference renders the tables of the given step types in
+// order of first use
+func renderStepConfigReference(stepTypes []string, schemas *stepconfig.Registry) string {
+	var reference strings.Builder
+	seen := make(map[string]bool)
+
+	for _, stepType := range stepTypes {
+		if seen[stepType] {
+			continue
+		}
+		seen[stepType] = true
+
+		schema, exists := schemas.Get(stepType)
+		if !exists {
+			continue
+		}
+
+		reference.WriteString(fmt.Sprintf("### %s\n\n", stepType))
+		if schema.Description != "" {
+			reference.WriteString(schema.Description + ".\n\n")
+		}
+		reference.WriteString("| Field | Type | Required | Default | Description |\n")
+		reference.WriteString("|-------|------|----------|---------|-------------|\n")
+		for _, field := range schema.Fields {
+			reference.WriteString(fmt.Sprintf("| `%s` | %s | %s | %s | %s |\n",
+				field.Name,
+				stepFieldType(field),
+				yesNo(field.Required),
+				markdownCell(field.Default),
+				markdownCell(field.Description),
+			))
+		}
+		reference.WriteString("\n")
+	}
+
+	return reference.String()
+}
+
+// stepFieldType describes a field type including item types and allowed values
+func stepFieldType(field stepconfig.Field) string {
+	fieldType := field.Type
+	if field.ItemType != "" {
+		fieldType = fmt.Sprintf("%s of %s", fieldType, field.ItemType)
+	}
+	if len(field.Enum) > 0 {
+		fieldType = fmt.Sprintf("%s (%s)", fieldType, strings.Join(field.Enum, ", "))
+	}
+	return fieldType
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// markdownCell escapes a value for use in a markdown table cell
+func markdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
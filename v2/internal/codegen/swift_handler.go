@@ -0,0 +1,644 @@
+package codegen
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// swiftKeywords cannot be used as identifiers in Swift without backticks
+var swiftKeywords = map[string]bool{
+	"associatedtype": true, "class": true, "deinit": true, "enum": true,
+	"extension": true, "fileprivate": true, "func": true, "import": true,
+	"init": true, "inout": true, "internal": true, "let": true,
+	"open": true, "operator": true, "private": true, "precedencegroup": true,
+	"protocol": true, "public": true, "rethrows": true, "static": true,
+	"struct": true, "subscript": true, "typealias": true, "var": true,
+	"break": true, "case": true, "catch": true, "continue": true,
+	"default": true, "defer": true, "do": true, "else": true,
+	"fallthrough": true, "for": true, "guard": true, "if": true,
+	"in": true, "repeat": true, "return": true, "throw": true,
+	"switch": true, "where": true, "while": true, "Any": true,
+	"as": true, "await": true, "false": true, "is": true,
+	"nil": true, "self": true, "Self": true, "super": true,
+	"throws": true, "true": true, "try": true,
+}
+
+// SwiftHandler implements LanguageHandler for Swift code generation. The
+// generated Swift package exposes async functions on top of URLSession and
+// uses Codable structs for the workflow models.
+type SwiftHandler struct {
+	templateManager *TemplateManager
+	namer           *ClientNamer
+}
+
+// swiftTemplateData is the template data of the Swift client, which also
+// needs the name of the typed input model
+type swiftTemplateData struct {
+	*TemplateData
+	InputModel string
+}
+
+// NewSwiftHandler creates a new Swift language handler
+func NewSwiftHandler(templateManager *TemplateManager) *SwiftHandler {
+	return &SwiftHandler{
+		templateManager: templateManager,
+		namer:           NewClientNamer(),
+	}
+}
+
+// Generate generates Swift code for a workflow
+func (h *SwiftHandler) Generate(workflow *models.Workflow, request *GenerationRequest, templateData *TemplateData) ([]GeneratedFile, error) {
+	var files []GeneratedFile
+
+	// Generate client file
+	clientFile, err := h.generateClientFile(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client file: %w", err)
+	}
+	files = append(files, clientFile)
+
+	// Generate models file
+	modelsFile, err := h.generateTemplateFile(templateData, "models", "Models.swift", "model")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate models file: %w", err)
+	}
+	files = append(files, modelsFile)
+
+	// Generate constants file
+	typesFile, err := h.generateTemplateFile(templateData, "types", "Constants.swift", "types")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate constants file: %w", err)
+	}
+	files = append(files, typesFile)
+
+	files = append(files, h.generateErrorFile(templateData))
+	files = append(files, h.generateConfigFile(templateData))
+
+	// Generate test file if requested
+	if request.IncludeTests {
+		testFile, err := h.generateTestFile(templateData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate test file: %w", err)
+		}
+		files = append(files, testFile)
+	}
+
+	// Generate Swift package manifest
+	files = append(files, h.generatePackageFile(templateData, request.IncludeTests))
+
+	// Generate README file
+	readmeFile, err := h.generateReadmeFile(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate README file: %w", err)
+	}
+	files = append(files, readmeFile)
+
+	return files, nil
+}
+
+// ValidateRequest validates Swift-specific generation request. The package
+// name is the name of the Swift module.
+func (h *SwiftHandler) ValidateRequest(request *GenerationRequest) error {
+	if request.PackageName == "" {
+		request.PackageName = h.GetDefaultPackageName()
+	}
+
+	if !isValidSwiftModuleName(request.PackageName) {
+		return fmt.Errorf("invalid Swift module name: %s", request.PackageName)
+	}
+
+	return nil
+}
+
+// PrepareTemplateData prepares template data for Swift code generation
+func (h *SwiftHandler) PrepareTemplateData(workflow *models.Workflow, request *GenerationRequest) (*TemplateData, error) {
+	packageName := request.PackageName
+	if packageName == "" {
+		packageName = h.GetDefaultPackageName()
+	}
+
+	className := h.namer.ClientClassName(workflow.Name)
+
+	// Step methods return the workflow output
+	methods := ExtractStepMethods(workflow)
+	for i := range methods {
+		methods[i].ReturnType = "[String: JSONValue]?"
+		for j := range methods[i].Parameters {
+			methods[i].Parameters[j].Type = h.mapFieldTypeToSwift(methods[i].Parameters[j].Type)
+		}
+	}
+
+	templateData := &TemplateData{
+		Workflow:     workflow,
+		PackageName:  packageName,
+		ClassName:    className,
+		Methods:      methods,
+		Models:       h.generateModels(workflow, strings.TrimSuffix(className, "Client")),
+		Options:      request.Options,
+		GeneratedAt:  workflow.CreatedAt,
+		ExampleInput: WorkflowExampleInput(workflow),
+	}
+
+	return templateData, nil
+}
+
+// GetFileExtension returns the file extension for Swift files
+func (h *SwiftHandler) GetFileExtension() string {
+	return ".swift"
+}
+
+// GetDefaultPackageName returns the default module name for Swift
+func (h *SwiftHandler) GetDefaultPackageName() string {
+	return "MagicFlowClient"
+}
+
+// sourcePath returns the path of a file in the module's sources
+func (h *SwiftHandler) sourcePath(data *TemplateData, name string) string {
+	return filepath.Join("Sources", data.PackageName, name)
+}
+
+// generateClientFile generates the main client file
+func (h *SwiftHandler) generateClientFile(data *TemplateData) (GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("swift", "client")
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	clientData := &swiftTemplateData{TemplateData: data}
+	for _, model := range data.Models {
+		if model.Name == strings.TrimSuffix(data.ClassName, "Client")+"Input" {
+			clientData.InputModel = model.Name
+		}
+	}
+
+	content, err := RenderTemplate(template, clientData)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	return GeneratedFile{
+		Path:     h.sourcePath(data, data.ClassName+".swift"),
+		Content:  content,
+		Language: "swift",
+		Type:     "client",
+	}, nil
+}
+
+// generateTemplateFile renders a template into a file of the module's
+// sources
+func (h *SwiftHandler) generateTemplateFile(data *TemplateData, templateName, name, fileType string) (GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("swift", templateName)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	content, err := RenderTemplate(template, data)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	return GeneratedFile{
+		Path:     h.sourcePath(data, name),
+		Content:  content,
+		Language: "swift",
+		Type:     fileType,
+	}, nil
+}
+
+// generateErrorFile generates the error enum. Callers can switch over every
+// error case exhaustively.
+func (h *SwiftHandler) generateErrorFile(data *TemplateData) GeneratedFile {
+	content := fmt.Sprintf(`// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: %s
+
+import Foundation
+
+/// Errors thrown by the Magic Flow client
+public enum MagicFlowError: Error, Equatable {
+    /// The server rejected the request
+    case api(statusCode: Int, message: String, body: String?)
+    /// The API key is missing or invalid
+    case authentication(String)
+    /// The workflow input is invalid
+    case validation(String)
+    /// The workflow execution failed or was cancelled
+    case execution(message: String, executionId: String?, stepId: String?)
+    /// A request or an execution did not complete in time
+    case timeout(String)
+    /// The server could not be reached
+    case network(String)
+    /// The response could not be decoded
+    case decoding(String)
+}
+
+extension MagicFlowError: LocalizedError {
+    public var errorDescription: String? {
+        switch self {
+        case let .api(statusCode, message, _):
+            return "\(message) (status \(statusCode))"
+        case let .authentication(message), let .validation(message), let .timeout(message),
+             let .network(message), let .decoding(message):
+            return message
+        case let .execution(message, _, _):
+            return message
+        }
+    }
+}
+`,
+		data.GeneratedAt.Format("2006-01-02 15:04:05"),
+	)
+
+	return GeneratedFile{
+		Path:     h.sourcePath(data, "MagicFlowError.swift"),
+		Content:  content,
+		Language: "swift",
+		Type:     "exception",
+	}
+}
+
+// generateConfigFile generates the configuration file
+func (h *SwiftHandler) generateConfigFile(data *TemplateData) GeneratedFile {
+	content := fmt.Sprintf(`// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: %s
+
+import Foundation
+
+/// Configuration for the %s client. The base URL and API key default to the
+/// MAGICFLOW_BASE_URL and MAGICFLOW_API_KEY environment variables.
+public struct ClientConfig {
+    public static let defaultBaseURL = URL(string: "http://localhost:8080")!
+
+    public var baseURL: URL
+    public var apiKey: String
+    /// Timeout of a single request, in seconds
+    public var timeout: TimeInterval
+    public var retryAttempts: Int
+    /// Delay between retries of a failed request, in seconds
+    public var retryDelay: TimeInterval
+
+    public init(
+        baseURL: URL? = nil,
+        apiKey: String? = nil,
+        timeout: TimeInterval = 30,
+        retryAttempts: Int = 3,
+        retryDelay: TimeInterval = 1
+    ) {
+        let environment = ProcessInfo.processInfo.environment
+        self.baseURL = baseURL
+            ?? environment["MAGICFLOW_BASE_URL"].flatMap(URL.init(string:))
+            ?? ClientConfig.defaultBaseURL
+        self.apiKey = apiKey ?? environment["MAGICFLOW_API_KEY"] ?? ""
+        self.timeout = timeout
+        self.retryAttempts = retryAttempts
+        self.retryDelay = retryDelay
+    }
+}
+`,
+		data.GeneratedAt.Format("2006-01-02 15:04:05"),
+		data.Workflow.Name,
+	)
+
+	return GeneratedFile{
+		Path:     h.sourcePath(data, "ClientConfig.swift"),
+		Content:  content,
+		Language: "swift",
+		Type:     "config",
+	}
+}
+
+// generateTestFile generates the test file
+func (h *SwiftHandler) generateTestFile(data *TemplateData) (GeneratedFile, error) {
+	template, err := h.templateManager.GetTemplate("swift", "test")
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	content, err := RenderTemplate(template, data)
+	if err != nil {
+		return GeneratedFile{}, err
+	}
+
+	return GeneratedFile{
+		Path:     filepath.Join("Tests", data.PackageName+"Tests", data.ClassName+"Tests.swift"),
+		Content:  content,
+		Language: "swift",
+		Type:     "test",
+	}, nil
+}
+
+// packageCoordinates returns the repository URL and version users depend on
+func (h *SwiftHandler) packageCoordinates(data *TemplateData) (string, string) {
+	repositoryURL := "https://github.com/your-org/" + ToSnakeCase(data.Workflow.Name) + "-client.git"
+	version := "1.0.0"
+	if data.Options != nil {
+		if u, ok := data.Options["repository_url"].(string); ok && u != "" {
+			repositoryURL = u
+		}
+		if v, ok := data.Options["version"].(string); ok && v != "" {
+			version = v
+		}
+	}
+	return repositoryURL, version
+}
+
+// generatePackageFile generates the Package.swift manifest of the Swift
+// package. The test target is only declared when tests are generated, as
+// SwiftPM rejects targets without sources.
+func (h *SwiftHandler) generatePackageFile(data *TemplateData, includeTests bool) GeneratedFile {
+	module := data.PackageName
+
+	testTarget := ""
+	if includeTests {
+		testTarget = fmt.Sprintf(`
+        .testTarget(
+            name: "%sTests",
+            dependencies: ["%s"],
+            path: "Tests/%sTests"
+        ),`, module, module, module)
+	}
+
+	content := fmt.Sprintf(`// swift-tools-version:5.7
+// Client library for the %s workflow
+import PackageDescription
+
+let package = Package(
+    name: "%s",
+    platforms: [
+        .macOS(.v12),
+        .iOS(.v15),
+        .tvOS(.v15),
+        .watchOS(.v8),
+    ],
+    products: [
+        .library(name: "%s", targets: ["%s"]),
+    ],
+    dependencies: [
+        // magic-flow:user-begin dependencies
+        // magic-flow:user-end dependencies
+    ],
+    targets: [
+        .target(
+            name: "%s",
+            path: "Sources/%s"
+        ),%s
+    ]
+)
+`,
+		data.Workflow.Name,
+		module,
+		module,
+		module,
+		module,
+		module,
+		testTarget,
+	)
+
+	return GeneratedFile{
+		Path:     "Package.swift",
+		Content:  content,
+		Language: "swift",
+		Type:     "config",
+	}
+}
+
+// generateReadmeFile generates the README file
+func (h *SwiftHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, error) {
+	repositoryURL, version := h.packageCoordinates(data)
+
+	readme := &ReadmeBuilder{
+		Language:  "Swift",
+		CodeFence: "swift",
+	}
+
+	readme.Installation = "### Swift Package Manager\n\nAdd the package to the dependencies of your `Package.swift`:\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`.package(url: %q, from: %q)`, repositoryURL, version)) +
+		"\n\nThen add `" + data.PackageName + "` to the dependencies of your target."
+
+	readme.Usage = readme.CodeBlock(fmt.Sprintf(`import %s
+
+let client = %s(config: ClientConfig(baseURL: URL(string: "http://localhost:8080")!, apiKey: "your-api-key"))
+
+do {
+    // Execute workflow
+    let result = try await client.executeWorkflow(input: %s)
+    print("Execution ID: \(result.id)")
+
+    // Wait for the execution to complete
+    let completed = try await client.waitForCompletion(executionId: result.id)
+    print("Output: \(String(describing: completed.output))")
+} catch let error as MagicFlowError {
+    print("Error: \(error.localizedDescription)")
+}`,
+		data.PackageName,
+		data.ClassName,
+		SwiftLiteral(data.ExampleInput, ""),
+	))
+
+	readme.ClientMethods = []ReadmeEntry{
+		{
+			Name:        "executeWorkflow",
+			Description: fmt.Sprintf("Executes the %s workflow with the provided input.", data.Workflow.Name),
+			Code:        "func executeWorkflow(input: [String: JSONValue]) async throws -> ExecutionResult",
+		},
+		{
+			Name:        "getExecutionStatus",
+			Description: "Retrieves the status of a workflow execution.",
+			Code:        "func getExecutionStatus(executionId: String) async throws -> ExecutionStatus",
+		},
+		{
+			Name:        "cancelExecution",
+			Description: "Cancels a running workflow execution.",
+			Code:        "func cancelExecution(executionId: String) async throws",
+		},
+		{
+			Name:        "getExecutionResult",
+			Description: "Retrieves the result of a completed workflow execution.",
+			Code:        "func getExecutionResult(executionId: String) async throws -> ExecutionResult",
+		},
+		{
+			Name:        "waitForCompletion",
+			Description: "Polls a workflow execution until it completes.",
+			Code: `func waitForCompletion(
+    executionId: String,
+    timeout: TimeInterval = 300,
+    pollInterval: TimeInterval = 1
+) async throws -> ExecutionResult`,
+		},
+	}
+	readme.MethodDocs = h.generateMethodDocs(data.Methods)
+
+	readme.Types = []ReadmeEntry{
+		{
+			Name:        "ExecutionResult",
+			Description: "Represents the result of a workflow execution.",
+			Code: `public struct ExecutionResult: Codable, Equatable {
+    public let id: String
+    public let workflowId: String
+    public let status: String
+    public let input: [String: JSONValue]?
+    public let output: [String: JSONValue]?
+    public let error: String?
+    public let startedAt: Date?
+    public let completedAt: Date?
+    public let duration: Int?
+}`,
+		},
+		{
+			Name:        "ExecutionStatus",
+			Description: "Represents the status of a workflow execution.",
+			Code: `public struct ExecutionStatus: Codable, Equatable {
+    public let id: String
+    public let status: String
+    public let progress: Double?
+    public let message: String?
+    public let currentStep: String?
+    public let steps: [StepStatus]?
+}`,
+		},
+		{
+			Name:        "JSONValue",
+			Description: "A JSON value, used for workflow data without a fixed type. It can be written as a string, number, boolean, array, dictionary or nil literal.",
+		},
+	}
+	for _, model := range data.Models {
+		readme.Types = append(readme.Types, ReadmeEntry{Name: model.Name, Description: model.Description})
+	}
+
+	readme.Configuration = "### ClientConfig\n\n" +
+		readme.CodeBlock(fmt.Sprintf(`let config = ClientConfig(
+    baseURL: URL(string: "http://localhost:8080")!,
+    apiKey: "your-api-key",
+    timeout: 30,
+    retryAttempts: 3,
+    retryDelay: 1
+)
+
+let client = %s(config: config)`, data.ClassName)) +
+		"\n\n### Environment Variables\n\n" + readmeEnvironmentVariables
+
+	readme.ErrorHandling = "Errors are reported with the `MagicFlowError` enum, so a `switch` over it is exhaustive:\n\n" +
+		readme.CodeBlock(`do {
+    _ = try await client.executeWorkflow(input: input)
+} catch let error as MagicFlowError {
+    switch error {
+    case .authentication(let message):
+        print("Authentication failed: \(message)")
+    case .validation(let message):
+        print("Validation error: \(message)")
+    case let .execution(message, executionId, stepId):
+        print("Execution \(executionId ?? "") failed at step \(stepId ?? ""): \(message)")
+    case .timeout(let message):
+        print("Request timed out: \(message)")
+    case .network(let message):
+        print("Network error: \(message)")
+    case let .api(statusCode, message, _):
+        print("API error \(statusCode): \(message)")
+    case .decoding(let message):
+        print("Unexpected response: \(message)")
+    }
+}`)
+
+	readme.Development = "### Building the Package\n\n" +
+		codeBlock("bash", "swift build") +
+		"\n\n### Running Tests\n\n" +
+		codeBlock("bash", "swift test")
+
+	readme.Requirements = []string{
+		"Swift 5.7 or higher",
+		"macOS 12, iOS 15, tvOS 15 or watchOS 8",
+	}
+
+	return readme.Build(data)
+}
+
+// generateModels generates Codable structs for the workflow input and output
+// schemas
+func (h *SwiftHandler) generateModels(workflow *models.Workflow, baseName string) []ModelData {
+	return schemaModels(workflow, baseName, h.mapFieldTypeToSwift)
+}
+
+// mapFieldTypeToSwift maps field types to Swift types. Values without a
+// fixed type are JSONValues, which unlike Any are Codable.
+func (h *SwiftHandler) mapFieldTypeToSwift(fieldType string) string {
+	switch fieldType {
+	case "string":
+		return "String"
+	case "integer", "int":
+		return "Int"
+	case "number", "float", "double":
+		return "Double"
+	case "boolean", "bool":
+		return "Bool"
+	case "array", "list":
+		return "[JSONValue]"
+	case "object", "map":
+		return "[String: JSONValue]"
+	default:
+		return "JSONValue"
+	}
+}
+
+// generateMethodDocs generates documentation for methods
+func (h *SwiftHandler) generateMethodDocs(methods []MethodData) string {
+	if len(methods) == 0 {
+		return ""
+	}
+
+	docs := "\n### Workflow Methods\n\n"
+	for _, method := range methods {
+		parameters := make([]string, len(method.Parameters))
+		for i, param := range method.Parameters {
+			parameters[i] = escapeSwiftIdentifier(param.Name) + ": " + param.Type
+		}
+		docs += fmt.Sprintf("#### %s\n\n%s\n\n```swift\nfunc %s(%s) async throws -> [String: JSONValue]?\n```\n\n",
+			method.Name,
+			method.Description,
+			escapeSwiftIdentifier(method.Name),
+			strings.Join(parameters, ", "),
+		)
+	}
+
+	return docs
+}
+
+// escapeSwiftIdentifier quotes identifiers that are Swift keywords with
+// backticks
+func escapeSwiftIdentifier(identifier string) string {
+	if swiftKeywords[identifier] {
+		return "`" + identifier + "`"
+	}
+	return identifier
+}
+
+// swiftCodingKey returns the CodingKeys case of a field, mapping it to its
+// JSON name when the two differ
+func swiftCodingKey(field FieldData) string {
+	name := escapeSwiftIdentifier(field.Name)
+	if jsonName := field.Tags["json"]; jsonName != "" && jsonName != field.Name {
+		return name + " = " + swiftQuote(jsonName)
+	}
+	return name
+}
+
+// isValidSwiftModuleName validates Swift module name. Module names are
+// restricted to ASCII identifiers so they are also valid SwiftPM target and
+// directory names.
+func isValidSwiftModuleName(name string) bool {
+	if name == "" || swiftKeywords[name] {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,108 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwiftHandler(t *testing.T) {
+	handler := NewSwiftHandler(NewTemplateManager())
+	workflow := newKotlinWorkflow()
+	request := &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageSwift, PackageName: "OrdersClient", IncludeTests: true}
+	require.NoError(t, handler.ValidateRequest(request))
+
+	data, err := prepareTemplateData(handler, workflow, request)
+	require.NoError(t, err)
+	data.Methods = []MethodData{{
+		Name:        "validateOrder",
+		Description: "Validate order",
+		StepID:      "validate_order",
+		ReturnType:  "[String: JSONValue]?",
+		Parameters: []ParameterData{
+			{Name: "strict", Type: "Bool"},
+			{Name: "in", Type: "String"},
+		},
+	}}
+
+	files, err := handler.Generate(workflow, request, data)
+	require.NoError(t, err)
+	byPath := make(map[string]GeneratedFile)
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+
+	source := "Sources/OrdersClient/"
+	client := byPath[source+"OrdersClient.swift"]
+	modelsFile := byPath[source+"Models.swift"]
+	require.NotEmpty(t, client.Content)
+	require.NotEmpty(t, modelsFile.Content)
+
+	t.Run("codable models", func(t *testing.T) {
+		assertGolden(t, "swift/Models.swift", modelsFile.Content)
+
+		assert.Contains(t, modelsFile.Content, "public struct OrdersInput: Codable, Equatable {")
+		assert.Contains(t, modelsFile.Content, "public struct OrdersOutput: Codable, Equatable {")
+		assert.Contains(t, modelsFile.Content, "public var customerId: String\n")
+		assert.Contains(t, modelsFile.Content, "public var quantity: Int?\n")
+		assert.Contains(t, modelsFile.Content, "public var items: [JSONValue]\n")
+		assert.Contains(t, modelsFile.Content, "enum CodingKeys: String, CodingKey {")
+		assert.Contains(t, modelsFile.Content, `case customerId = "customer_id"`)
+		assert.Contains(t, modelsFile.Content, "case quantity\n")
+		assert.Contains(t, modelsFile.Content, "public enum JSONValue: Codable, Equatable {")
+	})
+
+	t.Run("async functions", func(t *testing.T) {
+		assert.Contains(t, client.Content, "public func executeWorkflow(input: [String: JSONValue]) async throws -> ExecutionResult")
+		assert.Contains(t, client.Content, "public func executeWorkflow(input: OrdersInput) async throws -> ExecutionResult")
+		assert.Contains(t, client.Content, "public func validateOrder(strict: Bool, `in`: String) async throws -> [String: JSONValue]?")
+		assert.Contains(t, client.Content, `"in": try JSONValue(encoding: `+"`in`),")
+		assert.Contains(t, client.Content, "try await session.data(for: request)")
+	})
+
+	t.Run("package manifest", func(t *testing.T) {
+		manifest := byPath["Package.swift"]
+		assertGolden(t, "swift/Package.swift", manifest.Content)
+
+		assert.Equal(t, "config", manifest.Type)
+		assert.True(t, strings.HasPrefix(manifest.Content, "// swift-tools-version:5.7\n"))
+		assert.Contains(t, manifest.Content, "import PackageDescription")
+		assert.Contains(t, manifest.Content, `name: "OrdersClient",`)
+		assert.Contains(t, manifest.Content, `.library(name: "OrdersClient", targets: ["OrdersClient"]),`)
+		assert.Contains(t, manifest.Content, `path: "Sources/OrdersClient"`)
+		assert.Contains(t, manifest.Content, `dependencies: ["OrdersClient"],`)
+		assert.Contains(t, manifest.Content, "// magic-flow:user-begin dependencies\n        // magic-flow:user-end dependencies")
+
+		withoutTests := handler.generatePackageFile(data, false)
+		assert.NotContains(t, withoutTests.Content, ".testTarget(")
+		assert.Contains(t, withoutTests.Content, ".target(")
+	})
+
+	t.Run("errors and tests", func(t *testing.T) {
+		errors := byPath[source+"MagicFlowError.swift"]
+		assert.Equal(t, "exception", errors.Type)
+		assert.Contains(t, errors.Content, "public enum MagicFlowError: Error, Equatable {")
+		assert.Contains(t, errors.Content, "case authentication(String)")
+
+		tests := byPath["Tests/OrdersClientTests/OrdersClientTests.swift"]
+		assert.Contains(t, tests.Content, "@testable import OrdersClient")
+		assert.Contains(t, tests.Content, `"customer_id": "customer-123",`)
+	})
+}
+
+func TestSwiftModuleName(t *testing.T) {
+	handler := NewSwiftHandler(nil)
+
+	for _, name := range []string{"OrdersClient", "orders", "_Orders", "Orders2"} {
+		assert.NoError(t, handler.ValidateRequest(&GenerationRequest{PackageName: name}), name)
+	}
+	for _, name := range []string{"2Orders", "Orders-Client", "Orders.Client", "class", "Self", "Ördersclient"} {
+		assert.Error(t, handler.ValidateRequest(&GenerationRequest{PackageName: name}), name)
+	}
+
+	request := &GenerationRequest{}
+	require.NoError(t, handler.ValidateRequest(request))
+	assert.Equal(t, "MagicFlowClient", request.PackageName)
+}
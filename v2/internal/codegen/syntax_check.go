@@ -0,0 +1,175 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SyntaxIssue describes a generated file that failed the syntax check
+type SyntaxIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SyntaxCheckError is returned when generated files fail the syntax check
+type SyntaxCheckError struct {
+	Issues []SyntaxIssue
+}
+
+// Error implements the error interface
+func (e *SyntaxCheckError) Error() string {
+	messages := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		messages = append(messages, fmt.Sprintf("%s: %s", issue.Path, issue.Message))
+	}
+	return fmt.Sprintf("generated code failed syntax check: %s", strings.Join(messages, "; "))
+}
+
+// syntaxCheckFunc checks the content of a generated file
+type syntaxCheckFunc func(path, content string) error
+
+// CheckSyntax runs a lightweight syntax check over generated files: Go
+// sources are parsed with go/parser, JSON files such as package.json are
+// decoded, XML files such as pom.xml are tokenized and Python sources are
+// compiled with py_compile when a python3 interpreter is available, as are
+// protobuf definitions with protoc. Files
+// without a checker are skipped. It returns a *SyntaxCheckError listing every
+// file that failed.
+func CheckSyntax(files []GeneratedFile) error {
+	var issues []SyntaxIssue
+	for _, file := range files {
+		check := syntaxCheckerFor(file.Path)
+		if check == nil {
+			continue
+		}
+		if err := check(file.Path, file.Content); err != nil {
+			issues = append(issues, SyntaxIssue{Path: file.Path, Message: err.Error()})
+		}
+	}
+
+	if len(issues) > 0 {
+		return &SyntaxCheckError{Issues: issues}
+	}
+	return nil
+}
+
+// syntaxCheckerFor returns the checker for a file, or nil if the file type
+// is not checked
+func syntaxCheckerFor(path string) syntaxCheckFunc {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return checkGoSyntax
+	case ".json":
+		return checkJSONSyntax
+	case ".xml":
+		return checkXMLSyntax
+	case ".py":
+		return checkPythonSyntax
+	case ".proto":
+		return checkProtoSyntax
+	default:
+		return nil
+	}
+}
+
+func checkGoSyntax(path, content string) error {
+	_, err := parser.ParseFile(token.NewFileSet(), path, content, parser.AllErrors)
+	return err
+}
+
+func checkJSONSyntax(path, content string) error {
+	var value interface{}
+	return json.Unmarshal([]byte(content), &value)
+}
+
+func checkXMLSyntax(path, content string) error {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkPythonSyntax compiles a Python source with py_compile. The check is
+// skipped when no python3 interpreter is installed.
+func checkPythonSyntax(path, content string) error {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "magic-flow-pycheck-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(source, []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(python, "-m", "py_compile", source)
+	cmd.Stderr = &stderr
+	// Keep the bytecode next to the temp source so it is removed with it
+	cmd.Env = append(os.Environ(), "PYTHONPYCACHEPREFIX="+dir)
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(strings.ReplaceAll(stderr.String(), source, path))
+		if message == "" {
+			message = err.Error()
+		}
+		return fmt.Errorf("%s", message)
+	}
+	return nil
+}
+
+// checkProtoSyntax compiles a protobuf definition with protoc. The check is
+// skipped when protoc is not installed.
+func checkProtoSyntax(path, content string) error {
+	protoc, err := exec.LookPath("protoc")
+	if err != nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "magic-flow-protocheck-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Keep the package directories so imports resolve as in the project
+	source := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(source), 0o700); err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	if err := os.WriteFile(source, []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(protoc, "-I", dir, "--descriptor_set_out="+os.DevNull, source)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(strings.ReplaceAll(stderr.String(), dir+string(filepath.Separator), ""))
+		if message == "" {
+			message = err.Error()
+		}
+		return fmt.Errorf("%s", message)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package codegen
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"testing"
+	"text/template"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func TestCheckSyntax(t *testing.T) {
+	valid := []GeneratedFile{
+		{Path: "client.go", Content: "package client\n\nfunc Run() error { return nil }\n"},
+		{Path: "package.json", Content: `{"name": "@acme/orders-client", "version": "1.0.0"}`},
+		{Path: "pom.xml", Content: `<?xml version="1.0"?><project><artifactId>orders</artifactId></project>`},
+		{Path: "README.md", Content: "# {{ unchecked"},
+	}
+	assert.NoError(t, CheckSyntax(valid))
+
+	broken := []struct {
+		name string
+		file GeneratedFile
+	}{
+		{"go", GeneratedFile{Path: "client.go", Content: "package client\n\nfunc Run() error { return nil\n"}},
+		{"json", GeneratedFile{Path: "package.json", Content: `{"name": "@acme/orders-client",}`}},
+		{"xml", GeneratedFile{Path: "pom.xml", Content: `<project><artifactId>orders</project>`}},
+	}
+	for _, tc := range broken {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckSyntax(append([]GeneratedFile{valid[0]}, tc.file))
+
+			var syntaxErr *SyntaxCheckError
+			require.True(t, errors.As(err, &syntaxErr))
+			require.Len(t, syntaxErr.Issues, 1)
+			assert.Equal(t, tc.file.Path, syntaxErr.Issues[0].Path)
+			assert.NotEmpty(t, syntaxErr.Issues[0].Message)
+		})
+	}
+
+	t.Run("python", func(t *testing.T) {
+		if _, err := exec.LookPath("python3"); err != nil {
+			t.Skip("python3 not available")
+		}
+
+		assert.NoError(t, CheckSyntax([]GeneratedFile{{Path: "client.py", Content: "def run():\n    return None\n"}}))
+
+		err := CheckSyntax([]GeneratedFile{{Path: "orders/client.py", Content: "def run(:\n    return None\n"}})
+		var syntaxErr *SyntaxCheckError
+		require.True(t, errors.As(err, &syntaxErr))
+		require.Len(t, syntaxErr.Issues, 1)
+		assert.Equal(t, "orders/client.py", syntaxErr.Issues[0].Path)
+		assert.Contains(t, syntaxErr.Issues[0].Message, "orders/client.py")
+	})
+}
+
+// templateHandler renders each file from a text/template, standing in for a
+// language handler with a template bug
+type templateHandler struct {
+	templates map[string]string
+}
+
+func (h *templateHandler) Generate(workflow *models.Workflow, request *GenerationRequest, templateData *TemplateData) ([]GeneratedFile, error) {
+	var files []GeneratedFile
+	for path, text := range h.templates {
+		tmpl, err := template.New(path).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, templateData); err != nil {
+			return nil, err
+		}
+		files = append(files, GeneratedFile{Path: path, Content: content.String(), Language: "go", Type: "client"})
+	}
+	return files, nil
+}
+
+func (h *templateHandler) ValidateRequest(request *GenerationRequest) error { return nil }
+
+func (h *templateHandler) PrepareTemplateData(workflow *models.Workflow, request *GenerationRequest) (*TemplateData, error) {
+	return &TemplateData{Workflow: workflow, PackageName: "orders", ClassName: "OrdersClient"}, nil
+}
+
+func (h *templateHandler) GetFileExtension() string { return ".go" }
+
+func (h *templateHandler) GetDefaultPackageName() string { return "orders" }
+
+func TestGenerateValidateOutput(t *testing.T) {
+	workflow := &models.Workflow{ID: uuid.New(), Name: "orders"}
+
+	generator := NewCodeGenerator()
+	// The closing brace of the struct is missing from the template
+	generator.languageHandlers[LanguageGo] = &templateHandler{templates: map[string]string{
+		"client.go": "package {{.PackageName}}\n\ntype {{.ClassName}} struct {\n\tbaseURL string\n",
+	}}
+
+	t.Run("broken template passes without the flag", func(t *testing.T) {
+		result, err := generator.Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageGo})
+		require.NoError(t, err)
+		assert.Equal(t, false, result.Metadata["syntax_checked"])
+	})
+
+	t.Run("broken template fails the check", func(t *testing.T) {
+		result, err := generator.Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageGo, ValidateOutput: true})
+		require.Error(t, err)
+		assert.Nil(t, result)
+
+		var syntaxErr *SyntaxCheckError
+		require.True(t, errors.As(err, &syntaxErr))
+		require.Len(t, syntaxErr.Issues, 1)
+		assert.Equal(t, "client.go", syntaxErr.Issues[0].Path)
+		assert.Contains(t, err.Error(), "client.go")
+	})
+
+	t.Run("valid output passes the check", func(t *testing.T) {
+		result, err := NewCodeGenerator().Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageTypeScript, ValidateOutput: true})
+		require.NoError(t, err)
+		assert.Equal(t, true, result.Metadata["syntax_checked"])
+	})
+}
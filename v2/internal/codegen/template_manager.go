@@ -30,7 +30,7 @@ func NewTemplateManager() *TemplateManager {
 // loadEmbeddedTemplates loads templates from embedded filesystem
 func (tm *TemplateManager) loadEmbeddedTemplates() {
 	// Define template structure
-	languages := []string{"go", "typescript", "python", "java"}
+	languages := []string{"go", "typescript", "python", "java", "kotlin", "swift", "ruby"}
 	templateTypes := []string{"client", "models", "types", "test"}
 	
 	for _, lang := range languages {
@@ -86,6 +86,33 @@ func (tm *TemplateManager) loadAdditionalTemplates() {
 	tm.templates["java"]["models"] = javaModelsTemplate
 	tm.templates["java"]["types"] = javaTypesTemplate
 	tm.templates["java"]["test"] = javaTestTemplate
+	
+	// Kotlin-specific templates
+	if tm.templates["kotlin"] == nil {
+		tm.templates["kotlin"] = make(map[string]string)
+	}
+	tm.templates["kotlin"]["client"] = kotlinClientTemplate
+	tm.templates["kotlin"]["models"] = kotlinModelsTemplate
+	tm.templates["kotlin"]["types"] = kotlinTypesTemplate
+	tm.templates["kotlin"]["test"] = kotlinTestTemplate
+	
+	// Swift-specific templates
+	if tm.templates["swift"] == nil {
+		tm.templates["swift"] = make(map[string]string)
+	}
+	tm.templates["swift"]["client"] = swiftClientTemplate
+	tm.templates["swift"]["models"] = swiftModelsTemplate
+	tm.templates["swift"]["types"] = swiftTypesTemplate
+	tm.templates["swift"]["test"] = swiftTestTemplate
+	
+	// Ruby-specific templates
+	if tm.templates["ruby"] == nil {
+		tm.templates["ruby"] = make(map[string]string)
+	}
+	tm.templates["ruby"]["client"] = rubyClientTemplate
+	tm.templates["ruby"]["models"] = rubyModelsTemplate
+	tm.templates["ruby"]["types"] = rubyTypesTemplate
+	tm.templates["ruby"]["test"] = rubyTestTemplate
 }
 
 // GetTemplate retrieves a template by language and name
@@ -160,19 +187,88 @@ package {{.PackageName}}
 import (
 	"bytes"
 	"context"
+	"encoding"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"reflect"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ugorji/go/codec"
 )
 
+// CorrelationIDHeader is the header carrying the correlation ID shared by
+// every execution of one business transaction
+const CorrelationIDHeader = "X-Correlation-ID"
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context whose requests carry a correlation ID.
+// Executions started with it share the ID, which the server otherwise
+// generates.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by a context
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
+// Codec is the encoding of execution requests and responses
+type Codec string
+
+const (
+	// CodecJSON encodes executions as JSON, the default
+	CodecJSON Codec = "json"
+	// CodecMsgPack encodes executions as MessagePack, which is smaller and
+	// cheaper to parse
+	CodecMsgPack Codec = "msgpack"
+)
+
+const mimeMsgPack = "application/msgpack"
+
+// msgpackHandle encodes MessagePack documents like JSON ones: field names
+// come from json tags, and times and UUIDs are strings
+var msgpackHandle = func() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{}
+	handle.TypeInfos = codec.NewTypeInfos([]string{"json"})
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.RawToString = true
+	handle.TimeNotBuiltin = true
+	if err := handle.SetBytesExt(reflect.TypeOf(time.Time{}), 1, textExt{}); err != nil {
+		panic(err)
+	}
+	if err := handle.SetBytesExt(reflect.TypeOf(uuid.UUID{}), 2, textExt{}); err != nil {
+		panic(err)
+	}
+	return handle
+}()
+
+// textExt encodes values as their text, which is written as a string
+type textExt struct{}
+
+func (textExt) WriteExt(v interface{}) []byte {
+	text, _ := v.(encoding.TextMarshaler).MarshalText()
+	return text
+}
+
+func (textExt) ReadExt(dst interface{}, src []byte) {
+	if err := dst.(encoding.TextUnmarshaler).UnmarshalText(src); err != nil {
+		panic(err)
+	}
+}
+
 // {{.ClassName}} represents a client for the {{.Workflow.Name}} workflow
 type {{.ClassName}} struct {
 	baseURL    string
 	httpClient *http.Client
 	apiKey     string
+	codec      Codec
 }
 
 // New{{.ClassName}} creates a new workflow client
@@ -183,9 +279,42 @@ func New{{.ClassName}}(baseURL, apiKey string) *{{.ClassName}} {
 			Timeout: 30 * time.Second,
 		},
 		apiKey: apiKey,
+		codec:  CodecJSON,
 	}
 }
 
+// SetCodec sets the encoding of execution requests and responses. Responses
+// are gzip compressed and decompressed transparently either way.
+func (c *{{.ClassName}}) SetCodec(codec Codec) {
+	c.codec = codec
+}
+
+// encode encodes a request body with the codec of the client, returning its
+// content type
+func (c *{{.ClassName}}) encode(v interface{}) ([]byte, string, error) {
+	if c.codec != CodecMsgPack {
+		data, err := json.Marshal(v)
+		return data, "application/json", err
+	}
+	var data []byte
+	err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(v)
+	return data, mimeMsgPack, err
+}
+
+// decode decodes a response body in its content type, which is JSON on the
+// endpoints without MessagePack support
+func decode(resp *http.Response, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == mimeMsgPack {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
 // ExecuteWorkflow executes the {{.Workflow.Name}} workflow
 func (c *{{.ClassName}}) ExecuteWorkflow(ctx context.Context, input map[string]interface{}) (*ExecutionResult, error) {
 	payload := map[string]interface{}{
@@ -193,18 +322,22 @@ func (c *{{.ClassName}}) ExecuteWorkflow(ctx context.Context, input map[string]i
 		"input":       input,
 	}
 
-	jsonData, err := json.Marshal(payload)
+	body, contentType, err := c.encode(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v2/executions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v2/executions", bytes.NewBuffer(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		req.Header.Set(CorrelationIDHeader, correlationID)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -217,13 +350,56 @@ func (c *{{.ClassName}}) ExecuteWorkflow(ctx context.Context, input map[string]i
 	}
 
 	var result ExecutionResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := decode(resp, &result); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	return &result, nil
 }
 
+// Preflight runs the admission checks of an execution of the
+// {{.Workflow.Name}} workflow without starting it, reporting whether it would
+// start, queue or be rejected
+func (c *{{.ClassName}}) Preflight(ctx context.Context, input map[string]interface{}, options PreflightOptions) (*PreflightReport, error) {
+	payload := map[string]interface{}{
+		"input":   input,
+		"options": options,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v1/workflows/{{.Workflow.ID}}/preflight", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		req.Header.Set(CorrelationIDHeader, correlationID)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed with status: %d", resp.StatusCode)
+	}
+
+	var report PreflightReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &report, nil
+}
+
 {{range .Methods}}
 // {{.Name}} executes the {{.Description}} step
 func (c *{{$.ClassName}}) {{.Name}}(ctx context.Context{{range .Parameters}}, {{.Name}} {{.Type}}{{end}}) ({{.ReturnType}}, error) {
@@ -249,6 +425,9 @@ func (c *{{.ClassName}}) GetExecutionStatus(ctx context.Context, executionID uui
 	}
 
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		req.Header.Set(CorrelationIDHeader, correlationID)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -282,14 +461,15 @@ import (
 
 // ExecutionResult represents the result of a workflow execution
 type ExecutionResult struct {
-	ID          uuid.UUID              ` + "`json:\"id\"`" + `
-	WorkflowID  uuid.UUID              ` + "`json:\"workflow_id\"`" + `
-	Status      string                 ` + "`json:\"status\"`" + `
-	Output      map[string]interface{} ` + "`json:\"output\"`" + `
-	Error       string                 ` + "`json:\"error,omitempty\"`" + `
-	StartedAt   time.Time              ` + "`json:\"started_at\"`" + `
-	CompletedAt *time.Time             ` + "`json:\"completed_at,omitempty\"`" + `
-	Duration    *time.Duration         ` + "`json:\"duration,omitempty\"`" + `
+	ID            uuid.UUID              ` + "`json:\"id\"`" + `
+	WorkflowID    uuid.UUID              ` + "`json:\"workflow_id\"`" + `
+	CorrelationID string                 ` + "`json:\"correlation_id\"`" + `
+	Status        string                 ` + "`json:\"status\"`" + `
+	Output        map[string]interface{} ` + "`json:\"output\"`" + `
+	Error         string                 ` + "`json:\"error,omitempty\"`" + `
+	StartedAt     time.Time              ` + "`json:\"started_at\"`" + `
+	CompletedAt   *time.Time             ` + "`json:\"completed_at,omitempty\"`" + `
+	DurationMs    *int64                 ` + "`json:\"duration,omitempty\"`" + `
 }
 
 // ExecutionStatus represents the status of a workflow execution
@@ -311,6 +491,34 @@ type StepStatus struct {
 	Error    string    ` + "`json:\"error,omitempty\"`" + `
 }
 
+// PreflightOptions are the execution options a pre-flight check considers
+type PreflightOptions struct {
+	// VersionID pins the execution to a workflow version
+	VersionID *uuid.UUID ` + "`json:\"version_id,omitempty\"`" + `
+}
+
+// PreflightReport reports whether an execution would start right away
+// (verdict "ok"), wait for running executions ("would_queue") or be rejected
+// ("would_reject")
+type PreflightReport struct {
+	WorkflowID         uuid.UUID        ` + "`json:\"workflow_id\"`" + `
+	Verdict            string           ` + "`json:\"verdict\"`" + `
+	Checks             []PreflightCheck ` + "`json:\"checks\"`" + `
+	QueueDepth         int              ` + "`json:\"queue_depth\"`" + `
+	EstimatedQueueWait time.Duration    ` + "`json:\"estimated_queue_wait\"`" + `
+	Version            string           ` + "`json:\"version\"`" + `
+	VersionID          *uuid.UUID       ` + "`json:\"version_id,omitempty\"`" + `
+	CheckedAt          time.Time        ` + "`json:\"checked_at\"`" + `
+}
+
+// PreflightCheck is the outcome of one admission check: passed, queued,
+// rejected or skipped
+type PreflightCheck struct {
+	Name   string ` + "`json:\"name\"`" + `
+	Status string ` + "`json:\"status\"`" + `
+	Reason string ` + "`json:\"reason,omitempty\"`" + `
+}
+
 {{range .Models}}
 // {{.Name}} represents {{.Description}}
 type {{.Name}} struct {
@@ -327,8 +535,9 @@ package {{.PackageName}}
 
 // Workflow constants
 const (
-	WorkflowID   = "{{.Workflow.ID}}"
-	WorkflowName = "{{.Workflow.Name}}"
+	WorkflowID      = "{{.Workflow.ID}}"
+	WorkflowName    = "{{.Workflow.Name}}"
+	WorkflowVersion = "{{.Workflow.Version}}"
 )
 
 // Step constants
@@ -367,9 +576,7 @@ func Test{{.ClassName}}_ExecuteWorkflow(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	
-	input := map[string]interface{}{
-		"test": "value",
-	}
+	input := {{goLiteral .ExampleInput "\t"}}
 	
 	result, err := client.ExecuteWorkflow(ctx, input)
 	require.NoError(t, err)
@@ -402,21 +609,29 @@ const typeScriptClientTemplate = `// Code generated by Magic Flow v2. DO NOT EDI
 
 import { ExecutionResult, ExecutionStatus } from './types';
 
+const MIME_JSON = 'application/json';
+const MIME_MSGPACK = 'application/msgpack';
+
 export interface {{.ClassName}}Config {
   baseURL: string;
   apiKey: string;
   timeout?: number;
+  // codec is the encoding of executions. msgpack is smaller and cheaper to
+  // parse, and requires the optional @msgpack/msgpack dependency.
+  codec?: 'json' | 'msgpack';
 }
 
 export class {{.ClassName}} {
   private baseURL: string;
   private apiKey: string;
   private timeout: number;
+  private codec: 'json' | 'msgpack';
 
   constructor(config: {{.ClassName}}Config) {
     this.baseURL = config.baseURL;
     this.apiKey = config.apiKey;
     this.timeout = config.timeout || 30000;
+    this.codec = config.codec || 'json';
   }
 
   async executeWorkflow(input: Record<string, any>): Promise<ExecutionResult> {
@@ -425,20 +640,40 @@ export class {{.ClassName}} {
       input
     };
 
+    const contentType = this.codec === 'msgpack' ? MIME_MSGPACK : MIME_JSON;
     const response = await fetch(\`\${this.baseURL}/api/v2/executions\`, {
       method: 'POST',
       headers: {
-        'Content-Type': 'application/json',
+        'Content-Type': contentType,
+        'Accept': contentType,
         'Authorization': \`Bearer \${this.apiKey}\`
       },
-      body: JSON.stringify(payload)
+      body: await this.encode(payload)
     });
 
     if (!response.ok) {
       throw new Error(\`Request failed with status: \${response.status}\`);
     }
 
-    return response.json();
+    return this.decode<ExecutionResult>(response);
+  }
+
+  private async encode(payload: unknown): Promise<BodyInit> {
+    if (this.codec !== 'msgpack') {
+      return JSON.stringify(payload);
+    }
+    const { encode } = await import('@msgpack/msgpack');
+    return encode(payload);
+  }
+
+  // decode decodes a response in its content type, which is JSON on the
+  // endpoints without MessagePack support
+  private async decode<T>(response: Response): Promise<T> {
+    if (!(response.headers.get('Content-Type') || '').startsWith(MIME_MSGPACK)) {
+      return response.json();
+    }
+    const { decode } = await import('@msgpack/msgpack');
+    return decode(new Uint8Array(await response.arrayBuffer())) as T;
   }
 
 {{range .Methods}}
@@ -480,6 +715,7 @@ export interface ExecutionResult {
   error?: string;
   started_at: string;
   completed_at?: string;
+  /** Duration in milliseconds */
   duration?: number;
 }
 
@@ -513,6 +749,7 @@ const typeScriptTypesTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT
 
 export const WORKFLOW_ID = '{{.Workflow.ID}}';
 export const WORKFLOW_NAME = '{{.Workflow.Name}}';
+export const WORKFLOW_VERSION = '{{.Workflow.Version}}';
 
 export const STEPS = {
   {{range .Workflow.Definition.Steps}}{{.ID | upper}}: '{{.ID}}',
@@ -547,7 +784,7 @@ describe('{{.ClassName}}', () => {
   });
 
   it('should execute workflow', async () => {
-    const input = { test: 'value' };
+    const input = {{tsLiteral .ExampleInput "    "}};
     const result = await client.executeWorkflow(input);
     
     expect(result).toBeDefined();
@@ -576,13 +813,22 @@ import requests
 from typing import Dict, Any, Optional
 from .types import ExecutionResult, ExecutionStatus
 
+MIME_MSGPACK = 'application/msgpack'
+
 class {{.ClassName}}:
-    """Client for the {{.Workflow.Name}} workflow"""
+    """Client for the {{.Workflow.Name}} workflow
+
+    codec is the encoding of executions, 'json' or 'msgpack'. msgpack is
+    smaller and cheaper to parse, and requires the msgpack extra.
+    """
     
-    def __init__(self, base_url: str, api_key: str, timeout: int = 30):
+    def __init__(self, base_url: str, api_key: str, timeout: int = 30, codec: str = 'json'):
+        if codec not in ('json', 'msgpack'):
+            raise ValueError(f'unsupported codec: {codec}')
         self.base_url = base_url
         self.api_key = api_key
         self.timeout = timeout
+        self.codec = codec
         self.session = requests.Session()
         self.session.headers.update({
             'Authorization': f'Bearer {api_key}',
@@ -596,17 +842,34 @@ class {{.ClassName}}:
             'input': input_data
         }
         
-        response = self.session.post(
-            f'{self.base_url}/api/v2/executions',
-            json=payload,
-            timeout=self.timeout
-        )
+        if self.codec == 'msgpack':
+            import msgpack
+            response = self.session.post(
+                f'{self.base_url}/api/v2/executions',
+                data=msgpack.packb(payload),
+                headers={'Content-Type': MIME_MSGPACK, 'Accept': MIME_MSGPACK},
+                timeout=self.timeout
+            )
+        else:
+            response = self.session.post(
+                f'{self.base_url}/api/v2/executions',
+                json=payload,
+                timeout=self.timeout
+            )
         response.raise_for_status()
         
-        return ExecutionResult(**response.json())
+        return ExecutionResult(**self._decode(response))
+    
+    def _decode(self, response: requests.Response) -> Dict[str, Any]:
+        """Decode a response in its content type, which is JSON on the
+        endpoints without MessagePack support"""
+        if response.headers.get('Content-Type', '').startswith(MIME_MSGPACK):
+            import msgpack
+            return msgpack.unpackb(response.content)
+        return response.json()
     
 {{range .Methods}}
-    def {{.Name | toSnakeCase}}(self{{range .Parameters}}, {{.Name | toSnakeCase}}: {{.Type}}{{end}}) -> Any:
+    def {{.Name}}(self{{range .Parameters}}, {{.Name | toSnakeCase}}: {{.Type}}{{end}}) -> Any:
         """Execute the {{.Description}} step"""
         input_data = {
             {{range .Parameters}}'{{.Name}}': {{.Name | toSnakeCase}},
@@ -644,7 +907,7 @@ class ExecutionResult:
     started_at: datetime
     error: Optional[str] = None
     completed_at: Optional[datetime] = None
-    duration: Optional[float] = None
+    duration: Optional[int] = None  # milliseconds
 
 @dataclass
 class StepStatus:
@@ -667,7 +930,7 @@ class ExecutionStatus:
 @dataclass
 class {{.Name}}:
     """{{.Description}}"""
-    {{range .Fields}}{{.Name | toSnakeCase}}: {{.Type}}
+    {{range .Fields}}{{.Name}}: {{.Type}}
     {{end}}
 {{end}}
 `
@@ -677,6 +940,7 @@ const pythonTypesTemplate = `# Code generated by Magic Flow v2. DO NOT EDIT.
 
 WORKFLOW_ID = '{{.Workflow.ID}}'
 WORKFLOW_NAME = '{{.Workflow.Name}}'
+WORKFLOW_VERSION = '{{.Workflow.Version}}'
 
 class Steps:
     {{range .Workflow.Definition.Steps}}{{.ID | upper}} = '{{.ID}}'
@@ -705,7 +969,7 @@ class Test{{.ClassName}}:
         )
     
     def test_execute_workflow(self):
-        input_data = {'test': 'value'}
+        input_data = {{pyLiteral .ExampleInput "        "}}
         result = self.client.execute_workflow(input_data)
         
         assert result is not None
@@ -717,7 +981,7 @@ class Test{{.ClassName}}:
         {{range .Parameters}}{{.Name | toSnakeCase}} = {{if eq .Type "str"}}'test-value'{{else if eq .Type "int"}}123{{else if eq .Type "bool"}}True{{else}}None{{end}}
         {{end}}
         
-        result = self.client.{{.Name | toSnakeCase}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Name | toSnakeCase}}{{end}})
+        result = self.client.{{.Name}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Name | toSnakeCase}}{{end}})
         assert result is not None
     
 {{end}}
@@ -777,7 +1041,7 @@ public class {{.ClassName}} {
     }
     
 {{range .Methods}}
-    public Object {{.Name | toCamelCase}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Type}} {{$param.Name | toCamelCase}}{{end}}) throws Exception {
+    public Object {{.Name}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Type}} {{$param.Name | toCamelCase}}{{end}}) throws Exception {
         Map<String, Object> input = Map.of(
             {{range $i, $param := .Parameters}}{{if $i}}, {{end}}"{{$param.Name}}", {{$param.Name | toCamelCase}}{{end}}
         );
@@ -941,12 +1205,12 @@ public class StepStatus {
 {{range .Models}}
 public class {{.Name}} {
     {{range .Fields}}@JsonProperty("{{.Name | toSnakeCase}}")
-    private {{.Type}} {{.Name | toCamelCase}};
+    private {{.Type}} {{.Name}};
     
     {{end}}
     
-    {{range .Fields}}public {{.Type}} get{{.Name | toPascalCase}}() { return {{.Name | toCamelCase}}; }
-    public void set{{.Name | toPascalCase}}({{.Type}} {{.Name | toCamelCase}}) { this.{{.Name | toCamelCase}} = {{.Name | toCamelCase}}; }
+    {{range .Fields}}public {{.Type}} get{{.Name | toPascalCase}}() { return {{.Name}}; }
+    public void set{{.Name | toPascalCase}}({{.Type}} {{.Name}}) { this.{{.Name}} = {{.Name}}; }
     
     {{end}}
 }
@@ -961,6 +1225,7 @@ package {{.PackageName}};
 public final class Constants {
     public static final String WORKFLOW_ID = "{{.Workflow.ID}}";
     public static final String WORKFLOW_NAME = "{{.Workflow.Name}}";
+    public static final String WORKFLOW_VERSION = "{{.Workflow.Version}}";
     
     public static final class Steps {
         {{range .Workflow.Definition.Steps}}public static final String {{.ID | upper}} = "{{.ID}}";
@@ -989,6 +1254,7 @@ package {{.PackageName}};
 import org.junit.jupiter.api.BeforeEach;
 import org.junit.jupiter.api.Test;
 import static org.junit.jupiter.api.Assertions.*;
+import java.util.List;
 import java.util.Map;
 
 public class {{.ClassName}}Test {
@@ -1001,7 +1267,7 @@ public class {{.ClassName}}Test {
     
     @Test
     public void testExecuteWorkflow() throws Exception {
-        Map<String, Object> input = Map.of("test", "value");
+        Map<String, Object> input = {{javaLiteral .ExampleInput "        "}};
         ExecutionResult result = client.executeWorkflow(input);
         
         assertNotNull(result);
@@ -1015,10 +1281,1190 @@ public class {{.ClassName}}Test {
         {{range .Parameters}}{{.Type}} {{.Name | toCamelCase}} = {{if eq .Type "String"}}"test-value"{{else if eq .Type "int"}}123{{else if eq .Type "boolean"}}true{{else}}null{{end}};
         {{end}}
         
-        Object result = client.{{.Name | toCamelCase}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Name | toCamelCase}}{{end}});
+        Object result = client.{{.Name}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Name | toCamelCase}}{{end}});
         assertNotNull(result);
     }
     
 {{end}}
 }
-`
\ No newline at end of file
+`
+
+const kotlinClientTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+package {{.PackageName}}
+
+import com.fasterxml.jackson.databind.DeserializationFeature
+import com.fasterxml.jackson.module.kotlin.convertValue
+import com.fasterxml.jackson.module.kotlin.jacksonObjectMapper
+import com.fasterxml.jackson.module.kotlin.readValue
+import {{.PackageName}}.config.ClientConfig
+import {{.PackageName}}.exceptions.ApiException
+import {{.PackageName}}.exceptions.AuthenticationException
+import {{.PackageName}}.exceptions.ExecutionException
+import {{.PackageName}}.exceptions.NetworkException
+import {{.PackageName}}.exceptions.TimeoutException
+import {{.PackageName}}.exceptions.ValidationException
+import {{.PackageName}}.models.*
+import java.io.IOException
+import java.io.InterruptedIOException
+import java.util.concurrent.TimeUnit
+import kotlin.coroutines.resume
+import kotlin.coroutines.resumeWithException
+import kotlin.time.Duration
+import kotlin.time.Duration.Companion.minutes
+import kotlin.time.Duration.Companion.seconds
+import kotlinx.coroutines.TimeoutCancellationException
+import kotlinx.coroutines.delay
+import kotlinx.coroutines.suspendCancellableCoroutine
+import kotlinx.coroutines.withTimeout
+import okhttp3.Call
+import okhttp3.Callback
+import okhttp3.MediaType.Companion.toMediaType
+import okhttp3.OkHttpClient
+import okhttp3.Request
+import okhttp3.RequestBody.Companion.toRequestBody
+import okhttp3.Response
+
+/**
+ * Client for the {{.Workflow.Name}} workflow.
+ *
+ * Every call is a suspend function backed by an asynchronous OkHttp call;
+ * cancelling the calling coroutine cancels the HTTP request.
+ */
+class {{.ClassName}}(
+    private val config: ClientConfig = ClientConfig(),
+    httpClient: OkHttpClient? = null,
+) {
+    constructor(baseUrl: String, apiKey: String) : this(ClientConfig(baseUrl = baseUrl, apiKey = apiKey))
+
+    private val httpClient: OkHttpClient = httpClient ?: OkHttpClient.Builder()
+        .callTimeout(config.timeout.inWholeMilliseconds, TimeUnit.MILLISECONDS)
+        .build()
+
+    private val mapper = jacksonObjectMapper()
+        .findAndRegisterModules()
+        .configure(DeserializationFeature.FAIL_ON_UNKNOWN_PROPERTIES, false)
+
+    /** Executes the {{.Workflow.Name}} workflow */
+    suspend fun executeWorkflow(input: Map<String, Any?>): ExecutionResult {
+        val payload = mapOf("workflow_id" to Constants.WORKFLOW_ID, "input" to input)
+        val body = mapper.writeValueAsString(payload).toRequestBody(JSON)
+        return mapper.readValue(send(request("/api/v2/executions").post(body).build()))
+    }
+{{if .InputModel}}
+    /** Executes the {{.Workflow.Name}} workflow with a typed input */
+    suspend fun executeWorkflow(input: {{.InputModel}}): ExecutionResult =
+        executeWorkflow(mapper.convertValue<Map<String, Any?>>(input))
+{{end}}
+{{- range .Methods}}
+    /** Executes the workflow for the {{.Description}} step */
+    suspend fun {{.Name | kotlinName}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Name | kotlinName}}: {{$param.Type}}{{end}}): {{.ReturnType}} {
+        val input = mapOf<String, Any?>(
+            {{- range .Parameters}}
+            "{{.Name}}" to {{.Name | kotlinName}},
+            {{- end}}
+        )
+        return executeWorkflow(input).output
+    }
+{{end}}
+    /** Returns the status of an execution */
+    suspend fun getExecutionStatus(executionId: String): ExecutionStatus =
+        mapper.readValue(send(request("/api/v2/executions/$executionId/status").get().build()))
+
+    /** Returns an execution with its output once it has completed */
+    suspend fun getExecutionResult(executionId: String): ExecutionResult =
+        mapper.readValue(send(request("/api/v2/executions/$executionId").get().build()))
+
+    /** Cancels a running execution */
+    suspend fun cancelExecution(executionId: String) {
+        send(request("/api/v2/executions/$executionId/cancel").post(ByteArray(0).toRequestBody(JSON)).build())
+    }
+
+    /**
+     * Polls an execution until it completes and returns its result. A failed
+     * or cancelled execution throws an [ExecutionException].
+     */
+    suspend fun waitForCompletion(
+        executionId: String,
+        timeout: Duration = 5.minutes,
+        pollInterval: Duration = 1.seconds,
+    ): ExecutionResult {
+        try {
+            withTimeout(timeout) {
+                while (true) {
+                    val status = getExecutionStatus(executionId)
+                    when (status.status) {
+                        Constants.Status.COMPLETED -> return@withTimeout
+                        Constants.Status.FAILED, Constants.Status.CANCELLED ->
+                            throw ExecutionException("Execution ${status.status}: ${status.message.orEmpty()}", executionId, status.currentStep)
+                    }
+                    delay(pollInterval)
+                }
+            }
+        } catch (e: TimeoutCancellationException) {
+            throw TimeoutException("Execution $executionId did not complete within $timeout", e)
+        }
+        return getExecutionResult(executionId)
+    }
+
+    private fun request(path: String): Request.Builder =
+        Request.Builder()
+            .url(config.baseUrl.trimEnd('/') + path)
+            .header("Authorization", "Bearer ${config.apiKey}")
+            .header("Accept", "application/json")
+
+    /** Sends a request, retrying network failures, and returns the response body */
+    private suspend fun send(request: Request): String {
+        var attempt = 0
+        while (true) {
+            try {
+                return call(request)
+            } catch (e: NetworkException) {
+                if (++attempt > config.retryAttempts) throw e
+                delay(config.retryDelay)
+            }
+        }
+    }
+
+    private suspend fun call(request: Request): String = suspendCancellableCoroutine { continuation ->
+        val call = httpClient.newCall(request)
+        continuation.invokeOnCancellation { call.cancel() }
+        call.enqueue(object : Callback {
+            override fun onFailure(call: Call, e: IOException) {
+                val error = if (e is InterruptedIOException) {
+                    TimeoutException("Request timed out: ${e.message}", e)
+                } else {
+                    NetworkException("Network error: ${e.message}", e)
+                }
+                continuation.resumeWithException(error)
+            }
+
+            override fun onResponse(call: Call, response: Response) {
+                response.use {
+                    val body = try {
+                        it.body?.string().orEmpty()
+                    } catch (e: IOException) {
+                        onFailure(call, e)
+                        return
+                    }
+                    when {
+                        it.isSuccessful -> continuation.resume(body)
+                        else -> continuation.resumeWithException(errorFor(it.code, body))
+                    }
+                }
+            }
+        })
+    }
+
+    private fun errorFor(statusCode: Int, body: String) = when (statusCode) {
+        401, 403 -> AuthenticationException("Authentication failed with status $statusCode")
+        400, 422 -> ValidationException("Invalid request: $body")
+        else -> ApiException("Request failed with status $statusCode", statusCode, body)
+    }
+
+    private companion object {
+        val JSON = "application/json".toMediaType()
+    }
+}
+`
+
+const kotlinModelsTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+package {{.PackageName}}.models
+
+import com.fasterxml.jackson.annotation.JsonProperty
+import java.time.Instant
+
+/** The result of a workflow execution */
+data class ExecutionResult(
+    val id: String,
+    @JsonProperty("workflow_id") val workflowId: String,
+    val status: String,
+    val input: Map<String, Any?>? = null,
+    val output: Map<String, Any?>? = null,
+    val error: String? = null,
+    @JsonProperty("started_at") val startedAt: Instant? = null,
+    @JsonProperty("completed_at") val completedAt: Instant? = null,
+    val duration: Long? = null,
+)
+
+/** The status of a workflow execution */
+data class ExecutionStatus(
+    val id: String,
+    val status: String,
+    val progress: Double = 0.0,
+    val message: String? = null,
+    @JsonProperty("current_step") val currentStep: String? = null,
+    val steps: List<StepStatus> = emptyList(),
+)
+
+/** The status of a workflow step */
+data class StepStatus(
+    val id: String,
+    val name: String,
+    val status: String,
+    val error: String? = null,
+    @JsonProperty("started_at") val startedAt: Instant? = null,
+    @JsonProperty("completed_at") val completedAt: Instant? = null,
+)
+{{range .Models}}
+/**
+ * {{.Description}}
+{{- range .Fields}}{{if .Description}}
+ * @property {{.Name}} {{.Description}}{{end}}{{end}}
+ */
+data class {{.Name}}(
+{{- range .Fields}}
+    @JsonProperty("{{index .Tags "json"}}") val {{.Name | kotlinName}}: {{.Type}}{{if not .Required}}? = null{{end}},
+{{- end}}
+)
+{{end}}`
+
+const kotlinTypesTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+package {{.PackageName}}
+
+object Constants {
+    const val WORKFLOW_ID = "{{.Workflow.ID}}"
+    const val WORKFLOW_NAME = "{{.Workflow.Name}}"
+    const val WORKFLOW_VERSION = "{{.Workflow.Version}}"
+
+    object Steps {
+        {{range .Workflow.Definition.Steps}}const val {{.ID | upper}} = "{{.ID}}"
+        {{end}}
+    }
+
+    object Status {
+        const val PENDING = "pending"
+        const val RUNNING = "running"
+        const val COMPLETED = "completed"
+        const val FAILED = "failed"
+        const val CANCELLED = "cancelled"
+    }
+}
+`
+
+const kotlinTestTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+package {{.PackageName}}
+
+import {{.PackageName}}.config.ClientConfig
+import {{.PackageName}}.exceptions.AuthenticationException
+import kotlin.test.AfterTest
+import kotlin.test.BeforeTest
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlinx.coroutines.test.runTest
+import okhttp3.mockwebserver.MockResponse
+import okhttp3.mockwebserver.MockWebServer
+
+class {{.ClassName}}Test {
+    private lateinit var server: MockWebServer
+    private lateinit var client: {{.ClassName}}
+
+    @BeforeTest
+    fun setUp() {
+        server = MockWebServer()
+        server.start()
+        client = {{.ClassName}}(ClientConfig(baseUrl = server.url("/").toString(), apiKey = "test-api-key", retryAttempts = 0))
+    }
+
+    @AfterTest
+    fun tearDown() {
+        server.shutdown()
+    }
+
+    @Test
+    fun executeWorkflow() = runTest {
+        server.enqueue(MockResponse().setBody("""{"id": "execution-1", "workflow_id": "${Constants.WORKFLOW_ID}", "status": "running"}"""))
+
+        val input = {{kotlinLiteral .ExampleInput "        "}}
+        val result = client.executeWorkflow(input)
+
+        assertEquals(Constants.WORKFLOW_ID, result.workflowId)
+        assertEquals("Bearer test-api-key", server.takeRequest().getHeader("Authorization"))
+    }
+
+    @Test
+    fun authenticationFailure() = runTest {
+        server.enqueue(MockResponse().setResponseCode(401))
+
+        assertFailsWith<AuthenticationException> {
+            client.executeWorkflow(emptyMap())
+        }
+    }
+}
+`
+
+const swiftClientTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+import Foundation
+#if canImport(FoundationNetworking)
+import FoundationNetworking
+#endif
+
+/// Client for the {{.Workflow.Name}} workflow.
+///
+/// Every call is an async function backed by URLSession; cancelling the
+/// calling task cancels the HTTP request.
+public final class {{.ClassName}} {
+    private let config: ClientConfig
+    private let session: URLSession
+    private let encoder = JSONEncoder()
+    private let decoder: JSONDecoder
+
+    public init(config: ClientConfig = ClientConfig(), session: URLSession? = nil) {
+        self.config = config
+        if let session = session {
+            self.session = session
+        } else {
+            let configuration = URLSessionConfiguration.default
+            configuration.timeoutIntervalForRequest = config.timeout
+            self.session = URLSession(configuration: configuration)
+        }
+        decoder = JSONDecoder()
+        decoder.dateDecodingStrategy = .custom(Self.decodeDate)
+    }
+
+    public convenience init(baseURL: URL, apiKey: String) {
+        self.init(config: ClientConfig(baseURL: baseURL, apiKey: apiKey))
+    }
+
+    /// Executes the {{.Workflow.Name}} workflow
+    public func executeWorkflow(input: [String: JSONValue]) async throws -> ExecutionResult {
+        try await execute(input)
+    }
+{{if .InputModel}}
+    /// Executes the {{.Workflow.Name}} workflow with a typed input
+    public func executeWorkflow(input: {{.InputModel}}) async throws -> ExecutionResult {
+        try await execute(input)
+    }
+{{end}}
+{{- range .Methods}}
+    /// Executes the workflow for the {{.Description}} step
+    public func {{.Name | swiftName}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Name | swiftName}}: {{$param.Type}}{{end}}) async throws -> {{.ReturnType}} {
+        {{- if .Parameters}}
+        let input: [String: JSONValue] = [
+            {{- range .Parameters}}
+            "{{.Name}}": try JSONValue(encoding: {{.Name | swiftName}}),
+            {{- end}}
+        ]
+        {{- else}}
+        let input: [String: JSONValue] = [:]
+        {{- end}}
+        return try await executeWorkflow(input: input).output
+    }
+{{end}}
+    /// Returns the status of an execution
+    public func getExecutionStatus(executionId: String) async throws -> ExecutionStatus {
+        try decode(ExecutionStatus.self, from: try await send("/api/v2/executions/\(executionId)/status", method: "GET"))
+    }
+
+    /// Returns an execution with its output once it has completed
+    public func getExecutionResult(executionId: String) async throws -> ExecutionResult {
+        try decode(ExecutionResult.self, from: try await send("/api/v2/executions/\(executionId)", method: "GET"))
+    }
+
+    /// Cancels a running execution
+    public func cancelExecution(executionId: String) async throws {
+        _ = try await send("/api/v2/executions/\(executionId)/cancel", method: "POST")
+    }
+
+    /// Polls an execution until it completes and returns its result. A failed
+    /// or cancelled execution throws ` + "`MagicFlowError.execution`" + `.
+    public func waitForCompletion(
+        executionId: String,
+        timeout: TimeInterval = 300,
+        pollInterval: TimeInterval = 1
+    ) async throws -> ExecutionResult {
+        let deadline = Date().addingTimeInterval(timeout)
+        while true {
+            let status = try await getExecutionStatus(executionId: executionId)
+            switch status.status {
+            case Constants.Status.completed:
+                return try await getExecutionResult(executionId: executionId)
+            case Constants.Status.failed, Constants.Status.cancelled:
+                throw MagicFlowError.execution(
+                    message: "Execution \(status.status): \(status.message ?? "")",
+                    executionId: executionId,
+                    stepId: status.currentStep
+                )
+            default:
+                break
+            }
+
+            if Date() >= deadline {
+                throw MagicFlowError.timeout("Execution \(executionId) did not complete within \(timeout) seconds")
+            }
+            try await Task.sleep(nanoseconds: UInt64(pollInterval * 1_000_000_000))
+        }
+    }
+
+    private func execute<Input: Encodable>(_ input: Input) async throws -> ExecutionResult {
+        let body = try encoder.encode(ExecutionRequest(workflowId: Constants.workflowId, input: input))
+        return try decode(ExecutionResult.self, from: try await send("/api/v2/executions", method: "POST", body: body))
+    }
+
+    /// Sends a request, retrying network failures, and returns the response body
+    private func send(_ path: String, method: String, body: Data? = nil) async throws -> Data {
+        var request = URLRequest(url: config.baseURL.appendingPathComponent(path))
+        request.httpMethod = method
+        request.httpBody = body
+        request.setValue("Bearer \(config.apiKey)", forHTTPHeaderField: "Authorization")
+        request.setValue("application/json", forHTTPHeaderField: "Accept")
+        if body != nil {
+            request.setValue("application/json", forHTTPHeaderField: "Content-Type")
+        }
+
+        var attempt = 0
+        while true {
+            do {
+                return try await perform(request)
+            } catch MagicFlowError.network where attempt < config.retryAttempts {
+                attempt += 1
+                try await Task.sleep(nanoseconds: UInt64(config.retryDelay * 1_000_000_000))
+            }
+        }
+    }
+
+    private func perform(_ request: URLRequest) async throws -> Data {
+        let result: (Data, URLResponse)
+        do {
+            result = try await session.data(for: request)
+        } catch let error as URLError where error.code == .timedOut {
+            throw MagicFlowError.timeout("Request timed out: \(error.localizedDescription)")
+        } catch let error as URLError where error.code == .cancelled {
+            throw CancellationError()
+        } catch let error as URLError {
+            throw MagicFlowError.network("Network error: \(error.localizedDescription)")
+        }
+
+        let (data, response) = result
+        guard let httpResponse = response as? HTTPURLResponse else {
+            throw MagicFlowError.network("Unexpected response")
+        }
+
+        let body = String(decoding: data, as: UTF8.self)
+        switch httpResponse.statusCode {
+        case 200..<300:
+            return data
+        case 401, 403:
+            throw MagicFlowError.authentication("Authentication failed with status \(httpResponse.statusCode)")
+        case 400, 422:
+            throw MagicFlowError.validation("Invalid request: \(body)")
+        default:
+            throw MagicFlowError.api(statusCode: httpResponse.statusCode, message: "Request failed", body: body)
+        }
+    }
+
+    private func decode<T: Decodable>(_ type: T.Type, from data: Data) throws -> T {
+        do {
+            return try decoder.decode(type, from: data)
+        } catch {
+            throw MagicFlowError.decoding("Failed to decode \(T.self): \(error)")
+        }
+    }
+
+    /// Decodes RFC 3339 timestamps with or without fractional seconds
+    private static func decodeDate(_ decoder: Decoder) throws -> Date {
+        let container = try decoder.singleValueContainer()
+        let value = try container.decode(String.self)
+
+        let formatter = ISO8601DateFormatter()
+        formatter.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
+        if let date = formatter.date(from: value) {
+            return date
+        }
+        formatter.formatOptions = [.withInternetDateTime]
+        if let date = formatter.date(from: value) {
+            return date
+        }
+        throw DecodingError.dataCorruptedError(in: container, debugDescription: "Invalid date: \(value)")
+    }
+}
+
+private struct ExecutionRequest<Input: Encodable>: Encodable {
+    let workflowId: String
+    let input: Input
+
+    enum CodingKeys: String, CodingKey {
+        case workflowId = "workflow_id"
+        case input
+    }
+}
+`
+
+const swiftModelsTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+import Foundation
+
+/// The result of a workflow execution
+public struct ExecutionResult: Codable, Equatable {
+    public let id: String
+    public let workflowId: String
+    public let status: String
+    public let input: [String: JSONValue]?
+    public let output: [String: JSONValue]?
+    public let error: String?
+    public let startedAt: Date?
+    public let completedAt: Date?
+    public let duration: Int?
+
+    enum CodingKeys: String, CodingKey {
+        case id
+        case workflowId = "workflow_id"
+        case status, input, output, error
+        case startedAt = "started_at"
+        case completedAt = "completed_at"
+        case duration
+    }
+}
+
+/// The status of a workflow execution
+public struct ExecutionStatus: Codable, Equatable {
+    public let id: String
+    public let status: String
+    public let progress: Double?
+    public let message: String?
+    public let currentStep: String?
+    public let steps: [StepStatus]?
+
+    enum CodingKeys: String, CodingKey {
+        case id, status, progress, message
+        case currentStep = "current_step"
+        case steps
+    }
+}
+
+/// The status of a workflow step
+public struct StepStatus: Codable, Equatable {
+    public let id: String
+    public let name: String
+    public let status: String
+    public let error: String?
+    public let startedAt: Date?
+    public let completedAt: Date?
+
+    enum CodingKeys: String, CodingKey {
+        case id, name, status, error
+        case startedAt = "started_at"
+        case completedAt = "completed_at"
+    }
+}
+
+/// A JSON value, used for workflow data without a fixed type. It can be
+/// written as a string, number, boolean, array, dictionary or nil literal.
+public enum JSONValue: Codable, Equatable {
+    case string(String)
+    case number(Double)
+    case bool(Bool)
+    case object([String: JSONValue])
+    case array([JSONValue])
+    case null
+
+    /// Converts an encodable value, such as a model, to a JSON value
+    public init<T: Encodable>(encoding value: T) throws {
+        let data = try JSONEncoder().encode(value)
+        self = try JSONDecoder().decode(JSONValue.self, from: data)
+    }
+
+    public init(from decoder: Decoder) throws {
+        let container = try decoder.singleValueContainer()
+        if container.decodeNil() {
+            self = .null
+        } else if let value = try? container.decode(Bool.self) {
+            self = .bool(value)
+        } else if let value = try? container.decode(Double.self) {
+            self = .number(value)
+        } else if let value = try? container.decode(String.self) {
+            self = .string(value)
+        } else if let value = try? container.decode([JSONValue].self) {
+            self = .array(value)
+        } else if let value = try? container.decode([String: JSONValue].self) {
+            self = .object(value)
+        } else {
+            throw DecodingError.dataCorruptedError(in: container, debugDescription: "Unsupported JSON value")
+        }
+    }
+
+    public func encode(to encoder: Encoder) throws {
+        var container = encoder.singleValueContainer()
+        switch self {
+        case .string(let value):
+            try container.encode(value)
+        case .number(let value):
+            try container.encode(value)
+        case .bool(let value):
+            try container.encode(value)
+        case .object(let value):
+            try container.encode(value)
+        case .array(let value):
+            try container.encode(value)
+        case .null:
+            try container.encodeNil()
+        }
+    }
+}
+
+extension JSONValue: ExpressibleByStringLiteral, ExpressibleByIntegerLiteral, ExpressibleByFloatLiteral,
+    ExpressibleByBooleanLiteral, ExpressibleByArrayLiteral, ExpressibleByDictionaryLiteral, ExpressibleByNilLiteral {
+    public init(stringLiteral value: String) { self = .string(value) }
+    public init(integerLiteral value: Int) { self = .number(Double(value)) }
+    public init(floatLiteral value: Double) { self = .number(value) }
+    public init(booleanLiteral value: Bool) { self = .bool(value) }
+    public init(arrayLiteral elements: JSONValue...) { self = .array(elements) }
+    public init(dictionaryLiteral elements: (String, JSONValue)...) {
+        self = .object(Dictionary(elements, uniquingKeysWith: { _, last in last }))
+    }
+    public init(nilLiteral: ()) { self = .null }
+}
+{{range .Models}}
+/// {{.Description}}
+public struct {{.Name}}: Codable, Equatable {
+{{- range .Fields}}
+{{- if .Description}}
+    /// {{.Description}}
+{{- end}}
+    public var {{.Name | swiftName}}: {{.Type}}{{if not .Required}}?{{end}}
+{{- end}}
+
+    public init({{range $i, $field := .Fields}}{{if $i}}, {{end}}{{$field.Name | swiftName}}: {{$field.Type}}{{if not $field.Required}}? = nil{{end}}{{end}}) {
+{{- range .Fields}}
+        self.{{.Name | swiftName}} = {{.Name | swiftName}}
+{{- end}}
+    }
+
+    enum CodingKeys: String, CodingKey {
+{{- range .Fields}}
+        case {{swiftCodingKey .}}
+{{- end}}
+    }
+}
+{{end}}`
+
+const swiftTypesTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+/// Constants of the {{.Workflow.Name}} workflow
+public enum Constants {
+    public static let workflowId = "{{.Workflow.ID}}"
+    public static let workflowName = "{{.Workflow.Name}}"
+    public static let workflowVersion = "{{.Workflow.Version}}"
+
+    public enum Steps {
+        {{range .Workflow.Definition.Steps}}public static let {{.ID | toCamelCase | swiftName}} = "{{.ID}}"
+        {{end}}
+    }
+
+    public enum Status {
+        public static let pending = "pending"
+        public static let running = "running"
+        public static let completed = "completed"
+        public static let failed = "failed"
+        public static let cancelled = "cancelled"
+    }
+}
+`
+
+const swiftTestTemplate = `// Code generated by Magic Flow v2. DO NOT EDIT.
+// Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+import XCTest
+#if canImport(FoundationNetworking)
+import FoundationNetworking
+#endif
+@testable import {{.PackageName}}
+
+/// Serves canned responses to the client's URLSession
+final class MockURLProtocol: URLProtocol {
+    static var handler: ((URLRequest) -> (Int, Data))?
+    static var lastRequest: URLRequest?
+
+    override class func canInit(with request: URLRequest) -> Bool { true }
+    override class func canonicalRequest(for request: URLRequest) -> URLRequest { request }
+
+    override func startLoading() {
+        MockURLProtocol.lastRequest = request
+        let (statusCode, data) = MockURLProtocol.handler?(request) ?? (500, Data())
+        let response = HTTPURLResponse(url: request.url!, statusCode: statusCode, httpVersion: nil, headerFields: ["Content-Type": "application/json"])!
+        client?.urlProtocol(self, didReceive: response, cacheStoragePolicy: .notAllowed)
+        client?.urlProtocol(self, didLoad: data)
+        client?.urlProtocolDidFinishLoading(self)
+    }
+
+    override func stopLoading() {}
+}
+
+final class {{.ClassName}}Tests: XCTestCase {
+    private var client: {{.ClassName}}!
+
+    override func setUp() {
+        super.setUp()
+        let configuration = URLSessionConfiguration.ephemeral
+        configuration.protocolClasses = [MockURLProtocol.self]
+        client = {{.ClassName}}(
+            config: ClientConfig(baseURL: URL(string: "http://localhost:8080")!, apiKey: "test-api-key", retryAttempts: 0),
+            session: URLSession(configuration: configuration)
+        )
+    }
+
+    override func tearDown() {
+        MockURLProtocol.handler = nil
+        MockURLProtocol.lastRequest = nil
+        super.tearDown()
+    }
+
+    func testExecuteWorkflow() async throws {
+        MockURLProtocol.handler = { _ in
+            (200, Data(#"{"id": "execution-1", "workflow_id": "\#(Constants.workflowId)", "status": "running"}"#.utf8))
+        }
+
+        let input: [String: JSONValue] = {{swiftLiteral .ExampleInput "        "}}
+        let result = try await client.executeWorkflow(input: input)
+
+        XCTAssertEqual(result.workflowId, Constants.workflowId)
+        XCTAssertEqual(MockURLProtocol.lastRequest?.value(forHTTPHeaderField: "Authorization"), "Bearer test-api-key")
+    }
+
+    func testAuthenticationFailure() async {
+        MockURLProtocol.handler = { _ in (401, Data()) }
+
+        do {
+            _ = try await client.executeWorkflow(input: [:])
+            XCTFail("expected an authentication error")
+        } catch MagicFlowError.authentication {
+        } catch {
+            XCTFail("unexpected error: \(error)")
+        }
+    }
+
+    func testJSONValueRoundTrip() throws {
+        let value: JSONValue = ["name": "order", "count": 2, "tags": ["a", nil], "gift": true]
+        let decoded = try JSONDecoder().decode(JSONValue.self, from: JSONEncoder().encode(value))
+        XCTAssertEqual(decoded, value)
+    }
+}
+`
+
+const rubyClientTemplate = `# frozen_string_literal: true
+
+# Code generated by Magic Flow v2. DO NOT EDIT.
+# Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+require "faraday"
+require "json"
+
+module {{.Namespace}}
+  # Client for the {{.Workflow.Name}} workflow
+  class {{.ClassName}}
+    attr_reader :config
+
+    # @param config [Configuration] defaults to {{.Namespace}}.configuration
+    # @param connection [Faraday::Connection, nil] replaces the connection built
+    #   from the configuration, e.g. to add middleware
+    def initialize(config: ::{{.Namespace}}.configuration, connection: nil)
+      @config = config
+      @connection = connection || build_connection
+    end
+
+    # Executes the {{.Workflow.Name}} workflow
+    #
+    # @param input [Hash{{if .InputModel}}, {{.InputModel}}{{end}}] the workflow input
+    # @return [ExecutionResult]
+    def execute_workflow(input)
+      body = { "workflow_id" => Constants::WORKFLOW_ID, "input" => input.to_h }
+      ExecutionResult.from_h(request(:post, "/api/v2/executions", body))
+    end
+{{- range .Methods}}
+
+    # Executes the workflow for the {{.Description}} step
+    #
+{{- range .Parameters}}
+    # @param {{.Name | rubyName}} [{{.Type}}]
+{{- end}}
+    # @return [Hash, nil] the workflow output
+    def {{.Name | rubyName}}{{if .Parameters}}({{range $i, $param := .Parameters}}{{if $i}}, {{end}}{{$param.Name | rubyName}}:{{end}}){{end}}
+      {{- if .Parameters}}
+      input = {
+        {{- range .Parameters}}
+        {{rubyLiteral .Name ""}} => {{.Name | rubyName}},
+        {{- end}}
+      }
+      execute_workflow(input).output
+      {{- else}}
+      execute_workflow({}).output
+      {{- end}}
+    end
+{{- end}}
+
+    # Returns the status of an execution
+    #
+    # @return [ExecutionStatus]
+    def get_execution_status(execution_id)
+      ExecutionStatus.from_h(request(:get, "/api/v2/executions/#{execution_id}/status"))
+    end
+
+    # Returns an execution with its output once it has completed
+    #
+    # @return [ExecutionResult]
+    def get_execution_result(execution_id)
+      ExecutionResult.from_h(request(:get, "/api/v2/executions/#{execution_id}"))
+    end
+
+    # Cancels a running execution
+    def cancel_execution(execution_id)
+      request(:post, "/api/v2/executions/#{execution_id}/cancel")
+      nil
+    end
+
+    # Polls an execution until it completes and returns its result
+    #
+    # @param timeout [Numeric] seconds to wait for the execution
+    # @param poll_interval [Numeric] seconds between status requests
+    # @return [ExecutionResult]
+    # @raise [ExecutionError] if the execution fails or is cancelled
+    # @raise [TimeoutError] if the execution does not complete in time
+    def wait_for_completion(execution_id, timeout: 300, poll_interval: 1)
+      deadline = Process.clock_gettime(Process::CLOCK_MONOTONIC) + timeout
+      loop do
+        status = get_execution_status(execution_id)
+        case status.status
+        when Constants::Status::COMPLETED
+          return get_execution_result(execution_id)
+        when Constants::Status::FAILED, Constants::Status::CANCELLED
+          raise ExecutionError.new(
+            "Execution #{status.status}: #{status.message}",
+            execution_id: execution_id,
+            step_id: status.current_step,
+          )
+        end
+
+        if Process.clock_gettime(Process::CLOCK_MONOTONIC) >= deadline
+          raise TimeoutError, "Execution #{execution_id} did not complete within #{timeout} seconds"
+        end
+
+        sleep poll_interval
+      end
+    end
+
+    private
+
+    def build_connection
+      Faraday.new(url: config.base_url) do |faraday|
+        faraday.options.timeout = config.timeout
+        faraday.headers["Authorization"] = "Bearer #{config.api_key}"
+        faraday.headers["Accept"] = "application/json"
+        faraday.headers["Content-Type"] = "application/json"
+      end
+    end
+
+    # Sends a request, retrying connection failures, and returns the parsed
+    # response body
+    def request(method, path, body = nil)
+      attempts = 0
+      begin
+        response = @connection.run_request(method, path, body && JSON.generate(body), nil)
+      rescue Faraday::TimeoutError => e
+        raise TimeoutError, "Request timed out: #{e.message}"
+      rescue Faraday::ConnectionFailed => e
+        attempts += 1
+        if attempts <= config.retry_attempts
+          sleep config.retry_delay
+          retry
+        end
+        raise NetworkError, "Network error: #{e.message}"
+      end
+
+      handle_response(response)
+    end
+
+    def handle_response(response)
+      case response.status
+      when 200..299
+        parse(response.body)
+      when 401, 403
+        raise AuthenticationError.new(
+          "Authentication failed with status #{response.status}",
+          status: response.status,
+          body: response.body,
+        )
+      when 400, 422
+        raise ValidationError.new("Invalid request: #{response.body}", status: response.status, body: response.body)
+      else
+        raise ApiError.new("Request failed with status #{response.status}", status: response.status, body: response.body)
+      end
+    end
+
+    def parse(body)
+      return nil if body.nil? || body.empty?
+
+      JSON.parse(body)
+    rescue JSON::ParserError => e
+      raise DecodingError, "Failed to parse response: #{e.message}"
+    end
+  end
+end
+`
+
+const rubyModelsTemplate = `# frozen_string_literal: true
+
+# Code generated by Magic Flow v2. DO NOT EDIT.
+# Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+require "time"
+
+module {{.Namespace}}
+  # Converts models to and from the hashes of parsed JSON. Models map their
+  # attributes to JSON keys in JSON_KEYS.
+  module Model
+    def self.included(base)
+      base.extend(ClassMethods)
+    end
+
+    # Class methods of the models
+    module ClassMethods
+      # Builds a model from a parsed JSON hash, ignoring unknown keys
+      def from_h(hash)
+        return nil if hash.nil?
+
+        attributes = self::JSON_KEYS.each_with_object({}) do |(name, key), result|
+          if hash.key?(key)
+            result[name] = hash[key]
+          elsif hash.key?(key.to_sym)
+            result[name] = hash[key.to_sym]
+          end
+        end
+        new(**attributes)
+      end
+    end
+
+    # Returns the JSON representation of the model as a hash, without the
+    # attributes that are nil
+    def to_h
+      self.class::JSON_KEYS.each_with_object({}) do |(name, key), result|
+        value = public_send(name)
+        result[key] = serialize(value) unless value.nil?
+      end
+    end
+
+    def ==(other)
+      other.class == self.class && other.to_h == to_h
+    end
+    alias eql? ==
+
+    def hash
+      to_h.hash
+    end
+
+    private
+
+    def serialize(value)
+      case value
+      when Model then value.to_h
+      when Array then value.map { |item| serialize(item) }
+      when Time then value.iso8601
+      else value
+      end
+    end
+
+    def parse_time(value)
+      value.is_a?(String) ? Time.iso8601(value) : value
+    end
+  end
+
+  # The result of a workflow execution
+  class ExecutionResult
+    include Model
+
+    JSON_KEYS = {
+      id: "id",
+      workflow_id: "workflow_id",
+      status: "status",
+      input: "input",
+      output: "output",
+      error: "error",
+      started_at: "started_at",
+      completed_at: "completed_at",
+      duration: "duration",
+    }.freeze
+
+    attr_accessor :id, :workflow_id, :status, :input, :output, :error, :started_at, :completed_at, :duration
+
+    def initialize(id: nil, workflow_id: nil, status: nil, input: nil, output: nil, error: nil,
+                   started_at: nil, completed_at: nil, duration: nil)
+      @id = id
+      @workflow_id = workflow_id
+      @status = status
+      @input = input
+      @output = output
+      @error = error
+      @started_at = parse_time(started_at)
+      @completed_at = parse_time(completed_at)
+      @duration = duration
+    end
+  end
+
+  # The status of a workflow execution
+  class ExecutionStatus
+    include Model
+
+    JSON_KEYS = {
+      id: "id",
+      status: "status",
+      progress: "progress",
+      message: "message",
+      current_step: "current_step",
+      steps: "steps",
+    }.freeze
+
+    attr_accessor :id, :status, :progress, :message, :current_step, :steps
+
+    def initialize(id: nil, status: nil, progress: nil, message: nil, current_step: nil, steps: nil)
+      @id = id
+      @status = status
+      @progress = progress
+      @message = message
+      @current_step = current_step
+      @steps = steps&.map { |step| step.is_a?(StepStatus) ? step : StepStatus.from_h(step) }
+    end
+  end
+
+  # The status of a workflow step
+  class StepStatus
+    include Model
+
+    JSON_KEYS = {
+      id: "id",
+      name: "name",
+      status: "status",
+      error: "error",
+      started_at: "started_at",
+      completed_at: "completed_at",
+    }.freeze
+
+    attr_accessor :id, :name, :status, :error, :started_at, :completed_at
+
+    def initialize(id: nil, name: nil, status: nil, error: nil, started_at: nil, completed_at: nil)
+      @id = id
+      @name = name
+      @status = status
+      @error = error
+      @started_at = parse_time(started_at)
+      @completed_at = parse_time(completed_at)
+    end
+  end
+{{- range .Models}}
+
+  # {{.Description}}
+  class {{.Name}}
+    include Model
+
+    JSON_KEYS = {
+{{- range .Fields}}
+      {{.Name | rubyName}}: {{rubyLiteral (index .Tags "json") ""}},
+{{- end}}
+    }.freeze
+{{range .Fields}}
+    # @return [{{.Type}}{{if not .Required}}, nil{{end}}]{{if .Description}} {{.Description}}{{end}}
+    attr_accessor :{{.Name | rubyName}}
+{{end}}
+    def initialize({{range $i, $field := .Fields}}{{if $i}}, {{end}}{{$field.Name | rubyName}}:{{if not $field.Required}} nil{{end}}{{end}})
+{{- range .Fields}}
+      @{{.Name | rubyName}} = {{.Name | rubyName}}
+{{- end}}
+    end
+  end
+{{- end}}
+end
+`
+
+const rubyTypesTemplate = `# frozen_string_literal: true
+
+# Code generated by Magic Flow v2. DO NOT EDIT.
+# Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+module {{.Namespace}}
+  # Constants of the {{.Workflow.Name}} workflow
+  module Constants
+    WORKFLOW_ID = "{{.Workflow.ID}}"
+    WORKFLOW_NAME = {{rubyLiteral .Workflow.Name ""}}
+    WORKFLOW_VERSION = {{rubyLiteral .Workflow.Version ""}}
+
+    # IDs of the workflow steps
+    module Steps
+      {{range .Workflow.Definition.Steps}}{{.ID | sanitize | toSnakeCase | upper}} = {{rubyLiteral .ID ""}}
+      {{end}}
+    end
+
+    # Execution statuses
+    module Status
+      PENDING = "pending"
+      RUNNING = "running"
+      COMPLETED = "completed"
+      FAILED = "failed"
+      CANCELLED = "cancelled"
+    end
+  end
+end
+`
+
+const rubyTestTemplate = `# frozen_string_literal: true
+
+# Code generated by Magic Flow v2. DO NOT EDIT.
+# Generated at: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}
+
+require "spec_helper"
+
+RSpec.describe {{.Namespace}}::{{.ClassName}} do
+  let(:base_url) { "http://localhost:8080" }
+  let(:config) do
+    {{.Namespace}}::Configuration.new(base_url: base_url, api_key: "test-api-key", retry_attempts: 0)
+  end
+  let(:client) { described_class.new(config: config) }
+
+  describe "#execute_workflow" do
+    it "starts an execution" do
+      execution = { "id" => "execution-1", "workflow_id" => {{.Namespace}}::Constants::WORKFLOW_ID, "status" => "running" }
+      stub = stub_request(:post, "#{base_url}/api/v2/executions")
+             .with(headers: { "Authorization" => "Bearer test-api-key" })
+             .to_return(status: 200, body: JSON.generate(execution))
+
+      result = client.execute_workflow({{rubyLiteral .ExampleInput "      "}})
+
+      expect(result.workflow_id).to eq({{.Namespace}}::Constants::WORKFLOW_ID)
+      expect(stub).to have_been_requested
+    end
+
+    it "raises an authentication error" do
+      stub_request(:post, "#{base_url}/api/v2/executions").to_return(status: 401)
+
+      expect { client.execute_workflow({}) }.to raise_error({{.Namespace}}::AuthenticationError)
+    end
+  end
+{{- range .Methods}}
+
+  describe "#{{.Name | rubyName}}" do
+    it "returns the workflow output" do
+      skip "fill in the arguments of the {{.Description}} step"
+    end
+  end
+{{- end}}
+
+  describe "#wait_for_completion" do
+    it "raises when the execution fails" do
+      stub_request(:get, "#{base_url}/api/v2/executions/execution-1/status")
+        .to_return(status: 200, body: JSON.generate("id" => "execution-1", "status" => "failed", "current_step" => "charge"))
+
+      expect { client.wait_for_completion("execution-1") }
+        .to raise_error({{.Namespace}}::ExecutionError) { |error| expect(error.step_id).to eq("charge") }
+    end
+  end
+end
+`
@@ -11,12 +11,14 @@ import (
 // TypeScriptHandler implements LanguageHandler for TypeScript code generation
 type TypeScriptHandler struct {
 	templateManager *TemplateManager
+	namer           *ClientNamer
 }
 
 // NewTypeScriptHandler creates a new TypeScript language handler
 func NewTypeScriptHandler(templateManager *TemplateManager) *TypeScriptHandler {
 	return &TypeScriptHandler{
 		templateManager: templateManager,
+		namer:           NewClientNamer(),
 	}
 }
 
@@ -106,7 +108,7 @@ func (h *TypeScriptHandler) PrepareTemplateData(workflow *models.Workflow, reque
 		packageName = h.GetDefaultPackageName()
 	}
 
-	className := ToPascalCase(workflow.Name) + "Client"
+	className := h.namer.ClientClassName(workflow.Name)
 
 	// Extract methods from workflow steps
 	methods := ExtractStepMethods(workflow)
@@ -118,14 +120,15 @@ func (h *TypeScriptHandler) PrepareTemplateData(workflow *models.Workflow, reque
 	models := h.generateModels(workflow)
 
 	templateData := &TemplateData{
-		Workflow:    workflow,
-		PackageName: packageName,
-		ClassName:   className,
-		Imports:     imports,
-		Methods:     methods,
-		Models:      models,
-		Options:     request.Options,
-		GeneratedAt: workflow.CreatedAt,
+		Workflow:     workflow,
+		PackageName:  packageName,
+		ClassName:    className,
+		Imports:      imports,
+		Methods:      methods,
+		Models:       models,
+		Options:      request.Options,
+		GeneratedAt:  workflow.CreatedAt,
+		ExampleInput: WorkflowExampleInput(workflow),
 	}
 
 	return templateData, nil
@@ -302,6 +305,9 @@ func (h *TypeScriptHandler) generatePackageJsonFile(data *TemplateData) (Generat
     "ts-jest": "^29.1.0",
     "typescript": "^5.0.0"
   },
+  "optionalDependencies": {
+    "@msgpack/msgpack": "^3.0.0"
+  },
   "files": [
     "dist/**/*"
   ],
@@ -377,30 +383,21 @@ func (h *TypeScriptHandler) generateTsConfigFile(data *TemplateData) (GeneratedF
 
 // generateReadmeFile generates the README file
 func (h *TypeScriptHandler) generateReadmeFile(data *TemplateData) (GeneratedFile, error) {
-	content := fmt.Sprintf(`# %s TypeScript Client
-
-Generated TypeScript client library for the %s workflow.
-
-## Installation
-
-` + "```bash" + `
-npm install %s
-# or
-yarn add %s
-` + "```" + `
+	readme := &ReadmeBuilder{
+		Language:   "TypeScript",
+		CodeFence:  "typescript",
+		TypesTitle: "Types",
+	}
 
-## Usage
+	readme.Installation = codeBlock("bash", fmt.Sprintf("npm install %s\n# or\nyarn add %s", data.PackageName, data.PackageName))
 
-` + "```typescript" + `
-import { %s } from '%s';
+	readme.Usage = readme.CodeBlock(fmt.Sprintf(`import { %s } from '%s';
 
 const client = new %s('http://localhost:8080', 'your-api-key');
 
 async function executeWorkflow() {
   try {
-    const input = {
-      key: 'value'
-    };
+    const input = %s;
     
     const result = await client.executeWorkflow(input);
     console.log('Execution ID:', result.id);
@@ -415,55 +412,42 @@ async function executeWorkflow() {
   }
 }
 
-executeWorkflow();
-` + "```" + `
-
-## API Reference
-
-### Client Methods
-
-#### executeWorkflow
-
-Executes the %s workflow with the provided input.
-
-` + "```typescript" + `
-executeWorkflow(input: Record<string, any>): Promise<ExecutionResult>
-` + "```" + `
-
-#### getExecutionStatus
-
-Retrieves the status of a workflow execution.
-
-` + "```typescript" + `
-getExecutionStatus(executionId: string): Promise<ExecutionStatus>
-` + "```" + `
-
-#### cancelExecution
-
-Cancels a running workflow execution.
-
-` + "```typescript" + `
-cancelExecution(executionId: string): Promise<void>
-` + "```" + `
-
-#### getExecutionResult
-
-Retrieves the result of a completed workflow execution.
-
-` + "```typescript" + `
-getExecutionResult(executionId: string): Promise<ExecutionResult>
-` + "```" + `
-
-%s
-
-## Types
-
-### ExecutionResult
-
-Represents the result of a workflow execution.
-
-` + "```typescript" + `
-interface ExecutionResult {
+executeWorkflow();`,
+		data.ClassName,
+		data.PackageName,
+		data.ClassName,
+		TypeScriptLiteral(data.ExampleInput, "    "),
+	))
+
+	readme.ClientMethods = []ReadmeEntry{
+		{
+			Name:        "executeWorkflow",
+			Description: fmt.Sprintf("Executes the %s workflow with the provided input.", data.Workflow.Name),
+			Code:        "executeWorkflow(input: Record<string, any>): Promise<ExecutionResult>",
+		},
+		{
+			Name:        "getExecutionStatus",
+			Description: "Retrieves the status of a workflow execution.",
+			Code:        "getExecutionStatus(executionId: string): Promise<ExecutionStatus>",
+		},
+		{
+			Name:        "cancelExecution",
+			Description: "Cancels a running workflow execution.",
+			Code:        "cancelExecution(executionId: string): Promise<void>",
+		},
+		{
+			Name:        "getExecutionResult",
+			Description: "Retrieves the result of a completed workflow execution.",
+			Code:        "getExecutionResult(executionId: string): Promise<ExecutionResult>",
+		},
+	}
+	readme.MethodDocs = h.generateMethodDocs(data.Methods)
+
+	readme.Types = []ReadmeEntry{
+		{
+			Name:        "ExecutionResult",
+			Description: "Represents the result of a workflow execution.",
+			Code: `interface ExecutionResult {
   id: string;
   workflowId: string;
   status: ExecutionStatus;
@@ -473,15 +457,12 @@ interface ExecutionResult {
   startedAt: Date;
   completedAt?: Date;
   duration?: number;
-}
-` + "```" + `
-
-### ExecutionStatus
-
-Represents the status of a workflow execution.
-
-` + "```typescript" + `
-interface ExecutionStatus {
+}`,
+		},
+		{
+			Name:        "ExecutionStatus",
+			Description: "Represents the status of a workflow execution.",
+			Code: `interface ExecutionStatus {
   id: string;
   status: 'pending' | 'running' | 'completed' | 'failed' | 'cancelled';
   progress: number;
@@ -489,15 +470,12 @@ interface ExecutionStatus {
   steps: StepStatus[];
   startedAt: Date;
   updatedAt: Date;
-}
-` + "```" + `
-
-### StepStatus
-
-Represents the status of a workflow step.
-
-` + "```typescript" + `
-interface StepStatus {
+}`,
+		},
+		{
+			Name:        "StepStatus",
+			Description: "Represents the status of a workflow step.",
+			Code: `interface StepStatus {
   id: string;
   name: string;
   status: 'pending' | 'running' | 'completed' | 'failed' | 'skipped';
@@ -507,34 +485,26 @@ interface StepStatus {
   startedAt?: Date;
   completedAt?: Date;
   duration?: number;
-}
-` + "```" + `
-
-## Constants
-
-- ` + "`WORKFLOW_ID`" + `: The ID of the workflow
-- ` + "`WORKFLOW_NAME`" + `: The name of the workflow
-- ` + "`ExecutionStatus`" + `: Execution status enum
-- ` + "`StepIds`" + `: Step ID constants
-
-## Error Handling
+}`,
+		},
+	}
 
-All methods return promises that may reject with errors. Always use try-catch blocks:
+	readme.Constants = "- `WORKFLOW_ID`: The ID of the workflow\n" +
+		"- `WORKFLOW_NAME`: The name of the workflow\n" +
+		"- `WORKFLOW_VERSION`: The workflow version the client was generated against\n" +
+		"- `ExecutionStatus`: Execution status enum\n" +
+		"- `StepIds`: Step ID constants"
 
-` + "```typescript" + `
-try {
+	readme.ErrorHandling = "All methods return promises that may reject with errors. Always use try-catch blocks:\n\n" +
+		readme.CodeBlock(`try {
   const result = await client.executeWorkflow(input);
   // Handle success
 } catch (error) {
   // Handle error
   console.error('Error executing workflow:', error.message);
-}
-` + "```" + `
-
-## Development
+}`)
 
-` + "```bash" + `
-# Install dependencies
+	readme.Development = codeBlock("bash", `# Install dependencies
 npm install
 
 # Build the project
@@ -550,30 +520,9 @@ npm run test:watch
 npm run lint
 
 # Fix linting issues
-npm run lint:fix
-` + "```" + `
-
-## License
+npm run lint:fix`)
 
-Generated code - see original workflow license.
-`,
-		data.Workflow.Name,
-		data.Workflow.Name,
-		data.PackageName,
-		data.PackageName,
-		data.ClassName,
-		data.PackageName,
-		data.ClassName,
-		data.Workflow.Name,
-		h.generateMethodDocs(data.Methods),
-	)
-
-	return GeneratedFile{
-		Path:     "README.md",
-		Content:  content,
-		Language: "markdown",
-		Type:     "documentation",
-	}, nil
+	return readme.Build(data)
 }
 
 // generateImports generates the list of imports needed
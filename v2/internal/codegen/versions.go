@@ -0,0 +1,49 @@
+package codegen
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// VersionLoader loads historical workflow versions. The versioning Manager
+// implements it.
+type VersionLoader interface {
+	GetVersion(ctx context.Context, versionID uuid.UUID) (*models.WorkflowVersion, error)
+}
+
+// SetVersionLoader sets the loader used for requests targeting a specific
+// workflow version
+func (g *CodeGenerator) SetVersionLoader(versions VersionLoader) {
+	g.versions = versions
+}
+
+// workflowAtVersion returns the workflow to generate from. Requests without
+// a VersionID use the current definition; others get a copy of the workflow
+// with the definition, schemas and version string of the pinned version.
+func (g *CodeGenerator) workflowAtVersion(workflow *models.Workflow, request *GenerationRequest) (*models.Workflow, error) {
+	if request.VersionID == nil {
+		return workflow, nil
+	}
+	if g.versions == nil {
+		return nil, fmt.Errorf("workflow versions are not available for code generation")
+	}
+
+	version, err := g.versions.GetVersion(context.Background(), *request.VersionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workflow version %s: %w", *request.VersionID, err)
+	}
+	if version.WorkflowID != workflow.ID {
+		return nil, fmt.Errorf("version %s does not belong to workflow %s", version.ID, workflow.ID)
+	}
+
+	pinned := *workflow
+	pinned.Version = version.Version
+	pinned.Definition = version.Definition
+	pinned.InputSchema = version.InputSchema
+	pinned.OutputSchema = version.OutputSchema
+	return &pinned, nil
+}
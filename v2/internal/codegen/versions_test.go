@@ -0,0 +1,111 @@
+package codegen
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+type fakeVersionLoader map[uuid.UUID]*models.WorkflowVersion
+
+func (f fakeVersionLoader) GetVersion(ctx context.Context, versionID uuid.UUID) (*models.WorkflowVersion, error) {
+	version, ok := f[versionID]
+	if !ok {
+		return nil, fmt.Errorf("version %s not found", versionID)
+	}
+	return version, nil
+}
+
+func generatedFile(t *testing.T, result *GenerationResult, name string) string {
+	for _, file := range result.Files {
+		if filepath.Base(file.Path) == name {
+			return file.Content
+		}
+	}
+	t.Fatalf("%s was not generated", name)
+	return ""
+}
+
+func TestGeneratePinnedVersion(t *testing.T) {
+	workflow := &models.Workflow{
+		ID:      uuid.New(),
+		Name:    "orders",
+		Version: "2.0.0",
+		InputSchema: models.JSONSchema{
+			Type:       "object",
+			Properties: map[string]interface{}{"order_id": map[string]interface{}{"type": "string"}},
+		},
+	}
+	v1 := &models.WorkflowVersion{
+		ID:         uuid.New(),
+		WorkflowID: workflow.ID,
+		Version:    "1.4.0",
+		InputSchema: models.JSONSchema{
+			Type:       "object",
+			Properties: map[string]interface{}{"legacy_order_ref": map[string]interface{}{"type": "string"}},
+		},
+	}
+	other := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: uuid.New(), Version: "9.9.9"}
+
+	generator := NewCodeGenerator()
+	generator.SetVersionLoader(fakeVersionLoader{v1.ID: v1, other.ID: other})
+
+	t.Run("go", func(t *testing.T) {
+		result, err := generator.Generate(workflow, &GenerationRequest{
+			WorkflowID: workflow.ID,
+			Language:   LanguageGo,
+			VersionID:  &v1.ID,
+		})
+		require.NoError(t, err)
+
+		assert.Contains(t, generatedFile(t, result, "types.go"), `WorkflowVersion = "1.4.0"`)
+		readme := generatedFile(t, result, "README.md")
+		assert.Contains(t, readme, `"legacy_order_ref"`, "the example input follows the pinned schema")
+		assert.NotContains(t, readme, `"order_id"`)
+		assert.Equal(t, "1.4.0", result.Metadata["workflow_version"])
+		assert.Equal(t, v1.ID.String(), result.Metadata["version_id"])
+		assert.Equal(t, "2.0.0", workflow.Version, "the caller's workflow must not be modified")
+	})
+
+	t.Run("java client config", func(t *testing.T) {
+		result, err := generator.Generate(workflow, &GenerationRequest{
+			WorkflowID: workflow.ID,
+			Language:   LanguageJava,
+			VersionID:  &v1.ID,
+		})
+		require.NoError(t, err)
+
+		assert.Contains(t, generatedFile(t, result, "ClientConfig.java"), `WORKFLOW_VERSION = "1.4.0";`)
+	})
+
+	t.Run("current version without a version ID", func(t *testing.T) {
+		result, err := generator.Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageGo})
+		require.NoError(t, err)
+
+		assert.Contains(t, generatedFile(t, result, "types.go"), `WorkflowVersion = "2.0.0"`)
+		assert.NotContains(t, result.Metadata, "version_id")
+	})
+
+	t.Run("version of another workflow", func(t *testing.T) {
+		_, err := generator.Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageGo, VersionID: &other.ID})
+		assert.ErrorContains(t, err, "does not belong to workflow")
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		missing := uuid.New()
+		_, err := generator.Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageGo, VersionID: &missing})
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("without a version loader", func(t *testing.T) {
+		_, err := NewCodeGenerator().Generate(workflow, &GenerationRequest{WorkflowID: workflow.ID, Language: LanguageGo, VersionID: &v1.ID})
+		assert.Error(t, err)
+	})
+}
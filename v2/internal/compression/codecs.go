@@ -0,0 +1,97 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxPayloadSize bounds the size an envelope may record, so that corrupt
+// or hostile envelopes cannot make decompression allocate without limit
+const maxPayloadSize = 1 << 30
+
+// zstdCodec compresses with zstd. Its encoder and decoder are shared: their
+// EncodeAll and DecodeAll are safe for concurrent use.
+type zstdCodec struct{}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxPayloadSize))
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+func (zstdCodec) Algorithm() string {
+	return AlgorithmZstd
+}
+
+func (zstdCodec) Compress(data []byte) ([]byte, error) {
+	encoder, _, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeAll(data, nil), nil
+}
+
+func (zstdCodec) Decompress(data []byte, size int64) ([]byte, error) {
+	_, decoder, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 || size > maxPayloadSize {
+		return nil, fmt.Errorf("recorded size %d out of range", size)
+	}
+	return decoder.DecodeAll(data, make([]byte, 0, size))
+}
+
+// gzipCodec compresses with gzip
+type gzipCodec struct{}
+
+func (gzipCodec) Algorithm() string {
+	return AlgorithmGzip
+}
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(data []byte, size int64) ([]byte, error) {
+	if size < 0 || size > maxPayloadSize {
+		return nil, fmt.Errorf("recorded size %d out of range", size)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	// Read one byte more than recorded, so that longer payloads are
+	// detected without being read whole
+	payload := bytes.NewBuffer(make([]byte, 0, size))
+	if _, err := io.Copy(payload, io.LimitReader(reader, size+1)); err != nil {
+		return nil, err
+	}
+	return payload.Bytes(), nil
+}
@@ -0,0 +1,153 @@
+// Package compression compresses the execution payloads persisted as JSON,
+// such as inputs, outputs, variables and event data. Compressed payloads are
+// stored as an envelope, itself JSON so that payload columns keep their
+// type, recording the algorithm and the original size:
+//
+//	{"$compressed": {"v": 1, "alg": "zstd", "size": 48213, "data": "<base64>"}}
+//
+// Payloads without an envelope are plain JSON, so compressed and
+// uncompressed rows can be read side by side.
+package compression
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// AlgorithmZstd compresses with zstd, the default
+	AlgorithmZstd = "zstd"
+	// AlgorithmGzip compresses with gzip, for deployments whose tooling
+	// cannot read zstd
+	AlgorithmGzip = "gzip"
+
+	// EnvelopeKey is the only key of the object wrapping a compressed
+	// payload
+	EnvelopeKey = "$compressed"
+	// EnvelopeVersion is the version of the envelopes written
+	EnvelopeVersion = 1
+
+	// DefaultThreshold is the size of the payloads, in bytes of JSON, above
+	// which they are compressed
+	DefaultThreshold = 4096
+)
+
+var (
+	// ErrUnknownAlgorithm is returned for algorithms without a codec
+	ErrUnknownAlgorithm = errors.New("unknown compression algorithm")
+	// ErrUnsupportedVersion is returned for envelopes written by a newer
+	// version, which cannot be read
+	ErrUnsupportedVersion = errors.New("unsupported compression envelope version")
+	// ErrCorrupt is returned for envelopes whose data does not decompress
+	// to the recorded size
+	ErrCorrupt = errors.New("corrupt compressed payload")
+)
+
+// Envelope is a compressed payload
+type Envelope struct {
+	Version   int    `json:"v"`
+	Algorithm string `json:"alg"`
+	// Size is the size of the payload before compression
+	Size int64  `json:"size"`
+	Data []byte `json:"data"`
+}
+
+// Codec compresses and decompresses payloads with an algorithm
+type Codec interface {
+	Algorithm() string
+	Compress(data []byte) ([]byte, error)
+	// Decompress decompresses data, of size bytes once decompressed
+	Decompress(data []byte, size int64) ([]byte, error)
+}
+
+var codecs = map[string]Codec{
+	AlgorithmZstd: zstdCodec{},
+	AlgorithmGzip: gzipCodec{},
+}
+
+// Algorithms returns the supported algorithms
+func Algorithms() []string {
+	algorithms := make([]string, 0, len(codecs))
+	for algorithm := range codecs {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+func codecFor(algorithm string) (Codec, error) {
+	codec, ok := codecs[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+	return codec, nil
+}
+
+// Encode compresses a JSON payload with an algorithm into an envelope
+func Encode(algorithm string, payload []byte) ([]byte, error) {
+	codec, err := codecFor(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	data, err := codec.Compress(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]Envelope{EnvelopeKey: {
+		Version:   EnvelopeVersion,
+		Algorithm: algorithm,
+		Size:      int64(len(payload)),
+		Data:      data,
+	}})
+}
+
+// Parse returns the envelope of a stored payload, reporting false for
+// payloads that are not compressed
+func Parse(stored []byte) (*Envelope, bool, error) {
+	trimmed := bytes.TrimSpace(stored)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, []byte(`"`+EnvelopeKey+`"`)) {
+		return nil, false, nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &object); err != nil || len(object) != 1 || object[EnvelopeKey] == nil {
+		return nil, false, nil
+	}
+	var envelope Envelope
+	if err := json.Unmarshal(object[EnvelopeKey], &envelope); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if envelope.Version < 1 || envelope.Version > EnvelopeVersion {
+		return nil, false, fmt.Errorf("%w: %d", ErrUnsupportedVersion, envelope.Version)
+	}
+	return &envelope, true, nil
+}
+
+// Decode returns the JSON payload of a stored payload, decompressing it
+// when it is an envelope. Payloads that are not compressed are returned as
+// they are.
+func Decode(stored []byte) ([]byte, error) {
+	envelope, ok, err := Parse(stored)
+	if err != nil || !ok {
+		return stored, err
+	}
+	codec, err := codecFor(envelope.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := codec.Decompress(envelope.Data, envelope.Size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if int64(len(payload)) != envelope.Size {
+		return nil, fmt.Errorf("%w: %d bytes decompressed, %d recorded", ErrCorrupt, len(payload), envelope.Size)
+	}
+	return payload, nil
+}
+
+// column names a column as table.column
+func column(table, name string) string {
+	return table + "." + name
+}
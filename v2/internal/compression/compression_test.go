@@ -0,0 +1,227 @@
+package compression
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMetrics keeps the last value of gauges and the sum of counters
+type recordingMetrics struct {
+	values map[string]float64
+}
+
+func (m *recordingMetrics) RecordMetric(name string, value float64, labels map[string]string) {
+	if m.values == nil {
+		m.values = make(map[string]float64)
+	}
+	key := name + "{" + labels["table"] + "}"
+	if strings.HasSuffix(name, "_total") {
+		m.values[key] += value
+		return
+	}
+	m.values[key] = value
+}
+
+// fixture returns a testdata payload as it is persisted, compact JSON
+func fixture(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	var value interface{}
+	require.NoError(t, json.Unmarshal(data, &value))
+	payload, err := json.Marshal(value)
+	require.NoError(t, err)
+	return payload
+}
+
+func newCompressor(t *testing.T, config Config) *Compressor {
+	config.Enabled = true
+	compressor, err := NewCompressor(config)
+	require.NoError(t, err)
+	return compressor
+}
+
+func TestRoundTrip(t *testing.T) {
+	payload := fixture(t, "execution_input.json")
+	small := []byte(`{"order_id":"ord_1","total":42.5}`)
+
+	for _, algorithm := range Algorithms() {
+		t.Run(algorithm, func(t *testing.T) {
+			compressor := newCompressor(t, Config{Algorithm: algorithm, Threshold: 1024})
+
+			stored, err := compressor.Compress("executions", "input_data", payload)
+			require.NoError(t, err)
+			envelope, ok, err := Parse(stored)
+			require.NoError(t, err)
+			require.True(t, ok, "payloads above the threshold are stored as an envelope")
+			assert.Equal(t, EnvelopeVersion, envelope.Version)
+			assert.Equal(t, algorithm, envelope.Algorithm)
+			assert.Equal(t, int64(len(payload)), envelope.Size)
+			assert.True(t, json.Valid(stored), "envelopes are JSON")
+
+			decoded, err := Decode(stored)
+			require.NoError(t, err)
+			assert.Equal(t, payload, decoded)
+
+			// Envelopes read back from a jsonb column are reformatted
+			var reformatted interface{}
+			require.NoError(t, json.Unmarshal(stored, &reformatted))
+			indented, err := json.MarshalIndent(reformatted, "", "  ")
+			require.NoError(t, err)
+			decoded, err = Decode(indented)
+			require.NoError(t, err)
+			assert.Equal(t, payload, decoded)
+
+			// Payloads up to the threshold are stored as they are
+			stored, err = compressor.Compress("executions", "input_data", small)
+			require.NoError(t, err)
+			assert.Equal(t, small, stored)
+			decoded, err = Decode(stored)
+			require.NoError(t, err)
+			assert.Equal(t, small, decoded)
+		})
+	}
+
+	// Skipped columns and disabled compression store payloads as they are
+	compressor := newCompressor(t, Config{Threshold: 1024, Skip: []string{"executions.context"}})
+	stored, err := compressor.Compress("executions", "context", payload)
+	require.NoError(t, err)
+	assert.Equal(t, payload, stored)
+	disabled, err := NewCompressor(Config{Threshold: 1024})
+	require.NoError(t, err)
+	stored, err = disabled.Compress("executions", "input_data", payload)
+	require.NoError(t, err)
+	assert.Equal(t, payload, stored)
+
+	// Payloads compressing poorly are stored as they are
+	incompressible, err := Encode(AlgorithmZstd, payload)
+	require.NoError(t, err)
+	stored, err = compressor.Compress("executions", "input_data", []byte(fmt.Sprintf("%q", incompressible)))
+	require.NoError(t, err)
+	_, ok, _ := Parse(stored)
+	assert.False(t, ok)
+
+	_, err = NewCompressor(Config{Algorithm: "brotli"})
+	assert.True(t, errors.Is(err, ErrUnknownAlgorithm), "err = %v", err)
+}
+
+func TestEnvelopeVersioning(t *testing.T) {
+	payload := fixture(t, "execution_input.json")
+	stored, err := Encode(AlgorithmGzip, payload)
+	require.NoError(t, err)
+
+	rewrite := func(change func(envelope map[string]interface{})) []byte {
+		var object map[string]map[string]interface{}
+		require.NoError(t, json.Unmarshal(stored, &object))
+		change(object[EnvelopeKey])
+		data, err := json.Marshal(object)
+		require.NoError(t, err)
+		return data
+	}
+
+	// Envelopes of later versions are not read as an older version
+	_, err = Decode(rewrite(func(envelope map[string]interface{}) { envelope["v"] = 2 }))
+	assert.True(t, errors.Is(err, ErrUnsupportedVersion), "err = %v", err)
+	_, err = Decode(rewrite(func(envelope map[string]interface{}) { delete(envelope, "v") }))
+	assert.True(t, errors.Is(err, ErrUnsupportedVersion), "err = %v", err)
+
+	_, err = Decode(rewrite(func(envelope map[string]interface{}) { envelope["alg"] = "lz4" }))
+	assert.True(t, errors.Is(err, ErrUnknownAlgorithm), "err = %v", err)
+	_, err = Decode(rewrite(func(envelope map[string]interface{}) { envelope["size"] = 12 }))
+	assert.True(t, errors.Is(err, ErrCorrupt), "err = %v", err)
+	_, err = Decode(rewrite(func(envelope map[string]interface{}) { envelope["data"] = "H4sIAAAA" }))
+	assert.True(t, errors.Is(err, ErrCorrupt), "err = %v", err)
+
+	// Payloads that merely contain the envelope key are not envelopes
+	for _, plain := range []string{
+		`{"$compressed": {"v": 1}, "order_id": "ord_1"}`,
+		`{"note": "$compressed"}`,
+		`["$compressed"]`,
+		`"$compressed"`,
+	} {
+		decoded, err := Decode([]byte(plain))
+		require.NoError(t, err, plain)
+		assert.Equal(t, plain, string(decoded))
+	}
+}
+
+func TestRecompress(t *testing.T) {
+	payload := fixture(t, "step_output.json")
+	gzipCompressor := newCompressor(t, Config{Algorithm: AlgorithmGzip, Threshold: 1024})
+	zstdCompressor := newCompressor(t, Config{Algorithm: AlgorithmZstd, Threshold: 1024})
+
+	// Payloads written before compression was enabled are compressed
+	stored, changed, err := gzipCompressor.Recompress("step_executions", "output_data", payload)
+	require.NoError(t, err)
+	require.True(t, changed)
+	envelope, _, err := Parse(stored)
+	require.NoError(t, err)
+	assert.Equal(t, AlgorithmGzip, envelope.Algorithm)
+
+	// Recompressing with the same settings changes nothing
+	_, changed, err = gzipCompressor.Recompress("step_executions", "output_data", stored)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// Payloads of another algorithm are compressed again
+	stored, changed, err = zstdCompressor.Recompress("step_executions", "output_data", stored)
+	require.NoError(t, err)
+	require.True(t, changed)
+	envelope, _, err = Parse(stored)
+	require.NoError(t, err)
+	assert.Equal(t, AlgorithmZstd, envelope.Algorithm)
+	decoded, err := Decode(stored)
+	require.NoError(t, err)
+	assert.Equal(t, payload, decoded)
+
+	// Payloads of columns no longer compressed are decompressed
+	disabled, err := NewCompressor(Config{})
+	require.NoError(t, err)
+	restored, changed, err := disabled.Recompress("step_executions", "output_data", stored)
+	require.NoError(t, err)
+	require.True(t, changed)
+	assert.Equal(t, payload, restored)
+	_, changed, err = disabled.Recompress("step_executions", "output_data", restored)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// Small payloads are left as they are
+	_, changed, err = zstdCompressor.Recompress("step_executions", "output_data", []byte(`{"ok":true}`))
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestCompressionRatio(t *testing.T) {
+	fixtures := map[string]string{
+		"executions":      "execution_input.json",
+		"step_executions": "step_output.json",
+	}
+	for _, algorithm := range Algorithms() {
+		compressor := newCompressor(t, Config{Algorithm: algorithm})
+		metrics := &recordingMetrics{}
+		compressor.SetMetrics(metrics)
+
+		for table, name := range fixtures {
+			payload := fixture(t, name)
+			stored, err := compressor.Compress(table, "payload", payload)
+			require.NoError(t, err)
+
+			// The envelope encodes the data as base64, its ratio is still
+			// well below the target
+			ratio := float64(len(stored)) / float64(len(payload))
+			t.Logf("%s %s: %d bytes stored as %d, ratio %.3f", algorithm, name, len(payload), len(stored), ratio)
+			assert.Less(t, ratio, 0.25, "%s %s", algorithm, name)
+
+			assert.Equal(t, float64(len(payload)), metrics.values["payload_compression_original_bytes_total{"+table+"}"])
+			assert.Equal(t, float64(len(stored)), metrics.values["payload_compression_stored_bytes_total{"+table+"}"])
+			assert.InDelta(t, ratio, metrics.values["payload_compression_ratio{"+table+"}"], 1e-9)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package compression
+
+import "sync"
+
+// MetricsRecorder records compression metrics. It is satisfied by the
+// engine metrics collectors.
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// Config configures the compression of persisted payloads
+type Config struct {
+	Enabled bool
+	// Algorithm is zstd or gzip
+	Algorithm string
+	// Threshold is the size of the payloads, in bytes of JSON, above which
+	// they are compressed
+	Threshold int
+	// Skip lists the columns never compressed, as table.column, such as
+	// the payload columns queried in SQL
+	Skip []string
+}
+
+// Compressor compresses the payloads of the columns of a database
+type Compressor struct {
+	config  Config
+	skip    map[string]bool
+	metrics MetricsRecorder
+
+	mu     sync.Mutex
+	totals map[string]*tableTotals
+}
+
+// tableTotals are the bytes of the payloads written to a table, before and
+// after compression
+type tableTotals struct {
+	original int64
+	stored   int64
+}
+
+// NewCompressor creates a compressor. It fails for unknown algorithms.
+func NewCompressor(config Config) (*Compressor, error) {
+	if config.Algorithm == "" {
+		config.Algorithm = AlgorithmZstd
+	}
+	if _, err := codecFor(config.Algorithm); err != nil {
+		return nil, err
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultThreshold
+	}
+	skip := make(map[string]bool, len(config.Skip))
+	for _, name := range config.Skip {
+		skip[name] = true
+	}
+	return &Compressor{
+		config: config,
+		skip:   skip,
+		totals: make(map[string]*tableTotals),
+	}, nil
+}
+
+// SetMetrics sets the recorder of the payload_compression_* metrics
+func (c *Compressor) SetMetrics(metrics MetricsRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = metrics
+}
+
+// Algorithm returns the algorithm payloads are compressed with
+func (c *Compressor) Algorithm() string {
+	return c.config.Algorithm
+}
+
+// compresses reports whether the payloads of a column are compressed
+func (c *Compressor) compresses(table, name string) bool {
+	return c.config.Enabled && !c.skip[column(table, name)]
+}
+
+// Compress returns a JSON payload of a column as it is stored: an envelope
+// when compression is enabled for the column and the payload is above the
+// threshold, unless compressing does not make it smaller, and the payload
+// itself otherwise. The bytes written are counted per table in the
+// payload_compression_original_bytes_total and
+// payload_compression_stored_bytes_total metrics, and their ratio is the
+// payload_compression_ratio gauge.
+func (c *Compressor) Compress(table, name string, payload []byte) ([]byte, error) {
+	if !c.compresses(table, name) {
+		return payload, nil
+	}
+	stored := payload
+	if len(payload) > c.config.Threshold {
+		envelope, err := Encode(c.config.Algorithm, payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(envelope) < len(payload) {
+			stored = envelope
+		}
+	}
+	c.record(table, len(payload), len(stored))
+	return stored, nil
+}
+
+// Recompress returns a stored payload of a column as Compress would store
+// it now, reporting whether it changed. Payloads compressed with another
+// algorithm are compressed again, payloads above the threshold compressed,
+// and payloads of columns no longer compressed decompressed. Recompressing
+// twice changes nothing.
+func (c *Compressor) Recompress(table, name string, stored []byte) ([]byte, bool, error) {
+	envelope, compressed, err := Parse(stored)
+	if err != nil {
+		return nil, false, err
+	}
+	if compressed && c.compresses(table, name) && envelope.Algorithm == c.config.Algorithm && envelope.Size > int64(c.config.Threshold) {
+		return stored, false, nil
+	}
+	payload, err := Decode(stored)
+	if err != nil {
+		return nil, false, err
+	}
+	restored, err := c.Compress(table, name, payload)
+	if err != nil {
+		return nil, false, err
+	}
+	if !compressed {
+		if _, ok, _ := Parse(restored); !ok {
+			return stored, false, nil
+		}
+	}
+	return restored, true, nil
+}
+
+func (c *Compressor) record(table string, original, stored int) {
+	c.mu.Lock()
+	totals, ok := c.totals[table]
+	if !ok {
+		totals = &tableTotals{}
+		c.totals[table] = totals
+	}
+	totals.original += int64(original)
+	totals.stored += int64(stored)
+	ratio := float64(totals.stored) / float64(totals.original)
+	metrics := c.metrics
+	c.mu.Unlock()
+
+	if metrics == nil || original == 0 {
+		return
+	}
+	labels := map[string]string{"table": table}
+	metrics.RecordMetric("payload_compression_original_bytes_total", float64(original), labels)
+	metrics.RecordMetric("payload_compression_stored_bytes_total", float64(stored), labels)
+	metrics.RecordMetric("payload_compression_ratio", ratio, labels)
+}
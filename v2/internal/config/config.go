@@ -45,12 +45,19 @@ type Config struct {
 
 	// Environment-specific settings
 	Environment string `yaml:"environment" json:"environment"`
+
+	// Warnings lists the contradictions between feature flags and their
+	// subsystems the last validation synced, and the insecure settings of
+	// a production config
+	Warnings []string `yaml:"-" json:"-"`
 }
 
 // ServerConfig contains HTTP server configuration
 type ServerConfig struct {
 	Host         string        `yaml:"host" json:"host"`
 	Port         int           `yaml:"port" json:"port"`
+	// Mode is the gin mode of the server: debug, release or test
+	Mode         string        `yaml:"mode" json:"mode"`
 	ReadTimeout  time.Duration `yaml:"read_timeout" json:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout" json:"write_timeout"`
 	IdleTimeout  time.Duration `yaml:"idle_timeout" json:"idle_timeout"`
@@ -334,12 +341,14 @@ type FeatureFlags struct {
 	AdvancedWorkflows  bool `yaml:"advanced_workflows" json:"advanced_workflows"`
 }
 
-// DefaultConfig returns a default configuration
+// DefaultConfig returns the default configuration of the development
+// environment, see DefaultConfigFor for the other environments
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
 			Host:         "0.0.0.0",
 			Port:         8080,
+			Mode:         "debug",
 			ReadTimeout:  30 * time.Second,
 			WriteTimeout: 30 * time.Second,
 			IdleTimeout:  120 * time.Second,
@@ -413,7 +422,7 @@ func DefaultConfig() *Config {
 			Enabled:            true,
 			TemplatesDir:       "internal/codegen/templates",
 			OutputDir:          "generated",
-			SupportedLanguages: []string{"go", "typescript", "python", "java"},
+			SupportedLanguages: []string{"go", "typescript", "python", "java", "kotlin", "swift", "ruby", "grpc"},
 			LanguageConfigs: map[string]LanguageConfig{
 				"go": {
 					Enabled:       true,
@@ -439,6 +448,30 @@ func DefaultConfig() *Config {
 					FileExtension: ".java",
 					PackageFormat: "maven",
 				},
+				"kotlin": {
+					Enabled:       true,
+					TemplateDir:   "kotlin",
+					FileExtension: ".kt",
+					PackageFormat: "gradle",
+				},
+				"swift": {
+					Enabled:       true,
+					TemplateDir:   "swift",
+					FileExtension: ".swift",
+					PackageFormat: "spm",
+				},
+				"ruby": {
+					Enabled:       true,
+					TemplateDir:   "ruby",
+					FileExtension: ".rb",
+					PackageFormat: "gem",
+				},
+				"grpc": {
+					Enabled:       true,
+					TemplateDir:   "grpc",
+					FileExtension: ".proto",
+					PackageFormat: "protobuf",
+				},
 			},
 		},
 		Versioning: VersioningConfig{
@@ -528,9 +561,26 @@ func DefaultConfig() *Config {
 	}
 }
 
-// LoadConfig loads configuration from file and environment variables
+// LoadConfig loads configuration from file and environment variables, over
+// the defaults of the environment they select
 func LoadConfig(configPath string) (*Config, error) {
-	config := DefaultConfig()
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate configuration
+	if err := validateConfig(config); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	return config, nil
+}
+
+// ReadConfig reads configuration from file and environment variables like
+// LoadConfig, without validating it
+func ReadConfig(configPath string) (*Config, error) {
+	config := DefaultConfigFor(configEnvironment(configPath))
 
 	// Load from file if provided
 	if configPath != "" {
@@ -544,11 +594,6 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to load config from environment: %w", err)
 	}
 
-	// Validate configuration
-	if err := validateConfig(config); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
-	}
-
 	return config, nil
 }
 
@@ -638,6 +683,22 @@ func loadFromEnv(config *Config) error {
 		config.Features.Dashboard = strings.ToLower(dashboard) == "true"
 		config.Dashboard.Enabled = config.Features.Dashboard
 	}
+	if versioning := os.Getenv("MAGIC_FLOW_FEATURE_VERSIONING"); versioning != "" {
+		config.Features.WorkflowVersioning = strings.ToLower(versioning) == "true"
+		config.Versioning.Enabled = config.Features.WorkflowVersioning
+	}
+	if codegen := os.Getenv("MAGIC_FLOW_FEATURE_CODEGEN"); codegen != "" {
+		config.Features.CodeGeneration = strings.ToLower(codegen) == "true"
+		config.CodeGen.Enabled = config.Features.CodeGeneration
+	}
+	if rateLimit := os.Getenv("MAGIC_FLOW_FEATURE_RATE_LIMIT"); rateLimit != "" {
+		config.Features.RateLimit = strings.ToLower(rateLimit) == "true"
+		config.Security.RateLimit.Enabled = config.Features.RateLimit
+	}
+	if encryption := os.Getenv("MAGIC_FLOW_FEATURE_ENCRYPTION"); encryption != "" {
+		config.Features.Encryption = strings.ToLower(encryption) == "true"
+		config.Security.Encryption.Enabled = config.Features.Encryption
+	}
 
 	// Logging configuration
 	if logLevel := os.Getenv("MAGIC_FLOW_LOG_LEVEL"); logLevel != "" {
@@ -650,66 +711,203 @@ func loadFromEnv(config *Config) error {
 	return nil
 }
 
-// validateConfig validates the configuration
+// validateConfig validates the configuration, failing on the first error
 func validateConfig(config *Config) error {
+	if errs := validate(config); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateAll validates a configuration like LoadConfig does, syncing its
+// feature flags and setting its warnings, but returns every error found
+// rather than the first one, so they can all be fixed at once. A valid
+// configuration returns none.
+func ValidateAll(config *Config) []error {
+	return validate(config)
+}
+
+// validate runs every check of a configuration, in the order validateConfig
+// reports them, and sets its warnings
+func validate(config *Config) []error {
+	// Reconcile feature flags with their subsystems first, so the checks
+	// below see the synced configuration
+	warnings, errs := checkFeatures(config)
+	config.Warnings = warnings
+
 	// Validate server configuration
 	if config.Server.Port <= 0 || config.Server.Port > 65535 {
-		return fmt.Errorf("invalid server port: %d", config.Server.Port)
+		errs = append(errs, fmt.Errorf("invalid server port: %d", config.Server.Port))
 	}
 
 	// Validate database configuration
 	if config.Database.Host == "" {
-		return fmt.Errorf("database host is required")
+		errs = append(errs, fmt.Errorf("database host is required"))
 	}
 	if config.Database.Database == "" {
-		return fmt.Errorf("database name is required")
+		errs = append(errs, fmt.Errorf("database name is required"))
 	}
 
+	// Validate engine storage configuration
+	errs = append(errs, checkStorage(config.Engine.Storage)...)
+
 	// Validate TLS configuration
 	if config.Server.TLS.Enabled {
 		if config.Server.TLS.CertFile == "" {
-			return fmt.Errorf("TLS cert file is required when TLS is enabled")
+			errs = append(errs, fmt.Errorf("TLS cert file is required when TLS is enabled"))
+		} else if !fileExists(config.Server.TLS.CertFile) {
+			errs = append(errs, fmt.Errorf("TLS cert file does not exist: %s", config.Server.TLS.CertFile))
 		}
 		if config.Server.TLS.KeyFile == "" {
-			return fmt.Errorf("TLS key file is required when TLS is enabled")
-		}
-		if !fileExists(config.Server.TLS.CertFile) {
-			return fmt.Errorf("TLS cert file does not exist: %s", config.Server.TLS.CertFile)
-		}
-		if !fileExists(config.Server.TLS.KeyFile) {
-			return fmt.Errorf("TLS key file does not exist: %s", config.Server.TLS.KeyFile)
+			errs = append(errs, fmt.Errorf("TLS key file is required when TLS is enabled"))
+		} else if !fileExists(config.Server.TLS.KeyFile) {
+			errs = append(errs, fmt.Errorf("TLS key file does not exist: %s", config.Server.TLS.KeyFile))
 		}
 	}
 
 	// Validate JWT configuration
 	if config.Security.Authentication.Enabled && config.Security.Authentication.Provider == "jwt" {
 		if config.Security.Authentication.JWT.Secret == "" {
-			return fmt.Errorf("JWT secret is required when JWT authentication is enabled")
+			errs = append(errs, fmt.Errorf("JWT secret is required when JWT authentication is enabled"))
 		}
 	}
 
 	// Validate code generation configuration
 	if config.CodeGen.Enabled {
 		if config.CodeGen.TemplatesDir == "" {
-			return fmt.Errorf("code generation templates directory is required")
-		}
-		if !dirExists(config.CodeGen.TemplatesDir) {
-			return fmt.Errorf("code generation templates directory does not exist: %s", config.CodeGen.TemplatesDir)
+			errs = append(errs, fmt.Errorf("code generation templates directory is required"))
+		} else if !dirExists(config.CodeGen.TemplatesDir) {
+			errs = append(errs, fmt.Errorf("code generation templates directory does not exist: %s", config.CodeGen.TemplatesDir))
 		}
 	}
 
 	// Validate logging configuration
 	validLogLevels := []string{"debug", "info", "warn", "error", "fatal"}
 	if !contains(validLogLevels, config.Logging.Level) {
-		return fmt.Errorf("invalid log level: %s", config.Logging.Level)
+		errs = append(errs, fmt.Errorf("invalid log level: %s", config.Logging.Level))
 	}
 
 	validLogFormats := []string{"json", "text"}
 	if !contains(validLogFormats, config.Logging.Format) {
-		return fmt.Errorf("invalid log format: %s", config.Logging.Format)
+		errs = append(errs, fmt.Errorf("invalid log format: %s", config.Logging.Format))
+	}
+
+	// Validate the settings of the environment
+	environmentWarnings, environmentErrs := checkEnvironment(config)
+	config.Warnings = append(config.Warnings, environmentWarnings...)
+	errs = append(errs, environmentErrs...)
+
+	return errs
+}
+
+// featureSubsystem pairs a feature flag with the enable flag of the
+// subsystem it duplicates
+type featureSubsystem struct {
+	feature  string
+	key      string
+	security bool
+	flag     func(*Config) *bool
+	enabled  func(*Config) *bool
+}
+
+// featureSubsystems are the feature flags duplicated by a subsystem
+var featureSubsystems = []featureSubsystem{
+	{
+		feature: "workflow_versioning",
+		key:     "versioning.enabled",
+		flag:    func(c *Config) *bool { return &c.Features.WorkflowVersioning },
+		enabled: func(c *Config) *bool { return &c.Versioning.Enabled },
+	},
+	{
+		feature: "code_generation",
+		key:     "codegen.enabled",
+		flag:    func(c *Config) *bool { return &c.Features.CodeGeneration },
+		enabled: func(c *Config) *bool { return &c.CodeGen.Enabled },
+	},
+	{
+		feature: "dashboard",
+		key:     "dashboard.enabled",
+		flag:    func(c *Config) *bool { return &c.Features.Dashboard },
+		enabled: func(c *Config) *bool { return &c.Dashboard.Enabled },
+	},
+	{
+		feature: "metrics",
+		key:     "metrics.enabled",
+		flag:    func(c *Config) *bool { return &c.Features.Metrics },
+		enabled: func(c *Config) *bool { return &c.Metrics.Enabled },
+	},
+	{
+		feature:  "authentication",
+		key:      "security.authentication.enabled",
+		security: true,
+		flag:     func(c *Config) *bool { return &c.Features.Authentication },
+		enabled:  func(c *Config) *bool { return &c.Security.Authentication.Enabled },
+	},
+	{
+		feature:  "authorization",
+		key:      "security.authorization.enabled",
+		security: true,
+		flag:     func(c *Config) *bool { return &c.Features.Authorization },
+		enabled:  func(c *Config) *bool { return &c.Security.Authorization.Enabled },
+	},
+	{
+		feature:  "rate_limit",
+		key:      "security.rate_limit.enabled",
+		security: true,
+		flag:     func(c *Config) *bool { return &c.Features.RateLimit },
+		enabled:  func(c *Config) *bool { return &c.Security.RateLimit.Enabled },
+	},
+	{
+		feature:  "encryption",
+		key:      "security.encryption.enabled",
+		security: true,
+		flag:     func(c *Config) *bool { return &c.Features.Encryption },
+		enabled:  func(c *Config) *bool { return &c.Security.Encryption.Enabled },
+	},
+}
+
+// reconcileFeatures detects the feature flags contradicting their
+// subsystems. A contradiction of a security feature is an error, as
+// silently turning it on or off changes who can reach the server. Any other
+// contradiction is synced by turning the feature off, as one of the two
+// flags turned it off, and reported as a warning.
+func reconcileFeatures(config *Config) ([]string, error) {
+	warnings, errs := checkFeatures(config)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return warnings, nil
+}
+
+// checkFeatures reconciles the feature flags like reconcileFeatures,
+// returning every contradiction that is an error
+func checkFeatures(config *Config) ([]string, []error) {
+	var warnings []string
+	var errs []error
+	for _, pair := range featureSubsystems {
+		flag, enabled := pair.flag(config), pair.enabled(config)
+		if *flag == *enabled {
+			continue
+		}
+		if pair.security {
+			errs = append(errs, fmt.Errorf("feature flag features.%s is %t but %s is %t, set both to the same value",
+				pair.feature, *flag, pair.key, *enabled))
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("feature flag features.%s is %t but %s is %t, %s is disabled",
+			pair.feature, *flag, pair.key, *enabled, pair.feature))
+		*flag, *enabled = false, false
 	}
 
-	return nil
+	// Check the subsystems depending on another one
+	if config.Security.Authorization.Enabled && !config.Security.Authentication.Enabled {
+		errs = append(errs, fmt.Errorf("authorization requires authentication to be enabled"))
+	}
+	if config.Metrics.Prometheus.Enabled && !config.Metrics.Enabled {
+		warnings = append(warnings, "metrics.prometheus.enabled is true but metrics are disabled, prometheus is disabled")
+		config.Metrics.Prometheus.Enabled = false
+	}
+	return warnings, errs
 }
 
 // SaveConfig saves configuration to file
@@ -801,4 +999,22 @@ func (c *Config) IsFeatureEnabled(feature string) bool {
 	default:
 		return false
 	}
-}
\ No newline at end of file
+}
+
+// GetAllFeatureFlags returns the value of every feature flag
+func (c *Config) GetAllFeatureFlags() map[string]bool {
+	return map[string]bool{
+		"workflow_versioning": c.Features.WorkflowVersioning,
+		"code_generation":     c.Features.CodeGeneration,
+		"dashboard":           c.Features.Dashboard,
+		"metrics":             c.Features.Metrics,
+		"authentication":      c.Features.Authentication,
+		"authorization":       c.Features.Authorization,
+		"rate_limit":          c.Features.RateLimit,
+		"encryption":          c.Features.Encryption,
+		"audit_log":           c.Features.AuditLog,
+		"backup":              c.Features.Backup,
+		"clustering":          c.Features.Clustering,
+		"advanced_workflows":  c.Features.AdvancedWorkflows,
+	}
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReconcileFeaturesSyncsContradictions(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*Config)
+		feature func(*Config) bool
+		enabled func(*Config) bool
+	}{
+		{
+			name:    "versioning flag without versioning",
+			set:     func(c *Config) { c.Versioning.Enabled = false },
+			feature: func(c *Config) bool { return c.Features.WorkflowVersioning },
+			enabled: func(c *Config) bool { return c.Versioning.Enabled },
+		},
+		{
+			name:    "versioning without versioning flag",
+			set:     func(c *Config) { c.Features.WorkflowVersioning = false },
+			feature: func(c *Config) bool { return c.Features.WorkflowVersioning },
+			enabled: func(c *Config) bool { return c.Versioning.Enabled },
+		},
+		{
+			name:    "code generation flag without code generation",
+			set:     func(c *Config) { c.CodeGen.Enabled = false },
+			feature: func(c *Config) bool { return c.Features.CodeGeneration },
+			enabled: func(c *Config) bool { return c.CodeGen.Enabled },
+		},
+		{
+			name:    "code generation without code generation flag",
+			set:     func(c *Config) { c.Features.CodeGeneration = false },
+			feature: func(c *Config) bool { return c.Features.CodeGeneration },
+			enabled: func(c *Config) bool { return c.CodeGen.Enabled },
+		},
+		{
+			name:    "dashboard flag without dashboard",
+			set:     func(c *Config) { c.Dashboard.Enabled = false },
+			feature: func(c *Config) bool { return c.Features.Dashboard },
+			enabled: func(c *Config) bool { return c.Dashboard.Enabled },
+		},
+		{
+			name:    "dashboard without dashboard flag",
+			set:     func(c *Config) { c.Features.Dashboard = false },
+			feature: func(c *Config) bool { return c.Features.Dashboard },
+			enabled: func(c *Config) bool { return c.Dashboard.Enabled },
+		},
+		{
+			name:    "metrics flag without metrics",
+			set:     func(c *Config) { c.Metrics.Enabled = false },
+			feature: func(c *Config) bool { return c.Features.Metrics },
+			enabled: func(c *Config) bool { return c.Metrics.Enabled },
+		},
+		{
+			name:    "metrics without metrics flag",
+			set:     func(c *Config) { c.Features.Metrics = false },
+			feature: func(c *Config) bool { return c.Features.Metrics },
+			enabled: func(c *Config) bool { return c.Metrics.Enabled },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			tt.set(config)
+
+			warnings, err := reconcileFeatures(config)
+			if err != nil {
+				t.Fatalf("reconcileFeatures() error = %v", err)
+			}
+			if len(warnings) == 0 {
+				t.Fatal("expected a warning for the contradiction")
+			}
+			if tt.feature(config) || tt.enabled(config) {
+				t.Errorf("feature = %t, subsystem = %t, want both disabled", tt.feature(config), tt.enabled(config))
+			}
+		})
+	}
+}
+
+func TestReconcileFeaturesRejectsSecurityContradictions(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(*Config)
+		want string
+	}{
+		{
+			name: "authentication flag without authentication",
+			set:  func(c *Config) { c.Features.Authentication = true },
+			want: "features.authentication is true but security.authentication.enabled is false",
+		},
+		{
+			name: "authentication without authentication flag",
+			set:  func(c *Config) { c.Security.Authentication.Enabled = true },
+			want: "features.authentication is false but security.authentication.enabled is true",
+		},
+		{
+			name: "authorization flag without authorization",
+			set:  func(c *Config) { c.Features.Authorization = true },
+			want: "features.authorization is true but security.authorization.enabled is false",
+		},
+		{
+			name: "authorization without authorization flag",
+			set:  func(c *Config) { c.Security.Authorization.Enabled = true },
+			want: "features.authorization is false but security.authorization.enabled is true",
+		},
+		{
+			name: "rate limit flag without rate limiting",
+			set:  func(c *Config) { c.Features.RateLimit = true },
+			want: "features.rate_limit is true but security.rate_limit.enabled is false",
+		},
+		{
+			name: "rate limiting without rate limit flag",
+			set:  func(c *Config) { c.Security.RateLimit.Enabled = true },
+			want: "features.rate_limit is false but security.rate_limit.enabled is true",
+		},
+		{
+			name: "encryption flag without encryption",
+			set:  func(c *Config) { c.Features.Encryption = true },
+			want: "features.encryption is true but security.encryption.enabled is false",
+		},
+		{
+			name: "encryption without encryption flag",
+			set:  func(c *Config) { c.Security.Encryption.Enabled = true },
+			want: "features.encryption is false but security.encryption.enabled is true",
+		},
+		{
+			name: "authorization without authentication",
+			set: func(c *Config) {
+				c.Features.Authorization = true
+				c.Security.Authorization.Enabled = true
+			},
+			want: "authorization requires authentication",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			tt.set(config)
+
+			_, err := reconcileFeatures(config)
+			if err == nil {
+				t.Fatal("expected an error for the contradiction")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileFeaturesDisablesPrometheusWithoutMetrics(t *testing.T) {
+	config := DefaultConfig()
+	config.Features.Metrics = false
+	config.Metrics.Enabled = false
+
+	warnings, err := reconcileFeatures(config)
+	if err != nil {
+		t.Fatalf("reconcileFeatures() error = %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("warnings = %v, want one", warnings)
+	}
+	if config.Metrics.Prometheus.Enabled {
+		t.Error("expected prometheus to be disabled")
+	}
+}
+
+func TestValidateConfigReconcilesFeatures(t *testing.T) {
+	config := DefaultConfig()
+	config.CodeGen.TemplatesDir = t.TempDir()
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig() error = %v", err)
+	}
+	if len(config.Warnings) != 0 {
+		t.Errorf("warnings = %v, want none for the default config", config.Warnings)
+	}
+
+	config.Dashboard.Enabled = false
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig() error = %v", err)
+	}
+	if len(config.Warnings) != 1 || config.Features.Dashboard {
+		t.Errorf("warnings = %v, dashboard flag = %t, want the dashboard disabled with a warning", config.Warnings, config.Features.Dashboard)
+	}
+
+	config.Features.Authentication = true
+	if err := validateConfig(config); err == nil {
+		t.Error("expected the authentication contradiction to fail validation")
+	}
+}
+
+func TestLoadFromEnvSyncsFeatures(t *testing.T) {
+	t.Setenv("MAGIC_FLOW_FEATURE_VERSIONING", "false")
+	t.Setenv("MAGIC_FLOW_FEATURE_CODEGEN", "false")
+	t.Setenv("MAGIC_FLOW_FEATURE_RATE_LIMIT", "true")
+	t.Setenv("MAGIC_FLOW_FEATURE_ENCRYPTION", "true")
+
+	config := DefaultConfig()
+	if err := loadFromEnv(config); err != nil {
+		t.Fatalf("loadFromEnv() error = %v", err)
+	}
+	warnings, err := reconcileFeatures(config)
+	if err != nil {
+		t.Fatalf("reconcileFeatures() error = %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+	if config.Versioning.Enabled || config.CodeGen.Enabled {
+		t.Error("expected versioning and code generation to be disabled")
+	}
+	if !config.Security.RateLimit.Enabled || !config.Security.Encryption.Enabled {
+		t.Error("expected rate limiting and encryption to be enabled")
+	}
+}
+
+func TestValidateAllReportsEveryError(t *testing.T) {
+	newConfig := func() *Config {
+		config := DefaultConfig()
+		config.CodeGen.TemplatesDir = t.TempDir()
+		config.Server.Port = 0
+		config.Database.Host = ""
+		config.Server.TLS.Enabled = true
+		config.Server.TLS.CertFile = "/missing/cert.pem"
+		config.Security.Authorization.Enabled = true
+		config.Features.Authorization = true
+		config.Logging.Level = "loud"
+		config.Logging.Format = "xml"
+		config.Server.Mode = "fast"
+		return config
+	}
+
+	errs := ValidateAll(newConfig())
+	want := []string{
+		"authorization requires authentication",
+		"invalid server port: 0",
+		"database host is required",
+		"TLS cert file does not exist: /missing/cert.pem",
+		"TLS key file is required",
+		"invalid log level: loud",
+		"invalid log format: xml",
+		"invalid server mode: fast",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("ValidateAll() = %v, want %d errors", errs, len(want))
+	}
+	for i, substr := range want {
+		if !strings.Contains(errs[i].Error(), substr) {
+			t.Errorf("error %d = %v, want it to contain %q", i, errs[i], substr)
+		}
+	}
+
+	// The fail-fast path still reports the first error only
+	if err := validateConfig(newConfig()); err == nil || err.Error() != errs[0].Error() {
+		t.Errorf("validateConfig() error = %v, want %v", err, errs[0])
+	}
+
+	// A valid configuration has no error
+	config := DefaultConfig()
+	config.CodeGen.TemplatesDir = t.TempDir()
+	if errs := ValidateAll(config); len(errs) != 0 {
+		t.Errorf("ValidateAll() = %v, want no error", errs)
+	}
+}
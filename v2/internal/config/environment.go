@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environments with their own defaults
+const (
+	EnvironmentDevelopment = "development"
+	EnvironmentProduction  = "production"
+)
+
+// Modes of the HTTP server, as gin modes
+var serverModes = []string{"debug", "release", "test"}
+
+// DefaultConfigFor returns the default configuration of an environment.
+// Development defaults favour getting started: debug mode, CORS open to any
+// origin and no authentication. Production defaults are tightened: release
+// mode, CORS limited to the origins the config lists, rate limiting and a
+// database connection requiring TLS without a default password. Other
+// environments get the development defaults.
+func DefaultConfigFor(environment string) *Config {
+	config := DefaultConfig()
+	if environment == "" {
+		return config
+	}
+	config.Environment = environment
+
+	if environment == EnvironmentProduction {
+		config.Server.Mode = "release"
+		config.Server.CORS.AllowedOrigins = nil
+		config.Server.CORS.AllowedHeaders = []string{"Authorization", "Content-Type", "X-Request-ID"}
+		config.Database.Password = ""
+		config.Database.SSLMode = "require"
+		config.Security.RateLimit.Enabled = true
+		config.Features.RateLimit = true
+	}
+	return config
+}
+
+// configEnvironment returns the environment a configuration is loaded for:
+// MAGIC_FLOW_ENV, else the environment of the config file, else
+// development. A config file that cannot be read is reported when it is
+// loaded.
+func configEnvironment(configPath string) string {
+	if env := os.Getenv("MAGIC_FLOW_ENV"); env != "" {
+		return env
+	}
+	if configPath != "" {
+		if data, err := os.ReadFile(configPath); err == nil {
+			var file struct {
+				Environment string `yaml:"environment"`
+			}
+			if yaml.Unmarshal(data, &file) == nil && file.Environment != "" {
+				return file.Environment
+			}
+		}
+	}
+	return EnvironmentDevelopment
+}
+
+// checkEnvironment checks the settings that depend on the environment. In
+// production, CORS must list the origins it allows, and insecure settings,
+// usually left over from the development defaults, are reported as
+// warnings.
+func checkEnvironment(config *Config) ([]string, []error) {
+	var errs []error
+	if config.Server.Mode != "" && !contains(serverModes, config.Server.Mode) {
+		errs = append(errs, fmt.Errorf("invalid server mode: %s", config.Server.Mode))
+	}
+	if config.Environment != EnvironmentProduction {
+		return nil, errs
+	}
+
+	if cors := config.Server.CORS; cors.Enabled {
+		if len(cors.AllowedOrigins) == 0 {
+			errs = append(errs, fmt.Errorf("server.cors.allowed_origins is required in production when CORS is enabled"))
+		} else if contains(cors.AllowedOrigins, "*") {
+			errs = append(errs, fmt.Errorf("server.cors.allowed_origins cannot allow every origin in production"))
+		}
+	}
+
+	var warnings []string
+	if config.Server.Mode != "release" {
+		warnings = append(warnings, "server.mode is not release in production")
+	}
+	if !config.Security.Authentication.Enabled {
+		warnings = append(warnings, "authentication is disabled in production, enabling it is recommended")
+	}
+	if !config.Server.TLS.Enabled {
+		warnings = append(warnings, "TLS is disabled in production")
+	}
+	if config.Database.SSLMode == "disable" {
+		warnings = append(warnings, "database connection does not use TLS in production")
+	}
+	if config.Database.Password == "password" {
+		warnings = append(warnings, "database uses the default development password in production")
+	}
+	if !config.Security.RateLimit.Enabled {
+		warnings = append(warnings, "rate limiting is disabled in production")
+	}
+	if config.Logging.Level == "debug" {
+		warnings = append(warnings, "debug logging is enabled in production")
+	}
+	return warnings, errs
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigForProduction(t *testing.T) {
+	dev := DefaultConfigFor(EnvironmentDevelopment)
+	prod := DefaultConfigFor(EnvironmentProduction)
+
+	if dev.Server.Mode != "debug" || prod.Server.Mode != "release" {
+		t.Errorf("server mode = %q in development, %q in production, want debug and release", dev.Server.Mode, prod.Server.Mode)
+	}
+	if !contains(dev.Server.CORS.AllowedOrigins, "*") {
+		t.Errorf("development CORS origins = %v, want every origin", dev.Server.CORS.AllowedOrigins)
+	}
+	if len(prod.Server.CORS.AllowedOrigins) != 0 || contains(prod.Server.CORS.AllowedHeaders, "*") {
+		t.Errorf("production CORS origins = %v, headers = %v, want no origin and explicit headers",
+			prod.Server.CORS.AllowedOrigins, prod.Server.CORS.AllowedHeaders)
+	}
+	if dev.Database.SSLMode != "disable" || prod.Database.SSLMode != "require" {
+		t.Errorf("ssl mode = %q in development, %q in production, want disable and require", dev.Database.SSLMode, prod.Database.SSLMode)
+	}
+	if prod.Database.Password != "" {
+		t.Errorf("production database password = %q, want none", prod.Database.Password)
+	}
+	if dev.Security.RateLimit.Enabled || !prod.Security.RateLimit.Enabled || !prod.Features.RateLimit {
+		t.Error("expected rate limiting to be enabled in production only")
+	}
+	if prod.Environment != EnvironmentProduction {
+		t.Errorf("environment = %q, want production", prod.Environment)
+	}
+
+	// Other environments get the development defaults
+	staging := DefaultConfigFor("staging")
+	if staging.Environment != "staging" || staging.Server.Mode != "debug" {
+		t.Errorf("staging environment = %q, mode = %q, want the development defaults", staging.Environment, staging.Server.Mode)
+	}
+}
+
+func TestLoadConfigAppliesEnvironmentDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := "environment: production\n" +
+		"server:\n  cors:\n    allowed_origins: [\"https://flows.example.com\"]\n" +
+		"database:\n  ssl_mode: verify-full\n" +
+		"codegen:\n  templates_dir: " + dir + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file selects production: its defaults apply under the file
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.Server.Mode != "release" || !config.Security.RateLimit.Enabled {
+		t.Errorf("mode = %q, rate limit = %t, want the production defaults", config.Server.Mode, config.Security.RateLimit.Enabled)
+	}
+	if config.Database.SSLMode != "verify-full" {
+		t.Errorf("ssl mode = %q, want the file to override the default", config.Database.SSLMode)
+	}
+	if !hasWarning(config.Warnings, "authentication is disabled") || !hasWarning(config.Warnings, "TLS is disabled") {
+		t.Errorf("warnings = %v, want authentication and TLS warnings", config.Warnings)
+	}
+
+	// The environment variable takes precedence over the file
+	t.Setenv("MAGIC_FLOW_ENV", EnvironmentDevelopment)
+	config, err = LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.Server.Mode != "debug" || config.Environment != EnvironmentDevelopment || len(config.Warnings) != 0 {
+		t.Errorf("mode = %q, environment = %q, warnings = %v, want the development defaults",
+			config.Server.Mode, config.Environment, config.Warnings)
+	}
+}
+
+func TestValidateConfigProduction(t *testing.T) {
+	production := func() *Config {
+		config := DefaultConfigFor(EnvironmentProduction)
+		config.CodeGen.TemplatesDir = t.TempDir()
+		config.Server.CORS.AllowedOrigins = []string{"https://flows.example.com"}
+		return config
+	}
+
+	// CORS must list its origins
+	config := production()
+	config.Server.CORS.AllowedOrigins = nil
+	if err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "allowed_origins is required") {
+		t.Errorf("validateConfig() error = %v, want CORS origins to be required", err)
+	}
+	config.Server.CORS.AllowedOrigins = []string{"*"}
+	if err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "cannot allow every origin") {
+		t.Errorf("validateConfig() error = %v, want every origin to be rejected", err)
+	}
+	config.Server.CORS.Enabled = false
+	if err := validateConfig(config); err != nil {
+		t.Errorf("validateConfig() error = %v, want disabled CORS to need no origin", err)
+	}
+
+	// Insecure settings are warned about
+	config = production()
+	config.Server.Mode = "debug"
+	config.Database.Password = "password"
+	config.Database.SSLMode = "disable"
+	config.Security.RateLimit.Enabled = false
+	config.Features.RateLimit = false
+	config.Logging.Level = "debug"
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig() error = %v", err)
+	}
+	for _, want := range []string{"server.mode", "authentication", "TLS", "database connection", "default development password", "rate limiting", "debug logging"} {
+		if !hasWarning(config.Warnings, want) {
+			t.Errorf("warnings = %v, want one about %s", config.Warnings, want)
+		}
+	}
+
+	// Unknown server modes are rejected in every environment
+	config = DefaultConfig()
+	config.CodeGen.TemplatesDir = t.TempDir()
+	config.Server.Mode = "fast"
+	if err := validateConfig(config); err == nil {
+		t.Error("expected an unknown server mode to fail validation")
+	}
+}
+
+func hasWarning(warnings []string, substr string) bool {
+	for _, warning := range warnings {
+		if strings.Contains(warning, substr) {
+			return true
+		}
+	}
+	return false
+}
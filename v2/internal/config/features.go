@@ -0,0 +1,257 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FeatureOverrideHeader carries the feature flag overrides of a request, as
+// a comma separated list of flag=true or flag=false
+const FeatureOverrideHeader = "X-Feature-Flags"
+
+// Sources of an evaluated feature flag
+const (
+	FeatureSourceConfig = "config"
+	FeatureSourceUser   = "user"
+	FeatureSourceHeader = "header"
+)
+
+var (
+	// ErrUnknownFeatureFlag is returned when overriding a flag that does not
+	// exist
+	ErrUnknownFeatureFlag = errors.New("unknown feature flag")
+	// ErrFeatureNotOverridable is returned when overriding a security flag,
+	// which only the config sets
+	ErrFeatureNotOverridable = errors.New("feature flag cannot be overridden")
+)
+
+// FeatureSource provides the configured feature flags, such as the Manager
+// or a Config
+type FeatureSource interface {
+	GetAllFeatureFlags() map[string]bool
+}
+
+// FeatureOverrideStore holds the feature flag overrides of users
+type FeatureOverrideStore interface {
+	GetOverrides(ctx context.Context, userID string) (map[string]bool, error)
+	SetOverride(ctx context.Context, userID, flag string, enabled bool) error
+	DeleteOverride(ctx context.Context, userID, flag string) error
+}
+
+// FeatureEvaluation is the value of a feature flag for a request
+type FeatureEvaluation struct {
+	Flag    string `json:"flag"`
+	Enabled bool   `json:"enabled"`
+	// Source is where the value comes from: config, user or header
+	Source string `json:"source"`
+}
+
+// FeatureSet holds the feature flags evaluated for a request
+type FeatureSet struct {
+	flags map[string]FeatureEvaluation
+}
+
+// Enabled reports whether a feature is enabled, false for unknown flags
+func (s *FeatureSet) Enabled(flag string) bool {
+	return s.flags[flag].Enabled
+}
+
+// Evaluations returns every evaluated flag, sorted by name
+func (s *FeatureSet) Evaluations() []FeatureEvaluation {
+	evaluations := make([]FeatureEvaluation, 0, len(s.flags))
+	for _, evaluation := range s.flags {
+		evaluations = append(evaluations, evaluation)
+	}
+	sort.Slice(evaluations, func(i, j int) bool { return evaluations[i].Flag < evaluations[j].Flag })
+	return evaluations
+}
+
+// FeatureEvaluator evaluates feature flags per request, for gradual
+// rollouts. The config value is the default; the overrides of the user,
+// identified by the X-User-ID header, take precedence over it, and the
+// overrides of the X-Feature-Flags header over both. Security flags, such as
+// authentication, cannot be overridden.
+type FeatureEvaluator struct {
+	source FeatureSource
+	store  FeatureOverrideStore
+}
+
+// NewFeatureEvaluator creates a feature evaluator. store may be nil, in
+// which case only header overrides apply.
+func NewFeatureEvaluator(source FeatureSource, store FeatureOverrideStore) *FeatureEvaluator {
+	return &FeatureEvaluator{
+		source: source,
+		store:  store,
+	}
+}
+
+// Evaluate evaluates the feature flags of a request. When the user
+// overrides cannot be read the set is still returned, without them, along
+// with the error.
+func (e *FeatureEvaluator) Evaluate(r *http.Request) (*FeatureSet, error) {
+	set := &FeatureSet{flags: make(map[string]FeatureEvaluation)}
+	for flag, enabled := range e.source.GetAllFeatureFlags() {
+		set.flags[flag] = FeatureEvaluation{Flag: flag, Enabled: enabled, Source: FeatureSourceConfig}
+	}
+
+	var err error
+	if userID := r.Header.Get("X-User-ID"); e.store != nil && userID != "" {
+		var overrides map[string]bool
+		overrides, err = e.store.GetOverrides(r.Context(), userID)
+		if err != nil {
+			err = fmt.Errorf("failed to get feature overrides of user %s: %w", userID, err)
+		}
+		set.override(overrides, FeatureSourceUser)
+	}
+	set.override(parseFeatureOverrides(r.Header.Get(FeatureOverrideHeader)), FeatureSourceHeader)
+	return set, err
+}
+
+// IsEnabled reports whether a feature is enabled for a request, using the
+// flags evaluated by Middleware when it ran
+func (e *FeatureEvaluator) IsEnabled(r *http.Request, flag string) bool {
+	if set := FeaturesFromContext(r.Context()); set != nil {
+		return set.Enabled(flag)
+	}
+	set, _ := e.Evaluate(r)
+	return set.Enabled(flag)
+}
+
+// SetUserOverride overrides a feature flag for a user
+func (e *FeatureEvaluator) SetUserOverride(ctx context.Context, userID, flag string, enabled bool) error {
+	if err := e.checkOverridable(flag); err != nil {
+		return err
+	}
+	return e.store.SetOverride(ctx, userID, flag, enabled)
+}
+
+// DeleteUserOverride removes the override of a feature flag for a user, who
+// gets the config value again
+func (e *FeatureEvaluator) DeleteUserOverride(ctx context.Context, userID, flag string) error {
+	if err := e.checkOverridable(flag); err != nil {
+		return err
+	}
+	return e.store.DeleteOverride(ctx, userID, flag)
+}
+
+// Middleware evaluates the feature flags of each request and stores them in
+// its context, for FeaturesFromContext
+func (e *FeatureEvaluator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set, _ := e.Evaluate(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), featureSetKey{}, set)))
+	})
+}
+
+func (e *FeatureEvaluator) checkOverridable(flag string) error {
+	if e.store == nil {
+		return fmt.Errorf("no feature override store is configured")
+	}
+	if _, ok := e.source.GetAllFeatureFlags()[flag]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFeatureFlag, flag)
+	}
+	if !overridable(flag) {
+		return fmt.Errorf("%w: %s is a security flag", ErrFeatureNotOverridable, flag)
+	}
+	return nil
+}
+
+type featureSetKey struct{}
+
+// FeaturesFromContext returns the feature flags Middleware evaluated for a
+// request, nil if it did not run
+func FeaturesFromContext(ctx context.Context) *FeatureSet {
+	set, _ := ctx.Value(featureSetKey{}).(*FeatureSet)
+	return set
+}
+
+// override applies the overrides of known, overridable flags
+func (s *FeatureSet) override(overrides map[string]bool, source string) {
+	for flag, enabled := range overrides {
+		if _, ok := s.flags[flag]; ok && overridable(flag) {
+			s.flags[flag] = FeatureEvaluation{Flag: flag, Enabled: enabled, Source: source}
+		}
+	}
+}
+
+// overridable reports whether a flag can be overridden per request: the
+// security flags always follow the config
+func overridable(flag string) bool {
+	for _, pair := range featureSubsystems {
+		if pair.feature == flag {
+			return !pair.security
+		}
+	}
+	return true
+}
+
+// parseFeatureOverrides parses the X-Feature-Flags header, ignoring
+// malformed entries
+func parseFeatureOverrides(header string) map[string]bool {
+	overrides := make(map[string]bool)
+	for _, entry := range strings.Split(header, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(parts[1]))
+		if err != nil {
+			continue
+		}
+		overrides[strings.TrimSpace(parts[0])] = enabled
+	}
+	return overrides
+}
+
+// MemoryFeatureOverrideStore is a FeatureOverrideStore held in memory
+type MemoryFeatureOverrideStore struct {
+	mu        sync.RWMutex
+	overrides map[string]map[string]bool
+}
+
+// NewMemoryFeatureOverrideStore creates an empty in-memory override store
+func NewMemoryFeatureOverrideStore() *MemoryFeatureOverrideStore {
+	return &MemoryFeatureOverrideStore{overrides: make(map[string]map[string]bool)}
+}
+
+// GetOverrides returns the overrides of a user
+func (s *MemoryFeatureOverrideStore) GetOverrides(ctx context.Context, userID string) (map[string]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	overrides := make(map[string]bool, len(s.overrides[userID]))
+	for flag, enabled := range s.overrides[userID] {
+		overrides[flag] = enabled
+	}
+	return overrides, nil
+}
+
+// SetOverride overrides a flag for a user
+func (s *MemoryFeatureOverrideStore) SetOverride(ctx context.Context, userID, flag string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.overrides[userID] == nil {
+		s.overrides[userID] = make(map[string]bool)
+	}
+	s.overrides[userID][flag] = enabled
+	return nil
+}
+
+// DeleteOverride removes the override of a flag for a user
+func (s *MemoryFeatureOverrideStore) DeleteOverride(ctx context.Context, userID, flag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.overrides[userID], flag)
+	if len(s.overrides[userID]) == 0 {
+		delete(s.overrides, userID)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeatureEvaluatorHeaderOverride(t *testing.T) {
+	config := DefaultConfig()
+	config.Features.AdvancedWorkflows = false
+	evaluator := NewFeatureEvaluator(config, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if evaluator.IsEnabled(r, "advanced_workflows") {
+		t.Fatal("expected advanced_workflows to be disabled by the config")
+	}
+
+	r.Header.Set(FeatureOverrideHeader, "advanced_workflows=true, dashboard=false")
+	set, err := evaluator.Evaluate(r)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if !set.Enabled("advanced_workflows") {
+		t.Error("expected the header to enable advanced_workflows")
+	}
+	if set.Enabled("dashboard") {
+		t.Error("expected the header to disable the dashboard")
+	}
+	if !set.Enabled("metrics") {
+		t.Error("expected metrics to keep its config value")
+	}
+	for _, evaluation := range set.Evaluations() {
+		want := FeatureSourceConfig
+		if evaluation.Flag == "advanced_workflows" || evaluation.Flag == "dashboard" {
+			want = FeatureSourceHeader
+		}
+		if evaluation.Source != want {
+			t.Errorf("%s source = %s, want %s", evaluation.Flag, evaluation.Source, want)
+		}
+	}
+}
+
+func TestFeatureEvaluatorIgnoresInvalidOverrides(t *testing.T) {
+	config := DefaultConfig()
+	evaluator := NewFeatureEvaluator(config, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(FeatureOverrideHeader, "authentication=true,rate_limit=true,unknown=true,backup")
+	set, err := evaluator.Evaluate(r)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if set.Enabled("authentication") || set.Enabled("rate_limit") {
+		t.Error("expected security flags to ignore the header")
+	}
+	if set.Enabled("unknown") || set.Enabled("backup") {
+		t.Error("expected unknown and malformed overrides to be ignored")
+	}
+}
+
+func TestFeatureEvaluatorUserOverrides(t *testing.T) {
+	config := DefaultConfig()
+	config.Features.Clustering = false
+	evaluator := NewFeatureEvaluator(config, NewMemoryFeatureOverrideStore())
+	ctx := context.Background()
+
+	if err := evaluator.SetUserOverride(ctx, "alice", "clustering", true); err != nil {
+		t.Fatalf("SetUserOverride() error = %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-User-ID", "alice")
+	if !evaluator.IsEnabled(r, "clustering") {
+		t.Error("expected the user override to enable clustering")
+	}
+	r.Header.Set(FeatureOverrideHeader, "clustering=false")
+	if evaluator.IsEnabled(r, "clustering") {
+		t.Error("expected the header to take precedence over the user override")
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "/", nil)
+	other.Header.Set("X-User-ID", "bob")
+	if evaluator.IsEnabled(other, "clustering") {
+		t.Error("expected other users to get the config value")
+	}
+
+	if err := evaluator.DeleteUserOverride(ctx, "alice", "clustering"); err != nil {
+		t.Fatalf("DeleteUserOverride() error = %v", err)
+	}
+	r.Header.Del(FeatureOverrideHeader)
+	if evaluator.IsEnabled(r, "clustering") {
+		t.Error("expected the config value once the override is deleted")
+	}
+
+	if err := evaluator.SetUserOverride(ctx, "alice", "encryption", true); !errors.Is(err, ErrFeatureNotOverridable) {
+		t.Errorf("SetUserOverride(encryption) error = %v, want ErrFeatureNotOverridable", err)
+	}
+	if err := evaluator.SetUserOverride(ctx, "alice", "unknown", true); !errors.Is(err, ErrUnknownFeatureFlag) {
+		t.Errorf("SetUserOverride(unknown) error = %v, want ErrUnknownFeatureFlag", err)
+	}
+}
+
+func TestFeatureEvaluatorMiddleware(t *testing.T) {
+	config := DefaultConfig()
+	config.Features.Backup = false
+	evaluator := NewFeatureEvaluator(config, nil)
+
+	var enabled bool
+	handler := evaluator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enabled = FeaturesFromContext(r.Context()).Enabled("backup")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(FeatureOverrideHeader, "backup=true")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if !enabled {
+		t.Error("expected the handler to see the header override")
+	}
+}
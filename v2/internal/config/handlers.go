@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 type Handlers struct {
 	manager         *Manager
 	templateManager *TemplateManager
+	evaluator       *FeatureEvaluator
 }
 
 // NewHandlers creates new configuration handlers
@@ -21,6 +23,7 @@ func NewHandlers(manager *Manager, templateManager *TemplateManager) *Handlers {
 	return &Handlers{
 		manager:         manager,
 		templateManager: templateManager,
+		evaluator:       NewFeatureEvaluator(manager, NewMemoryFeatureOverrideStore()),
 	}
 }
 
@@ -43,9 +46,12 @@ func (h *Handlers) RegisterRoutes(router *mux.Router) {
 
 	// Feature flag endpoints
 	configRouter.HandleFunc("/features", h.GetFeatureFlags).Methods("GET")
+	configRouter.HandleFunc("/features/evaluate", h.EvaluateFeatureFlags).Methods("GET")
 	configRouter.HandleFunc("/features/{flag}", h.GetFeatureFlag).Methods("GET")
 	configRouter.HandleFunc("/features/{flag}", h.SetFeatureFlag).Methods("PUT")
 	configRouter.HandleFunc("/features/bulk", h.UpdateFeatureFlags).Methods("PUT")
+	configRouter.HandleFunc("/features/{flag}/overrides/{user}", h.SetFeatureOverride).Methods("PUT")
+	configRouter.HandleFunc("/features/{flag}/overrides/{user}", h.DeleteFeatureOverride).Methods("DELETE")
 
 	// Template endpoints
 	templateRouter := configRouter.PathPrefix("/templates").Subrouter()
@@ -113,10 +119,11 @@ func (h *Handlers) ValidateConfig(w http.ResponseWriter, r *http.Request) {
 		ValidatedAt: time.Now(),
 	}
 
-	if err := validateConfig(&config); err != nil {
+	for _, err := range ValidateAll(&config) {
 		validationResult.Valid = false
 		validationResult.Errors = append(validationResult.Errors, err.Error())
 	}
+	validationResult.Warnings = append(validationResult.Warnings, config.Warnings...)
 
 	// Add additional validation checks
 	h.performAdditionalValidation(&config, validationResult)
@@ -287,6 +294,67 @@ func (h *Handlers) UpdateFeatureFlags(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Evaluator returns the feature evaluator of the handlers, whose
+// Middleware evaluates the feature flags of requests
+func (h *Handlers) Evaluator() *FeatureEvaluator {
+	return h.evaluator
+}
+
+// EvaluateFeatureFlags returns the feature flags evaluated for the request,
+// with the overrides of its user and X-Feature-Flags header
+func (h *Handlers) EvaluateFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	set, err := h.evaluator.Evaluate(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to evaluate feature flags: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"features": set.Evaluations(),
+	})
+}
+
+// SetFeatureOverride overrides a feature flag for a user
+func (h *Handlers) SetFeatureOverride(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	flag, user := vars["flag"], vars["user"]
+
+	var request struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.evaluator.SetUserOverride(r.Context(), user, flag, request.Enabled); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to set feature override: %v", err), featureOverrideStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"flag":    flag,
+		"user":    user,
+		"enabled": request.Enabled,
+	})
+}
+
+// DeleteFeatureOverride removes the override of a feature flag for a user
+func (h *Handlers) DeleteFeatureOverride(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	flag, user := vars["flag"], vars["user"]
+
+	if err := h.evaluator.DeleteUserOverride(r.Context(), user, flag); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete feature override: %v", err), featureOverrideStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Template handlers
 
 // ListTemplates returns all configuration templates
@@ -431,19 +499,6 @@ func (h *Handlers) performAdditionalValidation(config *Config, result *Validatio
 		result.Warnings = append(result.Warnings, "High number of concurrent workflows may impact system resources")
 	}
 
-	// Check for development vs production settings
-	if config.Environment == "production" {
-		if config.Logging.Level == "debug" {
-			result.Warnings = append(result.Warnings, "Debug logging enabled in production environment")
-		}
-		if !config.Server.TLS.Enabled {
-			result.Warnings = append(result.Warnings, "TLS not enabled in production environment")
-		}
-		if !config.Security.Authentication.Enabled {
-			result.Warnings = append(result.Warnings, "Authentication not enabled in production environment")
-		}
-	}
-
 	// Check for feature flag consistency
 	if config.Features.Authentication && !config.Security.Authentication.Enabled {
 		result.Errors = append(result.Errors, "Authentication feature flag enabled but authentication not configured")
@@ -465,6 +520,17 @@ func getUserID(r *http.Request) string {
 	return "anonymous"
 }
 
+func featureOverrideStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnknownFeatureFlag):
+		return http.StatusNotFound
+	case errors.Is(err, ErrFeatureNotOverridable):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func parseQueryBool(r *http.Request, key string, defaultValue bool) bool {
 	value := r.URL.Query().Get(key)
 	if value == "" {
@@ -186,6 +186,13 @@ func (m *Manager) SetFeatureFlag(flag string, enabled bool) error {
 		return fmt.Errorf("unknown feature flag: %s", flag)
 	}
 
+	// Keep the subsystem duplicating the flag in sync
+	for _, pair := range featureSubsystems {
+		if pair.feature == flag {
+			*pair.enabled(&newConfig) = enabled
+		}
+	}
+
 	return m.UpdateConfig(&newConfig)
 }
 
@@ -194,20 +201,7 @@ func (m *Manager) GetAllFeatureFlags() map[string]bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return map[string]bool{
-		"workflow_versioning": m.config.Features.WorkflowVersioning,
-		"code_generation":     m.config.Features.CodeGeneration,
-		"dashboard":           m.config.Features.Dashboard,
-		"metrics":             m.config.Features.Metrics,
-		"authentication":      m.config.Features.Authentication,
-		"authorization":       m.config.Features.Authorization,
-		"rate_limit":          m.config.Features.RateLimit,
-		"encryption":          m.config.Features.Encryption,
-		"audit_log":           m.config.Features.AuditLog,
-		"backup":              m.config.Features.Backup,
-		"clustering":          m.config.Features.Clustering,
-		"advanced_workflows":  m.config.Features.AdvancedWorkflows,
-	}
+	return m.config.GetAllFeatureFlags()
 }
 
 // ValidateCurrentConfig validates the current configuration
@@ -141,6 +141,7 @@ func (s *Service) ValidateConfig(config *Config) *ValidationResult {
 		result.Valid = false
 		result.Errors = append(result.Errors, err.Error())
 	}
+	result.Warnings = append(result.Warnings, config.Warnings...)
 
 	// Perform additional validation
 	s.performServiceValidation(config, result)
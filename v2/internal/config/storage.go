@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Built-in storage types of the engine
+const (
+	StorageDatabase = "database"
+	StorageMemory   = "memory"
+	StorageFile     = "file"
+	StorageS3       = "s3"
+)
+
+// storageDriver is a storage type with the keys its config requires
+type storageDriver struct {
+	required []string
+	// optional drivers may run with an empty config, falling back to
+	// settings of the server
+	optional bool
+}
+
+// storageDrivers are the built-in storage types. Database storage without
+// config uses the application database, with config it needs its own DSN.
+var storageDrivers = map[string]storageDriver{
+	StorageDatabase: {required: []string{"dsn"}, optional: true},
+	StorageMemory:   {},
+	StorageFile:     {required: []string{"path"}},
+	StorageS3:       {required: []string{"bucket", "region"}},
+}
+
+// checkStorage checks the config of the engine storage against the keys its
+// type requires, which must be non-empty strings, so that misconfigured
+// backends are reported at load rather than when first used
+func checkStorage(storage StorageConfig) []error {
+	driver, ok := storageDrivers[storage.Type]
+	if !ok {
+		types := make([]string, 0, len(storageDrivers))
+		for name := range storageDrivers {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+		return []error{fmt.Errorf("invalid engine.storage.type %q, expected one of %s", storage.Type, strings.Join(types, ", "))}
+	}
+	if driver.optional && len(storage.Config) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, key := range driver.required {
+		value, ok := storage.Config[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("engine.storage.config.%s is required for %s storage", key, storage.Type))
+			continue
+		}
+		if s, isString := value.(string); !isString || strings.TrimSpace(s) == "" {
+			errs = append(errs, fmt.Errorf("engine.storage.config.%s must be a non-empty string for %s storage", key, storage.Type))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckStorageRequiredKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage StorageConfig
+		want    []string
+	}{
+		{
+			name:    "database without config uses the application database",
+			storage: StorageConfig{Type: StorageDatabase},
+		},
+		{
+			name:    "database with config",
+			storage: StorageConfig{Type: StorageDatabase, Config: map[string]interface{}{"dsn": "postgres://flows@db/storage"}},
+		},
+		{
+			name:    "database without dsn",
+			storage: StorageConfig{Type: StorageDatabase, Config: map[string]interface{}{"max_connections": 5}},
+			want:    []string{"engine.storage.config.dsn is required for database storage"},
+		},
+		{
+			name:    "memory",
+			storage: StorageConfig{Type: StorageMemory},
+		},
+		{
+			name:    "file",
+			storage: StorageConfig{Type: StorageFile, Config: map[string]interface{}{"path": "/var/lib/magic-flow"}},
+		},
+		{
+			name:    "file without path",
+			storage: StorageConfig{Type: StorageFile},
+			want:    []string{"engine.storage.config.path is required for file storage"},
+		},
+		{
+			name:    "s3",
+			storage: StorageConfig{Type: StorageS3, Config: map[string]interface{}{"bucket": "flows", "region": "eu-west-1"}},
+		},
+		{
+			name:    "s3 without bucket and region",
+			storage: StorageConfig{Type: StorageS3, Config: map[string]interface{}{"endpoint": "https://s3.example.com"}},
+			want: []string{
+				"engine.storage.config.bucket is required for s3 storage",
+				"engine.storage.config.region is required for s3 storage",
+			},
+		},
+		{
+			name:    "s3 with empty region",
+			storage: StorageConfig{Type: StorageS3, Config: map[string]interface{}{"bucket": "flows", "region": " "}},
+			want:    []string{"engine.storage.config.region must be a non-empty string for s3 storage"},
+		},
+		{
+			name:    "s3 with bucket of another type",
+			storage: StorageConfig{Type: StorageS3, Config: map[string]interface{}{"bucket": 42, "region": "eu-west-1"}},
+			want:    []string{"engine.storage.config.bucket must be a non-empty string for s3 storage"},
+		},
+		{
+			name:    "unknown type",
+			storage: StorageConfig{Type: "gcs"},
+			want:    []string{`invalid engine.storage.type "gcs", expected one of database, file, memory, s3`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := checkStorage(tt.storage)
+			if len(errs) != len(tt.want) {
+				t.Fatalf("checkStorage() = %v, want %d errors", errs, len(tt.want))
+			}
+			for i, err := range errs {
+				if err.Error() != tt.want[i] {
+					t.Errorf("error %d = %q, want %q", i, err.Error(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfigStorage(t *testing.T) {
+	config := DefaultConfig()
+	config.Engine.Storage = StorageConfig{Type: StorageS3, Config: map[string]interface{}{"bucket": "flows"}}
+
+	err := validateConfig(config)
+	if err == nil || !strings.Contains(err.Error(), "engine.storage.config.region") {
+		t.Fatalf("validateConfig() error = %v, want the missing region", err)
+	}
+}
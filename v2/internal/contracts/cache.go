@@ -0,0 +1,46 @@
+package contracts
+
+import "sync"
+
+// Cache caches compiled response schemas, so the schema of each step of a
+// workflow version is compiled once
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[string]*Schema
+}
+
+// NewCache creates an empty schema cache
+func NewCache() *Cache {
+	return &Cache{entries: make(map[string]*Schema)}
+}
+
+// Compile returns the cached schema for key, compiling definition on first
+// use. Compile errors are not cached.
+func (c *Cache) Compile(key string, definition map[string]interface{}) (*Schema, error) {
+	c.mu.RLock()
+	schema, exists := c.entries[key]
+	c.mu.RUnlock()
+	if exists {
+		return schema, nil
+	}
+
+	schema, err := Compile(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, exists := c.entries[key]; exists {
+		return cached, nil
+	}
+	c.entries[key] = schema
+	return schema, nil
+}
+
+// Len returns the number of cached schemas
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
@@ -0,0 +1,321 @@
+// Package contracts checks the responses of http steps against the response
+// schemas of their configs. Downstream services changing the shape of their
+// responses then fail the step calling them, with the fields that changed,
+// rather than steps further on with mapping errors.
+//
+// Response schemas are a subset of JSON schema: type, which may list
+// several types such as ["string", "null"], properties, required, items and
+// additionalProperties.
+package contracts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidSchema is returned for response schemas that do not compile
+	ErrInvalidSchema = errors.New("invalid response schema")
+	// ErrViolation is wrapped by the errors of responses violating their
+	// contract
+	ErrViolation = errors.New("response contract violated")
+)
+
+// JSON types of response schemas
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+	TypeObject  = "object"
+	TypeNull    = "null"
+)
+
+// Kinds of violations
+const (
+	// KindMissing is a required field the response lacks
+	KindMissing = "missing"
+	// KindType is a value of another type than the schema's
+	KindType = "type"
+	// KindUnexpected is a field of an object whose schema forbids
+	// additional properties
+	KindUnexpected = "unexpected"
+)
+
+// Schema is a compiled response schema
+type Schema struct {
+	types      []string
+	properties map[string]*Schema
+	// propertyNames are the names of the properties in sorted order
+	propertyNames []string
+	required      []string
+	items         *Schema
+	// closed forbids the properties that are not defined
+	closed bool
+}
+
+// Compile compiles a response schema. The error wraps ErrInvalidSchema and
+// names the invalid keyword.
+func Compile(definition map[string]interface{}) (*Schema, error) {
+	schema, err := compile(definition, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return schema, nil
+}
+
+func compile(definition map[string]interface{}, path string) (*Schema, error) {
+	schema := &Schema{}
+
+	switch value := definition["type"].(type) {
+	case nil:
+	case string:
+		schema.types = []string{value}
+	case []interface{}:
+		for _, item := range value {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: type must list type names", at(path))
+			}
+			schema.types = append(schema.types, name)
+		}
+	default:
+		return nil, fmt.Errorf("%s: type must be a type name or a list of them", at(path))
+	}
+	for _, name := range schema.types {
+		switch name {
+		case TypeString, TypeNumber, TypeInteger, TypeBoolean, TypeArray, TypeObject, TypeNull:
+		default:
+			return nil, fmt.Errorf("%s: unknown type %q", at(path), name)
+		}
+	}
+
+	if value, exists := definition["properties"]; exists {
+		properties, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: properties must be an object", at(path))
+		}
+		schema.properties = make(map[string]*Schema, len(properties))
+		for name, value := range properties {
+			property, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: property schema must be an object", at(join(path, name)))
+			}
+			compiled, err := compile(property, join(path, name))
+			if err != nil {
+				return nil, err
+			}
+			schema.properties[name] = compiled
+			schema.propertyNames = append(schema.propertyNames, name)
+		}
+		sort.Strings(schema.propertyNames)
+	}
+
+	if value, exists := definition["required"]; exists {
+		required, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: required must list field names", at(path))
+		}
+		for _, item := range required {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: required must list field names", at(path))
+			}
+			schema.required = append(schema.required, name)
+		}
+	}
+
+	if value, exists := definition["items"]; exists {
+		items, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: items must be a schema", at(path))
+		}
+		compiled, err := compile(items, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		schema.items = compiled
+	}
+
+	switch value := definition["additionalProperties"].(type) {
+	case nil:
+	case bool:
+		schema.closed = !value
+	default:
+		return nil, fmt.Errorf("%s: additionalProperties must be a boolean", at(path))
+	}
+
+	return schema, nil
+}
+
+// Violation is a difference between a response and its contract
+type Violation struct {
+	// Path is the path of the field in the response body, such as
+	// data.items[0].price, empty for the body itself
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// Message describes the violation
+func (v Violation) Message() string {
+	switch v.Kind {
+	case KindMissing:
+		return fmt.Sprintf("missing field %s", v.Path)
+	case KindUnexpected:
+		return fmt.Sprintf("unexpected field %s", v.Path)
+	default:
+		return fmt.Sprintf("%s must be %s, got %s", describe(v.Path), v.Expected, v.Actual)
+	}
+}
+
+// CheckBody parses a response body as JSON and checks it against the
+// schema. Bodies that are not JSON violate every schema.
+func (s *Schema) CheckBody(data []byte) (interface{}, []Violation) {
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		expected := "JSON"
+		if len(s.types) > 0 {
+			expected = strings.Join(s.types, " or ")
+		}
+		return nil, []Violation{{Kind: KindType, Expected: expected, Actual: "a body that is not JSON"}}
+	}
+	return body, s.Check(body)
+}
+
+// Check checks a parsed response body against the schema. Violations are
+// returned in the order of the fields of the schema, missing fields first.
+func (s *Schema) Check(body interface{}) []Violation {
+	var violations []Violation
+	s.check(body, "", &violations)
+	return violations
+}
+
+func (s *Schema) check(value interface{}, path string, violations *[]Violation) {
+	if len(s.types) > 0 && !s.accepts(value) {
+		*violations = append(*violations, Violation{
+			Path:     path,
+			Kind:     KindType,
+			Expected: strings.Join(s.types, " or "),
+			Actual:   TypeOf(value),
+		})
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, exists := v[name]; !exists {
+				*violations = append(*violations, Violation{Path: join(path, name), Kind: KindMissing})
+			}
+		}
+		for _, name := range s.propertyNames {
+			if field, exists := v[name]; exists {
+				s.properties[name].check(field, join(path, name), violations)
+			}
+		}
+		if s.closed {
+			names := make([]string, 0, len(v))
+			for name := range v {
+				if _, defined := s.properties[name]; !defined {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				*violations = append(*violations, Violation{Path: join(path, name), Kind: KindUnexpected})
+			}
+		}
+	case []interface{}:
+		if s.items != nil {
+			for i, item := range v {
+				s.items.check(item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	}
+}
+
+// accepts reports whether a value has one of the types of the schema
+func (s *Schema) accepts(value interface{}) bool {
+	actual := TypeOf(value)
+	for _, expected := range s.types {
+		if expected == actual || (expected == TypeNumber && actual == TypeInteger) {
+			return true
+		}
+	}
+	return false
+}
+
+// TypeOf returns the JSON type of a parsed JSON value. Numbers without a
+// fractional part are integers.
+func TypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return TypeNull
+	case string:
+		return TypeString
+	case bool:
+		return TypeBoolean
+	case float64:
+		if v == math.Trunc(v) {
+			return TypeInteger
+		}
+		return TypeNumber
+	case int, int32, int64:
+		return TypeInteger
+	case float32:
+		return TypeNumber
+	case []interface{}:
+		return TypeArray
+	case map[string]interface{}:
+		return TypeObject
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// ViolationError fails the http steps whose response violates their
+// contract. It wraps ErrViolation.
+type ViolationError struct {
+	StepID     string
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message()
+	}
+	return fmt.Sprintf("step %s: %v: %s", e.StepID, ErrViolation, strings.Join(messages, "; "))
+}
+
+func (e *ViolationError) Unwrap() error {
+	return ErrViolation
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func at(path string) string {
+	if path == "" {
+		return "schema"
+	}
+	return "schema of " + path
+}
+
+func describe(path string) string {
+	if path == "" {
+		return "response body"
+	}
+	return "field " + path
+}
@@ -0,0 +1,133 @@
+package contracts
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orderSchema is the contract of an orders service response
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "status", "items"],
+	"properties": {
+		"id": {"type": "string"},
+		"status": {"type": "string"},
+		"coupon": {"type": ["string", "null"]},
+		"total": {"type": "number"},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["sku", "quantity"],
+				"properties": {"sku": {"type": "string"}, "quantity": {"type": "integer"}}
+			}
+		}
+	}
+}`
+
+func decode(t *testing.T, document string) map[string]interface{} {
+	t.Helper()
+	var value map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(document), &value))
+	return value
+}
+
+func compileOrder(t *testing.T) *Schema {
+	t.Helper()
+	schema, err := Compile(decode(t, orderSchema))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestCheck(t *testing.T) {
+	schema := compileOrder(t)
+
+	for name, tc := range map[string]struct {
+		body       string
+		violations []Violation
+	}{
+		"conforming": {
+			body: `{"id": "o-1", "status": "paid", "coupon": null, "total": 12.5, "items": [{"sku": "a", "quantity": 2}], "extra": true}`,
+		},
+		"missing fields": {
+			body: `{"id": "o-1", "items": [{"sku": "a"}]}`,
+			violations: []Violation{
+				{Path: "status", Kind: KindMissing},
+				{Path: "items[0].quantity", Kind: KindMissing},
+			},
+		},
+		"wrong types": {
+			body: `{"id": 1, "status": "paid", "total": "12.50", "items": [{"sku": "a", "quantity": 1.5}]}`,
+			violations: []Violation{
+				{Path: "id", Kind: KindType, Expected: "string", Actual: "integer"},
+				{Path: "items[0].quantity", Kind: KindType, Expected: "integer", Actual: "number"},
+				{Path: "total", Kind: KindType, Expected: "number", Actual: "string"},
+			},
+		},
+		"wrong body type": {
+			body:       `[{"id": "o-1"}]`,
+			violations: []Violation{{Kind: KindType, Expected: "object", Actual: "array"}},
+		},
+	} {
+		var body interface{}
+		require.NoError(t, json.Unmarshal([]byte(tc.body), &body))
+		assert.Equal(t, tc.violations, schema.Check(body), name)
+	}
+
+	body, violations := schema.CheckBody([]byte("<html>maintenance</html>"))
+	assert.Nil(t, body)
+	assert.Equal(t, []Violation{{Kind: KindType, Expected: "object", Actual: "a body that is not JSON"}}, violations)
+}
+
+func TestClosedSchema(t *testing.T) {
+	schema, err := Compile(decode(t, `{"type": "object", "properties": {"id": {"type": "string"}}, "additionalProperties": false}`))
+	require.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Path: "name", Kind: KindUnexpected},
+		{Path: "total", Kind: KindUnexpected},
+	}, schema.Check(map[string]interface{}{"id": "o-1", "total": 3.0, "name": "x"}))
+}
+
+func TestCompileErrors(t *testing.T) {
+	for definition, message := range map[string]string{
+		`{"type": "decimal"}`: `schema: unknown type "decimal"`,
+		`{"type": 3}`:         "schema: type must be a type name or a list of them",
+		`{"properties": {"total": {"type": "money"}}}`:              `schema of total: unknown type "money"`,
+		`{"properties": {"items": {"items": {"type": "thing"}}}}`:   `schema of items[]: unknown type "thing"`,
+		`{"properties": {"id": "string"}}`:                          "schema of id: property schema must be an object",
+		`{"required": "id"}`:                                        "schema: required must list field names",
+		`{"additionalProperties": {"type": "string"}}`:              "schema: additionalProperties must be a boolean",
+		`{"properties": {"a": {"properties": {"b": {"type": 1}}}}}`: "schema of a.b: type must be a type name or a list of them",
+	} {
+		_, err := Compile(decode(t, definition))
+		assert.ErrorIs(t, err, ErrInvalidSchema, definition)
+		assert.ErrorContains(t, err, message, definition)
+	}
+}
+
+func TestViolationError(t *testing.T) {
+	err := error(&ViolationError{StepID: "fetch-order", Violations: []Violation{
+		{Path: "status", Kind: KindMissing},
+		{Path: "total", Kind: KindType, Expected: "number", Actual: "string"},
+		{Kind: KindType, Expected: "object", Actual: "array"},
+	}})
+	assert.True(t, errors.Is(err, ErrViolation))
+	assert.EqualError(t, err, "step fetch-order: response contract violated: missing field status; field total must be number, got string; response body must be object, got array")
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache()
+	first, err := cache.Compile("orders@1.0.0/fetch", decode(t, orderSchema))
+	require.NoError(t, err)
+	second, err := cache.Compile("orders@1.0.0/fetch", nil)
+	require.NoError(t, err)
+	assert.Same(t, first, second, "schemas are compiled once per key")
+
+	_, err = cache.Compile("orders@1.1.0/fetch", decode(t, `{"type": "money"}`))
+	assert.ErrorIs(t, err, ErrInvalidSchema)
+	assert.Equal(t, 1, cache.Len(), "compile errors are not cached")
+}
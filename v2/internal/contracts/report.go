@@ -0,0 +1,27 @@
+package contracts
+
+// Report is the outcome of a contract test: one call of a step, made
+// outside any execution, checked against the contract of the step
+type Report struct {
+	StepID     string      `json:"step_id"`
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	DurationMs int64       `json:"duration_ms"`
+	Conforms   bool        `json:"conforms"`
+	Violations []Violation `json:"violations"`
+	// Body is the parsed response body, absent when it is not JSON
+	Body interface{} `json:"body,omitempty"`
+}
+
+// NewReport reports on a response body checked against a contract
+func NewReport(body interface{}, violations []Violation) *Report {
+	if violations == nil {
+		violations = []Violation{}
+	}
+	return &Report{
+		Conforms:   len(violations) == 0,
+		Violations: violations,
+		Body:       body,
+	}
+}
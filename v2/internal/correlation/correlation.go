@@ -0,0 +1,111 @@
+// Package correlation carries a correlation ID from the API request that
+// started an execution through its steps, logs, events and outbound calls.
+// Unlike tracing it is a single opaque ID shared by everything a business
+// transaction causes, including the child executions it spawns.
+package correlation
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Header is the header carrying the correlation ID on API requests, their
+// responses and outbound calls
+const Header = "X-Correlation-ID"
+
+// Field is the log field and payload key holding the correlation ID
+const Field = "correlation_id"
+
+// validID matches correlation IDs accepted from callers. Other values are
+// replaced so that logs and headers never carry arbitrary input.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+type idKey struct{}
+
+type loggerKey struct{}
+
+// NewID generates a correlation ID
+func NewID() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether a correlation ID may be accepted from a caller
+func Valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+// WithID returns a context carrying a correlation ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// FromContext returns the correlation ID carried by a context, or an empty
+// string when there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Ensure returns a context carrying a correlation ID, generating one when the
+// context has none
+func Ensure(ctx context.Context) (context.Context, string) {
+	if id := FromContext(ctx); id != "" {
+		return ctx, id
+	}
+	id := NewID()
+	return WithID(ctx, id), id
+}
+
+// WithLogger returns a context carrying a request-scoped logger
+func WithLogger(ctx context.Context, logger *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the request-scoped logger of a context. Without one it
+// derives an entry from fallback tagged with the correlation ID, if any.
+func Logger(ctx context.Context, fallback *logrus.Logger) *logrus.Entry {
+	if logger, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok && logger != nil {
+		return logger
+	}
+	if fallback == nil {
+		fallback = logrus.StandardLogger()
+	}
+	if id := FromContext(ctx); id != "" {
+		return fallback.WithField(Field, id)
+	}
+	return logrus.NewEntry(fallback)
+}
+
+// SetHeader sets the correlation header of an outbound request from the
+// context, keeping a header set explicitly by the caller
+func SetHeader(ctx context.Context, header http.Header) {
+	if id := FromContext(ctx); id != "" && header.Get(Header) == "" {
+		header.Set(Header, id)
+	}
+}
+
+// Middleware accepts the correlation ID of a request from the Header header,
+// generating one when it is absent or invalid. The ID and a logger tagged
+// with it are added to the request context and the ID is echoed in the
+// response.
+func Middleware(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !Valid(id) {
+			id = NewID()
+		}
+
+		ctx := WithID(c.Request.Context(), id)
+		ctx = WithLogger(ctx, Logger(ctx, logger))
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(Field, id)
+		c.Header(Header, id)
+
+		c.Next()
+	}
+}
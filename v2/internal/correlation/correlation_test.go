@@ -0,0 +1,130 @@
+package correlation
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, hook := test.NewNullLogger()
+
+	router := gin.New()
+	router.Use(Middleware(logger))
+	router.GET("/ping", func(c *gin.Context) {
+		Logger(c.Request.Context(), nil).Info("ping")
+		c.String(http.StatusOK, FromContext(c.Request.Context()))
+	})
+
+	request := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if header != "" {
+			req.Header.Set(Header, header)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("accepts the caller's ID", func(t *testing.T) {
+		rec := request("order-42")
+		assert.Equal(t, "order-42", rec.Body.String())
+		assert.Equal(t, "order-42", rec.Header().Get(Header))
+		assert.Equal(t, "order-42", hook.LastEntry().Data[Field], "the request-scoped logger is tagged")
+	})
+
+	t.Run("generates a missing ID", func(t *testing.T) {
+		rec := request("")
+		assert.True(t, Valid(rec.Body.String()))
+		assert.Equal(t, rec.Body.String(), rec.Header().Get(Header))
+	})
+
+	t.Run("replaces an invalid ID", func(t *testing.T) {
+		rec := request("bad id\r\n" + strings.Repeat("x", 200))
+		assert.NotContains(t, rec.Body.String(), "bad")
+		assert.True(t, Valid(rec.Body.String()))
+	})
+}
+
+func TestPropagation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, hook := test.NewNullLogger()
+
+	var mu sync.Mutex
+	var downstream []string
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		downstream = append(downstream, r.Header.Get(Header))
+		mu.Unlock()
+	}))
+	defer service.Close()
+
+	// call makes an outbound call the way HTTP steps do
+	call := func(ctx context.Context, url string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		require.NoError(t, err)
+		SetHeader(ctx, req.Header)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	// The parent execution calls the downstream service and starts a
+	// sub-workflow through the API, which calls the service again
+	var api *httptest.Server
+	router := gin.New()
+	router.Use(Middleware(logger))
+	router.POST("/execute", func(c *gin.Context) {
+		ctx, _ := Ensure(c.Request.Context())
+		Logger(ctx, nil).WithField("child", c.Query("child")).Info("execution started")
+
+		call(ctx, service.URL)
+		if c.Query("child") == "" {
+			call(ctx, api.URL+"/execute?child=1")
+		}
+		c.Status(http.StatusAccepted)
+	})
+	api = httptest.NewServer(router)
+	defer api.Close()
+
+	req, err := http.NewRequest(http.MethodPost, api.URL+"/execute", nil)
+	require.NoError(t, err)
+	req.Header.Set(Header, "checkout-7")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "checkout-7", resp.Header.Get(Header))
+	assert.Equal(t, []string{"checkout-7", "checkout-7"}, downstream, "parent and sub-workflow calls carry the ID")
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, "checkout-7", entry.Data[Field])
+	}
+
+	t.Run("explicit header wins", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(Header, "explicit")
+		SetHeader(WithID(context.Background(), "ctx"), header)
+		assert.Equal(t, "explicit", header.Get(Header))
+	})
+
+	t.Run("fallback logger", func(t *testing.T) {
+		fallback := logrus.New()
+		assert.Empty(t, Logger(context.Background(), fallback).Data)
+		assert.Equal(t, "ctx", Logger(WithID(context.Background(), "ctx"), fallback).Data[Field])
+	})
+}
@@ -425,6 +425,11 @@ func (h *Handlers) HandleWebSocket(c *gin.Context) {
 
 	defer h.service.UnsubscribeFromRealtimeUpdates(clientID)
 
+	// Send the running executions first, from status snapshots
+	if err := conn.WriteJSON(h.service.GetInitialState()); err != nil {
+		return
+	}
+
 	// Handle WebSocket messages
 	go func() {
 		for {
@@ -6,23 +6,82 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 
 	"magic-flow/v2/internal/database"
+	"magic-flow/v2/internal/scheduler"
 	"magic-flow/v2/pkg/models"
 )
 
 // MetricsCollector handles metrics collection and aggregation
 type MetricsCollector struct {
 	repoManager database.RepositoryManager
+	clock       scheduler.Clock
+	probe       SystemProbe
+	logger      *logrus.Logger
+}
+
+// SystemProbe samples the load and resource usage of the host the
+// dashboard reports on
+type SystemProbe interface {
+	SystemLoad(ctx context.Context) (SystemLoadMetrics, error)
+	ResourceUsage(ctx context.Context) (ResourceUsageMetrics, error)
+}
+
+// MetricsCollectorOptions are the dependencies of a metrics collector. Nil
+// fields take their defaults: the system clock, a probe reporting
+// placeholder values and the standard logger.
+type MetricsCollectorOptions struct {
+	RepoManager database.RepositoryManager
+	// Clock tells the time time ranges end at and metrics are generated at
+	Clock  scheduler.Clock
+	Probe  SystemProbe
+	Logger *logrus.Logger
 }
 
 // NewMetricsCollector creates a new metrics collector
-func NewMetricsCollector(repoManager database.RepositoryManager) *MetricsCollector {
+func NewMetricsCollector(options MetricsCollectorOptions) *MetricsCollector {
+	if options.Clock == nil {
+		options.Clock = scheduler.NewRealClock()
+	}
+	if options.Probe == nil {
+		options.Probe = placeholderProbe{}
+	}
+	if options.Logger == nil {
+		options.Logger = logrus.StandardLogger()
+	}
 	return &MetricsCollector{
-		repoManager: repoManager,
+		repoManager: options.RepoManager,
+		clock:       options.Clock,
+		probe:       options.Probe,
+		logger:      options.Logger,
 	}
 }
 
+// placeholderProbe reports fixed values until a probe of the host is
+// injected
+type placeholderProbe struct{}
+
+func (placeholderProbe) SystemLoad(ctx context.Context) (SystemLoadMetrics, error) {
+	return SystemLoadMetrics{
+		CPUUsage:    45.2,
+		MemoryUsage: 67.8,
+		DiskUsage:   23.4,
+		NetworkIO:   12.5,
+		LoadAverage: 1.2,
+	}, nil
+}
+
+func (placeholderProbe) ResourceUsage(ctx context.Context) (ResourceUsageMetrics, error) {
+	return ResourceUsageMetrics{
+		ActiveConnections: 25,
+		DatabaseQueries:   1500,
+		CacheHitRate:      85.5,
+		QueueSize:         10,
+		WorkerUtilization: 75.0,
+	}, nil
+}
+
 // WorkflowMetrics represents metrics for a specific workflow
 type WorkflowMetrics struct {
 	WorkflowID       uuid.UUID                `json:"workflow_id"`
@@ -263,7 +322,7 @@ func (mc *MetricsCollector) GetWorkflowMetrics(ctx context.Context, workflowID u
 		ErrorBreakdown:   errorBreakdown,
 		StepMetrics:      stepMetrics,
 		TimeRange:        timeRange,
-		GeneratedAt:      time.Now(),
+		GeneratedAt:      mc.clock.Now(),
 	}, nil
 }
 
@@ -338,7 +397,7 @@ func (mc *MetricsCollector) GetExecutionMetrics(ctx context.Context, filters Exe
 		ExecutionsByHour:    executionsByHour,
 		TopFailedWorkflows:  topFailedWorkflows,
 		TimeRange:           timeRange,
-		GeneratedAt:         time.Now(),
+		GeneratedAt:         mc.clock.Now(),
 	}, nil
 }
 
@@ -368,10 +427,8 @@ func (mc *MetricsCollector) GetSystemMetrics(ctx context.Context, timeRange stri
 	}
 
 	// Get time-based execution counts
-	now := time.Now()
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	startOfWeek := startOfDay.AddDate(0, 0, -int(now.Weekday()))
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	now := mc.clock.Now()
+	startOfDay, startOfWeek, startOfMonth := calendarPeriods(now)
 
 	dailyExecutions, err := executionRepo.CountByTimeRange(ctx, startOfDay, now)
 	if err != nil {
@@ -399,21 +456,17 @@ func (mc *MetricsCollector) GetSystemMetrics(ctx context.Context, timeRange stri
 		return nil, fmt.Errorf("failed to get execution trends: %w", err)
 	}
 
-	// Mock system metrics (would be replaced with actual system monitoring)
-	systemLoad := SystemLoadMetrics{
-		CPUUsage:    45.2,
-		MemoryUsage: 67.8,
-		DiskUsage:   23.4,
-		NetworkIO:   12.5,
-		LoadAverage: 1.2,
+	// The host metrics only inform, so the metrics of a failing probe are
+	// reported as zero
+	systemLoad, err := mc.probe.SystemLoad(ctx)
+	if err != nil {
+		mc.logger.WithError(err).Warn("Failed to probe system load")
+		systemLoad = SystemLoadMetrics{}
 	}
-
-	resourceUsage := ResourceUsageMetrics{
-		ActiveConnections: 25,
-		DatabaseQueries:   1500,
-		CacheHitRate:      85.5,
-		QueueSize:         10,
-		WorkerUtilization: 75.0,
+	resourceUsage, err := mc.probe.ResourceUsage(ctx)
+	if err != nil {
+		mc.logger.WithError(err).Warn("Failed to probe resource usage")
+		resourceUsage = ResourceUsageMetrics{}
 	}
 
 	apiMetrics := APIMetrics{
@@ -446,13 +499,13 @@ func (mc *MetricsCollector) GetSystemMetrics(ctx context.Context, timeRange stri
 		WorkflowTrends:    workflowTrends,
 		ExecutionTrends:   executionTrends,
 		TimeRange:         timeRange,
-		GeneratedAt:       time.Now(),
+		GeneratedAt:       mc.clock.Now(),
 	}, nil
 }
 
 // parseTimeRange parses a time range string and returns start and end times
 func (mc *MetricsCollector) parseTimeRange(timeRange string) (time.Time, time.Time) {
-	now := time.Now()
+	now := mc.clock.Now()
 	var startTime time.Time
 
 	switch timeRange {
@@ -478,74 +531,84 @@ func (mc *MetricsCollector) parseTimeRange(timeRange string) (time.Time, time.Ti
 // Helper methods for getting specific metrics data
 
 func (mc *MetricsCollector) getExecutionTrend(ctx context.Context, workflowID uuid.UUID, startTime, endTime time.Time) ([]ExecutionTrendPoint, error) {
-	// This would query execution data and aggregate by time intervals
+	// This would query execution data and aggregate it by bucket
 	// For now, return mock data
-	return []ExecutionTrendPoint{
-		{
-			Timestamp:   startTime,
+	buckets := trendBuckets(startTime, endTime, trendWidth(endTime.Sub(startTime)))
+	trend := make([]ExecutionTrendPoint, len(buckets))
+	for i, bucket := range buckets {
+		trend[i] = ExecutionTrendPoint{
+			Timestamp:   bucket,
 			Executions:  10,
 			Successful:  8,
 			Failed:      2,
 			Cancelled:   0,
 			AverageTime: 120.5,
-		},
-	}, nil
+		}
+	}
+	return trend, nil
 }
 
 func (mc *MetricsCollector) getPerformanceTrend(ctx context.Context, workflowID uuid.UUID, startTime, endTime time.Time) ([]PerformanceTrendPoint, error) {
-	// This would query performance data and aggregate by time intervals
+	// This would query performance data and aggregate it by bucket
 	// For now, return mock data
-	return []PerformanceTrendPoint{
-		{
-			Timestamp:      startTime,
+	buckets := trendBuckets(startTime, endTime, trendWidth(endTime.Sub(startTime)))
+	trend := make([]PerformanceTrendPoint, len(buckets))
+	for i, bucket := range buckets {
+		trend[i] = PerformanceTrendPoint{
+			Timestamp:      bucket,
 			AverageRuntime: 120.5,
 			MedianRuntime:  115.0,
 			P95Runtime:     200.0,
 			Throughput:     5.2,
 			ErrorRate:      2.5,
-		},
-	}, nil
+		}
+	}
+	return trend, nil
 }
 
 func (mc *MetricsCollector) getErrorBreakdown(ctx context.Context, workflowID uuid.UUID, startTime, endTime time.Time) (map[string]int64, error) {
-	// This would query error data and aggregate by error type
-	// For now, return mock data
-	return map[string]int64{
-		"timeout":           5,
-		"validation_error":  3,
-		"network_error":     2,
-		"authentication":    1,
-	}, nil
+	// Failures are broken down by triage class
+	return mc.repoManager.ExecutionRepository().CountFailuresByTriageClass(&workflowID, startTime, endTime)
 }
 
 func (mc *MetricsCollector) getStepMetrics(ctx context.Context, workflowID uuid.UUID, startTime, endTime time.Time) ([]StepMetrics, error) {
-	// This would query step execution data
-	// For now, return mock data
-	return []StepMetrics{
-		{
-			StepName:       "validate_input",
-			StepType:       "validation",
-			Executions:     100,
-			Successful:     95,
-			Failed:         5,
-			AverageRuntime: 2 * time.Second,
-			SuccessRate:    95.0,
-			CommonErrors:   []string{"invalid_format", "missing_field"},
-		},
-	}, nil
+	stats, err := mc.repoManager.ExecutionRepository().AggregateSteps(workflowID, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]StepMetrics, len(stats))
+	for i, step := range stats {
+		metrics[i] = StepMetrics{
+			StepName:       step.StepName,
+			StepType:       step.StepType,
+			Executions:     step.Total,
+			Successful:     step.Completed,
+			Failed:         step.Failed,
+			AverageRuntime: step.AverageDuration,
+			CommonErrors:   []string{},
+		}
+		if step.Total > 0 {
+			metrics[i].SuccessRate = float64(step.Completed) / float64(step.Total) * 100
+		}
+	}
+	return metrics, nil
 }
 
 func (mc *MetricsCollector) getHourlyExecutionCounts(ctx context.Context, startTime, endTime time.Time, filters ExecutionMetricsFilters) ([]HourlyExecutionCount, error) {
-	// This would query execution data and aggregate by hour
+	// This would query execution data and aggregate it by hour
 	// For now, return mock data
-	return []HourlyExecutionCount{
-		{
-			Hour:       startTime.Truncate(time.Hour),
+	buckets := trendBuckets(startTime, endTime, time.Hour)
+	counts := make([]HourlyExecutionCount, len(buckets))
+	for i, hour := range buckets {
+		counts[i] = HourlyExecutionCount{
+			Hour:       hour,
 			Executions: 25,
 			Successful: 22,
 			Failed:     3,
-		},
-	}, nil
+		}
+	}
+	return counts, nil
 }
 
 func (mc *MetricsCollector) getTopFailedWorkflows(ctx context.Context, startTime, endTime time.Time, limit int) ([]WorkflowFailureCount, error) {
@@ -562,17 +625,20 @@ func (mc *MetricsCollector) getTopFailedWorkflows(ctx context.Context, startTime
 }
 
 func (mc *MetricsCollector) getWorkflowTrends(ctx context.Context, startTime, endTime time.Time) ([]WorkflowTrendPoint, error) {
-	// This would query workflow data and aggregate by time intervals
+	// This would query workflow data and aggregate it by bucket
 	// For now, return mock data
-	return []WorkflowTrendPoint{
-		{
-			Timestamp:        startTime,
+	buckets := trendBuckets(startTime, endTime, trendWidth(endTime.Sub(startTime)))
+	trend := make([]WorkflowTrendPoint, len(buckets))
+	for i, bucket := range buckets {
+		trend[i] = WorkflowTrendPoint{
+			Timestamp:        bucket,
 			TotalWorkflows:   50,
 			ActiveWorkflows:  35,
 			NewWorkflows:     2,
 			UpdatedWorkflows: 5,
-		},
-	}, nil
+		}
+	}
+	return trend, nil
 }
 
 // HealthCheck checks the health of the metrics collector
@@ -0,0 +1,103 @@
+package dashboard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/scheduler"
+)
+
+// now is a Wednesday morning
+var now = time.Date(2026, 3, 4, 10, 17, 30, 0, time.UTC)
+
+func newCollector() *MetricsCollector {
+	return NewMetricsCollector(MetricsCollectorOptions{Clock: scheduler.NewFakeClock(now)})
+}
+
+func TestNewMetricsCollectorDefaults(t *testing.T) {
+	collector := NewMetricsCollector(MetricsCollectorOptions{})
+	assert.NotNil(t, collector.clock)
+	assert.Same(t, logrus.StandardLogger(), collector.logger)
+
+	systemLoad, err := collector.probe.SystemLoad(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 45.2, systemLoad.CPUUsage)
+}
+
+func TestParseTimeRange(t *testing.T) {
+	collector := newCollector()
+	for timeRange, span := range map[string]time.Duration{
+		"1h":  time.Hour,
+		"24h": 24 * time.Hour,
+		"1w":  7 * 24 * time.Hour,
+		"90d": 90 * 24 * time.Hour,
+		"":    24 * time.Hour,
+		"2y":  24 * time.Hour,
+	} {
+		startTime, endTime := collector.parseTimeRange(timeRange)
+		assert.Equal(t, now, endTime, timeRange)
+		assert.Equal(t, now.Add(-span), startTime, timeRange)
+	}
+}
+
+func TestTrendBuckets(t *testing.T) {
+	collector := newCollector()
+	for timeRange, tc := range map[string]struct {
+		first, last time.Time
+		count       int
+	}{
+		// Buckets start on whole widths, the first one holding the start
+		// of the range and the last one now
+		"1h":  {time.Date(2026, 3, 4, 9, 15, 0, 0, time.UTC), time.Date(2026, 3, 4, 10, 15, 0, 0, time.UTC), 13},
+		"24h": {time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC), time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC), 25},
+		"7d":  {time.Date(2026, 2, 25, 6, 0, 0, 0, time.UTC), time.Date(2026, 3, 4, 6, 0, 0, 0, time.UTC), 29},
+		"30d": {time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC), 31},
+	} {
+		startTime, endTime := collector.parseTimeRange(timeRange)
+		trend, err := collector.getExecutionTrend(context.Background(), uuid.Nil, startTime, endTime)
+		require.NoError(t, err)
+		require.Len(t, trend, tc.count, timeRange)
+		assert.Equal(t, tc.first, trend[0].Timestamp, timeRange)
+		assert.Equal(t, tc.last, trend[len(trend)-1].Timestamp, timeRange)
+
+		width := trendWidth(endTime.Sub(startTime))
+		for i := 1; i < len(trend); i++ {
+			assert.Equal(t, width, trend[i].Timestamp.Sub(trend[i-1].Timestamp), timeRange)
+		}
+	}
+
+	// Hourly counts are binned by hour whatever the range
+	startTime, endTime := collector.parseTimeRange("6h")
+	counts, err := collector.getHourlyExecutionCounts(context.Background(), startTime, endTime, ExecutionMetricsFilters{})
+	require.NoError(t, err)
+	require.Len(t, counts, 7)
+	assert.Equal(t, time.Date(2026, 3, 4, 4, 0, 0, 0, time.UTC), counts[0].Hour)
+	assert.Equal(t, time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC), counts[6].Hour)
+
+	// A range ending on a bucket boundary does not open a bucket at its end
+	buckets := trendBuckets(now.Truncate(time.Hour).Add(-2*time.Hour), now.Truncate(time.Hour), time.Hour)
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 3, 4, 8, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC),
+	}, buckets)
+}
+
+func TestCalendarPeriods(t *testing.T) {
+	startOfDay, startOfWeek, startOfMonth := calendarPeriods(now)
+	assert.Equal(t, time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC), startOfDay)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), startOfWeek, "weeks start on Sunday")
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), startOfMonth)
+
+	// Periods follow the location of the time, a week spanning two months
+	tokyo := time.FixedZone("JST", 9*60*60)
+	startOfDay, startOfWeek, startOfMonth = calendarPeriods(time.Date(2026, 4, 2, 1, 30, 0, 0, tokyo))
+	assert.Equal(t, time.Date(2026, 4, 2, 0, 0, 0, 0, tokyo), startOfDay)
+	assert.Equal(t, time.Date(2026, 3, 29, 0, 0, 0, 0, tokyo), startOfWeek)
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, tokyo), startOfMonth)
+}
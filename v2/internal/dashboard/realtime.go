@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/engine"
 )
 
 // RealtimeManager handles real-time updates for dashboard clients
@@ -58,6 +60,7 @@ const (
 	UpdateTypeSystemStatus       = "system_status"
 	UpdateTypeUserActivity       = "user_activity"
 	UpdateTypeHeartbeat          = "heartbeat"
+	UpdateTypeInitialState       = "initial_state"
 	UpdateTypeError              = "error"
 )
 
@@ -389,6 +392,17 @@ func CreateSystemUpdate(data interface{}) RealtimeUpdate {
 	}
 }
 
+// CreateInitialStateUpdate creates the initial state update of a client
+func CreateInitialStateUpdate(executions []*engine.ExecutionStatus) RealtimeUpdate {
+	return RealtimeUpdate{
+		Type:      UpdateTypeInitialState,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"executions": executions,
+		},
+	}
+}
+
 // CreateErrorUpdate creates an error update
 func CreateErrorUpdate(errorMsg string, details interface{}) RealtimeUpdate {
 	return RealtimeUpdate{
@@ -9,6 +9,8 @@ import (
 	"gorm.io/gorm"
 
 	"magic-flow/v2/internal/database"
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/internal/slo"
 	"magic-flow/v2/pkg/models"
 )
 
@@ -17,26 +19,41 @@ type Service struct {
 	repoManager database.RepositoryManager
 	metricsCollector *MetricsCollector
 	realtimeManager *RealtimeManager
+	executionStatuses ExecutionStatusLister
+	sloHealth SLOHealthReporter
+}
+
+// ExecutionStatusLister lists the status snapshots of running executions,
+// implemented by engine.Engine
+type ExecutionStatusLister interface {
+	ListExecutions() []*engine.ExecutionStatus
+}
+
+// SLOHealthReporter reports the SLO health of workflows, implemented by
+// slo.Manager
+type SLOHealthReporter interface {
+	Health(ctx context.Context) ([]*slo.WorkflowHealth, error)
 }
 
 // NewService creates a new dashboard service
 func NewService(repoManager database.RepositoryManager) *Service {
 	return &Service{
 		repoManager: repoManager,
-		metricsCollector: NewMetricsCollector(repoManager),
+		metricsCollector: NewMetricsCollector(MetricsCollectorOptions{RepoManager: repoManager}),
 		realtimeManager: NewRealtimeManager(),
 	}
 }
 
 // DashboardOverview represents the main dashboard overview data
 type DashboardOverview struct {
-	WorkflowStats    WorkflowStats    `json:"workflow_stats"`
-	ExecutionStats   ExecutionStats   `json:"execution_stats"`
-	PerformanceStats PerformanceStats `json:"performance_stats"`
-	SystemStats      SystemStats      `json:"system_stats"`
-	RecentActivity   []ActivityItem   `json:"recent_activity"`
-	Alerts           []AlertItem      `json:"alerts"`
-	UpdatedAt        time.Time        `json:"updated_at"`
+	WorkflowStats    WorkflowStats         `json:"workflow_stats"`
+	ExecutionStats   ExecutionStats        `json:"execution_stats"`
+	PerformanceStats PerformanceStats      `json:"performance_stats"`
+	SystemStats      SystemStats           `json:"system_stats"`
+	RecentActivity   []ActivityItem        `json:"recent_activity"`
+	Alerts           []AlertItem           `json:"alerts"`
+	SLOHealth        []*slo.WorkflowHealth `json:"slo_health,omitempty"`
+	UpdatedAt        time.Time             `json:"updated_at"`
 }
 
 // WorkflowStats represents workflow statistics
@@ -45,6 +62,8 @@ type WorkflowStats struct {
 	Active   int64 `json:"active"`
 	Inactive int64 `json:"inactive"`
 	Draft    int64 `json:"draft"`
+	// Deprecated counts the workflows marked deprecated, whatever their status
+	Deprecated int64 `json:"deprecated"`
 }
 
 // ExecutionStats represents execution statistics
@@ -141,6 +160,15 @@ func (s *Service) GetDashboardOverview(ctx context.Context) (*DashboardOverview,
 		return nil, fmt.Errorf("failed to get alerts: %w", err)
 	}
 
+	// Get SLO health
+	var sloHealth []*slo.WorkflowHealth
+	if s.sloHealth != nil {
+		sloHealth, err = s.sloHealth.Health(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get SLO health: %w", err)
+		}
+	}
+
 	return &DashboardOverview{
 		WorkflowStats:    *workflowStats,
 		ExecutionStats:   *executionStats,
@@ -148,6 +176,7 @@ func (s *Service) GetDashboardOverview(ctx context.Context) (*DashboardOverview,
 		SystemStats:      *systemStats,
 		RecentActivity:   recentActivity,
 		Alerts:           alerts,
+		SLOHealth:        sloHealth,
 		UpdatedAt:        time.Now(),
 	}, nil
 }
@@ -176,11 +205,17 @@ func (s *Service) getWorkflowStats(ctx context.Context) (*WorkflowStats, error)
 		return nil, err
 	}
 
+	deprecated, err := workflowRepo.CountDeprecated()
+	if err != nil {
+		return nil, err
+	}
+
 	return &WorkflowStats{
-		Total:    total,
-		Active:   active,
-		Inactive: inactive,
-		Draft:    draft,
+		Total:      total,
+		Active:     active,
+		Inactive:   inactive,
+		Draft:      draft,
+		Deprecated: deprecated,
 	}, nil
 }
 
@@ -369,6 +404,28 @@ func (s *Service) UnsubscribeFromRealtimeUpdates(clientID string) {
 	s.realtimeManager.Unsubscribe(clientID)
 }
 
+// SetExecutionStatuses sets where the running executions sent to new
+// real-time clients are listed
+func (s *Service) SetExecutionStatuses(lister ExecutionStatusLister) {
+	s.executionStatuses = lister
+}
+
+// SetSLOs sets where the SLO health shown in the overview is reported
+func (s *Service) SetSLOs(reporter SLOHealthReporter) {
+	s.sloHealth = reporter
+}
+
+// GetInitialState returns the first update sent to real-time clients. It
+// lists the status snapshots of the running executions, so clients apply
+// the execution events with a later sequence number on top of it.
+func (s *Service) GetInitialState() RealtimeUpdate {
+	executions := []*engine.ExecutionStatus{}
+	if s.executionStatuses != nil {
+		executions = s.executionStatuses.ListExecutions()
+	}
+	return CreateInitialStateUpdate(executions)
+}
+
 // PublishRealtimeUpdate publishes a real-time update to all subscribers
 func (s *Service) PublishRealtimeUpdate(update RealtimeUpdate) {
 	s.realtimeManager.Publish(update)
@@ -0,0 +1,39 @@
+package dashboard
+
+import "time"
+
+// trendWidth returns the width of the buckets the trends of a time range are
+// binned in, giving trends of about 12 to 30 points
+func trendWidth(span time.Duration) time.Duration {
+	switch {
+	case span <= time.Hour:
+		return 5 * time.Minute
+	case span <= 24*time.Hour:
+		return time.Hour
+	case span <= 7*24*time.Hour:
+		return 6 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// trendBuckets returns the starts of the buckets covering the time range
+// [start, end). Buckets are aligned on multiples of their width, whole UTC
+// hours and days, so an instant falls in the same bucket whatever the
+// range; the first bucket may so start before the range.
+func trendBuckets(start, end time.Time, width time.Duration) []time.Time {
+	var buckets []time.Time
+	for bucket := start.Truncate(width); bucket.Before(end); bucket = bucket.Add(width) {
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// calendarPeriods returns the starts of the day, the week and the month of a
+// time, in its location. Weeks start on Sunday.
+func calendarPeriods(now time.Time) (startOfDay, startOfWeek, startOfMonth time.Time) {
+	startOfDay = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	startOfWeek = startOfDay.AddDate(0, 0, -int(now.Weekday()))
+	startOfMonth = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return startOfDay, startOfWeek, startOfMonth
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"magic-flow/v2/internal/compression"
+	"magic-flow/v2/pkg/models"
+)
+
+// payloadSerializer is the name of the serializer of the payload columns of
+// executions, step executions and execution events, which are compressed
+// once enabled. Columns queried in SQL, such as labels, do not use it.
+const payloadSerializer = "compressed"
+
+func init() {
+	schema.RegisterSerializer(payloadSerializer, compressedSerializer{})
+}
+
+// payloadCompressor is the compressor of the payload columns, nil until
+// compression is enabled
+var payloadCompressor atomic.Pointer[compression.Compressor]
+
+// EnableCompression compresses the payload columns written from now on
+// with compressor. Compressed payloads are decompressed on read whether
+// compression is enabled or not, so that it can be disabled again.
+func EnableCompression(compressor *compression.Compressor) {
+	payloadCompressor.Store(compressor)
+}
+
+// compressedSerializer stores the values of payload columns as JSON,
+// compressed by the payload compressor, and reads compressed and plain JSON
+// alike
+type compressedSerializer struct{}
+
+// Scan implements schema.SerializerInterface
+func (compressedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType)
+	if dbValue != nil {
+		var stored []byte
+		switch v := dbValue.(type) {
+		case []byte:
+			stored = v
+		case string:
+			stored = []byte(v)
+		default:
+			return fmt.Errorf("failed to unmarshal JSONB value: %#v", dbValue)
+		}
+		if len(stored) > 0 {
+			payload, err := compression.Decode(stored)
+			if err != nil {
+				return fmt.Errorf("failed to decompress %s.%s: %w", field.Schema.Table, field.DBName, err)
+			}
+			if err := json.Unmarshal(payload, fieldValue.Interface()); err != nil {
+				return err
+			}
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+// Value implements schema.SerializerInterface
+func (compressedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	payload, err := json.Marshal(fieldValue)
+	if err != nil {
+		return nil, err
+	}
+	if string(payload) == "null" {
+		if field.TagSettings["NOT NULL"] != "" {
+			return "", nil
+		}
+		return nil, nil
+	}
+	compressor := payloadCompressor.Load()
+	if compressor == nil {
+		return string(payload), nil
+	}
+	stored, err := compressor.Compress(field.Schema.Table, field.DBName, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress %s.%s: %w", field.Schema.Table, field.DBName, err)
+	}
+	return string(stored), nil
+}
+
+// payloadTable is a table with payload columns, keyed by id
+type payloadTable struct {
+	name string
+	// executionColumn holds the execution of the rows
+	executionColumn string
+	columns         []string
+}
+
+// payloadTables are the tables with payload columns, the columns of the
+// models using the compressed serializer
+var payloadTables = []payloadTable{
+	{name: "executions", executionColumn: "id", columns: []string{"trigger_data", "input_data", "output_data", "context"}},
+	{name: "step_executions", executionColumn: "execution_id", columns: []string{"input_data", "output_data"}},
+	{name: "execution_events", executionColumn: "execution_id", columns: []string{"data"}},
+}
+
+// RecompressionProcessor rewrites the payload columns of the executions of
+// a backfill, with their step executions and events, as the compressor
+// writes them now: rows written before compression was enabled or with
+// another algorithm are compressed, and the rows of columns no longer
+// compressed decompressed. It implements backfill.Processor.
+type RecompressionProcessor struct {
+	db         *gorm.DB
+	compressor *compression.Compressor
+}
+
+// NewRecompressionProcessor creates the recompression processor of
+// backfills
+func NewRecompressionProcessor(db *gorm.DB, compressor *compression.Compressor) *RecompressionProcessor {
+	return &RecompressionProcessor{db: db, compressor: compressor}
+}
+
+// Name returns the name backfills select the processor by
+func (p *RecompressionProcessor) Name() string {
+	return "recompression"
+}
+
+// Process rewrites the payloads of an execution that are not stored as the
+// compressor writes them, one row at a time. Executions whose payloads are
+// all up to date are skipped, so processing an execution again does
+// nothing.
+func (p *RecompressionProcessor) Process(ctx context.Context, execution *models.Execution) (bool, error) {
+	db := p.db.WithContext(ctx)
+	processed := false
+	for _, table := range payloadTables {
+		rewritten, err := p.recompressTable(db, table, execution.ID)
+		if err != nil {
+			return processed, fmt.Errorf("failed to recompress %s: %w", table.name, err)
+		}
+		processed = processed || rewritten
+	}
+	return processed, nil
+}
+
+// recompressTable rewrites the stale payloads of the rows of an execution in
+// a table, reporting whether it rewrote any
+func (p *RecompressionProcessor) recompressTable(db *gorm.DB, table payloadTable, executionID interface{}) (bool, error) {
+	columns := append([]string{"id"}, table.columns...)
+	rows, err := db.Table(table.name).Select(columns).Where(table.executionColumn+" = ?", executionID).Rows()
+	if err != nil {
+		return false, err
+	}
+	type update struct {
+		id      interface{}
+		columns map[string]interface{}
+	}
+	var updates []update
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		for i := range values {
+			values[i] = new(interface{})
+		}
+		if err := rows.Scan(values...); err != nil {
+			rows.Close()
+			return false, err
+		}
+		changed := make(map[string]interface{})
+		for i, name := range table.columns {
+			stored := storedBytes(*values[i+1].(*interface{}))
+			if stored == nil {
+				continue
+			}
+			recompressed, ok, err := p.compressor.Recompress(table.name, name, stored)
+			if err != nil {
+				rows.Close()
+				return false, fmt.Errorf("column %s: %w", name, err)
+			}
+			if ok {
+				changed[name] = string(recompressed)
+			}
+		}
+		if len(changed) > 0 {
+			updates = append(updates, update{id: *values[0].(*interface{}), columns: changed})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return false, err
+	}
+	if err := rows.Close(); err != nil {
+		return false, err
+	}
+
+	// Rows are updated by their primary key, without hooks or the update
+	// time, as their content does not change
+	for _, u := range updates {
+		if err := db.Table(table.name).Where("id = ?", u.id).UpdateColumns(u.columns).Error; err != nil {
+			return false, err
+		}
+	}
+	return len(updates) > 0, nil
+}
+
+// storedBytes returns the bytes of a payload column as scanned, nil for
+// NULL
+func storedBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"magic-flow/v2/internal/compression"
+	"magic-flow/v2/pkg/models"
+)
+
+// payloadExecution, payloadStep and payloadEvent are the payload columns of
+// the execution records, the schema of the models needs a postgres database
+type payloadExecution struct {
+	ID          uuid.UUID               `gorm:"type:uuid;primaryKey"`
+	TriggerData map[string]interface{}  `gorm:"serializer:compressed"`
+	InputData   map[string]interface{}  `gorm:"serializer:compressed"`
+	OutputData  map[string]interface{}  `gorm:"serializer:compressed"`
+	Context     models.ExecutionContext `gorm:"serializer:compressed"`
+	Labels      map[string]string       `gorm:"serializer:json"`
+}
+
+func (payloadExecution) TableName() string {
+	return "executions"
+}
+
+type payloadStep struct {
+	ID          uuid.UUID              `gorm:"type:uuid;primaryKey"`
+	ExecutionID uuid.UUID              `gorm:"type:uuid;index"`
+	InputData   map[string]interface{} `gorm:"serializer:compressed"`
+	OutputData  map[string]interface{} `gorm:"serializer:compressed"`
+}
+
+func (payloadStep) TableName() string {
+	return "step_executions"
+}
+
+type payloadEvent struct {
+	ID          uuid.UUID              `gorm:"type:uuid;primaryKey"`
+	ExecutionID uuid.UUID              `gorm:"type:uuid;index"`
+	Data        map[string]interface{} `gorm:"serializer:compressed"`
+}
+
+func (payloadEvent) TableName() string {
+	return "execution_events"
+}
+
+// largePayload returns a payload of about 20KB of order lines
+func largePayload(orderID string) map[string]interface{} {
+	lines := make([]interface{}, 200)
+	for i := range lines {
+		lines[i] = map[string]interface{}{"sku": "SKU-0042", "quantity": float64(i % 5), "warehouse": "AMS-1"}
+	}
+	return map[string]interface{}{"order_id": orderID, "lines": lines}
+}
+
+func enableCompression(t *testing.T, config compression.Config) *compression.Compressor {
+	config.Enabled = true
+	compressor, err := compression.NewCompressor(config)
+	require.NoError(t, err)
+	EnableCompression(compressor)
+	t.Cleanup(func() { EnableCompression(nil) })
+	return compressor
+}
+
+// storedColumn returns a column of a row as stored
+func storedColumn(t *testing.T, db *gorm.DB, table, column string, id uuid.UUID) string {
+	var stored string
+	require.NoError(t, db.Table(table).Select(column).Where("id = ?", id).Row().Scan(&stored))
+	return stored
+}
+
+func isEnvelope(t *testing.T, stored string) bool {
+	_, ok, err := compression.Parse([]byte(stored))
+	require.NoError(t, err)
+	return ok
+}
+
+// newPayloadExecution creates an execution with a step and an event, all
+// holding large payloads
+func newPayloadExecution(t *testing.T, db *gorm.DB, orderID string) uuid.UUID {
+	id := uuid.New()
+	require.NoError(t, db.Create(&payloadExecution{
+		ID:          id,
+		TriggerData: map[string]interface{}{"source": "api"},
+		InputData:   largePayload(orderID),
+		OutputData:  largePayload(orderID),
+		Context:     models.ExecutionContext{WorkflowName: "orders", Variables: largePayload(orderID)},
+		Labels:      map[string]string{"team": strings.Repeat("payments", 1000)},
+	}).Error)
+	require.NoError(t, db.Create(&payloadStep{ID: uuid.New(), ExecutionID: id, InputData: largePayload(orderID)}).Error)
+	require.NoError(t, db.Create(&payloadEvent{ID: uuid.New(), ExecutionID: id, Data: largePayload(orderID)}).Error)
+	return id
+}
+
+func TestCompressedColumns(t *testing.T) {
+	db := openSQLite(t, "payloads.db")
+	require.NoError(t, db.AutoMigrate(&payloadExecution{}, &payloadStep{}, &payloadEvent{}))
+	enableCompression(t, compression.Config{Algorithm: compression.AlgorithmGzip, Threshold: 1024})
+
+	id := newPayloadExecution(t, db, "ord_1")
+
+	// Large payloads are stored compressed, small ones and the columns
+	// queried in SQL as JSON
+	assert.True(t, isEnvelope(t, storedColumn(t, db, "executions", "input_data", id)))
+	assert.True(t, isEnvelope(t, storedColumn(t, db, "executions", "context", id)))
+	assert.Equal(t, `{"source":"api"}`, storedColumn(t, db, "executions", "trigger_data", id))
+	assert.False(t, isEnvelope(t, storedColumn(t, db, "executions", "labels", id)))
+	var count int64
+	require.NoError(t, db.Table("executions").Where("labels LIKE ?", `{"team":"payments%`).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// Reads decompress transparently
+	var execution payloadExecution
+	require.NoError(t, db.First(&execution, "id = ?", id).Error)
+	assert.Equal(t, "ord_1", execution.InputData["order_id"])
+	assert.Len(t, execution.OutputData["lines"], 200)
+	assert.Equal(t, "orders", execution.Context.WorkflowName)
+	assert.Len(t, execution.Context.Variables["lines"], 200)
+	var step payloadStep
+	require.NoError(t, db.First(&step, "execution_id = ?", id).Error)
+	assert.Equal(t, "ord_1", step.InputData["order_id"])
+	assert.Nil(t, step.OutputData)
+}
+
+func TestRecompressionProcessor(t *testing.T) {
+	db := openSQLite(t, "recompression.db")
+	require.NoError(t, db.AutoMigrate(&payloadExecution{}, &payloadStep{}, &payloadEvent{}))
+	ctx := context.Background()
+
+	// Rows written before compression was enabled stay plain JSON, and are
+	// read alongside compressed rows
+	before := newPayloadExecution(t, db, "ord_before")
+	zstdCompressor := enableCompression(t, compression.Config{Algorithm: compression.AlgorithmZstd, Threshold: 1024})
+	after := newPayloadExecution(t, db, "ord_after")
+	assert.False(t, isEnvelope(t, storedColumn(t, db, "executions", "input_data", before)))
+	assert.True(t, isEnvelope(t, storedColumn(t, db, "executions", "input_data", after)))
+
+	var executions []payloadExecution
+	require.NoError(t, db.Order("input_data").Find(&executions).Error)
+	require.Len(t, executions, 2)
+	orders := []interface{}{executions[0].InputData["order_id"], executions[1].InputData["order_id"]}
+	assert.ElementsMatch(t, []interface{}{"ord_before", "ord_after"}, orders)
+
+	// The processor compresses the rows of the execution, its steps and
+	// events, once
+	processor := NewRecompressionProcessor(db, zstdCompressor)
+	assert.Equal(t, "recompression", processor.Name())
+	processed, err := processor.Process(ctx, &models.Execution{ID: before})
+	require.NoError(t, err)
+	assert.True(t, processed)
+	for _, table := range []struct{ name, column, key string }{
+		{"executions", "input_data", "id"},
+		{"executions", "output_data", "id"},
+		{"executions", "context", "id"},
+		{"step_executions", "input_data", "execution_id"},
+		{"execution_events", "data", "execution_id"},
+	} {
+		var stored string
+		require.NoError(t, db.Table(table.name).Select(table.column).Where(table.key+" = ?", before).Row().Scan(&stored))
+		assert.True(t, isEnvelope(t, stored), "%s.%s", table.name, table.column)
+	}
+	var execution payloadExecution
+	require.NoError(t, db.First(&execution, "id = ?", before).Error)
+	assert.Equal(t, "ord_before", execution.InputData["order_id"])
+
+	processed, err = processor.Process(ctx, &models.Execution{ID: before})
+	require.NoError(t, err)
+	assert.False(t, processed, "processing an execution again does nothing")
+	processed, err = processor.Process(ctx, &models.Execution{ID: after})
+	require.NoError(t, err)
+	assert.False(t, processed, "executions written compressed are skipped")
+
+	// Switching algorithm migrates the compressed rows
+	gzipCompressor, err := compression.NewCompressor(compression.Config{Enabled: true, Algorithm: compression.AlgorithmGzip, Threshold: 1024})
+	require.NoError(t, err)
+	processed, err = NewRecompressionProcessor(db, gzipCompressor).Process(ctx, &models.Execution{ID: after})
+	require.NoError(t, err)
+	assert.True(t, processed)
+	envelope, _, err := compression.Parse([]byte(storedColumn(t, db, "executions", "output_data", after)))
+	require.NoError(t, err)
+	assert.Equal(t, compression.AlgorithmGzip, envelope.Algorithm)
+	execution = payloadExecution{}
+	require.NoError(t, db.First(&execution, "id = ?", after).Error)
+	assert.Equal(t, "ord_after", execution.OutputData["order_id"])
+}
+
+func TestPayloadTables(t *testing.T) {
+	// The recompressed columns are those of the models using the
+	// compressed serializer
+	naming := schema.NamingStrategy{}
+	for i, model := range []interface{}{models.Execution{}, models.StepExecution{}, models.ExecutionEvent{}} {
+		modelType := reflect.TypeOf(model)
+		var columns []string
+		for j := 0; j < modelType.NumField(); j++ {
+			field := modelType.Field(j)
+			if strings.Contains(field.Tag.Get("gorm"), "serializer:"+payloadSerializer) {
+				columns = append(columns, naming.ColumnName("", field.Name))
+			}
+		}
+		assert.Equal(t, naming.TableName(modelType.Name()), payloadTables[i].name)
+		assert.Equal(t, columns, payloadTables[i].columns, modelType.Name())
+	}
+}
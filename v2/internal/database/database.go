@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -19,6 +20,9 @@ type Database struct {
 	DB     *gorm.DB
 	Config *config.DatabaseConfig
 	Logger *logrus.Logger
+	// Router routes the reads that tolerate replication lag to the read
+	// replicas, it sends every read to DB when no replica is configured
+	Router *Router
 }
 
 // NewDatabase creates a new database connection
@@ -37,15 +41,9 @@ func NewDatabase(cfg *config.DatabaseConfig, log *logrus.Logger) (*Database, err
 
 // Connect establishes a connection to the database
 func (d *Database) Connect() error {
-	var dialector gorm.Dialector
-
-	switch d.Config.Driver {
-	case "postgres":
-		dialector = postgres.Open(d.Config.GetConnectionString())
-	case "mysql":
-		dialector = mysql.Open(d.Config.GetConnectionString())
-	default:
-		return fmt.Errorf("unsupported database driver: %s", d.Config.Driver)
+	dialector, err := d.dialector(d.Config.GetConnectionString())
+	if err != nil {
+		return err
 	}
 
 	// Configure GORM logger
@@ -85,9 +83,69 @@ func (d *Database) Connect() error {
 	d.DB = db
 	d.Logger.Info("Database connection established")
 
+	// Connect the read replicas, a replica that cannot be reached is left
+	// out and its reads go to the primary
+	replicas := make([]*Replica, 0, len(d.Config.Replicas))
+	for _, replicaConfig := range d.Config.Replicas {
+		replica, err := d.connectReplica(replicaConfig, gormConfig)
+		if err != nil {
+			d.Logger.WithError(err).WithField("replica", replicaConfig.Name).Warn("Failed to connect to database replica, reading from the primary")
+			continue
+		}
+		replicas = append(replicas, replica)
+	}
+	d.Router = NewRouter(db, replicas, RouterConfig{}, nil, d.Logger)
+
 	return nil
 }
 
+// connectReplica opens the connection pool of a read replica
+func (d *Database) connectReplica(replicaConfig config.ReplicaConfig, gormConfig *gorm.Config) (*Replica, error) {
+	dialector, err := d.dialector(d.Config.GetReplicaDSN(replicaConfig))
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replica connection: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+
+	maxOpenConns, maxIdleConns := d.Config.MaxOpenConns, d.Config.MaxIdleConns
+	if replicaConfig.MaxOpenConns > 0 {
+		maxOpenConns = replicaConfig.MaxOpenConns
+	}
+	if replicaConfig.MaxIdleConns > 0 {
+		maxIdleConns = replicaConfig.MaxIdleConns
+	}
+	sqlDB.SetMaxIdleConns(maxIdleConns)
+	sqlDB.SetMaxOpenConns(maxOpenConns)
+	sqlDB.SetConnMaxLifetime(d.Config.ConnMaxLifetime)
+
+	d.Logger.WithField("replica", replicaConfig.Name).Info("Database replica connection established")
+	return NewReplica(replicaConfig.Name, db), nil
+}
+
+func (d *Database) dialector(dsn string) (gorm.Dialector, error) {
+	switch d.Config.Driver {
+	case "postgres":
+		return postgres.Open(dsn), nil
+	case "mysql":
+		return mysql.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", d.Config.Driver)
+	}
+}
+
+// StartHeartbeat writes the heartbeat replica lag is measured from until
+// ctx is done. It does nothing when no replica is configured.
+func (d *Database) StartHeartbeat(ctx context.Context) {
+	d.Router.Start(ctx, d.Config.ReplicaHeartbeatInterval)
+}
+
 // AutoMigrate runs database migrations
 func (d *Database) AutoMigrate() error {
 	d.Logger.Info("Running database migrations...")
@@ -97,6 +155,7 @@ func (d *Database) AutoMigrate() error {
 		&models.Execution{},
 		&models.StepExecution{},
 		&models.ExecutionEvent{},
+		&models.ExecutionPlacement{},
 		&models.WorkflowVersion{},
 		&models.Deployment{},
 		&models.WorkflowMetric{},
@@ -111,6 +170,11 @@ func (d *Database) AutoMigrate() error {
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
+	if len(d.Config.Replicas) > 0 {
+		if err := d.Router.Migrate(); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
 
 	d.Logger.Info("Database migrations completed")
 	return nil
@@ -118,6 +182,13 @@ func (d *Database) AutoMigrate() error {
 
 // Close closes the database connection
 func (d *Database) Close() error {
+	if d.Router != nil {
+		for _, replica := range d.Router.Replicas() {
+			if sqlDB, err := replica.DB.DB(); err == nil {
+				sqlDB.Close()
+			}
+		}
+	}
 	if d.DB != nil {
 		sqlDB, err := d.DB.DB()
 		if err != nil {
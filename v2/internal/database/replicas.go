@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Replication lag tolerated by the reads repositories send to replicas
+const (
+	// DashboardStaleness is tolerated by dashboard, metrics and statistics
+	// reads
+	DashboardStaleness = 30 * time.Second
+	// ListStaleness is tolerated by list endpoints
+	ListStaleness = 5 * time.Second
+)
+
+const (
+	// DefaultLagCheckInterval is how long a measured replica lag is reused
+	// before the heartbeat is read from the replica again
+	DefaultLagCheckInterval = time.Second
+	// DefaultReplicaRetryInterval is how long a replica that failed is
+	// skipped before reads are sent to it again
+	DefaultReplicaRetryInterval = 30 * time.Second
+
+	// heartbeatID is the ID of the heartbeat row
+	heartbeatID = 1
+)
+
+// ReplicationHeartbeat is the row the primary keeps updating so replicas
+// report how far behind they are
+type ReplicationHeartbeat struct {
+	ID     int       `gorm:"primaryKey;autoIncrement:false"`
+	BeatAt time.Time `gorm:"not null"`
+}
+
+// TableName returns the table name of the heartbeat
+func (ReplicationHeartbeat) TableName() string {
+	return "replication_heartbeats"
+}
+
+// MetricsRecorder records replica fallback metrics
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// Replica is a read replica of the primary database
+type Replica struct {
+	Name string
+	DB   *gorm.DB
+
+	mu        sync.Mutex
+	lag       time.Duration
+	checkedAt time.Time
+	downUntil time.Time
+}
+
+// NewReplica creates a read replica
+func NewReplica(name string, db *gorm.DB) *Replica {
+	return &Replica{Name: name, DB: db}
+}
+
+// RouterConfig configures a Router
+type RouterConfig struct {
+	// LagCheckInterval defaults to DefaultLagCheckInterval
+	LagCheckInterval time.Duration
+	// RetryInterval defaults to DefaultReplicaRetryInterval
+	RetryInterval time.Duration
+}
+
+// Router routes reads that tolerate replication lag to read replicas and
+// everything else to the primary. A replica lagging more than a read
+// tolerates, or failing, is skipped and the read falls back to the
+// primary. A router without replicas sends every read to the primary.
+type Router struct {
+	primary  *gorm.DB
+	replicas []*Replica
+	config   RouterConfig
+	metrics  MetricsRecorder
+	logger   *logrus.Logger
+	now      func() time.Time
+	next     uint32
+}
+
+// NewRouter creates a router of reads between a primary and its replicas
+func NewRouter(primary *gorm.DB, replicas []*Replica, config RouterConfig, metrics MetricsRecorder, logger *logrus.Logger) *Router {
+	if config.LagCheckInterval <= 0 {
+		config.LagCheckInterval = DefaultLagCheckInterval
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultReplicaRetryInterval
+	}
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	return &Router{
+		primary:  primary,
+		replicas: replicas,
+		config:   config,
+		metrics:  metrics,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// newPrimaryRouter creates a router sending every read to db
+func newPrimaryRouter(db *gorm.DB) *Router {
+	return NewRouter(db, nil, RouterConfig{}, nil, nil)
+}
+
+// SetMetrics sets the recorder of the database_replica_fallbacks_total
+// metric
+func (r *Router) SetMetrics(metrics MetricsRecorder) {
+	r.metrics = metrics
+}
+
+// Primary returns the primary database
+func (r *Router) Primary() *gorm.DB {
+	return r.primary
+}
+
+// Replicas returns the read replicas
+func (r *Router) Replicas() []*Replica {
+	return r.replicas
+}
+
+// Read runs query on a replica lagging at most tolerance behind the
+// primary, or on the primary when no replica is available. A query failing
+// on a replica is run again on the primary; gorm.ErrRecordNotFound is not a
+// failure.
+func (r *Router) Read(tolerance time.Duration, query func(db *gorm.DB) error) error {
+	replica := r.pick(tolerance)
+	if replica == nil {
+		return query(r.primary)
+	}
+	err := query(replica.DB)
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	r.markDown(replica, err)
+	return query(r.primary)
+}
+
+// ReadContext is Read with the queries run with ctx, such as the context
+// carrying the tenant they are scoped to
+func (r *Router) ReadContext(ctx context.Context, tolerance time.Duration, query func(db *gorm.DB) error) error {
+	return r.Read(tolerance, func(db *gorm.DB) error {
+		return query(db.WithContext(ctx))
+	})
+}
+
+// pick returns the next replica in turn that is up and lags at most
+// tolerance, nil if there is none
+func (r *Router) pick(tolerance time.Duration) *Replica {
+	n := uint32(len(r.replicas))
+	if n == 0 {
+		return nil
+	}
+	start := atomic.AddUint32(&r.next, 1)
+	for i := uint32(0); i < n; i++ {
+		replica := r.replicas[(start+i)%n]
+		lag, ok := r.lag(replica)
+		if !ok {
+			continue
+		}
+		if lag > tolerance {
+			r.recordFallback(replica, "lag")
+			continue
+		}
+		return replica
+	}
+	return nil
+}
+
+// lag returns the replication lag of a replica, measuring it again when the
+// last measure is older than the lag check interval. It reports false for
+// a replica that is down.
+func (r *Router) lag(replica *Replica) (time.Duration, bool) {
+	now := r.now()
+	replica.mu.Lock()
+	if now.Before(replica.downUntil) {
+		replica.mu.Unlock()
+		r.recordFallback(replica, "unavailable")
+		return 0, false
+	}
+	if !replica.checkedAt.IsZero() && now.Sub(replica.checkedAt) < r.config.LagCheckInterval {
+		lag := replica.lag
+		replica.mu.Unlock()
+		return lag, true
+	}
+	replica.mu.Unlock()
+
+	var heartbeat ReplicationHeartbeat
+	err := replica.DB.Where("id = ?", heartbeatID).Take(&heartbeat).Error
+	var lag time.Duration
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// The replica has not received a heartbeat yet, so how far behind
+		// it is cannot be told
+		lag = time.Duration(math.MaxInt64)
+	case err != nil:
+		r.markDown(replica, err)
+		return 0, false
+	default:
+		lag = now.Sub(heartbeat.BeatAt)
+		if lag < 0 {
+			lag = 0
+		}
+	}
+
+	replica.mu.Lock()
+	replica.lag = lag
+	replica.checkedAt = now
+	replica.mu.Unlock()
+	return lag, true
+}
+
+// markDown skips a failed replica for the retry interval
+func (r *Router) markDown(replica *Replica, err error) {
+	replica.mu.Lock()
+	replica.downUntil = r.now().Add(r.config.RetryInterval)
+	replica.checkedAt = time.Time{}
+	replica.mu.Unlock()
+
+	r.logger.WithFields(logrus.Fields{
+		"replica": replica.Name,
+		"error":   err.Error(),
+	}).Warn("Database replica failed, reading from the primary")
+	r.recordFallback(replica, "unavailable")
+}
+
+func (r *Router) recordFallback(replica *Replica, reason string) {
+	if r.metrics != nil {
+		r.metrics.RecordMetric("database_replica_fallbacks_total", 1, map[string]string{
+			"replica": replica.Name,
+			"reason":  reason,
+		})
+	}
+}
+
+// Migrate creates the heartbeat table on the primary
+func (r *Router) Migrate() error {
+	return r.primary.AutoMigrate(&ReplicationHeartbeat{})
+}
+
+// Beat writes the heartbeat to the primary
+func (r *Router) Beat(ctx context.Context) error {
+	return r.primary.WithContext(ctx).Save(&ReplicationHeartbeat{ID: heartbeatID, BeatAt: r.now().UTC()}).Error
+}
+
+// Start writes the heartbeat every interval until ctx is done. It does
+// nothing for a router without replicas.
+func (r *Router) Start(ctx context.Context, interval time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := r.Beat(ctx); err != nil && ctx.Err() == nil {
+				r.logger.WithError(err).Warn("Failed to write the replication heartbeat")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// order is the record the tests read from the primary and the replica
+type order struct {
+	ID   int
+	Name string
+}
+
+// recordingMetrics records the labels of each metric
+type recordingMetrics struct {
+	mu     sync.Mutex
+	labels map[string][]map[string]string
+}
+
+func (m *recordingMetrics) RecordMetric(name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.labels == nil {
+		m.labels = make(map[string][]map[string]string)
+	}
+	m.labels[name] = append(m.labels[name], labels)
+}
+
+func (m *recordingMetrics) Recorded(name string) []map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.labels[name]
+}
+
+func openSQLite(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&order{}, &ReplicationHeartbeat{}))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// replicaFixture is a primary and a replica holding a delayed copy of its
+// orders, the replica copy is missing the latest order
+type replicaFixture struct {
+	primary *gorm.DB
+	replica *gorm.DB
+	router  *Router
+	metrics *recordingMetrics
+	now     time.Time
+}
+
+func newReplicaFixture(t *testing.T) *replicaFixture {
+	f := &replicaFixture{
+		primary: openSQLite(t, "primary.db"),
+		replica: openSQLite(t, "replica.db"),
+		metrics: &recordingMetrics{},
+		now:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, f.primary.Create(&[]order{{ID: 1, Name: "first"}, {ID: 2, Name: "latest"}}).Error)
+	require.NoError(t, f.replica.Create(&order{ID: 1, Name: "first"}).Error)
+
+	f.router = NewRouter(f.primary, []*Replica{NewReplica("replica-1", f.replica)}, RouterConfig{
+		LagCheckInterval: time.Second,
+		RetryInterval:    30 * time.Second,
+	}, f.metrics, logrus.New())
+	f.router.now = func() time.Time { return f.now }
+	return f
+}
+
+// replicate copies the heartbeat of the primary to the replica as it was
+// lag ago
+func (f *replicaFixture) replicate(t *testing.T, lag time.Duration) {
+	t.Helper()
+	require.NoError(t, f.replica.Save(&ReplicationHeartbeat{ID: heartbeatID, BeatAt: f.now.Add(-lag)}).Error)
+}
+
+// countOrders counts the orders through the router, telling which database
+// served the read
+func (f *replicaFixture) countOrders(t *testing.T, tolerance time.Duration) int64 {
+	t.Helper()
+	var count int64
+	require.NoError(t, f.router.Read(tolerance, func(db *gorm.DB) error {
+		return db.Model(&order{}).Count(&count).Error
+	}))
+	return count
+}
+
+func TestRouterWithoutReplicas(t *testing.T) {
+	f := newReplicaFixture(t)
+	metrics := &recordingMetrics{}
+	router := NewRouter(f.primary, nil, RouterConfig{}, metrics, logrus.New())
+
+	var count int64
+	require.NoError(t, router.Read(ListStaleness, func(db *gorm.DB) error {
+		return db.Model(&order{}).Count(&count).Error
+	}))
+	assert.EqualValues(t, 2, count)
+	assert.Empty(t, metrics.Recorded("database_replica_fallbacks_total"))
+
+	// Without replicas no heartbeat is written
+	ctx, cancel := context.WithCancel(context.Background())
+	router.Start(ctx, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	var heartbeats int64
+	require.NoError(t, f.primary.Model(&ReplicationHeartbeat{}).Count(&heartbeats).Error)
+	assert.Zero(t, heartbeats)
+}
+
+func TestRouterRouting(t *testing.T) {
+	f := newReplicaFixture(t)
+	f.replicate(t, 2*time.Second)
+
+	assert.EqualValues(t, 1, f.countOrders(t, ListStaleness), "reads tolerating the lag go to the replica")
+	var primaryCount int64
+	require.NoError(t, f.router.Primary().Model(&order{}).Count(&primaryCount).Error)
+	assert.EqualValues(t, 2, primaryCount, "the primary keeps the latest order")
+	assert.Empty(t, f.metrics.Recorded("database_replica_fallbacks_total"))
+
+	t.Run("not found is not a failure", func(t *testing.T) {
+		var missing order
+		err := f.router.Read(ListStaleness, func(db *gorm.DB) error {
+			return db.First(&missing, "id = ?", 2).Error
+		})
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		assert.Empty(t, f.metrics.Recorded("database_replica_fallbacks_total"))
+	})
+}
+
+func TestRouterLagFallback(t *testing.T) {
+	f := newReplicaFixture(t)
+	f.replicate(t, 10*time.Second)
+
+	assert.EqualValues(t, 2, f.countOrders(t, ListStaleness), "the replica lags more than list reads tolerate")
+	assert.EqualValues(t, 1, f.countOrders(t, DashboardStaleness), "dashboard reads tolerate the lag")
+	assert.Equal(t, []map[string]string{{"replica": "replica-1", "reason": "lag"}}, f.metrics.Recorded("database_replica_fallbacks_total"))
+
+	t.Run("lag is measured again after the check interval", func(t *testing.T) {
+		f.replicate(t, 0)
+		assert.EqualValues(t, 2, f.countOrders(t, ListStaleness), "the last measure is reused")
+
+		f.now = f.now.Add(time.Second)
+		f.replicate(t, 0)
+		assert.EqualValues(t, 1, f.countOrders(t, ListStaleness))
+	})
+
+	t.Run("replica without a heartbeat", func(t *testing.T) {
+		require.NoError(t, f.replica.Where("1 = 1").Delete(&ReplicationHeartbeat{}).Error)
+		f.now = f.now.Add(time.Second)
+		assert.EqualValues(t, 2, f.countOrders(t, DashboardStaleness))
+	})
+}
+
+func TestRouterFailover(t *testing.T) {
+	f := newReplicaFixture(t)
+	f.replicate(t, 0)
+	assert.EqualValues(t, 1, f.countOrders(t, ListStaleness))
+
+	// The replica fails after its lag was measured, the read is run again
+	// on the primary
+	sqlDB, err := f.replica.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	assert.EqualValues(t, 2, f.countOrders(t, ListStaleness))
+	assert.Equal(t, []map[string]string{{"replica": "replica-1", "reason": "unavailable"}}, f.metrics.Recorded("database_replica_fallbacks_total"))
+
+	// The replica is skipped until the retry interval passed
+	f.now = f.now.Add(10 * time.Second)
+	assert.EqualValues(t, 2, f.countOrders(t, ListStaleness))
+	assert.Len(t, f.metrics.Recorded("database_replica_fallbacks_total"), 2)
+
+	// Reached again after the retry interval, its lag check fails
+	f.now = f.now.Add(30 * time.Second)
+	assert.EqualValues(t, 2, f.countOrders(t, ListStaleness))
+	assert.Len(t, f.metrics.Recorded("database_replica_fallbacks_total"), 3)
+}
+
+func TestRouterHeartbeat(t *testing.T) {
+	f := newReplicaFixture(t)
+	ctx := context.Background()
+
+	require.NoError(t, f.router.Beat(ctx))
+	f.now = f.now.Add(time.Second)
+	require.NoError(t, f.router.Beat(ctx))
+
+	var heartbeats []ReplicationHeartbeat
+	require.NoError(t, f.primary.Find(&heartbeats).Error)
+	require.Len(t, heartbeats, 1)
+	assert.True(t, f.now.Equal(heartbeats[0].BeatAt), "the heartbeat row is updated in place")
+}
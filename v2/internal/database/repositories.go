@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -12,12 +13,25 @@ import (
 
 // WorkflowRepository handles workflow data operations
 type WorkflowRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *Router
 }
 
 // NewWorkflowRepository creates a new workflow repository
 func NewWorkflowRepository(db *gorm.DB) *WorkflowRepository {
-	return &WorkflowRepository{db: db}
+	return &WorkflowRepository{db: db, reads: newPrimaryRouter(db)}
+}
+
+// WithContext returns the repository querying with ctx. In multi-tenant
+// deployments its queries are scoped to the tenant of ctx.
+func (r *WorkflowRepository) WithContext(ctx context.Context) *WorkflowRepository {
+	return &WorkflowRepository{db: r.db.WithContext(ctx), reads: r.reads}
+}
+
+// read runs a query through the reads router with the context of the
+// repository
+func (r *WorkflowRepository) read(tolerance time.Duration, query func(db *gorm.DB) error) error {
+	return r.reads.ReadContext(r.db.Statement.Context, tolerance, query)
 }
 
 func (r *WorkflowRepository) Create(workflow *models.Workflow) error {
@@ -46,19 +60,24 @@ func (r *WorkflowRepository) List(limit, offset int, status string) ([]*models.W
 	var workflows []*models.Workflow
 	var total int64
 
-	query := r.db.Model(&models.Workflow{})
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
+	err := r.read(ListStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.Workflow{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+		// Get workflows with pagination
+		return query.Preload("Versions").Limit(limit).Offset(offset).Order("created_at DESC").Find(&workflows).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
-
-	// Get workflows with pagination
-	err := query.Preload("Versions").Limit(limit).Offset(offset).Order("created_at DESC").Find(&workflows).Error
-	return workflows, total, err
+	return workflows, total, nil
 }
 
 func (r *WorkflowRepository) Update(workflow *models.Workflow) error {
@@ -73,14 +92,35 @@ func (r *WorkflowRepository) UpdateStatus(id uuid.UUID, status models.WorkflowSt
 	return r.db.Model(&models.Workflow{}).Where("id = ?", id).Update("status", status).Error
 }
 
+func (r *WorkflowRepository) ListDeprecated() ([]*models.Workflow, error) {
+	var workflows []*models.Workflow
+	err := r.read(ListStaleness, func(db *gorm.DB) error {
+		return db.Where("deprecation IS NOT NULL").Order("name").Find(&workflows).Error
+	})
+	return workflows, err
+}
+
 // ExecutionRepository handles execution data operations
 type ExecutionRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *Router
 }
 
 // NewExecutionRepository creates a new execution repository
 func NewExecutionRepository(db *gorm.DB) *ExecutionRepository {
-	return &ExecutionRepository{db: db}
+	return &ExecutionRepository{db: db, reads: newPrimaryRouter(db)}
+}
+
+// WithContext returns the repository querying with ctx. In multi-tenant
+// deployments its queries are scoped to the tenant of ctx.
+func (r *ExecutionRepository) WithContext(ctx context.Context) *ExecutionRepository {
+	return &ExecutionRepository{db: r.db.WithContext(ctx), reads: r.reads}
+}
+
+// read runs a query through the reads router with the context of the
+// repository
+func (r *ExecutionRepository) read(tolerance time.Duration, query func(db *gorm.DB) error) error {
+	return r.reads.ReadContext(r.db.Statement.Context, tolerance, query)
 }
 
 func (r *ExecutionRepository) Create(execution *models.Execution) error {
@@ -89,7 +129,9 @@ func (r *ExecutionRepository) Create(execution *models.Execution) error {
 
 func (r *ExecutionRepository) GetByID(id uuid.UUID) (*models.Execution, error) {
 	var execution models.Execution
-	err := r.db.Preload("Steps").Preload("Events").First(&execution, "id = ?", id).Error
+	err := r.db.Preload("Steps").Preload("Events").Preload("Placements", func(db *gorm.DB) *gorm.DB {
+		return db.Order("placed_at ASC")
+	}).First(&execution, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -100,22 +142,83 @@ func (r *ExecutionRepository) List(workflowID *uuid.UUID, limit, offset int, sta
 	var executions []*models.Execution
 	var total int64
 
-	query := r.db.Model(&models.Execution{})
-	if workflowID != nil {
-		query = query.Where("workflow_id = ?", *workflowID)
-	}
-	if status != "" {
-		query = query.Where("status = ?", status)
+	err := r.read(ListStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.Execution{})
+		if workflowID != nil {
+			query = query.Where("workflow_id = ?", *workflowID)
+		}
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
+
+		// Get executions with pagination
+		return query.Preload("Steps").Limit(limit).Offset(offset).Order("started_at DESC").Find(&executions).Error
+	})
+	if err != nil {
+		return nil, 0, err
 	}
+	return executions, total, nil
+}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+// ListByCorrelationID returns the executions sharing a correlation ID, oldest
+// first so that parents precede the executions they spawned
+func (r *ExecutionRepository) ListByCorrelationID(correlationID string) ([]*models.Execution, error) {
+	var executions []*models.Execution
+	err := r.read(ListStaleness, func(db *gorm.DB) error {
+		return db.Where("correlation_id = ?", correlationID).Order("created_at ASC").Find(&executions).Error
+	})
+	return executions, err
+}
+
+// ListByNodeID returns the executions placed on a worker node at any hop,
+// newest first
+func (r *ExecutionRepository) ListByNodeID(nodeID string, limit, offset int) ([]*models.Execution, int64, error) {
+	var executions []*models.Execution
+	var total int64
+
+	err := r.read(ListStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.Execution{}).
+			Where("id IN (?)", db.Model(&models.ExecutionPlacement{}).Select("execution_id").Where("node_id = ?", nodeID))
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
+
+		return query.Limit(limit).Offset(offset).Order("started_at DESC").Find(&executions).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
+	return executions, total, nil
+}
 
-	// Get executions with pagination
-	err := query.Preload("Steps").Limit(limit).Offset(offset).Order("started_at DESC").Find(&executions).Error
-	return executions, total, err
+// ListAfter returns executions with their steps in the order of their
+// creation, after the execution created at afterCreatedAt with afterID, for
+// keyset scans of historical executions. Zero bounds and an empty workflow
+// list select every execution.
+func (r *ExecutionRepository) ListAfter(from, to time.Time, workflowIDs []uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]*models.Execution, error) {
+	var executions []*models.Execution
+	err := r.read(ListStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.Execution{})
+		if !from.IsZero() {
+			query = query.Where("created_at >= ?", from)
+		}
+		if !to.IsZero() {
+			query = query.Where("created_at <= ?", to)
+		}
+		if len(workflowIDs) > 0 {
+			query = query.Where("workflow_id IN ?", workflowIDs)
+		}
+		if !afterCreatedAt.IsZero() {
+			query = query.Where("(created_at, id) > (?, ?)", afterCreatedAt, afterID)
+		}
+		return query.Preload("Steps").Order("created_at ASC, id ASC").Limit(limit).Find(&executions).Error
+	})
+	return executions, err
 }
 
 func (r *ExecutionRepository) Update(execution *models.Execution) error {
@@ -135,6 +238,31 @@ func (r *ExecutionRepository) UpdateStatus(id uuid.UUID, status models.Execution
 	return r.db.Model(&models.Execution{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// ListParked returns parked executions with their steps, those parked
+// longest first. It reads the primary, as parked executions are claimed
+// right after.
+func (r *ExecutionRepository) ListParked(limit int) ([]*models.Execution, error) {
+	var executions []*models.Execution
+	err := r.db.Preload("Steps").Where("status = ?", models.ExecutionStatusParked).
+		Order("updated_at ASC, id ASC").Limit(limit).Find(&executions).Error
+	return executions, err
+}
+
+// ClaimParked switches a parked execution to running, reporting whether it
+// did. Of nodes claiming the same execution concurrently, one succeeds.
+func (r *ExecutionRepository) ClaimParked(id uuid.UUID) (bool, error) {
+	result := r.db.Model(&models.Execution{}).
+		Where("id = ? AND status = ?", id, models.ExecutionStatusParked).
+		Updates(map[string]interface{}{
+			"status":     models.ExecutionStatusRunning,
+			"updated_at": time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func (r *ExecutionRepository) GetActiveExecutions() ([]*models.Execution, error) {
 	var executions []*models.Execution
 	err := r.db.Where("status IN ?", []models.ExecutionStatus{
@@ -147,52 +275,198 @@ func (r *ExecutionRepository) GetActiveExecutions() ([]*models.Execution, error)
 func (r *ExecutionRepository) GetExecutionStats(workflowID *uuid.UUID, from, to time.Time) (map[string]int64, error) {
 	stats := make(map[string]int64)
 
-	query := r.db.Model(&models.Execution{}).Where("started_at BETWEEN ? AND ?", from, to)
-	if workflowID != nil {
-		query = query.Where("workflow_id = ?", *workflowID)
+	err := r.read(DashboardStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.Execution{}).Where("started_at BETWEEN ? AND ?", from, to)
+		if workflowID != nil {
+			query = query.Where("workflow_id = ?", *workflowID)
+		}
+
+		// Total executions
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
+		stats["total"] = total
+
+		// Status breakdown
+		statuses := []models.ExecutionStatus{
+			models.ExecutionStatusCompleted,
+			models.ExecutionStatusFailed,
+			models.ExecutionStatusCancelled,
+			models.ExecutionStatusRunning,
+			models.ExecutionStatusPending,
+		}
+
+		for _, status := range statuses {
+			var count int64
+			if err := query.Where("status = ?", status).Count(&count).Error; err != nil {
+				return err
+			}
+			stats[string(status)] = count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return stats, nil
+}
 
-	// Total executions
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
+// CountFailuresByTriageClass counts the failed executions of a workflow by
+// triage class, all workflows when workflowID is nil. Failures classified
+// before triage was enabled count as unclassified.
+func (r *ExecutionRepository) CountFailuresByTriageClass(workflowID *uuid.UUID, from, to time.Time) (map[string]int64, error) {
+	var rows []struct {
+		TriageClass string
+		Count       int64
+	}
+	err := r.read(DashboardStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.Execution{}).
+			Select("triage_class, COUNT(*) AS count").
+			Where("status = ? AND started_at BETWEEN ? AND ?", models.ExecutionStatusFailed, from, to)
+		if workflowID != nil {
+			query = query.Where("workflow_id = ?", *workflowID)
+		}
+		return query.Group("triage_class").Scan(&rows).Error
+	})
+	if err != nil {
 		return nil, err
 	}
-	stats["total"] = total
 
-	// Status breakdown
-	statuses := []models.ExecutionStatus{
-		models.ExecutionStatusCompleted,
-		models.ExecutionStatusFailed,
-		models.ExecutionStatusCancelled,
-		models.ExecutionStatusRunning,
-		models.ExecutionStatusPending,
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		class := row.TriageClass
+		if class == "" {
+			class = "unclassified"
+		}
+		counts[class] += row.Count
 	}
+	return counts, nil
+}
 
-	for _, status := range statuses {
-		var count int64
-		if err := query.Where("status = ?", status).Count(&count).Error; err != nil {
-			return nil, err
+// CountOutcomes counts the runs of a workflow, or of one of its steps when
+// step is set, that finished between from and to: all of them, those that
+// failed or timed out and those that took longer than slowerThan, none when
+// it is zero. Cancelled runs are not counted.
+func (r *ExecutionRepository) CountOutcomes(workflowID uuid.UUID, step string, from, to time.Time, slowerThan time.Duration) (total, failed, slow int64, err error) {
+	var row struct {
+		Total  int64
+		Failed int64
+		Slow   int64
+	}
+	err = r.read(DashboardStaleness, func(db *gorm.DB) error {
+		slowCount := "0"
+		if slowerThan > 0 {
+			slowCount = fmt.Sprintf("COUNT(CASE WHEN duration > %d THEN 1 END)", slowerThan.Milliseconds())
+		}
+
+		var query *gorm.DB
+		if step == "" {
+			query = db.Model(&models.Execution{}).
+				Where("workflow_id = ? AND status IN ?", workflowID, []models.ExecutionStatus{
+					models.ExecutionStatusCompleted,
+					models.ExecutionStatusCompletedWithWarnings,
+					models.ExecutionStatusFailed,
+					models.ExecutionStatusTimeout,
+				}).
+				Select("COUNT(*) AS total, COUNT(CASE WHEN status IN (?) THEN 1 END) AS failed, "+slowCount+" AS slow",
+					[]models.ExecutionStatus{models.ExecutionStatusFailed, models.ExecutionStatusTimeout})
+		} else {
+			executions := db.Model(&models.Execution{}).Select("id").Where("workflow_id = ?", workflowID)
+			query = db.Model(&models.StepExecution{}).
+				Where("step_name = ? AND execution_id IN (?) AND status IN ?", step, executions, []models.StepStatus{
+					models.StepStatusCompleted,
+					models.StepStatusFailed,
+				}).
+				Select("COUNT(*) AS total, COUNT(CASE WHEN status = ? THEN 1 END) AS failed, "+slowCount+" AS slow",
+					models.StepStatusFailed)
 		}
-		stats[string(status)] = count
+		return query.Where("completed_at >= ? AND completed_at <= ?", from, to).Scan(&row).Error
+	})
+	return row.Total, row.Failed, row.Slow, err
+}
+
+// StepStats aggregates the runs of a workflow step
+type StepStats struct {
+	StepName        string
+	StepType        string
+	Total           int64
+	Completed       int64
+	Failed          int64
+	AverageDuration time.Duration
+}
+
+// AggregateSteps aggregates the runs of the steps of a workflow that
+// finished between from and to, by step. Step durations are stored in
+// milliseconds, so steps shorter than a second keep their average.
+func (r *ExecutionRepository) AggregateSteps(workflowID uuid.UUID, from, to time.Time) ([]StepStats, error) {
+	var rows []struct {
+		StepName  string
+		StepType  string
+		Total     int64
+		Completed int64
+		Failed    int64
+		Average   *float64
+	}
+	err := r.read(DashboardStaleness, func(db *gorm.DB) error {
+		return db.Table("step_executions se").
+			Select("se.step_name, se.step_type, COUNT(*) AS total, "+
+				"COUNT(CASE WHEN se.status = ? THEN 1 END) AS completed, "+
+				"COUNT(CASE WHEN se.status = ? THEN 1 END) AS failed, "+
+				"AVG(se.duration) AS average", models.StepStatusCompleted, models.StepStatusFailed).
+			Joins("JOIN executions e ON e.id = se.execution_id").
+			Where("e.workflow_id = ? AND se.status IN ?", workflowID, []models.StepStatus{
+				models.StepStatusCompleted,
+				models.StepStatusFailed,
+			}).
+			Where("se.completed_at >= ? AND se.completed_at <= ?", from, to).
+			Group("se.step_name, se.step_type").
+			Order("se.step_name").
+			Scan(&rows).Error
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	stats := make([]StepStats, len(rows))
+	for i, row := range rows {
+		stats[i] = StepStats{
+			StepName:  row.StepName,
+			StepType:  row.StepType,
+			Total:     row.Total,
+			Completed: row.Completed,
+			Failed:    row.Failed,
+		}
+		if row.Average != nil {
+			stats[i].AverageDuration = time.Duration(*row.Average * float64(time.Millisecond))
+		}
+	}
 	return stats, nil
 }
 
 // StepExecutionRepository handles step execution data operations
 type StepExecutionRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *Router
 }
 
 // NewStepExecutionRepository creates a new step execution repository
 func NewStepExecutionRepository(db *gorm.DB) *StepExecutionRepository {
-	return &StepExecutionRepository{db: db}
+	return &StepExecutionRepository{db: db, reads: newPrimaryRouter(db)}
 }
 
 func (r *StepExecutionRepository) Create(stepExecution *models.StepExecution) error {
 	return r.db.Create(stepExecution).Error
 }
 
+// CreateBatch creates the step executions of an execution in one insert
+func (r *StepExecutionRepository) CreateBatch(stepExecutions []*models.StepExecution) error {
+	if len(stepExecutions) == 0 {
+		return nil
+	}
+	return r.db.Create(&stepExecutions).Error
+}
+
 func (r *StepExecutionRepository) GetByExecutionID(executionID uuid.UUID) ([]*models.StepExecution, error) {
 	var steps []*models.StepExecution
 	err := r.db.Where("execution_id = ?", executionID).Order("started_at ASC").Find(&steps).Error
@@ -214,12 +488,13 @@ func (r *StepExecutionRepository) UpdateStatus(id uuid.UUID, status models.StepS
 
 // ExecutionEventRepository handles execution event data operations
 type ExecutionEventRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *Router
 }
 
 // NewExecutionEventRepository creates a new execution event repository
 func NewExecutionEventRepository(db *gorm.DB) *ExecutionEventRepository {
-	return &ExecutionEventRepository{db: db}
+	return &ExecutionEventRepository{db: db, reads: newPrimaryRouter(db)}
 }
 
 func (r *ExecutionEventRepository) Create(event *models.ExecutionEvent) error {
@@ -230,26 +505,32 @@ func (r *ExecutionEventRepository) GetByExecutionID(executionID uuid.UUID, limit
 	var events []*models.ExecutionEvent
 	var total int64
 
-	query := r.db.Model(&models.ExecutionEvent{}).Where("execution_id = ?", executionID)
+	err := r.reads.Read(ListStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.ExecutionEvent{}).Where("execution_id = ?", executionID)
+
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+		// Get events with pagination
+		return query.Limit(limit).Offset(offset).Order("timestamp DESC").Find(&events).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
-
-	// Get events with pagination
-	err := query.Limit(limit).Offset(offset).Order("timestamp DESC").Find(&events).Error
-	return events, total, err
+	return events, total, nil
 }
 
 // WorkflowVersionRepository handles workflow version data operations
 type WorkflowVersionRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *Router
 }
 
 // NewWorkflowVersionRepository creates a new workflow version repository
 func NewWorkflowVersionRepository(db *gorm.DB) *WorkflowVersionRepository {
-	return &WorkflowVersionRepository{db: db}
+	return &WorkflowVersionRepository{db: db, reads: newPrimaryRouter(db)}
 }
 
 func (r *WorkflowVersionRepository) Create(version *models.WorkflowVersion) error {
@@ -269,16 +550,21 @@ func (r *WorkflowVersionRepository) GetByWorkflowID(workflowID uuid.UUID, limit,
 	var versions []*models.WorkflowVersion
 	var total int64
 
-	query := r.db.Model(&models.WorkflowVersion{}).Where("workflow_id = ?", workflowID)
+	err := r.reads.Read(ListStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.WorkflowVersion{}).Where("workflow_id = ?", workflowID)
+
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+		// Get versions with pagination
+		return query.Preload("Deployments").Limit(limit).Offset(offset).Order("created_at DESC").Find(&versions).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
-
-	// Get versions with pagination
-	err := query.Preload("Deployments").Limit(limit).Offset(offset).Order("created_at DESC").Find(&versions).Error
-	return versions, total, err
+	return versions, total, nil
 }
 
 func (r *WorkflowVersionRepository) GetLatestVersion(workflowID uuid.UUID) (*models.WorkflowVersion, error) {
@@ -294,14 +580,35 @@ func (r *WorkflowVersionRepository) UpdateStatus(id uuid.UUID, status models.Wor
 	return r.db.Model(&models.WorkflowVersion{}).Where("id = ?", id).Update("status", status).Error
 }
 
+func (r *WorkflowVersionRepository) Update(version *models.WorkflowVersion) error {
+	return r.db.Save(version).Error
+}
+
+func (r *WorkflowVersionRepository) ListDeprecated() ([]*models.WorkflowVersion, error) {
+	var versions []*models.WorkflowVersion
+	err := r.reads.Read(ListStaleness, func(db *gorm.DB) error {
+		return db.Where("deprecation IS NOT NULL").Order("workflow_id, created_at").Find(&versions).Error
+	})
+	return versions, err
+}
+
+func (r *WorkflowVersionRepository) ListProduction() ([]*models.WorkflowVersion, error) {
+	var versions []*models.WorkflowVersion
+	err := r.reads.Read(ListStaleness, func(db *gorm.DB) error {
+		return db.Where("status = ?", models.VersionStatusProduction).Order("workflow_id, created_at").Find(&versions).Error
+	})
+	return versions, err
+}
+
 // MetricsRepository handles metrics data operations
 type MetricsRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *Router
 }
 
 // NewMetricsRepository creates a new metrics repository
 func NewMetricsRepository(db *gorm.DB) *MetricsRepository {
-	return &MetricsRepository{db: db}
+	return &MetricsRepository{db: db, reads: newPrimaryRouter(db)}
 }
 
 func (r *MetricsRepository) CreateWorkflowMetric(metric *models.WorkflowMetric) error {
@@ -320,51 +627,62 @@ func (r *MetricsRepository) GetWorkflowMetrics(workflowID *uuid.UUID, metricName
 	var metrics []*models.WorkflowMetric
 	var total int64
 
-	query := r.db.Model(&models.WorkflowMetric{}).Where("timestamp BETWEEN ? AND ?", from, to)
-	if workflowID != nil {
-		query = query.Where("labels->>'workflow_id' = ?", workflowID.String())
-	}
-	if metricName != "" {
-		query = query.Where("name = ?", metricName)
-	}
+	err := r.reads.Read(DashboardStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.WorkflowMetric{}).Where("timestamp BETWEEN ? AND ?", from, to)
+		if workflowID != nil {
+			query = query.Where("labels->>'workflow_id' = ?", workflowID.String())
+		}
+		if metricName != "" {
+			query = query.Where("name = ?", metricName)
+		}
+
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+		// Get metrics with pagination
+		return query.Limit(limit).Offset(offset).Order("timestamp DESC").Find(&metrics).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
-
-	// Get metrics with pagination
-	err := query.Limit(limit).Offset(offset).Order("timestamp DESC").Find(&metrics).Error
-	return metrics, total, err
+	return metrics, total, nil
 }
 
 func (r *MetricsRepository) GetSystemMetrics(metricName string, from, to time.Time, limit, offset int) ([]*models.SystemMetric, int64, error) {
 	var metrics []*models.SystemMetric
 	var total int64
 
-	query := r.db.Model(&models.SystemMetric{}).Where("timestamp BETWEEN ? AND ?", from, to)
-	if metricName != "" {
-		query = query.Where("name = ?", metricName)
-	}
+	err := r.reads.Read(DashboardStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.SystemMetric{}).Where("timestamp BETWEEN ? AND ?", from, to)
+		if metricName != "" {
+			query = query.Where("name = ?", metricName)
+		}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
+
+		// Get metrics with pagination
+		return query.Limit(limit).Offset(offset).Order("timestamp DESC").Find(&metrics).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
-
-	// Get metrics with pagination
-	err := query.Limit(limit).Offset(offset).Order("timestamp DESC").Find(&metrics).Error
-	return metrics, total, err
+	return metrics, total, nil
 }
 
 // AlertRepository handles alert data operations
 type AlertRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *Router
 }
 
 // NewAlertRepository creates a new alert repository
 func NewAlertRepository(db *gorm.DB) *AlertRepository {
-	return &AlertRepository{db: db}
+	return &AlertRepository{db: db, reads: newPrimaryRouter(db)}
 }
 
 func (r *AlertRepository) Create(alert *models.Alert) error {
@@ -384,19 +702,24 @@ func (r *AlertRepository) List(limit, offset int, enabled *bool) ([]*models.Aler
 	var alerts []*models.Alert
 	var total int64
 
-	query := r.db.Model(&models.Alert{})
-	if enabled != nil {
-		query = query.Where("enabled = ?", *enabled)
-	}
+	err := r.reads.Read(ListStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.Alert{})
+		if enabled != nil {
+			query = query.Where("enabled = ?", *enabled)
+		}
+
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+		// Get alerts with pagination
+		return query.Limit(limit).Offset(offset).Order("created_at DESC").Find(&alerts).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
-
-	// Get alerts with pagination
-	err := query.Limit(limit).Offset(offset).Order("created_at DESC").Find(&alerts).Error
-	return alerts, total, err
+	return alerts, total, nil
 }
 
 func (r *AlertRepository) Update(alert *models.Alert) error {
@@ -415,26 +738,32 @@ func (r *AlertRepository) GetEvents(alertID uuid.UUID, limit, offset int) ([]*mo
 	var events []*models.AlertEvent
 	var total int64
 
-	query := r.db.Model(&models.AlertEvent{}).Where("alert_id = ?", alertID)
+	err := r.reads.Read(ListStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.AlertEvent{}).Where("alert_id = ?", alertID)
+
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+		// Get events with pagination
+		return query.Limit(limit).Offset(offset).Order("timestamp DESC").Find(&events).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
-
-	// Get events with pagination
-	err := query.Limit(limit).Offset(offset).Order("timestamp DESC").Find(&events).Error
-	return events, total, err
+	return events, total, nil
 }
 
 // DashboardRepository handles dashboard data operations
 type DashboardRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *Router
 }
 
 // NewDashboardRepository creates a new dashboard repository
 func NewDashboardRepository(db *gorm.DB) *DashboardRepository {
-	return &DashboardRepository{db: db}
+	return &DashboardRepository{db: db, reads: newPrimaryRouter(db)}
 }
 
 func (r *DashboardRepository) Create(dashboard *models.Dashboard) error {
@@ -454,22 +783,27 @@ func (r *DashboardRepository) List(limit, offset int, createdBy string, isPublic
 	var dashboards []*models.Dashboard
 	var total int64
 
-	query := r.db.Model(&models.Dashboard{})
-	if createdBy != "" {
-		query = query.Where("created_by = ?", createdBy)
-	}
-	if isPublic != nil {
-		query = query.Where("is_public = ?", *isPublic)
-	}
+	err := r.reads.Read(DashboardStaleness, func(db *gorm.DB) error {
+		query := db.Model(&models.Dashboard{})
+		if createdBy != "" {
+			query = query.Where("created_by = ?", createdBy)
+		}
+		if isPublic != nil {
+			query = query.Where("is_public = ?", *isPublic)
+		}
+
+		// Get total count
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
+		// Get dashboards with pagination
+		return query.Limit(limit).Offset(offset).Order("created_at DESC").Find(&dashboards).Error
+	})
+	if err != nil {
 		return nil, 0, err
 	}
-
-	// Get dashboards with pagination
-	err := query.Limit(limit).Offset(offset).Order("created_at DESC").Find(&dashboards).Error
-	return dashboards, total, err
+	return dashboards, total, nil
 }
 
 func (r *DashboardRepository) Update(dashboard *models.Dashboard) error {
@@ -504,4 +838,30 @@ func NewRepositoryManager(db *gorm.DB) *RepositoryManager {
 		Alert:           NewAlertRepository(db),
 		Dashboard:       NewDashboardRepository(db),
 	}
-}
\ No newline at end of file
+}
+
+// WithContext returns the repository manager querying workflows and
+// executions with ctx, scoped to its tenant in multi-tenant deployments
+func (m *RepositoryManager) WithContext(ctx context.Context) *RepositoryManager {
+	scoped := *m
+	scoped.Workflow = m.Workflow.WithContext(ctx)
+	scoped.Execution = m.Execution.WithContext(ctx)
+	return &scoped
+}
+
+// NewRoutedRepositoryManager creates a repository manager whose list,
+// dashboard and metrics reads go through router. Writes, and the reads of
+// records executions and version activation act on, stay on the primary.
+func NewRoutedRepositoryManager(router *Router) *RepositoryManager {
+	db := router.Primary()
+	return &RepositoryManager{
+		Workflow:        &WorkflowRepository{db: db, reads: router},
+		Execution:       &ExecutionRepository{db: db, reads: router},
+		StepExecution:   &StepExecutionRepository{db: db, reads: router},
+		ExecutionEvent:  &ExecutionEventRepository{db: db, reads: router},
+		WorkflowVersion: &WorkflowVersionRepository{db: db, reads: router},
+		Metrics:         &MetricsRepository{db: db, reads: router},
+		Alert:           &AlertRepository{db: db, reads: router},
+		Dashboard:       &DashboardRepository{db: db, reads: router},
+	}
+}
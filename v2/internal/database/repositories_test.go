@@ -0,0 +1,66 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// executionRun and stepRun are the parts of the execution records the step
+// aggregates read, the schema of the models needs a postgres database
+type executionRun struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	WorkflowID uuid.UUID
+}
+
+func (executionRun) TableName() string {
+	return "executions"
+}
+
+type stepRun struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ExecutionID uuid.UUID
+	StepName    string
+	StepType    string
+	Status      string
+	CompletedAt time.Time
+	Duration    int64
+}
+
+func (stepRun) TableName() string {
+	return "step_executions"
+}
+
+func TestAggregateSteps(t *testing.T) {
+	db := openSQLite(t, "steps.db")
+	require.NoError(t, db.AutoMigrate(&executionRun{}, &stepRun{}))
+
+	workflowID := uuid.New()
+	execution, other := uuid.New(), uuid.New()
+	require.NoError(t, db.Create(&[]executionRun{{ID: execution, WorkflowID: workflowID}, {ID: other, WorkflowID: uuid.New()}}).Error)
+
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	run := func(executionID uuid.UUID, name, status string, completedAt time.Time, durationMs int64) stepRun {
+		return stepRun{ID: uuid.New(), ExecutionID: executionID, StepName: name, StepType: "http", Status: status, CompletedAt: completedAt, Duration: durationMs}
+	}
+	require.NoError(t, db.Create(&[]stepRun{
+		run(execution, "validate", "completed", now, 120),
+		run(execution, "validate", "completed", now, 80),
+		run(execution, "validate", "failed", now, 400),
+		run(execution, "charge", "completed", now, 1500),
+		run(execution, "charge", "running", now, 0),
+		run(execution, "charge", "completed", now.Add(-48*time.Hour), 9000),
+		run(other, "charge", "completed", now, 9000),
+	}).Error)
+
+	stats, err := NewExecutionRepository(db).AggregateSteps(workflowID, now.Add(-time.Hour), now)
+	require.NoError(t, err)
+	assert.Equal(t, []StepStats{
+		{StepName: "charge", StepType: "http", Total: 1, Completed: 1, AverageDuration: 1500 * time.Millisecond},
+		// Steps shorter than a second do not average to nothing
+		{StepName: "validate", StepType: "http", Total: 3, Completed: 2, Failed: 1, AverageDuration: 200 * time.Millisecond},
+	}, stats)
+}
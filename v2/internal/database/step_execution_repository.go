@@ -242,9 +242,9 @@ func (r *stepExecutionRepository) GetStepExecutionStats(executionID *uuid.UUID,
 		AvgDuration *float64 `gorm:"column:avg_duration"`
 	}
 
-	err := query.Session(&gorm.Session{}).Select("AVG(EXTRACT(EPOCH FROM (completed_at - started_at))) as avg_duration").Where("status = ? AND started_at IS NOT NULL AND completed_at IS NOT NULL", models.StepExecutionStatusCompleted).Scan(&result).Error
+	err := query.Session(&gorm.Session{}).Select("AVG(duration) as avg_duration").Where("status = ? AND duration IS NOT NULL", models.StepExecutionStatusCompleted).Scan(&result).Error
 	if err == nil && result.AvgDuration != nil {
-		duration := time.Duration(*result.AvgDuration) * time.Second
+		duration := time.Duration(*result.AvgDuration * float64(time.Millisecond))
 		avgDuration = &duration
 	}
 	stats["average_duration"] = avgDuration
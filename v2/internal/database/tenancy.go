@@ -0,0 +1,157 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"magic-flow/v2/internal/tenancy"
+)
+
+// tenantField is the field of the models owned by a tenant
+const tenantField = "TenantID"
+
+// EnableTenancy scopes the queries of db on models with a TenantID, such as
+// workflows and executions, to the tenant of their context. Reads, updates
+// and deletes only match the records of the tenant, and created records are
+// assigned to it. Queries without a tenant fail with tenancy.ErrNoTenant
+// unless their context is a system context. It must be enabled on the
+// primary and on every read replica.
+func EnableTenancy(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("tenancy:query", scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenancy:row", scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenancy:update", func(db *gorm.DB) {
+		if field, tenant, ok := tenantScope(db); ok {
+			assignTenant(db, field, tenant)
+			whereTenant(db, field, tenant)
+		}
+	}); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenancy:delete", scopeTenant); err != nil {
+		return err
+	}
+	return callbacks.Create().Before("gorm:create").Register("tenancy:create", func(db *gorm.DB) {
+		if field, tenant, ok := tenantScope(db); ok {
+			assignTenant(db, field, tenant)
+			upsertTenant(db, field, tenant)
+		}
+	})
+}
+
+func scopeTenant(db *gorm.DB) {
+	if field, tenant, ok := tenantScope(db); ok {
+		whereTenant(db, field, tenant)
+	}
+}
+
+// tenantScope returns the tenant field of the model of a statement and the
+// tenant of its context. It reports false for models not owned by a tenant
+// and for system contexts, and fails the statement when the context has
+// no tenant.
+func tenantScope(db *gorm.DB) (*schema.Field, string, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, "", false
+	}
+	field := db.Statement.Schema.LookUpField(tenantField)
+	if field == nil || tenancy.IsSystem(db.Statement.Context) {
+		return nil, "", false
+	}
+	tenant := tenancy.FromContext(db.Statement.Context)
+	if tenant == "" {
+		db.AddError(fmt.Errorf("%w: %s", tenancy.ErrNoTenant, db.Statement.Schema.Table))
+		return nil, "", false
+	}
+	return field, tenant, true
+}
+
+// whereTenant adds the tenant to the conditions of a statement. Existing
+// conditions are grouped so that their OR conditions cannot match the
+// records of other tenants.
+func whereTenant(db *gorm.DB, field *schema.Field, tenant string) {
+	eq := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant}
+	if c, ok := db.Statement.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			c.Expression = clause.Where{Exprs: []clause.Expression{clause.And(where.Exprs...), eq}}
+			db.Statement.Clauses["WHERE"] = c
+			return
+		}
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{eq}})
+}
+
+// assignTenant assigns the records written by a statement without a tenant
+// to the tenant, and fails the statement for records of another tenant
+func assignTenant(db *gorm.DB, field *schema.Field, tenant string) {
+	if values, ok := db.Statement.Dest.(map[string]interface{}); ok {
+		assigned := false
+		for _, key := range []string{field.Name, field.DBName} {
+			if value, exists := values[key]; exists {
+				if value != tenant {
+					db.AddError(tenancy.ErrCrossTenant)
+					return
+				}
+				assigned = true
+			}
+		}
+		if !assigned {
+			values[field.DBName] = tenant
+		}
+	}
+
+	switch value := db.Statement.ReflectValue; value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			assignRecord(db, field, reflect.Indirect(value.Index(i)), tenant)
+		}
+	case reflect.Struct:
+		assignRecord(db, field, value, tenant)
+	}
+}
+
+func assignRecord(db *gorm.DB, field *schema.Field, record reflect.Value, tenant string) {
+	if record.Kind() != reflect.Struct {
+		return
+	}
+	current, zero := field.ValueOf(db.Statement.Context, record)
+	if zero {
+		if err := field.Set(db.Statement.Context, record, tenant); err != nil {
+			db.AddError(err)
+		}
+		return
+	}
+	if current != tenant {
+		db.AddError(tenancy.ErrCrossTenant)
+	}
+}
+
+// upsertTenant limits the updates of an upsert, such as the create Save
+// falls back to when it updated nothing, to the records of the tenant so
+// that it cannot overwrite the record of another tenant with the same key.
+// MySQL cannot limit the updates of upserts, so they fail there.
+func upsertTenant(db *gorm.DB, field *schema.Field, tenant string) {
+	c, ok := db.Statement.Clauses["ON CONFLICT"]
+	if !ok {
+		return
+	}
+	onConflict, ok := c.Expression.(clause.OnConflict)
+	if !ok || onConflict.DoNothing {
+		return
+	}
+	if db.Dialector.Name() == "mysql" {
+		db.AddError(fmt.Errorf("%w: upserts cannot be limited to a tenant on mysql", tenancy.ErrCrossTenant))
+		return
+	}
+	eq := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant}
+	onConflict.Where.Exprs = append(onConflict.Where.Exprs, eq)
+	c.Expression = onConflict
+	db.Statement.Clauses["ON CONFLICT"] = c
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/tenancy"
+)
+
+// tenantWorkflow is the tenant-owned part of a workflow record, the schema
+// of models.Workflow needs a postgres database
+type tenantWorkflow struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Name     string
+	Status   string
+	TenantID string `gorm:"index"`
+}
+
+func (tenantWorkflow) TableName() string {
+	return "workflows"
+}
+
+// tenancyFixture is a database with tenant isolation enabled holding an
+// orders workflow of the payments and of the shipping tenants
+type tenancyFixture struct {
+	db       *gorm.DB
+	payments uuid.UUID
+	shipping uuid.UUID
+}
+
+func newTenancyFixture(t *testing.T) *tenancyFixture {
+	db := openSQLite(t, "tenancy.db")
+	require.NoError(t, db.AutoMigrate(&tenantWorkflow{}))
+	require.NoError(t, EnableTenancy(db))
+
+	f := &tenancyFixture{db: db, payments: uuid.New(), shipping: uuid.New()}
+	system := db.WithContext(tenancy.WithSystem(context.Background()))
+	require.NoError(t, system.Create(&[]tenantWorkflow{
+		{ID: f.payments, Name: "orders", Status: "active", TenantID: "payments"},
+		{ID: f.shipping, Name: "orders", Status: "active", TenantID: "shipping"},
+	}).Error)
+	return f
+}
+
+func (f *tenancyFixture) as(tenant string) *gorm.DB {
+	return f.db.WithContext(tenancy.WithTenant(context.Background(), tenant))
+}
+
+func TestTenancyReads(t *testing.T) {
+	f := newTenancyFixture(t)
+
+	var workflow tenantWorkflow
+	require.NoError(t, f.as("payments").First(&workflow, "id = ?", f.payments).Error)
+	assert.Equal(t, "payments", workflow.TenantID)
+
+	err := f.as("payments").First(&tenantWorkflow{}, "id = ?", f.shipping).Error
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "workflows of other tenants cannot be read by ID")
+
+	var named tenantWorkflow
+	require.NoError(t, f.as("shipping").First(&named, "name = ?", "orders").Error)
+	assert.Equal(t, f.shipping, named.ID, "names are resolved within the tenant")
+
+	var workflows []tenantWorkflow
+	var total int64
+	query := f.as("payments").Model(&tenantWorkflow{}).Where("status = ?", "active")
+	require.NoError(t, query.Count(&total).Error)
+	require.NoError(t, query.Find(&workflows).Error)
+	assert.EqualValues(t, 1, total)
+	require.Len(t, workflows, 1)
+	assert.Equal(t, f.payments, workflows[0].ID)
+
+	require.NoError(t, f.as("billing").Find(&workflows).Error)
+	assert.Empty(t, workflows)
+
+	t.Run("OR conditions stay within the tenant", func(t *testing.T) {
+		var workflows []tenantWorkflow
+		err := f.as("payments").Where("id = ?", f.shipping).Or("name = ?", "orders").Find(&workflows).Error
+		require.NoError(t, err)
+		require.Len(t, workflows, 1)
+		assert.Equal(t, f.payments, workflows[0].ID)
+	})
+
+	t.Run("repositories read with the context of the tenant", func(t *testing.T) {
+		router := newPrimaryRouter(f.db)
+		var workflows []tenantWorkflow
+		err := router.ReadContext(tenancy.WithTenant(context.Background(), "shipping"), ListStaleness, func(db *gorm.DB) error {
+			return db.Find(&workflows).Error
+		})
+		require.NoError(t, err)
+		require.Len(t, workflows, 1)
+		assert.Equal(t, f.shipping, workflows[0].ID)
+	})
+}
+
+func TestTenancyWrites(t *testing.T) {
+	f := newTenancyFixture(t)
+
+	require.NoError(t, f.as("payments").Model(&tenantWorkflow{}).Where("id = ?", f.shipping).Update("status", "inactive").Error)
+	require.NoError(t, f.as("payments").Delete(&tenantWorkflow{}, "id = ?", f.shipping).Error)
+	var workflow tenantWorkflow
+	require.NoError(t, f.as("shipping").First(&workflow, "id = ?", f.shipping).Error, "other tenants cannot update or delete the workflow")
+	assert.Equal(t, "active", workflow.Status)
+
+	require.NoError(t, f.as("shipping").Delete(&tenantWorkflow{}, "id = ?", f.shipping).Error)
+	assert.ErrorIs(t, f.as("shipping").First(&workflow, "id = ?", f.shipping).Error, gorm.ErrRecordNotFound)
+
+	t.Run("created records are assigned to the tenant", func(t *testing.T) {
+		created := &tenantWorkflow{ID: uuid.New(), Name: "refunds"}
+		require.NoError(t, f.as("payments").Create(created).Error)
+		assert.Equal(t, "payments", created.TenantID)
+
+		batch := []*tenantWorkflow{{ID: uuid.New(), Name: "captures"}, {ID: uuid.New(), Name: "voids", TenantID: "payments"}}
+		require.NoError(t, f.as("payments").Create(&batch).Error)
+		assert.Equal(t, "payments", batch[0].TenantID)
+
+		err := f.as("payments").Create(&tenantWorkflow{ID: uuid.New(), Name: "chargebacks", TenantID: "shipping"}).Error
+		assert.ErrorIs(t, err, tenancy.ErrCrossTenant)
+
+		var count int64
+		require.NoError(t, f.as("shipping").Model(&tenantWorkflow{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("records cannot be moved to another tenant", func(t *testing.T) {
+		var workflow tenantWorkflow
+		require.NoError(t, f.as("payments").First(&workflow, "id = ?", f.payments).Error)
+		workflow.TenantID = "shipping"
+		assert.ErrorIs(t, f.as("payments").Save(&workflow).Error, tenancy.ErrCrossTenant)
+
+		err := f.as("payments").Model(&tenantWorkflow{}).Where("id = ?", f.payments).Updates(map[string]interface{}{"tenant_id": "shipping"}).Error
+		assert.ErrorIs(t, err, tenancy.ErrCrossTenant)
+
+		// Save falls back to an upsert when the update matched no record
+		require.NoError(t, f.as("shipping").Save(&tenantWorkflow{ID: f.payments, Name: "orders", Status: "archived"}).Error)
+		var saved tenantWorkflow
+		require.NoError(t, f.as("payments").First(&saved, "id = ?", f.payments).Error)
+		assert.Equal(t, "payments", saved.TenantID, "saving over the workflow of another tenant changes nothing")
+		assert.Equal(t, "active", saved.Status)
+	})
+}
+
+func TestTenancyFailsClosed(t *testing.T) {
+	f := newTenancyFixture(t)
+
+	var workflows []tenantWorkflow
+	assert.ErrorIs(t, f.db.Find(&workflows).Error, tenancy.ErrNoTenant)
+	var count int64
+	assert.ErrorIs(t, f.db.Model(&tenantWorkflow{}).Count(&count).Error, tenancy.ErrNoTenant)
+	assert.ErrorIs(t, f.db.Delete(&tenantWorkflow{}, "id = ?", f.payments).Error, tenancy.ErrNoTenant)
+	assert.ErrorIs(t, f.db.Model(&tenantWorkflow{}).Where("id = ?", f.payments).Update("status", "inactive").Error, tenancy.ErrNoTenant)
+	assert.ErrorIs(t, f.db.Create(&tenantWorkflow{ID: uuid.New(), Name: "refunds"}).Error, tenancy.ErrNoTenant)
+
+	system := f.db.WithContext(tenancy.WithSystem(context.Background()))
+	require.NoError(t, system.Find(&workflows).Error, "system contexts act for every tenant")
+	assert.Len(t, workflows, 2)
+
+	t.Run("records without tenant are not scoped", func(t *testing.T) {
+		var orders []order
+		require.NoError(t, f.db.Find(&orders).Error)
+	})
+}
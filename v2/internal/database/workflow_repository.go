@@ -93,6 +93,13 @@ func (r *workflowRepository) CountByStatus(status models.WorkflowStatus) (int64,
 	return count, err
 }
 
+// CountDeprecated returns the number of deprecated workflows
+func (r *workflowRepository) CountDeprecated() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Workflow{}).Where("deprecation IS NOT NULL").Count(&count).Error
+	return count, err
+}
+
 // GetByTriggerType retrieves workflows by trigger type
 func (r *workflowRepository) GetByTriggerType(triggerType models.TriggerType) ([]*models.Workflow, error) {
 	var workflows []*models.Workflow
@@ -0,0 +1,516 @@
+package dataflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// orderDefinition answers an order with a quote while analytics are
+// written in the background
+func orderDefinition() map[string]interface{} {
+	return map[string]interface{}{
+		"name": "order",
+		"steps": []interface{}{
+			map[string]interface{}{"name": "validate", "type": "script"},
+			map[string]interface{}{
+				"name":       "quote",
+				"type":       "http",
+				"priority":   "critical",
+				"depends_on": []interface{}{"validate"},
+				"output":     map[string]interface{}{"price": "${quote.body.price}"},
+			},
+			map[string]interface{}{
+				"name":     "analytics",
+				"type":     "http",
+				"priority": "background",
+				"config":   map[string]interface{}{"body": "${price}"},
+			},
+			map[string]interface{}{"name": "audit", "type": "http", "priority": "background"},
+		},
+		"output_mapping": map[string]interface{}{"price": "${price}"},
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	graph, err := Analyze(orderDefinition())
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	if got := graph.Dependencies("analytics"); !reflect.DeepEqual(got, []string{"quote"}) {
+		t.Errorf("analytics dependencies = %v, want the quote producing price", got)
+	}
+	if got := graph.OutputDependencies(); !reflect.DeepEqual(got, []string{"quote"}) {
+		t.Errorf("output dependencies = %v, want [quote]", got)
+	}
+	if got := graph.CriticalPath(); !reflect.DeepEqual(got, []string{"validate", "quote"}) {
+		t.Errorf("critical path = %v, want [validate quote]", got)
+	}
+	if graph.Priority("validate") != models.StepPriorityNormal {
+		t.Errorf("validate priority = %s, want normal by default", graph.Priority("validate"))
+	}
+}
+
+func TestReferences(t *testing.T) {
+	got := References(map[string]interface{}{
+		"customer": "${fetch-customer.name}",
+		"due":      "${ addBusinessDays(quote.created_at, sla_days, \"holidays\") }",
+		"label":    "order ${order.id} of ${now()}",
+		"items":    []interface{}{"${any(lines, line, line.qty > max_qty)}", "${step-1}"},
+	})
+	want := []string{"fetch-customer", "quote", "sla_days", "lines", "max_qty", "step-1", "order"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("References() = %v, want %v", got, want)
+	}
+}
+
+func TestWhenGuardDependencies(t *testing.T) {
+	graph, err := Analyze(map[string]interface{}{
+		"steps": []interface{}{
+			map[string]interface{}{"name": "score", "output": map[string]interface{}{"risk": "${score.risk}"}},
+			map[string]interface{}{"name": "review", "when": "risk > 0.8"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	if got := graph.Dependencies("review"); !reflect.DeepEqual(got, []string{"score"}) {
+		t.Errorf("review dependencies = %v, want the score producing risk", got)
+	}
+}
+
+func TestCriticalPathWithoutOutputMapping(t *testing.T) {
+	graph, err := NewGraph([]Step{
+		{Name: "a"},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "c", Priority: models.StepPriorityBackground},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewGraph() error = %v", err)
+	}
+	if got := graph.CriticalPath(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("critical path = %v, want every step but the background one", got)
+	}
+}
+
+func TestInvalidGraphs(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []Step
+		output map[string]string
+		want   string
+	}{
+		{
+			name:  "invalid priority",
+			steps: []Step{{Name: "a", Priority: "urgent"}},
+			want:  `step a has invalid priority "urgent"`,
+		},
+		{
+			name:  "unknown dependency",
+			steps: []Step{{Name: "a", DependsOn: []string{"missing"}}},
+			want:  "step a depends on unknown step missing",
+		},
+		{
+			name: "cycle",
+			steps: []Step{
+				{Name: "a", DependsOn: []string{"b"}},
+				{Name: "b", References: []string{"a"}},
+			},
+			want: "dependency cycle a -> b -> a",
+		},
+		{
+			name: "output mapping depending on a background step",
+			steps: []Step{
+				{Name: "a", Priority: models.StepPriorityBackground, Produces: []string{"total"}},
+			},
+			output: map[string]string{"total": "${total}"},
+			want:   "the output mapping depends on background step a",
+		},
+		{
+			name: "output mapping depending on a background step indirectly",
+			steps: []Step{
+				{Name: "a", Priority: models.StepPriorityBackground},
+				{Name: "b", DependsOn: []string{"a"}},
+			},
+			output: map[string]string{"result": "${b.result}"},
+			want:   "the output mapping depends on background step a",
+		},
+		{
+			name: "critical step depending on a background step",
+			steps: []Step{
+				{Name: "a", Priority: models.StepPriorityBackground},
+				{Name: "b", Priority: models.StepPriorityCritical, DependsOn: []string{"a"}},
+			},
+			want: "critical step b depends on background step a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGraph(tt.steps, tt.output)
+			if !errors.Is(err, ErrInvalidGraph) {
+				t.Fatalf("NewGraph() error = %v, want ErrInvalidGraph", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// steps controls the steps of a run: each step blocks until released and
+// then fails with the error set for it
+type steps struct {
+	mu       sync.Mutex
+	started  []string
+	release  map[string]chan struct{}
+	failures map[string]error
+}
+
+func newSteps(names ...string) *steps {
+	s := &steps{release: make(map[string]chan struct{}), failures: make(map[string]error)}
+	for _, name := range names {
+		s.release[name] = make(chan struct{})
+	}
+	return s
+}
+
+func (s *steps) execute(ctx context.Context, step string) error {
+	s.mu.Lock()
+	s.started = append(s.started, step)
+	release := s.release[step]
+	s.mu.Unlock()
+
+	if release != nil {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures[step]
+}
+
+func (s *steps) startedSteps() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.started...)
+}
+
+func stepResult(t *testing.T, result Result, name string) StepResult {
+	t.Helper()
+	for _, step := range result.Steps {
+		if step.Step == name {
+			return step
+		}
+	}
+	t.Fatalf("no result for step %s", name)
+	return StepResult{}
+}
+
+func TestRunRespondsBeforeBackgroundSteps(t *testing.T) {
+	graph, err := Analyze(orderDefinition())
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	steps := newSteps("analytics", "audit")
+	run := Start(context.Background(), graph, 0, steps.execute)
+
+	select {
+	case <-run.Responded():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run did not respond while background steps were running")
+	}
+	result := run.Result()
+	if result.RespondedAt == nil || result.Status != models.ExecutionStatusRunning {
+		t.Fatalf("result = %+v, want a responded running run", result)
+	}
+	if status := stepResult(t, result, "quote").Status; status != models.StepStatusCompleted {
+		t.Errorf("quote status = %s, want completed", status)
+	}
+
+	close(steps.release["analytics"])
+	close(steps.release["audit"])
+	result = run.Wait()
+	if result.Status != models.ExecutionStatusCompleted {
+		t.Errorf("status = %s, want completed", result.Status)
+	}
+	for _, name := range []string{"analytics", "audit"} {
+		if !stepResult(t, result, name).AfterResponse {
+			t.Errorf("step %s is not reported as completed after the response", name)
+		}
+	}
+	if stepResult(t, result, "quote").AfterResponse {
+		t.Error("quote is reported as completed after the response")
+	}
+}
+
+func TestRunWarnsOnLateBackgroundFailure(t *testing.T) {
+	graph, err := Analyze(orderDefinition())
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	steps := newSteps("analytics")
+	steps.failures["analytics"] = errors.New("warehouse unavailable")
+	run := Start(context.Background(), graph, 0, steps.execute)
+
+	<-run.Responded()
+	close(steps.release["analytics"])
+	result := run.Wait()
+
+	if result.Status != models.ExecutionStatusCompletedWithWarnings {
+		t.Fatalf("status = %s, want completed_with_warnings", result.Status)
+	}
+	if result.Error != "" {
+		t.Errorf("error = %q, want none", result.Error)
+	}
+	want := []string{"background step analytics failed: warehouse unavailable"}
+	if !reflect.DeepEqual(result.Warnings, want) {
+		t.Errorf("warnings = %v, want %v", result.Warnings, want)
+	}
+	analytics := stepResult(t, result, "analytics")
+	if analytics.Status != models.StepStatusFailed || !analytics.AfterResponse {
+		t.Errorf("analytics = %+v, want failed after the response", analytics)
+	}
+}
+
+func TestRunFailsOnCriticalPathFailure(t *testing.T) {
+	graph, err := Analyze(orderDefinition())
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	steps := newSteps()
+	steps.failures["validate"] = errors.New("invalid order")
+	result := Start(context.Background(), graph, 0, steps.execute).Wait()
+
+	if result.Status != models.ExecutionStatusFailed {
+		t.Fatalf("status = %s, want failed", result.Status)
+	}
+	if result.Error != "step validate failed: invalid order" {
+		t.Errorf("error = %q", result.Error)
+	}
+	if result.RespondedAt != nil {
+		t.Error("a failed run is reported as responded")
+	}
+	if status := stepResult(t, result, "quote").Status; status != models.StepStatusSkipped {
+		t.Errorf("quote status = %s, want skipped", status)
+	}
+}
+
+func TestRunStartsReadyStepsByPriority(t *testing.T) {
+	graph, err := NewGraph([]Step{
+		{Name: "first"},
+		{Name: "background", Priority: models.StepPriorityBackground, DependsOn: []string{"first"}},
+		{Name: "normal", DependsOn: []string{"first"}},
+		{Name: "critical", Priority: models.StepPriorityCritical, DependsOn: []string{"first"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewGraph() error = %v", err)
+	}
+	steps := newSteps()
+	result := Start(context.Background(), graph, 1, steps.execute).Wait()
+
+	if result.Status != models.ExecutionStatusCompleted {
+		t.Fatalf("status = %s, want completed", result.Status)
+	}
+	want := []string{"first", "critical", "normal", "background"}
+	if got := steps.startedSteps(); !reflect.DeepEqual(got, want) {
+		t.Errorf("started = %v, want %v", got, want)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	graph, err := NewGraph([]Step{{Name: "a"}, {Name: "b", DependsOn: []string{"a"}}}, nil)
+	if err != nil {
+		t.Fatalf("NewGraph() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	steps := newSteps("a")
+	run := Start(ctx, graph, 0, steps.execute)
+	cancel()
+
+	result := run.Wait()
+	if result.Status != models.ExecutionStatusCancelled {
+		t.Errorf("status = %s, want cancelled", result.Status)
+	}
+	if status := stepResult(t, result, "b").Status; status != models.StepStatusSkipped {
+		t.Errorf("b status = %s, want skipped", status)
+	}
+}
+
+func TestRunContinuesAfterSkippedSteps(t *testing.T) {
+	graph, err := Analyze(orderDefinition())
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	steps := newSteps()
+	steps.failures["validate"] = fmt.Errorf("%w: when guard does not hold", ErrSkipped)
+	result := Start(context.Background(), graph, 0, steps.execute).Wait()
+
+	if result.Status != models.ExecutionStatusCompleted {
+		t.Fatalf("status = %s, want completed", result.Status)
+	}
+	if result.RespondedAt == nil {
+		t.Error("the run did not respond with a skipped step on the critical path")
+	}
+	validate := stepResult(t, result, "validate")
+	if validate.Status != models.StepStatusSkipped || validate.Error != "step skipped: when guard does not hold" {
+		t.Errorf("validate = %+v, want skipped", validate)
+	}
+	if status := stepResult(t, result, "quote").Status; status != models.StepStatusCompleted {
+		t.Errorf("quote status = %s, want completed", status)
+	}
+}
+
+func TestRunParked(t *testing.T) {
+	graph, err := NewGraph([]Step{
+		{Name: "a"},
+		{Name: "b"},
+		{Name: "c", DependsOn: []string{"a"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewGraph() error = %v", err)
+	}
+	steps := newSteps("a", "b")
+	run := Start(context.Background(), graph, 0, steps.execute)
+
+	// The running steps finish after the run parked, the steps they ready
+	// do not start
+	for len(steps.startedSteps()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	run.Park()
+	close(steps.release["a"])
+	close(steps.release["b"])
+	result := run.Wait()
+
+	if result.Status != models.ExecutionStatusParked {
+		t.Fatalf("status = %s, want parked", result.Status)
+	}
+	for _, name := range []string{"a", "b"} {
+		if status := stepResult(t, result, name).Status; status != models.StepStatusCompleted {
+			t.Errorf("%s status = %s, want completed", name, status)
+		}
+	}
+	if status := stepResult(t, result, "c").Status; status != models.StepStatusPending {
+		t.Errorf("c status = %s, want pending", status)
+	}
+	if got := steps.startedSteps(); len(got) != 2 {
+		t.Errorf("started = %v, want only a and b", got)
+	}
+
+	// A run parked once every step started completes
+	steps = newSteps("a")
+	single, err := NewGraph([]Step{{Name: "a"}}, nil)
+	if err != nil {
+		t.Fatalf("NewGraph() error = %v", err)
+	}
+	run = Start(context.Background(), single, 0, steps.execute)
+	for len(steps.startedSteps()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	run.Park()
+	close(steps.release["a"])
+	if result := run.Wait(); result.Status != models.ExecutionStatusCompleted {
+		t.Errorf("status = %s, want completed", result.Status)
+	}
+}
+
+// fanOut is a graph of a step followed by branches parallel steps
+func fanOut(t *testing.T, branches int) *Graph {
+	t.Helper()
+	stepList := []Step{{Name: "start"}}
+	for i := 0; i < branches; i++ {
+		stepList = append(stepList, Step{Name: fmt.Sprintf("branch-%d", i), DependsOn: []string{"start"}})
+	}
+	graph, err := NewGraph(stepList, nil)
+	if err != nil {
+		t.Fatalf("NewGraph() error = %v", err)
+	}
+	return graph
+}
+
+func TestPoolBoundsStepsAcrossRuns(t *testing.T) {
+	const size = 4
+	pool := NewPool(size)
+
+	var running, peak int64
+	execute := func(ctx context.Context, step string) error {
+		current := atomic.AddInt64(&running, 1)
+		for {
+			seen := atomic.LoadInt64(&peak)
+			if current <= seen || atomic.CompareAndSwapInt64(&peak, seen, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt64(&running, -1)
+		return nil
+	}
+
+	runs := make([]*Run, 50)
+	for i := range runs {
+		runs[i] = StartWithPool(context.Background(), fanOut(t, 20), 0, pool, execute)
+	}
+	for i, run := range runs {
+		if result := run.Wait(); result.Status != models.ExecutionStatusCompleted {
+			t.Fatalf("run %d status = %s, want completed", i, result.Status)
+		}
+	}
+
+	if got := atomic.LoadInt64(&peak); got > size {
+		t.Errorf("%d steps ran at once, want at most %d", got, size)
+	}
+	if got := pool.Peak(); got != size {
+		t.Errorf("pool peak = %d, want %d", got, size)
+	}
+	if got := pool.Running(); got != 0 {
+		t.Errorf("pool running = %d after the runs, want 0", got)
+	}
+}
+
+func TestRunWaitingForPool(t *testing.T) {
+	pool := NewPool(1)
+	busy := newSteps("start")
+	holder := StartWithPool(context.Background(), fanOut(t, 0), 0, pool, busy.execute)
+	for len(busy.startedSteps()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Runs waiting for a slot stop when cancelled or parked
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := newSteps()
+	cancelled := StartWithPool(ctx, fanOut(t, 2), 0, pool, waiting.execute)
+	parked := StartWithPool(context.Background(), fanOut(t, 2), 0, pool, waiting.execute)
+	cancel()
+	parked.Park()
+
+	if result := cancelled.Wait(); result.Status != models.ExecutionStatusCancelled {
+		t.Errorf("cancelled status = %s, want cancelled", result.Status)
+	}
+	if status := stepResult(t, parked.Wait(), "start").Status; status != models.StepStatusPending {
+		t.Errorf("parked start status = %s, want pending", status)
+	}
+	if started := waiting.startedSteps(); len(started) != 0 {
+		t.Errorf("started = %v while the pool was full", started)
+	}
+
+	close(busy.release["start"])
+	if result := holder.Wait(); result.Status != models.ExecutionStatusCompleted {
+		t.Errorf("holder status = %s, want completed", result.Status)
+	}
+	if got := pool.Running(); got != 0 {
+		t.Errorf("pool running = %d, want 0", got)
+	}
+}
@@ -0,0 +1,447 @@
+// Package dataflow analyzes how data flows between the steps of a workflow
+// and runs the steps of an execution in dependency and priority order
+package dataflow
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrInvalidGraph is returned for step graphs that cannot be run, such as
+// graphs with cycles or unknown dependencies
+var ErrInvalidGraph = errors.New("invalid step graph")
+
+// namePattern matches the name a ${name} or ${name.path} reference starts
+// with. Names may hold dashes, which expressions do not parse.
+var namePattern = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)`)
+
+// Step is a step of a graph
+type Step struct {
+	Name      string
+	Priority  models.StepPriority
+	DependsOn []string
+	// References are the names referenced by the input, config, condition
+	// and when guard of the step: step names, variables or workflow inputs
+	References []string
+	// Produces are the variables set by the output mapping of the step
+	Produces []string
+}
+
+// Graph is the dependency graph of the steps of a workflow. A step depends
+// on the steps it declares in depends_on and on the steps producing the data
+// it references.
+type Graph struct {
+	nodes  []*node
+	byName map[string]*node
+	// output holds the steps the output mapping references
+	output []*node
+}
+
+type node struct {
+	step       Step
+	index      int
+	deps       []*node
+	dependents []*node
+	// critical is set for the steps the response depends on
+	critical bool
+}
+
+// NewGraph builds the graph of steps. output is the output mapping of the
+// workflow, nil when it has none. The critical path, the steps the response
+// waits on, holds the critical steps, the steps the output mapping
+// references and everything they depend on. Without critical steps and an
+// output mapping it holds every step that is not a background step.
+//
+// Output mappings and critical steps depending on background steps are
+// rejected, as they would make the response wait on best-effort work.
+func NewGraph(steps []Step, output map[string]string) (*Graph, error) {
+	g := &Graph{byName: make(map[string]*node, len(steps))}
+	for i, step := range steps {
+		if step.Priority == "" {
+			step.Priority = models.StepPriorityNormal
+		}
+		if rank(step.Priority) < 0 {
+			return nil, fmt.Errorf("%w: step %s has invalid priority %q, expected critical, normal or background", ErrInvalidGraph, step.Name, step.Priority)
+		}
+		if _, exists := g.byName[step.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate step %s", ErrInvalidGraph, step.Name)
+		}
+		n := &node{step: step, index: i}
+		g.nodes = append(g.nodes, n)
+		g.byName[step.Name] = n
+	}
+
+	producers := make(map[string][]*node)
+	for _, n := range g.nodes {
+		for _, variable := range n.step.Produces {
+			producers[variable] = append(producers[variable], n)
+		}
+	}
+	resolve := func(name string) []*node {
+		if n, ok := g.byName[name]; ok {
+			return []*node{n}
+		}
+		return producers[name]
+	}
+
+	for _, n := range g.nodes {
+		seen := make(map[*node]bool)
+		add := func(dep *node) {
+			if dep != n && !seen[dep] {
+				seen[dep] = true
+				n.deps = append(n.deps, dep)
+				dep.dependents = append(dep.dependents, n)
+			}
+		}
+		for _, name := range n.step.DependsOn {
+			dep, ok := g.byName[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: step %s depends on unknown step %s", ErrInvalidGraph, n.step.Name, name)
+			}
+			if dep == n {
+				return nil, fmt.Errorf("%w: step %s depends on itself", ErrInvalidGraph, n.step.Name)
+			}
+			add(dep)
+		}
+		for _, name := range n.step.References {
+			for _, dep := range resolve(name) {
+				add(dep)
+			}
+		}
+	}
+	if err := g.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[*node]bool)
+	for _, name := range References(outputValues(output)) {
+		for _, n := range resolve(name) {
+			if !seen[n] {
+				seen[n] = true
+				g.output = append(g.output, n)
+			}
+		}
+	}
+	sort.Slice(g.output, func(i, j int) bool { return g.output[i].index < g.output[j].index })
+
+	if err := g.markCriticalPath(output != nil); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Analyze builds the graph of a workflow definition, as held by workflow
+// versions: the steps are read from its steps, and the output mapping from
+// its output_mapping
+func Analyze(definition map[string]interface{}) (*Graph, error) {
+	rawSteps, _ := definition["steps"].([]interface{})
+	steps := make([]Step, 0, len(rawSteps))
+	for _, rawStep := range rawSteps {
+		step, ok := rawStep.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := step["name"].(string)
+		priority, _ := step["priority"].(string)
+		steps = append(steps, Step{
+			Name:       name,
+			Priority:   models.StepPriority(priority),
+			DependsOn:  stringList(step["depends_on"]),
+			References: References(step["input"], step["config"], step["condition"], guard(step["when"]), mappingSide(step, "input")),
+			Produces:   append(keys(step["output"]), keys(mappingSide(step, "output"))...),
+		})
+	}
+
+	var output map[string]string
+	if rawOutput, ok := definition["output_mapping"].(map[string]interface{}); ok {
+		output = make(map[string]string, len(rawOutput))
+		for key, value := range rawOutput {
+			output[key] = fmt.Sprint(value)
+		}
+	}
+	return NewGraph(steps, output)
+}
+
+// FromDefinition builds the graph of a workflow definition
+func FromDefinition(definition *models.WorkflowDefinition) (*Graph, error) {
+	steps := make([]Step, len(definition.Spec.Steps))
+	for i, step := range definition.Spec.Steps {
+		steps[i] = Step{
+			Name:       step.Name,
+			Priority:   step.Priority,
+			DependsOn:  step.DependsOn,
+			References: References(step.Config, step.Condition, guard(step.When), step.DataMapping.Input),
+			Produces:   sortedStringKeys(step.DataMapping.Output),
+		}
+	}
+	return NewGraph(steps, definition.Spec.OutputMapping)
+}
+
+// References returns the names referenced by ${...} expressions in values,
+// walking strings, maps and slices. The names are the document fields the
+// expressions read, such as fetch and limit in
+// ${addBusinessDays(fetch.due, limit)}.
+func References(values ...interface{}) []string {
+	seen := make(map[string]bool)
+	var names []string
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			for _, source := range expressions.EmbeddedAll(v) {
+				for _, name := range referencedNames(source) {
+					if !seen[name] {
+						seen[name] = true
+						names = append(names, name)
+					}
+				}
+			}
+		case map[string]interface{}:
+			for _, key := range sortedKeys(v) {
+				walk(v[key])
+			}
+		case map[string]string:
+			for _, key := range sortedStringKeys(v) {
+				walk(v[key])
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case []string:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	for _, value := range values {
+		walk(value)
+	}
+	return names
+}
+
+// guard returns the when guard of a step as a ${...} reference, as guards
+// are bare expressions
+func guard(when interface{}) interface{} {
+	if source, ok := when.(string); ok && strings.TrimSpace(source) != "" {
+		return "${" + source + "}"
+	}
+	return nil
+}
+
+// referencedNames returns the names an expression reads, or the name a
+// reference that is not an expression starts with, such as fetch-customer
+// in ${fetch-customer.name}
+func referencedNames(source string) []string {
+	if expr, err := expressions.Parse(source); err == nil {
+		return expr.Variables()
+	}
+	if match := namePattern.FindStringSubmatch(source); match != nil {
+		return []string{match[1]}
+	}
+	return nil
+}
+
+// Steps returns the names of the steps in definition order
+func (g *Graph) Steps() []string {
+	names := make([]string, len(g.nodes))
+	for i, n := range g.nodes {
+		names[i] = n.step.Name
+	}
+	return names
+}
+
+// Priority returns the priority of a step
+func (g *Graph) Priority(step string) models.StepPriority {
+	if n, ok := g.byName[step]; ok {
+		return n.step.Priority
+	}
+	return ""
+}
+
+// Dependencies returns the steps a step depends on directly
+func (g *Graph) Dependencies(step string) []string {
+	n, ok := g.byName[step]
+	if !ok {
+		return nil
+	}
+	names := make([]string, len(n.deps))
+	for i, dep := range n.deps {
+		names[i] = dep.step.Name
+	}
+	return names
+}
+
+// OutputDependencies returns the steps the output mapping references
+func (g *Graph) OutputDependencies() []string {
+	names := make([]string, len(g.output))
+	for i, n := range g.output {
+		names[i] = n.step.Name
+	}
+	return names
+}
+
+// CriticalPath returns the steps the response waits on, in definition order
+func (g *Graph) CriticalPath() []string {
+	var names []string
+	for _, n := range g.nodes {
+		if n.critical {
+			names = append(names, n.step.Name)
+		}
+	}
+	return names
+}
+
+// OnCriticalPath reports whether the response waits on a step
+func (g *Graph) OnCriticalPath(step string) bool {
+	n, ok := g.byName[step]
+	return ok && n.critical
+}
+
+// checkCycles rejects graphs whose steps depend on each other
+func (g *Graph) checkCycles() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*node]int, len(g.nodes))
+	var visit func(n *node, path []string) error
+	visit = func(n *node, path []string) error {
+		switch state[n] {
+		case visiting:
+			return fmt.Errorf("%w: dependency cycle %s", ErrInvalidGraph, strings.Join(append(path, n.step.Name), " -> "))
+		case visited:
+			return nil
+		}
+		state[n] = visiting
+		for _, dep := range n.deps {
+			if err := visit(dep, append(path, n.step.Name)); err != nil {
+				return err
+			}
+		}
+		state[n] = visited
+		return nil
+	}
+	for _, n := range g.nodes {
+		if err := visit(n, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markCriticalPath marks the steps the response waits on, rejecting
+// critical paths that hold background steps
+func (g *Graph) markCriticalPath(hasOutput bool) error {
+	var mark func(n *node, from string) error
+	mark = func(n *node, from string) error {
+		if n.step.Priority == models.StepPriorityBackground {
+			return fmt.Errorf("%w: %s depends on background step %s", ErrInvalidGraph, from, n.step.Name)
+		}
+		if n.critical {
+			return nil
+		}
+		n.critical = true
+		for _, dep := range n.deps {
+			if err := mark(dep, from); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	seeded := false
+	for _, n := range g.nodes {
+		if n.step.Priority == models.StepPriorityCritical {
+			seeded = true
+			for _, dep := range n.deps {
+				if err := mark(dep, "critical step "+n.step.Name); err != nil {
+					return err
+				}
+			}
+			n.critical = true
+		}
+	}
+	for _, n := range g.output {
+		seeded = true
+		if err := mark(n, "the output mapping"); err != nil {
+			return err
+		}
+	}
+	if !seeded && !hasOutput {
+		for _, n := range g.nodes {
+			if n.step.Priority != models.StepPriorityBackground {
+				n.critical = true
+			}
+		}
+	}
+	return nil
+}
+
+// rank orders priorities, critical first. Unknown priorities rank -1.
+func rank(priority models.StepPriority) int {
+	switch priority {
+	case models.StepPriorityCritical:
+		return 0
+	case models.StepPriorityNormal:
+		return 1
+	case models.StepPriorityBackground:
+		return 2
+	default:
+		return -1
+	}
+}
+
+func outputValues(output map[string]string) []string {
+	values := make([]string, 0, len(output))
+	for _, key := range sortedStringKeys(output) {
+		values = append(values, output[key])
+	}
+	return values
+}
+
+// mappingSide returns the input or output of the data mapping of a step
+func mappingSide(step map[string]interface{}, side string) interface{} {
+	mapping, _ := step["data_mapping"].(map[string]interface{})
+	return mapping[side]
+}
+
+func keys(value interface{}) []string {
+	mapping, _ := value.(map[string]interface{})
+	return sortedKeys(mapping)
+}
+
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
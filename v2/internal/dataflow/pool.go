@@ -0,0 +1,120 @@
+package dataflow
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool bounds the steps running at once across the runs sharing it, such as
+// the runs of every execution of a node. Runs start a goroutine for a step
+// only once the pool gave it a slot, so however many runs have ready
+// parallel steps, at most size step goroutines exist.
+type Pool struct {
+	mu      sync.Mutex
+	size    int
+	running int
+	peak    int
+	// freed is closed, and replaced, whenever a slot is released
+	freed chan struct{}
+}
+
+// NewPool creates a pool of size slots. A pool of size zero or less does not
+// bound the steps.
+func NewPool(size int) *Pool {
+	return &Pool{size: size, freed: make(chan struct{})}
+}
+
+// Size returns the number of slots of the pool, zero when it is unbounded
+func (p *Pool) Size() int {
+	if p.size < 0 {
+		return 0
+	}
+	return p.size
+}
+
+// Running returns the number of slots in use
+func (p *Pool) Running() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+// Peak returns the most slots ever in use at once
+func (p *Pool) Peak() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peak
+}
+
+// tryAcquire takes a slot if one is free. Otherwise it returns a channel
+// closed once a slot is released, after which the caller tries again.
+func (p *Pool) tryAcquire() (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.size > 0 && p.running >= p.size {
+		return false, p.freed
+	}
+	p.running++
+	if p.running > p.peak {
+		p.peak = p.running
+	}
+	return true, nil
+}
+
+// release frees a slot and wakes the runs waiting for one
+func (p *Pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.running--
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
+
+// acquire waits for a free slot until ctx is done
+func (p *Pool) acquire(ctx context.Context) error {
+	for {
+		acquired, freed := p.tryAcquire()
+		if acquired {
+			return nil
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type slotKey struct{}
+
+// slot is the pool slot of a running step
+type slot struct {
+	pool *Pool
+	held bool
+}
+
+// Idle gives up the pool slot of the step running with ctx while wait runs,
+// and waits for a free slot again before returning, so that a step waiting
+// for long, such as for an approval, does not keep the steps of other
+// executions from running. Outside of a pool, Idle only runs wait. It must
+// be called from the goroutine of the step.
+func Idle(ctx context.Context, wait func() error) error {
+	s, ok := ctx.Value(slotKey{}).(*slot)
+	if !ok || !s.held {
+		return wait()
+	}
+
+	s.pool.release()
+	s.held = false
+	err := wait()
+	if acquireErr := s.pool.acquire(ctx); acquireErr != nil {
+		if err == nil {
+			err = acquireErr
+		}
+		return err
+	}
+	s.held = true
+	return err
+}
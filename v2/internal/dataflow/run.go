@@ -0,0 +1,381 @@
+package dataflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrSkipped is wrapped by the errors ExecuteFunc returns for steps that did
+// not run, such as steps whose guard does not hold. Skipped steps do not fail
+// the run and the steps depending on them still run.
+var ErrSkipped = errors.New("step skipped")
+
+// ExecuteFunc executes a step of a run
+type ExecuteFunc func(ctx context.Context, step string) error
+
+// StepResult is the outcome of a step of a run
+type StepResult struct {
+	Step        string              `json:"step"`
+	Priority    models.StepPriority `json:"priority"`
+	Status      models.StepStatus   `json:"status"`
+	Error       string              `json:"error,omitempty"`
+	StartedAt   *time.Time          `json:"started_at,omitempty"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+	// AfterResponse is set for steps that finished after the response
+	AfterResponse bool `json:"after_response,omitempty"`
+}
+
+// Result is the outcome of a run
+type Result struct {
+	Status models.ExecutionStatus `json:"status"`
+	// Error is the failure of the first step that failed the run
+	Error string `json:"error,omitempty"`
+	// Err is the error of Error, wrapping the one the step failed with
+	Err error `json:"-"`
+	// Warnings lists the failures of background steps
+	Warnings []string `json:"warnings,omitempty"`
+	// RespondedAt is when the critical path completed, nil if it did not
+	RespondedAt *time.Time   `json:"responded_at,omitempty"`
+	Steps       []StepResult `json:"steps"`
+}
+
+// Run runs the steps of a graph. Ready steps, whose dependencies completed
+// or were skipped, start in priority order, critical steps first, whenever fewer steps than
+// the capacity are running and the pool of the run has a free slot.
+//
+// The run responds once the critical path completed, while background
+// steps may still be running. A failing background step only adds a
+// warning, completing the run with warnings, and skips the steps depending
+// on it. Any other failing step fails the run: no more steps are started.
+//
+// A parked run starts no more steps either, but lets the running ones
+// finish: it ends parked, with the steps it did not start still pending, so
+// that they can run later.
+type Run struct {
+	graph    *Graph
+	execute  ExecuteFunc
+	ctx      context.Context
+	capacity int
+	pool     *Pool
+	now      func() time.Time
+
+	mu          sync.Mutex
+	results     map[*node]*StepResult
+	waiting     map[*node]int
+	ready       []*node
+	running     int
+	stopped     bool
+	cancelled   bool
+	parked      bool
+	failure     error
+	warnings    []string
+	respondedAt *time.Time
+	isResponded bool
+	// freed is set while ready steps wait for a slot of the pool
+	freed <-chan struct{}
+
+	completions chan completion
+	parkedCh    chan struct{}
+	responded   chan struct{}
+	done        chan struct{}
+}
+
+type completion struct {
+	node *node
+	err  error
+}
+
+// Start starts running the steps of a graph with execute. At most capacity
+// steps run at once, any number when it is zero. Cancelling ctx stops the
+// run from starting more steps; it is also passed to execute.
+func Start(ctx context.Context, graph *Graph, capacity int, execute ExecuteFunc) *Run {
+	return StartWithPool(ctx, graph, capacity, nil, execute)
+}
+
+// StartWithPool starts running the steps of a graph like Start, each step
+// also holding a slot of pool while it runs. Ready steps wait for a free
+// slot, in priority order, without a goroutine of their own.
+func StartWithPool(ctx context.Context, graph *Graph, capacity int, pool *Pool, execute ExecuteFunc) *Run {
+	r := &Run{
+		graph:       graph,
+		execute:     execute,
+		ctx:         ctx,
+		capacity:    capacity,
+		pool:        pool,
+		now:         time.Now,
+		results:     make(map[*node]*StepResult, len(graph.nodes)),
+		waiting:     make(map[*node]int, len(graph.nodes)),
+		completions: make(chan completion),
+		parkedCh:    make(chan struct{}),
+		responded:   make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	for _, n := range graph.nodes {
+		r.results[n] = &StepResult{
+			Step:     n.step.Name,
+			Priority: n.step.Priority,
+			Status:   models.StepStatusPending,
+		}
+		r.waiting[n] = len(n.deps)
+		if len(n.deps) == 0 {
+			r.ready = append(r.ready, n)
+		}
+	}
+
+	go r.loop()
+	return r
+}
+
+// Park stops the run from starting more steps while the running ones
+// finish. A run whose steps all started already finishes as usual.
+func (r *Run) Park() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.parked {
+		r.parked = true
+		close(r.parkedCh)
+	}
+}
+
+// Responded is closed once the run can respond: when the critical path
+// completed, or when the run failed or was cancelled before it did
+func (r *Run) Responded() <-chan struct{} {
+	return r.responded
+}
+
+// Done is closed once every step finished or was skipped
+func (r *Run) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait waits for the run to finish and returns its result
+func (r *Run) Wait() Result {
+	<-r.done
+	return r.Result()
+}
+
+// Result returns the result of the run so far. Its status is running until
+// the run finished.
+func (r *Run) Result() Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := Result{
+		Status:      models.ExecutionStatusRunning,
+		Err:         r.failure,
+		Warnings:    append([]string(nil), r.warnings...),
+		RespondedAt: r.respondedAt,
+		Steps:       make([]StepResult, len(r.graph.nodes)),
+	}
+	if r.failure != nil {
+		result.Error = r.failure.Error()
+	}
+	for i, n := range r.graph.nodes {
+		result.Steps[i] = *r.results[n]
+	}
+
+	select {
+	case <-r.done:
+	default:
+		return result
+	}
+	switch {
+	case r.cancelled:
+		result.Status = models.ExecutionStatusCancelled
+	case r.failure != nil:
+		result.Status = models.ExecutionStatusFailed
+	case r.pendingLocked():
+		result.Status = models.ExecutionStatusParked
+	case len(r.warnings) > 0:
+		result.Status = models.ExecutionStatusCompletedWithWarnings
+	default:
+		result.Status = models.ExecutionStatusCompleted
+	}
+	return result
+}
+
+func (r *Run) loop() {
+	r.mu.Lock()
+	r.respondLocked()
+	for {
+		r.dispatchLocked()
+		if r.running == 0 && r.freed == nil {
+			break
+		}
+
+		// Steps waiting for the pool also start on cancellation, to be
+		// skipped, and on parking, to stay pending
+		var freed, cancelled, parked <-chan struct{}
+		if r.freed != nil {
+			freed, cancelled, parked = r.freed, r.ctx.Done(), r.parkedCh
+		}
+		r.mu.Unlock()
+		select {
+		case c := <-r.completions:
+			r.mu.Lock()
+			r.finishLocked(c)
+			r.respondLocked()
+		case <-freed:
+			r.mu.Lock()
+		case <-cancelled:
+			r.mu.Lock()
+		case <-parked:
+			r.mu.Lock()
+		}
+	}
+
+	// Steps not started because the run stopped are skipped, those of a
+	// parked run stay pending
+	for _, n := range r.graph.nodes {
+		if result := r.results[n]; result.Status == models.StepStatusPending && (r.stopped || !r.parked) {
+			result.Status = models.StepStatusSkipped
+			result.Error = "the execution stopped before the step started"
+		}
+	}
+	if !r.isResponded {
+		r.isResponded = true
+		close(r.responded)
+	}
+	close(r.done)
+	r.mu.Unlock()
+}
+
+// dispatchLocked starts the ready steps, by priority and then in definition
+// order, while the capacity and the pool allow
+func (r *Run) dispatchLocked() {
+	r.freed = nil
+	if r.ctx.Err() != nil {
+		r.stopped = true
+		r.cancelled = true
+	}
+	if r.stopped || r.parked {
+		return
+	}
+
+	sort.SliceStable(r.ready, func(i, j int) bool {
+		a, b := r.ready[i], r.ready[j]
+		if rank(a.step.Priority) != rank(b.step.Priority) {
+			return rank(a.step.Priority) < rank(b.step.Priority)
+		}
+		return a.index < b.index
+	})
+	for len(r.ready) > 0 && (r.capacity <= 0 || r.running < r.capacity) {
+		if r.pool != nil {
+			acquired, freed := r.pool.tryAcquire()
+			if !acquired {
+				r.freed = freed
+				return
+			}
+		}
+		n := r.ready[0]
+		r.ready = r.ready[1:]
+
+		startedAt := r.now().UTC()
+		result := r.results[n]
+		result.Status = models.StepStatusRunning
+		result.StartedAt = &startedAt
+		r.running++
+
+		go func(n *node) {
+			if r.pool == nil {
+				r.completions <- completion{node: n, err: r.execute(r.ctx, n.step.Name)}
+				return
+			}
+			// The step may give up its slot while it waits, see Idle
+			s := &slot{pool: r.pool, held: true}
+			err := r.execute(context.WithValue(r.ctx, slotKey{}, s), n.step.Name)
+			if s.held {
+				r.pool.release()
+			}
+			r.completions <- completion{node: n, err: err}
+		}(n)
+	}
+}
+
+// finishLocked records the outcome of a step and readies the steps waiting
+// on it
+func (r *Run) finishLocked(c completion) {
+	r.running--
+	completedAt := r.now().UTC()
+	result := r.results[c.node]
+	result.CompletedAt = &completedAt
+	result.AfterResponse = r.respondedAt != nil
+
+	if c.err == nil || errors.Is(c.err, ErrSkipped) {
+		result.Status = models.StepStatusCompleted
+		if c.err != nil {
+			result.Status = models.StepStatusSkipped
+			result.Error = c.err.Error()
+		}
+		for _, dependent := range c.node.dependents {
+			r.waiting[dependent]--
+			if r.waiting[dependent] == 0 && r.results[dependent].Status == models.StepStatusPending {
+				r.ready = append(r.ready, dependent)
+			}
+		}
+		return
+	}
+
+	result.Status = models.StepStatusFailed
+	result.Error = c.err.Error()
+	r.skipDependents(c.node)
+	if c.node.step.Priority == models.StepPriorityBackground {
+		r.warnings = append(r.warnings, fmt.Sprintf("background step %s failed: %v", c.node.step.Name, c.err))
+		return
+	}
+	if r.failure == nil {
+		r.failure = fmt.Errorf("step %s failed: %w", c.node.step.Name, c.err)
+	}
+	r.stopped = true
+}
+
+// pendingLocked reports whether steps of a parked run were left pending
+func (r *Run) pendingLocked() bool {
+	if !r.parked {
+		return false
+	}
+	for _, n := range r.graph.nodes {
+		if r.results[n].Status == models.StepStatusPending {
+			return true
+		}
+	}
+	return false
+}
+
+// skipDependents skips the steps depending on a failed step
+func (r *Run) skipDependents(failed *node) {
+	for _, dependent := range failed.dependents {
+		result := r.results[dependent]
+		if result.Status != models.StepStatusPending {
+			continue
+		}
+		result.Status = models.StepStatusSkipped
+		result.Error = fmt.Sprintf("step %s it depends on failed", failed.step.Name)
+		r.skipDependents(dependent)
+	}
+}
+
+// respondLocked responds once the critical path completed, or the run
+// failed or was cancelled
+func (r *Run) respondLocked() {
+	if r.isResponded {
+		return
+	}
+	if r.failure == nil && !r.cancelled {
+		for _, n := range r.graph.nodes {
+			if status := r.results[n].Status; n.critical && status != models.StepStatusCompleted && status != models.StepStatusSkipped {
+				return
+			}
+		}
+		respondedAt := r.now().UTC()
+		r.respondedAt = &respondedAt
+	}
+	r.isResponded = true
+	close(r.responded)
+}
@@ -0,0 +1,477 @@
+package debugbundle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/branding"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// DefaultAsyncEventThreshold is the number of events above which bundles
+// are built by jobs when Config.AsyncEventThreshold is not set
+const DefaultAsyncEventThreshold = 5000
+
+// ExecutionStore reads executions with their steps and events. It is
+// implemented by database.ExecutionRepository.
+type ExecutionStore interface {
+	GetByID(id uuid.UUID) (*models.Execution, error)
+}
+
+// EventStore counts the events of executions. It is implemented by
+// database.ExecutionEventRepository.
+type EventStore interface {
+	GetByExecutionID(executionID uuid.UUID, limit, offset int) ([]*models.ExecutionEvent, int64, error)
+}
+
+// WorkflowStore reads workflows. It is implemented by
+// database.WorkflowRepository.
+type WorkflowStore interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+}
+
+// VersionStore reads the versions of workflows. It is implemented by
+// database.WorkflowVersionRepository.
+type VersionStore interface {
+	GetByWorkflowID(workflowID uuid.UUID, limit, offset int) ([]*models.WorkflowVersion, int64, error)
+}
+
+// ApprovalStore reads the approval state of executions, bundled as it is
+// returned. It is implemented by approvals.Manager.
+type ApprovalStore interface {
+	ExecutionApprovals(ctx context.Context, executionID uuid.UUID) (interface{}, error)
+}
+
+// Sources are the stores bundles are read from. Events and Versions are
+// optional: without them every bundle is built during the request and the
+// definition of the workflow is bundled. Without Approvals bundles hold no
+// approval state. Branding resolves the branding profile of the workflow
+// namespace; without it bundles hold no profile.
+type Sources struct {
+	Executions ExecutionStore
+	Events     EventStore
+	Workflows  WorkflowStore
+	Versions   VersionStore
+	Approvals  ApprovalStore
+	Branding   branding.Resolver
+}
+
+// Config configures a Builder
+type Config struct {
+	// Version, NodeID and Environment identify the server in the system
+	// info of bundles
+	Version     string
+	NodeID      string
+	Environment string
+	// Limits are the limits of the server reported in the effective config
+	Limits map[string]interface{}
+	// AsyncEventThreshold defaults to DefaultAsyncEventThreshold
+	AsyncEventThreshold int64
+}
+
+// omittedFields are the fields reduced bundles leave out, by file
+var omittedFields = map[string][]string{
+	ExecutionFile: {"input_data", "output_data", "trigger_data", "context.variables", "context.environment", "context.secrets"},
+	StepsFile:     {"input_data", "output_data"},
+	EventsFile:    {"data"},
+	LogsFile:      {"data"},
+}
+
+// Builder builds the debug bundles of executions
+type Builder struct {
+	sources   Sources
+	config    Config
+	startedAt time.Time
+	now       func() time.Time
+}
+
+// NewBuilder creates a bundle builder
+func NewBuilder(sources Sources, config Config) *Builder {
+	if config.AsyncEventThreshold <= 0 {
+		config.AsyncEventThreshold = DefaultAsyncEventThreshold
+	}
+	return &Builder{
+		sources:   sources,
+		config:    config,
+		startedAt: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Large reports whether an execution has more events than bundles built
+// during a request may hold
+func (b *Builder) Large(executionID uuid.UUID) (bool, error) {
+	if b.sources.Events == nil {
+		return false, nil
+	}
+	_, total, err := b.sources.Events.GetByExecutionID(executionID, 1, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to count execution events: %w", err)
+	}
+	return total > b.config.AsyncEventThreshold, nil
+}
+
+// Build builds the bundle of an execution. Secrets are redacted from every
+// level; reduced bundles also leave the data of the execution out.
+func (b *Builder) Build(ctx context.Context, executionID uuid.UUID, level Level) (*Bundle, error) {
+	execution, err := b.sources.Executions.GetByID(executionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExecutionNotFound
+		}
+		return nil, fmt.Errorf("failed to get execution: %w", err)
+	}
+
+	var workflow *models.Workflow
+	if b.sources.Workflows != nil {
+		workflow, err = b.sources.Workflows.GetByID(execution.WorkflowID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to get workflow: %w", err)
+		}
+	}
+	definition, versionConfig, err := b.definition(execution, workflow)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	steps := append([]models.StepExecution(nil), execution.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return startedBefore(steps[i].StartedAt, steps[j].StartedAt)
+	})
+	events := append([]models.ExecutionEvent(nil), execution.Events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	record := *execution
+	record.Steps = nil
+	record.Events = nil
+
+	documents := map[string]interface{}{
+		ExecutionFile:   record,
+		StepsFile:       steps,
+		EventsFile:      events,
+		LogsFile:        logEntries(events),
+		AnnotationsFile: annotations(execution, workflow, definition),
+		DefinitionFile:  definition,
+		ConfigFile:      b.effectiveConfig(definition, workflow, versionConfig),
+		SystemFile:      b.systemInfo(level),
+	}
+	if b.sources.Approvals != nil {
+		approvals, err := b.sources.Approvals.ExecutionApprovals(ctx, executionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get execution approvals: %w", err)
+		}
+		documents[ApprovalsFile] = approvals
+	}
+	if b.sources.Branding != nil {
+		documents[BrandingFile] = b.sources.Branding.Messages(policies.Namespace(definition.Definition), "").Profile()
+	}
+
+	manifest := Manifest{
+		FormatVersion: FormatVersion,
+		ExecutionID:   execution.ID,
+		WorkflowID:    execution.WorkflowID,
+		WorkflowName:  definition.Name,
+		Level:         level,
+		GeneratedAt:   b.now().UTC(),
+	}
+	if level != LevelFull {
+		manifest.Level = LevelReduced
+		manifest.Omitted = omittedList()
+	}
+
+	redact := newRedactor(execution.Context.Secrets)
+	files := make(map[string][]byte, len(documents)+2)
+	redacted := make(map[string]interface{}, len(documents))
+	for name, document := range documents {
+		value, err := generic(document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		if name == ExecutionFile {
+			// The workflow is not preloaded, its definition is bundled
+			// on its own
+			omit(value, []string{"workflow"})
+		}
+		if manifest.Level == LevelReduced {
+			omit(value, omittedFields[name])
+		}
+		value = redact.value(value)
+		redacted[name] = value
+
+		content, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		files[name] = content
+	}
+	manifest.Redacted = redact.count
+	manifest.Files = fileNames(files)
+
+	summary, err := renderSummary(manifest, redacted)
+	if err != nil {
+		return nil, err
+	}
+	files[SummaryFile] = summary
+	return newBundle(manifest, files)
+}
+
+// definition returns the definition of the workflow version the execution
+// ran, or of the workflow when the version is unknown, and the
+// configuration of the version
+func (b *Builder) definition(execution *models.Execution, workflow *models.Workflow) (*Definition, *models.VersionConfig, error) {
+	version := execution.Context.WorkflowVersion
+	if version == "" && workflow != nil {
+		version = workflow.Version
+	}
+
+	if b.sources.Versions != nil && version != "" {
+		versions, _, err := b.sources.Versions.GetByWorkflowID(execution.WorkflowID, -1, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get workflow versions: %w", err)
+		}
+		for _, v := range versions {
+			if v.Version != version {
+				continue
+			}
+			id := v.ID
+			name := v.Definition.Metadata.Name
+			if workflow != nil {
+				name = workflow.Name
+			}
+			return &Definition{
+				Source:       DefinitionSourceVersion,
+				VersionID:    &id,
+				Version:      v.Version,
+				Name:         name,
+				Description:  v.Description,
+				Definition:   v.Definition,
+				InputSchema:  v.InputSchema,
+				OutputSchema: v.OutputSchema,
+			}, &v.Config, nil
+		}
+	}
+
+	definition := &Definition{
+		Source:  DefinitionSourceWorkflow,
+		Version: version,
+		Name:    execution.Context.WorkflowName,
+	}
+	if workflow != nil {
+		definition.Name = workflow.Name
+		definition.Description = workflow.Description
+		definition.Definition = workflow.Definition
+		definition.InputSchema = workflow.InputSchema
+		definition.OutputSchema = workflow.OutputSchema
+	}
+	return definition, nil, nil
+}
+
+// effectiveConfig resolves the policies of each step: its own, else those
+// of the version or the definition, else those of the workflow
+func (b *Builder) effectiveConfig(definition *Definition, workflow *models.Workflow, versionConfig *models.VersionConfig) *EffectiveConfig {
+	spec := definition.Definition.Spec
+	config := &EffectiveConfig{
+		Timeout:       spec.Timeout,
+		RetryPolicy:   spec.RetryPolicy,
+		ErrorHandling: spec.ErrorHandling,
+		FeatureFlags:  spec.FeatureFlags,
+		Limits:        b.config.Limits,
+		Steps:         make([]StepConfig, 0, len(spec.Steps)),
+	}
+	if workflow != nil {
+		config.MaxConcurrency = workflow.Config.MaxConcurrency
+		config.Timeout = firstNonEmpty(config.Timeout, workflow.Config.Timeout)
+		if config.RetryPolicy.MaxAttempts == 0 {
+			config.RetryPolicy = workflow.Config.RetryPolicy
+		}
+		if config.ErrorHandling.Strategy == "" {
+			config.ErrorHandling = workflow.Config.ErrorHandling
+		}
+	}
+	if versionConfig != nil {
+		if versionConfig.MaxConcurrency > 0 {
+			config.MaxConcurrency = versionConfig.MaxConcurrency
+		}
+		config.Timeout = firstNonEmpty(versionConfig.Timeout, config.Timeout)
+		if versionConfig.RetryPolicy.MaxAttempts > 0 {
+			config.RetryPolicy = versionConfig.RetryPolicy
+		}
+		if versionConfig.ErrorHandling.Strategy != "" {
+			config.ErrorHandling = versionConfig.ErrorHandling
+		}
+		if len(versionConfig.FeatureFlags) > 0 {
+			config.FeatureFlags = versionConfig.FeatureFlags
+		}
+		config.ResourceLimits = versionConfig.ResourceLimits
+	}
+
+	for _, step := range spec.Steps {
+		stepConfig := StepConfig{
+			Name:          step.Name,
+			Type:          step.Type,
+			Timeout:       firstNonEmpty(step.Timeout, config.Timeout),
+			RetryPolicy:   step.RetryPolicy,
+			ErrorHandling: step.ErrorHandling,
+		}
+		if stepConfig.RetryPolicy.MaxAttempts == 0 {
+			stepConfig.RetryPolicy = config.RetryPolicy
+		}
+		if stepConfig.ErrorHandling.Strategy == "" {
+			stepConfig.ErrorHandling = config.ErrorHandling
+		}
+		config.Steps = append(config.Steps, stepConfig)
+	}
+	return config
+}
+
+// systemInfo snapshots the server. Reduced bundles leave the hostname out.
+func (b *Builder) systemInfo(level Level) *SystemInfo {
+	info := &SystemInfo{
+		Version:      b.config.Version,
+		NodeID:       b.config.NodeID,
+		Environment:  b.config.Environment,
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		NumCPU:       runtime.NumCPU(),
+		NumGoroutine: runtime.NumGoroutine(),
+		StartedAt:    b.startedAt.UTC(),
+		Uptime:       b.now().Sub(b.startedAt).Round(time.Second).String(),
+	}
+	if level == LevelFull {
+		info.Hostname, _ = os.Hostname()
+	}
+	return info
+}
+
+// logEntries derives the log of an execution from its events
+func logEntries(events []models.ExecutionEvent) []LogEntry {
+	entries := make([]LogEntry, 0, len(events))
+	for _, event := range events {
+		message, _ := event.Data["message"].(string)
+		if message == "" {
+			message = event.EventType
+		}
+		entries = append(entries, LogEntry{
+			Timestamp: event.Timestamp,
+			Level:     logLevel(event.EventType),
+			Step:      event.StepName,
+			Message:   message,
+			Data:      event.Data,
+		})
+	}
+	return entries
+}
+
+// logLevel returns the log level of an event type
+func logLevel(eventType string) string {
+	switch {
+	case strings.HasSuffix(eventType, ".failed"), strings.Contains(eventType, "error"):
+		return "error"
+	case strings.Contains(eventType, "retry"), strings.HasSuffix(eventType, ".cancelled"):
+		return "warn"
+	default:
+		return "info"
+	}
+}
+
+// annotations collects the annotations of the workflow and the metadata of
+// the execution
+func annotations(execution *models.Execution, workflow *models.Workflow, definition *Definition) *Annotations {
+	result := &Annotations{
+		Annotations: definition.Definition.Metadata.Annotations,
+		Labels:      definition.Definition.Metadata.Labels,
+		Metadata:    execution.Metadata,
+	}
+	if workflow != nil {
+		result.Tags = workflow.Tags
+	}
+	return result
+}
+
+// omittedList returns the fields reduced bundles leave out, as file:field
+func omittedList() []string {
+	var omitted []string
+	for file, fields := range omittedFields {
+		for _, field := range fields {
+			omitted = append(omitted, file+":"+field)
+		}
+	}
+	sort.Strings(omitted)
+	return omitted
+}
+
+// omit removes dotted fields from a decoded JSON object, or from each
+// object of a decoded JSON array
+func omit(value interface{}, fields []string) {
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			omit(item, fields)
+		}
+	case map[string]interface{}:
+		for _, field := range fields {
+			object := value
+			path := strings.Split(field, ".")
+			for _, key := range path[:len(path)-1] {
+				object, _ = object[key].(map[string]interface{})
+			}
+			if object != nil {
+				delete(object, path[len(path)-1])
+			}
+		}
+	}
+}
+
+// generic converts a value to its decoded JSON form, keeping numbers as
+// they were encoded
+func generic(v interface{}) (interface{}, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func startedBefore(a, b *time.Time) bool {
+	switch {
+	case a == nil:
+		return false
+	case b == nil:
+		return true
+	default:
+		return a.Before(*b)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
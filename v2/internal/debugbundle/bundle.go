@@ -0,0 +1,263 @@
+package debugbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// FormatVersion is the version of the bundle layout, recorded in the
+// manifest
+const FormatVersion = 1
+
+// Level is how much of an execution a bundle holds
+type Level string
+
+const (
+	// LevelFull bundles hold the data of the execution, its steps and its
+	// events. They require the debug permission.
+	LevelFull Level = "full"
+	// LevelReduced bundles leave the data out, keeping statuses, timings,
+	// errors and the definition
+	LevelReduced Level = "reduced"
+)
+
+// Files of a bundle
+const (
+	ManifestFile    = "manifest.json"
+	ExecutionFile   = "execution.json"
+	StepsFile       = "steps.json"
+	EventsFile      = "events.json"
+	LogsFile        = "logs.json"
+	AnnotationsFile = "annotations.json"
+	DefinitionFile  = "workflow_version.json"
+	ConfigFile      = "config.json"
+	SystemFile      = "system.json"
+	ApprovalsFile   = "approvals.json"
+	BrandingFile    = "branding.json"
+	SummaryFile     = "summary.md"
+)
+
+var (
+	// ErrExecutionNotFound is returned when bundling an unknown execution
+	ErrExecutionNotFound = errors.New("execution not found")
+	// ErrInvalidBundle is returned when reading an archive that is not a
+	// debug bundle
+	ErrInvalidBundle = errors.New("invalid debug bundle")
+)
+
+// Manifest describes a bundle
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	ExecutionID   uuid.UUID `json:"execution_id"`
+	WorkflowID    uuid.UUID `json:"workflow_id"`
+	WorkflowName  string    `json:"workflow_name"`
+	Level         Level     `json:"level"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	Files         []string  `json:"files"`
+	// Omitted lists the fields a reduced bundle leaves out
+	Omitted []string `json:"omitted,omitempty"`
+	// Redacted counts the values replaced by RedactedValue
+	Redacted int `json:"redacted"`
+}
+
+// Definition is the workflow definition the execution ran
+type Definition struct {
+	// Source is version when the definition is the workflow version the
+	// execution ran, workflow when no version matches and the definition
+	// of the workflow is bundled instead
+	Source       string                    `json:"source"`
+	VersionID    *uuid.UUID                `json:"version_id,omitempty"`
+	Version      string                    `json:"version"`
+	Name         string                    `json:"name"`
+	Description  string                    `json:"description,omitempty"`
+	Definition   models.WorkflowDefinition `json:"definition"`
+	InputSchema  models.JSONSchema         `json:"input_schema"`
+	OutputSchema models.JSONSchema         `json:"output_schema"`
+}
+
+// Definition sources
+const (
+	DefinitionSourceVersion  = "version"
+	DefinitionSourceWorkflow = "workflow"
+)
+
+// EffectiveConfig is the configuration the execution ran with: the policies
+// each step resolved to and the limits of the server
+type EffectiveConfig struct {
+	Timeout        string                 `json:"timeout,omitempty"`
+	MaxConcurrency int                    `json:"max_concurrency,omitempty"`
+	RetryPolicy    models.RetryPolicy     `json:"retry_policy"`
+	ErrorHandling  models.ErrorHandling   `json:"error_handling"`
+	ResourceLimits models.ResourceLimits  `json:"resource_limits"`
+	FeatureFlags   map[string]bool        `json:"feature_flags,omitempty"`
+	Steps          []StepConfig           `json:"steps"`
+	Limits         map[string]interface{} `json:"limits,omitempty"`
+}
+
+// StepConfig is the effective configuration of a step, its own policies or
+// those of the workflow when it has none
+type StepConfig struct {
+	Name          string               `json:"name"`
+	Type          string               `json:"type"`
+	Timeout       string               `json:"timeout,omitempty"`
+	RetryPolicy   models.RetryPolicy   `json:"retry_policy"`
+	ErrorHandling models.ErrorHandling `json:"error_handling"`
+}
+
+// LogEntry is a log line of the execution, derived from its events
+type LogEntry struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Level     string                 `json:"level"`
+	Step      string                 `json:"step,omitempty"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Annotations are the annotations, labels and tags of the workflow and the
+// metadata of the execution
+type Annotations struct {
+	Annotations map[string]string      `json:"annotations,omitempty"`
+	Labels      map[string]string      `json:"labels,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// SystemInfo is a snapshot of the server that built the bundle
+type SystemInfo struct {
+	Version      string    `json:"version"`
+	NodeID       string    `json:"node_id,omitempty"`
+	Environment  string    `json:"environment,omitempty"`
+	Hostname     string    `json:"hostname,omitempty"`
+	GoVersion    string    `json:"go_version"`
+	OS           string    `json:"os"`
+	Arch         string    `json:"arch"`
+	NumCPU       int       `json:"num_cpu"`
+	NumGoroutine int       `json:"num_goroutine"`
+	StartedAt    time.Time `json:"started_at"`
+	Uptime       string    `json:"uptime"`
+}
+
+// Bundle is a debug bundle, the files describing an execution
+type Bundle struct {
+	Manifest Manifest
+	files    map[string][]byte
+}
+
+// File returns the content of a file of the bundle
+func (b *Bundle) File(name string) ([]byte, bool) {
+	content, ok := b.files[name]
+	return content, ok
+}
+
+// Decode decodes a JSON file of the bundle into v
+func (b *Bundle) Decode(name string, v interface{}) error {
+	content, ok := b.files[name]
+	if !ok {
+		return fmt.Errorf("%w: %s is missing", ErrInvalidBundle, name)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%w: failed to decode %s: %v", ErrInvalidBundle, name, err)
+	}
+	return nil
+}
+
+// Write writes the bundle as a zip archive
+func (b *Bundle) Write(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, name := range b.Manifest.Files {
+		f, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: b.Manifest.GeneratedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", name, err)
+		}
+		if _, err := f.Write(b.files[name]); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return archive.Close()
+}
+
+// Archive returns the bundle as a zip archive
+func (b *Bundle) Archive() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Read reads a bundle from a zip archive
+func Read(r io.ReaderAt, size int64) (*Bundle, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	bundle := &Bundle{files: make(map[string][]byte)}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to open %s: %v", ErrInvalidBundle, f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read %s: %v", ErrInvalidBundle, f.Name, err)
+		}
+		bundle.files[f.Name] = content
+	}
+
+	if err := bundle.Decode(ManifestFile, &bundle.Manifest); err != nil {
+		return nil, err
+	}
+	if bundle.Manifest.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidBundle, bundle.Manifest.FormatVersion)
+	}
+	return bundle, nil
+}
+
+// Open reads a bundle from a zip file
+func Open(path string) (*Bundle, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read debug bundle: %w", err)
+	}
+	return Read(bytes.NewReader(content), int64(len(content)))
+}
+
+// fileNames returns the sorted names of the files of a bundle, the manifest
+// and the summary included
+func fileNames(files map[string][]byte) []string {
+	names := []string{ManifestFile, SummaryFile}
+	for name := range files {
+		if name != ManifestFile && name != SummaryFile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newBundle creates a bundle of files, adding the manifest
+func newBundle(manifest Manifest, files map[string][]byte) (*Bundle, error) {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", ManifestFile, err)
+	}
+	files[ManifestFile] = content
+	return &Bundle{Manifest: manifest, files: files}, nil
+}
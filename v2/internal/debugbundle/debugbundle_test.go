@@ -0,0 +1,551 @@
+package debugbundle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/branding"
+	"magic-flow/v2/pkg/models"
+)
+
+const stripeKey = "sk_live_51HxQ2eLkd9"
+
+type executionStore map[uuid.UUID]*models.Execution
+
+func (s executionStore) GetByID(id uuid.UUID) (*models.Execution, error) {
+	execution, ok := s[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return execution, nil
+}
+
+type workflowStore map[uuid.UUID]*models.Workflow
+
+func (s workflowStore) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	workflow, ok := s[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return workflow, nil
+}
+
+type versionStore []*models.WorkflowVersion
+
+func (s versionStore) GetByWorkflowID(workflowID uuid.UUID, limit, offset int) ([]*models.WorkflowVersion, int64, error) {
+	var versions []*models.WorkflowVersion
+	for _, version := range s {
+		if version.WorkflowID == workflowID {
+			versions = append(versions, version)
+		}
+	}
+	return versions, int64(len(versions)), nil
+}
+
+// eventCounts reports the number of events of executions
+type eventCounts map[uuid.UUID]int64
+
+func (c eventCounts) GetByExecutionID(executionID uuid.UUID, limit, offset int) ([]*models.ExecutionEvent, int64, error) {
+	return nil, c[executionID], nil
+}
+
+// approvalStore returns the approval state of executions
+type approvalStore map[uuid.UUID][]map[string]interface{}
+
+func (s approvalStore) ExecutionApprovals(ctx context.Context, executionID uuid.UUID) (interface{}, error) {
+	return s[executionID], nil
+}
+
+var (
+	started     = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	executionID = uuid.MustParse("b7e4c1a9-2d5f-4c83-9e0a-6f1b2c3d4e5a")
+	workflowID  = uuid.MustParse("4a2d8e6f-1b3c-4d5e-8f7a-9b0c1d2e3f4a")
+	versionID   = uuid.MustParse("e1f2a3b4-c5d6-4e7f-8a9b-0c1d2e3f4a5b")
+)
+
+// failedCheckout returns the sources of a checkout execution that failed to
+// charge a card, its input, steps, events and definition holding secrets.
+// The execution ran version 1.1.0 of the workflow and has two events.
+func failedCheckout() Sources {
+	at := func(seconds int) *time.Time {
+		ts := started.Add(time.Duration(seconds) * time.Second)
+		return &ts
+	}
+
+	steps := []models.WorkflowStep{
+		{
+			Name: "charge",
+			Type: "http",
+			Config: map[string]interface{}{
+				"url":     "https://api.stripe.com/v1/charges",
+				"headers": map[string]interface{}{"Authorization": "Bearer " + stripeKey},
+			},
+			RetryPolicy: models.RetryPolicy{MaxAttempts: 5, Delay: "2s"},
+		},
+		{Name: "notify", Type: "http", DependsOn: []string{"charge"}, Config: map[string]interface{}{"url": "https://notify.internal"}},
+	}
+	workflow := &models.Workflow{
+		ID:      workflowID,
+		Name:    "checkout",
+		Version: "1.2.0",
+		Tags:    []string{"payments"},
+		Config: models.WorkflowConfig{
+			Timeout:        "5m",
+			MaxConcurrency: 4,
+			RetryPolicy:    models.RetryPolicy{MaxAttempts: 2, Delay: "1s"},
+			ErrorHandling:  models.ErrorHandling{Strategy: "stop"},
+		},
+	}
+	version := &models.WorkflowVersion{
+		ID:          versionID,
+		WorkflowID:  workflow.ID,
+		Version:     "1.1.0",
+		Description: "Charges the order",
+		Definition: models.WorkflowDefinition{
+			Kind: "Workflow",
+			Metadata: models.WorkflowMetadata{
+				Name:        "checkout",
+				Version:     "1.1.0",
+				Annotations: map[string]string{"owner": "payments-team"},
+			},
+			Spec: models.WorkflowSpec{Steps: steps},
+		},
+		InputSchema: models.JSONSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"order_id": map[string]interface{}{"type": "string"},
+				"card":     map[string]interface{}{"type": "string"},
+			},
+			Required: []string{"order_id"},
+		},
+		Config: models.VersionConfig{ResourceLimits: models.ResourceLimits{Memory: "256Mi"}},
+	}
+
+	execution := &models.Execution{
+		ID:          executionID,
+		WorkflowID:  workflow.ID,
+		Status:      models.ExecutionStatusFailed,
+		TriggerType: models.TriggerTypeManual,
+		TriggerBy:   "alice",
+		InputData:   map[string]interface{}{"order_id": "ord-1042", "card": "4242", "api_key": "ak-123456"},
+		Context: models.ExecutionContext{
+			WorkflowName:    "checkout",
+			WorkflowVersion: "1.1.0",
+			Variables:       map[string]interface{}{"region": "eu"},
+			Secrets:         map[string]string{"stripe": stripeKey},
+		},
+		CorrelationID: "corr-1",
+		StartedAt:     at(0),
+		CompletedAt:   at(4),
+		Duration:      4250,
+		Error:         "charge failed: stripe rejected key " + stripeKey,
+		Metadata:      map[string]interface{}{"ticket": "SUP-77"},
+		Steps: []models.StepExecution{
+			{
+				ID: uuid.New(), ExecutionID: executionID, StepName: "charge", StepType: "http", Status: models.StepStatusFailed,
+				InputData:  map[string]interface{}{"amount": 1999, "token": "tok_visa"},
+				OutputData: map[string]interface{}{"response": "invalid key " + stripeKey},
+				StartedAt:  at(1), Duration: 3000, Attempt: 2, MaxAttempts: 5,
+				Error: "402 | card declined",
+			},
+		},
+		Events: []models.ExecutionEvent{
+			{ID: uuid.New(), ExecutionID: executionID, EventType: "step.failed", StepName: "charge", Timestamp: *at(4), Data: map[string]interface{}{"message": "charge failed", "password": "hunter22"}},
+			{ID: uuid.New(), ExecutionID: executionID, EventType: "execution.started", Timestamp: *at(0), Data: map[string]interface{}{}},
+		},
+	}
+
+	return Sources{
+		Executions: executionStore{executionID: execution},
+		Events:     eventCounts{executionID: 2},
+		Workflows:  workflowStore{workflow.ID: workflow},
+		Versions:   versionStore{version},
+	}
+}
+
+// newTestBuilder returns a builder of the bundles of sources, an hour after
+// the execution started
+func newTestBuilder(sources Sources) *Builder {
+	builder := NewBuilder(sources, Config{
+		Version:             "2.0.0",
+		NodeID:              "node-a",
+		Limits:              map[string]interface{}{"delivery_max_attempts": 5},
+		AsyncEventThreshold: 100,
+	})
+	builder.now = func() time.Time { return started.Add(time.Hour) }
+	return builder
+}
+
+func decode(t *testing.T, bundle *Bundle, name string) map[string]interface{} {
+	t.Helper()
+	var value map[string]interface{}
+	require.NoError(t, bundle.Decode(name, &value))
+	return value
+}
+
+func decodeList(t *testing.T, bundle *Bundle, name string) []map[string]interface{} {
+	t.Helper()
+	var value []map[string]interface{}
+	require.NoError(t, bundle.Decode(name, &value))
+	return value
+}
+
+func TestBuildFull(t *testing.T) {
+	bundle, err := newTestBuilder(failedCheckout()).Build(context.Background(), executionID, LevelFull)
+	require.NoError(t, err)
+
+	assert.Equal(t, LevelFull, bundle.Manifest.Level)
+	assert.Empty(t, bundle.Manifest.Omitted)
+	assert.Equal(t, []string{
+		AnnotationsFile, ConfigFile, EventsFile, ExecutionFile, LogsFile,
+		ManifestFile, StepsFile, SummaryFile, SystemFile, DefinitionFile,
+	}, bundle.Manifest.Files)
+
+	execution := decode(t, bundle, ExecutionFile)
+	assert.Equal(t, map[string]interface{}{"order_id": "ord-1042", "card": "4242", "api_key": RedactedValue}, execution["input_data"])
+	assert.NotContains(t, execution, "steps", "steps have their own file")
+
+	steps := decodeList(t, bundle, StepsFile)
+	require.Len(t, steps, 1)
+	assert.Equal(t, map[string]interface{}{"amount": float64(1999), "token": RedactedValue}, steps[0]["input_data"])
+
+	events := decodeList(t, bundle, EventsFile)
+	require.Len(t, events, 2)
+	assert.Equal(t, "execution.started", events[0]["event_type"], "events are in the order they happened")
+
+	logs := decodeList(t, bundle, LogsFile)
+	require.Len(t, logs, 2)
+	assert.Equal(t, "error", logs[1]["level"])
+	assert.Equal(t, "charge failed", logs[1]["message"])
+
+	definition := decode(t, bundle, DefinitionFile)
+	assert.Equal(t, DefinitionSourceVersion, definition["source"])
+	assert.Equal(t, "1.1.0", definition["version"], "the version the execution ran, not the current one")
+	assert.Equal(t, versionID.String(), definition["version_id"])
+
+	var config EffectiveConfig
+	require.NoError(t, bundle.Decode(ConfigFile, &config))
+	assert.Equal(t, "5m", config.Timeout)
+	assert.Equal(t, 4, config.MaxConcurrency)
+	assert.Equal(t, "256Mi", config.ResourceLimits.Memory)
+	require.Len(t, config.Steps, 2)
+	assert.Equal(t, 5, config.Steps[0].RetryPolicy.MaxAttempts, "steps keep their own retry policy")
+	assert.Equal(t, 2, config.Steps[1].RetryPolicy.MaxAttempts, "steps without one get the workflow's")
+	assert.Equal(t, "stop", config.Steps[1].ErrorHandling.Strategy)
+	assert.EqualValues(t, 5, config.Limits["delivery_max_attempts"])
+
+	annotations := decode(t, bundle, AnnotationsFile)
+	assert.Equal(t, map[string]interface{}{"owner": "payments-team"}, annotations["annotations"])
+	assert.Equal(t, []interface{}{"payments"}, annotations["tags"])
+
+	var system SystemInfo
+	require.NoError(t, bundle.Decode(SystemFile, &system))
+	assert.Equal(t, "2.0.0", system.Version)
+	assert.Equal(t, "node-a", system.NodeID)
+	assert.NotEmpty(t, system.GoVersion)
+
+	summary, ok := bundle.File(SummaryFile)
+	require.True(t, ok)
+	assert.Contains(t, string(summary), "# Execution "+executionID.String())
+	assert.Contains(t, string(summary), "| Workflow | checkout 1.1.0 (version definition) |")
+	assert.Contains(t, string(summary), "| charge | http | failed | 2/5 | 3s | 402 \\| card declined |")
+	assert.Contains(t, string(summary), "Full bundle")
+}
+
+func TestRedaction(t *testing.T) {
+	builder := newTestBuilder(failedCheckout())
+	for _, level := range []Level{LevelFull, LevelReduced} {
+		t.Run(string(level), func(t *testing.T) {
+			bundle, err := builder.Build(context.Background(), executionID, level)
+			require.NoError(t, err)
+
+			for _, name := range bundle.Manifest.Files {
+				content, ok := bundle.File(name)
+				require.True(t, ok, name)
+				assert.NotContains(t, string(content), stripeKey, "%s holds a secret", name)
+				assert.NotContains(t, string(content), "hunter22", name)
+				assert.NotContains(t, string(content), "ak-123456", name)
+			}
+			assert.Positive(t, bundle.Manifest.Redacted)
+
+			execution := decode(t, bundle, ExecutionFile)
+			assert.Equal(t, "charge failed: stripe rejected key "+RedactedValue, execution["error"], "secrets are redacted inside other values")
+
+			var definition Definition
+			require.NoError(t, bundle.Decode(DefinitionFile, &definition))
+			headers := definition.Definition.Spec.Steps[0].Config["headers"].(map[string]interface{})
+			assert.Equal(t, RedactedValue, headers["Authorization"])
+		})
+	}
+
+	t.Run("secret keys are kept", func(t *testing.T) {
+		bundle, err := builder.Build(context.Background(), executionID, LevelFull)
+		require.NoError(t, err)
+		execContext := decode(t, bundle, ExecutionFile)["context"].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"stripe": RedactedValue}, execContext["secrets"])
+	})
+
+	t.Run("short secrets are only redacted by key", func(t *testing.T) {
+		r := newRedactor(map[string]string{"pin": "123", "key": "abcd"})
+		value := r.value(map[string]interface{}{"note": "call 123 with abcd", "pin_code": "123", "session_token": []interface{}{"x", ""}})
+		assert.Equal(t, map[string]interface{}{
+			"note":          "call 123 with " + RedactedValue,
+			"pin_code":      "123",
+			"session_token": []interface{}{RedactedValue, ""},
+		}, value)
+		assert.Equal(t, 2, r.count)
+	})
+}
+
+func TestBuildReduced(t *testing.T) {
+	bundle, err := newTestBuilder(failedCheckout()).Build(context.Background(), executionID, LevelReduced)
+	require.NoError(t, err)
+
+	assert.Equal(t, LevelReduced, bundle.Manifest.Level)
+	assert.Contains(t, bundle.Manifest.Omitted, "execution.json:input_data")
+
+	execution := decode(t, bundle, ExecutionFile)
+	for _, field := range []string{"input_data", "output_data", "trigger_data"} {
+		assert.NotContains(t, execution, field)
+	}
+	execContext := execution["context"].(map[string]interface{})
+	assert.NotContains(t, execContext, "secrets")
+	assert.NotContains(t, execContext, "variables")
+	assert.Equal(t, "checkout", execContext["workflow_name"])
+	assert.Equal(t, "failed", execution["status"], "statuses and errors are kept")
+
+	steps := decodeList(t, bundle, StepsFile)
+	assert.NotContains(t, steps[0], "input_data")
+	assert.NotContains(t, steps[0], "output_data")
+	assert.Equal(t, "402 | card declined", steps[0]["error"])
+	for _, event := range decodeList(t, bundle, EventsFile) {
+		assert.NotContains(t, event, "data")
+	}
+	for _, entry := range decodeList(t, bundle, LogsFile) {
+		assert.NotContains(t, entry, "data")
+	}
+
+	var system SystemInfo
+	require.NoError(t, bundle.Decode(SystemFile, &system))
+	assert.Empty(t, system.Hostname)
+
+	summary, _ := bundle.File(SummaryFile)
+	assert.Contains(t, string(summary), "Reduced bundle")
+	assert.Contains(t, string(summary), "debug permission")
+}
+
+func TestBuildWithoutVersion(t *testing.T) {
+	sources := failedCheckout()
+	sources.Executions.(executionStore)[executionID].Context.WorkflowVersion = "0.9.0"
+	builder := newTestBuilder(sources)
+	bundle, err := builder.Build(context.Background(), executionID, LevelFull)
+	require.NoError(t, err)
+
+	definition := decode(t, bundle, DefinitionFile)
+	assert.Equal(t, DefinitionSourceWorkflow, definition["source"])
+	assert.Equal(t, "checkout", definition["name"])
+
+	_, err = builder.Build(context.Background(), uuid.New(), LevelFull)
+	assert.ErrorIs(t, err, ErrExecutionNotFound)
+}
+
+func TestBuildApprovals(t *testing.T) {
+	sources := failedCheckout()
+	sources.Approvals = approvalStore{executionID: {{
+		"step":   "refund-sign-off",
+		"status": "pending",
+		"approvals": []interface{}{
+			map[string]interface{}{"approver": "alice", "via": "group:finance", "comment": "ok"},
+		},
+	}}}
+	bundle, err := newTestBuilder(sources).Build(context.Background(), executionID, LevelReduced)
+	require.NoError(t, err)
+
+	assert.Contains(t, bundle.Manifest.Files, ApprovalsFile)
+	approvals := decodeList(t, bundle, ApprovalsFile)
+	require.Len(t, approvals, 1)
+	assert.Equal(t, "pending", approvals[0]["status"])
+	assert.Len(t, approvals[0]["approvals"], 1, "approvals are kept in reduced bundles")
+}
+
+func TestBuildBranding(t *testing.T) {
+	builder := newTestBuilder(failedCheckout())
+	bundle, err := builder.Build(context.Background(), executionID, LevelReduced)
+	require.NoError(t, err)
+	assert.NotContains(t, bundle.Manifest.Files, BrandingFile)
+
+	manager := branding.NewManager(branding.NewMemoryStore(), logrus.New())
+	_, err = manager.SaveProfile(context.Background(), &branding.Profile{Namespace: branding.DefaultNamespace, ProductName: "Acme Orchestrator"}, "admin")
+	require.NoError(t, err)
+	builder.sources.Branding = manager
+	bundle, err = builder.Build(context.Background(), executionID, LevelReduced)
+	require.NoError(t, err)
+
+	profile := decode(t, bundle, BrandingFile)
+	assert.Equal(t, branding.DefaultNamespace, profile["namespace"])
+	assert.Equal(t, "Acme Orchestrator", profile["product_name"])
+	assert.Equal(t, "https://magicflow.dev", profile["support_url"])
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	bundle, err := newTestBuilder(failedCheckout()).Build(context.Background(), executionID, LevelFull)
+	require.NoError(t, err)
+	archive, err := bundle.Archive()
+	require.NoError(t, err)
+
+	read, err := Read(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	assert.Equal(t, bundle.Manifest.ExecutionID, read.Manifest.ExecutionID)
+	assert.Equal(t, bundle.Manifest.Files, read.Manifest.Files)
+	for _, name := range bundle.Manifest.Files {
+		expected, _ := bundle.File(name)
+		actual, ok := read.File(name)
+		require.True(t, ok, name)
+		assert.Equal(t, expected, actual, name)
+	}
+
+	_, err = Read(bytes.NewReader([]byte("not a zip")), 9)
+	assert.ErrorIs(t, err, ErrInvalidBundle)
+}
+
+const debugKey = "debug-key"
+
+func newTestRouter(builder *Builder) (*gin.Engine, *Jobs) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	jobs := NewJobs(builder, time.Hour, logger)
+	router := gin.New()
+	NewHandlers(builder, jobs, DebugKeys("X-API-Key", []string{debugKey})).RegisterRoutes(router.Group("/api"))
+	return router, jobs
+}
+
+func get(router *gin.Engine, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func readResponse(t *testing.T, w *httptest.ResponseRecorder) *Bundle {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, zipContentType, w.Header().Get("Content-Type"))
+	bundle, err := Read(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	return bundle
+}
+
+func TestHandlersPermission(t *testing.T) {
+	router, _ := newTestRouter(newTestBuilder(failedCheckout()))
+	path := "/api/v1/executions/" + executionID.String() + "/debug-bundle"
+
+	tests := map[string]struct {
+		path  string
+		key   string
+		code  int
+		level Level
+	}{
+		"debug permission gets the full bundle":      {path: path, key: debugKey, code: http.StatusOK, level: LevelFull},
+		"callers without a key get a reduced bundle": {path: path, code: http.StatusOK, level: LevelReduced},
+		"other callers get a reduced bundle":         {path: path, key: "another-key", code: http.StatusOK, level: LevelReduced},
+		"debug callers may ask for a reduced bundle": {path: path + "?level=reduced", key: debugKey, code: http.StatusOK, level: LevelReduced},
+		"full bundle without the permission":         {path: path + "?level=full", key: "another-key", code: http.StatusForbidden},
+		"unknown level":                              {path: path + "?level=everything", key: debugKey, code: http.StatusBadRequest},
+		"invalid execution ID":                       {path: "/api/v1/executions/nope/debug-bundle", key: debugKey, code: http.StatusBadRequest},
+		"unknown execution":                          {path: "/api/v1/executions/" + uuid.New().String() + "/debug-bundle", key: debugKey, code: http.StatusNotFound},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := get(router, tt.path, tt.key)
+			if tt.code != http.StatusOK {
+				assert.Equal(t, tt.code, w.Code, w.Body.String())
+				return
+			}
+			bundle := readResponse(t, w)
+			assert.Equal(t, tt.level, bundle.Manifest.Level)
+			assert.Equal(t, string(tt.level), w.Header().Get(LevelHeader))
+			assert.Contains(t, w.Header().Get("Content-Disposition"), "execution-"+executionID.String()+"-debug-bundle.zip")
+			if tt.level == LevelFull {
+				assert.Contains(t, decode(t, bundle, ExecutionFile), "input_data")
+			} else {
+				assert.NotContains(t, decode(t, bundle, ExecutionFile), "input_data")
+			}
+		})
+	}
+}
+
+func TestHandlersAsync(t *testing.T) {
+	sources := failedCheckout()
+	events := eventCounts{executionID: 101}
+	sources.Events = events
+	router, jobs := newTestRouter(newTestBuilder(sources))
+
+	w := get(router, "/api/v1/executions/"+executionID.String()+"/debug-bundle", debugKey)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var accepted struct {
+		Job       Job    `json:"job"`
+		StatusURL string `json:"status_url"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	assert.Equal(t, LevelFull, accepted.Job.Level)
+	assert.True(t, strings.HasSuffix(accepted.StatusURL, accepted.Job.ID.String()))
+	jobs.Wait()
+
+	t.Run("the full job is only visible with the debug permission", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get(router, accepted.StatusURL, "").Code)
+		assert.Equal(t, http.StatusForbidden, get(router, accepted.StatusURL+"/download", "").Code)
+	})
+
+	w = get(router, accepted.StatusURL, debugKey)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status struct {
+		Job         Job    `json:"job"`
+		DownloadURL string `json:"download_url"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, JobStatusCompleted, status.Job.Status)
+	assert.Positive(t, status.Job.Size)
+
+	bundle := readResponse(t, get(router, status.DownloadURL, debugKey))
+	assert.Equal(t, executionID, bundle.Manifest.ExecutionID)
+
+	t.Run("async on request", func(t *testing.T) {
+		events[executionID] = 2
+		w := get(router, "/api/v1/executions/"+executionID.String()+"/debug-bundle?async=true", "")
+		require.Equal(t, http.StatusAccepted, w.Code)
+		jobs.Wait()
+	})
+
+	t.Run("failed job", func(t *testing.T) {
+		job := jobs.Submit(uuid.New(), LevelReduced)
+		jobs.Wait()
+		failed, err := jobs.Get(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusFailed, failed.Status)
+		assert.Equal(t, ErrExecutionNotFound.Error(), failed.Error)
+		assert.Equal(t, http.StatusBadRequest, get(router, "/api/v1/debug-bundles/"+job.ID.String()+"/download", "").Code)
+	})
+
+	t.Run("jobs expire", func(t *testing.T) {
+		jobs.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		assert.Equal(t, http.StatusNotFound, get(router, accepted.StatusURL, debugKey).Code)
+	})
+}
@@ -0,0 +1,228 @@
+package debugbundle
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// LevelHeader reports the level of a bundle download
+const LevelHeader = "X-Magic-Flow-Bundle-Level"
+
+// zipContentType is the content type of bundle downloads
+const zipContentType = "application/zip"
+
+// Permission reports whether the caller of a request holds the debug
+// permission
+type Permission func(c *gin.Context) bool
+
+// DebugKeys grants the debug permission to the callers sending one of keys
+// in the API key header
+func DebugKeys(header string, keys []string) Permission {
+	return func(c *gin.Context) bool {
+		key := c.GetHeader(header)
+		if key == "" {
+			return false
+		}
+		for _, debugKey := range keys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(debugKey)) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Handlers provides HTTP handlers for execution debug bundles
+type Handlers struct {
+	builder  *Builder
+	jobs     *Jobs
+	canDebug Permission
+}
+
+// NewHandlers creates new debug bundle handlers. Callers canDebug rejects,
+// or every caller when it is nil, get reduced bundles.
+func NewHandlers(builder *Builder, jobs *Jobs, canDebug Permission) *Handlers {
+	if canDebug == nil {
+		canDebug = func(*gin.Context) bool { return false }
+	}
+	return &Handlers{builder: builder, jobs: jobs, canDebug: canDebug}
+}
+
+// RegisterRoutes registers debug bundle routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		v1.GET("/executions/:id/debug-bundle", h.GetBundle)
+		v1.GET("/debug-bundles/:job_id", h.GetJob)
+		v1.GET("/debug-bundles/:job_id/download", h.DownloadJob)
+	}
+}
+
+// GetBundle downloads the debug bundle of an execution
+// @Summary Download the debug bundle of an execution
+// @Description Downloads a zip archive of the execution, its steps, events, logs, annotations, workflow version definition, effective config and a server snapshot, with a summary.md. Secrets are redacted. Callers without the debug permission get a reduced bundle without the execution data. Bundles of executions with many events, or requested with async=true, are built by a job: the response is 202 with the job to poll.
+// @Tags executions
+// @Produce application/zip
+// @Param id path string true "Execution ID"
+// @Param level query string false "full or reduced, defaults to the highest level the caller holds"
+// @Param async query bool false "Build the bundle in a job"
+// @Success 200 {file} file
+// @Success 202 {object} Job
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/executions/{id}/debug-bundle [get]
+func (h *Handlers) GetBundle(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution ID"})
+		return
+	}
+
+	level, ok := h.level(c)
+	if !ok {
+		return
+	}
+
+	async := c.Query("async") == "true"
+	if !async {
+		async, err = h.builder.Large(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if async {
+		job := h.jobs.Submit(id, level)
+		c.JSON(http.StatusAccepted, gin.H{
+			"job":        job,
+			"status_url": "/api/v1/debug-bundles/" + job.ID.String(),
+		})
+		return
+	}
+
+	bundle, err := h.builder.Build(c.Request.Context(), id, level)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	archive, err := bundle.Archive()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.download(c, id, level, archive)
+}
+
+// GetJob gets a debug bundle job
+// @Summary Get a debug bundle job
+// @Tags executions
+// @Produce json
+// @Param job_id path string true "Job ID"
+// @Success 200 {object} Job
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/debug-bundles/{job_id} [get]
+func (h *Handlers) GetJob(c *gin.Context) {
+	job, ok := h.job(c)
+	if !ok {
+		return
+	}
+
+	response := gin.H{"job": job}
+	if job.Status == JobStatusCompleted {
+		response["download_url"] = "/api/v1/debug-bundles/" + job.ID.String() + "/download"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadJob downloads the bundle built by a job
+// @Summary Download the bundle of a debug bundle job
+// @Tags executions
+// @Produce application/zip
+// @Param job_id path string true "Job ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/debug-bundles/{job_id}/download [get]
+func (h *Handlers) DownloadJob(c *gin.Context) {
+	job, ok := h.job(c)
+	if !ok {
+		return
+	}
+
+	job, archive, err := h.jobs.Archive(job.ID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	h.download(c, job.ExecutionID, job.Level, archive)
+}
+
+// level returns the level of the bundle a caller asked for, the highest it
+// holds by default. Asking for a full bundle without the debug permission
+// is forbidden.
+func (h *Handlers) level(c *gin.Context) (Level, bool) {
+	canDebug := h.canDebug(c)
+	switch Level(c.Query("level")) {
+	case "":
+		if canDebug {
+			return LevelFull, true
+		}
+		return LevelReduced, true
+	case LevelReduced:
+		return LevelReduced, true
+	case LevelFull:
+		if !canDebug {
+			c.JSON(http.StatusForbidden, gin.H{"error": "a full debug bundle requires the debug permission"})
+			return "", false
+		}
+		return LevelFull, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid level %q, expected full or reduced", c.Query("level"))})
+		return "", false
+	}
+}
+
+// job returns the job of a request, which only callers holding the debug
+// permission may see when it builds a full bundle
+func (h *Handlers) job(c *gin.Context) (*Job, bool) {
+	id, err := uuid.Parse(c.Param("job_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return nil, false
+	}
+	job, err := h.jobs.Get(id)
+	if err != nil {
+		h.handleError(c, err)
+		return nil, false
+	}
+	if job.Level == LevelFull && !h.canDebug(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "a full debug bundle requires the debug permission"})
+		return nil, false
+	}
+	return job, true
+}
+
+func (h *Handlers) download(c *gin.Context, executionID uuid.UUID, level Level, archive []byte) {
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="execution-%s-debug-bundle.zip"`, executionID))
+	c.Header(LevelHeader, string(level))
+	c.Data(http.StatusOK, zipContentType, archive)
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrExecutionNotFound), errors.Is(err, ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrJobNotCompleted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,177 @@
+package debugbundle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultJobTTL is how long the bundle of a finished job is kept when no
+// TTL is configured
+const DefaultJobTTL = time.Hour
+
+var (
+	// ErrJobNotFound is returned for unknown or expired jobs
+	ErrJobNotFound = errors.New("debug bundle job not found")
+	// ErrJobNotCompleted is returned when downloading the bundle of a job
+	// still running or failed
+	ErrJobNotCompleted = errors.New("debug bundle job is not completed")
+)
+
+// JobStatus is the status of a bundle job
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// Job builds the bundle of a large execution in the background
+type Job struct {
+	ID          uuid.UUID  `json:"id"`
+	ExecutionID uuid.UUID  `json:"execution_id"`
+	Level       Level      `json:"level"`
+	Status      JobStatus  `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Size        int        `json:"size,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	archive []byte
+}
+
+// Jobs runs bundle jobs and keeps their bundles in memory until they expire
+type Jobs struct {
+	builder *Builder
+	ttl     time.Duration
+	logger  *logrus.Logger
+	now     func() time.Time
+
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*Job
+	wg   sync.WaitGroup
+}
+
+// NewJobs creates the runner of the bundle jobs of a builder. The bundle of
+// a job expires ttl after the job finished.
+func NewJobs(builder *Builder, ttl time.Duration, logger *logrus.Logger) *Jobs {
+	if ttl <= 0 {
+		ttl = DefaultJobTTL
+	}
+	return &Jobs{
+		builder: builder,
+		ttl:     ttl,
+		logger:  logger,
+		now:     time.Now,
+		jobs:    make(map[uuid.UUID]*Job),
+	}
+}
+
+// Submit starts a job building the bundle of an execution
+func (j *Jobs) Submit(executionID uuid.UUID, level Level) *Job {
+	job := &Job{
+		ID:          uuid.New(),
+		ExecutionID: executionID,
+		Level:       level,
+		Status:      JobStatusPending,
+		CreatedAt:   j.now().UTC(),
+	}
+
+	j.mu.Lock()
+	j.expireLocked()
+	j.jobs[job.ID] = job
+	submitted := *job
+	j.mu.Unlock()
+
+	j.wg.Add(1)
+	go j.run(job)
+	return &submitted
+}
+
+// Get returns a job
+func (j *Jobs) Get(id uuid.UUID) (*Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.expireLocked()
+	job, ok := j.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job.snapshot(), nil
+}
+
+// Archive returns the bundle of a completed job as a zip archive
+func (j *Jobs) Archive(id uuid.UUID) (*Job, []byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.expireLocked()
+	job, ok := j.jobs[id]
+	if !ok {
+		return nil, nil, ErrJobNotFound
+	}
+	if job.Status != JobStatusCompleted {
+		return nil, nil, ErrJobNotCompleted
+	}
+	return job.snapshot(), job.archive, nil
+}
+
+// Wait waits for the running jobs to finish
+func (j *Jobs) Wait() {
+	j.wg.Wait()
+}
+
+func (j *Jobs) run(job *Job) {
+	defer j.wg.Done()
+
+	j.mu.Lock()
+	job.Status = JobStatusRunning
+	j.mu.Unlock()
+
+	bundle, err := j.builder.Build(context.Background(), job.ExecutionID, job.Level)
+	var archive []byte
+	if err == nil {
+		archive, err = bundle.Archive()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	completedAt := j.now().UTC()
+	job.CompletedAt = &completedAt
+	if err != nil {
+		job.Status = JobStatusFailed
+		job.Error = err.Error()
+		j.logger.WithError(err).WithFields(logrus.Fields{
+			"job_id":       job.ID,
+			"execution_id": job.ExecutionID,
+		}).Error("Failed to build debug bundle")
+		return
+	}
+	job.Status = JobStatusCompleted
+	job.Size = len(archive)
+	job.archive = archive
+}
+
+// snapshot copies a job without its bundle
+func (job *Job) snapshot() *Job {
+	snapshot := *job
+	snapshot.archive = nil
+	return &snapshot
+}
+
+// expireLocked drops the jobs finished more than the TTL ago
+func (j *Jobs) expireLocked() {
+	now := j.now()
+	for id, job := range j.jobs {
+		if job.CompletedAt != nil && now.Sub(*job.CompletedAt) > j.ttl {
+			delete(j.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package debugbundle
+
+import (
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces the redacted values of a bundle
+const RedactedValue = "[REDACTED]"
+
+// minSecretLength is the length below which secret values are not searched
+// for in other values, short values matching too much unrelated text
+const minSecretLength = 4
+
+// sensitiveKeys are the fragments of the keys whose values are redacted
+var sensitiveKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"api_key",
+	"apikey",
+	"authorization",
+	"credential",
+	"private_key",
+	"cookie",
+}
+
+// isSensitiveKey reports whether the value of a key is redacted
+func isSensitiveKey(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, fragment := range sensitiveKeys {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor redacts the values of sensitive keys and the secrets of an
+// execution wherever they appear, counting what it redacted
+type redactor struct {
+	secrets []string
+	count   int
+}
+
+// newRedactor creates a redactor of the secret values of an execution
+func newRedactor(secrets map[string]string) *redactor {
+	r := &redactor{}
+	for _, secret := range secrets {
+		if len(secret) >= minSecretLength {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	// Longer secrets first, so a secret containing another is replaced
+	// whole
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+	return r
+}
+
+// value redacts a decoded JSON value in place and returns it
+func (r *redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isSensitiveKey(key) {
+				v[key] = r.all(value)
+			} else {
+				v[key] = r.value(value)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = r.value(value)
+		}
+		return v
+	case string:
+		return r.string(v)
+	default:
+		return v
+	}
+}
+
+// all redacts every value of v, keeping the keys of objects so the shape
+// of the data stays readable
+func (r *redactor) all(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = r.all(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = r.all(value)
+		}
+		return v
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return v
+		}
+	}
+	r.count++
+	return RedactedValue
+}
+
+// string replaces the secrets appearing in s
+func (r *redactor) string(s string) string {
+	for _, secret := range r.secrets {
+		if n := strings.Count(s, secret); n > 0 {
+			s = strings.ReplaceAll(s, secret, RedactedValue)
+			r.count += n
+		}
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+package debugbundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// summaryTemplate renders summary.md, the overview of a bundle read first
+// by whoever picks up the support ticket
+const summaryTemplate = `# Execution {{ .Execution.ID }}
+
+| | |
+|---|---|
+| Workflow | {{ cell .Definition.Name }} {{ cell .Definition.Version }} ({{ .Definition.Source }} definition) |
+| Status | {{ .Execution.Status }} |
+| Trigger | {{ .Execution.TriggerType }}{{ with .Execution.TriggerBy }} by {{ cell . }}{{ end }} |
+| Started | {{ timestamp .Execution.StartedAt }} |
+| Completed | {{ timestamp .Execution.CompletedAt }} |
+| Duration | {{ duration .Execution.Duration }} |
+{{- with .Execution.CorrelationID }}
+| Correlation ID | {{ cell . }} |
+{{- end }}
+{{- with .Execution.NodeID }}
+| Node | {{ cell . }} |
+{{- end }}
+| Server | {{ .System.Version }}{{ with .System.NodeID }} on {{ . }}{{ end }} |
+{{- with .Execution.Error }}
+
+## Error
+
+` + "```" + `
+{{ . }}
+` + "```" + `
+{{- end }}
+
+## Steps
+{{ if .Steps }}
+| Step | Type | Status | Attempt | Duration | Error |
+|---|---|---|---|---|---|
+{{- range .Steps }}
+| {{ cell .StepName }} | {{ cell .StepType }} | {{ .Status }} | {{ .Attempt }}/{{ .MaxAttempts }} | {{ duration .Duration }} | {{ cell .Error }} |
+{{- end }}
+{{ else }}
+The execution ran no steps.
+{{ end }}
+## Bundle
+
+{{ if eq .Manifest.Level "full" -}}
+Full bundle generated at {{ .Manifest.GeneratedAt.Format "2006-01-02T15:04:05Z07:00" }}.
+{{- else -}}
+Reduced bundle generated at {{ .Manifest.GeneratedAt.Format "2006-01-02T15:04:05Z07:00" }}. The inputs,
+outputs and event data of the execution are left out; a full bundle requires
+the debug permission.
+{{- end }}
+{{- if .Manifest.Redacted }} {{ .Manifest.Redacted }} secret values are redacted.{{ end }}
+{{ range .Manifest.Files }}
+- ` + "`{{ . }}`" + `
+{{- end }}
+`
+
+var summary = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"cell":      cell,
+	"timestamp": timestamp,
+	"duration":  duration,
+}).Parse(summaryTemplate))
+
+// summaryData is the data of the summary template
+type summaryData struct {
+	Manifest   Manifest
+	Execution  models.Execution
+	Steps      []models.StepExecution
+	Definition Definition
+	System     SystemInfo
+}
+
+// renderSummary renders summary.md from the redacted documents of a bundle
+func renderSummary(manifest Manifest, documents map[string]interface{}) ([]byte, error) {
+	data := summaryData{Manifest: manifest}
+	for name, target := range map[string]interface{}{
+		ExecutionFile:  &data.Execution,
+		StepsFile:      &data.Steps,
+		DefinitionFile: &data.Definition,
+		SystemFile:     &data.System,
+	} {
+		content, err := json.Marshal(documents[name])
+		if err == nil {
+			err = json.Unmarshal(content, target)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s for the summary: %w", name, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := summary.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", SummaryFile, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// cell escapes a value for a markdown table cell
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func timestamp(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// duration formats a duration in milliseconds
+func duration(ms int64) string {
+	if ms <= 0 {
+		return "-"
+	}
+	return (time.Duration(ms) * time.Millisecond).String()
+}
@@ -0,0 +1,176 @@
+package delivery
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/correlation"
+)
+
+// DefaultBufferSize is the number of events buffered for a handler when
+// Config.BufferSize is not set
+const DefaultBufferSize = 10000
+
+// OverflowPolicy decides what happens to the events of a handler whose
+// buffer is full
+type OverflowPolicy string
+
+const (
+	// OverflowBlock makes the engine wait until the handler has room for
+	// the event, slowing executions down to the pace of the handler
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest drops the oldest queued event of the handler to
+	// make room for the new one
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowDropNewest drops the new event
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+)
+
+// BufferConfig sets the buffer of the handlers it names
+type BufferConfig struct {
+	// Handler names the handlers, a name ending in * matching the handlers
+	// it prefixes
+	Handler string
+	// Size defaults to Config.BufferSize
+	Size int
+	// OverflowPolicy defaults to Config.OverflowPolicy
+	OverflowPolicy OverflowPolicy
+}
+
+// buffer returns the buffer size and overflow policy of a handler
+func (d *Dispatcher) buffer(name string) (int, OverflowPolicy) {
+	size, policy := d.config.BufferSize, d.config.OverflowPolicy
+	for _, buffer := range d.config.Buffers {
+		if !matchHandler(buffer.Handler, name) {
+			continue
+		}
+		if buffer.Size > 0 {
+			size = buffer.Size
+		}
+		if buffer.OverflowPolicy != "" {
+			policy = buffer.OverflowPolicy
+		}
+		break
+	}
+	return size, policy
+}
+
+// reserve makes room for an event in the buffer, applying the overflow
+// policy when it is full, and reports whether the event can be queued.
+// Events of held lanes do not count: they cannot leave the buffer until the
+// parked event holding them is re-driven or discarded, and would otherwise
+// block or drop the events of every other execution. c.mu must be held.
+func (c *Consumer) reserve(item *queued) bool {
+	for c.buffered >= c.bufferSize && c.buffered-c.heldLocked() >= c.bufferSize {
+		switch c.overflow {
+		case OverflowBlock:
+			if c.dispatcher.ctx.Err() != nil {
+				c.drop(item, "shutdown")
+				return false
+			}
+			c.room.Wait()
+		case OverflowDropOldest:
+			oldest := c.dropOldestLocked()
+			if oldest == nil {
+				// Every buffered event is being delivered
+				c.drop(item, string(c.overflow))
+				return false
+			}
+			c.drop(oldest, string(c.overflow))
+		default:
+			c.drop(item, string(c.overflow))
+			return false
+		}
+	}
+
+	c.buffered++
+	c.sequence++
+	item.sequence = c.sequence
+	return true
+}
+
+// heldLocked returns the number of events queued in lanes held by a parked
+// event. c.mu must be held.
+func (c *Consumer) heldLocked() int {
+	held := 0
+	for _, l := range c.lanes {
+		if l.heldBy != "" {
+			held += len(l.events)
+		}
+	}
+	return held
+}
+
+// dropOldestLocked removes the queued event buffered first from its lane
+// and returns it, nil when no event is queued outside held lanes. c.mu must
+// be held.
+func (c *Consumer) dropOldestLocked() *queued {
+	var oldestKey string
+	var oldest *lane
+	for key, l := range c.lanes {
+		if len(l.events) == 0 || l.heldBy != "" {
+			continue
+		}
+		if oldest == nil || l.events[0].sequence < oldest.events[0].sequence {
+			oldestKey, oldest = key, l
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+
+	item := oldest.events[0]
+	oldest.events = oldest.events[1:]
+	if len(oldest.events) == 0 && !oldest.running {
+		delete(c.lanes, oldestKey)
+	}
+	c.freeLocked(1)
+	return item
+}
+
+// drop records an event that was not delivered because the buffer was
+// full. Events of acknowledged handlers stay journaled and are delivered by
+// Recover after a restart.
+func (c *Consumer) drop(item *queued, reason string) {
+	d := c.dispatcher
+	d.logger.WithFields(logrus.Fields{
+		"handler":         c.name,
+		"event_type":      item.event.Type,
+		"execution_id":    item.event.ExecutionID,
+		correlation.Field: item.event.CorrelationID,
+		"buffer_size":     c.bufferSize,
+		"reason":          reason,
+		"journaled":       item.position != 0,
+	}).Warn("Event handler buffer full, event dropped")
+
+	if d.metrics != nil {
+		d.metrics.RecordMetric("event_deliveries_dropped_total", 1, map[string]string{
+			"handler": c.name,
+			"reason":  reason,
+		})
+	}
+}
+
+// free removes events from the buffer
+func (c *Consumer) free(count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.freeLocked(count)
+}
+
+// freeLocked removes events from the buffer, waking the callers waiting
+// for room. c.mu must be held.
+func (c *Consumer) freeLocked(count int) {
+	if count == 0 {
+		return
+	}
+	c.buffered -= count
+	c.room.Broadcast()
+}
+
+// Buffered returns the number of events of the handler that are queued or
+// being delivered
+func (c *Consumer) Buffered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buffered
+}
@@ -0,0 +1,694 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/engine"
+)
+
+// poisonHandler fails every delivery of one step's events until it is fixed
+type poisonHandler struct {
+	mu       sync.Mutex
+	poison   string
+	fixed    bool
+	attempts map[string]int
+	handled  []string
+}
+
+func newPoisonHandler(poison string) *poisonHandler {
+	return &poisonHandler{poison: poison, attempts: make(map[string]int)}
+}
+
+func (h *poisonHandler) Handle(event *engine.WorkflowEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.attempts[event.StepID]++
+	if event.StepID == h.poison && !h.fixed {
+		return errors.New("malformed payload")
+	}
+	h.handled = append(h.handled, event.StepID)
+	return nil
+}
+
+func (h *poisonHandler) GetEventTypes() []string {
+	return []string{"step.completed"}
+}
+
+func (h *poisonHandler) Fix() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fixed = true
+}
+
+func (h *poisonHandler) Handled() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.handled...)
+}
+
+func (h *poisonHandler) Attempts(stepID string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.attempts[stepID]
+}
+
+// recordingMetrics records metric names
+type recordingMetrics struct {
+	mu     sync.Mutex
+	labels map[string][]map[string]string
+}
+
+func (m *recordingMetrics) RecordMetric(name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.labels == nil {
+		m.labels = make(map[string][]map[string]string)
+	}
+	m.labels[name] = append(m.labels[name], labels)
+}
+
+func (m *recordingMetrics) Recorded(name string) []map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.labels[name]
+}
+
+// recordingNotifier records parked event notifications
+type recordingNotifier struct {
+	mu     sync.Mutex
+	parked []string
+}
+
+func (n *recordingNotifier) EventParked(ctx context.Context, event *ParkedEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.parked = append(n.parked, event.ID)
+}
+
+func (n *recordingNotifier) Parked() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.parked...)
+}
+
+type testDispatcher struct {
+	*Dispatcher
+	store    *MemoryStore
+	metrics  *recordingMetrics
+	notifier *recordingNotifier
+}
+
+func newTestDispatcher(t *testing.T, policy OrderingPolicy) *testDispatcher {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	store := NewMemoryStore()
+	metrics := &recordingMetrics{}
+	notifier := &recordingNotifier{}
+	dispatcher := NewDispatcher(Config{
+		MaxAttempts:     3,
+		RetryBackoff:    time.Millisecond,
+		MaxRetryBackoff: 2 * time.Millisecond,
+		OrderingPolicy:  policy,
+	}, store, metrics, notifier, logger)
+	t.Cleanup(dispatcher.Stop)
+
+	return &testDispatcher{Dispatcher: dispatcher, store: store, metrics: metrics, notifier: notifier}
+}
+
+func stepEvent(executionID uuid.UUID, stepID string) *engine.WorkflowEvent {
+	return &engine.WorkflowEvent{
+		Type:        "step.completed",
+		ExecutionID: executionID,
+		WorkflowID:  uuid.New(),
+		StepID:      stepID,
+		Timestamp:   time.Now().UTC(),
+		Data:        map[string]interface{}{"step": stepID},
+	}
+}
+
+// eventuallyParked waits for the number of parked events of the store
+func eventuallyParked(t *testing.T, store *MemoryStore, count int) []*ParkedEvent {
+	var parked []*ParkedEvent
+	require.Eventually(t, func() bool {
+		var err error
+		parked, err = store.List(context.Background(), "")
+		return err == nil && len(parked) == count
+	}, 5*time.Second, time.Millisecond)
+	return parked
+}
+
+func TestParking(t *testing.T) {
+	d := newTestDispatcher(t, SkipAndContinue)
+	handler := newPoisonHandler("charge")
+	consumer := d.Wrap("billing", handler)
+
+	var _ engine.QueuedEventHandler = consumer
+	executionID := uuid.New()
+	consumer.Enqueue(stepEvent(executionID, "charge"))
+	consumer.Enqueue(&engine.WorkflowEvent{Type: "step.started", ExecutionID: executionID, StepID: "ignored"})
+
+	parked := eventuallyParked(t, d.store, 1)[0]
+	assert.Equal(t, "billing", parked.Handler)
+	assert.Equal(t, "step.completed", parked.EventType)
+	assert.Equal(t, executionID.String(), parked.ExecutionID)
+	assert.Equal(t, executionID.String(), parked.OrderingKey)
+	assert.Equal(t, 3, parked.Attempts)
+	assert.Equal(t, "malformed payload", parked.LastError)
+	assert.False(t, parked.HoldsOrder)
+	assert.Equal(t, 3, handler.Attempts("charge"), "the event is not retried once parked")
+	assert.Zero(t, handler.Attempts("ignored"), "events of other types are not delivered")
+
+	require.Eventually(t, func() bool { return len(d.notifier.Parked()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{parked.ID}, d.notifier.Parked())
+	assert.Equal(t, []map[string]string{{"handler": "billing", "event_type": "step.completed"}}, d.metrics.Recorded("event_deliveries_parked_total"))
+
+	var event engine.WorkflowEvent
+	require.NoError(t, json.Unmarshal([]byte(parked.Payload), &event))
+	assert.Equal(t, "charge", event.StepID)
+
+	t.Run("duplicate handler names", func(t *testing.T) {
+		assert.Panics(t, func() { d.Wrap("billing", handler) })
+	})
+}
+
+func TestOrderingPolicies(t *testing.T) {
+	t.Run("skip and continue unblocks the execution", func(t *testing.T) {
+		d := newTestDispatcher(t, SkipAndContinue)
+		handler := newPoisonHandler("charge")
+		consumer := d.Wrap("billing", handler)
+
+		executionID := uuid.New()
+		for _, stepID := range []string{"reserve", "charge", "ship", "notify"} {
+			consumer.Enqueue(stepEvent(executionID, stepID))
+		}
+
+		eventuallyParked(t, d.store, 1)
+		require.Eventually(t, func() bool { return len(handler.Handled()) == 3 }, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"reserve", "ship", "notify"}, handler.Handled())
+	})
+
+	t.Run("hold order holds the execution until re-driven", func(t *testing.T) {
+		d := newTestDispatcher(t, HoldOrder)
+		handler := newPoisonHandler("charge")
+		consumer := d.Wrap("billing", handler)
+
+		executionID := uuid.New()
+		other := uuid.New()
+		for _, stepID := range []string{"reserve", "charge", "ship"} {
+			consumer.Enqueue(stepEvent(executionID, stepID))
+		}
+
+		parked := eventuallyParked(t, d.store, 1)[0]
+		assert.True(t, parked.HoldsOrder)
+
+		consumer.Enqueue(stepEvent(executionID, "notify"))
+		consumer.Enqueue(stepEvent(other, "other"))
+		require.Eventually(t, func() bool { return len(handler.Handled()) == 2 }, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"reserve", "other"}, handler.Handled(), "other executions are not held")
+
+		handler.Fix()
+		_, err := d.Redrive(context.Background(), parked.ID)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return len(handler.Handled()) == 5 }, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"reserve", "other", "charge", "ship", "notify"}, handler.Handled())
+	})
+
+	t.Run("discarding releases a held execution", func(t *testing.T) {
+		d := newTestDispatcher(t, HoldOrder)
+		handler := newPoisonHandler("charge")
+		consumer := d.Wrap("billing", handler)
+
+		executionID := uuid.New()
+		consumer.Enqueue(stepEvent(executionID, "charge"))
+		consumer.Enqueue(stepEvent(executionID, "ship"))
+		parked := eventuallyParked(t, d.store, 1)[0]
+
+		require.NoError(t, d.Discard(context.Background(), parked.ID))
+		require.Eventually(t, func() bool { return len(handler.Handled()) == 1 }, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"ship"}, handler.Handled())
+		eventuallyParked(t, d.store, 0)
+	})
+}
+
+func TestRedrive(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDispatcher(t, SkipAndContinue)
+	handler := newPoisonHandler("charge")
+	d.Wrap("billing", handler).Enqueue(stepEvent(uuid.New(), "charge"))
+	parked := eventuallyParked(t, d.store, 1)[0]
+
+	t.Run("failing re-drive keeps the event parked", func(t *testing.T) {
+		updated, err := d.Redrive(ctx, parked.ID)
+		assert.ErrorIs(t, err, ErrRedriveFailed)
+		require.NotNil(t, updated)
+		assert.Equal(t, 4, updated.Attempts)
+		eventuallyParked(t, d.store, 1)
+	})
+
+	t.Run("re-drive after a fix", func(t *testing.T) {
+		handler.Fix()
+		redriven, err := d.Redrive(ctx, parked.ID)
+		require.NoError(t, err)
+		assert.Equal(t, parked.ID, redriven.ID)
+		assert.Equal(t, []string{"charge"}, handler.Handled())
+
+		_, err = d.Get(ctx, parked.ID)
+		assert.ErrorIs(t, err, ErrParkedEventNotFound)
+	})
+
+	t.Run("unknown handler", func(t *testing.T) {
+		require.NoError(t, d.store.Park(ctx, &ParkedEvent{ID: "orphan", Handler: "removed", Payload: "{}"}))
+		_, err := d.Redrive(ctx, "orphan")
+		assert.ErrorIs(t, err, ErrHandlerNotFound)
+	})
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d := newTestDispatcher(t, SkipAndContinue)
+	handler := newPoisonHandler("charge")
+	consumer := d.Wrap("billing", handler)
+	consumer.Enqueue(stepEvent(uuid.New(), "charge"))
+	consumer.Enqueue(stepEvent(uuid.New(), "charge"))
+	eventuallyParked(t, d.store, 2)
+
+	router := gin.New()
+	NewHandlers(d.Dispatcher).RegisterRoutes(router.Group("/api"))
+	request := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/api/v1/parked-events?handler=billing")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parked []*ParkedEvent
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &parked))
+	require.Len(t, parked, 2)
+
+	rec = request(http.MethodGet, "/api/v1/parked-events/"+parked[0].ID)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	t.Run("re-drive", func(t *testing.T) {
+		rec := request(http.MethodPost, "/api/v1/parked-events/"+parked[0].ID+"/redrive")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		handler.Fix()
+		rec = request(http.MethodPost, "/api/v1/parked-events/"+parked[0].ID+"/redrive")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		rec := request(http.MethodDelete, "/api/v1/parked-events/"+parked[1].ID)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = request(http.MethodDelete, "/api/v1/parked-events/"+parked[1].ID)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	rec = request(http.MethodGet, "/api/v1/parked-events")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+}
+
+func newAcknowledgedDispatcher(t *testing.T, store *MemoryStore, metrics MetricsRecorder) *Dispatcher {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	dispatcher := NewDispatcher(Config{
+		MaxAttempts:     1000,
+		RetryBackoff:    time.Millisecond,
+		MaxRetryBackoff: 2 * time.Millisecond,
+		Acknowledged:    []string{"billing", "webhook:*"},
+	}, store, metrics, nil, logger)
+	dispatcher.SetJournal(store)
+	t.Cleanup(dispatcher.Stop)
+	return dispatcher
+}
+
+// eventuallyPending waits for the number of journaled events of a handler
+func eventuallyPending(t *testing.T, store *MemoryStore, handler string, count int) []*PendingEvent {
+	var pending []*PendingEvent
+	require.Eventually(t, func() bool {
+		var err error
+		pending, err = store.Pending(context.Background(), handler)
+		return err == nil && len(pending) == count
+	}, 5*time.Second, time.Millisecond)
+	return pending
+}
+
+func TestAcknowledgedDelivery(t *testing.T) {
+	t.Run("events are delivered in order and acknowledged", func(t *testing.T) {
+		store := NewMemoryStore()
+		d := newAcknowledgedDispatcher(t, store, nil)
+		billing := newPoisonHandler("")
+		audit := newPoisonHandler("")
+		webhook := newPoisonHandler("")
+		consumers := []*Consumer{d.Wrap("billing", billing), d.Wrap("audit", audit), d.Wrap("webhook:https://example.com", webhook)}
+
+		executionID := uuid.New()
+		var steps []string
+		for i := 0; i < 50; i++ {
+			step := fmt.Sprintf("step-%d", i)
+			steps = append(steps, step)
+			for _, consumer := range consumers {
+				consumer.Enqueue(stepEvent(executionID, step))
+			}
+		}
+
+		for _, handler := range []*poisonHandler{billing, audit, webhook} {
+			require.Eventually(t, func() bool { return len(handler.Handled()) == len(steps) }, 5*time.Second, time.Millisecond)
+			assert.Equal(t, steps, handler.Handled())
+		}
+		eventuallyPending(t, store, "billing", 0)
+		eventuallyPending(t, store, "webhook:https://example.com", 0)
+		assert.True(t, consumers[0].acknowledged)
+		assert.False(t, consumers[1].acknowledged, "handlers not listed are delivered at most once")
+		assert.True(t, consumers[2].acknowledged)
+	})
+
+	t.Run("events are redelivered after a crash", func(t *testing.T) {
+		ctx := context.Background()
+		store := NewMemoryStore()
+		crashed := newAcknowledgedDispatcher(t, store, nil)
+		failing := newPoisonHandler("charge")
+		consumer := crashed.Wrap("billing", failing)
+
+		executionID := uuid.New()
+		for _, stepID := range []string{"reserve", "charge", "ship", "notify"} {
+			consumer.Enqueue(stepEvent(executionID, stepID))
+		}
+		require.Eventually(t, func() bool { return failing.Attempts("charge") >= 2 }, 5*time.Second, time.Millisecond)
+		crashed.Stop()
+
+		assert.Equal(t, []string{"reserve"}, failing.Handled())
+		pending := eventuallyPending(t, store, "billing", 3)
+		var stepIDs []string
+		for _, entry := range pending {
+			var event engine.WorkflowEvent
+			require.NoError(t, json.Unmarshal([]byte(entry.Payload), &event))
+			stepIDs = append(stepIDs, event.StepID)
+			assert.Equal(t, executionID.String(), entry.OrderingKey)
+		}
+		assert.Equal(t, []string{"charge", "ship", "notify"}, stepIDs, "the events after the failed one are left for redelivery")
+
+		metrics := &recordingMetrics{}
+		restarted := newAcknowledgedDispatcher(t, store, metrics)
+		recovering := newPoisonHandler("")
+		consumer = restarted.Wrap("billing", recovering)
+
+		recovered, err := restarted.Recover(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, recovered)
+		consumer.Enqueue(stepEvent(executionID, "archive"))
+
+		require.Eventually(t, func() bool { return len(recovering.Handled()) == 4 }, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"charge", "ship", "notify", "archive"}, recovering.Handled())
+		eventuallyPending(t, store, "billing", 0)
+		assert.Equal(t, []map[string]string{{"handler": "billing"}}, metrics.Recorded("event_deliveries_recovered_total"))
+	})
+
+	t.Run("parked events are acknowledged", func(t *testing.T) {
+		store := NewMemoryStore()
+		logger := logrus.New()
+		logger.SetOutput(io.Discard)
+		d := NewDispatcher(Config{
+			MaxAttempts:     2,
+			RetryBackoff:    time.Millisecond,
+			MaxRetryBackoff: time.Millisecond,
+			Acknowledged:    []string{"billing"},
+		}, store, nil, nil, logger)
+		d.SetJournal(store)
+		t.Cleanup(d.Stop)
+
+		d.Wrap("billing", newPoisonHandler("charge")).Enqueue(stepEvent(uuid.New(), "charge"))
+		eventuallyParked(t, store, 1)
+		eventuallyPending(t, store, "billing", 0)
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	event := stepEvent(uuid.New(), "charge")
+	assert.Empty(t, event.IdempotencyKey())
+
+	event.Sequence = 7
+	assert.Equal(t, event.ExecutionID.String()+":7", event.IdempotencyKey())
+}
+
+// slowHandler blocks every delivery until it is released
+type slowHandler struct {
+	started chan string
+	release chan struct{}
+
+	mu      sync.Mutex
+	handled []string
+}
+
+func newSlowHandler() *slowHandler {
+	return &slowHandler{started: make(chan string, 100), release: make(chan struct{})}
+}
+
+func (h *slowHandler) Handle(event *engine.WorkflowEvent) error {
+	h.started <- event.StepID
+	<-h.release
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handled = append(h.handled, event.StepID)
+	return nil
+}
+
+func (h *slowHandler) GetEventTypes() []string {
+	return []string{"step.completed"}
+}
+
+func (h *slowHandler) Handled() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.handled...)
+}
+
+// waitStarted waits for the handler to start delivering an event
+func (h *slowHandler) waitStarted(t *testing.T, stepID string) {
+	t.Helper()
+	select {
+	case started := <-h.started:
+		require.Equal(t, stepID, started)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s was not delivered", stepID)
+	}
+}
+
+func newBufferedDispatcher(t *testing.T, config Config) *testDispatcher {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	store := NewMemoryStore()
+	metrics := &recordingMetrics{}
+	config.RetryBackoff = time.Millisecond
+	dispatcher := NewDispatcher(config, store, metrics, nil, logger)
+	t.Cleanup(dispatcher.Stop)
+	return &testDispatcher{Dispatcher: dispatcher, store: store, metrics: metrics}
+}
+
+func TestBackpressure(t *testing.T) {
+	for name, tt := range map[string]struct {
+		policy  OverflowPolicy
+		handled []string
+	}{
+		"drop-newest keeps the queued events": {OverflowDropNewest, []string{"reserve", "charge"}},
+		"drop-oldest keeps the latest events": {OverflowDropOldest, []string{"reserve", "notify"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := newBufferedDispatcher(t, Config{BufferSize: 2, OverflowPolicy: tt.policy})
+			handler := newSlowHandler()
+			consumer := d.Wrap("billing", handler)
+
+			executionID := uuid.New()
+			consumer.Enqueue(stepEvent(executionID, "reserve"))
+			handler.waitStarted(t, "reserve")
+			for _, stepID := range []string{"charge", "ship", "notify"} {
+				consumer.Enqueue(stepEvent(executionID, stepID))
+			}
+			assert.Equal(t, 2, consumer.Buffered(), "the event being delivered counts against the buffer")
+
+			close(handler.release)
+			require.Eventually(t, func() bool { return consumer.Buffered() == 0 }, 5*time.Second, time.Millisecond)
+			assert.Equal(t, tt.handled, handler.Handled())
+			dropped := map[string]string{"handler": "billing", "reason": string(tt.policy)}
+			assert.Equal(t, []map[string]string{dropped, dropped}, d.metrics.Recorded("event_deliveries_dropped_total"))
+		})
+	}
+
+	t.Run("drop-oldest never drops the event being delivered", func(t *testing.T) {
+		d := newBufferedDispatcher(t, Config{BufferSize: 1, OverflowPolicy: OverflowDropOldest})
+		handler := newSlowHandler()
+		consumer := d.Wrap("billing", handler)
+
+		consumer.Enqueue(stepEvent(uuid.New(), "reserve"))
+		handler.waitStarted(t, "reserve")
+		consumer.Enqueue(stepEvent(uuid.New(), "charge"))
+
+		close(handler.release)
+		require.Eventually(t, func() bool { return consumer.Buffered() == 0 }, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"reserve"}, handler.Handled())
+		assert.Len(t, d.metrics.Recorded("event_deliveries_dropped_total"), 1)
+	})
+
+	t.Run("block waits for room", func(t *testing.T) {
+		d := newBufferedDispatcher(t, Config{BufferSize: 1, OverflowPolicy: OverflowBlock})
+		handler := newSlowHandler()
+		consumer := d.Wrap("billing", handler)
+
+		executionID := uuid.New()
+		consumer.Enqueue(stepEvent(executionID, "reserve"))
+		handler.waitStarted(t, "reserve")
+
+		enqueued := make(chan struct{})
+		go func() {
+			consumer.Enqueue(stepEvent(executionID, "charge"))
+			close(enqueued)
+		}()
+		assert.Never(t, func() bool {
+			select {
+			case <-enqueued:
+				return true
+			default:
+				return false
+			}
+		}, 50*time.Millisecond, time.Millisecond, "Enqueue must block while the buffer is full")
+
+		close(handler.release)
+		require.Eventually(t, func() bool { return len(handler.Handled()) == 2 }, 5*time.Second, time.Millisecond)
+		<-enqueued
+		assert.Equal(t, []string{"reserve", "charge"}, handler.Handled())
+		assert.Empty(t, d.metrics.Recorded("event_deliveries_dropped_total"))
+	})
+
+	t.Run("block drops the waiting events on stop", func(t *testing.T) {
+		d := newBufferedDispatcher(t, Config{BufferSize: 1, OverflowPolicy: OverflowBlock})
+		handler := newSlowHandler()
+		consumer := d.Wrap("billing", handler)
+
+		consumer.Enqueue(stepEvent(uuid.New(), "reserve"))
+		handler.waitStarted(t, "reserve")
+		enqueued := make(chan struct{})
+		go func() {
+			consumer.Enqueue(stepEvent(uuid.New(), "charge"))
+			close(enqueued)
+		}()
+
+		stopped := make(chan struct{})
+		go func() {
+			d.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-enqueued:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Enqueue still blocked after stop")
+		}
+		assert.Equal(t, []map[string]string{{"handler": "billing", "reason": "shutdown"}}, d.metrics.Recorded("event_deliveries_dropped_total"))
+
+		close(handler.release)
+		<-stopped
+		assert.Equal(t, []string{"reserve"}, handler.Handled())
+	})
+
+	t.Run("block does not wait for held executions", func(t *testing.T) {
+		d := newBufferedDispatcher(t, Config{BufferSize: 2, OverflowPolicy: OverflowBlock, OrderingPolicy: HoldOrder, MaxAttempts: 2})
+		handler := newPoisonHandler("charge")
+		consumer := d.Wrap("billing", handler)
+
+		executionID := uuid.New()
+		for _, stepID := range []string{"charge", "ship", "notify"} {
+			consumer.Enqueue(stepEvent(executionID, stepID))
+		}
+		parked := eventuallyParked(t, d.store, 1)[0]
+
+		// ship and notify fill the buffer but wait for the parked event
+		enqueued := make(chan struct{})
+		go func() {
+			other := uuid.New()
+			for _, stepID := range []string{"reserve", "pack", "label"} {
+				consumer.Enqueue(stepEvent(other, stepID))
+			}
+			close(enqueued)
+		}()
+		select {
+		case <-enqueued:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Enqueue blocked by the held execution")
+		}
+		require.Eventually(t, func() bool { return len(handler.Handled()) == 3 }, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"reserve", "pack", "label"}, handler.Handled())
+		assert.Equal(t, 2, consumer.Buffered(), "the held events stay buffered")
+
+		handler.Fix()
+		_, err := d.Redrive(context.Background(), parked.ID)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return len(handler.Handled()) == 6 }, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"reserve", "pack", "label", "charge", "ship", "notify"}, handler.Handled())
+		assert.Empty(t, d.metrics.Recorded("event_deliveries_dropped_total"))
+	})
+
+	t.Run("handler buffers", func(t *testing.T) {
+		d := newBufferedDispatcher(t, Config{
+			OverflowPolicy: OverflowBlock,
+			Buffers: []BufferConfig{
+				{Handler: "webhook:*", Size: 5, OverflowPolicy: OverflowDropOldest},
+				{Handler: "webhook:https://example.com", Size: 1},
+				{Handler: "analytics", OverflowPolicy: OverflowDropNewest},
+			},
+		})
+
+		webhook := d.Wrap("webhook:https://example.com", newPoisonHandler(""))
+		assert.Equal(t, 5, webhook.bufferSize, "the first matching buffer applies")
+		assert.Equal(t, OverflowDropOldest, webhook.overflow)
+
+		analytics := d.Wrap("analytics", newPoisonHandler(""))
+		assert.Equal(t, DefaultBufferSize, analytics.bufferSize)
+		assert.Equal(t, OverflowDropNewest, analytics.overflow)
+
+		billing := d.Wrap("billing", newPoisonHandler(""))
+		assert.Equal(t, DefaultBufferSize, billing.bufferSize)
+		assert.Equal(t, OverflowBlock, billing.overflow)
+	})
+
+	t.Run("dropped events of acknowledged handlers stay journaled", func(t *testing.T) {
+		d := newBufferedDispatcher(t, Config{BufferSize: 1, OverflowPolicy: OverflowDropNewest, Acknowledged: []string{"billing"}})
+		d.SetJournal(d.store)
+		handler := newSlowHandler()
+		consumer := d.Wrap("billing", handler)
+
+		executionID := uuid.New()
+		consumer.Enqueue(stepEvent(executionID, "reserve"))
+		handler.waitStarted(t, "reserve")
+		consumer.Enqueue(stepEvent(executionID, "charge"))
+
+		close(handler.release)
+		pending := eventuallyPending(t, d.store, "billing", 1)
+		var event engine.WorkflowEvent
+		require.NoError(t, json.Unmarshal([]byte(pending[0].Payload), &event))
+		assert.Equal(t, "charge", event.StepID)
+		assert.Equal(t, []string{"reserve"}, handler.Handled())
+	})
+}
@@ -0,0 +1,729 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/pkg/models"
+)
+
+var (
+	// ErrHandlerNotFound is returned when a parked event belongs to a handler
+	// that is not registered with the dispatcher
+	ErrHandlerNotFound = errors.New("event handler not found")
+	// ErrRedriveFailed is returned when the handler fails a re-driven event
+	ErrRedriveFailed = errors.New("re-driven event failed")
+)
+
+// OrderingPolicy decides what happens to the later events of an execution
+// while one of its events is parked
+type OrderingPolicy string
+
+const (
+	// HoldOrder holds the later events of the execution until the parked
+	// event is re-driven or discarded
+	HoldOrder OrderingPolicy = "hold-order"
+	// SkipAndContinue delivers the later events of the execution, so a
+	// poison event does not stall its remaining notifications
+	SkipAndContinue OrderingPolicy = "skip-and-continue"
+)
+
+// MetricsRecorder records delivery metrics. It is satisfied by the engine
+// metrics collector.
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// Notifier tells operators about parked events
+type Notifier interface {
+	EventParked(ctx context.Context, event *ParkedEvent)
+}
+
+// Config configures the dispatcher
+type Config struct {
+	// MaxAttempts is the number of times a handler is given an event before
+	// the event is parked
+	MaxAttempts int
+	// RetryBackoff is the delay after the first failed attempt, doubled
+	// after each further failure
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps the delay between attempts
+	MaxRetryBackoff time.Duration
+	// OrderingPolicy applies to the execution of a parked event
+	OrderingPolicy OrderingPolicy
+	// Acknowledged names the handlers events are delivered to at least
+	// once. A name ending in * matches the handlers it prefixes.
+	Acknowledged []string
+	// BufferSize bounds the events of each handler that are queued or being
+	// delivered
+	BufferSize int
+	// OverflowPolicy applies to the events of a handler whose buffer is full
+	OverflowPolicy OverflowPolicy
+	// Buffers override the buffer size and overflow policy of the handlers
+	// they name, the first matching one applying
+	Buffers []BufferConfig
+}
+
+// DefaultConfig returns the default dispatcher configuration
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:     5,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: time.Minute,
+		OrderingPolicy:  SkipAndContinue,
+		BufferSize:      DefaultBufferSize,
+		OverflowPolicy:  OverflowBlock,
+	}
+}
+
+// Dispatcher delivers engine events to handlers through per-handler queues.
+// Events of an execution are delivered to a handler in the order the engine
+// emitted them, while executions do not wait for each other. Failed
+// deliveries are retried and events failing MaxAttempts times are parked
+// instead of blocking the queue. The queue of each handler is bounded, so a
+// handler that cannot keep up slows the engine down or loses events, as its
+// overflow policy says, instead of exhausting memory.
+//
+// Events queued for acknowledged handlers are journaled until the handler
+// processes them or they are parked, so the events a stopped or crashed
+// server had not delivered are delivered by Recover after a restart.
+type Dispatcher struct {
+	config   Config
+	store    Store
+	journal  Journal
+	metrics  MetricsRecorder
+	notifier Notifier
+	logger   *logrus.Logger
+	now      func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.RWMutex
+	consumers map[string]*Consumer
+}
+
+// NewDispatcher creates an event dispatcher. notifier may be nil.
+func NewDispatcher(config Config, store Store, metrics MetricsRecorder, notifier Notifier, logger *logrus.Logger) *Dispatcher {
+	defaults := DefaultConfig()
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaults.RetryBackoff
+	}
+	if config.MaxRetryBackoff < config.RetryBackoff {
+		config.MaxRetryBackoff = config.RetryBackoff
+	}
+	if config.OrderingPolicy == "" {
+		config.OrderingPolicy = defaults.OrderingPolicy
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaults.BufferSize
+	}
+	if config.OverflowPolicy == "" {
+		config.OverflowPolicy = defaults.OverflowPolicy
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		config:    config,
+		store:     store,
+		metrics:   metrics,
+		notifier:  notifier,
+		logger:    logger,
+		now:       time.Now,
+		ctx:       ctx,
+		cancel:    cancel,
+		consumers: make(map[string]*Consumer),
+	}
+}
+
+// SetJournal sets the journal of the events queued for acknowledged
+// handlers. Without a journal every handler receives events at most once.
+// It must be called before events are enqueued.
+func (d *Dispatcher) SetJournal(journal Journal) {
+	d.journal = journal
+}
+
+// Wrap returns an engine event handler delivering events to handler through
+// the dispatcher. name identifies the handler in parked events and must be
+// unique and stable across restarts, Wrap panics on a duplicate name.
+func (d *Dispatcher) Wrap(name string, handler engine.EventHandler) *Consumer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.consumers[name]; exists {
+		panic(fmt.Sprintf("delivery: duplicate event handler %s", name))
+	}
+
+	eventTypes := make(map[string]bool)
+	for _, eventType := range handler.GetEventTypes() {
+		eventTypes[eventType] = true
+	}
+
+	consumer := &Consumer{
+		name:         name,
+		handler:      handler,
+		eventTypes:   eventTypes,
+		acknowledged: d.acknowledges(name),
+		dispatcher:   d,
+		lanes:        make(map[string]*lane),
+	}
+	consumer.bufferSize, consumer.overflow = d.buffer(name)
+	consumer.room = sync.NewCond(&consumer.mu)
+	d.consumers[name] = consumer
+	return consumer
+}
+
+// WrapWebhooks returns a webhook event handler per webhook, so delivery
+// attempts and parked events are tracked per subscription. Handlers are
+// named after the webhook URL, numbered when several webhooks share a URL.
+func (d *Dispatcher) WrapWebhooks(webhooks []models.Webhook, logger *logrus.Logger) []*Consumer {
+	consumers := make([]*Consumer, 0, len(webhooks))
+	seen := make(map[string]int)
+	for _, webhook := range webhooks {
+		name := "webhook:" + webhook.URL
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s#%d", name, seen[name])
+		}
+		consumers = append(consumers, d.Wrap(name, engine.NewWebhookEventHandler([]models.Webhook{webhook}, logger)))
+	}
+	return consumers
+}
+
+// Stop stops retrying deliveries and waits for the queued events to be
+// drained. Events still failing are dropped, not parked; those of
+// acknowledged handlers stay journaled with the later events of their
+// execution, and are delivered by Recover after a restart.
+func (d *Dispatcher) Stop() {
+	d.cancel()
+
+	// Wake the callers waiting for room in a full buffer, their events
+	// are dropped
+	d.mu.RLock()
+	for _, consumer := range d.consumers {
+		consumer.mu.Lock()
+		consumer.room.Broadcast()
+		consumer.mu.Unlock()
+	}
+	d.mu.RUnlock()
+
+	d.wg.Wait()
+}
+
+// Recover queues the journaled events of the acknowledged handlers again,
+// in the order they were first enqueued, and returns their number. It must
+// be called once the handlers are wrapped and before the engine emits
+// events, so recovered events are delivered before the new events of their
+// execution. A handler may receive an event it processed just before the
+// server stopped once more, with the same IdempotencyKey.
+func (d *Dispatcher) Recover(ctx context.Context) (int, error) {
+	if d.journal == nil {
+		return 0, nil
+	}
+
+	d.mu.RLock()
+	consumers := make([]*Consumer, 0, len(d.consumers))
+	for _, consumer := range d.consumers {
+		if consumer.acknowledged {
+			consumers = append(consumers, consumer)
+		}
+	}
+	d.mu.RUnlock()
+
+	recovered := 0
+	for _, consumer := range consumers {
+		pending, err := d.journal.Pending(ctx, consumer.name)
+		if err != nil {
+			return recovered, fmt.Errorf("failed to list the pending events of %s: %w", consumer.name, err)
+		}
+
+		for _, entry := range pending {
+			var event engine.WorkflowEvent
+			if err := json.Unmarshal([]byte(entry.Payload), &event); err != nil {
+				d.logger.WithError(err).WithFields(logrus.Fields{
+					"handler":    consumer.name,
+					"event_type": entry.EventType,
+					"position":   entry.Position,
+				}).Error("Failed to decode pending event, event dropped")
+				consumer.ack(entry.Position)
+				continue
+			}
+			consumer.push(&queued{event: &event, position: entry.Position})
+			recovered++
+		}
+
+		if len(pending) > 0 && d.metrics != nil {
+			d.metrics.RecordMetric("event_deliveries_recovered_total", float64(len(pending)), map[string]string{
+				"handler": consumer.name,
+			})
+		}
+	}
+	return recovered, nil
+}
+
+// List returns the parked events of a handler, or of all handlers when
+// handler is empty
+func (d *Dispatcher) List(ctx context.Context, handler string) ([]*ParkedEvent, error) {
+	return d.store.List(ctx, handler)
+}
+
+// Get returns a parked event
+func (d *Dispatcher) Get(ctx context.Context, id string) (*ParkedEvent, error) {
+	return d.store.Get(ctx, id)
+}
+
+// Redrive gives a parked event to its handler once more. When the handler
+// succeeds the event is removed and the execution's held events, if any, are
+// delivered. When it fails the attempt is recorded, the event stays parked
+// and ErrRedriveFailed is returned with the updated event.
+func (d *Dispatcher) Redrive(ctx context.Context, id string) (*ParkedEvent, error) {
+	parked, err := d.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer := d.consumer(parked.Handler)
+	if consumer == nil {
+		return nil, fmt.Errorf("%w: %s", ErrHandlerNotFound, parked.Handler)
+	}
+
+	var event engine.WorkflowEvent
+	if err := json.Unmarshal([]byte(parked.Payload), &event); err != nil {
+		return nil, fmt.Errorf("failed to decode parked event %s: %w", id, err)
+	}
+
+	if err := consumer.handler.Handle(&event); err != nil {
+		updated, recordErr := d.store.RecordAttempt(ctx, id, err.Error(), d.now())
+		if recordErr != nil {
+			return nil, recordErr
+		}
+		return updated, fmt.Errorf("%w: %v", ErrRedriveFailed, err)
+	}
+
+	if err := d.store.Delete(ctx, id); err != nil && !errors.Is(err, ErrParkedEventNotFound) {
+		return nil, err
+	}
+	consumer.release(parked.OrderingKey, id)
+
+	d.logger.WithFields(logrus.Fields{
+		"parked_event_id": id,
+		"handler":         parked.Handler,
+		"event_type":      parked.EventType,
+		"execution_id":    parked.ExecutionID,
+	}).Info("Parked event re-driven")
+
+	return parked, nil
+}
+
+// Discard removes a parked event without delivering it and releases the
+// execution's held events, if any
+func (d *Dispatcher) Discard(ctx context.Context, id string) error {
+	parked, err := d.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := d.store.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if consumer := d.consumer(parked.Handler); consumer != nil {
+		consumer.release(parked.OrderingKey, id)
+	}
+
+	d.logger.WithFields(logrus.Fields{
+		"parked_event_id": id,
+		"handler":         parked.Handler,
+		"event_type":      parked.EventType,
+		"execution_id":    parked.ExecutionID,
+	}).Warn("Parked event discarded")
+
+	return nil
+}
+
+func (d *Dispatcher) consumer(name string) *Consumer {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.consumers[name]
+}
+
+// acknowledges reports whether a handler receives events at least once
+func (d *Dispatcher) acknowledges(name string) bool {
+	for _, pattern := range d.config.Acknowledged {
+		if matchHandler(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHandler reports whether a handler name matches a pattern, a name or
+// a prefix followed by *
+func matchHandler(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return pattern == name
+}
+
+// backoff returns the delay after the given failed attempt
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.config.RetryBackoff
+	for i := 1; i < attempt && delay < d.config.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.config.MaxRetryBackoff {
+		delay = d.config.MaxRetryBackoff
+	}
+	return delay
+}
+
+// Consumer is an engine event handler queueing events for a wrapped handler.
+// It implements engine.QueuedEventHandler so the engine enqueues events in
+// emission order.
+type Consumer struct {
+	name       string
+	handler    engine.EventHandler
+	eventTypes map[string]bool
+	// acknowledged reports whether events are journaled until the handler
+	// processes them
+	acknowledged bool
+	dispatcher   *Dispatcher
+	// bufferSize bounds buffered, the events queued in lanes or being
+	// delivered less those of held lanes, and overflow applies when it is
+	// reached
+	bufferSize int
+	overflow   OverflowPolicy
+
+	mu       sync.Mutex
+	lanes    map[string]*lane
+	buffered int
+	// sequence numbers the events in the order they were buffered
+	sequence uint64
+	// room is signalled when an event leaves the buffer
+	room *sync.Cond
+}
+
+// queued is an event of a lane with its journal position, zero for events
+// that are not journaled
+type queued struct {
+	event    *engine.WorkflowEvent
+	position uint64
+	sequence uint64
+}
+
+// lane is the queue of the events of one ordering key
+type lane struct {
+	events  []*queued
+	running bool
+	// heldBy is the ID of the parked event holding the lane under HoldOrder
+	heldBy string
+}
+
+// Name returns the name of the handler
+func (c *Consumer) Name() string {
+	return c.name
+}
+
+// Enqueue queues an event for the wrapped handler. Events are ordered by
+// execution. Events of acknowledged handlers are journaled before they are
+// queued. When the buffer of the handler is full, Enqueue blocks until
+// there is room under OverflowBlock and drops an event otherwise.
+func (c *Consumer) Enqueue(event *engine.WorkflowEvent) {
+	if !c.eventTypes[event.Type] {
+		return
+	}
+	c.push(&queued{event: event, position: c.journal(event)})
+}
+
+// push queues an event in the lane of its execution
+func (c *Consumer) push(item *queued) {
+	key := item.event.ExecutionID.String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.reserve(item) {
+		return
+	}
+	l, exists := c.lanes[key]
+	if !exists {
+		l = &lane{}
+		c.lanes[key] = l
+	}
+	l.events = append(l.events, item)
+	c.start(key, l)
+}
+
+// journal appends an event of an acknowledged handler to the journal and
+// returns its position, zero when the event is not journaled
+func (c *Consumer) journal(event *engine.WorkflowEvent) uint64 {
+	d := c.dispatcher
+	if !c.acknowledged || d.journal == nil {
+		return 0
+	}
+
+	logger := d.logger.WithFields(logrus.Fields{
+		"handler":         c.name,
+		"event_type":      event.Type,
+		"execution_id":    event.ExecutionID,
+		correlation.Field: event.CorrelationID,
+	})
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.WithError(err).Error("Failed to encode event for the journal, delivering it at most once")
+		return 0
+	}
+
+	pending := &PendingEvent{
+		Handler:     c.name,
+		OrderingKey: event.ExecutionID.String(),
+		EventType:   event.Type,
+		ExecutionID: event.ExecutionID.String(),
+		Payload:     string(payload),
+		EnqueuedAt:  d.now(),
+	}
+	if err := d.journal.Append(context.Background(), pending); err != nil {
+		logger.WithError(err).Error("Failed to journal event, delivering it at most once")
+		return 0
+	}
+	return pending.Position
+}
+
+// ack removes a processed event from the journal. Events whose
+// acknowledgement fails are delivered again after a restart.
+func (c *Consumer) ack(position uint64) {
+	if err := c.dispatcher.journal.Ack(context.Background(), position); err != nil {
+		c.dispatcher.logger.WithError(err).WithFields(logrus.Fields{
+			"handler":  c.name,
+			"position": position,
+		}).Warn("Failed to acknowledge event, it will be delivered again after a restart")
+	}
+}
+
+// Handle queues an event, for callers that do not enqueue
+func (c *Consumer) Handle(event *engine.WorkflowEvent) error {
+	c.Enqueue(event)
+	return nil
+}
+
+// GetEventTypes returns the event types of the wrapped handler
+func (c *Consumer) GetEventTypes() []string {
+	return c.handler.GetEventTypes()
+}
+
+// start drains a lane unless it is already drained or held. c.mu must be
+// held.
+func (c *Consumer) start(key string, l *lane) {
+	if l.running || l.heldBy != "" || len(l.events) == 0 {
+		return
+	}
+	l.running = true
+	c.dispatcher.wg.Add(1)
+	go c.drain(key, l)
+}
+
+// release lets a lane held by a parked event continue
+func (c *Consumer) release(key, parkedID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, exists := c.lanes[key]
+	if !exists || l.heldBy != parkedID {
+		return
+	}
+	l.heldBy = ""
+	if len(l.events) == 0 {
+		delete(c.lanes, key)
+		return
+	}
+	c.start(key, l)
+}
+
+// drain delivers the events of a lane one at a time
+func (c *Consumer) drain(key string, l *lane) {
+	defer c.dispatcher.wg.Done()
+
+	for {
+		c.mu.Lock()
+		if l.heldBy != "" || len(l.events) == 0 {
+			l.running = false
+			if l.heldBy == "" {
+				delete(c.lanes, key)
+			}
+			c.mu.Unlock()
+			return
+		}
+		item := l.events[0]
+		l.events = l.events[1:]
+		c.mu.Unlock()
+
+		settled := c.deliver(key, l, item.event)
+		c.free(1)
+		if item.position == 0 {
+			continue
+		}
+		if settled {
+			c.ack(item.position)
+			continue
+		}
+		if c.dispatcher.ctx.Err() != nil {
+			// The event was dropped during shutdown and stays journaled,
+			// leave the later events of the execution to be recovered
+			// after it
+			c.mu.Lock()
+			c.freeLocked(len(l.events))
+			l.events = nil
+			l.running = false
+			if l.heldBy == "" {
+				delete(c.lanes, key)
+			}
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// deliver gives an event to the handler until it succeeds or the event is
+// parked, and reports whether it did. Events dropped during shutdown or
+// because they could not be parked are not settled.
+func (c *Consumer) deliver(key string, l *lane, event *engine.WorkflowEvent) bool {
+	d := c.dispatcher
+	logger := d.logger.WithFields(logrus.Fields{
+		"handler":         c.name,
+		"event_type":      event.Type,
+		"execution_id":    event.ExecutionID,
+		correlation.Field: event.CorrelationID,
+	})
+
+	for attempt := 1; ; attempt++ {
+		err := c.handler.Handle(event)
+		if err == nil {
+			return true
+		}
+
+		if attempt >= d.config.MaxAttempts {
+			return c.park(key, l, event, attempt, err)
+		}
+
+		delay := d.backoff(attempt)
+		logger.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"error":   err.Error(),
+		}).Warnf("Event handler failed, retrying in %s", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-d.ctx.Done():
+			logger.WithError(err).Error("Event dropped during shutdown")
+			return false
+		}
+	}
+}
+
+// park moves an event to the parking area, holding the lane under
+// HoldOrder, and reports whether it did
+func (c *Consumer) park(key string, l *lane, event *engine.WorkflowEvent, attempts int, cause error) bool {
+	d := c.dispatcher
+	logger := d.logger.WithFields(logrus.Fields{
+		"handler":         c.name,
+		"event_type":      event.Type,
+		"execution_id":    event.ExecutionID,
+		correlation.Field: event.CorrelationID,
+	})
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.WithError(err).Error("Failed to encode event for parking, event dropped")
+		return false
+	}
+
+	now := d.now()
+	parked := &ParkedEvent{
+		ID:          uuid.New().String(),
+		Handler:     c.name,
+		OrderingKey: key,
+		EventType:   event.Type,
+		ExecutionID: event.ExecutionID.String(),
+		WorkflowID:  event.WorkflowID.String(),
+		Payload:     string(payload),
+		Attempts:    attempts,
+		LastError:   cause.Error(),
+		HoldsOrder:  d.config.OrderingPolicy == HoldOrder,
+		ParkedAt:    now,
+		UpdatedAt:   now,
+	}
+
+	// Hold the lane before the event can be re-driven from the store. Its
+	// events no longer count against the buffer.
+	if parked.HoldsOrder {
+		c.mu.Lock()
+		l.heldBy = parked.ID
+		c.room.Broadcast()
+		c.mu.Unlock()
+	}
+
+	if err := d.store.Park(d.ctx, parked); err != nil {
+		logger.WithError(err).Error("Failed to park event, event dropped")
+		if parked.HoldsOrder {
+			c.mu.Lock()
+			l.heldBy = ""
+			c.mu.Unlock()
+		}
+		return false
+	}
+
+	if d.metrics != nil {
+		d.metrics.RecordMetric("event_deliveries_parked_total", 1, map[string]string{
+			"handler":    c.name,
+			"event_type": event.Type,
+		})
+	}
+	if d.notifier != nil {
+		d.notifier.EventParked(d.ctx, parked)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"parked_event_id": parked.ID,
+		"attempts":        attempts,
+		"error":           cause.Error(),
+		"holds_order":     parked.HoldsOrder,
+	}).Error("Event parked after repeated handler failures")
+	return true
+}
+
+// LogNotifier notifies operators of parked events through the log
+type LogNotifier struct {
+	logger *logrus.Logger
+}
+
+// NewLogNotifier creates a notifier logging parked events as warnings
+func NewLogNotifier(logger *logrus.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// EventParked logs a parked event
+func (n *LogNotifier) EventParked(ctx context.Context, event *ParkedEvent) {
+	n.logger.WithFields(logrus.Fields{
+		"notification":    "event_parked",
+		"parked_event_id": event.ID,
+		"handler":         event.Handler,
+		"event_type":      event.EventType,
+		"execution_id":    event.ExecutionID,
+		"attempts":        event.Attempts,
+	}).Warnf("Event handler %s parked a %s event, inspect it at /api/v1/parked-events/%s", event.Handler, event.EventType, event.ID)
+}
@@ -0,0 +1,118 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers provides HTTP handlers for parked events
+type Handlers struct {
+	dispatcher *Dispatcher
+}
+
+// NewHandlers creates new parked event handlers
+func NewHandlers(dispatcher *Dispatcher) *Handlers {
+	return &Handlers{dispatcher: dispatcher}
+}
+
+// RegisterRoutes registers parked event routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		parked := v1.Group("/parked-events")
+		{
+			parked.GET("", h.ListParkedEvents)
+			parked.GET("/:id", h.GetParkedEvent)
+			parked.POST("/:id/redrive", h.RedriveParkedEvent)
+			parked.DELETE("/:id", h.DiscardParkedEvent)
+		}
+	}
+}
+
+// ListParkedEvents returns the parked events, optionally of one handler
+// @Summary List parked events
+// @Tags parked-events
+// @Produce json
+// @Param handler query string false "Event handler name"
+// @Success 200 {array} ParkedEvent
+// @Router /api/v1/parked-events [get]
+func (h *Handlers) ListParkedEvents(c *gin.Context) {
+	events, err := h.dispatcher.List(c.Request.Context(), c.Query("handler"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// GetParkedEvent returns a parked event
+// @Summary Get parked event
+// @Tags parked-events
+// @Produce json
+// @Param id path string true "Parked event ID"
+// @Success 200 {object} ParkedEvent
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/parked-events/{id} [get]
+func (h *Handlers) GetParkedEvent(c *gin.Context) {
+	event, err := h.dispatcher.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(parkedEventErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// RedriveParkedEvent gives a parked event to its handler once more. The
+// event is removed when the handler succeeds and stays parked otherwise.
+// @Summary Re-drive parked event
+// @Tags parked-events
+// @Produce json
+// @Param id path string true "Parked event ID"
+// @Success 200 {object} ParkedEvent
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/parked-events/{id}/redrive [post]
+func (h *Handlers) RedriveParkedEvent(c *gin.Context) {
+	event, err := h.dispatcher.Redrive(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, ErrRedriveFailed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "parked_event": event})
+		return
+	}
+	if err != nil {
+		c.JSON(parkedEventErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// DiscardParkedEvent removes a parked event without delivering it
+// @Summary Discard parked event
+// @Tags parked-events
+// @Param id path string true "Parked event ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/parked-events/{id} [delete]
+func (h *Handlers) DiscardParkedEvent(c *gin.Context) {
+	if err := h.dispatcher.Discard(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(parkedEventErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func parkedEventErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrParkedEventNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrHandlerNotFound):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
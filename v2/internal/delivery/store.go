@@ -0,0 +1,305 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrParkedEventNotFound is returned when a parked event does not exist
+var ErrParkedEventNotFound = errors.New("parked event not found")
+
+// ParkedEvent is an event a handler failed to process MaxAttempts times. It
+// stays parked until it is re-driven successfully or discarded.
+type ParkedEvent struct {
+	ID          string `json:"id" gorm:"primaryKey"`
+	Handler     string `json:"handler" gorm:"not null;index"`
+	OrderingKey string `json:"ordering_key" gorm:"index"`
+	EventType   string `json:"event_type" gorm:"not null"`
+	ExecutionID string `json:"execution_id" gorm:"index"`
+	WorkflowID  string `json:"workflow_id"`
+	// Payload is the JSON encoded engine event
+	Payload   string `json:"payload" gorm:"type:text;not null"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error" gorm:"type:text"`
+	// HoldsOrder reports whether later events of the ordering key wait for
+	// the parked event to be re-driven or discarded
+	HoldsOrder bool      `json:"holds_order"`
+	ParkedAt   time.Time `json:"parked_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the ParkedEvent model
+func (ParkedEvent) TableName() string {
+	return "parked_events"
+}
+
+// Store persists parked events
+type Store interface {
+	// Park stores a parked event
+	Park(ctx context.Context, event *ParkedEvent) error
+	// Get returns a parked event
+	Get(ctx context.Context, id string) (*ParkedEvent, error)
+	// List returns the parked events of a handler, or of all handlers when
+	// handler is empty, oldest first
+	List(ctx context.Context, handler string) ([]*ParkedEvent, error)
+	// RecordAttempt records a failed re-drive of a parked event
+	RecordAttempt(ctx context.Context, id, lastError string, now time.Time) (*ParkedEvent, error)
+	// Delete removes a parked event
+	Delete(ctx context.Context, id string) error
+}
+
+// PendingEvent is an event queued for an acknowledged handler. It is
+// journaled when the event is enqueued and removed once the handler
+// processed it or it was parked, so the events left when the server stops
+// are delivered again after a restart.
+type PendingEvent struct {
+	// Position orders the events of the journal in the order they were
+	// enqueued
+	Position    uint64 `json:"position" gorm:"primaryKey;autoIncrement"`
+	Handler     string `json:"handler" gorm:"not null;index"`
+	OrderingKey string `json:"ordering_key"`
+	EventType   string `json:"event_type" gorm:"not null"`
+	ExecutionID string `json:"execution_id"`
+	// Payload is the JSON encoded engine event
+	Payload    string    `json:"payload" gorm:"type:text;not null"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+// TableName returns the table name for the PendingEvent model
+func (PendingEvent) TableName() string {
+	return "pending_events"
+}
+
+// Journal persists the events queued for acknowledged handlers until they
+// are acknowledged
+type Journal interface {
+	// Append stores a pending event and sets its position
+	Append(ctx context.Context, event *PendingEvent) error
+	// Ack removes a pending event. Acknowledging an event twice is not an
+	// error.
+	Ack(ctx context.Context, position uint64) error
+	// Pending returns the pending events of a handler in position order
+	Pending(ctx context.Context, handler string) ([]*PendingEvent, error)
+}
+
+// MemoryStore is an in-memory Store and Journal
+type MemoryStore struct {
+	mu       sync.Mutex
+	events   map[string]*ParkedEvent
+	pending  map[uint64]*PendingEvent
+	position uint64
+}
+
+// NewMemoryStore creates an in-memory parked event store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		events:  make(map[string]*ParkedEvent),
+		pending: make(map[uint64]*PendingEvent),
+	}
+}
+
+// Park stores a parked event
+func (s *MemoryStore) Park(ctx context.Context, event *ParkedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parked := *event
+	s.events[event.ID] = &parked
+	return nil
+}
+
+// Get returns a parked event
+func (s *MemoryStore) Get(ctx context.Context, id string) (*ParkedEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, exists := s.events[id]
+	if !exists {
+		return nil, ErrParkedEventNotFound
+	}
+
+	found := *event
+	return &found, nil
+}
+
+// List returns the parked events of a handler, oldest first
+func (s *MemoryStore) List(ctx context.Context, handler string) ([]*ParkedEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]*ParkedEvent, 0, len(s.events))
+	for _, event := range s.events {
+		if handler == "" || event.Handler == handler {
+			parked := *event
+			events = append(events, &parked)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].ParkedAt.Equal(events[j].ParkedAt) {
+			return events[i].ParkedAt.Before(events[j].ParkedAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+// RecordAttempt records a failed re-drive of a parked event
+func (s *MemoryStore) RecordAttempt(ctx context.Context, id, lastError string, now time.Time) (*ParkedEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, exists := s.events[id]
+	if !exists {
+		return nil, ErrParkedEventNotFound
+	}
+
+	event.Attempts++
+	event.LastError = lastError
+	event.UpdatedAt = now
+	updated := *event
+	return &updated, nil
+}
+
+// Delete removes a parked event
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.events[id]; !exists {
+		return ErrParkedEventNotFound
+	}
+	delete(s.events, id)
+	return nil
+}
+
+// Append stores a pending event
+func (s *MemoryStore) Append(ctx context.Context, event *PendingEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.position++
+	event.Position = s.position
+	pending := *event
+	s.pending[event.Position] = &pending
+	return nil
+}
+
+// Ack removes a pending event
+func (s *MemoryStore) Ack(ctx context.Context, position uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, position)
+	return nil
+}
+
+// Pending returns the pending events of a handler in position order
+func (s *MemoryStore) Pending(ctx context.Context, handler string) ([]*PendingEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]*PendingEvent, 0)
+	for _, event := range s.pending {
+		if event.Handler == handler {
+			pending := *event
+			events = append(events, &pending)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Position < events[j].Position })
+	return events, nil
+}
+
+// GormStore is a Store and Journal backed by the application database
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database parked event store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the parked and pending events tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&ParkedEvent{}, &PendingEvent{})
+}
+
+// Park stores a parked event
+func (s *GormStore) Park(ctx context.Context, event *ParkedEvent) error {
+	return s.db.WithContext(ctx).Create(event).Error
+}
+
+// Get returns a parked event
+func (s *GormStore) Get(ctx context.Context, id string) (*ParkedEvent, error) {
+	var event ParkedEvent
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&event).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrParkedEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// List returns the parked events of a handler, oldest first
+func (s *GormStore) List(ctx context.Context, handler string) ([]*ParkedEvent, error) {
+	query := s.db.WithContext(ctx).Order("parked_at, id")
+	if handler != "" {
+		query = query.Where("handler = ?", handler)
+	}
+
+	var events []*ParkedEvent
+	err := query.Find(&events).Error
+	return events, err
+}
+
+// RecordAttempt records a failed re-drive of a parked event
+func (s *GormStore) RecordAttempt(ctx context.Context, id, lastError string, now time.Time) (*ParkedEvent, error) {
+	result := s.db.WithContext(ctx).Model(&ParkedEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": lastError,
+		"updated_at": now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrParkedEventNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+// Delete removes a parked event
+func (s *GormStore) Delete(ctx context.Context, id string) error {
+	result := s.db.WithContext(ctx).Where("id = ?", id).Delete(&ParkedEvent{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrParkedEventNotFound
+	}
+	return nil
+}
+
+// Append stores a pending event
+func (s *GormStore) Append(ctx context.Context, event *PendingEvent) error {
+	return s.db.WithContext(ctx).Create(event).Error
+}
+
+// Ack removes a pending event
+func (s *GormStore) Ack(ctx context.Context, position uint64) error {
+	return s.db.WithContext(ctx).Where("position = ?", position).Delete(&PendingEvent{}).Error
+}
+
+// Pending returns the pending events of a handler in position order
+func (s *GormStore) Pending(ctx context.Context, handler string) ([]*PendingEvent, error) {
+	var events []*PendingEvent
+	err := s.db.WithContext(ctx).Where("handler = ?", handler).Order("position").Find(&events).Error
+	return events, err
+}
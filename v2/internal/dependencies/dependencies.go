@@ -0,0 +1,124 @@
+// Package dependencies maintains the graph of the workflows depending on one
+// another across the organization. The edges of a workflow are extracted
+// from its definitions when its versions are created: the workflows its
+// sub-workflow steps start, the workflows its http steps execute through
+// the execute endpoint of this server, the workflows whose schemas its
+// schemas reference and the workflow it was created from. Webhook triggers
+// and schedules starting workflows are read from their sources when the
+// graph is traversed, so the impact of a change reaches them too.
+package dependencies
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrInvalidDirection is returned for directions other than upstream,
+// downstream and both
+var ErrInvalidDirection = errors.New("invalid dependency direction")
+
+// TemplateAnnotation is the definition annotation naming, by ID or name, the
+// workflow a definition was created from
+const TemplateAnnotation = "template"
+
+// Kind is how a workflow depends on another
+type Kind string
+
+const (
+	// KindSubWorkflow is a sub-workflow step starting the workflow
+	KindSubWorkflow Kind = "sub_workflow"
+	// KindHTTP is an http step calling the execute endpoint of the workflow
+	KindHTTP Kind = "http"
+	// KindSchema is a schema referencing a schema of the workflow
+	KindSchema Kind = "schema"
+	// KindTemplate is a definition created from the workflow
+	KindTemplate Kind = "template"
+)
+
+// Edge is a dependency of a workflow on another, extracted from the
+// definition of one of its versions
+type Edge struct {
+	ID uuid.UUID `json:"-" gorm:"type:uuid;primaryKey"`
+	// WorkflowID is the dependent workflow
+	WorkflowID uuid.UUID `json:"workflow_id" gorm:"type:uuid;not null;index"`
+	// VersionID is the version whose definition holds the reference, nil
+	// for the definition the workflow was created with
+	VersionID *uuid.UUID `json:"version_id,omitempty" gorm:"type:uuid;index"`
+	// DependsOn is the workflow depended on
+	DependsOn uuid.UUID `json:"depends_on" gorm:"type:uuid;not null;index"`
+	Kind      Kind      `json:"kind" gorm:"not null"`
+	// Path locates the reference in the definition, such as
+	// steps.charge or input_schema.customer
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the Edge model
+func (Edge) TableName() string {
+	return "workflow_dependencies"
+}
+
+// Source is a definition edges are extracted from, with the schemas of
+// its workflow or version
+type Source struct {
+	WorkflowID uuid.UUID
+	// VersionID is set for the definition of a version
+	VersionID    *uuid.UUID
+	Definition   *models.WorkflowDefinition
+	InputSchema  models.JSONSchema
+	OutputSchema models.JSONSchema
+}
+
+// WorkflowSource returns the source of the definition a workflow was
+// created with
+func WorkflowSource(workflow *models.Workflow) *Source {
+	return &Source{
+		WorkflowID:   workflow.ID,
+		Definition:   &workflow.Definition,
+		InputSchema:  workflow.InputSchema,
+		OutputSchema: workflow.OutputSchema,
+	}
+}
+
+// VersionSource returns the source of the definition of a version
+func VersionSource(version *models.WorkflowVersion) *Source {
+	return &Source{
+		WorkflowID:   version.WorkflowID,
+		VersionID:    &version.ID,
+		Definition:   &version.Definition,
+		InputSchema:  version.InputSchema,
+		OutputSchema: version.OutputSchema,
+	}
+}
+
+// Direction selects the side of a workflow a traversal follows
+type Direction string
+
+const (
+	// Upstream follows the workflows a workflow depends on
+	Upstream Direction = "upstream"
+	// Downstream follows the workflows depending on a workflow, those a
+	// change to it affects
+	Downstream Direction = "downstream"
+	Both       Direction = "both"
+)
+
+// Config configures the dependency graph
+type Config struct {
+	// ServerURLs are the base URLs this server is reached at. http steps
+	// calling the execute endpoint under one of them depend on the
+	// workflow they execute; with none, the endpoint path alone is
+	// matched.
+	ServerURLs []string
+	// MaxDepth bounds the depth of dependency traversals
+	MaxDepth int
+}
+
+// DefaultConfig returns the default dependency graph configuration
+func DefaultConfig() Config {
+	return Config{MaxDepth: 10}
+}
@@ -0,0 +1,380 @@
+package dependencies
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/internal/triggers"
+	"magic-flow/v2/pkg/models"
+)
+
+const serverURL = "https://flows.example.com"
+
+type workflowStore struct {
+	workflows map[uuid.UUID]*models.Workflow
+}
+
+func (s *workflowStore) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	if workflow, ok := s.workflows[id]; ok {
+		return workflow, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *workflowStore) GetByName(name string) (*models.Workflow, error) {
+	for _, workflow := range s.workflows {
+		if workflow.Name == name {
+			return workflow, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type scheduleList []*scheduler.Schedule
+
+func (l scheduleList) ListSchedules() []*scheduler.Schedule {
+	return l
+}
+
+func subWorkflowStep(name string, workflowID uuid.UUID) models.WorkflowStep {
+	return models.WorkflowStep{Name: name, Type: "sub_workflow", Config: map[string]interface{}{"workflow_id": workflowID.String()}}
+}
+
+func executeStep(name, baseURL string, workflowID uuid.UUID) models.WorkflowStep {
+	return models.WorkflowStep{Name: name, Type: "http", Config: map[string]interface{}{
+		"url":    baseURL + "/api/v1/executions/workflows/" + workflowID.String() + "/execute",
+		"method": "POST",
+	}}
+}
+
+func schemaRefTo(workflow string) models.JSONSchema {
+	return models.JSONSchema{Type: "object", Properties: map[string]interface{}{
+		"customer": map[string]interface{}{"$ref": "workflows/" + workflow + "/input_schema#/properties/customer"},
+	}}
+}
+
+// ids are the IDs of the workflows of the billing graph by name
+var ids = func() map[string]uuid.UUID {
+	ids := make(map[string]uuid.UUID)
+	for _, name := range []string{"billing", "checkout", "refunds", "invoice", "storefront", "reports", "ledger", "audit"} {
+		ids[name] = uuid.New()
+	}
+	return ids
+}()
+
+// newBillingGraph returns the graph of a web of workflows around billing:
+//
+//	checkout   -> billing    (sub_workflow)
+//	refunds    -> billing    (schema)
+//	invoice    -> billing    (template)
+//	storefront -> checkout   (http)
+//	reports    -> storefront (sub_workflow)
+//	ledger    <-> audit      (sub_workflow, http)
+//
+// reports and ledger run on enabled schedules, checkout on a disabled one,
+// and webhooks start storefront and audit.
+func newBillingGraph(t *testing.T) *Graph {
+	workflows := &workflowStore{workflows: make(map[uuid.UUID]*models.Workflow)}
+	graph := NewGraph(Config{ServerURLs: []string{serverURL}, MaxDepth: 10}, NewMemoryStore(), workflows, logrus.New())
+
+	add := func(name string, configure func(*models.Workflow), steps ...models.WorkflowStep) {
+		workflow := &models.Workflow{
+			ID:         ids[name],
+			Name:       name,
+			Definition: models.WorkflowDefinition{Spec: models.WorkflowSpec{Steps: steps}},
+		}
+		if configure != nil {
+			configure(workflow)
+		}
+		workflows.workflows[workflow.ID] = workflow
+		require.NoError(t, graph.RecordWorkflow(context.Background(), workflow))
+	}
+	add("billing", nil, executeStep("ping", "https://elsewhere.example.com", ids["checkout"]))
+	add("checkout", nil, subWorkflowStep("bill", ids["billing"]))
+	add("refunds", func(w *models.Workflow) { w.InputSchema = schemaRefTo("billing") })
+	add("invoice", func(w *models.Workflow) {
+		w.Definition.Metadata.Annotations = map[string]string{TemplateAnnotation: "billing"}
+	})
+	add("storefront", nil, executeStep("checkout", serverURL, ids["checkout"]))
+	add("reports", nil, subWorkflowStep("storefront", ids["storefront"]))
+	add("ledger", nil, subWorkflowStep("audit", ids["audit"]))
+	add("audit", nil, executeStep("post", serverURL, ids["ledger"]))
+
+	graph.SetSchedules(scheduleList{
+		{ID: uuid.New(), Name: "nightly-reports", WorkflowID: ids["reports"], Enabled: true},
+		{ID: uuid.New(), Name: "hourly-checkout", WorkflowID: ids["checkout"]},
+		{ID: uuid.New(), Name: "ledger-close", WorkflowID: ids["ledger"], Enabled: true},
+	})
+	graph.SetWebhooks([]*triggers.Trigger{
+		{Name: "shop-orders", WorkflowID: ids["storefront"]},
+		{Name: "bank-feed", WorkflowID: ids["audit"]},
+	})
+	return graph
+}
+
+func names(nodes []*Node) map[string]int {
+	depths := make(map[string]int, len(nodes))
+	for _, node := range nodes {
+		depths[node.Name] = node.Depth
+	}
+	return depths
+}
+
+func TestExtract(t *testing.T) {
+	graph := newBillingGraph(t)
+	workflowID := uuid.New()
+	workflow := &models.Workflow{
+		ID:   workflowID,
+		Name: "fulfilment",
+		Definition: models.WorkflowDefinition{
+			Metadata: models.WorkflowMetadata{Annotations: map[string]string{TemplateAnnotation: ids["checkout"].String()}},
+			Spec: models.WorkflowSpec{
+				OutputSchema: schemaRefTo("refunds"),
+				Steps: []models.WorkflowStep{
+					subWorkflowStep("bill", ids["billing"]),
+					executeStep("external", "https://elsewhere.example.com", ids["ledger"]),
+					{Name: "each", Type: "loop", Config: map[string]interface{}{
+						"steps": []interface{}{
+							map[string]interface{}{"name": "audit", "type": "http", "config": map[string]interface{}{
+								"url": serverURL + "/api/v1/executions/workflows/" + ids["audit"].String() + "/execute",
+							}},
+						},
+					}},
+				},
+			},
+		},
+		InputSchema: schemaRefTo("unknown"),
+	}
+
+	edges := graph.Extract(context.Background(), WorkflowSource(workflow))
+	type found struct {
+		dependsOn uuid.UUID
+		kind      Kind
+		path      string
+	}
+	var got []found
+	for _, edge := range edges {
+		assert.Equal(t, workflowID, edge.WorkflowID)
+		assert.Nil(t, edge.VersionID)
+		got = append(got, found{edge.DependsOn, edge.Kind, edge.Path})
+	}
+	assert.ElementsMatch(t, []found{
+		{ids["billing"], KindSubWorkflow, "steps.bill"},
+		{ids["audit"], KindHTTP, "steps.each.audit"},
+		{ids["refunds"], KindSchema, "spec.output_schema.customer"},
+		{ids["checkout"], KindTemplate, "metadata.annotations.template"},
+	}, got, "http steps calling other servers and references to unknown workflows are not dependencies")
+}
+
+func TestDependencies(t *testing.T) {
+	graph := newBillingGraph(t)
+	tests := map[string]struct {
+		workflow   string
+		direction  Direction
+		depth      int
+		reported   int
+		upstream   map[string]int
+		downstream map[string]int
+		truncated  bool
+	}{
+		"downstream":              {workflow: "billing", direction: Downstream, reported: 10, upstream: map[string]int{}, downstream: map[string]int{"checkout": 1, "refunds": 1, "invoice": 1, "storefront": 2, "reports": 3}},
+		"downstream to a depth":   {workflow: "billing", direction: Downstream, depth: 2, reported: 2, upstream: map[string]int{}, downstream: map[string]int{"checkout": 1, "refunds": 1, "invoice": 1, "storefront": 2}, truncated: true},
+		"upstream past max depth": {workflow: "reports", direction: Upstream, depth: 50, reported: 10, upstream: map[string]int{"storefront": 1, "checkout": 2, "billing": 3}, downstream: map[string]int{}},
+		"both directions":         {workflow: "checkout", depth: 1, reported: 1, upstream: map[string]int{"billing": 1}, downstream: map[string]int{"storefront": 1}, truncated: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			report, err := graph.Dependencies(context.Background(), ids[tt.workflow], tt.direction, tt.depth)
+			require.NoError(t, err)
+			assert.Equal(t, tt.workflow, report.Workflow.Name)
+			assert.Equal(t, tt.reported, report.Depth)
+			assert.Equal(t, tt.upstream, names(report.Upstream))
+			assert.Equal(t, tt.downstream, names(report.Downstream))
+			assert.Equal(t, tt.truncated, report.Truncated)
+		})
+	}
+
+	t.Run("nodes", func(t *testing.T) {
+		report, err := graph.Dependencies(context.Background(), ids["billing"], Downstream, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"checkout", "invoice", "refunds"}, []string{report.Downstream[0].Name, report.Downstream[1].Name, report.Downstream[2].Name}, "nodes are ordered by depth and name")
+
+		storefront := report.Downstream[3]
+		require.Len(t, storefront.Edges, 1)
+		assert.Equal(t, ids["checkout"], storefront.Edges[0].DependsOn)
+		assert.Equal(t, KindHTTP, storefront.Edges[0].Kind)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := graph.Dependencies(context.Background(), ids["billing"], "sideways", 0)
+		assert.ErrorIs(t, err, ErrInvalidDirection)
+		_, err = graph.Dependencies(context.Background(), uuid.New(), Both, 0)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestImpact(t *testing.T) {
+	graph := newBillingGraph(t)
+	ctx := context.Background()
+
+	impact, err := graph.Impact(ctx, ids["billing"])
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"checkout": 1, "refunds": 1, "invoice": 1, "storefront": 2, "reports": 3}, names(impact.Workflows))
+	require.Len(t, impact.Schedules, 2)
+	assert.Equal(t, "hourly-checkout", impact.Schedules[0].Name)
+	assert.Equal(t, "nightly-reports", impact.Schedules[1].Name)
+	require.Len(t, impact.Webhooks, 1)
+	assert.Equal(t, "shop-orders", impact.Webhooks[0].Name)
+	assert.Empty(t, impact.Cycles)
+
+	impact, err = graph.Impact(ctx, ids["ledger"])
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"audit": 1}, names(impact.Workflows))
+	require.Len(t, impact.Schedules, 1)
+	assert.Equal(t, "ledger-close", impact.Schedules[0].Name, "the schedules of the workflow itself are affected")
+	require.Len(t, impact.Webhooks, 1)
+	assert.Equal(t, "bank-feed", impact.Webhooks[0].Name)
+	require.Len(t, impact.Cycles, 1)
+
+	warnings, err := graph.DependentWarnings(ctx, ids["checkout"])
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"workflow storefront depends on checkout through its http reference at steps.checkout",
+		"workflow reports depends on checkout through workflow storefront",
+		"schedule hourly-checkout starts workflow checkout",
+		"schedule nightly-reports starts workflow reports",
+		"webhook trigger shop-orders starts workflow storefront",
+	}, warnings)
+}
+
+func TestCycles(t *testing.T) {
+	graph := newBillingGraph(t)
+	ctx := context.Background()
+
+	report, err := graph.Cycles(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Cycles, 1)
+	cycle := report.Cycles[0]
+	assert.Equal(t, []WorkflowRef{{ID: ids["audit"], Name: "audit"}, {ID: ids["ledger"], Name: "ledger"}}, cycle.Workflows)
+	assert.Len(t, cycle.Edges, 2)
+	assert.Equal(t, []string{"dependency cycle: audit (steps.post) -> ledger (steps.audit) -> audit"}, report.Warnings)
+
+	// A version of billing starting reports closes billing, checkout,
+	// storefront and reports into a cycle
+	version := &models.WorkflowVersion{
+		ID:         uuid.New(),
+		WorkflowID: ids["billing"],
+		Definition: models.WorkflowDefinition{Spec: models.WorkflowSpec{Steps: []models.WorkflowStep{subWorkflowStep("report", ids["reports"])}}},
+	}
+	warnings, err := graph.VersionCycles(ctx, version)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dependency cycle: billing (steps.report) -> reports (steps.storefront) -> storefront (steps.checkout) -> checkout (steps.bill) -> billing"}, warnings)
+
+	report, err = graph.Cycles(ctx)
+	require.NoError(t, err)
+	assert.Len(t, report.Cycles, 1, "checking a version does not record it")
+
+	require.NoError(t, graph.RecordVersion(ctx, version))
+	report, err = graph.Cycles(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Cycles, 2)
+	assert.Len(t, report.Cycles[1].Workflows, 4)
+
+	// A workflow starting itself is a cycle of its own
+	loop := &models.Workflow{ID: uuid.New(), Name: "retry"}
+	loop.Definition.Spec.Steps = []models.WorkflowStep{subWorkflowStep("again", loop.ID)}
+	warnings, err = graph.WorkflowCycles(ctx, loop)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dependency cycle: retry (steps.again) -> retry"}, warnings)
+
+	warnings, err = graph.WorkflowCycles(ctx, &models.Workflow{ID: uuid.New(), Name: "leaf"})
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+}
+
+func TestRecordVersions(t *testing.T) {
+	graph := newBillingGraph(t)
+	ctx := context.Background()
+
+	v1 := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: ids["invoice"]}
+	v1.Definition.Spec.Steps = []models.WorkflowStep{subWorkflowStep("refund", ids["refunds"])}
+	require.NoError(t, graph.RecordVersion(ctx, v1))
+	v2 := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: ids["invoice"]}
+	v2.Definition.Spec.Steps = []models.WorkflowStep{subWorkflowStep("refund", ids["refunds"])}
+	require.NoError(t, graph.RecordVersion(ctx, v2))
+
+	report, err := graph.Dependencies(ctx, ids["invoice"], Upstream, 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"billing": 1, "refunds": 1}, names(report.Upstream))
+	assert.Len(t, report.Upstream[1].Edges, 1, "versions making the same reference collapse into one edge")
+
+	// Recording a version again replaces its edges
+	v1.Definition.Spec.Steps = nil
+	require.NoError(t, graph.RecordVersion(ctx, v1))
+	v2.Definition.Spec.Steps = nil
+	require.NoError(t, graph.RecordVersion(ctx, v2))
+	report, err = graph.Dependencies(ctx, ids["invoice"], Upstream, 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"billing": 1}, names(report.Upstream))
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewHandlers(newBillingGraph(t)).RegisterRoutes(router.Group("/api"))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	billing := "/api/v1/workflows/" + ids["billing"].String()
+
+	rec := get(billing + "/dependencies?direction=downstream&depth=1")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var report Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, map[string]int{"checkout": 1, "refunds": 1, "invoice": 1}, names(report.Downstream))
+	assert.True(t, report.Truncated)
+
+	rec = get(billing + "/impact")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var impact Impact
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &impact))
+	assert.Len(t, impact.Workflows, 5)
+	assert.Len(t, impact.Schedules, 2)
+	assert.Len(t, impact.Webhooks, 1)
+
+	rec = get("/api/v1/dependencies/cycles")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var cycles CycleReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cycles))
+	assert.Len(t, cycles.Cycles, 1)
+
+	rejected := map[string]struct {
+		path string
+		code int
+	}{
+		"unknown direction":   {path: billing + "/dependencies?direction=sideways", code: http.StatusBadRequest},
+		"zero depth":          {path: billing + "/dependencies?depth=0", code: http.StatusBadRequest},
+		"invalid workflow ID": {path: "/api/v1/workflows/not-a-uuid/impact", code: http.StatusBadRequest},
+		"unknown workflow":    {path: "/api/v1/workflows/" + uuid.New().String() + "/impact", code: http.StatusNotFound},
+	}
+	for name, tt := range rejected {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.code, get(tt.path).Code)
+		})
+	}
+}
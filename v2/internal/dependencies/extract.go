@@ -0,0 +1,218 @@
+package dependencies
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/changesets"
+	"magic-flow/v2/pkg/models"
+)
+
+// executePath matches the path of the execute endpoint of a workflow
+var executePath = regexp.MustCompile(`/api/v1/executions/workflows/([0-9a-fA-F-]{36})/execute/?$`)
+
+// schemaRef matches the $ref of a schema to the input or output schema of a
+// workflow, named by ID or name, such as workflows/billing/input_schema
+var schemaRef = regexp.MustCompile(`(?:^|/)workflows/([^/#]+)/(input_schema|output_schema)(?:$|[/#])`)
+
+// reference is a workflow a definition references, by ID or by name
+type reference struct {
+	kind Kind
+	path string
+	id   uuid.UUID
+	name string
+}
+
+// Extract returns the edges of a definition. Workflows referenced by name
+// are resolved, and left out when they do not exist; workflows referenced
+// by ID are not loaded, as the workflows a changeset creates are not
+// visible before it commits.
+func (g *Graph) Extract(ctx context.Context, source *Source) []Edge {
+	var edges []Edge
+	seen := make(map[string]bool)
+	for _, ref := range g.references(source) {
+		id := ref.id
+		if id == uuid.Nil {
+			workflow, err := g.workflows.GetByName(ref.name)
+			if err != nil {
+				g.logger.WithError(err).WithField("workflow_id", source.WorkflowID).Debugf("Skipping dependency on unknown workflow %q at %s", ref.name, ref.path)
+				continue
+			}
+			id = workflow.ID
+		}
+
+		key := fmt.Sprintf("%s|%s|%s", id, ref.kind, ref.path)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		edges = append(edges, Edge{
+			WorkflowID: source.WorkflowID,
+			VersionID:  source.VersionID,
+			DependsOn:  id,
+			Kind:       ref.kind,
+			Path:       ref.path,
+		})
+	}
+	return edges
+}
+
+// references returns the workflows a definition and its schemas reference
+func (g *Graph) references(source *Source) []reference {
+	definition := source.Definition
+	var refs []reference
+	for _, step := range definition.Spec.Steps {
+		visitStep("steps."+step.Name, step.Type, step.Config, func(path, stepType string, config map[string]interface{}) {
+			if ref, ok := g.stepReference(path, stepType, config); ok {
+				refs = append(refs, ref)
+			}
+		})
+	}
+
+	for _, schema := range []struct {
+		path   string
+		schema models.JSONSchema
+	}{
+		{"input_schema", source.InputSchema},
+		{"output_schema", source.OutputSchema},
+		{"spec.input_schema", definition.Spec.InputSchema},
+		{"spec.output_schema", definition.Spec.OutputSchema},
+	} {
+		collectSchemaRefs(schema.path, schema.schema.Properties, &refs)
+	}
+
+	if template := definition.Metadata.Annotations[TemplateAnnotation]; template != "" {
+		refs = append(refs, byIDOrName(KindTemplate, "metadata.annotations."+TemplateAnnotation, template))
+	}
+	return refs
+}
+
+// stepReference returns the workflow a sub-workflow step starts or an http
+// step executes
+func (g *Graph) stepReference(path, stepType string, config map[string]interface{}) (reference, bool) {
+	switch stepType {
+	case changesets.SubWorkflowStepType:
+		raw, _ := config["workflow_id"].(string)
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return reference{}, false
+		}
+		return reference{kind: KindSubWorkflow, path: path, id: id}, true
+	case "http":
+		raw, _ := config["url"].(string)
+		id, ok := g.executedWorkflow(raw)
+		if !ok {
+			return reference{}, false
+		}
+		return reference{kind: KindHTTP, path: path, id: id}, true
+	}
+	return reference{}, false
+}
+
+// executedWorkflow returns the workflow a URL executes when it is the
+// execute endpoint of this server
+func (g *Graph) executedWorkflow(rawURL string) (uuid.UUID, bool) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	match := executePath.FindStringSubmatch(target.Path)
+	if match == nil {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(match[1])
+	if err != nil {
+		return uuid.Nil, false
+	}
+	if len(g.config.ServerURLs) == 0 {
+		return id, true
+	}
+	for _, server := range g.config.ServerURLs {
+		base, err := url.Parse(server)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(base.Host, target.Host) && strings.HasPrefix(target.Path, strings.TrimSuffix(base.Path, "/")+"/") {
+			return id, true
+		}
+	}
+	return uuid.Nil, false
+}
+
+// visitStep visits a step and the steps defined inline in it, in loops and
+// parallel branches
+func visitStep(path, stepType string, config map[string]interface{}, visit func(path, stepType string, config map[string]interface{})) {
+	visit(path, stepType, config)
+
+	var inline []interface{}
+	switch stepType {
+	case "loop":
+		inline, _ = config["steps"].([]interface{})
+	case "parallel":
+		branches, _ := config["branches"].([]interface{})
+		for _, branch := range branches {
+			switch b := branch.(type) {
+			case []interface{}:
+				inline = append(inline, b...)
+			case map[string]interface{}:
+				if steps, ok := b["steps"].([]interface{}); ok && b["type"] == nil {
+					inline = append(inline, steps...)
+				} else {
+					inline = append(inline, b)
+				}
+			}
+		}
+	}
+	for i, child := range inline {
+		step, ok := child.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := step["name"].(string)
+		if name == "" {
+			name = fmt.Sprintf("[%d]", i)
+		}
+		childType, _ := step["type"].(string)
+		childConfig, _ := step["config"].(map[string]interface{})
+		visitStep(path+"."+name, childType, childConfig, visit)
+	}
+}
+
+// collectSchemaRefs collects the workflows the $refs of the properties of
+// a schema reference, in the order of the property names
+func collectSchemaRefs(path string, value interface{}, refs *[]reference) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if match := schemaRef.FindStringSubmatch(ref); match != nil {
+				*refs = append(*refs, byIDOrName(KindSchema, path, match[1]))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			collectSchemaRefs(path+"."+key, v[key], refs)
+		}
+	case []interface{}:
+		for i, item := range v {
+			collectSchemaRefs(fmt.Sprintf("%s[%d]", path, i), item, refs)
+		}
+	}
+}
+
+// byIDOrName references a workflow named by ID or by name
+func byIDOrName(kind Kind, path, workflow string) reference {
+	if id, err := uuid.Parse(workflow); err == nil {
+		return reference{kind: kind, path: path, id: id}
+	}
+	return reference{kind: kind, path: path, name: workflow}
+}
@@ -0,0 +1,650 @@
+package dependencies
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/internal/triggers"
+	"magic-flow/v2/pkg/models"
+)
+
+// WorkflowStore loads the workflows of the graph. The workflow repository
+// implements it.
+type WorkflowStore interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+	GetByName(name string) (*models.Workflow, error)
+}
+
+// Schedules lists the schedules starting workflows. The scheduler service
+// implements it.
+type Schedules interface {
+	ListSchedules() []*scheduler.Schedule
+}
+
+// Graph records the dependencies of workflows on one another and answers
+// which workflows a workflow depends on, which depend on it and what a
+// change to it affects
+type Graph struct {
+	config    Config
+	store     Store
+	workflows WorkflowStore
+	schedules Schedules
+	webhooks  []*triggers.Trigger
+	logger    *logrus.Logger
+}
+
+// NewGraph creates a dependency graph
+func NewGraph(config Config, store Store, workflows WorkflowStore, logger *logrus.Logger) *Graph {
+	if config.MaxDepth <= 0 {
+		config.MaxDepth = DefaultConfig().MaxDepth
+	}
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &Graph{
+		config:    config,
+		store:     store,
+		workflows: workflows,
+		logger:    logger,
+	}
+}
+
+// SetSchedules sets the schedules the impact of a change reaches
+func (g *Graph) SetSchedules(schedules Schedules) {
+	g.schedules = schedules
+}
+
+// SetWebhooks sets the webhook triggers the impact of a change reaches
+func (g *Graph) SetWebhooks(webhooks []*triggers.Trigger) {
+	g.webhooks = webhooks
+}
+
+// RecordWorkflow records the edges of the definition a workflow was
+// created with
+func (g *Graph) RecordWorkflow(ctx context.Context, workflow *models.Workflow) error {
+	return g.record(ctx, WorkflowSource(workflow))
+}
+
+// RecordVersion records the edges of the definition of a version,
+// replacing those recorded for it before
+func (g *Graph) RecordVersion(ctx context.Context, version *models.WorkflowVersion) error {
+	return g.record(ctx, VersionSource(version))
+}
+
+func (g *Graph) record(ctx context.Context, source *Source) error {
+	edges := g.Extract(ctx, source)
+	if err := g.store.ReplaceEdges(ctx, source.WorkflowID, source.VersionID, edges); err != nil {
+		return fmt.Errorf("failed to record dependencies of workflow %s: %w", source.WorkflowID, err)
+	}
+	return nil
+}
+
+// WorkflowRef identifies a workflow of a report
+type WorkflowRef struct {
+	ID uuid.UUID `json:"id"`
+	// Name is empty for workflows that were deleted
+	Name string `json:"name,omitempty"`
+}
+
+// Node is a workflow reached by a traversal
+type Node struct {
+	WorkflowRef
+	// Depth is the number of edges between the workflow and the workflow
+	// the traversal started from
+	Depth int `json:"depth"`
+	// Edges are the edges reaching the workflow from the workflows one
+	// level closer
+	Edges []Edge `json:"edges"`
+}
+
+// Report lists the workflows upstream and downstream of a workflow
+type Report struct {
+	Workflow WorkflowRef `json:"workflow"`
+	Depth    int         `json:"depth"`
+	// Upstream are the workflows the workflow depends on
+	Upstream []*Node `json:"upstream,omitempty"`
+	// Downstream are the workflows depending on the workflow
+	Downstream []*Node `json:"downstream,omitempty"`
+	// Truncated reports whether workflows lie beyond the depth
+	Truncated bool `json:"truncated"`
+}
+
+// Dependencies returns the workflows upstream, downstream or on both sides
+// of a workflow, up to depth edges away. The depth is bounded by the
+// maximum depth, which it defaults to.
+func (g *Graph) Dependencies(ctx context.Context, workflowID uuid.UUID, direction Direction, depth int) (*Report, error) {
+	if direction == "" {
+		direction = Both
+	}
+	if direction != Upstream && direction != Downstream && direction != Both {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDirection, direction)
+	}
+	if depth <= 0 || depth > g.config.MaxDepth {
+		depth = g.config.MaxDepth
+	}
+
+	workflow, err := g.workflows.GetByID(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := g.load(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := g.namer(workflow)
+	report := &Report{Workflow: names.ref(workflowID), Depth: depth}
+	if direction != Downstream {
+		nodes, truncated := snapshot.traverse(workflowID, Upstream, depth)
+		report.Upstream = names.nodes(nodes)
+		report.Truncated = report.Truncated || truncated
+	}
+	if direction != Upstream {
+		nodes, truncated := snapshot.traverse(workflowID, Downstream, depth)
+		report.Downstream = names.nodes(nodes)
+		report.Truncated = report.Truncated || truncated
+	}
+	return report, nil
+}
+
+// AttachedSchedule is a schedule starting an affected workflow
+type AttachedSchedule struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	WorkflowID uuid.UUID `json:"workflow_id"`
+	Enabled    bool      `json:"enabled"`
+}
+
+// AttachedWebhook is a webhook trigger starting an affected workflow
+type AttachedWebhook struct {
+	Name       string    `json:"name"`
+	WorkflowID uuid.UUID `json:"workflow_id"`
+}
+
+// Impact is what changing or deprecating a workflow affects
+type Impact struct {
+	Workflow WorkflowRef `json:"workflow"`
+	// Workflows are the workflows depending on the workflow, directly or
+	// through other workflows
+	Workflows []*Node `json:"workflows"`
+	// Schedules and Webhooks are those starting the workflow or one of
+	// the workflows depending on it
+	Schedules []*AttachedSchedule `json:"schedules"`
+	Webhooks  []*AttachedWebhook  `json:"webhooks"`
+	// Cycles are the dependency cycles the workflow is part of
+	Cycles []*Cycle `json:"cycles,omitempty"`
+}
+
+// Impact returns everything changing or deprecating a workflow affects:
+// the workflows depending on it transitively, and the schedules and webhook
+// triggers starting any of them
+func (g *Graph) Impact(ctx context.Context, workflowID uuid.UUID) (*Impact, error) {
+	workflow, err := g.workflows.GetByID(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := g.load(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := g.namer(workflow)
+	nodes, _ := snapshot.traverse(workflowID, Downstream, 0)
+	impact := &Impact{
+		Workflow:  names.ref(workflowID),
+		Workflows: names.nodes(nodes),
+		Schedules: []*AttachedSchedule{},
+		Webhooks:  []*AttachedWebhook{},
+	}
+
+	affected := map[uuid.UUID]bool{workflowID: true}
+	for _, node := range nodes {
+		affected[node.ID] = true
+	}
+	if g.schedules != nil {
+		for _, schedule := range g.schedules.ListSchedules() {
+			if affected[schedule.WorkflowID] {
+				impact.Schedules = append(impact.Schedules, &AttachedSchedule{
+					ID:         schedule.ID,
+					Name:       schedule.Name,
+					WorkflowID: schedule.WorkflowID,
+					Enabled:    schedule.Enabled,
+				})
+			}
+		}
+		sort.Slice(impact.Schedules, func(i, j int) bool {
+			return impact.Schedules[i].Name < impact.Schedules[j].Name
+		})
+	}
+	for _, webhook := range g.webhooks {
+		if affected[webhook.WorkflowID] {
+			impact.Webhooks = append(impact.Webhooks, &AttachedWebhook{Name: webhook.Name, WorkflowID: webhook.WorkflowID})
+		}
+	}
+	sort.Slice(impact.Webhooks, func(i, j int) bool {
+		return impact.Webhooks[i].Name < impact.Webhooks[j].Name
+	})
+
+	for _, cycle := range snapshot.cycles(names) {
+		if cycle.contains(workflowID) {
+			impact.Cycles = append(impact.Cycles, cycle)
+		}
+	}
+	return impact, nil
+}
+
+// DependentWarnings describes what changing or deprecating a workflow
+// breaks: one warning for each workflow depending on it, and for each
+// schedule and webhook trigger starting one of them or the workflow itself
+func (g *Graph) DependentWarnings(ctx context.Context, workflowID uuid.UUID) ([]string, error) {
+	impact, err := g.Impact(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := impact.Workflow.label()
+	names := make(map[uuid.UUID]string, len(impact.Workflows)+1)
+	names[workflowID] = subject
+	for _, node := range impact.Workflows {
+		names[node.ID] = node.label()
+	}
+
+	var warnings []string
+	for _, node := range impact.Workflows {
+		edge := node.Edges[0]
+		if node.Depth == 1 {
+			warnings = append(warnings, fmt.Sprintf("workflow %s depends on %s through its %s reference at %s", node.label(), subject, edge.Kind, edge.Path))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("workflow %s depends on %s through workflow %s", node.label(), subject, names[edge.DependsOn]))
+		}
+	}
+	for _, schedule := range impact.Schedules {
+		warnings = append(warnings, fmt.Sprintf("schedule %s starts workflow %s", schedule.Name, names[schedule.WorkflowID]))
+	}
+	for _, webhook := range impact.Webhooks {
+		warnings = append(warnings, fmt.Sprintf("webhook trigger %s starts workflow %s", webhook.Name, names[webhook.WorkflowID]))
+	}
+	return warnings, nil
+}
+
+// Cycle is a set of workflows depending on one another
+type Cycle struct {
+	// Workflows are the workflows of the cycle, ordered by name
+	Workflows []WorkflowRef `json:"workflows"`
+	// Edges are the edges between the workflows of the cycle
+	Edges []Edge `json:"edges"`
+	// Warning describes the shortest cycle through the first workflow
+	Warning string `json:"warning"`
+}
+
+func (c *Cycle) contains(workflowID uuid.UUID) bool {
+	for _, workflow := range c.Workflows {
+		if workflow.ID == workflowID {
+			return true
+		}
+	}
+	return false
+}
+
+// CycleReport lists the dependency cycles across workflows
+type CycleReport struct {
+	Cycles   []*Cycle `json:"cycles"`
+	Warnings []string `json:"warnings"`
+}
+
+// Cycles reports the sets of workflows depending on one another, such as a
+// workflow starting a sub-workflow that executes it again
+func (g *Graph) Cycles(ctx context.Context) (*CycleReport, error) {
+	snapshot, err := g.load(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CycleReport{Cycles: snapshot.cycles(g.namer(nil)), Warnings: []string{}}
+	if report.Cycles == nil {
+		report.Cycles = []*Cycle{}
+	}
+	for _, cycle := range report.Cycles {
+		report.Warnings = append(report.Warnings, cycle.Warning)
+	}
+	return report, nil
+}
+
+// WorkflowCycles returns the warnings of the dependency cycles the
+// definition of a new workflow closes
+func (g *Graph) WorkflowCycles(ctx context.Context, workflow *models.Workflow) ([]string, error) {
+	return g.cyclesOf(ctx, workflow, WorkflowSource(workflow))
+}
+
+// VersionCycles returns the warnings of the dependency cycles the
+// definition of a new version closes
+func (g *Graph) VersionCycles(ctx context.Context, version *models.WorkflowVersion) ([]string, error) {
+	return g.cyclesOf(ctx, nil, VersionSource(version))
+}
+
+// cyclesOf returns the warnings of the cycles the workflow of a source is
+// part of once its edges are recorded
+func (g *Graph) cyclesOf(ctx context.Context, workflow *models.Workflow, source *Source) ([]string, error) {
+	edges := g.Extract(ctx, source)
+	snapshot, err := g.load(ctx, &pending{source: source, edges: edges})
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, cycle := range snapshot.cycles(g.namer(workflow)) {
+		if cycle.contains(source.WorkflowID) {
+			warnings = append(warnings, cycle.Warning)
+		}
+	}
+	return warnings, nil
+}
+
+// pending are the edges of a definition not recorded yet
+type pending struct {
+	source *Source
+	edges  []Edge
+}
+
+// load builds a snapshot of the recorded edges, with those of a pending
+// definition in place of the edges recorded for it
+func (g *Graph) load(ctx context.Context, overlay *pending) (*snapshot, error) {
+	edges, err := g.store.ListEdges(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dependencies: %w", err)
+	}
+	if overlay != nil {
+		kept := edges[:0]
+		for _, edge := range edges {
+			if !sameDefinition(&edge, overlay.source.WorkflowID, overlay.source.VersionID) {
+				kept = append(kept, edge)
+			}
+		}
+		edges = append(kept, overlay.edges...)
+	}
+	return newSnapshot(edges), nil
+}
+
+// namer names the workflows of a report, loading each once
+type namer struct {
+	workflows WorkflowStore
+	names     map[uuid.UUID]string
+}
+
+// namer returns a namer knowing the name of workflow, which may be nil or
+// not yet stored
+func (g *Graph) namer(workflow *models.Workflow) *namer {
+	n := &namer{workflows: g.workflows, names: make(map[uuid.UUID]string)}
+	if workflow != nil {
+		n.names[workflow.ID] = workflow.Name
+	}
+	return n
+}
+
+func (n *namer) ref(id uuid.UUID) WorkflowRef {
+	name, known := n.names[id]
+	if !known {
+		if workflow, err := n.workflows.GetByID(id); err == nil {
+			name = workflow.Name
+		}
+		n.names[id] = name
+	}
+	return WorkflowRef{ID: id, Name: name}
+}
+
+// nodes names the nodes of a traversal and orders them by depth and name
+func (n *namer) nodes(nodes []*Node) []*Node {
+	for _, node := range nodes {
+		node.WorkflowRef = n.ref(node.ID)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Depth != nodes[j].Depth {
+			return nodes[i].Depth < nodes[j].Depth
+		}
+		return nodes[i].label() < nodes[j].label()
+	})
+	if nodes == nil {
+		return []*Node{}
+	}
+	return nodes
+}
+
+// label returns the name of a workflow, or its ID when it has none
+func (r WorkflowRef) label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.ID.String()
+}
+
+// snapshot indexes the edges of the graph by both of their workflows. The
+// edges of the versions of a workflow making the same reference are
+// collapsed into the most recent one.
+type snapshot struct {
+	upstream   map[uuid.UUID][]Edge
+	downstream map[uuid.UUID][]Edge
+}
+
+func newSnapshot(edges []Edge) *snapshot {
+	s := &snapshot{
+		upstream:   make(map[uuid.UUID][]Edge),
+		downstream: make(map[uuid.UUID][]Edge),
+	}
+
+	type reference struct {
+		workflowID, dependsOn uuid.UUID
+		kind                  Kind
+		path                  string
+	}
+	latest := make(map[reference]Edge)
+	var order []reference
+	for _, edge := range edges {
+		key := reference{edge.WorkflowID, edge.DependsOn, edge.Kind, edge.Path}
+		current, exists := latest[key]
+		if !exists {
+			order = append(order, key)
+		}
+		if !exists || edge.CreatedAt.After(current.CreatedAt) {
+			latest[key] = edge
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if a.dependsOn != b.dependsOn {
+			return a.dependsOn.String() < b.dependsOn.String()
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.path < b.path
+	})
+	for _, key := range order {
+		edge := latest[key]
+		s.upstream[edge.WorkflowID] = append(s.upstream[edge.WorkflowID], edge)
+		s.downstream[edge.DependsOn] = append(s.downstream[edge.DependsOn], edge)
+	}
+	return s
+}
+
+// traverse returns the workflows up to depth edges upstream or downstream
+// of a workflow, all of them when depth is zero, and whether any lie
+// further
+func (s *snapshot) traverse(from uuid.UUID, direction Direction, depth int) ([]*Node, bool) {
+	next := func(id uuid.UUID) ([]Edge, func(Edge) uuid.UUID) {
+		if direction == Upstream {
+			return s.upstream[id], func(edge Edge) uuid.UUID { return edge.DependsOn }
+		}
+		return s.downstream[id], func(edge Edge) uuid.UUID { return edge.WorkflowID }
+	}
+
+	reached := map[uuid.UUID]*Node{from: nil}
+	var nodes []*Node
+	frontier := []uuid.UUID{from}
+	for level := 1; len(frontier) > 0; level++ {
+		if depth > 0 && level > depth {
+			for _, id := range frontier {
+				edges, other := next(id)
+				for _, edge := range edges {
+					if _, seen := reached[other(edge)]; !seen {
+						return nodes, true
+					}
+				}
+			}
+			return nodes, false
+		}
+
+		var discovered []uuid.UUID
+		for _, id := range frontier {
+			edges, other := next(id)
+			for _, edge := range edges {
+				target := other(edge)
+				node, seen := reached[target]
+				if !seen {
+					node = &Node{WorkflowRef: WorkflowRef{ID: target}, Depth: level}
+					reached[target] = node
+					nodes = append(nodes, node)
+					discovered = append(discovered, target)
+				}
+				if node != nil && node.Depth == level {
+					node.Edges = append(node.Edges, edge)
+				}
+			}
+		}
+		frontier = discovered
+	}
+	return nodes, false
+}
+
+// cycles returns the strongly connected sets of workflows of the graph
+// with more than one workflow, or with a workflow depending on itself,
+// ordered by the name of their first workflow
+func (s *snapshot) cycles(names *namer) []*Cycle {
+	var ids []uuid.UUID
+	for id := range s.upstream {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	// Tarjan's strongly connected components
+	index := make(map[uuid.UUID]int)
+	low := make(map[uuid.UUID]int)
+	onStack := make(map[uuid.UUID]bool)
+	var stack []uuid.UUID
+	var components [][]uuid.UUID
+	var connect func(id uuid.UUID)
+	connect = func(id uuid.UUID) {
+		index[id] = len(index)
+		low[id] = index[id]
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, edge := range s.upstream[id] {
+			target := edge.DependsOn
+			if _, visited := index[target]; !visited {
+				connect(target)
+				low[id] = min(low[id], low[target])
+			} else if onStack[target] {
+				low[id] = min(low[id], index[target])
+			}
+		}
+
+		if low[id] == index[id] {
+			var component []uuid.UUID
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == id {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+	for _, id := range ids {
+		if _, visited := index[id]; !visited {
+			connect(id)
+		}
+	}
+
+	var cycles []*Cycle
+	for _, component := range components {
+		members := make(map[uuid.UUID]bool, len(component))
+		for _, id := range component {
+			members[id] = true
+		}
+		cycle := &Cycle{}
+		for _, id := range component {
+			for _, edge := range s.upstream[id] {
+				if members[edge.DependsOn] {
+					cycle.Edges = append(cycle.Edges, edge)
+				}
+			}
+		}
+		if len(cycle.Edges) == 0 {
+			continue
+		}
+
+		for _, id := range component {
+			cycle.Workflows = append(cycle.Workflows, names.ref(id))
+		}
+		sort.Slice(cycle.Workflows, func(i, j int) bool {
+			return cycle.Workflows[i].label() < cycle.Workflows[j].label()
+		})
+		cycle.Warning = s.describe(cycle.Workflows[0].ID, members, names)
+		cycles = append(cycles, cycle)
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i].Workflows[0].label() < cycles[j].Workflows[0].label()
+	})
+	return cycles
+}
+
+// describe describes the shortest cycle from a workflow back to itself
+// through the members of its cycle, such as "dependency cycle: checkout
+// (steps.bill) -> billing (steps.refund) -> checkout"
+func (s *snapshot) describe(start uuid.UUID, members map[uuid.UUID]bool, names *namer) string {
+	via := map[uuid.UUID]Edge{}
+	frontier := []uuid.UUID{start}
+	var closing *Edge
+	for len(frontier) > 0 && closing == nil {
+		var discovered []uuid.UUID
+		for _, id := range frontier {
+			for _, edge := range s.upstream[id] {
+				if edge.DependsOn == start {
+					last := edge
+					closing = &last
+					break
+				}
+				if _, seen := via[edge.DependsOn]; seen || !members[edge.DependsOn] {
+					continue
+				}
+				via[edge.DependsOn] = edge
+				discovered = append(discovered, edge.DependsOn)
+			}
+			if closing != nil {
+				break
+			}
+		}
+		frontier = discovered
+	}
+
+	path := []Edge{*closing}
+	for id := closing.WorkflowID; id != start; id = via[id].WorkflowID {
+		path = append([]Edge{via[id]}, path...)
+	}
+	hops := make([]string, 0, len(path)+1)
+	for _, edge := range path {
+		hops = append(hops, fmt.Sprintf("%s (%s)", names.ref(edge.WorkflowID).label(), edge.Path))
+	}
+	hops = append(hops, names.ref(start).label())
+	return "dependency cycle: " + strings.Join(hops, " -> ")
+}
@@ -0,0 +1,119 @@
+package dependencies
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Handlers provides HTTP handlers for the workflow dependency graph
+type Handlers struct {
+	graph *Graph
+}
+
+// NewHandlers creates new dependency handlers
+func NewHandlers(graph *Graph) *Handlers {
+	return &Handlers{graph: graph}
+}
+
+// RegisterRoutes registers dependency routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		v1.GET("/workflows/:id/dependencies", h.GetDependencies)
+		v1.GET("/workflows/:id/impact", h.GetImpact)
+		v1.GET("/dependencies/cycles", h.ListCycles)
+	}
+}
+
+// GetDependencies returns the workflows upstream and downstream of a
+// workflow
+// @Summary Get the dependencies of a workflow
+// @Description Lists the workflows a workflow depends on (upstream) and the workflows depending on it (downstream), level by level up to the depth
+// @Tags dependencies
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param direction query string false "upstream, downstream or both (default)"
+// @Param depth query int false "Depth, bounded by and defaulting to the maximum depth"
+// @Success 200 {object} Report
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/dependencies [get]
+func (h *Handlers) GetDependencies(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workflow ID"})
+		return
+	}
+
+	depth := 0
+	if raw := c.Query("depth"); raw != "" {
+		depth, err = strconv.Atoi(raw)
+		if err != nil || depth <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "depth must be a positive integer"})
+			return
+		}
+	}
+
+	report, err := h.graph.Dependencies(c.Request.Context(), id, Direction(c.Query("direction")), depth)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetImpact returns what changing or deprecating a workflow affects
+// @Summary Get the impact of changing a workflow
+// @Description Lists the workflows depending on a workflow transitively, and the schedules and webhook triggers starting the workflow or any of them
+// @Tags dependencies
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 200 {object} Impact
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/impact [get]
+func (h *Handlers) GetImpact(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workflow ID"})
+		return
+	}
+
+	impact, err := h.graph.Impact(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, impact)
+}
+
+// ListCycles reports the dependency cycles across workflows
+// @Summary List dependency cycles
+// @Tags dependencies
+// @Produce json
+// @Success 200 {object} CycleReport
+// @Router /api/v1/dependencies/cycles [get]
+func (h *Handlers) ListCycles(c *gin.Context) {
+	report, err := h.graph.Cycles(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidDirection):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
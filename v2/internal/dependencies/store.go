@@ -0,0 +1,127 @@
+package dependencies
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store persists the edges of the dependency graph
+type Store interface {
+	// ReplaceEdges replaces the edges of a definition: those of the
+	// version when versionID is set, those of the definition the workflow
+	// was created with otherwise
+	ReplaceEdges(ctx context.Context, workflowID uuid.UUID, versionID *uuid.UUID, edges []Edge) error
+	// ListEdges returns every edge, ordered by dependent workflow
+	ListEdges(ctx context.Context) ([]Edge, error)
+}
+
+// sameDefinition reports whether an edge was extracted from the
+// definition of a workflow, or of one of its versions when versionID is set
+func sameDefinition(edge *Edge, workflowID uuid.UUID, versionID *uuid.UUID) bool {
+	if edge.WorkflowID != workflowID {
+		return false
+	}
+	if versionID == nil || edge.VersionID == nil {
+		return versionID == nil && edge.VersionID == nil
+	}
+	return *edge.VersionID == *versionID
+}
+
+// prepare assigns the IDs and creation times of new edges
+func prepare(edges []Edge, now time.Time) {
+	for i := range edges {
+		if edges[i].ID == uuid.Nil {
+			edges[i].ID = uuid.New()
+		}
+		if edges[i].CreatedAt.IsZero() {
+			edges[i].CreatedAt = now
+		}
+	}
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu    sync.Mutex
+	edges []Edge
+}
+
+// NewMemoryStore creates an in-memory edge store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// ReplaceEdges replaces the edges of a definition
+func (s *MemoryStore) ReplaceEdges(ctx context.Context, workflowID uuid.UUID, versionID *uuid.UUID, edges []Edge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.edges[:0]
+	for _, edge := range s.edges {
+		if !sameDefinition(&edge, workflowID, versionID) {
+			kept = append(kept, edge)
+		}
+	}
+	prepare(edges, time.Now().UTC())
+	s.edges = append(kept, edges...)
+	return nil
+}
+
+// ListEdges returns every edge
+func (s *MemoryStore) ListEdges(ctx context.Context) ([]Edge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	edges := append([]Edge(nil), s.edges...)
+	sort.SliceStable(edges, func(i, j int) bool {
+		return edges[i].WorkflowID.String() < edges[j].WorkflowID.String()
+	})
+	return edges, nil
+}
+
+// GormStore keeps the edges in the dependencies table, keyed by the workflow
+// and, for the edges of a version, the version they were extracted from
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database edge store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the dependencies table
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Edge{})
+}
+
+// ReplaceEdges replaces the edges of a definition in one transaction
+func (s *GormStore) ReplaceEdges(ctx context.Context, workflowID uuid.UUID, versionID *uuid.UUID, edges []Edge) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("workflow_id = ?", workflowID)
+		if versionID != nil {
+			query = query.Where("version_id = ?", *versionID)
+		} else {
+			query = query.Where("version_id IS NULL")
+		}
+		if err := query.Delete(&Edge{}).Error; err != nil {
+			return err
+		}
+		if len(edges) == 0 {
+			return nil
+		}
+		prepare(edges, time.Now().UTC())
+		return tx.Create(&edges).Error
+	})
+}
+
+// ListEdges returns every edge
+func (s *GormStore) ListEdges(ctx context.Context) ([]Edge, error) {
+	var edges []Edge
+	err := s.db.WithContext(ctx).Order("workflow_id, created_at").Find(&edges).Error
+	return edges, err
+}
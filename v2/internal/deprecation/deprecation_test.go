@@ -0,0 +1,465 @@
+package deprecation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/pkg/models"
+)
+
+type fakeWorkflows map[uuid.UUID]*models.Workflow
+
+func (w fakeWorkflows) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	workflow, ok := w[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return workflow, nil
+}
+
+func (w fakeWorkflows) Update(workflow *models.Workflow) error {
+	w[workflow.ID] = workflow
+	return nil
+}
+
+func (w fakeWorkflows) ListDeprecated() ([]*models.Workflow, error) {
+	var deprecated []*models.Workflow
+	for _, workflow := range w {
+		if workflow.Deprecation != nil {
+			deprecated = append(deprecated, workflow)
+		}
+	}
+	return deprecated, nil
+}
+
+type fakeVersions map[uuid.UUID]*models.WorkflowVersion
+
+func (v fakeVersions) GetByID(id uuid.UUID) (*models.WorkflowVersion, error) {
+	version, ok := v[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return version, nil
+}
+
+func (v fakeVersions) Update(version *models.WorkflowVersion) error {
+	v[version.ID] = version
+	return nil
+}
+
+func (v fakeVersions) ListDeprecated() ([]*models.WorkflowVersion, error) {
+	var deprecated []*models.WorkflowVersion
+	for _, version := range v {
+		if version.Deprecation != nil {
+			deprecated = append(deprecated, version)
+		}
+	}
+	return deprecated, nil
+}
+
+type recordingNotifier struct {
+	digests []*Digest
+}
+
+func (n *recordingNotifier) NotifyDependencies(ctx context.Context, digest *Digest) {
+	n.digests = append(n.digests, digest)
+}
+
+var (
+	now           = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	legacyID      = uuid.MustParse("7d9f1c2e-4b3a-4e51-9c0d-1a2b3c4d5e6f")
+	replacementID = uuid.MustParse("0e8a6b4c-2d1f-4a3b-8c5d-6e7f8a9b0c1d")
+)
+
+// ordersWorkflows returns orders-v1 and orders-v2, the workflow replacing it
+// with a flat input
+func ordersWorkflows() fakeWorkflows {
+	return fakeWorkflows{
+		legacyID: {
+			ID:      legacyID,
+			Name:    "orders-v1",
+			Version: "1.4.0",
+			Status:  models.WorkflowStatusActive,
+			InputSchema: models.JSONSchema{
+				Type:       "object",
+				Properties: map[string]interface{}{"customer": map[string]interface{}{"type": "object"}},
+			},
+		},
+		replacementID: {
+			ID:      replacementID,
+			Name:    "orders-v2",
+			Version: "2.0.0",
+			Status:  models.WorkflowStatusActive,
+			InputSchema: models.JSONSchema{
+				Type: "object",
+				Properties: map[string]interface{}{
+					"customer_id": map[string]interface{}{"type": "string"},
+					"express":     map[string]interface{}{"type": "boolean"},
+				},
+				Required: []string{"customer_id"},
+			},
+		},
+	}
+}
+
+// newTestManager returns a manager of workflows and versions at now, with a
+// week long notify window and its usage in memory
+func newTestManager(workflows fakeWorkflows, versions fakeVersions, notifier Notifier) *Manager {
+	manager := NewManager(Config{NotifyWindow: 7 * 24 * time.Hour}, workflows, versions, NewMemoryStore(), notifier, logrus.New())
+	manager.now = func() time.Time { return now }
+	return manager
+}
+
+// deprecateLegacy deprecates orders-v1 in favour of orders-v2
+func deprecateLegacy(t *testing.T, manager *Manager, policy models.SunsetPolicy, sunsetAt time.Time, mapping map[string]string) {
+	t.Helper()
+	_, err := manager.DeprecateWorkflow(context.Background(), legacyID, &models.Deprecation{
+		DeprecatedAt: now.Add(-30 * 24 * time.Hour),
+		SunsetAt:     &sunsetAt,
+		Reason:       "orders moved to the v2 pipeline",
+		Replacement:  &models.Replacement{WorkflowID: replacementID, InputMapping: mapping},
+		SunsetPolicy: policy,
+	})
+	require.NoError(t, err)
+}
+
+func TestNoticeHeaders(t *testing.T) {
+	sunsetAt := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		deprecation *models.Deprecation
+		deprecated  string
+		sunset      string
+		link        string
+		warning     []string
+	}{
+		"sunset date and replacement": {
+			deprecation: &models.Deprecation{
+				DeprecatedAt: now.Add(-30 * 24 * time.Hour),
+				SunsetAt:     &sunsetAt,
+				Reason:       "orders moved to the v2 pipeline",
+				Replacement:  &models.Replacement{WorkflowID: replacementID},
+				SunsetPolicy: models.SunsetPolicyReject,
+			},
+			deprecated: "@1714651200",
+			sunset:     "Mon, 01 Jul 2024 00:00:00 GMT",
+			link:       `</api/v1/workflows/` + replacementID.String() + `>; rel="successor-version"`,
+			warning: []string{
+				"workflow orders-v1 is deprecated and will be sunset on 2024-07-01T00:00:00Z",
+				"orders moved to the v2 pipeline",
+				"use workflow " + replacementID.String() + " instead",
+			},
+		},
+		"without sunset date or replacement": {
+			deprecation: &models.Deprecation{DeprecatedAt: now, SunsetPolicy: models.SunsetPolicyWarn},
+			deprecated:  "@1717243200",
+			warning:     []string{"workflow orders-v1 is deprecated"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			notice := NewNotice(ordersWorkflows()[legacyID], nil, tt.deprecation, now)
+			assert.False(t, notice.Sunset)
+
+			header := http.Header{}
+			notice.SetHeaders(header)
+			assert.Equal(t, tt.deprecated, header.Get("Deprecation"))
+			assert.Equal(t, tt.sunset, header.Get("Sunset"))
+			assert.Equal(t, tt.link, header.Get("Link"))
+			for _, warning := range tt.warning {
+				assert.Contains(t, notice.Warning(), warning)
+			}
+		})
+	}
+}
+
+func TestSunsetPolicies(t *testing.T) {
+	input := map[string]interface{}{"customer": map[string]interface{}{"id": "c-42"}}
+	mapping := map[string]string{"customer_id": "customer.id"}
+
+	tests := map[string]struct {
+		deprecated bool
+		policy     models.SunsetPolicy
+		mapping    map[string]string
+		input      map[string]interface{}
+		workflowID uuid.UUID
+		resolved   map[string]interface{}
+		forwarded  bool
+		warning    string
+		err        string
+	}{
+		"not deprecated":         {input: input, workflowID: legacyID, resolved: input},
+		"warn":                   {deprecated: true, policy: models.SunsetPolicyWarn, input: input, workflowID: legacyID, resolved: input, warning: "was sunset on"},
+		"reject":                 {deprecated: true, policy: models.SunsetPolicyReject, input: input, err: "use workflow " + replacementID.String() + " instead"},
+		"forward":                {deprecated: true, policy: models.SunsetPolicyForward, mapping: mapping, input: input, workflowID: replacementID, resolved: map[string]interface{}{"customer_id": "c-42"}, forwarded: true, warning: "was sunset on"},
+		"forward unmapped input": {deprecated: true, policy: models.SunsetPolicyForward, mapping: mapping, input: map[string]interface{}{"customer": "c-42"}, err: "missing required field customer_id"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			workflows := ordersWorkflows()
+			manager := newTestManager(workflows, fakeVersions{}, nil)
+			if tt.deprecated {
+				deprecateLegacy(t, manager, tt.policy, now.Add(-time.Hour), tt.mapping)
+			}
+
+			resolution, err := manager.Resolve(context.Background(), workflows[legacyID], nil, tt.input)
+			if tt.err != "" {
+				require.ErrorIs(t, err, ErrSunset)
+				var sunset *SunsetError
+				require.True(t, errors.As(err, &sunset))
+				assert.Equal(t, replacementID, sunset.Notice.Replacement.WorkflowID)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Same(t, workflows[tt.workflowID], resolution.Workflow)
+			assert.Equal(t, tt.resolved, resolution.Input)
+			if tt.forwarded {
+				assert.Equal(t, &workflows[legacyID].ID, resolution.ForwardedFrom)
+			} else {
+				assert.Nil(t, resolution.ForwardedFrom)
+			}
+			if !tt.deprecated {
+				assert.Nil(t, resolution.Notice)
+				return
+			}
+			require.NotNil(t, resolution.Notice)
+			assert.True(t, resolution.Notice.Sunset)
+			assert.Contains(t, resolution.Notice.Warning(), tt.warning)
+		})
+	}
+}
+
+func TestInvalidDeprecations(t *testing.T) {
+	sunsetAt := now.Add(-time.Hour)
+	version := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: legacyID, Version: "1.3.0"}
+
+	tests := map[string]struct {
+		deprecate func(manager *Manager) error
+		err       error
+	}{
+		"forward without an input mapping": {
+			deprecate: func(manager *Manager) error {
+				_, err := manager.DeprecateWorkflow(context.Background(), legacyID, &models.Deprecation{
+					SunsetAt:     &sunsetAt,
+					Replacement:  &models.Replacement{WorkflowID: replacementID},
+					SunsetPolicy: models.SunsetPolicyForward,
+				})
+				return err
+			},
+			err: ErrInvalidDeprecation,
+		},
+		"version of another workflow": {
+			deprecate: func(manager *Manager) error {
+				_, err := manager.DeprecateVersion(context.Background(), replacementID, version.ID, &models.Deprecation{})
+				return err
+			},
+			err: ErrVersionNotFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager := newTestManager(ordersWorkflows(), fakeVersions{version.ID: version}, nil)
+			assert.ErrorIs(t, tt.deprecate(manager), tt.err)
+		})
+	}
+}
+
+func TestVersionDeprecation(t *testing.T) {
+	sunsetAt := now.Add(-time.Hour)
+	input := map[string]interface{}{"customer": map[string]interface{}{"id": "c-42"}}
+	workflows := ordersWorkflows()
+	version := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: legacyID, Version: "1.3.0"}
+	manager := newTestManager(workflows, fakeVersions{version.ID: version}, nil)
+
+	_, err := manager.DeprecateVersion(context.Background(), legacyID, version.ID, &models.Deprecation{
+		DeprecatedAt: sunsetAt.Add(-24 * time.Hour),
+		SunsetAt:     &sunsetAt,
+		SunsetPolicy: models.SunsetPolicyReject,
+	})
+	require.NoError(t, err)
+
+	// Executions of the version are rejected, those of the workflow are not
+	_, err = manager.Resolve(context.Background(), workflows[legacyID], &version.ID, input)
+	require.ErrorIs(t, err, ErrSunset)
+	assert.Contains(t, err.Error(), "workflow orders-v1 version 1.3.0 was sunset")
+
+	resolution, err := manager.Resolve(context.Background(), workflows[legacyID], nil, input)
+	require.NoError(t, err)
+	assert.Nil(t, resolution.Notice)
+}
+
+func TestDependents(t *testing.T) {
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	version := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: replacementID, Version: "2.0.0-rc1"}
+	manager := newTestManager(ordersWorkflows(), fakeVersions{version.ID: version}, notifier)
+
+	deprecateLegacy(t, manager, models.SunsetPolicyWarn, now.Add(30*24*time.Hour), nil)
+	_, err := manager.DeprecateVersion(ctx, replacementID, version.ID, &models.Deprecation{SunsetPolicy: models.SunsetPolicyWarn})
+	require.NoError(t, err)
+
+	billing, reports, archive := CallerFromAPIKey("billing-key"), CallerFromAPIKey("reports-key"), CallerFromAPIKey("archive-key")
+	usages := []struct {
+		caller     string
+		workflowID uuid.UUID
+		version    string
+		at         time.Time
+	}{
+		{billing, legacyID, "1.4.0", now.Add(-time.Hour)},
+		{billing, legacyID, "1.4.0", now.Add(-2 * time.Hour)},
+		{billing, replacementID, "2.0.0", now.Add(-time.Hour)},
+		{reports, replacementID, "2.0.0-rc1", now.Add(-24 * time.Hour)},
+		// Outside the notify window
+		{archive, legacyID, "1.4.0", now.Add(-8 * 24 * time.Hour)},
+	}
+	for _, usage := range usages {
+		require.NoError(t, manager.usage.RecordExecution(ctx, usage.caller, usage.workflowID, usage.version, usage.at))
+	}
+	require.NoError(t, manager.RecordExecution(ctx, "", legacyID, "1.4.0"))
+
+	digests, err := manager.Dependents(ctx)
+	require.NoError(t, err)
+	require.Len(t, digests, 2)
+
+	byCaller := map[string]*Digest{}
+	for _, digest := range digests {
+		byCaller[digest.Caller] = digest
+	}
+
+	require.Contains(t, byCaller, billing)
+	require.Len(t, byCaller[billing].Dependencies, 1)
+	dependency := byCaller[billing].Dependencies[0]
+	assert.Equal(t, "workflow orders-v1", dependency.Notice.Subject())
+	assert.Equal(t, int64(2), dependency.Executions)
+	assert.Equal(t, now.Add(-time.Hour), dependency.LastExecutedAt)
+	assert.Equal(t, now.Add(-7*24*time.Hour), byCaller[billing].Since)
+
+	require.Contains(t, byCaller, reports)
+	require.Len(t, byCaller[reports].Dependencies, 1)
+	assert.Equal(t, "workflow orders-v2 version 2.0.0-rc1", byCaller[reports].Dependencies[0].Notice.Subject())
+
+	assert.NotContains(t, byCaller, archive)
+	assert.NotContains(t, byCaller, "")
+
+	sent, err := manager.SendDigests(ctx)
+	require.NoError(t, err)
+	assert.Len(t, sent, 2)
+	assert.Equal(t, sent, notifier.digests)
+}
+
+func TestCallerFromAPIKey(t *testing.T) {
+	billing := CallerFromAPIKey("billing-key")
+	assert.Equal(t, billing, CallerFromAPIKey("billing-key"))
+	assert.NotEqual(t, billing, CallerFromAPIKey("reports-key"))
+	assert.NotContains(t, billing, "billing-key")
+	assert.Empty(t, CallerFromAPIKey(""))
+}
+
+type fakeDependents []string
+
+func (d fakeDependents) DependentWarnings(ctx context.Context, workflowID uuid.UUID) ([]string, error) {
+	return d, nil
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	workflows, notifier := ordersWorkflows(), &recordingNotifier{}
+	manager := newTestManager(workflows, fakeVersions{}, notifier)
+	router := gin.New()
+	NewHandlers(manager).RegisterRoutes(router.Group("/api"))
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, bytes.NewReader(payload)))
+		return recorder
+	}
+	path := "/api/v1/workflows/" + legacyID.String() + "/deprecation"
+
+	t.Run("deprecate", func(t *testing.T) {
+		recorder := request(http.MethodPut, path, map[string]interface{}{
+			"sunset_at":     now.Add(24 * time.Hour),
+			"replacement":   map[string]interface{}{"workflow_id": replacementID},
+			"sunset_policy": "reject",
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var workflow models.Workflow
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &workflow))
+		require.NotNil(t, workflow.Deprecation)
+		assert.Equal(t, models.SunsetPolicyReject, workflow.Deprecation.SunsetPolicy)
+		assert.Equal(t, now, workflow.Deprecation.DeprecatedAt)
+		assert.Equal(t, replacementID, workflow.Deprecation.Replacement.WorkflowID)
+		assert.Empty(t, recorder.Header().Values("Warning"), "no warnings without a dependency graph")
+
+		recorder = request(http.MethodGet, "/api/v1/deprecations", nil)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"workflow_name":"orders-v1"`)
+	})
+
+	t.Run("warns about dependents", func(t *testing.T) {
+		manager.SetDependents(fakeDependents{"workflow fulfilment depends on orders-v1 through its sub_workflow reference at steps.order"})
+		defer manager.SetDependents(nil)
+
+		recorder := request(http.MethodPut, path, map[string]interface{}{"sunset_policy": "reject"})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Equal(t, []string{`299 - "workflow fulfilment depends on orders-v1 through its sub_workflow reference at steps.order"`}, recorder.Header().Values("Warning"))
+	})
+
+	t.Run("undeprecate", func(t *testing.T) {
+		recorder := request(http.MethodDelete, path, nil)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Nil(t, workflows[legacyID].Deprecation)
+		assert.NotContains(t, recorder.Body.String(), `"deprecation"`)
+	})
+
+	t.Run("dependents", func(t *testing.T) {
+		deprecateLegacy(t, manager, models.SunsetPolicyWarn, now.Add(24*time.Hour), nil)
+		require.NoError(t, manager.RecordExecution(context.Background(), CallerFromAPIKey("billing-key"), legacyID, "1.4.0"))
+
+		recorder := request(http.MethodGet, "/api/v1/deprecations/dependents", nil)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"count":1`)
+		assert.Contains(t, recorder.Body.String(), CallerFromAPIKey("billing-key"))
+
+		recorder = request(http.MethodPost, "/api/v1/deprecations/digests", nil)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"sent":1}`, recorder.Body.String())
+		assert.Len(t, notifier.digests, 1)
+	})
+
+	rejected := map[string]struct {
+		path string
+		body map[string]interface{}
+		code int
+	}{
+		"unknown sunset policy": {path: path, body: map[string]interface{}{"sunset_policy": "retire"}, code: http.StatusBadRequest},
+		"unknown replacement":   {path: path, body: map[string]interface{}{"replacement": map[string]interface{}{"workflow_id": uuid.New()}}, code: http.StatusBadRequest},
+		"unknown workflow":      {path: "/api/v1/workflows/" + uuid.New().String() + "/deprecation", body: map[string]interface{}{}, code: http.StatusNotFound},
+		"invalid workflow ID":   {path: "/api/v1/workflows/not-a-uuid/deprecation", body: map[string]interface{}{}, code: http.StatusBadRequest},
+	}
+	for name, tt := range rejected {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.code, request(http.MethodPut, tt.path, tt.body).Code)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package deprecation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// Handlers provides HTTP handlers for workflow deprecations
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new deprecation handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers deprecation routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		v1.PUT("/workflows/:id/deprecation", h.DeprecateWorkflow)
+		v1.DELETE("/workflows/:id/deprecation", h.UndeprecateWorkflow)
+		v1.PUT("/workflows/:id/versions/:version_id/deprecation", h.DeprecateVersion)
+		v1.DELETE("/workflows/:id/versions/:version_id/deprecation", h.UndeprecateVersion)
+		v1.GET("/deprecations", h.ListDeprecations)
+		v1.GET("/deprecations/dependents", h.ListDependents)
+		v1.POST("/deprecations/digests", h.SendDigests)
+	}
+}
+
+// DeprecateWorkflow deprecates a workflow
+// @Summary Deprecate a workflow
+// @Description Marks a workflow deprecated with an optional sunset date, replacement and sunset policy. The workflows, schedules and webhook triggers depending on it are reported in Warning headers.
+// @Tags deprecations
+// @Accept json
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param deprecation body models.Deprecation true "Deprecation"
+// @Success 200 {object} models.Workflow
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/deprecation [put]
+func (h *Handlers) DeprecateWorkflow(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workflow ID"})
+		return
+	}
+
+	var deprecation models.Deprecation
+	if err := c.ShouldBindJSON(&deprecation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workflow, err := h.manager.DeprecateWorkflow(c.Request.Context(), id, &deprecation)
+	if err != nil {
+		h.handleError(c, err, "workflow not found")
+		return
+	}
+	for _, warning := range h.manager.DependentWarnings(c.Request.Context(), id) {
+		c.Writer.Header().Add("Warning", fmt.Sprintf("299 - %q", warning))
+	}
+	c.JSON(http.StatusOK, workflow)
+}
+
+// UndeprecateWorkflow removes the deprecation of a workflow
+// @Summary Undeprecate a workflow
+// @Tags deprecations
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 200 {object} models.Workflow
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/deprecation [delete]
+func (h *Handlers) UndeprecateWorkflow(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workflow ID"})
+		return
+	}
+
+	workflow, err := h.manager.UndeprecateWorkflow(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err, "workflow not found")
+		return
+	}
+	c.JSON(http.StatusOK, workflow)
+}
+
+// DeprecateVersion deprecates a workflow version
+// @Summary Deprecate a workflow version
+// @Description Marks a workflow version deprecated with an optional sunset date, replacement and sunset policy
+// @Tags deprecations
+// @Accept json
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param version_id path string true "Version ID"
+// @Param deprecation body models.Deprecation true "Deprecation"
+// @Success 200 {object} models.WorkflowVersion
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/versions/{version_id}/deprecation [put]
+func (h *Handlers) DeprecateVersion(c *gin.Context) {
+	workflowID, versionID, ok := h.versionIDs(c)
+	if !ok {
+		return
+	}
+
+	var deprecation models.Deprecation
+	if err := c.ShouldBindJSON(&deprecation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	version, err := h.manager.DeprecateVersion(c.Request.Context(), workflowID, versionID, &deprecation)
+	if err != nil {
+		h.handleError(c, err, "version not found")
+		return
+	}
+	c.JSON(http.StatusOK, version)
+}
+
+// UndeprecateVersion removes the deprecation of a workflow version
+// @Summary Undeprecate a workflow version
+// @Tags deprecations
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param version_id path string true "Version ID"
+// @Success 200 {object} models.WorkflowVersion
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/versions/{version_id}/deprecation [delete]
+func (h *Handlers) UndeprecateVersion(c *gin.Context) {
+	workflowID, versionID, ok := h.versionIDs(c)
+	if !ok {
+		return
+	}
+
+	version, err := h.manager.UndeprecateVersion(c.Request.Context(), workflowID, versionID)
+	if err != nil {
+		h.handleError(c, err, "version not found")
+		return
+	}
+	c.JSON(http.StatusOK, version)
+}
+
+// ListDeprecations lists the deprecated workflows and versions
+// @Summary List deprecations
+// @Tags deprecations
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/deprecations [get]
+func (h *Handlers) ListDeprecations(c *gin.Context) {
+	notices, err := h.manager.Notices(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deprecations": notices, "count": len(notices)})
+}
+
+// ListDependents lists the callers that executed deprecated workflows within
+// the notify window, with their deprecated dependencies
+// @Summary List callers of deprecated workflows
+// @Tags deprecations
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/deprecations/dependents [get]
+func (h *Handlers) ListDependents(c *gin.Context) {
+	digests, err := h.manager.Dependents(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dependents": digests, "count": len(digests)})
+}
+
+// SendDigests notifies the callers of deprecated workflows right away
+// @Summary Send deprecation digests
+// @Tags deprecations
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/deprecations/digests [post]
+func (h *Handlers) SendDigests(c *gin.Context) {
+	digests, err := h.manager.SendDigests(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sent": len(digests)})
+}
+
+func (h *Handlers) versionIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	workflowID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workflow ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	versionID, err := uuid.Parse(c.Param("version_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return workflowID, versionID, true
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error, notFound string) {
+	switch {
+	case errors.Is(err, ErrInvalidDeprecation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, ErrVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
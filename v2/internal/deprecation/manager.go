@@ -0,0 +1,586 @@
+package deprecation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/branding"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrSunset is returned when a workflow past its sunset date rejects an
+// execution
+var ErrSunset = errors.New("workflow is sunset")
+
+// ErrInvalidDeprecation is returned when a deprecation is invalid
+var ErrInvalidDeprecation = errors.New("invalid deprecation")
+
+// ErrVersionNotFound is returned when a version does not belong to the
+// workflow it is deprecated through
+var ErrVersionNotFound = errors.New("version not found")
+
+// SunsetError is returned when an execution of a workflow past its sunset
+// date is rejected, either by the reject policy or because it could not be
+// forwarded to the replacement
+type SunsetError struct {
+	Notice *Notice
+	// Reason explains why the execution could not be forwarded
+	Reason string
+}
+
+// Error returns the error message
+func (e *SunsetError) Error() string {
+	message := fmt.Sprintf("%s was sunset on %s", e.Notice.Subject(), e.Notice.SunsetAt.UTC().Format(time.RFC3339))
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	if e.Notice.Replacement != nil {
+		message += fmt.Sprintf("; use workflow %s instead", e.Notice.Replacement.WorkflowID)
+	}
+	return message
+}
+
+// Unwrap returns ErrSunset
+func (e *SunsetError) Unwrap() error {
+	return ErrSunset
+}
+
+// WorkflowStore loads and saves workflows. The workflow repository
+// implements it.
+type WorkflowStore interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+	Update(workflow *models.Workflow) error
+	ListDeprecated() ([]*models.Workflow, error)
+}
+
+// VersionStore loads and saves workflow versions. The workflow version
+// repository implements it.
+type VersionStore interface {
+	GetByID(id uuid.UUID) (*models.WorkflowVersion, error)
+	Update(version *models.WorkflowVersion) error
+	ListDeprecated() ([]*models.WorkflowVersion, error)
+}
+
+// Dependents describes the workflows, schedules and webhook triggers a
+// change to a workflow breaks. The dependencies Graph implements it.
+type Dependents interface {
+	DependentWarnings(ctx context.Context, workflowID uuid.UUID) ([]string, error)
+}
+
+// Watch publishes the workflows deprecated to the watchers of workflow
+// definitions. The watch Hub implements it.
+type Watch interface {
+	WorkflowDeprecated(ctx context.Context, workflow *models.Workflow)
+}
+
+// Config configures deprecation notifications
+type Config struct {
+	// NotifyWindow is how far back an execution makes its caller a
+	// dependent of a deprecated workflow
+	NotifyWindow time.Duration
+}
+
+// DefaultConfig returns the default deprecation configuration
+func DefaultConfig() Config {
+	return Config{NotifyWindow: 30 * 24 * time.Hour}
+}
+
+// Resolution is the workflow an execution runs once the deprecation of the
+// requested workflow is applied
+type Resolution struct {
+	Workflow *models.Workflow
+	// Version is the pinned version the execution runs, nil for the
+	// current version
+	Version *models.WorkflowVersion
+	Input   map[string]interface{}
+	// Notice describes the deprecation of the requested workflow, nil when
+	// it is not deprecated
+	Notice *Notice
+	// ForwardedFrom is the sunset workflow the execution was forwarded from
+	ForwardedFrom *uuid.UUID
+}
+
+// Manager deprecates workflows and workflow versions, applies their sunset
+// policies to executions and notifies the callers depending on them
+type Manager struct {
+	config    Config
+	workflows WorkflowStore
+	versions  VersionStore
+	usage     UsageStore
+	notifier  Notifier
+	// dependents warns about the dependents of deprecated workflows
+	dependents Dependents
+	watch      Watch
+	logger     *logrus.Logger
+	now        func() time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager creates a deprecation manager. versions and notifier may be
+// nil.
+func NewManager(config Config, workflows WorkflowStore, versions VersionStore, usage UsageStore, notifier Notifier, logger *logrus.Logger) *Manager {
+	if config.NotifyWindow <= 0 {
+		config.NotifyWindow = DefaultConfig().NotifyWindow
+	}
+	return &Manager{
+		config:    config,
+		workflows: workflows,
+		versions:  versions,
+		usage:     usage,
+		notifier:  notifier,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// SetDependents sets the dependency graph deprecated workflows are looked
+// up in to warn about the workflows depending on them
+func (m *Manager) SetDependents(dependents Dependents) {
+	m.dependents = dependents
+}
+
+// SetWatch sets where the workflows deprecated are published
+func (m *Manager) SetWatch(watch Watch) {
+	m.watch = watch
+}
+
+// DependentWarnings describes what the deprecation of a workflow breaks. It
+// is empty without a dependency graph.
+func (m *Manager) DependentWarnings(ctx context.Context, workflowID uuid.UUID) []string {
+	if m.dependents == nil {
+		return nil
+	}
+	warnings, err := m.dependents.DependentWarnings(ctx, workflowID)
+	if err != nil {
+		m.logger.WithError(err).WithField("workflow_id", workflowID).Warn("Failed to look up dependents of deprecated workflow")
+		return nil
+	}
+	return warnings
+}
+
+// DeprecateWorkflow deprecates a workflow. The deprecation date defaults to
+// now.
+func (m *Manager) DeprecateWorkflow(ctx context.Context, workflowID uuid.UUID, deprecation *models.Deprecation) (*models.Workflow, error) {
+	workflow, err := m.workflows.GetByID(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.prepare(deprecation, workflowID, nil); err != nil {
+		return nil, err
+	}
+
+	workflow.Deprecation = deprecation
+	if err := m.workflows.Update(workflow); err != nil {
+		return nil, fmt.Errorf("failed to deprecate workflow: %w", err)
+	}
+	if m.watch != nil {
+		m.watch.WorkflowDeprecated(ctx, workflow)
+	}
+	return workflow, nil
+}
+
+// UndeprecateWorkflow removes the deprecation of a workflow
+func (m *Manager) UndeprecateWorkflow(ctx context.Context, workflowID uuid.UUID) (*models.Workflow, error) {
+	workflow, err := m.workflows.GetByID(workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	workflow.Deprecation = nil
+	if err := m.workflows.Update(workflow); err != nil {
+		return nil, fmt.Errorf("failed to undeprecate workflow: %w", err)
+	}
+	return workflow, nil
+}
+
+// DeprecateVersion deprecates a workflow version. The deprecation date
+// defaults to now.
+func (m *Manager) DeprecateVersion(ctx context.Context, workflowID, versionID uuid.UUID, deprecation *models.Deprecation) (*models.WorkflowVersion, error) {
+	version, err := m.version(workflowID, versionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.prepare(deprecation, version.WorkflowID, &version.ID); err != nil {
+		return nil, err
+	}
+
+	version.Deprecation = deprecation
+	if err := m.versions.Update(version); err != nil {
+		return nil, fmt.Errorf("failed to deprecate version: %w", err)
+	}
+	return version, nil
+}
+
+// UndeprecateVersion removes the deprecation of a workflow version
+func (m *Manager) UndeprecateVersion(ctx context.Context, workflowID, versionID uuid.UUID) (*models.WorkflowVersion, error) {
+	version, err := m.version(workflowID, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	version.Deprecation = nil
+	if err := m.versions.Update(version); err != nil {
+		return nil, fmt.Errorf("failed to undeprecate version: %w", err)
+	}
+	return version, nil
+}
+
+// version loads a version of a workflow
+func (m *Manager) version(workflowID, versionID uuid.UUID) (*models.WorkflowVersion, error) {
+	if m.versions == nil {
+		return nil, errors.New("workflow versions are not available")
+	}
+	version, err := m.versions.GetByID(versionID)
+	if err != nil {
+		return nil, err
+	}
+	if version.WorkflowID != workflowID {
+		return nil, ErrVersionNotFound
+	}
+	return version, nil
+}
+
+// prepare defaults and validates a deprecation of a workflow or version. The
+// replacement must exist and must not be the deprecated workflow or version
+// itself.
+func (m *Manager) prepare(deprecation *models.Deprecation, workflowID uuid.UUID, versionID *uuid.UUID) error {
+	if deprecation.DeprecatedAt.IsZero() {
+		deprecation.DeprecatedAt = m.now().UTC()
+	}
+	if deprecation.SunsetPolicy == "" {
+		deprecation.SunsetPolicy = models.SunsetPolicyWarn
+	}
+	if err := deprecation.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDeprecation, err)
+	}
+
+	replacement := deprecation.Replacement
+	if replacement == nil {
+		return nil
+	}
+	sameVersion := versionID != nil && replacement.VersionID != nil && *replacement.VersionID == *versionID
+	if replacement.WorkflowID == workflowID && (versionID == nil || sameVersion) {
+		return fmt.Errorf("%w: a workflow cannot be its own replacement", ErrInvalidDeprecation)
+	}
+	if _, err := m.workflows.GetByID(replacement.WorkflowID); err != nil {
+		return fmt.Errorf("%w: failed to load replacement workflow %s: %v", ErrInvalidDeprecation, replacement.WorkflowID, err)
+	}
+	return nil
+}
+
+// Resolve applies the deprecation of a workflow, or of the version an
+// execution is pinned to, to an execution. Executions of deprecated
+// workflows carry a notice. After the sunset date the workflow's sunset
+// policy applies: executions are rejected with a SunsetError or forwarded to
+// the replacement with the mapped input. Executions that cannot be forwarded
+// are rejected.
+func (m *Manager) Resolve(ctx context.Context, workflow *models.Workflow, versionID *uuid.UUID, input map[string]interface{}) (*Resolution, error) {
+	resolution := &Resolution{Workflow: workflow, Input: input}
+	if versionID != nil && m.versions != nil {
+		version, err := m.versions.GetByID(*versionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load version %s: %w", versionID, err)
+		}
+		resolution.Version = version
+	}
+
+	deprecation, deprecatedVersion := workflow.Deprecation, (*models.WorkflowVersion)(nil)
+	if resolution.Version != nil && resolution.Version.Deprecation != nil {
+		deprecation, deprecatedVersion = resolution.Version.Deprecation, resolution.Version
+	}
+	if deprecation == nil {
+		return resolution, nil
+	}
+
+	now := m.now()
+	resolution.Notice = NewNotice(workflow, deprecatedVersion, deprecation, now)
+	if !resolution.Notice.Sunset {
+		return resolution, nil
+	}
+
+	switch deprecation.SunsetPolicy {
+	case models.SunsetPolicyReject:
+		return nil, &SunsetError{Notice: resolution.Notice}
+	case models.SunsetPolicyForward:
+		return m.forward(ctx, resolution, deprecation.Replacement, now)
+	default:
+		return resolution, nil
+	}
+}
+
+// forward resolves an execution of a sunset workflow to its replacement
+func (m *Manager) forward(ctx context.Context, resolution *Resolution, replacement *models.Replacement, now time.Time) (*Resolution, error) {
+	notice := resolution.Notice
+	if replacement == nil || len(replacement.InputMapping) == 0 {
+		return nil, &SunsetError{Notice: notice, Reason: "no input mapping to forward executions to the replacement"}
+	}
+
+	target, err := m.workflows.GetByID(replacement.WorkflowID)
+	if err != nil {
+		return nil, &SunsetError{Notice: notice, Reason: fmt.Sprintf("failed to load the replacement: %v", err)}
+	}
+	if target.Deprecation != nil && target.Deprecation.IsSunset(now) {
+		return nil, &SunsetError{Notice: notice, Reason: "the replacement is sunset too"}
+	}
+
+	forwarded := &Resolution{Workflow: target, Notice: notice, ForwardedFrom: &resolution.Workflow.ID}
+	schema := target.InputSchema
+	if replacement.VersionID != nil {
+		if m.versions == nil {
+			return nil, &SunsetError{Notice: notice, Reason: "workflow versions are not available to forward to the replacement version"}
+		}
+		version, err := m.versions.GetByID(*replacement.VersionID)
+		if err != nil {
+			return nil, &SunsetError{Notice: notice, Reason: fmt.Sprintf("failed to load the replacement version: %v", err)}
+		}
+		forwarded.Version = version
+		schema = version.InputSchema
+	}
+
+	forwarded.Input = MapInput(replacement.InputMapping, resolution.Input)
+	if errs := schema.Validate(forwarded.Input); len(errs) > 0 {
+		return nil, &SunsetError{Notice: notice, Reason: "mapped input does not match the replacement: " + strings.Join(errs, "; ")}
+	}
+	return forwarded, nil
+}
+
+// MapInput builds the input of a replacement workflow. mapping maps its
+// fields to dot separated paths in input. Fields whose path is not in input
+// are left out.
+func MapInput(mapping map[string]string, input map[string]interface{}) map[string]interface{} {
+	mapped := make(map[string]interface{}, len(mapping))
+	for field, path := range mapping {
+		if value, ok := lookup(input, path); ok {
+			mapped[field] = value
+		}
+	}
+	return mapped
+}
+
+func lookup(input map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = input
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// RecordExecution records that a caller executed a workflow version. Calls
+// without a caller are not recorded.
+func (m *Manager) RecordExecution(ctx context.Context, caller string, workflowID uuid.UUID, version string) error {
+	if caller == "" {
+		return nil
+	}
+	return m.usage.RecordExecution(ctx, caller, workflowID, version, m.now().UTC())
+}
+
+// Notices returns the notices of the deprecated workflows and versions
+func (m *Manager) Notices(ctx context.Context) ([]*Notice, error) {
+	now := m.now()
+
+	workflows, err := m.workflows.ListDeprecated()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deprecated workflows: %w", err)
+	}
+	var notices []*Notice
+	for _, workflow := range workflows {
+		notices = append(notices, NewNotice(workflow, nil, workflow.Deprecation, now))
+	}
+
+	if m.versions != nil {
+		versions, err := m.versions.ListDeprecated()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deprecated versions: %w", err)
+		}
+		loaded := make(map[uuid.UUID]*models.Workflow)
+		for _, version := range versions {
+			workflow, exists := loaded[version.WorkflowID]
+			if !exists {
+				if workflow, err = m.workflows.GetByID(version.WorkflowID); err != nil {
+					return nil, fmt.Errorf("failed to load workflow of version %s: %w", version.ID, err)
+				}
+				loaded[version.WorkflowID] = workflow
+			}
+			notices = append(notices, NewNotice(workflow, version, version.Deprecation, now))
+		}
+	}
+
+	sort.SliceStable(notices, func(i, j int) bool {
+		if notices[i].WorkflowName != notices[j].WorkflowName {
+			return notices[i].WorkflowName < notices[j].WorkflowName
+		}
+		return notices[i].Version < notices[j].Version
+	})
+	return notices, nil
+}
+
+// Dependency is a deprecated workflow or version a caller executed within
+// the notify window
+type Dependency struct {
+	Notice *Notice `json:"notice"`
+	// Version is the version the caller executed
+	Version        string    `json:"version"`
+	Executions     int64     `json:"executions"`
+	LastExecutedAt time.Time `json:"last_executed_at"`
+}
+
+// Digest lists the deprecated dependencies of a caller
+type Digest struct {
+	Caller       string        `json:"caller"`
+	Dependencies []*Dependency `json:"dependencies"`
+	Since        time.Time     `json:"since"`
+}
+
+// Dependents returns a digest for each caller that executed a deprecated
+// workflow or version within the notify window, ordered by caller
+func (m *Manager) Dependents(ctx context.Context) ([]*Digest, error) {
+	notices, err := m.Notices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(notices) == 0 {
+		return nil, nil
+	}
+
+	since := m.now().Add(-m.config.NotifyWindow).UTC()
+	usages, err := m.usage.ExecutedSince(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load caller usage: %w", err)
+	}
+
+	var digests []*Digest
+	byCaller := make(map[string]*Digest)
+	for _, usage := range usages {
+		for _, notice := range notices {
+			if notice.WorkflowID != usage.WorkflowID || (notice.Version != "" && notice.Version != usage.Version) {
+				continue
+			}
+			digest, exists := byCaller[usage.Caller]
+			if !exists {
+				digest = &Digest{Caller: usage.Caller, Since: since}
+				byCaller[usage.Caller] = digest
+				digests = append(digests, digest)
+			}
+			digest.Dependencies = append(digest.Dependencies, &Dependency{
+				Notice:         notice,
+				Version:        usage.Version,
+				Executions:     usage.Executions,
+				LastExecutedAt: usage.LastExecutedAt,
+			})
+		}
+	}
+
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i].Caller < digests[j].Caller
+	})
+	return digests, nil
+}
+
+// SendDigests notifies each caller depending on deprecated workflows and
+// returns the digests sent
+func (m *Manager) SendDigests(ctx context.Context) ([]*Digest, error) {
+	digests, err := m.Dependents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if m.notifier != nil {
+		for _, digest := range digests {
+			m.notifier.NotifyDependencies(ctx, digest)
+		}
+	}
+	return digests, nil
+}
+
+// Start sends digests at the given interval until Stop is called
+func (m *Manager) Start(ctx context.Context, interval time.Duration) {
+	m.stopCh = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.SendDigests(ctx); err != nil {
+					m.logger.WithError(err).Error("Failed to send deprecation digests")
+				}
+			case <-m.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops sending digests
+func (m *Manager) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.stopCh = nil
+}
+
+// Notifier tells callers about the deprecated workflows they depend on
+type Notifier interface {
+	NotifyDependencies(ctx context.Context, digest *Digest)
+}
+
+// LogNotifier notifies callers of their deprecated dependencies through the
+// log, for operators to forward
+type LogNotifier struct {
+	logger *logrus.Logger
+	// messages resolves the digest text in the branding and locale of the
+	// default namespace, English when nil
+	messages branding.Resolver
+}
+
+// NewLogNotifier creates a notifier logging digests as warnings
+func NewLogNotifier(logger *logrus.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// SetMessages sets the resolver of the localized digest text
+func (n *LogNotifier) SetMessages(resolver branding.Resolver) {
+	n.messages = resolver
+}
+
+// NotifyDependencies logs the deprecated dependencies of a caller
+func (n *LogNotifier) NotifyDependencies(ctx context.Context, digest *Digest) {
+	subjects := make([]string, 0, len(digest.Dependencies))
+	for _, dependency := range digest.Dependencies {
+		subjects = append(subjects, dependency.Notice.Subject())
+	}
+	var messages *branding.Messages
+	if n.messages != nil {
+		messages = n.messages.Messages(branding.DefaultNamespace, "")
+	}
+	n.logger.WithFields(logrus.Fields{
+		"notification": "deprecation_digest",
+		"caller":       digest.Caller,
+		"dependencies": len(digest.Dependencies),
+	}).Warn(messages.Format("digest.deprecation",
+		"caller", digest.Caller,
+		"since", digest.Since.Format(time.RFC3339),
+		"subjects", strings.Join(subjects, ", ")))
+}
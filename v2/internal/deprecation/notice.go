@@ -0,0 +1,85 @@
+package deprecation
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// Notice describes the deprecation of a workflow or workflow version to the
+// callers executing it
+type Notice struct {
+	WorkflowID   uuid.UUID `json:"workflow_id"`
+	WorkflowName string    `json:"workflow_name"`
+	// Version is the deprecated version, empty when the whole workflow is
+	// deprecated
+	Version      string              `json:"version,omitempty"`
+	DeprecatedAt time.Time           `json:"deprecated_at"`
+	SunsetAt     *time.Time          `json:"sunset_at,omitempty"`
+	Reason       string              `json:"reason,omitempty"`
+	Replacement  *models.Replacement `json:"replacement,omitempty"`
+	SunsetPolicy models.SunsetPolicy `json:"sunset_policy"`
+	// Sunset reports whether the sunset date has passed
+	Sunset bool `json:"sunset"`
+}
+
+// NewNotice creates the notice of a deprecation of a workflow, or of one of
+// its versions when version is not nil
+func NewNotice(workflow *models.Workflow, version *models.WorkflowVersion, deprecation *models.Deprecation, now time.Time) *Notice {
+	notice := &Notice{
+		WorkflowID:   workflow.ID,
+		WorkflowName: workflow.Name,
+		DeprecatedAt: deprecation.DeprecatedAt,
+		SunsetAt:     deprecation.SunsetAt,
+		Reason:       deprecation.Reason,
+		Replacement:  deprecation.Replacement,
+		SunsetPolicy: deprecation.SunsetPolicy,
+		Sunset:       deprecation.IsSunset(now),
+	}
+	if version != nil {
+		notice.Version = version.Version
+	}
+	return notice
+}
+
+// Subject returns the name of the deprecated workflow or version
+func (n *Notice) Subject() string {
+	if n.Version != "" {
+		return fmt.Sprintf("workflow %s version %s", n.WorkflowName, n.Version)
+	}
+	return fmt.Sprintf("workflow %s", n.WorkflowName)
+}
+
+// Warning returns the warning included in execute responses
+func (n *Notice) Warning() string {
+	warning := n.Subject() + " is deprecated"
+	switch {
+	case n.Sunset:
+		warning += fmt.Sprintf(" and was sunset on %s", n.SunsetAt.UTC().Format(time.RFC3339))
+	case n.SunsetAt != nil:
+		warning += fmt.Sprintf(" and will be sunset on %s", n.SunsetAt.UTC().Format(time.RFC3339))
+	}
+	if n.Reason != "" {
+		warning += ": " + n.Reason
+	}
+	if n.Replacement != nil {
+		warning += fmt.Sprintf("; use workflow %s instead", n.Replacement.WorkflowID)
+	}
+	return warning
+}
+
+// SetHeaders sets the Deprecation (RFC 9745) and Sunset (RFC 8594) headers of
+// a response, and links the replacement workflow as its successor version
+func (n *Notice) SetHeaders(header http.Header) {
+	header.Set("Deprecation", fmt.Sprintf("@%d", n.DeprecatedAt.Unix()))
+	if n.SunsetAt != nil {
+		header.Set("Sunset", n.SunsetAt.UTC().Format(http.TimeFormat))
+	}
+	if n.Replacement != nil {
+		header.Add("Link", fmt.Sprintf(`</api/v1/workflows/%s>; rel="successor-version"`, n.Replacement.WorkflowID))
+	}
+}
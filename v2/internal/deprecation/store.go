@@ -0,0 +1,154 @@
+package deprecation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Usage records how often a caller executed a workflow version and when it
+// last did
+type Usage struct {
+	Caller         string    `json:"caller" gorm:"primaryKey"`
+	WorkflowID     uuid.UUID `json:"workflow_id" gorm:"type:uuid;primaryKey"`
+	Version        string    `json:"version" gorm:"primaryKey"`
+	Executions     int64     `json:"executions"`
+	LastExecutedAt time.Time `json:"last_executed_at" gorm:"index"`
+}
+
+// TableName returns the table name for the Usage model
+func (Usage) TableName() string {
+	return "workflow_caller_usages"
+}
+
+// CallerFromAPIKey identifies the caller using an API key by a fingerprint
+// of the key, so usage records never hold the key itself. It returns an
+// empty string for an empty key.
+func CallerFromAPIKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key_" + hex.EncodeToString(sum[:8])
+}
+
+// UsageStore persists which callers execute which workflows
+type UsageStore interface {
+	// RecordExecution records an execution of a workflow version by a caller
+	RecordExecution(ctx context.Context, caller string, workflowID uuid.UUID, version string, at time.Time) error
+	// ExecutedSince returns the usages of the callers that executed a
+	// workflow at or after a time, ordered by caller, workflow and version
+	ExecutedSince(ctx context.Context, since time.Time) ([]*Usage, error)
+}
+
+type usageKey struct {
+	caller     string
+	workflowID uuid.UUID
+	version    string
+}
+
+// MemoryStore is an in-memory UsageStore
+type MemoryStore struct {
+	mu     sync.Mutex
+	usages map[usageKey]*Usage
+}
+
+// NewMemoryStore creates an in-memory usage store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{usages: make(map[usageKey]*Usage)}
+}
+
+// RecordExecution records an execution of a workflow version by a caller
+func (s *MemoryStore) RecordExecution(ctx context.Context, caller string, workflowID uuid.UUID, version string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := usageKey{caller: caller, workflowID: workflowID, version: version}
+	usage, exists := s.usages[key]
+	if !exists {
+		usage = &Usage{Caller: caller, WorkflowID: workflowID, Version: version}
+		s.usages[key] = usage
+	}
+	usage.Executions++
+	if at.After(usage.LastExecutedAt) {
+		usage.LastExecutedAt = at
+	}
+	return nil
+}
+
+// ExecutedSince returns the usages of the callers that executed a workflow
+// at or after a time
+func (s *MemoryStore) ExecutedSince(ctx context.Context, since time.Time) ([]*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var usages []*Usage
+	for _, usage := range s.usages {
+		if !usage.LastExecutedAt.Before(since) {
+			found := *usage
+			usages = append(usages, &found)
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Caller != usages[j].Caller {
+			return usages[i].Caller < usages[j].Caller
+		}
+		if usages[i].WorkflowID != usages[j].WorkflowID {
+			return usages[i].WorkflowID.String() < usages[j].WorkflowID.String()
+		}
+		return usages[i].Version < usages[j].Version
+	})
+	return usages, nil
+}
+
+// GormStore keeps the usages in the workflow_caller_usages table, one row
+// per caller and workflow version, counted up by an upsert on every execution
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database usage store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the caller usages table
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Usage{})
+}
+
+// RecordExecution records an execution of a workflow version by a caller
+func (s *GormStore) RecordExecution(ctx context.Context, caller string, workflowID uuid.UUID, version string, at time.Time) error {
+	usage := &Usage{
+		Caller:         caller,
+		WorkflowID:     workflowID,
+		Version:        version,
+		Executions:     1,
+		LastExecutedAt: at,
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "caller"}, {Name: "workflow_id"}, {Name: "version"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "executions"}, Value: gorm.Expr("workflow_caller_usages.executions + 1")},
+			{Column: clause.Column{Name: "last_executed_at"}, Value: gorm.Expr("GREATEST(workflow_caller_usages.last_executed_at, excluded.last_executed_at)")},
+		},
+	}).Create(usage).Error
+}
+
+// ExecutedSince returns the usages of the callers that executed a workflow
+// at or after a time
+func (s *GormStore) ExecutedSince(ctx context.Context, since time.Time) ([]*Usage, error) {
+	var usages []*Usage
+	err := s.db.WithContext(ctx).
+		Where("last_executed_at >= ?", since).
+		Order("caller, workflow_id, version").
+		Find(&usages).Error
+	return usages, err
+}
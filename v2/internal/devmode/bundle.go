@@ -0,0 +1,175 @@
+package devmode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"magic-flow/v2/internal/debugbundle"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrDefinitionExists is returned when importing a bundle whose workflow
+// already has a definition file in the workflow directory
+var ErrDefinitionExists = errors.New("workflow definition already exists")
+
+// inputSuffix is the suffix of the file holding the input of a workflow,
+// next to its definition file
+const inputSuffix = ".input.json"
+
+// unsafeFileChars are replaced in the file names of imported workflows
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ImportedBundle is a debug bundle imported to the workflow directory
+type ImportedBundle struct {
+	Workflow       string `json:"workflow"`
+	DefinitionPath string `json:"definition_path"`
+	// InputPath is empty for reduced bundles, which hold no input
+	InputPath string   `json:"input_path,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// ImportBundle writes the workflow definition and the input of the
+// execution of a debug bundle to a workflow directory, as <name>.yaml and
+// <name>.input.json, so the execution can be reproduced in the playground.
+// Existing files are only replaced when overwrite is set.
+func ImportBundle(bundle *debugbundle.Bundle, dir string, overwrite bool) (*ImportedBundle, error) {
+	var definition debugbundle.Definition
+	if err := bundle.Decode(debugbundle.DefinitionFile, &definition); err != nil {
+		return nil, err
+	}
+	var execution models.Execution
+	if err := bundle.Decode(debugbundle.ExecutionFile, &execution); err != nil {
+		return nil, err
+	}
+	if definition.Name == "" {
+		return nil, fmt.Errorf("%w: the workflow has no name", debugbundle.ErrInvalidBundle)
+	}
+
+	content, err := yaml.Marshal(playgroundDefinition(&definition))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the workflow definition: %w", err)
+	}
+
+	base := filepath.Join(dir, unsafeFileChars.ReplaceAllString(definition.Name, "_"))
+	imported := &ImportedBundle{
+		Workflow:       definition.Name,
+		DefinitionPath: base + ".yaml",
+	}
+	if !overwrite {
+		if _, err := os.Stat(imported.DefinitionPath); err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrDefinitionExists, imported.DefinitionPath)
+		}
+	}
+
+	if definition.Source != debugbundle.DefinitionSourceVersion {
+		imported.Warnings = append(imported.Warnings, "the bundle holds the definition of the workflow, the version the execution ran was not found")
+	}
+	if strings.Contains(string(content), debugbundle.RedactedValue) {
+		imported.Warnings = append(imported.Warnings, "the definition holds redacted values, replace them before executing the workflow")
+	}
+
+	var input []byte
+	if bundle.Manifest.Level == debugbundle.LevelFull {
+		if execution.InputData == nil {
+			execution.InputData = map[string]interface{}{}
+		}
+		input, err = json.MarshalIndent(execution.InputData, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the execution input: %w", err)
+		}
+		imported.InputPath = base + inputSuffix
+	} else {
+		imported.Warnings = append(imported.Warnings, "the bundle is reduced and holds no execution input")
+	}
+
+	// The input is written first, so the watcher reloading the definition
+	// finds it
+	if input != nil {
+		if err := os.WriteFile(imported.InputPath, append(input, '\n'), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write the execution input: %w", err)
+		}
+	}
+	if err := os.WriteFile(imported.DefinitionPath, content, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write the workflow definition: %w", err)
+	}
+	return imported, nil
+}
+
+// playgroundDefinition converts a bundled definition to the format of the
+// playground definition files: a name, steps and optional inputs and
+// outputs
+func playgroundDefinition(definition *debugbundle.Definition) map[string]interface{} {
+	result := map[string]interface{}{
+		"name":  definition.Name,
+		"steps": definition.Definition.Spec.Steps,
+	}
+	if definition.Description != "" {
+		result["description"] = definition.Description
+	}
+
+	inputSchema := definition.InputSchema
+	if len(inputSchema.Properties) == 0 {
+		inputSchema = definition.Definition.Spec.InputSchema
+	}
+	if inputs := schemaFields(inputSchema); len(inputs) > 0 {
+		result["inputs"] = inputs
+	}
+	outputSchema := definition.OutputSchema
+	if len(outputSchema.Properties) == 0 {
+		outputSchema = definition.Definition.Spec.OutputSchema
+	}
+	if outputs := schemaFields(outputSchema); len(outputs) > 0 {
+		result["outputs"] = outputs
+	}
+	return result
+}
+
+// schemaFields converts an object schema to the fields of a definition, the
+// reverse of fieldsSchema
+func schemaFields(schema models.JSONSchema) map[string]interface{} {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	fields := make(map[string]interface{}, len(schema.Properties))
+	for name, property := range schema.Properties {
+		field := make(map[string]interface{})
+		if definition, ok := property.(map[string]interface{}); ok {
+			for key, value := range definition {
+				field[key] = value
+			}
+		}
+		if required[name] {
+			field["required"] = true
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// readInput reads the input file next to a workflow definition, nil when
+// there is none
+func readInput(definitionPath string) (map[string]interface{}, error) {
+	path := strings.TrimSuffix(definitionPath, filepath.Ext(definitionPath)) + inputSuffix
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+
+	var input map[string]interface{}
+	if err := json.Unmarshal(content, &input); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return input, nil
+}
@@ -0,0 +1,294 @@
+package devmode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"magic-flow/v2/internal/debugbundle"
+	"magic-flow/v2/internal/versioning"
+	"magic-flow/v2/pkg/models"
+)
+
+const ordersDefinition = `name: orders
+description: Processes an order
+inputs:
+  order_id:
+    type: string
+    required: true
+steps:
+  - name: fetch
+    type: http
+    config:
+      url: https://orders.internal/orders
+`
+
+const ordersDefinitionV2 = `name: orders
+description: Processes an order
+inputs:
+  order_id:
+    type: string
+    required: true
+steps:
+  - name: fetch
+    type: http
+    config:
+      url: https://orders.internal/orders
+  - name: notify
+    type: http
+    config:
+      url: https://notifications.internal/send
+      method: POST
+      retries: 3
+`
+
+// recordingExecutor records the workflows it executes
+type recordingExecutor struct {
+	mu       sync.Mutex
+	executed []*models.Workflow
+}
+
+func (r *recordingExecutor) ExecuteWorkflow(ctx context.Context, workflow *models.Workflow, input map[string]interface{}, config map[string]interface{}) (*models.Execution, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.executed = append(r.executed, workflow)
+	return &models.Execution{ID: uuid.New(), WorkflowID: workflow.ID}, nil
+}
+
+func newTestPlayground(t *testing.T, files map[string]string) (*Playground, *recordingExecutor, string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	executor := &recordingExecutor{}
+	playground, err := New(Options{Dir: dir, Environment: "development"}, executor, versioning.NewValidator(nil), logger)
+	require.NoError(t, err)
+
+	require.NoError(t, playground.Start(context.Background()))
+	t.Cleanup(playground.Stop)
+	return playground, executor, dir
+}
+
+// eventuallyWorkflow waits for the watcher to settle the named workflow in
+// the expected state
+func eventuallyWorkflow(t *testing.T, playground *Playground, name string, check func(*Workflow) bool) *Workflow {
+	var workflow *Workflow
+	require.Eventually(t, func() bool {
+		var err error
+		workflow, err = playground.Get(name)
+		return err == nil && check(workflow)
+	}, 5*time.Second, 20*time.Millisecond)
+	return workflow
+}
+
+func TestReloadOnFileChange(t *testing.T) {
+	ctx := context.Background()
+	playground, executor, dir := newTestPlayground(t, map[string]string{"orders.yaml": ordersDefinition})
+
+	workflow, err := playground.Get("orders")
+	require.NoError(t, err)
+	assert.Equal(t, 1, workflow.Revision)
+	assert.Equal(t, "dev.1", workflow.Workflow.Version)
+	assert.Equal(t, []string{"order_id"}, workflow.Workflow.InputSchema.Required)
+	assert.Len(t, workflow.Workflow.Definition.Spec.Steps, 1)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders.yaml"), []byte(ordersDefinitionV2), 0o644))
+	reloaded := eventuallyWorkflow(t, playground, "orders", func(w *Workflow) bool { return w.Revision == 2 })
+
+	assert.Equal(t, "dev.2", reloaded.Workflow.Version)
+	assert.Equal(t, workflow.Workflow.ID, reloaded.Workflow.ID, "revisions are versions of the same workflow")
+	assert.Len(t, reloaded.Workflow.Definition.Spec.Steps, 2)
+	assert.Len(t, reloaded.Warnings, 1, "validator findings are reported")
+	assert.Contains(t, reloaded.Warnings[0], "retries")
+
+	_, err = playground.Execute(ctx, "orders", map[string]interface{}{"order_id": "o-1"})
+	require.NoError(t, err)
+	require.Len(t, executor.executed, 1)
+	assert.Equal(t, "dev.2", executor.executed[0].Version, "executions run the latest revision")
+
+	t.Run("new files are loaded", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "refunds.yml"), []byte("name: refunds\nsteps:\n  - name: refund\n    type: http\n    config:\n      url: https://refunds.internal\n"), 0o644))
+		eventuallyWorkflow(t, playground, "refunds", func(w *Workflow) bool { return w.Revision == 1 })
+	})
+
+	t.Run("deleted files are removed", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(dir, "refunds.yml")))
+		require.Eventually(t, func() bool {
+			_, err := playground.Get("refunds")
+			return errors.Is(err, ErrWorkflowNotFound)
+		}, 5*time.Second, 20*time.Millisecond)
+	})
+}
+
+func TestDefinitionErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	playground, executor, dir := newTestPlayground(t, map[string]string{
+		"orders.yaml": ordersDefinition,
+		"broken.yaml": "name: broken\nsteps: [\n",
+	})
+	path := filepath.Join(dir, "orders.yaml")
+
+	router := gin.New()
+	NewHandlers(playground).RegisterRoutes(router.Group("/api"))
+	listWorkflows := func() map[string]Workflow {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/dev/workflows", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var workflows []Workflow
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &workflows))
+		byName := make(map[string]Workflow)
+		for _, workflow := range workflows {
+			byName[workflow.Name] = workflow
+		}
+		return byName
+	}
+
+	t.Run("parse errors", func(t *testing.T) {
+		broken := listWorkflows()["broken"]
+		assert.Contains(t, broken.Error, "failed to parse broken.yaml")
+		assert.Nil(t, broken.Workflow)
+
+		_, err := playground.Execute(ctx, "broken", nil)
+		assert.ErrorIs(t, err, ErrWorkflowInvalid)
+	})
+
+	t.Run("validation errors keep the last good revision", func(t *testing.T) {
+		invalid := "name: orders\nsteps:\n  - name: fetch\n    type: teleport\n"
+		require.NoError(t, os.WriteFile(path, []byte(invalid), 0o644))
+		eventuallyWorkflow(t, playground, "orders", func(w *Workflow) bool { return w.Error != "" })
+
+		orders := listWorkflows()["orders"]
+		assert.Contains(t, orders.Error, "unsupported step type: teleport")
+		assert.Equal(t, 1, orders.Revision)
+
+		_, err := playground.Execute(ctx, "orders", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "dev.1", executor.executed[0].Version)
+	})
+
+	t.Run("the watcher survives errors", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("steps: {{{"), 0o644))
+		eventuallyWorkflow(t, playground, "orders", func(w *Workflow) bool { return w.Error != "" && w.Revision == 1 })
+
+		require.NoError(t, os.WriteFile(path, []byte(ordersDefinitionV2), 0o644))
+		fixed := eventuallyWorkflow(t, playground, "orders", func(w *Workflow) bool { return w.Revision == 2 })
+		assert.Empty(t, fixed.Error)
+	})
+}
+
+func TestRefusesProduction(t *testing.T) {
+	_, err := New(Options{Dir: t.TempDir(), Environment: "production"}, &recordingExecutor{}, versioning.NewValidator(nil), logrus.New())
+	assert.ErrorIs(t, err, ErrProductionEnvironment)
+}
+
+type bundleExecutions map[uuid.UUID]*models.Execution
+
+func (s bundleExecutions) GetByID(id uuid.UUID) (*models.Execution, error) {
+	return s[id], nil
+}
+
+type bundleWorkflows map[uuid.UUID]*models.Workflow
+
+func (s bundleWorkflows) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	return s[id], nil
+}
+
+// buildBundle builds the debug bundle of an execution of the orders
+// workflow as the server would, read back from its archive
+func buildBundle(t *testing.T, level debugbundle.Level) (*debugbundle.Bundle, *models.Workflow, *models.Execution) {
+	t.Helper()
+	var definition map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(ordersDefinitionV2), &definition))
+	workflow, err := buildWorkflow(uuid.New(), 1, definition)
+	require.NoError(t, err)
+	workflow.Version = "1.0.0"
+
+	execution := &models.Execution{
+		ID:         uuid.New(),
+		WorkflowID: workflow.ID,
+		Status:     models.ExecutionStatusFailed,
+		InputData:  map[string]interface{}{"order_id": "ord-1042", "quantity": float64(3)},
+		Context:    models.ExecutionContext{WorkflowName: "orders", WorkflowVersion: "1.0.0"},
+	}
+	builder := debugbundle.NewBuilder(debugbundle.Sources{
+		Executions: bundleExecutions{execution.ID: execution},
+		Workflows:  bundleWorkflows{workflow.ID: workflow},
+	}, debugbundle.Config{Version: "2.0.0"})
+
+	bundle, err := builder.Build(context.Background(), execution.ID, level)
+	require.NoError(t, err)
+	archive, err := bundle.Archive()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	require.NoError(t, os.WriteFile(path, archive, 0o644))
+
+	bundle, err = debugbundle.Open(path)
+	require.NoError(t, err)
+	return bundle, workflow, execution
+}
+
+func TestImportBundle(t *testing.T) {
+	ctx := context.Background()
+	playground, executor, dir := newTestPlayground(t, nil)
+	bundle, original, execution := buildBundle(t, debugbundle.LevelFull)
+
+	imported, err := ImportBundle(bundle, dir, false)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", imported.Workflow)
+	assert.Equal(t, filepath.Join(dir, "orders.yaml"), imported.DefinitionPath)
+	assert.Equal(t, filepath.Join(dir, "orders.input.json"), imported.InputPath)
+	assert.Equal(t, []string{"the bundle holds the definition of the workflow, the version the execution ran was not found"}, imported.Warnings)
+
+	// The imported definition loads in the playground as the workflow the
+	// execution ran, with its input
+	workflow := eventuallyWorkflow(t, playground, "orders", func(w *Workflow) bool { return w.Revision == 1 })
+	assert.Empty(t, workflow.Error)
+	assert.Equal(t, original.Description, workflow.Workflow.Description)
+	assert.Equal(t, original.InputSchema, workflow.Workflow.InputSchema)
+	assert.Equal(t, original.Definition.Spec.Steps, workflow.Workflow.Definition.Spec.Steps)
+	assert.Equal(t, execution.InputData, workflow.Input)
+
+	_, err = playground.Execute(ctx, "orders", workflow.Input)
+	require.NoError(t, err)
+	require.Len(t, executor.executed, 1)
+
+	t.Run("existing definitions are kept", func(t *testing.T) {
+		_, err := ImportBundle(bundle, dir, false)
+		assert.ErrorIs(t, err, ErrDefinitionExists)
+
+		_, err = ImportBundle(bundle, dir, true)
+		require.NoError(t, err)
+	})
+
+	t.Run("reduced bundles hold no input", func(t *testing.T) {
+		reduced, _, _ := buildBundle(t, debugbundle.LevelReduced)
+		dir := t.TempDir()
+		imported, err := ImportBundle(reduced, dir, false)
+		require.NoError(t, err)
+		assert.Empty(t, imported.InputPath)
+		assert.Contains(t, imported.Warnings, "the bundle is reduced and holds no execution input")
+		_, err = os.Stat(filepath.Join(dir, "orders.input.json"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
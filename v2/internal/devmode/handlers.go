@@ -0,0 +1,123 @@
+package devmode
+
+import (
+	"embed"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+//go:embed static/index.html
+var static embed.FS
+
+// Handlers provides HTTP handlers for the playground
+type Handlers struct {
+	playground *Playground
+}
+
+// NewHandlers creates new playground handlers
+func NewHandlers(playground *Playground) *Handlers {
+	return &Handlers{playground: playground}
+}
+
+// RegisterRoutes registers playground routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		dev := v1.Group("/dev")
+		{
+			dev.GET("/workflows", h.ListWorkflows)
+			dev.GET("/workflows/:name", h.GetWorkflow)
+			dev.POST("/workflows/:name/executions", h.ExecuteWorkflow)
+			dev.GET("/executions/:id/events", h.StreamEvents)
+		}
+	}
+}
+
+// RegisterUI serves the playground UI at the root of the router
+func (h *Handlers) RegisterUI(router gin.IRoutes) {
+	router.GET("/", func(c *gin.Context) {
+		page, err := static.ReadFile("static/index.html")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	})
+}
+
+// ExecuteRequest is the request body of a playground execution
+type ExecuteRequest struct {
+	Input map[string]interface{} `json:"input"`
+}
+
+// ListWorkflows returns the workflows of the playground with their load
+// errors and validation warnings
+func (h *Handlers) ListWorkflows(c *gin.Context) {
+	c.JSON(http.StatusOK, h.playground.List())
+}
+
+// GetWorkflow returns a workflow of the playground
+func (h *Handlers) GetWorkflow(c *gin.Context) {
+	workflow, err := h.playground.Get(c.Param("name"))
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+// ExecuteWorkflow runs the latest good revision of a workflow
+func (h *Handlers) ExecuteWorkflow(c *gin.Context) {
+	var req ExecuteRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	execution, err := h.playground.Execute(c.Request.Context(), c.Param("name"), req.Input)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, execution)
+}
+
+// StreamEvents streams the events of an execution as server-sent events
+// until it ends
+func (h *Handlers) StreamEvents(c *gin.Context) {
+	executionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution ID"})
+		return
+	}
+
+	events, unsubscribe := h.playground.Stream().Subscribe(executionID)
+	defer unsubscribe()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			c.SSEvent(event.Type, event)
+			return !isTerminal(event)
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func (h *Handlers) errorResponse(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrWorkflowNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrWorkflowInvalid):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,134 @@
+package devmode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// isDefinitionFile reports whether a file of the workflow directory holds a
+// workflow definition
+func isDefinitionFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return !strings.HasPrefix(filepath.Base(path), ".")
+	default:
+		return false
+	}
+}
+
+// definitionFiles lists the workflow definitions of a directory
+func definitionFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isDefinitionFile(entry.Name()) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// readDefinition reads a YAML workflow definition, in the format accepted by
+// the versions API: a name, steps and optional inputs and outputs
+func readDefinition(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+
+	var definition map[string]interface{}
+	if err := yaml.Unmarshal(content, &definition); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	if definition == nil {
+		return nil, fmt.Errorf("%s is empty", filepath.Base(path))
+	}
+	return definition, nil
+}
+
+// buildWorkflow builds the workflow run by the engine from a validated
+// definition
+func buildWorkflow(id uuid.UUID, revision int, definition map[string]interface{}) (*models.Workflow, error) {
+	name, _ := definition["name"].(string)
+	description, _ := definition["description"].(string)
+	version := fmt.Sprintf("dev.%d", revision)
+
+	var steps []models.WorkflowStep
+	if err := convert(definition["steps"], &steps); err != nil {
+		return nil, fmt.Errorf("invalid steps: %w", err)
+	}
+	var examples []models.WorkflowExample
+	if err := convert(definition["examples"], &examples); err != nil {
+		return nil, fmt.Errorf("invalid examples: %w", err)
+	}
+	inputSchema := fieldsSchema(definition["inputs"])
+	outputSchema := fieldsSchema(definition["outputs"])
+
+	return &models.Workflow{
+		ID:          id,
+		Name:        name,
+		Description: description,
+		Version:     version,
+		Status:      models.WorkflowStatusActive,
+		Owner:       "dev",
+		CreatedBy:   "dev",
+		Definition: models.WorkflowDefinition{
+			Kind: "Workflow",
+			Metadata: models.WorkflowMetadata{
+				Name:        name,
+				Version:     version,
+				Description: description,
+			},
+			Spec: models.WorkflowSpec{
+				InputSchema:  inputSchema,
+				OutputSchema: outputSchema,
+				Steps:        steps,
+				Examples:     examples,
+			},
+		},
+		InputSchema:  inputSchema,
+		OutputSchema: outputSchema,
+	}, nil
+}
+
+// fieldsSchema converts the inputs or outputs of a definition, a map of
+// field names to {type, description, required}, to an object schema
+func fieldsSchema(fields interface{}) models.JSONSchema {
+	schema := models.JSONSchema{Type: "object", Properties: make(map[string]interface{})}
+
+	fieldMap, _ := fields.(map[string]interface{})
+	for name, field := range fieldMap {
+		schema.Properties[name] = field
+		if definition, ok := field.(map[string]interface{}); ok {
+			if required, _ := definition["required"].(bool); required {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// convert converts a decoded YAML value to a typed value through JSON
+func convert(value interface{}, target interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
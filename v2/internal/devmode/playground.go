@@ -0,0 +1,255 @@
+package devmode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/versioning"
+	"magic-flow/v2/pkg/models"
+)
+
+var (
+	// ErrProductionEnvironment is returned when dev mode is started with the
+	// production environment
+	ErrProductionEnvironment = errors.New("dev mode cannot run in the production environment")
+	// ErrWorkflowNotFound is returned for workflows not defined in the
+	// workflow directory
+	ErrWorkflowNotFound = errors.New("workflow not found")
+	// ErrWorkflowInvalid is returned when executing a workflow whose
+	// definition never loaded
+	ErrWorkflowInvalid = errors.New("workflow definition is invalid")
+)
+
+// Executor runs the workflows of the playground. It is implemented by
+// engine.Engine.
+type Executor interface {
+	ExecuteWorkflow(ctx context.Context, workflow *models.Workflow, input map[string]interface{}, config map[string]interface{}) (*models.Execution, error)
+}
+
+// Options configures the playground
+type Options struct {
+	// Dir is the directory holding the YAML workflow definitions
+	Dir string
+	// Environment is the environment the server runs in. Dev mode refuses
+	// to start in production.
+	Environment string
+}
+
+// Workflow is a workflow definition file of the playground. Every successful
+// load of the file is a new ephemeral revision; a file that fails to parse or
+// validate keeps its last good revision and reports the error.
+type Workflow struct {
+	Name     string           `json:"name"`
+	Path     string           `json:"path"`
+	Revision int              `json:"revision"`
+	Workflow *models.Workflow `json:"workflow,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	LoadedAt time.Time        `json:"loaded_at"`
+	// Input is the input of the <name>.input.json file next to the
+	// definition, such as the input of an imported debug bundle
+	Input map[string]interface{} `json:"input,omitempty"`
+}
+
+// Playground serves the workflows of a directory, reloading them as their
+// files change, without the versioning ceremony of the regular server
+type Playground struct {
+	dir       string
+	executor  Executor
+	validator *versioning.Validator
+	stream    *Stream
+	logger    *logrus.Logger
+
+	mu        sync.RWMutex
+	workflows map[string]*Workflow
+	ids       map[string]uuid.UUID
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New creates a playground for the workflows of opts.Dir
+func New(opts Options, executor Executor, validator *versioning.Validator, logger *logrus.Logger) (*Playground, error) {
+	if strings.EqualFold(opts.Environment, "production") {
+		return nil, ErrProductionEnvironment
+	}
+
+	info, err := os.Stat(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workflow directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", opts.Dir)
+	}
+
+	return &Playground{
+		dir:       opts.Dir,
+		executor:  executor,
+		validator: validator,
+		stream:    NewStream(),
+		logger:    logger,
+		workflows: make(map[string]*Workflow),
+		ids:       make(map[string]uuid.UUID),
+	}, nil
+}
+
+// Stream returns the execution event stream, to be registered as an event
+// handler of the engine
+func (p *Playground) Stream() *Stream {
+	return p.stream
+}
+
+// LoadAll loads every workflow definition of the directory
+func (p *Playground) LoadAll(ctx context.Context) error {
+	paths, err := definitionFiles(p.dir)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		p.Reload(ctx, path)
+	}
+	return nil
+}
+
+// Reload loads a workflow definition file as a new revision. Parse and
+// validation errors are logged and recorded on the workflow rather than
+// returned, so a broken file never stops the playground.
+func (p *Playground) Reload(ctx context.Context, path string) *Workflow {
+	definition, err := readDefinition(path)
+	if err == nil {
+		err = p.validator.ValidateDefinition(ctx, definition)
+	}
+	input, inputErr := readInput(path)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, exists := p.workflows[path]
+	if !exists {
+		entry = &Workflow{Path: path, Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+		p.workflows[path] = entry
+	}
+	entry.LoadedAt = time.Now().UTC()
+	logger := p.logger.WithField("file", filepath.Base(path))
+
+	if err == nil {
+		err = p.checkNameLocked(path, definition)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		logger.WithError(err).Error("Workflow definition rejected, keeping the last good revision")
+		return entry.copy()
+	}
+
+	name, _ := definition["name"].(string)
+	id, ok := p.ids[name]
+	if !ok {
+		id = uuid.New()
+		p.ids[name] = id
+	}
+	workflow, err := buildWorkflow(id, entry.Revision+1, definition)
+	if err != nil {
+		entry.Error = err.Error()
+		logger.WithError(err).Error("Workflow definition rejected, keeping the last good revision")
+		return entry.copy()
+	}
+
+	entry.Name = name
+	entry.Revision++
+	entry.Workflow = workflow
+	entry.Error = ""
+	entry.Warnings = p.validator.StepConfigWarnings(definition)
+	entry.Input = input
+	if inputErr != nil {
+		entry.Warnings = append(entry.Warnings, inputErr.Error())
+	}
+
+	logger = logger.WithFields(logrus.Fields{
+		"workflow": name,
+		"version":  workflow.Version,
+	})
+	for _, warning := range entry.Warnings {
+		logger.Warn(warning)
+	}
+	logger.Info("Workflow loaded")
+	return entry.copy()
+}
+
+// checkNameLocked rejects a definition reusing the name of a workflow of
+// another file
+func (p *Playground) checkNameLocked(path string, definition map[string]interface{}) error {
+	name, _ := definition["name"].(string)
+	for otherPath, other := range p.workflows {
+		if otherPath != path && other.Workflow != nil && other.Name == name {
+			return fmt.Errorf("workflow %s is already defined in %s", name, filepath.Base(otherPath))
+		}
+	}
+	return nil
+}
+
+// Remove drops the workflow of a deleted definition file
+func (p *Playground) Remove(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, exists := p.workflows[path]; exists {
+		delete(p.workflows, path)
+		p.logger.WithField("workflow", entry.Name).Info("Workflow removed")
+	}
+}
+
+// List returns the workflows of the playground sorted by name
+func (p *Playground) List() []*Workflow {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	workflows := make([]*Workflow, 0, len(p.workflows))
+	for _, entry := range p.workflows {
+		workflows = append(workflows, entry.copy())
+	}
+	sort.Slice(workflows, func(i, j int) bool {
+		return workflows[i].Name < workflows[j].Name
+	})
+	return workflows
+}
+
+// Get returns a workflow by name
+func (p *Playground) Get(name string) (*Workflow, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, entry := range p.workflows {
+		if entry.Name == name {
+			return entry.copy(), nil
+		}
+	}
+	return nil, ErrWorkflowNotFound
+}
+
+// Execute runs the latest good revision of a workflow
+func (p *Playground) Execute(ctx context.Context, name string, input map[string]interface{}) (*models.Execution, error) {
+	entry, err := p.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Workflow == nil {
+		return nil, fmt.Errorf("%w: %s", ErrWorkflowInvalid, entry.Error)
+	}
+	return p.executor.ExecuteWorkflow(ctx, entry.Workflow, input, nil)
+}
+
+func (w *Workflow) copy() *Workflow {
+	c := *w
+	c.Warnings = append([]string(nil), w.Warnings...)
+	return &c
+}
@@ -0,0 +1,105 @@
+package devmode
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/engine"
+)
+
+const (
+	// streamHistory is the number of recent executions whose events are
+	// replayed to new subscribers, which usually subscribe right after the
+	// execution started
+	streamHistory = 100
+	// subscriberBuffer is the number of events a slow subscriber may lag
+	// behind before it misses events
+	subscriberBuffer = 64
+)
+
+// Stream fans the engine events of executions out to subscribers, the live
+// execution views of the UI
+type Stream struct {
+	mu          sync.Mutex
+	history     map[uuid.UUID][]*engine.WorkflowEvent
+	order       []uuid.UUID
+	subscribers map[uuid.UUID]map[chan *engine.WorkflowEvent]struct{}
+}
+
+// NewStream creates an execution event stream
+func NewStream() *Stream {
+	return &Stream{
+		history:     make(map[uuid.UUID][]*engine.WorkflowEvent),
+		subscribers: make(map[uuid.UUID]map[chan *engine.WorkflowEvent]struct{}),
+	}
+}
+
+// Handle records an event and sends it to the subscribers of its execution
+func (s *Stream) Handle(event *engine.WorkflowEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.history[event.ExecutionID]; !exists {
+		s.order = append(s.order, event.ExecutionID)
+		if len(s.order) > streamHistory {
+			delete(s.history, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	s.history[event.ExecutionID] = append(s.history[event.ExecutionID], event)
+
+	for ch := range s.subscribers[event.ExecutionID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+// GetEventTypes returns the event types handled
+func (s *Stream) GetEventTypes() []string {
+	return []string{
+		"execution.started", "execution.completed", "execution.failed", "execution.cancelled",
+		"step.started", "step.completed", "step.failed",
+	}
+}
+
+// Subscribe returns the events of an execution, starting with those already
+// emitted, and a function ending the subscription
+func (s *Stream) Subscribe(executionID uuid.UUID) (<-chan *engine.WorkflowEvent, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.history[executionID]
+	ch := make(chan *engine.WorkflowEvent, len(history)+subscriberBuffer)
+	for _, event := range history {
+		ch <- event
+	}
+
+	if s.subscribers[executionID] == nil {
+		s.subscribers[executionID] = make(map[chan *engine.WorkflowEvent]struct{})
+	}
+	s.subscribers[executionID][ch] = struct{}{}
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.subscribers[executionID], ch)
+		if len(s.subscribers[executionID]) == 0 {
+			delete(s.subscribers, executionID)
+		}
+	}
+}
+
+// isTerminal reports whether an event ends its execution
+func isTerminal(event *engine.WorkflowEvent) bool {
+	switch event.Type {
+	case "execution.completed", "execution.failed", "execution.cancelled":
+		return true
+	default:
+		return false
+	}
+}
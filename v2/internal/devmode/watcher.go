@@ -0,0 +1,105 @@
+package devmode
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay lets editors finish writing a file before it is reloaded, so
+// a save producing several events reloads once
+const reloadDelay = 100 * time.Millisecond
+
+// Start loads the workflow directory and reloads its definitions as they
+// change until Stop is called
+func (p *Playground) Start(ctx context.Context) error {
+	if err := p.LoadAll(ctx); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	if err := watcher.Add(p.dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch workflow directory: %w", err)
+	}
+
+	p.stopCh = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer watcher.Close()
+		p.watch(ctx, watcher)
+	}()
+	return nil
+}
+
+// Stop stops watching the workflow directory
+func (p *Playground) Stop() {
+	if p.stopCh == nil {
+		return
+	}
+	close(p.stopCh)
+	p.wg.Wait()
+	p.stopCh = nil
+}
+
+func (p *Playground) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	var mu sync.Mutex
+	pending := make(map[string]*time.Timer)
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, timer := range pending {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !isDefinitionFile(event.Name) || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			// Whether the file changed, was replaced or deleted is decided
+			// once it settles
+			path := event.Name
+			mu.Lock()
+			if timer, exists := pending[path]; exists {
+				timer.Stop()
+			}
+			pending[path] = time.AfterFunc(reloadDelay, func() {
+				mu.Lock()
+				delete(pending, path)
+				mu.Unlock()
+
+				if _, err := os.Stat(path); err != nil {
+					p.Remove(path)
+					return
+				}
+				p.Reload(ctx, path)
+			})
+			mu.Unlock()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// Keep watching, the next change may reload fine
+			p.logger.WithError(err).Warn("Workflow directory watcher error")
+		case <-p.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/scheduler"
+)
+
+// queuedEvents keeps the events the engine emits, in order
+type queuedEvents struct {
+	mu     sync.Mutex
+	events []*WorkflowEvent
+}
+
+func (q *queuedEvents) Handle(event *WorkflowEvent) error {
+	q.Enqueue(event)
+	return nil
+}
+
+func (q *queuedEvents) GetEventTypes() []string {
+	return nil
+}
+
+func (q *queuedEvents) Enqueue(event *WorkflowEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, event)
+}
+
+func TestEngineClock(t *testing.T) {
+	started := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	clock := scheduler.NewFakeClock(started)
+	e := newStatusTestEngine()
+	e.SetClock(clock)
+	events := &queuedEvents{}
+	e.RegisterEventHandler(events)
+
+	execContext := startTestExecution(e, "orders")
+	execContext.StartTime = e.now()
+	execContext.Logger = logrus.NewEntry(e.logger)
+	assert.Equal(t, started, execContext.StartTime)
+
+	// Durations are measured on the engine clock
+	clock.Advance(90*time.Second + 250*time.Millisecond)
+	e.completeExecution(execContext)
+	completed := started.Add(90*time.Second + 250*time.Millisecond)
+	assert.Equal(t, int64(90250), execContext.Execution.Duration)
+	require.NotNil(t, execContext.Execution.CompletedAt)
+	assert.Equal(t, completed, *execContext.Execution.CompletedAt)
+	assert.Equal(t, completed, execContext.Execution.UpdatedAt)
+
+	require.Len(t, events.events, 1)
+	event := events.events[0]
+	assert.Equal(t, "execution.completed", event.Type)
+	assert.Equal(t, completed, event.Timestamp)
+	assert.Equal(t, int64(90250), event.Data["duration_ms"])
+	assert.Equal(t, started, event.Data["started_at"])
+
+	// Times are in UTC, whatever the location of the clock
+	clock.Set(time.Date(2026, 3, 4, 19, 30, 0, 0, time.FixedZone("JST", 9*60*60)))
+	e.PublishEvent("slo.burn", uuid.New(), nil)
+	require.Len(t, events.events, 2)
+	assert.Equal(t, time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC), events.events[1].Timestamp)
+}
+
+func TestExecutionDurationMilliseconds(t *testing.T) {
+	started := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	clock := scheduler.NewFakeClock(started)
+	e := newStatusTestEngine()
+	e.SetClock(clock)
+	events := &queuedEvents{}
+	e.RegisterEventHandler(events)
+
+	// Executions shorter than a second are not recorded as taking none
+	for _, end := range []func(*ExecutionContext){
+		e.completeExecution,
+		func(execContext *ExecutionContext) { e.cancelExecution(execContext, "stopped") },
+	} {
+		execContext := startTestExecution(e, "quote")
+		execContext.StartTime = e.now()
+		execContext.Logger = logrus.NewEntry(e.logger)
+
+		clock.Advance(150 * time.Millisecond)
+		end(execContext)
+		assert.Equal(t, int64(150), execContext.Execution.Duration)
+		event := events.events[len(events.events)-1]
+		assert.Equal(t, int64(150), event.Data["duration"])
+		assert.Equal(t, int64(150), event.Data["duration_ms"])
+	}
+}
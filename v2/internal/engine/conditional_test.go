@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/expressions"
+)
+
+func TestConditionalExpression(t *testing.T) {
+	executor := &ConditionalExecutor{logger: logrus.New()}
+	ctx := expressions.WithEnv(context.Background(), &expressions.Env{Now: time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)})
+	input := map[string]interface{}{"due": "2026-01-05T10:00:00Z", "amount": 12}
+
+	holds, err := executor.evaluateCondition(ctx, map[string]interface{}{
+		"operator": "and",
+		"conditions": []interface{}{
+			map[string]interface{}{"operator": "exists", "field": "due"},
+			map[string]interface{}{"operator": "expression", "expression": `parseTime(due, "RFC3339") <= addBusinessDays(now(), 1) && amount > 10`},
+		},
+	}, input)
+	require.NoError(t, err)
+	assert.True(t, holds)
+
+	_, err = executor.evaluateCondition(ctx, map[string]interface{}{"operator": "expression", "expression": "amount > now()"}, input)
+	assert.EqualError(t, err, `expression "amount > now()": cannot compare number with time`)
+
+	_, err = executor.evaluateCondition(ctx, map[string]interface{}{"operator": "expression", "expression": "soon(due)"}, input)
+	assert.ErrorContains(t, err, `unknown function "soon"`)
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// FencingTokenVariable is the step input key whose value the HTTP executor
+// forwards downstream in the FencingTokenHeader header
+const FencingTokenVariable = "fencing_token"
+
+// FencingTokenHeader is the header carrying a lock fencing token
+const FencingTokenHeader = "X-Fencing-Token"
+
+type executionIDKey struct{}
+
+type workflowKey struct{}
+
+type executionGroupKey struct{}
+
+// ExecutionGroup is the execution group executions start in
+type ExecutionGroup struct {
+	ID     uuid.UUID
+	Labels map[string]string
+}
+
+// WithExecutionID returns a context carrying the ID of the running execution
+func WithExecutionID(ctx context.Context, executionID uuid.UUID) context.Context {
+	return context.WithValue(ctx, executionIDKey{}, executionID)
+}
+
+// ExecutionIDFromContext returns the ID of the execution a step runs in
+func ExecutionIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	executionID, ok := ctx.Value(executionIDKey{}).(uuid.UUID)
+	return executionID, ok
+}
+
+// WithWorkflow returns a context carrying the workflow being executed
+func WithWorkflow(ctx context.Context, workflow *models.Workflow) context.Context {
+	return context.WithValue(ctx, workflowKey{}, workflow)
+}
+
+// WithExecutionGroup returns a context starting executions as members of an
+// execution group, carrying its labels
+func WithExecutionGroup(ctx context.Context, group ExecutionGroup) context.Context {
+	return context.WithValue(ctx, executionGroupKey{}, group)
+}
+
+// ExecutionGroupFromContext returns the execution group executions started
+// with a context are members of
+func ExecutionGroupFromContext(ctx context.Context) (ExecutionGroup, bool) {
+	group, ok := ctx.Value(executionGroupKey{}).(ExecutionGroup)
+	return group, ok
+}
+
+// WorkflowFromContext returns the workflow a step runs in
+func WorkflowFromContext(ctx context.Context) (*models.Workflow, bool) {
+	workflow, ok := ctx.Value(workflowKey{}).(*models.Workflow)
+	return workflow, ok && workflow != nil
+}
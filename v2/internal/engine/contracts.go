@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"magic-flow/v2/internal/contracts"
+	"magic-flow/v2/pkg/models"
+)
+
+var (
+	// ErrStepNotFound is returned for steps a workflow does not define
+	ErrStepNotFound = errors.New("step not found")
+	// ErrNoContract is returned when contract testing a step without a
+	// response contract
+	ErrNoContract = errors.New("step has no response contract")
+	// ErrInvalidBaseURL is returned for contract tests targeting a base URL
+	// that is not absolute
+	ErrInvalidBaseURL = errors.New("base URL must be an absolute URL")
+)
+
+// ContractTester is implemented by step executors whose steps declare
+// response contracts, such as the http executor
+type ContractTester interface {
+	TestContract(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}, baseURL string) (*contracts.Report, error)
+}
+
+// ContractTest is a standalone call of one step of a workflow, checking the
+// response against the contract of the step without running the workflow
+type ContractTest struct {
+	// BaseURL replaces the scheme and host of the step URL, targeting the
+	// environment to test, such as https://orders.staging.internal
+	BaseURL string `json:"base_url,omitempty"`
+	// Variables are sample variables the step input is mapped from, as in
+	// an execution
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// TestStepContract calls a step of a workflow, identified by name, and
+// reports whether the response conforms to the contract of the step.
+// Violations are reported rather than returned as errors, and are not
+// counted in the violation metrics of executions.
+func (e *Engine) TestStepContract(ctx context.Context, workflow *models.Workflow, stepName string, test *ContractTest) (*contracts.Report, error) {
+	var step *models.WorkflowStep
+	for i := range workflow.Definition.Spec.Steps {
+		candidate := &workflow.Definition.Spec.Steps[i]
+		if candidate.Name == stepName {
+			step = candidate
+			break
+		}
+	}
+	if step == nil {
+		return nil, fmt.Errorf("%w: %s", ErrStepNotFound, stepName)
+	}
+
+	e.mu.RLock()
+	executor, exists := e.stepExecutors[step.Type]
+	e.mu.RUnlock()
+	tester, ok := executor.(ContractTester)
+	if !exists || !ok {
+		return nil, fmt.Errorf("%w: %s steps have no response contracts", ErrNoContract, step.Type)
+	}
+
+	// Map the step input from the sample variables as an execution would
+	input := make(map[string]interface{})
+	if step.Input != nil {
+		input = e.evaluateDataMapping(&ExecutionContext{
+			Workflow:    workflow,
+			Variables:   test.Variables,
+			StepResults: make(map[string]interface{}),
+			Context:     ctx,
+			Logger:      e.logger.WithField("workflow_id", workflow.ID),
+		}, step.Input)
+	}
+
+	return tester.TestContract(ctx, step, input, test.BaseURL)
+}
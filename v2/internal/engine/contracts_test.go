@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/contracts"
+	"magic-flow/v2/pkg/models"
+)
+
+// recordedMetrics keeps the metrics recorded by executors
+type recordedMetrics struct {
+	mu     sync.Mutex
+	labels map[string][]map[string]string
+}
+
+func (m *recordedMetrics) RecordMetric(name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.labels == nil {
+		m.labels = make(map[string][]map[string]string)
+	}
+	m.labels[name] = append(m.labels[name], labels)
+}
+
+// orderContract is the response contract of the orders service
+var orderContract = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"id", "status"},
+	"properties": map[string]interface{}{
+		"id":     map[string]interface{}{"type": "string"},
+		"status": map[string]interface{}{"type": "string"},
+		"total":  map[string]interface{}{"type": "number"},
+	},
+}
+
+// ordersService answers like the orders service of each release: v1
+// conforms, v2 dropped the status and v3 sends the total as a string
+func ordersService() *httptest.Server {
+	responses := map[string]string{
+		"/v1/orders/42": `{"id": "42", "status": "paid", "total": 12.5}`,
+		"/v2/orders/42": `{"id": "42", "total": 12.5}`,
+		"/v3/orders/42": `{"id": "42", "status": "paid", "total": "12.50"}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, exists := responses[r.URL.Path]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, response)
+	}))
+}
+
+func newContractExecutor() (*HTTPExecutor, *recordedMetrics) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	executor := NewHTTPExecutor(logger)
+	metrics := &recordedMetrics{}
+	executor.SetMetrics(metrics)
+	return executor, metrics
+}
+
+func fetchOrder(url string) *models.WorkflowStep {
+	return &models.WorkflowStep{
+		Name:   "fetch-order",
+		Type:   "http",
+		Config: map[string]interface{}{"url": url, "response_schema": orderContract},
+	}
+}
+
+func TestHTTPResponseContract(t *testing.T) {
+	service := ordersService()
+	defer service.Close()
+	executor, metrics := newContractExecutor()
+	workflow := &models.Workflow{ID: uuid.New(), Version: "1.0.0"}
+	ctx := WithWorkflow(context.Background(), workflow)
+
+	output, err := executor.Execute(ctx, fetchOrder(service.URL+"/v1/orders/42"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "42", "status": "paid", "total": 12.5}, output["json"])
+
+	for path, violations := range map[string][]contracts.Violation{
+		"/v2/orders/42": {{Path: "status", Kind: contracts.KindMissing}},
+		"/v3/orders/42": {{Path: "total", Kind: contracts.KindType, Expected: "number", Actual: "string"}},
+	} {
+		output, err := executor.Execute(ctx, fetchOrder(service.URL+path), nil)
+		assert.Nil(t, output, "violating responses do not reach the variables")
+		assert.ErrorIs(t, err, contracts.ErrViolation, path)
+		var violationErr *contracts.ViolationError
+		require.True(t, errors.As(err, &violationErr), path)
+		assert.Equal(t, "fetch-order", violationErr.StepID)
+		assert.Equal(t, violations, violationErr.Violations, path)
+	}
+	assert.ErrorContains(t, func() error {
+		_, err := executor.Execute(ctx, fetchOrder(service.URL+"/v3/orders/42"), nil)
+		return err
+	}(), "step fetch-order: response contract violated: field total must be number, got string")
+
+	// Violations are counted per step
+	labels := map[string]string{"workflow_id": workflow.ID.String(), "step_id": "fetch-order"}
+	assert.Equal(t, []map[string]string{labels, labels, labels}, metrics.labels["http_response_contract_violations_total"])
+	assert.Equal(t, 1, executor.contracts.Len(), "the schema is compiled once per version")
+
+	// Invalid schemas are rejected when the version is validated
+	step := fetchOrder(service.URL)
+	step.Config["response_schema"] = map[string]interface{}{"type": "money"}
+	assert.ErrorIs(t, executor.Validate(step), contracts.ErrInvalidSchema)
+	assert.NoError(t, executor.Validate(fetchOrder(service.URL)))
+}
+
+func TestStepContractTest(t *testing.T) {
+	staging := ordersService()
+	defer staging.Close()
+	executor, metrics := newContractExecutor()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	e := NewEngine(10, nil, logger)
+	e.RegisterStepExecutor("http", executor)
+	e.RegisterStepExecutor("func", &funcExecutor{})
+
+	workflow := &models.Workflow{ID: uuid.New(), Version: "1.0.0"}
+	workflow.Definition.Spec.Steps = []models.WorkflowStep{
+		*fetchOrder("https://orders.prod.invalid/v2/orders/42"),
+		{Name: "notify", Type: "http", Config: map[string]interface{}{"url": "https://hooks.invalid"}},
+		{Name: "decide", Type: "func"},
+	}
+
+	// The step is called against staging, without running the workflow
+	report, err := e.TestStepContract(context.Background(), workflow, "fetch-order", &ContractTest{BaseURL: staging.URL})
+	require.NoError(t, err)
+	assert.False(t, report.Conforms)
+	assert.Equal(t, []contracts.Violation{{Path: "status", Kind: contracts.KindMissing}}, report.Violations)
+	assert.Equal(t, "fetch-order", report.StepID)
+	assert.Equal(t, "GET", report.Method)
+	assert.Equal(t, staging.URL+"/v2/orders/42", report.URL)
+	assert.Equal(t, http.StatusOK, report.StatusCode)
+	assert.Equal(t, map[string]interface{}{"id": "42", "total": 12.5}, report.Body)
+	assert.Empty(t, metrics.labels["http_response_contract_violations_total"], "contract tests are not counted as violations of executions")
+
+	workflow.Definition.Spec.Steps[0] = *fetchOrder(staging.URL + "/v1/orders/42")
+	report, err = e.TestStepContract(context.Background(), workflow, "fetch-order", &ContractTest{})
+	require.NoError(t, err)
+	assert.True(t, report.Conforms)
+	assert.Empty(t, report.Violations)
+
+	_, err = e.TestStepContract(context.Background(), workflow, "ship", &ContractTest{})
+	assert.ErrorIs(t, err, ErrStepNotFound)
+	_, err = e.TestStepContract(context.Background(), workflow, "notify", &ContractTest{})
+	assert.ErrorIs(t, err, ErrNoContract)
+	_, err = e.TestStepContract(context.Background(), workflow, "decide", &ContractTest{})
+	assert.ErrorIs(t, err, ErrNoContract)
+	_, err = e.TestStepContract(context.Background(), workflow, "fetch-order", &ContractTest{BaseURL: "staging"})
+	assert.ErrorIs(t, err, ErrInvalidBaseURL)
+}
@@ -0,0 +1,469 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/internal/replay"
+	"magic-flow/v2/pkg/models"
+)
+
+var (
+	// ErrDraining is returned when draining an engine already draining
+	ErrDraining = errors.New("engine is already draining")
+	// ErrNotParked is returned when resuming an execution that is not parked
+	ErrNotParked = errors.New("execution is not parked")
+)
+
+// drainInterruptReason is the reason interruptible executions are
+// cancelled with
+const drainInterruptReason = "interrupted by node drain"
+
+// DrainProgress counts the executions of one shutdown policy in a drain
+type DrainProgress struct {
+	// Running executions have not ended or parked yet
+	Running int `json:"running"`
+	// Ended executions completed or failed on their own
+	Ended       int `json:"ended"`
+	Parked      int `json:"parked"`
+	Interrupted int `json:"interrupted"`
+}
+
+// DrainStatus is the progress of the drain of an engine, per shutdown
+// policy of the drained executions
+type DrainStatus struct {
+	StartedAt time.Time `json:"started_at"`
+	// Deadline is when executions still running are checkpointed after
+	// their current step, whatever their policy
+	Deadline time.Time `json:"deadline"`
+	// Forced is set once the deadline passed
+	Forced   bool                                     `json:"forced"`
+	Done     bool                                     `json:"done"`
+	Policies map[models.ShutdownPolicy]*DrainProgress `json:"policies"`
+}
+
+// drain tracks the executions of a drain. It is guarded by the engine
+// mutex, so that executions are tracked and finished in the same critical
+// sections they are added to and removed from the engine.
+type drain struct {
+	status   DrainStatus
+	policies map[uuid.UUID]models.ShutdownPolicy
+	done     chan struct{}
+}
+
+func newDrain(startedAt, deadline time.Time) *drain {
+	progress := make(map[models.ShutdownPolicy]*DrainProgress, len(models.ShutdownPolicies))
+	for _, policy := range models.ShutdownPolicies {
+		progress[policy] = &DrainProgress{}
+	}
+	return &drain{
+		status:   DrainStatus{StartedAt: startedAt, Deadline: deadline, Policies: progress},
+		policies: make(map[uuid.UUID]models.ShutdownPolicy),
+		done:     make(chan struct{}),
+	}
+}
+
+// track counts a running execution
+func (d *drain) track(execContext *ExecutionContext) models.ShutdownPolicy {
+	policy := execContext.Workflow.Definition.Spec.Shutdown()
+	d.policies[execContext.Execution.ID] = policy
+	d.status.Policies[policy].Running++
+	return policy
+}
+
+// finish counts an execution that ended or parked
+func (d *drain) finish(execution *models.Execution) {
+	policy, tracked := d.policies[execution.ID]
+	if !tracked {
+		return
+	}
+	delete(d.policies, execution.ID)
+
+	progress := d.status.Policies[policy]
+	progress.Running--
+	switch execution.Status {
+	case models.ExecutionStatusParked:
+		progress.Parked++
+	case models.ExecutionStatusCancelled:
+		progress.Interrupted++
+	default:
+		progress.Ended++
+	}
+	d.check()
+}
+
+// check closes done once no execution runs
+func (d *drain) check() {
+	if len(d.policies) == 0 && !d.status.Done {
+		d.status.Done = true
+		close(d.done)
+	}
+}
+
+func (d *drain) snapshot() *DrainStatus {
+	status := d.status
+	status.Policies = make(map[models.ShutdownPolicy]*DrainProgress, len(d.status.Policies))
+	for policy, progress := range d.status.Policies {
+		copied := *progress
+		status.Policies[policy] = &copied
+	}
+	return &status
+}
+
+// Drain stops the engine from accepting executions and applies the shutdown
+// policy of the workflow of each running execution: interruptible ones are
+// cancelled at once, checkpoint_after_current_step ones park once their
+// running steps finished, and run_to_completion ones run on. Once deadline
+// elapsed, the executions still running are checkpointed after their
+// current step. Drain returns when no execution runs, or with the error of
+// ctx when it is done first.
+func (e *Engine) Drain(ctx context.Context, deadline time.Duration) (*DrainStatus, error) {
+	startedAt := e.now()
+	e.mu.Lock()
+	if e.drain != nil {
+		e.mu.Unlock()
+		return nil, ErrDraining
+	}
+	d := newDrain(startedAt, startedAt.Add(deadline))
+	e.drain = d
+	running := make([]*ExecutionContext, 0, len(e.executions))
+	for _, execContext := range e.executions {
+		running = append(running, execContext)
+	}
+	policies := make([]models.ShutdownPolicy, len(running))
+	for i, execContext := range running {
+		policies[i] = d.track(execContext)
+	}
+	d.check()
+	e.mu.Unlock()
+
+	e.logger.WithField("executions", len(running)).Info("Draining workflow engine")
+	for i, execContext := range running {
+		applyShutdownPolicy(execContext, policies[i])
+	}
+
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+	select {
+	case <-d.done:
+		return e.DrainStatus(), nil
+	case <-timer.C:
+		e.forceCheckpoints()
+	case <-ctx.Done():
+		return e.DrainStatus(), ctx.Err()
+	}
+
+	select {
+	case <-d.done:
+		return e.DrainStatus(), nil
+	case <-ctx.Done():
+		return e.DrainStatus(), ctx.Err()
+	}
+}
+
+// forceCheckpoints parks the executions still running once the drain
+// deadline elapsed
+func (e *Engine) forceCheckpoints() {
+	e.mu.Lock()
+	e.drain.status.Forced = true
+	var stragglers []*ExecutionContext
+	for id := range e.drain.policies {
+		if execContext, exists := e.executions[id]; exists {
+			stragglers = append(stragglers, execContext)
+		}
+	}
+	e.mu.Unlock()
+
+	e.logger.WithField("executions", len(stragglers)).Warn("Drain deadline reached, checkpointing running executions")
+	for _, execContext := range stragglers {
+		execContext.park()
+	}
+}
+
+// DrainStatus returns the progress of the drain of the engine, nil if it is
+// not draining
+func (e *Engine) DrainStatus() *DrainStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.drain == nil {
+		return nil
+	}
+	return e.drain.snapshot()
+}
+
+// applyShutdownPolicy stops a running execution as its policy says
+func applyShutdownPolicy(execContext *ExecutionContext, policy models.ShutdownPolicy) {
+	switch policy {
+	case models.ShutdownInterruptible:
+		execContext.interrupt(drainInterruptReason)
+	case models.ShutdownCheckpointAfterCurrentStep:
+		execContext.park()
+	}
+}
+
+// startRun records the dataflow run of the steps of the execution, parking
+// it if the execution was asked to park before it started
+func (execContext *ExecutionContext) startRun(run *dataflow.Run) {
+	execContext.mu.Lock()
+	defer execContext.mu.Unlock()
+	execContext.run = run
+	if execContext.parkRequested {
+		run.Park()
+	}
+}
+
+// park checkpoints the execution once its running steps finished
+func (execContext *ExecutionContext) park() {
+	execContext.mu.Lock()
+	defer execContext.mu.Unlock()
+	execContext.parkRequested = true
+	if execContext.run != nil {
+		execContext.run.Park()
+	}
+}
+
+// interrupt cancels the execution for a reason
+func (execContext *ExecutionContext) interrupt(reason string) {
+	execContext.mu.Lock()
+	execContext.interruptReason = reason
+	execContext.mu.Unlock()
+	execContext.Cancel()
+}
+
+// cancelReason returns why the execution was cancelled
+func (execContext *ExecutionContext) cancelReason() string {
+	execContext.mu.RLock()
+	defer execContext.mu.RUnlock()
+	if execContext.interruptReason != "" {
+		return execContext.interruptReason
+	}
+	return "execution cancelled or timed out"
+}
+
+// parkExecution marks an execution parked with the steps it did not start.
+// Its finished steps were persisted as they finished, so the execution can
+// resume on any node with ResumeExecution.
+func (e *Engine) parkExecution(execContext *ExecutionContext, result dataflow.Result) {
+	now := e.now()
+	var pending []string
+	for _, step := range result.Steps {
+		if step.Status == models.StepStatusPending {
+			pending = append(pending, step.Step)
+		}
+	}
+
+	execContext.Execution.Status = models.ExecutionStatusParked
+	execContext.Execution.UpdatedAt = now
+
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          "execution.parked",
+		ExecutionID:   execContext.Execution.ID,
+		WorkflowID:    execContext.Workflow.ID,
+		CorrelationID: execContext.Execution.CorrelationID,
+		Timestamp:     now,
+		Data: map[string]interface{}{
+			"pending_steps": pending,
+			"node_id":       execContext.Execution.NodeID,
+		},
+	})
+
+	execContext.Logger.WithField("pending_steps", len(pending)).Info("Workflow execution parked")
+}
+
+type resumptionKey struct{}
+
+// resumption is a parked execution being resumed, with the outcomes of the
+// steps it finished before it parked
+type resumption struct {
+	execution *models.Execution
+	steps     *replay.Recording
+}
+
+func resumptionFromContext(ctx context.Context) *resumption {
+	resumed, _ := ctx.Value(resumptionKey{}).(*resumption)
+	return resumed
+}
+
+// restore makes a new execution continue the parked one
+func (r *resumption) restore(execution *models.Execution) {
+	parked := r.execution
+	execution.ID = parked.ID
+	execution.TriggerType = parked.TriggerType
+	execution.ParentExecutionID = parked.ParentExecutionID
+	execution.GroupID = parked.GroupID
+	execution.Labels = parked.Labels
+	execution.Context.Environment = parked.Context.Environment
+	execution.StartedAt = parked.StartedAt
+	execution.CreatedAt = parked.CreatedAt
+}
+
+// ResumeExecution resumes a parked execution, with its steps persisted.
+// The steps it finished before it parked keep their outcome without
+// running again, the others run. The execution keeps its ID, start time
+// and feature flags, and is recorded as resumed on the node of the engine.
+func (e *Engine) ResumeExecution(ctx context.Context, workflow *models.Workflow, parked *models.Execution) (*models.Execution, error) {
+	if !parked.IsParked() {
+		return nil, fmt.Errorf("%w: execution %s is %s", ErrNotParked, parked.ID, parked.Status)
+	}
+
+	steps := make([]*models.StepExecution, len(parked.Steps))
+	for i := range parked.Steps {
+		steps[i] = &parked.Steps[i]
+	}
+	recording := replay.NewRecording(parked.ID, steps)
+	recording.Flags = parked.Flags
+
+	ctx = correlation.WithID(ctx, parked.CorrelationID)
+	ctx = WithPlacementHop(ctx, models.PlacementHopResume)
+	ctx = context.WithValue(ctx, resumptionKey{}, &resumption{execution: parked, steps: recording})
+	return e.ExecuteWorkflow(ctx, workflow, parked.InputData, map[string]interface{}{})
+}
+
+// restoreStep restores the output of a step a resumed execution completed
+// before it parked, reporting whether it did. Steps that failed run again,
+// as their retries may not have run.
+func (e *Engine) restoreStep(execContext *ExecutionContext, step *models.WorkflowStep) (bool, error) {
+	resumed := resumptionFromContext(execContext.Context)
+	if resumed == nil {
+		return false, nil
+	}
+	recorded, ok := resumed.steps.Step(step.Name)
+	if !ok || recorded.Error != "" {
+		return false, nil
+	}
+	output, _ := recorded.Result()
+	return true, e.storeStepOutput(execContext, step, output)
+}
+
+// ParkedStore lists parked executions, with their step executions, and
+// claims them for a resume. ClaimParked must atomically switch a parked
+// execution to running, so that each execution resumes on a single node.
+// database.ExecutionRepository implements it.
+type ParkedStore interface {
+	ListParked(limit int) ([]*models.Execution, error)
+	ClaimParked(id uuid.UUID) (bool, error)
+	UpdateStatus(id uuid.UUID, status models.ExecutionStatus) error
+}
+
+// WorkflowStore reads the workflows of parked executions
+type WorkflowStore interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+}
+
+// Resumer resumes parked executions on the engine of a node, as long as it
+// accepts executions and has free capacity
+type Resumer struct {
+	engine     *Engine
+	executions ParkedStore
+	workflows  WorkflowStore
+	logger     *logrus.Logger
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewResumer creates the resumer of parked executions for an engine
+func NewResumer(engine *Engine, executions ParkedStore, workflows WorkflowStore, logger *logrus.Logger) *Resumer {
+	return &Resumer{
+		engine:     engine,
+		executions: executions,
+		workflows:  workflows,
+		logger:     logger,
+	}
+}
+
+// ResumeParked resumes as many parked executions as the engine has free
+// capacity for, oldest first, and returns how many it resumed
+func (r *Resumer) ResumeParked(ctx context.Context) (int, error) {
+	if !r.engine.Accepting() {
+		return 0, nil
+	}
+	free := r.engine.Capacity() - r.engine.RunningExecutions()
+	if free <= 0 {
+		return 0, nil
+	}
+	parked, err := r.executions.ListParked(free)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list parked executions: %w", err)
+	}
+
+	resumed := 0
+	var errs []error
+	for _, execution := range parked {
+		claimed, err := r.executions.ClaimParked(execution.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to claim execution %s: %w", execution.ID, err))
+			continue
+		}
+		if !claimed {
+			// Another node resumed it
+			continue
+		}
+		if err := r.resume(ctx, execution); err != nil {
+			// Park it again for the next node with capacity
+			if parkErr := r.executions.UpdateStatus(execution.ID, models.ExecutionStatusParked); parkErr != nil {
+				err = errors.Join(err, parkErr)
+			}
+			errs = append(errs, fmt.Errorf("failed to resume execution %s: %w", execution.ID, err))
+			continue
+		}
+		resumed++
+	}
+	return resumed, errors.Join(errs...)
+}
+
+func (r *Resumer) resume(ctx context.Context, execution *models.Execution) error {
+	workflow, err := r.workflows.GetByID(execution.WorkflowID)
+	if err != nil {
+		return err
+	}
+	// The resumed execution outlives the resume
+	_, err = r.engine.ResumeExecution(context.WithoutCancel(ctx), workflow, execution)
+	return err
+}
+
+// Start resumes parked executions at once, then at the given interval until
+// Stop is called
+func (r *Resumer) Start(ctx context.Context, interval time.Duration) {
+	r.stopCh = make(chan struct{})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if resumed, err := r.ResumeParked(ctx); err != nil {
+				r.logger.WithError(err).Error("Failed to resume parked executions")
+			} else if resumed > 0 {
+				r.logger.WithField("executions", resumed).Info("Resumed parked executions")
+			}
+
+			select {
+			case <-ticker.C:
+			case <-r.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops resuming parked executions
+func (r *Resumer) Stop() {
+	if r.stopCh == nil {
+		return
+	}
+	close(r.stopCh)
+	r.wg.Wait()
+	r.stopCh = nil
+}
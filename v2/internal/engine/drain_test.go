@@ -0,0 +1,282 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/internal/replay"
+	"magic-flow/v2/pkg/models"
+)
+
+// drainedExecution is an execution of two steps, a then b, each running
+// until released
+type drainedExecution struct {
+	execContext *ExecutionContext
+	started     chan string
+	release     map[string]chan struct{}
+	done        chan struct{}
+}
+
+// startDrainableExecution runs an execution of a workflow with a shutdown
+// policy the way ExecuteWorkflow and executeWorkflowSteps do
+func startDrainableExecution(t *testing.T, e *Engine, policy models.ShutdownPolicy) *drainedExecution {
+	graph, err := dataflow.NewGraph([]dataflow.Step{{Name: "a"}, {Name: "b", DependsOn: []string{"a"}}}, nil)
+	require.NoError(t, err)
+
+	workflow := &models.Workflow{ID: uuid.New(), Name: string(policy)}
+	workflow.Definition.Spec.ShutdownPolicy = policy
+	ctx, cancel := context.WithCancel(context.Background())
+	execContext := &ExecutionContext{
+		Execution: &models.Execution{ID: uuid.New(), Status: models.ExecutionStatusRunning},
+		Workflow:  workflow,
+		Context:   ctx,
+		Cancel:    cancel,
+		StartTime: e.now(),
+		Logger:    logrus.NewEntry(e.logger),
+	}
+	execContext.publishStatusLocked()
+	execution := &drainedExecution{
+		execContext: execContext,
+		started:     make(chan string, 2),
+		release:     map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})},
+		done:        make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	e.executions[execContext.Execution.ID] = execContext
+	e.currentExecutions++
+	e.mu.Unlock()
+
+	go func() {
+		defer close(execution.done)
+		defer func() {
+			e.mu.Lock()
+			e.currentExecutions--
+			delete(e.executions, execContext.Execution.ID)
+			if e.drain != nil {
+				e.drain.finish(execContext.Execution)
+			}
+			e.mu.Unlock()
+		}()
+
+		run := dataflow.Start(ctx, graph, 0, func(ctx context.Context, step string) error {
+			execution.started <- step
+			select {
+			case <-execution.release[step]:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		execContext.startRun(run)
+		result := run.Wait()
+		switch result.Status {
+		case models.ExecutionStatusCancelled:
+			e.cancelExecution(execContext, execContext.cancelReason())
+		case models.ExecutionStatusParked:
+			e.parkExecution(execContext, result)
+		default:
+			e.completeExecution(execContext)
+		}
+	}()
+
+	require.Equal(t, "a", <-execution.started)
+	return execution
+}
+
+func parkRequested(execContext *ExecutionContext) bool {
+	execContext.mu.RLock()
+	defer execContext.mu.RUnlock()
+	return execContext.parkRequested
+}
+
+func newDrainTestEngine() (*Engine, *queuedEvents) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	e := NewEngine(10, nil, logger)
+	events := &queuedEvents{}
+	e.RegisterEventHandler(events)
+	return e, events
+}
+
+func TestDrainShutdownPolicies(t *testing.T) {
+	e, events := newDrainTestEngine()
+	interruptible := startDrainableExecution(t, e, models.ShutdownInterruptible)
+	checkpointed := startDrainableExecution(t, e, models.ShutdownCheckpointAfterCurrentStep)
+	completed := startDrainableExecution(t, e, models.ShutdownRunToCompletion)
+
+	type drained struct {
+		status *DrainStatus
+		err    error
+	}
+	drainDone := make(chan drained, 1)
+	go func() {
+		status, err := e.Drain(context.Background(), time.Hour)
+		drainDone <- drained{status, err}
+	}()
+
+	// Interruptible executions are cancelled at once
+	<-interruptible.done
+	for !parkRequested(checkpointed.execContext) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, models.ExecutionStatusCancelled, interruptible.execContext.Execution.Status)
+	assert.Equal(t, drainInterruptReason, interruptible.execContext.Execution.Error)
+
+	// Checkpointed executions park once their running step finished, with
+	// the steps they did not start pending
+	close(checkpointed.release["a"])
+	<-checkpointed.done
+	assert.Equal(t, models.ExecutionStatusParked, checkpointed.execContext.Execution.Status)
+
+	// The others run to completion
+	close(completed.release["a"])
+	require.Equal(t, "b", <-completed.started)
+	status := e.DrainStatus()
+	require.NotNil(t, status)
+	assert.False(t, status.Done)
+	assert.Equal(t, 1, status.Policies[models.ShutdownRunToCompletion].Running)
+	close(completed.release["b"])
+
+	result := <-drainDone
+	require.NoError(t, result.err)
+	assert.True(t, result.status.Done)
+	assert.False(t, result.status.Forced)
+	assert.Equal(t, &DrainProgress{Interrupted: 1}, result.status.Policies[models.ShutdownInterruptible])
+	assert.Equal(t, &DrainProgress{Parked: 1}, result.status.Policies[models.ShutdownCheckpointAfterCurrentStep])
+	assert.Equal(t, &DrainProgress{Ended: 1}, result.status.Policies[models.ShutdownRunToCompletion])
+	assert.Equal(t, models.ExecutionStatusCompleted, completed.execContext.Execution.Status)
+	assert.Equal(t, 0, e.RunningExecutions())
+
+	var parked *WorkflowEvent
+	for _, event := range events.events {
+		if event.Type == "execution.parked" {
+			parked = event
+		}
+	}
+	require.NotNil(t, parked)
+	assert.Equal(t, checkpointed.execContext.Execution.ID, parked.ExecutionID)
+	assert.Equal(t, []string{"b"}, parked.Data["pending_steps"])
+
+	// An engine drains once
+	_, err := e.Drain(context.Background(), time.Hour)
+	assert.ErrorIs(t, err, ErrDraining)
+}
+
+func TestDrainDeadlineCheckpoints(t *testing.T) {
+	e, _ := newDrainTestEngine()
+	execution := startDrainableExecution(t, e, models.ShutdownRunToCompletion)
+
+	// Past the deadline, executions running to completion are checkpointed
+	// after their current step too
+	drainDone := make(chan *DrainStatus, 1)
+	go func() {
+		status, err := e.Drain(context.Background(), 10*time.Millisecond)
+		assert.NoError(t, err)
+		drainDone <- status
+	}()
+	for status := e.DrainStatus(); status == nil || !status.Forced; status = e.DrainStatus() {
+		time.Sleep(time.Millisecond)
+	}
+	close(execution.release["a"])
+
+	status := <-drainDone
+	assert.True(t, status.Forced)
+	assert.Equal(t, &DrainProgress{Parked: 1}, status.Policies[models.ShutdownRunToCompletion])
+	assert.Equal(t, models.ExecutionStatusParked, execution.execContext.Execution.Status)
+}
+
+func TestDrainWithoutExecutions(t *testing.T) {
+	e, _ := newDrainTestEngine()
+	assert.Nil(t, e.DrainStatus())
+
+	status, err := e.Drain(context.Background(), time.Hour)
+	require.NoError(t, err)
+	assert.True(t, status.Done)
+
+	// Executions stuck past the drain timeout are reported running
+	e, _ = newDrainTestEngine()
+	execution := startDrainableExecution(t, e, models.ShutdownRunToCompletion)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	status, err = e.Drain(ctx, time.Hour)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, status.Done)
+	assert.Equal(t, 1, status.Policies[models.ShutdownRunToCompletion].Running)
+	close(execution.release["a"])
+	close(execution.release["b"])
+	<-execution.done
+}
+
+func TestResumeRestoresCompletedSteps(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	e := NewEngine(10, nopMetrics{}, logger)
+	store := &recordingStepStore{}
+	e.SetStepStore(store)
+	events := &queuedEvents{}
+	e.RegisterEventHandler(events)
+	steps := &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"charged": true}, nil
+	}}
+	e.RegisterStepExecutor("func", steps)
+
+	// The execution completed quote, failed charge and parked
+	startedAt := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	groupID := uuid.New()
+	parked := &models.Execution{
+		ID:            uuid.New(),
+		Status:        models.ExecutionStatusParked,
+		CorrelationID: "order-42",
+		TriggerType:   models.TriggerTypeAPI,
+		Flags:         map[string]bool{"new_pricing": true},
+		GroupID:       &groupID,
+		CreatedAt:     startedAt,
+	}
+	parked.Steps = []models.StepExecution{
+		{ExecutionID: parked.ID, StepName: "quote", Status: models.StepStatusCompleted, OutputData: map[string]interface{}{"price": 42.0}, Attempt: 1},
+		{ExecutionID: parked.ID, StepName: "charge", Status: models.StepStatusFailed, Error: "timeout", Attempt: 1},
+	}
+	recording := replay.NewRecording(parked.ID, []*models.StepExecution{&parked.Steps[0], &parked.Steps[1]})
+	recording.Flags = parked.Flags
+	ctx := context.WithValue(context.Background(), resumptionKey{}, &resumption{execution: parked, steps: recording})
+
+	execContext := newLoggingExecution(logger)
+	execContext.Context = ctx
+
+	// Completed steps keep their output without running again
+	require.NoError(t, e.executeStep(execContext, &models.WorkflowStep{Name: "quote", Type: "func"}))
+	assert.Equal(t, 0, steps.calls)
+	assert.Equal(t, 42.0, execContext.Variables["price"])
+	assert.Empty(t, store.steps)
+	assert.Empty(t, events.events)
+
+	// Failed steps run again
+	require.NoError(t, e.executeStep(execContext, &models.WorkflowStep{Name: "charge", Type: "func"}))
+	assert.Equal(t, 1, steps.calls)
+	assert.Equal(t, true, execContext.Variables["charged"])
+	require.Len(t, store.steps, 1)
+
+	// The resumed execution continues the parked one, with its flags
+	execution := &models.Execution{ID: uuid.New()}
+	resumptionFromContext(ctx).restore(execution)
+	assert.Equal(t, parked.ID, execution.ID)
+	assert.Equal(t, models.TriggerTypeAPI, execution.TriggerType)
+	assert.Equal(t, startedAt, execution.CreatedAt)
+	assert.Equal(t, &groupID, execution.GroupID)
+	flags := e.evaluateFlags(ctx, execution, execContext.Workflow, nil, execContext.Logger)
+	assert.Equal(t, map[string]bool{"new_pricing": true}, flags)
+
+	// Only parked executions resume
+	_, err := e.ResumeExecution(context.Background(), execContext.Workflow, &models.Execution{ID: uuid.New(), Status: models.ExecutionStatusCompleted})
+	assert.True(t, errors.Is(err, ErrNotParked), "err = %v", err)
+}
@@ -2,14 +2,26 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 
+	"magic-flow/v2/internal/contracts"
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/replay"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/internal/secrets"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/internal/warmup"
 	"magic-flow/v2/pkg/models"
 )
 
@@ -18,11 +30,38 @@ type Engine struct {
 	mu               sync.RWMutex
 	executions       map[uuid.UUID]*ExecutionContext
 	stepExecutors    map[string]StepExecutor
+	configSchemas    *stepconfig.Registry
+	configCache      *stepconfig.DecodeCache
 	eventHandlers    []EventHandler
+	placement        NodePlacement
+	calendars        expressions.Calendars
+	warmupConfig     warmup.Config
+	classifier       FailureClassifier
+	stepStore        StepStore
+	flags            FlagEvaluator
+	secrets          secrets.Provider
+	breakers         CircuitBreakers
 	metrics          MetricsCollector
+	clock            scheduler.Clock
 	logger           *logrus.Logger
+	stepSampling     StepLogSampling
+	stepLogCount     atomic.Uint64
 	maxConcurrent    int
+	// stepPool bounds the steps of every execution running at once, nil
+	// for no bound
+	stepPool         *dataflow.Pool
+	// maxVariableBytes is the budget of the variables of each execution,
+	// zero for none
+	maxVariableBytes int64
 	currentExecutions int
+	// fastLaneSize is how many lightweight executions run at once in the
+	// fast lane, outside maxConcurrent, and fastLaneExecutions how many
+	// do
+	fastLaneSize       int
+	fastLaneExecutions int
+	// drain tracks the executions of the drain of the engine, nil until
+	// it drains
+	drain            *drain
 	shutdownCh       chan struct{}
 	wg               sync.WaitGroup
 }
@@ -35,6 +74,9 @@ type ExecutionContext struct {
 	Output       map[string]interface{}
 	Variables    map[string]interface{}
 	StepResults  map[string]interface{}
+	// Environment is the environment of the workflow definition, with the
+	// overrides of the execution config, read as ${env.KEY}
+	Environment  map[string]string
 	Context      context.Context
 	Cancel       context.CancelFunc
 	StartTime    time.Time
@@ -43,6 +85,30 @@ type ExecutionContext struct {
 	RetryCount   int
 	MaxRetries   int
 	Timeout      time.Duration
+	Logger       *logrus.Entry
+	// Warnings lists the failures of background steps
+	Warnings     []string
+	// failedStep is the last step that failed, classified when the
+	// execution fails
+	failedStep   *models.StepExecution
+	// run is the dataflow run of the steps, parked when the execution is
+	// checkpointed by a drain, and interruptReason why a drain cancelled
+	// the execution
+	run             *dataflow.Run
+	parkRequested   bool
+	interruptReason string
+	// variablesBytes is the size of Variables encoded as JSON, and
+	// variableSizes the size of each of them
+	variablesBytes  int64
+	variableSizes   map[string]int64
+	// lightweight is set for executions in the lightweight mode, which
+	// buffer their step executions in bufferedSteps until they end
+	lightweight     bool
+	bufferedSteps   []*models.StepExecution
+	// status holds the latest *ExecutionStatus snapshot, and sequence the
+	// number of events the execution emitted
+	status       atomic.Value
+	sequence     atomic.Uint64
 	mu           sync.RWMutex
 }
 
@@ -59,6 +125,15 @@ type EventHandler interface {
 	GetEventTypes() []string
 }
 
+// QueuedEventHandler is an EventHandler that queues events and delivers them
+// itself. The engine enqueues events synchronously, so they are queued in the
+// order they were emitted, and Enqueue must not block unless the handler
+// applies backpressure to executions on purpose.
+type QueuedEventHandler interface {
+	EventHandler
+	Enqueue(event *WorkflowEvent)
+}
+
 // MetricsCollector interface for collecting execution metrics
 type MetricsCollector interface {
 	RecordExecution(execution *models.Execution)
@@ -67,15 +142,28 @@ type MetricsCollector interface {
 	RecordMetric(name string, value float64, labels map[string]string)
 }
 
-// WorkflowEvent represents an event during workflow execution
+// WorkflowEvent represents an event during workflow execution. Sequence
+// numbers the events of an execution from 1, in the order they are emitted.
 type WorkflowEvent struct {
-	Type        string                 `json:"type"`
-	ExecutionID uuid.UUID              `json:"execution_id"`
-	WorkflowID  uuid.UUID              `json:"workflow_id"`
-	StepID      string                 `json:"step_id,omitempty"`
-	Timestamp   time.Time              `json:"timestamp"`
-	Data        map[string]interface{} `json:"data"`
-	Error       string                 `json:"error,omitempty"`
+	Type          string                 `json:"type"`
+	ExecutionID   uuid.UUID              `json:"execution_id"`
+	WorkflowID    uuid.UUID              `json:"workflow_id"`
+	CorrelationID string                 `json:"correlation_id"`
+	StepID        string                 `json:"step_id,omitempty"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Data          map[string]interface{} `json:"data"`
+	Error         string                 `json:"error,omitempty"`
+	Sequence      uint64                 `json:"sequence,omitempty"`
+}
+
+// IdempotencyKey identifies an execution event across redeliveries, so
+// handlers receiving events at least once can skip the ones they already
+// processed. It is empty for events without a sequence number.
+func (e *WorkflowEvent) IdempotencyKey() string {
+	if e.Sequence == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", e.ExecutionID, e.Sequence)
 }
 
 // NewEngine creates a new workflow execution engine
@@ -83,19 +171,28 @@ func NewEngine(maxConcurrent int, metrics MetricsCollector, logger *logrus.Logge
 	return &Engine{
 		executions:    make(map[uuid.UUID]*ExecutionContext),
 		stepExecutors: make(map[string]StepExecutor),
+		configSchemas: stepconfig.NewRegistry(),
+		configCache:   stepconfig.NewDecodeCache(),
 		eventHandlers: make([]EventHandler, 0),
+		warmupConfig:  warmup.DefaultConfig(),
 		metrics:       metrics,
+		clock:         scheduler.NewRealClock(),
 		logger:        logger,
+		stepSampling:  StepLogSampling{Every: 1},
 		maxConcurrent: maxConcurrent,
 		shutdownCh:    make(chan struct{}),
 	}
 }
 
-// RegisterStepExecutor registers a step executor for a specific step type
+// RegisterStepExecutor registers a step executor for a specific step type.
+// Executors implementing ConfigSchemaProvider also register their schema.
 func (e *Engine) RegisterStepExecutor(stepType string, executor StepExecutor) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.stepExecutors[stepType] = executor
+	if provider, ok := executor.(ConfigSchemaProvider); ok {
+		e.configSchemas.Register(stepType, provider.ConfigSchema())
+	}
 }
 
 // RegisterEventHandler registers an event handler
@@ -105,31 +202,92 @@ func (e *Engine) RegisterEventHandler(handler EventHandler) {
 	e.eventHandlers = append(e.eventHandlers, handler)
 }
 
-// ExecuteWorkflow executes a workflow
+// ExecuteWorkflow executes a workflow. The execution takes the correlation ID
+// of ctx, generating one when it has none. Executions started from a step of
+// another execution, such as sub-workflows, are recorded as its children and
+// share its correlation ID. When the engine runs on a worker node, executions
+// are refused with ErrNodeCordoned while the node is cordoned and are
+// recorded as placed on the node otherwise. Executions are refused with
+// ErrNodeCordoned too while the engine drains.
 func (e *Engine) ExecuteWorkflow(ctx context.Context, workflow *models.Workflow, input map[string]interface{}, config map[string]interface{}) (*models.Execution, error) {
-	// Check if we can accept more executions
+	// Check if we can accept more executions. Lightweight executions start
+	// in the fast lane while it has room.
+	mode := executionMode(&workflow.Definition)
 	e.mu.Lock()
-	if e.currentExecutions >= e.maxConcurrent {
+	placement := e.placement
+	if (placement != nil && !placement.Accepting()) || e.drain != nil {
 		e.mu.Unlock()
-		return nil, fmt.Errorf("maximum concurrent executions reached: %d", e.maxConcurrent)
+		return nil, ErrNodeCordoned
 	}
-	e.currentExecutions++
+	fastLane, err := e.acquireSlotLocked(mode)
+	if err != nil {
+		e.mu.Unlock()
+		return nil, err
+	}
+	calendars := e.calendars
 	e.mu.Unlock()
 
-	// Create execution record
+	ctx, correlationID := correlation.Ensure(ctx)
+
+	// Create execution record. Resumed executions keep their start time.
+	startedAt := e.now()
+	resumed := resumptionFromContext(ctx)
+	if resumed != nil {
+		startedAt = resumed.execution.StartedAt
+	}
 	execution := &models.Execution{
-		ID:         uuid.New(),
-		WorkflowID: workflow.ID,
-		Status:     models.ExecutionStatusRunning,
-		Input:      input,
-		Config:     config,
-		StartedAt:  time.Now().UTC(),
-		CreatedAt:  time.Now().UTC(),
-		UpdatedAt:  time.Now().UTC(),
-	}
-
-	// Create execution context
-	execCtx, cancel := context.WithCancel(ctx)
+		ID:            uuid.New(),
+		WorkflowID:    workflow.ID,
+		TenantID:      workflow.TenantID,
+		Status:        models.ExecutionStatusRunning,
+		Input:         input,
+		Config:        config,
+		CorrelationID: correlationID,
+		ExecutionMode: mode,
+		StartedAt:     startedAt,
+		CreatedAt:     startedAt,
+		UpdatedAt:     startedAt,
+	}
+	if parentID, ok := ExecutionIDFromContext(ctx); ok {
+		execution.ParentExecutionID = &parentID
+	}
+	// Replays record the execution they replay as their parent
+	if recording := replay.FromContext(ctx); recording != nil {
+		execution.TriggerType = models.TriggerTypeReplay
+		execution.ParentExecutionID = &recording.ExecutionID
+	}
+	// Members of execution groups carry the labels of their group
+	if group, ok := ExecutionGroupFromContext(ctx); ok {
+		execution.GroupID = &group.ID
+		execution.Labels = group.Labels
+	}
+	// Resumes continue the parked execution
+	if resumed != nil {
+		resumed.restore(execution)
+	}
+
+	logger := e.logger.WithFields(executionFields(execution, workflow)).WithField(correlation.Field, correlationID)
+	if fastLane {
+		logger = logger.WithField("fast_lane", true)
+	}
+
+	if placement != nil {
+		execution.NodeID = placement.NodeID()
+		logger = logger.WithField("node_id", execution.NodeID)
+
+		// Placements only serve visibility, so executions run even if the
+		// record fails
+		if err := placement.RecordPlacement(ctx, execution.ID, placementHopFromContext(ctx)); err != nil {
+			logger.WithError(err).Error("Failed to record execution placement")
+		}
+	}
+
+	// Create execution context. Expressions read the start of the execution
+	// as now(), its logical clock, so retried steps evaluate the same times,
+	// the feature flags evaluated as it starts and its secrets.
+	flagValues := e.evaluateFlags(ctx, execution, workflow, input, logger)
+	ctx = expressions.WithEnv(ctx, &expressions.Env{Now: startedAt, Calendars: calendars, Flags: flagValues, Secrets: e.executionSecrets(ctx)})
+	execCtx, cancel := context.WithCancel(WithWorkflow(WithExecutionID(correlation.WithLogger(ctx, logger), execution.ID), workflow))
 	execContext := &ExecutionContext{
 		Execution:   execution,
 		Workflow:    workflow,
@@ -139,9 +297,11 @@ func (e *Engine) ExecuteWorkflow(ctx context.Context, workflow *models.Workflow,
 		StepResults: make(map[string]interface{}),
 		Context:     execCtx,
 		Cancel:      cancel,
-		StartTime:   time.Now(),
+		StartTime:   startedAt,
 		MaxRetries:  3, // Default retry count
 		Timeout:     30 * time.Minute, // Default timeout
+		Logger:      logger,
+		lightweight: mode == models.ExecutionModeLightweight,
 	}
 
 	// Apply configuration
@@ -163,10 +323,21 @@ func (e *Engine) ExecuteWorkflow(ctx context.Context, workflow *models.Workflow,
 		execContext.Cancel = cancel
 	}
 
-	// Store execution context
+	// Publish the initial status, before the context is shared
+	execContext.publishStatusLocked()
+
+	// Store execution context. Executions admitted as a drain started are
+	// drained too.
 	e.mu.Lock()
 	e.executions[execution.ID] = execContext
+	var drainPolicy models.ShutdownPolicy
+	if e.drain != nil {
+		drainPolicy = e.drain.track(execContext)
+	}
 	e.mu.Unlock()
+	if drainPolicy != "" {
+		applyShutdownPolicy(execContext, drainPolicy)
+	}
 
 	// Start execution in goroutine
 	e.wg.Add(1)
@@ -174,34 +345,39 @@ func (e *Engine) ExecuteWorkflow(ctx context.Context, workflow *models.Workflow,
 		defer e.wg.Done()
 		defer func() {
 			e.mu.Lock()
-			e.currentExecutions--
+			e.releaseSlotLocked(fastLane)
 			delete(e.executions, execution.ID)
+			if e.drain != nil {
+				e.drain.finish(execution)
+			}
 			e.mu.Unlock()
 		}()
 
 		e.executeWorkflowSteps(execContext)
 	}()
 
-	// Emit execution started event
-	e.emitEvent(&WorkflowEvent{
-		Type:        "execution.started",
-		ExecutionID: execution.ID,
-		WorkflowID:  workflow.ID,
-		Timestamp:   time.Now().UTC(),
+	// Emit execution started event, or resumed for resumes
+	eventType := "execution.started"
+	if resumed != nil {
+		eventType = "execution.resumed"
+	}
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          eventType,
+		ExecutionID:   execution.ID,
+		WorkflowID:    workflow.ID,
+		CorrelationID: correlationID,
+		Timestamp:     e.now(),
 		Data: map[string]interface{}{
-			"input":  input,
-			"config": config,
+			"input":          input,
+			"config":         config,
+			"execution_mode": mode,
 		},
 	})
 
 	// Record metrics
 	e.metrics.RecordExecution(execution)
 
-	e.logger.WithFields(logrus.Fields{
-		"execution_id": execution.ID,
-		"workflow_id":  workflow.ID,
-		"workflow_name": workflow.Name,
-	}).Info("Workflow execution started")
+	logger.Info("Workflow execution started")
 
 	return execution, nil
 }
@@ -217,68 +393,93 @@ func (e *Engine) executeWorkflowSteps(execContext *ExecutionContext) {
 		return
 	}
 
+	// Resolve the environment of the execution once. Resumed executions
+	// keep the environment they started with.
+	if execContext.Execution.Context.Environment == nil {
+		execContext.Execution.Context.Environment = resolveEnvironment(&workflowDef, execContext.Execution.Config)
+	}
+	execContext.mu.Lock()
+	execContext.Environment = execContext.Execution.Context.Environment
+	execContext.mu.Unlock()
+
 	// Initialize variables with input
+	budget := e.variableBudget()
+	execContext.mu.Lock()
 	for key, value := range execContext.Input {
-		execContext.Variables[key] = value
+		execContext.setVariableLocked(key, value)
+	}
+	err := e.checkVariableBudgetLocked(execContext, nil, budget)
+	execContext.mu.Unlock()
+	if err != nil {
+		e.failExecution(execContext, err)
+		return
 	}
 
-	// Execute steps
-	for _, step := range workflowDef.Steps {
-		select {
-		case <-execContext.Context.Done():
-			e.cancelExecution(execContext, "execution cancelled or timed out")
-			return
-		default:
-		}
-
-		if err := e.executeStep(execContext, &step); err != nil {
-			if step.ErrorHandling != nil && step.ErrorHandling.ContinueOnError {
-				e.logger.WithFields(logrus.Fields{
-					"execution_id": execContext.Execution.ID,
-					"step_id":      step.ID,
-					"error":        err.Error(),
-				}).Warn("Step failed but continuing execution")
-				continue
-			}
-
-			// Handle retries
-			if step.ErrorHandling != nil && step.ErrorHandling.RetryPolicy != nil {
-				if e.shouldRetry(execContext, &step, err) {
-					e.retryStep(execContext, &step)
-					continue
-				}
-			}
+	e.runSteps(execContext, &workflowDef)
+}
 
-			e.failExecution(execContext, fmt.Errorf("step %s failed: %w", step.ID, err))
-			return
-		}
+// runSteps executes the steps of a workflow in dependency and priority
+// order and ends the execution with the result of the run
+func (e *Engine) runSteps(execContext *ExecutionContext, workflowDef *models.WorkflowDefinition) {
+	graph, err := dataflow.FromDefinition(workflowDef)
+	if err != nil {
+		e.failExecution(execContext, err)
+		return
 	}
-
-	// Set output
-	if workflowDef.Output != nil {
-		execContext.Output = e.evaluateDataMapping(execContext, workflowDef.Output)
-	} else {
-		execContext.Output = execContext.Variables
+	run := dataflow.StartWithPool(execContext.Context, graph, 0, e.currentStepPool(), e.stepRunner(execContext, workflowDef))
+	execContext.startRun(run)
+
+	// Respond once the critical path completed, background steps may still
+	// be running
+	<-run.Responded()
+	if result := run.Result(); result.RespondedAt != nil {
+		e.respondExecution(execContext, workflowDef, *result.RespondedAt)
 	}
 
-	e.completeExecution(execContext)
+	result := run.Wait()
+	e.flushSteps(execContext)
+	switch result.Status {
+	case models.ExecutionStatusCancelled:
+		e.cancelExecution(execContext, execContext.cancelReason())
+	case models.ExecutionStatusFailed:
+		e.failExecution(execContext, result.Err)
+	case models.ExecutionStatusParked:
+		e.parkExecution(execContext, result)
+	default:
+		execContext.Warnings = result.Warnings
+		e.completeExecution(execContext)
+	}
 }
 
 // executeStep executes a single workflow step
 func (e *Engine) executeStep(execContext *ExecutionContext, step *models.WorkflowStep) error {
-	execContext.mu.Lock()
-	execContext.CurrentStep = step.ID
-	execContext.mu.Unlock()
+	return e.executeStepIn(execContext.Context, execContext, step)
+}
+
+// executeStepIn executes a single workflow step within ctx, the context the
+// dataflow run gives the step, carrying its slot of the step pool
+func (e *Engine) executeStepIn(ctx context.Context, execContext *ExecutionContext, step *models.WorkflowStep) error {
+	execContext.enterStep(step.ID)
+
+	// Steps a resumed execution completed before it parked are not run
+	// again
+	if restored, err := e.restoreStep(execContext, step); restored || err != nil {
+		return err
+	}
 
 	// Create step execution record
+	startedAt := e.now()
 	stepExecution := &models.StepExecution{
-		ID:          uuid.New(),
-		ExecutionID: execContext.Execution.ID,
-		StepID:      step.ID,
-		Status:      models.StepStatusRunning,
-		StartedAt:   time.Now().UTC(),
-		CreatedAt:   time.Now().UTC(),
-		UpdatedAt:   time.Now().UTC(),
+		ID:            uuid.New(),
+		ExecutionID:   execContext.Execution.ID,
+		StepID:        step.ID,
+		StepName:      step.Name,
+		StepType:      step.Type,
+		Status:        models.StepStatusRunning,
+		CorrelationID: execContext.Execution.CorrelationID,
+		StartedAt:     startedAt,
+		CreatedAt:     startedAt,
+		UpdatedAt:     startedAt,
 	}
 
 	// Get step executor
@@ -290,6 +491,30 @@ func (e *Engine) executeStep(execContext *ExecutionContext, step *models.Workflo
 		return fmt.Errorf("no executor found for step type: %s", step.Type)
 	}
 
+	// Entries logged within the step, by its executor too, carry the step.
+	// The entries of successful steps are sampled.
+	logger := execContext.stepLogger(step)
+	sampled := e.sampleStep()
+	stepCtx := WithEnvironment(correlation.WithLogger(ctx, logger), execContext.Environment)
+
+	// Skip the step when its when guard does not hold
+	holds, err := e.stepGuard(execContext, step)
+	if err != nil {
+		return err
+	}
+	if !holds {
+		return e.skipStep(execContext, step, stepExecution, logger, sampled)
+	}
+
+	// Decode the typed step config, cached per workflow version
+	typedConfig, err := e.decodeStepConfig(execContext, step)
+	if err != nil {
+		return err
+	}
+	if typedConfig != nil {
+		stepCtx = WithStepConfig(stepCtx, typedConfig)
+	}
+
 	// Prepare step input
 	stepInput := make(map[string]interface{})
 	if step.Input != nil {
@@ -297,97 +522,133 @@ func (e *Engine) executeStep(execContext *ExecutionContext, step *models.Workflo
 	}
 
 	// Emit step started event
-	e.emitEvent(&WorkflowEvent{
-		Type:        "step.started",
-		ExecutionID: execContext.Execution.ID,
-		WorkflowID:  execContext.Workflow.ID,
-		StepID:      step.ID,
-		Timestamp:   time.Now().UTC(),
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          "step.started",
+		ExecutionID:   execContext.Execution.ID,
+		WorkflowID:    execContext.Workflow.ID,
+		CorrelationID: execContext.Execution.CorrelationID,
+		StepID:        step.ID,
+		Timestamp:     e.now(),
 		Data: map[string]interface{}{
 			"step_type": step.Type,
 			"input":     stepInput,
 		},
 	})
 
-	e.logger.WithFields(logrus.Fields{
-		"execution_id": execContext.Execution.ID,
-		"step_id":      step.ID,
-		"step_type":    step.Type,
-	}).Info("Executing workflow step")
+	logger.Log(sampledLevel(sampled), "Executing workflow step")
 
-	// Execute step
-	startTime := time.Now()
-	output, err := executor.Execute(execContext.Context, step, stepInput)
-	duration := time.Since(startTime)
+	// Execute step, or replay its recorded outcome
+	startTime := e.now()
+	output, replayed, err := e.runStep(stepCtx, executor, step, stepInput)
+	duration := e.now().Sub(startTime)
+	if replayed {
+		stepExecution.Metadata = map[string]interface{}{"replayed": true}
+	}
+	if err == nil {
+		err = e.storeStepOutput(execContext, step, output)
+	}
 
 	if err != nil {
 		stepExecution.Status = models.StepStatusFailed
 		stepExecution.Error = err.Error()
-		stepExecution.CompletedAt = &[]time.Time{time.Now().UTC()}[0]
-		stepExecution.Duration = int64(duration.Seconds())
+		stepExecution.AfterResponse = execContext.responded()
+		stepExecution.CompletedAt = &[]time.Time{e.now()}[0]
+		stepExecution.Duration = duration.Milliseconds()
+		stepExecution.Attempt = execContext.RetryCount + 1
+		stepExecution.MaxAttempts = 1
+		if step.ErrorHandling != nil && step.ErrorHandling.RetryPolicy != nil {
+			stepExecution.MaxAttempts = step.ErrorHandling.RetryPolicy.MaxRetries + 1
+		}
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) {
+			stepExecution.OutputData = map[string]interface{}{"status_code": statusErr.StatusCode}
+		}
+		var violationErr *contracts.ViolationError
+		if errors.As(err, &violationErr) {
+			stepExecution.OutputData = map[string]interface{}{"contract_violations": violationErr.Violations}
+		}
+		failedData := map[string]interface{}{
+			"duration":       duration.Seconds(),
+			"after_response": stepExecution.AfterResponse,
+			"replayed":       replayed,
+		}
+		if hint := retryHintOf(err); hint != nil {
+			e.recordRetryHint(stepExecution, hint)
+			failedData["retry_hint"] = retryHintData(hint)
+		}
+		execContext.recordFailedStep(stepExecution)
 
 		// Emit step failed event
-		e.emitEvent(&WorkflowEvent{
-			Type:        "step.failed",
-			ExecutionID: execContext.Execution.ID,
-			WorkflowID:  execContext.Workflow.ID,
-			StepID:      step.ID,
-			Timestamp:   time.Now().UTC(),
-			Error:       err.Error(),
-			Data: map[string]interface{}{
-				"duration": duration.Seconds(),
-			},
+		e.emitExecutionEvent(execContext, &WorkflowEvent{
+			Type:          "step.failed",
+			ExecutionID:   execContext.Execution.ID,
+			WorkflowID:    execContext.Workflow.ID,
+			CorrelationID: execContext.Execution.CorrelationID,
+			StepID:        step.ID,
+			Timestamp:     e.now(),
+			Error:         err.Error(),
+			Data:          failedData,
 		})
 
 		e.metrics.RecordStepExecution(stepExecution)
+		e.persistStep(execContext, stepExecution)
+
+		logger.WithError(err).WithField("duration", duration.Seconds()).Error("Workflow step failed")
 		return err
 	}
 
 	// Step completed successfully
 	stepExecution.Status = models.StepStatusCompleted
-	stepExecution.Output = output
-	stepExecution.CompletedAt = &[]time.Time{time.Now().UTC()}[0]
-	stepExecution.Duration = int64(duration.Seconds())
+	stepExecution.AfterResponse = execContext.responded()
+	stepExecution.OutputData = output
+	stepExecution.CompletedAt = &[]time.Time{e.now()}[0]
+	stepExecution.Duration = duration.Milliseconds()
 
-	// Store step result
+	// Emit step completed event
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          "step.completed",
+		ExecutionID:   execContext.Execution.ID,
+		WorkflowID:    execContext.Workflow.ID,
+		CorrelationID: execContext.Execution.CorrelationID,
+		StepID:        step.ID,
+		Timestamp:     e.now(),
+		Data: map[string]interface{}{
+			"output":         output,
+			"duration":       duration.Seconds(),
+			"after_response": stepExecution.AfterResponse,
+			"replayed":       replayed,
+		},
+	})
+
+	e.metrics.RecordStepExecution(stepExecution)
+	e.persistStep(execContext, stepExecution)
+
+	e.logStepCompleted(logger, duration, sampled)
+
+	return nil
+}
+
+// storeStepOutput stores the result of a completed step and maps its output
+// to the variables of the execution. It returns ErrVariableBudgetExceeded
+// when the variables exceed the budget of the engine once merged.
+func (e *Engine) storeStepOutput(execContext *ExecutionContext, step *models.WorkflowStep, output map[string]interface{}) error {
+	budget := e.variableBudget()
 	execContext.mu.Lock()
+	defer execContext.mu.Unlock()
 	execContext.StepResults[step.ID] = output
 	// Apply output mapping to variables
 	if step.Output != nil {
 		mappedOutput := e.evaluateDataMapping(execContext, step.Output)
 		for key, value := range mappedOutput {
-			execContext.Variables[key] = value
+			execContext.setVariableLocked(key, value)
 		}
 	} else {
 		// Default: merge output into variables
 		for key, value := range output {
-			execContext.Variables[key] = value
+			execContext.setVariableLocked(key, value)
 		}
 	}
-	execContext.mu.Unlock()
-
-	// Emit step completed event
-	e.emitEvent(&WorkflowEvent{
-		Type:        "step.completed",
-		ExecutionID: execContext.Execution.ID,
-		WorkflowID:  execContext.Workflow.ID,
-		StepID:      step.ID,
-		Timestamp:   time.Now().UTC(),
-		Data: map[string]interface{}{
-			"output":   output,
-			"duration": duration.Seconds(),
-		},
-	})
-
-	e.metrics.RecordStepExecution(stepExecution)
-
-	e.logger.WithFields(logrus.Fields{
-		"execution_id": execContext.Execution.ID,
-		"step_id":      step.ID,
-		"duration":     duration.Seconds(),
-	}).Info("Workflow step completed")
-
-	return nil
+	return e.checkVariableBudgetLocked(execContext, step, budget)
 }
 
 // shouldRetry determines if a step should be retried
@@ -416,135 +677,214 @@ func (e *Engine) shouldRetry(execContext *ExecutionContext, step *models.Workflo
 	return true
 }
 
-// retryStep retries a failed step
-func (e *Engine) retryStep(execContext *ExecutionContext, step *models.WorkflowStep) {
+// retryStep retries a step that failed with stepErr. Steps asked to retry
+// after the deadline of the execution are not retried, the error returned
+// fails them.
+func (e *Engine) retryStep(ctx context.Context, execContext *ExecutionContext, step *models.WorkflowStep, stepErr error) error {
 	execContext.mu.Lock()
 	execContext.RetryCount++
+	retryCount := execContext.RetryCount
 	execContext.mu.Unlock()
 
 	retryPolicy := step.ErrorHandling.RetryPolicy
-	delay := time.Duration(retryPolicy.InitialDelay) * time.Second
+	backoff := time.Duration(retryPolicy.InitialDelay) * time.Second
 	if retryPolicy.BackoffMultiplier > 0 {
-		for i := 0; i < execContext.RetryCount-1; i++ {
-			delay = time.Duration(float64(delay) * retryPolicy.BackoffMultiplier)
+		for i := 0; i < retryCount-1; i++ {
+			backoff = time.Duration(float64(backoff) * retryPolicy.BackoffMultiplier)
 		}
 	}
+	maxDelay, _ := time.ParseDuration(retryPolicy.MaxDelay)
 
-	e.logger.WithFields(logrus.Fields{
-		"execution_id": execContext.Execution.ID,
-		"step_id":      step.ID,
-		"retry_count":  execContext.RetryCount,
-		"delay":        delay.Seconds(),
-	}).Info("Retrying workflow step")
+	// Wait at least as long as the failed service asked
+	delay, err := hintedRetryDelay(execContext.Context, backoff, maxDelay, stepErr)
+	if err != nil {
+		execContext.stepLogger(step).WithError(err).Warn("Not retrying workflow step past the execution deadline")
+		return err
+	}
+	// Retries share the execution timeout: a retry that cannot start
+	// before the deadline is not waited for
+	if err := retryBudget(execContext.Context, retryCount, delay, stepErr); err != nil {
+		execContext.stepLogger(step).WithError(err).Warn("Retry budget of the execution spent")
+		return err
+	}
+
+	fields := logrus.Fields{
+		"retry_count": retryCount,
+		"delay":       delay.Seconds(),
+	}
+	if hint := retryHintOf(stepErr); hint != nil {
+		fields["hint_source"] = hint.Source
+	}
+	execContext.stepLogger(step).WithFields(fields).Info("Retrying workflow step")
 
 	// Wait before retry
 	select {
-	case <-time.After(delay):
+	case <-e.after(delay):
 	case <-execContext.Context.Done():
-		return
+		return nil
 	}
 
-	// Retry the step
-	e.executeStep(execContext, step)
+	// Retry the step. Only an exceeded variable budget fails the execution.
+	if err := e.executeStepIn(ctx, execContext, step); errors.Is(err, ErrVariableBudgetExceeded) {
+		return err
+	}
+	return nil
 }
 
 // completeExecution marks an execution as completed
 func (e *Engine) completeExecution(execContext *ExecutionContext) {
-	now := time.Now().UTC()
+	now := e.now()
 	execContext.EndTime = &now
 
 	execContext.Execution.Status = models.ExecutionStatusCompleted
+	if len(execContext.Warnings) > 0 {
+		execContext.Execution.Status = models.ExecutionStatusCompletedWithWarnings
+		execContext.Execution.Warnings = execContext.Warnings
+	}
 	execContext.Execution.Output = execContext.Output
 	execContext.Execution.CompletedAt = &now
-	execContext.Execution.Duration = int64(now.Sub(execContext.StartTime).Seconds())
+	execContext.Execution.Duration = now.Sub(execContext.StartTime).Milliseconds()
 	execContext.Execution.UpdatedAt = now
 
 	// Emit execution completed event
-	e.emitEvent(&WorkflowEvent{
-		Type:        "execution.completed",
-		ExecutionID: execContext.Execution.ID,
-		WorkflowID:  execContext.Workflow.ID,
-		Timestamp:   now,
-		Data: map[string]interface{}{
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          "execution.completed",
+		ExecutionID:   execContext.Execution.ID,
+		WorkflowID:    execContext.Workflow.ID,
+		CorrelationID: execContext.Execution.CorrelationID,
+		Timestamp:     now,
+		Data: e.terminalEventData(execContext, now, map[string]interface{}{
 			"output":   execContext.Output,
-			"duration": execContext.Execution.Duration,
-		},
+			"status":   execContext.Execution.Status,
+			"warnings": execContext.Warnings,
+		}),
 	})
 
-	e.logger.WithFields(logrus.Fields{
-		"execution_id": execContext.Execution.ID,
-		"workflow_id":  execContext.Workflow.ID,
-		"duration":     execContext.Execution.Duration,
+	execContext.Logger.WithFields(logrus.Fields{
+		"duration": execContext.Execution.Duration,
+		"warnings": len(execContext.Warnings),
 	}).Info("Workflow execution completed")
 }
 
 // failExecution marks an execution as failed
 func (e *Engine) failExecution(execContext *ExecutionContext, err error) {
-	now := time.Now().UTC()
+	now := e.now()
 	execContext.EndTime = &now
 
 	execContext.Execution.Status = models.ExecutionStatusFailed
 	execContext.Execution.Error = err.Error()
+	var deadlineErr *RetryDeadlineError
+	var budgetErr *RetryBudgetError
+	switch {
+	case errors.As(err, &deadlineErr):
+		execContext.Execution.ErrorCode = ErrorCodeRetryHintExceedsDeadline
+	case errors.As(err, &budgetErr):
+		execContext.Execution.ErrorCode = ErrorCodeRetryBudgetExhausted
+	}
 	execContext.Execution.CompletedAt = &now
-	execContext.Execution.Duration = int64(now.Sub(execContext.StartTime).Seconds())
+	execContext.Execution.Duration = now.Sub(execContext.StartTime).Milliseconds()
 	execContext.Execution.UpdatedAt = now
+	e.classifyFailure(execContext)
 
-	// Emit execution failed event
-	e.emitEvent(&WorkflowEvent{
-		Type:        "execution.failed",
-		ExecutionID: execContext.Execution.ID,
-		WorkflowID:  execContext.Workflow.ID,
-		Timestamp:   now,
-		Error:       err.Error(),
-		Data: map[string]interface{}{
-			"duration": execContext.Execution.Duration,
-		},
+	// Emit execution failed event, with the triage class for escalations
+	var extra map[string]interface{}
+	if execContext.Execution.Triage != nil {
+		extra = map[string]interface{}{"triage": execContext.Execution.Triage}
+	}
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          "execution.failed",
+		ExecutionID:   execContext.Execution.ID,
+		WorkflowID:    execContext.Workflow.ID,
+		CorrelationID: execContext.Execution.CorrelationID,
+		Timestamp:     now,
+		Error:         err.Error(),
+		Data:          e.terminalEventData(execContext, now, extra),
 	})
 
 	e.metrics.RecordError(err, map[string]interface{}{
-		"execution_id": execContext.Execution.ID,
-		"workflow_id":  execContext.Workflow.ID,
+		"execution_id":    execContext.Execution.ID,
+		"workflow_id":     execContext.Workflow.ID,
+		correlation.Field: execContext.Execution.CorrelationID,
 	})
 
-	e.logger.WithFields(logrus.Fields{
-		"execution_id": execContext.Execution.ID,
-		"workflow_id":  execContext.Workflow.ID,
-		"error":        err.Error(),
-		"duration":     execContext.Execution.Duration,
+	execContext.Logger.WithFields(logrus.Fields{
+		"error":    err.Error(),
+		"duration": execContext.Execution.Duration,
+		"triage":   execContext.Execution.TriageClass,
 	}).Error("Workflow execution failed")
 }
 
 // cancelExecution cancels an execution
 func (e *Engine) cancelExecution(execContext *ExecutionContext, reason string) {
-	now := time.Now().UTC()
+	now := e.now()
 	execContext.EndTime = &now
 
 	execContext.Execution.Status = models.ExecutionStatusCancelled
 	execContext.Execution.Error = reason
 	execContext.Execution.CompletedAt = &now
-	execContext.Execution.Duration = int64(now.Sub(execContext.StartTime).Seconds())
+	execContext.Execution.Duration = now.Sub(execContext.StartTime).Milliseconds()
 	execContext.Execution.UpdatedAt = now
 
 	// Emit execution cancelled event
-	e.emitEvent(&WorkflowEvent{
-		Type:        "execution.cancelled",
-		ExecutionID: execContext.Execution.ID,
-		WorkflowID:  execContext.Workflow.ID,
-		Timestamp:   now,
-		Data: map[string]interface{}{
-			"reason":   reason,
-			"duration": execContext.Execution.Duration,
-		},
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          "execution.cancelled",
+		ExecutionID:   execContext.Execution.ID,
+		WorkflowID:    execContext.Workflow.ID,
+		CorrelationID: execContext.Execution.CorrelationID,
+		Timestamp:     now,
+		Data: e.terminalEventData(execContext, now, map[string]interface{}{
+			"reason": reason,
+		}),
 	})
 
-	e.logger.WithFields(logrus.Fields{
-		"execution_id": execContext.Execution.ID,
-		"workflow_id":  execContext.Workflow.ID,
-		"reason":       reason,
-		"duration":     execContext.Execution.Duration,
+	execContext.Logger.WithFields(logrus.Fields{
+		"reason":   reason,
+		"duration": execContext.Execution.Duration,
 	}).Info("Workflow execution cancelled")
 }
 
+// terminalEventData returns the execution summary attached to events that end
+// an execution, merged with event specific data
+func (e *Engine) terminalEventData(execContext *ExecutionContext, now time.Time, extra map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{
+		"duration":         execContext.Execution.Duration,
+		"duration_ms":      now.Sub(execContext.StartTime).Milliseconds(),
+		"started_at":       execContext.StartTime,
+		"workflow_name":    execContext.Workflow.Name,
+		"workflow_version": execContext.Workflow.Version,
+		"trigger_type":     string(execContext.Execution.TriggerType),
+		"node_id":          execContext.Execution.NodeID,
+		"labels":           execContext.Workflow.Definition.Metadata.Labels,
+		"error_code":       execContext.Execution.ErrorCode,
+		"execution_mode":   execContext.Execution.ExecutionMode,
+	}
+	if execContext.Execution.GroupID != nil {
+		data["group_id"] = *execContext.Execution.GroupID
+		data["labels"] = mergeLabels(execContext.Workflow.Definition.Metadata.Labels, execContext.Execution.Labels)
+	}
+	if cost, ok := execContext.Execution.Metadata["cost"]; ok {
+		data["cost"] = cost
+	}
+
+	for key, value := range extra {
+		data[key] = value
+	}
+	return data
+}
+
+// mergeLabels returns the labels of a workflow with the labels of its
+// execution, which take precedence
+func mergeLabels(workflowLabels, executionLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(workflowLabels)+len(executionLabels))
+	for key, value := range workflowLabels {
+		labels[key] = value
+	}
+	for key, value := range executionLabels {
+		labels[key] = value
+	}
+	return labels
+}
+
 // CancelExecution cancels a running execution
 func (e *Engine) CancelExecution(executionID uuid.UUID) error {
 	e.mu.RLock()
@@ -559,7 +899,8 @@ func (e *Engine) CancelExecution(executionID uuid.UUID) error {
 	return nil
 }
 
-// GetExecution gets an execution context
+// GetExecution gets the live execution context. Its fields are mutated while
+// the execution runs, status readers use GetExecutionStatus instead.
 func (e *Engine) GetExecution(executionID uuid.UUID) (*ExecutionContext, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
@@ -572,19 +913,6 @@ func (e *Engine) GetExecution(executionID uuid.UUID) (*ExecutionContext, error)
 	return execContext, nil
 }
 
-// ListExecutions lists all running executions
-func (e *Engine) ListExecutions() []*ExecutionContext {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
-
-	executions := make([]*ExecutionContext, 0, len(e.executions))
-	for _, execContext := range e.executions {
-		executions = append(executions, execContext)
-	}
-
-	return executions
-}
-
 // emitEvent emits a workflow event to all registered handlers
 func (e *Engine) emitEvent(event *WorkflowEvent) {
 	e.mu.RLock()
@@ -593,18 +921,43 @@ func (e *Engine) emitEvent(event *WorkflowEvent) {
 	e.mu.RUnlock()
 
 	for _, handler := range handlers {
+		if queued, ok := handler.(QueuedEventHandler); ok {
+			queued.Enqueue(event)
+			continue
+		}
+
 		go func(h EventHandler) {
 			if err := h.Handle(event); err != nil {
 				e.logger.WithFields(logrus.Fields{
-					"event_type": event.Type,
-					"error":      err.Error(),
+					"event_type":      event.Type,
+					"execution_id":    event.ExecutionID,
+					correlation.Field: event.CorrelationID,
+					"error":           err.Error(),
 				}).Error("Failed to handle workflow event")
 			}
 		}(handler)
 	}
 }
 
-// evaluateDataMapping evaluates data mapping expressions
+// PublishEvent emits an event not tied to an execution, such as the burn
+// alerts of SLOs, to all registered handlers
+func (e *Engine) PublishEvent(eventType string, workflowID uuid.UUID, data map[string]interface{}) {
+	e.emitEvent(&WorkflowEvent{
+		Type:       eventType,
+		WorkflowID: workflowID,
+		Timestamp:  e.now(),
+		Data:       data,
+	})
+}
+
+// mappingName matches the step and variable names of data mappings
+var mappingName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// evaluateDataMapping evaluates a data mapping. Values holding a single
+// ${expression} are evaluated against the step results and variables, the
+// variables shadowing step results of the same name, and the environment
+// of the execution as env; other values are literals. Expressions
+// evaluating to null or failing leave their key out.
 func (e *Engine) evaluateDataMapping(execContext *ExecutionContext, mapping *models.DataMapping) map[string]interface{} {
 	result := make(map[string]interface{})
 
@@ -615,30 +968,94 @@ func (e *Engine) evaluateDataMapping(execContext *ExecutionContext, mapping *mod
 	execContext.mu.RLock()
 	defer execContext.mu.RUnlock()
 
-	// Simple implementation - in a real system, you'd want a more sophisticated expression evaluator
+	var document map[string]interface{}
 	for key, expr := range *mapping {
-		if exprStr, ok := expr.(string); ok {
-			// Handle variable references like ${variable_name}
-			if len(exprStr) > 3 && exprStr[:2] == "${" && exprStr[len(exprStr)-1:] == "}" {
-				varName := exprStr[2 : len(exprStr)-1]
-				if value, exists := execContext.Variables[varName]; exists {
-					result[key] = value
-				} else if value, exists := execContext.StepResults[varName]; exists {
-					result[key] = value
-				}
-			} else {
-				// Literal value
-				result[key] = expr
-			}
-		} else {
+		exprStr, ok := expr.(string)
+		if !ok {
 			// Non-string value
 			result[key] = expr
+			continue
+		}
+		source, ok := expressions.Embedded(exprStr)
+		if !ok {
+			// Literal value
+			result[key] = expr
+			continue
+		}
+
+		if document == nil {
+			document = make(map[string]interface{}, len(execContext.StepResults)+len(execContext.Variables))
+			for name, value := range execContext.StepResults {
+				document[name] = value
+			}
+			for name, value := range execContext.Variables {
+				document[name] = value
+			}
+			document[environmentName] = environmentDocument(execContext.Environment)
+		}
+		// Names, which may hold dashes, are looked up without parsing
+		if value, exists := document[source]; exists {
+			result[key] = value
+			continue
+		}
+		if mappingName.MatchString(source) {
+			continue
+		}
+		value, err := e.evaluateExpression(execContext.Context, source, document)
+		if err != nil {
+			execContext.Logger.WithError(err).WithField("key", key).Warn("Failed to evaluate data mapping expression")
+			continue
+		}
+		if value != nil {
+			result[key] = value
 		}
 	}
 
 	return result
 }
 
+// evaluateExpression evaluates an expression of a data mapping in the
+// expression environment of the execution
+func (e *Engine) evaluateExpression(ctx context.Context, source string, document map[string]interface{}) (interface{}, error) {
+	expr, err := expressions.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return expr.Eval(ctx, expressions.EnvFromContext(ctx), document)
+}
+
+// SetCalendars sets the business calendars expressions look up in
+// addBusinessDays, such as the scheduler service
+func (e *Engine) SetCalendars(calendars expressions.Calendars) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calendars = calendars
+}
+
+// SetClock sets the clock executions read their start, step and event times
+// from. The engine reads the system clock until set.
+func (e *Engine) SetClock(clock scheduler.Clock) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clock = clock
+}
+
+// now returns the current time of the engine clock, in UTC
+func (e *Engine) now() time.Time {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.clock.Now().UTC()
+}
+
+// after returns a channel receiving the time once d elapsed on the engine
+// clock
+func (e *Engine) after(d time.Duration) <-chan time.Time {
+	e.mu.RLock()
+	clock := e.clock
+	e.mu.RUnlock()
+	return scheduler.After(clock, d)
+}
+
 // Shutdown gracefully shuts down the engine
 func (e *Engine) Shutdown(ctx context.Context) error {
 	e.logger.Info("Shutting down workflow engine")
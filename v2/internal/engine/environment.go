@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+// environmentName is the document field expressions read the environment of
+// the execution from, as ${env.KEY}
+const environmentName = "env"
+
+// ErrUndefinedEnvironment is returned for ${env.KEY} placeholders of step
+// configs naming keys the environment of the execution does not define
+var ErrUndefinedEnvironment = errors.New("undefined environment variable")
+
+// environmentPlaceholder matches the ${env.KEY} placeholders of step configs
+var environmentPlaceholder = regexp.MustCompile(`\$\{\s*env\.([A-Za-z0-9_-]+)\s*\}`)
+
+type environmentKey struct{}
+
+// WithEnvironment returns a context carrying the environment of the running
+// execution
+func WithEnvironment(ctx context.Context, environment map[string]string) context.Context {
+	return context.WithValue(ctx, environmentKey{}, environment)
+}
+
+// EnvironmentFromContext returns the environment of the execution a step
+// runs in. It is the environment of the workflow definition, not that of
+// the server process.
+func EnvironmentFromContext(ctx context.Context) map[string]string {
+	environment, _ := ctx.Value(environmentKey{}).(map[string]string)
+	return environment
+}
+
+// ExpandEnvironment replaces the ${env.KEY} placeholders of a step config
+// value with the environment of the execution a step runs in. Placeholders
+// of keys the environment does not define fail with
+// ErrUndefinedEnvironment rather than reach downstream services.
+func ExpandEnvironment(ctx context.Context, value string) (string, error) {
+	environment := EnvironmentFromContext(ctx)
+	var err error
+	expanded := environmentPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		key := environmentPlaceholder.FindStringSubmatch(placeholder)[1]
+		resolved, ok := environment[key]
+		if !ok && err == nil {
+			err = fmt.Errorf("%w: %s", ErrUndefinedEnvironment, key)
+		}
+		return resolved
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// resolveEnvironment returns the environment of a starting execution: the
+// environment of the workflow definition, with the keys the environment of
+// the execution config overrides. Values are resolved once, so every step
+// and retry of the execution sees the same environment.
+func resolveEnvironment(definition *models.WorkflowDefinition, config map[string]interface{}) map[string]string {
+	environment := make(map[string]string, len(definition.Spec.Environment))
+	for key, value := range definition.Spec.Environment {
+		environment[key] = value
+	}
+	if overrides, ok := config["environment"].(map[string]interface{}); ok {
+		for key, value := range overrides {
+			environment[key] = fmt.Sprint(value)
+		}
+	}
+	return environment
+}
+
+// environmentDocument returns the environment of an execution as the env
+// field of the documents expressions are evaluated against
+func environmentDocument(environment map[string]string) map[string]interface{} {
+	document := make(map[string]interface{}, len(environment))
+	for key, value := range environment {
+		document[key] = value
+	}
+	return document
+}
+
+// expandHTTPConfig returns the config of an http step with the ${env.KEY}
+// placeholders of its URL, headers and query parameters expanded. The
+// config is shared by the executions of the workflow version, so it is
+// copied rather than changed.
+func expandHTTPConfig(ctx context.Context, config *stepconfig.HTTPConfig) (*stepconfig.HTTPConfig, error) {
+	expanded := *config
+	var err error
+	if expanded.URL, err = ExpandEnvironment(ctx, config.URL); err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+	if len(config.Headers) > 0 {
+		expanded.Headers = make(map[string]string, len(config.Headers))
+		for name, value := range config.Headers {
+			if expanded.Headers[name], err = ExpandEnvironment(ctx, value); err != nil {
+				return nil, fmt.Errorf("header %s: %w", name, err)
+			}
+		}
+	}
+	if len(config.Params) > 0 {
+		expanded.Params = make(map[string]interface{}, len(config.Params))
+		for name, value := range config.Params {
+			text, ok := value.(string)
+			if !ok {
+				expanded.Params[name] = value
+				continue
+			}
+			if expanded.Params[name], err = ExpandEnvironment(ctx, text); err != nil {
+				return nil, fmt.Errorf("param %s: %w", name, err)
+			}
+		}
+	}
+	return &expanded, nil
+}
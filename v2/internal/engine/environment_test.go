@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func TestEnvironmentInHTTPStepURL(t *testing.T) {
+	var requests []*http.Request
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "42"}`))
+	}))
+	defer service.Close()
+
+	logger, _ := test.NewNullLogger()
+	e := NewEngine(10, nopMetrics{}, logger)
+	e.SetStepStore(&recordingStepStore{})
+	e.RegisterStepExecutor("http", NewHTTPExecutor(logger))
+
+	definition := &models.WorkflowDefinition{Spec: models.WorkflowSpec{Environment: map[string]string{
+		"ORDERS_URL": "http://orders.invalid",
+		"REGION":     "eu-west-1",
+	}}}
+	execContext := newLoggingExecution(logger)
+	execContext.Environment = resolveEnvironment(definition, map[string]interface{}{
+		"environment": map[string]interface{}{"ORDERS_URL": service.URL},
+	})
+	step := &models.WorkflowStep{
+		ID:   "fetch-order",
+		Name: "fetch-order",
+		Type: "http",
+		Config: map[string]interface{}{
+			"url":     "${env.ORDERS_URL}/v1/orders/42",
+			"headers": map[string]interface{}{"X-Region": "${env.REGION}"},
+		},
+		Input: &models.DataMapping{"region": "${env.REGION}"},
+	}
+
+	// The execution config overrides the environment of the definition,
+	// resolved when the step runs
+	require.NoError(t, e.executeStep(execContext, step))
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/v1/orders/42", requests[0].URL.Path)
+	assert.Equal(t, "eu-west-1", requests[0].Header.Get("X-Region"))
+	assert.Equal(t, map[string]interface{}{"id": "42"}, execContext.StepResults["fetch-order"].(map[string]interface{})["json"])
+
+	// Expressions read the environment as env
+	assert.Equal(t, map[string]interface{}{"region": "eu-west-1"}, e.evaluateDataMapping(execContext, step.Input))
+
+	// Keys the environment does not define fail the step, without a request
+	step.Config["url"] = "${env.BILLING_URL}/v1/invoices"
+	step.ID = "fetch-invoice"
+	err := e.executeStep(execContext, step)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrUndefinedEnvironment), "err = %v", err)
+	assert.Len(t, requests, 1)
+}
+
+func TestExpandEnvironment(t *testing.T) {
+	ctx := WithEnvironment(context.Background(), map[string]string{"HOST": "api.example.com", "EMPTY": ""})
+
+	expanded, err := ExpandEnvironment(ctx, "https://${env.HOST}/${ env.HOST }${env.EMPTY}")
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.example.com/api.example.com", expanded)
+
+	// Other placeholders are left to the step input
+	expanded, err = ExpandEnvironment(ctx, "${order_id}")
+	require.NoError(t, err)
+	assert.Equal(t, "${order_id}", expanded)
+
+	// The environment is not that of the server process
+	t.Setenv("MF_TEST_HOST", "localhost")
+	_, err = ExpandEnvironment(ctx, "${env.MF_TEST_HOST}")
+	assert.True(t, errors.Is(err, ErrUndefinedEnvironment), "err = %v", err)
+}
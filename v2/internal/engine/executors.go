@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os/exec"
 	"strings"
 	"time"
@@ -14,13 +16,32 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/sirupsen/logrus"
 
+	"magic-flow/v2/internal/artifacts"
+	"magic-flow/v2/internal/contracts"
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/scratch"
+	"magic-flow/v2/internal/scripting"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/internal/warmup"
 	"magic-flow/v2/pkg/models"
 )
 
-// HTTPExecutor executes HTTP requests
+// HTTPExecutor executes HTTP requests. The steps of every execution share
+// one transport, keeping connections to each host alive. Steps declaring a
+// response_schema fail when the response violates it. Artifact request
+// bodies and responses above response_artifact_bytes are streamed between
+// the artifact store and the connection, and responses of response_scratch
+// steps into the scratch area of their execution.
 type HTTPExecutor struct {
-	client *resty.Client
-	logger *logrus.Logger
+	client    *resty.Client
+	transport *http.Transport
+	warmup    warmup.Config
+	metrics   warmup.MetricsRecorder
+	contracts *contracts.Cache
+	artifacts artifacts.Store
+	scratch   *scratch.Space
+	logger    *logrus.Logger
 }
 
 // NewHTTPExecutor creates a new HTTP executor
@@ -31,52 +52,223 @@ func NewHTTPExecutor(logger *logrus.Logger) *HTTPExecutor {
 	client.SetRetryWaitTime(1 * time.Second)
 	client.SetRetryMaxWaitTime(10 * time.Second)
 
-	return &HTTPExecutor{
-		client: client,
-		logger: logger,
+	e := &HTTPExecutor{
+		client:    client,
+		contracts: contracts.NewCache(),
+		logger:    logger,
 	}
+	e.SetWarmup(warmup.DefaultConfig())
+	return e
+}
+
+// SetWarmup sets the warm-up config, replacing the shared transport with
+// one keeping as many connections alive per host
+func (e *HTTPExecutor) SetWarmup(config warmup.Config) {
+	e.warmup = config
+	e.transport = warmup.NewTransport(config)
+	e.client.SetTransport(e.transport)
+}
+
+// SetMetrics sets the recorder of the executor_starts_total metric, counting
+// the requests sent on warm connections and on new ones, and of the
+// http_response_contract_violations_total metric, counting the responses
+// violating the contract of each step
+func (e *HTTPExecutor) SetMetrics(metrics warmup.MetricsRecorder) {
+	e.metrics = metrics
+}
+
+// SetArtifacts sets the store of the artifacts steps send as request bodies
+// and of the responses above response_artifact_bytes. Without one, such
+// steps fail.
+func (e *HTTPExecutor) SetArtifacts(store artifacts.Store) {
+	e.artifacts = store
+}
+
+// SetScratch sets the scratch space response_scratch steps stream their
+// response into. Without one, such steps fail.
+func (e *HTTPExecutor) SetScratch(space *scratch.Space) {
+	e.scratch = space
+}
+
+// Warm opens connections to the hosts of the http steps of a workflow
+// version, so its first steps skip DNS resolution and the TLS handshake
+func (e *HTTPExecutor) Warm(ctx context.Context, hints *warmup.Hints) error {
+	if len(hints.Hosts) == 0 {
+		return nil
+	}
+	return warmup.WarmHosts(ctx, &http.Client{Transport: e.transport}, hints.Hosts, e.warmup.ConnectionsPerHost)
 }
 
 func (e *HTTPExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
-	// Extract HTTP configuration
-	config, ok := step.Config["http"].(map[string]interface{})
+	config, err := httpConfig(ctx, step)
+	if err != nil {
+		return nil, err
+	}
+	contract, err := e.contract(ctx, step, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	var body []byte
+	if ref := bodyArtifact(config, input); ref != "" || len(config.Multipart) > 0 || config.ResponseArtifactBytes > 0 || config.ResponseScratch != "" {
+		result, body, err = e.stream(ctx, step, config, ref, input)
+	} else {
+		var resp *resty.Response
+		if result, resp, err = e.call(ctx, step, config, config.URL, input); err == nil {
+			body = resp.Body()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the response against the contract of the step before its data
+	// reaches the variables of the execution
+	if contract != nil {
+		body, violations := contract.CheckBody(body)
+		if len(violations) > 0 {
+			e.recordViolation(ctx, step)
+			return nil, &contracts.ViolationError{StepID: step.Name, Violations: violations}
+		}
+		result["json"] = body
+	}
+
+	return result, nil
+}
+
+// TestContract calls a step outside any execution and reports whether the
+// response conforms to the contract of the step. A base URL replaces the
+// scheme and host of the step URL, targeting another environment.
+func (e *HTTPExecutor) TestContract(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}, baseURL string) (*contracts.Report, error) {
+	config, err := httpConfig(ctx, step)
+	if err != nil {
+		return nil, err
+	}
+	if config.ResponseSchema == nil {
+		return nil, fmt.Errorf("%w: step %s", ErrNoContract, step.Name)
+	}
+	contract, err := contracts.Compile(config.ResponseSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	target := config.URL
+	if baseURL != "" {
+		if target, err = rebaseURL(config.URL, baseURL); err != nil {
+			return nil, err
+		}
+	}
+
+	_, resp, err := e.call(ctx, step, config, target, input)
+	if err != nil {
+		return nil, err
+	}
+
+	report := contracts.NewReport(contract.CheckBody(resp.Body()))
+	report.StepID = step.Name
+	report.Method = resp.Request.Method
+	report.URL = target
+	report.StatusCode = resp.StatusCode()
+	report.DurationMs = resp.Time().Milliseconds()
+	return report, nil
+}
+
+// httpConfig returns the typed config of an http step, with the ${env.KEY}
+// placeholders of the environment of its execution expanded
+func httpConfig(ctx context.Context, step *models.WorkflowStep) (*stepconfig.HTTPConfig, error) {
+	typed, err := typedStepConfig(ctx, stepconfig.HTTPSchema, "http", step)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := typed.(*stepconfig.HTTPConfig)
 	if !ok {
 		return nil, fmt.Errorf("invalid HTTP configuration")
 	}
+	return expandHTTPConfig(ctx, config)
+}
 
-	url, ok := config["url"].(string)
+// contract returns the compiled response schema of a step, compiled once
+// per workflow version, or nil for steps without one
+func (e *HTTPExecutor) contract(ctx context.Context, step *models.WorkflowStep, config *stepconfig.HTTPConfig) (*contracts.Schema, error) {
+	if config.ResponseSchema == nil {
+		return nil, nil
+	}
+	workflow, ok := WorkflowFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("URL is required for HTTP step")
+		return contracts.Compile(config.ResponseSchema)
 	}
+	key := stepconfig.CacheKey(workflow.ID.String(), workflow.Version, step.Name)
+	return e.contracts.Compile(key, config.ResponseSchema)
+}
 
-	method := "GET"
-	if m, ok := config["method"].(string); ok {
-		method = strings.ToUpper(m)
+// recordViolation counts a response violating the contract of a step in the
+// http_response_contract_violations_total metric
+func (e *HTTPExecutor) recordViolation(ctx context.Context, step *models.WorkflowStep) {
+	if e.metrics == nil {
+		return
+	}
+	labels := map[string]string{"workflow_id": "", "step_id": step.Name}
+	if workflow, ok := WorkflowFromContext(ctx); ok {
+		labels["workflow_id"] = workflow.ID.String()
 	}
+	e.metrics.RecordMetric("http_response_contract_violations_total", 1, labels)
+}
 
-	// Prepare request
-	req := e.client.R().SetContext(ctx)
+// rebaseURL replaces the scheme and host of a URL with those of a base URL,
+// prefixing its path with the path of the base URL
+func rebaseURL(rawURL, baseURL string) (string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidBaseURL, baseURL)
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid step URL %q: %w", rawURL, err)
+	}
+	target.Scheme = base.Scheme
+	target.Host = base.Host
+	target.Path = strings.TrimSuffix(base.Path, "/") + target.Path
+	target.RawPath = ""
+	return target.String(), nil
+}
+
+// call sends the request of an http step to a URL and returns the step
+// result along with the response
+func (e *HTTPExecutor) call(ctx context.Context, step *models.WorkflowStep, config *stepconfig.HTTPConfig, target string, input map[string]interface{}) (map[string]interface{}, *resty.Response, error) {
+	if target == "" {
+		return nil, nil, fmt.Errorf("URL is required for HTTP step")
+	}
+
+	method := requestMethod(config)
+
+	// Prepare request, tracing whether it reuses a warm connection
+	traceCtx, trace := warmup.WithConnTrace(ctx)
+	req := e.client.R().SetContext(traceCtx)
 
 	// Set headers
-	if headers, ok := config["headers"].(map[string]interface{}); ok {
-		for key, value := range headers {
-			if strValue, ok := value.(string); ok {
-				req.SetHeader(key, strValue)
-			}
-		}
+	for key, value := range config.Headers {
+		req.SetHeader(key, value)
 	}
 
 	// Set query parameters
-	if params, ok := config["params"].(map[string]interface{}); ok {
-		for key, value := range params {
-			req.SetQueryParam(key, fmt.Sprintf("%v", value))
-		}
+	for key, value := range config.Params {
+		req.SetQueryParam(key, fmt.Sprintf("%v", value))
 	}
 
+	// Forward the fencing token of a held lock so downstream services can
+	// reject requests from stale lock holders
+	if token, ok := input[FencingTokenVariable]; ok {
+		req.SetHeader(FencingTokenHeader, fmt.Sprintf("%v", token))
+	}
+
+	// Forward the correlation ID of the execution unless the step sets one
+	correlation.SetHeader(ctx, req.Header)
+
 	// Set body for POST/PUT/PATCH requests
 	if method == "POST" || method == "PUT" || method == "PATCH" {
-		if body, ok := config["body"]; ok {
-			req.SetBody(body)
+		if config.Body != nil {
+			req.SetBody(config.Body)
 		} else if len(input) > 0 {
 			req.SetBody(input)
 		}
@@ -88,26 +280,27 @@ func (e *HTTPExecutor) Execute(ctx context.Context, step *models.WorkflowStep, i
 
 	switch method {
 	case "GET":
-		resp, err = req.Get(url)
+		resp, err = req.Get(target)
 	case "POST":
-		resp, err = req.Post(url)
+		resp, err = req.Post(target)
 	case "PUT":
-		resp, err = req.Put(url)
+		resp, err = req.Put(target)
 	case "PATCH":
-		resp, err = req.Patch(url)
+		resp, err = req.Patch(target)
 	case "DELETE":
-		resp, err = req.Delete(url)
+		resp, err = req.Delete(target)
 	default:
-		return nil, fmt.Errorf("unsupported HTTP method: %s", method)
+		return nil, nil, fmt.Errorf("unsupported HTTP method: %s", method)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
+	warmup.RecordStart(e.metrics, "http", trace.Reused())
 
 	// Check status code
 	if resp.StatusCode() >= 400 {
-		return nil, fmt.Errorf("HTTP request failed with status %d: %s", resp.StatusCode(), resp.String())
+		return nil, nil, httpRetryHint(&HTTPStatusError{StatusCode: resp.StatusCode(), Body: resp.String()}, resp.Header(), time.Now())
 	}
 
 	// Parse response
@@ -118,34 +311,72 @@ func (e *HTTPExecutor) Execute(ctx context.Context, step *models.WorkflowStep, i
 	}
 
 	// Try to parse JSON response
-	if strings.Contains(resp.Header().Get("Content-Type"), "application/json") {
-		var jsonBody interface{}
-		if err := json.Unmarshal(resp.Body(), &jsonBody); err == nil {
-			result["json"] = jsonBody
-		}
-	}
+	parseJSONBody(result, resp.Header(), resp.Body())
 
-	e.logger.WithFields(logrus.Fields{
+	correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
 		"step_id":     step.ID,
 		"method":      method,
-		"url":         url,
+		"url":         target,
 		"status_code": resp.StatusCode(),
 		"duration":    resp.Time().Milliseconds(),
 	}).Info("HTTP request completed")
 
-	return result, nil
+	return result, resp, nil
 }
 
-func (e *HTTPExecutor) Validate(step *models.WorkflowStep) error {
-	config, ok := step.Config["http"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("HTTP configuration is required")
+// requestMethod returns the method of an http step, GET by default
+func requestMethod(config *stepconfig.HTTPConfig) string {
+	if config.Method == "" {
+		return "GET"
 	}
+	return strings.ToUpper(config.Method)
+}
 
-	if _, ok := config["url"].(string); !ok {
-		return fmt.Errorf("URL is required for HTTP step")
+// parseJSONBody adds the body of a JSON response to the result of a step,
+// parsed, when it is valid JSON
+func parseJSONBody(result map[string]interface{}, header http.Header, body []byte) {
+	if !strings.Contains(header.Get("Content-Type"), "application/json") {
+		return
 	}
+	var jsonBody interface{}
+	if err := json.Unmarshal(body, &jsonBody); err == nil {
+		result["json"] = jsonBody
+	}
+}
 
+func (e *HTTPExecutor) Validate(step *models.WorkflowStep) error {
+	section := stepconfig.Section("http", step.Config)
+	if _, err := stepconfig.HTTPSchema.Validate(section, false); err != nil {
+		return err
+	}
+	if definition, ok := section["response_schema"].(map[string]interface{}); ok {
+		if _, err := contracts.Compile(definition); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		typed, err := stepconfig.HTTPSchema.Decode(section)
+		if err != nil {
+			return err
+		}
+		if typed.(*stepconfig.HTTPConfig).ResponseArtifactBytes > 0 {
+			return fmt.Errorf("step %s: responses streamed into artifacts cannot be checked against response_schema", step.Name)
+		}
+		if typed.(*stepconfig.HTTPConfig).ResponseScratch != "" {
+			return fmt.Errorf("step %s: responses streamed into scratch files cannot be checked against response_schema", step.Name)
+		}
+	}
+	if section["response_scratch"] != nil && section["response_artifact_bytes"] != nil {
+		return fmt.Errorf("step %s: response_scratch and response_artifact_bytes cannot both be set", step.Name)
+	}
+	if section["multipart"] != nil {
+		if section["body"] != nil {
+			return fmt.Errorf("step %s: body and multipart cannot both be set", step.Name)
+		}
+		switch method, _ := section["method"].(string); strings.ToUpper(method) {
+		case "POST", "PUT", "PATCH":
+		default:
+			return fmt.Errorf("step %s: multipart bodies are only sent by POST, PUT and PATCH steps", step.Name)
+		}
+	}
 	return nil
 }
 
@@ -153,9 +384,16 @@ func (e *HTTPExecutor) GetType() string {
 	return "http"
 }
 
-// ScriptExecutor executes shell scripts
+func (e *HTTPExecutor) ConfigSchema() *stepconfig.Schema {
+	return stepconfig.HTTPSchema
+}
+
+// ScriptExecutor executes shell scripts, and JavaScript scripts in the
+// script sandbox when a runtime is set
 type ScriptExecutor struct {
-	logger *logrus.Logger
+	logger  *logrus.Logger
+	runtime *scripting.Runtime
+	metrics warmup.MetricsRecorder
 }
 
 // NewScriptExecutor creates a new script executor
@@ -165,29 +403,54 @@ func NewScriptExecutor(logger *logrus.Logger) *ScriptExecutor {
 	}
 }
 
+// SetRuntime sets the sandbox runtime of javascript script steps
+func (e *ScriptExecutor) SetRuntime(runtime *scripting.Runtime) {
+	e.runtime = runtime
+}
+
+// SetMetrics sets the recorder of the executor_starts_total metric, counting
+// the javascript steps run on ready interpreters and on new ones
+func (e *ScriptExecutor) SetMetrics(metrics warmup.MetricsRecorder) {
+	e.metrics = metrics
+}
+
+// Warm loads the pinned modules of the javascript steps of a workflow
+// version and fills the interpreter pool of the runtime
+func (e *ScriptExecutor) Warm(ctx context.Context, hints *warmup.Hints) error {
+	if e.runtime == nil || len(hints.ModuleSets) == 0 {
+		return nil
+	}
+	return e.runtime.Warm(ctx, hints.ModuleSets)
+}
+
 func (e *ScriptExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
 	// Extract script configuration
-	config, ok := step.Config["script"].(map[string]interface{})
+	typed, err := typedStepConfig(ctx, stepconfig.ScriptSchema, "script", step)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := typed.(*stepconfig.ScriptConfig)
 	if !ok {
 		return nil, fmt.Errorf("invalid script configuration")
 	}
 
-	script, ok := config["command"].(string)
-	if !ok {
+	script := config.Command
+	if script == "" {
 		return nil, fmt.Errorf("command is required for script step")
 	}
 
+	if config.Language == "javascript" {
+		return e.executeJavaScript(ctx, step, config, input)
+	}
+
 	// Get shell (default to bash)
 	shell := "bash"
-	if s, ok := config["shell"].(string); ok {
-		shell = s
+	if config.Shell != "" {
+		shell = config.Shell
 	}
 
 	// Get working directory
-	workDir := ""
-	if wd, ok := config["working_directory"].(string); ok {
-		workDir = wd
-	}
+	workDir := config.WorkingDirectory
 
 	// Prepare command
 	cmd := exec.CommandContext(ctx, shell, "-c", script)
@@ -196,10 +459,8 @@ func (e *ScriptExecutor) Execute(ctx context.Context, step *models.WorkflowStep,
 	}
 
 	// Set environment variables
-	if env, ok := config["environment"].(map[string]interface{}); ok {
-		for key, value := range env {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", key, value))
-		}
+	for key, value := range config.Environment {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", key, value))
 	}
 
 	// Add input as environment variables
@@ -212,7 +473,7 @@ func (e *ScriptExecutor) Execute(ctx context.Context, step *models.WorkflowStep,
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	e.logger.WithFields(logrus.Fields{
+	correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
 		"step_id":   step.ID,
 		"command":   script,
 		"shell":     shell,
@@ -221,7 +482,7 @@ func (e *ScriptExecutor) Execute(ctx context.Context, step *models.WorkflowStep,
 
 	// Execute command
 	start := time.Now()
-	err := cmd.Run()
+	err = cmd.Run()
 	duration := time.Since(start)
 
 	result := map[string]interface{}{
@@ -241,7 +502,7 @@ func (e *ScriptExecutor) Execute(ctx context.Context, step *models.WorkflowStep,
 
 	result["exit_code"] = 0
 
-	e.logger.WithFields(logrus.Fields{
+	correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
 		"step_id":  step.ID,
 		"duration": duration.Milliseconds(),
 	}).Info("Script execution completed")
@@ -249,23 +510,74 @@ func (e *ScriptExecutor) Execute(ctx context.Context, step *models.WorkflowStep,
 	return result, nil
 }
 
-func (e *ScriptExecutor) Validate(step *models.WorkflowStep) error {
-	config, ok := step.Config["script"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("script configuration is required")
+// executeJavaScript runs a script in the sandbox under the host function
+// allowlist of the workflow and the limits of its namespace
+func (e *ScriptExecutor) executeJavaScript(ctx context.Context, step *models.WorkflowStep, config *stepconfig.ScriptConfig, input map[string]interface{}) (map[string]interface{}, error) {
+	if e.runtime == nil {
+		return nil, fmt.Errorf("javascript scripts are not enabled")
 	}
 
-	if _, ok := config["command"].(string); !ok {
-		return fmt.Errorf("command is required for script step")
+	req := scripting.RunRequest{
+		Namespace: "default",
+		Source:    config.Command,
+		Input:     input,
+		Modules:   config.Modules,
+	}
+	if workflow, ok := WorkflowFromContext(ctx); ok {
+		if namespace := workflow.Definition.Metadata.Labels["namespace"]; namespace != "" {
+			req.Namespace = namespace
+		}
+		if policy := workflow.Definition.Spec.Scripts; policy != nil {
+			req.AllowedHostFunctions = policy.AllowedHostFunctions
+		}
 	}
 
-	return nil
+	result, err := e.runtime.Run(ctx, req)
+	if result != nil {
+		warmup.RecordStart(e.metrics, "script", result.Warm)
+	}
+	if err != nil {
+		output := map[string]interface{}{}
+		if result != nil {
+			output["usage"] = result.Usage
+		}
+		var scriptErr *scripting.Error
+		if errors.As(err, &scriptErr) {
+			output["error_code"] = scriptErr.Code
+			output["details"] = scriptErr.Details
+		}
+		correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
+			"step_id":    step.ID,
+			"namespace":  req.Namespace,
+			"error_code": scripting.ErrorCode(err),
+		}).WithError(err).Warn("Script failed")
+		return output, err
+	}
+
+	correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
+		"step_id":      step.ID,
+		"namespace":    req.Namespace,
+		"ops":          result.Usage.Ops,
+		"memory_bytes": result.Usage.MemoryBytes,
+		"duration":     result.Usage.DurationMS,
+	}).Info("Script execution completed")
+
+	return result.Output, nil
+}
+
+func (e *ScriptExecutor) Validate(step *models.WorkflowStep) error {
+	_, err := stepconfig.ScriptSchema.Validate(stepconfig.Section("script", step.Config), false)
+	return err
 }
 
 func (e *ScriptExecutor) GetType() string {
 	return "script"
 }
 
+func (e *ScriptExecutor) ConfigSchema() *stepconfig.Schema {
+	return stepconfig.ScriptSchema
+}
+
 // TransformExecutor executes data transformations
 type TransformExecutor struct {
 	logger *logrus.Logger
@@ -485,22 +797,18 @@ func (e *TransformExecutor) executeAggregate(config map[string]interface{}, inpu
 }
 
 func (e *TransformExecutor) Validate(step *models.WorkflowStep) error {
-	config, ok := step.Config["transform"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("transform configuration is required")
-	}
-
-	if _, ok := config["type"].(string); !ok {
-		return fmt.Errorf("transform type is required")
-	}
-
-	return nil
+	_, err := stepconfig.TransformSchema.Validate(stepconfig.Section("transform", step.Config), false)
+	return err
 }
 
 func (e *TransformExecutor) GetType() string {
 	return "transform"
 }
 
+func (e *TransformExecutor) ConfigSchema() *stepconfig.Schema {
+	return stepconfig.TransformSchema
+}
+
 // DelayExecutor executes delay/wait steps
 type DelayExecutor struct {
 	logger *logrus.Logger
@@ -542,7 +850,7 @@ func (e *DelayExecutor) Execute(ctx context.Context, step *models.WorkflowStep,
 		return nil, fmt.Errorf("invalid duration type")
 	}
 
-	e.logger.WithFields(logrus.Fields{
+	correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
 		"step_id":  step.ID,
 		"duration": duration.String(),
 	}).Info("Starting delay")
@@ -550,7 +858,7 @@ func (e *DelayExecutor) Execute(ctx context.Context, step *models.WorkflowStep,
 	// Wait for the specified duration
 	select {
 	case <-time.After(duration):
-		e.logger.WithFields(logrus.Fields{
+		correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
 			"step_id":  step.ID,
 			"duration": duration.String(),
 		}).Info("Delay completed")
@@ -605,9 +913,12 @@ func (e *ConditionalExecutor) Execute(ctx context.Context, step *models.Workflow
 	}
 
 	// Evaluate condition
-	result := e.evaluateCondition(condition, input)
+	result, err := e.evaluateCondition(ctx, condition, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate condition: %w", err)
+	}
 
-	e.logger.WithFields(logrus.Fields{
+	correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
 		"step_id":   step.ID,
 		"condition": condition,
 		"result":    result,
@@ -619,93 +930,109 @@ func (e *ConditionalExecutor) Execute(ctx context.Context, step *models.Workflow
 	}, nil
 }
 
-func (e *ConditionalExecutor) evaluateCondition(condition map[string]interface{}, input map[string]interface{}) bool {
+// evaluateCondition evaluates a condition against the step input. The
+// expression operator evaluates an expression over the input fields, with
+// now() reading the logical clock of the execution.
+func (e *ConditionalExecutor) evaluateCondition(ctx context.Context, condition map[string]interface{}, input map[string]interface{}) (bool, error) {
 	operator, ok := condition["operator"].(string)
 	if !ok {
-		return false
+		return false, nil
 	}
 
 	switch operator {
 	case "equals":
 		field, ok := condition["field"].(string)
 		if !ok {
-			return false
+			return false, nil
 		}
 		expected := condition["value"]
 		actual, exists := input[field]
-		return exists && actual == expected
+		return exists && actual == expected, nil
 
 	case "not_equals":
 		field, ok := condition["field"].(string)
 		if !ok {
-			return false
+			return false, nil
 		}
 		expected := condition["value"]
 		actual, exists := input[field]
-		return !exists || actual != expected
+		return !exists || actual != expected, nil
 
 	case "exists":
 		field, ok := condition["field"].(string)
 		if !ok {
-			return false
+			return false, nil
 		}
 		_, exists := input[field]
-		return exists
+		return exists, nil
 
 	case "not_exists":
 		field, ok := condition["field"].(string)
 		if !ok {
-			return false
+			return false, nil
 		}
 		_, exists := input[field]
-		return !exists
+		return !exists, nil
+
+	case "expression":
+		source, ok := condition["expression"].(string)
+		if !ok {
+			return false, fmt.Errorf("expression is required for the expression operator")
+		}
+		expr, err := expressions.Parse(source)
+		if err != nil {
+			return false, fmt.Errorf("invalid expression %q: %w", source, err)
+		}
+		result, err := expr.EvalBool(ctx, expressions.EnvFromContext(ctx), input)
+		if err != nil {
+			return false, fmt.Errorf("expression %q: %w", source, err)
+		}
+		return result, nil
 
 	case "and":
 		conditions, ok := condition["conditions"].([]interface{})
 		if !ok {
-			return false
+			return false, nil
 		}
 		for _, cond := range conditions {
 			if condMap, ok := cond.(map[string]interface{}); ok {
-				if !e.evaluateCondition(condMap, input) {
-					return false
+				holds, err := e.evaluateCondition(ctx, condMap, input)
+				if err != nil || !holds {
+					return false, err
 				}
 			}
 		}
-		return true
+		return true, nil
 
 	case "or":
 		conditions, ok := condition["conditions"].([]interface{})
 		if !ok {
-			return false
+			return false, nil
 		}
 		for _, cond := range conditions {
 			if condMap, ok := cond.(map[string]interface{}); ok {
-				if e.evaluateCondition(condMap, input) {
-					return true
+				holds, err := e.evaluateCondition(ctx, condMap, input)
+				if err != nil || holds {
+					return holds, err
 				}
 			}
 		}
-		return false
+		return false, nil
 
 	default:
-		return false
+		return false, nil
 	}
 }
 
 func (e *ConditionalExecutor) Validate(step *models.WorkflowStep) error {
-	config, ok := step.Config["conditional"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("conditional configuration is required")
-	}
-
-	if _, ok := config["condition"].(map[string]interface{}); !ok {
-		return fmt.Errorf("condition is required for conditional step")
-	}
-
-	return nil
+	_, err := stepconfig.ConditionSchema.Validate(stepconfig.Section("conditional", step.Config), false)
+	return err
 }
 
 func (e *ConditionalExecutor) GetType() string {
 	return "conditional"
+}
+
+func (e *ConditionalExecutor) ConfigSchema() *stepconfig.Schema {
+	return stepconfig.ConditionSchema
 }
\ No newline at end of file
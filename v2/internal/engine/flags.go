@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/flags"
+	"magic-flow/v2/internal/replay"
+	"magic-flow/v2/pkg/models"
+)
+
+// FlagEvaluator evaluates the feature flags of executions as they start,
+// such as flags.Manager
+type FlagEvaluator interface {
+	Evaluate(ctx context.Context, request *flags.Request) (map[string]bool, error)
+}
+
+// SetFlags sets the evaluator of feature flags. Until set, flag() is off in
+// every execution.
+func (e *Engine) SetFlags(evaluator FlagEvaluator) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.flags = evaluator
+}
+
+// evaluateFlags evaluates the feature flags of a starting execution once and
+// records them on the execution, so its steps and retries see the same
+// values. Replays and resumes take the values the original execution
+// recorded, flags it did not evaluate being evaluated anew. Flags that
+// cannot be evaluated are off.
+func (e *Engine) evaluateFlags(ctx context.Context, execution *models.Execution, workflow *models.Workflow, input map[string]interface{}, logger *logrus.Entry) map[string]bool {
+	e.mu.RLock()
+	evaluator := e.flags
+	e.mu.RUnlock()
+
+	var values map[string]bool
+	if evaluator != nil {
+		var err error
+		values, err = evaluator.Evaluate(ctx, &flags.Request{
+			Workflow:      workflow,
+			Input:         input,
+			CorrelationID: execution.CorrelationID,
+		})
+		if err != nil {
+			logger.WithError(err).Error("Failed to evaluate feature flags, they are off")
+			values = nil
+		}
+	}
+
+	recording := replay.FromContext(ctx)
+	if resumed := resumptionFromContext(ctx); resumed != nil {
+		recording = resumed.steps
+	}
+	if recording != nil && len(recording.Flags) > 0 {
+		if values == nil {
+			values = make(map[string]bool, len(recording.Flags))
+		}
+		for key, value := range recording.Flags {
+			values[key] = value
+		}
+	}
+
+	execution.Flags = values
+	return values
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"magic-flow/v2/internal/flags"
+	"magic-flow/v2/internal/replay"
+	"magic-flow/v2/pkg/models"
+)
+
+// staticFlags evaluates flags to fixed values, counting its evaluations
+type staticFlags struct {
+	values      map[string]bool
+	evaluations int
+}
+
+func (f *staticFlags) Evaluate(ctx context.Context, request *flags.Request) (map[string]bool, error) {
+	f.evaluations++
+	values := make(map[string]bool, len(f.values))
+	for key, value := range f.values {
+		values[key] = value
+	}
+	return values, nil
+}
+
+func TestEvaluateFlagsRecordsThemOnTheExecution(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	e := NewEngine(10, nil, logger)
+	workflow := &models.Workflow{ID: uuid.New(), Name: "checkout"}
+
+	// Without an evaluator every flag is off
+	execution := &models.Execution{ID: uuid.New(), CorrelationID: "order-42"}
+	assert.Nil(t, e.evaluateFlags(context.Background(), execution, workflow, nil, logrus.NewEntry(logger)))
+	assert.Nil(t, execution.Flags)
+
+	evaluator := &staticFlags{values: map[string]bool{"new-tax-engine": true, "eu-vat": false}}
+	e.SetFlags(evaluator)
+	values := e.evaluateFlags(context.Background(), execution, workflow, nil, logrus.NewEntry(logger))
+	assert.Equal(t, map[string]bool{"new-tax-engine": true, "eu-vat": false}, values)
+	assert.Equal(t, values, execution.Flags, "the values are recorded on the execution")
+	assert.Equal(t, 1, evaluator.evaluations)
+
+	// The flags change, but replays take the branches of the original
+	// execution, and evaluate the flags it did not record
+	evaluator.values = map[string]bool{"new-tax-engine": false, "eu-vat": true, "fast-lane": true}
+	recording := replay.NewRecording(execution.ID, nil)
+	recording.Flags = execution.Flags
+	replayed := &models.Execution{ID: uuid.New(), CorrelationID: "order-42"}
+	values = e.evaluateFlags(replay.WithRecording(context.Background(), recording), replayed, workflow, nil, logrus.NewEntry(logger))
+	assert.Equal(t, map[string]bool{"new-tax-engine": true, "eu-vat": false, "fast-lane": true}, values)
+	assert.Equal(t, values, replayed.Flags)
+	assert.Equal(t, map[string]bool{"new-tax-engine": true, "eu-vat": false}, execution.Flags, "the recording is not modified")
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/pkg/models"
+)
+
+// stepGuard reports whether the when guard of a step holds against the
+// execution variables and environment. Steps without a guard always run. Guards that do not
+// parse or do not evaluate to a boolean fail the step.
+func (e *Engine) stepGuard(execContext *ExecutionContext, step *models.WorkflowStep) (bool, error) {
+	if strings.TrimSpace(step.When) == "" {
+		return true, nil
+	}
+	expr, err := expressions.Parse(step.When)
+	if err != nil {
+		return false, fmt.Errorf("invalid when guard %q: %w", step.When, err)
+	}
+
+	execContext.mu.RLock()
+	variables := make(map[string]interface{}, len(execContext.Variables)+1)
+	for name, value := range execContext.Variables {
+		variables[name] = value
+	}
+	variables[environmentName] = environmentDocument(execContext.Environment)
+	execContext.mu.RUnlock()
+
+	ctx := execContext.Context
+	holds, err := expr.EvalBool(ctx, expressions.EnvFromContext(ctx), variables)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate when guard %q: %w", step.When, err)
+	}
+	return holds, nil
+}
+
+// skipStep records a step whose when guard does not hold as skipped. The
+// returned error wraps dataflow.ErrSkipped, so the steps depending on it
+// still run. Skipped steps are logged like successful ones, sampled.
+func (e *Engine) skipStep(execContext *ExecutionContext, step *models.WorkflowStep, stepExecution *models.StepExecution, logger *logrus.Entry, sampled bool) error {
+	reason := fmt.Sprintf("when guard %q does not hold", step.When)
+	completedAt := e.now()
+	stepExecution.Status = models.StepStatusSkipped
+	stepExecution.Error = reason
+	stepExecution.AfterResponse = execContext.responded()
+	stepExecution.CompletedAt = &completedAt
+
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          "step.skipped",
+		ExecutionID:   execContext.Execution.ID,
+		WorkflowID:    execContext.Workflow.ID,
+		CorrelationID: execContext.Execution.CorrelationID,
+		StepID:        step.ID,
+		Timestamp:     completedAt,
+		Data: map[string]interface{}{
+			"step_type": step.Type,
+			"when":      step.When,
+		},
+	})
+
+	e.metrics.RecordStepExecution(stepExecution)
+	e.persistStep(execContext, stepExecution)
+
+	logger.WithField("when", step.When).Log(sampledLevel(sampled), "Workflow step skipped")
+	return fmt.Errorf("%w: %s", dataflow.ErrSkipped, reason)
+}
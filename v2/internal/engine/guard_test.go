@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/pkg/models"
+)
+
+func TestStepWhenGuard(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	e := NewEngine(10, nopMetrics{}, logger)
+	store := &recordingStepStore{}
+	e.SetStepStore(store)
+	review := &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"reviewed": true}, nil
+	}}
+	e.RegisterStepExecutor("func", review)
+
+	execContext := newLoggingExecution(logger)
+	execContext.Variables["risk"] = 0.9
+	step := &models.WorkflowStep{Name: "review", Type: "func", When: "risk > 0.8"}
+
+	// The guard holds: the step runs
+	require.NoError(t, e.executeStep(execContext, step))
+	assert.Equal(t, 1, review.calls)
+	require.Len(t, store.steps, 1)
+	assert.Equal(t, models.StepStatusCompleted, store.steps[0].Status)
+	assert.Equal(t, true, execContext.Variables["reviewed"])
+
+	// The guard does not hold: the step is skipped without running
+	execContext.Variables["risk"] = 0.2
+	err := e.executeStep(execContext, step)
+	require.True(t, errors.Is(err, dataflow.ErrSkipped), "err = %v", err)
+	assert.Equal(t, 1, review.calls)
+	require.Len(t, store.steps, 2)
+	assert.Equal(t, models.StepStatusSkipped, store.steps[1].Status)
+	assert.Equal(t, `when guard "risk > 0.8" does not hold`, store.steps[1].Error)
+	assert.NotNil(t, store.steps[1].CompletedAt)
+}
+
+func TestStepWhenGuardInvalid(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	e := NewEngine(10, nopMetrics{}, logger)
+	review := &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		return nil, nil
+	}}
+	e.RegisterStepExecutor("func", review)
+	execContext := newLoggingExecution(logger)
+	execContext.Variables["risk"] = 0.9
+
+	// Malformed guards fail the step rather than skip it
+	err := e.executeStep(execContext, &models.WorkflowStep{Name: "review", Type: "func", When: "risk >"})
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, dataflow.ErrSkipped))
+	assert.Contains(t, err.Error(), `invalid when guard "risk >"`)
+
+	// So do guards that are not conditions
+	err = e.executeStep(execContext, &models.WorkflowStep{Name: "review", Type: "func", When: "risk"})
+	assert.EqualError(t, err, `failed to evaluate when guard "risk": condition must be a boolean, got number`)
+	assert.Equal(t, 0, review.calls)
+}
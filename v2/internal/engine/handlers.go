@@ -2,6 +2,10 @@ package engine
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,12 +14,17 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"magic-flow/v2/internal/branding"
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/payloads"
+	"magic-flow/v2/internal/scheduler"
 	"magic-flow/v2/pkg/models"
 )
 
 // DatabaseEventHandler handles workflow events by storing them in the database
 type DatabaseEventHandler struct {
 	db     *gorm.DB
+	clock  scheduler.Clock
 	logger *logrus.Logger
 }
 
@@ -23,10 +32,17 @@ type DatabaseEventHandler struct {
 func NewDatabaseEventHandler(db *gorm.DB, logger *logrus.Logger) *DatabaseEventHandler {
 	return &DatabaseEventHandler{
 		db:     db,
+		clock:  scheduler.NewRealClock(),
 		logger: logger,
 	}
 }
 
+// SetClock sets the clock the handler reads the times it stores events and
+// updates executions at from, the engine's clock
+func (h *DatabaseEventHandler) SetClock(clock scheduler.Clock) {
+	h.clock = clock
+}
+
 func (h *DatabaseEventHandler) Handle(event *WorkflowEvent) error {
 	// Convert event data to JSON
 	eventDataJSON, err := json.Marshal(event.Data)
@@ -37,13 +53,14 @@ func (h *DatabaseEventHandler) Handle(event *WorkflowEvent) error {
 
 	// Create execution event record
 	executionEvent := &models.ExecutionEvent{
-		ExecutionID: event.ExecutionID,
-		Type:        event.Type,
-		StepID:      event.StepID,
-		Timestamp:   event.Timestamp,
-		Data:        string(eventDataJSON),
-		Error:       event.Error,
-		CreatedAt:   time.Now().UTC(),
+		ExecutionID:   event.ExecutionID,
+		Type:          event.Type,
+		StepID:        event.StepID,
+		CorrelationID: event.CorrelationID,
+		Timestamp:     event.Timestamp,
+		Data:          string(eventDataJSON),
+		Error:         event.Error,
+		CreatedAt:     h.clock.Now().UTC(),
 	}
 
 	// Save to database
@@ -73,14 +90,42 @@ func (h *DatabaseEventHandler) updateExecutionStatus(event *WorkflowEvent) error
 		updates = map[string]interface{}{
 			"status":     models.ExecutionStatusRunning,
 			"started_at": event.Timestamp,
-			"updated_at": time.Now().UTC(),
+			"updated_at": h.clock.Now().UTC(),
+		}
+
+	case "execution.resumed":
+		updates = map[string]interface{}{
+			"status":     models.ExecutionStatusRunning,
+			"updated_at": h.clock.Now().UTC(),
+		}
+
+	case "execution.parked":
+		updates = map[string]interface{}{
+			"status":     models.ExecutionStatusParked,
+			"updated_at": h.clock.Now().UTC(),
+		}
+
+	case "execution.responded":
+		updates = map[string]interface{}{
+			"responded_at": event.Timestamp,
+			"updated_at":   h.clock.Now().UTC(),
+		}
+		if output, ok := event.Data["output"]; ok {
+			updates["output"] = output
 		}
 
 	case "execution.completed":
 		updates = map[string]interface{}{
 			"status":       models.ExecutionStatusCompleted,
 			"completed_at": event.Timestamp,
-			"updated_at":   time.Now().UTC(),
+			"updated_at":   h.clock.Now().UTC(),
+		}
+		// Executions whose background steps failed complete with warnings
+		if status, ok := event.Data["status"].(models.ExecutionStatus); ok {
+			updates["status"] = status
+		}
+		if warnings, ok := event.Data["warnings"].([]string); ok && len(warnings) > 0 {
+			updates["warnings"] = warnings
 		}
 		if duration, ok := event.Data["duration"].(int64); ok {
 			updates["duration"] = duration
@@ -94,18 +139,22 @@ func (h *DatabaseEventHandler) updateExecutionStatus(event *WorkflowEvent) error
 			"status":       models.ExecutionStatusFailed,
 			"error":        event.Error,
 			"completed_at": event.Timestamp,
-			"updated_at":   time.Now().UTC(),
+			"updated_at":   h.clock.Now().UTC(),
 		}
 		if duration, ok := event.Data["duration"].(int64); ok {
 			updates["duration"] = duration
 		}
+		if triage, ok := event.Data["triage"].(*models.Triage); ok {
+			updates["triage"] = triage
+			updates["triage_class"] = triage.Class
+		}
 
 	case "execution.cancelled":
 		updates = map[string]interface{}{
 			"status":       models.ExecutionStatusCancelled,
 			"error":        event.Error,
 			"completed_at": event.Timestamp,
-			"updated_at":   time.Now().UTC(),
+			"updated_at":   h.clock.Now().UTC(),
 		}
 		if duration, ok := event.Data["duration"].(int64); ok {
 			updates["duration"] = duration
@@ -114,7 +163,7 @@ func (h *DatabaseEventHandler) updateExecutionStatus(event *WorkflowEvent) error
 	default:
 		// For step events, just update the timestamp
 		updates = map[string]interface{}{
-			"updated_at": time.Now().UTC(),
+			"updated_at": h.clock.Now().UTC(),
 		}
 	}
 
@@ -128,9 +177,12 @@ func (h *DatabaseEventHandler) updateExecutionStatus(event *WorkflowEvent) error
 func (h *DatabaseEventHandler) GetEventTypes() []string {
 	return []string{
 		"execution.started",
+		"execution.resumed",
+		"execution.responded",
 		"execution.completed",
 		"execution.failed",
 		"execution.cancelled",
+		"execution.parked",
 		"step.started",
 		"step.completed",
 		"step.failed",
@@ -168,18 +220,30 @@ func (h *MetricsEventHandler) Handle(event *WorkflowEvent) error {
 	case "execution.completed":
 		h.metrics.RecordMetric("workflow_executions_completed_total", 1, labels)
 		if duration, ok := event.Data["duration"].(int64); ok {
-			h.metrics.RecordMetric("workflow_execution_duration_seconds", float64(duration), labels)
+			h.metrics.RecordMetric("workflow_execution_duration_seconds", float64(duration)/1000, labels)
 		}
 
 	case "execution.failed":
 		h.metrics.RecordMetric("workflow_executions_failed_total", 1, labels)
 		if duration, ok := event.Data["duration"].(int64); ok {
-			h.metrics.RecordMetric("workflow_execution_duration_seconds", float64(duration), labels)
+			h.metrics.RecordMetric("workflow_execution_duration_seconds", float64(duration)/1000, labels)
+		}
+		if triage, ok := event.Data["triage"].(*models.Triage); ok {
+			h.metrics.RecordMetric("workflow_executions_failed_by_triage_total", 1, map[string]string{
+				"workflow_id":  event.WorkflowID.String(),
+				"triage_class": triage.Class,
+			})
 		}
 
 	case "execution.cancelled":
 		h.metrics.RecordMetric("workflow_executions_cancelled_total", 1, labels)
 
+	case "execution.parked":
+		h.metrics.RecordMetric("workflow_executions_parked_total", 1, labels)
+
+	case "execution.resumed":
+		h.metrics.RecordMetric("workflow_executions_resumed_total", 1, labels)
+
 	case "step.started":
 		h.metrics.RecordMetric("workflow_steps_started_total", 1, labels)
 
@@ -202,44 +266,96 @@ func (h *MetricsEventHandler) Handle(event *WorkflowEvent) error {
 func (h *MetricsEventHandler) GetEventTypes() []string {
 	return []string{
 		"execution.started",
+		"execution.resumed",
 		"execution.completed",
 		"execution.failed",
 		"execution.cancelled",
+		"execution.parked",
 		"step.started",
 		"step.completed",
 		"step.failed",
 	}
 }
 
+// TemplateErrorHeader carries the reason a webhook payload template failed
+// to render on deliveries that fell back to the default payload
+const TemplateErrorHeader = "X-Magic-Flow-Template-Error"
+
+// EventIDHeader carries the idempotency key of the event of a webhook
+// delivery, identical on redeliveries of the event
+const EventIDHeader = "X-Magic-Flow-Event-ID"
+
+// SignatureHeader carries the signature of webhook payloads sent to
+// webhooks with a secret
+const SignatureHeader = "X-Magic-Flow-Signature"
+
+// SignPayload returns the signature of a webhook payload: the hex-encoded
+// HMAC-SHA256 of the payload keyed with the webhook secret, prefixed with
+// sha256=
+func SignPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
 // WebhookEventHandler handles workflow events by sending webhooks
 type WebhookEventHandler struct {
 	webhooks []models.Webhook
+	// templates holds the compiled payload template of each webhook, nil
+	// for webhooks sending the default payload
+	templates []*payloads.Template
+	// templateErrors holds the errors of templates that failed to compile
+	templateErrors []error
+	// messages resolves the strings of built-in templates in the namespace
+	// of the event, English with the built-in branding when nil
+	messages branding.Resolver
 	client   *http.Client
 	logger   *logrus.Logger
 }
 
-// NewWebhookEventHandler creates a new webhook event handler
+// NewWebhookEventHandler creates a new webhook event handler. Payload
+// templates are validated when webhooks are saved; a template that no
+// longer compiles makes its webhook fall back to the default payload.
 func NewWebhookEventHandler(webhooks []models.Webhook, logger *logrus.Logger) *WebhookEventHandler {
-	return &WebhookEventHandler{
-		webhooks: webhooks,
+	h := &WebhookEventHandler{
+		webhooks:       webhooks,
+		templates:      make([]*payloads.Template, len(webhooks)),
+		templateErrors: make([]error, len(webhooks)),
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 		logger: logger,
 	}
+	for i, webhook := range webhooks {
+		h.templates[i], h.templateErrors[i] = payloads.Compile(webhook.Template)
+	}
+	return h
+}
+
+// SetMessages sets the resolver of the branding and localized strings
+// payload templates render, through the msg function
+func (h *WebhookEventHandler) SetMessages(resolver branding.Resolver) {
+	h.messages = resolver
 }
 
+// Handle sends the event to the interested webhooks and returns the first
+// delivery failure. Retries are left to the caller, wrap the handler of each
+// webhook with a delivery dispatcher to retry and park failing events per
+// subscription.
 func (h *WebhookEventHandler) Handle(event *WorkflowEvent) error {
-	for _, webhook := range h.webhooks {
+	var firstErr error
+	for i, webhook := range h.webhooks {
 		// Check if webhook is interested in this event type
 		if !h.shouldSendWebhook(webhook, event) {
 			continue
 		}
 
-		go h.sendWebhook(webhook, event)
+		if err := h.sendWebhook(i, webhook, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
 
-	return nil
+	return firstErr
 }
 
 func (h *WebhookEventHandler) shouldSendWebhook(webhook models.Webhook, event *WorkflowEvent) bool {
@@ -248,6 +364,11 @@ func (h *WebhookEventHandler) shouldSendWebhook(webhook models.Webhook, event *W
 		return false
 	}
 
+	// Lightweight executions only notify webhooks as they end
+	if !notifiesWebhooks(event) {
+		return false
+	}
+
 	// Check event type filters
 	if len(webhook.Events) > 0 {
 		found := false
@@ -279,12 +400,17 @@ func (h *WebhookEventHandler) shouldSendWebhook(webhook models.Webhook, event *W
 	return true
 }
 
-func (h *WebhookEventHandler) sendWebhook(webhook models.Webhook, event *WorkflowEvent) {
+func (h *WebhookEventHandler) sendWebhook(index int, webhook models.Webhook, event *WorkflowEvent) error {
 	// Prepare webhook payload
 	payload := map[string]interface{}{
-		"event":        event,
-		"webhook_id":   webhook.ID,
-		"timestamp":    time.Now().UTC(),
+		"event":           event,
+		"webhook_id":      webhook.ID,
+		correlation.Field: event.CorrelationID,
+		"timestamp":       time.Now().UTC(),
+	}
+	templateErr := h.templateErrors[index]
+	if templateErr != nil {
+		payload["template_error"] = templateErr.Error()
 	}
 
 	// Add custom headers
@@ -294,6 +420,12 @@ func (h *WebhookEventHandler) sendWebhook(webhook models.Webhook, event *Workflo
 	}
 	headers["Content-Type"] = "application/json"
 	headers["User-Agent"] = "Magic-Flow-Webhook/1.0"
+	if event.CorrelationID != "" {
+		headers[correlation.Header] = event.CorrelationID
+	}
+	if key := event.IdempotencyKey(); key != "" {
+		headers[EventIDHeader] = key
+	}
 
 	// Marshal payload
 	payloadBytes, err := json.Marshal(payload)
@@ -302,7 +434,34 @@ func (h *WebhookEventHandler) sendWebhook(webhook models.Webhook, event *Workflo
 			"webhook_id": webhook.ID,
 			"error":      err.Error(),
 		}).Error("Failed to marshal webhook payload")
-		return
+		return err
+	}
+
+	// Render the payload template, falling back to the default payload and
+	// recording the failure on the delivery if it does not render
+	if tmpl := h.templates[index]; tmpl != nil {
+		data := payloads.NewData(templateEvent(event), tmpl.Params())
+		if h.messages != nil {
+			data.Messages = h.messages.Messages(eventNamespace(event), "")
+		}
+		rendered, err := payloads.Payload(context.Background(), tmpl, data, nil)
+		if err != nil {
+			templateErr = err
+			payload["template_error"] = err.Error()
+			if payloadBytes, err = json.Marshal(payload); err != nil {
+				return err
+			}
+		} else {
+			payloadBytes = rendered
+		}
+	}
+	if templateErr != nil {
+		headers[TemplateErrorHeader] = templateErr.Error()
+		h.logger.WithFields(logrus.Fields{
+			"webhook_id": webhook.ID,
+			"url":        webhook.URL,
+			"error":      templateErr.Error(),
+		}).Warn("Webhook payload template failed, sending the default payload")
 	}
 
 	// Create request
@@ -313,7 +472,7 @@ func (h *WebhookEventHandler) sendWebhook(webhook models.Webhook, event *Workflo
 			"url":        webhook.URL,
 			"error":      err.Error(),
 		}).Error("Failed to create webhook request")
-		return
+		return err
 	}
 
 	// Set headers
@@ -323,58 +482,65 @@ func (h *WebhookEventHandler) sendWebhook(webhook models.Webhook, event *Workflo
 
 	// Add signature if secret is configured
 	if webhook.Secret != "" {
-		signature := h.generateSignature(payloadBytes, webhook.Secret)
-		req.Header.Set("X-Magic-Flow-Signature", signature)
+		req.Header.Set(SignatureHeader, SignPayload(payloadBytes, webhook.Secret))
 	}
 
-	// Send request with retries
-	maxRetries := 3
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		resp, err := h.client.Do(req)
-		if err != nil {
-			h.logger.WithFields(logrus.Fields{
-				"webhook_id": webhook.ID,
-				"url":        webhook.URL,
-				"attempt":    attempt + 1,
-				"error":      err.Error(),
-			}).Warn("Webhook request failed")
-
-			if attempt < maxRetries-1 {
-				time.Sleep(time.Duration(attempt+1) * time.Second)
-				continue
-			}
-			return
-		}
-
-		defer resp.Body.Close()
-
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			h.logger.WithFields(logrus.Fields{
-				"webhook_id":  webhook.ID,
-				"url":         webhook.URL,
-				"status_code": resp.StatusCode,
-				"attempt":     attempt + 1,
-			}).Info("Webhook sent successfully")
-			return
-		}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"webhook_id": webhook.ID,
+			"url":        webhook.URL,
+			"error":      err.Error(),
+		}).Warn("Webhook request failed")
+		return fmt.Errorf("webhook request to %s failed: %w", webhook.URL, err)
+	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		h.logger.WithFields(logrus.Fields{
 			"webhook_id":  webhook.ID,
 			"url":         webhook.URL,
 			"status_code": resp.StatusCode,
-			"attempt":     attempt + 1,
 		}).Warn("Webhook request returned error status")
-
-		if attempt < maxRetries-1 {
-			time.Sleep(time.Duration(attempt+1) * time.Second)
-		}
+		return fmt.Errorf("webhook %s returned status %d", webhook.URL, resp.StatusCode)
 	}
+
+	h.logger.WithFields(logrus.Fields{
+		"webhook_id":  webhook.ID,
+		"url":         webhook.URL,
+		"status_code": resp.StatusCode,
+	}).Info("Webhook sent successfully")
+	return nil
+}
+
+// templateEvent converts an event to the event payload templates render
+// eventNamespace returns the namespace label of the workflow of an event,
+// attached to events ending an execution, or the default namespace
+func eventNamespace(event *WorkflowEvent) string {
+	var namespace string
+	switch labels := event.Data["labels"].(type) {
+	case map[string]string:
+		namespace = labels["namespace"]
+	case map[string]interface{}:
+		namespace, _ = labels["namespace"].(string)
+	}
+	if namespace == "" {
+		return branding.DefaultNamespace
+	}
+	return namespace
 }
 
-func (h *WebhookEventHandler) generateSignature(payload []byte, secret string) string {
-	// Simple HMAC-SHA256 signature
-	// In a real implementation, you'd use crypto/hmac
-	return fmt.Sprintf("sha256=%x", payload) // Simplified for demo
+func templateEvent(event *WorkflowEvent) payloads.Event {
+	return payloads.Event{
+		Type:          event.Type,
+		ExecutionID:   event.ExecutionID.String(),
+		WorkflowID:    event.WorkflowID.String(),
+		CorrelationID: event.CorrelationID,
+		StepID:        event.StepID,
+		Timestamp:     event.Timestamp,
+		Data:          event.Data,
+		Error:         event.Error,
+	}
 }
 
 func (h *WebhookEventHandler) GetEventTypes() []string {
@@ -386,6 +552,9 @@ func (h *WebhookEventHandler) GetEventTypes() []string {
 		"step.started",
 		"step.completed",
 		"step.failed",
+		"execution_group.completed",
+		"execution_group.failed",
+		"execution_group.cancelled",
 	}
 }
 
@@ -430,6 +599,10 @@ func (h *LogEventHandler) Handle(event *WorkflowEvent) error {
 		h.logger.WithFields(fields).Error("Workflow execution failed")
 	case "execution.cancelled":
 		h.logger.WithFields(fields).Warn("Workflow execution cancelled")
+	case "execution.parked":
+		h.logger.WithFields(fields).Info("Workflow execution parked")
+	case "execution.resumed":
+		h.logger.WithFields(fields).Info("Workflow execution resumed")
 	case "step.started":
 		h.logger.WithFields(fields).Debug("Workflow step started")
 	case "step.completed":
@@ -446,9 +619,11 @@ func (h *LogEventHandler) Handle(event *WorkflowEvent) error {
 func (h *LogEventHandler) GetEventTypes() []string {
 	return []string{
 		"execution.started",
+		"execution.resumed",
 		"execution.completed",
 		"execution.failed",
 		"execution.cancelled",
+		"execution.parked",
 		"step.started",
 		"step.completed",
 		"step.failed",
@@ -0,0 +1,435 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/artifacts"
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/internal/warmup"
+	"magic-flow/v2/pkg/models"
+)
+
+// maxStreamedErrorBytes bounds the body of the error responses of streamed
+// requests kept in the step error
+const maxStreamedErrorBytes = 64 << 10
+
+// bodyArtifact returns the artifact reference the body of a POST, PUT or
+// PATCH step holds, as a reference string or object, directly or through a
+// ${variable} of the step input, or an empty string when the body is not an
+// artifact
+func bodyArtifact(config *stepconfig.HTTPConfig, input map[string]interface{}) string {
+	switch requestMethod(config) {
+	case "POST", "PUT", "PATCH":
+	default:
+		return ""
+	}
+	ref, _ := artifacts.RefOf(inputValue(config.Body, input))
+	return ref
+}
+
+// inputValue returns the value of the step input a ${variable} config value
+// names, or the config value itself
+func inputValue(value interface{}, input map[string]interface{}) interface{} {
+	if text, ok := value.(string); ok {
+		if match := sourceVariablePattern.FindStringSubmatch(text); match != nil {
+			return input[match[1]]
+		}
+	}
+	return value
+}
+
+// streamedBody is the body of a streamed request: the artifact of ref, or
+// the parts of a multipart form, of size bytes
+type streamedBody struct {
+	ref      string
+	parts    []formPart
+	boundary string
+	size     int64
+}
+
+// stream sends the request of an http step on the shared transport rather
+// than through resty, which buffers request and response bodies. The
+// artifact of bodyRef, or the multipart form of the step, is streamed as
+// the request body with its size as the content length, and response
+// bodies above response_artifact_bytes are streamed into a new artifact,
+// or into scratch with response_scratch. Requests failing on the way are
+// retried as resty retries them, the artifacts being opened again for each
+// attempt rather than buffered. The response body is returned when it is
+// kept in the output.
+func (e *HTTPExecutor) stream(ctx context.Context, step *models.WorkflowStep, config *stepconfig.HTTPConfig, bodyRef string, input map[string]interface{}) (map[string]interface{}, []byte, error) {
+	if config.URL == "" {
+		return nil, nil, fmt.Errorf("URL is required for HTTP step")
+	}
+	if e.artifacts == nil && (bodyRef != "" || config.ResponseArtifactBytes > 0) {
+		return nil, nil, fmt.Errorf("step %s streams artifacts but no artifact store is configured", step.Name)
+	}
+	if e.scratch == nil && config.ResponseScratch != "" {
+		return nil, nil, fmt.Errorf("step %s streams its response into scratch but no scratch space is configured", step.Name)
+	}
+	body := streamedBody{ref: bodyRef}
+	switch {
+	case bodyRef != "":
+		info, err := e.artifacts.Stat(ctx, bodyRef)
+		if err != nil {
+			return nil, nil, err
+		}
+		body.size = info.Size
+	case len(config.Multipart) > 0:
+		parts, err := e.multipartParts(ctx, step, config, input)
+		if err != nil {
+			return nil, nil, err
+		}
+		body.parts = parts
+		body.boundary = multipart.NewWriter(io.Discard).Boundary()
+		if body.size, err = formSize(parts, body.boundary); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	resp, reused, err := e.sendWithRetries(ctx, config, body, input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	warmup.RecordStart(e.metrics, "http", reused)
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStreamedErrorBytes))
+		return nil, nil, httpRetryHint(&HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}, resp.Header, time.Now())
+	}
+
+	result := map[string]interface{}{
+		"status_code": resp.StatusCode,
+		"headers":     resp.Header,
+	}
+	responseBody, err := e.readBody(ctx, config, resp, result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
+		"step_id":       step.Name,
+		"method":        requestMethod(config),
+		"url":           config.URL,
+		"status_code":   resp.StatusCode,
+		"body_artifact": bodyRef,
+		"form_parts":    len(body.parts),
+		"sent_bytes":    body.size,
+	}).Info("HTTP request completed")
+
+	return result, responseBody, nil
+}
+
+// sendWithRetries sends a streamed request, retrying it on transport errors
+// with the retry count and backoff of the resty client
+func (e *HTTPExecutor) sendWithRetries(ctx context.Context, config *stepconfig.HTTPConfig, body streamedBody, input map[string]interface{}) (*http.Response, bool, error) {
+	wait := e.client.RetryWaitTime
+	for attempt := 0; ; attempt++ {
+		resp, reused, err := e.send(ctx, config, body, input)
+		if err == nil {
+			return resp, reused, nil
+		}
+		if attempt >= e.client.RetryCount || ctx.Err() != nil {
+			return nil, false, err
+		}
+
+		correlation.Logger(ctx, e.logger).WithFields(logrus.Fields{
+			"url":     config.URL,
+			"attempt": attempt + 1,
+			"error":   err.Error(),
+		}).Warn("Retrying streamed HTTP request")
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > e.client.RetryMaxWaitTime {
+			wait = e.client.RetryMaxWaitTime
+		}
+	}
+}
+
+// send sends one attempt of a streamed request. The body artifacts are
+// opened anew, so an attempt following a partial upload sends them from the
+// start.
+func (e *HTTPExecutor) send(ctx context.Context, config *stepconfig.HTTPConfig, body streamedBody, input map[string]interface{}) (*http.Response, bool, error) {
+	target, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid URL %q: %w", config.URL, err)
+	}
+	if len(config.Params) > 0 {
+		query := target.Query()
+		for key, value := range config.Params {
+			query.Set(key, fmt.Sprintf("%v", value))
+		}
+		target.RawQuery = query.Encode()
+	}
+
+	traceCtx, trace := warmup.WithConnTrace(ctx)
+	req, err := http.NewRequestWithContext(traceCtx, requestMethod(config), target.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	for key, value := range config.Headers {
+		req.Header.Set(key, value)
+	}
+	if token, ok := input[FencingTokenVariable]; ok {
+		req.Header.Set(FencingTokenHeader, fmt.Sprintf("%v", token))
+	}
+	correlation.SetHeader(ctx, req.Header)
+
+	switch {
+	case body.ref != "":
+		content, err := e.artifacts.OpenAt(ctx, body.ref)
+		if err != nil {
+			return nil, false, err
+		}
+		req.Body = content
+		req.ContentLength = body.size
+		req.GetBody = func() (io.ReadCloser, error) {
+			return e.artifacts.OpenAt(ctx, body.ref)
+		}
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/octet-stream")
+		}
+	case body.parts != nil:
+		req.Body = e.multipartBody(ctx, body)
+		req.ContentLength = body.size
+		req.GetBody = func() (io.ReadCloser, error) {
+			return e.multipartBody(ctx, body), nil
+		}
+		req.Header.Set("Content-Type", "multipart/form-data; boundary="+body.boundary)
+	}
+
+	// Streamed requests are bounded by the step timeout rather than by the
+	// request timeout of the resty client, which large bodies would exceed
+	client := &http.Client{Transport: e.transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	return resp, trace.Reused(), nil
+}
+
+// readBody adds the body of a response to the result of a step. Bodies
+// above response_artifact_bytes are streamed into an artifact, whose
+// reference, size and checksum the result holds, and are not returned.
+// Bodies of response_scratch steps are streamed into the scratch area of
+// the execution.
+func (e *HTTPExecutor) readBody(ctx context.Context, config *stepconfig.HTTPConfig, resp *http.Response, result map[string]interface{}) ([]byte, error) {
+	if config.ResponseScratch != "" {
+		executionID, ok := ExecutionIDFromContext(ctx)
+		if !ok {
+			return nil, fmt.Errorf("responses are only streamed into scratch within an execution")
+		}
+		file, err := e.scratch.Put(ctx, executionID, config.ResponseScratch, resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store response: %w", err)
+		}
+		result["body_scratch"] = file.Name
+		result["body_size"] = file.Size
+		return nil, nil
+	}
+
+	limit := config.ResponseArtifactBytes
+	var head []byte
+	if limit <= 0 || resp.ContentLength <= limit {
+		reader := io.Reader(resp.Body)
+		if limit > 0 {
+			reader = io.LimitReader(resp.Body, limit+1)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if limit <= 0 || int64(len(body)) <= limit {
+			result["body"] = string(body)
+			parseJSONBody(result, resp.Header, body)
+			return body, nil
+		}
+		// Bodies of unknown length are held until they exceed the limit
+		head = body
+	}
+
+	info, err := e.artifacts.Put(ctx, responseArtifactName(config.URL), io.MultiReader(bytes.NewReader(head), resp.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store response: %w", err)
+	}
+	result["body_artifact"] = info.Ref
+	result["body_size"] = info.Size
+	result["body_sha256"] = info.SHA256
+	return nil, nil
+}
+
+// responseArtifactName names the artifact of a response body after the last
+// segment of the request path
+func responseArtifactName(rawURL string) string {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "response"
+	}
+	name := path.Base(target.Path)
+	if name == "." || name == "/" {
+		return "response"
+	}
+	return name
+}
+
+// formPart is a part of a multipart step body: a form field, or a file part
+// streaming an artifact
+type formPart struct {
+	name  string
+	value string
+	file  *artifacts.Reference
+}
+
+// multipartParts resolves the parts of a multipart step, in name order.
+// Artifact references and reference objects become file parts, sent with
+// the content type they declare or their artifact records.
+func (e *HTTPExecutor) multipartParts(ctx context.Context, step *models.WorkflowStep, config *stepconfig.HTTPConfig, input map[string]interface{}) ([]formPart, error) {
+	names := make([]string, 0, len(config.Multipart))
+	for name := range config.Multipart {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]formPart, 0, len(names))
+	for _, name := range names {
+		value := inputValue(config.Multipart[name], input)
+		ref, ok := artifacts.RefOf(value)
+		if !ok {
+			field, err := formValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("step %s: multipart field %s: %w", step.Name, name, err)
+			}
+			parts = append(parts, formPart{name: name, value: field})
+			continue
+		}
+
+		if e.artifacts == nil {
+			return nil, fmt.Errorf("step %s streams artifacts but no artifact store is configured", step.Name)
+		}
+		// The artifact is stated even for reference objects, whose size sets
+		// the content length
+		info, err := e.artifacts.Stat(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		file := &artifacts.Reference{Ref: ref, Size: info.Size, SHA256: info.SHA256, ContentType: info.ContentType}
+		if reference, ok := artifacts.AsReference(value); ok && reference.ContentType != "" {
+			file.ContentType = reference.ContentType
+		}
+		parts = append(parts, formPart{name: name, file: file})
+	}
+	return parts, nil
+}
+
+// formValue returns the text of a form field, JSON for values other than
+// strings and numbers
+func formValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	case float64, int, int64, bool:
+		return fmt.Sprintf("%v", v), nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// multipartBody streams the multipart form of a body through a pipe,
+// opening the artifact of each file part as it is reached. A failing
+// artifact fails the read of the body, and so the attempt.
+func (e *HTTPExecutor) multipartBody(ctx context.Context, body streamedBody) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeForm(writer, body, func(w io.Writer, file *artifacts.Reference) error {
+			content, err := e.artifacts.OpenAt(ctx, file.Ref)
+			if err != nil {
+				return err
+			}
+			defer content.Close()
+			_, err = io.Copy(w, content)
+			return err
+		}))
+	}()
+	return reader
+}
+
+// formSize returns the size of the multipart form of parts, the sizes of
+// the artifacts of file parts added to the size of the form around them
+func formSize(parts []formPart, boundary string) (int64, error) {
+	counter := &countingWriter{}
+	err := writeForm(counter, streamedBody{parts: parts, boundary: boundary}, func(w io.Writer, file *artifacts.Reference) error {
+		counter.n += file.Size
+		return nil
+	})
+	return counter.n, err
+}
+
+// quoteEscaper escapes the names of form parts as mime/multipart does
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// writeForm writes the multipart form of a body, writing the content of
+// file parts with writeFile
+func writeForm(w io.Writer, body streamedBody, writeFile func(w io.Writer, file *artifacts.Reference) error) error {
+	form := multipart.NewWriter(w)
+	if err := form.SetBoundary(body.boundary); err != nil {
+		return err
+	}
+	for _, part := range body.parts {
+		if part.file == nil {
+			if err := form.WriteField(part.name, part.value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		contentType := part.file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(part.name), quoteEscaper.Replace(path.Base(part.file.Ref))))
+		header.Set("Content-Type", contentType)
+		partWriter, err := form.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(partWriter, part.file); err != nil {
+			return fmt.Errorf("failed to send artifact %s: %w", part.file.Ref, err)
+		}
+	}
+	return form.Close()
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
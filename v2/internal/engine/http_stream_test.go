@@ -0,0 +1,399 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/artifacts"
+	"magic-flow/v2/internal/scratch"
+	"magic-flow/v2/pkg/models"
+)
+
+// generated is a reader of size bytes of a repeating pattern, produced
+// without holding them
+type generated struct {
+	size   int64
+	offset int64
+}
+
+func (g *generated) Read(p []byte) (int, error) {
+	if g.offset >= g.size {
+		return 0, io.EOF
+	}
+	if remaining := g.size - g.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	for i := range p {
+		p[i] = byte((g.offset + int64(i)) % 251)
+	}
+	g.offset += int64(len(p))
+	return len(p), nil
+}
+
+// generatedSum returns the checksum of a generated content
+func generatedSum(size int64) string {
+	hash := sha256.New()
+	io.Copy(hash, &generated{size: size})
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// countingStore counts the artifacts opened for random access
+type countingStore struct {
+	*artifacts.FileStore
+	opens atomic.Int32
+}
+
+func (s *countingStore) OpenAt(ctx context.Context, ref string) (artifacts.Content, error) {
+	s.opens.Add(1)
+	return s.FileStore.OpenAt(ctx, ref)
+}
+
+// upload is a request body received by the file service
+type upload struct {
+	ContentLength int64  `json:"content_length"`
+	Size          int64  `json:"size"`
+	SHA256        string `json:"sha256"`
+}
+
+// fileService receives uploads, answering with their size and checksum,
+// and serves generated files of the size in their path. Uploads to /flaky
+// drop the connection of the first attempt once 1 MiB was received.
+func fileService(t testing.TB) (*httptest.Server, *atomic.Int32) {
+	var flakyAttempts atomic.Int32
+	receive := func(w http.ResponseWriter, r *http.Request) {
+		hash := sha256.New()
+		size, err := io.Copy(hash, r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(upload{ContentLength: r.ContentLength, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/uploads", receive)
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if flakyAttempts.Add(1) == 1 {
+			io.CopyN(io.Discard, r.Body, 1<<20)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+			return
+		}
+		receive(w, r)
+	})
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		size, err := strconv.ParseInt(r.URL.Path[len("/files/"):], 10, 64)
+		require.NoError(t, err)
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+		io.Copy(w, &generated{size: size})
+	})
+	return httptest.NewServer(mux), &flakyAttempts
+}
+
+func newStreamingExecutor(t testing.TB) (*HTTPExecutor, *countingStore) {
+	fileStore, err := artifacts.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	store := &countingStore{FileStore: fileStore}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	executor := NewHTTPExecutor(logger)
+	executor.SetArtifacts(store)
+	executor.client.SetRetryWaitTime(time.Millisecond)
+	return executor, store
+}
+
+func putGenerated(t testing.TB, store artifacts.Store, size int64) artifacts.Info {
+	info, err := store.Put(context.Background(), "payload.bin", &generated{size: size})
+	require.NoError(t, err)
+	return info
+}
+
+func TestHTTPStreamArtifacts(t *testing.T) {
+	service, _ := fileService(t)
+	defer service.Close()
+	executor, store := newStreamingExecutor(t)
+	ctx := context.Background()
+
+	// Artifact bodies are sent with their size as the content length
+	payload := putGenerated(t, store, 3<<20+17)
+	assert.Equal(t, generatedSum(payload.Size), payload.SHA256, "checksums are computed while the artifact is written")
+	output, err := executor.Execute(ctx, &models.WorkflowStep{Name: "upload", Type: "http", Config: map[string]interface{}{
+		"url": service.URL + "/uploads", "method": "POST", "body": "${file}",
+	}}, map[string]interface{}{"file": payload.Ref})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"content_length": float64(payload.Size), "size": float64(payload.Size), "sha256": payload.SHA256,
+	}, output["json"])
+
+	// Response bodies above the threshold are stored as artifacts, whether
+	// their length is known ahead or not
+	for _, query := range []string{"", "?chunked=1"} {
+		output, err = executor.Execute(ctx, &models.WorkflowStep{Name: "download", Type: "http", Config: map[string]interface{}{
+			"url": fmt.Sprintf("%s/files/%d%s", service.URL, 5<<20, query), "response_artifact_bytes": 1 << 20,
+		}}, nil)
+		require.NoError(t, err, query)
+		assert.NotContains(t, output, "body", query)
+		assert.Equal(t, int64(5<<20), output["body_size"], query)
+		assert.Equal(t, generatedSum(5<<20), output["body_sha256"], query)
+
+		info, err := store.Stat(ctx, output["body_artifact"].(string))
+		require.NoError(t, err, query)
+		assert.Equal(t, output["body_sha256"], info.SHA256, "the checksum is stored on the artifact")
+		data, err := artifacts.ReadAll(ctx, store, info.Ref, 0)
+		require.NoError(t, err)
+		assert.Equal(t, generatedSum(5<<20), fmt.Sprintf("%x", sha256.Sum256(data)))
+	}
+
+	// Bodies up to the threshold stay in the output
+	output, err = executor.Execute(ctx, &models.WorkflowStep{Name: "download", Type: "http", Config: map[string]interface{}{
+		"url": service.URL + "/files/1024?chunked=1", "response_artifact_bytes": 1024,
+	}}, nil)
+	require.NoError(t, err)
+	assert.Len(t, output["body"], 1024)
+	assert.NotContains(t, output, "body_artifact")
+
+	// Artifacts are bounded for the readers consuming them
+	_, err = artifacts.OpenBounded(ctx, store, payload.Ref, 1<<20)
+	assert.ErrorIs(t, err, artifacts.ErrTooLarge)
+
+	// Steps cannot stream responses their contract has to check
+	assert.ErrorContains(t, executor.Validate(&models.WorkflowStep{Name: "download", Type: "http", Config: map[string]interface{}{
+		"url": service.URL, "response_artifact_bytes": 1024, "response_schema": map[string]interface{}{"type": "object"},
+	}}), "cannot be checked against response_schema")
+}
+
+func TestHTTPStreamRetriesPartialUpload(t *testing.T) {
+	service, attempts := fileService(t)
+	defer service.Close()
+	executor, store := newStreamingExecutor(t)
+	payload := putGenerated(t, store, 8<<20)
+	store.opens.Store(0)
+
+	output, err := executor.Execute(context.Background(), &models.WorkflowStep{Name: "upload", Type: "http", Config: map[string]interface{}{
+		"url": service.URL + "/flaky", "method": "POST", "body": payload.Ref,
+	}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, int32(2), store.opens.Load(), "the artifact is opened again for the retry")
+	assert.Equal(t, map[string]interface{}{
+		"content_length": float64(payload.Size), "size": float64(payload.Size), "sha256": payload.SHA256,
+	}, output["json"], "the retry sends the artifact from the start")
+
+	// Missing artifacts are not retried
+	store.opens.Store(0)
+	_, err = executor.Execute(context.Background(), &models.WorkflowStep{Name: "upload", Type: "http", Config: map[string]interface{}{
+		"url": service.URL + "/uploads", "method": "POST", "body": "artifact://6f1c1d5e-2f6b-4f4e-9d59-0f8f3c1f4d7a/missing.bin",
+	}}, nil)
+	assert.ErrorIs(t, err, artifacts.ErrNotFound)
+	assert.Zero(t, store.opens.Load())
+}
+
+func TestHTTPStreamResponseIntoScratch(t *testing.T) {
+	service, _ := fileService(t)
+	defer service.Close()
+	executor, _ := newStreamingExecutor(t)
+	space, err := scratch.NewSpace(t.TempDir(), 1<<20)
+	require.NoError(t, err)
+	executor.SetScratch(space)
+	executionID := uuid.New()
+	ctx := WithExecutionID(context.Background(), executionID)
+
+	step := &models.WorkflowStep{Name: "download", Type: "http", Config: map[string]interface{}{
+		"url": service.URL + "/files/4096?chunked=1", "response_scratch": "download.bin",
+	}}
+	output, err := executor.Execute(ctx, step, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "download.bin", output["body_scratch"])
+	assert.Equal(t, int64(4096), output["body_size"])
+	assert.NotContains(t, output, "body")
+	data, err := space.ReadAll(ctx, executionID, "download.bin", 0)
+	require.NoError(t, err)
+	assert.Len(t, data, 4096)
+
+	// Responses over the cap of the scratch area fail the step
+	step.Config["url"] = service.URL + "/files/2097152"
+	_, err = executor.Execute(ctx, step, nil)
+	assert.ErrorIs(t, err, scratch.ErrFull)
+
+	assert.ErrorContains(t, executor.Validate(&models.WorkflowStep{Name: "download", Type: "http", Config: map[string]interface{}{
+		"url": service.URL, "response_scratch": "a.json", "response_artifact_bytes": 1024,
+	}}), "cannot both be set")
+}
+
+// peakHeap runs fn and returns the largest heap in use while it ran
+func peakHeap(fn func()) uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapInuse
+
+	var peak uint64
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > base && stats.HeapInuse-base > peak {
+				peak = stats.HeapInuse - base
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+	fn()
+	close(done)
+	wg.Wait()
+	return peak
+}
+
+// transferArtifact uploads an artifact of size bytes and downloads one as
+// large into a new artifact
+func transferArtifact(t testing.TB, executor *HTTPExecutor, service *httptest.Server, payload artifacts.Info) {
+	output, err := executor.Execute(context.Background(), &models.WorkflowStep{Name: "upload", Type: "http", Config: map[string]interface{}{
+		"url": service.URL + "/uploads", "method": "PUT", "body": payload.Ref,
+	}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, float64(payload.Size), output["json"].(map[string]interface{})["size"])
+
+	output, err = executor.Execute(context.Background(), &models.WorkflowStep{Name: "download", Type: "http", Config: map[string]interface{}{
+		"url": fmt.Sprintf("%s/files/%d", service.URL, payload.Size), "response_artifact_bytes": 1 << 20,
+	}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, payload.Size, output["body_size"])
+}
+
+func TestHTTPStreamMultipart(t *testing.T) {
+	// The form service answers with the parts it received
+	type received struct {
+		Name        string `json:"name"`
+		FileName    string `json:"file_name,omitempty"`
+		ContentType string `json:"content_type,omitempty"`
+		Size        int64  `json:"size"`
+		SHA256      string `json:"sha256"`
+		Value       string `json:"value,omitempty"`
+	}
+	var contentLength atomic.Int64
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength.Store(r.ContentLength)
+		reader, err := r.MultipartReader()
+		require.NoError(t, err)
+		var parts []received
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			hash := sha256.New()
+			data, err := io.ReadAll(io.TeeReader(part, hash))
+			require.NoError(t, err)
+			got := received{Name: part.FormName(), FileName: part.FileName(), Size: int64(len(data)), SHA256: hex.EncodeToString(hash.Sum(nil))}
+			if part.FileName() == "" {
+				got.Value = string(data)
+			} else {
+				got.ContentType = part.Header.Get("Content-Type")
+			}
+			parts = append(parts, got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(parts)
+	}))
+	defer service.Close()
+	executor, store := newStreamingExecutor(t)
+	ctx := context.Background()
+
+	writer, err := store.Create(ctx, "invoice.pdf")
+	require.NoError(t, err)
+	writer.SetContentType("application/pdf")
+	_, err = io.Copy(writer, &generated{size: 2<<20 + 3})
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	invoice := writer.Info()
+	scan := putGenerated(t, store, 4096)
+
+	// Reference objects of the step input are sent as file parts with their
+	// content type, other values as fields
+	reference := artifacts.Reference{Ref: scan.Ref, ContentType: "image/png", Size: scan.Size, Encoding: "data_uri"}
+	output, err := executor.Execute(ctx, &models.WorkflowStep{Name: "submit", Type: "http", Config: map[string]interface{}{
+		"url": service.URL, "method": "POST",
+		"multipart": map[string]interface{}{
+			"invoice":  invoice.Ref,
+			"scan":     "${scan}",
+			"customer": "${customer}",
+			"meta":     map[string]interface{}{"pages": 3},
+		},
+	}}, map[string]interface{}{"scan": reference.Object(), "customer": "ACME"})
+	require.NoError(t, err)
+
+	var parts []received
+	data, err := json.Marshal(output["json"])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &parts))
+	assert.Equal(t, []received{
+		{Name: "customer", Size: 4, SHA256: fmt.Sprintf("%x", sha256.Sum256([]byte("ACME"))), Value: "ACME"},
+		{Name: "invoice", FileName: "invoice.pdf", ContentType: "application/pdf", Size: invoice.Size, SHA256: invoice.SHA256},
+		{Name: "meta", Size: 11, SHA256: fmt.Sprintf("%x", sha256.Sum256([]byte(`{"pages":3}`))), Value: `{"pages":3}`},
+		{Name: "scan", FileName: "payload.bin", ContentType: "image/png", Size: scan.Size, SHA256: scan.SHA256},
+	}, parts)
+	assert.Greater(t, contentLength.Load(), invoice.Size+scan.Size, "forms are sent with their size as the content length")
+
+	// Multipart bodies are only sent by steps with a body
+	assert.ErrorContains(t, executor.Validate(&models.WorkflowStep{Name: "submit", Type: "http", Config: map[string]interface{}{
+		"url": service.URL, "multipart": map[string]interface{}{"file": invoice.Ref},
+	}}), "only sent by POST, PUT and PATCH steps")
+	assert.ErrorContains(t, executor.Validate(&models.WorkflowStep{Name: "submit", Type: "http", Config: map[string]interface{}{
+		"url": service.URL, "method": "POST", "body": "{}", "multipart": map[string]interface{}{"file": invoice.Ref},
+	}}), "body and multipart cannot both be set")
+}
+
+func TestHTTPStreamMemoryStaysFlat(t *testing.T) {
+	service, _ := fileService(t)
+	defer service.Close()
+	executor, store := newStreamingExecutor(t)
+	payload := putGenerated(t, store, 128<<20)
+
+	peak := peakHeap(func() { transferArtifact(t, executor, service, payload) })
+	assert.Less(t, peak, uint64(16<<20), "128 MiB artifacts are streamed, not held in memory")
+}
+
+// BenchmarkHTTPStreamArtifact uploads a 2 GiB artifact and downloads one as
+// large into a new artifact, reporting the peak heap growth
+func BenchmarkHTTPStreamArtifact(b *testing.B) {
+	service, _ := fileService(b)
+	defer service.Close()
+	executor, store := newStreamingExecutor(b)
+	payload := putGenerated(b, store, 2<<30)
+
+	b.SetBytes(2 * payload.Size)
+	b.ResetTimer()
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		if heap := peakHeap(func() { transferArtifact(b, executor, service, payload) }); heap > peak {
+			peak = heap
+		}
+	}
+	b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MiB")
+}
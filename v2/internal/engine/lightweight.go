@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// StepBatchStore is a StepStore that also persists the step executions of an
+// execution in one write, such as database.StepExecutionRepository.
+// Lightweight executions persist their steps through CreateBatch when the
+// step store implements it, and one by one otherwise.
+type StepBatchStore interface {
+	StepStore
+	CreateBatch(stepExecutions []*models.StepExecution) error
+}
+
+// lightweightEvents are the events lightweight executions emit, those
+// starting and ending them on a node
+var lightweightEvents = map[string]bool{
+	"execution.started":   true,
+	"execution.resumed":   true,
+	"execution.parked":    true,
+	"execution.completed": true,
+	"execution.failed":    true,
+	"execution.cancelled": true,
+}
+
+// terminalEvents are the events ending an execution
+var terminalEvents = map[string]bool{
+	"execution.completed": true,
+	"execution.failed":    true,
+	"execution.cancelled": true,
+}
+
+// SetFastLane sets how many lightweight executions run at once in the fast
+// lane, whose slots are not counted against the maximum of concurrent
+// executions. Lightweight executions arriving while the fast lane is full
+// take a regular slot. Zero disables the fast lane.
+func (e *Engine) SetFastLane(size int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	e.fastLaneSize = size
+}
+
+// FastLaneAvailable reports whether an execution of a definition would start
+// in the fast lane right away
+func (e *Engine) FastLaneAvailable(definition models.WorkflowDefinition) bool {
+	if executionMode(&definition) != models.ExecutionModeLightweight {
+		return false
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.fastLaneExecutions < e.fastLaneSize
+}
+
+// acquireSlotLocked takes a slot for an execution of a mode and reports
+// whether it is a slot of the fast lane. It fails when every regular slot
+// is taken. e.mu must be held.
+func (e *Engine) acquireSlotLocked(mode models.ExecutionMode) (bool, error) {
+	if mode == models.ExecutionModeLightweight && e.fastLaneExecutions < e.fastLaneSize {
+		e.fastLaneExecutions++
+		return true, nil
+	}
+	if e.currentExecutions >= e.maxConcurrent {
+		return false, fmt.Errorf("maximum concurrent executions reached: %d", e.maxConcurrent)
+	}
+	e.currentExecutions++
+	return false, nil
+}
+
+// releaseSlotLocked frees the slot of an ended execution. e.mu must be held.
+func (e *Engine) releaseSlotLocked(fastLane bool) {
+	if fastLane {
+		e.fastLaneExecutions--
+		return
+	}
+	e.currentExecutions--
+}
+
+// executionMode returns the mode the executions of a definition run in.
+// Definitions asking for the lightweight mode run in the standard mode when
+// a step uses a feature lightweight executions cannot run. Versions record
+// that decision as they are created; it is made again here, so definitions
+// saved before their version recorded it degrade too.
+func executionMode(definition *models.WorkflowDefinition) models.ExecutionMode {
+	if definition.Spec.Mode() != models.ExecutionModeLightweight {
+		return models.ExecutionModeStandard
+	}
+	for i := range definition.Spec.Steps {
+		if !lightweightStep(definition.Spec.Steps[i].Type, definition.Spec.Steps[i].Config) {
+			return models.ExecutionModeStandard
+		}
+	}
+	return models.ExecutionModeLightweight
+}
+
+// lightweightStep reports whether lightweight executions can run a step and
+// the steps defined inline in it
+func lightweightStep(stepType string, config map[string]interface{}) bool {
+	if models.LightweightIncompatibility(stepType) != "" {
+		return false
+	}
+	if stepType != "loop" {
+		return true
+	}
+	steps, _ := config["steps"].([]interface{})
+	for _, child := range steps {
+		step, ok := child.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		childType, _ := step["type"].(string)
+		childConfig, _ := step["config"].(map[string]interface{})
+		if !lightweightStep(childType, childConfig) {
+			return false
+		}
+	}
+	return true
+}
+
+// flushSteps persists the step executions a lightweight execution buffered,
+// in one batch when the step store supports it. Like persistStep, failures
+// are logged and the execution goes on.
+func (e *Engine) flushSteps(execContext *ExecutionContext) {
+	if !execContext.lightweight {
+		return
+	}
+	execContext.mu.Lock()
+	steps := execContext.bufferedSteps
+	execContext.bufferedSteps = nil
+	execContext.mu.Unlock()
+
+	e.mu.RLock()
+	store := e.stepStore
+	e.mu.RUnlock()
+	if store == nil || len(steps) == 0 {
+		return
+	}
+
+	if batch, ok := store.(StepBatchStore); ok {
+		if err := batch.CreateBatch(steps); err != nil {
+			execContext.Logger.WithError(err).WithField("steps", len(steps)).Error("Failed to persist step executions")
+		}
+		return
+	}
+	for _, stepExecution := range steps {
+		if err := store.Create(stepExecution); err != nil {
+			execContext.Logger.WithError(err).WithFields(stepFields(stepExecution.StepName, stepExecution.StepType)).Error("Failed to persist step execution")
+		}
+	}
+}
+
+// notifiesWebhooks reports whether webhooks are sent an event. Lightweight
+// executions only notify webhooks as they end.
+func notifiesWebhooks(event *WorkflowEvent) bool {
+	if fmt.Sprint(event.Data["execution_mode"]) != string(models.ExecutionModeLightweight) {
+		return true
+	}
+	return terminalEvents[event.Type]
+}
+
+// SynthesizeStepEvents returns the step events of a lightweight execution,
+// which emits none, from its step executions: the events the execution
+// would have emitted in the standard mode, at the times its step executions
+// record, ordered by time. Synthesized events have no sequence number.
+func SynthesizeStepEvents(execution *models.Execution, steps []*models.StepExecution) []*WorkflowEvent {
+	events := make([]*WorkflowEvent, 0, 2*len(steps))
+	for _, step := range steps {
+		event := func(eventType string, timestamp time.Time, data map[string]interface{}) *WorkflowEvent {
+			return &WorkflowEvent{
+				Type:          eventType,
+				ExecutionID:   execution.ID,
+				WorkflowID:    execution.WorkflowID,
+				CorrelationID: execution.CorrelationID,
+				StepID:        step.StepID,
+				Timestamp:     timestamp,
+				Data:          data,
+			}
+		}
+		completedAt := step.StartedAt
+		if step.CompletedAt != nil {
+			completedAt = *step.CompletedAt
+		}
+		replayed := step.Metadata["replayed"] == true
+
+		switch step.Status {
+		case models.StepStatusSkipped:
+			events = append(events, event("step.skipped", completedAt, map[string]interface{}{
+				"step_type": step.StepType,
+				"reason":    step.Error,
+			}))
+		case models.StepStatusFailed:
+			events = append(events, event("step.started", step.StartedAt, map[string]interface{}{
+				"step_type": step.StepType,
+			}))
+			failed := event("step.failed", completedAt, map[string]interface{}{
+				"duration":       stepSeconds(step),
+				"after_response": step.AfterResponse,
+				"replayed":       replayed,
+			})
+			failed.Error = step.Error
+			events = append(events, failed)
+		default:
+			events = append(events, event("step.started", step.StartedAt, map[string]interface{}{
+				"step_type": step.StepType,
+			}))
+			events = append(events, event("step.completed", completedAt, map[string]interface{}{
+				"output":         step.OutputData,
+				"duration":       stepSeconds(step),
+				"after_response": step.AfterResponse,
+				"replayed":       replayed,
+			}))
+		}
+	}
+
+	// Steps starting together keep the order of their step executions
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events
+}
+
+// stepSeconds returns the duration of a step execution in seconds, as step
+// events report it
+func stepSeconds(step *models.StepExecution) float64 {
+	return (time.Duration(step.Duration) * time.Millisecond).Seconds()
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+// batchStepStore keeps the step executions it persists, one by one and in
+// batches
+type batchStepStore struct {
+	recordingStepStore
+	batches [][]*models.StepExecution
+}
+
+func (s *batchStepStore) CreateBatch(stepExecutions []*models.StepExecution) error {
+	s.batches = append(s.batches, stepExecutions)
+	return nil
+}
+
+// writes returns the number of writes the store received
+func (s *batchStepStore) writes() int {
+	return len(s.steps) + len(s.batches)
+}
+
+// bookkeepingRun runs a quote step taking two seconds and a failing charge
+// step in an execution of a mode, on a fake clock
+func bookkeepingRun(tb testing.TB, lightweight bool) (*ExecutionContext, *batchStepStore, *queuedEvents) {
+	tb.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clock := scheduler.NewFakeClock(time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC))
+	e := NewEngine(10, nopMetrics{}, logger)
+	e.SetClock(clock)
+	store := &batchStepStore{}
+	e.SetStepStore(store)
+	events := &queuedEvents{}
+	e.RegisterEventHandler(events)
+	e.RegisterStepExecutor("quote", &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		clock.Advance(2 * time.Second)
+		return map[string]interface{}{"price": 107.5}, nil
+	}})
+	e.RegisterStepExecutor("charge", &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errors.New("card declined")
+	}})
+
+	execContext := newLoggingExecution(logger)
+	execContext.lightweight = lightweight
+	require.NoError(tb, e.executeStep(execContext, &models.WorkflowStep{Name: "quote", Type: "quote"}))
+	require.Error(tb, e.executeStep(execContext, &models.WorkflowStep{Name: "charge", Type: "charge"}))
+	e.flushSteps(execContext)
+	return execContext, store, events
+}
+
+func TestLightweightExecutionRecords(t *testing.T) {
+	_, standardStore, standardEvents := bookkeepingRun(t, false)
+	lightweight, lightweightStore, lightweightEvents := bookkeepingRun(t, true)
+
+	// Standard executions write every step, lightweight ones write them
+	// all at once and emit no step event
+	assert.Len(t, standardStore.steps, 2)
+	assert.Empty(t, standardStore.batches)
+	assert.Empty(t, lightweightStore.steps)
+	require.Len(t, lightweightStore.batches, 1)
+	assert.Empty(t, lightweightEvents.events)
+
+	// The records are those of a standard execution
+	batch := lightweightStore.batches[0]
+	require.Len(t, batch, len(standardStore.steps))
+	for i, step := range batch {
+		standard, recorded := *standardStore.steps[i], *step
+		standard.ID, standard.ExecutionID = uuid.Nil, uuid.Nil
+		recorded.ID, recorded.ExecutionID = uuid.Nil, uuid.Nil
+		assert.Equal(t, standard, recorded, step.StepName)
+	}
+
+	// And so are the step events synthesized from them
+	synthesized := SynthesizeStepEvents(lightweight.Execution, batch)
+	require.Len(t, synthesized, len(standardEvents.events))
+	for i, event := range synthesized {
+		standard := standardEvents.events[i]
+		assert.Equal(t, standard.Type, event.Type)
+		assert.Equal(t, standard.StepID, event.StepID)
+		assert.Equal(t, standard.Timestamp, event.Timestamp, event.Type)
+		assert.Equal(t, standard.Error, event.Error, event.Type)
+		for _, key := range []string{"step_type", "output", "duration", "after_response", "replayed"} {
+			assert.Equal(t, standard.Data[key], event.Data[key], "%s %s", event.Type, key)
+		}
+		assert.Equal(t, lightweight.Execution.ID, event.ExecutionID)
+		assert.Zero(t, event.Sequence)
+	}
+}
+
+func TestFastLane(t *testing.T) {
+	e := NewEngine(1, nil, logrus.New())
+	e.SetFastLane(1)
+	lightweight := models.WorkflowDefinition{}
+	lightweight.Spec.ExecutionMode = models.ExecutionModeLightweight
+	assert.True(t, e.FastLaneAvailable(lightweight))
+	assert.False(t, e.FastLaneAvailable(models.WorkflowDefinition{}))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fastLane, err := e.acquireSlotLocked(models.ExecutionModeLightweight)
+	require.NoError(t, err)
+	assert.True(t, fastLane)
+
+	// The fast lane is full, the next lightweight execution takes the
+	// regular slot and standard ones are turned away
+	fastLane, err = e.acquireSlotLocked(models.ExecutionModeLightweight)
+	require.NoError(t, err)
+	assert.False(t, fastLane)
+	_, err = e.acquireSlotLocked(models.ExecutionModeStandard)
+	assert.Error(t, err)
+
+	e.releaseSlotLocked(true)
+	e.releaseSlotLocked(false)
+	assert.Zero(t, e.fastLaneExecutions)
+	assert.Zero(t, e.currentExecutions)
+}
+
+func TestExecutionModeFallback(t *testing.T) {
+	loop := func(stepType string) map[string]interface{} {
+		return map[string]interface{}{"steps": []interface{}{
+			map[string]interface{}{"name": "inner", "type": stepType},
+		}}
+	}
+	lightweight, standard := models.ExecutionModeLightweight, models.ExecutionModeStandard
+	tests := map[string]struct {
+		requested models.ExecutionMode
+		steps     []models.WorkflowStep
+		mode      models.ExecutionMode
+	}{
+		"simple steps":   {requested: lightweight, steps: []models.WorkflowStep{{Type: "http"}, {Type: "script"}}, mode: lightweight},
+		"loop":           {requested: lightweight, steps: []models.WorkflowStep{{Type: "loop", Config: loop("http")}}, mode: lightweight},
+		"approval":       {requested: lightweight, steps: []models.WorkflowStep{{Type: "http"}, {Type: "approval"}}, mode: standard},
+		"parallel":       {requested: lightweight, steps: []models.WorkflowStep{{Type: "parallel"}}, mode: standard},
+		"sub-workflow":   {requested: lightweight, steps: []models.WorkflowStep{{Type: "sub_workflow"}}, mode: standard},
+		"manual in loop": {requested: lightweight, steps: []models.WorkflowStep{{Type: "loop", Config: loop("manual")}}, mode: standard},
+		"not requested":  {steps: []models.WorkflowStep{{Type: "http"}}, mode: standard},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			definition := &models.WorkflowDefinition{}
+			definition.Spec.ExecutionMode = tt.requested
+			definition.Spec.Steps = tt.steps
+			assert.Equal(t, tt.mode, executionMode(definition))
+		})
+	}
+}
+
+func TestLightweightWebhooks(t *testing.T) {
+	lightweight := map[string]interface{}{"execution_mode": models.ExecutionModeLightweight}
+	assert.True(t, notifiesWebhooks(&WorkflowEvent{Type: "execution.completed", Data: lightweight}))
+	assert.True(t, notifiesWebhooks(&WorkflowEvent{Type: "execution.failed", Data: lightweight}))
+	assert.False(t, notifiesWebhooks(&WorkflowEvent{Type: "execution.started", Data: lightweight}))
+
+	// Standard executions and events of no execution notify webhooks
+	assert.True(t, notifiesWebhooks(&WorkflowEvent{Type: "execution.started", Data: map[string]interface{}{"execution_mode": models.ExecutionModeStandard}}))
+	assert.True(t, notifiesWebhooks(&WorkflowEvent{Type: "slo.burn"}))
+}
+
+// BenchmarkExecutionBookkeeping compares the writes and events of the
+// executions of a two step workflow in both modes
+func BenchmarkExecutionBookkeeping(b *testing.B) {
+	for _, mode := range []models.ExecutionMode{models.ExecutionModeStandard, models.ExecutionModeLightweight} {
+		b.Run(string(mode), func(b *testing.B) {
+			b.ReportAllocs()
+			writes, events := 0, 0
+			for i := 0; i < b.N; i++ {
+				_, store, emitted := bookkeepingRun(b, mode == models.ExecutionModeLightweight)
+				writes += store.writes()
+				events += len(emitted.events)
+			}
+			b.ReportMetric(float64(writes)/float64(b.N), "writes/op")
+			b.ReportMetric(float64(events)/float64(b.N), "events/op")
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// executionFields returns the fields every entry logged for an execution
+// carries
+func executionFields(execution *models.Execution, workflow *models.Workflow) logrus.Fields {
+	return logrus.Fields{
+		"execution_id":  execution.ID,
+		"workflow_id":   workflow.ID,
+		"workflow_name": workflow.Name,
+	}
+}
+
+// stepFields returns the fields every entry logged within a step carries,
+// on top of those of its execution
+func stepFields(stepID, stepType string) logrus.Fields {
+	return logrus.Fields{
+		"step_id":   stepID,
+		"step_type": stepType,
+	}
+}
+
+// stepLogger returns the logger of the entries logged within a step, by the
+// engine or, through the step context, by its executor
+func (execContext *ExecutionContext) stepLogger(step *models.WorkflowStep) *logrus.Entry {
+	return execContext.Logger.WithFields(stepFields(step.ID, step.Type))
+}
+
+// StepLogSampling thins the entries the engine logs for successful steps,
+// which flood the logs under load. Failed steps, and steps running for at
+// least SlowThreshold, are always logged.
+type StepLogSampling struct {
+	// Every logs one in Every successful steps: one logs every step, zero
+	// none, leaving failed and slow steps only. The entries of the other
+	// steps are logged at debug level.
+	Every int
+	// SlowThreshold is the duration from which successful steps are logged
+	// as slow. Zero treats no step as slow.
+	SlowThreshold time.Duration
+}
+
+// SetStepLogSampling sets the sampling of the entries logged for steps.
+// Every step is logged until set.
+func (e *Engine) SetStepLogSampling(sampling StepLogSampling) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stepSampling = sampling
+}
+
+func (e *Engine) stepLogSampling() StepLogSampling {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.stepSampling
+}
+
+// sampleStep reports whether the entries of a step starting are sampled.
+// Steps are counted across executions, so one in Every is sampled however
+// they are spread.
+func (e *Engine) sampleStep() bool {
+	every := e.stepLogSampling().Every
+	if every <= 1 {
+		return every == 1
+	}
+	return (e.stepLogCount.Add(1)-1)%uint64(every) == 0
+}
+
+// sampledLevel returns the level of the entries of a step, info when
+// sampled and debug otherwise
+func sampledLevel(sampled bool) logrus.Level {
+	if sampled {
+		return logrus.InfoLevel
+	}
+	return logrus.DebugLevel
+}
+
+// logStepCompleted logs the completion of a successful step, as a warning
+// when the step was slow whether it was sampled or not
+func (e *Engine) logStepCompleted(logger *logrus.Entry, duration time.Duration, sampled bool) {
+	logger = logger.WithField("duration", duration.Seconds())
+	threshold := e.stepLogSampling().SlowThreshold
+	if threshold > 0 && duration >= threshold {
+		logger.WithField("slow_threshold", threshold.Seconds()).Warn("Slow workflow step completed")
+		return
+	}
+	logger.Log(sampledLevel(sampled), "Workflow step completed")
+}
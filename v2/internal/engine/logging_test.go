@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+// nopMetrics discards the metrics of executions
+type nopMetrics struct{}
+
+func (nopMetrics) RecordExecution(execution *models.Execution)                       {}
+func (nopMetrics) RecordStepExecution(step *models.StepExecution)                    {}
+func (nopMetrics) RecordError(err error, context map[string]interface{})             {}
+func (nopMetrics) RecordMetric(name string, value float64, labels map[string]string) {}
+
+// failingStepStore fails to persist step executions
+type failingStepStore struct{}
+
+func (failingStepStore) Create(stepExecution *models.StepExecution) error {
+	return errors.New("connection reset")
+}
+
+// loggingExecutor logs through the logger of the step context
+type loggingExecutor struct {
+	err error
+	// clock and took make steps take time on the engine clock
+	clock *scheduler.FakeClock
+	took  time.Duration
+}
+
+func (e *loggingExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
+	correlation.Logger(ctx, nil).Info("Executor working")
+	if e.clock != nil {
+		e.clock.Advance(e.took)
+	}
+	return map[string]interface{}{"ok": e.err == nil}, e.err
+}
+
+func (e *loggingExecutor) Validate(step *models.WorkflowStep) error {
+	return nil
+}
+
+func (e *loggingExecutor) GetType() string {
+	return "logging"
+}
+
+func newLoggingExecution(logger *logrus.Logger) *ExecutionContext {
+	workflow := &models.Workflow{ID: uuid.New(), Name: "orders"}
+	execution := &models.Execution{ID: uuid.New(), WorkflowID: workflow.ID}
+	execContext := &ExecutionContext{
+		Execution:   execution,
+		Workflow:    workflow,
+		Variables:   make(map[string]interface{}),
+		StepResults: make(map[string]interface{}),
+		Context:     context.Background(),
+		Logger:      logger.WithFields(executionFields(execution, workflow)),
+	}
+	execContext.publishStatusLocked()
+	return execContext
+}
+
+func TestStepLogFields(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	e := NewEngine(10, nopMetrics{}, logger)
+	e.SetStepStore(failingStepStore{})
+	e.RegisterStepExecutor("logging", &loggingExecutor{})
+	e.RegisterStepExecutor("failing", &loggingExecutor{err: errors.New("upstream unavailable")})
+
+	execContext := newLoggingExecution(logger)
+	execution, workflow := execContext.Execution, execContext.Workflow
+
+	fetch := &models.WorkflowStep{Name: "fetch", Type: "logging"}
+	require.NoError(t, e.executeStep(execContext, fetch))
+	charge := &models.WorkflowStep{Name: "charge", Type: "failing"}
+	require.Error(t, e.executeStep(execContext, charge))
+
+	entries := hook.AllEntries()
+	var messages []string
+	for _, entry := range entries {
+		messages = append(messages, entry.Message)
+	}
+	assert.Equal(t, []string{
+		"Executing workflow step",
+		"Executor working",
+		"Failed to persist step execution",
+		"Workflow step completed",
+		"Executing workflow step",
+		"Executor working",
+		"Failed to persist step execution",
+		"Workflow step failed",
+	}, messages)
+
+	for i, entry := range entries {
+		step := fetch
+		if i >= 4 {
+			step = charge
+		}
+		assert.Equal(t, execution.ID, entry.Data["execution_id"], entry.Message)
+		assert.Equal(t, workflow.ID, entry.Data["workflow_id"], entry.Message)
+		assert.Equal(t, "orders", entry.Data["workflow_name"], entry.Message)
+		assert.Equal(t, step.ID, entry.Data["step_id"], entry.Message)
+		assert.Equal(t, step.Type, entry.Data["step_type"], entry.Message)
+	}
+}
+
+func TestStepLogSampling(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	clock := scheduler.NewFakeClock(time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC))
+	e := NewEngine(10, nopMetrics{}, logger)
+	e.SetClock(clock)
+	e.SetStepLogSampling(StepLogSampling{Every: 3, SlowThreshold: 5 * time.Second})
+	e.RegisterStepExecutor("fast", &loggingExecutor{clock: clock, took: 100 * time.Millisecond})
+	e.RegisterStepExecutor("slow", &loggingExecutor{clock: clock, took: 8 * time.Second})
+	e.RegisterStepExecutor("failing", &loggingExecutor{err: errors.New("upstream unavailable")})
+	execContext := newLoggingExecution(logger)
+
+	run := func(name, stepType string) {
+		t.Helper()
+		step := &models.WorkflowStep{Name: name, Type: stepType}
+		err := e.executeStep(execContext, step)
+		if stepType == "failing" {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+	// entries returns the step entries logged at info level or above since
+	// the last call, the executor entries aside
+	entries := func() []string {
+		var logged []string
+		for _, entry := range hook.AllEntries() {
+			if entry.Level <= logrus.InfoLevel && entry.Message != "Executor working" {
+				logged = append(logged, entry.Level.String()+": "+entry.Message)
+			}
+		}
+		hook.Reset()
+		return logged
+	}
+
+	// One in three successful steps is logged
+	for i := 0; i < 6; i++ {
+		run("fetch", "fast")
+	}
+	assert.Equal(t, []string{
+		"info: Executing workflow step",
+		"info: Workflow step completed",
+		"info: Executing workflow step",
+		"info: Workflow step completed",
+	}, entries())
+
+	// Failed and slow steps are always logged, sampled or not
+	run("charge", "failing")
+	run("charge", "failing")
+	run("render", "slow")
+	assert.Equal(t, []string{
+		"info: Executing workflow step",
+		"error: Workflow step failed",
+		"error: Workflow step failed",
+		"warning: Slow workflow step completed",
+	}, entries())
+
+	// Only anomalies are logged without sampling
+	e.SetStepLogSampling(StepLogSampling{Every: 0, SlowThreshold: 5 * time.Second})
+	run("fetch", "fast")
+	run("fetch", "fast")
+	run("charge", "failing")
+	assert.Equal(t, []string{"error: Workflow step failed"}, entries())
+
+	// Unsampled entries are still logged at debug level
+	logger.SetLevel(logrus.DebugLevel)
+	run("fetch", "fast")
+	debug := 0
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.DebugLevel {
+			debug++
+		}
+	}
+	assert.Equal(t, 2, debug)
+}
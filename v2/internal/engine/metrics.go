@@ -9,6 +9,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"magic-flow/v2/internal/scheduler"
 	"magic-flow/v2/pkg/models"
 )
 
@@ -55,6 +56,21 @@ func (c *PrometheusMetricsCollector) registerDefaultMetrics() {
 	c.registerGauge("workflow_engine_active_executions", "Number of currently active workflow executions", []string{})
 	c.registerGauge("workflow_engine_queue_size", "Number of workflow executions in queue", []string{})
 	c.registerCounter("workflow_engine_errors_total", "Total number of workflow engine errors", []string{"error_type"})
+
+	// Executor warm-up metrics
+	c.registerCounter("executor_starts_total", "Total number of steps started on warm connections or interpreters and on cold ones", []string{"executor", "start"})
+
+	// Response contract metrics
+	c.registerCounter("http_response_contract_violations_total", "Total number of http step responses violating the response contract of their step", []string{"workflow_id", "step_id"})
+
+	// Variable budget metrics
+	c.registerGauge("workflow_execution_variables_bytes", "Size in bytes of the variables of the latest execution of the workflow to merge a step output, encoded as JSON", []string{"workflow_id"})
+
+	// Input extraction metrics
+	c.registerCounter("execution_input_extracted_bytes_total", "Total number of bytes of binaries embedded in execution inputs extracted into artifacts", []string{"workflow_id"})
+
+	// Definition complexity metrics
+	c.registerCounter("definition_complexity_exceeded_total", "Total number of validated workflow definitions over a soft or hard complexity limit of their namespace", []string{"namespace", "measure", "limit"})
 }
 
 func (c *PrometheusMetricsCollector) registerCounter(name, help string, labels []string) {
@@ -147,6 +163,7 @@ func (c *PrometheusMetricsCollector) GetRegistry() *prometheus.Registry {
 // DatabaseMetricsCollector implements MetricsCollector by storing metrics in database
 type DatabaseMetricsCollector struct {
 	db     *gorm.DB
+	clock  scheduler.Clock
 	logger *logrus.Logger
 	buffer chan *models.WorkflowMetric
 	stop   chan struct{}
@@ -157,6 +174,7 @@ type DatabaseMetricsCollector struct {
 func NewDatabaseMetricsCollector(db *gorm.DB, logger *logrus.Logger) *DatabaseMetricsCollector {
 	c := &DatabaseMetricsCollector{
 		db:     db,
+		clock:  scheduler.NewRealClock(),
 		logger: logger,
 		buffer: make(chan *models.WorkflowMetric, 1000),
 		stop:   make(chan struct{}),
@@ -169,13 +187,20 @@ func NewDatabaseMetricsCollector(db *gorm.DB, logger *logrus.Logger) *DatabaseMe
 	return c
 }
 
+// SetClock sets the clock metrics are timestamped with, the engine's clock.
+// It must be set before metrics are recorded.
+func (c *DatabaseMetricsCollector) SetClock(clock scheduler.Clock) {
+	c.clock = clock
+}
+
 func (c *DatabaseMetricsCollector) RecordMetric(name string, value float64, labels map[string]string) {
+	now := c.clock.Now().UTC()
 	metric := &models.WorkflowMetric{
 		Name:      name,
 		Value:     value,
 		Labels:    labels,
-		Timestamp: time.Now().UTC(),
-		CreatedAt: time.Now().UTC(),
+		Timestamp: now,
+		CreatedAt: now,
 	}
 
 	// Try to send to buffer, drop if full
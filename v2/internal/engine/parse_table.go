@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/artifacts"
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/internal/tabular"
+	"magic-flow/v2/pkg/models"
+)
+
+// sourceVariablePattern matches sources referencing a step input variable
+var sourceVariablePattern = regexp.MustCompile(`^\$\{\s*([^}\s]+)\s*\}$`)
+
+// ParseTableExecutor executes parse_table steps, parsing CSV, TSV and xlsx
+// tables into rows. The output holds the rows, or under rows_artifact the
+// reference of the artifact holding them when they are larger than
+// max_inline_bytes, along with row_count and the parse report.
+type ParseTableExecutor struct {
+	artifacts artifacts.Store
+	logger    *logrus.Logger
+}
+
+// NewParseTableExecutor creates a new parse_table executor. Without an
+// artifact store, artifact sources cannot be read and rows larger than
+// max_inline_bytes fail the step.
+func NewParseTableExecutor(store artifacts.Store, logger *logrus.Logger) *ParseTableExecutor {
+	return &ParseTableExecutor{
+		artifacts: store,
+		logger:    logger,
+	}
+}
+
+func (e *ParseTableExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
+	typed, err := typedStepConfig(ctx, stepconfig.ParseTableSchema, "parse_table", step)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := typed.(*stepconfig.ParseTableConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid parse_table configuration")
+	}
+	options, err := tabular.OptionsFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parse_table configuration: %w", err)
+	}
+
+	maxSource := config.MaxSourceBytes
+	if maxSource <= 0 {
+		maxSource = tabular.DefaultMaxSourceBytes
+	}
+	source, err := e.openSource(ctx, config.Source, maxSource, input)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	limit := config.MaxInlineBytes
+	if limit <= 0 {
+		limit = tabular.DefaultMaxInlineBytes
+	}
+	collector := tabular.NewCollector(ctx, e.artifacts, limit)
+	report, err := tabular.Parse(ctx, source, options, collector.Add)
+	if err != nil {
+		collector.Discard()
+		return nil, fmt.Errorf("failed to parse table: %w", err)
+	}
+
+	output, err := collector.Output()
+	if err != nil {
+		return nil, err
+	}
+	reportData, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode parse report: %w", err)
+	}
+	var reportMap map[string]interface{}
+	if err := json.Unmarshal(reportData, &reportMap); err != nil {
+		return nil, fmt.Errorf("failed to encode parse report: %w", err)
+	}
+	output["report"] = reportMap
+
+	if report.RowsSkipped > 0 {
+		correlation.Logger(ctx, e.logger).WithField("skipped", report.RowsSkipped).Warn("Skipped malformed table rows")
+	}
+	return output, nil
+}
+
+// openSource opens the table of a step: the artifact or the text the
+// source holds, a ${variable} source holding either in the step input.
+// Artifacts larger than maxBytes are not opened, and those opened keep their
+// random access, so xlsx tables are not copied to a file.
+func (e *ParseTableExecutor) openSource(ctx context.Context, source string, maxBytes int64, input map[string]interface{}) (io.ReadCloser, error) {
+	if match := sourceVariablePattern.FindStringSubmatch(source); match != nil {
+		value, exists := input[match[1]]
+		if !exists || value == nil {
+			return nil, fmt.Errorf("table source references unknown variable %q", match[1])
+		}
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("table source variable %q must be a string, got %T", match[1], value)
+		}
+		source = text
+	}
+
+	if !artifacts.IsRef(source) {
+		return inlineTable{strings.NewReader(source)}, nil
+	}
+	if e.artifacts == nil {
+		return nil, fmt.Errorf("table source %s is an artifact but no artifact store is configured", source)
+	}
+	return artifacts.OpenBounded(ctx, e.artifacts, source, maxBytes)
+}
+
+// inlineTable is a table held by the source itself. It keeps the random
+// access of its reader, so xlsx tables are not copied to a file.
+type inlineTable struct {
+	*strings.Reader
+}
+
+func (inlineTable) Close() error {
+	return nil
+}
+
+func (e *ParseTableExecutor) Validate(step *models.WorkflowStep) error {
+	section := stepconfig.Section("parse_table", step.Config)
+	if _, err := stepconfig.ParseTableSchema.Validate(section, false); err != nil {
+		return err
+	}
+	typed, err := stepconfig.ParseTableSchema.Decode(section)
+	if err != nil {
+		return err
+	}
+	_, err = tabular.OptionsFromConfig(typed.(*stepconfig.ParseTableConfig))
+	return err
+}
+
+func (e *ParseTableExecutor) GetType() string {
+	return "parse_table"
+}
+
+func (e *ParseTableExecutor) ConfigSchema() *stepconfig.Schema {
+	return stepconfig.ParseTableSchema
+}
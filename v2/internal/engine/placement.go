@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrNodeCordoned is returned by ExecuteWorkflow when the worker node running
+// the engine does not accept new executions
+var ErrNodeCordoned = errors.New("node is not accepting new executions")
+
+// NodePlacement admits executions to the worker node running an engine and
+// records the executions placed on it
+type NodePlacement interface {
+	NodeID() string
+	Accepting() bool
+	RecordPlacement(ctx context.Context, executionID uuid.UUID, hop models.PlacementHop) error
+}
+
+type placementHopKey struct{}
+
+// SetPlacement sets the worker node the engine runs on. Without one the
+// engine accepts all executions and records no placements.
+func (e *Engine) SetPlacement(placement NodePlacement) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.placement = placement
+}
+
+// WithPlacementHop returns a context marking the execution started with it
+// as a resume, retry or reclaim of earlier work rather than a new start
+func WithPlacementHop(ctx context.Context, hop models.PlacementHop) context.Context {
+	return context.WithValue(ctx, placementHopKey{}, hop)
+}
+
+// placementHopFromContext returns the placement hop of ctx, defaulting to a
+// start
+func placementHopFromContext(ctx context.Context) models.PlacementHop {
+	if hop, ok := ctx.Value(placementHopKey{}).(models.PlacementHop); ok && hop != "" {
+		return hop
+	}
+	return models.PlacementHopStart
+}
+
+// Accepting reports whether the engine accepts new executions, which it does
+// unless the worker node it runs on is cordoned
+func (e *Engine) Accepting() bool {
+	e.mu.RLock()
+	placement := e.placement
+	e.mu.RUnlock()
+	return placement == nil || placement.Accepting()
+}
+
+// RunningExecutions returns the number of executions the engine is running
+func (e *Engine) RunningExecutions() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.currentExecutions
+}
+
+// Capacity returns the maximum number of concurrent executions
+func (e *Engine) Capacity() int {
+	return e.maxConcurrent
+}
+
+// StepTypes returns the step types with a registered executor
+func (e *Engine) StepTypes() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	types := make([]string, 0, len(e.stepExecutors))
+	for stepType := range e.stepExecutors {
+		types = append(types, stepType)
+	}
+	sort.Strings(types)
+	return types
+}
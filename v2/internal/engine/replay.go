@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+
+	"magic-flow/v2/internal/replay"
+	"magic-flow/v2/pkg/models"
+)
+
+// StepStore persists the step executions of executions, which replays use
+// as their recording, such as database.StepExecutionRepository
+type StepStore interface {
+	Create(stepExecution *models.StepExecution) error
+}
+
+// SetStepStore sets the store persisting step executions. Step executions
+// are not persisted until set, and such executions cannot be replayed.
+func (e *Engine) SetStepStore(store StepStore) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stepStore = store
+}
+
+// runStep runs a step with its executor or, in replays of executions that
+// recorded the step, returns its recorded outcome
+func (e *Engine) runStep(ctx context.Context, executor StepExecutor, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, bool, error) {
+	if recorded, ok := replay.FromContext(ctx).Step(step.Name); ok {
+		output, err := recorded.Result()
+		return output, true, err
+	}
+	output, err := executor.Execute(ctx, step, input)
+	return output, false, err
+}
+
+// persistStep persists a finished step execution. Persistence serves replays
+// and visibility, so failures are logged and the execution goes on.
+// Lightweight executions buffer their step executions, flushSteps persists
+// them once the execution ends.
+func (e *Engine) persistStep(execContext *ExecutionContext, stepExecution *models.StepExecution) {
+	if execContext.lightweight {
+		execContext.mu.Lock()
+		execContext.bufferedSteps = append(execContext.bufferedSteps, stepExecution)
+		execContext.mu.Unlock()
+		return
+	}
+	e.mu.RLock()
+	store := e.stepStore
+	e.mu.RUnlock()
+	if store == nil {
+		return
+	}
+	if err := store.Create(stepExecution); err != nil {
+		execContext.Logger.WithError(err).WithFields(stepFields(stepExecution.StepName, stepExecution.StepType)).Error("Failed to persist step execution")
+	}
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/replay"
+	"magic-flow/v2/pkg/models"
+)
+
+// recordingStepStore keeps the step executions it persists
+type recordingStepStore struct {
+	steps []*models.StepExecution
+}
+
+func (s *recordingStepStore) Create(stepExecution *models.StepExecution) error {
+	s.steps = append(s.steps, stepExecution)
+	return nil
+}
+
+// funcExecutor runs steps with a function, counting its calls
+type funcExecutor struct {
+	execute func(input map[string]interface{}) (map[string]interface{}, error)
+	calls   int
+}
+
+func (e *funcExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
+	e.calls++
+	return e.execute(input)
+}
+
+func (e *funcExecutor) Validate(step *models.WorkflowStep) error {
+	return nil
+}
+
+func (e *funcExecutor) GetType() string {
+	return "func"
+}
+
+func TestReplayRecordedSteps(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	e := NewEngine(10, nil, logger)
+	store := &recordingStepStore{}
+	e.SetStepStore(store)
+	execContext := &ExecutionContext{Execution: &models.Execution{ID: uuid.New()}, Logger: logrus.NewEntry(logger)}
+
+	// The quote service answers differently on every call, and the payment
+	// service declines the card
+	price := 100.0
+	quotes := &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		price += 7.5
+		return map[string]interface{}{"price": price}, nil
+	}}
+	charges := &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errors.New("card declined")
+	}}
+	// decide is a step added to the workflow since the original execution,
+	// fed by the outputs of the others
+	var decisions []map[string]interface{}
+	decides := &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		decisions = append(decisions, input)
+		return map[string]interface{}{"approved": input["price"].(float64) < 110 && input["charge_error"] == nil}, nil
+	}}
+
+	type stepRun struct {
+		step     *models.WorkflowStep
+		executor StepExecutor
+	}
+	quote := stepRun{&models.WorkflowStep{Name: "quote", Type: "func"}, quotes}
+	charge := stepRun{&models.WorkflowStep{Name: "charge", Type: "func"}, charges}
+	decide := stepRun{&models.WorkflowStep{Name: "decide", Type: "func"}, decides}
+
+	// run runs steps in order, feeding their outputs and errors to the next
+	// ones and persisting them as executeStep does
+	run := func(ctx context.Context, steps ...stepRun) map[string]interface{} {
+		variables := map[string]interface{}{}
+		for _, step := range steps {
+			input := make(map[string]interface{}, len(variables))
+			for key, value := range variables {
+				input[key] = value
+			}
+			output, replayed, err := e.runStep(ctx, step.executor, step.step, input)
+			stepExecution := &models.StepExecution{
+				ID:          uuid.New(),
+				ExecutionID: execContext.Execution.ID,
+				StepName:    step.step.Name,
+				Status:      models.StepStatusCompleted,
+				OutputData:  output,
+				Attempt:     1,
+				CreatedAt:   time.Now(),
+			}
+			if err != nil {
+				stepExecution.Status = models.StepStatusFailed
+				stepExecution.Error = err.Error()
+				variables[step.step.Name+"_error"] = err.Error()
+			}
+			if replayed {
+				stepExecution.Metadata = map[string]interface{}{"replayed": true}
+			}
+			e.persistStep(execContext, stepExecution)
+			for key, value := range output {
+				variables[key] = value
+			}
+		}
+		return variables
+	}
+
+	original := run(context.Background(), quote, charge)
+	require.Len(t, store.steps, 2)
+	recording := replay.NewRecording(execContext.Execution.ID, store.steps)
+
+	var replays []map[string]interface{}
+	for i := 0; i < 2; i++ {
+		store.steps = nil
+		replays = append(replays, run(replay.WithRecording(context.Background(), recording), quote, charge, decide))
+
+		require.Len(t, store.steps, 3)
+		assert.Equal(t, true, store.steps[0].Metadata["replayed"])
+		assert.Equal(t, true, store.steps[1].Metadata["replayed"])
+		assert.Nil(t, store.steps[2].Metadata, "new steps run for real")
+	}
+
+	assert.Equal(t, 1, quotes.calls, "recorded steps are not executed")
+	assert.Equal(t, 1, charges.calls, "recorded failures are not executed")
+	assert.Equal(t, 2, decides.calls, "steps missing from the recording are executed")
+
+	assert.Equal(t, original["price"], replays[0]["price"], "recorded outputs are replayed")
+	assert.Contains(t, replays[0]["charge_error"], "card declined", "recorded failures are replayed")
+	require.Len(t, decisions, 2)
+	assert.Equal(t, decisions[0], decisions[1], "downstream steps see the same inputs on every replay")
+	assert.Equal(t, replays[0], replays[1], "replays are deterministic")
+	assert.Equal(t, false, replays[0]["approved"])
+}
@@ -0,0 +1,267 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// Sources of retry hints
+const (
+	// RetryHintRetryAfter hints come from the Retry-After header
+	RetryHintRetryAfter = "retry_after"
+	// RetryHintRateLimitReset hints come from the rate limit reset headers
+	// of rate limited responses
+	RetryHintRateLimitReset = "rate_limit_reset"
+	// RetryHintStatus hints come from 429 and 503 statuses without timing
+	// headers
+	RetryHintStatus = "status"
+	// RetryHintExecutor hints are attached by step executors
+	RetryHintExecutor = "executor"
+)
+
+// ErrorCodeRetryHintExceedsDeadline is the error code of executions failed
+// because a step was asked to retry after the deadline of the execution
+const ErrorCodeRetryHintExceedsDeadline = "RETRY_HINT_EXCEEDS_DEADLINE"
+
+// ErrorCodeRetryBudgetExhausted is the error code of executions failed
+// because the next retry of a step would start after the execution timeout
+const ErrorCodeRetryBudgetExhausted = "RETRY_BUDGET_EXHAUSTED"
+
+// unavailableRetryDelay is the retry hint of 429 and 503 responses that do
+// not say when to retry. Services answering 500 are not assumed to recover
+// sooner by waiting longer.
+const unavailableRetryDelay = 5 * time.Second
+
+// epochResetThreshold tells rate limit resets given as unix times, such as
+// those of X-RateLimit-Reset, from resets given in seconds
+const epochResetThreshold = 1_000_000_000
+
+// RetryHint wraps a step error with when the failed service asked to be
+// retried. The retry delay of the step is at least Delay. Step executors
+// attach hints with WithRetryHint.
+type RetryHint struct {
+	Err    error
+	Delay  time.Duration
+	Source string
+}
+
+// WithRetryHint attaches a retry hint to an error, with the source
+// RetryHintExecutor when empty
+func WithRetryHint(err error, delay time.Duration, source string) error {
+	if err == nil {
+		return nil
+	}
+	if source == "" {
+		source = RetryHintExecutor
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return &RetryHint{Err: err, Delay: delay, Source: source}
+}
+
+func (h *RetryHint) Error() string {
+	return h.Err.Error()
+}
+
+func (h *RetryHint) Unwrap() error {
+	return h.Err
+}
+
+// retryHintOf returns the retry hint of a step error, nil without one
+func retryHintOf(err error) *RetryHint {
+	var hint *RetryHint
+	if errors.As(err, &hint) {
+		return hint
+	}
+	return nil
+}
+
+// RetryDeadlineError fails a step asked to retry after the deadline of its
+// execution, rather than waiting for a retry that cannot run
+type RetryDeadlineError struct {
+	Hint      *RetryHint
+	Remaining time.Duration
+}
+
+func (e *RetryDeadlineError) Error() string {
+	return fmt.Sprintf("%s: retry requested after %s, beyond the %s left before the execution deadline",
+		e.Hint.Err, e.Hint.Delay, e.Remaining.Round(time.Millisecond))
+}
+
+func (e *RetryDeadlineError) Unwrap() error {
+	return e.Hint
+}
+
+// RetryBudgetError fails a step whose next retry would start after the
+// deadline of its execution. Retries draw from the timeout of their
+// execution rather than each waiting on its own, so once the budget is
+// spent the remaining retries are abandoned.
+type RetryBudgetError struct {
+	Err       error
+	Retry     int
+	Delay     time.Duration
+	Remaining time.Duration
+}
+
+func (e *RetryBudgetError) Error() string {
+	return fmt.Sprintf("%s: retry %d due in %s, beyond the %s left of the execution timeout",
+		e.Err, e.Retry, e.Delay, e.Remaining.Round(time.Millisecond))
+}
+
+func (e *RetryBudgetError) Unwrap() error {
+	return e.Err
+}
+
+// retryBudget returns a RetryBudgetError when retry of a step that failed
+// with err, due after delay, would start after the deadline of ctx
+func retryBudget(ctx context.Context, retry int, delay time.Duration, err error) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	if remaining := time.Until(deadline); delay >= remaining {
+		return &RetryBudgetError{Err: err, Retry: retry, Delay: delay, Remaining: remaining}
+	}
+	return nil
+}
+
+// CircuitBreakers guard the services steps call. Breakers are told how
+// long services that failed asked to be left alone, so they cool down for
+// at least as long.
+type CircuitBreakers interface {
+	Cooldown(stepType string, until time.Time)
+}
+
+// SetCircuitBreakers sets the circuit breakers told of the retry hints of
+// failed steps
+func (e *Engine) SetCircuitBreakers(breakers CircuitBreakers) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.breakers = breakers
+}
+
+// recordRetryHint records the retry hint of a failed step on its attempt
+// and cools down the circuit breaker of the step type
+func (e *Engine) recordRetryHint(stepExecution *models.StepExecution, hint *RetryHint) {
+	if stepExecution.Metadata == nil {
+		stepExecution.Metadata = make(map[string]interface{})
+	}
+	stepExecution.Metadata["retry_hint"] = retryHintData(hint)
+
+	e.mu.RLock()
+	breakers := e.breakers
+	e.mu.RUnlock()
+	if breakers != nil {
+		breakers.Cooldown(stepExecution.StepType, e.now().Add(hint.Delay))
+	}
+}
+
+// retryHintData is the retry hint of attempts and step events
+func retryHintData(hint *RetryHint) map[string]interface{} {
+	return map[string]interface{}{
+		"source": hint.Source,
+		"delay":  hint.Delay.Seconds(),
+	}
+}
+
+// hintedRetryDelay returns the delay before a step that failed with err is
+// retried, given the backoff of its retry policy. The backoff is raised to
+// the retry hint of the error and capped by maxDelay, when positive. Steps
+// whose hint runs past the deadline of ctx fail with a RetryDeadlineError.
+func hintedRetryDelay(ctx context.Context, backoff, maxDelay time.Duration, err error) (time.Duration, error) {
+	hint := retryHintOf(err)
+	if hint == nil {
+		return backoff, nil
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); hint.Delay > remaining {
+			return 0, &RetryDeadlineError{Hint: hint, Remaining: remaining}
+		}
+	}
+	delay := backoff
+	if hint.Delay > delay {
+		delay = hint.Delay
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay, nil
+}
+
+// httpRetryHint attaches the retry hint of an error response to its
+// HTTPStatusError. Retry-After is honoured on every status, the rate limit
+// reset headers on 429s and responses with no requests remaining, and 429s
+// and 503s without either wait unavailableRetryDelay.
+func httpRetryHint(err *HTTPStatusError, header http.Header, now time.Time) error {
+	if delay, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+		return WithRetryHint(err, delay, RetryHintRetryAfter)
+	}
+	if err.StatusCode == http.StatusTooManyRequests || rateLimitExhausted(header) {
+		for _, name := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+			if delay, ok := parseRateLimitReset(header.Get(name), now); ok {
+				return WithRetryHint(err, delay, RetryHintRateLimitReset)
+			}
+		}
+	}
+	if err.StatusCode == http.StatusTooManyRequests || err.StatusCode == http.StatusServiceUnavailable {
+		return WithRetryHint(err, unavailableRetryDelay, RetryHintStatus)
+	}
+	return err
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return nonNegative(at.Sub(now)), true
+}
+
+// parseRateLimitReset parses a rate limit reset header, in seconds or as a
+// unix time
+func parseRateLimitReset(value string, now time.Time) (time.Duration, bool) {
+	reset, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || reset < 0 {
+		return 0, false
+	}
+	if reset >= epochResetThreshold {
+		return nonNegative(time.Unix(reset, 0).Sub(now)), true
+	}
+	return time.Duration(reset) * time.Second, true
+}
+
+// rateLimitExhausted reports whether a response says no requests remain
+func rateLimitExhausted(header http.Header) bool {
+	for _, name := range []string{"RateLimit-Remaining", "X-RateLimit-Remaining"} {
+		if strings.TrimSpace(header.Get(name)) == "0" {
+			return true
+		}
+	}
+	return false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
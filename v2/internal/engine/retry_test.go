@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+// quotaExecutor fails with the retry hint of a quota it exhausted
+type quotaExecutor struct{}
+
+func (quotaExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
+	return nil, WithRetryHint(errors.New("monthly quota exhausted"), 30*time.Second, "")
+}
+
+func (quotaExecutor) Validate(step *models.WorkflowStep) error { return nil }
+func (quotaExecutor) GetType() string                          { return "quota" }
+
+// cooldowns records the cooldowns of circuit breakers
+type cooldowns map[string]time.Time
+
+func (c cooldowns) Cooldown(stepType string, until time.Time) {
+	c[stepType] = until
+}
+
+func TestHTTPRetryHint(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		delay  time.Duration
+		source string
+	}{
+		{"retry after seconds", 429, http.Header{"Retry-After": {"120"}}, 2 * time.Minute, RetryHintRetryAfter},
+		{"retry after date", 503, http.Header{"Retry-After": {"Mon, 02 Mar 2026 10:00:45 GMT"}}, 45 * time.Second, RetryHintRetryAfter},
+		{"rate limit reset seconds", 429, http.Header{"Ratelimit-Reset": {"30"}}, 30 * time.Second, RetryHintRateLimitReset},
+		{"rate limit reset unix time", 403, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1772445660"}}, time.Minute, RetryHintRateLimitReset},
+		{"unavailable", 503, http.Header{}, unavailableRetryDelay, RetryHintStatus},
+		{"server error", 500, http.Header{}, 0, ""},
+		{"reset without rate limit", 500, http.Header{"X-Ratelimit-Reset": {"30"}}, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statusErr := &HTTPStatusError{StatusCode: tt.status, Body: "busy"}
+			err := httpRetryHint(statusErr, tt.header, now)
+
+			// The status error stays reachable through the hint
+			var got *HTTPStatusError
+			require.True(t, errors.As(err, &got))
+			assert.Equal(t, tt.status, got.StatusCode)
+			assert.Equal(t, statusErr.Error(), err.Error())
+
+			hint := retryHintOf(err)
+			if tt.source == "" {
+				assert.Nil(t, hint)
+				return
+			}
+			require.NotNil(t, hint)
+			assert.Equal(t, tt.delay, hint.Delay)
+			assert.Equal(t, tt.source, hint.Source)
+		})
+	}
+}
+
+func TestRetryAfterHonored(t *testing.T) {
+	err := httpRetryHint(&HTTPStatusError{StatusCode: 429}, http.Header{"Retry-After": {"120"}}, time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	// The hint is a floor of the backoff
+	delay, err := hintedRetryDelay(ctx, 2*time.Second, 0, err)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	delay, err = hintedRetryDelay(ctx, 5*time.Minute, 0, WithRetryHint(errors.New("busy"), time.Minute, ""))
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, delay)
+
+	// and capped by max_delay
+	delay, err = hintedRetryDelay(ctx, 2*time.Second, time.Minute, WithRetryHint(errors.New("busy"), 2*time.Minute, ""))
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, delay)
+
+	// Errors without hints keep the backoff
+	delay, err = hintedRetryDelay(ctx, 2*time.Second, time.Minute, errors.New("connection reset"))
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, delay)
+}
+
+func TestRetryHintExceedsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stepErr := httpRetryHint(&HTTPStatusError{StatusCode: 429, Body: "slow down"}, http.Header{"Retry-After": {"120"}}, time.Now())
+
+	_, err := hintedRetryDelay(ctx, 2*time.Second, 0, stepErr)
+	var deadlineErr *RetryDeadlineError
+	require.True(t, errors.As(err, &deadlineErr))
+	assert.Equal(t, 2*time.Minute, deadlineErr.Hint.Delay)
+	assert.LessOrEqual(t, deadlineErr.Remaining, time.Minute)
+	assert.Contains(t, err.Error(), "HTTP request failed with status 429: slow down: retry requested after 2m0s")
+
+	// The step error stays reachable
+	var statusErr *HTTPStatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, 429, statusErr.StatusCode)
+
+	// Executions failed by it carry a distinct code
+	e := NewEngine(10, nopMetrics{}, logrus.New())
+	execContext := newLoggingExecution(logrus.New())
+	e.failExecution(execContext, err)
+	assert.Equal(t, ErrorCodeRetryHintExceedsDeadline, execContext.Execution.ErrorCode)
+}
+
+func TestRetryHintFromCustomExecutor(t *testing.T) {
+	started := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	e := NewEngine(10, nopMetrics{}, logrus.New())
+	e.SetClock(scheduler.NewFakeClock(started))
+	breakers := cooldowns{}
+	e.SetCircuitBreakers(breakers)
+
+	step := &models.WorkflowStep{Name: "charge", Type: "quota"}
+	_, _, err := e.runStep(context.Background(), quotaExecutor{}, step, nil)
+	require.EqualError(t, err, "monthly quota exhausted")
+
+	hint := retryHintOf(err)
+	require.NotNil(t, hint)
+	assert.Equal(t, 30*time.Second, hint.Delay)
+	assert.Equal(t, RetryHintExecutor, hint.Source)
+
+	// The hint is recorded on the attempt and cools the breaker down
+	stepExecution := &models.StepExecution{StepName: step.Name, StepType: step.Type}
+	e.recordRetryHint(stepExecution, hint)
+	assert.Equal(t, map[string]interface{}{"source": RetryHintExecutor, "delay": 30.0}, stepExecution.Metadata["retry_hint"])
+	assert.Equal(t, started.Add(30*time.Second), breakers["quota"])
+
+	delay, err := hintedRetryDelay(context.Background(), time.Second, 0, err)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, delay)
+}
+
+func TestRetriesShareExecutionTimeout(t *testing.T) {
+	e := NewEngine(10, nopMetrics{}, logrus.New())
+	charge := &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errors.New("connection reset")
+	}}
+	e.RegisterStepExecutor("charge", charge)
+	definition := &models.WorkflowDefinition{}
+	definition.Spec.Steps = []models.WorkflowStep{{
+		Name: "charge",
+		Type: "charge",
+		ErrorHandling: &models.ErrorHandling{
+			RetryPolicy: &models.RetryPolicy{MaxRetries: 3, InitialDelay: 1, BackoffMultiplier: 2},
+		},
+	}}
+
+	// The first retry is due in a second, past the 300ms timeout of the
+	// execution
+	execContext := newLoggingExecution(logrus.New())
+	execContext.Context, execContext.Cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer execContext.Cancel()
+
+	started := time.Now()
+	e.runSteps(execContext, definition)
+
+	// The retry is cut off rather than waited for
+	assert.Less(t, time.Since(started), 300*time.Millisecond)
+	assert.Equal(t, 1, charge.calls)
+	assert.Equal(t, 1, execContext.RetryCount)
+
+	// and fails the execution with a distinct code
+	execution := execContext.Execution
+	assert.Equal(t, models.ExecutionStatusFailed, execution.Status)
+	assert.Equal(t, ErrorCodeRetryBudgetExhausted, execution.ErrorCode)
+	assert.Contains(t, execution.Error, "step charge failed: connection reset: retry 1 due in 1s")
+
+	// Executions without a timeout retry as long as their policy allows
+	assert.NoError(t, retryBudget(context.Background(), 3, time.Hour, errors.New("connection reset")))
+}
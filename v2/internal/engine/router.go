@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// DefaultRoute is the route key of the executor used for workflows whose
+// tags match no other route
+const DefaultRoute = "*"
+
+// WorkflowExecutor runs workflows. It is implemented by Engine and can be
+// implemented by clients of engines running in other processes or regions.
+type WorkflowExecutor interface {
+	ExecuteWorkflow(ctx context.Context, workflow *models.Workflow, input map[string]interface{}, config map[string]interface{}) (*models.Execution, error)
+	CancelExecution(executionID uuid.UUID) error
+}
+
+// WorkflowTagRouter routes workflow executions to executors based on the
+// workflow's tags
+type WorkflowTagRouter struct {
+	mu     sync.RWMutex
+	routes map[string]WorkflowExecutor
+}
+
+// NewTagRouter creates a router from a map of tag to engine. The engine
+// under DefaultRoute, if any, runs workflows whose tags match no route.
+func NewTagRouter(routes map[string]*Engine) *WorkflowTagRouter {
+	router := &WorkflowTagRouter{routes: make(map[string]WorkflowExecutor, len(routes))}
+	for tag, engine := range routes {
+		if engine != nil {
+			router.routes[tag] = engine
+		}
+	}
+	return router
+}
+
+// SetRoute routes workflows tagged with tag to an executor, replacing any
+// existing route for the tag. Use DefaultRoute to set the default executor.
+func (r *WorkflowTagRouter) SetRoute(tag string, executor WorkflowExecutor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.routes[tag] = executor
+}
+
+// Route returns the executor for a workflow. Tags are checked in the order
+// they are listed on the workflow and the first one with a route wins.
+func (r *WorkflowTagRouter) Route(workflow *models.Workflow) (WorkflowExecutor, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, tag := range workflow.Tags {
+		if tag == DefaultRoute {
+			continue
+		}
+		if executor, exists := r.routes[tag]; exists {
+			return executor, nil
+		}
+	}
+
+	if executor, exists := r.routes[DefaultRoute]; exists {
+		return executor, nil
+	}
+	return nil, fmt.Errorf("no route for workflow %s with tags %v", workflow.Name, workflow.Tags)
+}
+
+// ExecuteWorkflow forwards the execution to the executor routed for the
+// workflow and returns its result
+func (r *WorkflowTagRouter) ExecuteWorkflow(ctx context.Context, workflow *models.Workflow, input map[string]interface{}, config map[string]interface{}) (*models.Execution, error) {
+	executor, err := r.Route(workflow)
+	if err != nil {
+		return nil, err
+	}
+	return executor.ExecuteWorkflow(ctx, workflow, input, config)
+}
+
+// CancelExecution cancels an execution on whichever executor runs it
+func (r *WorkflowTagRouter) CancelExecution(executionID uuid.UUID) error {
+	r.mu.RLock()
+	executors := make([]WorkflowExecutor, 0, len(r.routes))
+	for _, executor := range r.routes {
+		executors = append(executors, executor)
+	}
+	r.mu.RUnlock()
+
+	for _, executor := range executors {
+		if err := executor.CancelExecution(executionID); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("execution not found: %s", executionID)
+}
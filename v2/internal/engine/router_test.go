@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// stubExecutor runs no workflow, recording the executions routed to it and
+// cancelling only the executions it owns
+type stubExecutor struct {
+	executed   []string
+	owned      map[uuid.UUID]bool
+	cancelled  []uuid.UUID
+	cancelCall int
+}
+
+func newStubExecutor() *stubExecutor {
+	return &stubExecutor{owned: make(map[uuid.UUID]bool)}
+}
+
+func (s *stubExecutor) ExecuteWorkflow(ctx context.Context, workflow *models.Workflow, input map[string]interface{}, config map[string]interface{}) (*models.Execution, error) {
+	s.executed = append(s.executed, workflow.Name)
+	execution := &models.Execution{ID: uuid.New(), WorkflowID: workflow.ID}
+	s.owned[execution.ID] = true
+	return execution, nil
+}
+
+func (s *stubExecutor) CancelExecution(executionID uuid.UUID) error {
+	s.cancelCall++
+	if !s.owned[executionID] {
+		return errors.New("execution not found")
+	}
+	s.cancelled = append(s.cancelled, executionID)
+	return nil
+}
+
+func TestTagRouterRoute(t *testing.T) {
+	gpu, eu, fallback := newStubExecutor(), newStubExecutor(), newStubExecutor()
+
+	tests := map[string]struct {
+		tags        []string
+		withDefault bool
+		executor    *stubExecutor
+		err         string
+	}{
+		"first matching tag wins":       {tags: []string{"batch", "eu", "gpu"}, withDefault: true, executor: eu},
+		"order of the workflow tags":    {tags: []string{"gpu", "eu"}, withDefault: true, executor: gpu},
+		"default route without a match": {tags: []string{"batch"}, withDefault: true, executor: fallback},
+		"default route without tags":    {withDefault: true, executor: fallback},
+		"default tag is not a route":    {tags: []string{DefaultRoute}, err: "no route for workflow orders"},
+		"no route without a default":    {tags: []string{"batch"}, err: "no route for workflow orders with tags [batch]"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			router := NewTagRouter(nil)
+			router.SetRoute("gpu", gpu)
+			router.SetRoute("eu", eu)
+			if tt.withDefault {
+				router.SetRoute(DefaultRoute, fallback)
+			}
+
+			executor, err := router.Route(&models.Workflow{Name: "orders", Tags: tt.tags})
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Same(t, tt.executor, executor)
+		})
+	}
+}
+
+func TestTagRouterExecution(t *testing.T) {
+	gpu, fallback := newStubExecutor(), newStubExecutor()
+	router := NewTagRouter(nil)
+	router.SetRoute("gpu", gpu)
+	router.SetRoute(DefaultRoute, fallback)
+
+	training, err := router.ExecuteWorkflow(context.Background(), &models.Workflow{Name: "training", Tags: []string{"gpu"}}, nil, nil)
+	require.NoError(t, err)
+	_, err = router.ExecuteWorkflow(context.Background(), &models.Workflow{Name: "report"}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"training"}, gpu.executed)
+	assert.Equal(t, []string{"report"}, fallback.executed)
+
+	// Cancellations are fanned out until the executor running the
+	// execution accepts it
+	require.NoError(t, router.CancelExecution(training.ID))
+	assert.Equal(t, []uuid.UUID{training.ID}, gpu.cancelled)
+	assert.Empty(t, fallback.cancelled)
+
+	fanned := gpu.cancelCall + fallback.cancelCall
+	err = router.CancelExecution(uuid.New())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "execution not found")
+	assert.Equal(t, fanned+2, gpu.cancelCall+fallback.cancelCall, "every executor is asked about unknown executions")
+
+	// Executions are not routed without a route
+	_, err = NewTagRouter(nil).ExecuteWorkflow(context.Background(), &models.Workflow{Name: "orders"}, nil, nil)
+	assert.Error(t, err)
+}
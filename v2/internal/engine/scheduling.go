@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/pkg/models"
+)
+
+// SetMaxConcurrentSteps sets how many steps run at once on the engine,
+// across every execution: the parallel steps of all executions draw from
+// one pool of max slots, and ready steps wait for a free slot, by priority
+// within an execution, without a goroutine of their own. Zero, the default,
+// runs every ready step at once. Executions already running keep the pool
+// they started with.
+func (e *Engine) SetMaxConcurrentSteps(max int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if max <= 0 {
+		e.stepPool = nil
+		return
+	}
+	e.stepPool = dataflow.NewPool(max)
+}
+
+// currentStepPool returns the pool the steps of new executions draw from
+func (e *Engine) currentStepPool() *dataflow.Pool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.stepPool
+}
+
+// stepRunner returns the function running the steps of an execution for the
+// dataflow scheduler. Steps continuing on error, or retried, never fail the
+// run, unless they exceed the variable budget. Steps skipped by their when
+// guard are reported as skipped.
+func (e *Engine) stepRunner(execContext *ExecutionContext, workflowDef *models.WorkflowDefinition) dataflow.ExecuteFunc {
+	steps := make(map[string]*models.WorkflowStep, len(workflowDef.Spec.Steps))
+	for i := range workflowDef.Spec.Steps {
+		steps[workflowDef.Spec.Steps[i].Name] = &workflowDef.Spec.Steps[i]
+	}
+
+	return func(ctx context.Context, name string) error {
+		step := steps[name]
+		err := e.executeStepIn(ctx, execContext, step)
+		if err == nil || errors.Is(err, dataflow.ErrSkipped) || errors.Is(err, ErrVariableBudgetExceeded) {
+			return err
+		}
+
+		if step.ErrorHandling != nil && step.ErrorHandling.ContinueOnError {
+			execContext.stepLogger(step).WithField("error", err.Error()).Warn("Step failed but continuing execution")
+			return nil
+		}
+
+		// Handle retries
+		if step.ErrorHandling != nil && step.ErrorHandling.RetryPolicy != nil {
+			if e.shouldRetry(execContext, step, err) {
+				return e.retryStep(ctx, execContext, step, err)
+			}
+		}
+		return err
+	}
+}
+
+// respondExecution sets the output of an execution once its critical path
+// completed, so callers waiting on it are answered while background steps
+// keep running
+func (e *Engine) respondExecution(execContext *ExecutionContext, workflowDef *models.WorkflowDefinition, respondedAt time.Time) {
+	output := make(map[string]interface{})
+	if workflowDef.Output != nil {
+		output = e.evaluateDataMapping(execContext, workflowDef.Output)
+	} else {
+		execContext.mu.RLock()
+		for key, value := range execContext.Variables {
+			output[key] = value
+		}
+		execContext.mu.RUnlock()
+	}
+
+	execContext.mu.Lock()
+	execContext.Output = output
+	execContext.Execution.Output = output
+	execContext.Execution.RespondedAt = &respondedAt
+	execContext.mu.Unlock()
+
+	e.emitExecutionEvent(execContext, &WorkflowEvent{
+		Type:          "execution.responded",
+		ExecutionID:   execContext.Execution.ID,
+		WorkflowID:    execContext.Workflow.ID,
+		CorrelationID: execContext.Execution.CorrelationID,
+		Timestamp:     respondedAt,
+		Data: map[string]interface{}{
+			"output":       output,
+			"responded_at": respondedAt,
+		},
+	})
+}
+
+// responded reports whether the execution responded, for the steps
+// completing after it
+func (execContext *ExecutionContext) responded() bool {
+	execContext.mu.RLock()
+	defer execContext.mu.RUnlock()
+	return execContext.Execution.RespondedAt != nil
+}
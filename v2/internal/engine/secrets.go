@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"context"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/secrets"
+)
+
+// SetSecrets sets the provider of the secrets steps read with secret(). Until
+// set, secret() fails in every execution.
+func (e *Engine) SetSecrets(provider secrets.Provider) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.secrets = provider
+}
+
+// executionSecrets returns the secrets of a starting execution. Secrets are
+// read from the provider when a step first reads them, then kept for the
+// rest of the execution, so its steps and retries see the same values
+// without the secrets being recorded on the execution.
+func (e *Engine) executionSecrets(ctx context.Context) expressions.Secrets {
+	e.mu.RLock()
+	provider := e.secrets
+	e.mu.RUnlock()
+
+	if provider == nil {
+		return nil
+	}
+	return secrets.NewCache(context.WithoutCancel(ctx), provider)
+}
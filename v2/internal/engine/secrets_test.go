@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/secrets"
+)
+
+// countingSecrets holds fixed secrets and counts the reads of each
+type countingSecrets struct {
+	values map[string]string
+	reads  map[string]int
+}
+
+func (p *countingSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	p.reads[name]++
+	value, ok := p.values[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", secrets.ErrNotFound, name)
+	}
+	return value, nil
+}
+
+func TestExecutionSecrets(t *testing.T) {
+	e := NewEngine(10, nopMetrics{}, logrus.New())
+
+	// Without a provider secret() fails
+	ctx := expressions.WithEnv(context.Background(), &expressions.Env{Secrets: e.executionSecrets(context.Background())})
+	_, err := e.evaluateExpression(ctx, `secret("api_key")`, nil)
+	assert.ErrorContains(t, err, "no secret provider is configured")
+
+	provider := &countingSecrets{values: map[string]string{"api_key": "sk_live"}, reads: make(map[string]int)}
+	e.SetSecrets(provider)
+
+	// Each execution reads a secret once, however many steps read it
+	for run := 1; run <= 2; run++ {
+		ctx := expressions.WithEnv(context.Background(), &expressions.Env{Secrets: e.executionSecrets(context.Background())})
+		for i := 0; i < 3; i++ {
+			value, err := e.evaluateExpression(ctx, `secret("api_key")`, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "sk_live", value)
+		}
+		assert.Equal(t, run, provider.reads["api_key"])
+
+		_, err = e.evaluateExpression(ctx, `secret("missing")`, nil)
+		assert.ErrorIs(t, err, secrets.ErrNotFound)
+	}
+}
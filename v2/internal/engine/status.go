@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExecutionStatus is an immutable snapshot of the progress of a running
+// execution. Executions publish a new snapshot at every step boundary, so
+// status readers never read the live ExecutionContext, whose fields steps
+// mutate concurrently. Snapshots are shared between readers and must not be
+// modified. Variables and step results are not part of the snapshot; they
+// are inspected through the persisted execution state.
+type ExecutionStatus struct {
+	ExecutionID  uuid.UUID `json:"execution_id"`
+	WorkflowID   uuid.UUID `json:"workflow_id"`
+	WorkflowName string    `json:"workflow_name"`
+	CurrentStep  string    `json:"current_step,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	RetryCount   int       `json:"retry_count"`
+	// VariablesBytes is the size of the variables of the execution,
+	// encoded as JSON
+	VariablesBytes int64 `json:"variables_bytes"`
+	// LastEventSequence is the sequence number of the last event the
+	// execution emitted before the snapshot, so clients can tell which of
+	// the events they receive are newer than the snapshot
+	LastEventSequence uint64 `json:"last_event_sequence"`
+}
+
+// Status returns the latest status snapshot of the execution
+func (execContext *ExecutionContext) Status() *ExecutionStatus {
+	status, _ := execContext.status.Load().(*ExecutionStatus)
+	return status
+}
+
+// enterStep records the step the execution starts and publishes its status
+func (execContext *ExecutionContext) enterStep(stepID string) {
+	execContext.mu.Lock()
+	defer execContext.mu.Unlock()
+
+	execContext.CurrentStep = stepID
+	execContext.publishStatusLocked()
+}
+
+// publishStatusLocked swaps in a snapshot of the live status fields. Callers
+// hold execContext.mu, which serializes the snapshots of concurrent steps.
+// Publishing allocates the snapshot and nothing else.
+func (execContext *ExecutionContext) publishStatusLocked() {
+	execContext.status.Store(&ExecutionStatus{
+		ExecutionID:       execContext.Execution.ID,
+		WorkflowID:        execContext.Workflow.ID,
+		WorkflowName:      execContext.Workflow.Name,
+		CurrentStep:       execContext.CurrentStep,
+		StartedAt:         execContext.StartTime,
+		RetryCount:        execContext.RetryCount,
+		VariablesBytes:    execContext.variablesBytes,
+		LastEventSequence: execContext.sequence.Load(),
+	})
+}
+
+// emitExecutionEvent numbers an event of an execution with the next
+// sequence number of the execution and emits it. Lightweight executions only
+// emit the events starting and ending them, their step events are
+// synthesized from their step executions when queried.
+func (e *Engine) emitExecutionEvent(execContext *ExecutionContext, event *WorkflowEvent) {
+	if execContext.lightweight && !lightweightEvents[event.Type] {
+		return
+	}
+	event.Sequence = execContext.sequence.Add(1)
+	e.emitEvent(event)
+}
+
+// GetExecutionStatus returns the latest status snapshot of a running
+// execution
+func (e *Engine) GetExecutionStatus(executionID uuid.UUID) (*ExecutionStatus, error) {
+	e.mu.RLock()
+	execContext, exists := e.executions[executionID]
+	e.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("execution not found: %s", executionID)
+	}
+	return execContext.Status(), nil
+}
+
+// ListExecutions lists the status snapshots of the running executions
+func (e *Engine) ListExecutions() []*ExecutionStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	statuses := make([]*ExecutionStatus, 0, len(e.executions))
+	for _, execContext := range e.executions {
+		statuses = append(statuses, execContext.Status())
+	}
+	return statuses
+}
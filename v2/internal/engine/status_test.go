@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func newStatusTestEngine() *Engine {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewEngine(1000, nil, logger)
+}
+
+// startTestExecution registers a running execution the way ExecuteWorkflow
+// does, without running its steps
+func startTestExecution(e *Engine, name string) *ExecutionContext {
+	execContext := &ExecutionContext{
+		Execution: &models.Execution{ID: uuid.New()},
+		Workflow:  &models.Workflow{ID: uuid.New(), Name: name},
+		Variables: make(map[string]interface{}),
+		StartTime: time.Now(),
+	}
+	execContext.publishStatusLocked()
+
+	e.mu.Lock()
+	e.executions[execContext.Execution.ID] = execContext
+	e.mu.Unlock()
+	return execContext
+}
+
+func TestExecutionStatus(t *testing.T) {
+	e := newStatusTestEngine()
+	execContext := startTestExecution(e, "orders")
+
+	initial, err := e.GetExecutionStatus(execContext.Execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, execContext.Execution.ID, initial.ExecutionID)
+	assert.Equal(t, execContext.Workflow.ID, initial.WorkflowID)
+	assert.Equal(t, "orders", initial.WorkflowName)
+	assert.Empty(t, initial.CurrentStep)
+	assert.Equal(t, execContext.StartTime, initial.StartedAt)
+
+	e.emitExecutionEvent(execContext, &WorkflowEvent{Type: "execution.started"})
+	event := &WorkflowEvent{Type: "step.started"}
+	e.emitExecutionEvent(execContext, event)
+	assert.Equal(t, uint64(2), event.Sequence)
+
+	execContext.mu.Lock()
+	execContext.RetryCount = 1
+	execContext.Variables["total"] = 42
+	execContext.mu.Unlock()
+
+	// Live fields are only published at step boundaries
+	status, err := e.GetExecutionStatus(execContext.Execution.ID)
+	require.NoError(t, err)
+	assert.Same(t, initial, status)
+
+	execContext.enterStep("charge")
+	status, err = e.GetExecutionStatus(execContext.Execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "charge", status.CurrentStep)
+	assert.Equal(t, 1, status.RetryCount)
+	assert.Equal(t, uint64(2), status.LastEventSequence)
+
+	// Earlier snapshots are never modified
+	assert.Empty(t, initial.CurrentStep)
+	assert.Zero(t, initial.RetryCount)
+	assert.Zero(t, initial.LastEventSequence)
+
+	assert.Equal(t, []*ExecutionStatus{status}, e.ListExecutions())
+
+	_, err = e.GetExecutionStatus(uuid.New())
+	assert.Error(t, err)
+}
+
+// TestListExecutionsUnderChurn runs hundreds of executions mutating their
+// contexts while readers list their statuses. Run it with -race.
+func TestListExecutionsUnderChurn(t *testing.T) {
+	const executions = 300
+	const steps = 50
+
+	e := newStatusTestEngine()
+
+	var writers sync.WaitGroup
+	for i := 0; i < executions; i++ {
+		execContext := startTestExecution(e, "churn")
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for step := 0; step < steps; step++ {
+				e.emitExecutionEvent(execContext, &WorkflowEvent{Type: "step.started"})
+
+				execContext.mu.Lock()
+				execContext.RetryCount = step
+				execContext.Variables["step"] = step
+				execContext.StepResults = map[string]interface{}{"step": step}
+				execContext.mu.Unlock()
+
+				execContext.enterStep("step-" + strconv.Itoa(step))
+			}
+
+			e.mu.Lock()
+			delete(e.executions, execContext.Execution.ID)
+			e.mu.Unlock()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		writers.Wait()
+		close(done)
+	}()
+
+	// Every snapshot is consistent: the step, retry count and event
+	// sequence published together belong to the same step
+	check := func(status *ExecutionStatus) bool {
+		if status.CurrentStep == "" {
+			return status.RetryCount == 0 && status.LastEventSequence == 0
+		}
+		return status.CurrentStep == "step-"+strconv.Itoa(status.RetryCount) &&
+			status.LastEventSequence == uint64(status.RetryCount)+1
+	}
+
+	var readers sync.WaitGroup
+	errs := make(chan *ExecutionStatus, 4)
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, status := range e.ListExecutions() {
+					if !check(status) {
+						errs <- status
+						return
+					}
+					if _, err := e.GetExecutionStatus(status.ExecutionID); err != nil {
+						// The execution ended since it was listed
+						continue
+					}
+				}
+			}
+		}()
+	}
+	readers.Wait()
+	close(errs)
+
+	for status := range errs {
+		t.Errorf("inconsistent status snapshot: %+v", status)
+	}
+	assert.Empty(t, e.ListExecutions())
+}
+
+func TestEnterStepAllocations(t *testing.T) {
+	e := newStatusTestEngine()
+	execContext := startTestExecution(e, "orders")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		execContext.enterStep("charge")
+	})
+	assert.Equal(t, float64(1), allocs)
+}
+
+func BenchmarkEnterStep(b *testing.B) {
+	e := newStatusTestEngine()
+	execContext := startTestExecution(e, "orders")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		execContext.enterStep("charge")
+	}
+}
+
+func BenchmarkListExecutions(b *testing.B) {
+	e := newStatusTestEngine()
+	for i := 0; i < 100; i++ {
+		startTestExecution(e, "orders")
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.ListExecutions()
+	}
+}
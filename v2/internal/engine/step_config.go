@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+// ConfigSchemaProvider is implemented by step executors that declare the
+// schema of their step config. The schema is used to validate configs when a
+// workflow version is created and to decode them into a typed struct.
+type ConfigSchemaProvider interface {
+	ConfigSchema() *stepconfig.Schema
+}
+
+type stepConfigKey struct{}
+
+// WithStepConfig returns a context carrying the typed config of a step
+func WithStepConfig(ctx context.Context, config interface{}) context.Context {
+	return context.WithValue(ctx, stepConfigKey{}, config)
+}
+
+// StepConfigFromContext returns the typed config the engine decoded for the
+// executing step
+func StepConfigFromContext(ctx context.Context) (interface{}, bool) {
+	config := ctx.Value(stepConfigKey{})
+	return config, config != nil
+}
+
+// ConfigSchemas returns the config schemas of the registered executors
+func (e *Engine) ConfigSchemas() *stepconfig.Registry {
+	return e.configSchemas
+}
+
+// decodeStepConfig returns the typed config of a step, decoding it once per
+// workflow version. Steps whose executor has no schema have no typed config.
+func (e *Engine) decodeStepConfig(execContext *ExecutionContext, step *models.WorkflowStep) (interface{}, error) {
+	schema, exists := e.configSchemas.Get(step.Type)
+	if !exists {
+		return nil, nil
+	}
+
+	key := stepconfig.CacheKey(execContext.Workflow.ID.String(), execContext.Workflow.Version, step.ID)
+	return e.configCache.Decode(key, schema, stepconfig.Section(step.Type, step.Config))
+}
+
+// typedStepConfig returns the typed config of a step, preferring the one the
+// engine decoded over decoding the raw config again
+func typedStepConfig(ctx context.Context, schema *stepconfig.Schema, stepType string, step *models.WorkflowStep) (interface{}, error) {
+	if config, ok := StepConfigFromContext(ctx); ok {
+		return config, nil
+	}
+	return schema.Decode(stepconfig.Section(stepType, step.Config))
+}
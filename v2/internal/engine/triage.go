@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"magic-flow/v2/internal/triage"
+	"magic-flow/v2/pkg/models"
+)
+
+// FailureClassifier assigns triage classes to failed executions, such as
+// triage.Classifier
+type FailureClassifier interface {
+	Classify(ctx context.Context, failure *triage.Failure) (*models.Triage, error)
+}
+
+// HTTPStatusError is returned by step executors calling a service that
+// answered with an error status, so the status can be classified
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// SetClassifier sets the classifier of failed executions. Failures are not
+// classified until set.
+func (e *Engine) SetClassifier(classifier FailureClassifier) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.classifier = classifier
+}
+
+// recordFailedStep records the step whose failure fails the execution
+func (execContext *ExecutionContext) recordFailedStep(step *models.StepExecution) {
+	execContext.mu.Lock()
+	defer execContext.mu.Unlock()
+	execContext.failedStep = step
+}
+
+// classifyFailure classifies a failed execution. Classification only
+// serves on-call, so failures to classify are logged and the execution
+// stays unclassified.
+func (e *Engine) classifyFailure(execContext *ExecutionContext) {
+	e.mu.RLock()
+	classifier := e.classifier
+	e.mu.RUnlock()
+	if classifier == nil {
+		return
+	}
+
+	execContext.mu.RLock()
+	step := execContext.failedStep
+	execContext.mu.RUnlock()
+
+	// The execution context may be cancelled by now, the classifier bounds
+	// its own evaluation
+	classification, err := classifier.Classify(context.Background(), &triage.Failure{
+		Execution: execContext.Execution,
+		Workflow:  execContext.Workflow,
+		Step:      step,
+	})
+	if err != nil {
+		execContext.Logger.WithError(err).Warn("Failed to classify execution failure")
+		return
+	}
+	execContext.Execution.Triage = classification
+	execContext.Execution.TriageClass = classification.Class
+}
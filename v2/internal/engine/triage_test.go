@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/triage"
+	"magic-flow/v2/pkg/models"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	failExecution := func(e *Engine) *ExecutionContext {
+		execContext := startTestExecution(e, "orders")
+		execContext.Logger = logrus.NewEntry(e.logger)
+		execContext.Execution.Status = models.ExecutionStatusFailed
+		execContext.recordFailedStep(&models.StepExecution{
+			StepName:   "charge",
+			StepType:   "http",
+			Status:     models.StepStatusFailed,
+			OutputData: map[string]interface{}{"status_code": 503},
+		})
+		return execContext
+	}
+
+	t.Run("classifies the failed step", func(t *testing.T) {
+		e := newStatusTestEngine()
+		classifier := triage.NewClassifier(triage.DefaultConfig(), triage.Sources{})
+		e.SetClassifier(classifier)
+
+		execContext := failExecution(e)
+		e.classifyFailure(execContext)
+		require.NotNil(t, execContext.Execution.Triage)
+		assert.Equal(t, triage.ClassDownstream5xx, execContext.Execution.Triage.Class)
+		assert.Equal(t, triage.ClassDownstream5xx, execContext.Execution.TriageClass)
+	})
+
+	t.Run("leaves failures unclassified without a classifier or on errors", func(t *testing.T) {
+		e := newStatusTestEngine()
+		execContext := failExecution(e)
+		e.classifyFailure(execContext)
+		assert.Nil(t, execContext.Execution.Triage)
+
+		e.SetClassifier(failingClassifier{})
+		e.classifyFailure(execContext)
+		assert.Nil(t, execContext.Execution.Triage)
+		assert.Empty(t, execContext.Execution.TriageClass)
+	})
+}
+
+type failingClassifier struct{}
+
+func (failingClassifier) Classify(ctx context.Context, failure *triage.Failure) (*models.Triage, error) {
+	return nil, errors.New("workflow not found")
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrVariableBudgetExceeded is returned when the variables of an execution
+// grow over the variable budget of the engine. It fails the execution, even
+// from steps continuing on error or retried.
+var ErrVariableBudgetExceeded = errors.New("execution variables exceed their size budget")
+
+// SetMaxVariableBytes sets the budget of the size of the variables of each
+// execution, encoded as JSON, checked as the input initializes them and
+// each time the output of a step is merged into them. Executions going over
+// it fail with ErrVariableBudgetExceeded rather than holding ever more
+// memory. Zero, the default, sets no budget.
+func (e *Engine) SetMaxVariableBytes(max int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.maxVariableBytes = max
+}
+
+// variableBudget returns the budget of the variables of each execution,
+// zero for none
+func (e *Engine) variableBudget() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.maxVariableBytes
+}
+
+// setVariableLocked sets a variable, keeping the size of the variables up
+// to date without encoding them all again. Callers hold execContext.mu.
+func (execContext *ExecutionContext) setVariableLocked(key string, value interface{}) {
+	if execContext.variableSizes == nil {
+		execContext.variableSizes = make(map[string]int64)
+	}
+	size := variableSize(key, value)
+	execContext.variablesBytes += size - execContext.variableSizes[key]
+	execContext.variableSizes[key] = size
+	execContext.Variables[key] = value
+}
+
+// VariablesBytes returns the size of the variables of the execution,
+// encoded as JSON
+func (execContext *ExecutionContext) VariablesBytes() int64 {
+	execContext.mu.RLock()
+	defer execContext.mu.RUnlock()
+	return execContext.variablesBytes
+}
+
+// variableSize returns the size of a variable as a member of a JSON object,
+// its separators included. Values that cannot be encoded count as their
+// printed form.
+func variableSize(key string, value interface{}) int64 {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return int64(len(key) + len(fmt.Sprintf("%v", value)) + 4)
+	}
+	return int64(len(key) + len(data) + 4)
+}
+
+// checkVariableBudgetLocked publishes the size of the variables of an
+// execution, in its status and the workflow_execution_variables_bytes
+// metric, and returns ErrVariableBudgetExceeded when they exceed budget.
+// step is the step whose output was merged, nil for the input. Callers hold
+// execContext.mu.
+func (e *Engine) checkVariableBudgetLocked(execContext *ExecutionContext, step *models.WorkflowStep, budget int64) error {
+	size := execContext.variablesBytes
+	execContext.publishStatusLocked()
+	e.metrics.RecordMetric("workflow_execution_variables_bytes", float64(size), map[string]string{
+		"workflow_id": execContext.Workflow.ID.String(),
+	})
+	if budget <= 0 || size <= budget {
+		return nil
+	}
+	if step == nil {
+		return fmt.Errorf("%w: the input holds %d bytes, over the budget of %d", ErrVariableBudgetExceeded, size, budget)
+	}
+	return fmt.Errorf("%w: the output of step %s took them to %d bytes, over the budget of %d", ErrVariableBudgetExceeded, step.Name, size, budget)
+}
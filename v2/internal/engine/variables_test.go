@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// gaugeMetrics keeps the last value of each metric
+type gaugeMetrics struct {
+	nopMetrics
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (m *gaugeMetrics) RecordMetric(name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.values == nil {
+		m.values = make(map[string]float64)
+	}
+	m.values[name] = value
+}
+
+func (m *gaugeMetrics) value(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[name]
+}
+
+func TestVariableBudget(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	metrics := &gaugeMetrics{}
+	e := NewEngine(10, metrics, logger)
+	e.SetMaxVariableBytes(1024)
+	store := &recordingStepStore{}
+	e.SetStepStore(store)
+
+	size := 100
+	producer := &funcExecutor{execute: func(input map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"payload": strings.Repeat("x", size)}, nil
+	}}
+	e.RegisterStepExecutor("func", producer)
+	execContext := newLoggingExecution(logger)
+	step := &models.WorkflowStep{Name: "produce", Type: "func"}
+
+	// Outputs within the budget are merged, and their size published
+	require.NoError(t, e.executeStep(execContext, step))
+	want := int64(len("payload") + size + 2 + 4)
+	assert.Equal(t, want, execContext.VariablesBytes())
+	assert.Equal(t, want, execContext.Status().VariablesBytes)
+	assert.Equal(t, float64(want), metrics.value("workflow_execution_variables_bytes"))
+
+	// Replacing a variable counts its new size only
+	require.NoError(t, e.executeStep(execContext, step))
+	assert.Equal(t, want, execContext.VariablesBytes())
+
+	// An oversized output fails the step
+	size = 2048
+	err := e.executeStep(execContext, step)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrVariableBudgetExceeded), "err = %v", err)
+	assert.Contains(t, err.Error(), "step produce")
+	require.Len(t, store.steps, 3)
+	assert.Equal(t, models.StepStatusFailed, store.steps[2].Status)
+	assert.Equal(t, err.Error(), store.steps[2].Error)
+	assert.Greater(t, execContext.VariablesBytes(), int64(1024))
+	assert.Equal(t, float64(execContext.VariablesBytes()), metrics.value("workflow_execution_variables_bytes"))
+
+	// Without a budget, variables grow unbounded
+	e.SetMaxVariableBytes(0)
+	require.NoError(t, e.executeStep(execContext, step))
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/warmup"
+	"magic-flow/v2/pkg/models"
+)
+
+// Warmer is implemented by step executors that can prepare for the steps of
+// a workflow version ahead of its executions, such as by opening
+// connections to the hosts of its http steps. Warm-up runs in the
+// background: errors only mean some steps will start cold.
+type Warmer interface {
+	Warm(ctx context.Context, hints *warmup.Hints) error
+}
+
+// SetWarmup sets the warm-up config of the engine. Warm-up is enabled with
+// the default config until set.
+func (e *Engine) SetWarmup(config warmup.Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.warmupConfig = config
+}
+
+// WarmVersion warms the executors of the steps of a version being
+// activated. It returns at once, each executor warming up in the
+// background within the warm-up timeout.
+func (e *Engine) WarmVersion(version *models.WorkflowVersion) {
+	e.mu.RLock()
+	config := e.warmupConfig
+	warmers := make(map[string]Warmer)
+	for stepType, executor := range e.stepExecutors {
+		if warmer, ok := executor.(Warmer); ok {
+			warmers[stepType] = warmer
+		}
+	}
+	e.mu.RUnlock()
+
+	if !config.Enabled || len(warmers) == 0 {
+		return
+	}
+	hints := warmup.HintsFromDefinition(&version.Definition)
+	if hints.Empty() {
+		return
+	}
+
+	logger := e.logger.WithFields(logrus.Fields{
+		"workflow_id": version.WorkflowID,
+		"version":     version.Version,
+	})
+	for stepType, warmer := range warmers {
+		go func(stepType string, warmer Warmer) {
+			ctx := context.Background()
+			if config.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+				defer cancel()
+			}
+
+			if err := warmer.Warm(ctx, hints); err != nil {
+				logger.WithField("step_type", stepType).WithError(err).Debug("Executor warm-up incomplete, steps may start cold")
+			}
+		}(stepType, warmer)
+	}
+}
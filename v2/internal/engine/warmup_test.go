@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"magic-flow/v2/internal/warmup"
+	"magic-flow/v2/pkg/models"
+)
+
+// warmingExecutor blocks its warm-up until released or timed out
+type warmingExecutor struct {
+	stepType string
+	hints    chan *warmup.Hints
+	results  chan error
+	release  chan struct{}
+}
+
+func newWarmingExecutor(stepType string) *warmingExecutor {
+	return &warmingExecutor{
+		stepType: stepType,
+		hints:    make(chan *warmup.Hints, 1),
+		results:  make(chan error, 1),
+		release:  make(chan struct{}),
+	}
+}
+
+func (e *warmingExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (e *warmingExecutor) Validate(step *models.WorkflowStep) error {
+	return nil
+}
+
+func (e *warmingExecutor) GetType() string {
+	return e.stepType
+}
+
+func (e *warmingExecutor) Warm(ctx context.Context, hints *warmup.Hints) error {
+	e.hints <- hints
+	var err error
+	select {
+	case <-e.release:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	e.results <- err
+	return err
+}
+
+func TestWarmVersion(t *testing.T) {
+	version := &models.WorkflowVersion{
+		WorkflowID: uuid.New(),
+		Version:    "1.1.0",
+		Definition: models.WorkflowDefinition{
+			Spec: models.WorkflowSpec{
+				Steps: []models.WorkflowStep{
+					{Name: "fetch", Type: "http", Config: map[string]interface{}{"url": "https://orders.internal/orders"}},
+				},
+			},
+		},
+	}
+
+	t.Run("warms executors in the background", func(t *testing.T) {
+		e := newStatusTestEngine()
+		executor := newWarmingExecutor("http")
+		defer close(executor.release)
+		e.RegisterStepExecutor("http", executor)
+
+		done := make(chan struct{})
+		go func() {
+			e.WarmVersion(version)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("WarmVersion waited on the warm-up")
+		}
+
+		select {
+		case hints := <-executor.hints:
+			assert.Equal(t, []string{"https://orders.internal:443"}, hints.Hosts)
+		case <-time.After(time.Second):
+			t.Fatal("executor was not warmed up")
+		}
+	})
+
+	t.Run("times warm-up out", func(t *testing.T) {
+		e := newStatusTestEngine()
+		config := warmup.DefaultConfig()
+		config.Timeout = 10 * time.Millisecond
+		e.SetWarmup(config)
+		executor := newWarmingExecutor("http")
+		e.RegisterStepExecutor("http", executor)
+
+		e.WarmVersion(version)
+		select {
+		case err := <-executor.results:
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		case <-time.After(time.Second):
+			t.Fatal("warm-up did not time out")
+		}
+	})
+
+	t.Run("skips warm-up when disabled", func(t *testing.T) {
+		e := newStatusTestEngine()
+		e.SetWarmup(warmup.Config{})
+		executor := newWarmingExecutor("http")
+		e.RegisterStepExecutor("http", executor)
+
+		e.WarmVersion(version)
+		select {
+		case <-executor.hints:
+			t.Fatal("disabled warm-up warmed an executor")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
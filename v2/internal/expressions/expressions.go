@@ -0,0 +1,575 @@
+// Package expressions is the expression language shared by admission policy
+// rules, failure triage rules, step input mappings, condition steps and
+// notification templates.
+// Expressions read the document they are evaluated against through paths
+// such as input.amount or workflow.labels.team, and combine them with:
+//
+//	literals     "text", 42, 1.5, true, false, null, ["a", "b"]
+//	comparisons  == != < <= > >=
+//	membership   x in list, key in object, text in text
+//	logic        && (and), || (or), ! (not), parentheses
+//	functions    len, lower, upper, trim, concat, starts_with, ends_with,
+//	             contains, matches, url_scheme, url_host, uuid,
+//	             round, floor, min, max,
+//	             now, addDuration, addBusinessDays, startOf, inZone,
+//	             format, parseTime, flag, secret
+//	quantifiers  any(list, item, condition), all(list, item, condition)
+//
+// Missing paths evaluate to null, so conditions on absent fields do not
+// fire. Comparing values of different types is an evaluation error. Numbers
+// are float64; times are time.Time values, produced by the time functions
+// and ordered by the comparisons. flag("name") reads a feature flag of the
+// execution, false when the execution did not evaluate it; flag names are
+// string literals. secret("name") reads a secret of the server secret
+// provider, and fails without one; secret names are string literals too, so
+// that inputs cannot choose the secrets a step reads.
+package expressions
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"magic-flow/v2/internal/scheduler"
+)
+
+// Calendars resolves the business calendars named in addBusinessDays. The
+// scheduler service implements it.
+type Calendars interface {
+	GetCalendar(name string) (*scheduler.Calendar, error)
+}
+
+// Env is what functions read besides their arguments
+type Env struct {
+	// Now is the time now() returns. Executions use their logical clock, so
+	// retries and replays of a step evaluate the same time.
+	Now time.Time
+	// Calendars resolves calendar names. Without it addBusinessDays only
+	// skips weekends and fails for named calendars.
+	Calendars Calendars
+	// Flags are the feature flags flag() reads, evaluated once when the
+	// execution starts so every step and replay sees the same values
+	Flags map[string]bool
+	// Secrets resolves the secrets secret() reads. Without it secret()
+	// fails.
+	Secrets Secrets
+}
+
+// Secrets resolves secrets by name. secrets.Cache implements it.
+type Secrets interface {
+	Secret(name string) (string, error)
+}
+
+type envKey struct{}
+
+// WithEnv returns a context carrying an evaluation environment, which step
+// executors read through EnvFromContext
+func WithEnv(ctx context.Context, env *Env) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// EnvFromContext returns the evaluation environment of a context, or nil
+func EnvFromContext(ctx context.Context) *Env {
+	env, _ := ctx.Value(envKey{}).(*Env)
+	return env
+}
+
+// Expression is a compiled expression. It is safe for concurrent use.
+type Expression struct {
+	source string
+	root   node
+	vars   []string
+	flags  []string
+}
+
+// Parse compiles an expression. Unknown functions and calls with the wrong
+// number of arguments are parse errors.
+func Parse(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, seen: make(map[string]bool), bound: make(map[string]int)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", next.text, next.pos+1)
+	}
+
+	return &Expression{source: source, root: root, vars: p.vars, flags: p.flags}, nil
+}
+
+// String returns the source of the expression
+func (x *Expression) String() string {
+	return x.source
+}
+
+// Variables returns the top level document fields the expression reads, in
+// order of appearance
+func (x *Expression) Variables() []string {
+	return x.vars
+}
+
+// Flags returns the feature flags the expression reads with flag(), in
+// order of appearance
+func (x *Expression) Flags() []string {
+	return x.flags
+}
+
+// Eval evaluates the expression against a document. A nil env has no clock
+// and no calendars.
+func (x *Expression) Eval(ctx context.Context, env *Env, document map[string]interface{}) (interface{}, error) {
+	if env == nil {
+		env = &Env{}
+	}
+	e := &evaluator{ctx: ctx, env: env, document: document, items: make(map[string]interface{})}
+	value, err := x.root.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// EvalBool evaluates a condition, which must be a boolean
+func (x *Expression) EvalBool(ctx context.Context, env *Env, document map[string]interface{}) (bool, error) {
+	value, err := x.Eval(ctx, env, document)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition must be a boolean, got %s", typeOf(value))
+	}
+	return result, nil
+}
+
+// embedded matches a whole string holding one ${expression}
+var embedded = regexp.MustCompile(`^\s*\$\{(.*)\}\s*$`)
+
+// embeddedAll matches the ${expression} placeholders of a string
+var embeddedAll = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// Embedded returns the expression of a string that is a single
+// ${expression} placeholder, as used in step input mappings
+func Embedded(s string) (string, bool) {
+	match := embedded.FindStringSubmatch(s)
+	if match == nil || strings.Contains(match[1], "${") {
+		return "", false
+	}
+	return strings.TrimSpace(match[1]), true
+}
+
+// EmbeddedAll returns the expressions of the ${expression} placeholders of a
+// string
+func EmbeddedAll(s string) []string {
+	var sources []string
+	for _, match := range embeddedAll.FindAllStringSubmatch(s, -1) {
+		sources = append(sources, strings.TrimSpace(match[1]))
+	}
+	return sources
+}
+
+// node is a compiled expression node
+type node interface {
+	eval(e *evaluator) (interface{}, error)
+}
+
+// evaluator evaluates an expression against a document. It checks the
+// context between nodes, so evaluations stop at their timeout.
+type evaluator struct {
+	ctx      context.Context
+	env      *Env
+	document map[string]interface{}
+	// items holds the items quantifiers bind, which shadow the document
+	items map[string]interface{}
+	nodes int
+}
+
+// checkEvery is how many nodes are evaluated between context checks
+const checkEvery = 64
+
+func (e *evaluator) step() error {
+	e.nodes++
+	if e.nodes%checkEvery == 0 || e.nodes == 1 {
+		if err := e.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (l *literal) eval(e *evaluator) (interface{}, error) {
+	return l.value, e.step()
+}
+
+type listExpr struct {
+	items []node
+}
+
+func (l *listExpr) eval(e *evaluator) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(l.items))
+	for i, item := range l.items {
+		value, err := item.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// variable reads a top level field of the document, or a quantifier item
+type variable struct {
+	name string
+}
+
+func (v *variable) eval(e *evaluator) (interface{}, error) {
+	if item, bound := e.items[v.name]; bound {
+		return item, e.step()
+	}
+	return normalize(e.document[v.name]), e.step()
+}
+
+// field reads a field of an object, or an element of a list
+type field struct {
+	target node
+	key    node
+}
+
+func (f *field) eval(e *evaluator) (interface{}, error) {
+	target, err := f.target.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	key, err := f.key.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target := target.(type) {
+	case map[string]interface{}:
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("object keys must be strings, got %s", typeOf(key))
+		}
+		return normalize(target[name]), nil
+	case []interface{}:
+		index, ok := key.(float64)
+		if !ok || index != float64(int(index)) {
+			return nil, fmt.Errorf("list indexes must be integers, got %v", key)
+		}
+		if index < 0 || int(index) >= len(target) {
+			return nil, nil
+		}
+		return normalize(target[int(index)]), nil
+	default:
+		return nil, nil
+	}
+}
+
+type notExpr struct {
+	operand node
+}
+
+func (n *notExpr) eval(e *evaluator) (interface{}, error) {
+	value, err := n.operand.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! expects a boolean, got %s", typeOf(value))
+	}
+	return !b, nil
+}
+
+// logical is && or ||, short-circuiting on the left operand
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (l *logical) eval(e *evaluator) (interface{}, error) {
+	left, err := l.evalOperand(e, l.left)
+	if err != nil {
+		return nil, err
+	}
+	if left != l.and {
+		return left, nil
+	}
+	return l.evalOperand(e, l.right)
+}
+
+func (l *logical) evalOperand(e *evaluator, operand node) (bool, error) {
+	value, err := operand.eval(e)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		operator := "||"
+		if l.and {
+			operator = "&&"
+		}
+		return false, fmt.Errorf("%s expects booleans, got %s", operator, typeOf(value))
+	}
+	return b, nil
+}
+
+type comparison struct {
+	operator    string
+	left, right node
+}
+
+func (c *comparison) eval(e *evaluator) (interface{}, error) {
+	left, err := c.left.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.right.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.operator {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return contains(right, left)
+	}
+
+	// Ordering comparisons with a missing value do not hold
+	if left == nil || right == nil {
+		return false, nil
+	}
+	var order int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number with %s", typeOf(right))
+		}
+		order = compareFloats(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string with %s", typeOf(right))
+		}
+		order = strings.Compare(l, r)
+	case time.Time:
+		r, ok := right.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare time with %s", typeOf(right))
+		}
+		order = compareTimes(l, r)
+	default:
+		return nil, fmt.Errorf("cannot order %s values", typeOf(left))
+	}
+
+	switch c.operator {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+func compareFloats(l, r float64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareTimes(l, r time.Time) int {
+	switch {
+	case l.Before(r):
+		return -1
+	case l.After(r):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// quantifier is any or all over the elements of a list, each bound to the
+// item name while the condition is evaluated
+type quantifier struct {
+	all       bool
+	list      node
+	item      string
+	condition node
+}
+
+func (q *quantifier) eval(e *evaluator) (interface{}, error) {
+	value, err := q.list.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	switch value := value.(type) {
+	case nil:
+	case []interface{}:
+		items = value
+	default:
+		return nil, fmt.Errorf("any and all expect a list, got %s", typeOf(value))
+	}
+
+	outer, nested := e.items[q.item]
+	defer func() {
+		if nested {
+			e.items[q.item] = outer
+		} else {
+			delete(e.items, q.item)
+		}
+	}()
+
+	for _, item := range items {
+		e.items[q.item] = normalize(item)
+		value, err := q.condition.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		holds, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("any and all conditions must be booleans, got %s", typeOf(value))
+		}
+		if holds != q.all {
+			return holds, nil
+		}
+	}
+	return q.all, nil
+}
+
+type call struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (c *call) eval(e *evaluator) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(c.args))
+	for i, arg := range c.args {
+		value, err := arg.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	value, err := c.fn.call(e.env, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.name, err)
+	}
+	return value, nil
+}
+
+// contains reports whether a list holds a value, an object a key or a
+// string a substring
+func contains(collection, value interface{}) (interface{}, error) {
+	switch collection := collection.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, item := range collection {
+			if equal(normalize(item), value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := value.(string)
+		if !ok {
+			return false, nil
+		}
+		_, exists := collection[key]
+		return exists, nil
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot look for %s in a string", typeOf(value))
+		}
+		return strings.Contains(collection, s), nil
+	default:
+		return nil, fmt.Errorf("cannot look for a value in %s", typeOf(collection))
+	}
+}
+
+func equal(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// normalize converts the Go numbers of documents built in code, such as the
+// int variables of executions, to the float64 numbers of expressions
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	default:
+		return value
+	}
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case time.Time:
+		return "time"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,281 @@
+package expressions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/scheduler"
+)
+
+type testCalendars map[string]*scheduler.Calendar
+
+func (c testCalendars) GetCalendar(name string) (*scheduler.Calendar, error) {
+	calendar, exists := c[name]
+	if !exists {
+		return nil, fmt.Errorf("calendar not found: %s", name)
+	}
+	return calendar, nil
+}
+
+func newYork(t *testing.T) *time.Location {
+	location, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	return location
+}
+
+// evaluate evaluates an expression, formatting times in RFC 3339 so cases
+// compare them with their offsets
+func evaluate(t *testing.T, env *Env, source string, document map[string]interface{}) (interface{}, error) {
+	expr, err := Parse(source)
+	require.NoError(t, err, source)
+	value, err := expr.Eval(context.Background(), env, document)
+	if tm, ok := value.(time.Time); ok {
+		return tm.Format(time.RFC3339), err
+	}
+	return value, err
+}
+
+func TestFunctions(t *testing.T) {
+	env := &Env{
+		// Friday
+		Now: time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC),
+		Calendars: testCalendars{
+			"holidays": {Name: "holidays", Dates: []string{"2026-01-05", "2026-03-09"}},
+		},
+	}
+	document := map[string]interface{}{
+		// The Saturday before daylight saving time starts in New York
+		"spring": time.Date(2026, 3, 7, 12, 0, 0, 0, newYork(t)),
+		"due":    "2026-01-31T09:00:00Z",
+		"count":  3,
+		"name":   "  Order-42 ",
+		"scores": []interface{}{4.5, 2, 7},
+	}
+
+	for _, tc := range []struct {
+		expr string
+		want interface{}
+	}{
+		{expr: `now()`, want: "2026-01-02T10:00:00Z"},
+		{expr: `now() > addDuration(now(), "-1s")`, want: true},
+
+		{expr: `addDuration(now(), "72h")`, want: "2026-01-05T10:00:00Z"},
+		{expr: `addDuration(now(), "-90m")`, want: "2026-01-02T08:30:00Z"},
+		{expr: `addDuration(now(), "2w")`, want: "2026-01-16T10:00:00Z"},
+		{expr: `addDuration(due, "1mo")`, want: "2026-02-28T09:00:00Z"},
+		{expr: `addDuration(due, "-1y")`, want: "2025-01-31T09:00:00Z"},
+		// Days keep the wall clock across the DST change, hours do not
+		{expr: `addDuration(spring, "1d")`, want: "2026-03-08T12:00:00-04:00"},
+		{expr: `addDuration(spring, "24h")`, want: "2026-03-08T13:00:00-04:00"},
+		{expr: `addDuration(null, "1d")`, want: nil},
+
+		{expr: `addBusinessDays(now(), 1)`, want: "2026-01-05T10:00:00Z"},
+		{expr: `addBusinessDays(now(), 3, "holidays")`, want: "2026-01-08T10:00:00Z"},
+		{expr: `addBusinessDays("2026-01-06T10:00:00Z", -1, "holidays")`, want: "2026-01-02T10:00:00Z"},
+		{expr: `addBusinessDays(now(), 0)`, want: "2026-01-02T10:00:00Z"},
+		{expr: `addBusinessDays(spring, 1)`, want: "2026-03-09T12:00:00-04:00"},
+		{expr: `addBusinessDays(spring, 1, "holidays")`, want: "2026-03-10T12:00:00-04:00"},
+		{expr: `addBusinessDays(now(), 1, null)`, want: "2026-01-05T10:00:00Z"},
+
+		{expr: `startOf(now(), "hour")`, want: "2026-01-02T10:00:00Z"},
+		{expr: `startOf(now(), "day")`, want: "2026-01-02T00:00:00Z"},
+		{expr: `startOf(now(), "week")`, want: "2025-12-29T00:00:00Z"},
+		{expr: `startOf(addDuration(now(), "2d"), "week")`, want: "2025-12-29T00:00:00Z"},
+		{expr: `startOf(now(), "month")`, want: "2026-01-01T00:00:00Z"},
+		{expr: `startOf(due, "year")`, want: "2026-01-01T00:00:00Z"},
+		{expr: `startOf(addDuration(spring, "1d"), "day")`, want: "2026-03-08T00:00:00-05:00"},
+
+		{expr: `inZone(now(), "Asia/Tokyo")`, want: "2026-01-02T19:00:00+09:00"},
+		{expr: `format(now(), "date")`, want: "2026-01-02"},
+		{expr: `format(inZone(now(), "America/New_York"), "datetime")`, want: "2026-01-02 05:00:00"},
+		{expr: `format(spring, "Mon 02 Jan 15:04 MST")`, want: "Sat 07 Mar 12:00 EST"},
+		{expr: `format(due, "RFC3339")`, want: "2026-01-31T09:00:00Z"},
+
+		{expr: `parseTime("2026-03-08", "date")`, want: "2026-03-08T00:00:00Z"},
+		{expr: `parseTime("07/03/2026 09:30", "02/01/2006 15:04", "America/New_York")`, want: "2026-03-07T09:30:00-05:00"},
+		{expr: `parseTime("2026-03-08 03:30:00", "datetime", "America/New_York")`, want: "2026-03-08T03:30:00-04:00"},
+		{expr: `parseTime("2026-01-02T10:00:00+01:00", "RFC3339") < now()`, want: true},
+		{expr: `parseTime(null, "date")`, want: nil},
+
+		{expr: `round(2.5)`, want: 3.0},
+		{expr: `round(-2.5)`, want: -3.0},
+		{expr: `round(3.14159, 2)`, want: 3.14},
+		{expr: `floor(-1.5)`, want: -2.0},
+		{expr: `floor(count)`, want: 3.0},
+		{expr: `min(3, 1, 2)`, want: 1.0},
+		{expr: `max(scores)`, want: 7.0},
+		{expr: `min(null, count)`, want: 3.0},
+		{expr: `max(now(), parseTime(due, "RFC3339"))`, want: "2026-01-31T09:00:00Z"},
+
+		{expr: `lower(trim(name))`, want: "order-42"},
+		{expr: `concat("order-", count, "-", true, null)`, want: "order-3-true"},
+		{expr: `concat(format(now(), "date"), "/", 1.5)`, want: "2026-01-02/1.5"},
+		{expr: `count == 3 && count in [1, 3]`, want: true},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			got, err := evaluate(t, env, tc.expr, document)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	for _, tc := range []struct {
+		expr string
+		env  *Env
+		err  string
+	}{
+		{expr: `now()`, env: &Env{}, err: "now: no clock is available"},
+		{expr: `addDuration(now(), "soon")`, env: env, err: `addDuration: invalid duration "soon"`},
+		{expr: `addDuration("tomorrow", "1d")`, env: env, err: `addDuration: expects a time, got string "tomorrow"`},
+		{expr: `addBusinessDays(now(), 1.5)`, env: env, err: "addBusinessDays: expects an integer, got 1.5"},
+		{expr: `addBusinessDays(now(), 1, "unknown")`, env: env, err: `addBusinessDays: calendar "unknown": calendar not found: unknown`},
+		{expr: `addBusinessDays(now(), 1, "holidays")`, env: &Env{Now: env.Now}, err: `addBusinessDays: calendar "holidays": no calendars are available`},
+		{expr: `addBusinessDays(now(), 100000)`, env: env, err: "addBusinessDays: cannot add more than 10000 business days"},
+		{expr: `startOf(now(), "fortnight")`, env: env, err: `startOf: unknown unit "fortnight", expected hour, day, week, month or year`},
+		{expr: `inZone(now(), "Mars/Olympus")`, env: env, err: `inZone: invalid time zone "Mars/Olympus"`},
+		{expr: `parseTime("2026-13-01", "date")`, env: env, err: `parseTime: cannot parse "2026-13-01" as date`},
+		{expr: `round(1, 20)`, env: env, err: "round: decimal places must be between 0 and 15, got 20"},
+		{expr: `min(1, "2")`, env: env, err: "min: cannot compare number with string"},
+		{expr: `concat("a", [1])`, env: env, err: "concat: cannot concatenate list"},
+		{expr: `now() > 3`, env: env, err: "cannot compare time with number"},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := evaluate(t, tc.env, tc.expr, document)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestUUID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	first, err := evaluate(t, nil, `uuid()`, nil)
+	require.NoError(t, err)
+	second, err := evaluate(t, nil, `uuid()`, nil)
+	require.NoError(t, err)
+	assert.Regexp(t, pattern, first)
+	assert.NotEqual(t, first, second)
+}
+
+func TestParse(t *testing.T) {
+	expr, err := Parse(`any(items, item, item.qty > limit) && lower(customer.name) == "x" && limit > 0`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"items", "limit", "customer"}, expr.Variables())
+
+	for source, message := range map[string]string{
+		`unknown(input)`:              `unknown function "unknown" at position 1`,
+		`now(1)`:                      "now expects 0 arguments, got 1",
+		`len(1, 2)`:                   "len expects 1 arguments, got 2",
+		`addBusinessDays(now())`:      "addBusinessDays expects 2 to 3 arguments, got 1",
+		`round(1, 2, 3)`:              "round expects 1 to 2 arguments, got 3",
+		`concat()`:                    "concat expects at least 1 arguments, got 0",
+		`addDuration(now(), "1d"`:     `expected "," at position 24, got "end of expression"`,
+		`any(items, 1, true)`:         `any expects an item name at position 12, got "1"`,
+		`format(now(), "date") "x"`:   `unexpected "\"x\"" at position 23`,
+		`parseTime("a", "b", "c", 1)`: "parseTime expects 2 to 3 arguments, got 4",
+	} {
+		_, err := Parse(source)
+		assert.EqualError(t, err, message, source)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	source, ok := Embedded(` ${ addBusinessDays(now(), 3) } `)
+	assert.True(t, ok)
+	assert.Equal(t, "addBusinessDays(now(), 3)", source)
+
+	for _, s := range []string{"order", "id-${order}", "${a}-${b}"} {
+		_, ok := Embedded(s)
+		assert.False(t, ok, s)
+	}
+
+	assert.Equal(t, []string{"a", `format(now(), "date")`}, EmbeddedAll(`${a}-${ format(now(), "date") }`))
+}
+
+func TestCall(t *testing.T) {
+	start := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	value, err := Call(nil, "addBusinessDays", start, 2)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 6, 10, 0, 0, 0, time.UTC), value)
+
+	value, err = Call(&Env{Now: start}, "now")
+	require.NoError(t, err)
+	assert.Equal(t, start, value)
+
+	_, err = Call(nil, "round")
+	assert.EqualError(t, err, "round expects 1 to 2 arguments, got 0")
+	_, err = Call(nil, "any", []interface{}{})
+	assert.EqualError(t, err, `unknown function "any"`)
+}
+
+func TestEvalRespectsContext(t *testing.T) {
+	expr, err := Parse(`all(items, item, item > 0)`)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = expr.EvalBool(ctx, nil, map[string]interface{}{"items": []interface{}{1, 2}})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = expr.EvalBool(context.Background(), nil, map[string]interface{}{"items": "nope"})
+	assert.EqualError(t, err, "any and all expect a list, got string")
+}
+
+func TestFlags(t *testing.T) {
+	expr, err := Parse(`flag("new-tax-engine") && (flag("eu-vat") || !flag("new-tax-engine"))`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-tax-engine", "eu-vat"}, expr.Flags())
+
+	env := &Env{Flags: map[string]bool{"new-tax-engine": true, "eu-vat": true}}
+	enabled, err := expr.EvalBool(context.Background(), env, nil)
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	// Flags the execution did not evaluate are off
+	enabled, err = expr.EvalBool(context.Background(), nil, nil)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	_, err = Parse(`flag(input.flag)`)
+	assert.EqualError(t, err, "flag expects a flag name string at position 1")
+}
+
+type secretMap map[string]string
+
+func (s secretMap) Secret(name string) (string, error) {
+	value, ok := s[name]
+	if !ok {
+		return "", fmt.Errorf("secret not found: %s", name)
+	}
+	return value, nil
+}
+
+func TestSecrets(t *testing.T) {
+	expr, err := Parse(`concat("Bearer ", secret("payments/stripe#api_key"))`)
+	require.NoError(t, err)
+
+	env := &Env{Secrets: secretMap{"payments/stripe#api_key": "sk_live_42"}}
+	value, err := expr.Eval(context.Background(), env, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer sk_live_42", value)
+
+	missing, err := Parse(`secret("missing")`)
+	require.NoError(t, err)
+	_, err = missing.Eval(context.Background(), env, nil)
+	assert.EqualError(t, err, "secret: secret not found: missing")
+
+	// Without a provider secrets cannot be read
+	_, err = expr.Eval(context.Background(), nil, nil)
+	assert.EqualError(t, err, `secret: cannot read "payments/stripe#api_key", no secret provider is configured`)
+
+	// Inputs cannot choose the secret read
+	_, err = Parse(`secret(input.name)`)
+	assert.EqualError(t, err, "secret expects a secret name string at position 1")
+}
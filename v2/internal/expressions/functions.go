@@ -0,0 +1,546 @@
+package expressions
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/scheduler"
+)
+
+// function is a built-in function of expressions
+type function struct {
+	minArgs int
+	// maxArgs is -1 for functions taking any number of arguments
+	maxArgs int
+	call    func(env *Env, args []interface{}) (interface{}, error)
+}
+
+func fixed(arity int, call func(env *Env, args []interface{}) (interface{}, error)) function {
+	return function{minArgs: arity, maxArgs: arity, call: call}
+}
+
+func (f function) checkArity(n int) error {
+	switch {
+	case f.minArgs == f.maxArgs && n != f.minArgs:
+		return fmt.Errorf("expects %d arguments, got %d", f.minArgs, n)
+	case f.maxArgs < 0 && n < f.minArgs:
+		return fmt.Errorf("expects at least %d arguments, got %d", f.minArgs, n)
+	case n < f.minArgs || (f.maxArgs >= 0 && n > f.maxArgs):
+		return fmt.Errorf("expects %d to %d arguments, got %d", f.minArgs, f.maxArgs, n)
+	}
+	return nil
+}
+
+// maxBusinessDays bounds the days addBusinessDays moves by
+const maxBusinessDays = 10000
+
+// layouts are the named layouts of format and parseTime. Other layouts are
+// Go reference time layouts, such as "02 Jan 2006 15:04".
+var layouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"date":        scheduler.DateLayout,
+	"datetime":    "2006-01-02 15:04:05",
+	"time":        "15:04",
+}
+
+// period matches the calendar periods of addDuration
+var period = regexp.MustCompile(`^([+-]?\d+)(d|w|mo|y)$`)
+
+var functions = map[string]function{
+	"len": fixed(1, func(env *Env, args []interface{}) (interface{}, error) {
+		switch value := args[0].(type) {
+		case nil:
+			return float64(0), nil
+		case string:
+			return float64(len([]rune(value))), nil
+		case []interface{}:
+			return float64(len(value)), nil
+		case map[string]interface{}:
+			return float64(len(value)), nil
+		default:
+			return nil, fmt.Errorf("expects a string, list or object, got %s", typeOf(value))
+		}
+	}),
+	"lower": fixed(1, stringFunction(func(s string) interface{} { return strings.ToLower(s) })),
+	"upper": fixed(1, stringFunction(func(s string) interface{} { return strings.ToUpper(s) })),
+	"trim":  fixed(1, stringFunction(func(s string) interface{} { return strings.TrimSpace(s) })),
+	"starts_with": fixed(2, stringsFunction(func(s, prefix string) (interface{}, error) {
+		return strings.HasPrefix(s, prefix), nil
+	})),
+	"ends_with": fixed(2, stringsFunction(func(s, suffix string) (interface{}, error) {
+		return strings.HasSuffix(s, suffix), nil
+	})),
+	"matches": fixed(2, stringsFunction(func(s, pattern string) (interface{}, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		return re.MatchString(s), nil
+	})),
+	"contains": fixed(2, func(env *Env, args []interface{}) (interface{}, error) {
+		return contains(args[0], args[1])
+	}),
+	"url_scheme": fixed(1, stringFunction(func(s string) interface{} {
+		parsed, err := url.Parse(s)
+		if err != nil {
+			return nil
+		}
+		return strings.ToLower(parsed.Scheme)
+	})),
+	"url_host": fixed(1, stringFunction(func(s string) interface{} {
+		parsed, err := url.Parse(s)
+		if err != nil {
+			return nil
+		}
+		return strings.ToLower(parsed.Hostname())
+	})),
+	"concat": {minArgs: 1, maxArgs: -1, call: concat},
+	"uuid": fixed(0, func(env *Env, args []interface{}) (interface{}, error) {
+		return uuid.NewString(), nil
+	}),
+
+	"round": {minArgs: 1, maxArgs: 2, call: round},
+	"floor": fixed(1, func(env *Env, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		x, err := numberArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return math.Floor(x), nil
+	}),
+	"min": {minArgs: 1, maxArgs: -1, call: extremum(-1)},
+	"max": {minArgs: 1, maxArgs: -1, call: extremum(1)},
+
+	"now": fixed(0, func(env *Env, args []interface{}) (interface{}, error) {
+		if env.Now.IsZero() {
+			return nil, fmt.Errorf("no clock is available")
+		}
+		return env.Now, nil
+	}),
+	"addDuration":     fixed(2, timeFunction(addDuration)),
+	"addBusinessDays": {minArgs: 2, maxArgs: 3, call: timeFunction(addBusinessDays)},
+	"startOf":         fixed(2, timeFunction(startOf)),
+	"inZone": fixed(2, timeFunction(func(env *Env, t time.Time, args []interface{}) (interface{}, error) {
+		location, err := locationArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return t.In(location), nil
+	})),
+	"format": fixed(2, timeFunction(func(env *Env, t time.Time, args []interface{}) (interface{}, error) {
+		layout, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(layoutOf(layout)), nil
+	})),
+	"parseTime": {minArgs: 2, maxArgs: 3, call: parseTime},
+
+	"flag": fixed(1, func(env *Env, args []interface{}) (interface{}, error) {
+		key, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return env.Flags[key], nil
+	}),
+	"secret": fixed(1, func(env *Env, args []interface{}) (interface{}, error) {
+		name, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if env.Secrets == nil {
+			return nil, fmt.Errorf("cannot read %q, no secret provider is configured", name)
+		}
+		return env.Secrets.Secret(name)
+	}),
+}
+
+// Functions returns the names of the built-in functions in sorted order
+func Functions() []string {
+	names := make([]string, 0, len(functions)+2)
+	for name := range functions {
+		names = append(names, name)
+	}
+	names = append(names, "any", "all")
+	sort.Strings(names)
+	return names
+}
+
+// Call calls a built-in function, for callers outside expressions such as
+// template function maps. Go numbers are accepted for number arguments.
+func Call(env *Env, name string, args ...interface{}) (interface{}, error) {
+	fn, exists := functions[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	if err := fn.checkArity(len(args)); err != nil {
+		return nil, fmt.Errorf("%s %v", name, err)
+	}
+	if env == nil {
+		env = &Env{}
+	}
+	normalized := make([]interface{}, len(args))
+	for i, arg := range args {
+		normalized[i] = normalize(arg)
+	}
+	value, err := fn.call(env, normalized)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return value, nil
+}
+
+// stringFunction wraps a function of one string, null for a missing value
+func stringFunction(fn func(string) interface{}) func(*Env, []interface{}) (interface{}, error) {
+	return func(env *Env, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expects a string, got %s", typeOf(args[0]))
+		}
+		return fn(s), nil
+	}
+}
+
+// stringsFunction wraps a function of two strings, false for a missing
+// first value
+func stringsFunction(fn func(string, string) (interface{}, error)) func(*Env, []interface{}) (interface{}, error) {
+	return func(env *Env, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		s, ok1 := args[0].(string)
+		t, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("expects strings, got %s and %s", typeOf(args[0]), typeOf(args[1]))
+		}
+		return fn(s, t)
+	}
+}
+
+// timeFunction wraps a function of a time and further arguments, null for
+// a missing time
+func timeFunction(fn func(env *Env, t time.Time, args []interface{}) (interface{}, error)) func(*Env, []interface{}) (interface{}, error) {
+	return func(env *Env, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		t, err := timeArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(env, t, args)
+	}
+}
+
+// timeArg reads a time, given as a time value or an RFC 3339 string
+func timeArg(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("expects a time, got string %q", v)
+		}
+		return t, nil
+	default:
+		return time.Time{}, fmt.Errorf("expects a time, got %s", typeOf(value))
+	}
+}
+
+func numberArg(value interface{}) (float64, error) {
+	x, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("expects a number, got %s", typeOf(value))
+	}
+	return x, nil
+}
+
+func intArg(value interface{}) (int, error) {
+	x, err := numberArg(value)
+	if err != nil {
+		return 0, err
+	}
+	if x != math.Trunc(x) || math.Abs(x) > math.MaxInt32 {
+		return 0, fmt.Errorf("expects an integer, got %v", x)
+	}
+	return int(x), nil
+}
+
+func stringArg(value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expects a string, got %s", typeOf(value))
+	}
+	return s, nil
+}
+
+func locationArg(value interface{}) (*time.Location, error) {
+	name, err := stringArg(value)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	}
+	return location, nil
+}
+
+func layoutOf(name string) string {
+	if layout, ok := layouts[name]; ok {
+		return layout
+	}
+	return name
+}
+
+// addDuration adds a Go duration such as "72h" or "-90m", which is elapsed
+// time, or a calendar period of days (d), weeks (w), months (mo) or years
+// (y), which keeps the wall clock of the time across daylight saving time
+// changes. Months added to the end of a month end on the last day of the
+// target month.
+func addDuration(env *Env, t time.Time, args []interface{}) (interface{}, error) {
+	text, err := stringArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if match := period.FindStringSubmatch(text); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q", text)
+		}
+		switch match[2] {
+		case "d":
+			return t.AddDate(0, 0, n), nil
+		case "w":
+			return t.AddDate(0, 0, 7*n), nil
+		case "mo":
+			return addMonths(t, n), nil
+		default:
+			return addMonths(t, 12*n), nil
+		}
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q", text)
+	}
+	return t.Add(d), nil
+}
+
+// addMonths adds months, clamping the day to the length of the target month
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// addBusinessDays moves a time by business days, skipping Saturdays,
+// Sundays and the dates of the optional calendar. Dates are those of the
+// time zone of the time, whose wall clock is kept.
+func addBusinessDays(env *Env, t time.Time, args []interface{}) (interface{}, error) {
+	days, err := intArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if days > maxBusinessDays || days < -maxBusinessDays {
+		return nil, fmt.Errorf("cannot add more than %d business days", maxBusinessDays)
+	}
+
+	var calendar *scheduler.Calendar
+	if len(args) == 3 && args[2] != nil {
+		name, err := stringArg(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if env.Calendars == nil {
+			return nil, fmt.Errorf("calendar %q: no calendars are available", name)
+		}
+		calendar, err = env.Calendars.GetCalendar(name)
+		if err != nil {
+			return nil, fmt.Errorf("calendar %q: %w", name, err)
+		}
+	}
+
+	step := 1
+	if days < 0 {
+		step, days = -1, -days
+	}
+	for days > 0 {
+		t = t.AddDate(0, 0, step)
+		if isBusinessDay(t, calendar) {
+			days--
+		}
+	}
+	return t, nil
+}
+
+func isBusinessDay(t time.Time, calendar *scheduler.Calendar) bool {
+	if weekday := t.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		return false
+	}
+	return calendar == nil || !calendar.Contains(t.Format(scheduler.DateLayout))
+}
+
+// startOf truncates a time to the start of its hour, day, week, which
+// starts on Monday, month or year in its time zone
+func startOf(env *Env, t time.Time, args []interface{}) (interface{}, error) {
+	unit, err := stringArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	year, month, day := t.Date()
+	location := t.Location()
+	switch unit {
+	case "hour":
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, location), nil
+	case "day":
+		return time.Date(year, month, day, 0, 0, 0, 0, location), nil
+	case "week":
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-sinceMonday, 0, 0, 0, 0, location), nil
+	case "month":
+		return time.Date(year, month, 1, 0, 0, 0, 0, location), nil
+	case "year":
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, location), nil
+	default:
+		return nil, fmt.Errorf("unknown unit %q, expected hour, day, week, month or year", unit)
+	}
+}
+
+// parseTime parses a string with a layout, in UTC or the optional time zone
+// unless the layout has an offset
+func parseTime(env *Env, args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	s, err := stringArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	layout, err := stringArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	location := time.UTC
+	if len(args) == 3 {
+		if location, err = locationArg(args[2]); err != nil {
+			return nil, err
+		}
+	}
+	t, err := time.ParseInLocation(layoutOf(layout), s, location)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q as %s", s, layout)
+	}
+	return t, nil
+}
+
+// round rounds a number half away from zero, to an optional number of
+// decimal places
+func round(env *Env, args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	x, err := numberArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		return math.Round(x), nil
+	}
+	places, err := intArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if places < 0 || places > 15 {
+		return nil, fmt.Errorf("decimal places must be between 0 and 15, got %d", places)
+	}
+	scale := math.Pow(10, float64(places))
+	return math.Round(x*scale) / scale, nil
+}
+
+// extremum returns min (sign -1) or max (sign 1) of numbers or times, given
+// as arguments or as a single list. Missing values are ignored.
+func extremum(sign int) func(*Env, []interface{}) (interface{}, error) {
+	return func(env *Env, args []interface{}) (interface{}, error) {
+		if len(args) == 1 {
+			if list, ok := args[0].([]interface{}); ok {
+				args = list
+			}
+		}
+
+		var best interface{}
+		for _, arg := range args {
+			arg = normalize(arg)
+			if arg == nil {
+				continue
+			}
+			if best == nil {
+				if _, ok := arg.(float64); !ok {
+					if _, ok := arg.(time.Time); !ok {
+						return nil, fmt.Errorf("expects numbers or times, got %s", typeOf(arg))
+					}
+				}
+				best = arg
+				continue
+			}
+			var order int
+			switch b := best.(type) {
+			case float64:
+				x, ok := arg.(float64)
+				if !ok {
+					return nil, fmt.Errorf("cannot compare number with %s", typeOf(arg))
+				}
+				order = compareFloats(x, b)
+			case time.Time:
+				x, ok := arg.(time.Time)
+				if !ok {
+					return nil, fmt.Errorf("cannot compare time with %s", typeOf(arg))
+				}
+				order = compareTimes(x, b)
+			}
+			if order*sign > 0 {
+				best = arg
+			}
+		}
+		return best, nil
+	}
+}
+
+// concat joins its arguments as strings. Null is the empty string, numbers
+// are formatted without trailing zeros and times in RFC 3339.
+func concat(env *Env, args []interface{}) (interface{}, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+		case string:
+			b.WriteString(v)
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			b.WriteString(strconv.FormatBool(v))
+		case time.Time:
+			b.WriteString(v.Format(time.RFC3339Nano))
+		default:
+			return nil, fmt.Errorf("cannot concatenate %s", typeOf(arg))
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,177 @@
+// Package flags evaluates workflow feature flags, which toggle branches of
+// a workflow for some executions without creating a new version. Flags are
+// defined for a namespace or a workflow and read in the condition
+// expressions of definitions as flag("new-tax-engine"). They are evaluated
+// once, when an execution starts, and recorded on the execution, so every
+// step, retry and replay of the execution sees the same values and flag
+// changes only apply to new executions.
+package flags
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/policies"
+)
+
+// Kind is how a flag decides its value
+type Kind string
+
+const (
+	// KindBoolean flags are on for every execution while enabled
+	KindBoolean Kind = "boolean"
+	// KindPercentage flags are on for a percentage of executions, bucketed
+	// by a deterministic hash of their routing key
+	KindPercentage Kind = "percentage"
+	// KindRule flags take the value of the first rule whose condition holds
+	// for the labels and input of the execution
+	KindRule Kind = "rule"
+)
+
+// ErrInvalidFlag is returned for flags that cannot be defined
+var ErrInvalidFlag = errors.New("invalid flag")
+
+// keyPattern matches flag keys, such as new-tax-engine
+var keyPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?$`)
+
+// Rule sets the value of a rule flag when its condition holds
+type Rule struct {
+	// When is the condition expression, over the labels, input, namespace
+	// and workflow of the execution
+	When  string `json:"when"`
+	Value bool   `json:"value"`
+}
+
+// Flag is a feature flag of the workflows of a namespace, or of one
+// workflow. Workflow flags override the namespace flags of the same key.
+type Flag struct {
+	ID  uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Key string    `json:"key" gorm:"uniqueIndex:idx_feature_flags_scope_key,priority:2;not null"`
+	// Namespace is the namespace of the workflows the flag applies to, the
+	// default namespace when empty. It is ignored for workflow flags.
+	Namespace string `json:"namespace,omitempty" gorm:"index"`
+	// WorkflowID limits the flag to one workflow
+	WorkflowID  *uuid.UUID `json:"workflow_id,omitempty" gorm:"type:uuid;index"`
+	Description string     `json:"description" gorm:"type:text"`
+	Kind        Kind       `json:"kind"`
+	// Enabled turns the flag on. Disabled flags are off for every execution
+	// whatever their kind.
+	Enabled bool `json:"enabled"`
+	// Percentage is the percentage of executions percentage flags are on
+	// for, between 0 and 100
+	Percentage float64 `json:"percentage,omitempty"`
+	// RoutingKey is the expression of the key percentage flags bucket
+	// executions by, such as input.customer_id, so the same customer gets
+	// the same value across executions. Executions are bucketed by their
+	// correlation ID when it is empty or evaluates to null.
+	RoutingKey string `json:"routing_key,omitempty"`
+	Rules      []Rule `json:"rules,omitempty" gorm:"type:jsonb;serializer:json"`
+	// Default is the value of rule flags when no rule holds
+	Default   bool      `json:"default,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Scope is the namespace or workflow of the flag, keys being unique
+	// within a scope
+	Scope string `json:"-" gorm:"uniqueIndex:idx_feature_flags_scope_key,priority:1;not null"`
+}
+
+// TableName returns the table name for the Flag model
+func (Flag) TableName() string {
+	return "feature_flags"
+}
+
+// normalizeScope sets the namespace and scope of the flag
+func (f *Flag) normalizeScope() {
+	if f.WorkflowID != nil {
+		f.Namespace = ""
+		f.Scope = "workflow/" + f.WorkflowID.String()
+		return
+	}
+	if f.Namespace == "" {
+		f.Namespace = policies.DefaultNamespace
+	}
+	f.Scope = "namespace/" + f.Namespace
+}
+
+// appliesTo reports whether the flag is defined for a workflow of a
+// namespace, and whether it is a workflow flag
+func (f *Flag) appliesTo(workflowID uuid.UUID, namespace string) (applies, workflowFlag bool) {
+	if f.WorkflowID != nil {
+		return *f.WorkflowID == workflowID, true
+	}
+	return f.Namespace == namespace, false
+}
+
+// Validate checks the flag, compiling its routing key and the conditions of
+// its rules. The error wraps ErrInvalidFlag and lists every problem.
+func (f *Flag) Validate() error {
+	_, err := f.compile()
+	return err
+}
+
+// compiledFlag is a flag ready to be evaluated
+type compiledFlag struct {
+	*Flag
+	routingKey *expressions.Expression
+	rules      []*expressions.Expression
+}
+
+func (f *Flag) compile() (*compiledFlag, error) {
+	var problems []string
+	if !keyPattern.MatchString(f.Key) {
+		problems = append(problems, fmt.Sprintf("key %q must be lowercase letters, digits, dots, dashes and underscores", f.Key))
+	}
+
+	compiled := &compiledFlag{Flag: f}
+	switch f.Kind {
+	case KindBoolean:
+	case KindPercentage:
+		if f.Percentage < 0 || f.Percentage > 100 {
+			problems = append(problems, "percentage must be between 0 and 100")
+		}
+		if f.RoutingKey != "" {
+			routingKey, err := expressions.Parse(f.RoutingKey)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("invalid routing key: %v", err))
+			}
+			compiled.routingKey = routingKey
+		}
+	case KindRule:
+		if len(f.Rules) == 0 {
+			problems = append(problems, "rule flags need at least one rule")
+		}
+		for i, rule := range f.Rules {
+			condition, err := expressions.Parse(rule.When)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("rule %d: invalid condition: %v", i+1, err))
+				continue
+			}
+			compiled.rules = append(compiled.rules, condition)
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("kind must be %s, %s or %s", KindBoolean, KindPercentage, KindRule))
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFlag, strings.Join(problems, "; "))
+	}
+	return compiled, nil
+}
+
+// Bucket returns the bucket of a routing key for a flag, between 0 and 100.
+// Buckets are a hash of the flag key and the routing key, so a routing key
+// always lands in the same bucket of a flag, and flags bucket independently
+// of each other.
+func Bucket(key, routingKey string) float64 {
+	sum := sha256.Sum256([]byte(key + "\x00" + routingKey))
+	return float64(binary.BigEndian.Uint64(sum[:8])%10000) / 100
+}
@@ -0,0 +1,193 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+type productionVersions []*models.WorkflowVersion
+
+func (v productionVersions) ListProduction() ([]*models.WorkflowVersion, error) {
+	return v, nil
+}
+
+func newManager(t *testing.T, versions VersionStore) *Manager {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	manager := NewManager(NewMemoryStore(), versions, logger)
+	manager.now = func() time.Time { return time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC) }
+	return manager
+}
+
+func define(t *testing.T, manager *Manager, flag *Flag) *Flag {
+	t.Helper()
+	flag.Enabled = true
+	created, err := manager.CreateFlag(context.Background(), flag)
+	require.NoError(t, err)
+	return created
+}
+
+// checkout is a checkout workflow whose tax step branches on flags
+func checkout(team string, flags ...string) models.WorkflowDefinition {
+	condition := "true"
+	for _, flag := range flags {
+		condition += fmt.Sprintf(` && flag(%q)`, flag)
+	}
+	return models.WorkflowDefinition{
+		Metadata: models.WorkflowMetadata{Labels: map[string]string{"namespace": "shop", "team": team}},
+		Spec: models.WorkflowSpec{Steps: []models.WorkflowStep{{
+			Name: "route-tax",
+			Type: "condition",
+			Config: map[string]interface{}{
+				"condition": map[string]interface{}{"operator": "expression", "expression": condition},
+			},
+		}}},
+	}
+}
+
+func newWorkflow(definition models.WorkflowDefinition) *models.Workflow {
+	return &models.Workflow{ID: uuid.New(), Name: "checkout", Definition: definition}
+}
+
+func TestReferences(t *testing.T) {
+	definition := checkout("payments", "new-tax-engine", "eu-vat")
+	definition.Spec.Steps = append(definition.Spec.Steps, models.WorkflowStep{
+		Name:   "charge",
+		Type:   "http",
+		Config: map[string]interface{}{"url": `${flag("legacy-lane") ? "a" : "b"}`, "headers": map[string]interface{}{"X-Lane": `${concat("lane-", flag("fast-lane"))}`}},
+	})
+	// The placeholder that does not parse references no flag
+	assert.Equal(t, []string{"eu-vat", "fast-lane", "new-tax-engine"}, References(definition))
+	assert.Empty(t, References(checkout("payments")))
+}
+
+func TestPercentageBucketing(t *testing.T) {
+	manager := newManager(t, nil)
+	define(t, manager, &Flag{Key: "new-tax-engine", Namespace: "shop", Kind: KindPercentage, Percentage: 25, RoutingKey: "input.customer_id"})
+	workflow := newWorkflow(checkout("payments", "new-tax-engine"))
+
+	evaluate := func(customerID string, correlationID string) bool {
+		values, err := manager.Evaluate(context.Background(), &Request{
+			Workflow:      workflow,
+			Input:         map[string]interface{}{"customer_id": customerID},
+			CorrelationID: correlationID,
+		})
+		require.NoError(t, err)
+		return values["new-tax-engine"]
+	}
+
+	on := 0
+	for i := 0; i < 2000; i++ {
+		customerID := fmt.Sprintf("customer-%d", i)
+		value := evaluate(customerID, uuid.NewString())
+		assert.Equal(t, value, evaluate(customerID, uuid.NewString()), "a routing key always gets the same value")
+		assert.Equal(t, Bucket("new-tax-engine", customerID) < 25, value)
+		if value {
+			on++
+		}
+	}
+	assert.InDelta(t, 500, on, 75, "about a quarter of the customers")
+
+	assert.Equal(t, Bucket("new-tax-engine", "customer-7"), Bucket("new-tax-engine", "customer-7"))
+	assert.NotEqual(t, Bucket("new-tax-engine", "customer-7"), Bucket("eu-vat", "customer-7"), "flags bucket independently")
+
+	// Executions without the routing key are bucketed by correlation ID
+	values, err := manager.Evaluate(context.Background(), &Request{Workflow: workflow, CorrelationID: "order-42"})
+	require.NoError(t, err)
+	assert.Equal(t, Bucket("new-tax-engine", "order-42") < 25, values["new-tax-engine"])
+}
+
+func TestRuleTargeting(t *testing.T) {
+	manager := newManager(t, nil)
+	define(t, manager, &Flag{Key: "new-tax-engine", Namespace: "shop", Kind: KindRule, Rules: []Rule{
+		{When: `input.country == "US"`, Value: false},
+		{When: `labels.team == "payments" || input.country in ["DE", "FR"]`, Value: true},
+	}})
+
+	evaluate := func(workflow *models.Workflow, country string) bool {
+		values, err := manager.Evaluate(context.Background(), &Request{Workflow: workflow, Input: map[string]interface{}{"country": country}})
+		require.NoError(t, err)
+		require.Contains(t, values, "new-tax-engine")
+		return values["new-tax-engine"]
+	}
+
+	payments := newWorkflow(checkout("payments", "new-tax-engine"))
+	retail := newWorkflow(checkout("retail", "new-tax-engine"))
+	assert.True(t, evaluate(payments, "GB"))
+	assert.False(t, evaluate(payments, "US"), "the first rule that holds decides")
+	assert.True(t, evaluate(retail, "FR"))
+	assert.False(t, evaluate(retail, "GB"), "the default applies when no rule holds")
+
+	// Workflow flags override namespace flags
+	define(t, manager, &Flag{Key: "new-tax-engine", WorkflowID: &retail.ID, Kind: KindBoolean})
+	assert.True(t, evaluate(retail, "GB"))
+	assert.True(t, evaluate(retail, "US"))
+	assert.False(t, evaluate(payments, "US"))
+
+	// Flags that are not defined are off, and recorded as such
+	values, err := manager.Evaluate(context.Background(), &Request{Workflow: newWorkflow(checkout("payments", "eu-vat"))})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"eu-vat": false}, values)
+}
+
+func TestValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		flag    Flag
+		message string
+	}{
+		"key":        {Flag{Key: "New Tax", Kind: KindBoolean}, `key "New Tax" must be`},
+		"kind":       {Flag{Key: "new-tax-engine"}, "kind must be boolean, percentage or rule"},
+		"percentage": {Flag{Key: "new-tax-engine", Kind: KindPercentage, Percentage: 120}, "percentage must be between 0 and 100"},
+		"routing":    {Flag{Key: "new-tax-engine", Kind: KindPercentage, RoutingKey: "input."}, "invalid routing key"},
+		"rules":      {Flag{Key: "new-tax-engine", Kind: KindRule}, "rule flags need at least one rule"},
+		"condition":  {Flag{Key: "new-tax-engine", Kind: KindRule, Rules: []Rule{{When: "soon()"}}}, "rule 1: invalid condition"},
+	} {
+		err := tc.flag.Validate()
+		assert.ErrorIs(t, err, ErrInvalidFlag, name)
+		assert.ErrorContains(t, err, tc.message, name)
+	}
+
+	manager := newManager(t, nil)
+	define(t, manager, &Flag{Key: "new-tax-engine", Kind: KindBoolean})
+	_, err := manager.CreateFlag(context.Background(), &Flag{Key: "new-tax-engine", Namespace: "default", Kind: KindBoolean})
+	assert.ErrorIs(t, err, ErrDuplicateFlag)
+}
+
+func TestStaleReferences(t *testing.T) {
+	live := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: uuid.New(), Version: "1.4.0", Definition: checkout("payments", "new-tax-engine")}
+	next := &models.WorkflowVersion{ID: uuid.New(), WorkflowID: uuid.New(), Version: "2.0.0", Definition: checkout("payments", "new-tax-engine", "eu-vat")}
+	manager := newManager(t, productionVersions{live, next})
+	assert.Nil(t, manager.StaleReferences())
+
+	flag := define(t, manager, &Flag{Key: "new-tax-engine", Namespace: "shop", Kind: KindBoolean})
+	euVAT := define(t, manager, &Flag{Key: "eu-vat", WorkflowID: &next.WorkflowID, Kind: KindBoolean})
+	report, err := manager.CheckStale(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.References)
+
+	require.NoError(t, manager.DeleteFlag(context.Background(), euVAT.ID))
+	require.NoError(t, manager.DeleteFlag(context.Background(), flag.ID))
+	report, err = manager.CheckStale(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []StaleReference{
+		{WorkflowID: live.WorkflowID, VersionID: live.ID, Version: "1.4.0", Namespace: "shop", Flag: "new-tax-engine"},
+		{WorkflowID: next.WorkflowID, VersionID: next.ID, Version: "2.0.0", Namespace: "shop", Flag: "eu-vat"},
+		{WorkflowID: next.WorkflowID, VersionID: next.ID, Version: "2.0.0", Namespace: "shop", Flag: "new-tax-engine"},
+	}, report.References)
+	assert.Same(t, report, manager.StaleReferences())
+
+	warnings, err := manager.Lint(context.Background(), live.WorkflowID, "shop", live.Definition)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`flag "new-tax-engine" is not defined for namespace shop or the workflow, so it is off for every execution`}, warnings)
+}
@@ -0,0 +1,204 @@
+package flags
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Handlers provides HTTP handlers for feature flags
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new flag handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers flag routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		flags := v1.Group("/flags")
+		{
+			flags.GET("", h.ListFlags)
+			flags.POST("", h.CreateFlag)
+			flags.GET("/stale", h.ListStaleReferences)
+			flags.GET("/:id", h.GetFlag)
+			flags.PUT("/:id", h.UpdateFlag)
+			flags.DELETE("/:id", h.DeleteFlag)
+		}
+	}
+}
+
+// ListFlags lists the flags
+// @Summary List feature flags
+// @Tags flags
+// @Produce json
+// @Param namespace query string false "Namespace"
+// @Param workflow_id query string false "Workflow ID"
+// @Success 200 {array} Flag
+// @Router /api/v1/flags [get]
+func (h *Handlers) ListFlags(c *gin.Context) {
+	filter := Filter{Namespace: c.Query("namespace")}
+	if value := c.Query("workflow_id"); value != "" {
+		workflowID, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workflow_id"})
+			return
+		}
+		filter.WorkflowID = &workflowID
+	}
+
+	flags, err := h.manager.ListFlags(c.Request.Context(), filter)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, flags)
+}
+
+// CreateFlag defines a flag
+// @Summary Create a feature flag
+// @Tags flags
+// @Accept json
+// @Produce json
+// @Param flag body Flag true "Flag"
+// @Success 201 {object} Flag
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/flags [post]
+func (h *Handlers) CreateFlag(c *gin.Context) {
+	var flag Flag
+	if err := c.ShouldBindJSON(&flag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.manager.CreateFlag(c.Request.Context(), &flag)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetFlag returns a flag
+// @Summary Get a feature flag
+// @Tags flags
+// @Produce json
+// @Param id path string true "Flag ID"
+// @Success 200 {object} Flag
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/flags/{id} [get]
+func (h *Handlers) GetFlag(c *gin.Context) {
+	id, ok := flagID(c)
+	if !ok {
+		return
+	}
+
+	flag, err := h.manager.GetFlag(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, flag)
+}
+
+// UpdateFlag replaces a flag
+// @Summary Update a feature flag
+// @Description Changes apply to executions started after the update
+// @Tags flags
+// @Accept json
+// @Produce json
+// @Param id path string true "Flag ID"
+// @Param flag body Flag true "Flag"
+// @Success 200 {object} Flag
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/flags/{id} [put]
+func (h *Handlers) UpdateFlag(c *gin.Context) {
+	id, ok := flagID(c)
+	if !ok {
+		return
+	}
+
+	var flag Flag
+	if err := c.ShouldBindJSON(&flag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.manager.UpdateFlag(c.Request.Context(), id, &flag)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteFlag removes a flag
+// @Summary Delete a feature flag
+// @Tags flags
+// @Param id path string true "Flag ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/flags/{id} [delete]
+func (h *Handlers) DeleteFlag(c *gin.Context) {
+	id, ok := flagID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.manager.DeleteFlag(c.Request.Context(), id); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListStaleReferences returns the flags production versions reference
+// without them being defined, as of the last background check
+// @Summary List stale feature flag references
+// @Tags flags
+// @Produce json
+// @Param refresh query bool false "Check now rather than return the last check"
+// @Success 200 {object} StaleReport
+// @Router /api/v1/flags/stale [get]
+func (h *Handlers) ListStaleReferences(c *gin.Context) {
+	report := h.manager.StaleReferences()
+	if report == nil || c.Query("refresh") == "true" {
+		var err error
+		report, err = h.manager.CheckStale(c.Request.Context())
+		if err != nil {
+			h.handleError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func flagID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid flag ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidFlag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrFlagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrDuplicateFlag):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,454 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// VersionStore lists the workflow versions in production, whose flag
+// references are checked
+type VersionStore interface {
+	ListProduction() ([]*models.WorkflowVersion, error)
+}
+
+// Request is an execution whose flags are evaluated as it starts
+type Request struct {
+	Workflow *models.Workflow
+	Input    map[string]interface{}
+	// CorrelationID buckets the execution for percentage flags without a
+	// routing key
+	CorrelationID string
+}
+
+// Filter selects flags. Zero fields match every flag.
+type Filter struct {
+	Namespace  string
+	WorkflowID *uuid.UUID
+}
+
+func (f Filter) matches(flag *Flag) bool {
+	return (f.Namespace == "" || flag.Namespace == f.Namespace) &&
+		(f.WorkflowID == nil || (flag.WorkflowID != nil && *flag.WorkflowID == *f.WorkflowID))
+}
+
+// StaleReference is a flag a production version references without it
+// being defined, such as a flag deleted while still in use. Executions of
+// the version evaluate it as off.
+type StaleReference struct {
+	WorkflowID uuid.UUID `json:"workflow_id"`
+	VersionID  uuid.UUID `json:"version_id"`
+	Version    string    `json:"version"`
+	Namespace  string    `json:"namespace"`
+	Flag       string    `json:"flag"`
+}
+
+// Warning returns the lint warning of the reference
+func (r StaleReference) Warning() string {
+	return fmt.Sprintf("flag %q is not defined for namespace %s or the workflow, so it is off for every execution", r.Flag, r.Namespace)
+}
+
+// StaleReport is the outcome of the last stale reference check
+type StaleReport struct {
+	CheckedAt  time.Time        `json:"checked_at"`
+	References []StaleReference `json:"references"`
+}
+
+// Manager defines flags, evaluates them for starting executions and checks
+// the flag references of production versions in the background
+type Manager struct {
+	store    Store
+	versions VersionStore
+	logger   *logrus.Logger
+	now      func() time.Time
+
+	mu     sync.RWMutex
+	report *StaleReport
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager creates a flag manager. Stale references are not checked
+// without a version store.
+func NewManager(store Store, versions VersionStore, logger *logrus.Logger) *Manager {
+	return &Manager{
+		store:    store,
+		versions: versions,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// CreateFlag defines a flag
+func (m *Manager) CreateFlag(ctx context.Context, flag *Flag) (*Flag, error) {
+	if err := flag.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := m.now().UTC()
+	flag.ID = uuid.New()
+	flag.CreatedAt = now
+	flag.UpdatedAt = now
+	flag.normalizeScope()
+	if err := m.store.Create(ctx, flag); err != nil {
+		return nil, err
+	}
+	return flag, nil
+}
+
+// UpdateFlag replaces a flag. Executions already started keep the value
+// they evaluated.
+func (m *Manager) UpdateFlag(ctx context.Context, id uuid.UUID, flag *Flag) (*Flag, error) {
+	existing, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := flag.Validate(); err != nil {
+		return nil, err
+	}
+
+	flag.ID = id
+	flag.CreatedAt = existing.CreatedAt
+	flag.UpdatedAt = m.now().UTC()
+	flag.normalizeScope()
+	if err := m.store.Update(ctx, flag); err != nil {
+		return nil, err
+	}
+	return flag, nil
+}
+
+// GetFlag returns a flag
+func (m *Manager) GetFlag(ctx context.Context, id uuid.UUID) (*Flag, error) {
+	return m.store.Get(ctx, id)
+}
+
+// DeleteFlag removes a flag. Versions still referencing it are reported by
+// the next stale reference check.
+func (m *Manager) DeleteFlag(ctx context.Context, id uuid.UUID) error {
+	return m.store.Delete(ctx, id)
+}
+
+// ListFlags returns the matching flags, ordered by key
+func (m *Manager) ListFlags(ctx context.Context, filter Filter) ([]*Flag, error) {
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flags := []*Flag{}
+	for _, flag := range stored {
+		if filter.matches(flag) {
+			flags = append(flags, flag)
+		}
+	}
+	return flags, nil
+}
+
+// Evaluate evaluates the flags the definition of a workflow references, for
+// an execution starting. Flags that are not defined, or whose evaluation
+// fails, are off. It returns nil for workflows referencing no flag.
+func (m *Manager) Evaluate(ctx context.Context, request *Request) (map[string]bool, error) {
+	definition := request.Workflow.Definition
+	keys := References(definition)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load flags: %w", err)
+	}
+
+	namespace := policies.Namespace(definition)
+	document, err := normalize(map[string]interface{}{
+		"namespace":      namespace,
+		"labels":         definition.Metadata.Labels,
+		"input":          request.Input,
+		"correlation_id": request.CorrelationID,
+		"workflow": map[string]interface{}{
+			"id":     request.Workflow.ID,
+			"name":   request.Workflow.Name,
+			"tags":   request.Workflow.Tags,
+			"labels": definition.Metadata.Labels,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	env := &expressions.Env{Now: m.now()}
+	values := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		flag := resolve(stored, key, request.Workflow.ID, namespace)
+		if flag == nil {
+			values[key] = false
+			continue
+		}
+		value, err := flag.evaluate(ctx, env, document, request.CorrelationID)
+		if err != nil {
+			m.logger.WithError(err).WithFields(logrus.Fields{
+				"flag":        key,
+				"workflow_id": request.Workflow.ID,
+			}).Warn("Failed to evaluate feature flag, it is off")
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// evaluate returns the value of the flag for an execution
+func (f *Flag) evaluate(ctx context.Context, env *expressions.Env, document map[string]interface{}, correlationID string) (bool, error) {
+	if !f.Enabled {
+		return false, nil
+	}
+	compiled, err := f.compile()
+	if err != nil {
+		return false, err
+	}
+
+	switch f.Kind {
+	case KindPercentage:
+		routingKey := correlationID
+		if compiled.routingKey != nil {
+			value, err := compiled.routingKey.Eval(ctx, env, document)
+			if err != nil {
+				return false, fmt.Errorf("routing key: %w", err)
+			}
+			if value != nil {
+				routingKey = fmt.Sprint(value)
+			}
+		}
+		return Bucket(f.Key, routingKey) < f.Percentage, nil
+	case KindRule:
+		for i, condition := range compiled.rules {
+			holds, err := condition.EvalBool(ctx, env, document)
+			if err != nil {
+				return false, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			if holds {
+				return f.Rules[i].Value, nil
+			}
+		}
+		return f.Default, nil
+	default:
+		return true, nil
+	}
+}
+
+// resolve returns the flag of a key for a workflow of a namespace, the
+// workflow flag overriding the namespace flag
+func resolve(flags []*Flag, key string, workflowID uuid.UUID, namespace string) *Flag {
+	var resolved *Flag
+	for _, flag := range flags {
+		if flag.Key != key {
+			continue
+		}
+		applies, workflowFlag := flag.appliesTo(workflowID, namespace)
+		if !applies {
+			continue
+		}
+		if workflowFlag {
+			return flag
+		}
+		resolved = flag
+	}
+	return resolved
+}
+
+// Lint returns a warning for every flag a definition references that is not
+// defined for the workflow or its namespace. The definition is a
+// models.WorkflowDefinition or its JSON form.
+func (m *Manager) Lint(ctx context.Context, workflowID uuid.UUID, namespace string, definition interface{}) ([]string, error) {
+	keys := References(definition)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load flags: %w", err)
+	}
+
+	var warnings []string
+	for _, key := range keys {
+		if resolve(stored, key, workflowID, namespace) == nil {
+			warnings = append(warnings, StaleReference{Namespace: namespace, Flag: key}.Warning())
+		}
+	}
+	return warnings, nil
+}
+
+// CheckStale checks the flag references of the versions in production,
+// keeping the report StaleReferences returns
+func (m *Manager) CheckStale(ctx context.Context) (*StaleReport, error) {
+	if m.versions == nil {
+		return nil, fmt.Errorf("no version store is available")
+	}
+	versions, err := m.versions.ListProduction()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list production versions: %w", err)
+	}
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load flags: %w", err)
+	}
+
+	report := &StaleReport{CheckedAt: m.now().UTC(), References: []StaleReference{}}
+	for _, version := range versions {
+		namespace := policies.Namespace(version.Definition)
+		for _, key := range References(version.Definition) {
+			if resolve(stored, key, version.WorkflowID, namespace) != nil {
+				continue
+			}
+			report.References = append(report.References, StaleReference{
+				WorkflowID: version.WorkflowID,
+				VersionID:  version.ID,
+				Version:    version.Version,
+				Namespace:  namespace,
+				Flag:       key,
+			})
+		}
+	}
+
+	m.mu.Lock()
+	m.report = report
+	m.mu.Unlock()
+	return report, nil
+}
+
+// StaleReferences returns the report of the last stale reference check, nil
+// before the first check
+func (m *Manager) StaleReferences() *StaleReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.report
+}
+
+// Start checks stale references at once and then at the given interval,
+// until Stop is called
+func (m *Manager) Start(ctx context.Context, interval time.Duration) {
+	m.stopCh = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			report, err := m.CheckStale(ctx)
+			if err != nil {
+				m.logger.WithError(err).Error("Failed to check stale flag references")
+			}
+			for _, reference := range referencesOf(report) {
+				m.logger.WithFields(logrus.Fields{
+					"workflow_id": reference.WorkflowID,
+					"version":     reference.Version,
+					"flag":        reference.Flag,
+				}).Warn("Production version references an undefined feature flag")
+			}
+
+			select {
+			case <-ticker.C:
+			case <-m.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops checking stale references
+func (m *Manager) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.stopCh = nil
+}
+
+func referencesOf(report *StaleReport) []StaleReference {
+	if report == nil {
+		return nil
+	}
+	return report.References
+}
+
+// References returns the keys of the flags a definition reads with flag(),
+// sorted. The definition is a models.WorkflowDefinition or its JSON form.
+// Expressions are those of ${...} placeholders and of conditions with the
+// expression operator; expressions that do not parse reference no flag.
+func References(definition interface{}) []string {
+	value, ok := definition.(map[string]interface{})
+	if !ok {
+		data, err := json.Marshal(definition)
+		if err != nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil
+		}
+	}
+
+	seen := make(map[string]bool)
+	collectReferences(value, seen)
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func collectReferences(value interface{}, seen map[string]bool) {
+	addFlags := func(source string) {
+		expr, err := expressions.Parse(source)
+		if err != nil {
+			return
+		}
+		for _, key := range expr.Flags() {
+			seen[key] = true
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		for _, source := range expressions.EmbeddedAll(v) {
+			addFlags(source)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			if source, ok := item.(string); ok && key == "expression" && v["operator"] == "expression" {
+				addFlags(source)
+				continue
+			}
+			collectReferences(item, seen)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectReferences(item, seen)
+		}
+	}
+}
+
+// normalize converts a document to its JSON form, so expressions compare
+// numbers as float64 and read structs through their JSON field names
+func normalize(document map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode flag document: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to decode flag document: %w", err)
+	}
+	return normalized, nil
+}
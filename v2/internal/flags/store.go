@@ -0,0 +1,207 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrFlagNotFound is returned for flags that do not exist
+	ErrFlagNotFound = errors.New("flag not found")
+	// ErrDuplicateFlag is returned when a key is already defined in the
+	// namespace or workflow of a flag
+	ErrDuplicateFlag = errors.New("flag key already exists in its scope")
+)
+
+// Store persists flags
+type Store interface {
+	Create(ctx context.Context, flag *Flag) error
+	Update(ctx context.Context, flag *Flag) error
+	Get(ctx context.Context, id uuid.UUID) (*Flag, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	// List returns every flag, ordered by key
+	List(ctx context.Context) ([]*Flag, error)
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu    sync.RWMutex
+	flags map[uuid.UUID]*Flag
+}
+
+// NewMemoryStore creates an in-memory flag store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{flags: make(map[uuid.UUID]*Flag)}
+}
+
+// Create stores a new flag
+func (s *MemoryStore) Create(ctx context.Context, flag *Flag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keyTakenLocked(flag) {
+		return ErrDuplicateFlag
+	}
+	stored := *flag
+	s.flags[flag.ID] = &stored
+	return nil
+}
+
+// Update replaces a flag
+func (s *MemoryStore) Update(ctx context.Context, flag *Flag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.flags[flag.ID]; !exists {
+		return ErrFlagNotFound
+	}
+	if s.keyTakenLocked(flag) {
+		return ErrDuplicateFlag
+	}
+	stored := *flag
+	s.flags[flag.ID] = &stored
+	return nil
+}
+
+func (s *MemoryStore) keyTakenLocked(flag *Flag) bool {
+	for id, existing := range s.flags {
+		if id != flag.ID && existing.Scope == flag.Scope && existing.Key == flag.Key {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns a flag
+func (s *MemoryStore) Get(ctx context.Context, id uuid.UUID) (*Flag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	flag, exists := s.flags[id]
+	if !exists {
+		return nil, ErrFlagNotFound
+	}
+	stored := *flag
+	return &stored, nil
+}
+
+// Delete removes a flag
+func (s *MemoryStore) Delete(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.flags[id]; !exists {
+		return ErrFlagNotFound
+	}
+	delete(s.flags, id)
+	return nil
+}
+
+// List returns every flag, ordered by key
+func (s *MemoryStore) List(ctx context.Context) ([]*Flag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	flags := make([]*Flag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		stored := *flag
+		flags = append(flags, &stored)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		if flags[i].Key != flags[j].Key {
+			return flags[i].Key < flags[j].Key
+		}
+		return flags[i].Scope < flags[j].Scope
+	})
+	return flags, nil
+}
+
+// GormStore is a database Store
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database flag store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the flag table
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Flag{})
+}
+
+// Create stores a new flag
+func (s *GormStore) Create(ctx context.Context, flag *Flag) error {
+	err := s.db.WithContext(ctx).Create(flag).Error
+	if isUniqueViolation(err) {
+		return ErrDuplicateFlag
+	}
+	return err
+}
+
+// Update replaces a flag
+func (s *GormStore) Update(ctx context.Context, flag *Flag) error {
+	result := s.db.WithContext(ctx).Model(&Flag{}).Where("id = ?", flag.ID).Select("*").Updates(flag)
+	if isUniqueViolation(result.Error) {
+		return ErrDuplicateFlag
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFlagNotFound
+	}
+	return nil
+}
+
+// Get returns a flag
+func (s *GormStore) Get(ctx context.Context, id uuid.UUID) (*Flag, error) {
+	var flag Flag
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&flag).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFlagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// Delete removes a flag
+func (s *GormStore) Delete(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Where("id = ?", id).Delete(&Flag{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFlagNotFound
+	}
+	return nil
+}
+
+// List returns every flag, ordered by key
+func (s *GormStore) List(ctx context.Context) ([]*Flag, error) {
+	var flags []*Flag
+	err := s.db.WithContext(ctx).Order("key, scope").Find(&flags).Error
+	return flags, err
+}
+
+// isUniqueViolation reports whether a database error is a unique constraint
+// violation, which drivers report with different messages
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "unique") || strings.Contains(message, "duplicate")
+}
@@ -0,0 +1,197 @@
+// Package freeze freezes the mutations of the API during incidents while
+// reads and the dashboard stay available. A freeze has a scope, freezing
+// every write, only the executions started or only the changes of
+// workflow definitions, a reason and an optional expiry. Freezes are
+// stored in the database, so a freeze applies to every server of the
+// cluster and survives restarts. Blocked requests are answered 423 Locked
+// with the reason and expiry of the freeze, while the operations needed to
+// get out of an incident, such as cancellations, node drains and lifting
+// the freeze itself, are never blocked. Schedules and webhook triggers
+// hold their executions while executions are frozen and start them once
+// the freeze ends.
+package freeze
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scope is what a freeze freezes
+type Scope string
+
+const (
+	// ScopeAllWrites freezes every mutation: executions, definitions and
+	// configuration
+	ScopeAllWrites Scope = "all-writes"
+	// ScopeExecutions freezes the executions started
+	ScopeExecutions Scope = "executions-only"
+	// ScopeDefinitions freezes the changes of workflow definitions and
+	// the activations of their versions
+	ScopeDefinitions Scope = "definitions-only"
+)
+
+// Operation is the kind of an API operation a freeze may block
+type Operation string
+
+const (
+	// OperationRead operations change nothing and are never blocked
+	OperationRead Operation = "read"
+	// OperationExempt operations are needed for safety, such as
+	// cancellations and drains, and are never blocked
+	OperationExempt Operation = "exempt"
+	// OperationExecution operations start executions
+	OperationExecution Operation = "execution"
+	// OperationDefinition operations change workflow definitions or
+	// activate their versions
+	OperationDefinition Operation = "definition"
+	// OperationWrite operations change anything else, such as schedules,
+	// flags and policies
+	OperationWrite Operation = "write"
+)
+
+// Valid reports whether a scope is known
+func (s Scope) Valid() bool {
+	switch s {
+	case ScopeAllWrites, ScopeExecutions, ScopeDefinitions:
+		return true
+	}
+	return false
+}
+
+// Blocks reports whether freezes of the scope block an operation
+func (s Scope) Blocks(operation Operation) bool {
+	switch operation {
+	case OperationExecution:
+		return s == ScopeAllWrites || s == ScopeExecutions
+	case OperationDefinition:
+		return s == ScopeAllWrites || s == ScopeDefinitions
+	case OperationWrite:
+		return s == ScopeAllWrites
+	}
+	return false
+}
+
+// ErrFreezeNotFound is returned for unknown freezes
+var ErrFreezeNotFound = errors.New("freeze not found")
+
+// ErrFreezeEnded is returned when lifting a freeze that was already lifted
+// or expired
+var ErrFreezeEnded = errors.New("freeze already ended")
+
+// ErrFrozen is matched by the errors of operations a freeze blocks
+var ErrFrozen = errors.New("frozen")
+
+// Freeze freezes the operations of its scope until it is lifted or expires
+type Freeze struct {
+	ID     uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	Scope  Scope     `json:"scope" gorm:"not null"`
+	Reason string    `json:"reason" gorm:"not null"`
+	Actor  string    `json:"actor"`
+	// ExpiresAt is when the freeze ends by itself, nil for freezes lasting
+	// until lifted
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	// EndedAt is when the freeze was lifted or expired, and EndedBy who
+	// lifted it, "expiry" for expired freezes
+	EndedAt *time.Time `json:"ended_at,omitempty" gorm:"index"`
+	EndedBy string     `json:"ended_by,omitempty"`
+}
+
+// TableName returns the table name for the Freeze model
+func (Freeze) TableName() string {
+	return "system_freezes"
+}
+
+// Active reports whether the freeze is in effect at a time
+func (f *Freeze) Active(now time.Time) bool {
+	return f.EndedAt == nil && (f.ExpiresAt == nil || now.Before(*f.ExpiresAt))
+}
+
+// Audit actions
+const (
+	ActionFrozen   = "frozen"
+	ActionUnfrozen = "unfrozen"
+	ActionExpired  = "expired"
+)
+
+// expiryActor ends the freezes that expire
+const expiryActor = "expiry"
+
+// AuditEntry records a freeze, lifted or expired
+type AuditEntry struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	FreezeID  uuid.UUID  `json:"freeze_id" gorm:"type:uuid;not null;index"`
+	Action    string     `json:"action" gorm:"not null"`
+	Scope     Scope      `json:"scope"`
+	Reason    string     `json:"reason"`
+	Actor     string     `json:"actor"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName returns the table name for the AuditEntry model
+func (AuditEntry) TableName() string {
+	return "system_freeze_audit"
+}
+
+// ErrHoldFull is returned when holding a webhook while the held webhooks
+// reached their limit
+var ErrHoldFull = errors.New("too many held webhooks")
+
+// HeldWebhook is a verified webhook received while executions were frozen.
+// Held webhooks are stored with the freezes, so that they survive restarts
+// and whichever server sees the freeze end starts them.
+type HeldWebhook struct {
+	ID uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	// Trigger names the webhook trigger that received the webhook
+	Trigger string `json:"trigger" gorm:"not null"`
+	// Input is the JSON payload of the webhook
+	Input     string    `json:"input" gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName returns the table name for the HeldWebhook model
+func (HeldWebhook) TableName() string {
+	return "held_webhooks"
+}
+
+// Request freezes the operations of a scope
+type Request struct {
+	Scope  Scope  `json:"scope" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+	// ExpiresIn is how long the freeze lasts, such as 30m, and ExpiresAt
+	// when it ends; a freeze with neither lasts until lifted
+	ExpiresIn string     `json:"expires_in,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// FrozenError is returned for operations a freeze blocks
+type FrozenError struct {
+	Freeze    *Freeze
+	Operation Operation
+}
+
+func (e *FrozenError) Error() string {
+	message := fmt.Sprintf("%s operations are frozen (%s): %s", e.Operation, e.Freeze.Scope, e.Freeze.Reason)
+	if e.Freeze.ExpiresAt != nil {
+		message += fmt.Sprintf(", until %s", e.Freeze.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return message
+}
+
+// Is matches ErrFrozen
+func (e *FrozenError) Is(target error) bool {
+	return target == ErrFrozen
+}
+
+// Banner is the freeze state shown in system information and the banner of
+// the dashboard
+type Banner struct {
+	Frozen bool `json:"frozen"`
+	// Message summarises the freezes in effect, the most restrictive first
+	Message string    `json:"message,omitempty"`
+	Freezes []*Freeze `json:"freezes"`
+}
@@ -0,0 +1,231 @@
+package freeze
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/scheduler"
+)
+
+func newTestManager(store Store) (*Manager, *scheduler.FakeClock) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	clock := scheduler.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewManager(store, logger)
+	manager.now = clock.Now
+	return manager, clock
+}
+
+// newTestRouter serves the freeze endpoints and stub routes of the server
+// behind the freeze middleware
+func newTestRouter(manager *Manager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(manager, DefaultRules))
+	NewHandlers(manager).RegisterRoutes(router.Group("/api"))
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	v1 := router.Group("/api/v1")
+	v1.GET("/workflows", ok)
+	v1.POST("/workflows", ok)
+	v1.PUT("/workflows/:id", ok)
+	v1.POST("/workflows/:id/validate", ok)
+	v1.PUT("/workflows/:id/deprecation", ok)
+	v1.POST("/executions/workflows/:id/execute", ok)
+	v1.POST("/executions/:id/cancel", ok)
+	v1.POST("/executions/:id/retry", ok)
+	v1.POST("/execution-groups", ok)
+	v1.POST("/nodes/:id/cordon", ok)
+	v1.POST("/triggers/webhooks/:name", ok)
+	v1.POST("/schedules", ok)
+	return router
+}
+
+func serve(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		payload, _ := json.Marshal(body)
+		reader = bytes.NewReader(payload)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", "oncall")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareScopes(t *testing.T) {
+	requests := []struct {
+		method, path string
+		operation    Operation
+	}{
+		{http.MethodGet, "/api/v1/workflows", OperationRead},
+		{http.MethodPost, "/api/v1/workflows/1/validate", OperationRead},
+		{http.MethodPost, "/api/v1/workflows", OperationDefinition},
+		{http.MethodPut, "/api/v1/workflows/1", OperationDefinition},
+		{http.MethodPut, "/api/v1/workflows/1/deprecation", OperationDefinition},
+		{http.MethodPost, "/api/v1/executions/workflows/1/execute", OperationExecution},
+		{http.MethodPost, "/api/v1/executions/1/retry", OperationExecution},
+		{http.MethodPost, "/api/v1/execution-groups", OperationExecution},
+		{http.MethodPost, "/api/v1/schedules", OperationWrite},
+	}
+
+	for _, scope := range []Scope{ScopeAllWrites, ScopeExecutions, ScopeDefinitions} {
+		t.Run(string(scope), func(t *testing.T) {
+			manager, _ := newTestManager(NewMemoryStore())
+			router := newTestRouter(manager)
+
+			rec := serve(router, http.MethodPost, "/api/v1/system/freeze", Request{Scope: scope, Reason: "INC-42 database failover", ExpiresIn: "30m"})
+			require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+			for _, req := range requests {
+				rec := serve(router, req.method, req.path, nil)
+				if !scope.Blocks(req.operation) {
+					assert.Equal(t, http.StatusOK, rec.Code, "%s %s", req.method, req.path)
+					continue
+				}
+
+				require.Equal(t, http.StatusLocked, rec.Code, "%s %s", req.method, req.path)
+				var body map[string]interface{}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+				assert.Equal(t, "INC-42 database failover", body["reason"])
+				assert.Equal(t, string(scope), body["scope"])
+				assert.Equal(t, "2024-01-01T12:30:00Z", body["expires_at"])
+			}
+		})
+	}
+
+	t.Run("unknown scope", func(t *testing.T) {
+		manager, _ := newTestManager(NewMemoryStore())
+		rec := serve(newTestRouter(manager), http.MethodPost, "/api/v1/system/freeze", Request{Scope: "everything", Reason: "INC-42"})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestMiddlewareExemptions(t *testing.T) {
+	manager, _ := newTestManager(NewMemoryStore())
+	router := newTestRouter(manager)
+
+	freeze, err := manager.Freeze(context.Background(), "oncall", Request{Scope: ScopeAllWrites, Reason: "INC-42"})
+	require.NoError(t, err)
+
+	for _, path := range []string{
+		"/api/v1/executions/1/cancel",
+		"/api/v1/nodes/node-1/cordon",
+		"/api/v1/triggers/webhooks/github-prs",
+	} {
+		assert.Equal(t, http.StatusOK, serve(router, http.MethodPost, path, nil).Code, path)
+	}
+
+	// Freezes can be added and reported during a freeze
+	rec := serve(router, http.MethodPost, "/api/v1/system/freeze", Request{Scope: ScopeExecutions, Reason: "INC-43"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = serve(router, http.MethodGet, "/api/v1/system/freeze", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var banner Banner
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &banner))
+	assert.True(t, banner.Frozen)
+	assert.Len(t, banner.Freezes, 2)
+	assert.Equal(t, "All writes frozen: INC-42, and 1 more freezes", banner.Message)
+
+	// and lifted
+	rec = serve(router, http.MethodDelete, "/api/v1/system/freeze/"+freeze.ID.String(), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, http.StatusConflict, serve(router, http.MethodDelete, "/api/v1/system/freeze/"+freeze.ID.String(), nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodDelete, "/api/v1/system/freeze/"+uuid.New().String(), nil).Code)
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodPost, "/api/v1/schedules", nil).Code)
+	assert.Equal(t, http.StatusLocked, serve(router, http.MethodPost, "/api/v1/executions/1/retry", nil).Code)
+}
+
+func TestFreezeExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	manager, clock := newTestManager(store)
+
+	var released int
+	manager.OnRelease(OperationExecution, func(ctx context.Context) { released++ })
+
+	freeze, err := manager.Freeze(ctx, "oncall", Request{Scope: ScopeExecutions, Reason: "INC-42", ExpiresIn: "10m"})
+	require.NoError(t, err)
+	assert.ErrorIs(t, manager.Check(OperationExecution), ErrFrozen)
+	assert.True(t, manager.Hold(OperationExecution).Held())
+	assert.NoError(t, manager.Check(OperationDefinition))
+
+	// The freeze stops applying at its expiry, before the next refresh
+	clock.Advance(10 * time.Minute)
+	assert.NoError(t, manager.Check(OperationExecution))
+	assert.False(t, manager.Banner().Frozen)
+
+	// A second server refreshing from the same store expires the freeze
+	// once
+	other, otherClock := newTestManager(store)
+	otherClock.Advance(10 * time.Minute)
+	require.NoError(t, manager.Refresh(ctx))
+	require.NoError(t, other.Refresh(ctx))
+	assert.Equal(t, 1, released)
+
+	ended, err := store.Get(ctx, freeze.ID)
+	require.NoError(t, err)
+	require.NotNil(t, ended.EndedAt)
+	assert.Equal(t, *freeze.ExpiresAt, *ended.EndedAt)
+	assert.Equal(t, expiryActor, ended.EndedBy)
+
+	entries, err := manager.ListAudit(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, ActionExpired, entries[0].Action)
+	assert.Equal(t, ActionFrozen, entries[1].Action)
+	assert.Equal(t, "oncall", entries[1].Actor)
+
+	_, err = manager.Freeze(ctx, "oncall", Request{Scope: ScopeExecutions, Reason: "INC-42", ExpiresIn: "-1m"})
+	assert.ErrorIs(t, err, ErrInvalidFreeze)
+	past := clock.Now().Add(-time.Minute)
+	_, err = manager.Freeze(ctx, "oncall", Request{Scope: ScopeExecutions, Reason: "INC-42", ExpiresAt: &past})
+	assert.ErrorIs(t, err, ErrInvalidFreeze)
+}
+
+func TestUnfreezeReleases(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := newTestManager(NewMemoryStore())
+
+	var released []Operation
+	manager.OnRelease(OperationExecution, func(ctx context.Context) { released = append(released, OperationExecution) })
+
+	all, err := manager.Freeze(ctx, "oncall", Request{Scope: ScopeAllWrites, Reason: "INC-42"})
+	require.NoError(t, err)
+	executions, err := manager.Freeze(ctx, "oncall", Request{Scope: ScopeExecutions, Reason: "INC-42"})
+	require.NoError(t, err)
+
+	// Executions stay blocked until both freezes are lifted
+	_, err = manager.Unfreeze(ctx, all.ID, "oncall")
+	require.NoError(t, err)
+	assert.Empty(t, released)
+	assert.ErrorIs(t, manager.Check(OperationExecution), ErrFrozen)
+	assert.NoError(t, manager.Check(OperationWrite))
+
+	_, err = manager.Unfreeze(ctx, executions.ID, "lead")
+	require.NoError(t, err)
+	assert.Equal(t, []Operation{OperationExecution}, released)
+	assert.False(t, manager.Hold(OperationExecution).Held())
+
+	entries, err := manager.ListAudit(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, ActionUnfrozen, entries[0].Action)
+	assert.Equal(t, "lead", entries[0].Actor)
+}
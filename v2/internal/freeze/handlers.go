@@ -0,0 +1,138 @@
+package freeze
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultAuditLimit = 100
+
+// Handlers provides HTTP handlers for system freezes
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new freeze handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers freeze routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		freeze := v1.Group("/system/freeze")
+		{
+			freeze.POST("", h.CreateFreeze)
+			freeze.GET("", h.GetFreezes)
+			freeze.GET("/audit", h.ListAudit)
+			freeze.DELETE("/:id", h.DeleteFreeze)
+		}
+	}
+}
+
+// CreateFreeze freezes the operations of a scope
+// @Summary Freeze operations
+// @Description Freezes every write (all-writes), the executions started (executions-only) or the changes of workflow definitions (definitions-only) until lifted or expired. Blocked requests are answered 423 Locked.
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param request body Request true "Freeze request"
+// @Success 201 {object} Freeze
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/system/freeze [post]
+func (h *Handlers) CreateFreeze(c *gin.Context) {
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	freeze, err := h.manager.Freeze(c.Request.Context(), c.GetHeader("X-User-ID"), req)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, freeze)
+}
+
+// GetFreezes returns the freezes in effect
+// @Summary Get freezes in effect
+// @Tags system
+// @Produce json
+// @Success 200 {object} Banner
+// @Router /api/v1/system/freeze [get]
+func (h *Handlers) GetFreezes(c *gin.Context) {
+	c.JSON(http.StatusOK, h.manager.Banner())
+}
+
+// DeleteFreeze lifts a freeze
+// @Summary Unfreeze operations
+// @Tags system
+// @Produce json
+// @Param id path string true "Freeze ID"
+// @Success 200 {object} Freeze
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/system/freeze/{id} [delete]
+func (h *Handlers) DeleteFreeze(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid freeze ID"})
+		return
+	}
+
+	freeze, err := h.manager.Unfreeze(c.Request.Context(), id, c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, freeze)
+}
+
+// ListAudit returns the freeze audit log
+// @Summary List freeze audit log
+// @Tags system
+// @Produce json
+// @Param limit query int false "Maximum number of entries" default(100)
+// @Success 200 {array} AuditEntry
+// @Router /api/v1/system/freeze/audit [get]
+func (h *Handlers) ListAudit(c *gin.Context) {
+	limit := defaultAuditLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := h.manager.ListAudit(c.Request.Context(), limit)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func (h *Handlers) errorResponse(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidFreeze):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrFreezeNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrFreezeEnded):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,340 @@
+package freeze
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidFreeze is returned for freeze requests without a valid scope,
+// reason or expiry
+var ErrInvalidFreeze = errors.New("invalid freeze")
+
+// Hold reports whether executions must be held rather than started. The
+// scheduler and webhook triggers consult it before firing.
+type Hold interface {
+	Held() bool
+}
+
+// hold holds the operations of a kind while a freeze blocks them
+type hold struct {
+	manager   *Manager
+	operation Operation
+}
+
+// Held reports whether a freeze blocks the operations
+func (h hold) Held() bool {
+	return h.manager.Check(h.operation) != nil
+}
+
+// Manager freezes and unfreezes operations. It caches the freezes in
+// effect, refreshing them from the store at an interval so that freezes
+// made on other servers apply, and ends the freezes that expired.
+type Manager struct {
+	store  Store
+	logger *logrus.Logger
+	now    func() time.Time
+
+	mu       sync.RWMutex
+	active   []*Freeze
+	releases map[Operation][]func(ctx context.Context)
+	blocked  map[Operation]bool
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager creates a freeze manager
+func NewManager(store Store, logger *logrus.Logger) *Manager {
+	return &Manager{
+		store:    store,
+		logger:   logger,
+		now:      time.Now,
+		releases: make(map[Operation][]func(ctx context.Context)),
+		blocked:  make(map[Operation]bool),
+	}
+}
+
+// Freeze freezes the operations of a scope until the freeze is lifted or
+// expires
+func (m *Manager) Freeze(ctx context.Context, actor string, req Request) (*Freeze, error) {
+	if !req.Scope.Valid() {
+		return nil, fmt.Errorf("%w: unknown scope %q, expected %s, %s or %s", ErrInvalidFreeze, req.Scope, ScopeAllWrites, ScopeExecutions, ScopeDefinitions)
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return nil, fmt.Errorf("%w: a reason is required", ErrInvalidFreeze)
+	}
+
+	now := m.now().UTC()
+	freeze := &Freeze{
+		ID:        uuid.New(),
+		Scope:     req.Scope,
+		Reason:    req.Reason,
+		Actor:     actor,
+		CreatedAt: now,
+	}
+	switch {
+	case req.ExpiresIn != "" && req.ExpiresAt != nil:
+		return nil, fmt.Errorf("%w: expires_in and expires_at are exclusive", ErrInvalidFreeze)
+	case req.ExpiresIn != "":
+		duration, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("%w: expires_in must be a positive duration, got %q", ErrInvalidFreeze, req.ExpiresIn)
+		}
+		expiresAt := now.Add(duration)
+		freeze.ExpiresAt = &expiresAt
+	case req.ExpiresAt != nil:
+		if !req.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("%w: expires_at is in the past", ErrInvalidFreeze)
+		}
+		expiresAt := req.ExpiresAt.UTC()
+		freeze.ExpiresAt = &expiresAt
+	}
+
+	if err := m.store.Create(ctx, freeze); err != nil {
+		return nil, fmt.Errorf("failed to store freeze: %w", err)
+	}
+	m.audit(ctx, freeze, ActionFrozen, actor)
+
+	m.logger.WithFields(logrus.Fields{
+		"freeze_id":  freeze.ID,
+		"scope":      freeze.Scope,
+		"reason":     freeze.Reason,
+		"actor":      actor,
+		"expires_at": freeze.ExpiresAt,
+	}).Warn("Operations frozen")
+
+	if err := m.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return freeze, nil
+}
+
+// Unfreeze lifts a freeze
+func (m *Manager) Unfreeze(ctx context.Context, id uuid.UUID, actor string) (*Freeze, error) {
+	if err := m.store.End(ctx, id, m.now().UTC(), actor); err != nil {
+		return nil, err
+	}
+	freeze, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.audit(ctx, freeze, ActionUnfrozen, actor)
+
+	m.logger.WithFields(logrus.Fields{
+		"freeze_id": id,
+		"scope":     freeze.Scope,
+		"actor":     actor,
+	}).Info("Operations unfrozen")
+
+	if err := m.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return freeze, nil
+}
+
+// Refresh reloads the freezes in effect from the store, ending those that
+// expired, and runs the release callbacks of the operations no longer
+// blocked
+func (m *Manager) Refresh(ctx context.Context) error {
+	freezes, err := m.store.ListActive(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list freezes: %w", err)
+	}
+
+	now := m.now().UTC()
+	active := make([]*Freeze, 0, len(freezes))
+	for _, freeze := range freezes {
+		if freeze.Active(now) {
+			active = append(active, freeze)
+			continue
+		}
+		// Every server expires the freeze; the one whose update ends it
+		// records the expiry
+		err := m.store.End(ctx, freeze.ID, *freeze.ExpiresAt, expiryActor)
+		if errors.Is(err, ErrFreezeEnded) {
+			continue
+		}
+		if err != nil {
+			m.logger.WithError(err).WithField("freeze_id", freeze.ID).Error("Failed to expire freeze")
+			continue
+		}
+		m.audit(ctx, freeze, ActionExpired, expiryActor)
+		m.logger.WithFields(logrus.Fields{
+			"freeze_id": freeze.ID,
+			"scope":     freeze.Scope,
+		}).Info("Freeze expired")
+	}
+
+	m.mu.Lock()
+	m.active = active
+	var released []func(ctx context.Context)
+	for operation, callbacks := range m.releases {
+		blocked := blocking(active, operation, now) != nil
+		if m.blocked[operation] && !blocked {
+			released = append(released, callbacks...)
+		}
+		m.blocked[operation] = blocked
+	}
+	m.mu.Unlock()
+
+	for _, release := range released {
+		release(ctx)
+	}
+	return nil
+}
+
+// blocking returns the first freeze blocking an operation
+func blocking(freezes []*Freeze, operation Operation, now time.Time) *Freeze {
+	for _, freeze := range freezes {
+		if freeze.Active(now) && freeze.Scope.Blocks(operation) {
+			return freeze
+		}
+	}
+	return nil
+}
+
+// Active returns the freezes in effect, the oldest first
+func (m *Manager) Active() []*Freeze {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := m.now()
+	freezes := make([]*Freeze, 0, len(m.active))
+	for _, freeze := range m.active {
+		if freeze.Active(now) {
+			freezes = append(freezes, freeze)
+		}
+	}
+	return freezes
+}
+
+// Check returns a FrozenError when a freeze blocks an operation
+func (m *Manager) Check(operation Operation) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if freeze := blocking(m.active, operation, m.now()); freeze != nil {
+		return &FrozenError{Freeze: freeze, Operation: operation}
+	}
+	return nil
+}
+
+// Hold returns a Hold holding the operations of a kind while a freeze
+// blocks them
+func (m *Manager) Hold(operation Operation) Hold {
+	return hold{manager: m, operation: operation}
+}
+
+// OnRelease registers a callback run when the operations of a kind are no
+// longer blocked, the freeze blocking them being lifted or expired
+func (m *Manager) OnRelease(operation Operation, fn func(ctx context.Context)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.releases[operation] = append(m.releases[operation], fn)
+	m.blocked[operation] = blocking(m.active, operation, m.now()) != nil
+}
+
+// Banner returns the freezes in effect for system information and the
+// dashboard banner
+func (m *Manager) Banner() *Banner {
+	freezes := m.Active()
+	banner := &Banner{Frozen: len(freezes) > 0, Freezes: freezes}
+	if !banner.Frozen {
+		return banner
+	}
+
+	// The widest scope in effect leads the message
+	lead := freezes[0]
+	for _, freeze := range freezes {
+		if freeze.Scope == ScopeAllWrites {
+			lead = freeze
+			break
+		}
+	}
+	banner.Message = fmt.Sprintf("%s frozen: %s", scopeLabel(lead.Scope), lead.Reason)
+	if lead.ExpiresAt != nil {
+		banner.Message += fmt.Sprintf(" (until %s)", lead.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if len(freezes) > 1 {
+		banner.Message += fmt.Sprintf(", and %d more freezes", len(freezes)-1)
+	}
+	return banner
+}
+
+// scopeLabel names what a scope freezes in banner messages
+func scopeLabel(scope Scope) string {
+	switch scope {
+	case ScopeExecutions:
+		return "Executions"
+	case ScopeDefinitions:
+		return "Workflow definitions"
+	}
+	return "All writes"
+}
+
+// ListAudit returns the latest freeze audit entries, the most recent first
+func (m *Manager) ListAudit(ctx context.Context, limit int) ([]*AuditEntry, error) {
+	return m.store.ListAudit(ctx, limit)
+}
+
+// audit records a freeze audit entry. Failures are logged, the freeze
+// already being in effect.
+func (m *Manager) audit(ctx context.Context, freeze *Freeze, action, actor string) {
+	entry := &AuditEntry{
+		FreezeID:  freeze.ID,
+		Action:    action,
+		Scope:     freeze.Scope,
+		Reason:    freeze.Reason,
+		Actor:     actor,
+		ExpiresAt: freeze.ExpiresAt,
+		CreatedAt: m.now().UTC(),
+	}
+	if err := m.store.RecordAudit(ctx, entry); err != nil {
+		m.logger.WithError(err).WithFields(logrus.Fields{
+			"freeze_id": freeze.ID,
+			"action":    action,
+		}).Error("Failed to audit freeze")
+	}
+}
+
+// Start refreshes the freezes at the given interval until Stop is called
+func (m *Manager) Start(ctx context.Context, interval time.Duration) {
+	m.stopCh = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Refresh(ctx); err != nil {
+					m.logger.WithError(err).Error("Freeze refresh failed")
+				}
+			case <-m.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops refreshing the freezes
+func (m *Manager) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.stopCh = nil
+}
@@ -0,0 +1,109 @@
+package freeze
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rule classifies the API routes it matches as an operation. Method is
+// empty for every method, Path is a route path as registered, such as
+// /api/v1/executions/:id/cancel, or a path prefix when Prefix is set.
+type Rule struct {
+	Method    string
+	Path      string
+	Prefix    bool
+	Operation Operation
+}
+
+func (r Rule) matches(method, path string) bool {
+	if r.Method != "" && r.Method != method {
+		return false
+	}
+	if r.Prefix {
+		return strings.HasPrefix(path, r.Path)
+	}
+	return path == r.Path
+}
+
+// DefaultRules classify the routes of the server. Exempt rules are the
+// allowlist of the operations needed for safety during an incident:
+// cancellations, node drains, lock releases and lifting freezes. Webhook
+// triggers are exempt because the triggers hold their executions
+// themselves rather than rejecting the deliveries.
+var DefaultRules = []Rule{
+	{Method: http.MethodPost, Path: "/api/v1/system/freeze", Operation: OperationExempt},
+	{Method: http.MethodDelete, Path: "/api/v1/system/freeze/:id", Operation: OperationExempt},
+	{Method: http.MethodPost, Path: "/api/v1/executions/:id/cancel", Operation: OperationExempt},
+	{Method: http.MethodPost, Path: "/api/v1/backfills/:id/cancel", Operation: OperationExempt},
+	{Method: http.MethodPost, Path: "/api/v1/backfills/:id/pause", Operation: OperationExempt},
+	{Method: http.MethodPost, Path: "/api/v1/nodes/:id/cordon", Operation: OperationExempt},
+	{Method: http.MethodPost, Path: "/api/v1/nodes/:id/uncordon", Operation: OperationExempt},
+	{Method: http.MethodPost, Path: "/api/v1/locks/:name/force-release", Operation: OperationExempt},
+	{Method: http.MethodPost, Path: "/api/v1/triggers/webhooks/:name", Operation: OperationExempt},
+
+	// Validations, previews and dry runs change nothing
+	{Method: http.MethodPost, Path: "/api/v1/workflows/:id/validate", Operation: OperationRead},
+	{Method: http.MethodPost, Path: "/api/v1/workflows/:id/preflight", Operation: OperationRead},
+	{Method: http.MethodPost, Path: "/api/v1/workflows/:id/steps/:step/contract-test", Operation: OperationRead},
+	{Method: http.MethodPost, Path: "/api/v1/schedules/preview", Operation: OperationRead},
+	{Method: http.MethodPost, Path: "/api/v1/policies/test", Operation: OperationRead},
+	{Method: http.MethodPost, Path: "/api/v1/policies/:id/test", Operation: OperationRead},
+	{Method: http.MethodPost, Path: "/api/v1/triage/dry-run", Operation: OperationRead},
+
+	{Method: http.MethodPost, Path: "/api/v1/executions/workflows/:id/execute", Operation: OperationExecution},
+	{Method: http.MethodPost, Path: "/api/v1/executions/:id/retry", Operation: OperationExecution},
+	{Method: http.MethodPost, Path: "/api/v1/executions/:id/replay", Operation: OperationExecution},
+	{Method: http.MethodPost, Path: "/api/v1/dev/workflows/:name/executions", Operation: OperationExecution},
+	{Path: "/api/v1/execution-groups", Prefix: true, Operation: OperationExecution},
+	{Path: "/api/v1/backfills", Prefix: true, Operation: OperationExecution},
+
+	{Path: "/api/v1/workflows", Prefix: true, Operation: OperationDefinition},
+	{Path: "/api/v1/versions", Prefix: true, Operation: OperationDefinition},
+	{Method: http.MethodPost, Path: "/api/v1/changesets", Operation: OperationDefinition},
+}
+
+// Middleware rejects the API requests a freeze blocks with 423 Locked,
+// carrying the reason and expiry of the freeze. Reads are never blocked,
+// other requests are classified by the first rule matching their route,
+// requests matching none being writes.
+func Middleware(manager *Manager, rules []Rule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		if path == "" || !strings.HasPrefix(path, "/api/") {
+			c.Next()
+			return
+		}
+
+		err := manager.Check(classify(rules, c.Request.Method, path))
+		var frozen *FrozenError
+		if !errors.As(err, &frozen) {
+			c.Next()
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusLocked, gin.H{
+			"error":      err.Error(),
+			"freeze_id":  frozen.Freeze.ID,
+			"scope":      frozen.Freeze.Scope,
+			"reason":     frozen.Freeze.Reason,
+			"expires_at": frozen.Freeze.ExpiresAt,
+		})
+	}
+}
+
+// classify returns the operation of a request
+func classify(rules []Rule, method, path string) Operation {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return OperationRead
+	}
+	for _, rule := range rules {
+		if rule.matches(method, path) {
+			return rule.Operation
+		}
+	}
+	return OperationWrite
+}
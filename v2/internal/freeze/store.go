@@ -0,0 +1,276 @@
+package freeze
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists freezes and their audit log
+type Store interface {
+	Create(ctx context.Context, freeze *Freeze) error
+	Get(ctx context.Context, id uuid.UUID) (*Freeze, error)
+	// ListActive returns the freezes not ended, expired ones included, the
+	// oldest first
+	ListActive(ctx context.Context) ([]*Freeze, error)
+	// End ends a freeze, returning ErrFreezeEnded when it already ended so
+	// that servers racing to expire a freeze audit it once
+	End(ctx context.Context, id uuid.UUID, at time.Time, by string) error
+
+	RecordAudit(ctx context.Context, entry *AuditEntry) error
+	// ListAudit returns the latest audit entries, the most recent first
+	ListAudit(ctx context.Context, limit int) ([]*AuditEntry, error)
+
+	// HoldWebhook stores a held webhook, returning ErrHoldFull when limit
+	// webhooks are held already. A limit of zero does not bound them.
+	HoldWebhook(ctx context.Context, webhook *HeldWebhook, limit int) error
+	// TakeHeldWebhooks removes and returns up to limit held webhooks, the
+	// oldest first. Servers taking held webhooks at once take distinct
+	// ones.
+	TakeHeldWebhooks(ctx context.Context, limit int) ([]*HeldWebhook, error)
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu       sync.RWMutex
+	freezes  map[uuid.UUID]*Freeze
+	audit    []*AuditEntry
+	webhooks []*HeldWebhook
+}
+
+// NewMemoryStore creates an in-memory freeze store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{freezes: make(map[uuid.UUID]*Freeze)}
+}
+
+// Create stores a new freeze
+func (s *MemoryStore) Create(ctx context.Context, freeze *Freeze) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *freeze
+	s.freezes[freeze.ID] = &stored
+	return nil
+}
+
+// Get returns a freeze
+func (s *MemoryStore) Get(ctx context.Context, id uuid.UUID) (*Freeze, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	freeze, exists := s.freezes[id]
+	if !exists {
+		return nil, ErrFreezeNotFound
+	}
+	found := *freeze
+	return &found, nil
+}
+
+// ListActive returns the freezes not ended, the oldest first
+func (s *MemoryStore) ListActive(ctx context.Context) ([]*Freeze, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var freezes []*Freeze
+	for _, freeze := range s.freezes {
+		if freeze.EndedAt == nil {
+			found := *freeze
+			freezes = append(freezes, &found)
+		}
+	}
+	sort.Slice(freezes, func(i, j int) bool {
+		return freezes[i].CreatedAt.Before(freezes[j].CreatedAt)
+	})
+	return freezes, nil
+}
+
+// End ends a freeze
+func (s *MemoryStore) End(ctx context.Context, id uuid.UUID, at time.Time, by string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	freeze, exists := s.freezes[id]
+	if !exists {
+		return ErrFreezeNotFound
+	}
+	if freeze.EndedAt != nil {
+		return ErrFreezeEnded
+	}
+	freeze.EndedAt = &at
+	freeze.EndedBy = by
+	return nil
+}
+
+// RecordAudit stores an audit entry
+func (s *MemoryStore) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = uint(len(s.audit) + 1)
+	stored := *entry
+	s.audit = append(s.audit, &stored)
+	return nil
+}
+
+// ListAudit returns the latest audit entries, the most recent first
+func (s *MemoryStore) ListAudit(ctx context.Context, limit int) ([]*AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []*AuditEntry
+	for i := len(s.audit) - 1; i >= 0 && (limit <= 0 || len(entries) < limit); i-- {
+		entry := *s.audit[i]
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// HoldWebhook stores a held webhook
+func (s *MemoryStore) HoldWebhook(ctx context.Context, webhook *HeldWebhook, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limit > 0 && len(s.webhooks) >= limit {
+		return ErrHoldFull
+	}
+	stored := *webhook
+	s.webhooks = append(s.webhooks, &stored)
+	return nil
+}
+
+// TakeHeldWebhooks removes and returns the oldest held webhooks
+func (s *MemoryStore) TakeHeldWebhooks(ctx context.Context, limit int) ([]*HeldWebhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := len(s.webhooks)
+	if limit > 0 && count > limit {
+		count = limit
+	}
+	taken := s.webhooks[:count:count]
+	s.webhooks = s.webhooks[count:]
+	return taken, nil
+}
+
+// GormStore keeps freezes in the system_freezes table, ending them by setting
+// their end time, their audit entries in the system_freeze_audit table and
+// the webhooks they hold in the held_webhooks table
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database freeze store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the freeze, audit and held webhook tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Freeze{}, &AuditEntry{}, &HeldWebhook{})
+}
+
+// Create stores a new freeze
+func (s *GormStore) Create(ctx context.Context, freeze *Freeze) error {
+	return s.db.WithContext(ctx).Create(freeze).Error
+}
+
+// Get returns a freeze
+func (s *GormStore) Get(ctx context.Context, id uuid.UUID) (*Freeze, error) {
+	var freeze Freeze
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&freeze).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFreezeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &freeze, nil
+}
+
+// ListActive returns the freezes not ended, the oldest first
+func (s *GormStore) ListActive(ctx context.Context) ([]*Freeze, error) {
+	var freezes []*Freeze
+	err := s.db.WithContext(ctx).Where("ended_at IS NULL").Order("created_at").Find(&freezes).Error
+	return freezes, err
+}
+
+// End ends a freeze. The update only matches freezes not ended yet, so a
+// single server ends each freeze.
+func (s *GormStore) End(ctx context.Context, id uuid.UUID, at time.Time, by string) error {
+	result := s.db.WithContext(ctx).Model(&Freeze{}).
+		Where("id = ? AND ended_at IS NULL", id).
+		Updates(map[string]interface{}{"ended_at": at, "ended_by": by})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(ctx, id); err != nil {
+			return err
+		}
+		return ErrFreezeEnded
+	}
+	return nil
+}
+
+// RecordAudit stores an audit entry
+func (s *GormStore) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	return s.db.WithContext(ctx).Create(entry).Error
+}
+
+// ListAudit returns the latest audit entries, the most recent first
+func (s *GormStore) ListAudit(ctx context.Context, limit int) ([]*AuditEntry, error) {
+	query := s.db.WithContext(ctx).Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var entries []*AuditEntry
+	return entries, query.Find(&entries).Error
+}
+
+// HoldWebhook stores a held webhook. The held webhooks are counted before
+// the webhook is stored, so servers holding webhooks at once may exceed the
+// limit by a few.
+func (s *GormStore) HoldWebhook(ctx context.Context, webhook *HeldWebhook, limit int) error {
+	if limit > 0 {
+		var held int64
+		if err := s.db.WithContext(ctx).Model(&HeldWebhook{}).Count(&held).Error; err != nil {
+			return err
+		}
+		if held >= int64(limit) {
+			return ErrHoldFull
+		}
+	}
+	return s.db.WithContext(ctx).Create(webhook).Error
+}
+
+// TakeHeldWebhooks removes and returns the oldest held webhooks. Rows are
+// locked so that servers releasing held webhooks at once each take a
+// webhook at most once.
+func (s *GormStore) TakeHeldWebhooks(ctx context.Context, limit int) ([]*HeldWebhook, error) {
+	var taken []*HeldWebhook
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).Order("created_at, id")
+		if limit > 0 {
+			query = query.Limit(limit)
+		}
+		if err := query.Find(&taken).Error; err != nil || len(taken) == 0 {
+			return err
+		}
+
+		ids := make([]uuid.UUID, len(taken))
+		for i, webhook := range taken {
+			ids[i] = webhook.ID
+		}
+		return tx.Where("id IN ?", ids).Delete(&HeldWebhook{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return taken, nil
+}
@@ -0,0 +1,434 @@
+package gates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// maxReasonIssues is the number of lint issues quoted in the reason of an
+// unsatisfied lint-clean gate
+const maxReasonIssues = 3
+
+// Versions looks up the versions gates are evaluated for. It is satisfied
+// by versioning.Manager.
+type Versions interface {
+	// GateVersion returns ErrVersionNotFound for unknown versions
+	GateVersion(ctx context.Context, versionID uuid.UUID) (*Version, error)
+}
+
+// Linter reports the validation errors and warnings of the definition of a
+// version. It is satisfied by versioning.Manager.
+type Linter interface {
+	LintVersion(ctx context.Context, versionID uuid.UUID) ([]string, error)
+}
+
+// Directory resolves the groups and roles of users. It is satisfied by the
+// directories of approval policies.
+type Directory interface {
+	Memberships(ctx context.Context, user string) ([]string, error)
+}
+
+// Checker evaluates the checklists of versions
+type Checker struct {
+	config    Config
+	store     Store
+	versions  Versions
+	linter    Linter
+	directory Directory
+	client    *http.Client
+	logger    *logrus.Logger
+	now       func() time.Time
+}
+
+// NewChecker creates a checker of the checklists of config
+func NewChecker(config Config, store Store, versions Versions, logger *logrus.Logger) *Checker {
+	if config.WebhookTimeout <= 0 {
+		config.WebhookTimeout = DefaultWebhookTimeout
+	}
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &Checker{
+		config:   config,
+		store:    store,
+		versions: versions,
+		client:   &http.Client{},
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// SetLinter sets the linter of lint-clean gates. Without one, lint-clean
+// gates are unsatisfied.
+func (c *Checker) SetLinter(linter Linter) {
+	c.linter = linter
+}
+
+// SetDirectory sets the directory resolving the group: and role:
+// overriders
+func (c *Checker) SetDirectory(directory Directory) {
+	c.directory = directory
+}
+
+type overrideKey struct{}
+
+type override struct {
+	actor         string
+	justification string
+}
+
+// WithOverride returns a context activating versions despite unsatisfied
+// gates on behalf of actor, who must be permitted to override them
+func WithOverride(ctx context.Context, actor, justification string) context.Context {
+	return context.WithValue(ctx, overrideKey{}, override{actor: actor, justification: justification})
+}
+
+// Evaluate evaluates every gate of the checklist of a version. Nothing is
+// cached: reviews, simulation runs and webhooks are consulted again on
+// each call.
+func (c *Checker) Evaluate(ctx context.Context, versionID uuid.UUID) (*Report, error) {
+	version, err := c.versions.GateVersion(ctx, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := version.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	report := &Report{
+		VersionID: versionID,
+		Namespace: namespace,
+		Satisfied: true,
+		Gates:     []Result{},
+	}
+	for _, gate := range c.config.checklist(namespace) {
+		result := c.evaluateGate(ctx, gate, version)
+		report.Gates = append(report.Gates, result)
+		report.Satisfied = report.Satisfied && result.Satisfied
+	}
+	report.EvaluatedAt = c.now()
+	return report, nil
+}
+
+// CheckActivation evaluates the gates of a version being activated. It
+// returns a BlockedError when gates are unsatisfied, unless the context
+// carries the override of a permitted user with a justification, which is
+// then audited.
+func (c *Checker) CheckActivation(ctx context.Context, versionID uuid.UUID) (*Report, error) {
+	report, err := c.Evaluate(ctx, versionID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Satisfied {
+		return report, nil
+	}
+
+	requested, ok := ctx.Value(overrideKey{}).(override)
+	if !ok {
+		return report, &BlockedError{Report: report}
+	}
+	if strings.TrimSpace(requested.justification) == "" {
+		return report, ErrJustificationRequired
+	}
+	permitted, err := c.permitted(ctx, requested.actor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve override permission: %w", err)
+	}
+	if !permitted {
+		return report, fmt.Errorf("%w: %q", ErrOverrideForbidden, requested.actor)
+	}
+
+	version, err := c.versions.GateVersion(ctx, versionID)
+	if err != nil {
+		return nil, err
+	}
+	record := &Override{
+		ID:            uuid.New(),
+		VersionID:     versionID,
+		WorkflowID:    version.WorkflowID,
+		Actor:         requested.actor,
+		Justification: requested.justification,
+		Unsatisfied:   report.Unsatisfied(),
+		CreatedAt:     c.now(),
+	}
+	if err := c.store.RecordOverride(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to audit gate override: %w", err)
+	}
+	report.Override = record
+
+	c.logger.WithFields(logrus.Fields{
+		"version_id":    versionID,
+		"actor":         record.Actor,
+		"justification": record.Justification,
+		"unsatisfied":   record.Unsatisfied,
+	}).Warn("Activation gates overridden")
+	return report, nil
+}
+
+// ListOverrides returns the latest overrides of a version, or of every
+// version for uuid.Nil, the most recent first
+func (c *Checker) ListOverrides(ctx context.Context, versionID uuid.UUID, limit int) ([]*Override, error) {
+	return c.store.ListOverrides(ctx, versionID, limit)
+}
+
+// RecordReview records the review of a version. Authors may not review
+// their own versions.
+func (c *Checker) RecordReview(ctx context.Context, review *Review) error {
+	if review.Reviewer == "" {
+		return fmt.Errorf("%w: a reviewer is required", ErrInvalidRecord)
+	}
+	version, err := c.versions.GateVersion(ctx, review.VersionID)
+	if err != nil {
+		return err
+	}
+	if review.Reviewer == version.Author {
+		return fmt.Errorf("%w: the author of a version may not review it", ErrInvalidRecord)
+	}
+
+	review.ID = uuid.New()
+	review.CreatedAt = c.now()
+	return c.store.RecordReview(ctx, review)
+}
+
+// RecordSimulation records a simulation run of a version
+func (c *Checker) RecordSimulation(ctx context.Context, simulation *Simulation) error {
+	if simulation.Cases < 0 || simulation.Failures < 0 || simulation.Failures > simulation.Cases {
+		return fmt.Errorf("%w: failures must be between 0 and the number of cases", ErrInvalidRecord)
+	}
+	if _, err := c.versions.GateVersion(ctx, simulation.VersionID); err != nil {
+		return err
+	}
+
+	simulation.ID = uuid.New()
+	if simulation.RanAt.IsZero() {
+		simulation.RanAt = c.now()
+	}
+	return c.store.RecordSimulation(ctx, simulation)
+}
+
+// RecordNotification records that the impact of a version was notified
+func (c *Checker) RecordNotification(ctx context.Context, notification *ImpactNotification) error {
+	if len(notification.Recipients) == 0 {
+		return fmt.Errorf("%w: at least one recipient is required", ErrInvalidRecord)
+	}
+	if _, err := c.versions.GateVersion(ctx, notification.VersionID); err != nil {
+		return err
+	}
+
+	notification.ID = uuid.New()
+	notification.SentAt = c.now()
+	return c.store.RecordNotification(ctx, notification)
+}
+
+// permitted reports whether a user may override gates, directly or
+// through one of their groups and roles
+func (c *Checker) permitted(ctx context.Context, actor string) (bool, error) {
+	if actor == "" {
+		return false, nil
+	}
+	references := []string{UserPrefix + actor}
+	if c.directory != nil {
+		memberships, err := c.directory.Memberships(ctx, actor)
+		if err != nil {
+			return false, err
+		}
+		references = append(references, memberships...)
+	}
+	for _, overrider := range c.config.Overriders {
+		for _, reference := range references {
+			if overrider == reference {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (c *Checker) evaluateGate(ctx context.Context, gate Gate, version *Version) Result {
+	result := Result{Name: gate.name(), Type: gate.Type}
+	var err error
+	switch gate.Type {
+	case TypeLintClean:
+		result.Satisfied, result.Reason, err = c.lintClean(ctx, version)
+	case TypeSimulationPassed:
+		result.Satisfied, result.Reason, err = c.simulationPassed(ctx, gate, version)
+	case TypeSecondPersonReview:
+		result.Satisfied, result.Reason, err = c.secondPersonReview(ctx, version)
+	case TypeImpactNotificationSent:
+		result.Satisfied, result.Reason, err = c.impactNotified(ctx, version)
+	case TypeWebhook:
+		result.Satisfied, result.Reason = c.webhookVerdict(ctx, gate, version)
+	default:
+		result.Reason = fmt.Sprintf("unknown gate type %q", gate.Type)
+	}
+	if err != nil {
+		// Gates that cannot be evaluated fail closed
+		result.Satisfied = false
+		result.Reason = fmt.Sprintf("gate could not be evaluated: %v", err)
+	}
+	return result
+}
+
+func (c *Checker) lintClean(ctx context.Context, version *Version) (bool, string, error) {
+	if c.linter == nil {
+		return false, "no linter is configured", nil
+	}
+	issues, err := c.linter.LintVersion(ctx, version.ID)
+	if err != nil {
+		return false, "", err
+	}
+	if len(issues) == 0 {
+		return true, "", nil
+	}
+
+	quoted := issues
+	if len(quoted) > maxReasonIssues {
+		quoted = quoted[:maxReasonIssues]
+	}
+	reason := fmt.Sprintf("%d lint issues: %s", len(issues), strings.Join(quoted, "; "))
+	if len(issues) > maxReasonIssues {
+		reason += fmt.Sprintf("; and %d more", len(issues)-maxReasonIssues)
+	}
+	return false, reason, nil
+}
+
+func (c *Checker) simulationPassed(ctx context.Context, gate Gate, version *Version) (bool, string, error) {
+	simulations, err := c.store.ListSimulations(ctx, version.ID)
+	if err != nil {
+		return false, "", err
+	}
+
+	var latest *Simulation
+	for _, simulation := range simulations {
+		if gate.Suite != "" && simulation.Suite != gate.Suite {
+			continue
+		}
+		if latest == nil || !simulation.RanAt.Before(latest.RanAt) {
+			latest = simulation
+		}
+	}
+	switch {
+	case latest == nil && gate.Suite != "":
+		return false, fmt.Sprintf("no simulation run of suite %s is recorded", gate.Suite), nil
+	case latest == nil:
+		return false, "no simulation run is recorded", nil
+	case !latest.Passed:
+		return false, fmt.Sprintf("latest simulation run %s failed %d of %d cases", latest.ID, latest.Failures, latest.Cases), nil
+	}
+	return true, fmt.Sprintf("simulation run %s passed %d cases", latest.ID, latest.Cases), nil
+}
+
+func (c *Checker) secondPersonReview(ctx context.Context, version *Version) (bool, string, error) {
+	reviews, err := c.store.ListReviews(ctx, version.ID)
+	if err != nil {
+		return false, "", err
+	}
+
+	// The latest review of each reviewer counts
+	latest := make(map[string]*Review)
+	var reviewers []string
+	for _, review := range reviews {
+		if review.Reviewer == version.Author {
+			continue
+		}
+		if _, seen := latest[review.Reviewer]; !seen {
+			reviewers = append(reviewers, review.Reviewer)
+		}
+		latest[review.Reviewer] = review
+	}
+
+	var rejected []string
+	for _, reviewer := range reviewers {
+		if latest[reviewer].Approved {
+			return true, "approved by " + reviewer, nil
+		}
+		rejected = append(rejected, reviewer)
+	}
+	if len(rejected) > 0 {
+		return false, "changes requested by " + strings.Join(rejected, ", "), nil
+	}
+	return false, "no approving review by someone other than the author", nil
+}
+
+func (c *Checker) impactNotified(ctx context.Context, version *Version) (bool, string, error) {
+	notifications, err := c.store.ListNotifications(ctx, version.ID)
+	if err != nil {
+		return false, "", err
+	}
+	if len(notifications) == 0 {
+		return false, "the impact of the version was not notified", nil
+	}
+	latest := notifications[len(notifications)-1]
+	return true, "notified " + strings.Join(latest.Recipients, ", "), nil
+}
+
+// webhookRequest is the body posted to webhook gates
+type webhookRequest struct {
+	Gate    string   `json:"gate"`
+	Version *Version `json:"version"`
+}
+
+// webhookResponse is the verdict of a webhook gate
+type webhookResponse struct {
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// webhookVerdict posts the version to the webhook of a gate, which passes
+// on a 2xx answer with a pass verdict. Errors and timeouts fail the gate.
+func (c *Checker) webhookVerdict(ctx context.Context, gate Gate, version *Version) (bool, string) {
+	timeout := gate.Timeout
+	if timeout <= 0 {
+		timeout = c.config.WebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	payload, err := json.Marshal(webhookRequest{Gate: gate.name(), Version: version})
+	if err != nil {
+		return false, fmt.Sprintf("failed to encode webhook request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gate.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Sprintf("invalid webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false, fmt.Sprintf("webhook timed out after %s", timeout)
+	}
+	if err != nil {
+		return false, fmt.Sprintf("webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Sprintf("webhook answered status %d", resp.StatusCode)
+	}
+	var verdict webhookResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&verdict); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return false, fmt.Sprintf("webhook timed out after %s", timeout)
+		}
+		return false, fmt.Sprintf("invalid webhook verdict: %v", err)
+	}
+	if !strings.EqualFold(verdict.Verdict, "pass") {
+		if verdict.Reason != "" {
+			return false, fmt.Sprintf("webhook verdict %q: %s", verdict.Verdict, verdict.Reason)
+		}
+		return false, fmt.Sprintf("webhook verdict %q", verdict.Verdict)
+	}
+	return true, verdict.Reason
+}
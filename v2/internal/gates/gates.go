@@ -0,0 +1,245 @@
+// Package gates implements the promotion checklists workflow versions must
+// satisfy before they are activated. Each namespace configures its
+// checklist from the built-in gate types: a clean lint of the definition,
+// a passed simulation run recorded for the version, the approving review of
+// someone other than its author, the notification of its impact, and
+// webhooks asking an external system for a verdict. Gates are evaluated
+// afresh each time, so an activation is never allowed on a stale result.
+// Users permitted to override may activate a version failing its gates with
+// a justification, which is audited.
+package gates
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type is the type of a gate
+type Type string
+
+const (
+	// TypeLintClean requires the definition of the version to validate
+	// without errors or warnings
+	TypeLintClean Type = "lint-clean"
+	// TypeSimulationPassed requires the latest simulation run recorded for
+	// the version to have passed
+	TypeSimulationPassed Type = "simulation-passed"
+	// TypeSecondPersonReview requires an approving review of someone other
+	// than the author of the version
+	TypeSecondPersonReview Type = "second-person-review"
+	// TypeImpactNotificationSent requires the impact of the version to
+	// have been notified
+	TypeImpactNotificationSent Type = "impact-notification-sent"
+	// TypeWebhook calls an external system which must answer a pass
+	// verdict
+	TypeWebhook Type = "webhook"
+)
+
+// Valid reports whether t is a known gate type
+func (t Type) Valid() bool {
+	switch t {
+	case TypeLintClean, TypeSimulationPassed, TypeSecondPersonReview, TypeImpactNotificationSent, TypeWebhook:
+		return true
+	}
+	return false
+}
+
+// DefaultNamespace is the namespace of versions whose definition names
+// none
+const DefaultNamespace = "default"
+
+// DefaultWebhookTimeout bounds the calls of webhook gates without a
+// timeout of their own
+const DefaultWebhookTimeout = 10 * time.Second
+
+var (
+	// ErrBlocked is returned when activating a version failing its gates
+	ErrBlocked = errors.New("activation blocked by unsatisfied gates")
+	// ErrOverrideForbidden is returned when a user without the override
+	// permission overrides the gates
+	ErrOverrideForbidden = errors.New("user is not permitted to override activation gates")
+	// ErrJustificationRequired is returned for overrides without a
+	// justification
+	ErrJustificationRequired = errors.New("a justification is required to override activation gates")
+	// ErrVersionNotFound is returned for gates of unknown versions
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrInvalidRecord is returned for reviews, simulation runs and impact
+	// notifications missing a field, and for self-reviews
+	ErrInvalidRecord = errors.New("invalid gate record")
+)
+
+// Gate is a gate of a checklist
+type Gate struct {
+	// Name identifies the gate in reports, its type when empty
+	Name string `json:"name"`
+	Type Type   `json:"type"`
+	// Suite is the simulation suite whose runs a simulation-passed gate
+	// considers, any suite when empty
+	Suite string `json:"suite,omitempty"`
+	// URL is the endpoint a webhook gate posts the version to
+	URL string `json:"url,omitempty"`
+	// Timeout bounds the call of a webhook gate, the checker's webhook
+	// timeout when zero
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// name returns the name of the gate in reports
+func (g Gate) name() string {
+	if g.Name != "" {
+		return g.Name
+	}
+	return string(g.Type)
+}
+
+// Validate checks the type of the gate and the URL of webhook gates
+func (g Gate) Validate() error {
+	if !g.Type.Valid() {
+		return fmt.Errorf("unknown gate type %q", g.Type)
+	}
+	if g.Timeout < 0 {
+		return fmt.Errorf("gate %s: timeout must not be negative", g.name())
+	}
+	if g.Type != TypeWebhook {
+		return nil
+	}
+	parsed, err := url.Parse(g.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("gate %s: webhook gates need an http or https URL", g.name())
+	}
+	return nil
+}
+
+// Config configures the checklists of the namespaces
+type Config struct {
+	// Checklist is the checklist of the namespaces without one of their own
+	Checklist []Gate
+	// Namespaces overrides the checklist per namespace, an empty checklist
+	// leaving the versions of the namespace ungated
+	Namespaces map[string][]Gate
+	// Overriders are the users permitted to override the gates, as user:,
+	// group: and role: references
+	Overriders []string
+	// WebhookTimeout bounds the calls of webhook gates without a timeout
+	// of their own, DefaultWebhookTimeout when zero
+	WebhookTimeout time.Duration
+}
+
+// Validate checks every gate of the checklists and the overrider
+// references
+func (c Config) Validate() error {
+	checklists := map[string][]Gate{"": c.Checklist}
+	for namespace, gates := range c.Namespaces {
+		checklists[namespace] = gates
+	}
+	for namespace, gates := range checklists {
+		names := make(map[string]bool)
+		for _, gate := range gates {
+			if err := gate.Validate(); err != nil {
+				return checklistError(namespace, err)
+			}
+			if names[gate.name()] {
+				return checklistError(namespace, fmt.Errorf("duplicate gate %s", gate.name()))
+			}
+			names[gate.name()] = true
+		}
+	}
+	for _, reference := range c.Overriders {
+		if !validReference(reference) {
+			return fmt.Errorf("invalid overrider %q: expected a user:, group: or role: reference", reference)
+		}
+	}
+	return nil
+}
+
+func checklistError(namespace string, err error) error {
+	if namespace == "" {
+		return fmt.Errorf("default checklist: %w", err)
+	}
+	return fmt.Errorf("checklist of namespace %s: %w", namespace, err)
+}
+
+// checklist returns the gates of the versions of a namespace
+func (c Config) checklist(namespace string) []Gate {
+	if gates, ok := c.Namespaces[namespace]; ok {
+		return gates
+	}
+	return c.Checklist
+}
+
+// Reference prefixes of overriders, as in approval policies
+const (
+	UserPrefix  = "user:"
+	GroupPrefix = "group:"
+	RolePrefix  = "role:"
+)
+
+func validReference(reference string) bool {
+	for _, prefix := range []string{UserPrefix, GroupPrefix, RolePrefix} {
+		if strings.HasPrefix(reference, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(reference, prefix)) != ""
+		}
+	}
+	return false
+}
+
+// Version is the version of a workflow the gates are evaluated for
+type Version struct {
+	ID         uuid.UUID `json:"id"`
+	WorkflowID uuid.UUID `json:"workflow_id"`
+	Version    string    `json:"version"`
+	Namespace  string    `json:"namespace"`
+	// Author is the user who created the version
+	Author string `json:"author"`
+}
+
+// Result is the outcome of one gate
+type Result struct {
+	Name      string `json:"name"`
+	Type      Type   `json:"type"`
+	Satisfied bool   `json:"satisfied"`
+	// Reason explains why the gate is unsatisfied, or what satisfied it
+	Reason string `json:"reason,omitempty"`
+}
+
+// Report is the checklist of a version, evaluated at EvaluatedAt
+type Report struct {
+	VersionID   uuid.UUID `json:"version_id"`
+	Namespace   string    `json:"namespace"`
+	Satisfied   bool      `json:"satisfied"`
+	Gates       []Result  `json:"gates"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+	// Override is the override the version was activated with despite
+	// unsatisfied gates
+	Override *Override `json:"override,omitempty"`
+}
+
+// Unsatisfied returns the names of the unsatisfied gates
+func (r *Report) Unsatisfied() []string {
+	names := make([]string, 0)
+	for _, gate := range r.Gates {
+		if !gate.Satisfied {
+			names = append(names, gate.Name)
+		}
+	}
+	return names
+}
+
+// BlockedError is returned when activating a version failing its gates
+// without an override. Report lists every gate.
+type BlockedError struct {
+	Report *Report
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrBlocked, strings.Join(e.Report.Unsatisfied(), ", "))
+}
+
+// Is matches ErrBlocked
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
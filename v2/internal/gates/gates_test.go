@@ -0,0 +1,302 @@
+package gates
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVersions serves versions from a map
+type fakeVersions map[uuid.UUID]*Version
+
+func (f fakeVersions) GateVersion(ctx context.Context, versionID uuid.UUID) (*Version, error) {
+	version, ok := f[versionID]
+	if !ok {
+		return nil, ErrVersionNotFound
+	}
+	return version, nil
+}
+
+// fakeLinter returns the issues set on it
+type fakeLinter struct {
+	issues []string
+	calls  int
+}
+
+func (f *fakeLinter) LintVersion(ctx context.Context, versionID uuid.UUID) ([]string, error) {
+	f.calls++
+	return f.issues, nil
+}
+
+type fakeDirectory map[string][]string
+
+func (f fakeDirectory) Memberships(ctx context.Context, user string) ([]string, error) {
+	return f[user], nil
+}
+
+func newTestChecker(config Config) (*Checker, *Version) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	version := &Version{
+		ID:         uuid.New(),
+		WorkflowID: uuid.New(),
+		Version:    "1.1.0",
+		Namespace:  "payments",
+		Author:     "alice",
+	}
+	checker := NewChecker(config, NewMemoryStore(), fakeVersions{version.ID: version}, logger)
+	checker.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+	return checker, version
+}
+
+func checklist(gates ...Gate) Config {
+	return Config{Namespaces: map[string][]Gate{"payments": gates}}
+}
+
+func TestLintCleanGate(t *testing.T) {
+	ctx := context.Background()
+	checker, version := newTestChecker(checklist(Gate{Type: TypeLintClean}))
+
+	report, err := checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.False(t, report.Satisfied)
+	assert.Equal(t, "no linter is configured", report.Gates[0].Reason)
+
+	linter := &fakeLinter{issues: []string{"steps[0].name: required", "steps[1]: unknown flag beta", "a", "b"}}
+	checker.SetLinter(linter)
+	report, err = checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.False(t, report.Satisfied)
+	assert.Equal(t, "4 lint issues: steps[0].name: required; steps[1]: unknown flag beta; a; and 1 more", report.Gates[0].Reason)
+
+	// Gates are evaluated afresh on each call
+	linter.issues = nil
+	report, err = checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.True(t, report.Satisfied)
+	assert.Equal(t, 2, linter.calls)
+}
+
+func TestSimulationPassedGate(t *testing.T) {
+	ctx := context.Background()
+	checker, version := newTestChecker(checklist(
+		Gate{Name: "simulation", Type: TypeSimulationPassed},
+		Gate{Name: "regression", Type: TypeSimulationPassed, Suite: "regression"},
+	))
+
+	report, err := checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "no simulation run is recorded", report.Gates[0].Reason)
+	assert.Equal(t, "no simulation run of suite regression is recorded", report.Gates[1].Reason)
+
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, checker.RecordSimulation(ctx, &Simulation{VersionID: version.ID, Suite: "regression", Passed: true, Cases: 12, RanAt: start}))
+	failed := &Simulation{VersionID: version.ID, Suite: "smoke", Cases: 3, Failures: 1, RanAt: start.Add(time.Hour)}
+	require.NoError(t, checker.RecordSimulation(ctx, failed))
+
+	// The latest run counts, within the suite of the gate
+	report, err = checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.False(t, report.Gates[0].Satisfied)
+	assert.Equal(t, "latest simulation run "+failed.ID.String()+" failed 1 of 3 cases", report.Gates[0].Reason)
+	assert.True(t, report.Gates[1].Satisfied)
+
+	require.NoError(t, checker.RecordSimulation(ctx, &Simulation{VersionID: version.ID, Suite: "smoke", Passed: true, Cases: 3, RanAt: start.Add(2 * time.Hour)}))
+	report, err = checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.True(t, report.Satisfied)
+
+	assert.ErrorIs(t, checker.RecordSimulation(ctx, &Simulation{VersionID: version.ID, Cases: 1, Failures: 2}), ErrInvalidRecord)
+	assert.ErrorIs(t, checker.RecordSimulation(ctx, &Simulation{VersionID: uuid.New(), Passed: true}), ErrVersionNotFound)
+}
+
+func TestSecondPersonReviewGate(t *testing.T) {
+	ctx := context.Background()
+	checker, version := newTestChecker(checklist(Gate{Type: TypeSecondPersonReview}))
+
+	assert.ErrorIs(t, checker.RecordReview(ctx, &Review{VersionID: version.ID, Reviewer: "alice", Approved: true}), ErrInvalidRecord)
+
+	report, err := checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "no approving review by someone other than the author", report.Gates[0].Reason)
+
+	require.NoError(t, checker.RecordReview(ctx, &Review{VersionID: version.ID, Reviewer: "bob", Approved: true}))
+	require.NoError(t, checker.RecordReview(ctx, &Review{VersionID: version.ID, Reviewer: "bob", Comment: "retry budget too high"}))
+	report, err = checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.False(t, report.Satisfied)
+	assert.Equal(t, "changes requested by bob", report.Gates[0].Reason)
+
+	require.NoError(t, checker.RecordReview(ctx, &Review{VersionID: version.ID, Reviewer: "carol", Approved: true}))
+	report, err = checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.True(t, report.Satisfied)
+	assert.Equal(t, "approved by carol", report.Gates[0].Reason)
+}
+
+func TestImpactNotificationGate(t *testing.T) {
+	ctx := context.Background()
+	checker, version := newTestChecker(checklist(Gate{Type: TypeImpactNotificationSent}))
+
+	report, err := checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.False(t, report.Satisfied)
+
+	assert.ErrorIs(t, checker.RecordNotification(ctx, &ImpactNotification{VersionID: version.ID}), ErrInvalidRecord)
+	require.NoError(t, checker.RecordNotification(ctx, &ImpactNotification{VersionID: version.ID, Recipients: []string{"#payments", "billing-owners"}}))
+	report, err = checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.True(t, report.Satisfied)
+	assert.Equal(t, "notified #payments, billing-owners", report.Gates[0].Reason)
+
+	// Other namespaces use the default checklist
+	other := &Version{ID: uuid.New(), Namespace: "search"}
+	checker.versions = fakeVersions{version.ID: version, other.ID: other}
+	report, err = checker.Evaluate(ctx, other.ID)
+	require.NoError(t, err)
+	assert.True(t, report.Satisfied)
+	assert.Empty(t, report.Gates)
+}
+
+func TestWebhookGate(t *testing.T) {
+	ctx := context.Background()
+	verdict := `{"verdict":"fail","reason":"change window closed"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body webhookRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "change-management", body.Gate)
+		assert.Equal(t, "1.1.0", body.Version.Version)
+		w.Write([]byte(verdict))
+	}))
+	defer server.Close()
+
+	checker, version := newTestChecker(checklist(Gate{Name: "change-management", Type: TypeWebhook, URL: server.URL}))
+
+	report, err := checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.False(t, report.Satisfied)
+	assert.Equal(t, `webhook verdict "fail": change window closed`, report.Gates[0].Reason)
+
+	verdict = `{"verdict":"pass"}`
+	report, err = checker.Evaluate(ctx, version.ID)
+	require.NoError(t, err)
+	assert.True(t, report.Satisfied)
+}
+
+func TestWebhookGateTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte(`{"verdict":"pass"}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	checker, version := newTestChecker(checklist(Gate{Name: "change-management", Type: TypeWebhook, URL: server.URL, Timeout: 50 * time.Millisecond}))
+
+	started := time.Now()
+	report, err := checker.Evaluate(context.Background(), version.ID)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(started), time.Second)
+	assert.False(t, report.Satisfied)
+	assert.Equal(t, "webhook timed out after 50ms", report.Gates[0].Reason)
+
+	_, err = checker.CheckActivation(context.Background(), version.ID)
+	assert.ErrorIs(t, err, ErrBlocked)
+}
+
+func TestOverride(t *testing.T) {
+	ctx := context.Background()
+	config := checklist(Gate{Type: TypeSecondPersonReview}, Gate{Type: TypeImpactNotificationSent})
+	config.Overriders = []string{"user:oncall", "role:release-manager"}
+	checker, version := newTestChecker(config)
+	checker.SetDirectory(fakeDirectory{"dave": {"role:release-manager"}})
+
+	_, err := checker.CheckActivation(ctx, version.ID)
+	var blocked *BlockedError
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, []string{"second-person-review", "impact-notification-sent"}, blocked.Report.Unsatisfied())
+	assert.Equal(t, "activation blocked by unsatisfied gates: second-person-review, impact-notification-sent", err.Error())
+
+	_, err = checker.CheckActivation(WithOverride(ctx, "oncall", " "), version.ID)
+	assert.ErrorIs(t, err, ErrJustificationRequired)
+	_, err = checker.CheckActivation(WithOverride(ctx, "alice", "hotfix"), version.ID)
+	assert.ErrorIs(t, err, ErrOverrideForbidden)
+
+	report, err := checker.CheckActivation(WithOverride(ctx, "dave", "INC-42 hotfix, reviewed on the bridge"), version.ID)
+	require.NoError(t, err)
+	require.NotNil(t, report.Override)
+	assert.Equal(t, "dave", report.Override.Actor)
+
+	overrides, err := checker.ListOverrides(ctx, version.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, overrides, 1)
+	assert.Equal(t, "INC-42 hotfix, reviewed on the bridge", overrides[0].Justification)
+	assert.Equal(t, []string{"second-person-review", "impact-notification-sent"}, overrides[0].Unsatisfied)
+	assert.Equal(t, version.WorkflowID, overrides[0].WorkflowID)
+
+	// Satisfied gates need no override and audit none
+	require.NoError(t, checker.RecordReview(ctx, &Review{VersionID: version.ID, Reviewer: "bob", Approved: true}))
+	require.NoError(t, checker.RecordNotification(ctx, &ImpactNotification{VersionID: version.ID, Recipients: []string{"#payments"}}))
+	report, err = checker.CheckActivation(WithOverride(ctx, "oncall", "not needed"), version.ID)
+	require.NoError(t, err)
+	assert.Nil(t, report.Override)
+	overrides, err = checker.ListOverrides(ctx, uuid.Nil, 0)
+	require.NoError(t, err)
+	assert.Len(t, overrides, 1)
+}
+
+func TestChecklistEndpoints(t *testing.T) {
+	checker, version := newTestChecker(checklist(Gate{Type: TypeSecondPersonReview}))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewHandlers(checker).RegisterRoutes(router.Group("/api"))
+
+	serve := func(method, path, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", user)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	path := "/api/v1/activation-gates/versions/" + version.ID.String()
+
+	rec := serve(http.MethodPost, path+"/reviews", "alice", `{"approved":true}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(http.MethodPost, path+"/reviews", "bob", `{"approved":true}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	rec = serve(http.MethodGet, path, "alice", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.True(t, report.Satisfied)
+	assert.Equal(t, "payments", report.Namespace)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/v1/activation-gates/versions/"+uuid.New().String(), "alice", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/api/v1/activation-gates/overrides?limit=0", "alice", "").Code)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{Checklist: []Gate{{Type: TypeLintClean}}, Overriders: []string{"group:sre"}}.Validate())
+	assert.Error(t, Config{Checklist: []Gate{{Type: "manual"}}}.Validate())
+	assert.Error(t, Config{Namespaces: map[string][]Gate{"payments": {{Type: TypeWebhook, URL: "ftp://example.com"}}}}.Validate())
+	assert.Error(t, Config{Checklist: []Gate{{Type: TypeLintClean}, {Type: TypeLintClean}}}.Validate())
+	assert.Error(t, Config{Overriders: []string{"oncall"}}.Validate())
+}
@@ -0,0 +1,255 @@
+package gates
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultOverrideLimit = 100
+
+// Handlers provides HTTP handlers for activation gates
+type Handlers struct {
+	checker *Checker
+}
+
+// NewHandlers creates new activation gate handlers
+func NewHandlers(checker *Checker) *Handlers {
+	return &Handlers{checker: checker}
+}
+
+// RegisterRoutes registers activation gate routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		gates := v1.Group("/activation-gates")
+		{
+			gates.GET("/overrides", h.ListOverrides)
+			gates.GET("/versions/:version_id", h.GetChecklist)
+			gates.POST("/versions/:version_id/reviews", h.CreateReview)
+			gates.POST("/versions/:version_id/simulations", h.CreateSimulation)
+			gates.POST("/versions/:version_id/impact-notifications", h.CreateNotification)
+		}
+	}
+}
+
+// ReviewRequest is the review of a version by the requesting user
+type ReviewRequest struct {
+	Approved bool   `json:"approved"`
+	Comment  string `json:"comment"`
+}
+
+// SimulationRequest is a simulation run of a version
+type SimulationRequest struct {
+	Suite      string    `json:"suite"`
+	Passed     bool      `json:"passed"`
+	Cases      int       `json:"cases"`
+	Failures   int       `json:"failures"`
+	ResultsURL string    `json:"results_url"`
+	RanAt      time.Time `json:"ran_at"`
+}
+
+// NotificationRequest records the notification of the impact of a version
+type NotificationRequest struct {
+	Recipients []string `json:"recipients" binding:"required"`
+	Message    string   `json:"message"`
+}
+
+// GetChecklist evaluates the gates of a version
+// @Summary Get the activation checklist of a version
+// @Description Evaluates every gate of the checklist of the namespace of a version, as its activation would
+// @Tags versioning
+// @Produce json
+// @Param version_id path string true "Version ID"
+// @Success 200 {object} Report
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/activation-gates/versions/{version_id} [get]
+func (h *Handlers) GetChecklist(c *gin.Context) {
+	versionID, ok := parseVersionID(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.checker.Evaluate(c.Request.Context(), versionID)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// CreateReview records the review of a version by the requesting user
+// @Summary Review a version
+// @Tags versioning
+// @Accept json
+// @Produce json
+// @Param version_id path string true "Version ID"
+// @Param request body ReviewRequest true "Review"
+// @Success 201 {object} Review
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/activation-gates/versions/{version_id}/reviews [post]
+func (h *Handlers) CreateReview(c *gin.Context) {
+	versionID, ok := parseVersionID(c)
+	if !ok {
+		return
+	}
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review := &Review{
+		VersionID: versionID,
+		Reviewer:  c.GetHeader("X-User-ID"),
+		Approved:  req.Approved,
+		Comment:   req.Comment,
+	}
+	if err := h.checker.RecordReview(c.Request.Context(), review); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, review)
+}
+
+// CreateSimulation records a simulation run of a version
+// @Summary Record a simulation run
+// @Tags versioning
+// @Accept json
+// @Produce json
+// @Param version_id path string true "Version ID"
+// @Param request body SimulationRequest true "Simulation run"
+// @Success 201 {object} Simulation
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/activation-gates/versions/{version_id}/simulations [post]
+func (h *Handlers) CreateSimulation(c *gin.Context) {
+	versionID, ok := parseVersionID(c)
+	if !ok {
+		return
+	}
+	var req SimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	simulation := &Simulation{
+		VersionID:  versionID,
+		Suite:      req.Suite,
+		Passed:     req.Passed,
+		Cases:      req.Cases,
+		Failures:   req.Failures,
+		ResultsURL: req.ResultsURL,
+		RanBy:      c.GetHeader("X-User-ID"),
+		RanAt:      req.RanAt,
+	}
+	if err := h.checker.RecordSimulation(c.Request.Context(), simulation); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, simulation)
+}
+
+// CreateNotification records the notification of the impact of a version
+// @Summary Record an impact notification
+// @Tags versioning
+// @Accept json
+// @Produce json
+// @Param version_id path string true "Version ID"
+// @Param request body NotificationRequest true "Impact notification"
+// @Success 201 {object} ImpactNotification
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/activation-gates/versions/{version_id}/impact-notifications [post]
+func (h *Handlers) CreateNotification(c *gin.Context) {
+	versionID, ok := parseVersionID(c)
+	if !ok {
+		return
+	}
+	var req NotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	notification := &ImpactNotification{
+		VersionID:  versionID,
+		Recipients: req.Recipients,
+		Message:    req.Message,
+		SentBy:     c.GetHeader("X-User-ID"),
+	}
+	if err := h.checker.RecordNotification(c.Request.Context(), notification); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, notification)
+}
+
+// ListOverrides returns the audit of gate overrides
+// @Summary List activation gate overrides
+// @Tags versioning
+// @Produce json
+// @Param version_id query string false "Version ID"
+// @Param limit query int false "Maximum number of overrides" default(100)
+// @Success 200 {array} Override
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/activation-gates/overrides [get]
+func (h *Handlers) ListOverrides(c *gin.Context) {
+	versionID := uuid.Nil
+	if value := c.Query("version_id"); value != "" {
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version ID"})
+			return
+		}
+		versionID = parsed
+	}
+	limit := defaultOverrideLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = parsed
+	}
+
+	overrides, err := h.checker.ListOverrides(c.Request.Context(), versionID, limit)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, overrides)
+}
+
+func parseVersionID(c *gin.Context) (uuid.UUID, bool) {
+	versionID, err := uuid.Parse(c.Param("version_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version ID"})
+		return uuid.Nil, false
+	}
+	return versionID, true
+}
+
+func (h *Handlers) errorResponse(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidRecord):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrVersionNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
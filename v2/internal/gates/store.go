@@ -0,0 +1,284 @@
+package gates
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Simulation is a simulation run of a version, recorded by the system
+// running it, such as CI
+type Simulation struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	VersionID uuid.UUID `json:"version_id" gorm:"type:uuid;not null;index"`
+	// Suite names the simulated scenarios
+	Suite    string `json:"suite,omitempty"`
+	Passed   bool   `json:"passed"`
+	Cases    int    `json:"cases"`
+	Failures int    `json:"failures"`
+	// ResultsURL links the detailed results of the run
+	ResultsURL string    `json:"results_url,omitempty"`
+	RanBy      string    `json:"ran_by"`
+	RanAt      time.Time `json:"ran_at"`
+}
+
+// TableName returns the table name for simulation runs
+func (Simulation) TableName() string {
+	return "activation_gate_simulations"
+}
+
+// Review is the review of a version by a user other than its author
+type Review struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	VersionID uuid.UUID `json:"version_id" gorm:"type:uuid;not null;index"`
+	Reviewer  string    `json:"reviewer" gorm:"not null"`
+	Approved  bool      `json:"approved"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for reviews
+func (Review) TableName() string {
+	return "activation_gate_reviews"
+}
+
+// ImpactNotification records that the impact of a version was notified
+type ImpactNotification struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	VersionID uuid.UUID `json:"version_id" gorm:"type:uuid;not null;index"`
+	// Recipients are the channels or owners notified
+	Recipients []string  `json:"recipients" gorm:"type:jsonb;serializer:json"`
+	Message    string    `json:"message,omitempty"`
+	SentBy     string    `json:"sent_by"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// TableName returns the table name for impact notifications
+func (ImpactNotification) TableName() string {
+	return "activation_gate_impact_notifications"
+}
+
+// Override is the audit record of a version activated despite unsatisfied
+// gates
+type Override struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	VersionID     uuid.UUID `json:"version_id" gorm:"type:uuid;not null;index"`
+	WorkflowID    uuid.UUID `json:"workflow_id" gorm:"type:uuid;index"`
+	Actor         string    `json:"actor" gorm:"not null"`
+	Justification string    `json:"justification" gorm:"not null"`
+	// Unsatisfied are the names of the gates overridden
+	Unsatisfied []string  `json:"unsatisfied" gorm:"type:jsonb;serializer:json"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName returns the table name for overrides
+func (Override) TableName() string {
+	return "activation_gate_overrides"
+}
+
+// Store persists the records gates are evaluated against and the audit of
+// overrides. Lists return the records of a version, the oldest first.
+type Store interface {
+	RecordSimulation(ctx context.Context, simulation *Simulation) error
+	ListSimulations(ctx context.Context, versionID uuid.UUID) ([]*Simulation, error)
+
+	RecordReview(ctx context.Context, review *Review) error
+	ListReviews(ctx context.Context, versionID uuid.UUID) ([]*Review, error)
+
+	RecordNotification(ctx context.Context, notification *ImpactNotification) error
+	ListNotifications(ctx context.Context, versionID uuid.UUID) ([]*ImpactNotification, error)
+
+	RecordOverride(ctx context.Context, override *Override) error
+	// ListOverrides returns the latest overrides of a version, or of every
+	// version for uuid.Nil, the most recent first
+	ListOverrides(ctx context.Context, versionID uuid.UUID, limit int) ([]*Override, error)
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu            sync.RWMutex
+	simulations   []*Simulation
+	reviews       []*Review
+	notifications []*ImpactNotification
+	overrides     []*Override
+}
+
+// NewMemoryStore creates an in-memory gate store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// RecordSimulation stores a simulation run
+func (s *MemoryStore) RecordSimulation(ctx context.Context, simulation *Simulation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *simulation
+	s.simulations = append(s.simulations, &stored)
+	return nil
+}
+
+// ListSimulations returns the simulation runs of a version
+func (s *MemoryStore) ListSimulations(ctx context.Context, versionID uuid.UUID) ([]*Simulation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var simulations []*Simulation
+	for _, simulation := range s.simulations {
+		if simulation.VersionID == versionID {
+			found := *simulation
+			simulations = append(simulations, &found)
+		}
+	}
+	return simulations, nil
+}
+
+// RecordReview stores a review
+func (s *MemoryStore) RecordReview(ctx context.Context, review *Review) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *review
+	s.reviews = append(s.reviews, &stored)
+	return nil
+}
+
+// ListReviews returns the reviews of a version
+func (s *MemoryStore) ListReviews(ctx context.Context, versionID uuid.UUID) ([]*Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reviews []*Review
+	for _, review := range s.reviews {
+		if review.VersionID == versionID {
+			found := *review
+			reviews = append(reviews, &found)
+		}
+	}
+	return reviews, nil
+}
+
+// RecordNotification stores an impact notification
+func (s *MemoryStore) RecordNotification(ctx context.Context, notification *ImpactNotification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *notification
+	s.notifications = append(s.notifications, &stored)
+	return nil
+}
+
+// ListNotifications returns the impact notifications of a version
+func (s *MemoryStore) ListNotifications(ctx context.Context, versionID uuid.UUID) ([]*ImpactNotification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notifications []*ImpactNotification
+	for _, notification := range s.notifications {
+		if notification.VersionID == versionID {
+			found := *notification
+			notifications = append(notifications, &found)
+		}
+	}
+	return notifications, nil
+}
+
+// RecordOverride stores an override
+func (s *MemoryStore) RecordOverride(ctx context.Context, override *Override) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *override
+	s.overrides = append(s.overrides, &stored)
+	return nil
+}
+
+// ListOverrides returns the latest overrides, the most recent first
+func (s *MemoryStore) ListOverrides(ctx context.Context, versionID uuid.UUID, limit int) ([]*Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var overrides []*Override
+	for i := len(s.overrides) - 1; i >= 0 && (limit <= 0 || len(overrides) < limit); i-- {
+		if versionID != uuid.Nil && s.overrides[i].VersionID != versionID {
+			continue
+		}
+		found := *s.overrides[i]
+		overrides = append(overrides, &found)
+	}
+	return overrides, nil
+}
+
+// GormStore appends simulation runs, reviews, impact notifications and
+// overrides to one activation_gate_* table each. Records are never updated,
+// so the tables are the audit trail of the gates of a version.
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database gate store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the gate record and override tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Simulation{}, &Review{}, &ImpactNotification{}, &Override{})
+}
+
+// RecordSimulation stores a simulation run
+func (s *GormStore) RecordSimulation(ctx context.Context, simulation *Simulation) error {
+	return s.db.WithContext(ctx).Create(simulation).Error
+}
+
+// ListSimulations returns the simulation runs of a version
+func (s *GormStore) ListSimulations(ctx context.Context, versionID uuid.UUID) ([]*Simulation, error) {
+	var simulations []*Simulation
+	err := s.db.WithContext(ctx).Where("version_id = ?", versionID).Order("ran_at").Find(&simulations).Error
+	return simulations, err
+}
+
+// RecordReview stores a review
+func (s *GormStore) RecordReview(ctx context.Context, review *Review) error {
+	return s.db.WithContext(ctx).Create(review).Error
+}
+
+// ListReviews returns the reviews of a version
+func (s *GormStore) ListReviews(ctx context.Context, versionID uuid.UUID) ([]*Review, error) {
+	var reviews []*Review
+	err := s.db.WithContext(ctx).Where("version_id = ?", versionID).Order("created_at").Find(&reviews).Error
+	return reviews, err
+}
+
+// RecordNotification stores an impact notification
+func (s *GormStore) RecordNotification(ctx context.Context, notification *ImpactNotification) error {
+	return s.db.WithContext(ctx).Create(notification).Error
+}
+
+// ListNotifications returns the impact notifications of a version
+func (s *GormStore) ListNotifications(ctx context.Context, versionID uuid.UUID) ([]*ImpactNotification, error) {
+	var notifications []*ImpactNotification
+	err := s.db.WithContext(ctx).Where("version_id = ?", versionID).Order("sent_at").Find(&notifications).Error
+	return notifications, err
+}
+
+// RecordOverride stores an override
+func (s *GormStore) RecordOverride(ctx context.Context, override *Override) error {
+	return s.db.WithContext(ctx).Create(override).Error
+}
+
+// ListOverrides returns the latest overrides, the most recent first
+func (s *GormStore) ListOverrides(ctx context.Context, versionID uuid.UUID, limit int) ([]*Override, error) {
+	query := s.db.WithContext(ctx).Order("created_at DESC")
+	if versionID != uuid.Nil {
+		query = query.Where("version_id = ?", versionID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var overrides []*Override
+	return overrides, query.Find(&overrides).Error
+}
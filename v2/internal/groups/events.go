@@ -0,0 +1,77 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/pkg/models"
+)
+
+// EventHandler records the end of the executions of group members, whether
+// they completed, failed or were cancelled. Executions outside of groups
+// are ignored.
+type EventHandler struct {
+	manager *Manager
+}
+
+// NewEventHandler creates an engine event handler for the group manager
+func NewEventHandler(manager *Manager) *EventHandler {
+	return &EventHandler{manager: manager}
+}
+
+// Handle records the end of the member execution of a terminal event
+func (h *EventHandler) Handle(event *engine.WorkflowEvent) error {
+	groupID, ok := eventGroupID(event.Data)
+	if !ok {
+		return nil
+	}
+
+	var status models.ExecutionStatus
+	reason := event.Error
+	switch event.Type {
+	case "execution.completed":
+		status = models.ExecutionStatusCompleted
+		if recorded, ok := event.Data["status"]; ok {
+			status = models.ExecutionStatus(fmt.Sprint(recorded))
+		}
+	case "execution.failed":
+		status = models.ExecutionStatusFailed
+	case "execution.cancelled":
+		status = models.ExecutionStatusCancelled
+		if recorded, ok := event.Data["reason"].(string); ok {
+			reason = recorded
+		}
+	default:
+		return nil
+	}
+
+	_, err := h.manager.MemberEnded(context.Background(), groupID, event.ExecutionID, status, reason)
+	// Groups that failed to start are not stored, their members are ignored
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// GetEventTypes returns the event types handled
+func (h *EventHandler) GetEventTypes() []string {
+	return []string{"execution.completed", "execution.failed", "execution.cancelled"}
+}
+
+// eventGroupID returns the group of the execution of an event, recorded as
+// a UUID or, for events read back from a queue, a string
+func eventGroupID(data map[string]interface{}) (uuid.UUID, bool) {
+	switch id := data["group_id"].(type) {
+	case uuid.UUID:
+		return id, true
+	case string:
+		parsed, err := uuid.Parse(id)
+		return parsed, err == nil
+	}
+	return uuid.Nil, false
+}
@@ -0,0 +1,229 @@
+// Package groups implements execution groups: executions of several
+// workflows started together for one business transaction, which share a
+// fate. Members share the correlation ID and labels of their group. The
+// fate policy of a group tells whether the failure of a member cancels its
+// siblings and how the status of the group derives from the statuses of its
+// members. Group events are published once the group ends, for the webhooks
+// subscribed to them.
+package groups
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// Event types published when a group ends, delivered to the webhooks and
+// notifications subscribed to them
+const (
+	EventCompleted = "execution_group.completed"
+	EventFailed    = "execution_group.failed"
+	EventCancelled = "execution_group.cancelled"
+)
+
+var (
+	// ErrInvalidGroup is returned for groups without members, with an
+	// unknown fate policy or a member of an inactive workflow
+	ErrInvalidGroup = errors.New("invalid execution group")
+	// ErrGroupEnded is returned when adding a member to a group that ended,
+	// or whose failure is cancelling its members
+	ErrGroupEnded = errors.New("execution group has ended")
+)
+
+// FatePolicy is how the fate of the members of a group is tied
+type FatePolicy string
+
+const (
+	// FateIndependent members run independently. The group completes once
+	// they all ended, if one of them completed.
+	FateIndependent FatePolicy = "independent"
+	// FateCancelOnAnyFailure cancels the running members of a group as
+	// soon as one of them fails, failing the group
+	FateCancelOnAnyFailure FatePolicy = "cancel-group-on-any-failure"
+	// FateRequireAllSuccess completes a group only when all of its members
+	// completed, without cancelling members when one fails
+	FateRequireAllSuccess FatePolicy = "require-all-success"
+)
+
+// FatePolicies are the valid fate policies
+var FatePolicies = []FatePolicy{FateIndependent, FateCancelOnAnyFailure, FateRequireAllSuccess}
+
+func (p FatePolicy) valid() bool {
+	for _, policy := range FatePolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// Status is the status of a group, derived from the statuses of its members
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Group is an execution group
+type Group struct {
+	ID            uuid.UUID         `json:"id" gorm:"type:uuid;primaryKey"`
+	Policy        FatePolicy        `json:"policy" gorm:"not null"`
+	CorrelationID string            `json:"correlation_id" gorm:"index"`
+	Labels        map[string]string `json:"labels,omitempty" gorm:"type:jsonb;serializer:json"`
+	// Status is recorded once the group ended, running until then
+	Status    Status     `json:"status" gorm:"not null;index"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+
+	Members []*Member `json:"members" gorm:"-"`
+}
+
+// TableName returns the table name for the Group model
+func (Group) TableName() string {
+	return "execution_groups"
+}
+
+// Member is an execution of a group
+type Member struct {
+	ExecutionID uuid.UUID `json:"execution_id" gorm:"type:uuid;primaryKey"`
+	GroupID     uuid.UUID `json:"group_id" gorm:"type:uuid;not null;index"`
+	// Position is the rank of the member in its group, in the order members
+	// joined
+	Position   int                    `json:"position"`
+	WorkflowID uuid.UUID              `json:"workflow_id" gorm:"type:uuid;not null"`
+	Status     models.ExecutionStatus `json:"status" gorm:"not null"`
+	Error      string                 `json:"error,omitempty"`
+	// CancelledByGroup is set for members the group cancelled after another
+	// member failed
+	CancelledByGroup bool       `json:"cancelled_by_group,omitempty"`
+	JoinedAt         time.Time  `json:"joined_at"`
+	EndedAt          *time.Time `json:"ended_at,omitempty"`
+}
+
+// TableName returns the table name for the Member model
+func (Member) TableName() string {
+	return "execution_group_members"
+}
+
+// ended reports whether the execution of a member ended
+func (m *Member) ended() bool {
+	return outcomeOf(m.Status) != outcomeRunning
+}
+
+type outcome int
+
+const (
+	outcomeRunning outcome = iota
+	outcomeSucceeded
+	outcomeFailed
+	outcomeCancelled
+)
+
+func outcomeOf(status models.ExecutionStatus) outcome {
+	switch status {
+	case models.ExecutionStatusCompleted, models.ExecutionStatusCompletedWithWarnings:
+		return outcomeSucceeded
+	case models.ExecutionStatusFailed, models.ExecutionStatusTimeout:
+		return outcomeFailed
+	case models.ExecutionStatusCancelled:
+		return outcomeCancelled
+	}
+	return outcomeRunning
+}
+
+// Derive returns the status of a group from the statuses of its members.
+// A group runs while one of its members runs. Once they all ended, a group
+// whose members were all cancelled is cancelled, whatever its policy, and
+// otherwise:
+//
+//   - independent groups complete if a member completed, and fail if none
+//     did
+//   - cancel-group-on-any-failure groups fail if a member failed, complete
+//     if all members completed, and are cancelled otherwise
+//   - require-all-success groups complete if all members completed, and
+//     fail otherwise
+func Derive(policy FatePolicy, members []*Member) Status {
+	counts := make(map[outcome]int, 4)
+	for _, member := range members {
+		counts[outcomeOf(member.Status)]++
+	}
+	switch {
+	case counts[outcomeRunning] > 0:
+		return StatusRunning
+	case counts[outcomeCancelled] == len(members):
+		return StatusCancelled
+	}
+
+	switch policy {
+	case FateIndependent:
+		if counts[outcomeSucceeded] > 0 {
+			return StatusCompleted
+		}
+		return StatusFailed
+	case FateCancelOnAnyFailure:
+		if counts[outcomeFailed] > 0 {
+			return StatusFailed
+		}
+		if counts[outcomeSucceeded] == len(members) {
+			return StatusCompleted
+		}
+		return StatusCancelled
+	default:
+		if counts[outcomeSucceeded] == len(members) {
+			return StatusCompleted
+		}
+		return StatusFailed
+	}
+}
+
+// failing reports whether a running group was failed by a member and is
+// cancelling the others
+func (g *Group) failing() bool {
+	if g.Policy != FateCancelOnAnyFailure {
+		return false
+	}
+	for _, member := range g.Members {
+		if outcomeOf(member.Status) == outcomeFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// MemberRequest is a member of a group to start
+type MemberRequest struct {
+	WorkflowID uuid.UUID              `json:"workflow_id" binding:"required"`
+	Input      map[string]interface{} `json:"input"`
+}
+
+// Request is a group to start
+type Request struct {
+	Policy FatePolicy `json:"policy"`
+	// CorrelationID is the correlation ID of the group, generated when
+	// empty
+	CorrelationID string            `json:"correlation_id"`
+	Labels        map[string]string `json:"labels"`
+	Members       []MemberRequest   `json:"members"`
+}
+
+// validate checks a group request, defaulting its policy to independent
+func (r *Request) validate() error {
+	if r.Policy == "" {
+		r.Policy = FateIndependent
+	}
+	if !r.Policy.valid() {
+		return fmt.Errorf("%w: unknown fate policy %q, expected one of %v", ErrInvalidGroup, r.Policy, FatePolicies)
+	}
+	if len(r.Members) == 0 {
+		return fmt.Errorf("%w: a group needs at least one member", ErrInvalidGroup)
+	}
+	return nil
+}
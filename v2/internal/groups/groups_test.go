@@ -0,0 +1,422 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/pkg/models"
+)
+
+// fakeExecutor starts executions that run until the test ends them,
+// recording the group and correlation ID they carry the way the engine does
+type fakeExecutor struct {
+	mu         sync.Mutex
+	executions []*models.Execution
+	cancelled  []uuid.UUID
+	// refused is a workflow whose executions cannot start
+	refused uuid.UUID
+}
+
+func (e *fakeExecutor) ExecuteWorkflow(ctx context.Context, workflow *models.Workflow, input map[string]interface{}, config map[string]interface{}) (*models.Execution, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if workflow.ID == e.refused {
+		return nil, errors.New("maximum concurrent executions reached: 1")
+	}
+	execution := &models.Execution{
+		ID:            uuid.New(),
+		WorkflowID:    workflow.ID,
+		Status:        models.ExecutionStatusRunning,
+		CorrelationID: correlation.FromContext(ctx),
+	}
+	if group, ok := engine.ExecutionGroupFromContext(ctx); ok {
+		execution.GroupID = &group.ID
+		execution.Labels = group.Labels
+	}
+	e.executions = append(e.executions, execution)
+	return execution, nil
+}
+
+func (e *fakeExecutor) CancelExecution(executionID uuid.UUID) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cancelled = append(e.cancelled, executionID)
+	return nil
+}
+
+func (e *fakeExecutor) cancelledExecutions() []uuid.UUID {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]uuid.UUID(nil), e.cancelled...)
+}
+
+type workflowStore map[uuid.UUID]*models.Workflow
+
+func (s workflowStore) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	workflow, ok := s[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return workflow, nil
+}
+
+// recordingPublisher records the events it publishes
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []publishedEvent
+}
+
+type publishedEvent struct {
+	eventType string
+	data      map[string]interface{}
+}
+
+func (p *recordingPublisher) PublishEvent(eventType string, workflowID uuid.UUID, data map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, publishedEvent{eventType: eventType, data: data})
+}
+
+func (p *recordingPublisher) types() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	types := make([]string, len(p.events))
+	for i, event := range p.events {
+		types[i] = event.eventType
+	}
+	return types
+}
+
+var (
+	provisionID  = uuid.MustParse("6c1e7b0a-2f0e-4b7e-9a55-0d3f5e1a0c01")
+	billingID    = uuid.MustParse("6c1e7b0a-2f0e-4b7e-9a55-0d3f5e1a0c02")
+	onboardingID = uuid.MustParse("6c1e7b0a-2f0e-4b7e-9a55-0d3f5e1a0c03")
+)
+
+// newTestManager creates a group manager of three active workflows:
+// provision account, set up billing and send onboarding
+func newTestManager(executor *fakeExecutor) (*Manager, *recordingPublisher) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	workflows := workflowStore{
+		provisionID:  {ID: provisionID, Name: "provision-account", Status: models.WorkflowStatusActive},
+		billingID:    {ID: billingID, Name: "setup-billing", Status: models.WorkflowStatusActive},
+		onboardingID: {ID: onboardingID, Name: "send-onboarding", Status: models.WorkflowStatusActive},
+	}
+	publisher := &recordingPublisher{}
+	return NewManager(NewMemoryStore(), workflows, executor, publisher, logger), publisher
+}
+
+// onboarding requests a group of the three workflows
+func onboarding(policy FatePolicy) *Request {
+	return &Request{
+		Policy:        policy,
+		CorrelationID: "onboarding-42",
+		Labels:        map[string]string{"customer": "acme"},
+		Members: []MemberRequest{
+			{WorkflowID: provisionID},
+			{WorkflowID: billingID},
+			{WorkflowID: onboardingID},
+		},
+	}
+}
+
+func startGroup(t *testing.T, manager *Manager, policy FatePolicy) *Group {
+	t.Helper()
+	group, err := manager.Start(context.Background(), onboarding(policy), "alice")
+	require.NoError(t, err)
+	require.Len(t, group.Members, 3)
+	return group
+}
+
+// endMember delivers the terminal event of the execution of a member the
+// way the engine emits it
+func endMember(t *testing.T, manager *Manager, group *Group, member int, status models.ExecutionStatus) {
+	t.Helper()
+	event := &engine.WorkflowEvent{
+		ExecutionID: group.Members[member].ExecutionID,
+		Data:        map[string]interface{}{"group_id": group.ID},
+	}
+	switch status {
+	case models.ExecutionStatusFailed:
+		event.Type = "execution.failed"
+		event.Error = "step charge failed"
+	case models.ExecutionStatusCancelled:
+		event.Type = "execution.cancelled"
+		event.Data["reason"] = "execution cancelled"
+	default:
+		event.Type = "execution.completed"
+		event.Data["status"] = status
+	}
+	require.NoError(t, NewEventHandler(manager).Handle(event))
+}
+
+func getGroup(t *testing.T, manager *Manager, group *Group) *Group {
+	t.Helper()
+	stored, err := manager.Get(context.Background(), group.ID)
+	require.NoError(t, err)
+	return stored
+}
+
+func TestFatePolicies(t *testing.T) {
+	const (
+		completed = models.ExecutionStatusCompleted
+		warnings  = models.ExecutionStatusCompletedWithWarnings
+		failed    = models.ExecutionStatusFailed
+		cancelled = models.ExecutionStatusCancelled
+	)
+	tests := map[string]struct {
+		policy FatePolicy
+		// ends are the statuses the members end with, in order
+		ends   []models.ExecutionStatus
+		status Status
+	}{
+		"independent members run on failures":         {policy: FateIndependent, ends: []models.ExecutionStatus{failed, completed, cancelled}, status: StatusCompleted},
+		"require all success fails once all ended":    {policy: FateRequireAllSuccess, ends: []models.ExecutionStatus{warnings, failed, completed}, status: StatusFailed},
+		"cancel group on any failure completes":       {policy: FateCancelOnAnyFailure, ends: []models.ExecutionStatus{completed, completed, completed}, status: StatusCompleted},
+		"require all success completes with warnings": {policy: FateRequireAllSuccess, ends: []models.ExecutionStatus{completed, warnings, completed}, status: StatusCompleted},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			executor := &fakeExecutor{}
+			manager, publisher := newTestManager(executor)
+			group := startGroup(t, manager, tt.policy)
+
+			for i, status := range tt.ends {
+				endMember(t, manager, group, i, status)
+				if i < len(tt.ends)-1 {
+					assert.Equal(t, StatusRunning, getGroup(t, manager, group).Status, "group ended before its last member")
+					assert.Empty(t, publisher.types())
+				}
+			}
+			assert.Empty(t, executor.cancelledExecutions(), "no member is cancelled")
+			stored := getGroup(t, manager, group)
+			assert.Equal(t, tt.status, stored.Status)
+			assert.NotNil(t, stored.EndedAt)
+			event := EventCompleted
+			if tt.status == StatusFailed {
+				event = EventFailed
+			}
+			assert.Equal(t, []string{event}, publisher.types())
+		})
+	}
+}
+
+func TestMemberFailingWhileSiblingsRun(t *testing.T) {
+	executor := &fakeExecutor{}
+	manager, publisher := newTestManager(executor)
+	group := startGroup(t, manager, FateCancelOnAnyFailure)
+
+	// Billing fails while provisioning and onboarding are mid-step: both are
+	// cancelled, and the group fails once their cancellation ended them
+	endMember(t, manager, group, 1, models.ExecutionStatusFailed)
+	assert.ElementsMatch(t, []uuid.UUID{group.Members[0].ExecutionID, group.Members[2].ExecutionID}, executor.cancelledExecutions())
+	stored := getGroup(t, manager, group)
+	assert.Equal(t, StatusRunning, stored.Status)
+	assert.True(t, stored.Members[0].CancelledByGroup)
+	assert.False(t, stored.Members[1].CancelledByGroup)
+	assert.Equal(t, "step charge failed", stored.Members[1].Error)
+
+	// New members are refused while the group is failing
+	_, err := manager.AddMember(context.Background(), group.ID, MemberRequest{WorkflowID: provisionID})
+	assert.ErrorIs(t, err, ErrGroupEnded)
+
+	endMember(t, manager, group, 0, models.ExecutionStatusCancelled)
+	assert.Empty(t, publisher.types())
+	endMember(t, manager, group, 2, models.ExecutionStatusCancelled)
+
+	stored = getGroup(t, manager, group)
+	assert.Equal(t, StatusFailed, stored.Status)
+	assert.Equal(t, models.ExecutionStatusCancelled, stored.Members[2].Status)
+	assert.True(t, stored.Members[2].CancelledByGroup)
+	require.Equal(t, []string{EventFailed}, publisher.types())
+	data := publisher.events[0].data
+	assert.Equal(t, group.ID, data["group_id"])
+	assert.Equal(t, "onboarding-42", data[correlation.Field])
+	assert.Equal(t, map[models.ExecutionStatus]int{models.ExecutionStatusFailed: 1, models.ExecutionStatusCancelled: 2}, data["member_statuses"])
+
+	// Redelivered events change nothing, and cancel no sibling again
+	endMember(t, manager, group, 1, models.ExecutionStatusFailed)
+	assert.Len(t, executor.cancelledExecutions(), 2)
+	assert.Len(t, publisher.types(), 1)
+}
+
+func TestDerive(t *testing.T) {
+	const (
+		completed = models.ExecutionStatusCompleted
+		warnings  = models.ExecutionStatusCompletedWithWarnings
+		failed    = models.ExecutionStatusFailed
+		timeout   = models.ExecutionStatusTimeout
+		cancelled = models.ExecutionStatusCancelled
+		running   = models.ExecutionStatusRunning
+	)
+	tests := []struct {
+		name     string
+		statuses []models.ExecutionStatus
+		want     map[FatePolicy]Status
+	}{
+		{
+			name:     "running member",
+			statuses: []models.ExecutionStatus{completed, failed, running},
+			want:     map[FatePolicy]Status{FateIndependent: StatusRunning, FateCancelOnAnyFailure: StatusRunning, FateRequireAllSuccess: StatusRunning},
+		},
+		{
+			name:     "all completed",
+			statuses: []models.ExecutionStatus{completed, warnings},
+			want:     map[FatePolicy]Status{FateIndependent: StatusCompleted, FateCancelOnAnyFailure: StatusCompleted, FateRequireAllSuccess: StatusCompleted},
+		},
+		{
+			name:     "all cancelled",
+			statuses: []models.ExecutionStatus{cancelled, cancelled},
+			want:     map[FatePolicy]Status{FateIndependent: StatusCancelled, FateCancelOnAnyFailure: StatusCancelled, FateRequireAllSuccess: StatusCancelled},
+		},
+		{
+			name:     "completed and cancelled",
+			statuses: []models.ExecutionStatus{completed, cancelled},
+			want:     map[FatePolicy]Status{FateIndependent: StatusCompleted, FateCancelOnAnyFailure: StatusCancelled, FateRequireAllSuccess: StatusFailed},
+		},
+		{
+			name:     "failed and cancelled",
+			statuses: []models.ExecutionStatus{failed, cancelled},
+			want:     map[FatePolicy]Status{FateIndependent: StatusFailed, FateCancelOnAnyFailure: StatusFailed, FateRequireAllSuccess: StatusFailed},
+		},
+		{
+			name:     "timed out and completed",
+			statuses: []models.ExecutionStatus{timeout, completed},
+			want:     map[FatePolicy]Status{FateIndependent: StatusCompleted, FateCancelOnAnyFailure: StatusFailed, FateRequireAllSuccess: StatusFailed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members := make([]*Member, len(tt.statuses))
+			for i, status := range tt.statuses {
+				members[i] = &Member{Status: status}
+			}
+			for policy, want := range tt.want {
+				assert.Equal(t, want, Derive(policy, members), policy)
+			}
+		})
+	}
+}
+
+func TestMembersInheritGroup(t *testing.T) {
+	executor := &fakeExecutor{}
+	manager, _ := newTestManager(executor)
+	group := startGroup(t, manager, FateIndependent)
+	assert.Equal(t, "onboarding-42", group.CorrelationID)
+	assert.Equal(t, "alice", group.CreatedBy)
+
+	for _, execution := range executor.executions {
+		require.NotNil(t, execution.GroupID)
+		assert.Equal(t, group.ID, *execution.GroupID)
+		assert.Equal(t, "onboarding-42", execution.CorrelationID)
+		assert.Equal(t, map[string]string{"customer": "acme"}, execution.Labels)
+	}
+
+	// Groups started without a correlation ID get one
+	generated, err := manager.Start(context.Background(), &Request{Members: []MemberRequest{{WorkflowID: provisionID}}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, FateIndependent, generated.Policy)
+	assert.NotEmpty(t, generated.CorrelationID)
+	assert.Equal(t, generated.CorrelationID, executor.executions[len(executor.executions)-1].CorrelationID)
+}
+
+func TestAddMember(t *testing.T) {
+	executor := &fakeExecutor{}
+	manager, _ := newTestManager(executor)
+	group := startGroup(t, manager, FateRequireAllSuccess)
+
+	// Fan-outs add members to running groups, which wait for them
+	for i := range group.Members {
+		endMember(t, manager, group, i, models.ExecutionStatusCompleted)
+		if i == 0 {
+			member, err := manager.AddMember(context.Background(), group.ID, MemberRequest{WorkflowID: onboardingID})
+			require.NoError(t, err)
+			assert.Equal(t, "onboarding-42", executor.executions[len(executor.executions)-1].CorrelationID)
+			assert.Equal(t, group.ID, member.GroupID)
+		}
+	}
+	stored := getGroup(t, manager, group)
+	require.Len(t, stored.Members, 4)
+	assert.Equal(t, StatusRunning, stored.Status)
+
+	endMember(t, manager, stored, 3, models.ExecutionStatusCompleted)
+	assert.Equal(t, StatusCompleted, getGroup(t, manager, group).Status)
+
+	// Ended groups refuse new members
+	_, err := manager.AddMember(context.Background(), group.ID, MemberRequest{WorkflowID: provisionID})
+	assert.ErrorIs(t, err, ErrGroupEnded)
+	_, err = manager.AddMember(context.Background(), uuid.New(), MemberRequest{WorkflowID: provisionID})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestStartIsAtomic(t *testing.T) {
+	executor := &fakeExecutor{refused: onboardingID}
+	manager, _ := newTestManager(executor)
+
+	_, err := manager.Start(context.Background(), onboarding(FateCancelOnAnyFailure), "")
+	require.Error(t, err)
+
+	// The members started before the refusal are cancelled, and their
+	// cancelled events are ignored as the group was not stored
+	require.Len(t, executor.executions, 2)
+	assert.Equal(t, []uuid.UUID{executor.executions[0].ID, executor.executions[1].ID}, executor.cancelledExecutions())
+	require.NoError(t, NewEventHandler(manager).Handle(&engine.WorkflowEvent{
+		Type:        "execution.cancelled",
+		ExecutionID: executor.executions[0].ID,
+		Data:        map[string]interface{}{"group_id": *executor.executions[0].GroupID},
+	}))
+
+	// Events of executions outside of groups are ignored
+	assert.NoError(t, NewEventHandler(manager).Handle(&engine.WorkflowEvent{Type: "execution.failed", ExecutionID: uuid.New(), Data: map[string]interface{}{}}))
+}
+
+func TestInvalidGroups(t *testing.T) {
+	members := onboarding(FateIndependent).Members
+	tests := map[string]*Request{
+		"no members":          {},
+		"unknown policy":      {Policy: "all-or-nothing", Members: members},
+		"unknown workflow":    {Members: []MemberRequest{{WorkflowID: uuid.New()}}},
+		"invalid correlation": {CorrelationID: "not a valid id", Members: members[:1]},
+	}
+
+	for name, request := range tests {
+		t.Run(name, func(t *testing.T) {
+			executor := &fakeExecutor{}
+			manager, _ := newTestManager(executor)
+			_, err := manager.Start(context.Background(), request, "")
+			assert.ErrorIs(t, err, ErrInvalidGroup)
+			assert.Empty(t, executor.executions, "invalid groups start nothing")
+		})
+	}
+}
+
+func TestMemberEndedTimestamps(t *testing.T) {
+	manager, _ := newTestManager(&fakeExecutor{})
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+	group := startGroup(t, manager, FateIndependent)
+
+	now = now.Add(time.Minute)
+	for i := range group.Members {
+		endMember(t, manager, group, i, models.ExecutionStatusCompleted)
+	}
+	stored := getGroup(t, manager, group)
+	assert.Equal(t, now.Add(-time.Minute), stored.CreatedAt)
+	require.NotNil(t, stored.EndedAt)
+	assert.Equal(t, now, *stored.EndedAt)
+	assert.Equal(t, now, *stored.Members[0].EndedAt)
+}
@@ -0,0 +1,131 @@
+package groups
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Handlers provides HTTP handlers for execution groups
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new group handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers group routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		groups := v1.Group("/execution-groups")
+		{
+			groups.POST("", h.StartGroup)
+			groups.GET("/:id", h.GetGroup)
+			groups.POST("/:id/members", h.AddMember)
+		}
+	}
+}
+
+// StartGroup starts the executions of the members of a group together
+// @Summary Start execution group
+// @Description Starts the executions of several workflows together, sharing a correlation ID, labels and a fate policy: independent, cancel-group-on-any-failure or require-all-success. When a member cannot start, none is left running.
+// @Tags execution-groups
+// @Accept json
+// @Produce json
+// @Param request body Request true "Execution group"
+// @Success 201 {object} Group
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/execution-groups [post]
+func (h *Handlers) StartGroup(c *gin.Context) {
+	var request Request
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.manager.Start(c.Request.Context(), &request, c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// GetGroup returns a group with the status of each of its members
+// @Summary Get execution group
+// @Tags execution-groups
+// @Produce json
+// @Param id path string true "Execution group ID"
+// @Success 200 {object} Group
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/execution-groups/{id} [get]
+func (h *Handlers) GetGroup(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution group ID"})
+		return
+	}
+
+	group, err := h.manager.Get(c.Request.Context(), id)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// AddMember starts the execution of a new member of a running group
+// @Summary Add execution group member
+// @Description Starts the execution of a workflow as a member of a running group, for fan-out patterns. Groups that ended, or whose failing member is cancelling the others, refuse new members.
+// @Tags execution-groups
+// @Accept json
+// @Produce json
+// @Param id path string true "Execution group ID"
+// @Param request body MemberRequest true "Member"
+// @Success 201 {object} Member
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/execution-groups/{id}/members [post]
+func (h *Handlers) AddMember(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution group ID"})
+		return
+	}
+	var request MemberRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := h.manager.AddMember(c.Request.Context(), id, request)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func (h *Handlers) errorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidGroup):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrGroupEnded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,324 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/pkg/models"
+)
+
+// EventPublisher publishes events to the engine event handlers, which
+// deliver them to the webhooks and notifications subscribed to their type.
+// The engine implements it.
+type EventPublisher interface {
+	PublishEvent(eventType string, workflowID uuid.UUID, data map[string]interface{})
+}
+
+// WorkflowStore loads the workflows of members. The workflow repository
+// implements it.
+type WorkflowStore interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+}
+
+// Manager starts execution groups, follows the executions of their members
+// and applies their fate policy
+type Manager struct {
+	store     Store
+	workflows WorkflowStore
+	executor  engine.WorkflowExecutor
+	publisher EventPublisher
+	logger    *logrus.Logger
+	now       func() time.Time
+
+	// mu serializes the changes of groups, so that a member ending while
+	// the group starts or grows sees its membership stored
+	mu sync.Mutex
+}
+
+// NewManager creates a group manager starting the executions of members
+// with the executor. The publisher may be nil, in which case no group event
+// is published.
+func NewManager(store Store, workflows WorkflowStore, executor engine.WorkflowExecutor, publisher EventPublisher, logger *logrus.Logger) *Manager {
+	return &Manager{
+		store:     store,
+		workflows: workflows,
+		executor:  executor,
+		publisher: publisher,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// Start starts the executions of the members of a group. The members start
+// together: when one of them cannot start, those already started are
+// cancelled and no group is stored. The creator may be empty.
+func (m *Manager) Start(ctx context.Context, request *Request, createdBy string) (*Group, error) {
+	if err := request.validate(); err != nil {
+		return nil, err
+	}
+	if request.CorrelationID != "" && !correlation.Valid(request.CorrelationID) {
+		return nil, fmt.Errorf("%w: invalid correlation ID %q", ErrInvalidGroup, request.CorrelationID)
+	}
+	workflows := make([]*models.Workflow, len(request.Members))
+	for i, member := range request.Members {
+		workflow, err := m.workflow(member.WorkflowID)
+		if err != nil {
+			return nil, err
+		}
+		workflows[i] = workflow
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now().UTC()
+	group := &Group{
+		ID:            uuid.New(),
+		Policy:        request.Policy,
+		CorrelationID: request.CorrelationID,
+		Labels:        request.Labels,
+		Status:        StatusRunning,
+		CreatedBy:     createdBy,
+		CreatedAt:     now,
+	}
+	if group.CorrelationID == "" {
+		group.CorrelationID = correlation.NewID()
+	}
+
+	for i, member := range request.Members {
+		started, err := m.startMember(ctx, group, workflows[i], member.Input, now)
+		if err != nil {
+			m.cancelMembers(group.Members, "group start failed")
+			return nil, fmt.Errorf("failed to start member %d of the group: %w", i, err)
+		}
+		group.Members = append(group.Members, started)
+	}
+	if err := m.store.Create(ctx, group); err != nil {
+		m.cancelMembers(group.Members, "group could not be stored")
+		return nil, fmt.Errorf("failed to store execution group: %w", err)
+	}
+
+	m.groupLogger(group).WithField("members", len(group.Members)).Info("Execution group started")
+	return group, nil
+}
+
+// AddMember starts the execution of a new member of a running group. Groups
+// that ended, or that a failing member is cancelling, refuse new members
+// with ErrGroupEnded.
+func (m *Manager) AddMember(ctx context.Context, groupID uuid.UUID, request MemberRequest) (*Member, error) {
+	workflow, err := m.workflow(request.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	group, err := m.store.Get(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group.Status != StatusRunning || group.failing() {
+		return nil, fmt.Errorf("%w: group %s is %s", ErrGroupEnded, group.ID, Derive(group.Policy, group.Members))
+	}
+
+	member, err := m.startMember(ctx, group, workflow, request.Input, m.now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to start group member: %w", err)
+	}
+	if err := m.store.SaveMember(ctx, member); err != nil {
+		m.cancelMembers([]*Member{member}, "group member could not be stored")
+		return nil, fmt.Errorf("failed to store group member: %w", err)
+	}
+
+	m.groupLogger(group).WithField("execution_id", member.ExecutionID).Info("Execution group member added")
+	return member, nil
+}
+
+// Get returns a group with its members
+func (m *Manager) Get(ctx context.Context, id uuid.UUID) (*Group, error) {
+	return m.store.Get(ctx, id)
+}
+
+// MemberEnded records the end of the execution of a member. When a member
+// of a cancel-group-on-any-failure group failed, its running siblings are
+// cancelled. Once all members ended, the group ends with the status derived
+// from theirs and its event is published. Ends recorded already are
+// ignored, so that redelivered events are harmless.
+func (m *Manager) MemberEnded(ctx context.Context, groupID, executionID uuid.UUID, status models.ExecutionStatus, reason string) (*Group, error) {
+	m.mu.Lock()
+	group, err := m.store.Get(ctx, groupID)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	var member *Member
+	for _, candidate := range group.Members {
+		if candidate.ExecutionID == executionID {
+			member = candidate
+		}
+	}
+	if member == nil {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("execution %s is not a member of group %s: %w", executionID, groupID, gorm.ErrRecordNotFound)
+	}
+	if member.ended() {
+		m.mu.Unlock()
+		return group, nil
+	}
+
+	now := m.now().UTC()
+	member.Status = status
+	member.Error = reason
+	member.EndedAt = &now
+	if err := m.store.SaveMember(ctx, member); err != nil {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("failed to store group member: %w", err)
+	}
+
+	// The siblings of a failed member are cancelled once the group is
+	// unlocked, as their cancelled events end them in turn
+	var cancelled []*Member
+	if group.Policy == FateCancelOnAnyFailure && outcomeOf(status) == outcomeFailed {
+		for _, sibling := range group.Members {
+			if sibling.ended() || sibling.CancelledByGroup {
+				continue
+			}
+			sibling.CancelledByGroup = true
+			if err := m.store.SaveMember(ctx, sibling); err != nil {
+				m.mu.Unlock()
+				return nil, fmt.Errorf("failed to store group member: %w", err)
+			}
+			cancelled = append(cancelled, sibling)
+		}
+	}
+
+	err = m.settle(ctx, group, now)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	m.cancelMembers(cancelled, fmt.Sprintf("member %s failed", executionID))
+	return group, nil
+}
+
+// settle ends a group once all of its members ended
+func (m *Manager) settle(ctx context.Context, group *Group, now time.Time) error {
+	status := Derive(group.Policy, group.Members)
+	if status == StatusRunning || group.Status != StatusRunning {
+		return nil
+	}
+	group.Status = status
+	group.EndedAt = &now
+	if err := m.store.Save(ctx, group); err != nil {
+		return fmt.Errorf("failed to store execution group: %w", err)
+	}
+
+	m.publish(group)
+	m.groupLogger(group).WithField("status", status).Info("Execution group ended")
+	return nil
+}
+
+// startMember starts the execution of a member of a group, carrying the
+// correlation ID and labels of the group. The execution outlives the
+// request starting it.
+func (m *Manager) startMember(ctx context.Context, group *Group, workflow *models.Workflow, input map[string]interface{}, now time.Time) (*Member, error) {
+	ctx = engine.WithExecutionGroup(context.WithoutCancel(ctx), engine.ExecutionGroup{ID: group.ID, Labels: group.Labels})
+	ctx = correlation.WithID(ctx, group.CorrelationID)
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	execution, err := m.executor.ExecuteWorkflow(ctx, workflow, input, map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start workflow %s: %w", workflow.Name, err)
+	}
+	return &Member{
+		ExecutionID: execution.ID,
+		GroupID:     group.ID,
+		WorkflowID:  workflow.ID,
+		Position:    len(group.Members),
+		Status:      models.ExecutionStatusRunning,
+		JoinedAt:    now,
+	}, nil
+}
+
+// cancelMembers cancels the executions of members. Executions that ended
+// meanwhile cannot be cancelled, their own end event settles them.
+func (m *Manager) cancelMembers(members []*Member, reason string) {
+	for _, member := range members {
+		if err := m.executor.CancelExecution(member.ExecutionID); err != nil {
+			m.logger.WithError(err).WithFields(logrus.Fields{
+				"group_id":     member.GroupID,
+				"execution_id": member.ExecutionID,
+			}).Warn("Failed to cancel execution group member")
+			continue
+		}
+		m.logger.WithFields(logrus.Fields{
+			"group_id":     member.GroupID,
+			"execution_id": member.ExecutionID,
+			"reason":       reason,
+		}).Info("Execution group member cancelled")
+	}
+}
+
+// workflow loads the workflow of a member, which must be active
+func (m *Manager) workflow(id uuid.UUID) (*models.Workflow, error) {
+	workflow, err := m.workflows.GetByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: workflow %s not found", ErrInvalidGroup, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workflow %s: %w", id, err)
+	}
+	if !workflow.IsActive() {
+		return nil, fmt.Errorf("%w: workflow %s is not active", ErrInvalidGroup, workflow.Name)
+	}
+	return workflow, nil
+}
+
+func (m *Manager) publish(group *Group) {
+	if m.publisher == nil {
+		return
+	}
+	eventType := EventCompleted
+	switch group.Status {
+	case StatusFailed:
+		eventType = EventFailed
+	case StatusCancelled:
+		eventType = EventCancelled
+	}
+
+	counts := map[models.ExecutionStatus]int{}
+	for _, member := range group.Members {
+		counts[member.Status]++
+	}
+	m.publisher.PublishEvent(eventType, uuid.Nil, map[string]interface{}{
+		"group_id":        group.ID,
+		"policy":          group.Policy,
+		"status":          group.Status,
+		correlation.Field: group.CorrelationID,
+		"labels":          group.Labels,
+		"members":         group.Members,
+		"member_statuses": counts,
+		"created_at":      group.CreatedAt,
+		"ended_at":        group.EndedAt,
+	})
+}
+
+func (m *Manager) groupLogger(group *Group) *logrus.Entry {
+	return m.logger.WithFields(logrus.Fields{
+		"group_id":        group.ID,
+		"policy":          group.Policy,
+		correlation.Field: group.CorrelationID,
+	})
+}
@@ -0,0 +1,158 @@
+package groups
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store persists execution groups and their members. Get returns
+// gorm.ErrRecordNotFound for unknown groups.
+type Store interface {
+	// Create stores a group with its members
+	Create(ctx context.Context, group *Group) error
+	// Get returns a group with its members, in the order they joined
+	Get(ctx context.Context, id uuid.UUID) (*Group, error)
+	// Save stores the new state of a group, without its members
+	Save(ctx context.Context, group *Group) error
+	// SaveMember stores a member or its new state
+	SaveMember(ctx context.Context, member *Member) error
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu      sync.Mutex
+	groups  map[uuid.UUID]*Group
+	members map[uuid.UUID]*Member
+}
+
+// NewMemoryStore creates an in-memory group store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		groups:  make(map[uuid.UUID]*Group),
+		members: make(map[uuid.UUID]*Member),
+	}
+}
+
+// Create stores a group with its members
+func (s *MemoryStore) Create(ctx context.Context, group *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups[group.ID] = copyGroup(group)
+	for _, member := range group.Members {
+		stored := *member
+		s.members[member.ExecutionID] = &stored
+	}
+	return nil
+}
+
+// Get returns a group with its members
+func (s *MemoryStore) Get(ctx context.Context, id uuid.UUID) (*Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	stored := copyGroup(group)
+	for _, member := range s.members {
+		if member.GroupID == id {
+			copied := *member
+			stored.Members = append(stored.Members, &copied)
+		}
+	}
+	sortMembers(stored.Members)
+	return stored, nil
+}
+
+// Save stores the new state of a group
+func (s *MemoryStore) Save(ctx context.Context, group *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups[group.ID] = copyGroup(group)
+	return nil
+}
+
+// SaveMember stores a member
+func (s *MemoryStore) SaveMember(ctx context.Context, member *Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *member
+	s.members[member.ExecutionID] = &stored
+	return nil
+}
+
+func copyGroup(group *Group) *Group {
+	stored := *group
+	stored.Members = nil
+	return &stored
+}
+
+func sortMembers(members []*Member) {
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Position < members[j].Position
+	})
+}
+
+// GormStore keeps groups in the execution_groups table and their members in
+// the execution_group_members table, keyed by the execution they started. A
+// group and its first members are created in one transaction.
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database group store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the group tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Group{}, &Member{})
+}
+
+// Create stores a group with its members, in one transaction
+func (s *GormStore) Create(ctx context.Context, group *Group) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		if len(group.Members) == 0 {
+			return nil
+		}
+		return tx.Create(group.Members).Error
+	})
+}
+
+// Get returns a group with its members
+func (s *GormStore) Get(ctx context.Context, id uuid.UUID) (*Group, error) {
+	var group Group
+	if err := s.db.WithContext(ctx).First(&group, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	err := s.db.WithContext(ctx).
+		Where("group_id = ?", id).
+		Order("position").
+		Find(&group.Members).Error
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// Save stores the new state of a group
+func (s *GormStore) Save(ctx context.Context, group *Group) error {
+	return s.db.WithContext(ctx).Omit("Members").Save(group).Error
+}
+
+// SaveMember stores a member
+func (s *GormStore) SaveMember(ctx context.Context, member *Member) error {
+	return s.db.WithContext(ctx).Save(member).Error
+}
@@ -0,0 +1,120 @@
+// Package importer imports workflow definitions from YAML and JSON files
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"magic-flow/v2/internal/versioning"
+	"magic-flow/v2/pkg/models"
+)
+
+// Version is the version imported workflows are created with
+const Version = "1.0.0"
+
+// ErrInvalidDefinition is returned when a definition file cannot be parsed
+// or fails validation
+var ErrInvalidDefinition = errors.New("invalid workflow definition")
+
+// Definition is a validated workflow definition, in the format accepted by
+// the versions API: a name, steps and optional inputs and outputs
+type Definition struct {
+	Name        string
+	Description string
+	Content     map[string]interface{}
+}
+
+// JSON returns the definition encoded as JSON
+func (d *Definition) JSON() ([]byte, error) {
+	return json.Marshal(d.Content)
+}
+
+// CreateFunc creates the workflow of an imported definition. The CLI creates
+// it through the workflow service.
+type CreateFunc func(ctx context.Context, definition *Definition) (*models.Workflow, error)
+
+// Result is the outcome of an import
+type Result struct {
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`
+	Warnings []string `json:"warnings,omitempty"`
+	// Workflow is the created workflow, nil for a dry run
+	Workflow *models.Workflow `json:"workflow,omitempty"`
+}
+
+// Importer validates workflow definition files and creates their workflows
+type Importer struct {
+	validator *versioning.Validator
+	create    CreateFunc
+}
+
+// New creates an importer. create may be nil when only dry runs are made.
+func New(validator *versioning.Validator, create CreateFunc) *Importer {
+	return &Importer{validator: validator, create: create}
+}
+
+// Import reads and validates a definition file and creates its workflow with
+// version Version. A dry run stops after validation.
+func (i *Importer) Import(ctx context.Context, path string, dryRun bool) (*Result, error) {
+	content, err := ReadDefinition(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.validator.ValidateDefinition(ctx, content); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidDefinition, filepath.Base(path), err)
+	}
+
+	content["version"] = Version
+	definition := &Definition{Content: content}
+	definition.Name, _ = content["name"].(string)
+	definition.Description, _ = content["description"].(string)
+
+	result := &Result{
+		Name:     definition.Name,
+		Version:  Version,
+		Warnings: i.validator.StepConfigWarnings(content),
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if i.create == nil {
+		return nil, fmt.Errorf("workflows cannot be created by this importer")
+	}
+	workflow, err := i.create(ctx, definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workflow %s: %w", definition.Name, err)
+	}
+	result.Workflow = workflow
+	return result, nil
+}
+
+// ReadDefinition reads a workflow definition file. Files with a .json
+// extension are decoded as JSON, any other file as YAML.
+func ReadDefinition(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+
+	var content map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &content)
+	} else {
+		err = yaml.Unmarshal(data, &content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s: %v", ErrInvalidDefinition, filepath.Base(path), err)
+	}
+	if content == nil {
+		return nil, fmt.Errorf("%w: %s is empty", ErrInvalidDefinition, filepath.Base(path))
+	}
+	return content, nil
+}
@@ -0,0 +1,128 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/versioning"
+	"magic-flow/v2/pkg/models"
+)
+
+// recordingCreator records the definitions it creates workflows for
+type recordingCreator struct {
+	definitions []*Definition
+	err         error
+}
+
+func (c *recordingCreator) create(ctx context.Context, definition *Definition) (*models.Workflow, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.definitions = append(c.definitions, definition)
+	return &models.Workflow{ID: uuid.New(), Name: definition.Name, Version: Version}, nil
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("yaml", func(t *testing.T) {
+		creator := &recordingCreator{}
+		result, err := New(versioning.NewValidator(nil), creator.create).Import(ctx, filepath.Join("testdata", "orders.yaml"), false)
+		require.NoError(t, err)
+
+		assert.Equal(t, "orders", result.Name)
+		assert.Equal(t, "1.0.0", result.Version)
+		require.NotNil(t, result.Workflow)
+		assert.Equal(t, "orders", result.Workflow.Name)
+
+		require.Len(t, creator.definitions, 1)
+		definition := creator.definitions[0]
+		assert.Equal(t, "Processes an order", definition.Description)
+		assert.Equal(t, "1.0.0", definition.Content["version"])
+		encoded, err := definition.JSON()
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"name": "orders",
+			"description": "Processes an order",
+			"version": "1.0.0",
+			"inputs": {"order_id": {"type": "string", "required": true}},
+			"steps": [{"name": "fetch", "type": "http", "config": {"url": "https://orders.internal/orders"}}]
+		}`, string(encoded))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		creator := &recordingCreator{}
+		result, err := New(versioning.NewValidator(nil), creator.create).Import(ctx, filepath.Join("testdata", "refunds.json"), false)
+		require.NoError(t, err)
+
+		assert.Equal(t, "refunds", result.Name)
+		assert.NotEmpty(t, result.Warnings)
+		require.Len(t, creator.definitions, 1)
+		assert.Equal(t, "Refunds an order", creator.definitions[0].Description)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		creator := &recordingCreator{}
+		result, err := New(versioning.NewValidator(nil), creator.create).Import(ctx, filepath.Join("testdata", "orders.yaml"), true)
+		require.NoError(t, err)
+
+		assert.Equal(t, "orders", result.Name)
+		assert.Nil(t, result.Workflow)
+		assert.Empty(t, creator.definitions)
+	})
+
+	t.Run("create failure", func(t *testing.T) {
+		creator := &recordingCreator{err: errors.New("duplicate workflow name")}
+		_, err := New(versioning.NewValidator(nil), creator.create).Import(ctx, filepath.Join("testdata", "orders.yaml"), false)
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrInvalidDefinition))
+		assert.Contains(t, err.Error(), "failed to create workflow orders: duplicate workflow name")
+	})
+}
+
+func TestImportInvalid(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("validation", func(t *testing.T) {
+		for _, dryRun := range []bool{false, true} {
+			creator := &recordingCreator{}
+			_, err := New(versioning.NewValidator(nil), creator.create).Import(ctx, filepath.Join("testdata", "invalid.yaml"), dryRun)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrInvalidDefinition))
+			assert.Contains(t, err.Error(), "invalid.yaml")
+			assert.Contains(t, err.Error(), "unsupported step type: teleport")
+			assert.Empty(t, creator.definitions)
+		}
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		dir := t.TempDir()
+		for name, content := range map[string]string{
+			"broken.yaml": "name: orders\nsteps: [\n",
+			"broken.json": `{"name": "orders", "steps": [`,
+			"empty.yaml":  "",
+		} {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+			_, err := New(versioning.NewValidator(nil), nil).Import(ctx, path, true)
+			require.Error(t, err, name)
+			assert.True(t, errors.Is(err, ErrInvalidDefinition), name)
+			assert.Contains(t, err.Error(), name)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := New(versioning.NewValidator(nil), nil).Import(ctx, filepath.Join("testdata", "missing.yaml"), true)
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrInvalidDefinition))
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+}
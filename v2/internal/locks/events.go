@@ -0,0 +1,29 @@
+package locks
+
+import (
+	"context"
+
+	"magic-flow/v2/internal/engine"
+)
+
+// EventHandler releases the locks of executions when they end, whether they
+// completed, failed or were cancelled
+type EventHandler struct {
+	manager *Manager
+}
+
+// NewEventHandler creates an engine event handler for the lock manager
+func NewEventHandler(manager *Manager) *EventHandler {
+	return &EventHandler{manager: manager}
+}
+
+// Handle releases all locks held by the execution of a terminal event
+func (h *EventHandler) Handle(event *engine.WorkflowEvent) error {
+	_, err := h.manager.ReleaseHolder(context.Background(), event.ExecutionID.String())
+	return err
+}
+
+// GetEventTypes returns the event types handled
+func (h *EventHandler) GetEventTypes() []string {
+	return []string{"execution.completed", "execution.failed", "execution.cancelled"}
+}
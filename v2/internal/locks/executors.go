@@ -0,0 +1,212 @@
+package locks
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+const (
+	defaultTTL         = 30 * time.Second
+	defaultWaitTimeout = 10 * time.Second
+)
+
+var placeholderPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// LockExecutor executes lock steps. The locks are held by the execution
+// until an unlock step releases them or the execution ends.
+type LockExecutor struct {
+	manager *Manager
+}
+
+// NewLockExecutor creates a new lock executor
+func NewLockExecutor(manager *Manager) *LockExecutor {
+	return &LockExecutor{manager: manager}
+}
+
+// Execute acquires the configured locks. The output holds the acquired lock
+// names, their fencing tokens and, under engine.FencingTokenVariable, the
+// token of the first lock in acquisition order.
+func (e *LockExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
+	typed, err := stepConfig(ctx, stepconfig.LockSchema, "lock", step)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := typed.(*stepconfig.LockConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid lock configuration")
+	}
+
+	holder, err := executionHolder(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := renderNames(config.Names, input)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := parseDuration("ttl", config.TTL, defaultTTL)
+	if err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		return nil, fmt.Errorf("invalid ttl %q: must be positive", config.TTL)
+	}
+	wait, err := parseDuration("wait_timeout", config.WaitTimeout, defaultWaitTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	acquired, err := e.manager.Acquire(ctx, holder, names, ttl, wait)
+	if err != nil {
+		return nil, err
+	}
+
+	lockNames := make([]string, 0, len(acquired))
+	tokens := make(map[string]interface{}, len(acquired))
+	for _, lock := range acquired {
+		lockNames = append(lockNames, lock.Name)
+		tokens[lock.Name] = lock.Token
+	}
+
+	return map[string]interface{}{
+		"locks":                     lockNames,
+		"lock_tokens":               tokens,
+		engine.FencingTokenVariable: acquired[0].Token,
+	}, nil
+}
+
+func (e *LockExecutor) Validate(step *models.WorkflowStep) error {
+	_, err := stepconfig.LockSchema.Validate(stepconfig.Section("lock", step.Config), false)
+	return err
+}
+
+func (e *LockExecutor) GetType() string {
+	return "lock"
+}
+
+func (e *LockExecutor) ConfigSchema() *stepconfig.Schema {
+	return stepconfig.LockSchema
+}
+
+// UnlockExecutor executes unlock steps
+type UnlockExecutor struct {
+	manager *Manager
+}
+
+// NewUnlockExecutor creates a new unlock executor
+func NewUnlockExecutor(manager *Manager) *UnlockExecutor {
+	return &UnlockExecutor{manager: manager}
+}
+
+// Execute releases the configured locks, or all locks of the execution when
+// no names are configured
+func (e *UnlockExecutor) Execute(ctx context.Context, step *models.WorkflowStep, input map[string]interface{}) (map[string]interface{}, error) {
+	typed, err := stepConfig(ctx, stepconfig.UnlockSchema, "unlock", step)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := typed.(*stepconfig.UnlockConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid unlock configuration")
+	}
+
+	holder, err := executionHolder(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Names) == 0 {
+		released, err := e.manager.ReleaseHolder(ctx, holder)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"released_locks": released}, nil
+	}
+
+	names, err := renderNames(config.Names, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.manager.Release(ctx, holder, names); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"released_locks": sortedNames(names)}, nil
+}
+
+func (e *UnlockExecutor) Validate(step *models.WorkflowStep) error {
+	_, err := stepconfig.UnlockSchema.Validate(stepconfig.Section("unlock", step.Config), false)
+	return err
+}
+
+func (e *UnlockExecutor) GetType() string {
+	return "unlock"
+}
+
+func (e *UnlockExecutor) ConfigSchema() *stepconfig.Schema {
+	return stepconfig.UnlockSchema
+}
+
+// stepConfig returns the typed config the engine decoded for a step,
+// decoding the raw config when the step runs outside the engine
+func stepConfig(ctx context.Context, schema *stepconfig.Schema, stepType string, step *models.WorkflowStep) (interface{}, error) {
+	if config, ok := engine.StepConfigFromContext(ctx); ok {
+		return config, nil
+	}
+	return schema.Decode(stepconfig.Section(stepType, step.Config))
+}
+
+// executionHolder returns the lock holder of the running execution
+func executionHolder(ctx context.Context) (string, error) {
+	executionID, ok := engine.ExecutionIDFromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("lock steps must run within an execution")
+	}
+	return executionID.String(), nil
+}
+
+// renderNames substitutes ${variable} placeholders in lock names with values
+// from the step input
+func renderNames(names []string, input map[string]interface{}) ([]string, error) {
+	rendered := make([]string, 0, len(names))
+	for _, name := range names {
+		var missing string
+		value := placeholderPattern.ReplaceAllStringFunc(name, func(placeholder string) string {
+			variable := placeholderPattern.FindStringSubmatch(placeholder)[1]
+			value, exists := input[variable]
+			if !exists || value == nil {
+				missing = variable
+				return ""
+			}
+			return fmt.Sprintf("%v", value)
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("lock name %q references unknown variable %q", name, missing)
+		}
+		rendered = append(rendered, value)
+	}
+	return rendered, nil
+}
+
+// parseDuration parses a duration field, falling back to a default when the
+// field is not set
+func parseDuration(field, value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must not be negative", field, value)
+	}
+	return duration, nil
+}
@@ -0,0 +1,115 @@
+package locks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers provides HTTP handlers for execution locks
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new lock handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers lock routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		locks := v1.Group("/locks")
+		{
+			locks.GET("", h.ListLocks)
+			locks.GET("/:name/verify", h.VerifyToken)
+			locks.POST("/:name/force-release", h.ForceRelease)
+		}
+	}
+}
+
+// ForceReleaseRequest is the request body of a force release
+type ForceReleaseRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ListLocks returns the locks currently held by executions
+// @Summary List execution locks
+// @Tags locks
+// @Produce json
+// @Success 200 {array} Lock
+// @Router /api/v1/locks [get]
+func (h *Handlers) ListLocks(c *gin.Context) {
+	locks, err := h.manager.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, locks)
+}
+
+// VerifyToken checks that a fencing token belongs to the current holder of a
+// lock. Downstream services call it with the X-Fencing-Token they received.
+// @Summary Verify fencing token
+// @Tags locks
+// @Produce json
+// @Param name path string true "Lock name"
+// @Param token query int true "Fencing token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/locks/{name}/verify [get]
+func (h *Handlers) VerifyToken(c *gin.Context) {
+	token, err := strconv.ParseUint(c.Query("token"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token must be a positive integer"})
+		return
+	}
+
+	if err := h.manager.Verify(c.Request.Context(), c.Param("name"), token); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrStaleToken) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": true})
+}
+
+// ForceRelease releases a lock regardless of its holder. The action is
+// recorded in the lock audit log.
+// @Summary Force release execution lock
+// @Tags locks
+// @Accept json
+// @Produce json
+// @Param name path string true "Lock name"
+// @Param request body ForceReleaseRequest true "Force release request"
+// @Success 200 {object} Lock
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/locks/{name}/force-release [post]
+func (h *Handlers) ForceRelease(c *gin.Context) {
+	var req ForceReleaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lock, err := h.manager.ForceRelease(c.Request.Context(), c.Param("name"), c.GetHeader("X-User-ID"), req.Reason)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrLockNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, lock)
+}
@@ -0,0 +1,278 @@
+package locks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+func newTestManager(store Store) (*Manager, *scheduler.FakeClock) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	clock := scheduler.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewManager(store, logger)
+	manager.now = clock.Now
+	manager.pollInterval = time.Millisecond
+	return manager, clock
+}
+
+func TestManagerContention(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("held lock times out", func(t *testing.T) {
+		manager, _ := newTestManager(NewMemoryStore())
+
+		_, err := manager.Acquire(ctx, "exec-a", []string{"customer:1"}, time.Minute, 0)
+		require.NoError(t, err)
+
+		_, err = manager.Acquire(ctx, "exec-b", []string{"customer:1"}, time.Minute, 0)
+		assert.ErrorIs(t, err, ErrLockTimeout)
+
+		_, err = manager.Acquire(ctx, "exec-b", []string{"customer:2"}, time.Minute, 0)
+		assert.NoError(t, err, "other locks are independent")
+	})
+
+	t.Run("waiter acquires after release", func(t *testing.T) {
+		manager, _ := newTestManager(NewMemoryStore())
+		manager.now = time.Now
+
+		first, err := manager.Acquire(ctx, "exec-a", []string{"customer:1"}, time.Minute, 0)
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			manager.Release(ctx, "exec-a", []string{"customer:1"})
+		}()
+
+		second, err := manager.Acquire(ctx, "exec-b", []string{"customer:1"}, time.Minute, 5*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, first[0].Token+1, second[0].Token)
+	})
+
+	t.Run("re-acquiring extends the lease", func(t *testing.T) {
+		manager, clock := newTestManager(NewMemoryStore())
+
+		first, err := manager.Acquire(ctx, "exec-a", []string{"customer:1"}, time.Minute, 0)
+		require.NoError(t, err)
+
+		clock.Advance(50 * time.Second)
+		second, err := manager.Acquire(ctx, "exec-a", []string{"customer:1"}, time.Minute, 0)
+		require.NoError(t, err)
+
+		assert.Equal(t, first[0].Token, second[0].Token)
+		assert.Equal(t, clock.Now().Add(time.Minute), second[0].ExpiresAt)
+	})
+}
+
+func TestManagerFencing(t *testing.T) {
+	ctx := context.Background()
+	manager, clock := newTestManager(NewMemoryStore())
+
+	stale, err := manager.Acquire(ctx, "exec-a", []string{"customer:1"}, 30*time.Second, 0)
+	require.NoError(t, err)
+	require.NoError(t, manager.Verify(ctx, "customer:1", stale[0].Token))
+
+	clock.Advance(31 * time.Second)
+	assert.ErrorIs(t, manager.Verify(ctx, "customer:1", stale[0].Token), ErrStaleToken, "expired tokens must be rejected")
+
+	current, err := manager.Acquire(ctx, "exec-b", []string{"customer:1"}, 30*time.Second, 0)
+	require.NoError(t, err)
+	assert.Greater(t, current[0].Token, stale[0].Token)
+
+	assert.ErrorIs(t, manager.Verify(ctx, "customer:1", stale[0].Token), ErrStaleToken)
+	assert.NoError(t, manager.Verify(ctx, "customer:1", current[0].Token))
+	assert.ErrorIs(t, manager.Verify(ctx, "customer:2", 1), ErrStaleToken)
+
+	// The stale holder cannot release the new holder's lock
+	require.NoError(t, manager.Release(ctx, "exec-a", []string{"customer:1"}))
+	assert.NoError(t, manager.Verify(ctx, "customer:1", current[0].Token))
+}
+
+func TestManagerMultiLock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("locks are acquired in sorted order", func(t *testing.T) {
+		manager, _ := newTestManager(NewMemoryStore())
+
+		acquired, err := manager.Acquire(ctx, "exec-a", []string{"order:9", "customer:1", "order:9"}, time.Minute, 0)
+		require.NoError(t, err)
+
+		require.Len(t, acquired, 2)
+		assert.Equal(t, "customer:1", acquired[0].Name)
+		assert.Equal(t, "order:9", acquired[1].Name)
+	})
+
+	t.Run("failed acquisition releases taken locks", func(t *testing.T) {
+		manager, _ := newTestManager(NewMemoryStore())
+
+		_, err := manager.Acquire(ctx, "exec-a", []string{"a"}, time.Minute, 0)
+		require.NoError(t, err)
+		_, err = manager.Acquire(ctx, "exec-b", []string{"c"}, time.Minute, 0)
+		require.NoError(t, err)
+
+		_, err = manager.Acquire(ctx, "exec-a", []string{"c", "b", "a"}, time.Minute, 0)
+		assert.ErrorIs(t, err, ErrLockTimeout)
+
+		locks, err := manager.List(ctx)
+		require.NoError(t, err)
+		holders := make(map[string]string)
+		for _, lock := range locks {
+			holders[lock.Name] = lock.Holder
+		}
+		assert.Equal(t, map[string]string{"a": "exec-a", "c": "exec-b"}, holders,
+			"b must be released and the previously held a kept")
+	})
+
+	t.Run("no names", func(t *testing.T) {
+		manager, _ := newTestManager(NewMemoryStore())
+
+		_, err := manager.Acquire(ctx, "exec-a", []string{""}, time.Minute, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestLockExecutors(t *testing.T) {
+	manager, _ := newTestManager(NewMemoryStore())
+	executionID := uuid.New()
+	ctx := engine.WithExecutionID(context.Background(), executionID)
+
+	lockStep := &models.WorkflowStep{
+		Type: "lock",
+		Config: map[string]interface{}{
+			"names": []interface{}{"customer:${customer_id}", "order:${order_id}"},
+			"ttl":   "1m",
+		},
+	}
+	output, err := NewLockExecutor(manager).Execute(ctx, lockStep, map[string]interface{}{"customer_id": 42, "order_id": "A-1"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"customer:42", "order:A-1"}, output["locks"])
+	assert.Equal(t, map[string]interface{}{"customer:42": uint64(1), "order:A-1": uint64(1)}, output["lock_tokens"])
+	assert.Equal(t, uint64(1), output[engine.FencingTokenVariable])
+
+	locks, err := manager.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, locks, 2)
+	assert.Equal(t, executionID.String(), locks[0].Holder)
+
+	_, err = NewLockExecutor(manager).Execute(ctx, lockStep, map[string]interface{}{"customer_id": 42})
+	assert.ErrorContains(t, err, `unknown variable "order_id"`)
+
+	_, err = NewLockExecutor(manager).Execute(context.Background(), lockStep, map[string]interface{}{"customer_id": 42, "order_id": "A-1"})
+	assert.ErrorContains(t, err, "within an execution")
+
+	unlockStep := &models.WorkflowStep{
+		Type:   "unlock",
+		Config: map[string]interface{}{"names": []interface{}{"order:${order_id}"}},
+	}
+	output, err = NewUnlockExecutor(manager).Execute(ctx, unlockStep, map[string]interface{}{"order_id": "A-1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order:A-1"}, output["released_locks"])
+
+	output, err = NewUnlockExecutor(manager).Execute(ctx, &models.WorkflowStep{Type: "unlock"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"customer:42"}, output["released_locks"])
+
+	locks, err = manager.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, locks)
+}
+
+func TestEventHandlerReleasesOnFailure(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := newTestManager(NewMemoryStore())
+	failed := uuid.New()
+	running := uuid.New()
+
+	_, err := manager.Acquire(ctx, failed.String(), []string{"customer:1", "customer:2"}, time.Minute, 0)
+	require.NoError(t, err)
+	_, err = manager.Acquire(ctx, running.String(), []string{"customer:3"}, time.Minute, 0)
+	require.NoError(t, err)
+
+	handler := NewEventHandler(manager)
+	assert.Contains(t, handler.GetEventTypes(), "execution.failed")
+	require.NoError(t, handler.Handle(&engine.WorkflowEvent{Type: "execution.failed", ExecutionID: failed}))
+
+	locks, err := manager.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, locks, 1)
+	assert.Equal(t, "customer:3", locks[0].Name)
+
+	_, err = manager.Acquire(ctx, "exec-next", []string{"customer:1"}, time.Minute, 0)
+	assert.NoError(t, err, "locks of failed executions must be free")
+}
+
+func TestForceRelease(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := correlation.WithID(context.Background(), "order-42")
+	store := NewMemoryStore()
+	manager, _ := newTestManager(store)
+
+	held, err := manager.Acquire(ctx, "exec-a", []string{"customer:1"}, time.Minute, 0)
+	require.NoError(t, err)
+
+	router := gin.New()
+	NewHandlers(manager).RegisterRoutes(router.Group("/api"))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "admin")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/api/v1/locks", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listed []*Lock
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, "exec-a", listed[0].Holder)
+
+	rec = request(http.MethodPost, "/api/v1/locks/customer:1/force-release", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a reason is required")
+
+	rec = request(http.MethodPost, "/api/v1/locks/customer:1/force-release", `{"reason":"stuck execution"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	audit := store.Audit()
+	require.Len(t, audit, 1)
+	assert.Equal(t, "customer:1", audit[0].LockName)
+	assert.Equal(t, "force_release", audit[0].Action)
+	assert.Equal(t, "exec-a", audit[0].Holder)
+	assert.Equal(t, "order-42", audit[0].CorrelationID, "the audit entry carries the holder's correlation ID")
+	assert.Equal(t, held[0].Token, audit[0].Token)
+	assert.Equal(t, "admin", audit[0].Actor)
+	assert.Equal(t, "stuck execution", audit[0].Reason)
+
+	rec = request(http.MethodGet, "/api/v1/locks/customer:1/verify?token=1", "")
+	assert.Equal(t, http.StatusConflict, rec.Code, "the released holder's token must be rejected")
+
+	rec = request(http.MethodPost, "/api/v1/locks/customer:1/force-release", `{"reason":"again"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	next, err := manager.Acquire(ctx, "exec-b", []string{"customer:1"}, time.Minute, 0)
+	require.NoError(t, err)
+	assert.Equal(t, held[0].Token+1, next[0].Token)
+
+	rec = request(http.MethodGet, "/api/v1/locks/customer:1/verify?token=2", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,199 @@
+package locks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultPollInterval = 100 * time.Millisecond
+
+// Manager acquires and releases locks on behalf of executions
+type Manager struct {
+	store        Store
+	logger       *logrus.Logger
+	now          func() time.Time
+	pollInterval time.Duration
+}
+
+// NewManager creates a lock manager
+func NewManager(store Store, logger *logrus.Logger) *Manager {
+	return &Manager{
+		store:        store,
+		logger:       logger,
+		now:          time.Now,
+		pollInterval: defaultPollInterval,
+	}
+}
+
+// Acquire takes all named locks for a holder, waiting up to wait for locks
+// held by others. Locks are taken in sorted order so executions acquiring
+// overlapping sets cannot deadlock. Either all locks are acquired or none.
+func (m *Manager) Acquire(ctx context.Context, holder string, names []string, ttl, wait time.Duration) ([]*Lock, error) {
+	names = sortedNames(names)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no locks to acquire")
+	}
+
+	deadline := m.now().Add(wait)
+	acquired := make([]*Lock, 0, len(names))
+	var taken []*Lock
+	for _, name := range names {
+		lock, fresh, err := m.acquireOne(ctx, holder, name, ttl, deadline)
+		if err != nil {
+			// Locks the holder already had before this call stay held
+			m.releaseAll(holder, taken)
+			return nil, err
+		}
+		acquired = append(acquired, lock)
+		if fresh {
+			taken = append(taken, lock)
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"holder": holder,
+		"locks":  names,
+	}).Debug("Locks acquired")
+
+	return acquired, nil
+}
+
+// acquireOne polls for a lock until it is acquired or the deadline passes.
+// fresh reports whether the lock was newly taken rather than extended.
+func (m *Manager) acquireOne(ctx context.Context, holder, name string, ttl time.Duration, deadline time.Time) (*Lock, bool, error) {
+	current, err := m.store.Get(ctx, name)
+	if err != nil && !errors.Is(err, ErrLockNotFound) {
+		return nil, false, fmt.Errorf("failed to get lock %s: %w", name, err)
+	}
+	fresh := current == nil || current.Holder != holder || !current.HeldAt(m.now())
+
+	for {
+		lock, err := m.store.Acquire(ctx, name, holder, m.now(), ttl)
+		if err == nil {
+			return lock, fresh, nil
+		}
+		if !errors.Is(err, ErrLockHeld) {
+			return nil, false, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+		}
+		if !m.now().Before(deadline) {
+			return nil, false, fmt.Errorf("%w %s", ErrLockTimeout, name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// releaseAll releases locks taken by a failed multi-lock acquisition
+func (m *Manager) releaseAll(holder string, acquired []*Lock) {
+	for _, lock := range acquired {
+		if err := m.store.Release(context.Background(), lock.Name, holder); err != nil {
+			m.logger.WithError(err).WithField("lock", lock.Name).Error("Failed to release lock")
+		}
+	}
+}
+
+// Release releases named locks of a holder. Locks the holder no longer
+// holds are skipped.
+func (m *Manager) Release(ctx context.Context, holder string, names []string) error {
+	for _, name := range sortedNames(names) {
+		if err := m.store.Release(ctx, name, holder); err != nil {
+			return fmt.Errorf("failed to release lock %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ReleaseHolder releases all locks of a holder and returns their names
+func (m *Manager) ReleaseHolder(ctx context.Context, holder string) ([]string, error) {
+	released, err := m.store.ReleaseHolder(ctx, holder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release locks of %s: %w", holder, err)
+	}
+
+	if len(released) > 0 {
+		m.logger.WithFields(logrus.Fields{
+			"holder": holder,
+			"locks":  released,
+		}).Debug("Locks released")
+	}
+	return released, nil
+}
+
+// ForceRelease releases a lock regardless of its holder and records who did
+// it and why. The stale holder's fencing token is rejected by Verify.
+func (m *Manager) ForceRelease(ctx context.Context, name, actor, reason string) (*Lock, error) {
+	lock, err := m.store.ForceRelease(ctx, name, m.now())
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &AuditEntry{
+		LockName:      name,
+		Action:        "force_release",
+		Holder:        lock.Holder,
+		CorrelationID: lock.CorrelationID,
+		Token:         lock.Token,
+		Actor:         actor,
+		Reason:        reason,
+		CreatedAt:     m.now(),
+	}
+	if err := m.store.RecordAudit(ctx, entry); err != nil {
+		return nil, fmt.Errorf("failed to audit force release of %s: %w", name, err)
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"lock":   name,
+		"holder": lock.Holder,
+		"token":  lock.Token,
+		"actor":  actor,
+		"reason": reason,
+	}).Warn("Lock force released")
+
+	return lock, nil
+}
+
+// Verify checks that a fencing token belongs to the current holder of a
+// lock. Tokens of expired, released or stolen locks are rejected with
+// ErrStaleToken.
+func (m *Manager) Verify(ctx context.Context, name string, token uint64) error {
+	lock, err := m.store.Get(ctx, name)
+	if errors.Is(err, ErrLockNotFound) {
+		return ErrStaleToken
+	}
+	if err != nil {
+		return err
+	}
+
+	if !lock.HeldAt(m.now()) || lock.Token != token {
+		return ErrStaleToken
+	}
+	return nil
+}
+
+// List returns the currently held locks
+func (m *Manager) List(ctx context.Context) ([]*Lock, error) {
+	return m.store.List(ctx, m.now())
+}
+
+// sortedNames returns the distinct non-empty names in acquisition order
+func sortedNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	sorted := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
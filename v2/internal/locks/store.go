@@ -0,0 +1,346 @@
+package locks
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"magic-flow/v2/internal/correlation"
+)
+
+var (
+	// ErrLockHeld is returned when a lock is held by another holder
+	ErrLockHeld = errors.New("lock is held by another execution")
+	// ErrLockTimeout is returned when locks could not be acquired in time
+	ErrLockTimeout = errors.New("timed out waiting for lock")
+	// ErrStaleToken is returned when a fencing token no longer matches the
+	// current holder of a lock
+	ErrStaleToken = errors.New("stale fencing token")
+	// ErrLockNotFound is returned when a lock is not held
+	ErrLockNotFound = errors.New("lock not found")
+)
+
+// Lock is a named lock. Released locks keep their row so the fencing token
+// keeps increasing across holders.
+type Lock struct {
+	Name          string    `json:"name" gorm:"primaryKey"`
+	Holder        string    `json:"holder" gorm:"index"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Token         uint64    `json:"token" gorm:"not null"`
+	AcquiredAt    time.Time `json:"acquired_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// TableName returns the table name for the Lock model
+func (Lock) TableName() string {
+	return "execution_locks"
+}
+
+// HeldAt reports whether the lock is held at the given time
+func (l *Lock) HeldAt(now time.Time) bool {
+	return l.Holder != "" && now.Before(l.ExpiresAt)
+}
+
+// AuditEntry records an administrative action on a lock
+type AuditEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	LockName      string    `json:"lock_name" gorm:"not null;index"`
+	Action        string    `json:"action" gorm:"not null"`
+	Holder        string    `json:"holder"`
+	CorrelationID string    `json:"correlation_id,omitempty" gorm:"index"`
+	Token         uint64    `json:"token"`
+	Actor         string    `json:"actor"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the AuditEntry model
+func (AuditEntry) TableName() string {
+	return "lock_audit"
+}
+
+// Store persists locks. Acquire must be atomic so that only one holder can
+// take a lock, and must increment the token whenever the holder changes.
+type Store interface {
+	Acquire(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (*Lock, error)
+	Release(ctx context.Context, name, holder string) error
+	ReleaseHolder(ctx context.Context, holder string) ([]string, error)
+	ForceRelease(ctx context.Context, name string, now time.Time) (*Lock, error)
+	Get(ctx context.Context, name string) (*Lock, error)
+	List(ctx context.Context, now time.Time) ([]*Lock, error)
+	RecordAudit(ctx context.Context, entry *AuditEntry) error
+}
+
+// acquire applies an acquisition to the current state of a lock, which is
+// nil when the lock was never taken. The lock records the correlation ID of
+// the acquiring execution, taken from ctx.
+func acquire(ctx context.Context, current *Lock, name, holder string, now time.Time, ttl time.Duration) (*Lock, error) {
+	if current == nil {
+		current = &Lock{Name: name}
+	}
+
+	if current.HeldAt(now) && current.Holder != holder {
+		return nil, ErrLockHeld
+	}
+
+	lock := *current
+	if !current.HeldAt(now) {
+		// A new holder, including one whose own lock expired, gets a new token
+		lock.Token++
+		lock.AcquiredAt = now
+		lock.CorrelationID = correlation.FromContext(ctx)
+	}
+	lock.Holder = holder
+	lock.ExpiresAt = now.Add(ttl)
+	return &lock, nil
+}
+
+// MemoryStore is a Store kept in memory. Locks only coordinate executions of
+// a single process, so it is only suitable for tests and development.
+type MemoryStore struct {
+	mu    sync.Mutex
+	locks map[string]*Lock
+	audit []*AuditEntry
+}
+
+// NewMemoryStore creates an in-memory lock store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{locks: make(map[string]*Lock)}
+}
+
+// Acquire takes a lock for a holder or extends the holder's lease
+func (s *MemoryStore) Acquire(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (*Lock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, err := acquire(ctx, s.locks[name], name, holder, now, ttl)
+	if err != nil {
+		return nil, err
+	}
+	s.locks[name] = lock
+
+	acquired := *lock
+	return &acquired, nil
+}
+
+// Release releases a lock held by a holder
+func (s *MemoryStore) Release(ctx context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lock, exists := s.locks[name]; exists && lock.Holder == holder {
+		lock.Holder = ""
+	}
+	return nil
+}
+
+// ReleaseHolder releases all locks of a holder
+func (s *MemoryStore) ReleaseHolder(ctx context.Context, holder string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var released []string
+	for name, lock := range s.locks {
+		if lock.Holder == holder {
+			lock.Holder = ""
+			released = append(released, name)
+		}
+	}
+	sort.Strings(released)
+	return released, nil
+}
+
+// ForceRelease releases a lock regardless of its holder
+func (s *MemoryStore) ForceRelease(ctx context.Context, name string, now time.Time) (*Lock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, exists := s.locks[name]
+	if !exists || !lock.HeldAt(now) {
+		return nil, ErrLockNotFound
+	}
+
+	released := *lock
+	lock.Holder = ""
+	return &released, nil
+}
+
+// Get returns a lock
+func (s *MemoryStore) Get(ctx context.Context, name string) (*Lock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, exists := s.locks[name]
+	if !exists {
+		return nil, ErrLockNotFound
+	}
+
+	found := *lock
+	return &found, nil
+}
+
+// List returns the locks held at the given time
+func (s *MemoryStore) List(ctx context.Context, now time.Time) ([]*Lock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locks := make([]*Lock, 0, len(s.locks))
+	for _, lock := range s.locks {
+		if lock.HeldAt(now) {
+			held := *lock
+			locks = append(locks, &held)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Name < locks[j].Name
+	})
+	return locks, nil
+}
+
+// RecordAudit stores an audit entry
+func (s *MemoryStore) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+// Audit returns the recorded audit entries
+func (s *MemoryStore) Audit() []*AuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*AuditEntry(nil), s.audit...)
+}
+
+// GormStore keeps locks in the execution_locks table and their audit trail
+// in the lock_audit table. Lock rows are read with SELECT ... FOR UPDATE so
+// acquisitions from several servers are serialized by the database.
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database lock store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the lock and audit tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Lock{}, &AuditEntry{})
+}
+
+// Acquire takes a lock for a holder or extends the holder's lease
+func (s *GormStore) Acquire(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (*Lock, error) {
+	var acquired *Lock
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current *Lock
+		var row Lock
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", name).First(&row).Error
+		switch {
+		case err == nil:
+			current = &row
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		lock, err := acquire(ctx, current, name, holder, now, ttl)
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			// Concurrent first acquisitions race on the primary key
+			if err := tx.Create(lock).Error; err != nil {
+				return ErrLockHeld
+			}
+		} else if err := tx.Save(lock).Error; err != nil {
+			return err
+		}
+
+		acquired = lock
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acquired, nil
+}
+
+// Release releases a lock held by a holder
+func (s *GormStore) Release(ctx context.Context, name, holder string) error {
+	return s.db.WithContext(ctx).Model(&Lock{}).
+		Where("name = ? AND holder = ?", name, holder).
+		Update("holder", "").Error
+}
+
+// ReleaseHolder releases all locks of a holder
+func (s *GormStore) ReleaseHolder(ctx context.Context, holder string) ([]string, error) {
+	var released []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Lock{}).Where("holder = ?", holder).Order("name").Pluck("name", &released).Error; err != nil {
+			return err
+		}
+		if len(released) == 0 {
+			return nil
+		}
+		return tx.Model(&Lock{}).Where("holder = ?", holder).Update("holder", "").Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+// ForceRelease releases a lock regardless of its holder
+func (s *GormStore) ForceRelease(ctx context.Context, name string, now time.Time) (*Lock, error) {
+	var released Lock
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", name).First(&released).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !released.HeldAt(now)) {
+			return ErrLockNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Lock{}).Where("name = ?", name).Update("holder", "").Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &released, nil
+}
+
+// Get returns a lock
+func (s *GormStore) Get(ctx context.Context, name string) (*Lock, error) {
+	var lock Lock
+	err := s.db.WithContext(ctx).Where("name = ?", name).First(&lock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrLockNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// List returns the locks held at the given time
+func (s *GormStore) List(ctx context.Context, now time.Time) ([]*Lock, error) {
+	var locks []*Lock
+	err := s.db.WithContext(ctx).
+		Where("holder <> '' AND expires_at > ?", now).
+		Order("name").
+		Find(&locks).Error
+	return locks, err
+}
+
+// RecordAudit stores an audit entry
+func (s *GormStore) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	return s.db.WithContext(ctx).Create(entry).Error
+}
@@ -0,0 +1,300 @@
+package negotiation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/ugorji/go/codec"
+)
+
+// timestampExt is the MessagePack timestamp extension type, -1
+const timestampExt = 0xff
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	mapType  = reflect.TypeOf(map[string]interface{}(nil))
+)
+
+// handle encodes values the way encoding/json does: field names come from
+// json tags, and times and UUIDs are strings, so MessagePack bodies carry the
+// same documents as JSON ones. Decoded times may also be timestamp
+// extensions.
+var handle = newHandle()
+
+func newHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{}
+	handle.TypeInfos = codec.NewTypeInfos([]string{"json"})
+	handle.MapType = mapType
+	handle.RawToString = true
+	// Times use the extension below rather than the timestamp extension
+	handle.TimeNotBuiltin = true
+	// Without the extension preamble, extensions are written as strings
+	handle.WriteExt = false
+	if err := handle.SetBytesExt(timeType, timestampExt, timeExt{}); err != nil {
+		panic(err)
+	}
+	if err := handle.SetBytesExt(uuidType, 0, uuidExt{}); err != nil {
+		panic(err)
+	}
+	return handle
+}
+
+// timeExt encodes times as RFC 3339 strings, like encoding/json, and
+// decodes them from strings or timestamp extensions
+type timeExt struct{}
+
+func (timeExt) WriteExt(v interface{}) []byte {
+	var t time.Time
+	switch value := v.(type) {
+	case time.Time:
+		t = value
+	case *time.Time:
+		t = *value
+	}
+	text, _ := t.MarshalText()
+	return text
+}
+
+func (timeExt) ReadExt(dst interface{}, src []byte) {
+	t, err := decodeTime(src)
+	if err != nil {
+		panic(err)
+	}
+	*(dst.(*time.Time)) = t
+}
+
+// decodeTime decodes the 4, 8 or 12 bytes of a timestamp extension, or an
+// RFC 3339 string, which is longer
+func decodeTime(src []byte) (time.Time, error) {
+	switch len(src) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(src)), 0).UTC(), nil
+	case 8:
+		data := binary.BigEndian.Uint64(src)
+		return time.Unix(int64(data&0x3ffffffff), int64(data>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(src[:4])
+		sec := binary.BigEndian.Uint64(src[4:])
+		return time.Unix(int64(sec), int64(nsec)).UTC(), nil
+	default:
+		var t time.Time
+		err := t.UnmarshalText(src)
+		return t, err
+	}
+}
+
+// uuidExt encodes UUIDs as strings, like encoding/json
+type uuidExt struct{}
+
+func (uuidExt) WriteExt(v interface{}) []byte {
+	switch value := v.(type) {
+	case uuid.UUID:
+		return []byte(value.String())
+	case *uuid.UUID:
+		return []byte(value.String())
+	}
+	return nil
+}
+
+func (uuidExt) ReadExt(dst interface{}, src []byte) {
+	parse := uuid.ParseBytes
+	if len(src) == 16 {
+		parse = uuid.FromBytes
+	}
+	id, err := parse(src)
+	if err != nil {
+		panic(err)
+	}
+	*(dst.(*uuid.UUID)) = id
+}
+
+// Marshal encodes a value in a format
+func Marshal(format Format, v interface{}) ([]byte, error) {
+	if format != FormatMsgPack {
+		return json.Marshal(v)
+	}
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, handle).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a body in a format into obj. Numbers decoded into
+// interfaces are float64, as encoding/json decodes them.
+func Unmarshal(format Format, data []byte, obj interface{}) error {
+	if format != FormatMsgPack {
+		return json.Unmarshal(data, obj)
+	}
+	if err := codec.NewDecoderBytes(data, handle).Decode(obj); err != nil {
+		return err
+	}
+	normalize(reflect.ValueOf(obj))
+	return nil
+}
+
+// Bind decodes the request body, in the negotiated content type, into obj
+// and validates it like gin's JSON binding
+func Bind(c *gin.Context, obj interface{}) error {
+	format := FormatJSON
+	if _, negotiated := c.Get(formatKey); negotiated {
+		format, _ = requestFormat(c.ContentType())
+	}
+
+	if c.Request.Body == nil {
+		return fmt.Errorf("invalid request: empty body")
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		return binding.JSON.BindBody(body, obj)
+	}
+	if err := Unmarshal(FormatMsgPack, body, obj); err != nil {
+		return err
+	}
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// BindStatus returns the status of a Bind error: 413 for bodies exceeding
+// the size limit, 400 otherwise
+func BindStatus(err error) int {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Render writes obj in the negotiated format
+func Render(c *gin.Context, status int, obj interface{}) {
+	format := NegotiatedFormat(c)
+	if format != FormatMsgPack {
+		c.JSON(status, obj)
+		return
+	}
+	data, err := Marshal(format, obj)
+	if err != nil {
+		_ = c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode response: " + err.Error()})
+		return
+	}
+	c.Data(status, MIMEMsgPack, data)
+}
+
+// normalize converts the integers MessagePack decodes into interfaces to
+// float64
+func normalize(v reflect.Value) {
+	info := normalizeInfoOf(v.Type())
+	if !info.holds {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			normalize(v.Elem())
+		}
+	case reflect.Interface:
+		if !v.IsNil() && v.CanSet() {
+			v.Set(valueOf(normalizeValue(v.Interface()), v.Type()))
+		}
+	case reflect.Struct:
+		for _, i := range info.fields {
+			normalize(v.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			normalize(v.Index(i))
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			v.SetMapIndex(iter.Key(), valueOf(normalizeValue(iter.Value().Interface()), v.Type().Elem()))
+		}
+	}
+}
+
+// normalizeInfo is whether values of a type may hold interfaces normalize
+// converts and, for structs, the fields that may
+type normalizeInfo struct {
+	holds  bool
+	fields []int
+}
+
+// normalizeInfos caches the normalizeInfo of types, so normalize skips the
+// values that cannot hold interfaces
+var normalizeInfos sync.Map
+
+func normalizeInfoOf(t reflect.Type) *normalizeInfo {
+	if cached, ok := normalizeInfos.Load(t); ok {
+		return cached.(*normalizeInfo)
+	}
+	// Recursive types are assumed to hold interfaces while they are walked
+	normalizeInfos.Store(t, &normalizeInfo{holds: true})
+	info := &normalizeInfo{}
+	switch t.Kind() {
+	case reflect.Interface:
+		info.holds = true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		info.holds = normalizeInfoOf(t.Elem()).holds
+	case reflect.Map:
+		info.holds = t.Elem().Kind() == reflect.Interface
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.IsExported() && normalizeInfoOf(field.Type).holds {
+				info.fields = append(info.fields, i)
+			}
+		}
+		info.holds = len(info.fields) > 0
+	}
+	normalizeInfos.Store(t, info)
+	return info
+}
+
+// valueOf returns the value of an interface of type t, which may be nil
+func valueOf(value interface{}, t reflect.Type) reflect.Value {
+	if value == nil {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(value)
+}
+
+// normalizeValue returns a decoded value with its numbers as float64
+func normalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case int64:
+		return float64(typed)
+	case uint64:
+		return float64(typed)
+	case float32:
+		return float64(typed)
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = normalizeValue(item)
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = normalizeValue(item)
+		}
+		return typed
+	}
+	return value
+}
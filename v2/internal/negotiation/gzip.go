@@ -0,0 +1,89 @@
+package negotiation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compressWriter buffers a response and gzip compresses it when it reaches
+// the minimum size, so small responses are not compressed for nothing
+type compressWriter struct {
+	gin.ResponseWriter
+	min    int
+	status int
+	buf    bytes.Buffer
+}
+
+func newCompressWriter(writer gin.ResponseWriter, min int) *compressWriter {
+	return &compressWriter{ResponseWriter: writer, min: min}
+}
+
+// WriteHeader records the status, written once the body is complete
+func (w *compressWriter) WriteHeader(code int) {
+	if code > 0 && w.status == 0 {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow is deferred like WriteHeader
+func (w *compressWriter) WriteHeaderNow() {}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.buf.WriteString(s)
+}
+
+// Status returns the recorded status until the response is written
+func (w *compressWriter) Status() int {
+	if w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+// Size returns the buffered size until the response is written
+func (w *compressWriter) Size() int {
+	if w.buf.Len() > 0 {
+		return w.buf.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// Written reports whether anything was written
+func (w *compressWriter) Written() bool {
+	return w.status != 0 || w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// finish writes the buffered response, compressed when it is large enough
+func (w *compressWriter) finish() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	header := w.ResponseWriter.Header()
+	header.Add("Vary", "Accept-Encoding")
+
+	status := w.ResponseWriter.Status()
+	if w.buf.Len() < w.min || status == http.StatusNoContent || status == http.StatusNotModified ||
+		header.Get("Content-Encoding") != "" {
+		if w.buf.Len() > 0 {
+			header.Set("Content-Length", strconv.Itoa(w.buf.Len()))
+			_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		} else {
+			w.ResponseWriter.WriteHeaderNow()
+		}
+		return
+	}
+
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	writer := gzip.NewWriter(w.ResponseWriter)
+	_, _ = writer.Write(w.buf.Bytes())
+	_ = writer.Close()
+}
@@ -0,0 +1,289 @@
+// Package negotiation negotiates the encoding of the bodies of the
+// execution APIs. Requests may send JSON or MessagePack bodies, gzip
+// compressed or not, and responses are encoded in the format of the Accept
+// header, gzip compressed when large and the caller accepts it. Bodies are
+// decoded into the same structures whatever their format, so validation is
+// shared.
+package negotiation
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Media types of the supported formats
+const (
+	MIMEJSON    = "application/json"
+	MIMEMsgPack = "application/msgpack"
+	// mimeXMsgPack is the legacy media type of MessagePack, accepted as an
+	// alias
+	mimeXMsgPack = "application/x-msgpack"
+)
+
+// Format is the encoding of a body
+type Format string
+
+const (
+	FormatJSON    Format = "json"
+	FormatMsgPack Format = "msgpack"
+)
+
+// MediaType returns the media type of the format
+func (f Format) MediaType() string {
+	if f == FormatMsgPack {
+		return MIMEMsgPack
+	}
+	return MIMEJSON
+}
+
+var (
+	// ErrBodyTooLarge is returned when a request body, once decompressed,
+	// exceeds the body size limit
+	ErrBodyTooLarge = errors.New("request body too large")
+	// ErrMalformedBody is returned for compressed bodies that cannot be
+	// decompressed
+	ErrMalformedBody = errors.New("malformed compressed request body")
+)
+
+// SupportedTypes are the media types of request and response bodies
+var SupportedTypes = []string{MIMEJSON, MIMEMsgPack}
+
+// SupportedEncodings are the content encodings of request bodies
+var SupportedEncodings = []string{"identity", "gzip"}
+
+// Config configures content negotiation
+type Config struct {
+	// MaxBodyBytes is the largest request body accepted, compressed and
+	// decompressed, so small compressed bodies cannot expand without bound
+	MaxBodyBytes int64
+	// CompressMinBytes is the smallest response compressed for callers
+	// accepting gzip
+	CompressMinBytes int
+}
+
+// DefaultConfig returns the default negotiation configuration
+func DefaultConfig() Config {
+	return Config{
+		MaxBodyBytes:     10 << 20,
+		CompressMinBytes: 1024,
+	}
+}
+
+const formatKey = "negotiation.format"
+
+// Middleware negotiates the format of requests and responses. Requests
+// with an unsupported content type or encoding are rejected with 415, and
+// requests accepting none of the supported types with 406, listing the
+// supported ones.
+func Middleware(config Config) gin.HandlerFunc {
+	defaults := DefaultConfig()
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = defaults.MaxBodyBytes
+	}
+	if config.CompressMinBytes <= 0 {
+		config.CompressMinBytes = defaults.CompressMinBytes
+	}
+
+	return func(c *gin.Context) {
+		format, ok := accepted(c.GetHeader("Accept"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{
+				"error":     "none of the accepted media types is supported",
+				"supported": SupportedTypes,
+			})
+			return
+		}
+		c.Set(formatKey, format)
+		c.Writer.Header().Add("Vary", "Accept")
+
+		if hasBody(c.Request) {
+			if _, ok := requestFormat(c.ContentType()); !ok {
+				c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+					"error":     "unsupported content type " + c.ContentType(),
+					"supported": SupportedTypes,
+				})
+				return
+			}
+			if err := decompress(c.Request, config.MaxBodyBytes); err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, errUnsupportedEncoding) {
+					status = http.StatusUnsupportedMediaType
+				}
+				c.AbortWithStatusJSON(status, gin.H{
+					"error":     err.Error(),
+					"supported": SupportedEncodings,
+				})
+				return
+			}
+		}
+
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+		writer := newCompressWriter(c.Writer, config.CompressMinBytes)
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+	}
+}
+
+// NegotiatedFormat returns the response format negotiated for a request,
+// JSON on routes without negotiation
+func NegotiatedFormat(c *gin.Context) Format {
+	if format, ok := c.Get(formatKey); ok {
+		return format.(Format)
+	}
+	return FormatJSON
+}
+
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0
+}
+
+// requestFormat returns the format of a content type. Requests without one
+// are JSON, as they were before negotiation.
+func requestFormat(contentType string) (Format, bool) {
+	switch contentType {
+	case "", MIMEJSON:
+		return FormatJSON, true
+	case MIMEMsgPack, mimeXMsgPack:
+		return FormatMsgPack, true
+	default:
+		return "", false
+	}
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// accepted returns the preferred supported format of an Accept header,
+// JSON when it prefers none
+func accepted(header string) (Format, bool) {
+	if strings.TrimSpace(header) == "" {
+		return FormatJSON, true
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	for _, r := range ranges {
+		switch r.mediaType {
+		case MIMEJSON, "application/*", "*/*":
+			return FormatJSON, true
+		case MIMEMsgPack, mimeXMsgPack:
+			return FormatMsgPack, true
+		}
+	}
+	return "", false
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		params = strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return params != "q=0" && params != "q=0.0"
+	}
+	return false
+}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decompress limits the request body and streams the decompression of
+// gzip bodies, limiting the decompressed size too
+func decompress(req *http.Request, maxBytes int64) error {
+	body := &limitedReader{reader: req.Body, remaining: maxBytes}
+	encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		req.Body = readCloser{Reader: body, Closer: req.Body}
+		return nil
+	case "gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			if errors.Is(err, ErrBodyTooLarge) {
+				return err
+			}
+			return ErrMalformedBody
+		}
+		req.Body = readCloser{
+			Reader: &limitedReader{reader: gzipReader{reader}, remaining: maxBytes},
+			Closer: req.Body,
+		}
+		req.Header.Del("Content-Encoding")
+		req.ContentLength = -1
+		return nil
+	default:
+		return errUnsupportedEncoding
+	}
+}
+
+// limitedReader fails with ErrBodyTooLarge once more than remaining bytes
+// are read, unlike io.LimitReader, which ends silently
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// gzipReader reports corrupt compressed data as ErrMalformedBody
+type gzipReader struct {
+	reader *gzip.Reader
+}
+
+func (r gzipReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF && !errors.Is(err, ErrBodyTooLarge) {
+		return n, ErrMalformedBody
+	}
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
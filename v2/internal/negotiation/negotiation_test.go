@@ -0,0 +1,292 @@
+package negotiation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+type executeRequest struct {
+	Input       map[string]interface{} `json:"input" binding:"required"`
+	TriggerType string                 `json:"trigger_type" binding:"omitempty,oneof=manual api"`
+	Timeout     *int                   `json:"timeout"`
+}
+
+func newRouter(config Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/execute", Middleware(config), func(c *gin.Context) {
+		var request executeRequest
+		if err := Bind(c, &request); err != nil {
+			Render(c, BindStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		Render(c, http.StatusOK, gin.H{"input": request.Input, "trigger_type": request.TriggerType})
+	})
+	router.GET("/results", Middleware(config), func(c *gin.Context) {
+		Render(c, http.StatusOK, newExecution(1))
+	})
+	return router
+}
+
+func newExecution(steps int) *models.Execution {
+	started := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	completed := started.Add(1500 * time.Millisecond)
+	execution := &models.Execution{
+		ID:            uuid.New(),
+		WorkflowID:    uuid.New(),
+		Status:        models.ExecutionStatusCompleted,
+		TriggerType:   models.TriggerTypeAPI,
+		TriggerBy:     "orders-service",
+		InputData:     map[string]interface{}{"order_id": "ord_1234", "amount": 129.95, "items": []interface{}{"sku-1", "sku-2"}},
+		OutputData:    map[string]interface{}{"approved": true, "score": 0.87},
+		CorrelationID: "corr-5678",
+		StartedAt:     &started,
+		CompletedAt:   &completed,
+		Duration:      1500,
+		CreatedAt:     started,
+		UpdatedAt:     completed,
+	}
+	for i := 0; i < steps; i++ {
+		execution.Steps = append(execution.Steps, models.StepExecution{
+			ID:          uuid.New(),
+			ExecutionID: execution.ID,
+			StepName:    "step-" + strings.Repeat("x", i%8),
+			StepType:    "http",
+			Status:      models.StepStatusCompleted,
+			InputData:   map[string]interface{}{"url": "https://payments.internal/v1/charges", "attempt": 1},
+			OutputData:  map[string]interface{}{"status": 200, "body": map[string]interface{}{"id": "ch_1"}},
+			StartedAt:   &started,
+			CompletedAt: &completed,
+			Duration:    1500,
+			Attempt:     1,
+			MaxAttempts: 3,
+			CreatedAt:   started,
+			UpdatedAt:   completed,
+		})
+	}
+	return execution
+}
+
+func send(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func gzipped(t testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestMsgPackRequests(t *testing.T) {
+	router := newRouter(DefaultConfig())
+
+	body, err := Marshal(FormatMsgPack, map[string]interface{}{
+		"input":        map[string]interface{}{"order_id": "ord_1", "quantity": 3},
+		"trigger_type": "api",
+	})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body))
+	req.Header.Set("Content-Type", MIMEMsgPack)
+	rec := send(router, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, MIMEJSON+"; charset=utf-8", rec.Header().Get("Content-Type"), "the response is JSON unless msgpack is accepted")
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, map[string]interface{}{"order_id": "ord_1", "quantity": float64(3)}, response["input"])
+	assert.Equal(t, "api", response["trigger_type"])
+
+	// The validation of JSON bodies applies to msgpack ones
+	body, err = Marshal(FormatMsgPack, map[string]interface{}{"input": map[string]interface{}{}, "trigger_type": "cron"})
+	require.NoError(t, err)
+	req = httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body))
+	req.Header.Set("Content-Type", mimeXMsgPack)
+	rec = send(router, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "oneof")
+
+	req = httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"trigger_type":"api"}`))
+	req.Header.Set("Content-Type", MIMEJSON)
+	assert.Equal(t, http.StatusBadRequest, send(router, req).Code, "input is required")
+
+	req = httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader([]byte{0xc1}))
+	req.Header.Set("Content-Type", MIMEMsgPack)
+	assert.Equal(t, http.StatusBadRequest, send(router, req).Code, "malformed msgpack")
+}
+
+func TestMsgPackResponses(t *testing.T) {
+	router := newRouter(DefaultConfig())
+
+	req := httptest.NewRequest(http.MethodGet, "/results", nil)
+	req.Header.Set("Accept", "application/json;q=0.5, application/msgpack")
+	rec := send(router, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, MIMEMsgPack, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Accept")
+
+	var execution map[string]interface{}
+	require.NoError(t, Unmarshal(FormatMsgPack, rec.Body.Bytes(), &execution))
+	_, err := uuid.Parse(execution["id"].(string))
+	assert.NoError(t, err, "UUIDs are strings, as in JSON")
+	assert.Equal(t, "2026-03-02T10:00:00Z", execution["started_at"], "times are RFC 3339 strings, as in JSON")
+	assert.Equal(t, float64(1500), execution["duration"])
+
+	// The msgpack document decodes into the same structure as the JSON one
+	var decoded models.Execution
+	require.NoError(t, Unmarshal(FormatMsgPack, rec.Body.Bytes(), &decoded))
+	req.Header.Set("Accept", MIMEJSON)
+	var fromJSON models.Execution
+	require.NoError(t, json.Unmarshal(send(router, req).Body.Bytes(), &fromJSON))
+	assert.Equal(t, len(fromJSON.Steps), len(decoded.Steps))
+	assert.Equal(t, fromJSON.StartedAt.UTC(), decoded.StartedAt.UTC())
+	assert.Equal(t, fromJSON.OutputData, decoded.OutputData)
+	assert.Equal(t, fromJSON.Steps[0].OutputData, decoded.Steps[0].OutputData)
+}
+
+func TestNegotiationFailures(t *testing.T) {
+	router := newRouter(DefaultConfig())
+
+	req := httptest.NewRequest(http.MethodGet, "/results", nil)
+	req.Header.Set("Accept", "application/xml, text/html;q=0.9")
+	rec := send(router, req)
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	assert.Contains(t, rec.Body.String(), MIMEMsgPack)
+
+	req.Header.Set("Accept", "application/msgpack;q=0, */*")
+	assert.Equal(t, http.StatusOK, send(router, req).Code, "wildcards accept JSON")
+
+	req = httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`<input/>`))
+	req.Header.Set("Content-Type", "application/xml")
+	rec = send(router, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Contains(t, rec.Body.String(), MIMEJSON)
+
+	req = httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"input":{}}`))
+	req.Header.Set("Content-Type", MIMEJSON)
+	req.Header.Set("Content-Encoding", "br")
+	rec = send(router, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Contains(t, rec.Body.String(), "gzip")
+}
+
+func TestGzipRequests(t *testing.T) {
+	router := newRouter(Config{MaxBodyBytes: 4096})
+
+	post := func(body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(body))
+		req.Header.Set("Content-Type", MIMEJSON)
+		req.Header.Set("Content-Encoding", "gzip")
+		return send(router, req)
+	}
+
+	rec := post(gzipped(t, []byte(`{"input":{"order_id":"ord_1"}}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "ord_1")
+
+	assert.Equal(t, http.StatusBadRequest, post([]byte("not gzip")).Code, "malformed header")
+
+	truncated := gzipped(t, []byte(`{"input":{"order_id":"ord_1"}}`))
+	assert.Equal(t, http.StatusBadRequest, post(truncated[:len(truncated)-6]).Code, "truncated stream")
+
+	corrupt := gzipped(t, []byte(`{"input":{"order_id":"ord_1"}}`))
+	corrupt[len(corrupt)-5] ^= 0xff
+	assert.Equal(t, http.StatusBadRequest, post(corrupt).Code, "checksum mismatch")
+
+	// A small compressed body expanding past the limit is rejected
+	bomb := gzipped(t, []byte(`{"input":{"padding":"`+strings.Repeat("a", 1<<20)+`"}}`))
+	require.Less(t, len(bomb), 4096)
+	rec = post(bomb)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, rec.Body.String())
+
+	// The compressed body is limited too
+	req := httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"input":{"padding":"`+strings.Repeat("a", 8192)+`"}}`))
+	req.Header.Set("Content-Type", MIMEJSON)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(router, req).Code)
+}
+
+func TestGzipResponses(t *testing.T) {
+	router := newRouter(Config{CompressMinBytes: 256})
+
+	req := httptest.NewRequest(http.MethodGet, "/results", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := send(router, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Accept-Encoding")
+
+	reader, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	var execution models.Execution
+	require.NoError(t, json.Unmarshal(body, &execution))
+	assert.Len(t, execution.Steps, 1)
+
+	// Small responses are not compressed
+	req = httptest.NewRequest(http.MethodPost, "/execute", strings.NewReader(`{"input":{}}`))
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = send(router, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.JSONEq(t, `{"input":{},"trigger_type":""}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/results", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0")
+	assert.Empty(t, send(router, req).Header().Get("Content-Encoding"))
+}
+
+func BenchmarkEncode(b *testing.B) {
+	execution := newExecution(20)
+	for _, format := range []Format{FormatJSON, FormatMsgPack} {
+		b.Run(string(format), func(b *testing.B) {
+			data, err := Marshal(format, execution)
+			require.NoError(b, err)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := Marshal(format, execution); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	execution := newExecution(20)
+	for _, format := range []Format{FormatJSON, FormatMsgPack} {
+		b.Run(string(format), func(b *testing.B) {
+			data, err := Marshal(format, execution)
+			require.NoError(b, err)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var decoded models.Execution
+				if err := Unmarshal(format, data, &decoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
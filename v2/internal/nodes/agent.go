@@ -0,0 +1,210 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/pkg/models"
+)
+
+const defaultHeartbeatInterval = 10 * time.Second
+
+// Workload reports what the engine of a node can and does run. It is
+// implemented by engine.Engine.
+type Workload interface {
+	RunningExecutions() int
+	Capacity() int
+	StepTypes() []string
+}
+
+// Agent registers the node an engine runs on and keeps it alive with
+// heartbeats. It implements engine.NodePlacement, so the engine stops
+// accepting executions once the agent learns that the node was cordoned or
+// marked dead, at the latest one heartbeat after it happened.
+type Agent struct {
+	store      Store
+	workload   Workload
+	logger     *logrus.Logger
+	now        func() time.Time
+	id         string
+	version    string
+	startedAt  time.Time
+	queueDepth func() int
+
+	mu     sync.RWMutex
+	status Status
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewAgent creates the agent of a node. An empty id generates one from the
+// hostname.
+func NewAgent(store Store, id, version string, workload Workload, logger *logrus.Logger) *Agent {
+	if id == "" {
+		id = newNodeID()
+	}
+	return &Agent{
+		store:    store,
+		workload: workload,
+		logger:   logger,
+		now:      time.Now,
+		id:       id,
+		version:  version,
+		status:   StatusActive,
+	}
+}
+
+// newNodeID generates a node ID unique across restarts of a host
+func newNodeID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "node"
+	}
+	return fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8])
+}
+
+// SetQueueDepth sets the function reporting the executions waiting for the
+// node, for deployments queueing executions in front of the engine
+func (a *Agent) SetQueueDepth(queueDepth func() int) {
+	a.queueDepth = queueDepth
+}
+
+// NodeID returns the ID of the node
+func (a *Agent) NodeID() string {
+	return a.id
+}
+
+// Status returns the status of the node as of the last registration or
+// heartbeat
+func (a *Agent) Status() Status {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.status
+}
+
+// Accepting reports whether the node accepts new executions
+func (a *Agent) Accepting() bool {
+	return a.Status() == StatusActive
+}
+
+// RecordPlacement records an execution placed on the node
+func (a *Agent) RecordPlacement(ctx context.Context, executionID uuid.UUID, hop models.PlacementHop) error {
+	return a.store.RecordPlacement(ctx, &models.ExecutionPlacement{
+		ID:          uuid.New(),
+		ExecutionID: executionID,
+		NodeID:      a.id,
+		Hop:         hop,
+		PlacedAt:    a.now().UTC(),
+	})
+}
+
+// Register registers the node with its engine's capacity and executors
+func (a *Agent) Register(ctx context.Context) error {
+	if a.startedAt.IsZero() {
+		a.startedAt = a.now().UTC()
+	}
+
+	hostname, _ := os.Hostname()
+	node, err := a.store.Register(ctx, &Node{
+		ID:                a.id,
+		Hostname:          hostname,
+		Version:           a.version,
+		Capacity:          a.workload.Capacity(),
+		Executors:         a.workload.StepTypes(),
+		StartedAt:         a.startedAt,
+		LastHeartbeat:     a.now(),
+		RunningExecutions: a.workload.RunningExecutions(),
+		QueueDepth:        a.currentQueueDepth(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register node %s: %w", a.id, err)
+	}
+
+	a.setStatus(node.Status)
+	a.logger.WithFields(logrus.Fields{
+		"node_id": a.id,
+		"status":  node.Status,
+	}).Info("Node registered")
+	return nil
+}
+
+// Heartbeat reports the live stats of the node and picks up its status
+func (a *Agent) Heartbeat(ctx context.Context) error {
+	node, err := a.store.Heartbeat(ctx, a.id, Stats{
+		RunningExecutions: a.workload.RunningExecutions(),
+		QueueDepth:        a.currentQueueDepth(),
+	}, a.now())
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat of node %s: %w", a.id, err)
+	}
+
+	if node.Status == StatusDead && a.Status() != StatusDead {
+		// The executions of the node were reclaimed by other nodes. It
+		// takes no new work until it restarts and registers again.
+		a.logger.WithField("node_id", a.id).Error("Node was marked dead after missing heartbeats")
+	}
+	a.setStatus(node.Status)
+	return nil
+}
+
+func (a *Agent) setStatus(status Status) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status = status
+}
+
+func (a *Agent) currentQueueDepth() int {
+	if a.queueDepth == nil {
+		return 0
+	}
+	return a.queueDepth()
+}
+
+// Start registers the node and sends heartbeats at the given interval until
+// Stop is called
+func (a *Agent) Start(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	if err := a.Register(ctx); err != nil {
+		return err
+	}
+
+	a.stopCh = make(chan struct{})
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := a.Heartbeat(ctx); err != nil {
+					a.logger.WithError(err).Warn("Node heartbeat failed")
+				}
+			case <-a.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops sending heartbeats
+func (a *Agent) Stop() {
+	if a.stopCh == nil {
+		return
+	}
+	close(a.stopCh)
+	a.wg.Wait()
+	a.stopCh = nil
+}
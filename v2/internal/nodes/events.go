@@ -0,0 +1,29 @@
+package nodes
+
+import (
+	"context"
+
+	"magic-flow/v2/internal/engine"
+)
+
+// EventHandler finishes the placement of executions when they end, whether
+// they completed, failed or were cancelled, or when they park to resume on
+// another node
+type EventHandler struct {
+	manager *Manager
+}
+
+// NewEventHandler creates an engine event handler for the node manager
+func NewEventHandler(manager *Manager) *EventHandler {
+	return &EventHandler{manager: manager}
+}
+
+// Handle finishes the placements of the execution of a terminal event
+func (h *EventHandler) Handle(event *engine.WorkflowEvent) error {
+	return h.manager.FinishExecution(context.Background(), event.ExecutionID)
+}
+
+// GetEventTypes returns the event types handled
+func (h *EventHandler) GetEventTypes() []string {
+	return []string{"execution.completed", "execution.failed", "execution.cancelled", "execution.parked"}
+}
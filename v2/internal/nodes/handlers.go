@@ -0,0 +1,148 @@
+package nodes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers provides HTTP handlers for worker nodes
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new node handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers node routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		nodes := v1.Group("/nodes")
+		{
+			nodes.GET("", h.ListNodes)
+			nodes.GET("/queue", h.GetQueue)
+			nodes.GET("/:id", h.GetNode)
+			nodes.POST("/:id/cordon", h.CordonNode)
+			nodes.POST("/:id/uncordon", h.UncordonNode)
+		}
+	}
+}
+
+// CordonRequest is the request body of a cordon
+type CordonRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ListNodes returns the worker nodes with their live stats
+// @Summary List worker nodes
+// @Tags nodes
+// @Produce json
+// @Success 200 {array} Node
+// @Router /api/v1/nodes [get]
+func (h *Handlers) ListNodes(c *gin.Context) {
+	nodes, err := h.manager.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, nodes)
+}
+
+// GetQueue returns the execution capacity of the cluster and the capacity
+// reservations holding slots of it
+// @Summary Get execution queue status
+// @Description Sums the capacity, running executions and queue depth of the live nodes and lists the active capacity reservations with their utilization
+// @Tags nodes
+// @Produce json
+// @Success 200 {object} QueueStatus
+// @Router /api/v1/nodes/queue [get]
+func (h *Handlers) GetQueue(c *gin.Context) {
+	status, err := h.manager.Queue(c.Request.Context())
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetNode returns a worker node
+// @Summary Get worker node
+// @Tags nodes
+// @Produce json
+// @Param id path string true "Node ID"
+// @Success 200 {object} Node
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/nodes/{id} [get]
+func (h *Handlers) GetNode(c *gin.Context) {
+	node, err := h.manager.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, node)
+}
+
+// CordonNode stops assigning new executions to a node
+// @Summary Cordon worker node
+// @Tags nodes
+// @Accept json
+// @Produce json
+// @Param id path string true "Node ID"
+// @Param request body CordonRequest true "Cordon request"
+// @Success 200 {object} Node
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/nodes/{id}/cordon [post]
+func (h *Handlers) CordonNode(c *gin.Context) {
+	var req CordonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	node, err := h.manager.Cordon(c.Request.Context(), c.Param("id"), c.GetHeader("X-User-ID"), req.Reason)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, node)
+}
+
+// UncordonNode lets a cordoned node accept new executions again
+// @Summary Uncordon worker node
+// @Tags nodes
+// @Produce json
+// @Param id path string true "Node ID"
+// @Success 200 {object} Node
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/nodes/{id}/uncordon [post]
+func (h *Handlers) UncordonNode(c *gin.Context) {
+	node, err := h.manager.Uncordon(c.Request.Context(), c.Param("id"), c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, node)
+}
+
+func (h *Handlers) errorResponse(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrNodeDead):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
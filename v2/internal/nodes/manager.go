@@ -0,0 +1,248 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/reservations"
+	"magic-flow/v2/pkg/models"
+)
+
+const defaultHeartbeatTimeout = time.Minute
+
+// Reclaimer takes over the executions of dead nodes. Each placement is the
+// last one of a running execution on the dead node.
+type Reclaimer interface {
+	Reclaim(ctx context.Context, placement *models.ExecutionPlacement) error
+}
+
+// ReclaimerFunc adapts a function to a Reclaimer
+type ReclaimerFunc func(ctx context.Context, placement *models.ExecutionPlacement) error
+
+// Reclaim calls the function
+func (f ReclaimerFunc) Reclaim(ctx context.Context, placement *models.ExecutionPlacement) error {
+	return f(ctx, placement)
+}
+
+// ReservationReporter reports the active capacity reservations with their
+// utilization. The reservations Manager implements it.
+type ReservationReporter interface {
+	Active(ctx context.Context) ([]*reservations.Status, error)
+}
+
+// QueueStatus is the execution capacity of the live nodes of a cluster, with
+// the capacity reservations holding slots of it
+type QueueStatus struct {
+	// Nodes is the number of nodes accepting new executions, whose
+	// capacity is summed
+	Nodes             int `json:"nodes"`
+	Capacity          int `json:"capacity"`
+	RunningExecutions int `json:"running_executions"`
+	QueueDepth        int `json:"queue_depth"`
+	// ReservedSlots is the number of slots the active reservations hold,
+	// FreeReservedSlots those of them kept free for their executions
+	ReservedSlots     int                    `json:"reserved_slots"`
+	FreeReservedSlots int                    `json:"free_reserved_slots"`
+	Reservations      []*reservations.Status `json:"reservations"`
+}
+
+// Manager administers the nodes of a cluster and detects dead nodes
+type Manager struct {
+	store            Store
+	reclaimer        Reclaimer
+	reservations     ReservationReporter
+	logger           *logrus.Logger
+	now              func() time.Time
+	heartbeatTimeout time.Duration
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager creates a node manager. Nodes without a heartbeat for
+// heartbeatTimeout are marked dead and their executions handed to reclaimer.
+func NewManager(store Store, heartbeatTimeout time.Duration, reclaimer Reclaimer, logger *logrus.Logger) *Manager {
+	if heartbeatTimeout <= 0 {
+		heartbeatTimeout = defaultHeartbeatTimeout
+	}
+	return &Manager{
+		store:            store,
+		reclaimer:        reclaimer,
+		logger:           logger,
+		now:              time.Now,
+		heartbeatTimeout: heartbeatTimeout,
+	}
+}
+
+// List returns the registered nodes with their live stats
+func (m *Manager) List(ctx context.Context) ([]*Node, error) {
+	return m.store.List(ctx)
+}
+
+// SetReservations sets the reporter of the capacity reservations listed
+// with the queue status. No reservations are listed until set.
+func (m *Manager) SetReservations(reporter ReservationReporter) {
+	m.reservations = reporter
+}
+
+// Queue returns the execution capacity of the live nodes and the active
+// capacity reservations holding slots of it. Cordoned nodes count towards
+// the running and queued executions but not the capacity.
+func (m *Manager) Queue(ctx context.Context) (*QueueStatus, error) {
+	nodes, err := m.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &QueueStatus{Reservations: []*reservations.Status{}}
+	for _, node := range nodes {
+		if node.Status == StatusDead {
+			continue
+		}
+		if node.Status == StatusActive {
+			status.Nodes++
+			status.Capacity += node.Capacity
+		}
+		status.RunningExecutions += node.RunningExecutions
+		status.QueueDepth += node.QueueDepth
+	}
+
+	if m.reservations != nil {
+		if status.Reservations, err = m.reservations.Active(ctx); err != nil {
+			return nil, err
+		}
+		for _, reservation := range status.Reservations {
+			status.ReservedSlots += reservation.ReservedSlots
+			status.FreeReservedSlots += reservation.FreeSlots
+		}
+	}
+	return status, nil
+}
+
+// Get returns a node
+func (m *Manager) Get(ctx context.Context, id string) (*Node, error) {
+	return m.store.Get(ctx, id)
+}
+
+// Cordon stops assigning new executions to a node. Executions running on it
+// continue, so a node can be drained by cordoning it and waiting for its
+// running executions to reach zero.
+func (m *Manager) Cordon(ctx context.Context, id, actor, reason string) (*Node, error) {
+	node, err := m.store.SetCordoned(ctx, id, true, actor, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"node_id": id,
+		"actor":   actor,
+		"reason":  reason,
+	}).Warn("Node cordoned")
+	return node, nil
+}
+
+// Uncordon lets a cordoned node accept new executions again
+func (m *Manager) Uncordon(ctx context.Context, id, actor string) (*Node, error) {
+	node, err := m.store.SetCordoned(ctx, id, false, actor, "")
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"node_id": id,
+		"actor":   actor,
+	}).Info("Node uncordoned")
+	return node, nil
+}
+
+// FinishExecution records that an execution left the node it ran on
+func (m *Manager) FinishExecution(ctx context.Context, executionID uuid.UUID) error {
+	return m.store.FinishPlacements(ctx, executionID, m.now().UTC())
+}
+
+// DetectDead marks the nodes that missed their heartbeats as dead and hands
+// their running executions to the reclaimer. It returns the nodes marked
+// dead; executions that could not be reclaimed are reported in the error.
+func (m *Manager) DetectDead(ctx context.Context) ([]*Node, error) {
+	dead, err := m.store.MarkDead(ctx, m.now().Add(-m.heartbeatTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark dead nodes: %w", err)
+	}
+
+	var errs []error
+	for _, node := range dead {
+		placements, err := m.store.OpenPlacements(ctx, node.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list executions of node %s: %w", node.ID, err))
+			continue
+		}
+
+		m.logger.WithFields(logrus.Fields{
+			"node_id":        node.ID,
+			"last_heartbeat": node.LastHeartbeat,
+			"executions":     len(placements),
+		}).Error("Node marked dead")
+
+		for _, placement := range placements {
+			if err := m.reclaim(ctx, placement); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return dead, errors.Join(errs...)
+}
+
+// reclaim finishes the placement of an execution on a dead node before
+// handing it over, so the placement the reclaimer records is the open one
+func (m *Manager) reclaim(ctx context.Context, placement *models.ExecutionPlacement) error {
+	if err := m.store.FinishPlacements(ctx, placement.ExecutionID, m.now().UTC()); err != nil {
+		return fmt.Errorf("failed to finish placement of execution %s: %w", placement.ExecutionID, err)
+	}
+	if m.reclaimer == nil {
+		return nil
+	}
+	if err := m.reclaimer.Reclaim(ctx, placement); err != nil {
+		return fmt.Errorf("failed to reclaim execution %s: %w", placement.ExecutionID, err)
+	}
+	return nil
+}
+
+// Start detects dead nodes at the given interval until Stop is called
+func (m *Manager) Start(ctx context.Context, interval time.Duration) {
+	m.stopCh = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.DetectDead(ctx); err != nil {
+					m.logger.WithError(err).Error("Dead node detection failed")
+				}
+			case <-m.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops detecting dead nodes
+func (m *Manager) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.stopCh = nil
+}
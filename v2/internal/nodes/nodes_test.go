@@ -0,0 +1,299 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/internal/reservations"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+type nopMetrics struct{}
+
+func (nopMetrics) RecordExecution(execution *models.Execution)                       {}
+func (nopMetrics) RecordStepExecution(step *models.StepExecution)                    {}
+func (nopMetrics) RecordError(err error, context map[string]interface{})             {}
+func (nopMetrics) RecordMetric(name string, value float64, labels map[string]string) {}
+
+// testCluster is two in-process engines on nodes sharing a store
+type testCluster struct {
+	store   *MemoryStore
+	clock   *scheduler.FakeClock
+	manager *Manager
+	engines map[string]*engine.Engine
+	agents  map[string]*Agent
+}
+
+func newTestCluster(t *testing.T, reclaimer Reclaimer) *testCluster {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cluster := &testCluster{
+		store:   NewMemoryStore(),
+		clock:   scheduler.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+		engines: make(map[string]*engine.Engine),
+		agents:  make(map[string]*Agent),
+	}
+	cluster.manager = NewManager(cluster.store, 30*time.Second, reclaimer, logger)
+	cluster.manager.now = cluster.clock.Now
+
+	for _, id := range []string{"node-a", "node-b"} {
+		workflowEngine := engine.NewEngine(4, nopMetrics{}, logger)
+		workflowEngine.RegisterStepExecutor("delay", engine.NewDelayExecutor(logger))
+
+		agent := NewAgent(cluster.store, id, "2.0.0", workflowEngine, logger)
+		agent.now = cluster.clock.Now
+		require.NoError(t, agent.Register(context.Background()))
+		workflowEngine.SetPlacement(agent)
+
+		cluster.engines[id] = workflowEngine
+		cluster.agents[id] = agent
+	}
+	return cluster
+}
+
+func newTestWorkflow() *models.Workflow {
+	return &models.Workflow{ID: uuid.New(), Name: "orders", Version: "1.0.0"}
+}
+
+func TestPlacement(t *testing.T) {
+	ctx := context.Background()
+	cluster := newTestCluster(t, nil)
+
+	execution, err := cluster.engines["node-a"].ExecuteWorkflow(ctx, newTestWorkflow(), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "node-a", execution.NodeID)
+
+	// The execution is retried on the other node
+	retried, err := cluster.engines["node-b"].ExecuteWorkflow(engine.WithPlacementHop(ctx, models.PlacementHopRetry), newTestWorkflow(), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "node-b", retried.NodeID)
+
+	placements := cluster.store.Placements(execution.ID)
+	require.Len(t, placements, 1)
+	assert.Equal(t, "node-a", placements[0].NodeID)
+	assert.Equal(t, models.PlacementHopStart, placements[0].Hop)
+
+	placements = cluster.store.Placements(retried.ID)
+	require.Len(t, placements, 1)
+	assert.Equal(t, "node-b", placements[0].NodeID)
+	assert.Equal(t, models.PlacementHopRetry, placements[0].Hop)
+
+	t.Run("terminal events finish placements", func(t *testing.T) {
+		handler := NewEventHandler(cluster.manager)
+		require.NoError(t, handler.Handle(&engine.WorkflowEvent{Type: "execution.completed", ExecutionID: execution.ID}))
+
+		placements := cluster.store.Placements(execution.ID)
+		require.Len(t, placements, 1)
+		assert.NotNil(t, placements[0].FinishedAt)
+	})
+
+	t.Run("registration reports the engine", func(t *testing.T) {
+		node, err := cluster.manager.Get(ctx, "node-a")
+		require.NoError(t, err)
+		assert.Equal(t, StatusActive, node.Status)
+		assert.Equal(t, 4, node.Capacity)
+		assert.Equal(t, []string{"delay"}, node.Executors)
+		assert.Equal(t, "2.0.0", node.Version)
+	})
+}
+
+func TestCordon(t *testing.T) {
+	ctx := context.Background()
+	cluster := newTestCluster(t, nil)
+
+	node, err := cluster.manager.Cordon(ctx, "node-a", "ops", "kernel upgrade")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCordoned, node.Status)
+	assert.Equal(t, "ops", node.StatusChangedBy)
+
+	// The engine learns about the cordon with its next heartbeat
+	require.NoError(t, cluster.agents["node-a"].Heartbeat(ctx))
+	_, err = cluster.engines["node-a"].ExecuteWorkflow(ctx, newTestWorkflow(), nil, nil)
+	assert.ErrorIs(t, err, engine.ErrNodeCordoned)
+
+	execution, err := cluster.engines["node-b"].ExecuteWorkflow(ctx, newTestWorkflow(), nil, nil)
+	require.NoError(t, err, "other nodes keep accepting work")
+	assert.Equal(t, "node-b", execution.NodeID)
+
+	t.Run("cordon survives a restart", func(t *testing.T) {
+		require.NoError(t, cluster.agents["node-a"].Register(ctx))
+		assert.False(t, cluster.agents["node-a"].Accepting())
+	})
+
+	t.Run("uncordon", func(t *testing.T) {
+		_, err := cluster.manager.Uncordon(ctx, "node-a", "ops")
+		require.NoError(t, err)
+		require.NoError(t, cluster.agents["node-a"].Heartbeat(ctx))
+
+		_, err = cluster.engines["node-a"].ExecuteWorkflow(ctx, newTestWorkflow(), nil, nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("unknown node", func(t *testing.T) {
+		_, err := cluster.manager.Cordon(ctx, "node-z", "ops", "typo")
+		assert.ErrorIs(t, err, ErrNodeNotFound)
+	})
+}
+
+func TestDeadNodeDetection(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var reclaimed []*models.ExecutionPlacement
+	var cluster *testCluster
+	cluster = newTestCluster(t, ReclaimerFunc(func(ctx context.Context, placement *models.ExecutionPlacement) error {
+		mu.Lock()
+		reclaimed = append(reclaimed, placement)
+		mu.Unlock()
+		// The surviving node takes the execution over
+		return cluster.agents["node-b"].RecordPlacement(ctx, placement.ExecutionID, models.PlacementHopReclaim)
+	}))
+
+	// node-a starts an execution and then stops sending heartbeats
+	execution, err := cluster.engines["node-a"].ExecuteWorkflow(ctx, newTestWorkflow(), nil, nil)
+	require.NoError(t, err)
+
+	cluster.clock.Advance(20 * time.Second)
+	require.NoError(t, cluster.agents["node-b"].Heartbeat(ctx))
+
+	dead, err := cluster.manager.DetectDead(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dead, "nodes within the heartbeat timeout are alive")
+
+	cluster.clock.Advance(20 * time.Second)
+	require.NoError(t, cluster.agents["node-b"].Heartbeat(ctx))
+
+	dead, err = cluster.manager.DetectDead(ctx)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "node-a", dead[0].ID)
+	assert.Equal(t, StatusDead, dead[0].Status)
+
+	require.Len(t, reclaimed, 1)
+	assert.Equal(t, execution.ID, reclaimed[0].ExecutionID)
+	assert.Equal(t, "node-a", reclaimed[0].NodeID)
+
+	placements := cluster.store.Placements(execution.ID)
+	require.Len(t, placements, 2)
+	assert.NotNil(t, placements[0].FinishedAt, "the placement on the dead node is finished")
+	assert.Equal(t, "node-b", placements[1].NodeID)
+	assert.Equal(t, models.PlacementHopReclaim, placements[1].Hop)
+	assert.Nil(t, placements[1].FinishedAt)
+
+	t.Run("dead nodes are reported once", func(t *testing.T) {
+		dead, err := cluster.manager.DetectDead(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, dead)
+		assert.Len(t, reclaimed, 1)
+	})
+
+	t.Run("a late heartbeat does not revive the node", func(t *testing.T) {
+		require.NoError(t, cluster.agents["node-a"].Heartbeat(ctx))
+		assert.Equal(t, StatusDead, cluster.agents["node-a"].Status())
+
+		_, err := cluster.engines["node-a"].ExecuteWorkflow(ctx, newTestWorkflow(), nil, nil)
+		assert.ErrorIs(t, err, engine.ErrNodeCordoned)
+
+		_, err = cluster.manager.Uncordon(ctx, "node-a", "ops")
+		assert.ErrorIs(t, err, ErrNodeDead)
+	})
+
+	t.Run("re-registration revives the node", func(t *testing.T) {
+		require.NoError(t, cluster.agents["node-a"].Register(ctx))
+		assert.True(t, cluster.agents["node-a"].Accepting())
+	})
+}
+
+// fakeReservations reports fixed active reservations
+type fakeReservations []*reservations.Status
+
+func (r fakeReservations) Active(ctx context.Context) ([]*reservations.Status, error) {
+	return r, nil
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	cluster := newTestCluster(t, nil)
+
+	_, err := cluster.engines["node-a"].ExecuteWorkflow(ctx, newTestWorkflow(), map[string]interface{}{}, nil)
+	require.NoError(t, err)
+
+	cluster.manager.SetReservations(fakeReservations{
+		{Reservation: &reservations.Reservation{Name: "spring-campaign", Slots: 4}, Phase: reservations.PhaseHolding, ReservedSlots: 4, SlotsInUse: 1, FreeSlots: 3},
+	})
+
+	router := gin.New()
+	NewHandlers(cluster.manager).RegisterRoutes(router.Group("/api"))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "ops")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("list", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/v1/nodes", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var nodes []Node
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &nodes))
+		require.Len(t, nodes, 2)
+		assert.Equal(t, "node-a", nodes[0].ID)
+		assert.Equal(t, cluster.clock.Now(), nodes[0].LastHeartbeat.UTC())
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/v1/nodes/queue", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var status QueueStatus
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+		assert.Equal(t, 2, status.Nodes)
+		assert.Equal(t, 8, status.Capacity)
+		assert.Equal(t, 4, status.ReservedSlots)
+		assert.Equal(t, 3, status.FreeReservedSlots)
+		require.Len(t, status.Reservations, 1)
+		assert.Equal(t, "spring-campaign", status.Reservations[0].Name)
+	})
+
+	t.Run("cordon", func(t *testing.T) {
+		rec := request(http.MethodPost, "/api/v1/nodes/node-b/cordon", `{}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "a reason is required")
+
+		rec = request(http.MethodPost, "/api/v1/nodes/node-b/cordon", `{"reason":"drain"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var node Node
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &node))
+		assert.Equal(t, StatusCordoned, node.Status)
+		assert.Equal(t, "drain", node.StatusReason)
+
+		rec = request(http.MethodPost, "/api/v1/nodes/node-b/uncordon", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("unknown node", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/v1/nodes/node-z", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
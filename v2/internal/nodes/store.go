@@ -0,0 +1,433 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"magic-flow/v2/pkg/models"
+)
+
+var (
+	// ErrNodeNotFound is returned when a node is not registered
+	ErrNodeNotFound = errors.New("node not found")
+	// ErrNodeDead is returned when cordoning a node marked dead
+	ErrNodeDead = errors.New("node is dead")
+)
+
+// Status is the scheduling status of a worker node
+type Status string
+
+const (
+	// StatusActive nodes accept new executions
+	StatusActive Status = "active"
+	// StatusCordoned nodes finish their executions but accept no new ones
+	StatusCordoned Status = "cordoned"
+	// StatusDead nodes missed their heartbeats and had their executions
+	// reclaimed
+	StatusDead Status = "dead"
+)
+
+// Node is a worker node running an engine. Live stats are reported with
+// each heartbeat.
+type Node struct {
+	ID                string    `json:"id" gorm:"primaryKey"`
+	Hostname          string    `json:"hostname"`
+	Version           string    `json:"version"`
+	Capacity          int       `json:"capacity"`
+	Executors         []string  `json:"executors" gorm:"type:jsonb;serializer:json"`
+	Status            Status    `json:"status" gorm:"not null;index"`
+	StatusReason      string    `json:"status_reason,omitempty"`
+	StatusChangedBy   string    `json:"status_changed_by,omitempty"`
+	StartedAt         time.Time `json:"started_at"`
+	LastHeartbeat     time.Time `json:"last_heartbeat" gorm:"index"`
+	RunningExecutions int       `json:"running_executions"`
+	QueueDepth        int       `json:"queue_depth"`
+}
+
+// TableName returns the table name for the Node model
+func (Node) TableName() string {
+	return "worker_nodes"
+}
+
+// Stats are the live stats a node reports with its heartbeat
+type Stats struct {
+	RunningExecutions int `json:"running_executions"`
+	QueueDepth        int `json:"queue_depth"`
+}
+
+// Store persists nodes and the placements of executions on them. MarkDead
+// must be atomic so that each dead node is reported, and its executions
+// reclaimed, only once.
+type Store interface {
+	Register(ctx context.Context, node *Node) (*Node, error)
+	Heartbeat(ctx context.Context, id string, stats Stats, now time.Time) (*Node, error)
+	SetCordoned(ctx context.Context, id string, cordoned bool, actor, reason string) (*Node, error)
+	Get(ctx context.Context, id string) (*Node, error)
+	List(ctx context.Context) ([]*Node, error)
+	MarkDead(ctx context.Context, before time.Time) ([]*Node, error)
+	RecordPlacement(ctx context.Context, placement *models.ExecutionPlacement) error
+	FinishPlacements(ctx context.Context, executionID uuid.UUID, now time.Time) error
+	OpenPlacements(ctx context.Context, nodeID string) ([]*models.ExecutionPlacement, error)
+}
+
+// register applies a registration to the current state of a node, which is
+// nil when the node never registered. A restarted node stays cordoned so
+// that it can be drained across restarts; a dead node comes back active.
+func register(current, node *Node) *Node {
+	registered := *node
+	registered.Status = StatusActive
+	if current != nil && current.Status == StatusCordoned {
+		registered.Status = StatusCordoned
+		registered.StatusReason = current.StatusReason
+		registered.StatusChangedBy = current.StatusChangedBy
+	}
+	return &registered
+}
+
+// setCordoned applies a cordon or uncordon to a node
+func setCordoned(node *Node, cordoned bool, actor, reason string) (*Node, error) {
+	if node.Status == StatusDead {
+		return nil, ErrNodeDead
+	}
+
+	updated := *node
+	updated.Status = StatusActive
+	if cordoned {
+		updated.Status = StatusCordoned
+	}
+	updated.StatusReason = reason
+	updated.StatusChangedBy = actor
+	return &updated, nil
+}
+
+// MemoryStore is a Store kept in memory. Nodes of different processes do
+// not see each other, so it is only suitable for tests and development.
+type MemoryStore struct {
+	mu         sync.Mutex
+	nodes      map[string]*Node
+	placements []*models.ExecutionPlacement
+}
+
+// NewMemoryStore creates an in-memory node store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nodes: make(map[string]*Node)}
+}
+
+// Register registers a node or updates the registration of a restarted node
+func (s *MemoryStore) Register(ctx context.Context, node *Node) (*Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registered := register(s.nodes[node.ID], node)
+	s.nodes[node.ID] = registered
+
+	result := *registered
+	return &result, nil
+}
+
+// Heartbeat records the live stats of a node. Dead nodes are not revived.
+func (s *MemoryStore) Heartbeat(ctx context.Context, id string, stats Stats, now time.Time) (*Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, exists := s.nodes[id]
+	if !exists {
+		return nil, ErrNodeNotFound
+	}
+	if node.Status != StatusDead {
+		node.LastHeartbeat = now
+		node.RunningExecutions = stats.RunningExecutions
+		node.QueueDepth = stats.QueueDepth
+	}
+
+	result := *node
+	return &result, nil
+}
+
+// SetCordoned cordons or uncordons a node
+func (s *MemoryStore) SetCordoned(ctx context.Context, id string, cordoned bool, actor, reason string) (*Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, exists := s.nodes[id]
+	if !exists {
+		return nil, ErrNodeNotFound
+	}
+	updated, err := setCordoned(node, cordoned, actor, reason)
+	if err != nil {
+		return nil, err
+	}
+	s.nodes[id] = updated
+
+	result := *updated
+	return &result, nil
+}
+
+// Get returns a node
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, exists := s.nodes[id]
+	if !exists {
+		return nil, ErrNodeNotFound
+	}
+
+	result := *node
+	return &result, nil
+}
+
+// List returns all registered nodes
+func (s *MemoryStore) List(ctx context.Context) ([]*Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes := make([]*Node, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		result := *node
+		nodes = append(nodes, &result)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes, nil
+}
+
+// MarkDead marks the nodes whose last heartbeat is before the given time as
+// dead and returns them
+func (s *MemoryStore) MarkDead(ctx context.Context, before time.Time) ([]*Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var dead []*Node
+	for _, node := range s.nodes {
+		if node.Status != StatusDead && node.LastHeartbeat.Before(before) {
+			node.Status = StatusDead
+			node.StatusReason = "missed heartbeats"
+			node.StatusChangedBy = ""
+			result := *node
+			dead = append(dead, &result)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool {
+		return dead[i].ID < dead[j].ID
+	})
+	return dead, nil
+}
+
+// RecordPlacement stores a placement
+func (s *MemoryStore) RecordPlacement(ctx context.Context, placement *models.ExecutionPlacement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *placement
+	s.placements = append(s.placements, &stored)
+	return nil
+}
+
+// FinishPlacements finishes the open placements of an execution
+func (s *MemoryStore) FinishPlacements(ctx context.Context, executionID uuid.UUID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, placement := range s.placements {
+		if placement.ExecutionID == executionID && placement.FinishedAt == nil {
+			finishedAt := now
+			placement.FinishedAt = &finishedAt
+		}
+	}
+	return nil
+}
+
+// OpenPlacements returns the unfinished placements on a node
+func (s *MemoryStore) OpenPlacements(ctx context.Context, nodeID string) ([]*models.ExecutionPlacement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var open []*models.ExecutionPlacement
+	for _, placement := range s.placements {
+		if placement.NodeID == nodeID && placement.FinishedAt == nil {
+			result := *placement
+			open = append(open, &result)
+		}
+	}
+	return open, nil
+}
+
+// Placements returns the recorded placements of an execution in order
+func (s *MemoryStore) Placements(executionID uuid.UUID) []*models.ExecutionPlacement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var placements []*models.ExecutionPlacement
+	for _, placement := range s.placements {
+		if placement.ExecutionID == executionID {
+			result := *placement
+			placements = append(placements, &result)
+		}
+	}
+	return placements
+}
+
+// GormStore keeps nodes in the worker_nodes table and placements in the
+// execution_placements table, shared by the nodes of a cluster. Node rows
+// are locked while they are updated, so registrations and dead node
+// detection on several servers do not overlap.
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database node store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the node and placement tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Node{}, &models.ExecutionPlacement{})
+}
+
+// Register registers a node or updates the registration of a restarted node
+func (s *GormStore) Register(ctx context.Context, node *Node) (*Node, error) {
+	var registered *Node
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current *Node
+		var row Node
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", node.ID).First(&row).Error
+		switch {
+		case err == nil:
+			current = &row
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		registered = register(current, node)
+		return tx.Save(registered).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return registered, nil
+}
+
+// Heartbeat records the live stats of a node. Dead nodes are not revived.
+func (s *GormStore) Heartbeat(ctx context.Context, id string, stats Stats, now time.Time) (*Node, error) {
+	err := s.db.WithContext(ctx).Model(&Node{}).
+		Where("id = ? AND status <> ?", id, StatusDead).
+		Updates(map[string]interface{}{
+			"last_heartbeat":     now,
+			"running_executions": stats.RunningExecutions,
+			"queue_depth":        stats.QueueDepth,
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+// SetCordoned cordons or uncordons a node
+func (s *GormStore) SetCordoned(ctx context.Context, id string, cordoned bool, actor, reason string) (*Node, error) {
+	var updated *Node
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var node Node
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&node).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNodeNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		updated, err = setCordoned(&node, cordoned, actor, reason)
+		if err != nil {
+			return err
+		}
+		return tx.Save(updated).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Get returns a node
+func (s *GormStore) Get(ctx context.Context, id string) (*Node, error) {
+	var node Node
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&node).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// List returns all registered nodes
+func (s *GormStore) List(ctx context.Context) ([]*Node, error) {
+	var nodes []*Node
+	err := s.db.WithContext(ctx).Order("id").Find(&nodes).Error
+	return nodes, err
+}
+
+// MarkDead marks the nodes whose last heartbeat is before the given time as
+// dead and returns them. Rows are locked so that servers detecting dead
+// nodes concurrently each report a node at most once.
+func (s *GormStore) MarkDead(ctx context.Context, before time.Time) ([]*Node, error) {
+	var dead []*Node
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status <> ? AND last_heartbeat < ?", StatusDead, before).
+			Order("id").
+			Find(&dead).Error
+		if err != nil || len(dead) == 0 {
+			return err
+		}
+
+		ids := make([]string, len(dead))
+		for i, node := range dead {
+			node.Status = StatusDead
+			node.StatusReason = "missed heartbeats"
+			node.StatusChangedBy = ""
+			ids[i] = node.ID
+		}
+		return tx.Model(&Node{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":            StatusDead,
+			"status_reason":     "missed heartbeats",
+			"status_changed_by": "",
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dead, nil
+}
+
+// RecordPlacement stores a placement
+func (s *GormStore) RecordPlacement(ctx context.Context, placement *models.ExecutionPlacement) error {
+	return s.db.WithContext(ctx).Create(placement).Error
+}
+
+// FinishPlacements finishes the open placements of an execution
+func (s *GormStore) FinishPlacements(ctx context.Context, executionID uuid.UUID, now time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.ExecutionPlacement{}).
+		Where("execution_id = ? AND finished_at IS NULL", executionID).
+		Update("finished_at", now).Error
+}
+
+// OpenPlacements returns the unfinished placements on a node
+func (s *GormStore) OpenPlacements(ctx context.Context, nodeID string) ([]*models.ExecutionPlacement, error) {
+	var placements []*models.ExecutionPlacement
+	err := s.db.WithContext(ctx).
+		Where("node_id = ? AND finished_at IS NULL", nodeID).
+		Order("placed_at").
+		Find(&placements).Error
+	return placements, err
+}
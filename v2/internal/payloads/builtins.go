@@ -0,0 +1,124 @@
+package payloads
+
+import "sort"
+
+// builtins are the templates selectable by name
+var builtins = map[string]string{
+	// slack-basic posts a message to a Slack incoming webhook
+	"slack-basic": `{{- $workflow := default .Execution.WorkflowID .Execution.WorkflowName -}}
+{
+  "text": {{ json (msg "notification.title" "workflow" $workflow "event" .Event.Type) }},
+  "blocks": [
+    {
+      "type": "section",
+      "text": {
+        "type": "mrkdwn",
+        "text": {{ json (printf "*%s* %s\n%s" $workflow .Event.Type (msg "notification.execution_status" "execution" (printf "` + "`%s`" + `" .Execution.ID) "status" (printf "*%s*" .Execution.Status))) }}
+      }
+    },
+    {{- if .Event.StepID }}
+    {
+      "type": "section",
+      "text": {"type": "mrkdwn", "text": {{ json (msg "notification.step" "step" (printf "` + "`%s`" + `" .Event.StepID)) }}}
+    },
+    {{- end }}
+    {{- if .Event.Error }}
+    {
+      "type": "section",
+      "text": {"type": "mrkdwn", "text": {{ json (printf "` + "```%s```" + `" (truncate 2900 .Event.Error)) }}}
+    },
+    {{- end }}
+    {
+      "type": "context",
+      "elements": [
+        {"type": "mrkdwn", "text": {{ json (formatTime "2006-01-02 15:04:05 MST" .Event.Timestamp) }}}
+      ]
+    }
+  ]
+}`,
+
+	// pagerduty-v2 sends an Events API v2 event, triggering an incident for
+	// failures and resolving it when the execution completes. The routing
+	// key is the routing_key param.
+	"pagerduty-v2": `{{- $workflow := default .Execution.WorkflowID .Execution.WorkflowName -}}
+{{- $summary := msg "notification.summary" "workflow" $workflow "execution" .Execution.ID "status" .Execution.Status -}}
+{{- if .Event.Error }}{{ $summary = printf "%s: %s" $summary .Event.Error }}{{ end -}}
+{
+  "routing_key": {{ json (required "routing_key param" .Params.routing_key) }},
+  "event_action": {{ if eq .Execution.Status "completed" }}"resolve"{{ else }}"trigger"{{ end }},
+  "dedup_key": {{ json .Execution.ID }},
+  "payload": {
+    "summary": {{ json (truncate 1024 $summary) }},
+    "source": {{ json (default "magic-flow" .Params.source) }},
+    "severity": {{ if eq .Execution.Status "failed" }}{{ json (default "error" .Params.severity) }}{{ else }}"info"{{ end }},
+    "timestamp": {{ json (formatTime "2006-01-02T15:04:05.000Z07:00" .Event.Timestamp) }},
+    "component": {{ json $workflow }},
+    "custom_details": {
+      "event_type": {{ json .Event.Type }},
+      "execution_id": {{ json .Execution.ID }},
+      "workflow_id": {{ json .Execution.WorkflowID }},
+      "step_id": {{ json .Event.StepID }},
+      "correlation_id": {{ json .Event.CorrelationID }},
+      "error": {{ json .Event.Error }}
+    }
+  }
+}`,
+
+	// teams-card posts an adaptive card to a Microsoft Teams workflow or
+	// incoming webhook
+	"teams-card": `{{- $workflow := default .Execution.WorkflowID .Execution.WorkflowName -}}
+{
+  "type": "message",
+  "attachments": [
+    {
+      "contentType": "application/vnd.microsoft.card.adaptive",
+      "content": {
+        "$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+        "type": "AdaptiveCard",
+        "version": "1.4",
+        "body": [
+          {
+            "type": "TextBlock",
+            "size": "Medium",
+            "weight": "Bolder",
+            "wrap": true,
+            "text": {{ json (msg "notification.title" "workflow" $workflow "event" .Event.Type) }}
+          },
+          {
+            "type": "FactSet",
+            "facts": [
+              {"title": {{ json (msg "notification.fact.execution") }}, "value": {{ json .Execution.ID }}},
+              {"title": {{ json (msg "notification.fact.status") }}, "value": {{ json .Execution.Status }}},
+              {{- if .Event.StepID }}
+              {"title": {{ json (msg "notification.fact.step") }}, "value": {{ json .Event.StepID }}},
+              {{- end }}
+              {{- if .Execution.DurationMs }}
+              {"title": {{ json (msg "notification.fact.duration") }}, "value": {{ json (formatDuration .Execution.DurationMs) }}},
+              {{- end }}
+              {"title": {{ json (msg "notification.fact.time") }}, "value": {{ json (formatTime "2006-01-02 15:04:05 MST" .Event.Timestamp) }}}
+            ]
+          }
+          {{- if .Event.Error }},
+          {
+            "type": "TextBlock",
+            "wrap": true,
+            "color": "Attention",
+            "text": {{ json (truncate 2000 .Event.Error) }}
+          }
+          {{- end }}
+        ]
+      }
+    }
+  ]
+}`,
+}
+
+// Builtins returns the names of the built-in templates
+func Builtins() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,206 @@
+package payloads
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"magic-flow/v2/internal/branding"
+	"magic-flow/v2/internal/expressions"
+)
+
+// funcs is the function set of payload templates. It only formats the data
+// a template is rendered against: there is no access to files, the
+// environment or the network.
+var funcs = template.FuncMap{
+	"json":           toJSON,
+	"get":            get,
+	"default":        defaultValue,
+	"required":       required,
+	"truncate":       truncate,
+	"upper":          strings.ToUpper,
+	"lower":          strings.ToLower,
+	"replace":        replace,
+	"join":           join,
+	"formatTime":     formatTime,
+	"formatDuration": formatDuration,
+	// msg returns a localized string of the message catalog with its
+	// placeholders filled from name, value pairs, such as
+	// {{ msg "notification.step" "step" .Event.StepID }}. It is bound to
+	// the messages of the render data.
+	"msg": (*branding.Messages)(nil).Format,
+}
+
+// expressionFuncs are the functions templates share with expressions. They
+// take their arguments in the order of expressions, such as
+// {{ format (addBusinessDays now 3 "holidays") "date" }}, and now is the
+// timestamp of the event.
+var expressionFuncs = []string{
+	"now", "addDuration", "addBusinessDays", "startOf", "inZone", "format", "parseTime",
+	"round", "floor", "min", "max", "trim", "concat", "uuid",
+}
+
+func init() {
+	for name, fn := range expressionFuncMap(nil) {
+		funcs[name] = fn
+	}
+}
+
+// expressionFuncMap returns the expression functions bound to an
+// environment
+func expressionFuncMap(env *expressions.Env) template.FuncMap {
+	funcMap := make(template.FuncMap, len(expressionFuncs))
+	for _, name := range expressionFuncs {
+		name := name
+		funcMap[name] = func(args ...interface{}) (interface{}, error) {
+			return expressions.Call(env, name, args...)
+		}
+	}
+	return funcMap
+}
+
+// toJSON encodes a value as JSON, for embedding values in JSON payloads
+func toJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// get returns the value at a dot separated path in maps and slices, such as
+// "output.items.0.sku", or nil if the path does not exist
+func get(value interface{}, path string) interface{} {
+	if path == "" {
+		return value
+	}
+	for _, segment := range strings.Split(path, ".") {
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil
+			}
+			element := v.MapIndex(reflect.ValueOf(segment).Convert(v.Type().Key()))
+			if !element.IsValid() {
+				return nil
+			}
+			value = element.Interface()
+		case reflect.Slice, reflect.Array:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= v.Len() {
+				return nil
+			}
+			value = v.Index(index).Interface()
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// defaultValue returns value, or fallback if value is empty
+func defaultValue(fallback, value interface{}) interface{} {
+	if isEmpty(value) {
+		return fallback
+	}
+	return value
+}
+
+// required returns value, failing the render if it is empty
+func required(name string, value interface{}) (interface{}, error) {
+	if isEmpty(value) {
+		return nil, fmt.Errorf("%s is required", name)
+	}
+	return value, nil
+}
+
+// truncate shortens s to at most n characters, ending it with an ellipsis
+// when it was cut
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string(runes[:n])
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+func replace(old, new, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+func join(sep string, values interface{}) string {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(values)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
+
+// formatTime formats a time, or an RFC 3339 string, with a Go layout
+func formatTime(layout string, value interface{}) (string, error) {
+	switch t := value.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case *time.Time:
+		if t == nil {
+			return "", nil
+		}
+		return t.Format(layout), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return "", err
+		}
+		return parsed.Format(layout), nil
+	default:
+		return "", fmt.Errorf("cannot format %T as a time", value)
+	}
+}
+
+// formatDuration formats a number of milliseconds as a duration such as
+// "1.5s"
+func formatDuration(ms interface{}) string {
+	v := reflect.ValueOf(ms)
+	switch {
+	case isInteger(v):
+		return (time.Duration(v.Int()) * time.Millisecond).String()
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return time.Duration(v.Float() * float64(time.Millisecond)).String()
+	default:
+		return ""
+	}
+}
+
+func isInteger(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,295 @@
+// Package payloads renders the bodies of webhook and notification
+// deliveries from payload templates
+package payloads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"magic-flow/v2/internal/branding"
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+const (
+	// RenderTimeout bounds the time a template may take to render
+	RenderTimeout = 250 * time.Millisecond
+	// MaxTemplateSize is the largest template body accepted
+	MaxTemplateSize = 64 * 1024
+	// MaxPayloadSize is the largest payload a template may render
+	MaxPayloadSize = 1024 * 1024
+)
+
+// ErrInvalidTemplate is returned when a payload template cannot be compiled
+// or does not render a JSON payload for the sample event
+var ErrInvalidTemplate = errors.New("invalid payload template")
+
+// Event is the event a payload is rendered for
+type Event struct {
+	Type          string                 `json:"type"`
+	ExecutionID   string                 `json:"execution_id"`
+	WorkflowID    string                 `json:"workflow_id"`
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+	StepID        string                 `json:"step_id,omitempty"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+// ExecutionSummary summarizes the execution an event belongs to
+type ExecutionSummary struct {
+	ID           string `json:"id"`
+	WorkflowID   string `json:"workflow_id"`
+	WorkflowName string `json:"workflow_name,omitempty"`
+	// Status is the execution status the event reports: running, completed,
+	// failed or cancelled
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Data is what templates are rendered against: .Event, .Execution and the
+// .Params of the template
+type Data struct {
+	Event     Event
+	Execution ExecutionSummary
+	Params    map[string]string
+	// Calendars resolves the calendars named in addBusinessDays. Without
+	// it, templates naming a calendar fail to render.
+	Calendars expressions.Calendars
+	// Messages resolves the strings of msg in the branding and locale of
+	// the workflow's namespace. Nil resolves the English defaults.
+	Messages *branding.Messages
+}
+
+// NewData builds the render data of an event, summarizing its execution
+// from the event type and data
+func NewData(event Event, params map[string]string) *Data {
+	summary := ExecutionSummary{
+		ID:         event.ExecutionID,
+		WorkflowID: event.WorkflowID,
+		Status:     "running",
+		Error:      event.Error,
+	}
+	switch event.Type {
+	case "execution.completed":
+		summary.Status = "completed"
+	case "execution.failed", "execution.timeout":
+		summary.Status = "failed"
+	case "execution.cancelled":
+		summary.Status = "cancelled"
+	}
+	if name, ok := event.Data["workflow_name"].(string); ok {
+		summary.WorkflowName = name
+	}
+	switch duration := event.Data["duration_ms"].(type) {
+	case float64:
+		summary.DurationMs = int64(duration)
+	case int64:
+		summary.DurationMs = duration
+	case int:
+		summary.DurationMs = int64(duration)
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	return &Data{Event: event, Execution: summary, Params: params}
+}
+
+// SampleData returns the render data templates are validated against
+func SampleData(params map[string]string) *Data {
+	data := NewData(Event{
+		Type:          "execution.failed",
+		ExecutionID:   "00000000-0000-0000-0000-000000000001",
+		WorkflowID:    "00000000-0000-0000-0000-000000000002",
+		CorrelationID: "sample-correlation",
+		StepID:        "charge",
+		Timestamp:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Data: map[string]interface{}{
+			"workflow_name": "sample",
+			"duration_ms":   1500.0,
+			"output":        map[string]interface{}{"order_id": "ord-1"},
+			"triage": &models.Triage{
+				Class:        "downstream_5xx",
+				Confidence:   0.8,
+				Rule:         "downstream-server-error",
+				ClassifiedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		Error: "sample error",
+	}, params)
+	data.Calendars = sampleCalendars{}
+	return data
+}
+
+// sampleCalendars resolves every calendar name to an empty calendar, so
+// templates naming calendars validate
+type sampleCalendars struct{}
+
+func (sampleCalendars) GetCalendar(name string) (*scheduler.Calendar, error) {
+	return &scheduler.Calendar{Name: name}, nil
+}
+
+// Template is a compiled payload template
+type Template struct {
+	name   string
+	tmpl   *template.Template
+	params map[string]string
+}
+
+// Compile compiles a payload template, either a built-in one selected by
+// name or a body. It returns nil for a nil spec.
+func Compile(spec *models.PayloadTemplate) (*Template, error) {
+	if spec == nil {
+		return nil, nil
+	}
+
+	name, body := spec.Name, spec.Body
+	switch {
+	case name != "" && body != "":
+		return nil, fmt.Errorf("%w: name and body are mutually exclusive", ErrInvalidTemplate)
+	case name != "":
+		builtin, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown built-in template %q, expected one of %s", ErrInvalidTemplate, name, strings.Join(Builtins(), ", "))
+		}
+		body = builtin
+	case body == "":
+		return nil, fmt.Errorf("%w: name or body is required", ErrInvalidTemplate)
+	default:
+		name = "custom"
+	}
+	if len(body) > MaxTemplateSize {
+		return nil, fmt.Errorf("%w: body exceeds %d bytes", ErrInvalidTemplate, MaxTemplateSize)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=zero").Funcs(funcs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return &Template{name: name, tmpl: tmpl, params: spec.Params}, nil
+}
+
+// Validate compiles a payload template and renders it against the sample
+// event
+func Validate(spec *models.PayloadTemplate) error {
+	t, err := Compile(spec)
+	if err != nil || t == nil {
+		return err
+	}
+	if _, err := t.Render(context.Background(), SampleData(spec.Params)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return nil
+}
+
+// ValidateConfig validates the payload templates of the webhooks and
+// notifications of a workflow config
+func ValidateConfig(config *models.WorkflowConfig) error {
+	if config == nil {
+		return nil
+	}
+	for i, webhook := range config.Webhooks {
+		if err := Validate(webhook.Template); err != nil {
+			return fmt.Errorf("webhooks[%d].template: %w", i, err)
+		}
+	}
+	for i, notification := range config.Notifications {
+		if err := Validate(notification.Template); err != nil {
+			return fmt.Errorf("notifications[%d].template: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the template, "custom" for a template body
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Params returns the params of the template
+func (t *Template) Params() map[string]string {
+	return t.params
+}
+
+// Render renders the template against data. Rendering is stopped after
+// RenderTimeout or when ctx is done, and fails if the payload exceeds
+// MaxPayloadSize or is not JSON.
+func (t *Template) Render(ctx context.Context, data *Data) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, RenderTimeout)
+	defer cancel()
+
+	// The expression functions read the event timestamp as now, so
+	// redeliveries render the same payload
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Funcs(expressionFuncMap(&expressions.Env{Now: data.Event.Timestamp, Calendars: data.Calendars}))
+	tmpl.Funcs(template.FuncMap{"msg": data.Messages.Format})
+
+	out := &limitedBuffer{ctx: ctx, limit: MaxPayloadSize}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("template panicked: %v", r)
+			}
+		}()
+		done <- tmpl.Execute(out, data)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, fmt.Errorf("rendering %s template: %w", t.name, ctx.Err())
+	}
+
+	payload := out.buf.Bytes()
+	if !json.Valid(payload) {
+		return nil, fmt.Errorf("%s template did not render valid JSON", t.name)
+	}
+	return payload, nil
+}
+
+// Payload returns the body of a delivery: the rendered template, or raw when
+// t is nil or rendering fails. The rendering failure is returned alongside
+// raw so callers can record it on the delivery.
+func Payload(ctx context.Context, t *Template, data *Data, raw []byte) ([]byte, error) {
+	if t == nil {
+		return raw, nil
+	}
+	payload, err := t.Render(ctx, data)
+	if err != nil {
+		return raw, err
+	}
+	return payload, nil
+}
+
+// limitedBuffer fails writes past its limit or once its context is done,
+// which stops a template that runs too long at its next write
+type limitedBuffer struct {
+	ctx   context.Context
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if b.buf.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("payload exceeds %d bytes", b.limit)
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,287 @@
+package payloads
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/branding"
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the built-in templates")
+
+func loadEvent(t *testing.T, name string) Event {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", "events", name+".json"))
+	require.NoError(t, err)
+	var event Event
+	require.NoError(t, json.Unmarshal(content, &event))
+	return event
+}
+
+func TestBuiltins(t *testing.T) {
+	assert.Equal(t, []string{"pagerduty-v2", "slack-basic", "teams-card"}, Builtins())
+
+	params := map[string]string{"routing_key": "R0UT1NGK3Y"}
+	for _, name := range Builtins() {
+		for _, fixture := range []string{"execution_failed", "execution_completed", "step_failed"} {
+			t.Run(name+"/"+fixture, func(t *testing.T) {
+				tmpl, err := Compile(&models.PayloadTemplate{Name: name, Params: params})
+				require.NoError(t, err)
+
+				payload, err := tmpl.Render(context.Background(), NewData(loadEvent(t, fixture), tmpl.Params()))
+				require.NoError(t, err)
+
+				golden := filepath.Join("testdata", "golden", name, fixture+".json")
+				if *update {
+					var indented map[string]interface{}
+					require.NoError(t, json.Unmarshal(payload, &indented))
+					content, err := json.MarshalIndent(indented, "", "  ")
+					require.NoError(t, err)
+					require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0o755))
+					require.NoError(t, os.WriteFile(golden, append(content, '\n'), 0o644))
+				}
+				expected, err := os.ReadFile(golden)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(expected), string(payload))
+			})
+		}
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	tmpl, err := Compile(&models.PayloadTemplate{
+		Body: `{"kind": {{ json (upper .Event.Type) }}, "order": {{ json (get .Event.Data "output.order_id") }}, ` +
+			`"missing": {{ json (get .Event.Data "output.items.0") }}, "took": {{ json (formatDuration .Execution.DurationMs) }}, ` +
+			`"team": {{ json .Params.team }}, "status": {{ json .Execution.Status }}}`,
+		Params: map[string]string{"team": "payments"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "custom", tmpl.Name())
+
+	payload, err := tmpl.Render(context.Background(), NewData(loadEvent(t, "execution_completed"), tmpl.Params()))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"kind": "EXECUTION.COMPLETED", "order": "ord-1042", "missing": null, "took": "51s", "team": "payments", "status": "completed"}`, string(payload))
+}
+
+func TestLocalizedBuiltin(t *testing.T) {
+	manager := branding.NewManager(branding.NewMemoryStore(), logrus.New())
+	for key, value := range map[string]string{
+		"notification.title":            "Workflow {workflow} : {event}",
+		"notification.execution_status": "L'exécution {execution} est {status}",
+		"notification.step":             "Étape : {step}",
+	} {
+		_, err := manager.SetEntry(context.Background(), &branding.Entry{Namespace: branding.DefaultNamespace, Locale: "fr", Key: key, Value: value}, "tester")
+		require.NoError(t, err)
+	}
+
+	tmpl, err := Compile(&models.PayloadTemplate{Name: "slack-basic"})
+	require.NoError(t, err)
+	data := NewData(loadEvent(t, "execution_failed"), nil)
+	data.Messages = manager.Messages("acme", "fr")
+	payload, err := tmpl.Render(context.Background(), data)
+	require.NoError(t, err)
+
+	var message struct {
+		Text   string `json:"text"`
+		Blocks []struct {
+			Text struct {
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"blocks"`
+	}
+	require.NoError(t, json.Unmarshal(payload, &message))
+	assert.Equal(t, "Workflow checkout : execution.failed", message.Text)
+	require.GreaterOrEqual(t, len(message.Blocks), 2)
+	assert.Equal(t, "*checkout* execution.failed\nL'exécution `3f1c2d9e-7b1a-4c55-9a0e-1d2f3a4b5c6d` est *failed*", message.Blocks[0].Text.Text)
+	assert.Equal(t, "Étape : `charge_card`", message.Blocks[1].Text.Text)
+
+	// Strings of other locales fall back to English
+	data.Messages = manager.Messages("acme", "de")
+	payload, err = tmpl.Render(context.Background(), data)
+	require.NoError(t, err)
+	expected, err := os.ReadFile(filepath.Join("testdata", "golden", "slack-basic", "execution_failed.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(payload))
+}
+
+type holidays []string
+
+func (h holidays) GetCalendar(name string) (*scheduler.Calendar, error) {
+	if name != "holidays" {
+		return nil, errors.New("calendar not found")
+	}
+	return &scheduler.Calendar{Name: name, Dates: h}, nil
+}
+
+func TestExpressionFunctions(t *testing.T) {
+	tmpl, err := Compile(&models.PayloadTemplate{
+		Body: `{"due": {{ json (format (addBusinessDays now 3 "holidays") "date") }}, ` +
+			`"week": {{ json (format (startOf (inZone now "Asia/Tokyo") "week") "RFC3339") }}, ` +
+			`"seconds": {{ json (round 51.456 1) }}, ` +
+			`"ref": {{ json (concat (trim " ord ") "-" (max 3 .Execution.DurationMs)) }}}`,
+	})
+	require.NoError(t, err)
+
+	data := NewData(loadEvent(t, "execution_completed"), nil)
+	data.Calendars = holidays{"2024-05-03"}
+	payload, err := tmpl.Render(context.Background(), data)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"due": "2024-05-07", "week": "2024-04-29T00:00:00+09:00", "seconds": 51.5, "ref": "ord-51000"}`, string(payload))
+
+	// now is the event timestamp, so renders are deterministic
+	again, err := tmpl.Render(context.Background(), data)
+	require.NoError(t, err)
+	assert.Equal(t, payload, again)
+
+	data.Calendars = nil
+	_, err = tmpl.Render(context.Background(), data)
+	assert.ErrorContains(t, err, `addBusinessDays: calendar "holidays": no calendars are available`)
+
+	// Templates naming calendars validate against the sample data
+	assert.NoError(t, Validate(&models.PayloadTemplate{Body: `{"due": {{ json (addBusinessDays now 1 "holidays") }}}`}))
+	err = Validate(&models.PayloadTemplate{Body: `{"due": {{ json (addBusinessDays now) }}}`})
+	assert.ErrorContains(t, err, "addBusinessDays expects 2 to 3 arguments, got 1")
+}
+
+func TestValidate(t *testing.T) {
+	valid := []*models.PayloadTemplate{
+		nil,
+		{Name: "slack-basic"},
+		{Name: "teams-card"},
+		{Name: "pagerduty-v2", Params: map[string]string{"routing_key": "R0UT1NGK3Y"}},
+		{Body: `{"text": {{ json (truncate 20 .Event.Error) }}}`},
+	}
+	for _, spec := range valid {
+		assert.NoError(t, Validate(spec))
+	}
+
+	for name, tc := range map[string]struct {
+		spec    *models.PayloadTemplate
+		message string
+	}{
+		"empty":             {&models.PayloadTemplate{}, "name or body is required"},
+		"name and body":     {&models.PayloadTemplate{Name: "slack-basic", Body: `{}`}, "mutually exclusive"},
+		"unknown builtin":   {&models.PayloadTemplate{Name: "discord"}, `unknown built-in template "discord", expected one of pagerduty-v2, slack-basic, teams-card`},
+		"syntax":            {&models.PayloadTemplate{Body: `{"text": {{ .Event.Type }`}, "unexpected"},
+		"undefined func":    {&models.PayloadTemplate{Body: `{"home": {{ env "HOME" }}}`}, `function "env" not defined`},
+		"no file access":    {&models.PayloadTemplate{Body: `{{ readFile "/etc/passwd" }}`}, `function "readFile" not defined`},
+		"not json":          {&models.PayloadTemplate{Body: `text: {{ .Event.Type }}`}, "did not render valid JSON"},
+		"render error":      {&models.PayloadTemplate{Body: `{"at": {{ json (formatTime "2006" .Event.Type) }}}`}, "cannot parse"},
+		"missing param":     {&models.PayloadTemplate{Name: "pagerduty-v2"}, "routing_key param is required"},
+		"oversized":         {&models.PayloadTemplate{Body: `{"x": "` + strings.Repeat("a", MaxTemplateSize) + `"}`}, "exceeds"},
+		"oversized payload": {&models.PayloadTemplate{Body: `{"x": "{{ range .Params }}{{ printf "%1000s" "" }}{{ end }}"}`, Params: manyParams(2000)}, "payload exceeds"},
+	} {
+		err := Validate(tc.spec)
+		require.Error(t, err, name)
+		assert.True(t, errors.Is(err, ErrInvalidTemplate), name)
+		assert.Contains(t, err.Error(), tc.message, name)
+	}
+}
+
+func manyParams(n int) map[string]string {
+	params := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		params[strconv.Itoa(i)] = ""
+	}
+	return params
+}
+
+func TestValidateConfig(t *testing.T) {
+	config := &models.WorkflowConfig{
+		Webhooks: []models.Webhook{
+			{URL: "https://hooks.slack.com/services/x", Template: &models.PayloadTemplate{Name: "slack-basic"}},
+			{URL: "https://example.com/hook"},
+		},
+		Notifications: []models.Notification{
+			{Type: "webhook", Template: &models.PayloadTemplate{Name: "teams-card"}},
+		},
+	}
+	require.NoError(t, ValidateConfig(config))
+	require.NoError(t, ValidateConfig(nil))
+
+	config.Notifications = append(config.Notifications, models.Notification{Type: "webhook", Template: &models.PayloadTemplate{Name: "pagerduty-v2"}})
+	err := ValidateConfig(config)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrInvalidTemplate))
+	assert.Contains(t, err.Error(), "notifications[1].template")
+
+	config.Webhooks[1].Template = &models.PayloadTemplate{Body: "{{"}
+	err = ValidateConfig(config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "webhooks[1].template")
+}
+
+func TestPayload(t *testing.T) {
+	raw := []byte(`{"event": {"type": "execution.failed"}}`)
+	data := NewData(loadEvent(t, "execution_failed"), nil)
+
+	t.Run("no template", func(t *testing.T) {
+		payload, err := Payload(context.Background(), nil, data, raw)
+		require.NoError(t, err)
+		assert.Equal(t, raw, payload)
+	})
+
+	t.Run("rendered", func(t *testing.T) {
+		tmpl, err := Compile(&models.PayloadTemplate{Name: "slack-basic"})
+		require.NoError(t, err)
+		payload, err := Payload(context.Background(), tmpl, data, raw)
+		require.NoError(t, err)
+		assert.Contains(t, string(payload), `"blocks"`)
+	})
+
+	t.Run("falls back to the raw payload when rendering fails", func(t *testing.T) {
+		// The template was valid for the sample event but the delivered
+		// event has no output
+		tmpl, err := Compile(&models.PayloadTemplate{Body: `{"order": {{ json (required "order" (get .Event.Data "output.order_id")) }}}`})
+		require.NoError(t, err)
+		payload, err := Payload(context.Background(), tmpl, data, raw)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "order is required")
+		assert.Equal(t, raw, payload)
+	})
+
+	t.Run("falls back when rendering times out", func(t *testing.T) {
+		items := make([]int, 2000)
+		data := NewData(Event{Type: "execution.completed", Data: map[string]interface{}{"items": items}}, nil)
+		tmpl, err := Compile(&models.PayloadTemplate{Body: `{{ range get .Event.Data "items" }}{{ range get $.Event.Data "items" }}{{ range get $.Event.Data "items" }}{{ end }}{{ end }}{{ end }}{}`})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		payload, err := Payload(ctx, tmpl, data, raw)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(t, raw, payload)
+		assert.Less(t, time.Since(start), RenderTimeout)
+	})
+}
+
+func TestNewData(t *testing.T) {
+	data := NewData(loadEvent(t, "execution_failed"), nil)
+	assert.Equal(t, ExecutionSummary{
+		ID:           "3f1c2d9e-7b1a-4c55-9a0e-1d2f3a4b5c6d",
+		WorkflowID:   "8a7b6c5d-4e3f-4a1b-9c8d-7e6f5a4b3c2d",
+		WorkflowName: "checkout",
+		Status:       "failed",
+		DurationMs:   4250,
+		Error:        "payment provider returned 402: card declined",
+	}, data.Execution)
+	assert.NotNil(t, data.Params)
+
+	assert.Equal(t, "running", NewData(loadEvent(t, "step_failed"), nil).Execution.Status)
+}
@@ -0,0 +1,282 @@
+package policies
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Handlers provides HTTP handlers for admission policies
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new policy handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers policy routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		policies := v1.Group("/policies")
+		{
+			policies.GET("", h.ListPolicies)
+			policies.POST("", h.CreatePolicy)
+			policies.POST("/test", h.TestPolicy)
+			policies.GET("/decisions", h.ListDecisions)
+			policies.GET("/:id", h.GetPolicy)
+			policies.PUT("/:id", h.UpdatePolicy)
+			policies.DELETE("/:id", h.DeletePolicy)
+			policies.POST("/:id/test", h.TestRegisteredPolicy)
+		}
+	}
+}
+
+// TestRequest is the request body of a policy test. Policy is only read by
+// the test of unregistered policies.
+type TestRequest struct {
+	Policy   *Policy                `json:"policy,omitempty"`
+	Hook     Hook                   `json:"hook"`
+	Document map[string]interface{} `json:"document"`
+}
+
+// ListPolicies lists the registered policies
+// @Summary List admission policies
+// @Tags policies
+// @Produce json
+// @Success 200 {array} Policy
+// @Router /api/v1/policies [get]
+func (h *Handlers) ListPolicies(c *gin.Context) {
+	policies, err := h.manager.ListPolicies(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+// CreatePolicy registers a policy
+// @Summary Create an admission policy
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Param policy body Policy true "Policy"
+// @Success 201 {object} Policy
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/policies [post]
+func (h *Handlers) CreatePolicy(c *gin.Context) {
+	var policy Policy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.manager.CreatePolicy(c.Request.Context(), &policy)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetPolicy returns a policy
+// @Summary Get an admission policy
+// @Tags policies
+// @Produce json
+// @Param id path string true "Policy ID"
+// @Success 200 {object} Policy
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/policies/{id} [get]
+func (h *Handlers) GetPolicy(c *gin.Context) {
+	id, ok := policyID(c)
+	if !ok {
+		return
+	}
+
+	policy, err := h.manager.GetPolicy(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdatePolicy replaces a policy
+// @Summary Update an admission policy
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Param id path string true "Policy ID"
+// @Param policy body Policy true "Policy"
+// @Success 200 {object} Policy
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/policies/{id} [put]
+func (h *Handlers) UpdatePolicy(c *gin.Context) {
+	id, ok := policyID(c)
+	if !ok {
+		return
+	}
+
+	var policy Policy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.manager.UpdatePolicy(c.Request.Context(), id, &policy)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeletePolicy removes a policy
+// @Summary Delete an admission policy
+// @Tags policies
+// @Param id path string true "Policy ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/policies/{id} [delete]
+func (h *Handlers) DeletePolicy(c *gin.Context) {
+	id, ok := policyID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.manager.DeletePolicy(c.Request.Context(), id); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TestPolicy evaluates an unregistered policy against a sample document
+// @Summary Test an admission policy
+// @Description Evaluates a policy against a sample document without registering it or recording its decision
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Param request body TestRequest true "Policy and sample document"
+// @Success 200 {object} PolicyResult
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/policies/test [post]
+func (h *Handlers) TestPolicy(c *gin.Context) {
+	var req TestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Policy == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "policy is required"})
+		return
+	}
+
+	h.test(c, req.Policy, req)
+}
+
+// TestRegisteredPolicy evaluates a registered policy against a sample
+// document
+// @Summary Test a registered admission policy
+// @Tags policies
+// @Accept json
+// @Produce json
+// @Param id path string true "Policy ID"
+// @Param request body TestRequest true "Sample document"
+// @Success 200 {object} PolicyResult
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/policies/{id}/test [post]
+func (h *Handlers) TestRegisteredPolicy(c *gin.Context) {
+	id, ok := policyID(c)
+	if !ok {
+		return
+	}
+
+	var req TestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy, err := h.manager.GetPolicy(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	h.test(c, policy, req)
+}
+
+func (h *Handlers) test(c *gin.Context, policy *Policy, req TestRequest) {
+	result, err := h.manager.Test(c.Request.Context(), policy, req.Hook, req.Document)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ListDecisions returns the decision log, the most recent first
+// @Summary List policy decisions
+// @Description Lists the policy decisions that denied or warned about a request
+// @Tags policies
+// @Produce json
+// @Param policy_id query string false "Policy ID"
+// @Param workflow_id query string false "Workflow ID"
+// @Param decision query string false "Decision (deny, warn)"
+// @Param limit query int false "Limit"
+// @Success 200 {array} DecisionRecord
+// @Router /api/v1/policies/decisions [get]
+func (h *Handlers) ListDecisions(c *gin.Context) {
+	filter := DecisionFilter{Decision: Decision(c.Query("decision")), Limit: 100}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 1000 {
+		filter.Limit = l
+	}
+	for param, target := range map[string]**uuid.UUID{"policy_id": &filter.PolicyID, "workflow_id": &filter.WorkflowID} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+			return
+		}
+		*target = &id
+	}
+
+	decisions, err := h.manager.Decisions(c.Request.Context(), filter)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, decisions)
+}
+
+func policyID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid policy ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidPolicy):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrPolicyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrDuplicatePolicy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,432 @@
+package policies
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrDenied is returned when a policy denies a request
+var ErrDenied = errors.New("denied by policy")
+
+// DefaultNamespace is the namespace of workflows without a namespace label
+const DefaultNamespace = "default"
+
+// Namespace returns the namespace of a workflow definition, from its
+// namespace label
+func Namespace(definition models.WorkflowDefinition) string {
+	if namespace := definition.Metadata.Labels["namespace"]; namespace != "" {
+		return namespace
+	}
+	return DefaultNamespace
+}
+
+// Config configures policy evaluation
+type Config struct {
+	// DefaultTimeout bounds the evaluation of policies without a timeout
+	DefaultTimeout time.Duration
+}
+
+// DefaultConfig returns the default policy configuration
+func DefaultConfig() Config {
+	return Config{DefaultTimeout: 100 * time.Millisecond}
+}
+
+// ExecutionRequest is an execution about to be admitted
+type ExecutionRequest struct {
+	Workflow *models.Workflow
+	// Definition is the definition of the version the execution runs
+	Definition models.WorkflowDefinition
+	// Version is the version the execution runs
+	Version string
+	Input   map[string]interface{}
+	// Actor is who requested the execution, when known
+	Actor string
+	// DryRun evaluates the policies without recording their decisions, for
+	// pre-flight requests
+	DryRun bool
+}
+
+// ActivationRequest is a workflow version about to be activated
+type ActivationRequest struct {
+	Workflow *models.Workflow
+	Version  *models.WorkflowVersion
+	// Actor is who requested the activation, when known
+	Actor  string
+	DryRun bool
+}
+
+// PolicyResult is the decision of one policy
+type PolicyResult struct {
+	PolicyID uuid.UUID `json:"policy_id"`
+	Name     string    `json:"name"`
+	Decision Decision  `json:"decision"`
+	// Reasons are those of the rules that fired, or why the policy could
+	// not be evaluated
+	Reasons []string `json:"reasons,omitempty"`
+	// Error is why the policy could not be evaluated, its failure mode
+	// deciding the request
+	Error string `json:"error,omitempty"`
+}
+
+// Result is the decision of the policies evaluated at a hook. Deny overrides
+// warn, which overrides allow.
+type Result struct {
+	Hook      Hook           `json:"hook"`
+	Namespace string         `json:"namespace"`
+	Decision  Decision       `json:"decision"`
+	Policies  []PolicyResult `json:"policies"`
+}
+
+// Reasons returns the reasons of the policies that reached a decision,
+// prefixed with the policy name
+func (r *Result) Reasons(decision Decision) []string {
+	var reasons []string
+	for _, policy := range r.Policies {
+		if policy.Decision != decision {
+			continue
+		}
+		for _, reason := range policy.Reasons {
+			reasons = append(reasons, policy.Name+": "+reason)
+		}
+	}
+	return reasons
+}
+
+// Err returns a DeniedError when the request is denied
+func (r *Result) Err() error {
+	if r.Decision != DecisionDeny {
+		return nil
+	}
+	return &DeniedError{Result: r}
+}
+
+// DeniedError is returned when policies deny a request
+type DeniedError struct {
+	Result *Result
+}
+
+// Error returns the error message
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrDenied, strings.Join(e.Result.Reasons(DecisionDeny), "; "))
+}
+
+// Unwrap returns ErrDenied
+func (e *DeniedError) Unwrap() error {
+	return ErrDenied
+}
+
+// Manager registers policies and evaluates them at the hook points,
+// recording the requests they deny or warn about in the decision log
+type Manager struct {
+	store  Store
+	config Config
+	logger *logrus.Logger
+	now    func() time.Time
+}
+
+// NewManager creates a policy manager
+func NewManager(store Store, config Config, logger *logrus.Logger) *Manager {
+	if config.DefaultTimeout <= 0 {
+		config.DefaultTimeout = DefaultConfig().DefaultTimeout
+	}
+	return &Manager{
+		store:  store,
+		config: config,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// CreatePolicy registers a policy
+func (m *Manager) CreatePolicy(ctx context.Context, policy *Policy) (*Policy, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := m.now().UTC()
+	policy.ID = uuid.New()
+	policy.CreatedAt = now
+	policy.UpdatedAt = now
+	if err := m.store.Create(ctx, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// UpdatePolicy replaces a policy
+func (m *Manager) UpdatePolicy(ctx context.Context, id uuid.UUID, policy *Policy) (*Policy, error) {
+	existing, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	policy.ID = id
+	policy.CreatedAt = existing.CreatedAt
+	policy.UpdatedAt = m.now().UTC()
+	if err := m.store.Update(ctx, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// GetPolicy returns a policy
+func (m *Manager) GetPolicy(ctx context.Context, id uuid.UUID) (*Policy, error) {
+	return m.store.Get(ctx, id)
+}
+
+// DeletePolicy removes a policy
+func (m *Manager) DeletePolicy(ctx context.Context, id uuid.UUID) error {
+	return m.store.Delete(ctx, id)
+}
+
+// ListPolicies returns every policy, ordered by name
+func (m *Manager) ListPolicies(ctx context.Context) ([]*Policy, error) {
+	return m.store.List(ctx)
+}
+
+// Decisions returns the decision log
+func (m *Manager) Decisions(ctx context.Context, filter DecisionFilter) ([]*DecisionRecord, error) {
+	return m.store.ListDecisions(ctx, filter)
+}
+
+// EvaluateExecution evaluates the execution admission policies of the
+// namespace of the workflow. The document holds the input, the labels and
+// the metadata of the workflow.
+func (m *Manager) EvaluateExecution(ctx context.Context, request *ExecutionRequest) (*Result, error) {
+	namespace := Namespace(request.Definition)
+	workflow := workflowDocument(request.Workflow, request.Definition)
+	workflow["version"] = request.Version
+
+	document, err := normalize(map[string]interface{}{
+		"hook":      HookExecutionAdmission,
+		"namespace": namespace,
+		"labels":    request.Definition.Metadata.Labels,
+		"workflow":  workflow,
+		"input":     request.Input,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	audit := DecisionRecord{WorkflowID: request.Workflow.ID, Actor: request.Actor}
+	return m.evaluate(ctx, HookExecutionAdmission, namespace, document, audit, request.DryRun)
+}
+
+// EvaluateActivation evaluates the version activation policies of the
+// namespace of the version. The document holds the full definition of the
+// version.
+func (m *Manager) EvaluateActivation(ctx context.Context, request *ActivationRequest) (*Result, error) {
+	version := request.Version
+	namespace := Namespace(version.Definition)
+
+	document, err := normalize(map[string]interface{}{
+		"hook":       HookVersionActivation,
+		"namespace":  namespace,
+		"labels":     version.Definition.Metadata.Labels,
+		"workflow":   workflowDocument(request.Workflow, version.Definition),
+		"definition": version.Definition,
+		"version": map[string]interface{}{
+			"id":               version.ID,
+			"version":          version.Version,
+			"status":           version.Status,
+			"description":      version.Description,
+			"changelog":        version.Changelog,
+			"breaking_changes": version.BreakingChanges,
+			"created_by":       version.CreatedBy,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	audit := DecisionRecord{WorkflowID: version.WorkflowID, VersionID: &version.ID, Actor: request.Actor}
+	return m.evaluate(ctx, HookVersionActivation, namespace, document, audit, request.DryRun)
+}
+
+// Test evaluates a policy against a sample document without registering
+// it or recording its decision. The document may set now to evaluate time
+// conditions at a given time.
+func (m *Manager) Test(ctx context.Context, policy *Policy, hook Hook, document map[string]interface{}) (*PolicyResult, error) {
+	compiled, err := policy.compile()
+	if err != nil {
+		return nil, err
+	}
+	document, err = normalize(document)
+	if err != nil {
+		return nil, err
+	}
+	if document == nil {
+		document = make(map[string]interface{})
+	}
+	if _, ok := document["hook"]; !ok && hook != "" {
+		document["hook"] = string(hook)
+	}
+	result := m.evaluatePolicy(ctx, compiled, document)
+	return &result, nil
+}
+
+// evaluate evaluates the policies of a hook that apply to a namespace.
+// Unless the evaluation is a dry run, the policies that did not allow the
+// request are recorded in the decision log.
+func (m *Manager) evaluate(ctx context.Context, hook Hook, namespace string, document map[string]interface{}, audit DecisionRecord, dryRun bool) (*Result, error) {
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+
+	result := &Result{Hook: hook, Namespace: namespace, Decision: DecisionAllow, Policies: []PolicyResult{}}
+	for _, policy := range stored {
+		if !policy.AppliesTo(hook, namespace) {
+			continue
+		}
+
+		var policyResult PolicyResult
+		compiled, err := policy.compile()
+		if err != nil {
+			policyResult = failed(policy, err)
+		} else {
+			policyResult = m.evaluatePolicy(ctx, compiled, document)
+		}
+		result.Policies = append(result.Policies, policyResult)
+		if policyResult.Decision.severity() > result.Decision.severity() {
+			result.Decision = policyResult.Decision
+		}
+
+		if !dryRun && policyResult.Decision != DecisionAllow {
+			m.record(ctx, hook, namespace, audit, policyResult)
+		}
+	}
+	return result, nil
+}
+
+// evaluatePolicy evaluates every rule of a policy within its timeout. A
+// policy that cannot be evaluated warns when it fails open and denies when
+// it fails closed.
+func (m *Manager) evaluatePolicy(ctx context.Context, policy *compiledPolicy, document map[string]interface{}) PolicyResult {
+	timeout := m.config.DefaultTimeout
+	if policy.TimeoutMS > 0 {
+		timeout = time.Duration(policy.TimeoutMS) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The time fields and now() are those of the time zone of the policy, so
+	// they are added to a copy of the shared document
+	env := &expressions.Env{Now: m.now().In(policy.location)}
+	if _, ok := document["now"]; !ok {
+		withNow := make(map[string]interface{}, len(document)+1)
+		for key, value := range document {
+			withNow[key] = value
+		}
+		withNow["now"] = nowDocument(env.Now)
+		document = withNow
+	}
+
+	result := PolicyResult{PolicyID: policy.ID, Name: policy.Name, Decision: DecisionAllow}
+	for i, rule := range policy.rules {
+		fired, err := rule.condition.EvalBool(ctx, env, document)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("evaluation timed out after %s", timeout)
+		}
+		if err != nil {
+			return failed(policy.Policy, fmt.Errorf("rule %d: %w", i+1, err))
+		}
+		if !fired {
+			continue
+		}
+		if rule.Decision.severity() > result.Decision.severity() {
+			result.Decision = rule.Decision
+		}
+		result.Reasons = append(result.Reasons, rule.Reason)
+	}
+	return result
+}
+
+// failed returns the decision of a policy that could not be evaluated
+func failed(policy *Policy, err error) PolicyResult {
+	decision := DecisionWarn
+	if policy.FailureMode == FailClosed {
+		decision = DecisionDeny
+	}
+	return PolicyResult{
+		PolicyID: policy.ID,
+		Name:     policy.Name,
+		Decision: decision,
+		Reasons:  []string{fmt.Sprintf("policy could not be evaluated and fails %s", policy.FailureMode)},
+		Error:    err.Error(),
+	}
+}
+
+// record adds a policy decision to the decision log. Failures are logged,
+// as the request was already decided.
+func (m *Manager) record(ctx context.Context, hook Hook, namespace string, audit DecisionRecord, result PolicyResult) {
+	record := audit
+	record.PolicyID = result.PolicyID
+	record.PolicyName = result.Name
+	record.Hook = hook
+	record.Namespace = namespace
+	record.Decision = result.Decision
+	record.Reason = strings.Join(result.Reasons, "; ")
+	record.Error = result.Error
+	record.EvaluatedAt = m.now().UTC()
+
+	if err := m.store.RecordDecision(ctx, &record); err != nil {
+		m.logger.WithError(err).WithFields(logrus.Fields{
+			"policy":      result.Name,
+			"hook":        hook,
+			"workflow_id": audit.WorkflowID,
+		}).Error("Failed to record policy decision")
+	}
+}
+
+// workflowDocument describes the metadata of a workflow
+func workflowDocument(workflow *models.Workflow, definition models.WorkflowDefinition) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         workflow.ID,
+		"name":       workflow.Name,
+		"version":    workflow.Version,
+		"status":     workflow.Status,
+		"owner":      workflow.Owner,
+		"created_by": workflow.CreatedBy,
+		"tags":       workflow.Tags,
+		"labels":     definition.Metadata.Labels,
+	}
+}
+
+// nowDocument describes a time. Weekdays are named, such as Friday.
+func nowDocument(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"time":    now.Format(time.RFC3339),
+		"date":    now.Format("2006-01-02"),
+		"weekday": now.Weekday().String(),
+		"hour":    float64(now.Hour()),
+		"minute":  float64(now.Minute()),
+	}
+}
+
+// normalize converts a document to its JSON form, so expressions compare
+// numbers as float64 and read structs through their JSON field names
+func normalize(document map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy document: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to decode policy document: %w", err)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,483 @@
+package policies
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/pkg/models"
+)
+
+// evaluatedAt is a Friday
+var evaluatedAt = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newManager(t *testing.T) (*Manager, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	manager := NewManager(store, DefaultConfig(), logrus.New())
+	manager.now = func() time.Time { return evaluatedAt }
+	return manager, store
+}
+
+func register(t *testing.T, manager *Manager, policy *Policy) *Policy {
+	t.Helper()
+	policy.Enabled = true
+	if policy.FailureMode == "" {
+		policy.FailureMode = FailClosed
+	}
+	created, err := manager.CreatePolicy(context.Background(), policy)
+	require.NoError(t, err)
+	return created
+}
+
+func newWorkflow(namespace string, steps ...models.WorkflowStep) *models.Workflow {
+	return &models.Workflow{
+		ID:      uuid.New(),
+		Name:    "charge-card",
+		Version: "1.0.0",
+		Status:  models.WorkflowStatusActive,
+		Owner:   "payments",
+		Definition: models.WorkflowDefinition{
+			Metadata: models.WorkflowMetadata{Labels: map[string]string{"namespace": namespace, "tier": "critical"}},
+			Spec:     models.WorkflowSpec{Steps: steps},
+		},
+	}
+}
+
+func executionRequest(workflow *models.Workflow, input map[string]interface{}) *ExecutionRequest {
+	return &ExecutionRequest{Workflow: workflow, Definition: workflow.Definition, Version: workflow.Version, Input: input}
+}
+
+func activationRequest(workflow *models.Workflow) *ActivationRequest {
+	return &ActivationRequest{
+		Workflow: workflow,
+		Version: &models.WorkflowVersion{
+			ID:         uuid.New(),
+			WorkflowID: workflow.ID,
+			Version:    "1.1.0",
+			Definition: workflow.Definition,
+		},
+	}
+}
+
+func TestEvaluateExecution(t *testing.T) {
+	manager, store := newManager(t)
+	register(t, manager, &Policy{
+		Name:      "payment-limits",
+		Namespace: "prod-payments",
+		Hooks:     []Hook{HookExecutionAdmission},
+		Rules: []Rule{
+			{Decision: DecisionDeny, When: "input.amount > 10000", Reason: "amounts above 10000 need a manual review"},
+			{Decision: DecisionDeny, When: `input.currency not in ["EUR", "USD"]`, Reason: "unsupported currency"},
+			{Decision: DecisionWarn, When: `labels.tier == "critical" && input.amount > 5000`, Reason: "large payment on a critical workflow"},
+		},
+	})
+	register(t, manager, &Policy{
+		Name:  "owners",
+		Hooks: []Hook{HookExecutionAdmission},
+		Rules: []Rule{{Decision: DecisionWarn, When: `workflow.owner == ""`, Reason: "workflow has no owner"}},
+	})
+	register(t, manager, &Policy{
+		Name:  "activation-only",
+		Hooks: []Hook{HookVersionActivation},
+		Rules: []Rule{{Decision: DecisionDeny, When: "true", Reason: "never evaluated at admission"}},
+	})
+	ctx := context.Background()
+
+	t.Run("denied execution", func(t *testing.T) {
+		workflow := newWorkflow("prod-payments")
+		result, err := manager.EvaluateExecution(ctx, executionRequest(workflow, map[string]interface{}{"amount": 20000, "currency": "JPY"}))
+		require.NoError(t, err)
+
+		assert.Equal(t, DecisionDeny, result.Decision)
+		assert.Equal(t, "prod-payments", result.Namespace)
+		assert.Equal(t, []string{
+			"payment-limits: amounts above 10000 need a manual review",
+			"payment-limits: unsupported currency",
+			"payment-limits: large payment on a critical workflow",
+		}, result.Reasons(DecisionDeny))
+		require.Len(t, result.Policies, 2, "policies of other hooks are not evaluated")
+
+		err = result.Err()
+		var denied *DeniedError
+		require.True(t, errors.As(err, &denied))
+		assert.ErrorIs(t, err, ErrDenied)
+		assert.Contains(t, err.Error(), "denied by policy: payment-limits: amounts above 10000 need a manual review")
+
+		decisions, err := store.ListDecisions(ctx, DecisionFilter{WorkflowID: &workflow.ID})
+		require.NoError(t, err)
+		require.Len(t, decisions, 1)
+		assert.Equal(t, DecisionDeny, decisions[0].Decision)
+		assert.Equal(t, "payment-limits", decisions[0].PolicyName)
+		assert.Equal(t, HookExecutionAdmission, decisions[0].Hook)
+		assert.Equal(t, evaluatedAt, decisions[0].EvaluatedAt)
+	})
+
+	t.Run("warned execution", func(t *testing.T) {
+		workflow := newWorkflow("prod-payments")
+		result, err := manager.EvaluateExecution(ctx, executionRequest(workflow, map[string]interface{}{"amount": 6000, "currency": "EUR"}))
+		require.NoError(t, err)
+
+		assert.Equal(t, DecisionWarn, result.Decision)
+		assert.NoError(t, result.Err())
+		assert.Equal(t, []string{"payment-limits: large payment on a critical workflow"}, result.Reasons(DecisionWarn))
+	})
+
+	t.Run("namespaced policies apply to their namespace", func(t *testing.T) {
+		workflow := newWorkflow("staging")
+		result, err := manager.EvaluateExecution(ctx, executionRequest(workflow, map[string]interface{}{"amount": 20000}))
+		require.NoError(t, err)
+
+		assert.Equal(t, DecisionAllow, result.Decision)
+		require.Len(t, result.Policies, 1)
+		assert.Equal(t, "owners", result.Policies[0].Name)
+	})
+
+	t.Run("dry runs are not recorded", func(t *testing.T) {
+		workflow := newWorkflow("prod-payments")
+		request := executionRequest(workflow, map[string]interface{}{"amount": 20000, "currency": "EUR"})
+		request.DryRun = true
+		result, err := manager.EvaluateExecution(ctx, request)
+		require.NoError(t, err)
+		assert.Equal(t, DecisionDeny, result.Decision)
+
+		decisions, err := store.ListDecisions(ctx, DecisionFilter{WorkflowID: &workflow.ID})
+		require.NoError(t, err)
+		assert.Empty(t, decisions)
+	})
+}
+
+func TestEvaluateActivation(t *testing.T) {
+	manager, store := newManager(t)
+	register(t, manager, &Policy{
+		Name:      "https-allowlist",
+		Namespace: "prod-payments",
+		Hooks:     []Hook{HookVersionActivation},
+		Rules: []Rule{{
+			Decision: DecisionDeny,
+			When: `any(definition.spec.steps, step, step.type == "http" &&
+				(url_scheme(step.config.url) != "https" || url_host(step.config.url) not in ["api.stripe.com", "ledger.internal"]))`,
+			Reason: "http steps may only call allowlisted https endpoints",
+		}},
+	})
+	ctx := context.Background()
+	step := func(url string) models.WorkflowStep {
+		return models.WorkflowStep{Name: "call", Type: "http", Config: map[string]interface{}{"url": url}}
+	}
+
+	for _, tc := range []struct {
+		url      string
+		decision Decision
+	}{
+		{url: "https://api.stripe.com/v1/charges", decision: DecisionAllow},
+		{url: "https://LEDGER.internal/entries", decision: DecisionAllow},
+		{url: "http://api.stripe.com/v1/charges", decision: DecisionDeny},
+		{url: "https://evil.example.com/collect", decision: DecisionDeny},
+	} {
+		t.Run(tc.url, func(t *testing.T) {
+			workflow := newWorkflow("prod-payments", models.WorkflowStep{Name: "validate", Type: "transform"}, step(tc.url))
+			result, err := manager.EvaluateActivation(ctx, activationRequest(workflow))
+			require.NoError(t, err)
+			assert.Equal(t, tc.decision, result.Decision)
+		})
+	}
+
+	t.Run("denied activation is recorded", func(t *testing.T) {
+		workflow := newWorkflow("prod-payments", step("http://ledger.internal"))
+		request := activationRequest(workflow)
+		request.Actor = "alice"
+		result, err := manager.EvaluateActivation(ctx, request)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"https-allowlist: http steps may only call allowlisted https endpoints"}, result.Reasons(DecisionDeny))
+
+		decisions, err := store.ListDecisions(ctx, DecisionFilter{WorkflowID: &workflow.ID})
+		require.NoError(t, err)
+		require.Len(t, decisions, 1)
+		assert.Equal(t, HookVersionActivation, decisions[0].Hook)
+		assert.Equal(t, &request.Version.ID, decisions[0].VersionID)
+		assert.Equal(t, "alice", decisions[0].Actor)
+	})
+
+	t.Run("other namespaces", func(t *testing.T) {
+		workflow := newWorkflow("", step("http://anything.example.com"))
+		result, err := manager.EvaluateActivation(ctx, activationRequest(workflow))
+		require.NoError(t, err)
+		assert.Equal(t, DefaultNamespace, result.Namespace)
+		assert.Equal(t, DecisionAllow, result.Decision)
+		assert.Empty(t, result.Policies)
+	})
+}
+
+func TestFridayCutoff(t *testing.T) {
+	manager, _ := newManager(t)
+	register(t, manager, &Policy{
+		Name:     "no-friday-deploys",
+		Hooks:    []Hook{HookVersionActivation},
+		TimeZone: "UTC",
+		Rules: []Rule{{
+			Decision: DecisionDeny,
+			When:     `now.weekday == "Friday" && now.hour >= 15`,
+			Reason:   "no version activation on Fridays after 15:00",
+		}},
+	})
+
+	for _, tc := range []struct {
+		name     string
+		at       time.Time
+		decision Decision
+	}{
+		{name: "friday afternoon", at: time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC), decision: DecisionDeny},
+		{name: "friday evening", at: time.Date(2024, 3, 1, 22, 30, 0, 0, time.UTC), decision: DecisionDeny},
+		{name: "friday morning", at: time.Date(2024, 3, 1, 14, 59, 0, 0, time.UTC), decision: DecisionAllow},
+		{name: "thursday afternoon", at: time.Date(2024, 2, 29, 16, 0, 0, 0, time.UTC), decision: DecisionAllow},
+		{name: "friday afternoon elsewhere", at: time.Date(2024, 3, 1, 15, 0, 0, 0, time.FixedZone("UTC+2", 2*3600)), decision: DecisionAllow},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			manager.now = func() time.Time { return tc.at }
+			result, err := manager.EvaluateActivation(context.Background(), activationRequest(newWorkflow("default")))
+			require.NoError(t, err)
+			assert.Equal(t, tc.decision, result.Decision)
+		})
+	}
+}
+
+func TestEvaluationTimeout(t *testing.T) {
+	items := make([]interface{}, 2000)
+	for i := range items {
+		items[i] = i
+	}
+	slow := func(mode FailureMode) *Policy {
+		return &Policy{
+			Name:        "slow-" + string(mode),
+			Hooks:       []Hook{HookExecutionAdmission},
+			TimeoutMS:   1,
+			FailureMode: mode,
+			Rules: []Rule{{
+				Decision: DecisionDeny,
+				When:     "any(input.items, a, any(input.items, b, a == b && a < 0))",
+				Reason:   "negative item",
+			}},
+		}
+	}
+
+	t.Run("fail open warns", func(t *testing.T) {
+		manager, store := newManager(t)
+		register(t, manager, slow(FailOpen))
+
+		workflow := newWorkflow("default")
+		result, err := manager.EvaluateExecution(context.Background(), executionRequest(workflow, map[string]interface{}{"items": items}))
+		require.NoError(t, err)
+		assert.Equal(t, DecisionWarn, result.Decision)
+		assert.NoError(t, result.Err())
+		require.Len(t, result.Policies, 1)
+		assert.Contains(t, result.Policies[0].Error, "evaluation timed out after 1ms")
+		assert.Equal(t, []string{"slow-open: policy could not be evaluated and fails open"}, result.Reasons(DecisionWarn))
+
+		decisions, err := store.ListDecisions(context.Background(), DecisionFilter{})
+		require.NoError(t, err)
+		require.Len(t, decisions, 1)
+		assert.Equal(t, DecisionWarn, decisions[0].Decision)
+		assert.Contains(t, decisions[0].Error, "timed out")
+	})
+
+	t.Run("fail closed denies", func(t *testing.T) {
+		manager, _ := newManager(t)
+		register(t, manager, slow(FailClosed))
+
+		result, err := manager.EvaluateExecution(context.Background(), executionRequest(newWorkflow("default"), map[string]interface{}{"items": items}))
+		require.NoError(t, err)
+		assert.Equal(t, DecisionDeny, result.Decision)
+		assert.ErrorIs(t, result.Err(), ErrDenied)
+		assert.Contains(t, result.Policies[0].Error, "evaluation timed out after 1ms")
+	})
+
+	t.Run("evaluation errors follow the failure mode", func(t *testing.T) {
+		manager, _ := newManager(t)
+		register(t, manager, &Policy{
+			Name:        "type-mismatch",
+			Hooks:       []Hook{HookExecutionAdmission},
+			FailureMode: FailClosed,
+			Rules:       []Rule{{Decision: DecisionWarn, When: `input.amount > "ten"`, Reason: "large amount"}},
+		})
+
+		result, err := manager.EvaluateExecution(context.Background(), executionRequest(newWorkflow("default"), map[string]interface{}{"amount": 5}))
+		require.NoError(t, err)
+		assert.Equal(t, DecisionDeny, result.Decision)
+		assert.Equal(t, "rule 1: cannot compare number with string", result.Policies[0].Error)
+	})
+}
+
+func TestExpressions(t *testing.T) {
+	document := map[string]interface{}{
+		"input": map[string]interface{}{
+			"name":   "Order-42",
+			"amount": 12.5,
+			"tags":   []interface{}{"eu", "b2b"},
+			"items":  []interface{}{map[string]interface{}{"sku": "a", "qty": 2.0}, map[string]interface{}{"sku": "b", "qty": 0.0}},
+		},
+		"labels": map[string]interface{}{"team": "payments"},
+	}
+
+	for _, tc := range []struct {
+		expr string
+		want bool
+	}{
+		{expr: `input.amount >= 12.5 and input.amount < 13`, want: true},
+		{expr: `"eu" in input.tags && !("us" in input.tags)`, want: true},
+		{expr: `"team" in labels and labels["team"] == "payments"`, want: true},
+		{expr: `lower(input.name) == "order-42" && starts_with(input.name, "Order")`, want: true},
+		{expr: `matches(input.name, "^Order-[0-9]+$")`, want: true},
+		{expr: `len(input.items) == 2 && input.items[1].sku == "b"`, want: true},
+		{expr: `all(input.items, item, item.qty > 0)`, want: false},
+		{expr: `any(input.items, item, item.qty == 0)`, want: true},
+		{expr: `input.missing.field > 3 or input.missing == null`, want: true},
+		{expr: `contains(input.name, "42") || false`, want: true},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			expr, err := expressions.Parse(tc.expr)
+			require.NoError(t, err)
+			got, err := expr.EvalBool(context.Background(), nil, document)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	for _, source := range []string{`input.amount >`, `unknown(input)`, `len(1, 2)`, `"unterminated`, `any(input.items, 1, true)`} {
+		_, err := expressions.Parse(source)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestPolicyValidation(t *testing.T) {
+	manager, _ := newManager(t)
+	_, err := manager.CreatePolicy(context.Background(), &Policy{
+		Name:        "broken",
+		Hooks:       []Hook{"on_deploy"},
+		FailureMode: "sometimes",
+		TimeoutMS:   60000,
+		Rules:       []Rule{{Decision: DecisionAllow, When: "input.amount >"}},
+	})
+
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	for _, problem := range []string{
+		`unknown hook "on_deploy"`,
+		"failure_mode must be open or closed",
+		"timeout_ms must be between 0 and 5000",
+		"rule 1: decision must be deny or warn",
+		"rule 1: invalid condition",
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager, _ := newManager(t)
+	router := gin.New()
+	NewHandlers(manager).RegisterRoutes(router.Group("/api"))
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, bytes.NewReader(payload)))
+		return recorder
+	}
+	cutoff := Policy{
+		Name:        "no-friday-deploys",
+		Hooks:       []Hook{HookVersionActivation},
+		FailureMode: FailOpen,
+		Enabled:     true,
+		Rules: []Rule{{
+			Decision: DecisionDeny,
+			When:     `now.weekday == "Friday" && now.hour >= 15`,
+			Reason:   "no version activation on Fridays after 15:00",
+		}},
+	}
+
+	recorder := send(http.MethodPost, "/api/v1/policies", cutoff)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created Policy
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	assert.NotEqual(t, uuid.Nil, created.ID)
+
+	t.Run("duplicate name", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, send(http.MethodPost, "/api/v1/policies", cutoff).Code)
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		recorder := send(http.MethodPost, "/api/v1/policies", Policy{Name: "empty"})
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "at least one rule is required")
+	})
+
+	t.Run("test registered policy", func(t *testing.T) {
+		recorder := send(http.MethodPost, "/api/v1/policies/"+created.ID.String()+"/test", TestRequest{
+			Hook:     HookVersionActivation,
+			Document: map[string]interface{}{"now": map[string]interface{}{"weekday": "Friday", "hour": 16}},
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var result PolicyResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		assert.Equal(t, DecisionDeny, result.Decision)
+		assert.Equal(t, []string{"no version activation on Fridays after 15:00"}, result.Reasons)
+	})
+
+	t.Run("test unregistered policy", func(t *testing.T) {
+		recorder := send(http.MethodPost, "/api/v1/policies/test", TestRequest{
+			Policy: &Policy{
+				Name:        "amount-limit",
+				Hooks:       []Hook{HookExecutionAdmission},
+				FailureMode: FailClosed,
+				Rules:       []Rule{{Decision: DecisionWarn, When: "input.amount > 100", Reason: "large amount"}},
+			},
+			Hook:     HookExecutionAdmission,
+			Document: map[string]interface{}{"input": map[string]interface{}{"amount": 50}},
+		})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var result PolicyResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		assert.Equal(t, DecisionAllow, result.Decision)
+		assert.Empty(t, result.Reasons)
+
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/api/v1/policies/test", TestRequest{}).Code)
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/api/v1/policies/"+uuid.New().String(), nil).Code)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/api/v1/policies/not-a-uuid", nil).Code)
+	})
+
+	t.Run("decisions", func(t *testing.T) {
+		manager.now = func() time.Time { return evaluatedAt.Add(4 * time.Hour) }
+		result, err := manager.EvaluateActivation(context.Background(), activationRequest(newWorkflow("default")))
+		require.NoError(t, err)
+		require.Equal(t, DecisionDeny, result.Decision)
+
+		recorder := send(http.MethodGet, "/api/v1/policies/decisions?decision=deny&policy_id="+created.ID.String(), nil)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var decisions []DecisionRecord
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &decisions))
+		require.Len(t, decisions, 1)
+		assert.Equal(t, "no version activation on Fridays after 15:00", decisions[0].Reason)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send(http.MethodDelete, "/api/v1/policies/"+created.ID.String(), nil).Code)
+		assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, "/api/v1/policies/"+created.ID.String(), nil).Code)
+	})
+}
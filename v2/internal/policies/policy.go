@@ -0,0 +1,185 @@
+// Package policies evaluates admission policies, org rules written as data
+// rather than code, at two hook points: execution admission and version
+// activation. Each policy holds rules whose conditions are expressions over
+// a document describing the request, and decides to allow, deny or warn.
+package policies
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/expressions"
+)
+
+// Hook is a point where policies are evaluated
+type Hook string
+
+const (
+	// HookExecutionAdmission evaluates policies before an execution is
+	// created, against its input, labels and workflow
+	HookExecutionAdmission Hook = "execution_admission"
+	// HookVersionActivation evaluates policies before a version is put in
+	// production, against its full definition
+	HookVersionActivation Hook = "version_activation"
+)
+
+// Decision is the outcome of a policy
+type Decision string
+
+const (
+	DecisionAllow Decision = "allow"
+	DecisionWarn  Decision = "warn"
+	DecisionDeny  Decision = "deny"
+)
+
+// severity orders decisions, deny overriding warn overriding allow
+func (d Decision) severity() int {
+	switch d {
+	case DecisionDeny:
+		return 2
+	case DecisionWarn:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// FailureMode decides what happens when a policy cannot be evaluated, such
+// as when it times out
+type FailureMode string
+
+const (
+	// FailOpen lets the request through with a warning
+	FailOpen FailureMode = "open"
+	// FailClosed denies the request
+	FailClosed FailureMode = "closed"
+)
+
+// MaxTimeout is the longest evaluation timeout a policy can set
+const MaxTimeout = 5 * time.Second
+
+// ErrInvalidPolicy is returned for policies that cannot be registered
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Rule denies or warns when its condition holds
+type Rule struct {
+	// Decision is deny or warn
+	Decision Decision `json:"decision"`
+	// When is the condition expression
+	When string `json:"when"`
+	// Reason explains the decision to the caller
+	Reason string `json:"reason"`
+}
+
+// Policy is a set of rules evaluated at hook points, globally or for the
+// workflows of one namespace. A policy whose rules do not fire allows the
+// request.
+type Policy struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description string    `json:"description" gorm:"type:text"`
+	// Namespace limits the policy to the workflows labeled with it. Empty
+	// for global policies.
+	Namespace string `json:"namespace,omitempty" gorm:"index"`
+	Hooks     []Hook `json:"hooks" gorm:"type:jsonb;serializer:json"`
+	Rules     []Rule `json:"rules" gorm:"type:jsonb;serializer:json"`
+	// TimeoutMS bounds the evaluation of the policy, the configured default
+	// applying when zero
+	TimeoutMS   int         `json:"timeout_ms,omitempty"`
+	FailureMode FailureMode `json:"failure_mode"`
+	// TimeZone is the time zone of the now fields of the document, UTC by
+	// default
+	TimeZone  string    `json:"time_zone,omitempty"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the Policy model
+func (Policy) TableName() string {
+	return "admission_policies"
+}
+
+// AppliesTo reports whether the policy is evaluated at a hook for the
+// workflows of a namespace
+func (p *Policy) AppliesTo(hook Hook, namespace string) bool {
+	if !p.Enabled || (p.Namespace != "" && p.Namespace != namespace) {
+		return false
+	}
+	for _, h := range p.Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the policy, compiling the conditions of its rules. The
+// error wraps ErrInvalidPolicy and lists every problem.
+func (p *Policy) Validate() error {
+	_, err := p.compile()
+	return err
+}
+
+// compiledRule is a rule with its parsed condition
+type compiledRule struct {
+	Rule
+	condition *expressions.Expression
+}
+
+// compiledPolicy is a policy ready to be evaluated
+type compiledPolicy struct {
+	*Policy
+	rules    []compiledRule
+	location *time.Location
+}
+
+func (p *Policy) compile() (*compiledPolicy, error) {
+	var problems []string
+	if strings.TrimSpace(p.Name) == "" {
+		problems = append(problems, "name is required")
+	}
+	if len(p.Hooks) == 0 {
+		problems = append(problems, "at least one hook is required")
+	}
+	for _, hook := range p.Hooks {
+		if hook != HookExecutionAdmission && hook != HookVersionActivation {
+			problems = append(problems, fmt.Sprintf("unknown hook %q, expected %s or %s", hook, HookExecutionAdmission, HookVersionActivation))
+		}
+	}
+	if p.FailureMode != FailOpen && p.FailureMode != FailClosed {
+		problems = append(problems, fmt.Sprintf("failure_mode must be %s or %s", FailOpen, FailClosed))
+	}
+	if p.TimeoutMS < 0 || time.Duration(p.TimeoutMS)*time.Millisecond > MaxTimeout {
+		problems = append(problems, fmt.Sprintf("timeout_ms must be between 0 and %d", MaxTimeout.Milliseconds()))
+	}
+	location, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("invalid time zone %q", p.TimeZone))
+	}
+	if len(p.Rules) == 0 {
+		problems = append(problems, "at least one rule is required")
+	}
+
+	compiled := &compiledPolicy{Policy: p, location: location}
+	for i, rule := range p.Rules {
+		if rule.Decision != DecisionDeny && rule.Decision != DecisionWarn {
+			problems = append(problems, fmt.Sprintf("rule %d: decision must be %s or %s", i+1, DecisionDeny, DecisionWarn))
+		}
+		condition, err := expressions.Parse(rule.When)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("rule %d: invalid condition: %v", i+1, err))
+			continue
+		}
+		compiled.rules = append(compiled.rules, compiledRule{Rule: rule, condition: condition})
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPolicy, strings.Join(problems, "; "))
+	}
+	return compiled, nil
+}
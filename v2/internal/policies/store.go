@@ -0,0 +1,304 @@
+package policies
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPolicyNotFound is returned for policies that do not exist
+	ErrPolicyNotFound = errors.New("policy not found")
+	// ErrDuplicatePolicy is returned when a policy name is already taken
+	ErrDuplicatePolicy = errors.New("policy name already exists")
+)
+
+// DecisionRecord is the audit entry of a policy that denied or warned about
+// a request, or could not be evaluated
+type DecisionRecord struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	PolicyID   uuid.UUID  `json:"policy_id" gorm:"type:uuid;index"`
+	PolicyName string     `json:"policy_name"`
+	Hook       Hook       `json:"hook" gorm:"index"`
+	Namespace  string     `json:"namespace"`
+	WorkflowID uuid.UUID  `json:"workflow_id" gorm:"type:uuid;index"`
+	VersionID  *uuid.UUID `json:"version_id,omitempty" gorm:"type:uuid"`
+	Decision   Decision   `json:"decision" gorm:"index"`
+	Reason     string     `json:"reason" gorm:"type:text"`
+	Error      string     `json:"error,omitempty" gorm:"type:text"`
+	// Actor is who made the request, when known
+	Actor       string    `json:"actor,omitempty"`
+	EvaluatedAt time.Time `json:"evaluated_at" gorm:"index"`
+}
+
+// TableName returns the table name for the DecisionRecord model
+func (DecisionRecord) TableName() string {
+	return "policy_decisions"
+}
+
+// DecisionFilter selects decision records. Zero fields match every record.
+type DecisionFilter struct {
+	PolicyID   *uuid.UUID
+	WorkflowID *uuid.UUID
+	Decision   Decision
+	// Limit caps the number of records, the most recent first
+	Limit int
+}
+
+func (f DecisionFilter) matches(record *DecisionRecord) bool {
+	return (f.PolicyID == nil || record.PolicyID == *f.PolicyID) &&
+		(f.WorkflowID == nil || record.WorkflowID == *f.WorkflowID) &&
+		(f.Decision == "" || record.Decision == f.Decision)
+}
+
+// Store persists policies and their decision records
+type Store interface {
+	Create(ctx context.Context, policy *Policy) error
+	Update(ctx context.Context, policy *Policy) error
+	Get(ctx context.Context, id uuid.UUID) (*Policy, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	// List returns every policy, ordered by name
+	List(ctx context.Context) ([]*Policy, error)
+	RecordDecision(ctx context.Context, record *DecisionRecord) error
+	// ListDecisions returns the matching decision records, the most recent
+	// first
+	ListDecisions(ctx context.Context, filter DecisionFilter) ([]*DecisionRecord, error)
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu        sync.RWMutex
+	policies  map[uuid.UUID]*Policy
+	decisions []*DecisionRecord
+}
+
+// NewMemoryStore creates an in-memory policy store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{policies: make(map[uuid.UUID]*Policy)}
+}
+
+// Create stores a new policy
+func (s *MemoryStore) Create(ctx context.Context, policy *Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTakenLocked(policy) {
+		return ErrDuplicatePolicy
+	}
+	stored := *policy
+	s.policies[policy.ID] = &stored
+	return nil
+}
+
+// Update replaces a policy
+func (s *MemoryStore) Update(ctx context.Context, policy *Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.policies[policy.ID]; !exists {
+		return ErrPolicyNotFound
+	}
+	if s.nameTakenLocked(policy) {
+		return ErrDuplicatePolicy
+	}
+	stored := *policy
+	s.policies[policy.ID] = &stored
+	return nil
+}
+
+func (s *MemoryStore) nameTakenLocked(policy *Policy) bool {
+	for id, existing := range s.policies {
+		if id != policy.ID && existing.Name == policy.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns a policy
+func (s *MemoryStore) Get(ctx context.Context, id uuid.UUID) (*Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policy, exists := s.policies[id]
+	if !exists {
+		return nil, ErrPolicyNotFound
+	}
+	stored := *policy
+	return &stored, nil
+}
+
+// Delete removes a policy
+func (s *MemoryStore) Delete(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.policies[id]; !exists {
+		return ErrPolicyNotFound
+	}
+	delete(s.policies, id)
+	return nil
+}
+
+// List returns every policy, ordered by name
+func (s *MemoryStore) List(ctx context.Context) ([]*Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policies := make([]*Policy, 0, len(s.policies))
+	for _, policy := range s.policies {
+		stored := *policy
+		policies = append(policies, &stored)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+	return policies, nil
+}
+
+// RecordDecision stores a decision record
+func (s *MemoryStore) RecordDecision(ctx context.Context, record *DecisionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.ID = uint(len(s.decisions) + 1)
+	stored := *record
+	s.decisions = append(s.decisions, &stored)
+	return nil
+}
+
+// ListDecisions returns the matching decision records, the most recent
+// first
+func (s *MemoryStore) ListDecisions(ctx context.Context, filter DecisionFilter) ([]*DecisionRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []*DecisionRecord
+	for i := len(s.decisions) - 1; i >= 0; i-- {
+		if !filter.matches(s.decisions[i]) {
+			continue
+		}
+		stored := *s.decisions[i]
+		records = append(records, &stored)
+		if filter.Limit > 0 && len(records) == filter.Limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+// GormStore is a database Store
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database policy store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the policy and decision tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Policy{}, &DecisionRecord{})
+}
+
+// Create stores a new policy
+func (s *GormStore) Create(ctx context.Context, policy *Policy) error {
+	err := s.db.WithContext(ctx).Create(policy).Error
+	if isUniqueViolation(err) {
+		return ErrDuplicatePolicy
+	}
+	return err
+}
+
+// Update replaces a policy
+func (s *GormStore) Update(ctx context.Context, policy *Policy) error {
+	result := s.db.WithContext(ctx).Model(&Policy{}).Where("id = ?", policy.ID).Select("*").Updates(policy)
+	if isUniqueViolation(result.Error) {
+		return ErrDuplicatePolicy
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPolicyNotFound
+	}
+	return nil
+}
+
+// Get returns a policy
+func (s *GormStore) Get(ctx context.Context, id uuid.UUID) (*Policy, error) {
+	var policy Policy
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPolicyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Delete removes a policy
+func (s *GormStore) Delete(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Where("id = ?", id).Delete(&Policy{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPolicyNotFound
+	}
+	return nil
+}
+
+// List returns every policy, ordered by name
+func (s *GormStore) List(ctx context.Context) ([]*Policy, error) {
+	var policies []*Policy
+	err := s.db.WithContext(ctx).Order("name").Find(&policies).Error
+	return policies, err
+}
+
+// RecordDecision stores a decision record
+func (s *GormStore) RecordDecision(ctx context.Context, record *DecisionRecord) error {
+	return s.db.WithContext(ctx).Create(record).Error
+}
+
+// ListDecisions returns the matching decision records, the most recent
+// first
+func (s *GormStore) ListDecisions(ctx context.Context, filter DecisionFilter) ([]*DecisionRecord, error) {
+	query := s.db.WithContext(ctx).Order("evaluated_at DESC, id DESC")
+	if filter.PolicyID != nil {
+		query = query.Where("policy_id = ?", *filter.PolicyID)
+	}
+	if filter.WorkflowID != nil {
+		query = query.Where("workflow_id = ?", *filter.WorkflowID)
+	}
+	if filter.Decision != "" {
+		query = query.Where("decision = ?", filter.Decision)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var records []*DecisionRecord
+	err := query.Find(&records).Error
+	return records, err
+}
+
+// isUniqueViolation reports whether a database error is a unique constraint
+// violation, which drivers report with different messages
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "unique") || strings.Contains(message, "duplicate")
+}
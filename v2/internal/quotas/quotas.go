@@ -0,0 +1,165 @@
+// Package quotas limits the executions each tenant may start per period,
+// so one tenant cannot use up the capacity shared by all. Tenants are the
+// namespaces of workflows. Each tenant has a token bucket refilled at the
+// rate of its limit and holding up to its burst, configured like the rate
+// limit of API requests.
+package quotas
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrQuotaExceeded is returned when a tenant has used up its execution
+// quota
+var ErrQuotaExceeded = errors.New("execution quota exceeded")
+
+// Limit is the execution quota of a tenant. A limit without executions is
+// unlimited.
+type Limit struct {
+	// Executions is the number of executions allowed per Period
+	Executions int
+	Period     time.Duration
+	// Burst is the number of executions that may start at once, Executions
+	// when zero
+	Burst int
+}
+
+func (l Limit) unlimited() bool {
+	return l.Executions <= 0 || l.Period <= 0
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Executions)
+}
+
+// rate returns the executions the bucket of the limit is refilled with per
+// second
+func (l Limit) rate() float64 {
+	return float64(l.Executions) / l.Period.Seconds()
+}
+
+// Config configures the quotas of tenants
+type Config struct {
+	// Default is the limit of tenants without their own
+	Default Limit
+	// Tenants maps tenants to their limit
+	Tenants map[string]Limit
+}
+
+// ExceededError is returned when an execution is rejected by the quota of
+// its tenant
+type ExceededError struct {
+	Tenant string
+	Limit  Limit
+	// RetryAfter is when the next execution of the tenant is allowed
+	RetryAfter time.Duration
+}
+
+// Error returns the error message
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("execution quota of tenant %s exceeded: %d executions per %s, retry after %s",
+		e.Tenant, e.Limit.Executions, e.Limit.Period, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap returns ErrQuotaExceeded
+func (e *ExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// bucket holds the executions a tenant may start
+type bucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens accrued since the last update
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(b.limit.capacity(), b.tokens+elapsed.Seconds()*b.limit.rate())
+		b.updated = now
+	}
+}
+
+// Limiter enforces the execution quotas of tenants
+type Limiter struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter creates a limiter enforcing the quotas of config
+func NewLimiter(config Config) *Limiter {
+	return &Limiter{
+		config:  config,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Tenant returns the tenant executions of a workflow count against, the
+// namespace of the workflow
+func Tenant(workflow *models.Workflow) string {
+	return policies.Namespace(workflow.Definition)
+}
+
+// limit returns the limit of a tenant
+func (l *Limiter) limit(tenant string) Limit {
+	if limit, ok := l.config.Tenants[tenant]; ok {
+		return limit
+	}
+	return l.config.Default
+}
+
+// bucketLocked returns the refilled bucket of a tenant, full when the
+// tenant starts its first execution
+func (l *Limiter) bucketLocked(tenant string, limit Limit, now time.Time) *bucket {
+	b, ok := l.buckets[tenant]
+	if !ok {
+		b = &bucket{limit: limit, tokens: limit.capacity(), updated: now}
+		l.buckets[tenant] = b
+	}
+	b.refill(now)
+	return b
+}
+
+// Take counts an execution against the quota of a tenant. It returns an
+// *ExceededError when the quota is used up, and the execution must not
+// start.
+func (l *Limiter) Take(tenant string) error {
+	limit := l.limit(tenant)
+	if limit.unlimited() {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucketLocked(tenant, limit, l.now())
+	if b.tokens < 1 {
+		return &ExceededError{
+			Tenant:     tenant,
+			Limit:      limit,
+			RetryAfter: time.Duration((1 - b.tokens) / limit.rate() * float64(time.Second)),
+		}
+	}
+	b.tokens--
+	return nil
+}
+
+// TakeWorkflow counts an execution of a workflow against the quota of its
+// tenant
+func (l *Limiter) TakeWorkflow(workflow *models.Workflow) error {
+	return l.Take(Tenant(workflow))
+}
@@ -0,0 +1,94 @@
+package quotas
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/scheduler"
+	"magic-flow/v2/pkg/models"
+)
+
+func newTestLimiter(config Config) (*Limiter, *scheduler.FakeClock) {
+	clock := scheduler.NewFakeClock(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	limiter := NewLimiter(config)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestTake(t *testing.T) {
+	config := Config{
+		Default: Limit{Executions: 3, Period: time.Minute},
+		Tenants: map[string]Limit{
+			"payments":  {Executions: 60, Period: time.Hour, Burst: 2},
+			"reporting": {},
+		},
+	}
+
+	t.Run("within quota", func(t *testing.T) {
+		limiter, _ := newTestLimiter(config)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, limiter.Take("default"))
+		}
+	})
+
+	t.Run("over quota", func(t *testing.T) {
+		limiter, clock := newTestLimiter(config)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, limiter.Take("default"))
+		}
+
+		err := limiter.Take("default")
+		assert.ErrorIs(t, err, ErrQuotaExceeded)
+		var exceeded *ExceededError
+		require.True(t, errors.As(err, &exceeded))
+		assert.Equal(t, "default", exceeded.Tenant)
+		assert.Equal(t, 20*time.Second, exceeded.RetryAfter)
+
+		// The bucket refills at 3 executions a minute
+		clock.Advance(19 * time.Second)
+		assert.ErrorIs(t, limiter.Take("default"), ErrQuotaExceeded)
+		clock.Advance(time.Second)
+		assert.NoError(t, limiter.Take("default"))
+		assert.ErrorIs(t, limiter.Take("default"), ErrQuotaExceeded)
+	})
+
+	t.Run("tenants have their own quota", func(t *testing.T) {
+		limiter, clock := newTestLimiter(config)
+		require.NoError(t, limiter.Take("payments"))
+		require.NoError(t, limiter.Take("payments"))
+		assert.ErrorIs(t, limiter.Take("payments"), ErrQuotaExceeded, "burst of 2")
+		assert.NoError(t, limiter.Take("shipping"), "other tenants are not limited by payments")
+
+		// Idle tenants accrue no more than their burst
+		clock.Advance(time.Hour)
+		require.NoError(t, limiter.Take("payments"))
+		require.NoError(t, limiter.Take("payments"))
+		assert.ErrorIs(t, limiter.Take("payments"), ErrQuotaExceeded)
+	})
+
+	t.Run("limits without executions are unlimited", func(t *testing.T) {
+		limiter, _ := newTestLimiter(config)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, limiter.Take("reporting"))
+		}
+
+		unlimited, _ := newTestLimiter(Config{})
+		assert.NoError(t, unlimited.Take("default"))
+	})
+}
+
+func TestTakeWorkflow(t *testing.T) {
+	limiter, _ := newTestLimiter(Config{Tenants: map[string]Limit{
+		"payments": {Executions: 1, Period: time.Minute},
+	}})
+	workflow := &models.Workflow{}
+	workflow.Definition.Metadata.Labels = map[string]string{"namespace": "payments"}
+
+	require.NoError(t, limiter.TakeWorkflow(workflow))
+	assert.ErrorIs(t, limiter.TakeWorkflow(workflow), ErrQuotaExceeded)
+	assert.NoError(t, limiter.TakeWorkflow(&models.Workflow{}), "workflows without namespace count against default")
+}
@@ -0,0 +1,138 @@
+// Package replay replays executions deterministically. A replayed execution
+// runs the current definition of its workflow against the input of an
+// original execution, but steps recorded by the original execution return
+// their recorded output, or fail with their recorded error, instead of
+// calling their executor. Changes to the logic of a workflow, such as its
+// conditions and data mappings, can so be validated against historical
+// executions without calling downstream services. Steps the original
+// execution did not run, such as steps added since, run for real.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrNotReplayable is returned for executions that cannot be replayed, such
+// as executions that have not finished
+var ErrNotReplayable = errors.New("execution cannot be replayed")
+
+// RecordedStep is the outcome of a step recorded by the original execution
+type RecordedStep struct {
+	Name   string
+	Output map[string]interface{}
+	// Error is the error the step failed with, empty for completed steps
+	Error string
+}
+
+// RecordedError is the error of a replayed step that failed in the original
+// execution
+type RecordedError struct {
+	Step    string
+	Message string
+}
+
+func (e *RecordedError) Error() string {
+	return fmt.Sprintf("recorded failure of step %s: %s", e.Step, e.Message)
+}
+
+// Result returns the recorded output of the step, or its recorded error.
+// The output is a copy, so replays cannot modify the recording.
+func (s *RecordedStep) Result() (map[string]interface{}, error) {
+	if s.Error != "" {
+		return nil, &RecordedError{Step: s.Name, Message: s.Error}
+	}
+	output := make(map[string]interface{}, len(s.Output))
+	for key, value := range s.Output {
+		output[key] = value
+	}
+	return output, nil
+}
+
+// Recording holds the step outcomes of an original execution
+type Recording struct {
+	ExecutionID uuid.UUID
+	// Flags are the feature flags the original execution evaluated, which
+	// the replay takes instead of evaluating them anew
+	Flags map[string]bool
+	steps map[string]*RecordedStep
+}
+
+// NewRecording creates the recording of an execution from its persisted
+// step executions. Steps attempted several times are recorded with their
+// last attempt, and steps that never finished are not recorded, so they run
+// for real.
+func NewRecording(executionID uuid.UUID, steps []*models.StepExecution) *Recording {
+	last := make(map[string]*models.StepExecution, len(steps))
+	for _, step := range steps {
+		if step.ExecutionID != executionID {
+			continue
+		}
+		if step.Status != models.StepStatusCompleted && step.Status != models.StepStatusFailed {
+			continue
+		}
+		if previous, ok := last[step.StepName]; ok && !laterAttempt(step, previous) {
+			continue
+		}
+		last[step.StepName] = step
+	}
+
+	recording := &Recording{ExecutionID: executionID, steps: make(map[string]*RecordedStep, len(last))}
+	for name, step := range last {
+		recorded := &RecordedStep{Name: name, Output: step.OutputData}
+		if step.Status == models.StepStatusFailed {
+			recorded.Error = step.Error
+			if recorded.Error == "" {
+				recorded.Error = "step failed"
+			}
+		}
+		recording.steps[name] = recorded
+	}
+	return recording
+}
+
+// laterAttempt reports whether step is a later attempt than previous
+func laterAttempt(step, previous *models.StepExecution) bool {
+	if step.Attempt != previous.Attempt {
+		return step.Attempt > previous.Attempt
+	}
+	return !step.CreatedAt.Before(previous.CreatedAt)
+}
+
+// Step returns the recorded outcome of a step. A nil recording records no
+// step.
+func (r *Recording) Step(name string) (*RecordedStep, bool) {
+	if r == nil {
+		return nil, false
+	}
+	step, ok := r.steps[name]
+	return step, ok
+}
+
+// Len returns the number of recorded steps
+func (r *Recording) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.steps)
+}
+
+type recordingKey struct{}
+
+// WithRecording returns a context replaying the steps of a recording.
+// Executions started with it are replays of the recorded execution.
+func WithRecording(ctx context.Context, recording *Recording) context.Context {
+	return context.WithValue(ctx, recordingKey{}, recording)
+}
+
+// FromContext returns the recording replayed by a context, nil when the
+// context does not replay an execution
+func FromContext(ctx context.Context) *Recording {
+	recording, _ := ctx.Value(recordingKey{}).(*Recording)
+	return recording
+}
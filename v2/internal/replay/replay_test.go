@@ -0,0 +1,86 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func TestNewRecording(t *testing.T) {
+	executionID := uuid.New()
+	created := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	step := func(name string, status models.StepStatus, attempt int, output map[string]interface{}, errMessage string) *models.StepExecution {
+		created = created.Add(time.Second)
+		return &models.StepExecution{
+			ExecutionID: executionID,
+			StepName:    name,
+			Status:      status,
+			Attempt:     attempt,
+			OutputData:  output,
+			Error:       errMessage,
+			CreatedAt:   created,
+		}
+	}
+
+	recording := NewRecording(executionID, []*models.StepExecution{
+		step("fetch-order", models.StepStatusCompleted, 1, map[string]interface{}{"total": 120.5, "currency": "EUR"}, ""),
+		step("charge", models.StepStatusFailed, 1, nil, "HTTP request failed with status 503"),
+		step("charge", models.StepStatusCompleted, 2, map[string]interface{}{"charge_id": "ch_1"}, ""),
+		step("notify", models.StepStatusFailed, 1, nil, "smtp timeout"),
+		step("ship", models.StepStatusRunning, 1, nil, ""),
+		// Steps of other executions are not recorded
+		{ExecutionID: uuid.New(), StepName: "audit", Status: models.StepStatusCompleted, Attempt: 1},
+	})
+	assert.Equal(t, executionID, recording.ExecutionID)
+	assert.Equal(t, 3, recording.Len())
+
+	fetch, ok := recording.Step("fetch-order")
+	require.True(t, ok)
+	output, err := fetch.Result()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"total": 120.5, "currency": "EUR"}, output)
+
+	// Replays may modify the output without modifying the recording
+	output["total"] = 0
+	output, err = fetch.Result()
+	require.NoError(t, err)
+	assert.Equal(t, 120.5, output["total"])
+
+	charge, ok := recording.Step("charge")
+	require.True(t, ok)
+	output, err = charge.Result()
+	require.NoError(t, err, "the last attempt is recorded")
+	assert.Equal(t, "ch_1", output["charge_id"])
+
+	notify, ok := recording.Step("notify")
+	require.True(t, ok)
+	_, err = notify.Result()
+	var recorded *RecordedError
+	require.True(t, errors.As(err, &recorded))
+	assert.Equal(t, "notify", recorded.Step)
+	assert.Equal(t, "smtp timeout", recorded.Message)
+
+	_, ok = recording.Step("ship")
+	assert.False(t, ok, "unfinished steps run for real")
+	_, ok = recording.Step("audit")
+	assert.False(t, ok)
+}
+
+func TestRecordingContext(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+
+	var none *Recording
+	_, ok := none.Step("charge")
+	assert.False(t, ok)
+	assert.Zero(t, none.Len())
+
+	recording := NewRecording(uuid.New(), nil)
+	assert.Same(t, recording, FromContext(WithRecording(context.Background(), recording)))
+}
@@ -0,0 +1,28 @@
+package reservations
+
+import (
+	"magic-flow/v2/internal/engine"
+)
+
+// EventHandler releases the reserved slots of executions when they end,
+// whether they completed, failed or were cancelled
+type EventHandler struct {
+	manager *Manager
+}
+
+// NewEventHandler creates an engine event handler for the reservation
+// manager
+func NewEventHandler(manager *Manager) *EventHandler {
+	return &EventHandler{manager: manager}
+}
+
+// Handle releases the reserved slot of the execution of a terminal event
+func (h *EventHandler) Handle(event *engine.WorkflowEvent) error {
+	h.manager.Finish(event.ExecutionID)
+	return nil
+}
+
+// GetEventTypes returns the event types handled
+func (h *EventHandler) GetEventTypes() []string {
+	return []string{"execution.completed", "execution.failed", "execution.cancelled"}
+}
@@ -0,0 +1,159 @@
+package reservations
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Handlers provides HTTP handlers for capacity reservations
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new reservation handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers reservation routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		reservations := v1.Group("/reservations")
+		{
+			reservations.POST("", h.CreateReservation)
+			reservations.GET("", h.ListReservations)
+			reservations.GET("/:id", h.GetReservation)
+			reservations.DELETE("/:id", h.CancelReservation)
+		}
+	}
+}
+
+// CreateRequest is the request body of a reservation
+type CreateRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Namespace  string     `json:"namespace"`
+	WorkflowID *uuid.UUID `json:"workflow_id"`
+	StartsAt   time.Time  `json:"starts_at" binding:"required"`
+	EndsAt     time.Time  `json:"ends_at" binding:"required"`
+	Slots      int        `json:"slots" binding:"required"`
+	Executions int        `json:"executions" binding:"required"`
+}
+
+// CreateReservation reserves capacity for a burst of executions
+// @Summary Create capacity reservation
+// @Description Reserves concurrent execution slots for the executions of a namespace or workflow during a window, up to a number of executions. Reservations exceeding the reservable capacity with those they overlap are rejected with the overlapping reservations.
+// @Tags reservations
+// @Accept json
+// @Produce json
+// @Param request body CreateRequest true "Reservation"
+// @Success 201 {object} Reservation
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/reservations [post]
+func (h *Handlers) CreateReservation(c *gin.Context) {
+	var req CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reservation, err := h.manager.Create(c.Request.Context(), &Reservation{
+		Name:       req.Name,
+		Namespace:  req.Namespace,
+		WorkflowID: req.WorkflowID,
+		StartsAt:   req.StartsAt,
+		EndsAt:     req.EndsAt,
+		Slots:      req.Slots,
+		Executions: req.Executions,
+	}, c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, reservation)
+}
+
+// ListReservations returns the reservations with their live utilization
+// @Summary List capacity reservations
+// @Tags reservations
+// @Produce json
+// @Success 200 {array} Status
+// @Router /api/v1/reservations [get]
+func (h *Handlers) ListReservations(c *gin.Context) {
+	statuses, err := h.manager.List(c.Request.Context())
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statuses)
+}
+
+// GetReservation returns a reservation with its live utilization
+// @Summary Get capacity reservation
+// @Tags reservations
+// @Produce json
+// @Param id path string true "Reservation ID"
+// @Success 200 {object} Status
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/reservations/{id} [get]
+func (h *Handlers) GetReservation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reservation ID"})
+		return
+	}
+
+	status, err := h.manager.Get(c.Request.Context(), id)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// CancelReservation deletes a reservation, releasing its slots
+// @Summary Cancel capacity reservation
+// @Tags reservations
+// @Param id path string true "Reservation ID"
+// @Success 204
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/reservations/{id} [delete]
+func (h *Handlers) CancelReservation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reservation ID"})
+		return
+	}
+
+	if err := h.manager.Cancel(c.Request.Context(), id, c.GetHeader("X-User-ID")); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handlers) errorResponse(c *gin.Context, err error) {
+	var capacity *CapacityError
+	switch {
+	case errors.As(err, &capacity):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "capacity": capacity})
+	case errors.Is(err, ErrInvalidReservation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "reservation not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
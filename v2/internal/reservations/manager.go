@@ -0,0 +1,371 @@
+package reservations
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/admission"
+	"magic-flow/v2/pkg/models"
+)
+
+// Capacity reports the maximum number of concurrent executions, which
+// reservations are validated against. The engine implements it.
+type Capacity interface {
+	Capacity() int
+}
+
+// usage is the live usage of a reservation
+type usage struct {
+	admitted int
+	// running are the executions in reserved slots
+	running        map[uuid.UUID]bool
+	lastAdmittedAt time.Time
+}
+
+// Manager creates reservations and tracks their usage. It is the
+// reservation source of admission, which it tells which reservation an
+// execution draws on and how many slots reservations keep free. The usage
+// of reservations is tracked in memory by the node admitting executions.
+type Manager struct {
+	config   Config
+	store    Store
+	capacity Capacity
+	logger   *logrus.Logger
+	now      func() time.Time
+
+	// createMu serializes creations, so that concurrent reservations are
+	// checked against each other
+	createMu sync.Mutex
+
+	mu    sync.Mutex
+	usage map[uuid.UUID]*usage
+}
+
+// NewManager creates a reservation manager validating reservations against
+// the capacity
+func NewManager(config Config, store Store, capacity Capacity, logger *logrus.Logger) *Manager {
+	return &Manager{
+		config:   config,
+		store:    store,
+		capacity: capacity,
+		logger:   logger,
+		now:      time.Now,
+		usage:    make(map[uuid.UUID]*usage),
+	}
+}
+
+// Create validates and stores a reservation, assigning its ID and token.
+// Reservations that would hold, with the reservations they overlap, more
+// than the reservable share of the capacity at any time of their window are
+// rejected with a CapacityError.
+func (m *Manager) Create(ctx context.Context, reservation *Reservation, actor string) (*Reservation, error) {
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+
+	now := m.now().UTC()
+	if err := reservation.validate(now); err != nil {
+		return nil, err
+	}
+	reservation.StartsAt = reservation.StartsAt.UTC()
+	reservation.EndsAt = reservation.EndsAt.UTC()
+	if err := m.checkCapacity(ctx, reservation); err != nil {
+		return nil, err
+	}
+
+	reservation.ID = uuid.New()
+	reservation.Token = newToken()
+	reservation.CreatedBy = actor
+	reservation.CreatedAt = now
+	if err := m.store.Create(ctx, reservation); err != nil {
+		return nil, err
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"reservation_id": reservation.ID,
+		"reservation":    reservation.Name,
+		"scope":          reservation.Scope(),
+		"starts_at":      reservation.StartsAt,
+		"ends_at":        reservation.EndsAt,
+		"slots":          reservation.Slots,
+		"executions":     reservation.Executions,
+		"actor":          actor,
+	}).Info("Capacity reservation created")
+	return reservation, nil
+}
+
+// checkCapacity checks that the reservation fits in the reservable share of
+// the capacity next to the reservations it overlaps. The reserved slots
+// peak when a reservation starts, so only those times are checked.
+func (m *Manager) checkCapacity(ctx context.Context, reservation *Reservation) error {
+	capacity := m.capacity.Capacity()
+	if capacity <= 0 {
+		return nil
+	}
+	limit := int(float64(capacity) * m.config.MaxReservedShare)
+	if reservation.Slots > limit {
+		return &CapacityError{Requested: reservation.Slots, Limit: limit, Capacity: capacity, At: reservation.StartsAt}
+	}
+
+	overlapping, err := m.store.Overlapping(ctx, reservation.StartsAt, reservation.EndsAt)
+	if err != nil {
+		return err
+	}
+	starts := []time.Time{reservation.StartsAt}
+	for _, other := range overlapping {
+		if other.StartsAt.After(reservation.StartsAt) {
+			starts = append(starts, other.StartsAt)
+		}
+	}
+	for _, at := range starts {
+		var holding []*Reservation
+		reserved := 0
+		for _, other := range overlapping {
+			if other.ActiveAt(at) {
+				holding = append(holding, other)
+				reserved += other.Slots
+			}
+		}
+		if reserved+reservation.Slots > limit {
+			return &CapacityError{
+				Requested:   reservation.Slots,
+				Reserved:    reserved,
+				Limit:       limit,
+				Capacity:    capacity,
+				At:          at,
+				Overlapping: holding,
+			}
+		}
+	}
+	return nil
+}
+
+// Cancel deletes a reservation, releasing its slots
+func (m *Manager) Cancel(ctx context.Context, id uuid.UUID, actor string) error {
+	if err := m.store.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.usage, id)
+	m.mu.Unlock()
+
+	m.logger.WithFields(logrus.Fields{
+		"reservation_id": id,
+		"actor":          actor,
+	}).Info("Capacity reservation cancelled")
+	return nil
+}
+
+// Get returns a reservation with its live utilization
+func (m *Manager) Get(ctx context.Context, id uuid.UUID) (*Status, error) {
+	reservation, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.statusLocked(reservation, m.now()), nil
+}
+
+// List returns every reservation with its live utilization
+func (m *Manager) List(ctx context.Context) ([]*Status, error) {
+	reservations, err := m.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.statuses(reservations, m.now()), nil
+}
+
+// Active returns the reservations active now with their live utilization
+func (m *Manager) Active(ctx context.Context) ([]*Status, error) {
+	now := m.now()
+	reservations, err := m.store.Active(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	return m.statuses(reservations, now), nil
+}
+
+func (m *Manager) statuses(reservations []*Reservation, at time.Time) []*Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]*Status, len(reservations))
+	for i, reservation := range reservations {
+		statuses[i] = m.statusLocked(reservation, at)
+	}
+	return statuses
+}
+
+// Match returns the reservation active at a time an execution of the
+// workflow draws on. A token selects the reservation with the token;
+// otherwise reservations of the workflow are preferred to those of its
+// namespace, then those with the most free slots. Reservations that
+// admitted all their executions are not drawn on.
+func (m *Manager) Match(ctx context.Context, workflow *models.Workflow, token string, at time.Time) (*admission.Reservation, error) {
+	active, err := m.store.Active(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var match *admission.Reservation
+	matchWorkflow := false
+	for _, reservation := range active {
+		if !reservation.Covers(workflow) || (token != "" && reservation.Token != token) {
+			continue
+		}
+		status := m.statusLocked(reservation, at)
+		if status.RemainingExecutions <= 0 {
+			continue
+		}
+
+		ofWorkflow := reservation.WorkflowID != nil
+		if match == nil || (ofWorkflow && !matchWorkflow) || (ofWorkflow == matchWorkflow && status.FreeSlots > match.FreeSlots) {
+			match = &admission.Reservation{
+				ID:                  reservation.ID,
+				Name:                reservation.Name,
+				FreeSlots:           status.FreeSlots,
+				RemainingExecutions: status.RemainingExecutions,
+			}
+			matchWorkflow = ofWorkflow
+		}
+	}
+	return match, nil
+}
+
+// Held returns the number of free slots the reservations active at a time
+// keep for their executions
+func (m *Manager) Held(ctx context.Context, at time.Time) (int, error) {
+	active, err := m.store.Active(ctx, at)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	held := 0
+	for _, reservation := range active {
+		held += m.statusLocked(reservation, at).FreeSlots
+	}
+	return held, nil
+}
+
+// Claim counts an admitted execution against a reservation. The execution
+// takes a free reserved slot, when one is left, until Finish is called for
+// it; executions past the free slots compete for unreserved capacity.
+func (m *Manager) Claim(ctx context.Context, reservationID, executionID uuid.UUID, at time.Time) error {
+	reservation, err := m.store.Get(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	free := m.statusLocked(reservation, at).FreeSlots
+	u := m.usageLocked(reservationID)
+	u.admitted++
+	u.lastAdmittedAt = at
+	if free > 0 && executionID != uuid.Nil {
+		u.running[executionID] = true
+	}
+	return nil
+}
+
+// Finish releases the reserved slot of an execution that ended
+func (m *Manager) Finish(executionID uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.usage {
+		delete(u.running, executionID)
+	}
+}
+
+func (m *Manager) usageLocked(id uuid.UUID) *usage {
+	u, ok := m.usage[id]
+	if !ok {
+		u = &usage{running: make(map[uuid.UUID]bool)}
+		m.usage[id] = u
+	}
+	return u
+}
+
+// statusLocked returns the utilization of a reservation at a time
+func (m *Manager) statusLocked(reservation *Reservation, at time.Time) *Status {
+	u, ok := m.usage[reservation.ID]
+	if !ok {
+		u = &usage{}
+	}
+
+	status := &Status{
+		Reservation:         reservation,
+		SlotsInUse:          len(u.running),
+		Admitted:            u.admitted,
+		RemainingExecutions: reservation.Executions - u.admitted,
+		Utilization:         float64(len(u.running)) / float64(reservation.Slots),
+	}
+	if status.RemainingExecutions < 0 {
+		status.RemainingExecutions = 0
+	}
+	if !u.lastAdmittedAt.IsZero() {
+		lastAdmittedAt := u.lastAdmittedAt
+		status.LastAdmittedAt = &lastAdmittedAt
+	}
+
+	switch {
+	case at.Before(reservation.StartsAt):
+		status.Phase = PhaseScheduled
+		return status
+	case !reservation.ActiveAt(at):
+		status.Phase = PhaseEnded
+		return status
+	case status.RemainingExecutions == 0:
+		status.Phase = PhaseExhausted
+		status.ReservedSlots = status.SlotsInUse
+		return status
+	}
+
+	reserved := m.reservedSlots(reservation, u.lastAdmittedAt, at)
+	status.Phase = PhaseHolding
+	if reserved < reservation.Slots {
+		status.Phase = PhaseReleasing
+	}
+	status.ReservedSlots = reserved
+	if status.SlotsInUse > reserved {
+		status.ReservedSlots = status.SlotsInUse
+	}
+	status.FreeSlots = status.ReservedSlots - status.SlotsInUse
+	return status
+}
+
+// reservedSlots returns the number of slots an active reservation holds at a
+// time. A reservation holds all its slots for the grace period from the
+// start of its window or the last execution it admitted, then releases
+// them a share at a time over the release period.
+func (m *Manager) reservedSlots(reservation *Reservation, lastAdmittedAt, at time.Time) int {
+	idleSince := reservation.StartsAt
+	if lastAdmittedAt.After(idleSince) {
+		idleSince = lastAdmittedAt
+	}
+
+	releasing := at.Sub(idleSince) - m.config.GracePeriod
+	switch {
+	case releasing < 0:
+		return reservation.Slots
+	case releasing >= m.config.ReleasePeriod:
+		return 0
+	}
+	left := float64(m.config.ReleasePeriod-releasing) / float64(m.config.ReleasePeriod)
+	return int(math.Ceil(float64(reservation.Slots) * left))
+}
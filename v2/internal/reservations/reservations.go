@@ -0,0 +1,188 @@
+// Package reservations sets execution capacity aside for known bursts of
+// executions, such as a campaign submitting thousands of executions in a
+// few minutes. A reservation holds concurrent slots for the executions of a
+// namespace or workflow during a time window, up to a number of executions.
+// During the window admission keeps the free reserved slots from unreserved
+// executions, which queue instead, and admits matching executions past
+// their quota. Slots the reservation leaves unused for a grace period are
+// released gradually to everything else.
+package reservations
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrInvalidReservation is returned for reservations without a name, a
+// scope, a window, slots or executions
+var ErrInvalidReservation = errors.New("invalid reservation")
+
+// Reservation holds execution capacity for the executions of a namespace or
+// a workflow during a time window
+type Reservation struct {
+	ID   uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Name string    `json:"name" gorm:"not null"`
+	// Namespace or WorkflowID scope the executions drawing on the
+	// reservation. Exactly one of them is set.
+	Namespace  string     `json:"namespace,omitempty" gorm:"index"`
+	WorkflowID *uuid.UUID `json:"workflow_id,omitempty" gorm:"type:uuid;index"`
+	// Token selects the reservation when passed with an execution request,
+	// among the reservations of the workflow
+	Token    string    `json:"token" gorm:"not null;uniqueIndex"`
+	StartsAt time.Time `json:"starts_at" gorm:"not null;index"`
+	EndsAt   time.Time `json:"ends_at" gorm:"not null;index"`
+	// Slots is the number of concurrent executions reserved
+	Slots int `json:"slots" gorm:"not null"`
+	// Executions is the number of executions the reservation admits
+	Executions int       `json:"executions" gorm:"not null"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the Reservation model
+func (Reservation) TableName() string {
+	return "capacity_reservations"
+}
+
+// ActiveAt reports whether the window of the reservation contains a time
+func (r *Reservation) ActiveAt(at time.Time) bool {
+	return !at.Before(r.StartsAt) && at.Before(r.EndsAt)
+}
+
+// Scope describes the executions drawing on the reservation
+func (r *Reservation) Scope() string {
+	if r.WorkflowID != nil {
+		return "workflow " + r.WorkflowID.String()
+	}
+	return "namespace " + r.Namespace
+}
+
+// Covers reports whether executions of a workflow may draw on the
+// reservation
+func (r *Reservation) Covers(workflow *models.Workflow) bool {
+	if r.WorkflowID != nil {
+		return *r.WorkflowID == workflow.ID
+	}
+	return r.Namespace == policies.Namespace(workflow.Definition)
+}
+
+// validate checks the fields of a new reservation
+func (r *Reservation) validate(now time.Time) error {
+	switch {
+	case strings.TrimSpace(r.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidReservation)
+	case r.Namespace == "" && r.WorkflowID == nil:
+		return fmt.Errorf("%w: a namespace or a workflow is required", ErrInvalidReservation)
+	case r.Namespace != "" && r.WorkflowID != nil:
+		return fmt.Errorf("%w: a reservation is either for a namespace or for a workflow", ErrInvalidReservation)
+	case !r.EndsAt.After(r.StartsAt):
+		return fmt.Errorf("%w: the window must end after it starts", ErrInvalidReservation)
+	case !r.EndsAt.After(now):
+		return fmt.Errorf("%w: the window has already ended", ErrInvalidReservation)
+	case r.Slots <= 0:
+		return fmt.Errorf("%w: slots must be positive", ErrInvalidReservation)
+	case r.Executions <= 0:
+		return fmt.Errorf("%w: executions must be positive", ErrInvalidReservation)
+	}
+	return nil
+}
+
+// Phase is where a reservation stands in its window
+type Phase string
+
+const (
+	// PhaseScheduled means the window has not started
+	PhaseScheduled Phase = "scheduled"
+	// PhaseHolding means the reservation holds all its slots
+	PhaseHolding Phase = "holding"
+	// PhaseReleasing means the reservation is releasing the slots it left
+	// unused for the grace period
+	PhaseReleasing Phase = "releasing"
+	// PhaseExhausted means the reservation admitted all its executions
+	PhaseExhausted Phase = "exhausted"
+	// PhaseEnded means the window has ended
+	PhaseEnded Phase = "ended"
+)
+
+// Status is a reservation with its live utilization
+type Status struct {
+	*Reservation
+	Phase Phase `json:"phase"`
+	// ReservedSlots is the number of slots the reservation holds now,
+	// lower than its slots once it releases unused slots
+	ReservedSlots int `json:"reserved_slots"`
+	// SlotsInUse is the number of running executions in reserved slots
+	SlotsInUse int `json:"slots_in_use"`
+	// FreeSlots is the number of reserved slots kept free for executions
+	// of the reservation, which unreserved executions cannot use
+	FreeSlots           int `json:"free_slots"`
+	Admitted            int `json:"admitted"`
+	RemainingExecutions int `json:"remaining_executions"`
+	// Utilization is the share of the slots of the reservation in use
+	Utilization float64 `json:"utilization"`
+	// LastAdmittedAt is when the reservation last admitted an execution
+	LastAdmittedAt *time.Time `json:"last_admitted_at,omitempty"`
+}
+
+// CapacityError is returned when a reservation, with the reservations it
+// overlaps, would reserve more slots than may be reserved
+type CapacityError struct {
+	// Requested is the number of slots of the rejected reservation
+	Requested int `json:"requested"`
+	// Reserved is the number of slots the overlapping reservations hold
+	// at At
+	Reserved int `json:"reserved"`
+	// Limit is the number of slots that may be reserved at once, the
+	// reservable share of the capacity
+	Limit    int       `json:"limit"`
+	Capacity int       `json:"capacity"`
+	At       time.Time `json:"at"`
+	// Overlapping are the reservations holding slots at At
+	Overlapping []*Reservation `json:"overlapping"`
+}
+
+func (e *CapacityError) Error() string {
+	if len(e.Overlapping) == 0 {
+		return fmt.Sprintf("reservation of %d slots exceeds the %d reservable slots (capacity %d)", e.Requested, e.Limit, e.Capacity)
+	}
+	names := make([]string, len(e.Overlapping))
+	for i, reservation := range e.Overlapping {
+		names[i] = reservation.Name
+	}
+	return fmt.Sprintf("reservation of %d slots exceeds capacity at %s: overlapping reservations %s hold %d of the %d reservable slots (capacity %d)",
+		e.Requested, e.At.UTC().Format(time.RFC3339), strings.Join(names, ", "), e.Reserved, e.Limit, e.Capacity)
+}
+
+// Config contains the reservation settings
+type Config struct {
+	// GracePeriod is how long a reservation holds slots it leaves unused,
+	// from the start of its window or the last execution it admitted
+	GracePeriod time.Duration
+	// ReleasePeriod is how long releasing the unused slots takes once the
+	// grace period is over. The slots are released a share at a time.
+	ReleasePeriod time.Duration
+	// MaxReservedShare bounds the share of the capacity reservations may
+	// hold at once, so that unreserved executions are not starved
+	MaxReservedShare float64
+}
+
+// DefaultConfig returns the default reservation settings
+func DefaultConfig() Config {
+	return Config{
+		GracePeriod:      2 * time.Minute,
+		ReleasePeriod:    10 * time.Minute,
+		MaxReservedShare: 0.8,
+	}
+}
+
+// newToken returns a new reservation token
+func newToken() string {
+	return "rsv_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
@@ -0,0 +1,384 @@
+package reservations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/admission"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+type fakeEngine struct {
+	running  int
+	capacity int
+}
+
+func (e *fakeEngine) Accepting() bool        { return true }
+func (e *fakeEngine) RunningExecutions() int { return e.running }
+func (e *fakeEngine) Capacity() int          { return e.capacity }
+func (e *fakeEngine) StepTypes() []string    { return []string{"http"} }
+
+// campaignQuotas reports the quota of the marketing namespace exhausted
+type campaignQuotas struct{}
+
+func (campaignQuotas) RemainingExecutions(ctx context.Context, workflow *models.Workflow) (int, bool, error) {
+	if policies.Namespace(workflow.Definition) == "marketing" {
+		return 0, true, nil
+	}
+	return 100, true, nil
+}
+
+var nineAM = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func newTestManager(engine *fakeEngine) *Manager {
+	return NewManager(DefaultConfig(), NewMemoryStore(), engine, logrus.New())
+}
+
+// newTestChecker returns an admission checker of executions on engine,
+// drawing on the reservations of manager
+func newTestChecker(manager *Manager, engine *fakeEngine) *admission.AdmissionChecker {
+	return admission.NewAdmissionChecker(admission.DefaultConfig(), admission.Sources{
+		Engine:       engine,
+		Quotas:       campaignQuotas{},
+		Reservations: manager,
+	})
+}
+
+func reserve(t *testing.T, manager *Manager, reservation *Reservation) *Reservation {
+	t.Helper()
+	created, err := manager.Create(context.Background(), reservation, "marketing-ops")
+	require.NoError(t, err)
+	return created
+}
+
+// admit admits an execution, which starts on engine unless it would queue
+func admit(t *testing.T, checker *admission.AdmissionChecker, engine *fakeEngine, workflow *models.Workflow, token string) (*admission.Report, uuid.UUID) {
+	t.Helper()
+	executionID := uuid.New()
+	report, err := checker.Admit(context.Background(), &admission.Request{
+		Workflow:    workflow,
+		Input:       map[string]interface{}{},
+		Options:     admission.Options{ReservationToken: token},
+		ExecutionID: executionID,
+	})
+	require.NoError(t, err)
+	if report.Verdict == admission.VerdictOK {
+		engine.running++
+	}
+	return report, executionID
+}
+
+func preflight(checker *admission.AdmissionChecker, workflow *models.Workflow) *admission.Report {
+	return checker.Preflight(context.Background(), &admission.Request{Workflow: workflow, Input: map[string]interface{}{}})
+}
+
+func newWorkflow(name, namespace string) *models.Workflow {
+	workflow := &models.Workflow{ID: uuid.New(), Name: name, Version: "1.0.0", Status: models.WorkflowStatusActive}
+	workflow.Definition.Metadata.Labels = map[string]string{"namespace": namespace}
+	workflow.Definition.Spec.Steps = []models.WorkflowStep{{Name: "send", Type: "http"}}
+	return workflow
+}
+
+func capacityReason(t *testing.T, report *admission.Report) string {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.Name == "capacity" {
+			return check.Reason
+		}
+	}
+	t.Fatal("report has no capacity check")
+	return ""
+}
+
+func TestInvalidReservations(t *testing.T) {
+	workflowID := uuid.New()
+	tests := map[string]*Reservation{
+		"unnamed":       {Namespace: "marketing", StartsAt: nineAM, EndsAt: nineAM.Add(time.Hour), Slots: 1, Executions: 1},
+		"unscoped":      {Name: "unscoped", StartsAt: nineAM, EndsAt: nineAM.Add(time.Hour), Slots: 1, Executions: 1},
+		"both scopes":   {Name: "both", Namespace: "marketing", WorkflowID: &workflowID, StartsAt: nineAM, EndsAt: nineAM.Add(time.Hour), Slots: 1, Executions: 1},
+		"backwards":     {Name: "backwards", Namespace: "marketing", StartsAt: nineAM, EndsAt: nineAM, Slots: 1, Executions: 1},
+		"past":          {Name: "past", Namespace: "marketing", StartsAt: nineAM.Add(-3 * time.Hour), EndsAt: nineAM.Add(-2 * time.Hour), Slots: 1, Executions: 1},
+		"no slots":      {Name: "no slots", Namespace: "marketing", StartsAt: nineAM, EndsAt: nineAM.Add(time.Hour), Executions: 1},
+		"no executions": {Name: "no executions", Namespace: "marketing", StartsAt: nineAM, EndsAt: nineAM.Add(time.Hour), Slots: 1},
+	}
+
+	for name, reservation := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager := newTestManager(&fakeEngine{capacity: 10})
+			manager.now = func() time.Time { return nineAM.Add(-time.Hour) }
+			_, err := manager.Create(context.Background(), reservation, "ops")
+			assert.ErrorIs(t, err, ErrInvalidReservation)
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	manager := newTestManager(&fakeEngine{capacity: 10})
+	manager.now = func() time.Time { return nineAM.Add(-time.Hour) }
+	ctx := context.Background()
+	workflowID := uuid.New()
+
+	// With a capacity of 10, reservations may hold 8 slots at once
+	a := reserve(t, manager, &Reservation{Name: "campaign-a", Namespace: "marketing", StartsAt: nineAM, EndsAt: nineAM.Add(30 * time.Minute), Slots: 5, Executions: 100})
+	assert.NotEqual(t, uuid.Nil, a.ID)
+	assert.Regexp(t, `^rsv_[0-9a-f]{32}$`, a.Token)
+	assert.Equal(t, "marketing-ops", a.CreatedBy)
+	b := reserve(t, manager, &Reservation{Name: "campaign-b", WorkflowID: &workflowID, StartsAt: nineAM.Add(20 * time.Minute), EndsAt: nineAM.Add(time.Hour), Slots: 3, Executions: 100})
+
+	_, err := manager.Create(ctx, &Reservation{Name: "campaign-c", Namespace: "marketing", StartsAt: nineAM.Add(10 * time.Minute), EndsAt: nineAM.Add(25 * time.Minute), Slots: 1, Executions: 10}, "ops")
+	var capacity *CapacityError
+	require.ErrorAs(t, err, &capacity)
+	assert.Equal(t, 1, capacity.Requested)
+	assert.Equal(t, 8, capacity.Reserved)
+	assert.Equal(t, 8, capacity.Limit)
+	assert.Equal(t, 10, capacity.Capacity)
+	assert.Equal(t, nineAM.Add(20*time.Minute), capacity.At, "the slots peak when campaign-b starts")
+	require.Len(t, capacity.Overlapping, 2)
+	assert.Equal(t, a.ID, capacity.Overlapping[0].ID)
+	assert.Equal(t, b.ID, capacity.Overlapping[1].ID)
+	assert.Equal(t, "reservation of 1 slots exceeds capacity at 2024-03-01T09:20:00Z: overlapping reservations campaign-a, campaign-b hold 8 of the 8 reservable slots (capacity 10)", err.Error())
+
+	// campaign-a ends when campaign-d starts
+	reserve(t, manager, &Reservation{Name: "campaign-d", Namespace: "marketing", StartsAt: nineAM.Add(30 * time.Minute), EndsAt: nineAM.Add(time.Hour), Slots: 5, Executions: 100})
+
+	_, err = manager.Create(ctx, &Reservation{Name: "everything", Namespace: "sales", StartsAt: nineAM.Add(2 * time.Hour), EndsAt: nineAM.Add(3 * time.Hour), Slots: 9, Executions: 10}, "ops")
+	require.ErrorAs(t, err, &capacity)
+	assert.Empty(t, capacity.Overlapping)
+	assert.Equal(t, "reservation of 9 slots exceeds the 8 reservable slots (capacity 10)", err.Error())
+
+	statuses, err := manager.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, PhaseScheduled, statuses[0].Phase)
+	assert.Zero(t, statuses[0].ReservedSlots)
+}
+
+// TestContention runs a campaign reserving 4 of 10 slots while 6 unreserved
+// executions run. The quota of the campaign is exhausted.
+func TestContention(t *testing.T) {
+	engine := &fakeEngine{capacity: 10}
+	manager := newTestManager(engine)
+	checker := newTestChecker(manager, engine)
+	ctx := context.Background()
+	now := time.Now()
+	reservation := reserve(t, manager, &Reservation{Name: "spring-campaign", Namespace: "marketing", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour), Slots: 4, Executions: 5})
+	campaign := newWorkflow("newsletter", "marketing")
+	orders := newWorkflow("orders", "sales")
+	engine.running = 6
+
+	report := preflight(checker, orders)
+	assert.Equal(t, admission.VerdictWouldQueue, report.Verdict, "unreserved traffic queues behind the reserved slots")
+	assert.Nil(t, report.Reservation)
+	assert.Equal(t, 4, report.ReservedSlots)
+	assert.Equal(t, "all 10 execution slots in use or reserved (4 reserved), 1 executions ahead", capacityReason(t, report))
+
+	var executions []uuid.UUID
+	for i := 0; i < 4; i++ {
+		report, executionID := admit(t, checker, engine, campaign, "")
+		require.Equal(t, admission.VerdictOK, report.Verdict, "reserved execution %d starts: %v", i, report.Checks)
+		require.NotNil(t, report.Reservation)
+		assert.Equal(t, reservation.ID, report.Reservation.ID)
+		executions = append(executions, executionID)
+	}
+	assert.Equal(t, 10, engine.running)
+
+	status, err := manager.Get(ctx, reservation.ID)
+	require.NoError(t, err)
+	assert.Equal(t, PhaseHolding, status.Phase)
+	assert.Equal(t, 4, status.SlotsInUse)
+	assert.Zero(t, status.FreeSlots)
+	assert.Equal(t, 4, status.Admitted)
+	assert.Equal(t, 1, status.RemainingExecutions)
+	assert.Equal(t, 1.0, status.Utilization)
+
+	report = checker.Preflight(ctx, &admission.Request{Workflow: campaign, Input: map[string]interface{}{}, Options: admission.Options{ReservationToken: reservation.Token}})
+	assert.Equal(t, admission.VerdictWouldQueue, report.Verdict, "past its slots the campaign competes for unreserved capacity")
+	require.NotNil(t, report.Reservation)
+	assert.Zero(t, report.Reservation.FreeSlots)
+
+	// A reserved execution ends, freeing its slot for the campaign only
+	manager.Finish(executions[0])
+	engine.running--
+	assert.Equal(t, admission.VerdictWouldQueue, preflight(checker, orders).Verdict)
+
+	report, _ = admit(t, checker, engine, campaign, reservation.Token)
+	assert.Equal(t, admission.VerdictOK, report.Verdict)
+	assert.Equal(t, "reserved slot of reservation spring-campaign, 9 of 10 execution slots in use", capacityReason(t, report))
+
+	// The campaign admitted all its executions; the next one is limited by
+	// the quota again
+	_, err = checker.Admit(ctx, &admission.Request{Workflow: campaign, Input: map[string]interface{}{}, ExecutionID: uuid.New()})
+	assert.ErrorIs(t, err, admission.ErrRejected)
+	assert.Contains(t, err.Error(), "quota: execution quota exhausted")
+
+	status, err = manager.Get(ctx, reservation.ID)
+	require.NoError(t, err)
+	assert.Equal(t, PhaseExhausted, status.Phase)
+	assert.Equal(t, 5, status.Admitted)
+	assert.Equal(t, 4, status.ReservedSlots, "running executions keep their slots")
+
+	for _, executionID := range executions[1:] {
+		manager.Finish(executionID)
+		engine.running--
+	}
+	report = preflight(checker, orders)
+	assert.Equal(t, admission.VerdictOK, report.Verdict, "an exhausted reservation holds no free slots")
+	assert.Zero(t, report.ReservedSlots)
+}
+
+func TestRelease(t *testing.T) {
+	engine := &fakeEngine{capacity: 10}
+	manager := newTestManager(engine)
+	clock := nineAM.Add(-time.Hour)
+	manager.now = func() time.Time { return clock }
+	ctx := context.Background()
+	reservation := reserve(t, manager, &Reservation{Name: "spring-campaign", Namespace: "marketing", StartsAt: nineAM, EndsAt: nineAM.Add(30 * time.Minute), Slots: 4, Executions: 100})
+
+	held := func(at time.Duration) int {
+		t.Helper()
+		held, err := manager.Held(ctx, nineAM.Add(at))
+		require.NoError(t, err)
+		return held
+	}
+	phase := func(at time.Duration) Phase {
+		t.Helper()
+		clock = nineAM.Add(at)
+		status, err := manager.Get(ctx, reservation.ID)
+		require.NoError(t, err)
+		return status.Phase
+	}
+
+	assert.Zero(t, held(-time.Minute))
+	assert.Equal(t, PhaseScheduled, phase(-time.Minute))
+	assert.Equal(t, 4, held(time.Minute))
+	assert.Equal(t, 4, held(2*time.Minute), "unused slots are held for the grace period")
+	assert.Equal(t, PhaseHolding, phase(2*time.Minute))
+	assert.Equal(t, 3, held(4*time.Minute+30*time.Second))
+	assert.Equal(t, PhaseReleasing, phase(4*time.Minute+30*time.Second))
+	assert.Equal(t, 2, held(7*time.Minute))
+	assert.Zero(t, held(12*time.Minute), "unused slots are released over the release period")
+
+	// A campaign starting late draws on the reservation again, which holds
+	// its slots for another grace period
+	workflow := newWorkflow("newsletter", "marketing")
+	match, err := manager.Match(ctx, workflow, "", nineAM.Add(12*time.Minute))
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Zero(t, match.FreeSlots)
+	require.NoError(t, manager.Claim(ctx, reservation.ID, uuid.New(), nineAM.Add(12*time.Minute)))
+	assert.Equal(t, 4, held(12*time.Minute))
+	require.NoError(t, manager.Claim(ctx, reservation.ID, uuid.New(), nineAM.Add(13*time.Minute)))
+	assert.Equal(t, 3, held(13*time.Minute))
+	assert.Equal(t, 1, held(20*time.Minute), "slots in use are not released")
+
+	assert.Zero(t, held(30*time.Minute))
+	assert.Equal(t, PhaseEnded, phase(30*time.Minute))
+
+	// A reservation whose campaign never came no longer holds slots from
+	// unreserved traffic
+	manager.now = time.Now
+	now := time.Now()
+	reserve(t, manager, &Reservation{Name: "autumn-campaign", Namespace: "marketing", StartsAt: now.Add(-20 * time.Minute), EndsAt: now.Add(time.Hour), Slots: 4, Executions: 100})
+	engine.running = 6
+	report := preflight(newTestChecker(manager, engine), newWorkflow("orders", "sales"))
+	assert.Equal(t, admission.VerdictOK, report.Verdict)
+	assert.Zero(t, report.ReservedSlots)
+}
+
+func TestMatch(t *testing.T) {
+	manager := newTestManager(&fakeEngine{capacity: 10})
+	manager.now = func() time.Time { return nineAM.Add(-time.Hour) }
+	ctx := context.Background()
+	workflow := newWorkflow("newsletter", "marketing")
+
+	namespace := reserve(t, manager, &Reservation{Name: "namespace", Namespace: "marketing", StartsAt: nineAM, EndsAt: nineAM.Add(time.Hour), Slots: 4, Executions: 10})
+	own := reserve(t, manager, &Reservation{Name: "workflow", WorkflowID: &workflow.ID, StartsAt: nineAM, EndsAt: nineAM.Add(time.Hour), Slots: 2, Executions: 10})
+	reserve(t, manager, &Reservation{Name: "sales", Namespace: "sales", StartsAt: nineAM, EndsAt: nineAM.Add(time.Hour), Slots: 2, Executions: 10})
+
+	match, err := manager.Match(ctx, workflow, "", nineAM)
+	require.NoError(t, err)
+	assert.Equal(t, own.ID, match.ID, "reservations of the workflow are preferred")
+	assert.Equal(t, 2, match.FreeSlots)
+	assert.Equal(t, 10, match.RemainingExecutions)
+
+	match, err = manager.Match(ctx, workflow, namespace.Token, nineAM)
+	require.NoError(t, err)
+	assert.Equal(t, namespace.ID, match.ID, "tokens select the reservation")
+
+	match, err = manager.Match(ctx, newWorkflow("orders", policies.DefaultNamespace), namespace.Token, nineAM)
+	require.NoError(t, err)
+	assert.Nil(t, match, "tokens do not reach workflows outside the reservation")
+
+	match, err = manager.Match(ctx, workflow, "", nineAM.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Nil(t, match, "reservations are matched during their window only")
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewHandlers(newTestManager(&fakeEngine{capacity: 10})).RegisterRoutes(router.Group("/api"))
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			var err error
+			payload, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("X-User-ID", "marketing-ops")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	rec := request(http.MethodPost, "/api/v1/reservations", CreateRequest{Name: "spring-campaign", Namespace: "marketing", StartsAt: start, EndsAt: start.Add(10 * time.Minute), Slots: 6, Executions: 20000})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var reservation Reservation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reservation))
+	assert.Equal(t, "marketing-ops", reservation.CreatedBy)
+	assert.NotEmpty(t, reservation.Token)
+
+	rec = request(http.MethodPost, "/api/v1/reservations", CreateRequest{Name: "flash-sale", Namespace: "sales", StartsAt: start.Add(5 * time.Minute), EndsAt: start.Add(time.Hour), Slots: 4, Executions: 100})
+	require.Equal(t, http.StatusConflict, rec.Code)
+	var conflict struct {
+		Error    string        `json:"error"`
+		Capacity CapacityError `json:"capacity"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &conflict))
+	require.Len(t, conflict.Capacity.Overlapping, 1)
+	assert.Equal(t, "spring-campaign", conflict.Capacity.Overlapping[0].Name)
+	assert.Equal(t, 6, conflict.Capacity.Reserved)
+
+	rec = request(http.MethodPost, "/api/v1/reservations", CreateRequest{Name: "unscoped", StartsAt: start, EndsAt: start.Add(time.Hour), Slots: 1, Executions: 1})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = request(http.MethodGet, "/api/v1/reservations", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var statuses []Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	require.Len(t, statuses, 1)
+	assert.Equal(t, PhaseScheduled, statuses[0].Phase)
+
+	rec = request(http.MethodGet, "/api/v1/reservations/"+reservation.ID.String(), nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/api/v1/reservations/"+reservation.ID.String(), nil).Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/api/v1/reservations/"+reservation.ID.String(), nil).Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, "/api/v1/reservations/"+reservation.ID.String(), nil).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/api/v1/reservations/not-a-uuid", nil).Code)
+}
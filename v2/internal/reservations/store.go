@@ -0,0 +1,180 @@
+package reservations
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store persists reservations. Get returns gorm.ErrRecordNotFound for
+// unknown reservations.
+type Store interface {
+	Create(ctx context.Context, reservation *Reservation) error
+	Get(ctx context.Context, id uuid.UUID) (*Reservation, error)
+	// List returns every reservation, ordered by start
+	List(ctx context.Context) ([]*Reservation, error)
+	// Overlapping returns the reservations whose window overlaps the
+	// window from-to, ordered by start
+	Overlapping(ctx context.Context, from, to time.Time) ([]*Reservation, error)
+	// Active returns the reservations whose window contains a time,
+	// ordered by start
+	Active(ctx context.Context, at time.Time) ([]*Reservation, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu           sync.Mutex
+	reservations map[uuid.UUID]*Reservation
+}
+
+// NewMemoryStore creates an in-memory reservation store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{reservations: make(map[uuid.UUID]*Reservation)}
+}
+
+// Create stores a reservation
+func (s *MemoryStore) Create(ctx context.Context, reservation *Reservation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *reservation
+	s.reservations[reservation.ID] = &stored
+	return nil
+}
+
+// Get returns a reservation
+func (s *MemoryStore) Get(ctx context.Context, id uuid.UUID) (*Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reservation, ok := s.reservations[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	stored := *reservation
+	return &stored, nil
+}
+
+// List returns every reservation
+func (s *MemoryStore) List(ctx context.Context) ([]*Reservation, error) {
+	return s.filter(func(*Reservation) bool { return true }), nil
+}
+
+// Overlapping returns the reservations overlapping a window
+func (s *MemoryStore) Overlapping(ctx context.Context, from, to time.Time) ([]*Reservation, error) {
+	return s.filter(func(r *Reservation) bool {
+		return r.StartsAt.Before(to) && r.EndsAt.After(from)
+	}), nil
+}
+
+// Active returns the reservations active at a time
+func (s *MemoryStore) Active(ctx context.Context, at time.Time) ([]*Reservation, error) {
+	return s.filter(func(r *Reservation) bool { return r.ActiveAt(at) }), nil
+}
+
+// Delete removes a reservation
+func (s *MemoryStore) Delete(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reservations[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.reservations, id)
+	return nil
+}
+
+func (s *MemoryStore) filter(keep func(*Reservation) bool) []*Reservation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reservations []*Reservation
+	for _, reservation := range s.reservations {
+		if keep(reservation) {
+			stored := *reservation
+			reservations = append(reservations, &stored)
+		}
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].StartsAt.Equal(reservations[j].StartsAt) {
+			return reservations[i].StartsAt.Before(reservations[j].StartsAt)
+		}
+		return reservations[i].Name < reservations[j].Name
+	})
+	return reservations
+}
+
+// GormStore keeps reservations in the reservations table and finds the ones
+// of a window by comparing their start and end in the query. Slots in use
+// are tracked by the manager, not stored.
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database reservation store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the reservations table
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Reservation{})
+}
+
+// Create stores a reservation
+func (s *GormStore) Create(ctx context.Context, reservation *Reservation) error {
+	return s.db.WithContext(ctx).Create(reservation).Error
+}
+
+// Get returns a reservation
+func (s *GormStore) Get(ctx context.Context, id uuid.UUID) (*Reservation, error) {
+	var reservation Reservation
+	if err := s.db.WithContext(ctx).First(&reservation, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// List returns every reservation
+func (s *GormStore) List(ctx context.Context) ([]*Reservation, error) {
+	var reservations []*Reservation
+	err := s.db.WithContext(ctx).Order("starts_at, name").Find(&reservations).Error
+	return reservations, err
+}
+
+// Overlapping returns the reservations overlapping a window
+func (s *GormStore) Overlapping(ctx context.Context, from, to time.Time) ([]*Reservation, error) {
+	var reservations []*Reservation
+	err := s.db.WithContext(ctx).
+		Where("starts_at < ? AND ends_at > ?", to, from).
+		Order("starts_at, name").
+		Find(&reservations).Error
+	return reservations, err
+}
+
+// Active returns the reservations active at a time
+func (s *GormStore) Active(ctx context.Context, at time.Time) ([]*Reservation, error) {
+	var reservations []*Reservation
+	err := s.db.WithContext(ctx).
+		Where("starts_at <= ? AND ends_at > ?", at, at).
+		Order("starts_at, name").
+		Find(&reservations).Error
+	return reservations, err
+}
+
+// Delete removes a reservation
+func (s *GormStore) Delete(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Delete(&Reservation{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Package runner starts workflow executions from the command line and waits
+// for them to finish
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// DefaultPollInterval is how often a waiting run checks its execution
+const DefaultPollInterval = time.Second
+
+// ErrInvalidInput is returned when an input file is not a JSON object
+var ErrInvalidInput = errors.New("invalid execution input")
+
+// ErrExecutionFailed is returned by a waiting run whose execution finished
+// without completing
+var ErrExecutionFailed = errors.New("execution did not complete")
+
+// StartFunc starts an execution of a workflow. The CLI starts it through
+// the workflow service.
+type StartFunc func(ctx context.Context, workflowID uuid.UUID, input map[string]interface{}) (*models.Execution, error)
+
+// GetFunc returns the current state of an execution
+type GetFunc func(ctx context.Context, executionID uuid.UUID) (*models.Execution, error)
+
+// Runner starts workflow executions
+type Runner struct {
+	start        StartFunc
+	get          GetFunc
+	pollInterval time.Duration
+}
+
+// New creates a runner. get may be nil when runs never wait.
+func New(start StartFunc, get GetFunc) *Runner {
+	return &Runner{start: start, get: get, pollInterval: DefaultPollInterval}
+}
+
+// WithPollInterval sets how often waiting runs check their execution
+func (r *Runner) WithPollInterval(interval time.Duration) *Runner {
+	if interval > 0 {
+		r.pollInterval = interval
+	}
+	return r
+}
+
+// Run starts an execution of a workflow with input. With wait it then polls
+// the execution until it responded or finished, or ctx is done, and returns
+// ErrExecutionFailed along with the execution if it did not complete. An
+// execution responds once its critical path completed, with its output,
+// while its background steps may still be running.
+func (r *Runner) Run(ctx context.Context, workflowID uuid.UUID, input map[string]interface{}, wait bool) (*models.Execution, error) {
+	execution, err := r.start(ctx, workflowID, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start workflow %s: %w", workflowID, err)
+	}
+	if !wait {
+		return execution, nil
+	}
+	if r.get == nil {
+		return execution, fmt.Errorf("executions cannot be waited for by this runner")
+	}
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for !execution.IsFinished() && !execution.IsResponded() {
+		select {
+		case <-ctx.Done():
+			return execution, fmt.Errorf("stopped waiting for execution %s: %w", execution.ID, ctx.Err())
+		case <-ticker.C:
+		}
+
+		current, err := r.get(ctx, execution.ID)
+		if err != nil {
+			return execution, fmt.Errorf("failed to get execution %s: %w", execution.ID, err)
+		}
+		execution = current
+	}
+
+	if execution.IsFinished() && !execution.IsCompleted() {
+		if execution.Error != "" {
+			return execution, fmt.Errorf("%w: execution %s %s: %s", ErrExecutionFailed, execution.ID, execution.Status, execution.Error)
+		}
+		return execution, fmt.Errorf("%w: execution %s %s", ErrExecutionFailed, execution.ID, execution.Status)
+	}
+	return execution, nil
+}
+
+// ReadInput reads an execution input file holding a JSON object. An empty
+// path is an empty input and "-" reads standard input.
+func ReadInput(path string) (map[string]interface{}, error) {
+	if path == "" {
+		return map[string]interface{}{}, nil
+	}
+
+	var (
+		data []byte
+		err  error
+		name = filepath.Base(path)
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+		name = "standard input"
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	var input map[string]interface{}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s: %v", ErrInvalidInput, name, err)
+	}
+	if input == nil {
+		return nil, fmt.Errorf("%w: %s is not a JSON object", ErrInvalidInput, name)
+	}
+	return input, nil
+}
@@ -0,0 +1,185 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// fakeExecutions starts executions and reports them in the given statuses,
+// one per poll
+type fakeExecutions struct {
+	workflowID uuid.UUID
+	input      map[string]interface{}
+	execution  *models.Execution
+	statuses   []models.ExecutionStatus
+	polls      int
+	err        error
+	// respondedAt is the poll from which the execution has responded
+	respondedAt int
+}
+
+func (f *fakeExecutions) start(ctx context.Context, workflowID uuid.UUID, input map[string]interface{}) (*models.Execution, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.workflowID = workflowID
+	f.input = input
+	f.execution = &models.Execution{ID: uuid.New(), WorkflowID: workflowID, Status: models.ExecutionStatusPending}
+	return f.execution, nil
+}
+
+func (f *fakeExecutions) get(ctx context.Context, executionID uuid.UUID) (*models.Execution, error) {
+	current := *f.execution
+	if f.polls < len(f.statuses) {
+		current.Status = f.statuses[f.polls]
+	} else if len(f.statuses) > 0 {
+		current.Status = f.statuses[len(f.statuses)-1]
+	}
+	f.polls++
+	if f.respondedAt > 0 && f.polls >= f.respondedAt {
+		respondedAt := time.Now()
+		current.RespondedAt = &respondedAt
+		current.OutputData = map[string]interface{}{"total": 42.0}
+	}
+	if current.Status == models.ExecutionStatusCompleted {
+		current.OutputData = map[string]interface{}{"total": 42.0}
+	}
+	if current.Status == models.ExecutionStatusFailed {
+		current.Error = "payment declined"
+	}
+	return &current, nil
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	workflowID := uuid.New()
+
+	t.Run("starts an execution with the parsed input", func(t *testing.T) {
+		input, err := ReadInput(filepath.Join("testdata", "input.json"))
+		require.NoError(t, err)
+
+		executions := &fakeExecutions{}
+		execution, err := New(executions.start, nil).Run(ctx, workflowID, input, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, workflowID, executions.workflowID)
+		assert.Equal(t, map[string]interface{}{
+			"order_id": "ord-1",
+			"items":    []interface{}{map[string]interface{}{"sku": "a-1", "qty": 2.0}},
+			"rush":     true,
+		}, executions.input)
+		assert.Equal(t, models.ExecutionStatusPending, execution.Status)
+		assert.Zero(t, executions.polls)
+	})
+
+	t.Run("waits for completion", func(t *testing.T) {
+		executions := &fakeExecutions{statuses: []models.ExecutionStatus{
+			models.ExecutionStatusRunning,
+			models.ExecutionStatusRunning,
+			models.ExecutionStatusCompleted,
+		}}
+		execution, err := New(executions.start, executions.get).WithPollInterval(time.Millisecond).Run(ctx, workflowID, map[string]interface{}{}, true)
+		require.NoError(t, err)
+
+		assert.Equal(t, 3, executions.polls)
+		assert.Equal(t, models.ExecutionStatusCompleted, execution.Status)
+		assert.Equal(t, map[string]interface{}{"total": 42.0}, execution.OutputData)
+	})
+
+	t.Run("returns once the execution responded", func(t *testing.T) {
+		executions := &fakeExecutions{
+			statuses: []models.ExecutionStatus{
+				models.ExecutionStatusRunning,
+				models.ExecutionStatusRunning,
+				models.ExecutionStatusRunning,
+				models.ExecutionStatusCompletedWithWarnings,
+			},
+			respondedAt: 2,
+		}
+		execution, err := New(executions.start, executions.get).WithPollInterval(time.Millisecond).Run(ctx, workflowID, map[string]interface{}{}, true)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, executions.polls)
+		assert.Equal(t, models.ExecutionStatusRunning, execution.Status)
+		assert.True(t, execution.IsResponded())
+		assert.Equal(t, map[string]interface{}{"total": 42.0}, execution.OutputData)
+	})
+
+	t.Run("completed with warnings", func(t *testing.T) {
+		executions := &fakeExecutions{statuses: []models.ExecutionStatus{models.ExecutionStatusCompletedWithWarnings}}
+		execution, err := New(executions.start, executions.get).WithPollInterval(time.Millisecond).Run(ctx, workflowID, map[string]interface{}{}, true)
+		require.NoError(t, err)
+		assert.Equal(t, models.ExecutionStatusCompletedWithWarnings, execution.Status)
+	})
+
+	t.Run("failed execution", func(t *testing.T) {
+		executions := &fakeExecutions{statuses: []models.ExecutionStatus{models.ExecutionStatusFailed}}
+		execution, err := New(executions.start, executions.get).WithPollInterval(time.Millisecond).Run(ctx, workflowID, map[string]interface{}{}, true)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrExecutionFailed))
+		assert.Contains(t, err.Error(), "failed: payment declined")
+		require.NotNil(t, execution)
+		assert.Equal(t, models.ExecutionStatusFailed, execution.Status)
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		executions := &fakeExecutions{statuses: []models.ExecutionStatus{models.ExecutionStatusRunning}}
+		waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		execution, err := New(executions.start, executions.get).WithPollInterval(time.Millisecond).Run(waitCtx, workflowID, map[string]interface{}{}, true)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.False(t, errors.Is(err, ErrExecutionFailed))
+		assert.Equal(t, models.ExecutionStatusRunning, execution.Status)
+	})
+
+	t.Run("start failure", func(t *testing.T) {
+		executions := &fakeExecutions{err: errors.New("workflow not found")}
+		_, err := New(executions.start, executions.get).Run(ctx, workflowID, map[string]interface{}{}, true)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "workflow not found")
+	})
+}
+
+func TestReadInput(t *testing.T) {
+	t.Run("empty path", func(t *testing.T) {
+		input, err := ReadInput("")
+		require.NoError(t, err)
+		assert.Empty(t, input)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		for name, content := range map[string]string{
+			"broken.json": `{"order_id": `,
+			"array.json":  `[1, 2]`,
+			"null.json":   `null`,
+		} {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+			_, err := ReadInput(path)
+			require.Error(t, err, name)
+			assert.True(t, errors.Is(err, ErrInvalidInput), name)
+			assert.Contains(t, err.Error(), name)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := ReadInput(filepath.Join("testdata", "missing.json"))
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrInvalidInput))
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+}
@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts the current time so schedules can be evaluated deterministically
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock reads the system clock
+type realClock struct{}
+
+// Now returns the current system time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// After returns a channel receiving the current time once d elapsed
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// NewRealClock returns a clock backed by the system time
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+// After returns a channel receiving the time once d elapsed on the clock.
+// Clocks without an After method of their own wait on the system clock.
+func After(clock Clock, d time.Duration) <-chan time.Time {
+	if waiter, ok := clock.(interface {
+		After(d time.Duration) <-chan time.Time
+	}); ok {
+		return waiter.After(d)
+	}
+	return time.After(d)
+}
+
+// FakeClock is a manually controlled clock used in tests
+type FakeClock struct {
+	mu  sync.RWMutex
+	now time.Time
+	// waiters are the channels of After calls, sent the time once the
+	// clock reaches their deadline
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock creates a fake clock set to the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the fake current time
+func (c *FakeClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Advance moves the fake clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.fireLocked()
+}
+
+// Set moves the fake clock to t
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+	c.fireLocked()
+}
+
+// After returns a channel receiving the fake time once the clock was moved
+// d past the current time
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// fireLocked sends the time to the waiters whose deadline passed. c.mu must
+// be held.
+func (c *FakeClock) fireLocked() {
+	waiting := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(c.now) {
+			waiting = append(waiting, waiter)
+			continue
+		}
+		waiter.ch <- c.now
+	}
+	c.waiters = waiting
+}
@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CronExpression is a parsed five-field cron expression
+// (minute, hour, day of month, month, day of week)
+type CronExpression struct {
+	raw      string
+	minutes  [60]bool
+	hours    [24]bool
+	days     [32]bool
+	months   [13]bool
+	weekdays [7]bool
+
+	// domRestricted and dowRestricted follow the classic cron rule: when both
+	// day fields are restricted a day matches if either of them matches
+	domRestricted bool
+	dowRestricted bool
+}
+
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var (
+	minuteField  = cronField{name: "minute", min: 0, max: 59}
+	hourField    = cronField{name: "hour", min: 0, max: 23}
+	dayField     = cronField{name: "day of month", min: 1, max: 31}
+	monthField   = cronField{name: "month", min: 1, max: 12}
+	weekdayField = cronField{name: "day of week", min: 0, max: 7}
+)
+
+// cronMacros maps the supported shorthand expressions to their five-field form
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard five-field cron expression
+func ParseCron(expr string) (*CronExpression, error) {
+	raw := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(raw)]; ok {
+		raw = macro
+	}
+
+	fields := strings.Fields(raw)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	cron := &CronExpression{raw: strings.TrimSpace(expr)}
+
+	minutes, err := parseCronField(fields[0], minuteField)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := parseCronField(fields[1], hourField)
+	if err != nil {
+		return nil, err
+	}
+	days, err := parseCronField(fields[2], dayField)
+	if err != nil {
+		return nil, err
+	}
+	months, err := parseCronField(fields[3], monthField)
+	if err != nil {
+		return nil, err
+	}
+	weekdays, err := parseCronField(fields[4], weekdayField)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range minutes {
+		cron.minutes[v] = true
+	}
+	for _, v := range hours {
+		cron.hours[v] = true
+	}
+	for _, v := range days {
+		cron.days[v] = true
+	}
+	for _, v := range months {
+		cron.months[v] = true
+	}
+	for _, v := range weekdays {
+		// 7 is an alias for Sunday
+		cron.weekdays[v%7] = true
+	}
+
+	cron.domRestricted = fields[2] != "*" && fields[2] != "?"
+	cron.dowRestricted = fields[4] != "*" && fields[4] != "?"
+
+	return cron, nil
+}
+
+// String returns the original expression
+func (c *CronExpression) String() string {
+	return c.raw
+}
+
+// matchesDay reports whether the cron day, month and weekday fields match a date
+func (c *CronExpression) matchesDay(month, day, weekday int) bool {
+	if !c.months[month] {
+		return false
+	}
+
+	domMatch := c.days[day]
+	dowMatch := c.weekdays[weekday]
+
+	switch {
+	case c.domRestricted && c.dowRestricted:
+		return domMatch || dowMatch
+	case c.domRestricted:
+		return domMatch
+	case c.dowRestricted:
+		return dowMatch
+	default:
+		return true
+	}
+}
+
+// wallTimes returns the matching (hour, minute) pairs of a day in ascending order
+func (c *CronExpression) wallTimes() [][2]int {
+	times := make([][2]int, 0)
+	for h := 0; h < 24; h++ {
+		if !c.hours[h] {
+			continue
+		}
+		for m := 0; m < 60; m++ {
+			if c.minutes[m] {
+				times = append(times, [2]int{h, m})
+			}
+		}
+	}
+	return times
+}
+
+func parseCronField(field string, spec cronField) ([]int, error) {
+	values := make([]int, 0)
+	for _, part := range strings.Split(field, ",") {
+		if part == "" {
+			return nil, fmt.Errorf("empty value in %s field", spec.name)
+		}
+
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("invalid step %q in %s field", part[idx+1:], spec.name)
+			}
+			step = s
+			part = part[:idx]
+		}
+
+		lo, hi := spec.min, spec.max
+		switch {
+		case part == "*" || part == "?":
+			if spec.name == weekdayField.name {
+				hi = 6
+			}
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], spec); err != nil {
+				return nil, err
+			}
+			if hi, err = parseCronValue(bounds[1], spec); err != nil {
+				return nil, err
+			}
+			if lo > hi {
+				return nil, fmt.Errorf("invalid range %q in %s field", part, spec.name)
+			}
+		default:
+			v, err := parseCronValue(part, spec)
+			if err != nil {
+				return nil, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+func parseCronValue(value string, spec cronField) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", value, spec.name)
+	}
+	if v < spec.min || v > spec.max {
+		return 0, fmt.Errorf("value %d out of range [%d-%d] in %s field", v, spec.min, spec.max, spec.name)
+	}
+	return v, nil
+}
@@ -0,0 +1,271 @@
+package scheduler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Handlers provides HTTP handlers for schedules and calendars
+type Handlers struct {
+	service *Service
+}
+
+// NewHandlers creates new scheduler handlers
+func NewHandlers(service *Service) *Handlers {
+	return &Handlers{service: service}
+}
+
+// RegisterRoutes registers schedule and calendar routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		schedules := v1.Group("/schedules")
+		{
+			schedules.POST("", h.CreateSchedule)
+			schedules.GET("", h.ListSchedules)
+			schedules.POST("/preview", h.PreviewSchedule)
+			schedules.GET("/:id", h.GetSchedule)
+			schedules.PUT("/:id", h.UpdateSchedule)
+			schedules.DELETE("/:id", h.DeleteSchedule)
+		}
+
+		calendars := v1.Group("/calendars")
+		{
+			calendars.GET("", h.ListCalendars)
+			calendars.GET("/:name", h.GetCalendar)
+			calendars.PUT("/:name", h.PutCalendar)
+			calendars.DELETE("/:name", h.DeleteCalendar)
+		}
+	}
+}
+
+// CreateSchedule creates a new schedule
+// @Summary Create schedule
+// @Tags scheduler
+// @Accept json
+// @Produce json
+// @Param request body Schedule true "Schedule"
+// @Success 201 {object} ScheduleDetail
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/schedules [post]
+func (h *Handlers) CreateSchedule(c *gin.Context) {
+	var schedule Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.service.CreateSchedule(&schedule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	detail, err := h.service.GetSchedule(created.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, detail)
+}
+
+// ListSchedules lists all schedules
+// @Summary List schedules
+// @Tags scheduler
+// @Produce json
+// @Success 200 {array} Schedule
+// @Router /api/v1/schedules [get]
+func (h *Handlers) ListSchedules(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.ListSchedules())
+}
+
+// GetSchedule returns a schedule with its next fire times
+// @Summary Get schedule
+// @Tags scheduler
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} ScheduleDetail
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/schedules/{id} [get]
+func (h *Handlers) GetSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	detail, err := h.service.GetSchedule(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// UpdateSchedule replaces a schedule
+// @Summary Update schedule
+// @Tags scheduler
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Param request body Schedule true "Schedule"
+// @Success 200 {object} ScheduleDetail
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/schedules/{id} [put]
+func (h *Handlers) UpdateSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	var schedule Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.service.UpdateSchedule(id, &schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	detail, err := h.service.GetSchedule(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// DeleteSchedule deletes a schedule
+// @Summary Delete schedule
+// @Tags scheduler
+// @Param id path string true "Schedule ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/schedules/{id} [delete]
+func (h *Handlers) DeleteSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	if err := h.service.DeleteSchedule(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PreviewSchedule computes fire times for an unsaved schedule
+// @Summary Preview schedule fire times
+// @Tags scheduler
+// @Accept json
+// @Produce json
+// @Param count query int false "Number of fire times (default 5)"
+// @Param request body Schedule true "Schedule"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/schedules/preview [post]
+func (h *Handlers) PreviewSchedule(c *gin.Context) {
+	var schedule Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, _ := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(UpcomingFireTimesCount)))
+	if count < 1 || count > 100 {
+		count = UpcomingFireTimesCount
+	}
+
+	times, err := h.service.PreviewSchedule(&schedule, count)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"upcoming_fire_times": times})
+}
+
+// ListCalendars lists all exclusion calendars
+// @Summary List calendars
+// @Tags scheduler
+// @Produce json
+// @Success 200 {array} Calendar
+// @Router /api/v1/calendars [get]
+func (h *Handlers) ListCalendars(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.ListCalendars())
+}
+
+// GetCalendar returns an exclusion calendar
+// @Summary Get calendar
+// @Tags scheduler
+// @Produce json
+// @Param name path string true "Calendar name"
+// @Success 200 {object} Calendar
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/calendars/{name} [get]
+func (h *Handlers) GetCalendar(c *gin.Context) {
+	calendar, err := h.service.GetCalendar(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// PutCalendar creates or replaces an exclusion calendar
+// @Summary Create or replace calendar
+// @Description Referenced schedules have their next fire time recomputed
+// @Tags scheduler
+// @Accept json
+// @Produce json
+// @Param name path string true "Calendar name"
+// @Param request body Calendar true "Calendar"
+// @Success 200 {object} Calendar
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/calendars/{name} [put]
+func (h *Handlers) PutCalendar(c *gin.Context) {
+	var calendar Calendar
+	if err := c.ShouldBindJSON(&calendar); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	calendar.Name = c.Param("name")
+
+	saved, err := h.service.PutCalendar(&calendar)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteCalendar deletes an unreferenced exclusion calendar
+// @Summary Delete calendar
+// @Tags scheduler
+// @Param name path string true "Calendar name"
+// @Success 204
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/calendars/{name} [delete]
+func (h *Handlers) DeleteCalendar(c *gin.Context) {
+	if err := h.service.DeleteCalendar(c.Param("name")); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,411 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	require.NoError(t, err)
+	return loc
+}
+
+func newTestSchedule(cron string) *Schedule {
+	return &Schedule{
+		WorkflowID:     uuid.New(),
+		Name:           "test",
+		CronExpression: cron,
+		TimeZone:       "Europe/Warsaw",
+		Enabled:        true,
+	}
+}
+
+func newTestTimetable(t *testing.T, schedule *Schedule, calendars ...*Calendar) *Timetable {
+	schedule.applyDefaults()
+	require.NoError(t, schedule.Validate())
+	timetable, err := NewTimetable(schedule, calendars)
+	require.NoError(t, err)
+	return timetable
+}
+
+func TestParseCron(t *testing.T) {
+	t.Run("valid expressions", func(t *testing.T) {
+		for _, expr := range []string{"* * * * *", "0 8 * * 1-5", "*/15 0-6 1,15 * *", "0 0 * * 7", "@daily"} {
+			_, err := ParseCron(expr)
+			assert.NoError(t, err, expr)
+		}
+	})
+
+	t.Run("invalid expressions", func(t *testing.T) {
+		for _, expr := range []string{"", "* * * *", "60 * * * *", "0 24 * * *", "0 0 0 * *", "0 0 * 13 *", "5-1 * * * *", "*/0 * * * *"} {
+			_, err := ParseCron(expr)
+			assert.Error(t, err, expr)
+		}
+	})
+}
+
+func TestTimetableTimeZone(t *testing.T) {
+	warsaw := mustLocation(t, "Europe/Warsaw")
+	timetable := newTestTimetable(t, newTestSchedule("0 8 * * *"))
+
+	after := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	next, ok := timetable.Next(after)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2024, 1, 16, 8, 0, 0, 0, warsaw), next)
+	assert.Equal(t, time.Date(2024, 1, 16, 7, 0, 0, 0, time.UTC), next.UTC())
+
+	// Summer time: 08:00 CEST is 06:00 UTC
+	next, ok = timetable.Next(time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2024, 7, 2, 6, 0, 0, 0, time.UTC), next.UTC())
+}
+
+func TestTimetableSpringForward(t *testing.T) {
+	// On 2024-03-31 Warsaw clocks jump from 02:00 CET to 03:00 CEST
+	after := time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+
+	t.Run("shift", func(t *testing.T) {
+		schedule := newTestSchedule("30 2 * * *")
+		schedule.DSTPolicy = DSTPolicy{Gap: GapPolicyShift, Overlap: OverlapPolicyFirst}
+		timetable := newTestTimetable(t, schedule)
+
+		times := timetable.NextN(after, 2)
+		require.Len(t, times, 2)
+		// 02:30 CET would have been 01:30 UTC
+		assert.Equal(t, time.Date(2024, 3, 31, 1, 30, 0, 0, time.UTC), times[0].UTC())
+		// The following day is back to normal: 02:30 CEST is 00:30 UTC
+		assert.Equal(t, time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC), times[1].UTC())
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		schedule := newTestSchedule("30 2 * * *")
+		schedule.DSTPolicy = DSTPolicy{Gap: GapPolicySkip, Overlap: OverlapPolicyFirst}
+		timetable := newTestTimetable(t, schedule)
+
+		next, ok := timetable.Next(after)
+		require.True(t, ok)
+		assert.Equal(t, time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("shift does not duplicate existing fire times", func(t *testing.T) {
+		schedule := newTestSchedule("30 2,3 31 3 *")
+		schedule.DSTPolicy = DSTPolicy{Gap: GapPolicyShift, Overlap: OverlapPolicyFirst}
+		timetable := newTestTimetable(t, schedule)
+
+		times := timetable.Between(after, time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC))
+		require.Len(t, times, 1)
+		assert.Equal(t, time.Date(2024, 3, 31, 1, 30, 0, 0, time.UTC), times[0].UTC())
+	})
+}
+
+func TestTimetableFallBack(t *testing.T) {
+	// On 2024-10-27 Warsaw clocks go back from 03:00 CEST to 02:00 CET,
+	// so 02:30 happens twice: 00:30 UTC and 01:30 UTC
+	after := time.Date(2024, 10, 26, 12, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 10, 27, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		policy   OverlapPolicy
+		expected []time.Time
+	}{
+		{OverlapPolicyFirst, []time.Time{time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC)}},
+		{OverlapPolicyLast, []time.Time{time.Date(2024, 10, 27, 1, 30, 0, 0, time.UTC)}},
+		{OverlapPolicyBoth, []time.Time{
+			time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC),
+			time.Date(2024, 10, 27, 1, 30, 0, 0, time.UTC),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			schedule := newTestSchedule("30 2 * * *")
+			schedule.DSTPolicy = DSTPolicy{Gap: GapPolicyShift, Overlap: tt.policy}
+			timetable := newTestTimetable(t, schedule)
+
+			times := timetable.Between(after, end)
+			require.Len(t, times, len(tt.expected))
+			for i := range tt.expected {
+				assert.Equal(t, tt.expected[i], times[i].UTC())
+			}
+		})
+	}
+}
+
+func TestTimetableHolidayExclusion(t *testing.T) {
+	holidays := &Calendar{Name: "pl-holidays", Dates: []string{"2024-05-01", "2024-05-03"}}
+	schedule := newTestSchedule("0 8 * * 1-5")
+	schedule.Calendars = []string{holidays.Name}
+	timetable := newTestTimetable(t, schedule, holidays)
+
+	times := timetable.NextN(time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC), 3)
+	require.Len(t, times, 3)
+	assert.Equal(t, "2024-05-02", times[0].Format(DateLayout))
+	// 2024-05-03 is a holiday and 4-5 May is a weekend
+	assert.Equal(t, "2024-05-06", times[1].Format(DateLayout))
+	assert.Equal(t, "2024-05-07", times[2].Format(DateLayout))
+}
+
+func TestTimetableLast(t *testing.T) {
+	timetable := newTestTimetable(t, newTestSchedule("0 8 * * *"))
+	from := time.Date(2024, 4, 28, 12, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		n    int
+		days []string
+	}{
+		"latest":    {n: 1, days: []string{"2024-05-02"}},
+		"latest 2":  {n: 2, days: []string{"2024-05-01", "2024-05-02"}},
+		"unbounded": {n: 0, days: []string{"2024-04-29", "2024-04-30", "2024-05-01", "2024-05-02"}},
+		"beyond":    {n: 10, days: []string{"2024-04-29", "2024-04-30", "2024-05-01", "2024-05-02"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			days := make([]string, 0)
+			for _, fire := range timetable.Last(from, to, tt.n) {
+				days = append(days, fire.Format(DateLayout))
+			}
+			assert.Equal(t, tt.days, days)
+		})
+	}
+}
+
+func TestTimetableLastBusinessDayOfMonth(t *testing.T) {
+	schedule := newTestSchedule("0 18 * * *")
+	schedule.Constraint = ConstraintLastBusinessDayOfMonth
+
+	t.Run("weekend at month end", func(t *testing.T) {
+		timetable := newTestTimetable(t, schedule)
+		// 2024-08-31 is a Saturday
+		times := timetable.NextN(time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), 2)
+		require.Len(t, times, 2)
+		assert.Equal(t, "2024-08-30", times[0].Format(DateLayout))
+		assert.Equal(t, "2024-09-30", times[1].Format(DateLayout))
+	})
+
+	t.Run("holiday at month end", func(t *testing.T) {
+		holidays := &Calendar{Name: "year-end", Dates: []string{"2024-12-31"}}
+		timetable := newTestTimetable(t, schedule, holidays)
+
+		next, ok := timetable.Next(time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC))
+		require.True(t, ok)
+		assert.Equal(t, "2024-12-30", next.Format(DateLayout))
+	})
+}
+
+func TestServiceScheduleDetail(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	service := NewService(clock, nil, nil)
+
+	schedule, err := service.CreateSchedule(newTestSchedule("0 8 * * *"))
+	require.NoError(t, err)
+
+	detail, err := service.GetSchedule(schedule.ID)
+	require.NoError(t, err)
+	require.Len(t, detail.UpcomingFireTimes, UpcomingFireTimesCount)
+	assert.Equal(t, time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC), detail.UpcomingFireTimes[0].UTC())
+	assert.Equal(t, *detail.NextFireTime, detail.UpcomingFireTimes[0])
+}
+
+func TestServiceCalendarChangeRecomputesSchedules(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 12, 23, 12, 0, 0, 0, time.UTC))
+	service := NewService(clock, nil, nil)
+
+	_, err := service.PutCalendar(&Calendar{Name: "holidays"})
+	require.NoError(t, err)
+
+	schedule := newTestSchedule("0 8 * * 1-5")
+	schedule.Calendars = []string{"holidays"}
+	schedule, err = service.CreateSchedule(schedule)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-12-24", schedule.NextFireTime.Format(DateLayout))
+
+	_, err = service.PutCalendar(&Calendar{Name: "holidays", Dates: []string{"2024-12-24", "2024-12-25", "2024-12-26"}})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-12-27", schedule.NextFireTime.Format(DateLayout))
+
+	assert.Error(t, service.DeleteCalendar("holidays"))
+}
+
+func TestServiceMisfireCatchUp(t *testing.T) {
+	start := time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC)
+
+	newService := func(policy MisfirePolicy, catchUpLimit int) (*Service, *FakeClock, *[]time.Time) {
+		clock := NewFakeClock(start)
+		var mu sync.Mutex
+		fired := make([]time.Time, 0)
+		service := NewService(clock, func(ctx context.Context, schedule *Schedule, fireTime time.Time) error {
+			mu.Lock()
+			defer mu.Unlock()
+			fired = append(fired, fireTime)
+			return nil
+		}, nil)
+
+		service.SetCatchUpLimit(catchUpLimit)
+
+		_, err := service.PutCalendar(&Calendar{Name: "holidays", Dates: []string{"2024-05-01"}})
+		require.NoError(t, err)
+
+		schedule := newTestSchedule("0 8 * * *")
+		schedule.Calendars = []string{"holidays"}
+		schedule.MisfirePolicy = policy
+		_, err = service.CreateSchedule(schedule)
+		require.NoError(t, err)
+
+		return service, clock, &fired
+	}
+
+	t.Run("fire all honours exclusions", func(t *testing.T) {
+		service, clock, fired := newService(MisfirePolicyFireAll, 0)
+
+		// The scheduler was down from Monday to Thursday noon
+		clock.Set(time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC))
+		service.Tick(context.Background())
+
+		require.Len(t, *fired, 3)
+		assert.Equal(t, "2024-04-29", (*fired)[0].Format(DateLayout))
+		assert.Equal(t, "2024-04-30", (*fired)[1].Format(DateLayout))
+		assert.Equal(t, "2024-05-02", (*fired)[2].Format(DateLayout))
+	})
+
+	t.Run("fire all is bounded by the catch-up limit", func(t *testing.T) {
+		service, clock, fired := newService(MisfirePolicyFireAll, 2)
+
+		// The scheduler was down for a month
+		clock.Set(time.Date(2024, 5, 29, 12, 0, 0, 0, time.UTC))
+		service.Tick(context.Background())
+
+		require.Len(t, *fired, 2)
+		assert.Equal(t, "2024-05-28", (*fired)[0].Format(DateLayout))
+		assert.Equal(t, "2024-05-29", (*fired)[1].Format(DateLayout))
+
+		schedule := service.ListSchedules()[0]
+		assert.Equal(t, "2024-05-29", schedule.LastFireTime.Format(DateLayout))
+		assert.Equal(t, "2024-05-30", schedule.NextFireTime.Format(DateLayout))
+	})
+
+	t.Run("fire once", func(t *testing.T) {
+		service, clock, fired := newService(MisfirePolicyFireOnce, 0)
+
+		clock.Set(time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC))
+		service.Tick(context.Background())
+
+		require.Len(t, *fired, 1)
+		assert.Equal(t, "2024-05-02", (*fired)[0].Format(DateLayout))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		service, clock, fired := newService(MisfirePolicySkip, 0)
+
+		clock.Set(time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC))
+		service.Tick(context.Background())
+		assert.Empty(t, *fired)
+
+		// An on-time tick still fires
+		clock.Set(time.Date(2024, 5, 3, 6, 0, 0, 0, time.UTC))
+		service.Tick(context.Background())
+		require.Len(t, *fired, 1)
+		assert.Equal(t, "2024-05-03", (*fired)[0].Format(DateLayout))
+	})
+}
+
+// testHold is a Hold switched by tests
+type testHold struct {
+	held bool
+}
+
+func (h *testHold) Held() bool {
+	return h.held
+}
+
+func TestServiceHoldAndCatchUp(t *testing.T) {
+	start := time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC)
+
+	newService := func(policy MisfirePolicy, catchUpLimit int) (*Service, *FakeClock, *testHold, *[]time.Time) {
+		clock := NewFakeClock(start)
+		fired := make([]time.Time, 0)
+		service := NewService(clock, func(ctx context.Context, schedule *Schedule, fireTime time.Time) error {
+			fired = append(fired, fireTime)
+			return nil
+		}, nil)
+		hold := &testHold{}
+		service.SetHold(hold)
+		service.SetCatchUpLimit(catchUpLimit)
+
+		schedule := newTestSchedule("0 8 * * *")
+		schedule.MisfirePolicy = policy
+		_, err := service.CreateSchedule(schedule)
+		require.NoError(t, err)
+		return service, clock, hold, &fired
+	}
+
+	t.Run("held fires are caught up after the release", func(t *testing.T) {
+		service, clock, hold, fired := newService(MisfirePolicyFireAll, 2)
+
+		// Frozen from Monday to Thursday noon: four daily fires are held
+		hold.held = true
+		for day := 0; day < 4; day++ {
+			clock.Set(start.AddDate(0, 0, day).Add(12 * time.Hour))
+			service.Tick(context.Background())
+		}
+		assert.Empty(t, *fired)
+
+		// The release fires the two most recent of them
+		hold.held = false
+		clock.Set(time.Date(2024, 5, 2, 12, 0, 1, 0, time.UTC))
+		service.Tick(context.Background())
+		require.Len(t, *fired, 2)
+		assert.Equal(t, "2024-05-01", (*fired)[0].Format(DateLayout))
+		assert.Equal(t, "2024-05-02", (*fired)[1].Format(DateLayout))
+
+		// and the schedule resumes
+		clock.Set(time.Date(2024, 5, 3, 8, 0, 0, 0, time.UTC))
+		service.Tick(context.Background())
+		require.Len(t, *fired, 3)
+		assert.Equal(t, "2024-05-03", (*fired)[2].Format(DateLayout))
+	})
+
+	t.Run("skip policy keeps the latest held fire", func(t *testing.T) {
+		service, clock, hold, fired := newService(MisfirePolicySkip, 10)
+
+		hold.held = true
+		clock.Set(time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC))
+		service.Tick(context.Background())
+		assert.Empty(t, *fired)
+
+		hold.held = false
+		clock.Set(time.Date(2024, 4, 30, 15, 0, 0, 0, time.UTC))
+		service.Tick(context.Background())
+		require.Len(t, *fired, 1)
+		assert.Equal(t, "2024-04-30", (*fired)[0].Format(DateLayout))
+	})
+}
+
+func TestFakeClockAfter(t *testing.T) {
+	start := time.Date(2024, 4, 29, 8, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	fired := After(clock, time.Minute)
+
+	clock.Advance(59 * time.Second)
+	select {
+	case <-fired:
+		t.Fatal("fired before the deadline")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case now := <-fired:
+		assert.Equal(t, start.Add(time.Minute), now)
+	default:
+		t.Fatal("did not fire at the deadline")
+	}
+}
@@ -0,0 +1,483 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// UpcomingFireTimesCount is the number of fire times exposed in a schedule detail
+const UpcomingFireTimesCount = 5
+
+// TriggerFunc starts a workflow execution for a schedule fire time
+type TriggerFunc func(ctx context.Context, schedule *Schedule, fireTime time.Time) error
+
+// Hold reports whether executions must be held, such as while executions
+// are frozen
+type Hold interface {
+	Held() bool
+}
+
+// Service manages schedules and exclusion calendars
+type Service struct {
+	mu        sync.RWMutex
+	schedules map[uuid.UUID]*Schedule
+	calendars map[string]*Calendar
+	clock     Clock
+	trigger   TriggerFunc
+	interval  time.Duration
+	logger    *logrus.Logger
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+
+	hold         Hold
+	catchUpLimit int
+	// holding is set by the ticks the hold held, so that the first tick
+	// after the release fires the held fire times
+	holding bool
+}
+
+// NewService creates a new scheduler service
+func NewService(clock Clock, trigger TriggerFunc, logger *logrus.Logger) *Service {
+	if clock == nil {
+		clock = NewRealClock()
+	}
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	return &Service{
+		schedules: make(map[uuid.UUID]*Schedule),
+		calendars: make(map[string]*Calendar),
+		clock:     clock,
+		trigger:   trigger,
+		interval:  time.Second,
+		logger:    logger,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// SetHold holds the fires of every schedule while hold is held. Held fire
+// times are not dropped: the first tick after the release fires them as a
+// catch-up, the catch-up limit of them with the fire_all misfire policy and
+// the latest one otherwise, even with the skip policy.
+func (s *Service) SetHold(hold Hold) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hold = hold
+}
+
+// SetCatchUpLimit bounds the fire times a fire_all schedule catches up,
+// whether they were missed or held, to the latest limit of them. A limit of
+// zero does not bound catch-ups.
+func (s *Service) SetCatchUpLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.catchUpLimit = limit
+}
+
+// CreateSchedule validates and stores a new schedule
+func (s *Service) CreateSchedule(schedule *Schedule) (*Schedule, error) {
+	schedule.applyDefaults()
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkCalendarsLocked(schedule); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now().UTC()
+	if schedule.ID == uuid.Nil {
+		schedule.ID = uuid.New()
+	}
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+
+	if err := s.recomputeLocked(schedule, now); err != nil {
+		return nil, err
+	}
+
+	s.schedules[schedule.ID] = schedule
+	return schedule, nil
+}
+
+// ValidateSchedule validates a schedule the way CreateSchedule does,
+// without storing it
+func (s *Service) ValidateSchedule(schedule *Schedule) error {
+	schedule.applyDefaults()
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checkCalendarsLocked(schedule)
+}
+
+// UpdateSchedule replaces an existing schedule and recomputes its next fire time
+func (s *Service) UpdateSchedule(id uuid.UUID, schedule *Schedule) (*Schedule, error) {
+	schedule.applyDefaults()
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.schedules[id]
+	if !ok {
+		return nil, fmt.Errorf("schedule not found: %s", id)
+	}
+	if err := s.checkCalendarsLocked(schedule); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now().UTC()
+	schedule.ID = id
+	schedule.CreatedAt = existing.CreatedAt
+	schedule.LastFireTime = existing.LastFireTime
+	schedule.UpdatedAt = now
+
+	if err := s.recomputeLocked(schedule, now); err != nil {
+		return nil, err
+	}
+
+	s.schedules[id] = schedule
+	return schedule, nil
+}
+
+// DeleteSchedule removes a schedule
+func (s *Service) DeleteSchedule(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[id]; !ok {
+		return fmt.Errorf("schedule not found: %s", id)
+	}
+	delete(s.schedules, id)
+	return nil
+}
+
+// GetSchedule returns a schedule together with its upcoming fire times
+func (s *Service) GetSchedule(id uuid.UUID) (*ScheduleDetail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return nil, fmt.Errorf("schedule not found: %s", id)
+	}
+
+	timetable, err := NewTimetable(schedule, s.calendarsForLocked(schedule))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScheduleDetail{
+		Schedule:          schedule,
+		UpcomingFireTimes: timetable.NextN(s.clock.Now(), UpcomingFireTimesCount),
+	}, nil
+}
+
+// ListSchedules returns all schedules ordered by name
+func (s *Service) ListSchedules() []*Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]*Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	return schedules
+}
+
+// PreviewSchedule returns the upcoming fire times of an unsaved schedule
+func (s *Service) PreviewSchedule(schedule *Schedule, count int) ([]time.Time, error) {
+	schedule.applyDefaults()
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	timetable, err := NewTimetable(schedule, s.calendarsForLocked(schedule))
+	if err != nil {
+		return nil, err
+	}
+	return timetable.NextN(s.clock.Now(), count), nil
+}
+
+// PutCalendar creates or replaces a calendar and recomputes the next fire
+// time of every schedule that references it
+func (s *Service) PutCalendar(calendar *Calendar) (*Calendar, error) {
+	if err := calendar.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now().UTC()
+	if existing, ok := s.calendars[calendar.Name]; ok {
+		calendar.CreatedAt = existing.CreatedAt
+	} else {
+		calendar.CreatedAt = now
+	}
+	calendar.UpdatedAt = now
+	s.calendars[calendar.Name] = calendar
+
+	for _, schedule := range s.schedules {
+		if !schedule.ReferencesCalendar(calendar.Name) {
+			continue
+		}
+		if err := s.recomputeLocked(schedule, now); err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"schedule_id": schedule.ID,
+				"calendar":    calendar.Name,
+				"error":       err.Error(),
+			}).Error("Failed to recompute schedule after calendar change")
+		}
+	}
+
+	return calendar, nil
+}
+
+// GetCalendar returns a calendar by name
+func (s *Service) GetCalendar(name string) (*Calendar, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	calendar, ok := s.calendars[name]
+	if !ok {
+		return nil, fmt.Errorf("calendar not found: %s", name)
+	}
+	return calendar, nil
+}
+
+// ListCalendars returns all calendars ordered by name
+func (s *Service) ListCalendars() []*Calendar {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	calendars := make([]*Calendar, 0, len(s.calendars))
+	for _, calendar := range s.calendars {
+		calendars = append(calendars, calendar)
+	}
+	sort.Slice(calendars, func(i, j int) bool { return calendars[i].Name < calendars[j].Name })
+	return calendars
+}
+
+// DeleteCalendar removes a calendar that is no longer referenced by any schedule
+func (s *Service) DeleteCalendar(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.calendars[name]; !ok {
+		return fmt.Errorf("calendar not found: %s", name)
+	}
+	for _, schedule := range s.schedules {
+		if schedule.ReferencesCalendar(name) {
+			return fmt.Errorf("calendar %s is referenced by schedule %s", name, schedule.Name)
+		}
+	}
+
+	delete(s.calendars, name)
+	return nil
+}
+
+// Tick fires every schedule that is due, applying the schedule's misfire
+// policy to fire times missed since the last tick
+func (s *Service) Tick(ctx context.Context) {
+	now := s.clock.Now()
+
+	type firing struct {
+		schedule *Schedule
+		times    []time.Time
+	}
+	due := make([]firing, 0)
+
+	s.mu.Lock()
+	if s.hold != nil && s.hold.Held() {
+		// Fire times stay due until the release
+		s.holding = true
+		s.mu.Unlock()
+		return
+	}
+	released := s.holding
+	s.holding = false
+
+	for _, schedule := range s.schedules {
+		if !schedule.Enabled || schedule.NextFireTime == nil || schedule.NextFireTime.After(now) {
+			continue
+		}
+
+		timetable, err := NewTimetable(schedule, s.calendarsForLocked(schedule))
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"schedule_id": schedule.ID,
+				"error":       err.Error(),
+			}).Error("Failed to evaluate schedule")
+			continue
+		}
+
+		// NextFireTime already honours exclusions, and so does every later
+		// fire time found by the timetable. Only the fire times the policy
+		// may fire are kept: however long the scheduler was down, that is
+		// the latest one, or the catch-up limit of them with fire_all.
+		limit := 1
+		if schedule.MisfirePolicy == MisfirePolicyFireAll {
+			limit = s.catchUpLimit
+		}
+		missed := append([]time.Time{*schedule.NextFireTime}, timetable.Last(*schedule.NextFireTime, now, limit)...)
+		var times []time.Time
+		if released {
+			times = s.releaseHeld(schedule.MisfirePolicy, missed)
+		} else {
+			times = s.applyMisfirePolicy(schedule.MisfirePolicy, missed)
+		}
+
+		last := missed[len(missed)-1]
+		schedule.LastFireTime = &last
+		if next, ok := timetable.Next(now); ok {
+			schedule.NextFireTime = &next
+		} else {
+			schedule.NextFireTime = nil
+		}
+
+		if len(times) > 0 {
+			due = append(due, firing{schedule: schedule, times: times})
+		}
+	}
+	s.mu.Unlock()
+
+	if s.trigger == nil {
+		return
+	}
+	for _, f := range due {
+		for _, fireTime := range f.times {
+			if err := s.trigger(ctx, f.schedule, fireTime); err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"schedule_id": f.schedule.ID,
+					"workflow_id": f.schedule.WorkflowID,
+					"fire_time":   fireTime,
+					"error":       err.Error(),
+				}).Error("Failed to trigger scheduled execution")
+			}
+		}
+	}
+}
+
+// Start runs the scheduler loop until Stop is called
+func (s *Service) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.Tick(ctx)
+			case <-s.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler loop
+func (s *Service) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// applyMisfirePolicy reduces the due fire times according to the policy.
+// The most recent time is the regular fire; earlier ones were missed.
+func (s *Service) applyMisfirePolicy(policy MisfirePolicy, times []time.Time) []time.Time {
+	switch policy {
+	case MisfirePolicyFireAll:
+		return s.limitCatchUp(times)
+	case MisfirePolicySkip:
+		// Only a fire time within one tick interval counts as on time
+		last := times[len(times)-1]
+		if s.clock.Now().Sub(last) <= s.interval {
+			return []time.Time{last}
+		}
+		return nil
+	default:
+		return times[len(times)-1:]
+	}
+}
+
+// releaseHeld reduces the fire times held by a hold. Unlike missed fire
+// times they are never skipped.
+func (s *Service) releaseHeld(policy MisfirePolicy, times []time.Time) []time.Time {
+	if policy != MisfirePolicyFireAll {
+		return times[len(times)-1:]
+	}
+	return s.limitCatchUp(times)
+}
+
+// limitCatchUp keeps the latest catch-up limit of the fire times
+func (s *Service) limitCatchUp(times []time.Time) []time.Time {
+	if s.catchUpLimit > 0 && len(times) > s.catchUpLimit {
+		return times[len(times)-s.catchUpLimit:]
+	}
+	return times
+}
+
+// recomputeLocked refreshes a schedule's next fire time; callers hold s.mu
+func (s *Service) recomputeLocked(schedule *Schedule, now time.Time) error {
+	timetable, err := NewTimetable(schedule, s.calendarsForLocked(schedule))
+	if err != nil {
+		return err
+	}
+
+	from := now
+	if schedule.LastFireTime != nil && schedule.LastFireTime.After(from) {
+		from = *schedule.LastFireTime
+	}
+
+	if next, ok := timetable.Next(from); ok {
+		schedule.NextFireTime = &next
+	} else {
+		schedule.NextFireTime = nil
+	}
+	return nil
+}
+
+// calendarsForLocked resolves the calendars referenced by a schedule; callers hold s.mu
+func (s *Service) calendarsForLocked(schedule *Schedule) []*Calendar {
+	calendars := make([]*Calendar, 0, len(schedule.Calendars))
+	for _, name := range schedule.Calendars {
+		if calendar, ok := s.calendars[name]; ok {
+			calendars = append(calendars, calendar)
+		}
+	}
+	return calendars
+}
+
+func (s *Service) checkCalendarsLocked(schedule *Schedule) error {
+	for _, name := range schedule.Calendars {
+		if _, ok := s.calendars[name]; !ok {
+			return fmt.Errorf("calendar not found: %s", name)
+		}
+	}
+	return nil
+}
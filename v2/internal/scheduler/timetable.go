@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxSearchDays bounds the search for the next fire time so that expressions
+// which can never match (e.g. "0 0 30 2 *") terminate
+const maxSearchDays = 366 * 5
+
+// Timetable evaluates a schedule's fire times in its time zone
+type Timetable struct {
+	cron       *CronExpression
+	location   *time.Location
+	policy     DSTPolicy
+	constraint Constraint
+	calendars  []*Calendar
+}
+
+// NewTimetable builds a timetable for a schedule using the given exclusion calendars
+func NewTimetable(schedule *Schedule, calendars []*Calendar) (*Timetable, error) {
+	cron, err := ParseCron(schedule.CronExpression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", schedule.TimeZone, err)
+	}
+
+	return &Timetable{
+		cron:       cron,
+		location:   location,
+		policy:     schedule.DSTPolicy,
+		constraint: schedule.Constraint,
+		calendars:  calendars,
+	}, nil
+}
+
+// Next returns the first fire time strictly after the given instant
+func (t *Timetable) Next(after time.Time) (time.Time, bool) {
+	local := after.In(t.location)
+	// Start one day early so fire times of the previous local date that fall
+	// after the instant because of an offset change are not missed
+	day := time.Date(local.Year(), local.Month(), local.Day()-1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < maxSearchDays; i++ {
+		for _, fire := range t.fireTimesOn(day) {
+			if fire.After(after) {
+				return fire, true
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return time.Time{}, false
+}
+
+// NextN returns up to n fire times strictly after the given instant
+func (t *Timetable) NextN(after time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	cursor := after
+	for len(times) < n {
+		next, ok := t.Next(cursor)
+		if !ok {
+			break
+		}
+		times = append(times, next)
+		cursor = next
+	}
+	return times
+}
+
+// Between returns all fire times in the half-open interval (from, to]
+func (t *Timetable) Between(from, to time.Time) []time.Time {
+	times := make([]time.Time, 0)
+	cursor := from
+	for {
+		next, ok := t.Next(cursor)
+		if !ok || next.After(to) {
+			return times
+		}
+		times = append(times, next)
+		cursor = next
+	}
+}
+
+// Last returns the n latest fire times in the half-open interval (from, to],
+// or all of them when n is zero, without keeping the earlier ones
+func (t *Timetable) Last(from, to time.Time, n int) []time.Time {
+	if n <= 0 {
+		return t.Between(from, to)
+	}
+
+	times := make([]time.Time, 0, n)
+	cursor := from
+	for {
+		next, ok := t.Next(cursor)
+		if !ok || next.After(to) {
+			return times
+		}
+		if len(times) == n {
+			copy(times, times[1:])
+			times = times[:n-1]
+		}
+		times = append(times, next)
+		cursor = next
+	}
+}
+
+// fireTimesOn returns the sorted fire instants for a local calendar date.
+// The date is passed as a UTC midnight value carrying only year, month and day.
+func (t *Timetable) fireTimesOn(day time.Time) []time.Time {
+	if !t.cron.matchesDay(int(day.Month()), day.Day(), int(day.Weekday())) {
+		return nil
+	}
+	if !t.dayAllowed(day) {
+		return nil
+	}
+
+	seen := make(map[int64]bool)
+	fires := make([]time.Time, 0)
+	for _, hm := range t.cron.wallTimes() {
+		wall := time.Date(day.Year(), day.Month(), day.Day(), hm[0], hm[1], 0, 0, time.UTC)
+		for _, instant := range t.resolve(wall) {
+			if !seen[instant.Unix()] {
+				seen[instant.Unix()] = true
+				fires = append(fires, instant)
+			}
+		}
+	}
+
+	sort.Slice(fires, func(i, j int) bool { return fires[i].Before(fires[j]) })
+	return fires
+}
+
+// resolve maps a local wall-clock time (expressed in UTC fields) to the
+// instants it denotes in the timetable's zone, applying the DST policy
+func (t *Timetable) resolve(wall time.Time) []time.Time {
+	// Collect the offsets in effect around the wall time; DST transitions
+	// never happen more than once within this window
+	offsets := make([]int, 0, 2)
+	for _, probe := range []time.Time{wall.Add(-24 * time.Hour), wall.Add(24 * time.Hour)} {
+		_, offset := probe.In(t.location).Zone()
+		if len(offsets) == 0 || offsets[0] != offset {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	candidates := make([]time.Time, 0, 2)
+	for _, offset := range offsets {
+		instant := wall.Add(-time.Duration(offset) * time.Second).In(t.location)
+		if sameWallClock(instant, wall) {
+			candidates = append(candidates, instant)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+	switch len(candidates) {
+	case 0:
+		// Spring-forward gap: the wall time does not exist
+		if t.policy.Gap == GapPolicySkip {
+			return nil
+		}
+		// Interpret the wall time with the offset in effect before the gap
+		return []time.Time{wall.Add(-time.Duration(offsets[0]) * time.Second).In(t.location)}
+	case 1:
+		return candidates
+	default:
+		// Fall-back overlap: the wall time occurs twice
+		switch t.policy.Overlap {
+		case OverlapPolicyLast:
+			return candidates[len(candidates)-1:]
+		case OverlapPolicyBoth:
+			return candidates
+		default:
+			return candidates[:1]
+		}
+	}
+}
+
+// dayAllowed applies exclusion calendars and the inclusion constraint to a local date
+func (t *Timetable) dayAllowed(day time.Time) bool {
+	if t.excluded(day) {
+		return false
+	}
+
+	switch t.constraint {
+	case ConstraintBusinessDay:
+		return t.isBusinessDay(day)
+	case ConstraintLastBusinessDayOfMonth:
+		if !t.isBusinessDay(day) {
+			return false
+		}
+		for next := day.AddDate(0, 0, 1); next.Month() == day.Month(); next = next.AddDate(0, 0, 1) {
+			if t.isBusinessDay(next) {
+				return false
+			}
+		}
+		return true
+	case ConstraintFirstBusinessDayOfMonth:
+		if !t.isBusinessDay(day) {
+			return false
+		}
+		for prev := day.AddDate(0, 0, -1); prev.Month() == day.Month(); prev = prev.AddDate(0, 0, -1) {
+			if t.isBusinessDay(prev) {
+				return false
+			}
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+// isBusinessDay reports whether a local date is a weekday not excluded by any calendar
+func (t *Timetable) isBusinessDay(day time.Time) bool {
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false
+	}
+	return !t.excluded(day)
+}
+
+func (t *Timetable) excluded(day time.Time) bool {
+	date := day.Format(DateLayout)
+	for _, calendar := range t.calendars {
+		if calendar.Contains(date) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameWallClock(instant, wall time.Time) bool {
+	return instant.Year() == wall.Year() &&
+		instant.Month() == wall.Month() &&
+		instant.Day() == wall.Day() &&
+		instant.Hour() == wall.Hour() &&
+		instant.Minute() == wall.Minute()
+}
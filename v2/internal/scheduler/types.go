@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DateLayout is the layout used for calendar dates
+const DateLayout = "2006-01-02"
+
+// GapPolicy controls fire times that fall into a DST spring-forward gap
+type GapPolicy string
+
+const (
+	// GapPolicySkip drops fire times that do not exist in the local zone
+	GapPolicySkip GapPolicy = "skip"
+	// GapPolicyShift fires at the instant the wall clock would have shown
+	// without the transition, e.g. 02:30 becomes 03:30 after a one hour jump
+	GapPolicyShift GapPolicy = "shift"
+)
+
+// OverlapPolicy controls fire times that occur twice during a DST fall-back
+type OverlapPolicy string
+
+const (
+	// OverlapPolicyFirst fires only on the first occurrence (daylight time)
+	OverlapPolicyFirst OverlapPolicy = "first"
+	// OverlapPolicyLast fires only on the second occurrence (standard time)
+	OverlapPolicyLast OverlapPolicy = "last"
+	// OverlapPolicyBoth fires on both occurrences
+	OverlapPolicyBoth OverlapPolicy = "both"
+)
+
+// DSTPolicy describes how daylight saving transitions are resolved
+type DSTPolicy struct {
+	Gap     GapPolicy     `json:"gap"`
+	Overlap OverlapPolicy `json:"overlap"`
+}
+
+// DefaultDSTPolicy returns the policy used when a schedule does not specify one
+func DefaultDSTPolicy() DSTPolicy {
+	return DSTPolicy{
+		Gap:     GapPolicyShift,
+		Overlap: OverlapPolicyFirst,
+	}
+}
+
+// Constraint restricts the days on which a schedule may fire
+type Constraint string
+
+const (
+	// ConstraintNone applies no inclusion constraint
+	ConstraintNone Constraint = ""
+	// ConstraintBusinessDay only fires on weekdays not excluded by a calendar
+	ConstraintBusinessDay Constraint = "business_day"
+	// ConstraintLastBusinessDayOfMonth only fires on the last business day of each month
+	ConstraintLastBusinessDayOfMonth Constraint = "last_business_day_of_month"
+	// ConstraintFirstBusinessDayOfMonth only fires on the first business day of each month
+	ConstraintFirstBusinessDayOfMonth Constraint = "first_business_day_of_month"
+)
+
+// MisfirePolicy controls how fire times missed while the scheduler was down are handled
+type MisfirePolicy string
+
+const (
+	// MisfirePolicyFireOnce runs a single catch-up execution for all missed fire times
+	MisfirePolicyFireOnce MisfirePolicy = "fire_once"
+	// MisfirePolicyFireAll runs one catch-up execution per missed fire time
+	MisfirePolicyFireAll MisfirePolicy = "fire_all"
+	// MisfirePolicySkip discards missed fire times
+	MisfirePolicySkip MisfirePolicy = "skip"
+)
+
+// Calendar is a named set of dates on which schedules referencing it do not fire
+type Calendar struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Dates       []string  `json:"dates"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate validates the calendar
+func (c *Calendar) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("calendar name is required")
+	}
+	for _, date := range c.Dates {
+		if _, err := time.Parse(DateLayout, date); err != nil {
+			return fmt.Errorf("invalid calendar date %q: expected YYYY-MM-DD", date)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether the calendar excludes the given local date
+func (c *Calendar) Contains(date string) bool {
+	for _, d := range c.Dates {
+		if d == date {
+			return true
+		}
+	}
+	return false
+}
+
+// Schedule fires a workflow according to a cron expression evaluated in a time zone
+type Schedule struct {
+	ID             uuid.UUID              `json:"id"`
+	WorkflowID     uuid.UUID              `json:"workflow_id"`
+	Name           string                 `json:"name"`
+	CronExpression string                 `json:"cron_expression"`
+	TimeZone       string                 `json:"time_zone"`
+	DSTPolicy      DSTPolicy              `json:"dst_policy"`
+	Calendars      []string               `json:"calendars,omitempty"`
+	Constraint     Constraint             `json:"constraint,omitempty"`
+	MisfirePolicy  MisfirePolicy          `json:"misfire_policy"`
+	Input          map[string]interface{} `json:"input,omitempty"`
+	Enabled        bool                   `json:"enabled"`
+	LastFireTime   *time.Time             `json:"last_fire_time,omitempty"`
+	NextFireTime   *time.Time             `json:"next_fire_time,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+}
+
+// Validate validates the schedule
+func (s *Schedule) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("schedule name is required")
+	}
+	if s.WorkflowID == uuid.Nil {
+		return fmt.Errorf("schedule workflow_id is required")
+	}
+	if _, err := ParseCron(s.CronExpression); err != nil {
+		return fmt.Errorf("invalid cron expression: %w", err)
+	}
+	if _, err := time.LoadLocation(s.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone %q: %w", s.TimeZone, err)
+	}
+
+	switch s.DSTPolicy.Gap {
+	case GapPolicySkip, GapPolicyShift:
+	default:
+		return fmt.Errorf("invalid DST gap policy: %s", s.DSTPolicy.Gap)
+	}
+	switch s.DSTPolicy.Overlap {
+	case OverlapPolicyFirst, OverlapPolicyLast, OverlapPolicyBoth:
+	default:
+		return fmt.Errorf("invalid DST overlap policy: %s", s.DSTPolicy.Overlap)
+	}
+	switch s.Constraint {
+	case ConstraintNone, ConstraintBusinessDay, ConstraintLastBusinessDayOfMonth, ConstraintFirstBusinessDayOfMonth:
+	default:
+		return fmt.Errorf("invalid schedule constraint: %s", s.Constraint)
+	}
+	switch s.MisfirePolicy {
+	case MisfirePolicyFireOnce, MisfirePolicyFireAll, MisfirePolicySkip:
+	default:
+		return fmt.Errorf("invalid misfire policy: %s", s.MisfirePolicy)
+	}
+
+	return nil
+}
+
+// applyDefaults fills in optional fields left empty by the caller
+func (s *Schedule) applyDefaults() {
+	if s.TimeZone == "" {
+		s.TimeZone = "UTC"
+	}
+	defaults := DefaultDSTPolicy()
+	if s.DSTPolicy.Gap == "" {
+		s.DSTPolicy.Gap = defaults.Gap
+	}
+	if s.DSTPolicy.Overlap == "" {
+		s.DSTPolicy.Overlap = defaults.Overlap
+	}
+	if s.MisfirePolicy == "" {
+		s.MisfirePolicy = MisfirePolicyFireOnce
+	}
+}
+
+// ReferencesCalendar reports whether the schedule uses the named calendar
+func (s *Schedule) ReferencesCalendar(name string) bool {
+	for _, c := range s.Calendars {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ScheduleDetail is a schedule together with its upcoming fire times
+type ScheduleDetail struct {
+	*Schedule
+	UpcomingFireTimes []time.Time `json:"upcoming_fire_times"`
+}
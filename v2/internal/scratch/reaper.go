@@ -0,0 +1,230 @@
+package scratch
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// Config configures the cleanup of scratch areas
+type Config struct {
+	// GracePeriod is how long the area of an execution is kept once the
+	// execution ended, for steps reading it after the fact such as those of
+	// a replay
+	GracePeriod time.Duration
+	// DebugSampleEvery retains the area of one in DebugSampleEvery
+	// executions for DebugRetention, so the files of failures can be
+	// inspected. Zero samples none.
+	DebugSampleEvery int
+	// DebugRetention is how long the area of a sampled execution is kept
+	// once the execution ended
+	DebugRetention time.Duration
+	// CleanupInterval is how often the areas of ended executions are removed
+	CleanupInterval time.Duration
+}
+
+// DefaultConfig returns the default scratch config
+func DefaultConfig() Config {
+	return Config{
+		GracePeriod:     time.Hour,
+		DebugRetention:  7 * 24 * time.Hour,
+		CleanupInterval: 10 * time.Minute,
+	}
+}
+
+// ExecutionStore reads the executions scratch areas belong to. GetByID
+// returns gorm.ErrRecordNotFound for unknown executions.
+type ExecutionStore interface {
+	GetByID(id uuid.UUID) (*models.Execution, error)
+}
+
+// MetricsRecorder records the scratch_reclaimed_bytes_total and
+// scratch_areas_removed_total metrics. It is satisfied by the engine metrics
+// collector.
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// Sweep is the outcome of a cleanup
+type Sweep struct {
+	Removed        int   `json:"removed"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	Retained       int   `json:"retained"`
+}
+
+// Reaper removes the scratch areas of the executions that ended more than
+// the grace period ago, and those of executions that no longer exist
+type Reaper struct {
+	space      *Space
+	executions ExecutionStore
+	config     Config
+	metrics    MetricsRecorder
+	logger     *logrus.Logger
+	now        func() time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewReaper creates the cleanup job of a scratch space
+func NewReaper(space *Space, executions ExecutionStore, config Config, logger *logrus.Logger) *Reaper {
+	defaults := DefaultConfig()
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = defaults.CleanupInterval
+	}
+	return &Reaper{
+		space:      space,
+		executions: executions,
+		config:     config,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// SetMetrics sets the recorder of the cleanup metrics
+func (r *Reaper) SetMetrics(metrics MetricsRecorder) {
+	r.metrics = metrics
+}
+
+// Sampled reports whether the scratch area of an execution is retained for
+// debugging. Executions are sampled by ID, so every node agrees on them
+// without coordination.
+func Sampled(executionID uuid.UUID, every int) bool {
+	if every <= 0 {
+		return false
+	}
+	hash := fnv.New32a()
+	hash.Write(executionID[:])
+	return hash.Sum32()%uint32(every) == 0
+}
+
+// Sweep removes the areas due for removal. Areas of running executions are
+// kept, and so are the areas of unknown executions modified within the
+// grace period, whose execution may not be stored yet.
+func (r *Reaper) Sweep(ctx context.Context) (Sweep, error) {
+	var sweep Sweep
+	areas, err := r.space.Areas()
+	if err != nil {
+		return sweep, err
+	}
+
+	now := r.now()
+	for _, area := range areas {
+		if ctx.Err() != nil {
+			return sweep, ctx.Err()
+		}
+
+		reason, retained, err := r.due(area, now)
+		if err != nil {
+			r.logger.WithError(err).WithField("execution_id", area.ExecutionID).Warn("Failed to check scratch area")
+			continue
+		}
+		if retained {
+			sweep.Retained++
+		}
+		if reason == "" {
+			continue
+		}
+
+		reclaimed, err := r.space.Remove(area.ExecutionID)
+		if err != nil {
+			r.logger.WithError(err).WithField("execution_id", area.ExecutionID).Warn("Failed to remove scratch area")
+			continue
+		}
+		sweep.Removed++
+		sweep.ReclaimedBytes += reclaimed
+		if r.metrics != nil {
+			labels := map[string]string{"reason": reason}
+			r.metrics.RecordMetric("scratch_areas_removed_total", 1, labels)
+			r.metrics.RecordMetric("scratch_reclaimed_bytes_total", float64(reclaimed), labels)
+		}
+		r.logger.WithFields(logrus.Fields{
+			"execution_id":    area.ExecutionID,
+			"reason":          reason,
+			"reclaimed_bytes": reclaimed,
+		}).Debug("Removed scratch area")
+	}
+	return sweep, nil
+}
+
+// due returns why an area is due for removal, ended or orphaned, or an
+// empty reason when it is kept. retained reports the areas kept only
+// because their execution is sampled for debugging.
+func (r *Reaper) due(area Area, now time.Time) (string, bool, error) {
+	execution, err := r.executions.GetByID(area.ExecutionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if now.Sub(area.ModifiedAt) < r.config.GracePeriod {
+			return "", false, nil
+		}
+		return "orphaned", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	endedAt, ended := endOf(execution)
+	if !ended || now.Sub(endedAt) < r.config.GracePeriod {
+		return "", false, nil
+	}
+	if Sampled(execution.ID, r.config.DebugSampleEvery) && now.Sub(endedAt) < r.config.DebugRetention {
+		return "", true, nil
+	}
+	return "ended", false, nil
+}
+
+// endOf returns when an execution reached a terminal state, and whether it
+// did
+func endOf(execution *models.Execution) (time.Time, bool) {
+	switch execution.Status {
+	case models.ExecutionStatusCompleted, models.ExecutionStatusCompletedWithWarnings,
+		models.ExecutionStatusFailed, models.ExecutionStatusCancelled, models.ExecutionStatusTimeout:
+	default:
+		return time.Time{}, false
+	}
+	if execution.CompletedAt != nil {
+		return *execution.CompletedAt, true
+	}
+	return execution.UpdatedAt, true
+}
+
+// Start sweeps the space every cleanup interval until stopped
+func (r *Reaper) Start(ctx context.Context) {
+	r.stopCh = make(chan struct{})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.config.CleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := r.Sweep(ctx); err != nil {
+					r.logger.WithError(err).Error("Failed to clean scratch areas up")
+				}
+			case <-r.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops sweeping the space
+func (r *Reaper) Stop() {
+	if r.stopCh == nil {
+		return
+	}
+	close(r.stopCh)
+	r.wg.Wait()
+	r.stopCh = nil
+}
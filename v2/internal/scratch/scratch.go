@@ -0,0 +1,356 @@
+// Package scratch gives each execution a scratch area: temporary files its
+// steps share, such as intermediate results, kept apart from artifacts and
+// removed once the execution ended
+package scratch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrFull is returned when a write would take the files of an execution
+	// over the size cap of its area
+	ErrFull = errors.New("scratch area full")
+	// ErrNotFound is returned when reading a file missing from an area
+	ErrNotFound = errors.New("scratch file not found")
+	// ErrInvalidName is returned for file names that are not a plain name
+	ErrInvalidName = errors.New("invalid scratch file name")
+)
+
+// tmpPrefix prefixes the files being written, which are not listed
+const tmpPrefix = ".tmp-"
+
+// File describes a file of a scratch area
+type File struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// Space holds the scratch areas of executions, one directory per execution
+// ID. The files of an execution hold at most maxBytes, counting the files
+// being written, so concurrent writes cannot exceed the cap together.
+type Space struct {
+	dir      string
+	maxBytes int64
+
+	mu sync.Mutex
+	// usage is the size of the files of the areas in use, loaded from their
+	// directory when first used
+	usage map[uuid.UUID]int64
+}
+
+// NewSpace creates the scratch space of the areas kept in dir, creating it
+// if needed. maxBytes caps the size of the files of each execution, 0 for
+// no cap.
+func NewSpace(dir string, maxBytes int64) (*Space, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	return &Space{
+		dir:      dir,
+		maxBytes: maxBytes,
+		usage:    make(map[uuid.UUID]int64),
+	}, nil
+}
+
+// Put streams the content of a reader into a file of the area of an
+// execution, replacing the file of the same name. The file is only visible
+// once written entirely; writes taking the area over its cap fail with
+// ErrFull and leave the previous file in place.
+func (s *Space) Put(ctx context.Context, executionID uuid.UUID, name string, r io.Reader) (File, error) {
+	path, err := s.path(executionID, name)
+	if err != nil {
+		return File{}, err
+	}
+	if err := s.load(executionID); err != nil {
+		return File{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return File{}, fmt.Errorf("failed to create scratch area: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), tmpPrefix+"*")
+	if err != nil {
+		return File{}, fmt.Errorf("failed to write scratch file %s: %w", name, err)
+	}
+
+	writer := &cappedWriter{space: s, executionID: executionID, file: file}
+	if _, err := io.Copy(writer, r); err != nil {
+		writer.discard()
+		if errors.Is(err, ErrFull) {
+			return File{}, err
+		}
+		return File{}, fmt.Errorf("failed to write scratch file %s: %w", name, err)
+	}
+	if err := file.Close(); err != nil {
+		writer.discard()
+		return File{}, fmt.Errorf("failed to write scratch file %s: %w", name, err)
+	}
+
+	// The replaced file no longer counts against the cap
+	var replaced int64
+	if stat, err := os.Stat(path); err == nil {
+		replaced = stat.Size()
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		writer.discard()
+		return File{}, fmt.Errorf("failed to write scratch file %s: %w", name, err)
+	}
+	s.release(executionID, replaced)
+	return File{Name: name, Size: writer.size, ModifiedAt: time.Now().UTC()}, nil
+}
+
+// Open opens a file of the area of an execution
+func (s *Space) Open(ctx context.Context, executionID uuid.UUID, name string) (*os.File, error) {
+	path, err := s.path(executionID, name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scratch file %s: %w", name, err)
+	}
+	return file, nil
+}
+
+// ReadAll reads a file of the area of an execution holding at most limit
+// bytes, 0 accepting any size
+func (s *Space) ReadAll(ctx context.Context, executionID uuid.UUID, name string, limit int64) ([]byte, error) {
+	file, err := s.Open(ctx, executionID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scratch file %s: %w", name, err)
+	}
+	if limit > 0 && stat.Size() > limit {
+		return nil, fmt.Errorf("scratch file %s holds %d bytes, more than the limit of %d", name, stat.Size(), limit)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scratch file %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// List returns the files of the area of an execution, sorted by name. The
+// area of an execution that wrote no file is empty.
+func (s *Space) List(ctx context.Context, executionID uuid.UUID) ([]File, error) {
+	entries, err := os.ReadDir(s.area(executionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return []File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scratch area: %w", err)
+	}
+
+	files := make([]File, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), tmpPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, File{Name: entry.Name(), Size: info.Size(), ModifiedAt: info.ModTime().UTC()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// Delete removes a file of the area of an execution
+func (s *Space) Delete(ctx context.Context, executionID uuid.UUID, name string) error {
+	path, err := s.path(executionID, name)
+	if err != nil {
+		return err
+	}
+	if err := s.load(executionID); err != nil {
+		return err
+	}
+	stat, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete scratch file %s: %w", name, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to delete scratch file %s: %w", name, err)
+	}
+	s.release(executionID, stat.Size())
+	return nil
+}
+
+// Usage returns the size of the files of the area of an execution,
+// including those being written
+func (s *Space) Usage(executionID uuid.UUID) (int64, error) {
+	if err := s.load(executionID); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[executionID], nil
+}
+
+// Area describes the scratch area of an execution
+type Area struct {
+	ExecutionID uuid.UUID
+	// ModifiedAt is when a file of the area was last added or removed
+	ModifiedAt time.Time
+}
+
+// Areas returns the scratch areas of the space
+func (s *Space) Areas() ([]Area, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scratch areas: %w", err)
+	}
+	var areas []Area
+	for _, entry := range entries {
+		executionID, err := uuid.Parse(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		areas = append(areas, Area{ExecutionID: executionID, ModifiedAt: info.ModTime()})
+	}
+	return areas, nil
+}
+
+// Remove removes the area of an execution with its files, returning the
+// number of bytes reclaimed
+func (s *Space) Remove(executionID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	area := s.area(executionID)
+	size, err := areaSize(area, true)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.RemoveAll(area); err != nil {
+		return 0, fmt.Errorf("failed to remove scratch area of execution %s: %w", executionID, err)
+	}
+	delete(s.usage, executionID)
+	return size, nil
+}
+
+// load loads the usage of an area from its directory, when first used
+func (s *Space) load(executionID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, loaded := s.usage[executionID]; loaded {
+		return nil
+	}
+	size, err := areaSize(s.area(executionID), false)
+	if err != nil {
+		return err
+	}
+	s.usage[executionID] = size
+	return nil
+}
+
+// reserve counts n more bytes against the cap of an area
+func (s *Space) reserve(executionID uuid.UUID, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.usage[executionID]
+	if s.maxBytes > 0 && usage+n > s.maxBytes {
+		return fmt.Errorf("%w: execution %s cannot hold more than %d bytes of scratch files", ErrFull, executionID, s.maxBytes)
+	}
+	s.usage[executionID] = usage + n
+	return nil
+}
+
+// release stops counting n bytes against the cap of an area
+func (s *Space) release(executionID uuid.UUID, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if usage, loaded := s.usage[executionID]; loaded {
+		s.usage[executionID] = usage - n
+	}
+}
+
+func (s *Space) area(executionID uuid.UUID) string {
+	return filepath.Join(s.dir, executionID.String())
+}
+
+// path returns the file of a name in the area of an execution, rejecting
+// names that are not a plain file name
+func (s *Space) path(executionID uuid.UUID, name string) (string, error) {
+	if name == "" || filepath.Base(name) != name || name == "." || name == ".." || strings.HasPrefix(name, tmpPrefix) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return filepath.Join(s.area(executionID), name), nil
+}
+
+// areaSize returns the size of the files of an area directory. Files left
+// being written by a previous run only count with partial.
+func areaSize(area string, partial bool) (int64, error) {
+	entries, err := os.ReadDir(area)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read scratch area: %w", err)
+	}
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() || (!partial && strings.HasPrefix(entry.Name(), tmpPrefix)) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// cappedWriter writes a scratch file, reserving each chunk against the cap
+// of its area before writing it
+type cappedWriter struct {
+	space       *Space
+	executionID uuid.UUID
+	file        *os.File
+	size        int64
+}
+
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	if err := w.space.reserve(w.executionID, int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if n < len(p) {
+		w.space.release(w.executionID, int64(len(p)-n))
+	}
+	return n, err
+}
+
+// discard removes the file being written and releases its bytes
+func (w *cappedWriter) discard() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+	w.space.release(w.executionID, w.size)
+}
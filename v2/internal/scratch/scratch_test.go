@@ -0,0 +1,295 @@
+package scratch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func newSpace(t *testing.T, maxBytes int64) *Space {
+	space, err := NewSpace(filepath.Join(t.TempDir(), "scratch"), maxBytes)
+	require.NoError(t, err)
+	return space
+}
+
+func TestSpaceFiles(t *testing.T) {
+	ctx := context.Background()
+	space := newSpace(t, 0)
+	executionID := uuid.New()
+
+	file, err := space.Put(ctx, executionID, "rows.json", strings.NewReader(`[1,2,3]`))
+	require.NoError(t, err)
+	assert.Equal(t, "rows.json", file.Name)
+	assert.Equal(t, int64(7), file.Size)
+	_, err = space.Put(ctx, executionID, "summary.txt", strings.NewReader("done"))
+	require.NoError(t, err)
+
+	data, err := space.ReadAll(ctx, executionID, "rows.json", 0)
+	require.NoError(t, err)
+	assert.Equal(t, `[1,2,3]`, string(data))
+	_, err = space.ReadAll(ctx, executionID, "rows.json", 4)
+	assert.Error(t, err)
+
+	files, err := space.List(ctx, executionID)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "rows.json", files[0].Name)
+	assert.Equal(t, "summary.txt", files[1].Name)
+
+	require.NoError(t, space.Delete(ctx, executionID, "rows.json"))
+	_, err = space.Open(ctx, executionID, "rows.json")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, space.Delete(ctx, executionID, "rows.json"), ErrNotFound)
+
+	for _, name := range []string{"", "../escape", "a/b", "..", ".tmp-1"} {
+		_, err := space.Put(ctx, executionID, name, strings.NewReader("x"))
+		assert.ErrorIs(t, err, ErrInvalidName, "name %q", name)
+	}
+}
+
+func TestSpaceSizeCap(t *testing.T) {
+	ctx := context.Background()
+	space := newSpace(t, 10)
+	executionID := uuid.New()
+
+	_, err := space.Put(ctx, executionID, "a", strings.NewReader("123456"))
+	require.NoError(t, err)
+
+	// A write over the cap fails cleanly: nothing is left behind
+	_, err = space.Put(ctx, executionID, "b", strings.NewReader("123456"))
+	assert.ErrorIs(t, err, ErrFull)
+	_, err = space.Open(ctx, executionID, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+	usage, err := space.Usage(executionID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), usage)
+	entries, err := os.ReadDir(filepath.Join(space.dir, executionID.String()))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// A failed replacement keeps the previous file
+	_, err = space.Put(ctx, executionID, "a", strings.NewReader("12345678901"))
+	assert.ErrorIs(t, err, ErrFull)
+	data, err := space.ReadAll(ctx, executionID, "a", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "123456", string(data))
+
+	// Replacing or deleting a file frees its bytes
+	_, err = space.Put(ctx, executionID, "a", strings.NewReader("1234"))
+	require.NoError(t, err)
+	_, err = space.Put(ctx, executionID, "b", strings.NewReader("123456"))
+	require.NoError(t, err)
+	require.NoError(t, space.Delete(ctx, executionID, "a"))
+	_, err = space.Put(ctx, executionID, "c", strings.NewReader("1234"))
+	require.NoError(t, err)
+
+	// The usage of an area is loaded from its files after a restart
+	restarted, err := NewSpace(space.dir, 10)
+	require.NoError(t, err)
+	usage, err = restarted.Usage(executionID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), usage)
+	_, err = restarted.Put(ctx, executionID, "d", strings.NewReader("1"))
+	assert.ErrorIs(t, err, ErrFull)
+}
+
+// slowReader returns its content one byte at a time, so concurrent writes
+// interleave
+type slowReader struct {
+	remaining int
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	r.remaining--
+	p[0] = 'x'
+	time.Sleep(time.Microsecond)
+	return 1, nil
+}
+
+func TestSpaceIsolatesExecutions(t *testing.T) {
+	ctx := context.Background()
+	space := newSpace(t, 100)
+	first, second := uuid.New(), uuid.New()
+
+	// Concurrent writes of one execution share its cap, those of another
+	// execution do not count against it
+	type outcome struct {
+		executionID uuid.UUID
+		err         error
+	}
+	var wg sync.WaitGroup
+	outcomes := make(chan outcome, 8)
+	for i := 0; i < 4; i++ {
+		for _, executionID := range []uuid.UUID{first, second} {
+			wg.Add(1)
+			go func(executionID uuid.UUID, i int) {
+				defer wg.Done()
+				_, err := space.Put(ctx, executionID, string(rune('a'+i)), &slowReader{remaining: 40})
+				outcomes <- outcome{executionID: executionID, err: err}
+			}(executionID, i)
+		}
+	}
+	wg.Wait()
+	close(outcomes)
+
+	written := map[uuid.UUID]int{}
+	for outcome := range outcomes {
+		if !errors.Is(outcome.err, ErrFull) {
+			require.NoError(t, outcome.err)
+			written[outcome.executionID]++
+		}
+	}
+	for _, executionID := range []uuid.UUID{first, second} {
+		// At most two of the four 40 byte files fit the cap
+		assert.LessOrEqual(t, written[executionID], 2)
+		files, err := space.List(ctx, executionID)
+		require.NoError(t, err)
+		assert.Len(t, files, written[executionID])
+		usage, err := space.Usage(executionID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(40*written[executionID]), usage)
+
+		// The bytes of the failed writes were released
+		_, err = space.Put(ctx, executionID, "rest", strings.NewReader(strings.Repeat("x", int(100-usage))))
+		require.NoError(t, err)
+	}
+
+	// Files of one execution are invisible to the other
+	require.NoError(t, space.Delete(ctx, first, "rest"))
+	_, err := space.Put(ctx, first, "shared", strings.NewReader("first"))
+	require.NoError(t, err)
+	_, err = space.Open(ctx, second, "shared")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// fakeExecutions is an ExecutionStore over a map
+type fakeExecutions map[uuid.UUID]*models.Execution
+
+func (f fakeExecutions) GetByID(id uuid.UUID) (*models.Execution, error) {
+	execution, exists := f[id]
+	if !exists {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return execution, nil
+}
+
+type recordingMetrics struct {
+	values map[string]float64
+}
+
+func (m *recordingMetrics) RecordMetric(name string, value float64, labels map[string]string) {
+	m.values[name+"/"+labels["reason"]] += value
+}
+
+func TestReaperRemovesEndedExecutions(t *testing.T) {
+	ctx := context.Background()
+	space := newSpace(t, 0)
+	now := time.Now()
+	completedAt := now.Add(-2 * time.Hour)
+	recentlyCompletedAt := now.Add(-time.Minute)
+
+	completed := &models.Execution{ID: uuid.New(), Status: models.ExecutionStatusCompleted, CompletedAt: &completedAt}
+	recent := &models.Execution{ID: uuid.New(), Status: models.ExecutionStatusFailed, CompletedAt: &recentlyCompletedAt}
+	running := &models.Execution{ID: uuid.New(), Status: models.ExecutionStatusRunning}
+	orphaned := uuid.New()
+	executions := fakeExecutions{completed.ID: completed, recent.ID: recent, running.ID: running}
+	for _, executionID := range []uuid.UUID{completed.ID, recent.ID, running.ID, orphaned} {
+		_, err := space.Put(ctx, executionID, "data", strings.NewReader("0123456789"))
+		require.NoError(t, err)
+	}
+	// The area of the unknown execution was last written long ago
+	old := now.Add(-3 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(space.dir, orphaned.String()), old, old))
+
+	logger, _ := test.NewNullLogger()
+	reaper := NewReaper(space, executions, Config{GracePeriod: time.Hour}, logger)
+	reaper.now = func() time.Time { return now }
+	metrics := &recordingMetrics{values: map[string]float64{}}
+	reaper.SetMetrics(metrics)
+
+	sweep, err := reaper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Sweep{Removed: 2, ReclaimedBytes: 20}, sweep)
+	assert.Equal(t, 10.0, metrics.values["scratch_reclaimed_bytes_total/ended"])
+	assert.Equal(t, 10.0, metrics.values["scratch_reclaimed_bytes_total/orphaned"])
+	assert.Equal(t, 1.0, metrics.values["scratch_areas_removed_total/ended"])
+
+	areas, err := space.Areas()
+	require.NoError(t, err)
+	var kept []uuid.UUID
+	for _, area := range areas {
+		kept = append(kept, area.ExecutionID)
+	}
+	assert.ElementsMatch(t, []uuid.UUID{recent.ID, running.ID}, kept)
+	usage, err := space.Usage(completed.ID)
+	require.NoError(t, err)
+	assert.Zero(t, usage)
+
+	// Areas of new executions not stored yet are kept
+	_, err = space.Put(ctx, uuid.New(), "data", strings.NewReader("x"))
+	require.NoError(t, err)
+	sweep, err = reaper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sweep.Removed)
+}
+
+func TestReaperRetainsSampledExecutions(t *testing.T) {
+	ctx := context.Background()
+	space := newSpace(t, 0)
+	now := time.Now()
+	completedAt := now.Add(-2 * time.Hour)
+
+	// Find an execution sampled one in three times and one that is not
+	var sampled, unsampled *models.Execution
+	for sampled == nil || unsampled == nil {
+		execution := &models.Execution{ID: uuid.New(), Status: models.ExecutionStatusFailed, CompletedAt: &completedAt}
+		if Sampled(execution.ID, 3) {
+			sampled = execution
+		} else {
+			unsampled = execution
+		}
+	}
+	assert.False(t, Sampled(sampled.ID, 0))
+	for _, executionID := range []uuid.UUID{sampled.ID, unsampled.ID} {
+		_, err := space.Put(ctx, executionID, "data", strings.NewReader("x"))
+		require.NoError(t, err)
+	}
+
+	logger, _ := test.NewNullLogger()
+	reaper := NewReaper(space, fakeExecutions{sampled.ID: sampled, unsampled.ID: unsampled}, Config{
+		GracePeriod:      time.Hour,
+		DebugSampleEvery: 3,
+		DebugRetention:   24 * time.Hour,
+	}, logger)
+	reaper.now = func() time.Time { return now }
+
+	sweep, err := reaper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Sweep{Removed: 1, ReclaimedBytes: 1, Retained: 1}, sweep)
+	files, err := space.List(ctx, sampled.ID)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// Sampled areas are removed once the debug retention elapsed too
+	reaper.now = func() time.Time { return now.Add(24 * time.Hour) }
+	sweep, err = reaper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Sweep{Removed: 1, ReclaimedBytes: 1}, sweep)
+}
@@ -0,0 +1,78 @@
+package scripting
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	hostCallPattern       = regexp.MustCompile(`\bmf\s*\.\s*([A-Za-z_$][\w$]*(?:\s*\.\s*[A-Za-z_$][\w$]*)?)`)
+	dynamicHostPattern    = regexp.MustCompile(`\bmf\s*\[`)
+	requirePattern        = regexp.MustCompile(`\brequire\s*\(\s*['"]([^'"]+)['"]\s*\)`)
+	dynamicRequirePattern = regexp.MustCompile(`\brequire\s*\(\s*[^'"\s)]`)
+)
+
+// Analysis is what static analysis could learn about a script. Dynamic host
+// access and dynamic requires cannot be checked statically and are enforced
+// at runtime only.
+type Analysis struct {
+	HostFunctions     []string `json:"host_functions"`
+	Requires          []string `json:"requires"`
+	DynamicHostAccess bool     `json:"dynamic_host_access"`
+	DynamicRequire    bool     `json:"dynamic_require"`
+}
+
+// Analyze scans script source for host function references and module
+// requires
+func Analyze(source string) Analysis {
+	return Analysis{
+		HostFunctions:     uniqueMatches(hostCallPattern, source),
+		Requires:          uniqueMatches(requirePattern, source),
+		DynamicHostAccess: dynamicHostPattern.MatchString(source),
+		DynamicRequire:    dynamicRequirePattern.MatchString(source),
+	}
+}
+
+// CheckHostFunctions returns a CodeHostFunctionDenied error for the first
+// host function referenced by the analysis that is not allowed
+func CheckHostFunctions(analysis Analysis, allowed []string) error {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allowedSet[name] = true
+	}
+	for _, name := range analysis.HostFunctions {
+		if !hostAllowed(allowedSet, name) {
+			return hostFunctionDenied(name)
+		}
+	}
+	return nil
+}
+
+// hostAllowed reports whether a host function is allowed. Allowing a
+// namespace, such as scratch, allows its functions, such as scratch.put,
+// and a property of an allowed function, such as log.call, is allowed.
+func hostAllowed(allowed map[string]bool, name string) bool {
+	if allowed[name] {
+		return true
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		return allowed[name[:i]]
+	}
+	return false
+}
+
+func uniqueMatches(pattern *regexp.Regexp, source string) []string {
+	seen := make(map[string]bool)
+	var matches []string
+	for _, match := range pattern.FindAllStringSubmatch(source, -1) {
+		// Members of namespaces may be spaced out, as mf.scratch . put
+		name := strings.Join(strings.Fields(match[1]), "")
+		if !seen[name] {
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
@@ -0,0 +1,57 @@
+package scripting
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error codes of script step failures caused by the sandbox
+const (
+	// CodeHostFunctionDenied is returned when a script calls a host function
+	// missing from the workflow's allowlist
+	CodeHostFunctionDenied = "SCRIPT_HOST_FUNCTION_DENIED"
+	// CodeModuleNotPinned is returned when a script requires a module that was
+	// not pinned when the workflow version was created
+	CodeModuleNotPinned = "SCRIPT_MODULE_NOT_PINNED"
+	// CodeResourceLimit is returned when a script exceeds the memory, ops or
+	// time limits of its namespace
+	CodeResourceLimit = "STEP_RESOURCE_LIMIT"
+)
+
+// Error is a sandbox violation. Details carry machine readable context such
+// as the denied function or the usage that breached a limit.
+type Error struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ErrorCode returns the code of a sandbox error, or an empty string when err
+// is not one
+func ErrorCode(err error) string {
+	var scriptErr *Error
+	if errors.As(err, &scriptErr) {
+		return scriptErr.Code
+	}
+	return ""
+}
+
+func hostFunctionDenied(name string) *Error {
+	return &Error{
+		Code:    CodeHostFunctionDenied,
+		Message: fmt.Sprintf("host function mf.%s is not allowed for this workflow", name),
+		Details: map[string]interface{}{"function": name},
+	}
+}
+
+func moduleNotPinned(spec string) *Error {
+	return &Error{
+		Code:    CodeModuleNotPinned,
+		Message: fmt.Sprintf("module %s is not pinned for this workflow version", spec),
+		Details: map[string]interface{}{"module": spec},
+	}
+}
@@ -0,0 +1,172 @@
+// Package gojs runs script steps written in JavaScript with the goja engine
+package gojs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dop251/goja"
+
+	"magic-flow/v2/internal/scripting"
+)
+
+// Interpreter runs JavaScript script steps. Every run gets a fresh VM so no
+// globals leak between steps or workflows; VMs may be initialized ahead of
+// runs by the instance pool of the runtime.
+//
+// The step source is the body of a function receiving the step input as
+// input; its return value is the step output. Host functions are available
+// as mf.<name>, or mf.<namespace>.<function>, and pinned modules as
+// require('<spec>') using CommonJS module.exports.
+type Interpreter struct{}
+
+// New creates a JavaScript interpreter
+func New() *Interpreter {
+	return &Interpreter{}
+}
+
+func (i *Interpreter) Run(ctx context.Context, env *scripting.Environment, source string, input map[string]interface{}) (interface{}, error) {
+	return newInstance().Run(ctx, env, source, input)
+}
+
+// NewInstance initializes a VM ahead of a run, for the instance pool of the
+// runtime
+func (i *Interpreter) NewInstance() (scripting.Instance, error) {
+	return newInstance(), nil
+}
+
+// instance is a VM that has not run a script yet
+type instance struct {
+	vm *goja.Runtime
+}
+
+func newInstance() *instance {
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	return &instance{vm: vm}
+}
+
+// Reset reports false: VMs run a single script so no globals leak between
+// steps or workflows
+func (in *instance) Reset() bool {
+	return false
+}
+
+func (in *instance) Run(ctx context.Context, env *scripting.Environment, source string, input map[string]interface{}) (interface{}, error) {
+	vm := in.vm
+
+	// Interrupt the VM when the step is cancelled or its time limit expires
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			vm.Interrupt(ctx.Err())
+		case <-done:
+		}
+	}()
+
+	mf := vm.NewDynamicObject(&hostObject{ctx: ctx, vm: vm, env: env})
+	if err := vm.Set("mf", mf); err != nil {
+		return nil, err
+	}
+	loader := &moduleLoader{vm: vm, env: env, mf: mf, cache: make(map[string]goja.Value)}
+	if err := vm.Set("require", loader.require); err != nil {
+		return nil, err
+	}
+
+	wrapper, err := vm.RunScript("step", "(function(input) {\n"+source+"\n})")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile script: %w", err)
+	}
+	fn, ok := goja.AssertFunction(wrapper)
+	if !ok {
+		return nil, fmt.Errorf("failed to compile script")
+	}
+
+	result, err := fn(goja.Undefined(), vm.ToValue(input))
+	if err != nil {
+		return nil, fmt.Errorf("script failed: %w", err)
+	}
+	return result.Export(), nil
+}
+
+// hostObject is the mf object. Every property is a function routed through
+// the environment, so calls to functions missing from the allowlist fail
+// with the sandbox error code rather than a TypeError. Namespaces of host
+// functions are host objects whose functions are named after their prefix.
+type hostObject struct {
+	ctx    context.Context
+	vm     *goja.Runtime
+	env    *scripting.Environment
+	prefix string
+}
+
+func (h *hostObject) Get(key string) goja.Value {
+	name := h.prefix + key
+	if h.env.IsHostNamespace(name) {
+		return h.vm.NewDynamicObject(&hostObject{ctx: h.ctx, vm: h.vm, env: h.env, prefix: name + "."})
+	}
+	return h.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		args := make([]interface{}, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			args[i] = arg.Export()
+		}
+		result, err := h.env.CallHost(h.ctx, name, args)
+		if err != nil {
+			panic(h.vm.NewGoError(err))
+		}
+		return h.vm.ToValue(result)
+	})
+}
+
+func (h *hostObject) Set(key string, val goja.Value) bool { return false }
+
+func (h *hostObject) Has(key string) bool { return true }
+
+func (h *hostObject) Delete(key string) bool { return false }
+
+func (h *hostObject) Keys() []string { return nil }
+
+// moduleLoader implements require for pinned modules
+type moduleLoader struct {
+	vm    *goja.Runtime
+	env   *scripting.Environment
+	mf    goja.Value
+	cache map[string]goja.Value
+}
+
+func (l *moduleLoader) require(call goja.FunctionCall) goja.Value {
+	spec := call.Argument(0).String()
+	if exports, loaded := l.cache[spec]; loaded {
+		return exports
+	}
+
+	module, err := l.env.Require(spec)
+	if err != nil {
+		panic(l.vm.NewGoError(err))
+	}
+
+	wrapper, err := l.vm.RunScript(module.Ref(), "(function(module, exports, require, mf) {\n"+module.Source+"\n})")
+	if err != nil {
+		panic(l.vm.NewGoError(fmt.Errorf("module %s: %w", module.Ref(), err)))
+	}
+	fn, ok := goja.AssertFunction(wrapper)
+	if !ok {
+		panic(l.vm.NewGoError(fmt.Errorf("module %s: failed to compile", module.Ref())))
+	}
+
+	moduleObject := l.vm.NewObject()
+	exports := l.vm.NewObject()
+	_ = moduleObject.Set("exports", exports)
+	// Cache before running so that circular requires see partial exports
+	l.cache[spec] = exports
+
+	if _, err := fn(goja.Undefined(), moduleObject, exports, l.vm.Get("require"), l.mf); err != nil {
+		delete(l.cache, spec)
+		panic(l.vm.NewGoError(fmt.Errorf("module %s: %w", module.Ref(), err)))
+	}
+
+	l.cache[spec] = moduleObject.Get("exports")
+	return l.cache[spec]
+}
@@ -0,0 +1,135 @@
+package scripting
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers provides HTTP handlers for script modules
+type Handlers struct {
+	modules *ModuleRegistry
+}
+
+// NewHandlers creates new script module handlers
+func NewHandlers(modules *ModuleRegistry) *Handlers {
+	return &Handlers{modules: modules}
+}
+
+// RegisterRoutes registers script module routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		modules := v1.Group("/script-modules")
+		{
+			modules.GET("", h.ListModules)
+			modules.POST("", h.PublishModule)
+			modules.GET("/:name", h.ListModuleVersions)
+			modules.GET("/:name/:version", h.GetModule)
+		}
+	}
+}
+
+// PublishModuleRequest is the request body of a module publication
+type PublishModuleRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Version     string `json:"version" binding:"required"`
+	Source      string `json:"source" binding:"required"`
+	Description string `json:"description"`
+}
+
+// ListModules returns all published module versions
+// @Summary List script modules
+// @Tags script-modules
+// @Produce json
+// @Success 200 {array} Module
+// @Router /api/v1/script-modules [get]
+func (h *Handlers) ListModules(c *gin.Context) {
+	modules, err := h.modules.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, modules)
+}
+
+// PublishModule publishes a new version of a module. Published versions
+// cannot be changed.
+// @Summary Publish script module version
+// @Tags script-modules
+// @Accept json
+// @Produce json
+// @Param request body PublishModuleRequest true "Module version"
+// @Success 201 {object} Module
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/script-modules [post]
+func (h *Handlers) PublishModule(c *gin.Context) {
+	var req PublishModuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	module, err := h.modules.Publish(c.Request.Context(), req.Name, req.Version, req.Source, req.Description, c.GetHeader("X-User-ID"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInvalidModule):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrModuleVersionExists):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, module)
+}
+
+// ListModuleVersions returns the published versions of a module
+// @Summary List script module versions
+// @Tags script-modules
+// @Produce json
+// @Param name path string true "Module name"
+// @Success 200 {array} Module
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/script-modules/{name} [get]
+func (h *Handlers) ListModuleVersions(c *gin.Context) {
+	versions, err := h.modules.Versions(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrModuleNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetModule returns a module version
+// @Summary Get script module version
+// @Tags script-modules
+// @Produce json
+// @Param name path string true "Module name"
+// @Param version path string true "Module version"
+// @Success 200 {object} Module
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/script-modules/{name}/{version} [get]
+func (h *Handlers) GetModule(c *gin.Context) {
+	module, err := h.modules.Resolve(c.Request.Context(), c.Param("name")+"@"+c.Param("version"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrModuleNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, module)
+}
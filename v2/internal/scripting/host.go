@@ -0,0 +1,244 @@
+package scripting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/artifacts"
+	"magic-flow/v2/internal/correlation"
+	"magic-flow/v2/internal/scratch"
+)
+
+// HostFunction is a Go function exposed to scripts as mf.<name>, or as
+// mf.<namespace>.<function> when registered as <namespace>.<function>.
+// Arguments and results are plain JSON-like values.
+type HostFunction func(ctx context.Context, args []interface{}) (interface{}, error)
+
+// HostRegistry holds the host functions a sandbox can expose. Which of them
+// a script may call is decided per workflow by its allowlist.
+type HostRegistry struct {
+	mu        sync.RWMutex
+	functions map[string]HostFunction
+}
+
+// NewHostRegistry creates an empty host function registry
+func NewHostRegistry() *HostRegistry {
+	return &HostRegistry{functions: make(map[string]HostFunction)}
+}
+
+// Register exposes a host function under name, replacing any function
+// already registered under it
+func (r *HostRegistry) Register(name string, fn HostFunction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.functions[name] = fn
+}
+
+// Get returns the host function registered under name
+func (r *HostRegistry) Get(name string) (HostFunction, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, exists := r.functions[name]
+	return fn, exists
+}
+
+// IsNamespace reports whether functions are registered under name, as
+// <name>.<function>
+func (r *HostRegistry) IsNamespace(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for registered := range r.functions {
+		if strings.HasPrefix(registered, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the registered function names in sorted order
+func (r *HostRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.functions))
+	for name := range r.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultHostFunctions returns a registry with the built-in host functions:
+// mf.httpGet(url) and mf.log(message)
+func DefaultHostFunctions(logger *logrus.Logger) *HostRegistry {
+	registry := NewHostRegistry()
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	registry.Register("httpGet", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		if len(args) < 1 {
+			return nil, fmt.Errorf("httpGet requires a url")
+		}
+		url, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("httpGet url must be a string")
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		correlation.SetHeader(ctx, req.Header)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"status": resp.StatusCode,
+			"body":   string(body),
+		}, nil
+	})
+
+	registry.Register("log", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		correlation.Logger(ctx, logger).WithField("args", args).Info("Script log")
+		return nil, nil
+	})
+
+	return registry
+}
+
+// RegisterArtifactFunctions exposes mf.readArtifact(ref) to scripts, which
+// returns the content of an artifact as text. ref is a reference string or
+// a reference object, such as an input field extracted into an artifact.
+// Artifacts larger than maxBytes fail the call rather than being loaded
+// into the sandbox.
+func RegisterArtifactFunctions(registry *HostRegistry, store artifacts.Store, maxBytes int64) {
+	registry.Register("readArtifact", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		if len(args) < 1 {
+			return nil, fmt.Errorf("readArtifact requires an artifact reference")
+		}
+		ref, ok := artifacts.RefOf(args[0])
+		if !ok {
+			return nil, fmt.Errorf("readArtifact reference must be an artifact reference or reference object")
+		}
+
+		data, err := artifacts.ReadAll(ctx, store, ref, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	})
+}
+
+// RegisterScratchFunctions exposes the scratch area of the execution a
+// script runs in as mf.scratch.put(name, content), mf.scratch.get(name),
+// mf.scratch.list() and mf.scratch.delete(name). Content that is not text
+// is stored as JSON. Files larger than maxBytes fail get rather than being
+// loaded into the sandbox. executionID returns the execution of a step
+// context; scripts running outside an execution have no scratch area.
+func RegisterScratchFunctions(registry *HostRegistry, space *scratch.Space, maxBytes int64, executionID func(ctx context.Context) (uuid.UUID, bool)) {
+	area := func(ctx context.Context, function string) (uuid.UUID, error) {
+		id, ok := executionID(ctx)
+		if !ok {
+			return uuid.Nil, fmt.Errorf("scratch.%s is only available to steps of an execution", function)
+		}
+		return id, nil
+	}
+	fileName := func(function string, args []interface{}) (string, error) {
+		if len(args) < 1 {
+			return "", fmt.Errorf("scratch.%s requires a file name", function)
+		}
+		name, ok := args[0].(string)
+		if !ok {
+			return "", fmt.Errorf("scratch.%s file name must be a string", function)
+		}
+		return name, nil
+	}
+
+	registry.Register("scratch.put", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		id, err := area(ctx, "put")
+		if err != nil {
+			return nil, err
+		}
+		name, err := fileName("put", args)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) < 2 {
+			return nil, fmt.Errorf("scratch.put requires content")
+		}
+		content, ok := args[1].(string)
+		if !ok {
+			data, err := json.Marshal(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("scratch.put content cannot be encoded: %w", err)
+			}
+			content = string(data)
+		}
+
+		file, err := space.Put(ctx, id, name, strings.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"name": file.Name, "size": file.Size}, nil
+	})
+
+	registry.Register("scratch.get", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		id, err := area(ctx, "get")
+		if err != nil {
+			return nil, err
+		}
+		name, err := fileName("get", args)
+		if err != nil {
+			return nil, err
+		}
+		data, err := space.ReadAll(ctx, id, name, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	})
+
+	registry.Register("scratch.list", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		id, err := area(ctx, "list")
+		if err != nil {
+			return nil, err
+		}
+		files, err := space.List(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		listed := make([]interface{}, len(files))
+		for i, file := range files {
+			listed[i] = map[string]interface{}{"name": file.Name, "size": file.Size}
+		}
+		return listed, nil
+	})
+
+	registry.Register("scratch.delete", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		id, err := area(ctx, "delete")
+		if err != nil {
+			return nil, err
+		}
+		name, err := fileName("delete", args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, space.Delete(ctx, id, name)
+	})
+}
@@ -0,0 +1,141 @@
+package scripting
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limits bound the resources a single script step may use. Zero values mean
+// no limit.
+//
+// Ops count host function calls and module loads plus any operations the
+// interpreter charges itself. Memory counts the bytes of data entering and
+// leaving the sandbox: input, module sources, host function results and
+// output.
+type Limits struct {
+	MaxMemoryBytes int64         `json:"max_memory_bytes,omitempty"`
+	MaxOps         int64         `json:"max_ops,omitempty"`
+	Timeout        time.Duration `json:"timeout,omitempty"`
+}
+
+// LimitsConfig holds the default limits and per namespace overrides
+type LimitsConfig struct {
+	Default    Limits            `json:"default"`
+	Namespaces map[string]Limits `json:"namespaces,omitempty"`
+}
+
+// For returns the limits of a namespace. Limits the namespace leaves unset
+// fall back to the defaults.
+func (c LimitsConfig) For(namespace string) Limits {
+	limits := c.Default
+	override, exists := c.Namespaces[namespace]
+	if !exists {
+		return limits
+	}
+	if override.MaxMemoryBytes > 0 {
+		limits.MaxMemoryBytes = override.MaxMemoryBytes
+	}
+	if override.MaxOps > 0 {
+		limits.MaxOps = override.MaxOps
+	}
+	if override.Timeout > 0 {
+		limits.Timeout = override.Timeout
+	}
+	return limits
+}
+
+// Usage is the resource usage of a script run
+type Usage struct {
+	Ops         int64 `json:"ops"`
+	MemoryBytes int64 `json:"memory_bytes"`
+	DurationMS  int64 `json:"duration_ms"`
+}
+
+// Meter accounts the resources used by a script run against its limits
+type Meter struct {
+	mu     sync.Mutex
+	limits Limits
+	usage  Usage
+}
+
+// NewMeter creates a meter enforcing limits
+func NewMeter(limits Limits) *Meter {
+	return &Meter{limits: limits}
+}
+
+// ChargeOps records n operations and fails once MaxOps is exceeded
+func (m *Meter) ChargeOps(n int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage.Ops += n
+	if m.limits.MaxOps > 0 && m.usage.Ops > m.limits.MaxOps {
+		return m.limitError("ops", m.limits.MaxOps, m.usage.Ops)
+	}
+	return nil
+}
+
+// ChargeMemory records bytes of memory and fails once MaxMemoryBytes is
+// exceeded
+func (m *Meter) ChargeMemory(bytes int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage.MemoryBytes += bytes
+	if m.limits.MaxMemoryBytes > 0 && m.usage.MemoryBytes > m.limits.MaxMemoryBytes {
+		return m.limitError("memory", m.limits.MaxMemoryBytes, m.usage.MemoryBytes)
+	}
+	return nil
+}
+
+// ChargeValue records the memory of a value, estimated from its JSON size
+func (m *Meter) ChargeValue(value interface{}) error {
+	return m.ChargeMemory(sizeOf(value))
+}
+
+// Usage returns the usage recorded so far
+func (m *Meter) Usage() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// timeout reports a breach of the time limit after elapsed
+func (m *Meter) timeout(elapsed time.Duration) *Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage.DurationMS = elapsed.Milliseconds()
+	return m.limitError("time", m.limits.Timeout.Milliseconds(), elapsed.Milliseconds())
+}
+
+func (m *Meter) limitError(resource string, limit, used int64) *Error {
+	return &Error{
+		Code:    CodeResourceLimit,
+		Message: fmt.Sprintf("script exceeded its %s limit (%d of %d)", resource, used, limit),
+		Details: map[string]interface{}{
+			"resource": resource,
+			"limit":    limit,
+			"used":     used,
+			"usage":    m.usage,
+		},
+	}
+}
+
+func sizeOf(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
@@ -0,0 +1,309 @@
+package scripting
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrModuleNotFound is returned when no module matches a name or version
+	ErrModuleNotFound = errors.New("script module not found")
+	// ErrModuleVersionExists is returned when publishing a version that was
+	// already published. Module versions are immutable.
+	ErrModuleVersionExists = errors.New("script module version already exists")
+	// ErrInvalidModule is returned when publishing a module with an invalid
+	// name, version or source
+	ErrInvalidModule = errors.New("invalid script module")
+)
+
+var (
+	moduleNamePattern    = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	moduleVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+)
+
+// Module is a published version of a helper module scripts can require as
+// require('name@version')
+type Module struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	Name        string    `json:"name" gorm:"not null;uniqueIndex:idx_script_module_version"`
+	Version     string    `json:"version" gorm:"not null;uniqueIndex:idx_script_module_version"`
+	Description string    `json:"description"`
+	Source      string    `json:"source" gorm:"type:text;not null"`
+	Checksum    string    `json:"checksum" gorm:"not null"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the Module model
+func (Module) TableName() string {
+	return "script_modules"
+}
+
+// Ref returns the exact module reference, name@version
+func (m *Module) Ref() string {
+	return m.Name + "@" + m.Version
+}
+
+// ModuleStore persists script modules
+type ModuleStore interface {
+	Create(ctx context.Context, module *Module) error
+	Get(ctx context.Context, name, version string) (*Module, error)
+	Versions(ctx context.Context, name string) ([]*Module, error)
+	List(ctx context.Context) ([]*Module, error)
+}
+
+// MemoryModuleStore is an in-memory ModuleStore
+type MemoryModuleStore struct {
+	mu      sync.RWMutex
+	modules map[string]*Module
+}
+
+// NewMemoryModuleStore creates an in-memory module store
+func NewMemoryModuleStore() *MemoryModuleStore {
+	return &MemoryModuleStore{modules: make(map[string]*Module)}
+}
+
+func (s *MemoryModuleStore) Create(ctx context.Context, module *Module) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.modules[module.Ref()]; exists {
+		return ErrModuleVersionExists
+	}
+	stored := *module
+	s.modules[module.Ref()] = &stored
+	return nil
+}
+
+func (s *MemoryModuleStore) Get(ctx context.Context, name, version string) (*Module, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	module, exists := s.modules[name+"@"+version]
+	if !exists {
+		return nil, ErrModuleNotFound
+	}
+	found := *module
+	return &found, nil
+}
+
+func (s *MemoryModuleStore) Versions(ctx context.Context, name string) ([]*Module, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var versions []*Module
+	for _, module := range s.modules {
+		if module.Name == name {
+			found := *module
+			versions = append(versions, &found)
+		}
+	}
+	sortModules(versions)
+	return versions, nil
+}
+
+func (s *MemoryModuleStore) List(ctx context.Context) ([]*Module, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	modules := make([]*Module, 0, len(s.modules))
+	for _, module := range s.modules {
+		found := *module
+		modules = append(modules, &found)
+	}
+	sortModules(modules)
+	return modules, nil
+}
+
+// GormModuleStore is a ModuleStore backed by the database
+type GormModuleStore struct {
+	db *gorm.DB
+}
+
+// NewGormModuleStore creates a database backed module store
+func NewGormModuleStore(db *gorm.DB) *GormModuleStore {
+	return &GormModuleStore{db: db}
+}
+
+// Migrate creates the module table
+func (s *GormModuleStore) Migrate() error {
+	return s.db.AutoMigrate(&Module{})
+}
+
+func (s *GormModuleStore) Create(ctx context.Context, module *Module) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&Module{}).
+		Where("name = ? AND version = ?", module.Name, module.Version).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrModuleVersionExists
+	}
+	return s.db.WithContext(ctx).Create(module).Error
+}
+
+func (s *GormModuleStore) Get(ctx context.Context, name, version string) (*Module, error) {
+	var module Module
+	err := s.db.WithContext(ctx).Where("name = ? AND version = ?", name, version).First(&module).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrModuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &module, nil
+}
+
+func (s *GormModuleStore) Versions(ctx context.Context, name string) ([]*Module, error) {
+	var modules []*Module
+	if err := s.db.WithContext(ctx).Where("name = ?", name).Find(&modules).Error; err != nil {
+		return nil, err
+	}
+	sortModules(modules)
+	return modules, nil
+}
+
+func (s *GormModuleStore) List(ctx context.Context) ([]*Module, error) {
+	var modules []*Module
+	if err := s.db.WithContext(ctx).Find(&modules).Error; err != nil {
+		return nil, err
+	}
+	sortModules(modules)
+	return modules, nil
+}
+
+// ModuleRegistry publishes and resolves script modules
+type ModuleRegistry struct {
+	store ModuleStore
+	now   func() time.Time
+}
+
+// NewModuleRegistry creates a module registry
+func NewModuleRegistry(store ModuleStore) *ModuleRegistry {
+	return &ModuleRegistry{store: store, now: time.Now}
+}
+
+// Publish publishes a new module version. Versions are immutable once
+// published so that pinned workflow versions keep running the same code.
+func (r *ModuleRegistry) Publish(ctx context.Context, name, version, source, description, createdBy string) (*Module, error) {
+	if !moduleNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: name %q must be lowercase letters, digits, - and _", ErrInvalidModule, name)
+	}
+	if !moduleVersionPattern.MatchString(version) {
+		return nil, fmt.Errorf("%w: version %q must be MAJOR.MINOR.PATCH", ErrInvalidModule, version)
+	}
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("%w: source is required", ErrInvalidModule)
+	}
+
+	checksum := sha256.Sum256([]byte(source))
+	module := &Module{
+		ID:          uuid.New(),
+		Name:        name,
+		Version:     version,
+		Description: description,
+		Source:      source,
+		Checksum:    hex.EncodeToString(checksum[:]),
+		CreatedBy:   createdBy,
+		CreatedAt:   r.now().UTC(),
+	}
+	if err := r.store.Create(ctx, module); err != nil {
+		return nil, err
+	}
+	return module, nil
+}
+
+// Resolve returns the module a spec refers to. A spec is name@version for an
+// exact version or a bare name for the latest version.
+func (r *ModuleRegistry) Resolve(ctx context.Context, spec string) (*Module, error) {
+	name, version := ParseModuleSpec(spec)
+	if version != "" {
+		module, err := r.store.Get(ctx, name, version)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec, err)
+		}
+		return module, nil
+	}
+
+	versions, err := r.store.Versions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%s: %w", spec, ErrModuleNotFound)
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Pin resolves specs to exact module references, keyed by spec. Pins are
+// stored with a workflow version so that publishing newer module versions
+// never changes what existing versions run.
+func (r *ModuleRegistry) Pin(ctx context.Context, specs []string) (map[string]string, error) {
+	pins := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		module, err := r.Resolve(ctx, spec)
+		if err != nil {
+			return nil, err
+		}
+		pins[spec] = module.Ref()
+	}
+	return pins, nil
+}
+
+// Versions returns the published versions of a module, oldest first
+func (r *ModuleRegistry) Versions(ctx context.Context, name string) ([]*Module, error) {
+	return r.store.Versions(ctx, name)
+}
+
+// List returns all published module versions
+func (r *ModuleRegistry) List(ctx context.Context) ([]*Module, error) {
+	return r.store.List(ctx)
+}
+
+// ParseModuleSpec splits a module spec into name and version. The version is
+// empty for bare names.
+func ParseModuleSpec(spec string) (name, version string) {
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
+
+// sortModules orders modules by name, then by semantic version
+func sortModules(modules []*Module) {
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Name != modules[j].Name {
+			return modules[i].Name < modules[j].Name
+		}
+		return compareVersions(modules[i].Version, modules[j].Version) < 0
+	})
+}
+
+func compareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, _ := strconv.Atoi(aParts[i])
+		bNum, _ := strconv.Atoi(bParts[i])
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(aParts) - len(bParts)
+}
@@ -0,0 +1,175 @@
+package scripting
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Instance is an interpreter initialized ahead of a run. An instance runs
+// one script at a time.
+type Instance interface {
+	Interpreter
+	// Reset readies the instance for another run, reporting false when it
+	// cannot be reused and must be discarded
+	Reset() bool
+}
+
+// InstanceFactory is implemented by interpreters that can initialize
+// instances ahead of runs
+type InstanceFactory interface {
+	NewInstance() (Instance, error)
+}
+
+// PoolConfig bounds an instance pool. Zero values mean no ready instances
+// and no expiry.
+type PoolConfig struct {
+	// Size is the number of ready instances kept
+	Size int
+	// TTL discards ready instances unused for longer, and stops replacing
+	// checked out instances once the pool was unused for longer
+	TTL time.Duration
+}
+
+// Pool keeps initialized interpreter instances ready for script steps. Runs
+// check an instance out and return it after use; instances that cannot be
+// reset are replaced in the background while the pool is in use.
+type Pool struct {
+	factory InstanceFactory
+	config  PoolConfig
+	now     func() time.Time
+
+	mu       sync.Mutex
+	ready    []readyInstance
+	filling  int
+	lastUsed time.Time
+}
+
+type readyInstance struct {
+	instance Instance
+	readyAt  time.Time
+}
+
+// NewPool creates an empty pool of the instances of factory
+func NewPool(factory InstanceFactory, config PoolConfig) *Pool {
+	return &Pool{factory: factory, config: config, now: time.Now}
+}
+
+// Warm initializes instances until the pool holds Size ready instances or
+// ctx is done
+func (p *Pool) Warm(ctx context.Context) error {
+	p.mu.Lock()
+	p.lastUsed = p.now()
+	p.mu.Unlock()
+
+	for ctx.Err() == nil {
+		p.mu.Lock()
+		p.expireLocked()
+		if len(p.ready)+p.filling >= p.config.Size {
+			p.mu.Unlock()
+			return nil
+		}
+		p.filling++
+		p.mu.Unlock()
+
+		instance, err := p.factory.NewInstance()
+		p.filled(instance, err)
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// Checkout returns a ready instance, or a new one when none is ready. warm
+// reports whether the instance was initialized ahead of the run.
+func (p *Pool) Checkout() (instance Instance, warm bool, err error) {
+	p.mu.Lock()
+	p.lastUsed = p.now()
+	p.expireLocked()
+	if n := len(p.ready); n > 0 {
+		instance = p.ready[n-1].instance
+		p.ready = p.ready[:n-1]
+		warm = true
+	}
+	p.mu.Unlock()
+
+	if !warm {
+		instance, err = p.factory.NewInstance()
+	}
+	p.refill()
+	return instance, warm, err
+}
+
+// Return gives an instance back after its run
+func (p *Pool) Return(instance Instance) {
+	if instance.Reset() {
+		p.mu.Lock()
+		p.putLocked(instance)
+		p.mu.Unlock()
+		return
+	}
+	p.refill()
+}
+
+// Ready returns the number of ready instances
+func (p *Pool) Ready() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expireLocked()
+	return len(p.ready)
+}
+
+// refill initializes instances in the background until the pool holds Size
+// ready instances, unless the pool was unused for longer than the TTL
+func (p *Pool) refill() {
+	p.mu.Lock()
+	missing := p.config.Size - len(p.ready) - p.filling
+	if missing <= 0 || (p.config.TTL > 0 && p.now().Sub(p.lastUsed) > p.config.TTL) {
+		p.mu.Unlock()
+		return
+	}
+	p.filling += missing
+	p.mu.Unlock()
+
+	go func() {
+		for i := 0; i < missing; i++ {
+			instance, err := p.factory.NewInstance()
+			p.filled(instance, err)
+		}
+	}()
+}
+
+// filled makes an instance initialized by Warm or refill ready
+func (p *Pool) filled(instance Instance, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filling--
+	if err == nil {
+		p.putLocked(instance)
+	}
+}
+
+// putLocked makes an instance ready, dropping it when the pool is full
+func (p *Pool) putLocked(instance Instance) {
+	if len(p.ready) < p.config.Size {
+		p.ready = append(p.ready, readyInstance{instance: instance, readyAt: p.now()})
+	}
+}
+
+// expireLocked discards the ready instances older than the TTL
+func (p *Pool) expireLocked() {
+	if p.config.TTL <= 0 {
+		return
+	}
+	kept := p.ready[:0]
+	for _, ready := range p.ready {
+		if p.now().Sub(ready.readyAt) <= p.config.TTL {
+			kept = append(kept, ready)
+		}
+	}
+	for i := len(kept); i < len(p.ready); i++ {
+		p.ready[i] = readyInstance{}
+	}
+	p.ready = kept
+}
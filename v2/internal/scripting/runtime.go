@@ -0,0 +1,311 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Interpreter runs script source inside an Environment. Implementations
+// expose Environment.CallHost to scripts as the mf object and
+// Environment.Require as require, and must stop once ctx is done.
+type Interpreter interface {
+	Run(ctx context.Context, env *Environment, source string, input map[string]interface{}) (interface{}, error)
+}
+
+// Environment is the sandbox of a single script step. It only exposes the
+// host functions allowed for the workflow and the modules pinned for the
+// workflow version, and meters resource usage against the namespace limits.
+//
+// The first violation is recorded so that it fails the step even when the
+// script catches the error raised for it.
+type Environment struct {
+	allowed map[string]bool
+	hosts   *HostRegistry
+	modules map[string]*Module
+	meter   *Meter
+
+	mu        sync.Mutex
+	violation error
+}
+
+// CallHost calls an allowed host function
+func (e *Environment) CallHost(ctx context.Context, name string, args []interface{}) (interface{}, error) {
+	if !hostAllowed(e.allowed, name) {
+		return nil, e.violate(hostFunctionDenied(name))
+	}
+	fn, exists := e.hosts.Get(name)
+	if !exists {
+		return nil, fmt.Errorf("host function mf.%s is not registered", name)
+	}
+	if err := e.ChargeOps(1); err != nil {
+		return nil, err
+	}
+
+	result, err := fn(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.ChargeMemory(sizeOf(result)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// IsHostNamespace reports whether name groups host functions, as scratch
+// groups scratch.put. Interpreters expose its functions as
+// mf.<name>.<function>.
+func (e *Environment) IsHostNamespace(name string) bool {
+	return e.hosts.IsNamespace(name)
+}
+
+// Require returns a module pinned for the workflow version. Specs must match
+// the spec pinned, so require('utils') and require('utils@1.2.0') are pinned
+// separately.
+func (e *Environment) Require(spec string) (*Module, error) {
+	module, exists := e.modules[spec]
+	if !exists {
+		return nil, e.violate(moduleNotPinned(spec))
+	}
+	if err := e.ChargeOps(1); err != nil {
+		return nil, err
+	}
+	if err := e.ChargeMemory(int64(len(module.Source))); err != nil {
+		return nil, err
+	}
+	return module, nil
+}
+
+// ChargeOps records operations performed by the interpreter
+func (e *Environment) ChargeOps(n int64) error {
+	if err := e.meter.ChargeOps(n); err != nil {
+		return e.violate(err)
+	}
+	return nil
+}
+
+// ChargeMemory records memory allocated by the interpreter
+func (e *Environment) ChargeMemory(bytes int64) error {
+	if err := e.meter.ChargeMemory(bytes); err != nil {
+		return e.violate(err)
+	}
+	return nil
+}
+
+// Violation returns the first sandbox violation of the run, if any
+func (e *Environment) Violation() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.violation
+}
+
+func (e *Environment) violate(err error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.violation == nil {
+		e.violation = err
+	}
+	return err
+}
+
+// RunRequest describes a script step run
+type RunRequest struct {
+	Namespace            string
+	Source               string
+	Input                map[string]interface{}
+	AllowedHostFunctions []string
+	// Modules maps the module specs the script requires to the exact
+	// name@version pinned when the workflow version was created
+	Modules map[string]string
+}
+
+// RunResult is the outcome of a script step run
+type RunResult struct {
+	Output map[string]interface{} `json:"output"`
+	Usage  Usage                  `json:"usage"`
+	// Warm is set when the script ran on an instance initialized ahead of
+	// the run
+	Warm bool `json:"warm"`
+}
+
+// Runtime runs script steps in isolated environments
+type Runtime struct {
+	interpreter Interpreter
+	hosts       *HostRegistry
+	modules     *ModuleRegistry
+	limits      LimitsConfig
+	pool        *Pool
+
+	// loaded caches the modules loaded by reference. Published versions are
+	// immutable, so cached modules never go stale.
+	mu     sync.RWMutex
+	loaded map[string]*Module
+}
+
+// NewRuntime creates a script runtime
+func NewRuntime(interpreter Interpreter, hosts *HostRegistry, modules *ModuleRegistry, limits LimitsConfig) *Runtime {
+	return &Runtime{
+		interpreter: interpreter,
+		hosts:       hosts,
+		modules:     modules,
+		limits:      limits,
+		loaded:      make(map[string]*Module),
+	}
+}
+
+// SetPool sets the pool of interpreter instances scripts run on. Without a
+// pool every run initializes the interpreter.
+func (r *Runtime) SetPool(pool *Pool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pool = pool
+}
+
+// Warm readies the runtime for scripts requiring moduleSets: it loads the
+// pinned modules and fills the instance pool. It returns the errors of the
+// modules that could not be loaded.
+func (r *Runtime) Warm(ctx context.Context, moduleSets []map[string]string) error {
+	var errs []error
+	for _, pins := range moduleSets {
+		if _, err := r.loadModules(ctx, pins); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+	if pool != nil {
+		if err := pool.Warm(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Modules returns the module registry of the runtime
+func (r *Runtime) Modules() *ModuleRegistry {
+	return r.modules
+}
+
+// Run checks a script against its policy and runs it. Violations detected
+// before the run and during it are returned as *Error; the result carries
+// the usage even when the run fails.
+func (r *Runtime) Run(ctx context.Context, req RunRequest) (*RunResult, error) {
+	analysis := Analyze(req.Source)
+	if err := CheckHostFunctions(analysis, req.AllowedHostFunctions); err != nil {
+		return nil, err
+	}
+	for _, spec := range analysis.Requires {
+		if _, pinned := req.Modules[spec]; !pinned {
+			return nil, moduleNotPinned(spec)
+		}
+	}
+
+	modules, err := r.loadModules(ctx, req.Modules)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool, len(req.AllowedHostFunctions))
+	for _, name := range req.AllowedHostFunctions {
+		allowed[name] = true
+	}
+
+	limits := r.limits.For(req.Namespace)
+	meter := NewMeter(limits)
+	env := &Environment{
+		allowed: allowed,
+		hosts:   r.hosts,
+		modules: modules,
+		meter:   meter,
+	}
+
+	result := &RunResult{}
+	if err := env.ChargeMemory(sizeOf(req.Input)); err != nil {
+		result.Usage = meter.Usage()
+		return result, err
+	}
+
+	runCtx := ctx
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	interpreter := r.interpreter
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+	if pool != nil {
+		instance, warm, err := pool.Checkout()
+		if err != nil {
+			result.Usage = meter.Usage()
+			return result, fmt.Errorf("failed to initialize interpreter: %w", err)
+		}
+		defer pool.Return(instance)
+		interpreter = instance
+		result.Warm = warm
+	}
+
+	start := time.Now()
+	value, err := interpreter.Run(runCtx, env, req.Source, req.Input)
+	elapsed := time.Since(start)
+
+	if violation := env.Violation(); violation != nil {
+		err = violation
+	} else if runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		err = meter.timeout(elapsed)
+	}
+	if err == nil {
+		result.Output = toOutput(value)
+		err = env.ChargeMemory(sizeOf(result.Output))
+	}
+
+	result.Usage = meter.Usage()
+	result.Usage.DurationMS = elapsed.Milliseconds()
+	return result, err
+}
+
+// loadModules loads the pinned modules keyed by the spec scripts require
+// them with
+func (r *Runtime) loadModules(ctx context.Context, pins map[string]string) (map[string]*Module, error) {
+	modules := make(map[string]*Module, len(pins))
+	for spec, ref := range pins {
+		if _, version := ParseModuleSpec(ref); version == "" {
+			return nil, fmt.Errorf("module %s must be pinned to an exact version, got %s", spec, ref)
+		}
+		r.mu.RLock()
+		module, loaded := r.loaded[ref]
+		r.mu.RUnlock()
+		if !loaded {
+			if r.modules == nil {
+				return nil, fmt.Errorf("module %s: no module registry configured", spec)
+			}
+			var err error
+			module, err = r.modules.Resolve(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			r.mu.Lock()
+			r.loaded[ref] = module
+			r.mu.Unlock()
+		}
+		modules[spec] = module
+	}
+	return modules, nil
+}
+
+func toOutput(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case nil:
+		return map[string]interface{}{}
+	case map[string]interface{}:
+		return v
+	default:
+		return map[string]interface{}{"result": v}
+	}
+}
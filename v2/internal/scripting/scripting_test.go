@@ -0,0 +1,513 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/scratch"
+)
+
+// fakeInterpreter stands in for a JavaScript engine by running a Go function
+// in place of the script source
+type fakeInterpreter func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error)
+
+func (f fakeInterpreter) Run(ctx context.Context, env *Environment, source string, input map[string]interface{}) (interface{}, error) {
+	return f(ctx, env, input)
+}
+
+func newTestHosts() *HostRegistry {
+	hosts := NewHostRegistry()
+	hosts.Register("log", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	hosts.Register("httpGet", func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return map[string]interface{}{"status": 200, "body": strings.Repeat("x", 512)}, nil
+	})
+	return hosts
+}
+
+func publish(t *testing.T, registry *ModuleRegistry, name, version, source string) *Module {
+	module, err := registry.Publish(context.Background(), name, version, source, "", "tester")
+	require.NoError(t, err)
+	return module
+}
+
+func requireScriptError(t *testing.T, err error, code string) *Error {
+	var scriptErr *Error
+	require.True(t, errors.As(err, &scriptErr), "expected a script error, got %v", err)
+	assert.Equal(t, code, scriptErr.Code)
+	return scriptErr
+}
+
+func TestModulePinning(t *testing.T) {
+	ctx := context.Background()
+	registry := NewModuleRegistry(NewMemoryModuleStore())
+	publish(t, registry, "utils", "1.0.0", "module.exports = 'v1.0.0'")
+	publish(t, registry, "utils", "1.10.0", "module.exports = 'v1.10.0'")
+	publish(t, registry, "utils", "1.2.0", "module.exports = 'v1.2.0'")
+
+	pins, err := registry.Pin(ctx, []string{"utils", "utils@1.2.0"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"utils": "utils@1.10.0", "utils@1.2.0": "utils@1.2.0"}, pins)
+
+	t.Run("versions are immutable", func(t *testing.T) {
+		_, err := registry.Publish(ctx, "utils", "1.2.0", "module.exports = 'changed'", "", "tester")
+		assert.ErrorIs(t, err, ErrModuleVersionExists)
+	})
+
+	t.Run("invalid modules are rejected", func(t *testing.T) {
+		_, err := registry.Publish(ctx, "utils", "latest", "module.exports = 1", "", "tester")
+		assert.ErrorIs(t, err, ErrInvalidModule)
+		_, err = registry.Publish(ctx, "Utils", "1.0.0", "module.exports = 1", "", "tester")
+		assert.ErrorIs(t, err, ErrInvalidModule)
+	})
+
+	t.Run("unknown modules cannot be pinned", func(t *testing.T) {
+		_, err := registry.Pin(ctx, []string{"missing"})
+		assert.ErrorIs(t, err, ErrModuleNotFound)
+		_, err = registry.Pin(ctx, []string{"utils@9.9.9"})
+		assert.ErrorIs(t, err, ErrModuleNotFound)
+	})
+
+	t.Run("pinned versions survive newer releases", func(t *testing.T) {
+		publish(t, registry, "utils", "2.0.0", "module.exports = 'v2.0.0'")
+
+		var loaded string
+		runtime := NewRuntime(fakeInterpreter(func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+			module, err := env.Require("utils")
+			if err != nil {
+				return nil, err
+			}
+			loaded = module.Source
+			return nil, nil
+		}), newTestHosts(), registry, LimitsConfig{})
+
+		_, err := runtime.Run(ctx, RunRequest{Source: "require('utils')", Modules: pins})
+		require.NoError(t, err)
+		assert.Equal(t, "module.exports = 'v1.10.0'", loaded)
+	})
+
+	t.Run("unpinned requires fail", func(t *testing.T) {
+		runtime := NewRuntime(fakeInterpreter(func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+			t.Fatal("script must not run")
+			return nil, nil
+		}), newTestHosts(), registry, LimitsConfig{})
+
+		_, err := runtime.Run(ctx, RunRequest{Source: "require('utils@2.0.0')", Modules: pins})
+		requireScriptError(t, err, CodeModuleNotPinned)
+	})
+}
+
+func TestStaticAllowlist(t *testing.T) {
+	source := `
+		const strings = require('strings@1.0.0');
+		mf.log("fetching");
+		const res = mf . httpGet(input.url);
+		return { body: strings.trim(res.body) };
+	`
+
+	analysis := Analyze(source)
+	assert.Equal(t, []string{"httpGet", "log"}, analysis.HostFunctions)
+	assert.Equal(t, []string{"strings@1.0.0"}, analysis.Requires)
+	assert.False(t, analysis.DynamicHostAccess)
+
+	assert.NoError(t, CheckHostFunctions(analysis, []string{"log", "httpGet"}))
+	scriptErr := requireScriptError(t, CheckHostFunctions(analysis, []string{"log"}), CodeHostFunctionDenied)
+	assert.Equal(t, "httpGet", scriptErr.Details["function"])
+
+	t.Run("runtime rejects before running", func(t *testing.T) {
+		ran := false
+		runtime := NewRuntime(fakeInterpreter(func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+			ran = true
+			return nil, nil
+		}), newTestHosts(), nil, LimitsConfig{})
+
+		_, err := runtime.Run(context.Background(), RunRequest{Source: "return mf.httpGet('http://example.com')", AllowedHostFunctions: []string{"log"}})
+		requireScriptError(t, err, CodeHostFunctionDenied)
+		assert.False(t, ran)
+	})
+}
+
+func TestRuntimeAllowlist(t *testing.T) {
+	// Dynamic access cannot be checked statically, so the call is denied
+	// at runtime. The script swallows the error, yet the step still fails.
+	source := `try { mf["http" + "Get"]("http://example.com") } catch (e) {} return {}`
+	assert.True(t, Analyze(source).DynamicHostAccess)
+
+	runtime := NewRuntime(fakeInterpreter(func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+		if _, err := env.CallHost(ctx, "log", nil); err != nil {
+			return nil, err
+		}
+		_, err := env.CallHost(ctx, "httpGet", []interface{}{"http://example.com"})
+		assert.Error(t, err)
+		return map[string]interface{}{}, nil
+	}), newTestHosts(), nil, LimitsConfig{})
+
+	result, err := runtime.Run(context.Background(), RunRequest{Source: source, AllowedHostFunctions: []string{"log"}})
+	scriptErr := requireScriptError(t, err, CodeHostFunctionDenied)
+	assert.Equal(t, "httpGet", scriptErr.Details["function"])
+	assert.Equal(t, CodeHostFunctionDenied, ErrorCode(err))
+	assert.Equal(t, int64(1), result.Usage.Ops)
+}
+
+func TestScratchFunctions(t *testing.T) {
+	space, err := scratch.NewSpace(t.TempDir(), 16)
+	require.NoError(t, err)
+	hosts := newTestHosts()
+	RegisterScratchFunctions(hosts, space, 8, func(ctx context.Context) (uuid.UUID, bool) {
+		executionID, ok := ctx.Value(executionKey{}).(uuid.UUID)
+		return executionID, ok
+	})
+	assert.True(t, hosts.IsNamespace("scratch"))
+	assert.False(t, hosts.IsNamespace("log"))
+
+	// Namespaced functions are checked statically by their full name, or
+	// allowed with their namespace
+	source := `mf.scratch.put("rows", input.rows); return mf.scratch . get("rows")`
+	analysis := Analyze(source)
+	assert.Equal(t, []string{"scratch.get", "scratch.put"}, analysis.HostFunctions)
+	assert.NoError(t, CheckHostFunctions(analysis, []string{"scratch"}))
+	assert.NoError(t, CheckHostFunctions(analysis, []string{"scratch.get", "scratch.put"}))
+	scriptErr := requireScriptError(t, CheckHostFunctions(analysis, []string{"scratch.get"}), CodeHostFunctionDenied)
+	assert.Equal(t, "scratch.put", scriptErr.Details["function"])
+
+	run := func(ctx context.Context, allowed []string, fn fakeInterpreter) (*RunResult, error) {
+		runtime := NewRuntime(fn, hosts, nil, LimitsConfig{})
+		return runtime.Run(ctx, RunRequest{Source: "mf.scratch", AllowedHostFunctions: allowed})
+	}
+	first := context.WithValue(context.Background(), executionKey{}, uuid.New())
+	second := context.WithValue(context.Background(), executionKey{}, uuid.New())
+
+	result, err := run(first, []string{"scratch"}, func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+		assert.True(t, env.IsHostNamespace("scratch"))
+		if _, err := env.CallHost(ctx, "scratch.put", []interface{}{"rows", []interface{}{1, 2}}); err != nil {
+			return nil, err
+		}
+		rows, err := env.CallHost(ctx, "scratch.get", []interface{}{"rows"})
+		if err != nil {
+			return nil, err
+		}
+		files, err := env.CallHost(ctx, "scratch.list", nil)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"rows": rows, "files": files}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "[1,2]", result.Output["rows"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "rows", "size": int64(5)}}, result.Output["files"])
+
+	_, err = run(second, []string{"scratch"}, func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+		// The files of another execution are not visible
+		_, err := env.CallHost(ctx, "scratch.get", []interface{}{"rows"})
+		assert.ErrorIs(t, err, scratch.ErrNotFound)
+		// Writes over the cap fail
+		_, err = env.CallHost(ctx, "scratch.put", []interface{}{"big", strings.Repeat("x", 17)})
+		assert.ErrorIs(t, err, scratch.ErrFull)
+		// Files larger than the read limit are not loaded
+		if _, err := env.CallHost(ctx, "scratch.put", []interface{}{"wide", strings.Repeat("x", 9)}); err != nil {
+			return nil, err
+		}
+		_, err = env.CallHost(ctx, "scratch.get", []interface{}{"wide"})
+		assert.Error(t, err)
+		return nil, env.Violation()
+	})
+	require.NoError(t, err)
+
+	// Scripts outside an execution have no scratch area, and functions of
+	// the namespace missing from the allowlist are denied
+	_, err = run(context.Background(), []string{"scratch"}, func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+		_, err := env.CallHost(ctx, "scratch.list", nil)
+		assert.ErrorContains(t, err, "only available to steps of an execution")
+		return nil, nil
+	})
+	require.NoError(t, err)
+	_, err = run(first, []string{"scratch.get"}, func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+		return env.CallHost(ctx, "scratch.delete", []interface{}{"rows"})
+	})
+	requireScriptError(t, err, CodeHostFunctionDenied)
+}
+
+type executionKey struct{}
+
+func TestResourceLimits(t *testing.T) {
+	limits := LimitsConfig{
+		Default: Limits{MaxOps: 3, MaxMemoryBytes: 1024, Timeout: time.Second},
+		Namespaces: map[string]Limits{
+			"batch": {MaxOps: 10, Timeout: 20 * time.Millisecond},
+		},
+	}
+
+	t.Run("namespace overrides fall back to defaults", func(t *testing.T) {
+		assert.Equal(t, Limits{MaxOps: 10, MaxMemoryBytes: 1024, Timeout: 20 * time.Millisecond}, limits.For("batch"))
+		assert.Equal(t, limits.Default, limits.For("unknown"))
+	})
+
+	run := func(namespace string, fn fakeInterpreter) (*RunResult, error) {
+		runtime := NewRuntime(fn, newTestHosts(), nil, limits)
+		return runtime.Run(context.Background(), RunRequest{
+			Namespace:            namespace,
+			Source:               "loop()",
+			AllowedHostFunctions: []string{"log", "httpGet"},
+		})
+	}
+
+	t.Run("ops", func(t *testing.T) {
+		result, err := run("default", func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+			for i := 0; i < 5; i++ {
+				if _, err := env.CallHost(ctx, "log", nil); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		})
+
+		scriptErr := requireScriptError(t, err, CodeResourceLimit)
+		assert.Equal(t, "ops", scriptErr.Details["resource"])
+		assert.Equal(t, int64(3), scriptErr.Details["limit"])
+		assert.Equal(t, int64(4), scriptErr.Details["used"])
+		assert.Equal(t, int64(4), scriptErr.Details["usage"].(Usage).Ops)
+		assert.Equal(t, int64(4), result.Usage.Ops)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		_, err := run("default", func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+			for i := 0; i < 3; i++ {
+				if _, err := env.CallHost(ctx, "httpGet", []interface{}{"http://example.com"}); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		})
+
+		scriptErr := requireScriptError(t, err, CodeResourceLimit)
+		assert.Equal(t, "memory", scriptErr.Details["resource"])
+		assert.Equal(t, int64(1024), scriptErr.Details["limit"])
+		assert.Greater(t, scriptErr.Details["used"].(int64), int64(1024))
+	})
+
+	t.Run("time", func(t *testing.T) {
+		result, err := run("batch", func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		scriptErr := requireScriptError(t, err, CodeResourceLimit)
+		assert.Equal(t, "time", scriptErr.Details["resource"])
+		assert.Equal(t, int64(20), scriptErr.Details["limit"])
+		assert.GreaterOrEqual(t, result.Usage.DurationMS, int64(20))
+	})
+
+	t.Run("cancellation is not a limit breach", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		runtime := NewRuntime(fakeInterpreter(func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), newTestHosts(), nil, limits)
+
+		_, err := runtime.Run(ctx, RunRequest{Source: "loop()"})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, ErrorCode(err))
+	})
+
+	t.Run("within limits", func(t *testing.T) {
+		result, err := run("default", func(ctx context.Context, env *Environment, input map[string]interface{}) (interface{}, error) {
+			_, err := env.CallHost(ctx, "log", nil)
+			return "done", err
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"result": "done"}, result.Output)
+		assert.Equal(t, int64(1), result.Usage.Ops)
+	})
+}
+
+func TestModuleHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewHandlers(NewModuleRegistry(NewMemoryModuleStore())).RegisterRoutes(router.Group("/api"))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "admin")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"name": "utils", "version": "1.2.0", "source": "module.exports = {}"}`
+	assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/api/v1/script-modules", body).Code)
+	assert.Equal(t, http.StatusConflict, request(http.MethodPost, "/api/v1/script-modules", body).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/api/v1/script-modules", `{"name": "utils", "version": "v2", "source": "x"}`).Code)
+
+	rec := request(http.MethodGet, "/api/v1/script-modules/utils/1.2.0", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"created_by":"admin"`)
+
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/api/v1/script-modules/utils/1.3.0", "").Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/api/v1/script-modules/missing", "").Code)
+}
+
+// testInstance fails runs overlapping on the same instance
+type testInstance struct {
+	reusable bool
+	busy     atomic.Bool
+	runs     atomic.Int64
+}
+
+func (i *testInstance) Run(ctx context.Context, env *Environment, source string, input map[string]interface{}) (interface{}, error) {
+	if !i.busy.CompareAndSwap(false, true) {
+		return nil, errors.New("instance used by two runs at once")
+	}
+	defer i.busy.Store(false)
+	i.runs.Add(1)
+	time.Sleep(time.Millisecond)
+	return map[string]interface{}{"ok": true}, nil
+}
+
+func (i *testInstance) Reset() bool {
+	return i.reusable
+}
+
+type testFactory struct {
+	reusable bool
+	created  atomic.Int64
+}
+
+func (f *testFactory) NewInstance() (Instance, error) {
+	f.created.Add(1)
+	return &testInstance{reusable: f.reusable}, nil
+}
+
+func (f *testFactory) Run(ctx context.Context, env *Environment, source string, input map[string]interface{}) (interface{}, error) {
+	return nil, errors.New("runs must use pooled instances")
+}
+
+func TestPool(t *testing.T) {
+	t.Run("concurrent checkouts never share an instance", func(t *testing.T) {
+		factory := &testFactory{reusable: true}
+		pool := NewPool(factory, PoolConfig{Size: 4})
+		require.NoError(t, pool.Warm(context.Background()))
+		assert.Equal(t, 4, pool.Ready())
+
+		var wg sync.WaitGroup
+		var warm atomic.Int64
+		errs := make(chan error, 64)
+		for i := 0; i < 64; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				instance, isWarm, err := pool.Checkout()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if isWarm {
+					warm.Add(1)
+				}
+				if _, err := instance.Run(context.Background(), nil, "", nil); err != nil {
+					errs <- err
+				}
+				pool.Return(instance)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+
+		assert.Positive(t, warm.Load())
+		assert.LessOrEqual(t, pool.Ready(), 4)
+	})
+
+	t.Run("instances that cannot be reset are replaced", func(t *testing.T) {
+		factory := &testFactory{}
+		pool := NewPool(factory, PoolConfig{Size: 2})
+		require.NoError(t, pool.Warm(context.Background()))
+
+		instance, warm, err := pool.Checkout()
+		require.NoError(t, err)
+		assert.True(t, warm)
+		_, err = instance.Run(context.Background(), nil, "", nil)
+		require.NoError(t, err)
+		pool.Return(instance)
+
+		assert.Eventually(t, func() bool { return pool.Ready() == 2 }, time.Second, time.Millisecond)
+		for i := 0; i < 2; i++ {
+			ready, _, err := pool.Checkout()
+			require.NoError(t, err)
+			assert.NotSame(t, instance, ready)
+			assert.Zero(t, ready.(*testInstance).runs.Load())
+		}
+	})
+
+	t.Run("ready instances expire", func(t *testing.T) {
+		now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+		pool := NewPool(&testFactory{reusable: true}, PoolConfig{Size: 2, TTL: time.Minute})
+		pool.now = func() time.Time { return now }
+		require.NoError(t, pool.Warm(context.Background()))
+		assert.Equal(t, 2, pool.Ready())
+
+		now = now.Add(2 * time.Minute)
+		assert.Zero(t, pool.Ready())
+		_, warm, err := pool.Checkout()
+		require.NoError(t, err)
+		assert.False(t, warm)
+	})
+
+	t.Run("empty pools start cold", func(t *testing.T) {
+		pool := NewPool(&testFactory{}, PoolConfig{})
+		instance, warm, err := pool.Checkout()
+		require.NoError(t, err)
+		assert.False(t, warm)
+		pool.Return(instance)
+		assert.Zero(t, pool.Ready())
+	})
+}
+
+// countingStore counts the module lookups reaching the store
+type countingStore struct {
+	*MemoryModuleStore
+	gets atomic.Int64
+}
+
+func (s *countingStore) Get(ctx context.Context, name, version string) (*Module, error) {
+	s.gets.Add(1)
+	return s.MemoryModuleStore.Get(ctx, name, version)
+}
+
+func TestRuntimeWarm(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryModuleStore: NewMemoryModuleStore()}
+	registry := NewModuleRegistry(store)
+	publish(t, registry, "utils", "1.0.0", "module.exports = {}")
+
+	factory := &testFactory{reusable: true}
+	runtime := NewRuntime(factory, newTestHosts(), registry, LimitsConfig{})
+	runtime.SetPool(NewPool(factory, PoolConfig{Size: 1}))
+
+	pins := map[string]string{"utils": "utils@1.0.0"}
+	err := runtime.Warm(ctx, []map[string]string{pins, {"missing": "missing@1.0.0"}})
+	assert.ErrorIs(t, err, ErrModuleNotFound)
+	assert.Equal(t, int64(2), store.gets.Load())
+
+	result, err := runtime.Run(ctx, RunRequest{Source: "require('utils')", Modules: pins})
+	require.NoError(t, err)
+	assert.True(t, result.Warm)
+	assert.Equal(t, int64(2), store.gets.Load(), "warm modules are not looked up again")
+}
@@ -0,0 +1,150 @@
+// Package secrets resolves the secrets of the server and of workflow steps,
+// such as the JWT secret, the database password or the API keys steps call
+// services with, from a secret store rather than from the config file.
+// Secrets are named, and a name may select a key of another secret of the
+// store as path#key. Providers are chained so that a store such as Vault is
+// read first, with the environment as the fallback.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned for secrets a provider does not hold
+var ErrNotFound = errors.New("secret not found")
+
+// Provider reads secrets by name
+type Provider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// DefaultEnvPrefix prefixes the environment variables EnvProvider reads
+const DefaultEnvPrefix = "MAGICFLOW_SECRET_"
+
+// envName matches the characters of secret names environment variable
+// names replace with underscores
+var envName = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// EnvProvider reads secrets from environment variables: the secret
+// payments/stripe#api_key is read from PREFIX_PAYMENTS_STRIPE_API_KEY
+type EnvProvider struct {
+	prefix string
+}
+
+// NewEnvProvider creates a provider reading environment variables with a
+// prefix, DefaultEnvPrefix when empty
+func NewEnvProvider(prefix string) *EnvProvider {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	return &EnvProvider{prefix: prefix}
+}
+
+// Variable returns the environment variable a secret is read from
+func (p *EnvProvider) Variable(name string) string {
+	return p.prefix + strings.Trim(strings.ToUpper(envName.ReplaceAllString(name, "_")), "_")
+}
+
+// GetSecret reads a secret from its environment variable. Empty variables
+// hold no secret.
+func (p *EnvProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	if value := os.Getenv(p.Variable(name)); value != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Chain reads secrets from the first of its providers holding them. A
+// provider failing otherwise than with ErrNotFound fails the read, so that
+// an unreachable store is not masked by an older value of the fallback.
+type Chain []Provider
+
+// GetSecret reads a secret from the providers in order
+func (c Chain) GetSecret(ctx context.Context, name string) (string, error) {
+	for _, provider := range c {
+		value, err := provider.GetSecret(ctx, name)
+		if err == nil {
+			return value, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Provider types of Config
+const (
+	ProviderEnv   = "env"
+	ProviderVault = "vault"
+)
+
+// Config selects the provider of the server
+type Config struct {
+	// Provider is env or vault. Vault is read first, with the environment
+	// as the fallback.
+	Provider  string
+	EnvPrefix string
+	Vault     VaultConfig
+}
+
+// New creates the provider of a configuration
+func New(config Config) (Provider, error) {
+	env := NewEnvProvider(config.EnvPrefix)
+	switch config.Provider {
+	case "", ProviderEnv:
+		return Chain{env}, nil
+	case ProviderVault:
+		vault, err := NewVaultProvider(config.Vault)
+		if err != nil {
+			return nil, err
+		}
+		return Chain{vault, env}, nil
+	}
+	return nil, fmt.Errorf("unknown secret provider %q, expected %s or %s", config.Provider, ProviderEnv, ProviderVault)
+}
+
+// Cache reads each secret once from a provider, for the time of an
+// execution. It implements expressions.Secrets for the secret() function.
+type Cache struct {
+	ctx      context.Context
+	provider Provider
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewCache creates a cache of the secrets of a provider, read with ctx
+func NewCache(ctx context.Context, provider Provider) *Cache {
+	return &Cache{ctx: ctx, provider: provider, values: make(map[string]string)}
+}
+
+// Secret returns a secret, reading it on first use
+func (c *Cache) Secret(name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if value, ok := c.values[name]; ok {
+		return value, nil
+	}
+	value, err := c.provider.GetSecret(c.ctx, name)
+	if err != nil {
+		return "", err
+	}
+	c.values[name] = value
+	return value, nil
+}
+
+// splitName returns the path and key of a secret name. Names without a path
+// select a key of the default path.
+func splitName(name string) (string, string) {
+	if i := strings.LastIndex(name, "#"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
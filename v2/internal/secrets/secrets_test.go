@@ -0,0 +1,173 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProvider holds fixed secrets and records the names it is asked for
+type mockProvider struct {
+	name    string
+	secrets map[string]string
+	err     error
+	reads   *[]string
+}
+
+func (p *mockProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	if p.reads != nil {
+		*p.reads = append(*p.reads, p.name+":"+name)
+	}
+	if p.err != nil {
+		return "", p.err
+	}
+	value, ok := p.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return value, nil
+}
+
+func TestChainFallbackOrder(t *testing.T) {
+	var reads []string
+	vault := &mockProvider{name: "vault", secrets: map[string]string{"jwt_secret": "from-vault"}, reads: &reads}
+	env := &mockProvider{name: "env", secrets: map[string]string{"jwt_secret": "from-env", "database_password": "db-env"}, reads: &reads}
+	chain := Chain{vault, env}
+
+	// The first provider holding a secret wins
+	value, err := chain.GetSecret(context.Background(), "jwt_secret")
+	require.NoError(t, err)
+	assert.Equal(t, "from-vault", value)
+	assert.Equal(t, []string{"vault:jwt_secret"}, reads)
+
+	// Secrets the first provider does not hold fall back to the next
+	reads = nil
+	value, err = chain.GetSecret(context.Background(), "database_password")
+	require.NoError(t, err)
+	assert.Equal(t, "db-env", value)
+	assert.Equal(t, []string{"vault:database_password", "env:database_password"}, reads)
+
+	// Secrets no provider holds are not found
+	_, err = chain.GetSecret(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Failing providers are not masked by the fallback
+	reads = nil
+	vault.err = errors.New("vault sealed")
+	_, err = chain.GetSecret(context.Background(), "database_password")
+	assert.EqualError(t, err, "vault sealed")
+	assert.Equal(t, []string{"vault:database_password"}, reads)
+}
+
+func TestEnvProvider(t *testing.T) {
+	provider := NewEnvProvider("")
+	assert.Equal(t, "MAGICFLOW_SECRET_DATABASE_PASSWORD", provider.Variable("database_password"))
+	assert.Equal(t, "MAGICFLOW_SECRET_PAYMENTS_STRIPE_API_KEY", provider.Variable("payments/stripe#api_key"))
+
+	t.Setenv("MAGICFLOW_SECRET_PAYMENTS_STRIPE_API_KEY", "sk_test")
+	value, err := provider.GetSecret(context.Background(), "payments/stripe#api_key")
+	require.NoError(t, err)
+	assert.Equal(t, "sk_test", value)
+
+	t.Setenv("MAGICFLOW_SECRET_EMPTY", "")
+	_, err = provider.GetSecret(context.Background(), "empty")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Equal(t, "APP_JWT", NewEnvProvider("APP_").Variable("jwt"))
+}
+
+func TestVaultProvider(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/magic-flow":
+			fmt.Fprint(w, `{"data":{"data":{"jwt_secret":"from-vault","port":5432},"metadata":{"version":3}}}`)
+		case "/v1/kv/data/payments/stripe":
+			fmt.Fprint(w, `{"data":{"data":{"api_key":"sk_live"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+		}
+	}))
+	defer server.Close()
+
+	provider, err := NewVaultProvider(VaultConfig{Address: server.URL + "/", Token: "s.token", Mount: "kv", Path: "magic-flow"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	value, err := provider.GetSecret(ctx, "jwt_secret")
+	require.NoError(t, err)
+	assert.Equal(t, "from-vault", value)
+
+	value, err = provider.GetSecret(ctx, "payments/stripe#api_key")
+	require.NoError(t, err)
+	assert.Equal(t, "sk_live", value)
+	assert.Equal(t, []string{"/v1/kv/data/magic-flow", "/v1/kv/data/payments/stripe"}, paths)
+
+	// Missing secrets and keys are not found, so chains fall back
+	_, err = provider.GetSecret(ctx, "database_password")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = provider.GetSecret(ctx, "billing#api_key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = provider.GetSecret(ctx, "port")
+	assert.EqualError(t, err, "vault secret port holds a float64 rather than a string")
+
+	// Other failures are reported
+	denied, err := NewVaultProvider(VaultConfig{Address: server.URL, Token: "wrong", Mount: "kv", Path: "magic-flow"})
+	require.NoError(t, err)
+	_, err = denied.GetSecret(ctx, "jwt_secret")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.Contains(t, err.Error(), "status 403")
+
+	_, err = NewVaultProvider(VaultConfig{})
+	assert.EqualError(t, err, "vault address is required")
+}
+
+func TestCacheReadsOnce(t *testing.T) {
+	var reads []string
+	cache := NewCache(context.Background(), &mockProvider{name: "vault", secrets: map[string]string{"api_key": "k1"}, reads: &reads})
+
+	for i := 0; i < 3; i++ {
+		value, err := cache.Secret("api_key")
+		require.NoError(t, err)
+		assert.Equal(t, "k1", value)
+	}
+	assert.Equal(t, []string{"vault:api_key"}, reads)
+
+	// Failed reads are retried
+	_, err := cache.Secret("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _ = cache.Secret("missing")
+	assert.Len(t, reads, 3)
+}
+
+func TestNew(t *testing.T) {
+	provider, err := New(Config{})
+	require.NoError(t, err)
+	assert.IsType(t, Chain{}, provider)
+	assert.Len(t, provider.(Chain), 1)
+
+	provider, err = New(Config{Provider: ProviderVault, Vault: VaultConfig{Address: "https://vault.internal:8200", Path: "magic-flow"}})
+	require.NoError(t, err)
+	chain := provider.(Chain)
+	require.Len(t, chain, 2)
+	assert.IsType(t, &VaultProvider{}, chain[0])
+	assert.IsType(t, &EnvProvider{}, chain[1])
+
+	_, err = New(Config{Provider: "aws"})
+	assert.EqualError(t, err, `unknown secret provider "aws", expected env or vault`)
+}
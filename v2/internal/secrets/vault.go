@@ -0,0 +1,107 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VaultConfig configures the HashiCorp Vault provider
+type VaultConfig struct {
+	// Address is the base URL of Vault, such as https://vault.example.com:8200
+	Address string
+	// Token authenticates the requests
+	Token string
+	// Mount is the mount path of the KV version 2 secrets engine
+	Mount string
+	// Path is the secret holding the keys of names without a path
+	Path string
+	// Timeout bounds each read
+	Timeout time.Duration
+}
+
+// VaultProvider reads secrets from a KV version 2 secrets engine of
+// HashiCorp Vault. The secret jwt_secret is the jwt_secret key of the
+// secret at the configured path, payments/stripe#api_key the api_key key of
+// the secret at payments/stripe. Secrets are read when requested, so that
+// rotated values are picked up by the next execution reading them.
+type VaultProvider struct {
+	config VaultConfig
+	client *http.Client
+}
+
+// NewVaultProvider creates a Vault provider
+func NewVaultProvider(config VaultConfig) (*VaultProvider, error) {
+	if config.Address == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if _, err := url.ParseRequestURI(config.Address); err != nil {
+		return nil, fmt.Errorf("invalid vault address: %w", err)
+	}
+	if config.Mount == "" {
+		config.Mount = "secret"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &VaultProvider{config: config, client: &http.Client{Timeout: config.Timeout}}, nil
+}
+
+// vaultSecret is the response body of a KV version 2 read
+type vaultSecret struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+// GetSecret reads a key of a Vault secret
+func (p *VaultProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	path, key := splitName(name)
+	if path == "" {
+		path = p.config.Path
+	}
+	if path == "" || key == "" {
+		return "", fmt.Errorf("%w: %s names no vault secret path and key", ErrNotFound, name)
+	}
+
+	endpoint := strings.TrimSuffix(p.config.Address, "/") + "/v1/" + strings.Trim(p.config.Mount, "/") + "/data/" + strings.Trim(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+	req.Header.Set("X-Vault-Token", p.config.Token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("failed to read vault secret %s: status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret vaultSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to decode vault secret %s: %w", path, err)
+	}
+	value, ok := secret.Data.Data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s holds a %T rather than a string", name, value)
+	}
+	return s, nil
+}
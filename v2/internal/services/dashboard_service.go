@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -27,6 +28,14 @@ func NewDashboardService(repos *database.RepositoryManager, logger *logrus.Logge
 	}
 }
 
+// WithContext returns the service querying with ctx. Its overviews then
+// only count the workflows and executions of the tenant of ctx.
+func (s *DashboardService) WithContext(ctx context.Context) *DashboardService {
+	scoped := *s
+	scoped.repos = s.repos.WithContext(ctx)
+	return &scoped
+}
+
 // CreateDashboard creates a new dashboard
 func (s *DashboardService) CreateDashboard(req *CreateDashboardRequest) (*models.Dashboard, error) {
 	// Validate dashboard configuration
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,6 +12,7 @@ import (
 
 	"magic-flow/v2/internal/database"
 	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/internal/replay"
 	"magic-flow/v2/pkg/models"
 )
 
@@ -29,6 +32,14 @@ func NewExecutionService(repos *database.RepositoryManager, engine *engine.Engin
 	}
 }
 
+// WithContext returns the service querying executions with ctx, which
+// only finds the executions of its tenant in multi-tenant deployments
+func (s *ExecutionService) WithContext(ctx context.Context) *ExecutionService {
+	scoped := *s
+	scoped.repos = s.repos.WithContext(ctx)
+	return &scoped
+}
+
 // GetExecution retrieves an execution by ID
 func (s *ExecutionService) GetExecution(id uuid.UUID) (*models.Execution, error) {
 	execution, err := s.repos.Execution.GetByID(id)
@@ -43,6 +54,22 @@ func (s *ExecutionService) GetExecution(id uuid.UUID) (*models.Execution, error)
 
 // ListExecutions retrieves executions with pagination and filtering
 func (s *ExecutionService) ListExecutions(req *ListExecutionsRequest) ([]*models.Execution, int64, error) {
+	if req.CorrelationID != "" {
+		executions, err := s.repos.Execution.ListByCorrelationID(req.CorrelationID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list executions: %w", err)
+		}
+		return executions, int64(len(executions)), nil
+	}
+
+	if req.NodeID != "" {
+		executions, total, err := s.repos.Execution.ListByNodeID(req.NodeID, req.Limit, req.Offset)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list executions: %w", err)
+		}
+		return executions, total, nil
+	}
+
 	executions, total, err := s.repos.Execution.List(req.Limit, req.Offset, req.WorkflowID, req.Status)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list executions: %w", err)
@@ -168,7 +195,7 @@ func (s *ExecutionService) GetExecutionLogs(id uuid.UUID, req *GetExecutionLogsR
 // GetExecutionEvents retrieves events for an execution
 func (s *ExecutionService) GetExecutionEvents(id uuid.UUID, req *GetExecutionEventsRequest) ([]*models.ExecutionEvent, int64, error) {
 	// Check if execution exists
-	_, err := s.repos.Execution.GetByID(id)
+	execution, err := s.repos.Execution.GetByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, 0, fmt.Errorf("execution not found")
@@ -176,6 +203,10 @@ func (s *ExecutionService) GetExecutionEvents(id uuid.UUID, req *GetExecutionEve
 		return nil, 0, fmt.Errorf("failed to get execution: %w", err)
 	}
 
+	if execution.ExecutionMode == models.ExecutionModeLightweight {
+		return s.lightweightEvents(execution, req)
+	}
+
 	events, total, err := s.repos.ExecutionEvent.GetByExecutionID(id, req.Limit, req.Offset, req.EventType)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get execution events: %w", err)
@@ -184,6 +215,54 @@ func (s *ExecutionService) GetExecutionEvents(id uuid.UUID, req *GetExecutionEve
 	return events, total, nil
 }
 
+// lightweightEvents retrieves the events of a lightweight execution, which
+// only stores the events starting and ending it. Its step events are
+// synthesized from its step executions, then the events are paginated
+// newest first like stored events.
+func (s *ExecutionService) lightweightEvents(execution *models.Execution, req *GetExecutionEventsRequest) ([]*models.ExecutionEvent, int64, error) {
+	events, _, err := s.repos.ExecutionEvent.GetByExecutionID(execution.ID, -1, 0, req.EventType)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get execution events: %w", err)
+	}
+	stepExecutions, err := s.repos.StepExecution.GetByExecutionID(execution.ID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get step executions: %w", err)
+	}
+
+	for _, event := range engine.SynthesizeStepEvents(execution, stepExecutions) {
+		if req.EventType != "" && event.Type != req.EventType {
+			continue
+		}
+		data := event.Data
+		if event.Error != "" {
+			data["error"] = event.Error
+		}
+		events = append(events, &models.ExecutionEvent{
+			ExecutionID:   event.ExecutionID,
+			EventType:     event.Type,
+			StepName:      event.StepID,
+			CorrelationID: event.CorrelationID,
+			Data:          data,
+			Timestamp:     event.Timestamp,
+			Metadata:      map[string]interface{}{"synthesized": true},
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.After(events[j].Timestamp)
+	})
+
+	total := int64(len(events))
+	start := req.Offset
+	if start > len(events) {
+		start = len(events)
+	}
+	end := len(events)
+	if req.Limit > 0 && start+req.Limit < end {
+		end = start + req.Limit
+	}
+	return events[start:end], total, nil
+}
+
 // CancelExecution cancels a running execution
 func (s *ExecutionService) CancelExecution(id uuid.UUID, cancelledBy string) error {
 	execution, err := s.repos.Execution.GetByID(id)
@@ -260,12 +339,14 @@ func (s *ExecutionService) RetryExecution(id uuid.UUID, retryBy string) (*models
 	newExecution := &models.Execution{
 		ID:               uuid.New(),
 		WorkflowID:       originalExecution.WorkflowID,
+		TenantID:         originalExecution.TenantID,
 		Status:           models.ExecutionStatusPending,
 		TriggerType:      originalExecution.TriggerType,
 		TriggerData:      originalExecution.TriggerData,
 		Input:            originalExecution.Input,
 		Context:          originalExecution.Context,
 		ParentExecutionID: &originalExecution.ID,
+		CorrelationID:    originalExecution.CorrelationID,
 		CreatedBy:        retryBy,
 		CreatedAt:        time.Now().UTC(),
 		UpdatedAt:        time.Now().UTC(),
@@ -293,12 +374,61 @@ func (s *ExecutionService) RetryExecution(id uuid.UUID, retryBy string) (*models
 	return newExecution, nil
 }
 
+// ReplayExecution replays a finished execution against the current
+// definition of its workflow. Steps the execution recorded return their
+// recorded outputs instead of calling their executors, and steps it did not
+// run are executed. Executions that have not finished cannot be replayed,
+// returning replay.ErrNotReplayable.
+func (s *ExecutionService) ReplayExecution(ctx context.Context, id uuid.UUID, replayedBy string) (*models.Execution, error) {
+	originalExecution, err := s.repos.Execution.GetByID(id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("execution not found")
+		}
+		return nil, fmt.Errorf("failed to get execution: %w", err)
+	}
+
+	if !originalExecution.IsFinished() {
+		return nil, fmt.Errorf("%w: execution %s has not finished", replay.ErrNotReplayable, id)
+	}
+
+	workflow, err := s.repos.Workflow.GetByID(originalExecution.WorkflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+
+	stepExecutions, err := s.repos.StepExecution.GetByExecutionID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get step executions: %w", err)
+	}
+	recording := replay.NewRecording(id, stepExecutions)
+	recording.Flags = originalExecution.Flags
+
+	// The replay outlives the request starting it
+	ctx = replay.WithRecording(context.WithoutCancel(ctx), recording)
+	replayExecution, err := s.engine.ExecuteWorkflow(ctx, workflow, originalExecution.InputData, map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay execution: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"original_execution_id": originalExecution.ID,
+		"replay_execution_id":   replayExecution.ID,
+		"workflow_id":           workflow.ID,
+		"recorded_steps":        recording.Len(),
+		"replayed_by":           replayedBy,
+	}).Info("Execution replayed")
+
+	return replayExecution, nil
+}
+
 // Helper methods
-func (s *ExecutionService) calculateDuration(startedAt, completedAt *time.Time) *time.Duration {
+// calculateDuration returns the duration in milliseconds between two times
+func (s *ExecutionService) calculateDuration(startedAt, completedAt *time.Time) *int64 {
 	if startedAt == nil || completedAt == nil {
 		return nil
 	}
-	duration := completedAt.Sub(*startedAt)
+	duration := completedAt.Sub(*startedAt).Milliseconds()
 	return &duration
 }
 
@@ -324,6 +454,10 @@ type ListExecutionsRequest struct {
 	Offset     int        `json:"offset"`
 	WorkflowID *uuid.UUID `json:"workflow_id,omitempty"`
 	Status     string     `json:"status,omitempty"`
+	// CorrelationID lists all executions sharing a correlation ID
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// NodeID lists the executions placed on a worker node
+	NodeID string `json:"node_id,omitempty"`
 }
 
 type ExecutionStatusResponse struct {
@@ -347,7 +481,7 @@ type ExecutionResultsResponse struct {
 	Error       *string                 `json:"error"`
 	StartedAt   *time.Time              `json:"started_at"`
 	CompletedAt *time.Time              `json:"completed_at"`
-	Duration    *time.Duration          `json:"duration"`
+	Duration    *int64                  `json:"duration"` // in milliseconds
 	StepResults []StepResult            `json:"step_results"`
 }
 
@@ -358,7 +492,7 @@ type StepResult struct {
 	Error       *string                `json:"error"`
 	StartedAt   *time.Time             `json:"started_at"`
 	CompletedAt *time.Time             `json:"completed_at"`
-	Duration    *time.Duration         `json:"duration"`
+	Duration    *int64                 `json:"duration"` // in milliseconds
 }
 
 type GetExecutionLogsRequest struct {
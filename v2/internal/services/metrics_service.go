@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -8,12 +9,14 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"magic-flow/v2/internal/database"
+	"magic-flow/v2/internal/scheduler"
 	"magic-flow/v2/pkg/models"
 )
 
 // MetricsService handles metrics business logic
 type MetricsService struct {
 	repos  *database.RepositoryManager
+	clock  scheduler.Clock
 	logger *logrus.Logger
 }
 
@@ -21,10 +24,36 @@ type MetricsService struct {
 func NewMetricsService(repos *database.RepositoryManager, logger *logrus.Logger) *MetricsService {
 	return &MetricsService{
 		repos:  repos,
+		clock:  scheduler.NewRealClock(),
 		logger: logger,
 	}
 }
 
+// WithContext returns the service querying with ctx, so that its execution
+// and workflow counts only cover the tenant of ctx
+func (s *MetricsService) WithContext(ctx context.Context) *MetricsService {
+	scoped := *s
+	scoped.repos = s.repos.WithContext(ctx)
+	return &scoped
+}
+
+// SetClock sets the clock the current day and metric timestamps are read
+// from, the clock of the engine and scheduler
+func (s *MetricsService) SetClock(clock scheduler.Clock) {
+	s.clock = clock
+}
+
+// now returns the current time of the service clock, in UTC
+func (s *MetricsService) now() time.Time {
+	return s.clock.Now().UTC()
+}
+
+// today returns the start of the current UTC day and of the next one
+func (s *MetricsService) today() (time.Time, time.Time) {
+	today := s.now().Truncate(24 * time.Hour)
+	return today, today.Add(24 * time.Hour)
+}
+
 // GetWorkflowMetrics retrieves workflow metrics
 func (s *MetricsService) GetWorkflowMetrics(req *GetWorkflowMetricsRequest) (*WorkflowMetricsResponse, error) {
 	var metrics []*models.WorkflowMetrics
@@ -98,7 +127,7 @@ func (s *MetricsService) RecordBusinessMetric(req *RecordBusinessMetricRequest)
 		Unit:       req.Unit,
 		Tags:       req.Tags,
 		WorkflowID: req.WorkflowID,
-		Timestamp:  time.Now().UTC(),
+		Timestamp:  s.now(),
 	}
 
 	if err := s.repos.Metrics.CreateBusinessMetric(metric); err != nil {
@@ -141,7 +170,7 @@ func (s *MetricsService) CreateMetricAggregation(req *CreateMetricAggregationReq
 		TimeWindow:      req.TimeWindow,
 		Value:           req.Value,
 		Tags:            req.Tags,
-		Timestamp:       time.Now().UTC(),
+		Timestamp:       s.now(),
 	}
 
 	if err := s.repos.Metrics.CreateMetricAggregation(aggregation); err != nil {
@@ -165,8 +194,7 @@ func (s *MetricsService) GetDashboardOverview() (*DashboardOverviewResponse, err
 	}
 
 	// Get execution counts for today
-	today := time.Now().UTC().Truncate(24 * time.Hour)
-	tomorrow := today.Add(24 * time.Hour)
+	today, tomorrow := s.today()
 
 	totalExecutions, err := s.repos.Execution.CountByTimeRange(&today, &tomorrow)
 	if err != nil {
@@ -213,7 +241,7 @@ func (s *MetricsService) GetDashboardOverview() (*DashboardOverviewResponse, err
 			SuccessRate: successRate,
 		},
 		RecentExecutions: recentExecutions,
-		LastUpdated:      time.Now().UTC(),
+		LastUpdated:      s.now(),
 	}, nil
 }
 
@@ -239,7 +267,7 @@ func (s *MetricsService) GetWorkflowStatusSummary() (*WorkflowStatusSummaryRespo
 
 	return &WorkflowStatusSummaryResponse{
 		StatusCounts: statusMap,
-		LastUpdated:  time.Now().UTC(),
+		LastUpdated:  s.now(),
 	}, nil
 }
 
@@ -279,7 +307,7 @@ func (s *MetricsService) GetSystemHealth() (*SystemHealthResponse, error) {
 		Healthy:       overallHealthy,
 		Database:      dbHealthy,
 		SystemMetrics: latestMetrics,
-		LastChecked:   time.Now().UTC(),
+		LastChecked:   s.now(),
 	}, nil
 }
 
@@ -298,8 +326,8 @@ func (s *MetricsService) GetLiveMetrics() (*LiveMetricsResponse, error) {
 	}
 
 	// Get execution rate (executions per minute in last hour)
-	lastHour := time.Now().UTC().Add(-time.Hour)
-	now := time.Now().UTC()
+	now := s.now()
+	lastHour := now.Add(-time.Hour)
 	executionsLastHour, err := s.repos.Execution.CountByTimeRange(&lastHour, &now)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get executions in last hour: %w", err)
@@ -311,7 +339,7 @@ func (s *MetricsService) GetLiveMetrics() (*LiveMetricsResponse, error) {
 		RunningExecutions: len(runningExecutions),
 		ExecutionRate:     executionRate,
 		SystemMetrics:     latestSystemMetrics,
-		Timestamp:         time.Now().UTC(),
+		Timestamp:         s.now(),
 	}, nil
 }
 
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"magic-flow/v2/internal/scheduler"
+)
+
+func TestMetricsServiceToday(t *testing.T) {
+	tests := map[string]struct {
+		now   time.Time
+		start time.Time
+	}{
+		"midday": {
+			now:   time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+			start: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"start of the day": {
+			now:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			start: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"late in another time zone": {
+			now:   time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*60*60)),
+			start: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			service := NewMetricsService(nil, logrus.New())
+			service.SetClock(scheduler.NewFakeClock(tt.now))
+
+			start, end := service.today()
+			assert.Equal(t, tt.start, start)
+			assert.Equal(t, tt.start.Add(24*time.Hour), end)
+		})
+	}
+}
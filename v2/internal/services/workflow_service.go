@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -8,29 +9,69 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"magic-flow/v2/internal/admission"
 	"magic-flow/v2/internal/database"
 	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/internal/payloads"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/internal/quotas"
 	"magic-flow/v2/pkg/models"
 )
 
+// DefinitionWatch publishes the workflows created and deleted to the
+// watchers of workflow definitions. The watch Hub implements it.
+type DefinitionWatch interface {
+	WorkflowCreated(ctx context.Context, workflow *models.Workflow)
+	WorkflowDeleted(ctx context.Context, workflow *models.Workflow)
+}
+
 // WorkflowService handles workflow business logic
 type WorkflowService struct {
-	repos  *database.RepositoryManager
-	engine *engine.Engine
-	parser *engine.WorkflowParser
-	logger *logrus.Logger
+	repos     *database.RepositoryManager
+	engine    *engine.Engine
+	parser    *engine.WorkflowParser
+	admission *admission.AdmissionChecker
+	quotas    *quotas.Limiter
+	watch     DefinitionWatch
+	logger    *logrus.Logger
 }
 
 // NewWorkflowService creates a new workflow service
 func NewWorkflowService(repos *database.RepositoryManager, engine *engine.Engine, logger *logrus.Logger) *WorkflowService {
 	return &WorkflowService{
-		repos:  repos,
-		engine: engine,
-		parser: engine.NewWorkflowParser(),
-		logger: logger,
+		repos:     repos,
+		engine:    engine,
+		parser:    engine.NewWorkflowParser(),
+		admission: admission.NewAdmissionChecker(admission.DefaultConfig(), admission.Sources{Engine: engine}),
+		logger:    logger,
 	}
 }
 
+// WithContext returns the service querying workflows and executions with
+// ctx. API handlers scope it to the tenant of their request.
+func (s *WorkflowService) WithContext(ctx context.Context) *WorkflowService {
+	scoped := *s
+	scoped.repos = s.repos.WithContext(ctx)
+	return &scoped
+}
+
+// SetAdmissionChecker sets the checker executions are admitted through. The
+// pre-flight endpoint must use the same checker so its reports match.
+func (s *WorkflowService) SetAdmissionChecker(checker *admission.AdmissionChecker) {
+	s.admission = checker
+}
+
+// SetQuotas sets the limiter of the executions each tenant may start.
+// Executions are not limited until set.
+func (s *WorkflowService) SetQuotas(limiter *quotas.Limiter) {
+	s.quotas = limiter
+}
+
+// SetWatch sets where the workflows created and deleted are published
+func (s *WorkflowService) SetWatch(watch DefinitionWatch) {
+	s.watch = watch
+}
+
 // CreateWorkflow creates a new workflow
 func (s *WorkflowService) CreateWorkflow(req *CreateWorkflowRequest) (*models.Workflow, error) {
 	// Parse workflow definition
@@ -63,6 +104,9 @@ func (s *WorkflowService) CreateWorkflow(req *CreateWorkflowRequest) (*models.Wo
 	if err := s.parser.ValidateWorkflow(workflow); err != nil {
 		return nil, fmt.Errorf("workflow validation failed: %w", err)
 	}
+	if err := payloads.ValidateConfig(&workflow.Config); err != nil {
+		return nil, fmt.Errorf("workflow validation failed: %w", err)
+	}
 
 	// Save to database
 	if err := s.repos.Workflow.Create(workflow); err != nil {
@@ -75,6 +119,10 @@ func (s *WorkflowService) CreateWorkflow(req *CreateWorkflowRequest) (*models.Wo
 		"created_by":    workflow.CreatedBy,
 	}).Info("Workflow created")
 
+	if s.watch != nil {
+		s.watch.WorkflowCreated(context.Background(), workflow)
+	}
+
 	return workflow, nil
 }
 
@@ -162,7 +210,7 @@ func (s *WorkflowService) UpdateWorkflow(id uuid.UUID, req *UpdateWorkflowReques
 // DeleteWorkflow deletes a workflow
 func (s *WorkflowService) DeleteWorkflow(id uuid.UUID) error {
 	// Check if workflow exists
-	_, err := s.repos.Workflow.GetByID(id)
+	workflow, err := s.repos.Workflow.GetByID(id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return fmt.Errorf("workflow not found")
@@ -191,6 +239,10 @@ func (s *WorkflowService) DeleteWorkflow(id uuid.UUID) error {
 		"workflow_id": id,
 	}).Info("Workflow deleted")
 
+	if s.watch != nil {
+		s.watch.WorkflowDeleted(context.Background(), workflow)
+	}
+
 	return nil
 }
 
@@ -243,22 +295,51 @@ func (s *WorkflowService) ExecuteWorkflow(req *ExecuteWorkflowRequest) (*models.
 		return nil, fmt.Errorf("failed to get workflow: %w", err)
 	}
 
-	if workflow.Status != models.WorkflowStatusActive {
-		return nil, fmt.Errorf("workflow is not active")
+	// Run the admission checks, which pre-flight requests run too
+	executionID := uuid.New()
+	report, err := s.admission.Admit(context.Background(), &admission.Request{
+		Workflow: workflow,
+		Input:    req.Input,
+		Options: admission.Options{
+			VersionID:        req.VersionID,
+			ReservationToken: req.ReservationToken,
+		},
+		Actor:       req.CreatedBy,
+		ExecutionID: executionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the admitted execution against the quota of the tenant of the
+	// requested workflow, rejecting it with quotas.ErrQuotaExceeded.
+	// Executions of capacity reservations are not limited by quotas.
+	if s.quotas != nil && report.Reservation == nil {
+		if err := s.quotas.TakeWorkflow(workflow); err != nil {
+			return nil, err
+		}
+	}
+
+	// Executions of sunset workflows may be forwarded to their replacement
+	input := req.Input
+	if report.ForwardedFrom != nil {
+		workflow, input = report.Resolution.Workflow, report.Resolution.Input
 	}
 
 	// Create execution record
 	execution := &models.Execution{
-		ID:          uuid.New(),
-		WorkflowID:  req.WorkflowID,
-		Status:      models.ExecutionStatusPending,
-		TriggerType: models.TriggerType(req.TriggerType),
-		TriggerData: req.TriggerData,
-		Input:       req.Input,
-		Context:     req.Context,
-		CreatedBy:   req.CreatedBy,
-		CreatedAt:   time.Now().UTC(),
-		UpdatedAt:   time.Now().UTC(),
+		ID:              executionID,
+		WorkflowID:      workflow.ID,
+		TenantID:        workflow.TenantID,
+		WorkflowVersion: report.Version,
+		Status:          models.ExecutionStatusPending,
+		TriggerType:     models.TriggerType(req.TriggerType),
+		TriggerData:     req.TriggerData,
+		Input:           input,
+		Context:         req.Context,
+		CreatedBy:       req.CreatedBy,
+		CreatedAt:       time.Now().UTC(),
+		UpdatedAt:       time.Now().UTC(),
 	}
 
 	// Save execution
@@ -273,12 +354,25 @@ func (s *WorkflowService) ExecuteWorkflow(req *ExecuteWorkflowRequest) (*models.
 		return nil, fmt.Errorf("failed to execute workflow: %w", err)
 	}
 
-	s.logger.WithFields(logrus.Fields{
+	logger := s.logger.WithFields(logrus.Fields{
 		"execution_id": execution.ID,
 		"workflow_id":  workflow.ID,
 		"trigger_type": req.TriggerType,
 		"created_by":   req.CreatedBy,
-	}).Info("Workflow execution started")
+	})
+	if report.ForwardedFrom != nil {
+		logger = logger.WithField("forwarded_from", *report.ForwardedFrom)
+	}
+	if report.Reservation != nil {
+		logger = logger.WithField("reservation", report.Reservation.Name)
+	}
+	if report.Deprecation != nil {
+		logger.Warn(report.Deprecation.Warning())
+	}
+	if report.Policy != nil && report.Policy.Decision == policies.DecisionWarn {
+		logger.WithField("policy_warnings", report.Policy.Reasons(policies.DecisionWarn)).Warn("Admission policies warned about the execution")
+	}
+	logger.Info("Workflow execution started")
 
 	return execution, nil
 }
@@ -325,4 +419,9 @@ type ExecuteWorkflowRequest struct {
 	Input       map[string]interface{} `json:"input,omitempty"`
 	Context     map[string]interface{} `json:"context,omitempty"`
 	CreatedBy   string                 `json:"created_by,omitempty"`
+	// VersionID pins the execution to a workflow version
+	VersionID *uuid.UUID `json:"version_id,omitempty"`
+	// ReservationToken draws the execution on the capacity reservation
+	// with the token
+	ReservationToken string `json:"reservation_token,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,262 @@
+package slo
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// Handlers provides HTTP handlers for the SLOs of workflows
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new SLO handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers SLO routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		slos := v1.Group("/workflows/:id/slos")
+		{
+			slos.GET("", h.ListSLOs)
+			slos.POST("", h.CreateSLO)
+			slos.GET("/status", h.GetStatus)
+			slos.GET("/audit", h.GetAudit)
+			slos.PUT("/:name", h.UpdateSLO)
+			slos.DELETE("/:name", h.DeleteSLO)
+			slos.POST("/:name/reset", h.ResetSLO)
+		}
+	}
+}
+
+// Request is the request body creating or changing an SLO
+type Request struct {
+	models.SLODefinition
+	// Reason is recorded in the audit log
+	Reason string `json:"reason"`
+}
+
+// ResetRequest is the request body of a window reset
+type ResetRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ListSLOs returns the SLOs of a workflow, including those declared in its
+// definition
+// @Summary List workflow SLOs
+// @Tags slos
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 200 {array} SLO
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/slos [get]
+func (h *Handlers) ListSLOs(c *gin.Context) {
+	workflowID, ok := h.workflowID(c)
+	if !ok {
+		return
+	}
+
+	slos, err := h.manager.List(c.Request.Context(), workflowID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, slos)
+}
+
+// CreateSLO adds an SLO to a workflow, its window starting now
+// @Summary Create a workflow SLO
+// @Tags slos
+// @Accept json
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param request body Request true "SLO"
+// @Success 201 {object} SLO
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/slos [post]
+func (h *Handlers) CreateSLO(c *gin.Context) {
+	workflowID, ok := h.workflowID(c)
+	if !ok {
+		return
+	}
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slo, err := h.manager.Create(c.Request.Context(), workflowID, req.SLODefinition, c.GetHeader("X-User-ID"), req.Reason)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, slo)
+}
+
+// UpdateSLO changes an SLO managed through the API. Changing the objective
+// resets the window of the SLO, which is recorded in the audit log.
+// @Summary Update a workflow SLO
+// @Tags slos
+// @Accept json
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param name path string true "SLO name"
+// @Param request body Request true "SLO"
+// @Success 200 {object} SLO
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/slos/{name} [put]
+func (h *Handlers) UpdateSLO(c *gin.Context) {
+	workflowID, ok := h.workflowID(c)
+	if !ok {
+		return
+	}
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slo, err := h.manager.Update(c.Request.Context(), workflowID, c.Param("name"), req.SLODefinition, c.GetHeader("X-User-ID"), req.Reason)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, slo)
+}
+
+// DeleteSLO removes an SLO managed through the API
+// @Summary Delete a workflow SLO
+// @Tags slos
+// @Param id path string true "Workflow ID"
+// @Param name path string true "SLO name"
+// @Param reason query string false "Reason recorded in the audit log"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/slos/{name} [delete]
+func (h *Handlers) DeleteSLO(c *gin.Context) {
+	workflowID, ok := h.workflowID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.manager.Delete(c.Request.Context(), workflowID, c.Param("name"), c.GetHeader("X-User-ID"), c.Query("reason")); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ResetSLO restarts the window of an SLO now. The reset is recorded in the
+// audit log.
+// @Summary Reset the window of a workflow SLO
+// @Tags slos
+// @Accept json
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param name path string true "SLO name"
+// @Param request body ResetRequest true "Reset request"
+// @Success 200 {object} SLO
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/slos/{name}/reset [post]
+func (h *Handlers) ResetSLO(c *gin.Context) {
+	workflowID, ok := h.workflowID(c)
+	if !ok {
+		return
+	}
+	var req ResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slo, err := h.manager.Reset(c.Request.Context(), workflowID, c.Param("name"), c.GetHeader("X-User-ID"), req.Reason)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, slo)
+}
+
+// GetStatus returns the latest evaluation of the SLOs of a workflow: their
+// compliance, remaining error budget, burn rates and alerts
+// @Summary Get workflow SLO status
+// @Tags slos
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 200 {array} Status
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/{id}/slos/status [get]
+func (h *Handlers) GetStatus(c *gin.Context) {
+	workflowID, ok := h.workflowID(c)
+	if !ok {
+		return
+	}
+
+	statuses, err := h.manager.Statuses(c.Request.Context(), workflowID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statuses)
+}
+
+// GetAudit returns the audit log of the SLOs of a workflow, the most recent
+// first
+// @Summary Get workflow SLO audit log
+// @Tags slos
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 200 {array} AuditEntry
+// @Router /api/v1/workflows/{id}/slos/audit [get]
+func (h *Handlers) GetAudit(c *gin.Context) {
+	workflowID, ok := h.workflowID(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.manager.Audit(c.Request.Context(), workflowID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+func (h *Handlers) workflowID(c *gin.Context) (uuid.UUID, bool) {
+	workflowID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workflow ID"})
+		return uuid.Nil, false
+	}
+	return workflowID, true
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidSLO):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+	case errors.Is(err, ErrSLONotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrSLOExists), errors.Is(err, ErrDeclared):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
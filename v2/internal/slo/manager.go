@@ -0,0 +1,594 @@
+package slo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/admission"
+	"magic-flow/v2/pkg/models"
+)
+
+// definitionActor is the actor of the changes following workflow
+// definitions
+const definitionActor = "workflow-definition"
+
+// WorkflowStore loads workflows. The workflow repository implements it.
+type WorkflowStore interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+	List(limit, offset int, status string) ([]*models.Workflow, int64, error)
+}
+
+// OutcomeCounter counts the runs of a workflow, or of one of its steps when
+// step is set, that finished in a period: all of them, those that failed
+// and those slower than slowerThan, none when it is zero. The execution
+// repository implements it.
+type OutcomeCounter interface {
+	CountOutcomes(workflowID uuid.UUID, step string, from, to time.Time, slowerThan time.Duration) (total, failed, slow int64, err error)
+}
+
+// MetricsRecorder records SLO metrics. It is satisfied by the engine
+// metrics collector.
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// Config configures the SLO evaluator
+type Config struct {
+	// EvaluationInterval is how often SLOs are evaluated
+	EvaluationInterval time.Duration
+	// FastBurnWindow and FastBurnRate raise fast burn alerts when the error
+	// budget burned FastBurnRate times faster than the window allows over
+	// the last FastBurnWindow
+	FastBurnWindow time.Duration
+	FastBurnRate   float64
+	// SlowBurnWindow and SlowBurnRate raise slow burn alerts
+	SlowBurnWindow time.Duration
+	SlowBurnRate   float64
+}
+
+// DefaultConfig returns the default SLO configuration: a fast burn spends
+// 2% and a slow burn 5% of a 30 day budget within its window
+func DefaultConfig() Config {
+	return Config{
+		EvaluationInterval: time.Minute,
+		FastBurnWindow:     time.Hour,
+		FastBurnRate:       14.4,
+		SlowBurnWindow:     6 * time.Hour,
+		SlowBurnRate:       6,
+	}
+}
+
+// Manager stores the SLOs of workflows, evaluates their compliance and
+// error budget burn, and notifies burn alerts
+type Manager struct {
+	config      Config
+	store       Store
+	workflows   WorkflowStore
+	outcomes    OutcomeCounter
+	notifier    Notifier
+	maintenance admission.MaintenanceSchedule
+	metrics     MetricsRecorder
+	logger      *logrus.Logger
+	now         func() time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager creates an SLO manager
+func NewManager(config Config, store Store, workflows WorkflowStore, outcomes OutcomeCounter, logger *logrus.Logger) *Manager {
+	defaults := DefaultConfig()
+	if config.EvaluationInterval <= 0 {
+		config.EvaluationInterval = defaults.EvaluationInterval
+	}
+	if config.FastBurnWindow <= 0 || config.FastBurnRate <= 0 {
+		config.FastBurnWindow, config.FastBurnRate = defaults.FastBurnWindow, defaults.FastBurnRate
+	}
+	if config.SlowBurnWindow <= 0 || config.SlowBurnRate <= 0 {
+		config.SlowBurnWindow, config.SlowBurnRate = defaults.SlowBurnWindow, defaults.SlowBurnRate
+	}
+	return &Manager{
+		config:    config,
+		store:     store,
+		workflows: workflows,
+		outcomes:  outcomes,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// SetNotifier sets where burn alerts are notified
+func (m *Manager) SetNotifier(notifier Notifier) {
+	m.notifier = notifier
+}
+
+// SetMaintenance sets the maintenance windows during which burn alerts are
+// not notified. Alerts still raised once a window ends are notified then.
+func (m *Manager) SetMaintenance(schedule admission.MaintenanceSchedule) {
+	m.maintenance = schedule
+}
+
+// SetMetrics sets the recorder of the slo_error_budget_remaining and
+// slo_burn_rate metrics
+func (m *Manager) SetMetrics(metrics MetricsRecorder) {
+	m.metrics = metrics
+}
+
+// List returns the SLOs of a workflow, including those declared in its
+// definition
+func (m *Manager) List(ctx context.Context, workflowID uuid.UUID) ([]*SLO, error) {
+	workflow, err := m.workflows.GetByID(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Sync(ctx, workflow); err != nil {
+		return nil, err
+	}
+	return m.store.List(ctx, &workflowID)
+}
+
+// Create adds an SLO to a workflow. Its window starts now.
+func (m *Manager) Create(ctx context.Context, workflowID uuid.UUID, definition models.SLODefinition, actor, reason string) (*SLO, error) {
+	workflow, err := m.workflows.GetByID(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(workflow, definition); err != nil {
+		return nil, err
+	}
+	return m.create(ctx, workflowID, definition, SourceAPI, actor, reason)
+}
+
+func (m *Manager) create(ctx context.Context, workflowID uuid.UUID, definition models.SLODefinition, source Source, actor, reason string) (*SLO, error) {
+	now := m.now().UTC()
+	slo := &SLO{
+		ID:          uuid.New(),
+		WorkflowID:  workflowID,
+		Source:      source,
+		WindowStart: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	slo.apply(definition)
+	if err := m.store.Create(ctx, slo); err != nil {
+		return nil, err
+	}
+	if err := m.audit(ctx, slo, "created", "", actor, reason); err != nil {
+		return nil, err
+	}
+	return slo, nil
+}
+
+// Update changes the objective of an SLO managed through the API. A change
+// of the objective resets the window of the SLO, so runs measured against
+// the previous objective no longer count, and is recorded in the audit log.
+func (m *Manager) Update(ctx context.Context, workflowID uuid.UUID, name string, definition models.SLODefinition, actor, reason string) (*SLO, error) {
+	workflow, err := m.workflows.GetByID(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	definition.Name = name
+	if err := validate(workflow, definition); err != nil {
+		return nil, err
+	}
+
+	slo, err := m.store.Get(ctx, workflowID, name)
+	if err != nil {
+		return nil, err
+	}
+	if slo.Source == SourceDefinition {
+		return nil, fmt.Errorf("%w: change the definition of workflow %s instead", ErrDeclared, workflowID)
+	}
+	return m.update(ctx, slo, definition, SourceAPI, actor, reason)
+}
+
+func (m *Manager) update(ctx context.Context, slo *SLO, definition models.SLODefinition, source Source, actor, reason string) (*SLO, error) {
+	objective := slo.changes(definition)
+	changes := objective
+	if slo.Source != source {
+		changes = strings.TrimPrefix(changes+fmt.Sprintf(", source %s -> %s", slo.Source, source), ", ")
+	}
+	if changes == "" {
+		return slo, nil
+	}
+
+	now := m.now().UTC()
+	slo.apply(definition)
+	slo.Source = source
+	slo.UpdatedAt = now
+	if objective != "" {
+		slo.WindowStart = now
+	}
+	if err := m.store.Update(ctx, slo); err != nil {
+		return nil, err
+	}
+	if err := m.audit(ctx, slo, "updated", changes, actor, reason); err != nil {
+		return nil, err
+	}
+	return slo, nil
+}
+
+// Reset restarts the window of an SLO now, for example once the cause of
+// a spent error budget is fixed. The reset is recorded in the audit log.
+func (m *Manager) Reset(ctx context.Context, workflowID uuid.UUID, name, actor, reason string) (*SLO, error) {
+	slo, err := m.store.Get(ctx, workflowID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now().UTC()
+	slo.WindowStart = now
+	slo.UpdatedAt = now
+	if err := m.store.Update(ctx, slo); err != nil {
+		return nil, err
+	}
+	if err := m.audit(ctx, slo, "reset", "", actor, reason); err != nil {
+		return nil, err
+	}
+	return slo, nil
+}
+
+// Delete removes an SLO managed through the API and its status
+func (m *Manager) Delete(ctx context.Context, workflowID uuid.UUID, name, actor, reason string) error {
+	slo, err := m.store.Get(ctx, workflowID, name)
+	if err != nil {
+		return err
+	}
+	if slo.Source == SourceDefinition {
+		return fmt.Errorf("%w: change the definition of workflow %s instead", ErrDeclared, workflowID)
+	}
+	return m.delete(ctx, slo, actor, reason)
+}
+
+func (m *Manager) delete(ctx context.Context, slo *SLO, actor, reason string) error {
+	if err := m.store.Delete(ctx, slo.ID); err != nil {
+		return err
+	}
+	slo.WindowStart = time.Time{}
+	return m.audit(ctx, slo, "deleted", "", actor, reason)
+}
+
+func (m *Manager) audit(ctx context.Context, slo *SLO, action, changes, actor, reason string) error {
+	entry := &AuditEntry{
+		SLOID:       slo.ID,
+		WorkflowID:  slo.WorkflowID,
+		Name:        slo.Name,
+		Action:      action,
+		Changes:     changes,
+		WindowStart: slo.WindowStart,
+		Actor:       actor,
+		Reason:      reason,
+		CreatedAt:   m.now().UTC(),
+	}
+	if err := m.store.RecordAudit(ctx, entry); err != nil {
+		return fmt.Errorf("failed to audit %s of SLO %s: %w", action, slo.Name, err)
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"workflow_id":  slo.WorkflowID,
+		"slo":          slo.Name,
+		"action":       action,
+		"changes":      changes,
+		"window_start": slo.WindowStart,
+		"actor":        actor,
+	}).Info("SLO changed")
+	return nil
+}
+
+// Audit returns the audit log of the SLOs of a workflow, the most recent
+// first
+func (m *Manager) Audit(ctx context.Context, workflowID uuid.UUID) ([]*AuditEntry, error) {
+	return m.store.ListAudit(ctx, workflowID)
+}
+
+// Statuses returns the latest status of the SLOs of a workflow
+func (m *Manager) Statuses(ctx context.Context, workflowID uuid.UUID) ([]*Status, error) {
+	if _, err := m.workflows.GetByID(workflowID); err != nil {
+		return nil, err
+	}
+	return m.store.ListStatuses(ctx, &workflowID)
+}
+
+// validate validates an SLO of a workflow
+func validate(workflow *models.Workflow, definition models.SLODefinition) error {
+	if err := definition.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSLO, err)
+	}
+	if definition.Step == "" {
+		return nil
+	}
+	for _, step := range workflow.Definition.Spec.Steps {
+		if step.Name == definition.Step {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: workflow has no step %s", ErrInvalidSLO, definition.Step)
+}
+
+// Sync applies the SLOs declared in the definition of a workflow. Declared
+// SLOs take over the API managed SLOs of the same name, and SLOs no longer
+// declared are deleted. Every change is audited.
+func (m *Manager) Sync(ctx context.Context, workflow *models.Workflow) error {
+	existing, err := m.store.List(ctx, &workflow.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list SLOs of workflow %s: %w", workflow.ID, err)
+	}
+	byName := make(map[string]*SLO, len(existing))
+	for _, slo := range existing {
+		byName[slo.Name] = slo
+	}
+
+	reason := fmt.Sprintf("definition of workflow version %s", workflow.Version)
+	declared := make(map[string]bool)
+	for _, definition := range workflow.Definition.Spec.SLOs {
+		declared[definition.Name] = true
+		if err := validate(workflow, definition); err != nil {
+			m.logger.WithError(err).WithField("workflow_id", workflow.ID).Warn("Ignoring invalid SLO of workflow definition")
+			continue
+		}
+		if slo, exists := byName[definition.Name]; exists {
+			_, err = m.update(ctx, slo, definition, SourceDefinition, definitionActor, reason)
+		} else {
+			_, err = m.create(ctx, workflow.ID, definition, SourceDefinition, definitionActor, reason)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply SLO %s of workflow %s: %w", definition.Name, workflow.ID, err)
+		}
+	}
+
+	for _, slo := range existing {
+		if slo.Source == SourceDefinition && !declared[slo.Name] {
+			if err := m.delete(ctx, slo, definitionActor, reason); err != nil {
+				return fmt.Errorf("failed to delete SLO %s of workflow %s: %w", slo.Name, workflow.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// syncBatchSize is the number of workflows synced per query
+const syncBatchSize = 100
+
+// syncWorkflows applies the SLOs declared in the definitions of the active
+// workflows
+func (m *Manager) syncWorkflows(ctx context.Context) error {
+	for offset := 0; ; offset += syncBatchSize {
+		workflows, _, err := m.workflows.List(syncBatchSize, offset, string(models.WorkflowStatusActive))
+		if err != nil {
+			return fmt.Errorf("failed to list workflows: %w", err)
+		}
+		for _, workflow := range workflows {
+			if err := m.Sync(ctx, workflow); err != nil {
+				return err
+			}
+		}
+		if len(workflows) < syncBatchSize {
+			return nil
+		}
+	}
+}
+
+// Evaluate applies the SLOs declared in workflow definitions, then
+// evaluates every SLO, stores its status and notifies the burn alerts
+// raised or cleared since the last notification
+func (m *Manager) Evaluate(ctx context.Context) error {
+	if err := m.syncWorkflows(ctx); err != nil {
+		return err
+	}
+
+	slos, err := m.store.List(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list SLOs: %w", err)
+	}
+	now := m.now().UTC()
+	var errs []error
+	for _, slo := range slos {
+		if _, err := m.evaluate(ctx, slo, now); err != nil {
+			errs = append(errs, fmt.Errorf("SLO %s of workflow %s: %w", slo.Name, slo.WorkflowID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// evaluate computes the status of an SLO at a time
+func (m *Manager) evaluate(ctx context.Context, slo *SLO, now time.Time) (*Status, error) {
+	definition := slo.Definition()
+	window, err := m.count(slo, definition.WindowDuration(), now)
+	if err != nil {
+		return nil, err
+	}
+	fast, err := m.count(slo, m.config.FastBurnWindow, now)
+	if err != nil {
+		return nil, err
+	}
+	slow, err := m.count(slo, m.config.SlowBurnWindow, now)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		SLOID:           slo.ID,
+		WorkflowID:      slo.WorkflowID,
+		Name:            slo.Name,
+		Step:            slo.Step,
+		Type:            slo.Type,
+		Target:          slo.Target,
+		WindowStart:     since(slo, definition.WindowDuration(), now),
+		EvaluatedAt:     now,
+		Total:           window.Total,
+		Bad:             window.Bad,
+		Compliance:      compliance(window),
+		BudgetRemaining: budgetRemaining(window, slo.Target),
+		FastBurnRate:    burnRate(fast, slo.Target),
+		SlowBurnRate:    burnRate(slow, slo.Target),
+		Alert:           AlertNone,
+		Notified:        AlertNone,
+	}
+	switch {
+	case status.FastBurnRate >= m.config.FastBurnRate:
+		status.Alert = AlertFastBurn
+	case status.SlowBurnRate >= m.config.SlowBurnRate:
+		status.Alert = AlertSlowBurn
+	}
+
+	previous, err := m.store.GetStatus(ctx, slo.ID)
+	switch {
+	case err == nil:
+		status.Notified = previous.Notified
+	case !errors.Is(err, ErrSLONotFound):
+		return nil, err
+	}
+	if status.Alert != status.Notified {
+		m.notify(ctx, slo, status, now)
+	}
+
+	if err := m.store.SaveStatus(ctx, status); err != nil {
+		return nil, fmt.Errorf("failed to save status: %w", err)
+	}
+	m.record(status)
+	return status, nil
+}
+
+// count counts the outcomes of the runs of an SLO over the last period,
+// from the start of its window at most
+func (m *Manager) count(slo *SLO, period time.Duration, now time.Time) (Outcomes, error) {
+	var threshold time.Duration
+	if slo.Type == models.SLOTypeLatency {
+		definition := slo.Definition()
+		threshold = definition.ThresholdDuration()
+	}
+	total, failed, slow, err := m.outcomes.CountOutcomes(slo.WorkflowID, slo.Step, since(slo, period, now), now, threshold)
+	if err != nil {
+		return Outcomes{}, fmt.Errorf("failed to count outcomes: %w", err)
+	}
+	if slo.Type == models.SLOTypeLatency {
+		return Outcomes{Total: total, Bad: slow}, nil
+	}
+	return Outcomes{Total: total, Bad: failed}, nil
+}
+
+// since returns the start of the last period of an SLO, the start of its
+// window at most
+func since(slo *SLO, period time.Duration, now time.Time) time.Time {
+	start := now.Add(-period)
+	if start.Before(slo.WindowStart) {
+		return slo.WindowStart
+	}
+	return start
+}
+
+// notify notifies that the alert of an SLO changed, unless a maintenance
+// window is active. Suppressed notifications leave the notified alert
+// unchanged, so they are sent after the window if the alert still holds.
+func (m *Manager) notify(ctx context.Context, slo *SLO, status *Status, now time.Time) {
+	if m.maintenance != nil {
+		if window, active := m.maintenance.ActiveWindow(now); active {
+			status.SuppressedBy = window.Name
+			return
+		}
+	}
+	if m.notifier != nil {
+		m.notifier.NotifyBurn(ctx, &Notification{SLO: slo, Status: status, Previous: status.Notified})
+	}
+	status.Notified = status.Alert
+}
+
+// record records the budget and burn rate metrics of a status
+func (m *Manager) record(status *Status) {
+	if m.metrics == nil {
+		return
+	}
+	labels := func(extra ...string) map[string]string {
+		labels := map[string]string{"workflow_id": status.WorkflowID.String(), "slo": status.Name}
+		for i := 0; i+1 < len(extra); i += 2 {
+			labels[extra[i]] = extra[i+1]
+		}
+		return labels
+	}
+	m.metrics.RecordMetric("slo_error_budget_remaining", status.BudgetRemaining, labels())
+	m.metrics.RecordMetric("slo_burn_rate", status.FastBurnRate, labels("window", "fast"))
+	m.metrics.RecordMetric("slo_burn_rate", status.SlowBurnRate, labels("window", "slow"))
+}
+
+// WorkflowHealth summarizes the SLOs of a workflow
+type WorkflowHealth struct {
+	WorkflowID uuid.UUID `json:"workflow_id"`
+	SLOs       int       `json:"slos"`
+	// Breached counts the SLOs below their target over their window
+	Breached int `json:"breached"`
+	// Alert is the most severe burn alert of the SLOs
+	Alert Alert `json:"alert"`
+	// BudgetRemaining is the lowest share of error budget left
+	BudgetRemaining float64 `json:"budget_remaining"`
+}
+
+// Health returns the SLO health of each workflow with evaluated SLOs
+func (m *Manager) Health(ctx context.Context) ([]*WorkflowHealth, error) {
+	statuses, err := m.store.ListStatuses(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var health []*WorkflowHealth
+	byWorkflow := make(map[uuid.UUID]*WorkflowHealth)
+	for _, status := range statuses {
+		workflow, exists := byWorkflow[status.WorkflowID]
+		if !exists {
+			workflow = &WorkflowHealth{WorkflowID: status.WorkflowID, Alert: AlertNone, BudgetRemaining: status.BudgetRemaining}
+			byWorkflow[status.WorkflowID] = workflow
+			health = append(health, workflow)
+		}
+		workflow.SLOs++
+		if !status.Met() {
+			workflow.Breached++
+		}
+		if status.Alert.severity() > workflow.Alert.severity() {
+			workflow.Alert = status.Alert
+		}
+		if status.BudgetRemaining < workflow.BudgetRemaining {
+			workflow.BudgetRemaining = status.BudgetRemaining
+		}
+	}
+	return health, nil
+}
+
+// Start evaluates the SLOs at the evaluation interval until Stop is called
+func (m *Manager) Start(ctx context.Context) {
+	m.stopCh = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.config.EvaluationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Evaluate(ctx); err != nil {
+					m.logger.WithError(err).Error("Failed to evaluate SLOs")
+				}
+			case <-m.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops evaluating SLOs
+func (m *Manager) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.stopCh = nil
+}
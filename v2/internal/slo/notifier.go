@@ -0,0 +1,60 @@
+package slo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// EventType is the type of the events notifying burn alerts
+const EventType = "slo.burn_rate"
+
+// Notification tells that the burn alert of an SLO was raised or cleared
+type Notification struct {
+	SLO    *SLO
+	Status *Status
+	// Previous is the alert notified before
+	Previous Alert
+}
+
+// Notifier notifies burn alerts
+type Notifier interface {
+	NotifyBurn(ctx context.Context, notification *Notification)
+}
+
+// EventPublisher publishes events to the engine event handlers, which
+// deliver them to the webhooks and notifications subscribed to their type.
+// The engine implements it.
+type EventPublisher interface {
+	PublishEvent(eventType string, workflowID uuid.UUID, data map[string]interface{})
+}
+
+// EventNotifier notifies burn alerts as slo.burn_rate events, through the
+// same routes as the execution events of the workflow
+type EventNotifier struct {
+	publisher EventPublisher
+}
+
+// NewEventNotifier creates a notifier publishing burn alerts as events
+func NewEventNotifier(publisher EventPublisher) *EventNotifier {
+	return &EventNotifier{publisher: publisher}
+}
+
+// NotifyBurn publishes a burn alert event
+func (n *EventNotifier) NotifyBurn(ctx context.Context, notification *Notification) {
+	slo, status := notification.SLO, notification.Status
+	n.publisher.PublishEvent(EventType, slo.WorkflowID, map[string]interface{}{
+		"slo":              slo.Name,
+		"step":             slo.Step,
+		"type":             slo.Type,
+		"target":           slo.Target,
+		"window":           slo.Window,
+		"window_start":     status.WindowStart,
+		"alert":            status.Alert,
+		"previous_alert":   notification.Previous,
+		"compliance":       status.Compliance,
+		"budget_remaining": status.BudgetRemaining,
+		"fast_burn_rate":   status.FastBurnRate,
+		"slow_burn_rate":   status.SlowBurnRate,
+	})
+}
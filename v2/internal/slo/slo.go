@@ -0,0 +1,237 @@
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/pkg/models"
+)
+
+var (
+	// ErrSLONotFound is returned when a workflow has no SLO of a name
+	ErrSLONotFound = errors.New("SLO not found")
+	// ErrSLOExists is returned when a workflow already has an SLO of a name
+	ErrSLOExists = errors.New("SLO already exists")
+	// ErrInvalidSLO is returned when an SLO definition is invalid
+	ErrInvalidSLO = errors.New("invalid SLO")
+	// ErrDeclared is returned when an SLO declared in the definition of a
+	// workflow is changed through the API
+	ErrDeclared = errors.New("SLO is declared in the workflow definition")
+)
+
+// Source is where an SLO was declared
+type Source string
+
+const (
+	// SourceDefinition SLOs are declared in the workflow definition and
+	// follow its changes
+	SourceDefinition Source = "definition"
+	// SourceAPI SLOs are managed through the API
+	SourceAPI Source = "api"
+)
+
+// SLO is a service level objective of a workflow or of one of its steps.
+// WindowStart is when its rolling window was last reset: runs before it do
+// not count, so a changed objective is never measured against runs of the
+// objective it replaced.
+type SLO struct {
+	ID         uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey"`
+	WorkflowID uuid.UUID      `json:"workflow_id" gorm:"type:uuid;not null;uniqueIndex:idx_slos_workflow_name,priority:1"`
+	Name       string         `json:"name" gorm:"not null;uniqueIndex:idx_slos_workflow_name,priority:2"`
+	Step       string         `json:"step,omitempty"`
+	Type       models.SLOType `json:"type" gorm:"not null"`
+	Threshold  string         `json:"threshold,omitempty"`
+	Target     float64        `json:"target" gorm:"not null"`
+	Window     string         `json:"window" gorm:"not null"`
+	Source     Source         `json:"source" gorm:"not null"`
+
+	WindowStart time.Time `json:"window_start"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the SLO model
+func (SLO) TableName() string {
+	return "slos"
+}
+
+// Definition returns the objective of the SLO
+func (s *SLO) Definition() models.SLODefinition {
+	return models.SLODefinition{
+		Name:      s.Name,
+		Step:      s.Step,
+		Type:      s.Type,
+		Threshold: s.Threshold,
+		Target:    s.Target,
+		Window:    s.Window,
+	}
+}
+
+// Subject returns the workflow or step the SLO applies to
+func (s *SLO) Subject() string {
+	if s.Step != "" {
+		return fmt.Sprintf("step %s of workflow %s", s.Step, s.WorkflowID)
+	}
+	return fmt.Sprintf("workflow %s", s.WorkflowID)
+}
+
+func (s *SLO) apply(definition models.SLODefinition) {
+	s.Name = definition.Name
+	s.Step = definition.Step
+	s.Type = definition.Type
+	s.Threshold = definition.Threshold
+	s.Target = definition.Target
+	s.Window = definition.Window
+}
+
+// changes describes how a definition changes the objective of the SLO,
+// empty when it does not
+func (s *SLO) changes(definition models.SLODefinition) string {
+	current := s.Definition()
+	var changes []string
+	diff := func(field string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s %v -> %v", field, from, to))
+		}
+	}
+	diff("step", current.Step, definition.Step)
+	diff("type", current.Type, definition.Type)
+	diff("threshold", current.Threshold, definition.Threshold)
+	diff("target", current.Target, definition.Target)
+	diff("window", current.Window, definition.Window)
+	return strings.Join(changes, ", ")
+}
+
+// Alert is the burn alert of an SLO
+type Alert string
+
+const (
+	// AlertNone is the alert of SLOs burning their error budget slower
+	// than both thresholds
+	AlertNone Alert = "none"
+	// AlertSlowBurn is raised when the budget burns at the slow burn rate
+	// over the slow burn window
+	AlertSlowBurn Alert = "slow_burn"
+	// AlertFastBurn is raised when the budget burns at the fast burn rate
+	// over the fast burn window
+	AlertFastBurn Alert = "fast_burn"
+)
+
+// severity orders alerts
+func (a Alert) severity() int {
+	switch a {
+	case AlertFastBurn:
+		return 2
+	case AlertSlowBurn:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Status is the latest evaluation of an SLO
+type Status struct {
+	SLOID      uuid.UUID      `json:"slo_id" gorm:"type:uuid;primaryKey"`
+	WorkflowID uuid.UUID      `json:"workflow_id" gorm:"type:uuid;not null;index"`
+	Name       string         `json:"name"`
+	Step       string         `json:"step,omitempty"`
+	Type       models.SLOType `json:"type"`
+	Target     float64        `json:"target"`
+
+	WindowStart time.Time `json:"window_start"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+	// Total counts the runs finished within the window, Bad those that
+	// missed the objective
+	Total int64 `json:"total"`
+	Bad   int64 `json:"bad"`
+	// Compliance is the percentage of runs that met the objective
+	Compliance float64 `json:"compliance"`
+	// BudgetRemaining is the share of the error budget of the window left,
+	// negative once the budget is spent
+	BudgetRemaining float64 `json:"budget_remaining"`
+	// FastBurnRate and SlowBurnRate are how many times faster than the
+	// window allows the budget burned over the fast and slow burn windows
+	FastBurnRate float64 `json:"fast_burn_rate"`
+	SlowBurnRate float64 `json:"slow_burn_rate"`
+	Alert        Alert   `json:"alert"`
+	// Notified is the last alert notified. It lags Alert while
+	// notifications are suppressed by a maintenance window.
+	Notified     Alert  `json:"notified"`
+	SuppressedBy string `json:"suppressed_by,omitempty"`
+}
+
+// TableName returns the table name for the Status model
+func (Status) TableName() string {
+	return "slo_statuses"
+}
+
+// Met reports whether the SLO meets its target over the window
+func (s *Status) Met() bool {
+	return s.Compliance >= s.Target
+}
+
+// AuditEntry records a change of an SLO. Changes of the objective and
+// explicit resets reset the window of the SLO.
+type AuditEntry struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	SLOID      uuid.UUID `json:"slo_id" gorm:"type:uuid;not null;index"`
+	WorkflowID uuid.UUID `json:"workflow_id" gorm:"type:uuid;not null;index"`
+	Name       string    `json:"name"`
+	// Action is created, updated, reset or deleted
+	Action  string `json:"action" gorm:"not null"`
+	Changes string `json:"changes,omitempty"`
+	// WindowStart is the start of the window after the change, zero for
+	// deleted SLOs
+	WindowStart time.Time `json:"window_start"`
+	Actor       string    `json:"actor"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the AuditEntry model
+func (AuditEntry) TableName() string {
+	return "slo_audit"
+}
+
+// Outcomes counts the good and bad runs of an SLO over a period
+type Outcomes struct {
+	Total int64
+	Bad   int64
+}
+
+// burnRate returns how many times faster than allowed the outcomes burn
+// the error budget of a target. A rate of 1 spends the whole budget in
+// exactly one window.
+func burnRate(outcomes Outcomes, target float64) float64 {
+	if outcomes.Total == 0 {
+		return 0
+	}
+	return badRatio(outcomes) / budget(target)
+}
+
+// budgetRemaining returns the share of the error budget of a target the
+// outcomes of a window leave
+func budgetRemaining(outcomes Outcomes, target float64) float64 {
+	return 1 - burnRate(outcomes, target)
+}
+
+// compliance returns the percentage of good runs, 100 without runs
+func compliance(outcomes Outcomes) float64 {
+	if outcomes.Total == 0 {
+		return 100
+	}
+	return 100 * (1 - badRatio(outcomes))
+}
+
+func badRatio(outcomes Outcomes) float64 {
+	return float64(outcomes.Bad) / float64(outcomes.Total)
+}
+
+// budget returns the share of runs a target allows to miss the objective
+func budget(target float64) float64 {
+	return 1 - target/100
+}
@@ -0,0 +1,384 @@
+package slo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/internal/admission"
+	"magic-flow/v2/pkg/models"
+)
+
+var start = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+type fakeWorkflows map[uuid.UUID]*models.Workflow
+
+func (w fakeWorkflows) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	workflow, ok := w[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return workflow, nil
+}
+
+func (w fakeWorkflows) List(limit, offset int, status string) ([]*models.Workflow, int64, error) {
+	var workflows []*models.Workflow
+	for _, workflow := range w {
+		if status == "" || string(workflow.Status) == status {
+			workflows = append(workflows, workflow)
+		}
+	}
+	total := int64(len(workflows))
+	if offset >= len(workflows) {
+		return nil, total, nil
+	}
+	workflows = workflows[offset:]
+	if len(workflows) > limit {
+		workflows = workflows[:limit]
+	}
+	return workflows, total, nil
+}
+
+// run is a finished execution, or step execution when step is set
+type run struct {
+	workflowID  uuid.UUID
+	step        string
+	completedAt time.Time
+	duration    time.Duration
+	failed      bool
+}
+
+type seededRuns []run
+
+func (r *seededRuns) CountOutcomes(workflowID uuid.UUID, step string, from, to time.Time, slowerThan time.Duration) (total, failed, slow int64, err error) {
+	for _, run := range *r {
+		if run.workflowID != workflowID || run.step != step || run.completedAt.Before(from) || run.completedAt.After(to) {
+			continue
+		}
+		total++
+		if run.failed {
+			failed++
+		}
+		if slowerThan > 0 && run.duration > slowerThan {
+			slow++
+		}
+	}
+	return total, failed, slow, nil
+}
+
+// seed adds count runs completed at a time, failed ones first
+func (r *seededRuns) seed(workflowID uuid.UUID, step string, at time.Time, count, failed int, duration time.Duration) {
+	for i := 0; i < count; i++ {
+		*r = append(*r, run{workflowID: workflowID, step: step, completedAt: at, duration: duration, failed: i < failed})
+	}
+}
+
+type publishedEvent struct {
+	eventType  string
+	workflowID uuid.UUID
+	data       map[string]interface{}
+}
+
+type recordingPublisher struct {
+	events []publishedEvent
+}
+
+func (p *recordingPublisher) PublishEvent(eventType string, workflowID uuid.UUID, data map[string]interface{}) {
+	p.events = append(p.events, publishedEvent{eventType: eventType, workflowID: workflowID, data: data})
+}
+
+var checkoutID = uuid.MustParse("2f8b6d4a-0c1e-4a3b-9d5f-7e6a8b9c0d1e")
+
+// newCheckout returns the checkout workflow, charging and shipping orders
+func newCheckout() *models.Workflow {
+	return &models.Workflow{
+		ID:      checkoutID,
+		Name:    "checkout",
+		Version: "1.0.0",
+		Status:  models.WorkflowStatusActive,
+		Definition: models.WorkflowDefinition{Spec: models.WorkflowSpec{
+			Steps: []models.WorkflowStep{{Name: "charge", Type: "http"}, {Name: "ship", Type: "http"}},
+		}},
+	}
+}
+
+// newTestManager returns a manager measuring the SLOs of checkout on runs
+// at the time now points to
+func newTestManager(checkout *models.Workflow, runs *seededRuns, now *time.Time) *Manager {
+	manager := NewManager(DefaultConfig(), NewMemoryStore(), fakeWorkflows{checkout.ID: checkout}, runs, logrus.New())
+	manager.now = func() time.Time { return *now }
+	return manager
+}
+
+func createSLO(t *testing.T, manager *Manager, definition models.SLODefinition) *SLO {
+	t.Helper()
+	slo, err := manager.Create(context.Background(), checkoutID, definition, "alice", "checkout promise")
+	require.NoError(t, err)
+	return slo
+}
+
+// evaluate evaluates the SLOs and returns the statuses of those of checkout
+// by name
+func evaluate(t *testing.T, manager *Manager) map[string]*Status {
+	t.Helper()
+	require.NoError(t, manager.Evaluate(context.Background()))
+	statuses, err := manager.Statuses(context.Background(), checkoutID)
+	require.NoError(t, err)
+	byName := make(map[string]*Status, len(statuses))
+	for _, status := range statuses {
+		byName[status.Name] = status
+	}
+	return byName
+}
+
+var successRate = models.SLODefinition{Name: "success", Type: models.SLOTypeSuccessRate, Target: 99, Window: "720h"}
+
+func TestBurnRateMath(t *testing.T) {
+	now, runs := start, &seededRuns{}
+	manager := newTestManager(newCheckout(), runs, &now)
+	createSLO(t, manager, successRate)
+	createSLO(t, manager, models.SLODefinition{Name: "latency", Type: models.SLOTypeLatency, Threshold: "30s", Target: 99, Window: "720h"})
+	createSLO(t, manager, models.SLODefinition{Name: "charge", Step: "charge", Type: models.SLOTypeSuccessRate, Target: 99.9, Window: "24h"})
+
+	// The window of the SLOs starts when they are created, runs are
+	// measured from then
+	now = start.Add(20 * 24 * time.Hour)
+	id := checkoutID
+	runs.seed(id, "", start.Add(-time.Hour), 500, 500, time.Minute)
+	runs.seed(id, "", now.Add(-10*24*time.Hour), 880, 0, 10*time.Second)
+	runs.seed(id, "", now.Add(-3*time.Hour), 100, 6, 45*time.Second)
+	runs.seed(id, "", now.Add(-30*time.Minute), 20, 5, 20*time.Second)
+	runs.seed(id, "charge", now.Add(-2*24*time.Hour), 1000, 1000, time.Second)
+	runs.seed(id, "charge", now.Add(-2*time.Hour), 1000, 0, time.Second)
+
+	statuses := evaluate(t, manager)
+	require.Len(t, statuses, 3)
+
+	success := statuses["success"]
+	assert.EqualValues(t, 1000, success.Total, "runs before the window do not count")
+	assert.EqualValues(t, 11, success.Bad)
+	assert.InDelta(t, 98.9, success.Compliance, 1e-9)
+	assert.InDelta(t, -0.1, success.BudgetRemaining, 1e-9)
+	assert.InDelta(t, 25, success.FastBurnRate, 1e-9, "5 failures of 20 runs over the last hour")
+	assert.InDelta(t, 11.0/120/0.01, success.SlowBurnRate, 1e-9)
+	assert.Equal(t, AlertFastBurn, success.Alert)
+	assert.False(t, success.Met())
+
+	latency := statuses["latency"]
+	assert.EqualValues(t, 1000, latency.Total)
+	assert.EqualValues(t, 100, latency.Bad, "runs slower than 30s miss the objective")
+	assert.InDelta(t, 90, latency.Compliance, 1e-9)
+	assert.InDelta(t, -9, latency.BudgetRemaining, 1e-9)
+	assert.InDelta(t, 0, latency.FastBurnRate, 1e-9)
+	assert.InDelta(t, 100.0/120/0.01, latency.SlowBurnRate, 1e-9)
+	assert.Equal(t, AlertSlowBurn, latency.Alert)
+
+	charge := statuses["charge"]
+	assert.Equal(t, "charge", charge.Step)
+	assert.EqualValues(t, 1000, charge.Total, "the window of step SLOs is their own")
+	assert.EqualValues(t, 0, charge.Bad)
+	assert.InDelta(t, 1, charge.BudgetRemaining, 1e-9)
+	assert.Equal(t, AlertNone, charge.Alert)
+	assert.True(t, charge.Met())
+
+	health, err := manager.Health(context.Background())
+	require.NoError(t, err)
+	require.Len(t, health, 1)
+	assert.Equal(t, id, health[0].WorkflowID)
+	assert.Equal(t, 3, health[0].SLOs)
+	assert.Equal(t, 2, health[0].Breached)
+	assert.Equal(t, AlertFastBurn, health[0].Alert)
+	assert.InDelta(t, -9, health[0].BudgetRemaining, 1e-9)
+
+	t.Run("SLOs without runs keep their budget", func(t *testing.T) {
+		assert.InDelta(t, 100, compliance(Outcomes{}), 1e-9)
+		assert.InDelta(t, 1, budgetRemaining(Outcomes{}, 99), 1e-9)
+		assert.InDelta(t, 0, burnRate(Outcomes{}, 99), 1e-9)
+	})
+}
+
+func TestBurnNotifications(t *testing.T) {
+	now, runs, publisher := start, &seededRuns{}, &recordingPublisher{}
+	manager := newTestManager(newCheckout(), runs, &now)
+	manager.SetNotifier(NewEventNotifier(publisher))
+	createSLO(t, manager, successRate)
+	id := checkoutID
+
+	now = start.Add(24 * time.Hour)
+	runs.seed(id, "", now.Add(-5*time.Hour), 200, 0, time.Second)
+	assert.Equal(t, AlertNone, evaluate(t, manager)["success"].Alert)
+	assert.Empty(t, publisher.events, "healthy SLOs notify nothing")
+
+	// 30 failures of 300 runs over the last 6 hours burn the budget 10
+	// times faster than allowed, 10 of 80 over the last hour 12.5 times
+	runs.seed(id, "", now.Add(-4*time.Hour), 20, 20, time.Second)
+	runs.seed(id, "", now.Add(-10*time.Minute), 80, 10, time.Second)
+	status := evaluate(t, manager)["success"]
+	assert.Equal(t, AlertSlowBurn, status.Alert)
+	require.Len(t, publisher.events, 1)
+	event := publisher.events[0]
+	assert.Equal(t, EventType, event.eventType)
+	assert.Equal(t, id, event.workflowID)
+	assert.Equal(t, AlertSlowBurn, event.data["alert"])
+	assert.Equal(t, AlertNone, event.data["previous_alert"])
+	assert.Equal(t, "success", event.data["slo"])
+
+	evaluate(t, manager)
+	assert.Len(t, publisher.events, 1, "alerts are notified when they change")
+
+	runs.seed(id, "", now.Add(-5*time.Minute), 100, 40, time.Second)
+	assert.Equal(t, AlertFastBurn, evaluate(t, manager)["success"].Alert)
+	require.Len(t, publisher.events, 2)
+	assert.Equal(t, AlertFastBurn, publisher.events[1].data["alert"])
+	assert.Equal(t, AlertSlowBurn, publisher.events[1].data["previous_alert"])
+
+	t.Run("maintenance windows suppress notifications", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		manager.SetMaintenance(admission.MaintenanceWindows{{
+			Name:  "database-upgrade",
+			Start: now.Add(-time.Hour),
+			End:   now.Add(time.Hour),
+		}})
+		status := evaluate(t, manager)["success"]
+		assert.Equal(t, AlertSlowBurn, status.Alert)
+		assert.Equal(t, AlertFastBurn, status.Notified)
+		assert.Equal(t, "database-upgrade", status.SuppressedBy)
+		assert.Len(t, publisher.events, 2)
+
+		// The alert still holds after the window and is notified then
+		now = now.Add(90 * time.Minute)
+		status = evaluate(t, manager)["success"]
+		assert.Equal(t, AlertSlowBurn, status.Alert)
+		assert.Empty(t, status.SuppressedBy)
+		require.Len(t, publisher.events, 3)
+		assert.Equal(t, AlertSlowBurn, publisher.events[2].data["alert"])
+		assert.Equal(t, AlertFastBurn, publisher.events[2].data["previous_alert"])
+	})
+
+	t.Run("recoveries are notified", func(t *testing.T) {
+		now = now.Add(12 * time.Hour)
+		runs.seed(id, "", now.Add(-time.Hour), 500, 0, time.Second)
+		status := evaluate(t, manager)["success"]
+		assert.Equal(t, AlertNone, status.Alert)
+		assert.Less(t, status.BudgetRemaining, 1.0, "the budget spent stays spent within the window")
+		require.Len(t, publisher.events, 4)
+		assert.Equal(t, AlertNone, publisher.events[3].data["alert"])
+	})
+}
+
+func TestWindowReset(t *testing.T) {
+	ctx := context.Background()
+	now, runs, checkout := start, &seededRuns{}, newCheckout()
+	manager := newTestManager(checkout, runs, &now)
+	created := createSLO(t, manager, successRate)
+	assert.Equal(t, start, created.WindowStart)
+	id := checkoutID
+
+	now = start.Add(24 * time.Hour)
+	runs.seed(id, "", now.Add(-12*time.Hour), 100, 10, time.Second)
+	assert.EqualValues(t, 100, evaluate(t, manager)["success"].Total)
+
+	unchanged, err := manager.Update(ctx, id, "success", successRate, "bob", "no change")
+	require.NoError(t, err)
+	assert.Equal(t, start, unchanged.WindowStart, "updates leaving the objective unchanged keep the window")
+
+	stricter := successRate
+	stricter.Target = 99.5
+	updated, err := manager.Update(ctx, id, "success", stricter, "bob", "tighter promise")
+	require.NoError(t, err)
+	assert.Equal(t, now, updated.WindowStart)
+
+	status := evaluate(t, manager)["success"]
+	assert.Equal(t, now, status.WindowStart)
+	assert.Zero(t, status.Total, "runs measured against the previous objective do not count")
+	assert.InDelta(t, 1, status.BudgetRemaining, 1e-9)
+	assert.InDelta(t, 99.5, status.Target, 1e-9)
+
+	now = now.Add(time.Hour)
+	runs.seed(id, "", now.Add(-time.Minute), 10, 0, time.Second)
+	reset, err := manager.Reset(ctx, id, "success", "carol", "incident fixed")
+	require.NoError(t, err)
+	assert.Equal(t, now, reset.WindowStart)
+
+	entries, err := manager.Audit(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "reset", entries[0].Action)
+	assert.Equal(t, "carol", entries[0].Actor)
+	assert.Equal(t, "incident fixed", entries[0].Reason)
+	assert.Equal(t, now, entries[0].WindowStart)
+	assert.Equal(t, "updated", entries[1].Action)
+	assert.Equal(t, "target 99 -> 99.5", entries[1].Changes)
+	assert.Equal(t, "bob", entries[1].Actor)
+	assert.Equal(t, "created", entries[2].Action)
+
+	t.Run("SLOs declared in the definition follow it", func(t *testing.T) {
+		checkout.Definition.Spec.SLOs = []models.SLODefinition{
+			{Name: "charge-latency", Step: "charge", Type: models.SLOTypeLatency, Threshold: "2s", Target: 99, Window: "168h"},
+		}
+		slos, err := manager.List(ctx, id)
+		require.NoError(t, err)
+		require.Len(t, slos, 2)
+		declared := slos[0]
+		assert.Equal(t, "charge-latency", declared.Name)
+		assert.Equal(t, SourceDefinition, declared.Source)
+
+		_, err = manager.Update(ctx, id, "charge-latency", checkout.Definition.Spec.SLOs[0], "bob", "")
+		assert.ErrorIs(t, err, ErrDeclared)
+		assert.ErrorIs(t, manager.Delete(ctx, id, "charge-latency", "bob", ""), ErrDeclared)
+
+		now = now.Add(time.Hour)
+		checkout.Version = "1.1.0"
+		checkout.Definition.Spec.SLOs[0].Threshold = "1s"
+		require.NoError(t, manager.Evaluate(ctx))
+		changed, err := manager.store.Get(ctx, id, "charge-latency")
+		require.NoError(t, err)
+		assert.Equal(t, "1s", changed.Threshold)
+		assert.Equal(t, now, changed.WindowStart)
+
+		checkout.Definition.Spec.SLOs = nil
+		require.NoError(t, manager.Evaluate(ctx))
+		_, err = manager.store.Get(ctx, id, "charge-latency")
+		assert.ErrorIs(t, err, ErrSLONotFound)
+
+		entries, err := manager.Audit(ctx, id)
+		require.NoError(t, err)
+		require.Len(t, entries, 6)
+		assert.Equal(t, "deleted", entries[0].Action)
+		assert.Equal(t, "updated", entries[1].Action)
+		assert.Equal(t, "threshold 2s -> 1s", entries[1].Changes)
+		assert.Equal(t, definitionActor, entries[1].Actor)
+		assert.Equal(t, "definition of workflow version 1.1.0", entries[1].Reason)
+		assert.Equal(t, "created", entries[2].Action)
+	})
+}
+
+func TestInvalidSLOs(t *testing.T) {
+	tests := map[string]struct {
+		definition models.SLODefinition
+		err        error
+	}{
+		"latency without threshold": {definition: models.SLODefinition{Name: "latency", Type: models.SLOTypeLatency, Target: 99, Window: "720h"}, err: ErrInvalidSLO},
+		"target of 100":             {definition: models.SLODefinition{Name: "success", Type: models.SLOTypeSuccessRate, Target: 100, Window: "720h"}, err: ErrInvalidSLO},
+		"window in days":            {definition: models.SLODefinition{Name: "success", Type: models.SLOTypeSuccessRate, Target: 99, Window: "30d"}, err: ErrInvalidSLO},
+		"unknown step":              {definition: models.SLODefinition{Name: "refund", Step: "refund", Type: models.SLOTypeSuccessRate, Target: 99, Window: "720h"}, err: ErrInvalidSLO},
+		"existing name":             {definition: successRate, err: ErrSLOExists},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := start
+			manager := newTestManager(newCheckout(), &seededRuns{}, &now)
+			createSLO(t, manager, successRate)
+
+			_, err := manager.Create(context.Background(), checkoutID, tt.definition, "bob", "")
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package slo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists SLOs, their latest status and their audit log
+type Store interface {
+	Create(ctx context.Context, slo *SLO) error
+	Update(ctx context.Context, slo *SLO) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	Get(ctx context.Context, workflowID uuid.UUID, name string) (*SLO, error)
+	// List returns the SLOs of a workflow, of every workflow when
+	// workflowID is nil, ordered by workflow and name
+	List(ctx context.Context, workflowID *uuid.UUID) ([]*SLO, error)
+
+	SaveStatus(ctx context.Context, status *Status) error
+	GetStatus(ctx context.Context, sloID uuid.UUID) (*Status, error)
+	// ListStatuses returns the statuses of the SLOs of a workflow, of every
+	// workflow when workflowID is nil, ordered by workflow and name
+	ListStatuses(ctx context.Context, workflowID *uuid.UUID) ([]*Status, error)
+
+	RecordAudit(ctx context.Context, entry *AuditEntry) error
+	// ListAudit returns the audit entries of the SLOs of a workflow, the
+	// most recent first
+	ListAudit(ctx context.Context, workflowID uuid.UUID) ([]*AuditEntry, error)
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu       sync.RWMutex
+	slos     map[uuid.UUID]*SLO
+	statuses map[uuid.UUID]*Status
+	audit    []*AuditEntry
+}
+
+// NewMemoryStore creates an in-memory SLO store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		slos:     make(map[uuid.UUID]*SLO),
+		statuses: make(map[uuid.UUID]*Status),
+	}
+}
+
+// Create stores a new SLO
+func (s *MemoryStore) Create(ctx context.Context, slo *SLO) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.slos {
+		if existing.WorkflowID == slo.WorkflowID && existing.Name == slo.Name {
+			return ErrSLOExists
+		}
+	}
+	stored := *slo
+	s.slos[slo.ID] = &stored
+	return nil
+}
+
+// Update replaces an SLO
+func (s *MemoryStore) Update(ctx context.Context, slo *SLO) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.slos[slo.ID]; !exists {
+		return ErrSLONotFound
+	}
+	stored := *slo
+	s.slos[slo.ID] = &stored
+	return nil
+}
+
+// Delete removes an SLO and its status
+func (s *MemoryStore) Delete(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.slos[id]; !exists {
+		return ErrSLONotFound
+	}
+	delete(s.slos, id)
+	delete(s.statuses, id)
+	return nil
+}
+
+// Get returns the SLO of a workflow with a name
+func (s *MemoryStore) Get(ctx context.Context, workflowID uuid.UUID, name string) (*SLO, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, slo := range s.slos {
+		if slo.WorkflowID == workflowID && slo.Name == name {
+			found := *slo
+			return &found, nil
+		}
+	}
+	return nil, ErrSLONotFound
+}
+
+// List returns the SLOs of a workflow, of every workflow when workflowID is
+// nil, ordered by workflow and name
+func (s *MemoryStore) List(ctx context.Context, workflowID *uuid.UUID) ([]*SLO, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	slos := make([]*SLO, 0, len(s.slos))
+	for _, slo := range s.slos {
+		if workflowID == nil || slo.WorkflowID == *workflowID {
+			found := *slo
+			slos = append(slos, &found)
+		}
+	}
+	sort.Slice(slos, func(i, j int) bool {
+		if slos[i].WorkflowID != slos[j].WorkflowID {
+			return slos[i].WorkflowID.String() < slos[j].WorkflowID.String()
+		}
+		return slos[i].Name < slos[j].Name
+	})
+	return slos, nil
+}
+
+// SaveStatus stores the latest status of an SLO
+func (s *MemoryStore) SaveStatus(ctx context.Context, status *Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *status
+	s.statuses[status.SLOID] = &stored
+	return nil
+}
+
+// GetStatus returns the latest status of an SLO
+func (s *MemoryStore) GetStatus(ctx context.Context, sloID uuid.UUID) (*Status, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status, exists := s.statuses[sloID]
+	if !exists {
+		return nil, ErrSLONotFound
+	}
+	found := *status
+	return &found, nil
+}
+
+// ListStatuses returns the statuses of the SLOs of a workflow, of every
+// workflow when workflowID is nil, ordered by workflow and name
+func (s *MemoryStore) ListStatuses(ctx context.Context, workflowID *uuid.UUID) ([]*Status, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]*Status, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		if workflowID == nil || status.WorkflowID == *workflowID {
+			found := *status
+			statuses = append(statuses, &found)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].WorkflowID != statuses[j].WorkflowID {
+			return statuses[i].WorkflowID.String() < statuses[j].WorkflowID.String()
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses, nil
+}
+
+// RecordAudit stores an audit entry
+func (s *MemoryStore) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = uint(len(s.audit) + 1)
+	stored := *entry
+	s.audit = append(s.audit, &stored)
+	return nil
+}
+
+// ListAudit returns the audit entries of the SLOs of a workflow, the most
+// recent first
+func (s *MemoryStore) ListAudit(ctx context.Context, workflowID uuid.UUID) ([]*AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []*AuditEntry
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		if s.audit[i].WorkflowID == workflowID {
+			entry := *s.audit[i]
+			entries = append(entries, &entry)
+		}
+	}
+	return entries, nil
+}
+
+// GormStore keeps SLOs, their last evaluated status and their audit trail in
+// three tables. An SLO and its status are deleted together.
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database SLO store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the SLO, status and audit tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&SLO{}, &Status{}, &AuditEntry{})
+}
+
+// Create stores a new SLO
+func (s *GormStore) Create(ctx context.Context, slo *SLO) error {
+	db := s.db.WithContext(ctx)
+	var count int64
+	if err := db.Model(&SLO{}).Where("workflow_id = ? AND name = ?", slo.WorkflowID, slo.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSLOExists
+	}
+	return db.Create(slo).Error
+}
+
+// Update replaces an SLO
+func (s *GormStore) Update(ctx context.Context, slo *SLO) error {
+	result := s.db.WithContext(ctx).Model(&SLO{}).Where("id = ?", slo.ID).Select("*").Updates(slo)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSLONotFound
+	}
+	return nil
+}
+
+// Delete removes an SLO and its status
+func (s *GormStore) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&SLO{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSLONotFound
+		}
+		return tx.Delete(&Status{}, "slo_id = ?", id).Error
+	})
+}
+
+// Get returns the SLO of a workflow with a name
+func (s *GormStore) Get(ctx context.Context, workflowID uuid.UUID, name string) (*SLO, error) {
+	var slo SLO
+	err := s.db.WithContext(ctx).Where("workflow_id = ? AND name = ?", workflowID, name).First(&slo).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSLONotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slo, nil
+}
+
+// List returns the SLOs of a workflow, of every workflow when workflowID is
+// nil, ordered by workflow and name
+func (s *GormStore) List(ctx context.Context, workflowID *uuid.UUID) ([]*SLO, error) {
+	query := s.db.WithContext(ctx).Order("workflow_id, name")
+	if workflowID != nil {
+		query = query.Where("workflow_id = ?", *workflowID)
+	}
+	var slos []*SLO
+	return slos, query.Find(&slos).Error
+}
+
+// SaveStatus stores the latest status of an SLO
+func (s *GormStore) SaveStatus(ctx context.Context, status *Status) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(status).Error
+}
+
+// GetStatus returns the latest status of an SLO
+func (s *GormStore) GetStatus(ctx context.Context, sloID uuid.UUID) (*Status, error) {
+	var status Status
+	err := s.db.WithContext(ctx).Where("slo_id = ?", sloID).First(&status).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSLONotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ListStatuses returns the statuses of the SLOs of a workflow, of every
+// workflow when workflowID is nil, ordered by workflow and name
+func (s *GormStore) ListStatuses(ctx context.Context, workflowID *uuid.UUID) ([]*Status, error) {
+	query := s.db.WithContext(ctx).Order("workflow_id, name")
+	if workflowID != nil {
+		query = query.Where("workflow_id = ?", *workflowID)
+	}
+	var statuses []*Status
+	return statuses, query.Find(&statuses).Error
+}
+
+// RecordAudit stores an audit entry
+func (s *GormStore) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	return s.db.WithContext(ctx).Create(entry).Error
+}
+
+// ListAudit returns the audit entries of the SLOs of a workflow, the most
+// recent first
+func (s *GormStore) ListAudit(ctx context.Context, workflowID uuid.UUID) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	err := s.db.WithContext(ctx).Where("workflow_id = ?", workflowID).Order("id DESC").Find(&entries).Error
+	return entries, err
+}
@@ -0,0 +1,180 @@
+package spikes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// defaultTriggerLimit is the number of triggers listed unless a request
+// sets a limit
+const defaultTriggerLimit = 100
+
+// Handlers provides HTTP handlers administering spike guards
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new spike guard handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers spike guard routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		spikes := v1.Group("/spikes")
+		{
+			spikes.GET("/guards", h.ListGuards)
+			spikes.POST("/guards/:subject/reset", h.ResetGuard)
+			spikes.GET("/triggers", h.ListTriggers)
+			spikes.GET("/overrides", h.ListOverrides)
+			spikes.POST("/overrides", h.CreateOverride)
+			spikes.DELETE("/overrides/:subject", h.DeleteOverride)
+		}
+	}
+}
+
+// OverrideRequest is the request body of an override, naming a workflow or
+// an API key
+type OverrideRequest struct {
+	WorkflowID *uuid.UUID `json:"workflow_id"`
+	APIKey     string     `json:"api_key"`
+	Until      time.Time  `json:"until" binding:"required"`
+	Reason     string     `json:"reason" binding:"required"`
+}
+
+// ListGuards returns the triggered guards and the overrides in effect
+// @Summary List spike guards
+// @Description Returns the triggered spike guards of workflows and API keys, with their current rate, and the overrides in effect
+// @Tags spikes
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/spikes/guards [get]
+func (h *Handlers) ListGuards(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"guards":    h.manager.Guards(),
+		"overrides": h.manager.Overrides(),
+	})
+}
+
+// ResetGuard resets the guard of a subject before its cool-down ends
+// @Summary Reset spike guard
+// @Tags spikes
+// @Produce json
+// @Param subject path string true "Subject, workflow:<id> or api_key:<caller>"
+// @Success 200 {object} Guard
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/spikes/guards/{subject}/reset [post]
+func (h *Handlers) ResetGuard(c *gin.Context) {
+	guard, err := h.manager.Reset(c.Request.Context(), c.Param("subject"), c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, guard)
+}
+
+// ListTriggers returns the recent triggers of spike guards
+// @Summary List spike guard triggers
+// @Tags spikes
+// @Produce json
+// @Param subject query string false "Subject"
+// @Param limit query int false "Number of triggers" default(100)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/spikes/triggers [get]
+func (h *Handlers) ListTriggers(c *gin.Context) {
+	limit := defaultTriggerLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+
+	triggers, err := h.manager.Triggers(c.Request.Context(), c.Query("subject"), limit)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"triggers": triggers})
+}
+
+// ListOverrides returns the overrides in effect
+// @Summary List spike guard overrides
+// @Tags spikes
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/spikes/overrides [get]
+func (h *Handlers) ListOverrides(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"overrides": h.manager.Overrides()})
+}
+
+// CreateOverride exempts a workflow or an API key from spike guards
+// @Summary Create spike guard override
+// @Description Exempts the submissions of a workflow or an API key from spike guards until a time, for planned bursts, and resets its guard. Capacity reservations pre-authorize the bursts of their workflows too.
+// @Tags spikes
+// @Accept json
+// @Produce json
+// @Param request body OverrideRequest true "Override"
+// @Success 201 {object} Override
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/spikes/overrides [post]
+func (h *Handlers) CreateOverride(c *gin.Context) {
+	var req OverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var subject string
+	switch {
+	case req.WorkflowID != nil && req.APIKey == "":
+		subject = WorkflowSubject(*req.WorkflowID)
+	case req.WorkflowID == nil && req.APIKey != "":
+		subject = APIKeySubject(req.APIKey)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of workflow_id and api_key is required"})
+		return
+	}
+
+	override, err := h.manager.Override(c.Request.Context(), subject, req.Until, req.Reason, c.GetHeader("X-User-ID"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, override)
+}
+
+// DeleteOverride ends the override of a subject
+// @Summary Delete spike guard override
+// @Tags spikes
+// @Param subject path string true "Subject"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/spikes/overrides/{subject} [delete]
+func (h *Handlers) DeleteOverride(c *gin.Context) {
+	if err := h.manager.RemoveOverride(c.Request.Context(), c.Param("subject")); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidSubject), errors.Is(err, ErrInvalidOverride):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrGuardNotFound), errors.Is(err, ErrOverrideNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
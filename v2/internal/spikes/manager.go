@@ -0,0 +1,606 @@
+package spikes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/admission"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrInvalidOverride is returned for overrides that would not be in effect
+var ErrInvalidOverride = errors.New("invalid override")
+
+// Reservations matches submissions to the capacity reservations
+// pre-authorizing their burst. The reservation manager implements it.
+type Reservations interface {
+	Match(ctx context.Context, workflow *models.Workflow, token string, at time.Time) (*admission.Reservation, error)
+}
+
+// Decision is the outcome of the guards of an admitted submission
+type Decision struct {
+	// Guards are the triggered guards of the subjects of the submission,
+	// which annotate it
+	Guards []*Guard `json:"guards,omitempty"`
+	// Reservation is the capacity reservation pre-authorizing the
+	// submission, which is not guarded
+	Reservation string `json:"reservation,omitempty"`
+}
+
+// Subjects returns the subjects of the guards of the submission
+func (d *Decision) Subjects() []string {
+	subjects := make([]string, len(d.Guards))
+	for i, guard := range d.Guards {
+		subjects[i] = guard.Subject
+	}
+	return subjects
+}
+
+// subjectState is the recent submissions of a subject and its guard
+type subjectState struct {
+	// minutes counts the submissions of each minute of the rate window
+	minutes map[int64]int64
+	guard   *Guard
+}
+
+func (s *subjectState) count(now time.Time) {
+	s.minutes[now.Unix()/60]++
+}
+
+// rate returns the submissions per hour over the window, forgetting the
+// minutes before it
+func (s *subjectState) rate(now time.Time, window time.Duration) float64 {
+	from := now.Add(-window).Unix() / 60
+	var total int64
+	for minute, count := range s.minutes {
+		if minute <= from {
+			delete(s.minutes, minute)
+			continue
+		}
+		total += count
+	}
+	return float64(total) * float64(time.Hour) / float64(window)
+}
+
+// baseline is the baseline rate of a subject during an hour
+type baseline struct {
+	hour time.Time
+	rate float64
+}
+
+// Manager counts the submissions of workflows and API keys, triggers their
+// guards on spikes and applies the action of the guards
+type Manager struct {
+	config       Config
+	store        Store
+	reservations Reservations
+	notifier     Notifier
+	logger       *logrus.Logger
+	now          func() time.Time
+
+	mu        sync.Mutex
+	subjects  map[string]*subjectState
+	baselines map[string]baseline
+	overrides map[string]*Override
+	// pending counts the admitted submissions not written to the hourly
+	// stats yet
+	pending map[countKey]int64
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager creates a spike guard manager
+func NewManager(config Config, store Store, logger *logrus.Logger) *Manager {
+	defaults := DefaultConfig()
+	if !config.Action.Valid() {
+		config.Action = defaults.Action
+	}
+	if config.Multiplier <= 0 {
+		config.Multiplier = defaults.Multiplier
+	}
+	if config.MinRate <= 0 {
+		config.MinRate = defaults.MinRate
+	}
+	if config.Window <= 0 {
+		config.Window = defaults.Window
+	}
+	if config.BaselineWindow < time.Hour {
+		config.BaselineWindow = defaults.BaselineWindow
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = defaults.CoolDown
+	}
+	if config.SweepInterval <= 0 {
+		config.SweepInterval = defaults.SweepInterval
+	}
+	return &Manager{
+		config:    config,
+		store:     store,
+		logger:    logger,
+		now:       time.Now,
+		subjects:  make(map[string]*subjectState),
+		baselines: make(map[string]baseline),
+		overrides: make(map[string]*Override),
+		pending:   make(map[countKey]int64),
+	}
+}
+
+// SetReservations sets the capacity reservations pre-authorizing bursts.
+// Submissions drawing on an active reservation of their workflow are not
+// guarded.
+func (m *Manager) SetReservations(reservations Reservations) {
+	m.reservations = reservations
+}
+
+// SetNotifier sets where the guards that trigger and reset are notified
+func (m *Manager) SetNotifier(notifier Notifier) {
+	m.notifier = notifier
+}
+
+// Refresh loads the overrides from the store
+func (m *Manager) Refresh(ctx context.Context) error {
+	overrides, err := m.store.ListOverrides(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load spike guard overrides: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overrides = make(map[string]*Override, len(overrides))
+	for _, override := range overrides {
+		m.overrides[override.Subject] = override
+	}
+	return nil
+}
+
+// Check counts a submission against its workflow and API key and applies
+// their guards, triggering them when the submission rate spikes. It
+// returns a *ConfirmationError or a *ThrottledError, both wrapping
+// ErrSpike, when a guard rejects the submission, which must not start.
+func (m *Manager) Check(ctx context.Context, submission *Submission) (*Decision, error) {
+	now := m.now().UTC()
+	if m.reservations != nil {
+		reservation, err := m.reservations.Match(ctx, submission.Workflow, "", now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match capacity reservations: %w", err)
+		}
+		if reservation != nil {
+			return &Decision{Reservation: reservation.Name}, nil
+		}
+	}
+
+	subjects := submission.subjects()
+	baselines := make([]float64, len(subjects))
+	for i, subject := range subjects {
+		rate, err := m.baseline(ctx, subject, now)
+		if err != nil {
+			return nil, err
+		}
+		baselines[i] = rate
+	}
+
+	m.mu.Lock()
+	decision := &Decision{}
+	var triggered []*Guard
+	var rejection error
+	for i, subject := range subjects {
+		state := m.stateLocked(subject)
+		state.count(now)
+		rate := state.rate(now, m.config.Window)
+		if m.overriddenLocked(subject, now) {
+			continue
+		}
+
+		guard := state.guard
+		if threshold := m.threshold(baselines[i]); rate > threshold {
+			if guard == nil {
+				guard = m.newGuard(subject, submission.Workflow.ID, baselines[i], threshold, now)
+				state.guard = guard
+				triggered = append(triggered, guard)
+			}
+			guard.LastExceededAt = now
+		}
+		if guard == nil {
+			continue
+		}
+		m.observe(guard, rate)
+		if rejection == nil {
+			rejection = m.actLocked(guard, submission, now)
+		}
+		decision.Guards = append(decision.Guards, guard.snapshot())
+	}
+	if rejection == nil {
+		hour := now.Truncate(time.Hour).Unix()
+		for _, subject := range subjects {
+			m.pending[countKey{subject: subject, hour: hour}]++
+		}
+	}
+	for i, guard := range triggered {
+		triggered[i] = guard.snapshot()
+	}
+	m.mu.Unlock()
+
+	for _, guard := range triggered {
+		m.triggered(ctx, guard)
+	}
+	return decision, rejection
+}
+
+// baseline returns the baseline rate of a subject, its submissions per
+// hour averaged over the hourly stats of the baseline window
+func (m *Manager) baseline(ctx context.Context, subject string, now time.Time) (float64, error) {
+	hour := now.Truncate(time.Hour)
+	m.mu.Lock()
+	cached, ok := m.baselines[subject]
+	m.mu.Unlock()
+	if ok && cached.hour.Equal(hour) {
+		return cached.rate, nil
+	}
+
+	count, err := m.store.CountSubmissions(ctx, subject, hour.Add(-m.config.BaselineWindow), hour)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the submission stats of %s: %w", subject, err)
+	}
+	rate := float64(count) / m.config.BaselineWindow.Hours()
+
+	m.mu.Lock()
+	m.baselines[subject] = baseline{hour: hour, rate: rate}
+	m.mu.Unlock()
+	return rate, nil
+}
+
+// threshold returns the rate triggering the guard of a subject with a
+// baseline
+func (m *Manager) threshold(baseline float64) float64 {
+	return math.Max(baseline*m.config.Multiplier, m.config.MinRate)
+}
+
+func (m *Manager) stateLocked(subject string) *subjectState {
+	state, ok := m.subjects[subject]
+	if !ok {
+		state = &subjectState{minutes: make(map[int64]int64)}
+		m.subjects[subject] = state
+	}
+	return state
+}
+
+func (m *Manager) overriddenLocked(subject string, now time.Time) bool {
+	override, ok := m.overrides[subject]
+	return ok && now.Before(override.Until)
+}
+
+// newGuard creates the guard of a subject whose rate spiked. Throttled
+// subjects are throttled to their baseline, and no lower than the rate a
+// subject without history may spike from.
+func (m *Manager) newGuard(subject string, workflowID uuid.UUID, baseline, threshold float64, now time.Time) *Guard {
+	guard := &Guard{
+		Subject:     subject,
+		Action:      m.config.Action,
+		TriggerID:   uuid.New(),
+		WorkflowID:  workflowID,
+		TriggeredAt: now,
+		Baseline:    baseline,
+		Threshold:   threshold,
+		refilled:    now,
+	}
+	switch guard.Action {
+	case ActionConfirm:
+		guard.challenge = newChallenge()
+	case ActionThrottle:
+		guard.ThrottleRate = math.Max(baseline, m.config.MinRate/m.config.Multiplier)
+	}
+	return guard
+}
+
+// observe records the current rate of the subject of a guard
+func (m *Manager) observe(guard *Guard, rate float64) {
+	guard.Rate = rate
+	guard.PeakRate = math.Max(guard.PeakRate, rate)
+	guard.ResetsAt = guard.LastExceededAt.Add(m.config.CoolDown)
+}
+
+// actLocked applies the action of a guard to a submission
+func (m *Manager) actLocked(guard *Guard, submission *Submission, now time.Time) error {
+	switch guard.Action {
+	case ActionConfirm:
+		if subtle.ConstantTimeCompare([]byte(submission.Confirmation), []byte(guard.challenge)) != 1 {
+			guard.Rejected++
+			return &ConfirmationError{Guard: guard.snapshot(), Challenge: guard.challenge}
+		}
+	case ActionThrottle:
+		// The bucket starts empty and holds up to a minute of submissions
+		perSecond := guard.ThrottleRate / time.Hour.Seconds()
+		capacity := math.Max(1, guard.ThrottleRate/60)
+		guard.tokens = math.Min(capacity, guard.tokens+now.Sub(guard.refilled).Seconds()*perSecond)
+		guard.refilled = now
+		if guard.tokens < 1 {
+			guard.Rejected++
+			return &ThrottledError{
+				Guard:      guard.snapshot(),
+				RetryAfter: time.Duration((1 - guard.tokens) / perSecond * float64(time.Second)),
+			}
+		}
+		guard.tokens--
+	}
+	return nil
+}
+
+// triggered records and notifies a guard that triggered
+func (m *Manager) triggered(ctx context.Context, guard *Guard) {
+	m.logger.WithFields(logrus.Fields{
+		"subject":   guard.Subject,
+		"action":    guard.Action,
+		"rate":      guard.Rate,
+		"baseline":  guard.Baseline,
+		"threshold": guard.Threshold,
+	}).Warn("Submission spike guard triggered")
+
+	if err := m.store.RecordTrigger(ctx, &Trigger{
+		ID:          guard.TriggerID,
+		Subject:     guard.Subject,
+		WorkflowID:  guard.WorkflowID,
+		Action:      guard.Action,
+		Baseline:    guard.Baseline,
+		Threshold:   guard.Threshold,
+		Rate:        guard.Rate,
+		TriggeredAt: guard.TriggeredAt,
+	}); err != nil {
+		m.logger.WithError(err).Error("Failed to record spike guard trigger")
+	}
+	if m.notifier != nil {
+		m.notifier.NotifySpike(ctx, guard, StatusTriggered)
+	}
+}
+
+// reset records and notifies a guard that reset
+func (m *Manager) reset(ctx context.Context, guard *Guard, at time.Time, reason, actor string) {
+	m.logger.WithFields(logrus.Fields{
+		"subject":  guard.Subject,
+		"reason":   reason,
+		"rejected": guard.Rejected,
+	}).Info("Submission spike guard reset")
+
+	if err := m.store.ResetTrigger(ctx, guard.TriggerID, at, reason, actor); err != nil {
+		m.logger.WithError(err).Error("Failed to record spike guard reset")
+	}
+	if m.notifier != nil {
+		m.notifier.NotifySpike(ctx, guard, StatusReset)
+	}
+}
+
+// Guards returns the triggered guards, ordered by subject
+func (m *Manager) Guards() []*Guard {
+	now := m.now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var guards []*Guard
+	for _, state := range m.subjects {
+		if state.guard == nil {
+			continue
+		}
+		m.observe(state.guard, state.rate(now, m.config.Window))
+		guards = append(guards, state.guard.snapshot())
+	}
+	sort.Slice(guards, func(i, j int) bool { return guards[i].Subject < guards[j].Subject })
+	return guards
+}
+
+// Triggers returns the recent triggers of a subject, of every subject when
+// it is empty, the most recent first
+func (m *Manager) Triggers(ctx context.Context, subject string, limit int) ([]*Trigger, error) {
+	return m.store.ListTriggers(ctx, subject, limit)
+}
+
+// Reset resets the guard of a subject before its cool-down ends
+func (m *Manager) Reset(ctx context.Context, subject, actor string) (*Guard, error) {
+	now := m.now().UTC()
+	guard := m.removeGuard(subject)
+	if guard == nil {
+		return nil, fmt.Errorf("%w: %s", ErrGuardNotFound, subject)
+	}
+	m.reset(ctx, guard, now, ResetManual, actor)
+	return guard, nil
+}
+
+// removeGuard removes the guard of a subject and returns it, nil when the
+// subject has none
+func (m *Manager) removeGuard(subject string) *Guard {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.subjects[subject]
+	if !ok || state.guard == nil {
+		return nil
+	}
+	guard := state.guard.snapshot()
+	state.guard = nil
+	return guard
+}
+
+// Override exempts a subject from guards until a time, for planned bursts,
+// resetting its guard
+func (m *Manager) Override(ctx context.Context, subject string, until time.Time, reason, actor string) (*Override, error) {
+	if err := ValidateSubject(subject); err != nil {
+		return nil, err
+	}
+	now := m.now().UTC()
+	if !until.After(now) {
+		return nil, fmt.Errorf("%w: until %s is not in the future", ErrInvalidOverride, until.Format(time.RFC3339))
+	}
+
+	override := &Override{
+		Subject:   subject,
+		Until:     until.UTC(),
+		Reason:    reason,
+		CreatedBy: actor,
+		CreatedAt: now,
+	}
+	if err := m.store.SaveOverride(ctx, override); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.overrides[subject] = override
+	m.mu.Unlock()
+
+	if guard := m.removeGuard(subject); guard != nil {
+		m.reset(ctx, guard, now, ResetOverride, actor)
+	}
+	return override, nil
+}
+
+// RemoveOverride ends the override of a subject
+func (m *Manager) RemoveOverride(ctx context.Context, subject string) error {
+	if err := m.store.DeleteOverride(ctx, subject); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.overrides, subject)
+	m.mu.Unlock()
+	return nil
+}
+
+// Overrides returns the overrides in effect, ordered by subject
+func (m *Manager) Overrides() []*Override {
+	now := m.now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	overrides := make([]*Override, 0, len(m.overrides))
+	for _, override := range m.overrides {
+		if now.Before(override.Until) {
+			stored := *override
+			overrides = append(overrides, &stored)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Subject < overrides[j].Subject })
+	return overrides
+}
+
+// Sweep writes the admitted submissions to the hourly stats, resets the
+// guards whose rate stayed below their threshold for the cool-down and
+// removes the overrides that ended
+func (m *Manager) Sweep(ctx context.Context) error {
+	now := m.now().UTC()
+	hour := now.Truncate(time.Hour)
+
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[countKey]int64)
+	var reset []*Guard
+	for subject, state := range m.subjects {
+		rate := state.rate(now, m.config.Window)
+		if guard := state.guard; guard != nil {
+			if rate > guard.Threshold {
+				guard.LastExceededAt = now
+			}
+			m.observe(guard, rate)
+			if !now.Before(guard.ResetsAt) {
+				reset = append(reset, guard.snapshot())
+				state.guard = nil
+			}
+		}
+		if state.guard == nil && len(state.minutes) == 0 {
+			delete(m.subjects, subject)
+		}
+	}
+	for subject, cached := range m.baselines {
+		if !cached.hour.Equal(hour) {
+			delete(m.baselines, subject)
+		}
+	}
+	var ended []string
+	for subject, override := range m.overrides {
+		if !now.Before(override.Until) {
+			ended = append(ended, subject)
+			delete(m.overrides, subject)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, guard := range reset {
+		m.reset(ctx, guard, now, ResetCoolDown, "")
+	}
+
+	var errs []error
+	for _, subject := range ended {
+		if err := m.store.DeleteOverride(ctx, subject); err != nil && !errors.Is(err, ErrOverrideNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	for key, count := range pending {
+		if err := m.store.AddSubmissions(ctx, key.subject, time.Unix(key.hour, 0).UTC(), count); err != nil {
+			errs = append(errs, err)
+			// Keep the submissions for the next sweep
+			m.mu.Lock()
+			m.pending[key] += count
+			m.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start sweeps every sweep interval until Stop is called
+func (m *Manager) Start(ctx context.Context) {
+	m.stopCh = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.config.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Sweep(ctx); err != nil {
+					m.logger.WithError(err).Error("Failed to sweep spike guards")
+				}
+			case <-m.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops sweeping, writing the submissions counted since the last
+// sweep to the hourly stats
+func (m *Manager) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.stopCh = nil
+	if err := m.Sweep(context.Background()); err != nil {
+		m.logger.WithError(err).Error("Failed to sweep spike guards")
+	}
+}
+
+// snapshot returns a copy of the guard, safe to read outside the lock of
+// the manager
+func (g *Guard) snapshot() *Guard {
+	snapshot := *g
+	return &snapshot
+}
+
+func newChallenge() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return uuid.NewString()
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,55 @@
+package spikes
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// EventType is the type of the events notifying spike guards
+const EventType = "submission.spike"
+
+// Notification statuses
+const (
+	StatusTriggered = "triggered"
+	StatusReset     = "reset"
+)
+
+// Notifier notifies the guards that trigger and reset
+type Notifier interface {
+	NotifySpike(ctx context.Context, guard *Guard, status string)
+}
+
+// EventPublisher publishes events to the engine event handlers, which
+// deliver them to the webhooks and notifications subscribed to their type.
+// The engine implements it.
+type EventPublisher interface {
+	PublishEvent(eventType string, workflowID uuid.UUID, data map[string]interface{})
+}
+
+// EventNotifier notifies spike guards as submission.spike events of the
+// workflow whose submission triggered them
+type EventNotifier struct {
+	publisher EventPublisher
+}
+
+// NewEventNotifier creates a notifier publishing spike guards as events
+func NewEventNotifier(publisher EventPublisher) *EventNotifier {
+	return &EventNotifier{publisher: publisher}
+}
+
+// NotifySpike publishes a spike guard event
+func (n *EventNotifier) NotifySpike(ctx context.Context, guard *Guard, status string) {
+	n.publisher.PublishEvent(EventType, guard.WorkflowID, map[string]interface{}{
+		"status":       status,
+		"subject":      guard.Subject,
+		"action":       guard.Action,
+		"trigger_id":   guard.TriggerID,
+		"triggered_at": guard.TriggeredAt,
+		"baseline":     guard.Baseline,
+		"threshold":    guard.Threshold,
+		"rate":         guard.Rate,
+		"peak_rate":    guard.PeakRate,
+		"rejected":     guard.Rejected,
+	})
+}
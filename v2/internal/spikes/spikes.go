@@ -0,0 +1,269 @@
+// Package spikes guards against submission spikes, such as a buggy
+// upstream submitting the same workflow thousands of times an hour. The
+// submissions of each workflow and API key are counted into hourly stats,
+// their baseline rate. A guard triggers when the current rate of a workflow
+// or API key exceeds a multiple of its baseline, and acts on its further
+// submissions until the rate stays normal for a cool-down period.
+package spikes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/deprecation"
+	"magic-flow/v2/pkg/models"
+)
+
+// Action is what a guard does with the submissions of its subject
+type Action string
+
+const (
+	// ActionNotify annotates the submissions and notifies the spike
+	ActionNotify Action = "notify"
+	// ActionConfirm rejects the submissions that do not echo the challenge
+	// of the guard
+	ActionConfirm Action = "confirm"
+	// ActionThrottle limits the submissions to the baseline rate
+	ActionThrottle Action = "throttle"
+)
+
+// Valid reports whether the action is known
+func (a Action) Valid() bool {
+	switch a {
+	case ActionNotify, ActionConfirm, ActionThrottle:
+		return true
+	}
+	return false
+}
+
+const (
+	// ChallengeHeader carries the challenge of submissions rejected until
+	// they are confirmed
+	ChallengeHeader = "X-Magic-Flow-Challenge"
+	// ConfirmHeader echoes the challenge back, confirming a submission
+	ConfirmHeader = "X-Magic-Flow-Confirm"
+)
+
+// Subject prefixes, the kinds of submitters guards track
+const (
+	subjectWorkflow = "workflow:"
+	subjectAPIKey   = "api_key:"
+)
+
+var (
+	// ErrSpike is wrapped by the errors of submissions rejected by a guard
+	ErrSpike = errors.New("submission spike")
+	// ErrGuardNotFound is returned for subjects without an active guard
+	ErrGuardNotFound = errors.New("spike guard not found")
+	// ErrOverrideNotFound is returned for subjects without an override
+	ErrOverrideNotFound = errors.New("spike guard override not found")
+	// ErrInvalidSubject is returned for subjects that name neither a
+	// workflow nor an API key
+	ErrInvalidSubject = errors.New("invalid subject")
+)
+
+// WorkflowSubject returns the subject of the submissions of a workflow
+func WorkflowSubject(id uuid.UUID) string {
+	return subjectWorkflow + id.String()
+}
+
+// APIKeySubject returns the subject of the submissions made with an API
+// key. Keys are identified by their caller ID, so they are not stored.
+func APIKeySubject(key string) string {
+	return subjectAPIKey + deprecation.CallerFromAPIKey(key)
+}
+
+// ValidateSubject checks that a subject names a workflow or an API key
+func ValidateSubject(subject string) error {
+	if id, ok := strings.CutPrefix(subject, subjectWorkflow); ok {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidSubject, subject)
+		}
+		return nil
+	}
+	if caller, ok := strings.CutPrefix(subject, subjectAPIKey); ok && caller != "" {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidSubject, subject)
+}
+
+// Config configures the spike guards
+type Config struct {
+	// Action is what guards do with the submissions of their subject
+	Action Action
+	// Multiplier triggers a guard when the current rate exceeds that many
+	// times the baseline rate
+	Multiplier float64
+	// MinRate is the lowest rate, in submissions per hour, triggering a
+	// guard, so quiet workflows do not trigger on a few submissions
+	MinRate float64
+	// Window is the period the current rate is measured over
+	Window time.Duration
+	// BaselineWindow is the period of the hourly stats the baseline rate
+	// is averaged over
+	BaselineWindow time.Duration
+	// CoolDown is how long the rate must stay normal before a guard resets
+	CoolDown time.Duration
+	// SweepInterval is how often the hourly stats are written and guards
+	// whose cool-down ended are reset
+	SweepInterval time.Duration
+}
+
+// DefaultConfig returns the default guard configuration
+func DefaultConfig() Config {
+	return Config{
+		Action:         ActionNotify,
+		Multiplier:     10,
+		MinRate:        1000,
+		Window:         10 * time.Minute,
+		BaselineWindow: 7 * 24 * time.Hour,
+		CoolDown:       30 * time.Minute,
+		SweepInterval:  time.Minute,
+	}
+}
+
+// Submission is an execution about to be submitted
+type Submission struct {
+	Workflow *models.Workflow
+	// APIKey is the API key of the caller, if any
+	APIKey string
+	// Confirmation is the challenge echoed by the caller
+	Confirmation string
+}
+
+// subjects returns the subjects the submission counts against
+func (s *Submission) subjects() []string {
+	subjects := []string{WorkflowSubject(s.Workflow.ID)}
+	if s.APIKey != "" {
+		subjects = append(subjects, APIKeySubject(s.APIKey))
+	}
+	return subjects
+}
+
+// Guard is a triggered spike guard acting on the submissions of its
+// subject
+type Guard struct {
+	Subject   string    `json:"subject"`
+	Action    Action    `json:"action"`
+	TriggerID uuid.UUID `json:"trigger_id"`
+	// WorkflowID is the workflow of the submission that triggered the guard
+	WorkflowID  uuid.UUID `json:"workflow_id"`
+	TriggeredAt time.Time `json:"triggered_at"`
+	// Baseline and Threshold are the rates, in submissions per hour, the
+	// guard triggered against
+	Baseline  float64 `json:"baseline"`
+	Threshold float64 `json:"threshold"`
+	// ThrottleRate is the rate submissions are throttled to
+	ThrottleRate float64 `json:"throttle_rate,omitempty"`
+	// Rate is the current rate and PeakRate the highest since the guard
+	// triggered
+	Rate     float64 `json:"rate"`
+	PeakRate float64 `json:"peak_rate"`
+	// LastExceededAt is when the rate was last above the threshold. The
+	// guard resets once it stayed below for the cool-down.
+	LastExceededAt time.Time `json:"last_exceeded_at"`
+	ResetsAt       time.Time `json:"resets_at"`
+	// Rejected counts the submissions the guard rejected
+	Rejected int64 `json:"rejected"`
+
+	challenge string
+	// tokens and refilled are the throttle bucket of the guard
+	tokens   float64
+	refilled time.Time
+}
+
+// Reset reasons of triggers
+const (
+	ResetCoolDown = "cool_down"
+	ResetManual   = "manual"
+	ResetOverride = "override"
+)
+
+// Trigger records a guard that triggered
+type Trigger struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Subject     string    `json:"subject" gorm:"not null;index"`
+	WorkflowID  uuid.UUID `json:"workflow_id" gorm:"type:uuid"`
+	Action      Action    `json:"action"`
+	Baseline    float64   `json:"baseline"`
+	Threshold   float64   `json:"threshold"`
+	Rate        float64   `json:"rate"`
+	TriggeredAt time.Time `json:"triggered_at" gorm:"index"`
+	// ResetAt and ResetReason are set once the guard resets
+	ResetAt     *time.Time `json:"reset_at,omitempty"`
+	ResetReason string     `json:"reset_reason,omitempty"`
+	ResetBy     string     `json:"reset_by,omitempty"`
+}
+
+// TableName returns the table name for the Trigger model
+func (Trigger) TableName() string {
+	return "spike_guard_triggers"
+}
+
+// Override exempts a subject from guards until a time, for planned bursts
+type Override struct {
+	Subject   string    `json:"subject" gorm:"primaryKey"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the Override model
+func (Override) TableName() string {
+	return "spike_guard_overrides"
+}
+
+// SubmissionCount is the number of submissions of a subject admitted in an
+// hour, the stats baselines are averaged from
+type SubmissionCount struct {
+	Subject string    `json:"subject" gorm:"primaryKey"`
+	Hour    time.Time `json:"hour" gorm:"primaryKey"`
+	Count   int64     `json:"count"`
+}
+
+// TableName returns the table name for the SubmissionCount model
+func (SubmissionCount) TableName() string {
+	return "submission_counts"
+}
+
+// ConfirmationError is returned for submissions of a subject whose guard
+// requires confirmation and that did not echo its challenge
+type ConfirmationError struct {
+	Guard     *Guard
+	Challenge string
+}
+
+// Error returns the error message
+func (e *ConfirmationError) Error() string {
+	return fmt.Sprintf("submissions of %s spiked to %.0f per hour against a baseline of %.0f: echo the challenge in the %s header to confirm",
+		e.Guard.Subject, e.Guard.PeakRate, e.Guard.Baseline, ConfirmHeader)
+}
+
+// Unwrap returns ErrSpike
+func (e *ConfirmationError) Unwrap() error {
+	return ErrSpike
+}
+
+// ThrottledError is returned for submissions of a subject throttled to its
+// baseline rate
+type ThrottledError struct {
+	Guard *Guard
+	// RetryAfter is when the next submission is allowed
+	RetryAfter time.Duration
+}
+
+// Error returns the error message
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("submissions of %s spiked to %.0f per hour and are throttled to %.0f per hour, retry after %s",
+		e.Guard.Subject, e.Guard.PeakRate, e.Guard.ThrottleRate, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap returns ErrSpike
+func (e *ThrottledError) Unwrap() error {
+	return ErrSpike
+}
@@ -0,0 +1,384 @@
+package spikes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/admission"
+	"magic-flow/v2/pkg/models"
+)
+
+var nineAM = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+type recordingNotifier struct {
+	mu       sync.Mutex
+	statuses []string
+	subjects []string
+}
+
+func (n *recordingNotifier) NotifySpike(ctx context.Context, guard *Guard, status string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.statuses = append(n.statuses, status)
+	n.subjects = append(n.subjects, guard.Subject)
+}
+
+// campaignReservations pre-authorizes the bursts of one workflow
+type campaignReservations struct {
+	workflowID uuid.UUID
+}
+
+func (r campaignReservations) Match(ctx context.Context, workflow *models.Workflow, token string, at time.Time) (*admission.Reservation, error) {
+	if workflow.ID == r.workflowID {
+		return &admission.Reservation{ID: uuid.New(), Name: "spring-campaign"}, nil
+	}
+	return nil, nil
+}
+
+var orders = &models.Workflow{ID: uuid.MustParse("0b8f3c1e-5d2a-4c6f-8e1b-7a9d2f4c6e01"), Name: "orders"}
+
+// newTestManager creates a manager on a clock whose orders workflow was
+// submitted 60 times an hour over the baseline window, so it triggers above
+// 600 an hour, 100 submissions in the 10 minute window
+func newTestManager(t *testing.T, action Action, clock *time.Time) (*Manager, *MemoryStore, *recordingNotifier) {
+	t.Helper()
+	store := NewMemoryStore()
+	notifier := &recordingNotifier{}
+	config := DefaultConfig()
+	config.Action = action
+	config.MinRate = 100
+	manager := NewManager(config, store, logrus.New())
+	manager.now = func() time.Time { return *clock }
+	manager.SetNotifier(notifier)
+
+	ctx := context.Background()
+	for hour := 1; hour <= 7*24; hour++ {
+		require.NoError(t, store.AddSubmissions(ctx, WorkflowSubject(orders.ID), nineAM.Add(-time.Duration(hour)*time.Hour), 60))
+	}
+	return manager, store, notifier
+}
+
+// submit submits the orders workflow n times, one second apart
+func submit(manager *Manager, clock *time.Time, n int) (*Decision, error) {
+	var decision *Decision
+	var err error
+	for i := 0; i < n; i++ {
+		*clock = clock.Add(time.Second)
+		decision, err = manager.Check(context.Background(), &Submission{Workflow: orders})
+	}
+	return decision, err
+}
+
+func TestNotifyAction(t *testing.T) {
+	ctx := context.Background()
+	clock := nineAM
+	manager, store, notifier := newTestManager(t, ActionNotify, &clock)
+
+	decision, err := submit(manager, &clock, 100)
+	require.NoError(t, err)
+	assert.Empty(t, decision.Guards, "100 submissions in 10 minutes is 10 times the baseline")
+	assert.Empty(t, manager.Guards())
+
+	decision, err = submit(manager, &clock, 1)
+	require.NoError(t, err, "notified spikes are admitted")
+	require.Len(t, decision.Guards, 1)
+	guard := decision.Guards[0]
+	assert.Equal(t, WorkflowSubject(orders.ID), guard.Subject)
+	assert.Equal(t, ActionNotify, guard.Action)
+	assert.InDelta(t, 60, guard.Baseline, 0.001)
+	assert.InDelta(t, 600, guard.Threshold, 0.001)
+	assert.InDelta(t, 606, guard.Rate, 0.001)
+	assert.Equal(t, []string{WorkflowSubject(orders.ID)}, decision.Subjects())
+	assert.Equal(t, []string{StatusTriggered}, notifier.statuses)
+
+	// Further submissions are annotated without notifying again
+	decision, err = submit(manager, &clock, 5)
+	require.NoError(t, err)
+	require.Len(t, decision.Guards, 1)
+	assert.Equal(t, guard.TriggerID, decision.Guards[0].TriggerID)
+	assert.Len(t, notifier.statuses, 1)
+
+	triggers, err := manager.Triggers(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, triggers, 1)
+	assert.Equal(t, guard.TriggerID, triggers[0].ID)
+	assert.Nil(t, triggers[0].ResetAt)
+
+	// Admitted submissions are written to the hourly stats the baseline
+	// is averaged from
+	require.NoError(t, manager.Sweep(ctx))
+	count, err := store.CountSubmissions(ctx, WorkflowSubject(orders.ID), nineAM, nineAM.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(106), count)
+}
+
+func TestMinimumRate(t *testing.T) {
+	clock := nineAM
+	manager, _, _ := newTestManager(t, ActionConfirm, &clock)
+	quiet := &models.Workflow{ID: uuid.New(), Name: "quiet"}
+
+	// Without history any submission is above the baseline, but the rate
+	// must reach the minimum of 100 an hour
+	for i := 0; i < 16; i++ {
+		clock = clock.Add(time.Second)
+		_, err := manager.Check(context.Background(), &Submission{Workflow: quiet})
+		require.NoError(t, err)
+	}
+	_, err := manager.Check(context.Background(), &Submission{Workflow: quiet})
+	assert.ErrorIs(t, err, ErrSpike)
+}
+
+func TestConfirmAction(t *testing.T) {
+	clock := nineAM
+	manager, _, _ := newTestManager(t, ActionConfirm, &clock)
+
+	_, err := submit(manager, &clock, 100)
+	require.NoError(t, err)
+
+	_, err = submit(manager, &clock, 1)
+	var confirmation *ConfirmationError
+	require.ErrorAs(t, err, &confirmation)
+	assert.ErrorIs(t, err, ErrSpike)
+	require.NotEmpty(t, confirmation.Challenge)
+
+	_, err = manager.Check(context.Background(), &Submission{Workflow: orders, Confirmation: "guess"})
+	assert.ErrorAs(t, err, &confirmation)
+
+	decision, err := manager.Check(context.Background(), &Submission{Workflow: orders, Confirmation: confirmation.Challenge})
+	require.NoError(t, err, "submissions echoing the challenge are admitted")
+	require.Len(t, decision.Guards, 1)
+	assert.Equal(t, int64(2), decision.Guards[0].Rejected)
+}
+
+func TestThrottleAction(t *testing.T) {
+	clock := nineAM
+	manager, _, _ := newTestManager(t, ActionThrottle, &clock)
+
+	_, err := submit(manager, &clock, 100)
+	require.NoError(t, err)
+
+	_, err = submit(manager, &clock, 1)
+	var throttled *ThrottledError
+	require.ErrorAs(t, err, &throttled)
+	assert.InDelta(t, 60, throttled.Guard.ThrottleRate, 0.001, "throttled to the baseline")
+	assert.InDelta(t, 60, throttled.RetryAfter.Seconds(), 0.001)
+
+	// The baseline of 60 an hour admits one submission a minute
+	clock = clock.Add(time.Minute + time.Second)
+	_, err = manager.Check(context.Background(), &Submission{Workflow: orders})
+	require.NoError(t, err)
+	_, err = manager.Check(context.Background(), &Submission{Workflow: orders})
+	require.ErrorAs(t, err, &throttled)
+	assert.InDelta(t, 60, throttled.RetryAfter.Seconds(), 0.001)
+	assert.Equal(t, int64(2), throttled.Guard.Rejected)
+}
+
+func TestAPIKeyGuard(t *testing.T) {
+	clock := nineAM
+	manager, _, _ := newTestManager(t, ActionConfirm, &clock)
+	ctx := context.Background()
+
+	// The key submits executions of as many workflows, none of which
+	// spikes, but the key has no baseline
+	var err error
+	for i := 0; i < 120 && err == nil; i++ {
+		clock = clock.Add(time.Second)
+		_, err = manager.Check(ctx, &Submission{Workflow: &models.Workflow{ID: uuid.New()}, APIKey: "batch-key"})
+	}
+	var confirmation *ConfirmationError
+	require.ErrorAs(t, err, &confirmation)
+	assert.Equal(t, APIKeySubject("batch-key"), confirmation.Guard.Subject)
+	assert.NotContains(t, confirmation.Guard.Subject, "batch-key", "keys are not exposed")
+
+	// Other keys are not guarded
+	_, err = manager.Check(ctx, &Submission{Workflow: &models.Workflow{ID: uuid.New()}, APIKey: "other-key"})
+	assert.NoError(t, err)
+}
+
+func TestCoolDownReset(t *testing.T) {
+	ctx := context.Background()
+	clock := nineAM
+	manager, _, notifier := newTestManager(t, ActionConfirm, &clock)
+
+	_, err := submit(manager, &clock, 101)
+	require.ErrorIs(t, err, ErrSpike)
+	triggeredAt := clock
+
+	// The spike continues, delaying the reset
+	clock = triggeredAt.Add(5 * time.Minute)
+	require.NoError(t, manager.Sweep(ctx))
+	guards := manager.Guards()
+	require.Len(t, guards, 1)
+	assert.Equal(t, clock.Add(30*time.Minute), guards[0].ResetsAt)
+
+	// The rate falls below the threshold once the spike leaves the window,
+	// and the guard resets after 30 minutes below it
+	lastExceeded := clock
+	clock = lastExceeded.Add(15 * time.Minute)
+	require.NoError(t, manager.Sweep(ctx))
+	require.Len(t, manager.Guards(), 1, "the cool-down is not over")
+	assert.Zero(t, manager.Guards()[0].Rate)
+
+	clock = lastExceeded.Add(30 * time.Minute)
+	require.NoError(t, manager.Sweep(ctx))
+	assert.Empty(t, manager.Guards())
+	assert.Equal(t, []string{StatusTriggered, StatusReset}, notifier.statuses)
+
+	triggers, err := manager.Triggers(ctx, WorkflowSubject(orders.ID), 10)
+	require.NoError(t, err)
+	require.Len(t, triggers, 1)
+	require.NotNil(t, triggers[0].ResetAt)
+	assert.Equal(t, ResetCoolDown, triggers[0].ResetReason)
+
+	// Submissions are admitted again without confirmation
+	_, err = submit(manager, &clock, 1)
+	assert.NoError(t, err)
+}
+
+func TestOverridesAndReservations(t *testing.T) {
+	ctx := context.Background()
+	clock := nineAM
+	manager, store, _ := newTestManager(t, ActionConfirm, &clock)
+
+	_, err := submit(manager, &clock, 101)
+	require.ErrorIs(t, err, ErrSpike)
+
+	// An override of a planned burst resets the guard and exempts the
+	// workflow until it ends
+	_, err = manager.Override(ctx, WorkflowSubject(orders.ID), clock.Add(-time.Minute), "launch", "alice")
+	assert.ErrorIs(t, err, ErrInvalidOverride)
+	_, err = manager.Override(ctx, WorkflowSubject(orders.ID), clock.Add(time.Hour), "launch", "alice")
+	require.NoError(t, err)
+	assert.Empty(t, manager.Guards())
+	assert.Len(t, manager.Overrides(), 1)
+
+	decision, err := submit(manager, &clock, 200)
+	require.NoError(t, err)
+	assert.Empty(t, decision.Guards)
+
+	triggers, err := manager.Triggers(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, triggers, 1)
+	assert.Equal(t, ResetOverride, triggers[0].ResetReason)
+	assert.Equal(t, "alice", triggers[0].ResetBy)
+
+	// Overrides survive a restart and end on their own
+	restarted := NewManager(manager.config, store, logrus.New())
+	restarted.now = manager.now
+	require.NoError(t, restarted.Refresh(ctx))
+	assert.Len(t, restarted.Overrides(), 1)
+	clock = clock.Add(time.Hour)
+	require.NoError(t, restarted.Sweep(ctx))
+	assert.Empty(t, restarted.Overrides())
+
+	// Capacity reservations pre-authorize the bursts of their workflow
+	reservedClock := nineAM
+	reserved, _, _ := newTestManager(t, ActionConfirm, &reservedClock)
+	reserved.SetReservations(campaignReservations{workflowID: orders.ID})
+	decision, err = submit(reserved, &reservedClock, 200)
+	require.NoError(t, err)
+	assert.Equal(t, "spring-campaign", decision.Reservation)
+	assert.Empty(t, reserved.Guards())
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := nineAM
+	manager, _, _ := newTestManager(t, ActionNotify, &clock)
+	router := gin.New()
+	NewHandlers(manager).RegisterRoutes(router.Group("/api"))
+
+	_, err := submit(manager, &clock, 101)
+	require.NoError(t, err)
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var reader *bytes.Reader
+		if body != nil {
+			data, err := json.Marshal(body)
+			require.NoError(t, err)
+			reader = bytes.NewReader(data)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "alice")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/api/v1/spikes/guards", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		Guards []*Guard `json:"guards"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Guards, 1)
+
+	subject := WorkflowSubject(orders.ID)
+	w = do(http.MethodPost, "/api/v1/spikes/guards/"+subject+"/reset", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodPost, "/api/v1/spikes/guards/"+subject+"/reset", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(http.MethodGet, "/api/v1/spikes/triggers?subject="+subject, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var history struct {
+		Triggers []*Trigger `json:"triggers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history.Triggers, 1)
+	assert.Equal(t, ResetManual, history.Triggers[0].ResetReason)
+
+	w = do(http.MethodPost, "/api/v1/spikes/overrides", gin.H{"until": clock.Add(time.Hour), "reason": "launch"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "overrides name a workflow or an API key")
+	w = do(http.MethodPost, "/api/v1/spikes/overrides", gin.H{"api_key": "batch-key", "until": clock.Add(time.Hour), "reason": "launch"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var override Override
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &override))
+	assert.Equal(t, APIKeySubject("batch-key"), override.Subject)
+
+	w = do(http.MethodDelete, "/api/v1/spikes/overrides/"+override.Subject, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do(http.MethodDelete, "/api/v1/spikes/overrides/"+override.Subject, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestValidateSubject(t *testing.T) {
+	tests := map[string]struct {
+		subject string
+		valid   bool
+	}{
+		"workflow":      {subject: WorkflowSubject(uuid.New()), valid: true},
+		"API key":       {subject: APIKeySubject("key"), valid: true},
+		"empty":         {subject: ""},
+		"workflow name": {subject: "workflow:orders"},
+		"empty API key": {subject: "api_key:"},
+		"unknown kind":  {subject: "tenant:acme"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateSubject(tt.subject)
+			if tt.valid {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, ErrInvalidSubject))
+		})
+	}
+}
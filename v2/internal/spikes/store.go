@@ -0,0 +1,253 @@
+package spikes
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists the hourly submission stats, the history of the guards
+// that triggered and the overrides of planned bursts
+type Store interface {
+	// AddSubmissions adds to the submissions of a subject admitted in an
+	// hour
+	AddSubmissions(ctx context.Context, subject string, hour time.Time, count int64) error
+	// CountSubmissions returns the submissions of a subject admitted in the
+	// hours from from, to to excluded
+	CountSubmissions(ctx context.Context, subject string, from, to time.Time) (int64, error)
+
+	RecordTrigger(ctx context.Context, trigger *Trigger) error
+	// ResetTrigger records the reset of the guard of a trigger
+	ResetTrigger(ctx context.Context, id uuid.UUID, at time.Time, reason, actor string) error
+	// ListTriggers returns the triggers of a subject, of every subject when
+	// it is empty, the most recent first
+	ListTriggers(ctx context.Context, subject string, limit int) ([]*Trigger, error)
+
+	SaveOverride(ctx context.Context, override *Override) error
+	// DeleteOverride returns ErrOverrideNotFound for subjects without one
+	DeleteOverride(ctx context.Context, subject string) error
+	ListOverrides(ctx context.Context) ([]*Override, error)
+}
+
+type countKey struct {
+	subject string
+	hour    int64
+}
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu        sync.Mutex
+	counts    map[countKey]int64
+	triggers  []*Trigger
+	overrides map[string]*Override
+}
+
+// NewMemoryStore creates an in-memory spike guard store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counts:    make(map[countKey]int64),
+		overrides: make(map[string]*Override),
+	}
+}
+
+// AddSubmissions adds to the submissions of a subject in an hour
+func (s *MemoryStore) AddSubmissions(ctx context.Context, subject string, hour time.Time, count int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts[countKey{subject: subject, hour: hour.Unix()}] += count
+	return nil
+}
+
+// CountSubmissions returns the submissions of a subject in a period
+func (s *MemoryStore) CountSubmissions(ctx context.Context, subject string, from, to time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for key, count := range s.counts {
+		if key.subject == subject && key.hour >= from.Unix() && key.hour < to.Unix() {
+			total += count
+		}
+	}
+	return total, nil
+}
+
+// RecordTrigger stores a trigger
+func (s *MemoryStore) RecordTrigger(ctx context.Context, trigger *Trigger) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *trigger
+	s.triggers = append(s.triggers, &stored)
+	return nil
+}
+
+// ResetTrigger records the reset of a trigger
+func (s *MemoryStore) ResetTrigger(ctx context.Context, id uuid.UUID, at time.Time, reason, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, trigger := range s.triggers {
+		if trigger.ID == id {
+			trigger.ResetAt = &at
+			trigger.ResetReason = reason
+			trigger.ResetBy = actor
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// ListTriggers returns the triggers of a subject, the most recent first
+func (s *MemoryStore) ListTriggers(ctx context.Context, subject string, limit int) ([]*Trigger, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var triggers []*Trigger
+	for i := len(s.triggers) - 1; i >= 0 && (limit <= 0 || len(triggers) < limit); i-- {
+		if subject != "" && s.triggers[i].Subject != subject {
+			continue
+		}
+		stored := *s.triggers[i]
+		triggers = append(triggers, &stored)
+	}
+	return triggers, nil
+}
+
+// SaveOverride stores an override, replacing that of its subject
+func (s *MemoryStore) SaveOverride(ctx context.Context, override *Override) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *override
+	s.overrides[override.Subject] = &stored
+	return nil
+}
+
+// DeleteOverride removes the override of a subject
+func (s *MemoryStore) DeleteOverride(ctx context.Context, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.overrides[subject]; !ok {
+		return ErrOverrideNotFound
+	}
+	delete(s.overrides, subject)
+	return nil
+}
+
+// ListOverrides returns every override, ordered by subject
+func (s *MemoryStore) ListOverrides(ctx context.Context) ([]*Override, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	overrides := make([]*Override, 0, len(s.overrides))
+	for _, override := range s.overrides {
+		stored := *override
+		overrides = append(overrides, &stored)
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Subject < overrides[j].Subject })
+	return overrides, nil
+}
+
+// GormStore counts submissions per subject and hour in the submission_counts
+// table, adding to the count of the hour with an upsert, and keeps triggers
+// and overrides in the spike_guard_triggers and spike_guard_overrides tables
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database spike guard store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the submission stats, trigger and override tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&SubmissionCount{}, &Trigger{}, &Override{})
+}
+
+// AddSubmissions adds to the submissions of a subject in an hour
+func (s *GormStore) AddSubmissions(ctx context.Context, subject string, hour time.Time, count int64) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject"}, {Name: "hour"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "count"}, Value: gorm.Expr("submission_counts.count + ?", count)},
+		},
+	}).Create(&SubmissionCount{Subject: subject, Hour: hour.UTC(), Count: count}).Error
+}
+
+// CountSubmissions returns the submissions of a subject in a period
+func (s *GormStore) CountSubmissions(ctx context.Context, subject string, from, to time.Time) (int64, error) {
+	var total int64
+	err := s.db.WithContext(ctx).Model(&SubmissionCount{}).
+		Select("COALESCE(SUM(count), 0)").
+		Where("subject = ? AND hour >= ? AND hour < ?", subject, from.UTC(), to.UTC()).
+		Scan(&total).Error
+	return total, err
+}
+
+// RecordTrigger stores a trigger
+func (s *GormStore) RecordTrigger(ctx context.Context, trigger *Trigger) error {
+	return s.db.WithContext(ctx).Create(trigger).Error
+}
+
+// ResetTrigger records the reset of a trigger
+func (s *GormStore) ResetTrigger(ctx context.Context, id uuid.UUID, at time.Time, reason, actor string) error {
+	result := s.db.WithContext(ctx).Model(&Trigger{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"reset_at":     at,
+		"reset_reason": reason,
+		"reset_by":     actor,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListTriggers returns the triggers of a subject, the most recent first
+func (s *GormStore) ListTriggers(ctx context.Context, subject string, limit int) ([]*Trigger, error) {
+	query := s.db.WithContext(ctx).Order("triggered_at DESC")
+	if subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var triggers []*Trigger
+	err := query.Find(&triggers).Error
+	return triggers, err
+}
+
+// SaveOverride stores an override, replacing that of its subject
+func (s *GormStore) SaveOverride(ctx context.Context, override *Override) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(override).Error
+}
+
+// DeleteOverride removes the override of a subject
+func (s *GormStore) DeleteOverride(ctx context.Context, subject string) error {
+	result := s.db.WithContext(ctx).Delete(&Override{}, "subject = ?", subject)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOverrideNotFound
+	}
+	return nil
+}
+
+// ListOverrides returns every override, ordered by subject
+func (s *GormStore) ListOverrides(ctx context.Context) ([]*Override, error) {
+	var overrides []*Override
+	err := s.db.WithContext(ctx).Order("subject").Find(&overrides).Error
+	return overrides, err
+}
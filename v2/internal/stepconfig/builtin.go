@@ -0,0 +1,135 @@
+package stepconfig
+
+// HTTPConfig configures http steps
+type HTTPConfig struct {
+	URL     string                 `json:"url" schema:"required" description:"Request URL"`
+	Method  string                 `json:"method,omitempty" schema:"enum=GET|POST|PUT|PATCH|DELETE,default=GET" description:"HTTP method"`
+	Headers map[string]string      `json:"headers,omitempty" description:"Request headers"`
+	Params  map[string]interface{} `json:"params,omitempty" description:"Query parameters"`
+	Body    interface{}            `json:"body,omitempty" description:"Request body, defaults to the step input for POST, PUT and PATCH; an artifact reference or reference object, or a ${variable} of the step input holding one, streams the artifact as the body"`
+	// Multipart sends the body as a multipart/form-data form, streaming
+	// the artifacts of its file parts
+	Multipart map[string]interface{} `json:"multipart,omitempty" description:"Parts of a multipart/form-data body of POST, PUT and PATCH steps: artifact references and reference objects, or ${variable}s of the step input holding them, are sent as file parts with their content type, other values as form fields"`
+	// ResponseSchema is the contract of the response, checked before the
+	// response reaches the variables of the execution
+	ResponseSchema map[string]interface{} `json:"response_schema,omitempty" description:"JSON schema the response body must conform to: type, properties, required, items and additionalProperties; responses violating it fail the step"`
+	// ResponseArtifactBytes is the size above which the response body is
+	// streamed into an artifact rather than held in the step output
+	ResponseArtifactBytes int64 `json:"response_artifact_bytes,omitempty" description:"Size of the response body above which it is streamed into an artifact, referenced by body_artifact in the output; 0 keeps every body in the output"`
+	// ResponseScratch is the scratch file of the execution the response body
+	// is streamed into rather than held in the step output
+	ResponseScratch string `json:"response_scratch,omitempty" description:"Name of the file of the execution scratch area the response body is streamed into, named by body_scratch in the output"`
+}
+
+// ScriptConfig configures script steps
+type ScriptConfig struct {
+	Command          string                 `json:"command" schema:"required" description:"Command to run, or the script body for javascript"`
+	Language         string                 `json:"language,omitempty" schema:"enum=shell|javascript,default=shell" description:"Language of the command; javascript runs in the script sandbox"`
+	Shell            string                 `json:"shell,omitempty" schema:"default=bash" description:"Shell used to run the command"`
+	WorkingDirectory string                 `json:"working_directory,omitempty" description:"Working directory of the command"`
+	Environment      map[string]interface{} `json:"environment,omitempty" description:"Additional environment variables"`
+	Modules          map[string]string      `json:"modules,omitempty" description:"Exact versions of required modules, pinned when the workflow version is created"`
+}
+
+// ConditionConfig configures condition steps
+type ConditionConfig struct {
+	Condition map[string]interface{} `json:"condition" schema:"required" description:"Condition with operator, field, value and nested conditions, or the expression operator with an expression"`
+	OnTrue    string                 `json:"on_true,omitempty" description:"Step to run when the condition holds"`
+	OnFalse   string                 `json:"on_false,omitempty" description:"Step to run when the condition does not hold"`
+}
+
+// LoopConfig configures loop steps
+type LoopConfig struct {
+	Items         interface{} `json:"items" schema:"required" description:"Items to iterate, as an array or an input expression"`
+	ItemVariable  string      `json:"item_variable,omitempty" schema:"default=item" description:"Variable holding the current item"`
+	Steps         []string    `json:"steps,omitempty" description:"Steps run for each item"`
+	MaxIterations int         `json:"max_iterations,omitempty" description:"Upper bound on iterations, 0 for no limit"`
+}
+
+// TransformConfig configures transform steps
+type TransformConfig struct {
+	Type       string                   `json:"type" schema:"required,enum=json|filter|map|aggregate" description:"Transform to apply"`
+	Operations []map[string]interface{} `json:"operations,omitempty" description:"Operations of json and aggregate transforms"`
+	Conditions []map[string]interface{} `json:"conditions,omitempty" description:"Conditions of filter transforms"`
+	Mapping    map[string]string        `json:"mapping,omitempty" description:"Target to source field mapping of map transforms"`
+}
+
+// NotifyConfig configures notify steps
+type NotifyConfig struct {
+	Channel    string   `json:"channel" schema:"required,enum=email|slack|webhook" description:"Notification channel"`
+	Recipients []string `json:"recipients,omitempty" description:"Recipients of the notification"`
+	Subject    string   `json:"subject,omitempty" description:"Subject line"`
+	Message    string   `json:"message" schema:"required" description:"Notification body"`
+	Template   string   `json:"template,omitempty" description:"Template used instead of message"`
+}
+
+// LockConfig configures lock steps
+type LockConfig struct {
+	Names       []string `json:"names" schema:"required" description:"Locks to acquire, may reference variables as ${name}; acquired in sorted order"`
+	TTL         string   `json:"ttl,omitempty" schema:"default=30s" description:"Duration after which the locks expire unless released"`
+	WaitTimeout string   `json:"wait_timeout,omitempty" schema:"default=10s" description:"How long to wait for locks held by other executions"`
+}
+
+// UnlockConfig configures unlock steps
+type UnlockConfig struct {
+	Names []string `json:"names,omitempty" description:"Locks to release, all locks of the execution when empty"`
+}
+
+// ApprovalConfig configures approval steps
+type ApprovalConfig struct {
+	Approvers      []string `json:"approvers" schema:"required" description:"Eligible approvers as user:<name>, group:<name> or role:<name> references, resolved through the RBAC directory"`
+	Required       int      `json:"required,omitempty" schema:"default=1" description:"Number of approvals completing the step"`
+	DistinctGroups bool     `json:"distinct_groups,omitempty" description:"Whether each approval must be given for a different approver reference, such as two approvers from two groups"`
+	AllowSubmitter bool     `json:"allow_submitter,omitempty" description:"Whether the submitter of the execution may approve it; separation of duties forbids it by default"`
+	Timeout        string   `json:"timeout,omitempty" schema:"default=24h" description:"How long to wait for the approvals before the step fails"`
+	Reminders      []string `json:"reminders,omitempty" description:"Durations before the timeout at which approval.reminder events are sent"`
+	Message        string   `json:"message,omitempty" description:"What the approvers are asked to approve"`
+}
+
+// ParseTableConfig configures parse_table steps
+type ParseTableConfig struct {
+	Source         string            `json:"source" schema:"required" description:"Table to parse: an artifact reference, the table itself, or a ${variable} of the step input holding either"`
+	Format         string            `json:"format,omitempty" schema:"enum=csv|tsv|xlsx,default=csv" description:"Table format"`
+	Delimiter      string            `json:"delimiter,omitempty" description:"Field delimiter of csv tables, a comma by default"`
+	Quote          string            `json:"quote,omitempty" description:"Quote character of csv and tsv tables, a double quote by default; none disables quoting"`
+	Sheet          string            `json:"sheet,omitempty" description:"Name of the xlsx worksheet to read"`
+	SheetIndex     int               `json:"sheet_index,omitempty" description:"1-based position of the xlsx worksheet to read, the first by default"`
+	Header         *bool             `json:"header,omitempty" schema:"default=true" description:"Whether the first row names the columns"`
+	Columns        []string          `json:"columns,omitempty" description:"Column names, replacing the header row"`
+	Types          map[string]string `json:"types,omitempty" description:"Coercion rule of columns: string, int, float, bool, date or date:<layout>"`
+	MaxRows        int               `json:"max_rows,omitempty" description:"Data rows parsed at most, 0 for no limit"`
+	OnError        string            `json:"on_error,omitempty" schema:"enum=fail|skip,default=fail" description:"Whether malformed rows fail the step or are skipped and reported"`
+	MaxInlineBytes int               `json:"max_inline_bytes,omitempty" schema:"default=1048576" description:"Size of the rows, as JSON, above which they are stored as an artifact"`
+	MaxSourceBytes int64             `json:"max_source_bytes,omitempty" schema:"default=4294967296" description:"Size of an artifact source above which the step fails without parsing it"`
+}
+
+// Schemas of the built-in step types
+var (
+	HTTPSchema       = NewSchema("http", "Performs an HTTP request", HTTPConfig{})
+	ScriptSchema     = NewSchema("script", "Runs a shell command or a sandboxed JavaScript script", ScriptConfig{})
+	ConditionSchema  = NewSchema("condition", "Evaluates a condition against the step input", ConditionConfig{})
+	LoopSchema       = NewSchema("loop", "Runs steps for each item of a collection", LoopConfig{})
+	TransformSchema  = NewSchema("transform", "Transforms the step input", TransformConfig{})
+	NotifySchema     = NewSchema("notify", "Sends a notification", NotifyConfig{})
+	LockSchema       = NewSchema("lock", "Acquires named locks held until released or the execution ends", LockConfig{})
+	UnlockSchema     = NewSchema("unlock", "Releases named locks held by the execution", UnlockConfig{})
+	ParseTableSchema = NewSchema("parse_table", "Parses a CSV, TSV or xlsx table into rows", ParseTableConfig{})
+	ApprovalSchema   = NewSchema("approval", "Waits for the approvals required by an approval policy", ApprovalConfig{})
+)
+
+// Builtin returns a registry holding the schemas of the built-in step types
+func Builtin() *Registry {
+	registry := NewRegistry()
+	registry.Register("http", HTTPSchema)
+	registry.Register("script", ScriptSchema)
+	registry.Register("condition", ConditionSchema)
+	registry.Register("conditional", ConditionSchema)
+	registry.Register("loop", LoopSchema)
+	registry.Register("transform", TransformSchema)
+	registry.Register("notify", NotifySchema)
+	registry.Register("lock", LockSchema)
+	registry.Register("unlock", UnlockSchema)
+	registry.Register("parse_table", ParseTableSchema)
+	registry.Register("approval", ApprovalSchema)
+	return registry
+}
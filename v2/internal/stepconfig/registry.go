@@ -0,0 +1,106 @@
+package stepconfig
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry maps step types to their config schemas
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*Schema
+}
+
+// NewRegistry creates an empty schema registry
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]*Schema)}
+}
+
+// Register registers the schema of a step type
+func (r *Registry) Register(stepType string, schema *Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[stepType] = schema
+}
+
+// Get returns the schema of a step type
+func (r *Registry) Get(stepType string) (*Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schema, exists := r.schemas[stepType]
+	return schema, exists
+}
+
+// Types returns the registered step types in sorted order
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.schemas))
+	for stepType := range r.schemas {
+		types = append(types, stepType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Section returns the part of a step config that belongs to the step type.
+// Configs may either nest their settings under the step type
+// ({"http": {"url": ...}}) or hold them directly ({"url": ...}).
+func Section(stepType string, config map[string]interface{}) map[string]interface{} {
+	if nested, ok := config[stepType].(map[string]interface{}); ok {
+		return nested
+	}
+	if config == nil {
+		return map[string]interface{}{}
+	}
+	return config
+}
+
+// DecodeCache caches decoded step configs so each step of a workflow version
+// is decoded only once
+type DecodeCache struct {
+	mu      sync.RWMutex
+	entries map[string]interface{}
+}
+
+// NewDecodeCache creates an empty decode cache
+func NewDecodeCache() *DecodeCache {
+	return &DecodeCache{entries: make(map[string]interface{})}
+}
+
+// CacheKey builds the cache key of a step within a workflow version
+func CacheKey(workflowID, version, stepID string) string {
+	return workflowID + "@" + version + "/" + stepID
+}
+
+// Decode returns the cached typed config for key, decoding config with the
+// schema on first use. Decode errors are not cached.
+func (c *DecodeCache) Decode(key string, schema *Schema, config map[string]interface{}) (interface{}, error) {
+	c.mu.RLock()
+	typed, exists := c.entries[key]
+	c.mu.RUnlock()
+	if exists {
+		return typed, nil
+	}
+
+	typed, err := schema.Decode(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, exists := c.entries[key]; exists {
+		return cached, nil
+	}
+	c.entries[key] = typed
+	return typed, nil
+}
+
+// Len returns the number of cached configs
+func (c *DecodeCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
@@ -0,0 +1,334 @@
+package stepconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Field types reported by a schema
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+	TypeObject  = "object"
+	TypeAny     = "any"
+)
+
+// Field describes a single configuration field of a step type
+type Field struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	ItemType    string   `json:"item_type,omitempty"`
+	Required    bool     `json:"required"`
+	Enum        []string `json:"enum,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// Schema describes the configuration accepted by a step type. It is derived
+// from a Go struct whose fields carry json, schema and description tags:
+//
+//	URL    string `json:"url" schema:"required" description:"Request URL"`
+//	Method string `json:"method" schema:"enum=GET|POST,default=GET"`
+type Schema struct {
+	StepType    string  `json:"step_type"`
+	Description string  `json:"description"`
+	Fields      []Field `json:"fields"`
+
+	configType reflect.Type
+}
+
+// NewSchema builds a schema from a config struct prototype. It panics if the
+// prototype is not a struct, as schemas are declared at init time.
+func NewSchema(stepType, description string, prototype interface{}) *Schema {
+	configType := reflect.TypeOf(prototype)
+	if configType != nil && configType.Kind() == reflect.Ptr {
+		configType = configType.Elem()
+	}
+	if configType == nil || configType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("stepconfig: schema prototype for %s must be a struct, got %T", stepType, prototype))
+	}
+
+	schema := &Schema{
+		StepType:    stepType,
+		Description: description,
+		configType:  configType,
+	}
+
+	for i := 0; i < configType.NumField(); i++ {
+		structField := configType.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = structField.Name
+		}
+
+		field := Field{
+			Name:        name,
+			Type:        typeName(structField.Type),
+			Description: structField.Tag.Get("description"),
+		}
+		if field.Type == TypeArray || field.Type == TypeObject {
+			if elem := elemTypeName(structField.Type); elem != TypeAny {
+				field.ItemType = elem
+			}
+		}
+
+		for _, option := range strings.Split(structField.Tag.Get("schema"), ",") {
+			switch {
+			case option == "required":
+				field.Required = true
+			case strings.HasPrefix(option, "enum="):
+				field.Enum = strings.Split(strings.TrimPrefix(option, "enum="), "|")
+			case strings.HasPrefix(option, "default="):
+				field.Default = strings.TrimPrefix(option, "default=")
+			}
+		}
+
+		schema.Fields = append(schema.Fields, field)
+	}
+
+	return schema
+}
+
+// Field returns the field with the given name
+func (s *Schema) Field(name string) (Field, bool) {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// Problem is an invalid field of a step config
+type Problem struct {
+	Field   string
+	Message string
+}
+
+// ConfigError lists the invalid fields of a step config
+type ConfigError struct {
+	StepType string
+	Problems []Problem
+}
+
+func (e *ConfigError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.Message
+	}
+	return fmt.Sprintf("%s step config: %s", e.StepType, strings.Join(messages, "; "))
+}
+
+// Validate checks a raw step config against the schema. Unknown fields are
+// returned as warnings, or reported as errors in strict mode. Errors are a
+// *ConfigError.
+func (s *Schema) Validate(config map[string]interface{}, strict bool) ([]string, error) {
+	var problems []Problem
+	var warnings []string
+
+	for _, field := range s.Fields {
+		value, exists := config[field.Name]
+		if !exists || value == nil {
+			if field.Required {
+				problems = append(problems, Problem{Field: field.Name, Message: fmt.Sprintf("missing required field %q", field.Name)})
+			}
+			continue
+		}
+
+		if problem := field.check(value); problem != "" {
+			problems = append(problems, Problem{Field: field.Name, Message: problem})
+		}
+	}
+
+	unknown := make([]string, 0)
+	for key := range config {
+		if _, known := s.Field(key); !known {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		message := fmt.Sprintf("unknown field %q", key)
+		if suggestion := s.suggest(key); suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		if strict {
+			problems = append(problems, Problem{Field: key, Message: message})
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s step: %s", s.StepType, message))
+		}
+	}
+
+	if len(problems) > 0 {
+		return warnings, &ConfigError{StepType: s.StepType, Problems: problems}
+	}
+	return warnings, nil
+}
+
+// Decode converts a raw step config into a new instance of the schema's
+// config struct and returns a pointer to it
+func (s *Schema) Decode(config map[string]interface{}) (interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s step config: %w", s.StepType, err)
+	}
+
+	typed := reflect.New(s.configType).Interface()
+	if err := json.Unmarshal(data, typed); err != nil {
+		return nil, fmt.Errorf("failed to decode %s step config: %w", s.StepType, err)
+	}
+	return typed, nil
+}
+
+// suggest returns the known field closest to an unknown one, if any is
+// within a couple of edits
+func (s *Schema) suggest(name string) string {
+	best := ""
+	bestDistance := 3
+	for _, field := range s.Fields {
+		if distance := editDistance(name, field.Name); distance < bestDistance {
+			best = field.Name
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// check returns a description of why value does not fit the field
+func (f Field) check(value interface{}) string {
+	if !matchesType(f.Type, value) {
+		return fmt.Sprintf("field %q must be of type %s, got %T", f.Name, f.Type, value)
+	}
+
+	if f.ItemType != "" {
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				if !matchesType(f.ItemType, v.Index(i).Interface()) {
+					return fmt.Sprintf("field %q must contain %s values", f.Name, f.ItemType)
+				}
+			}
+		case reflect.Map:
+			for _, key := range v.MapKeys() {
+				if !matchesType(f.ItemType, v.MapIndex(key).Interface()) {
+					return fmt.Sprintf("field %q must contain %s values", f.Name, f.ItemType)
+				}
+			}
+		}
+	}
+
+	if len(f.Enum) > 0 {
+		str, _ := value.(string)
+		for _, allowed := range f.Enum {
+			if strings.EqualFold(str, allowed) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("field %q must be one of %s, got %q", f.Name, strings.Join(f.Enum, ", "), str)
+	}
+
+	return ""
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return TypeString
+	case reflect.Bool:
+		return TypeBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return TypeInteger
+	case reflect.Float32, reflect.Float64:
+		return TypeNumber
+	case reflect.Slice, reflect.Array:
+		return TypeArray
+	case reflect.Map, reflect.Struct:
+		return TypeObject
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	default:
+		return TypeAny
+	}
+}
+
+func elemTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return typeName(t.Elem())
+	default:
+		return TypeAny
+	}
+}
+
+func matchesType(fieldType string, value interface{}) bool {
+	v := reflect.ValueOf(value)
+	switch fieldType {
+	case TypeString:
+		return v.Kind() == reflect.String
+	case TypeBoolean:
+		return v.Kind() == reflect.Bool
+	case TypeInteger:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		case reflect.Float32, reflect.Float64:
+			// JSON numbers decode to float64
+			return v.Float() == math.Trunc(v.Float())
+		}
+		return false
+	case TypeNumber:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case TypeArray:
+		return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	case TypeObject:
+		return v.Kind() == reflect.Map
+	default:
+		return true
+	}
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,158 @@
+package stepconfig
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSchema(t *testing.T) {
+	method, exists := HTTPSchema.Field("method")
+	require.True(t, exists)
+	assert.Equal(t, TypeString, method.Type)
+	assert.False(t, method.Required)
+	assert.Equal(t, "GET", method.Default)
+	assert.Equal(t, []string{"GET", "POST", "PUT", "PATCH", "DELETE"}, method.Enum)
+
+	url, exists := HTTPSchema.Field("url")
+	require.True(t, exists)
+	assert.True(t, url.Required)
+
+	headers, exists := HTTPSchema.Field("headers")
+	require.True(t, exists)
+	assert.Equal(t, TypeObject, headers.Type)
+	assert.Equal(t, TypeString, headers.ItemType)
+
+	assert.Panics(t, func() { NewSchema("bad", "", "not a struct") })
+}
+
+func TestSchemaValidate(t *testing.T) {
+	t.Run("valid config", func(t *testing.T) {
+		warnings, err := HTTPSchema.Validate(map[string]interface{}{
+			"url":     "https://example.com",
+			"method":  "post",
+			"headers": map[string]interface{}{"Accept": "application/json"},
+		}, true)
+
+		assert.NoError(t, err)
+		assert.Empty(t, warnings)
+	})
+
+	t.Run("unknown field warns by default", func(t *testing.T) {
+		warnings, err := HTTPSchema.Validate(map[string]interface{}{
+			"url":   "https://example.com",
+			"metod": "POST",
+		}, false)
+
+		assert.NoError(t, err)
+		require.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], `unknown field "metod"`)
+		assert.Contains(t, warnings[0], `did you mean "method"?`)
+	})
+
+	t.Run("unknown field fails in strict mode", func(t *testing.T) {
+		_, err := HTTPSchema.Validate(map[string]interface{}{
+			"url":   "https://example.com",
+			"metod": "POST",
+		}, true)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown field "metod"`)
+
+		var configErr *ConfigError
+		require.True(t, errors.As(err, &configErr))
+		assert.Equal(t, "metod", configErr.Problems[0].Field)
+	})
+
+	rejected := []struct {
+		name    string
+		schema  *Schema
+		config  map[string]interface{}
+		problem string
+	}{
+		{"missing required field", HTTPSchema, map[string]interface{}{"method": "GET"}, `missing required field "url"`},
+		{"wrong type", ScriptSchema, map[string]interface{}{"command": 42}, `field "command" must be of type string`},
+		{"enum", HTTPSchema, map[string]interface{}{"url": "https://example.com", "method": "FETCH"}, `field "method" must be one of`},
+		{"item type", HTTPSchema, map[string]interface{}{"url": "https://example.com", "headers": map[string]interface{}{"X-Retry": 3}}, `field "headers" must contain string values`},
+		{"fractional integer", LoopSchema, map[string]interface{}{"items": []interface{}{1}, "max_iterations": 1.5}, `field "max_iterations" must be of type integer`},
+		{"transform type", TransformSchema, map[string]interface{}{"type": "reduce"}, `field "type" must be one of`},
+		{"notify message", NotifySchema, map[string]interface{}{"channel": "slack"}, `missing required field "message"`},
+		{"lock names", LockSchema, map[string]interface{}{"ttl": "1m"}, `missing required field "names"`},
+		{"condition object", ConditionSchema, map[string]interface{}{"condition": "x > 1"}, `field "condition" must be of type object`},
+	}
+	for _, tc := range rejected {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.schema.Validate(tc.config, false)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.problem)
+		})
+	}
+}
+
+func TestSchemaDecode(t *testing.T) {
+	typed, err := HTTPSchema.Decode(map[string]interface{}{
+		"url":     "https://example.com",
+		"method":  "POST",
+		"headers": map[string]interface{}{"Accept": "application/json"},
+		"body":    map[string]interface{}{"id": 1},
+	})
+	require.NoError(t, err)
+
+	config, ok := typed.(*HTTPConfig)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com", config.URL)
+	assert.Equal(t, "POST", config.Method)
+	assert.Equal(t, map[string]string{"Accept": "application/json"}, config.Headers)
+	assert.Equal(t, map[string]interface{}{"id": float64(1)}, config.Body)
+}
+
+func TestSection(t *testing.T) {
+	nested := map[string]interface{}{"http": map[string]interface{}{"url": "https://example.com"}}
+	flat := map[string]interface{}{"url": "https://example.com"}
+
+	assert.Equal(t, flat, Section("http", nested))
+	assert.Equal(t, flat, Section("http", flat))
+	assert.Equal(t, map[string]interface{}{}, Section("http", nil))
+}
+
+func TestDecodeCache(t *testing.T) {
+	cache := NewDecodeCache()
+	config := map[string]interface{}{"command": "echo one"}
+	key := CacheKey("wf-1", "1.0.0", "build")
+
+	first, err := cache.Decode(key, ScriptSchema, config)
+	require.NoError(t, err)
+
+	config["command"] = "echo two"
+	second, err := cache.Decode(key, ScriptSchema, config)
+	require.NoError(t, err)
+
+	assert.Same(t, first, second, "config must be decoded once per version")
+	assert.Equal(t, "echo one", second.(*ScriptConfig).Command)
+	assert.Equal(t, 1, cache.Len())
+
+	next, err := cache.Decode(CacheKey("wf-1", "1.1.0", "build"), ScriptSchema, config)
+	require.NoError(t, err)
+	assert.Equal(t, "echo two", next.(*ScriptConfig).Command)
+	assert.Equal(t, 2, cache.Len())
+
+	_, err = cache.Decode(CacheKey("wf-1", "1.2.0", "build"), ScriptSchema, map[string]interface{}{"command": 42})
+	assert.Error(t, err)
+	assert.Equal(t, 2, cache.Len(), "decode errors must not be cached")
+}
+
+func TestBuiltin(t *testing.T) {
+	registry := Builtin()
+
+	for _, stepType := range []string{"http", "script", "condition", "loop", "transform", "notify", "lock", "unlock", "approval"} {
+		schema, exists := registry.Get(stepType)
+		require.True(t, exists, stepType)
+		assert.NotEmpty(t, schema.Fields, stepType)
+	}
+
+	_, exists := registry.Get("custom")
+	assert.False(t, exists)
+}
@@ -0,0 +1,120 @@
+package tabular
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"magic-flow/v2/internal/artifacts"
+)
+
+// Collector collects the rows of a table. Rows are kept in memory until
+// their JSON size exceeds the limit, after which they are all streamed to an
+// artifact as a JSON array.
+type Collector struct {
+	ctx   context.Context
+	store artifacts.Store
+	limit int
+
+	rows   []interface{}
+	size   int
+	count  int
+	writer artifacts.Writer
+}
+
+// NewCollector creates a collector storing rows larger than limit in store.
+// Without a store, rows larger than the limit fail the collection.
+func NewCollector(ctx context.Context, store artifacts.Store, limit int) *Collector {
+	return &Collector{ctx: ctx, store: store, limit: limit}
+}
+
+// Add collects a row
+func (c *Collector) Add(row map[string]interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("failed to encode row: %w", err)
+	}
+	c.count++
+
+	if c.writer == nil {
+		c.size += len(data) + 1
+		if c.size <= c.limit {
+			c.rows = append(c.rows, row)
+			return nil
+		}
+		if err := c.spill(); err != nil {
+			return err
+		}
+	}
+	if c.count > 1 {
+		if _, err := io.WriteString(c.writer, ","); err != nil {
+			return fmt.Errorf("failed to write rows artifact: %w", err)
+		}
+	}
+	if _, err := c.writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write rows artifact: %w", err)
+	}
+	return nil
+}
+
+// spill moves the rows kept in memory to a new artifact
+func (c *Collector) spill() error {
+	if c.store == nil {
+		return fmt.Errorf("the rows exceed max_inline_bytes (%d) and no artifact store is configured", c.limit)
+	}
+	writer, err := c.store.Create(c.ctx, "rows.json")
+	if err != nil {
+		return err
+	}
+	c.writer = writer
+
+	if _, err := io.WriteString(writer, "["); err != nil {
+		return fmt.Errorf("failed to write rows artifact: %w", err)
+	}
+	for i, row := range c.rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("failed to encode row: %w", err)
+		}
+		if i > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := writer.Write(data); err != nil {
+			return fmt.Errorf("failed to write rows artifact: %w", err)
+		}
+	}
+	c.rows = nil
+	return nil
+}
+
+// Output returns the collected rows under rows, or the reference of their
+// artifact under rows_artifact, and their number under row_count
+func (c *Collector) Output() (map[string]interface{}, error) {
+	output := map[string]interface{}{"row_count": c.count}
+	if c.writer == nil {
+		rows := c.rows
+		if rows == nil {
+			rows = []interface{}{}
+		}
+		output["rows"] = rows
+		return output, nil
+	}
+
+	if _, err := io.WriteString(c.writer, "]"); err != nil {
+		c.writer.Discard()
+		return nil, fmt.Errorf("failed to write rows artifact: %w", err)
+	}
+	if err := c.writer.Close(); err != nil {
+		return nil, err
+	}
+	output["rows_artifact"] = c.writer.Ref()
+	return output, nil
+}
+
+// Discard abandons the artifact of the rows, if any, after a failed parse
+func (c *Collector) Discard() {
+	if c.writer != nil {
+		c.writer.Discard()
+	}
+}
@@ -0,0 +1,51 @@
+package tabular
+
+import (
+	"fmt"
+	"strings"
+
+	"magic-flow/v2/internal/stepconfig"
+)
+
+// DefaultMaxInlineBytes is the size of the rows of a parse_table step, as
+// JSON, above which they are stored as an artifact
+const DefaultMaxInlineBytes = 1 << 20
+
+// DefaultMaxSourceBytes is the size of the artifact source of a parse_table
+// step above which the step fails without parsing it
+const DefaultMaxSourceBytes = 4 << 30
+
+// OptionsFromConfig returns the parse options of a parse_table step config,
+// checking its coercion rules and reader options
+func OptionsFromConfig(config *stepconfig.ParseTableConfig) (Options, error) {
+	rules, err := ParseRules(config.Types)
+	if err != nil {
+		return Options{}, err
+	}
+
+	options := Options{
+		Format:      strings.ToLower(config.Format),
+		Delimiter:   config.Delimiter,
+		Quote:       config.Quote,
+		Sheet:       config.Sheet,
+		SheetIndex:  config.SheetIndex,
+		Header:      config.Header == nil || *config.Header,
+		Columns:     config.Columns,
+		Types:       rules,
+		MaxRows:     config.MaxRows,
+		ErrorPolicy: strings.ToLower(config.OnError),
+	}
+	if options.Format == "" {
+		options.Format = FormatCSV
+	}
+	if options.ErrorPolicy == "" {
+		options.ErrorPolicy = ErrorPolicyFail
+	}
+	if config.Sheet != "" && config.SheetIndex != 0 {
+		return Options{}, fmt.Errorf("set either sheet or sheet_index, not both")
+	}
+	if err := ValidateOptions(options); err != nil {
+		return Options{}, err
+	}
+	return options, nil
+}
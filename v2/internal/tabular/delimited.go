@@ -0,0 +1,126 @@
+package tabular
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// delimitedReader reads the records of delimited text, such as CSV and TSV,
+// one at a time. Fields may be quoted, a doubled quote standing for a quote,
+// and quoted fields may span lines.
+type delimitedReader struct {
+	r         *bufio.Reader
+	delimiter rune
+	// quote is the quote character, zero when fields are never quoted
+	quote rune
+	// line is the line the next record starts on
+	line    int
+	started bool
+}
+
+func newDelimitedReader(r io.Reader, delimiter, quote rune) *delimitedReader {
+	return &delimitedReader{
+		r:         bufio.NewReader(r),
+		delimiter: delimiter,
+		quote:     quote,
+		line:      1,
+	}
+}
+
+// read returns the next record and the line it starts on. A malformed
+// record is returned with a *RowError, reading resuming at the next record.
+// Blank lines are skipped.
+func (d *delimitedReader) read() ([]string, int, error) {
+	var (
+		fields     []string
+		field      strings.Builder
+		line       = d.line
+		inQuotes   bool
+		afterQuote bool
+		fieldStart = true
+		empty      = true
+		problem    string
+	)
+	endField := func() {
+		fields = append(fields, field.String())
+		field.Reset()
+		fieldStart, afterQuote = true, false
+	}
+
+	for {
+		r, _, err := d.r.ReadRune()
+		if err == io.EOF {
+			if empty {
+				return nil, line, io.EOF
+			}
+			if inQuotes && problem == "" {
+				problem = "unterminated quoted field"
+			}
+			endField()
+			return fields, line, d.rowError(line, problem)
+		}
+		if err != nil {
+			return nil, line, err
+		}
+		if !d.started {
+			d.started = true
+			if r == '\uFEFF' {
+				continue
+			}
+		}
+
+		if inQuotes {
+			if r == d.quote {
+				if next, _, err := d.r.ReadRune(); err == nil {
+					if next == d.quote {
+						field.WriteRune(d.quote)
+						continue
+					}
+					d.r.UnreadRune()
+				}
+				inQuotes, afterQuote = false, true
+				continue
+			}
+			if r == '\n' {
+				d.line++
+			}
+			field.WriteRune(r)
+			continue
+		}
+
+		switch {
+		case r == '\r' || r == '\n':
+			if r == '\r' {
+				if next, _, err := d.r.ReadRune(); err == nil && next != '\n' {
+					d.r.UnreadRune()
+				}
+			}
+			d.line++
+			if empty {
+				line = d.line
+				continue
+			}
+			endField()
+			return fields, line, d.rowError(line, problem)
+		case r == d.delimiter:
+			empty = false
+			endField()
+		case r == d.quote && d.quote != 0 && fieldStart:
+			empty, inQuotes, fieldStart = false, true, false
+		default:
+			empty, fieldStart = false, false
+			if afterQuote && problem == "" {
+				problem = "unexpected text after a quoted field"
+			}
+			field.WriteRune(r)
+		}
+	}
+}
+
+func (d *delimitedReader) rowError(line int, problem string) error {
+	if problem == "" {
+		return nil
+	}
+	return &RowError{Row: line, Message: problem}
+}
@@ -0,0 +1,406 @@
+// Package tabular parses CSV, TSV and xlsx tables into records, streaming
+// the rows so that large files are never held in memory
+package tabular
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Table formats
+const (
+	FormatCSV  = "csv"
+	FormatTSV  = "tsv"
+	FormatXLSX = "xlsx"
+)
+
+// Error policies, deciding what a malformed row does
+const (
+	// ErrorPolicyFail fails the parse on the first malformed row
+	ErrorPolicyFail = "fail"
+	// ErrorPolicySkip skips malformed rows, collecting their errors in the
+	// report
+	ErrorPolicySkip = "skip"
+)
+
+// maxReportedErrors bounds the row errors kept in a report; further skipped
+// rows are only counted
+const maxReportedErrors = 100
+
+// Options configure a parse
+type Options struct {
+	Format string
+	// Delimiter separates the fields of CSV rows, a comma by default
+	Delimiter string
+	// Quote quotes the fields of CSV and TSV rows, a double quote by
+	// default; "none" disables quoting
+	Quote string
+	// Sheet names the xlsx worksheet to read, SheetIndex gives its 1-based
+	// position instead. The first worksheet is read when neither is set.
+	Sheet      string
+	SheetIndex int
+	// Header is set when the first row names the columns
+	Header bool
+	// Columns names the columns, replacing the header row when there is
+	// one. Without either, columns are named column_1, column_2 and so on.
+	Columns []string
+	// Types holds the coercion rule of columns, others are kept as strings
+	Types map[string]Rule
+	// MaxRows stops the parse after that many data rows, 0 for no limit
+	MaxRows     int
+	ErrorPolicy string
+}
+
+// RowError is a malformed row
+type RowError struct {
+	// Row is the line of CSV and TSV rows, the row number of xlsx rows
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *RowError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("row %d: column %s: %s", e.Row, e.Column, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// ColumnReport summarizes the values of a column
+type ColumnReport struct {
+	Name string `json:"name"`
+	// Type is the coercion rule of the column, string when it has none
+	Type string `json:"type"`
+	// Inferred is the narrowest type fitting every value of the column:
+	// int, float, bool, date, string, or empty when it has no value
+	Inferred string `json:"inferred"`
+	Values   int    `json:"values"`
+	Empty    int    `json:"empty"`
+	// Invalid counts the values the rule could not coerce
+	Invalid int `json:"invalid"`
+}
+
+// Report summarizes a parse
+type Report struct {
+	Format string `json:"format"`
+	// RowsRead counts the data rows read, malformed or not
+	RowsRead    int `json:"rows_read"`
+	RowsParsed  int `json:"rows_parsed"`
+	RowsSkipped int `json:"rows_skipped"`
+	// Truncated is set when rows were left unread because of MaxRows
+	Truncated bool `json:"truncated"`
+	// Errors holds the errors of the first skipped rows
+	Errors  []RowError     `json:"errors,omitempty"`
+	Columns []ColumnReport `json:"columns"`
+}
+
+// recordReader reads the rows of a table one at a time
+type recordReader interface {
+	read() ([]string, int, error)
+}
+
+// Parse reads a table, calling emit with each parsed row as an object keyed
+// by column name. Rows are read and emitted one at a time. xlsx tables need
+// random access: files and in-memory readers are read in place, other
+// readers are first copied to a temporary file.
+//
+// The report is returned even when the parse fails, covering the rows read
+// until then. A malformed row fails the parse with a *RowError under the
+// fail policy.
+func Parse(ctx context.Context, r io.Reader, options Options, emit func(row map[string]interface{}) error) (*Report, error) {
+	report := &Report{Format: options.Format}
+	reader, cleanup, err := openReader(r, options)
+	if err != nil {
+		return report, err
+	}
+	defer cleanup()
+
+	p := &parser{
+		options:     options,
+		report:      report,
+		serialDates: options.Format == FormatXLSX,
+		lenient:     options.Format == FormatXLSX,
+	}
+	return report, p.run(ctx, reader, emit)
+}
+
+// ValidateOptions checks options before any row is read
+func ValidateOptions(options Options) error {
+	switch options.Format {
+	case FormatCSV, FormatTSV, FormatXLSX:
+	default:
+		return fmt.Errorf("unknown format %q, expected csv, tsv or xlsx", options.Format)
+	}
+	switch options.ErrorPolicy {
+	case "", ErrorPolicyFail, ErrorPolicySkip:
+	default:
+		return fmt.Errorf("unknown error policy %q, expected fail or skip", options.ErrorPolicy)
+	}
+	delimiter, err := singleRune("delimiter", options.Delimiter)
+	if err != nil {
+		return err
+	}
+	if options.Quote != "none" {
+		quote, err := singleRune("quote", options.Quote)
+		if err != nil {
+			return err
+		}
+		if quote != 0 && quote == delimiter {
+			return fmt.Errorf("quote and delimiter must differ")
+		}
+	}
+	if options.MaxRows < 0 {
+		return fmt.Errorf("max rows must not be negative")
+	}
+	if options.SheetIndex < 0 {
+		return fmt.Errorf("sheet index must not be negative")
+	}
+	return nil
+}
+
+func openReader(r io.Reader, options Options) (recordReader, func(), error) {
+	if err := ValidateOptions(options); err != nil {
+		return nil, nil, err
+	}
+
+	if options.Format == FormatXLSX {
+		readerAt, size, cleanup, err := randomAccess(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader, err := newXLSXReader(readerAt, size, options.Sheet, options.SheetIndex)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		return reader, func() {
+			reader.close()
+			cleanup()
+		}, nil
+	}
+
+	delimiter := ','
+	if options.Format == FormatTSV {
+		delimiter = '\t'
+	}
+	if options.Delimiter != "" {
+		delimiter, _ = utf8.DecodeRuneInString(options.Delimiter)
+	}
+	quote := '"'
+	switch {
+	case options.Quote == "none":
+		quote = 0
+	case options.Quote != "":
+		quote, _ = utf8.DecodeRuneInString(options.Quote)
+	}
+	return newDelimitedReader(r, delimiter, quote), func() {}, nil
+}
+
+// randomAccess returns r as an io.ReaderAt, copying it to a temporary file
+// when it is neither a file nor an in-memory reader
+func randomAccess(r io.Reader) (io.ReaderAt, int64, func(), error) {
+	switch v := r.(type) {
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to read xlsx file: %w", err)
+		}
+		return v, info.Size(), func() {}, nil
+	case interface {
+		io.ReaderAt
+		Size() int64
+	}:
+		return v, v.Size(), func() {}, nil
+	}
+
+	file, err := os.CreateTemp("", "magic-flow-xlsx-*")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to buffer xlsx file: %w", err)
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	size, err := io.Copy(file, r)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("failed to buffer xlsx file: %w", err)
+	}
+	return file, size, cleanup, nil
+}
+
+type parser struct {
+	options     Options
+	report      *Report
+	columns     []string
+	inferences  []inference
+	serialDates bool
+	// lenient pads short rows and ignores empty trailing cells, as xlsx
+	// rows leave out their empty cells
+	lenient bool
+}
+
+func (p *parser) run(ctx context.Context, reader recordReader, emit func(row map[string]interface{}) error) error {
+	if len(p.options.Columns) > 0 {
+		if err := p.setColumns(p.options.Columns); err != nil {
+			return err
+		}
+	}
+
+	headerPending := p.options.Header
+	for {
+		record, row, err := reader.read()
+		if err == io.EOF {
+			return nil
+		}
+		var rowErr *RowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return err
+		}
+
+		if headerPending {
+			headerPending = false
+			if rowErr != nil {
+				return fmt.Errorf("invalid header: %w", rowErr)
+			}
+			if p.columns == nil {
+				if err := p.setColumns(record); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if p.columns == nil {
+			names := make([]string, len(record))
+			if err := p.setColumns(names); err != nil {
+				return err
+			}
+		}
+
+		if p.options.MaxRows > 0 && p.report.RowsRead == p.options.MaxRows {
+			p.report.Truncated = true
+			return nil
+		}
+		p.report.RowsRead++
+		if p.report.RowsRead%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		values, err := p.parseRow(record, row, rowErr)
+		if err != nil {
+			if !errors.As(err, &rowErr) || p.options.ErrorPolicy != ErrorPolicySkip {
+				return err
+			}
+			p.report.RowsSkipped++
+			if len(p.report.Errors) < maxReportedErrors {
+				p.report.Errors = append(p.report.Errors, *rowErr)
+			}
+			continue
+		}
+		if err := emit(values); err != nil {
+			return err
+		}
+		p.report.RowsParsed++
+	}
+}
+
+// setColumns names the columns, unnamed columns being named by position,
+// and checks the coercion rules only name known columns
+func (p *parser) setColumns(names []string) error {
+	columns := make([]string, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate column %s", name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+
+	var unknown []string
+	for column := range p.options.Types {
+		if !seen[column] {
+			unknown = append(unknown, column)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("column types name unknown columns: %s", strings.Join(unknown, ", "))
+	}
+
+	p.columns = columns
+	p.inferences = make([]inference, len(columns))
+	p.report.Columns = make([]ColumnReport, len(columns))
+	for i, column := range columns {
+		rule, ok := p.options.Types[column]
+		if !ok {
+			rule = Rule{Type: TypeString}
+		}
+		p.report.Columns[i] = ColumnReport{Name: column, Type: rule.String(), Inferred: TypeEmpty}
+	}
+	return nil
+}
+
+// parseRow checks the fields of a row and coerces its values
+func (p *parser) parseRow(record []string, row int, rowErr *RowError) (map[string]interface{}, error) {
+	if rowErr != nil {
+		return nil, rowErr
+	}
+	if p.lenient {
+		for len(record) > len(p.columns) && record[len(record)-1] == "" {
+			record = record[:len(record)-1]
+		}
+		for len(record) < len(p.columns) {
+			record = append(record, "")
+		}
+	}
+	if len(record) != len(p.columns) {
+		return nil, &RowError{Row: row, Message: fmt.Sprintf("has %d fields, expected %d", len(record), len(p.columns))}
+	}
+
+	for i, field := range record {
+		p.inferences[i].observe(field)
+		column := &p.report.Columns[i]
+		column.Values, column.Empty = p.inferences[i].values, p.inferences[i].empty
+		column.Inferred = p.inferences[i].inferred()
+	}
+
+	values := make(map[string]interface{}, len(record))
+	for i, field := range record {
+		rule, ok := p.options.Types[p.columns[i]]
+		if !ok {
+			values[p.columns[i]] = field
+			continue
+		}
+		value, err := rule.Coerce(field, p.serialDates)
+		if err != nil {
+			p.report.Columns[i].Invalid++
+			return nil, &RowError{Row: row, Column: p.columns[i], Message: err.Error()}
+		}
+		values[p.columns[i]] = value
+	}
+	return values, nil
+}
+
+func singleRune(name, value string) (rune, error) {
+	if value == "" {
+		return 0, nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("%s must be a single character, got %q", name, value)
+	}
+	return r, nil
+}
@@ -0,0 +1,213 @@
+package tabular
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types of coercion rules and type inference
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	TypeDate   = "date"
+	// TypeEmpty is inferred for columns without any value
+	TypeEmpty = "empty"
+)
+
+// DefaultDateLayout is the layout of date rules without one
+const DefaultDateLayout = "2006-01-02"
+
+// layoutProbe differs from Go's reference time in every element, so it
+// formats to the layout itself only under layouts without any element,
+// which could not parse a date
+var layoutProbe = time.Date(1999, time.November, 28, 21, 37, 48, 0, time.UTC)
+
+// excelEpoch is the day xlsx date serials count from
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// Rule coerces the values of a column. Rules are written as string, int,
+// float, bool, date or date:<layout>, the layout using Go's reference time,
+// such as date:02/01/2006.
+type Rule struct {
+	Type   string
+	Layout string
+}
+
+// ParseRule parses a coercion rule
+func ParseRule(spec string) (Rule, error) {
+	name, layout, hasLayout := strings.Cut(strings.TrimSpace(spec), ":")
+	switch name {
+	case TypeString, TypeInt, TypeFloat, TypeBool:
+		if hasLayout {
+			return Rule{}, fmt.Errorf("type %s does not take a layout", name)
+		}
+		return Rule{Type: name}, nil
+	case TypeDate:
+		if !hasLayout {
+			return Rule{Type: TypeDate, Layout: DefaultDateLayout}, nil
+		}
+		if layout == "" || layoutProbe.Format(layout) == layout {
+			return Rule{}, fmt.Errorf("date layout %q has no date or time elements, write it with Go's reference time 2006-01-02 15:04:05", layout)
+		}
+		return Rule{Type: TypeDate, Layout: layout}, nil
+	default:
+		return Rule{}, fmt.Errorf("unknown type %q, expected string, int, float, bool, date or date:<layout>", name)
+	}
+}
+
+// ParseRules parses the coercion rules of columns, reporting every invalid
+// rule
+func ParseRules(specs map[string]string) (map[string]Rule, error) {
+	columns := make([]string, 0, len(specs))
+	for column := range specs {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	rules := make(map[string]Rule, len(specs))
+	var problems []string
+	for _, column := range columns {
+		rule, err := ParseRule(specs[column])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("column %s: %v", column, err))
+			continue
+		}
+		rules[column] = rule
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid column types: %s", strings.Join(problems, "; "))
+	}
+	return rules, nil
+}
+
+// String returns the rule as written
+func (r Rule) String() string {
+	if r.Type == TypeDate && r.Layout != DefaultDateLayout {
+		return TypeDate + ":" + r.Layout
+	}
+	return r.Type
+}
+
+// Coerce converts a value of the column. Empty values are nil for every
+// type but string. Dates are returned in RFC 3339; with serialDates, numbers
+// are read as the date serials of xlsx cells formatted as dates.
+func (r Rule) Coerce(value string, serialDates bool) (interface{}, error) {
+	if r.Type == TypeString || r.Type == "" {
+		return value, nil
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	switch r.Type {
+	case TypeInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %q", value)
+		}
+		return n, nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", value)
+		}
+		return f, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", value)
+		}
+		return b, nil
+	case TypeDate:
+		if t, err := time.Parse(r.Layout, value); err == nil {
+			return t.Format(time.RFC3339), nil
+		}
+		if serialDates {
+			if serial, err := strconv.ParseFloat(value, 64); err == nil {
+				return serialDate(serial).Format(time.RFC3339), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date %q, expected layout %s", value, r.Layout)
+	default:
+		return nil, fmt.Errorf("unknown type %q", r.Type)
+	}
+}
+
+// serialDate converts an xlsx date serial, in days since its epoch
+func serialDate(serial float64) time.Time {
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 24 * 60 * 60)
+	return excelEpoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+}
+
+// inference tracks which types fit every value of a column
+type inference struct {
+	values   int
+	empty    int
+	notInt   bool
+	notFloat bool
+	notBool  bool
+	notDate  bool
+}
+
+func (i *inference) observe(value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		i.empty++
+		return
+	}
+	i.values++
+	if !i.notInt {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			i.notInt = true
+		}
+	}
+	if !i.notFloat {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			i.notFloat = true
+		}
+	}
+	if !i.notBool {
+		if _, err := strconv.ParseBool(value); err != nil || isNumber(value) {
+			i.notBool = true
+		}
+	}
+	if !i.notDate {
+		_, dateErr := time.Parse(DefaultDateLayout, value)
+		_, timeErr := time.Parse(time.RFC3339, value)
+		if dateErr != nil && timeErr != nil {
+			i.notDate = true
+		}
+	}
+}
+
+// inferred returns the narrowest type fitting every value
+func (i *inference) inferred() string {
+	switch {
+	case i.values == 0:
+		return TypeEmpty
+	case !i.notInt:
+		return TypeInt
+	case !i.notFloat:
+		return TypeFloat
+	case !i.notBool:
+		return TypeBool
+	case !i.notDate:
+		return TypeDate
+	default:
+		return TypeString
+	}
+}
+
+// isNumber keeps 0 and 1 columns from being inferred as bool
+func isNumber(value string) bool {
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
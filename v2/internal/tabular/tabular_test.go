@@ -0,0 +1,332 @@
+package tabular
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"magic-flow/v2/internal/artifacts"
+	"magic-flow/v2/internal/stepconfig"
+)
+
+// ordersCSV has a row with a missing field, one with an invalid quantity
+// and one with an unterminated quote
+const ordersCSV = `id,customer,quantity,ordered
+1,"Acme, Corp",3,2024-03-01
+2,Globex
+3,Initech,many,2024-03-03
+
+4,"Umbrella ""Labs""",5,2024-03-04
+5,"Hooli,7,2024-03-05
+`
+
+func orderOptions(policy string) Options {
+	rules, err := ParseRules(map[string]string{"id": "int", "quantity": "int", "ordered": "date"})
+	if err != nil {
+		panic(err)
+	}
+	return Options{Format: FormatCSV, Header: true, Types: rules, ErrorPolicy: policy}
+}
+
+func parseAll(t *testing.T, r io.Reader, options Options) ([]map[string]interface{}, *Report, error) {
+	t.Helper()
+	var rows []map[string]interface{}
+	report, err := Parse(context.Background(), r, options, func(row map[string]interface{}) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, report, err
+}
+
+func TestParseFailsOnMalformedRow(t *testing.T) {
+	rows, report, err := parseAll(t, strings.NewReader(ordersCSV), orderOptions(ErrorPolicyFail))
+
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) {
+		t.Fatalf("Parse() error = %v, want a *RowError", err)
+	}
+	if rowErr.Row != 3 || rowErr.Message != "has 2 fields, expected 4" {
+		t.Errorf("row error = %+v, want line 3 with 2 fields", rowErr)
+	}
+	if len(rows) != 1 || report.RowsParsed != 1 || report.RowsRead != 2 {
+		t.Errorf("rows = %v, report = %+v, want the first row only", rows, report)
+	}
+}
+
+func TestParseSkipsMalformedRows(t *testing.T) {
+	rows, report, err := parseAll(t, strings.NewReader(ordersCSV), orderOptions(ErrorPolicySkip))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []map[string]interface{}{
+		{"id": int64(1), "customer": "Acme, Corp", "quantity": int64(3), "ordered": "2024-03-01T00:00:00Z"},
+		{"id": int64(4), "customer": `Umbrella "Labs"`, "quantity": int64(5), "ordered": "2024-03-04T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+	if report.RowsRead != 5 || report.RowsParsed != 2 || report.RowsSkipped != 3 {
+		t.Errorf("report = %+v, want 5 read, 2 parsed and 3 skipped", report)
+	}
+	wantErrors := []RowError{
+		{Row: 3, Message: "has 2 fields, expected 4"},
+		{Row: 4, Column: "quantity", Message: `invalid int "many"`},
+		{Row: 7, Message: "unterminated quoted field"},
+	}
+	if !reflect.DeepEqual(report.Errors, wantErrors) {
+		t.Errorf("errors = %+v, want %+v", report.Errors, wantErrors)
+	}
+
+	quantity := report.Columns[2]
+	if quantity.Type != TypeInt || quantity.Inferred != TypeString || quantity.Invalid != 1 {
+		t.Errorf("quantity column = %+v, want int coerced, string inferred and one invalid value", quantity)
+	}
+	if ordered := report.Columns[3]; ordered.Inferred != TypeDate {
+		t.Errorf("ordered column inferred %s, want date", ordered.Inferred)
+	}
+}
+
+func TestParseDelimiterQuoteAndColumns(t *testing.T) {
+	table := "1;'a;b';true\n2;'it''s';false\n"
+	rules, err := ParseRules(map[string]string{"flag": "bool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, report, err := parseAll(t, strings.NewReader(table), Options{
+		Format:    FormatCSV,
+		Delimiter: ";",
+		Quote:     "'",
+		Columns:   []string{"id", "text", "flag"},
+		Types:     rules,
+		MaxRows:   1,
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []map[string]interface{}{{"id": "1", "text": "a;b", "flag": true}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+	if !report.Truncated {
+		t.Error("expected the report to be truncated by max rows")
+	}
+	if report.Columns[0].Inferred != TypeInt {
+		t.Errorf("id column inferred %s, want int", report.Columns[0].Inferred)
+	}
+}
+
+func TestParseTSVWithoutHeader(t *testing.T) {
+	rows, _, err := parseAll(t, strings.NewReader("a\tb\r\nc\td\r\n"), Options{Format: FormatTSV})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []map[string]interface{}{
+		{"column_1": "a", "column_2": "b"},
+		{"column_1": "c", "column_2": "d"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+}
+
+func TestParseXLSX(t *testing.T) {
+	file, err := os.Open("testdata/orders.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rules, err := ParseRules(map[string]string{"id": "int", "quantity": "int", "ordered": "date", "paid": "bool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Format: FormatXLSX, Sheet: "Orders", Header: true, Types: rules, ErrorPolicy: ErrorPolicySkip}
+	rows, report, err := parseAll(t, file, options)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []map[string]interface{}{
+		{"id": int64(1), "customer": "Acme Corp", "quantity": int64(3), "ordered": "2024-03-01T00:00:00Z", "paid": true},
+		{"id": int64(3), "customer": "Initech", "quantity": nil, "ordered": "2024-03-04T00:00:00Z", "paid": nil},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+	wantErrors := []RowError{{Row: 3, Column: "quantity", Message: `invalid int "many"`}}
+	if !reflect.DeepEqual(report.Errors, wantErrors) {
+		t.Errorf("errors = %+v, want %+v", report.Errors, wantErrors)
+	}
+}
+
+func TestParseXLSXFailPolicy(t *testing.T) {
+	file, err := os.Open("testdata/orders.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rules, err := ParseRules(map[string]string{"quantity": "int"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = parseAll(t, file, Options{Format: FormatXLSX, SheetIndex: 2, Header: true, Types: rules, ErrorPolicy: ErrorPolicyFail})
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || rowErr.Row != 3 || rowErr.Column != "quantity" {
+		t.Errorf("Parse() error = %v, want row 3 failing on quantity", err)
+	}
+}
+
+func TestParseXLSXSheetByIndex(t *testing.T) {
+	content, err := os.ReadFile("testdata/orders.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reader without random access is buffered to a temporary file
+	rows, _, err := parseAll(t, io.MultiReader(strings.NewReader(string(content))), Options{Format: FormatXLSX, SheetIndex: 1, Header: true})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []map[string]interface{}{{"total": "6"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+
+	_, _, err = parseAll(t, strings.NewReader(string(content)), Options{Format: FormatXLSX, Sheet: "Missing"})
+	if err == nil || !strings.Contains(err.Error(), `no sheet "Missing"`) {
+		t.Errorf("Parse() error = %v, want a missing sheet error", err)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Rule
+		err  string
+	}{
+		{spec: "int", want: Rule{Type: TypeInt}},
+		{spec: "date", want: Rule{Type: TypeDate, Layout: DefaultDateLayout}},
+		{spec: "date:02/01/2006 15:04", want: Rule{Type: TypeDate, Layout: "02/01/2006 15:04"}},
+		{spec: "date:dd/mm/yyyy", err: "has no date or time elements"},
+		{spec: "int:base10", err: "does not take a layout"},
+		{spec: "money", err: `unknown type "money"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := ParseRule(tt.spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ParseRule() error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || rule != tt.want {
+				t.Errorf("ParseRule() = %+v, %v, want %+v", rule, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionsFromConfig(t *testing.T) {
+	header := false
+	options, err := OptionsFromConfig(&stepconfig.ParseTableConfig{Format: "TSV", Header: &header})
+	if err != nil {
+		t.Fatalf("OptionsFromConfig() error = %v", err)
+	}
+	if options.Format != FormatTSV || options.Header || options.ErrorPolicy != ErrorPolicyFail {
+		t.Errorf("options = %+v, want tsv without header failing on malformed rows", options)
+	}
+
+	invalid := []*stepconfig.ParseTableConfig{
+		{Types: map[string]string{"amount": "decimal"}},
+		{Delimiter: ";;"},
+		{Delimiter: "'", Quote: "'"},
+		{Format: "xlsx", Sheet: "Orders", SheetIndex: 2},
+	}
+	for _, config := range invalid {
+		if _, err := OptionsFromConfig(config); err == nil {
+			t.Errorf("OptionsFromConfig(%+v) succeeded, want an error", config)
+		}
+	}
+}
+
+func TestCollectorStoresLargeTablesAsArtifacts(t *testing.T) {
+	store, err := artifacts.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stream a large table through a pipe so it is never held in memory
+	const rowCount = 20000
+	reader, writer := io.Pipe()
+	go func() {
+		fmt.Fprintln(writer, "id,name")
+		for i := 1; i <= rowCount; i++ {
+			fmt.Fprintf(writer, "%d,name-%d\n", i, i)
+		}
+		writer.Close()
+	}()
+
+	rules, err := ParseRules(map[string]string{"id": "int"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := NewCollector(context.Background(), store, 64*1024)
+	report, err := Parse(context.Background(), reader, Options{Format: FormatCSV, Header: true, Types: rules}, collector.Add)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	output, err := collector.Output()
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+
+	if _, inline := output["rows"]; inline {
+		t.Fatal("expected the rows to be stored as an artifact")
+	}
+	ref, _ := output["rows_artifact"].(string)
+	if !artifacts.IsRef(ref) || output["row_count"] != rowCount || report.RowsParsed != rowCount {
+		t.Fatalf("output = %v, report = %+v", output, report)
+	}
+
+	content, err := store.Open(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer content.Close()
+	var rows []map[string]interface{}
+	if err := json.NewDecoder(content).Decode(&rows); err != nil {
+		t.Fatalf("artifact is not a JSON array: %v", err)
+	}
+	if len(rows) != rowCount || rows[rowCount-1]["name"] != fmt.Sprintf("name-%d", rowCount) {
+		t.Errorf("artifact holds %d rows, last %v", len(rows), rows[len(rows)-1])
+	}
+}
+
+func TestCollectorKeepsSmallTablesInline(t *testing.T) {
+	collector := NewCollector(context.Background(), nil, 1024)
+	if _, err := Parse(context.Background(), strings.NewReader("a\n1\n"), Options{Format: FormatCSV, Header: true}, collector.Add); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	output, err := collector.Output()
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	want := map[string]interface{}{"row_count": 1, "rows": []interface{}{map[string]interface{}{"a": "1"}}}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("output = %v, want %v", output, want)
+	}
+
+	collector = NewCollector(context.Background(), nil, 4)
+	if err := collector.Add(map[string]interface{}{"a": "12345"}); err == nil {
+		t.Error("expected rows above the limit to fail without an artifact store")
+	}
+}
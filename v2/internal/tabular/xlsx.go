@@ -0,0 +1,301 @@
+package tabular
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const relationshipsNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxReader reads the rows of a worksheet of an xlsx workbook. The
+// worksheet is decoded as a stream, one row at a time; only the shared
+// strings table, which cells reference by index, is held in memory.
+type xlsxReader struct {
+	file    io.Closer
+	decoder *xml.Decoder
+	strings []string
+}
+
+// newXLSXReader opens the worksheet of a workbook by name, or by its 1-based
+// index when name is empty. The first worksheet is read when neither is
+// set.
+func newXLSXReader(r io.ReaderAt, size int64, name string, index int) (*xlsxReader, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var workbook xlsxWorkbook
+	if err := decodeXLSXPart(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var relationships xlsxRelationships
+	if err := decodeXLSXPart(files, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("invalid xlsx file: the workbook has no sheets")
+	}
+
+	sheet := -1
+	switch {
+	case name != "":
+		for i, candidate := range workbook.Sheets {
+			if candidate.Name == name {
+				sheet = i
+			}
+		}
+		if sheet < 0 {
+			return nil, fmt.Errorf("the workbook has no sheet %q", name)
+		}
+	case index > 0:
+		if index > len(workbook.Sheets) {
+			return nil, fmt.Errorf("the workbook has %d sheets, no sheet %d", len(workbook.Sheets), index)
+		}
+		sheet = index - 1
+	default:
+		sheet = 0
+	}
+
+	target := ""
+	for _, relationship := range relationships.Relationships {
+		if relationship.ID == workbook.Sheets[sheet].RID {
+			target = relationship.Target
+		}
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+	worksheet, ok := files[target]
+	if !ok {
+		return nil, fmt.Errorf("invalid xlsx file: missing worksheet %s", workbook.Sheets[sheet].Name)
+	}
+
+	sharedStrings, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+	content, err := worksheet.Open()
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	return &xlsxReader{
+		file:    content,
+		decoder: xml.NewDecoder(content),
+		strings: sharedStrings,
+	}, nil
+}
+
+// read returns the cells of the next row holding a value, and its row
+// number. Cells missing from the row are empty strings.
+func (x *xlsxReader) read() ([]string, int, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid xlsx worksheet: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		row, _ := strconv.Atoi(attribute(start, "r"))
+		cells, err := x.readRow()
+		if err != nil {
+			return nil, row, err
+		}
+		for _, cell := range cells {
+			if cell != "" {
+				return cells, row, nil
+			}
+		}
+	}
+}
+
+func (x *xlsxReader) close() error {
+	return x.file.Close()
+}
+
+// readRow reads the cells of a row up to its end element
+func (x *xlsxReader) readRow() ([]string, error) {
+	var cells []string
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid xlsx worksheet: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			column := len(cells)
+			if index := columnIndex(attribute(t, "r")); index >= 0 {
+				column = index
+			}
+			value, err := x.readCell(t)
+			if err != nil {
+				return nil, err
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			cells[column] = value
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return cells, nil
+			}
+		}
+	}
+}
+
+// readCell reads the value of a cell: shared strings are looked up,
+// booleans read as true or false and numbers kept as written
+func (x *xlsxReader) readCell(start xml.StartElement) (string, error) {
+	var cell struct {
+		Value  string   `xml:"v"`
+		Inline []string `xml:"is>t"`
+		Runs   []string `xml:"is>r>t"`
+	}
+	if err := x.decoder.DecodeElement(&cell, &start); err != nil {
+		return "", fmt.Errorf("invalid xlsx worksheet: %w", err)
+	}
+
+	switch attribute(start, "t") {
+	case "s":
+		index, err := strconv.Atoi(strings.TrimSpace(cell.Value))
+		if err != nil || index < 0 || index >= len(x.strings) {
+			return "", fmt.Errorf("invalid xlsx worksheet: unknown shared string %q", cell.Value)
+		}
+		return x.strings[index], nil
+	case "inlineStr":
+		return strings.Join(cell.Inline, "") + strings.Join(cell.Runs, ""), nil
+	case "b":
+		if strings.TrimSpace(cell.Value) == "1" {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		return cell.Value, nil
+	}
+}
+
+// readSharedStrings reads the shared strings table, joining the runs of
+// rich text strings and leaving out their phonetic hints
+func readSharedStrings(file *zip.File) ([]string, error) {
+	if file == nil {
+		return nil, nil
+	}
+	content, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	defer content.Close()
+
+	var (
+		sharedStrings []string
+		text          strings.Builder
+		inText        bool
+		phonetic      int
+	)
+	decoder := xml.NewDecoder(content)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return sharedStrings, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid xlsx shared strings: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				text.Reset()
+			case "rPh":
+				phonetic++
+			case "t":
+				inText = phonetic == 0
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				sharedStrings = append(sharedStrings, text.String())
+			case "rPh":
+				phonetic--
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+}
+
+func decodeXLSXPart(files map[string]*zip.File, name string, v interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		return fmt.Errorf("invalid xlsx file: missing %s", name)
+	}
+	content, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	defer content.Close()
+	if err := xml.NewDecoder(content).Decode(v); err != nil {
+		return fmt.Errorf("invalid xlsx file: %s: %w", name, err)
+	}
+	return nil
+}
+
+func attribute(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name && attr.Name.Space != relationshipsNamespace {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// columnIndex returns the 0-based column of a cell reference such as AB12,
+// -1 when it has no column
+func columnIndex(ref string) int {
+	column := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+	}
+	return column - 1
+}
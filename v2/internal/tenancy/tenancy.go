@@ -0,0 +1,86 @@
+// Package tenancy isolates the data of the tenants of multi-tenant
+// deployments. The tenant of an API request is resolved from its API key
+// and carried by the request context; the database scopes the queries of
+// tenant-owned records, workflows and executions, to the tenant of their
+// context and fails closed when there is none. Background processes acting
+// for every tenant, such as the engine and the scheduler, query with a
+// system context.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrNoTenant is returned for queries of tenant-owned records without
+	// a tenant in their context
+	ErrNoTenant = errors.New("no tenant in context")
+	// ErrCrossTenant is returned for writes of records owned by another
+	// tenant than the tenant of their context
+	ErrCrossTenant = errors.New("record belongs to another tenant")
+)
+
+type tenantKey struct{}
+
+type systemKey struct{}
+
+// WithTenant returns a context carrying a tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// FromContext returns the tenant carried by a context, or an empty string
+// when there is none
+func FromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// WithSystem returns a context acting for every tenant, for the background
+// processes that are not scoped to one
+func WithSystem(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemKey{}, true)
+}
+
+// IsSystem reports whether a context acts for every tenant
+func IsSystem(ctx context.Context) bool {
+	system, _ := ctx.Value(systemKey{}).(bool)
+	return system
+}
+
+// Middleware sets the tenant of API requests, resolved from the API key
+// sent in header through keys. Callers cannot pick another tenant than the
+// one of their key. API requests without the key of a tenant are rejected;
+// requests outside the API, such as health checks, and API requests under
+// the public path prefixes, authenticated otherwise like signed webhook
+// triggers, carry no tenant.
+func Middleware(header string, keys map[string]string, public ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.Request.URL.Path, "/api/") || isPublic(c.Request.URL.Path, public) {
+			c.Next()
+			return
+		}
+
+		tenant := keys[c.GetHeader(header)]
+		if tenant == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unknown tenant"})
+			return
+		}
+		c.Request = c.Request.WithContext(WithTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
+
+func isPublic(path string, public []string) bool {
+	for _, prefix := range public {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
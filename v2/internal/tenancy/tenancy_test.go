@@ -0,0 +1,58 @@
+package tenancy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Middleware("X-API-Key", map[string]string{"pk_payments": "payments", "pk_shipping": "shipping"}, "/api/v1/triggers/"))
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, FromContext(c.Request.Context()))
+	}
+	router.GET("/api/v1/workflows", handler)
+	router.GET("/health", handler)
+	router.GET("/api/v1/triggers/webhooks/github", handler)
+
+	request := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("/api/v1/workflows", "pk_shipping")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "shipping", rec.Body.String(), "the tenant is resolved from the API key")
+
+	assert.Equal(t, http.StatusUnauthorized, request("/api/v1/workflows", "pk_unknown").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("/api/v1/workflows", "").Code)
+
+	rec = request("/health", "")
+	assert.Equal(t, http.StatusOK, rec.Code, "requests outside the API carry no tenant")
+	assert.Empty(t, rec.Body.String())
+
+	rec = request("/api/v1/triggers/webhooks/github", "")
+	assert.Equal(t, http.StatusOK, rec.Code, "requests under public prefixes pass without a key")
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, FromContext(ctx))
+	assert.False(t, IsSystem(ctx))
+
+	assert.Equal(t, "payments", FromContext(WithTenant(ctx, "payments")))
+	assert.True(t, IsSystem(WithSystem(ctx)))
+}
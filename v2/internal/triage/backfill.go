@@ -0,0 +1,52 @@
+package triage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// BackfillProcessor classifies the failed executions of a backfill, such
+// as the failures that ended before triage was enabled or before rules
+// changed. It implements backfill.Processor.
+type BackfillProcessor struct {
+	classifier *Classifier
+}
+
+// NewBackfillProcessor creates the triage processor of backfills
+func NewBackfillProcessor(classifier *Classifier) *BackfillProcessor {
+	return &BackfillProcessor{classifier: classifier}
+}
+
+// Name returns the name backfills select the processor by
+func (p *BackfillProcessor) Name() string {
+	return "triage"
+}
+
+// Process classifies a failed execution and stores its class. Executions
+// that did not fail, or whose class is unchanged, are skipped, so
+// processing an execution again does nothing.
+func (p *BackfillProcessor) Process(ctx context.Context, execution *models.Execution) (bool, error) {
+	if execution.Status != models.ExecutionStatusFailed {
+		return false, nil
+	}
+	if p.classifier.sources.Executions == nil {
+		return false, errors.New("no execution store configured")
+	}
+
+	triage, err := p.classifier.Classify(ctx, &Failure{Execution: execution})
+	if err != nil {
+		return false, err
+	}
+	if sameTriage(execution.Triage, triage) {
+		return false, nil
+	}
+	execution.Triage = triage
+	execution.TriageClass = triage.Class
+	if err := p.classifier.sources.Executions.Update(execution); err != nil {
+		return false, fmt.Errorf("failed to update execution: %w", err)
+	}
+	return true, nil
+}
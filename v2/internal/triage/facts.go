@@ -0,0 +1,200 @@
+package triage
+
+import (
+	"fmt"
+	"time"
+
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// Failure is a failed execution to classify
+type Failure struct {
+	Execution *models.Execution
+	// Workflow is the workflow of the execution, loaded from the workflow
+	// store when nil
+	Workflow *models.Workflow
+	// Step is the step whose failure failed the execution, the last failed
+	// step of the execution when nil
+	Step *models.StepExecution
+}
+
+// failedStep returns the step that failed an execution: the failed step
+// that completed last
+func failedStep(execution *models.Execution) *models.StepExecution {
+	var failed *models.StepExecution
+	for i := range execution.Steps {
+		step := &execution.Steps[i]
+		if step.Status != models.StepStatusFailed {
+			continue
+		}
+		if failed == nil || completedAt(step).After(completedAt(failed)) {
+			failed = step
+		}
+	}
+	return failed
+}
+
+func completedAt(step *models.StepExecution) time.Time {
+	if step.CompletedAt != nil {
+		return *step.CompletedAt
+	}
+	return time.Time{}
+}
+
+// failedAt returns when an execution failed, the time recent failures are
+// counted back from
+func failedAt(execution *models.Execution, now time.Time) time.Time {
+	if execution.CompletedAt != nil {
+		return *execution.CompletedAt
+	}
+	return now
+}
+
+// statusCode returns the HTTP status code recorded in the output of a step,
+// or nil when the step recorded none
+func statusCode(step *models.StepExecution) interface{} {
+	if step == nil {
+		return nil
+	}
+	switch code := step.OutputData["status_code"].(type) {
+	case int:
+		return float64(code)
+	case int64:
+		return float64(code)
+	case float64:
+		return code
+	default:
+		return nil
+	}
+}
+
+// signature identifies the failures of one step failing the same way
+func signature(execution *models.Execution, step *models.StepExecution) string {
+	if step == nil {
+		return "|" + execution.ErrorCode
+	}
+	return fmt.Sprintf("%s|%s|%v", step.StepName, step.ErrorCode, statusCode(step))
+}
+
+// facts builds the document rules are evaluated against:
+//
+//	execution  id, status, error, error_code, trigger_type
+//	workflow   id, name, version, labels
+//	namespace  the namespace label of the workflow
+//	step       name, type, error, error_code, status_code (null without an
+//	           HTTP response), attempt, max_attempts, retries_exhausted
+//	breaker_open  whether the circuit breaker of the step type is open
+//	recent     executions, failures, failure_rate (null without executions)
+//	           and same_failure, the other failures of the same step with
+//	           the same error code and status, within the recent window
+//	           before the failure
+func (c *Classifier) facts(failure *Failure) (map[string]interface{}, error) {
+	execution := failure.Execution
+	workflow := failure.Workflow
+	step := failure.Step
+	if step == nil {
+		step = failedStep(execution)
+	}
+
+	document := map[string]interface{}{
+		"execution": map[string]interface{}{
+			"id":           execution.ID.String(),
+			"status":       string(execution.Status),
+			"error":        execution.Error,
+			"error_code":   execution.ErrorCode,
+			"trigger_type": string(execution.TriggerType),
+		},
+		"namespace":    policies.Namespace(workflow.Definition),
+		"breaker_open": false,
+	}
+
+	labels := make(map[string]interface{}, len(workflow.Definition.Metadata.Labels))
+	for key, value := range workflow.Definition.Metadata.Labels {
+		labels[key] = value
+	}
+	document["workflow"] = map[string]interface{}{
+		"id":      workflow.ID.String(),
+		"name":    workflow.Name,
+		"version": workflow.Version,
+		"labels":  labels,
+	}
+
+	stepFacts := map[string]interface{}{
+		"name":              "",
+		"type":              "",
+		"error":             "",
+		"error_code":        "",
+		"status_code":       nil,
+		"attempt":           float64(0),
+		"max_attempts":      float64(0),
+		"retries_exhausted": false,
+	}
+	if step != nil {
+		stepFacts["name"] = step.StepName
+		stepFacts["type"] = step.StepType
+		stepFacts["error"] = step.Error
+		stepFacts["error_code"] = step.ErrorCode
+		stepFacts["status_code"] = statusCode(step)
+		stepFacts["attempt"] = float64(step.Attempt)
+		stepFacts["max_attempts"] = float64(step.MaxAttempts)
+		stepFacts["retries_exhausted"] = step.MaxAttempts > 1 && step.Attempt >= step.MaxAttempts
+		if c.sources.Breakers != nil {
+			document["breaker_open"] = c.sources.Breakers.IsOpen(step.StepType)
+		}
+	}
+	document["step"] = stepFacts
+
+	recent, err := c.recent(execution, step)
+	if err != nil {
+		return nil, err
+	}
+	document["recent"] = recent
+	return document, nil
+}
+
+// recent describes the recent failures of the workflow of an execution,
+// within the recent window before the execution failed
+func (c *Classifier) recent(execution *models.Execution, step *models.StepExecution) (map[string]interface{}, error) {
+	recent := map[string]interface{}{
+		"executions":   float64(0),
+		"failures":     float64(0),
+		"failure_rate": nil,
+		"same_failure": float64(0),
+	}
+	to := failedAt(execution, c.now())
+	from := to.Add(-c.config.RecentWindow)
+
+	if c.sources.Stats != nil {
+		stats, err := c.sources.Stats.GetExecutionStats(&execution.WorkflowID, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load recent executions: %w", err)
+		}
+		total, failures := stats["total"], stats[string(models.ExecutionStatusFailed)]
+		recent["executions"] = float64(total)
+		recent["failures"] = float64(failures)
+		if total > 0 {
+			recent["failure_rate"] = float64(failures) / float64(total)
+		}
+	}
+
+	if c.sources.Executions != nil {
+		failures, _, err := c.sources.Executions.List(&execution.WorkflowID, c.config.RecentLimit, 0, string(models.ExecutionStatusFailed))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load recent failures: %w", err)
+		}
+		same := signature(execution, step)
+		count := 0
+		for _, other := range failures {
+			at := failedAt(other, to)
+			if other.ID == execution.ID || at.Before(from) || at.After(to) {
+				continue
+			}
+			if signature(other, failedStep(other)) == same {
+				count++
+			}
+		}
+		recent["same_failure"] = float64(count)
+	}
+	return recent, nil
+}
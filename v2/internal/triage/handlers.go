@@ -0,0 +1,145 @@
+package triage
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Handlers provides HTTP handlers for triage rules
+type Handlers struct {
+	classifier *Classifier
+}
+
+// NewHandlers creates new triage handlers
+func NewHandlers(classifier *Classifier) *Handlers {
+	return &Handlers{classifier: classifier}
+}
+
+// RegisterRoutes registers triage routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		triage := v1.Group("/triage")
+		{
+			triage.GET("/rules/:namespace", h.GetRules)
+			triage.PUT("/rules/:namespace", h.SetRules)
+			triage.POST("/dry-run", h.DryRun)
+			triage.POST("/reclassify", h.Reclassify)
+		}
+	}
+}
+
+// SetRulesRequest is the request body replacing the rules of a namespace
+type SetRulesRequest struct {
+	Rules []Rule `json:"rules"`
+}
+
+// DryRunRequest is the request body of a dry run. Rules, when set, replace
+// the rules of the namespace of the execution.
+type DryRunRequest struct {
+	ExecutionID uuid.UUID `json:"execution_id" binding:"required"`
+	Rules       []Rule    `json:"rules,omitempty"`
+}
+
+// GetRules returns the rules evaluated for a namespace, its own rules
+// followed by the default ones
+// @Summary Get the triage rules of a namespace
+// @Tags triage
+// @Produce json
+// @Param namespace path string true "Namespace"
+// @Success 200 {array} Rule
+// @Router /api/v1/triage/rules/{namespace} [get]
+func (h *Handlers) GetRules(c *gin.Context) {
+	c.JSON(http.StatusOK, h.classifier.Rules(c.Param("namespace")))
+}
+
+// SetRules replaces the rules of a namespace. Past failures keep their class
+// until reclassified.
+// @Summary Replace the triage rules of a namespace
+// @Tags triage
+// @Accept json
+// @Produce json
+// @Param namespace path string true "Namespace"
+// @Param request body SetRulesRequest true "Rules"
+// @Success 200 {array} Rule
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/triage/rules/{namespace} [put]
+func (h *Handlers) SetRules(c *gin.Context) {
+	var req SetRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	namespace := c.Param("namespace")
+	if err := h.classifier.SetRules(namespace, req.Rules); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, h.classifier.Rules(namespace))
+}
+
+// DryRun classifies a past failed execution without storing its class
+// @Summary Dry-run triage rules against a past execution
+// @Description Classifies a failed execution with the current rules of its namespace, or with candidate rules, and returns the facts and the rules evaluated
+// @Tags triage
+// @Accept json
+// @Produce json
+// @Param request body DryRunRequest true "Execution and candidate rules"
+// @Success 200 {object} Classification
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/triage/dry-run [post]
+func (h *Handlers) DryRun(c *gin.Context) {
+	var req DryRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	classification, err := h.classifier.DryRun(c.Request.Context(), req.ExecutionID, req.Rules)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, classification)
+}
+
+// Reclassify classifies recent failures again with the current rules
+// @Summary Reclassify recent failures
+// @Tags triage
+// @Accept json
+// @Produce json
+// @Param request body ReclassifyRequest false "Failures to reclassify"
+// @Success 200 {object} ReclassifyReport
+// @Router /api/v1/triage/reclassify [post]
+func (h *Handlers) Reclassify(c *gin.Context) {
+	var req ReclassifyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	report, err := h.classifier.Reclassify(c.Request.Context(), req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRule), errors.Is(err, ErrNotFailed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
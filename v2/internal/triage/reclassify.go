@@ -0,0 +1,108 @@
+package triage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// ReclassifyRequest selects the recent failures to reclassify
+type ReclassifyRequest struct {
+	// Namespace limits reclassification to the workflows of a namespace,
+	// empty for every namespace
+	Namespace string `json:"namespace,omitempty"`
+	// WorkflowID limits reclassification to one workflow
+	WorkflowID *uuid.UUID `json:"workflow_id,omitempty"`
+	// Limit caps the number of failures reclassified, the most recent first
+	Limit int `json:"limit,omitempty"`
+}
+
+// Reclassification is the class change of one execution
+type Reclassification struct {
+	ExecutionID uuid.UUID      `json:"execution_id"`
+	From        string         `json:"from"`
+	To          *models.Triage `json:"to"`
+}
+
+// ReclassifyReport lists the failures whose class changed
+type ReclassifyReport struct {
+	Scanned int                `json:"scanned"`
+	Changed []Reclassification `json:"changed"`
+	// Classes counts the scanned failures by their new class
+	Classes map[string]int `json:"classes"`
+}
+
+// DefaultReclassifyLimit is the number of failures reclassified by
+// requests without a limit
+const DefaultReclassifyLimit = 500
+
+// Reclassify classifies recent failures again with the current rules,
+// after rules changed. Executions whose class, rule or confidence changed
+// are updated; the others keep their classification time.
+func (c *Classifier) Reclassify(ctx context.Context, request ReclassifyRequest) (*ReclassifyReport, error) {
+	if c.sources.Executions == nil {
+		return nil, errors.New("no execution store configured")
+	}
+	limit := request.Limit
+	if limit <= 0 {
+		limit = DefaultReclassifyLimit
+	}
+	failures, _, err := c.sources.Executions.List(request.WorkflowID, limit, 0, string(models.ExecutionStatusFailed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load failed executions: %w", err)
+	}
+
+	report := &ReclassifyReport{Changed: []Reclassification{}, Classes: make(map[string]int)}
+	workflows := make(map[uuid.UUID]*models.Workflow)
+	for _, execution := range failures {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		workflow, ok := workflows[execution.WorkflowID]
+		if !ok {
+			if c.sources.Workflows == nil {
+				return nil, errors.New("no workflow store configured")
+			}
+			if workflow, err = c.sources.Workflows.GetByID(execution.WorkflowID); err != nil {
+				return report, fmt.Errorf("failed to load workflow %s: %w", execution.WorkflowID, err)
+			}
+			workflows[execution.WorkflowID] = workflow
+		}
+		if request.Namespace != "" && policies.Namespace(workflow.Definition) != request.Namespace {
+			continue
+		}
+
+		triage, err := c.Classify(ctx, &Failure{Execution: execution, Workflow: workflow})
+		if err != nil {
+			return report, fmt.Errorf("failed to classify execution %s: %w", execution.ID, err)
+		}
+		report.Scanned++
+		report.Classes[triage.Class]++
+		if sameTriage(execution.Triage, triage) {
+			continue
+		}
+
+		from := execution.TriageClass
+		execution.Triage = triage
+		execution.TriageClass = triage.Class
+		if err := c.sources.Executions.Update(execution); err != nil {
+			return report, fmt.Errorf("failed to update execution %s: %w", execution.ID, err)
+		}
+		report.Changed = append(report.Changed, Reclassification{ExecutionID: execution.ID, From: from, To: triage})
+	}
+	return report, nil
+}
+
+// sameTriage reports whether two classifications differ only by their time
+func sameTriage(a, b *models.Triage) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Class == b.Class && a.Rule == b.Rule && a.Confidence == b.Confidence && a.Action == b.Action
+}
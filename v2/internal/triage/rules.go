@@ -0,0 +1,178 @@
+package triage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"magic-flow/v2/internal/expressions"
+)
+
+// Triage classes of the default rules. Namespaces may define their own.
+const (
+	// ClassDownstream5xx is a failure of a service a step called
+	ClassDownstream5xx = "downstream_5xx"
+	// ClassBadInput is a failure caused by the input of the execution
+	ClassBadInput = "bad_input"
+	// ClassOurBug is a failure of the workflow or of the engine itself
+	ClassOurBug = "our_bug"
+	// ClassKnownFlake is a rare failure that recurs and goes away by itself
+	ClassKnownFlake = "known_flake"
+	// ClassUnclassified is the class of failures no rule matched
+	ClassUnclassified = "unclassified"
+)
+
+// ErrInvalidRule is returned for rules that cannot be registered
+var ErrInvalidRule = errors.New("invalid triage rule")
+
+// Rule assigns a triage class to the failures matching its condition.
+// Rules are evaluated by decreasing priority, and the first matching rule
+// classifies the failure.
+type Rule struct {
+	Name string `json:"name"`
+	// Class is the triage class assigned to matching failures
+	Class string `json:"class"`
+	// When is the condition expression, evaluated against the facts of
+	// the failure
+	When string `json:"when"`
+	// Confidence is the confidence of the classification before boosts,
+	// between 0 and 1
+	Confidence float64 `json:"confidence"`
+	// Boosts raise the confidence when their condition holds as well
+	Boosts []Boost `json:"boosts,omitempty"`
+	// Action is the action suggested to on-call
+	Action string `json:"action,omitempty"`
+	// Priority orders the rules of a namespace, higher first. Rules of the
+	// same priority keep their order.
+	Priority int `json:"priority,omitempty"`
+}
+
+// Boost adds Weight to the confidence of a matching rule when its
+// condition holds
+type Boost struct {
+	When   string  `json:"when"`
+	Weight float64 `json:"weight"`
+}
+
+// compiledRule is a rule with its parsed conditions
+type compiledRule struct {
+	Rule
+	condition *expressions.Expression
+	boosts    []*expressions.Expression
+}
+
+// compileRules validates rules and returns them by decreasing priority.
+// The error wraps ErrInvalidRule and lists every problem.
+func compileRules(rules []Rule) ([]compiledRule, error) {
+	var problems []string
+	names := make(map[string]bool)
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		label := fmt.Sprintf("rule %d", i+1)
+		if strings.TrimSpace(rule.Name) == "" {
+			problems = append(problems, label+": name is required")
+		} else if names[rule.Name] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate name %q", label, rule.Name))
+		}
+		names[rule.Name] = true
+		if strings.TrimSpace(rule.Class) == "" {
+			problems = append(problems, label+": class is required")
+		}
+		if rule.Confidence < 0 || rule.Confidence > 1 {
+			problems = append(problems, label+": confidence must be between 0 and 1")
+		}
+
+		condition, err := expressions.Parse(rule.When)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid condition: %v", label, err))
+		}
+		compiledRule := compiledRule{Rule: rule, condition: condition}
+		for j, boost := range rule.Boosts {
+			if boost.Weight < -1 || boost.Weight > 1 {
+				problems = append(problems, fmt.Sprintf("%s: boost %d: weight must be between -1 and 1", label, j+1))
+			}
+			boostCondition, err := expressions.Parse(boost.When)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: boost %d: invalid condition: %v", label, j+1, err))
+			}
+			compiledRule.boosts = append(compiledRule.boosts, boostCondition)
+		}
+		compiled = append(compiled, compiledRule)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRule, strings.Join(problems, "; "))
+	}
+	sort.SliceStable(compiled, func(i, j int) bool {
+		return compiled[i].Priority > compiled[j].Priority
+	})
+	return compiled, nil
+}
+
+// ValidateRules checks rules, compiling their conditions
+func ValidateRules(rules []Rule) error {
+	_, err := compileRules(rules)
+	return err
+}
+
+// DefaultRules returns the rules applying to every namespace, after the
+// rules of the namespace
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:       "circuit-breaker-open",
+			Class:      ClassDownstream5xx,
+			When:       "breaker_open",
+			Confidence: 0.9,
+			Action:     "The circuit breaker of the failed step type is open: check the health of the service it calls and re-run the execution once the breaker closes",
+			Priority:   100,
+		},
+		{
+			Name:       "recurring-rare-failure",
+			Class:      ClassKnownFlake,
+			When:       "recent.same_failure >= 2 && recent.failure_rate <= 0.05",
+			Confidence: 0.6,
+			Boosts: []Boost{
+				{When: "step.status_code in [408, 429, 502, 503, 504]", Weight: 0.2},
+				{When: "!step.retries_exhausted", Weight: 0.1},
+			},
+			Action:   "Known intermittent failure: re-run the execution, and raise the retries of the step if it keeps recurring",
+			Priority: 80,
+		},
+		{
+			Name:       "downstream-server-error",
+			Class:      ClassDownstream5xx,
+			When:       "step.status_code >= 500",
+			Confidence: 0.7,
+			Boosts: []Boost{
+				{When: "step.retries_exhausted", Weight: 0.1},
+				{When: "recent.same_failure >= 3", Weight: 0.1},
+			},
+			Action:   "The service called by the failed step answered with a server error: check its health and re-run the execution once it recovers",
+			Priority: 60,
+		},
+		{
+			Name:       "rejected-input",
+			Class:      ClassBadInput,
+			When:       `(step.status_code >= 400 && step.status_code < 500 && !(step.status_code in [408, 429])) || execution.error_code in ["VALIDATION_ERROR", "INVALID_INPUT"]`,
+			Confidence: 0.6,
+			Boosts: []Boost{
+				{When: "recent.failure_rate < 0.2", Weight: 0.2},
+			},
+			Action:   "The input was rejected: fix the input of the execution, or the mapping feeding the failed step, and re-run it",
+			Priority: 50,
+		},
+		{
+			Name:       "workflow-code-error",
+			Class:      ClassOurBug,
+			When:       `step.type in ["script", "transform", "condition"] || starts_with(step.error_code, "SCRIPT_") || step.error_code == "STEP_RESOURCE_LIMIT"`,
+			Confidence: 0.6,
+			Boosts: []Boost{
+				{When: "recent.same_failure >= 3", Weight: 0.2},
+			},
+			Action:   "The workflow itself failed: check the failed step and the version it runs, and roll back if the version is new",
+			Priority: 10,
+		},
+	}
+}
@@ -0,0 +1,289 @@
+// Package triage classifies failed executions, so on-call knows at a glance
+// whether a failure is a downstream outage, bad input, a bug of the
+// workflow or a known flake. Rules are expressions of the shared
+// expression language evaluated against the facts of a failure: its error
+// codes, the step that failed and its HTTP status, the retry and circuit
+// breaker state, and the recent failures of the same workflow. Each
+// namespace may define rules evaluated before the default ones.
+package triage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrNotFailed is returned when classifying an execution that did not fail
+var ErrNotFailed = errors.New("execution did not fail")
+
+// Config configures classification
+type Config struct {
+	// RecentWindow is how far back the recent failures of a workflow are
+	// counted, before the failure being classified
+	RecentWindow time.Duration
+	// RecentLimit caps the number of recent failures compared with the
+	// failure being classified
+	RecentLimit int
+	// Timeout bounds the evaluation of the rules of one failure
+	Timeout time.Duration
+}
+
+// DefaultConfig returns the default classification config
+func DefaultConfig() Config {
+	return Config{
+		RecentWindow: time.Hour,
+		RecentLimit:  100,
+		Timeout:      100 * time.Millisecond,
+	}
+}
+
+// ExecutionStore reads and updates executions. It is implemented by
+// database.ExecutionRepository.
+type ExecutionStore interface {
+	GetByID(id uuid.UUID) (*models.Execution, error)
+	// List returns executions with their steps, the most recent first
+	List(workflowID *uuid.UUID, limit, offset int, status string) ([]*models.Execution, int64, error)
+	Update(execution *models.Execution) error
+}
+
+// StatsStore counts the executions of a workflow by status. It is
+// implemented by database.ExecutionRepository.
+type StatsStore interface {
+	GetExecutionStats(workflowID *uuid.UUID, from, to time.Time) (map[string]int64, error)
+}
+
+// WorkflowStore reads workflows. It is implemented by
+// database.WorkflowRepository.
+type WorkflowStore interface {
+	GetByID(id uuid.UUID) (*models.Workflow, error)
+}
+
+// CircuitBreakers reports the circuit breakers guarding step types
+type CircuitBreakers interface {
+	IsOpen(stepType string) bool
+}
+
+// Sources are the components facts are read from. Facts whose source is
+// nil keep their zero value.
+type Sources struct {
+	Executions ExecutionStore
+	Stats      StatsStore
+	Workflows  WorkflowStore
+	Breakers   CircuitBreakers
+}
+
+// Classification is the result of classifying a failure
+type Classification struct {
+	Triage *models.Triage `json:"triage"`
+	// Namespace is the namespace whose rules were evaluated
+	Namespace string `json:"namespace"`
+	// Facts is the document the rules were evaluated against
+	Facts map[string]interface{} `json:"facts"`
+	// Evaluated lists the rules evaluated, in order, up to the matching one
+	Evaluated []RuleResult `json:"evaluated"`
+}
+
+// RuleResult is the outcome of one rule
+type RuleResult struct {
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Classifier assigns triage classes to failed executions
+type Classifier struct {
+	config  Config
+	sources Sources
+	now     func() time.Time
+
+	mu sync.RWMutex
+	// defaults apply to every namespace, after the rules of the namespace
+	defaults   []compiledRule
+	namespaces map[string][]compiledRule
+}
+
+// NewClassifier creates a classifier with the default rules
+func NewClassifier(config Config, sources Sources) *Classifier {
+	defaults, err := compileRules(DefaultRules())
+	if err != nil {
+		panic(err)
+	}
+	return &Classifier{
+		config:     config,
+		sources:    sources,
+		now:        time.Now,
+		defaults:   defaults,
+		namespaces: make(map[string][]compiledRule),
+	}
+}
+
+// SetDefaultRules replaces the rules applying to every namespace
+func (c *Classifier) SetDefaultRules(rules []Rule) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaults = compiled
+	return nil
+}
+
+// SetRules replaces the rules of a namespace. Rules set before are no
+// longer evaluated; executions they classified keep their class until
+// reclassified.
+func (c *Classifier) SetRules(namespace string, rules []Rule) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(compiled) == 0 {
+		delete(c.namespaces, namespace)
+		return nil
+	}
+	c.namespaces[namespace] = compiled
+	return nil
+}
+
+// Rules returns the rules of a namespace followed by the default rules, in
+// the order they are evaluated
+func (c *Classifier) Rules(namespace string) []Rule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	compiled := c.rulesLocked(namespace)
+	rules := make([]Rule, len(compiled))
+	for i, rule := range compiled {
+		rules[i] = rule.Rule
+	}
+	return rules
+}
+
+func (c *Classifier) rulesLocked(namespace string) []compiledRule {
+	rules := make([]compiledRule, 0, len(c.namespaces[namespace])+len(c.defaults))
+	rules = append(rules, c.namespaces[namespace]...)
+	return append(rules, c.defaults...)
+}
+
+// Classify classifies a failed execution with the rules of the namespace
+// of its workflow
+func (c *Classifier) Classify(ctx context.Context, failure *Failure) (*models.Triage, error) {
+	classification, err := c.classify(ctx, failure, nil)
+	if err != nil {
+		return nil, err
+	}
+	return classification.Triage, nil
+}
+
+// DryRun classifies a past failed execution without storing its class.
+// Candidate rules, when given, replace the rules of the namespace of the
+// execution, so rule changes can be tested before they are made.
+func (c *Classifier) DryRun(ctx context.Context, executionID uuid.UUID, candidate []Rule) (*Classification, error) {
+	if c.sources.Executions == nil {
+		return nil, errors.New("no execution store configured")
+	}
+	execution, err := c.sources.Executions.GetByID(executionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load execution: %w", err)
+	}
+
+	var rules []compiledRule
+	if candidate != nil {
+		compiled, err := compileRules(candidate)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.RLock()
+		rules = append(compiled, c.defaults...)
+		c.mu.RUnlock()
+	}
+	return c.classify(ctx, &Failure{Execution: execution}, rules)
+}
+
+// classify evaluates rules against the facts of a failure, the rules of
+// the namespace of its workflow when rules is nil. The first matching rule
+// classifies the failure; rules that cannot be evaluated are skipped.
+func (c *Classifier) classify(ctx context.Context, failure *Failure, rules []compiledRule) (*Classification, error) {
+	if failure.Execution.Status != models.ExecutionStatusFailed {
+		return nil, ErrNotFailed
+	}
+	if failure.Workflow == nil {
+		if c.sources.Workflows == nil {
+			return nil, errors.New("no workflow store configured")
+		}
+		workflow, err := c.sources.Workflows.GetByID(failure.Execution.WorkflowID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load workflow: %w", err)
+		}
+		failure = &Failure{Execution: failure.Execution, Workflow: workflow, Step: failure.Step}
+	}
+
+	facts, err := c.facts(failure)
+	if err != nil {
+		return nil, err
+	}
+	namespace := policies.Namespace(failure.Workflow.Definition)
+	if rules == nil {
+		c.mu.RLock()
+		rules = c.rulesLocked(namespace)
+		c.mu.RUnlock()
+	}
+
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+
+	now := c.now().UTC()
+	env := &expressions.Env{Now: now}
+	classification := &Classification{
+		Triage:    &models.Triage{Class: ClassUnclassified, ClassifiedAt: now},
+		Namespace: namespace,
+		Facts:     facts,
+		Evaluated: []RuleResult{},
+	}
+	for _, rule := range rules {
+		matched, err := rule.condition.EvalBool(ctx, env, facts)
+		result := RuleResult{Rule: rule.Name, Matched: matched}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		classification.Evaluated = append(classification.Evaluated, result)
+		if !matched {
+			continue
+		}
+
+		classification.Triage = &models.Triage{
+			Class:        rule.Class,
+			Confidence:   confidence(ctx, env, rule, facts),
+			Rule:         rule.Name,
+			Action:       rule.Action,
+			ClassifiedAt: now,
+		}
+		break
+	}
+	return classification, nil
+}
+
+// confidence returns the confidence of a matching rule plus the weights of
+// its boosts whose condition holds, between 0 and 1
+func confidence(ctx context.Context, env *expressions.Env, rule compiledRule, facts map[string]interface{}) float64 {
+	score := rule.Confidence
+	for i, boost := range rule.boosts {
+		if holds, err := boost.EvalBool(ctx, env, facts); err == nil && holds {
+			score += rule.Boosts[i].Weight
+		}
+	}
+	return math.Round(math.Max(0, math.Min(1, score))*100) / 100
+}
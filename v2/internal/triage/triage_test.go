@@ -0,0 +1,358 @@
+package triage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"magic-flow/v2/pkg/models"
+)
+
+var now = time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+type fakeExecutions struct {
+	executions map[uuid.UUID]*models.Execution
+	updates    int
+}
+
+func (f *fakeExecutions) GetByID(id uuid.UUID) (*models.Execution, error) {
+	execution, ok := f.executions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return execution, nil
+}
+
+func (f *fakeExecutions) List(workflowID *uuid.UUID, limit, offset int, status string) ([]*models.Execution, int64, error) {
+	var executions []*models.Execution
+	for _, execution := range f.executions {
+		if (workflowID == nil || execution.WorkflowID == *workflowID) && (status == "" || string(execution.Status) == status) {
+			executions = append(executions, execution)
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool { return executions[i].CompletedAt.After(*executions[j].CompletedAt) })
+	if len(executions) > limit {
+		executions = executions[:limit]
+	}
+	return executions, int64(len(executions)), nil
+}
+
+func (f *fakeExecutions) Update(execution *models.Execution) error {
+	f.updates++
+	f.executions[execution.ID] = execution
+	return nil
+}
+
+type fakeStats map[string]int64
+
+func (f fakeStats) GetExecutionStats(workflowID *uuid.UUID, from, to time.Time) (map[string]int64, error) {
+	return f, nil
+}
+
+type fakeWorkflows map[uuid.UUID]*models.Workflow
+
+func (f fakeWorkflows) GetByID(id uuid.UUID) (*models.Workflow, error) {
+	if workflow, ok := f[id]; ok {
+		return workflow, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type fakeBreakers map[string]bool
+
+func (f fakeBreakers) IsOpen(stepType string) bool {
+	return f[stepType]
+}
+
+func newWorkflow(namespace string) *models.Workflow {
+	workflow := &models.Workflow{ID: uuid.New(), Name: "orders", Version: "1.0.0"}
+	workflow.Definition.Metadata.Labels = map[string]string{"namespace": namespace}
+	return workflow
+}
+
+// newFailure returns an execution of workflow failed ago before now by a
+// step of stepType answered with status, when not zero
+func newFailure(workflow *models.Workflow, ago time.Duration, stepType string, status int) *models.Execution {
+	failedAt := now.Add(-ago)
+	step := models.StepExecution{
+		StepName:    "charge",
+		StepType:    stepType,
+		Status:      models.StepStatusFailed,
+		Error:       "charge failed",
+		Attempt:     3,
+		MaxAttempts: 3,
+		CompletedAt: &failedAt,
+	}
+	if status != 0 {
+		step.OutputData = map[string]interface{}{"status_code": status}
+	}
+	return &models.Execution{
+		ID:          uuid.New(),
+		WorkflowID:  workflow.ID,
+		Status:      models.ExecutionStatusFailed,
+		Error:       "step charge failed",
+		CompletedAt: &failedAt,
+		Steps:       []models.StepExecution{step},
+	}
+}
+
+func newClassifier(sources Sources) *Classifier {
+	classifier := NewClassifier(DefaultConfig(), sources)
+	classifier.now = func() time.Time { return now }
+	return classifier
+}
+
+func TestClassifyPrecedence(t *testing.T) {
+	workflow := newWorkflow("payments")
+	classify := func(t *testing.T, classifier *Classifier, execution *models.Execution) *models.Triage {
+		triage, err := classifier.Classify(context.Background(), &Failure{Execution: execution, Workflow: workflow})
+		require.NoError(t, err)
+		return triage
+	}
+
+	t.Run("default rules by priority", func(t *testing.T) {
+		breakers := fakeBreakers{}
+		classifier := newClassifier(Sources{Breakers: breakers})
+		execution := newFailure(workflow, time.Minute, "http", 503)
+
+		triage := classify(t, classifier, execution)
+		assert.Equal(t, ClassDownstream5xx, triage.Class)
+		assert.Equal(t, "downstream-server-error", triage.Rule)
+		assert.NotEmpty(t, triage.Action)
+		assert.Equal(t, now, triage.ClassifiedAt)
+
+		breakers["http"] = true
+		assert.Equal(t, "circuit-breaker-open", classify(t, classifier, execution).Rule)
+		breakers["http"] = false
+
+		assert.Equal(t, ClassBadInput, classify(t, classifier, newFailure(workflow, time.Minute, "http", 422)).Class)
+		assert.Equal(t, ClassOurBug, classify(t, classifier, newFailure(workflow, time.Minute, "script", 0)).Class)
+	})
+
+	t.Run("unmatched failures are unclassified", func(t *testing.T) {
+		triage := classify(t, newClassifier(Sources{}), newFailure(workflow, time.Minute, "email", 0))
+		assert.Equal(t, &models.Triage{Class: ClassUnclassified, ClassifiedAt: now}, triage)
+	})
+
+	t.Run("namespace rules before default rules", func(t *testing.T) {
+		classifier := newClassifier(Sources{})
+		require.NoError(t, classifier.SetRules("payments", []Rule{
+			{Name: "psp-outage", Class: "psp_outage", When: `step.name == "charge"`, Confidence: 0.5, Priority: 1},
+			{Name: "psp-maintenance", Class: "psp_maintenance", When: "step.status_code == 503", Confidence: 0.5, Priority: 5},
+			{Name: "psp-unavailable", Class: "psp_unavailable", When: "step.status_code == 503", Confidence: 0.5, Priority: 5},
+		}))
+
+		assert.Equal(t, "psp-maintenance", classify(t, classifier, newFailure(workflow, time.Minute, "http", 503)).Rule)
+		assert.Equal(t, "psp-outage", classify(t, classifier, newFailure(workflow, time.Minute, "http", 500)).Rule)
+
+		other := newWorkflow("shipping")
+		triage, err := classifier.Classify(context.Background(), &Failure{Execution: newFailure(other, time.Minute, "http", 503), Workflow: other})
+		require.NoError(t, err)
+		assert.Equal(t, "downstream-server-error", triage.Rule)
+
+		names := make([]string, 0)
+		for _, rule := range classifier.Rules("payments") {
+			names = append(names, rule.Name)
+		}
+		assert.Equal(t, []string{"psp-maintenance", "psp-unavailable", "psp-outage", "circuit-breaker-open"}, names[:4])
+	})
+
+	t.Run("rules that cannot be evaluated are skipped", func(t *testing.T) {
+		classifier := newClassifier(Sources{})
+		require.NoError(t, classifier.SetRules("payments", []Rule{
+			{Name: "broken", Class: "broken", When: `step.name > 5`, Confidence: 0.5},
+		}))
+		assert.Equal(t, "downstream-server-error", classify(t, classifier, newFailure(workflow, time.Minute, "http", 500)).Rule)
+	})
+
+	t.Run("only failed executions", func(t *testing.T) {
+		execution := newFailure(workflow, time.Minute, "http", 500)
+		execution.Status = models.ExecutionStatusCompleted
+		_, err := newClassifier(Sources{}).Classify(context.Background(), &Failure{Execution: execution, Workflow: workflow})
+		assert.ErrorIs(t, err, ErrNotFailed)
+	})
+}
+
+func TestClassifyConfidence(t *testing.T) {
+	workflow := newWorkflow("payments")
+	executions := &fakeExecutions{executions: make(map[uuid.UUID]*models.Execution)}
+	stats := fakeStats{"total": 100, "failed": 50}
+	classifier := newClassifier(Sources{Executions: executions, Stats: stats})
+	classify := func(execution *models.Execution) *models.Triage {
+		executions.executions[execution.ID] = execution
+		triage, err := classifier.Classify(context.Background(), &Failure{Execution: execution, Workflow: workflow})
+		require.NoError(t, err)
+		return triage
+	}
+
+	// Retries exhausted boost the 0.7 of downstream server errors
+	triage := classify(newFailure(workflow, time.Minute, "http", 500))
+	assert.Equal(t, "downstream-server-error", triage.Rule)
+	assert.Equal(t, 0.8, triage.Confidence)
+
+	// Three identical failures within the window boost it again, older
+	// ones and other statuses do not count
+	classify(newFailure(workflow, 2*time.Minute, "http", 500))
+	classify(newFailure(workflow, 2*time.Hour, "http", 500))
+	classify(newFailure(workflow, 4*time.Minute, "http", 502))
+	assert.Equal(t, 0.8, classify(newFailure(workflow, 30*time.Second, "http", 500)).Confidence)
+	classify(newFailure(workflow, 3*time.Minute, "http", 500))
+	assert.Equal(t, 0.9, classify(newFailure(workflow, 20*time.Second, "http", 500)).Confidence)
+
+	// The same failures are a known flake when the workflow rarely fails
+	stats["failed"] = 2
+	triage = classify(newFailure(workflow, 10*time.Second, "http", 503))
+	assert.Equal(t, ClassDownstream5xx, triage.Class)
+	flake := newFailure(workflow, 5*time.Second, "http", 500)
+	flake.Steps[0].Attempt = 1
+	triage = classify(flake)
+	assert.Equal(t, ClassKnownFlake, triage.Class)
+	assert.Equal(t, 0.7, triage.Confidence)
+
+	t.Run("clamped between 0 and 1", func(t *testing.T) {
+		require.NoError(t, classifier.SetRules("payments", []Rule{
+			{Name: "certain", Class: "certain", When: "true", Confidence: 0.9, Boosts: []Boost{
+				{When: "true", Weight: 0.5},
+				{When: "step.name > 1", Weight: 0.5},
+			}},
+		}))
+		assert.Equal(t, 1.0, classify(newFailure(workflow, time.Second, "http", 500)).Confidence)
+
+		require.NoError(t, classifier.SetRules("payments", []Rule{
+			{Name: "doubtful", Class: "doubtful", When: "true", Confidence: 0.2, Boosts: []Boost{{When: "true", Weight: -0.5}}},
+		}))
+		assert.Equal(t, 0.0, classify(newFailure(workflow, time.Second, "http", 500)).Confidence)
+	})
+}
+
+func TestReclassify(t *testing.T) {
+	payments, shipping := newWorkflow("payments"), newWorkflow("shipping")
+	executions := &fakeExecutions{executions: make(map[uuid.UUID]*models.Execution)}
+	classifier := newClassifier(Sources{
+		Executions: executions,
+		Workflows:  fakeWorkflows{payments.ID: payments, shipping.ID: shipping},
+	})
+
+	failures := []*models.Execution{
+		newFailure(payments, time.Minute, "http", 503),
+		newFailure(payments, 2*time.Minute, "http", 400),
+		newFailure(shipping, 3*time.Minute, "http", 503),
+	}
+	for _, execution := range failures {
+		executions.executions[execution.ID] = execution
+	}
+
+	report, err := classifier.Reclassify(context.Background(), ReclassifyRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Scanned)
+	assert.Len(t, report.Changed, 3)
+	assert.Equal(t, map[string]int{ClassDownstream5xx: 2, ClassBadInput: 1}, report.Classes)
+	assert.Equal(t, ClassDownstream5xx, failures[0].TriageClass)
+
+	t.Run("unchanged rules change nothing", func(t *testing.T) {
+		updates := executions.updates
+		report, err := classifier.Reclassify(context.Background(), ReclassifyRequest{})
+		require.NoError(t, err)
+		assert.Empty(t, report.Changed)
+		assert.Equal(t, updates, executions.updates)
+	})
+
+	t.Run("changed rules reclassify the failures of their namespace", func(t *testing.T) {
+		require.NoError(t, classifier.SetRules("payments", []Rule{
+			{Name: "psp-maintenance", Class: "psp_maintenance", When: "step.status_code == 503", Confidence: 0.9, Action: "Wait for the PSP maintenance to end"},
+		}))
+
+		report, err := classifier.Reclassify(context.Background(), ReclassifyRequest{Namespace: "payments"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Scanned)
+		require.Len(t, report.Changed, 1)
+		assert.Equal(t, failures[0].ID, report.Changed[0].ExecutionID)
+		assert.Equal(t, ClassDownstream5xx, report.Changed[0].From)
+		assert.Equal(t, "psp_maintenance", report.Changed[0].To.Class)
+
+		assert.Equal(t, "psp_maintenance", failures[0].TriageClass)
+		assert.Equal(t, "Wait for the PSP maintenance to end", failures[0].Triage.Action)
+		assert.Equal(t, ClassBadInput, failures[1].TriageClass)
+		assert.Equal(t, ClassDownstream5xx, failures[2].TriageClass)
+	})
+}
+
+func TestBackfillProcessor(t *testing.T) {
+	payments := newWorkflow("payments")
+	executions := &fakeExecutions{executions: make(map[uuid.UUID]*models.Execution)}
+	processor := NewBackfillProcessor(newClassifier(Sources{
+		Executions: executions,
+		Workflows:  fakeWorkflows{payments.ID: payments},
+	}))
+
+	failure := newFailure(payments, time.Minute, "http", 503)
+	processed, err := processor.Process(context.Background(), failure)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, ClassDownstream5xx, failure.TriageClass)
+	assert.Equal(t, 1, executions.updates)
+
+	processed, err = processor.Process(context.Background(), failure)
+	require.NoError(t, err)
+	assert.False(t, processed, "classified executions are skipped")
+
+	completed := &models.Execution{ID: uuid.New(), WorkflowID: payments.ID, Status: models.ExecutionStatusCompleted}
+	processed, err = processor.Process(context.Background(), completed)
+	require.NoError(t, err)
+	assert.False(t, processed)
+	assert.Equal(t, 1, executions.updates)
+}
+
+func TestDryRun(t *testing.T) {
+	workflow := newWorkflow("payments")
+	execution := newFailure(workflow, time.Minute, "http", 503)
+	executions := &fakeExecutions{executions: map[uuid.UUID]*models.Execution{execution.ID: execution}}
+	classifier := newClassifier(Sources{Executions: executions, Workflows: fakeWorkflows{workflow.ID: workflow}})
+
+	classification, err := classifier.DryRun(context.Background(), execution.ID, []Rule{
+		{Name: "psp-maintenance", Class: "psp_maintenance", When: "step.status_code == 503", Confidence: 0.9},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "psp_maintenance", classification.Triage.Class)
+	assert.Equal(t, "payments", classification.Namespace)
+	assert.Equal(t, []RuleResult{{Rule: "psp-maintenance", Matched: true}}, classification.Evaluated)
+	assert.Equal(t, float64(503), classification.Facts["step"].(map[string]interface{})["status_code"])
+	assert.Nil(t, execution.Triage)
+	assert.Zero(t, executions.updates)
+
+	classification, err = classifier.DryRun(context.Background(), execution.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "downstream-server-error", classification.Triage.Rule)
+	assert.Equal(t, "circuit-breaker-open", classification.Evaluated[0].Rule)
+
+	_, err = classifier.DryRun(context.Background(), execution.ID, []Rule{{Name: "bad", Class: "bad", When: "step.status_code =="}})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	_, err = classifier.DryRun(context.Background(), uuid.New(), nil)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestValidateRules(t *testing.T) {
+	require.NoError(t, ValidateRules(DefaultRules()))
+
+	err := ValidateRules([]Rule{
+		{Name: "a", Class: "x", When: "true", Confidence: 1.5},
+		{Name: "a", When: "step.status_code >=", Boosts: []Boost{{When: "true", Weight: 2}}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	for _, problem := range []string{
+		"rule 1: confidence must be between 0 and 1",
+		`rule 2: duplicate name "a"`,
+		"rule 2: class is required",
+		"rule 2: invalid condition",
+		"rule 2: boost 1: weight must be between -1 and 1",
+	} {
+		assert.ErrorContains(t, err, problem)
+	}
+}
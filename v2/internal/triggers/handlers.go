@@ -0,0 +1,196 @@
+package triggers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/admission"
+	"magic-flow/v2/internal/freeze"
+	"magic-flow/v2/internal/quotas"
+)
+
+// Handlers provides the HTTP endpoint receiving the webhooks of triggers
+type Handlers struct {
+	config   Config
+	triggers map[string]*Trigger
+	execute  ExecuteFunc
+
+	hold      Hold
+	store     HeldStore
+	heldLimit int
+}
+
+// NewHandlers creates webhook trigger handlers starting workflows through
+// execute
+func NewHandlers(config Config, triggers []*Trigger, execute ExecuteFunc) *Handlers {
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultConfig().MaxBodyBytes
+	}
+	byName := make(map[string]*Trigger, len(triggers))
+	for _, trigger := range triggers {
+		byName[trigger.Name] = trigger
+	}
+	return &Handlers{config: config, triggers: byName, execute: execute}
+}
+
+// SetHold holds the executions of the webhooks received while hold is
+// held. Held webhooks are verified, kept in store and accepted, then
+// executed by Release; once limit webhooks are held, further ones are
+// rejected with 423 Locked so that their senders retry them.
+func (h *Handlers) SetHold(hold Hold, store HeldStore, limit int) {
+	h.hold = hold
+	h.store = store
+	h.heldLimit = limit
+}
+
+// Release starts the executions of the held webhooks, returning the number
+// started. The servers sharing the store may release them at once: each
+// webhook is taken, and started, by one of them. Webhooks whose execution
+// fails are dropped and reported in the error; those not taken when the
+// hold is held again stay held.
+func (h *Handlers) Release(ctx context.Context) (int, error) {
+	if h.store == nil {
+		return 0, nil
+	}
+
+	started := 0
+	var errs []error
+	for h.hold == nil || !h.hold.Held() {
+		webhooks, err := h.store.TakeHeldWebhooks(ctx, 1)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if len(webhooks) == 0 {
+			break
+		}
+		if err := h.start(ctx, webhooks[0]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		started++
+	}
+	return started, errors.Join(errs...)
+}
+
+// start starts the execution of a held webhook
+func (h *Handlers) start(ctx context.Context, webhook *freeze.HeldWebhook) error {
+	trigger, exists := h.triggers[webhook.Trigger]
+	if !exists {
+		return fmt.Errorf("held webhook %s: %w: %s", webhook.ID, ErrTriggerNotFound, webhook.Trigger)
+	}
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(webhook.Input), &input); err != nil {
+		return fmt.Errorf("held webhook %s: %w", webhook.ID, err)
+	}
+	_, err := h.execute(ctx, trigger, input)
+	return err
+}
+
+// RegisterRoutes registers webhook trigger routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		v1.POST("/triggers/webhooks/:name", h.ReceiveWebhook)
+	}
+}
+
+// ReceiveWebhook verifies the signature of a webhook and starts the
+// workflow of its trigger with the JSON payload as input
+// @Summary Receive a webhook trigger
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param name path string true "Trigger name"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Failure 423 {object} map[string]interface{}
+// @Router /api/v1/triggers/webhooks/{name} [post]
+func (h *Handlers) ReceiveWebhook(c *gin.Context) {
+	trigger, exists := h.triggers[c.Param("name")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrTriggerNotFound.Error()})
+		return
+	}
+
+	// The signature covers the raw body, so it is read before decoding
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, h.config.MaxBodyBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if int64(len(payload)) > h.config.MaxBodyBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "webhook payload too large"})
+		return
+	}
+
+	if err := trigger.Verifier.Verify(c.Request.Header, payload); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var input map[string]interface{}
+	if err := json.Unmarshal(payload, &input); err != nil || input == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "webhook payload must be a JSON object"})
+		return
+	}
+
+	if h.hold != nil && h.hold.Held() {
+		h.holdWebhook(c, trigger, payload)
+		return
+	}
+
+	executionID, err := h.execute(c.Request.Context(), trigger, input)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"trigger":      trigger.Name,
+		"workflow_id":  trigger.WorkflowID,
+		"execution_id": executionID,
+	})
+}
+
+// holdWebhook holds the execution of a verified webhook until Release
+func (h *Handlers) holdWebhook(c *gin.Context, trigger *Trigger, payload []byte) {
+	err := h.store.HoldWebhook(c.Request.Context(), &freeze.HeldWebhook{
+		ID:      uuid.New(),
+		Trigger: trigger.Name,
+		Input:   string(payload),
+	}, h.heldLimit)
+	if errors.Is(err, ErrHoldFull) {
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"trigger":     trigger.Name,
+		"workflow_id": trigger.WorkflowID,
+		"held":        true,
+	})
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, admission.ErrRejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, quotas.ErrQuotaExceeded):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
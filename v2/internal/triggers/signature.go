@@ -0,0 +1,247 @@
+package triggers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissingSignature is returned for payloads without a signature
+	ErrMissingSignature = errors.New("missing webhook signature")
+	// ErrInvalidSignature is returned for payloads whose signature does not
+	// match, or cannot be parsed
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrExpiredSignature is returned for timestamped signatures outside
+	// the tolerance of their scheme, which may be replayed payloads
+	ErrExpiredSignature = errors.New("webhook signature timestamp outside tolerance")
+)
+
+// Algorithm is the hash function of HMAC signatures
+type Algorithm string
+
+const (
+	AlgorithmSHA1   Algorithm = "sha1"
+	AlgorithmSHA256 Algorithm = "sha256"
+	AlgorithmSHA512 Algorithm = "sha512"
+)
+
+func (a Algorithm) hash() (func() hash.Hash, bool) {
+	switch a {
+	case AlgorithmSHA1:
+		return sha1.New, true
+	case AlgorithmSHA256:
+		return sha256.New, true
+	case AlgorithmSHA512:
+		return sha512.New, true
+	default:
+		return nil, false
+	}
+}
+
+// Encoding is how signatures are encoded in their header
+type Encoding string
+
+const (
+	EncodingHex    Encoding = "hex"
+	EncodingBase64 Encoding = "base64"
+)
+
+func (e Encoding) encode(sum []byte) string {
+	if e == EncodingBase64 {
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+	return hex.EncodeToString(sum)
+}
+
+func (e Encoding) decode(signature string) ([]byte, error) {
+	if e == EncodingBase64 {
+		return base64.StdEncoding.DecodeString(signature)
+	}
+	return hex.DecodeString(signature)
+}
+
+// Scheme is how a sender signs the payloads of its webhooks: an HMAC of
+// the payload with a shared secret, sent in a header
+type Scheme struct {
+	Header    string    `json:"header"`
+	Algorithm Algorithm `json:"algorithm"`
+	Encoding  Encoding  `json:"encoding"`
+	// Prefix precedes the signature in the header, such as sha256=
+	Prefix string `json:"prefix,omitempty"`
+	// Timestamped schemes, such as Stripe's, send "t=<unix time>,v1=<signature>"
+	// in the header and sign "<unix time>.<payload>". Signatures older or
+	// newer than Tolerance are rejected, so payloads cannot be replayed.
+	Timestamped bool          `json:"timestamped,omitempty"`
+	Tolerance   time.Duration `json:"tolerance,omitempty"`
+}
+
+// Schemes are the signature schemes of common webhook senders
+var Schemes = map[string]Scheme{
+	"github": {
+		Header:    "X-Hub-Signature-256",
+		Algorithm: AlgorithmSHA256,
+		Encoding:  EncodingHex,
+		Prefix:    "sha256=",
+	},
+	"stripe": {
+		Header:      "Stripe-Signature",
+		Algorithm:   AlgorithmSHA256,
+		Encoding:    EncodingHex,
+		Timestamped: true,
+		Tolerance:   5 * time.Minute,
+	},
+	"shopify": {
+		Header:    "X-Shopify-Hmac-Sha256",
+		Algorithm: AlgorithmSHA256,
+		Encoding:  EncodingBase64,
+	},
+	"hmac-sha256": {
+		Header:    "X-Signature",
+		Algorithm: AlgorithmSHA256,
+		Encoding:  EncodingHex,
+	},
+}
+
+// Validate checks that the scheme can verify signatures
+func (s Scheme) Validate() error {
+	if s.Header == "" {
+		return fmt.Errorf("signature header is required")
+	}
+	if _, ok := s.Algorithm.hash(); !ok {
+		return fmt.Errorf("unsupported signature algorithm %q", s.Algorithm)
+	}
+	if s.Encoding != EncodingHex && s.Encoding != EncodingBase64 {
+		return fmt.Errorf("unsupported signature encoding %q", s.Encoding)
+	}
+	if s.Tolerance < 0 {
+		return fmt.Errorf("signature tolerance cannot be negative")
+	}
+	return nil
+}
+
+// Verifier verifies the signatures of the payloads of a webhook sender
+type Verifier struct {
+	scheme Scheme
+	secret []byte
+	now    func() time.Time
+}
+
+// NewVerifier creates a verifier of the signatures made with secret
+// following scheme
+func NewVerifier(scheme Scheme, secret string) (*Verifier, error) {
+	if err := scheme.Validate(); err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("signature secret is required")
+	}
+	return &Verifier{scheme: scheme, secret: []byte(secret), now: time.Now}, nil
+}
+
+// Scheme returns the signature scheme of the verifier
+func (v *Verifier) Scheme() Scheme {
+	return v.scheme
+}
+
+// Verify checks the signature sent in header for payload, the raw request
+// body. Signatures are compared in constant time.
+func (v *Verifier) Verify(header http.Header, payload []byte) error {
+	value := strings.TrimSpace(header.Get(v.scheme.Header))
+	if value == "" {
+		return ErrMissingSignature
+	}
+
+	if v.scheme.Timestamped {
+		return v.verifyTimestamped(value, payload)
+	}
+
+	if !strings.HasPrefix(value, v.scheme.Prefix) {
+		return ErrInvalidSignature
+	}
+	if !v.matches(strings.TrimPrefix(value, v.scheme.Prefix), payload) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// verifyTimestamped checks a "t=<unix time>,v1=<signature>" header. It may
+// list several v1 signatures while the sender rotates its secret; one must
+// match.
+func (v *Verifier) verifyTimestamped(value string, payload []byte) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = val
+		case "v1":
+			signatures = append(signatures, val)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	signed := append([]byte(timestamp+"."), payload...)
+	matched := false
+	for _, signature := range signatures {
+		if v.matches(signature, signed) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return ErrInvalidSignature
+	}
+
+	if v.scheme.Tolerance > 0 {
+		age := v.now().Sub(time.Unix(unix, 0))
+		if age > v.scheme.Tolerance || age < -v.scheme.Tolerance {
+			return ErrExpiredSignature
+		}
+	}
+	return nil
+}
+
+func (v *Verifier) matches(signature string, signed []byte) bool {
+	sent, err := v.scheme.Encoding.decode(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sent, v.sum(signed))
+}
+
+func (v *Verifier) sum(signed []byte) []byte {
+	newHash, _ := v.scheme.Algorithm.hash()
+	mac := hmac.New(newHash, v.secret)
+	mac.Write(signed)
+	return mac.Sum(nil)
+}
+
+// Sign returns the header value a sender following the scheme sends with
+// payload at a time, to test webhook triggers
+func (v *Verifier) Sign(payload []byte, at time.Time) string {
+	if v.scheme.Timestamped {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		signed := append([]byte(timestamp+"."), payload...)
+		return "t=" + timestamp + ",v1=" + v.scheme.Encoding.encode(v.sum(signed))
+	}
+	return v.scheme.Prefix + v.scheme.Encoding.encode(v.sum(payload))
+}
@@ -0,0 +1,58 @@
+// Package triggers starts workflows from the webhooks of external
+// services, such as GitHub and Stripe. Each webhook trigger names the
+// workflow it starts and how its sender signs payloads; payloads whose
+// signature does not verify are rejected before a workflow is started.
+package triggers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/freeze"
+)
+
+// ErrTriggerNotFound is returned for webhooks of unknown triggers
+var ErrTriggerNotFound = errors.New("webhook trigger not found")
+
+// ErrHoldFull is returned for webhooks received while executions are held
+// and the held webhooks reached their limit
+var ErrHoldFull = freeze.ErrHoldFull
+
+// Hold reports whether executions must be held, such as while executions
+// are frozen
+type Hold interface {
+	Held() bool
+}
+
+// HeldStore keeps the webhooks held while executions are frozen, so that
+// they survive restarts and any server of the cluster starts them. It is
+// implemented by the freeze stores.
+type HeldStore interface {
+	HoldWebhook(ctx context.Context, webhook *freeze.HeldWebhook, limit int) error
+	TakeHeldWebhooks(ctx context.Context, limit int) ([]*freeze.HeldWebhook, error)
+}
+
+// Trigger starts a workflow from the webhooks of a sender
+type Trigger struct {
+	// Name identifies the trigger in its webhook URL
+	Name       string
+	WorkflowID uuid.UUID
+	Verifier   *Verifier
+}
+
+// ExecuteFunc starts the workflow of a trigger with the verified payload
+// as its input, returning the ID of the execution
+type ExecuteFunc func(ctx context.Context, trigger *Trigger, input map[string]interface{}) (uuid.UUID, error)
+
+// Config configures the webhook triggers endpoint
+type Config struct {
+	// MaxBodyBytes is the largest payload accepted
+	MaxBodyBytes int64
+}
+
+// DefaultConfig returns the default trigger configuration
+func DefaultConfig() Config {
+	return Config{MaxBodyBytes: 1 << 20}
+}
@@ -0,0 +1,272 @@
+package triggers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/internal/freeze"
+	"magic-flow/v2/internal/quotas"
+)
+
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"action":"opened","number":42}`)
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	t.Run("github", func(t *testing.T) {
+		verifier, err := NewVerifier(Schemes["github"], "It's a Secret to Everybody")
+		require.NoError(t, err)
+
+		// The example signature of the GitHub webhook documentation
+		header := http.Header{}
+		header.Set("X-Hub-Signature-256", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17")
+		assert.NoError(t, verifier.Verify(header, []byte("Hello, World!")))
+
+		header.Set("X-Hub-Signature-256", verifier.Sign(payload, now))
+		assert.NoError(t, verifier.Verify(header, payload))
+		assert.ErrorIs(t, verifier.Verify(header, []byte(`{"action":"opened","number":43}`)), ErrInvalidSignature, "tampered payload")
+
+		header.Set("X-Hub-Signature-256", verifier.Sign(payload, now)[len("sha256="):])
+		assert.ErrorIs(t, verifier.Verify(header, payload), ErrInvalidSignature, "signature without its prefix")
+
+		header.Set("X-Hub-Signature-256", "sha256=not-hex")
+		assert.ErrorIs(t, verifier.Verify(header, payload), ErrInvalidSignature)
+
+		assert.ErrorIs(t, verifier.Verify(http.Header{}, payload), ErrMissingSignature)
+
+		other, err := NewVerifier(Schemes["github"], "another secret")
+		require.NoError(t, err)
+		header.Set("X-Hub-Signature-256", other.Sign(payload, now))
+		assert.ErrorIs(t, verifier.Verify(header, payload), ErrInvalidSignature, "signed with another secret")
+	})
+
+	t.Run("stripe", func(t *testing.T) {
+		verifier, err := NewVerifier(Schemes["stripe"], "whsec_test")
+		require.NoError(t, err)
+		verifier.now = func() time.Time { return now }
+		v1 := func(value string) string {
+			return value[strings.Index(value, "v1=")+len("v1="):]
+		}
+
+		header := http.Header{}
+		header.Set("Stripe-Signature", verifier.Sign(payload, now.Add(-time.Minute)))
+		assert.NoError(t, verifier.Verify(header, payload))
+		assert.ErrorIs(t, verifier.Verify(header, append(payload, ' ')), ErrInvalidSignature, "tampered payload")
+
+		rotated, err := NewVerifier(Schemes["stripe"], "whsec_old")
+		require.NoError(t, err)
+		signature := verifier.Sign(payload, now)
+		header.Set("Stripe-Signature", rotated.Sign(payload, now)+",v1="+v1(signature))
+		assert.NoError(t, verifier.Verify(header, payload), "one of the signatures matches while the secret rotates")
+
+		header.Set("Stripe-Signature", verifier.Sign(payload, now.Add(-10*time.Minute)))
+		assert.ErrorIs(t, verifier.Verify(header, payload), ErrExpiredSignature, "replayed payload")
+
+		// The timestamp is signed, so it cannot be moved into the tolerance
+		stale := verifier.Sign(payload, now.Add(-10*time.Minute))
+		header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", now.Unix(), v1(stale)))
+		assert.ErrorIs(t, verifier.Verify(header, payload), ErrInvalidSignature)
+
+		header.Set("Stripe-Signature", "v1=abc")
+		assert.ErrorIs(t, verifier.Verify(header, payload), ErrInvalidSignature)
+	})
+
+	t.Run("base64", func(t *testing.T) {
+		verifier, err := NewVerifier(Schemes["shopify"], "shpss_test")
+		require.NoError(t, err)
+
+		header := http.Header{}
+		header.Set("X-Shopify-Hmac-Sha256", verifier.Sign(payload, now))
+		assert.NoError(t, verifier.Verify(header, payload))
+		assert.ErrorIs(t, verifier.Verify(header, []byte(`{}`)), ErrInvalidSignature)
+	})
+
+	t.Run("custom scheme", func(t *testing.T) {
+		verifier, err := NewVerifier(Scheme{Header: "X-Acme-Signature", Algorithm: AlgorithmSHA512, Encoding: EncodingHex, Prefix: "v1:"}, "acme")
+		require.NoError(t, err)
+
+		header := http.Header{}
+		header.Set("X-Acme-Signature", verifier.Sign(payload, now))
+		assert.NoError(t, verifier.Verify(header, payload))
+		assert.Len(t, header.Get("X-Acme-Signature"), len("v1:")+128)
+	})
+
+	t.Run("invalid schemes", func(t *testing.T) {
+		_, err := NewVerifier(Scheme{Header: "X-Signature", Algorithm: "md5", Encoding: EncodingHex}, "secret")
+		assert.Error(t, err)
+		_, err = NewVerifier(Scheme{Algorithm: AlgorithmSHA256, Encoding: EncodingHex}, "secret")
+		assert.Error(t, err)
+		_, err = NewVerifier(Scheme{Header: "X-Signature", Algorithm: AlgorithmSHA256, Encoding: "base32"}, "secret")
+		assert.Error(t, err)
+		_, err = NewVerifier(Schemes["github"], "")
+		assert.Error(t, err)
+	})
+}
+
+func TestReceiveWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	verifier, err := NewVerifier(Schemes["github"], "secret")
+	require.NoError(t, err)
+	trigger := &Trigger{Name: "github-prs", WorkflowID: uuid.New(), Verifier: verifier}
+
+	var started []map[string]interface{}
+	executionID := uuid.New()
+	var executeErr error
+	handlers := NewHandlers(Config{MaxBodyBytes: 64}, []*Trigger{trigger}, func(ctx context.Context, trigger *Trigger, input map[string]interface{}) (uuid.UUID, error) {
+		if executeErr != nil {
+			return uuid.Nil, executeErr
+		}
+		started = append(started, input)
+		return executionID, nil
+	})
+	router := gin.New()
+	handlers.RegisterRoutes(router.Group("/api"))
+
+	post := func(name string, payload []byte, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/triggers/webhooks/"+name, bytes.NewReader(payload))
+		if signature != "" {
+			req.Header.Set("X-Hub-Signature-256", signature)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	payload := []byte(`{"action":"opened"}`)
+	rec := post("github-prs", payload, verifier.Sign(payload, time.Now()))
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), executionID.String())
+	require.Len(t, started, 1)
+	assert.Equal(t, "opened", started[0]["action"], "the payload is the input of the workflow")
+
+	assert.Equal(t, http.StatusUnauthorized, post("github-prs", []byte(`{"action":"closed"}`), verifier.Sign(payload, time.Now())).Code, "tampered payload")
+	assert.Equal(t, http.StatusUnauthorized, post("github-prs", payload, "").Code)
+	assert.Len(t, started, 1, "no workflow is started for invalid signatures")
+
+	assert.Equal(t, http.StatusNotFound, post("stripe-payments", payload, verifier.Sign(payload, time.Now())).Code)
+
+	large := []byte(fmt.Sprintf(`{"body":"%s"}`, bytes.Repeat([]byte("x"), 64)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("github-prs", large, verifier.Sign(large, time.Now())).Code)
+
+	list := []byte(`[1,2]`)
+	assert.Equal(t, http.StatusBadRequest, post("github-prs", list, verifier.Sign(list, time.Now())).Code)
+
+	executeErr = &quotas.ExceededError{Tenant: "payments", Limit: quotas.Limit{Executions: 1, Period: time.Minute}}
+	assert.Equal(t, http.StatusTooManyRequests, post("github-prs", payload, verifier.Sign(payload, time.Now())).Code)
+}
+
+// testHold is a Hold switched by tests
+type testHold struct {
+	held bool
+}
+
+func (h *testHold) Held() bool {
+	return h.held
+}
+
+func TestReceiveWebhookHeld(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	verifier, err := NewVerifier(Schemes["github"], "secret")
+	require.NoError(t, err)
+	trigger := &Trigger{Name: "github-prs", WorkflowID: uuid.New(), Verifier: verifier}
+
+	var started []map[string]interface{}
+	handlers := NewHandlers(Config{}, []*Trigger{trigger}, func(ctx context.Context, trigger *Trigger, input map[string]interface{}) (uuid.UUID, error) {
+		started = append(started, input)
+		return uuid.New(), nil
+	})
+	hold := &testHold{held: true}
+	handlers.SetHold(hold, freeze.NewMemoryStore(), 2)
+	router := gin.New()
+	handlers.RegisterRoutes(router.Group("/api"))
+
+	post := func(payload []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/triggers/webhooks/github-prs", bytes.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", verifier.Sign(payload, time.Now()))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Webhooks are held rather than dropped, up to the limit
+	for _, action := range []string{"opened", "closed"} {
+		rec := post([]byte(fmt.Sprintf(`{"action":%q}`, action)))
+		require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"held":true`)
+	}
+	assert.Equal(t, http.StatusLocked, post([]byte(`{"action":"edited"}`)).Code)
+	assert.Empty(t, started)
+
+	// Releasing while still held starts nothing
+	count, err := handlers.Release(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	hold.held = false
+	count, err = handlers.Release(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	require.Len(t, started, 2)
+	assert.Equal(t, "opened", started[0]["action"])
+	assert.Equal(t, "closed", started[1]["action"])
+
+	rec := post([]byte(`{"action":"reopened"}`))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"held"`)
+	assert.Len(t, started, 3)
+}
+
+func TestReleaseHeldWebhooksAcrossServers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	verifier, err := NewVerifier(Schemes["github"], "secret")
+	require.NoError(t, err)
+	trigger := &Trigger{Name: "github-prs", WorkflowID: uuid.New(), Verifier: verifier}
+
+	// Two servers holding webhooks in the same store
+	store := freeze.NewMemoryStore()
+	hold := &testHold{held: true}
+	started := make(map[string][]string)
+	newServer := func(name string) *Handlers {
+		handlers := NewHandlers(Config{}, []*Trigger{trigger}, func(ctx context.Context, trigger *Trigger, input map[string]interface{}) (uuid.UUID, error) {
+			started[name] = append(started[name], input["action"].(string))
+			return uuid.New(), nil
+		})
+		handlers.SetHold(hold, store, 10)
+		return handlers
+	}
+	receiving, releasing := newServer("receiving"), newServer("releasing")
+
+	router := gin.New()
+	receiving.RegisterRoutes(router.Group("/api"))
+	for _, action := range []string{"opened", "closed"} {
+		payload := []byte(fmt.Sprintf(`{"action":%q}`, action))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/triggers/webhooks/github-prs", bytes.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", verifier.Sign(payload, time.Now()))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+
+	// Whichever server sees the freeze end starts each webhook once
+	hold.held = false
+	count, err := releasing.Release(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = receiving.Release(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	assert.Equal(t, map[string][]string{"releasing": {"opened", "closed"}}, started)
+}
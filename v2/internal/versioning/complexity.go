@@ -0,0 +1,426 @@
+package versioning
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"magic-flow/v2/internal/expressions"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// Measures of the complexity of workflow definitions
+const (
+	// MeasureNestingDepth is the deepest nesting of loop and parallel steps
+	MeasureNestingDepth = "nesting_depth"
+	// MeasureExpandedSteps is the number of steps once the steps defined
+	// inline in loops and parallel branches are expanded. YAML anchors and
+	// aliases are expanded as definitions are decoded, so every alias of a
+	// step counts.
+	MeasureExpandedSteps = "expanded_steps"
+	// MeasureParallelBranches is the most branches of a parallel step
+	MeasureParallelBranches = "parallel_branches"
+	// MeasureDefinitionBytes is the size of the definition encoded as JSON
+	MeasureDefinitionBytes = "definition_bytes"
+	// MeasureExpressionLength is the length of the longest expression
+	MeasureExpressionLength = "expression_length"
+)
+
+// measureLabels name the measures in problems and warnings
+var measureLabels = map[string]string{
+	MeasureNestingDepth:     "nesting depth",
+	MeasureExpandedSteps:    "expanded step count",
+	MeasureParallelBranches: "parallel branch count",
+	MeasureDefinitionBytes:  "definition size in bytes",
+	MeasureExpressionLength: "expression length",
+}
+
+// MetricsRecorder records the complexity metrics of definitions. It is
+// satisfied by the engine metrics collector.
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// Limit is a soft and a hard threshold of a measure of complexity.
+// Definitions over the soft threshold are accepted with a warning, those
+// over the hard threshold are rejected. Zero thresholds are not enforced.
+type Limit struct {
+	Soft int `json:"soft,omitempty"`
+	Hard int `json:"hard,omitempty"`
+}
+
+// ComplexityLimits bound the complexity of workflow definitions, beyond
+// MaxStepsPerWorkflow and MaxNestingDepth which apply in every namespace
+type ComplexityLimits struct {
+	NestingDepth     Limit `json:"nesting_depth"`
+	ExpandedSteps    Limit `json:"expanded_steps"`
+	ParallelBranches Limit `json:"parallel_branches"`
+	DefinitionBytes  Limit `json:"definition_bytes"`
+	ExpressionLength Limit `json:"expression_length"`
+}
+
+// limit returns the limit of a measure
+func (l ComplexityLimits) limit(measure string) Limit {
+	switch measure {
+	case MeasureNestingDepth:
+		return l.NestingDepth
+	case MeasureExpandedSteps:
+		return l.ExpandedSteps
+	case MeasureParallelBranches:
+		return l.ParallelBranches
+	case MeasureDefinitionBytes:
+		return l.DefinitionBytes
+	case MeasureExpressionLength:
+		return l.ExpressionLength
+	}
+	return Limit{}
+}
+
+// ComplexityConfig holds the default complexity limits and per namespace
+// overrides
+type ComplexityConfig struct {
+	Default    ComplexityLimits            `json:"default"`
+	Namespaces map[string]ComplexityLimits `json:"namespaces,omitempty"`
+}
+
+// DefaultComplexityConfig returns the default complexity limits. The hard
+// nesting depth is left to MaxNestingDepth.
+func DefaultComplexityConfig() ComplexityConfig {
+	return ComplexityConfig{
+		Default: ComplexityLimits{
+			NestingDepth:     Limit{Soft: 4},
+			ExpandedSteps:    Limit{Soft: 200, Hard: 1000},
+			ParallelBranches: Limit{Soft: 20, Hard: 100},
+			DefinitionBytes:  Limit{Soft: 256 * 1024, Hard: 1024 * 1024},
+			ExpressionLength: Limit{Soft: 500, Hard: 2000},
+		},
+	}
+}
+
+// For returns the complexity limits of a namespace. Thresholds the
+// namespace leaves unset fall back to the defaults.
+func (c ComplexityConfig) For(namespace string) ComplexityLimits {
+	limits := c.Default
+	override, exists := c.Namespaces[namespace]
+	if !exists {
+		return limits
+	}
+	limits.NestingDepth = limits.NestingDepth.override(override.NestingDepth)
+	limits.ExpandedSteps = limits.ExpandedSteps.override(override.ExpandedSteps)
+	limits.ParallelBranches = limits.ParallelBranches.override(override.ParallelBranches)
+	limits.DefinitionBytes = limits.DefinitionBytes.override(override.DefinitionBytes)
+	limits.ExpressionLength = limits.ExpressionLength.override(override.ExpressionLength)
+	return limits
+}
+
+func (l Limit) override(override Limit) Limit {
+	if override.Soft > 0 {
+		l.Soft = override.Soft
+	}
+	if override.Hard > 0 {
+		l.Hard = override.Hard
+	}
+	return l
+}
+
+// Measure is a measure of the complexity of a definition and where its
+// worst offender is
+type Measure struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+	// Path is the path of the worst offender in the definition, such as
+	// steps[3] or steps[3].config.branches, empty for the definition itself
+	Path string `json:"path,omitempty"`
+	// Trail names the steps down to the worst offender, from the outermost
+	// one, such as the loops and parallels of the deepest nesting
+	Trail []string `json:"trail,omitempty"`
+}
+
+// location describes where the worst offender of a measure is
+func (m Measure) location() string {
+	location := m.Path
+	if location == "" {
+		location = "the definition"
+	}
+	if len(m.Trail) > 0 {
+		location += " (" + strings.Join(m.Trail, " > ") + ")"
+	}
+	return location
+}
+
+// MeasureComplexity measures the complexity of a workflow definition, in
+// the order of the measure constants
+func MeasureComplexity(definition map[string]interface{}) []Measure {
+	steps, _ := definition["steps"].([]interface{})
+	return []Measure{
+		measureNestingDepth(steps),
+		measureExpandedSteps(steps),
+		measureParallelBranches(steps),
+		measureDefinitionBytes(definition, steps),
+		measureExpressionLength(definition, steps),
+	}
+}
+
+func measureNestingDepth(steps []interface{}) Measure {
+	measure := Measure{Name: MeasureNestingDepth}
+	index := newNestingIndex(steps)
+	for i, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok || index.nested[stepName(step)] {
+			continue
+		}
+		if trail := index.trail(step); len(trail) > measure.Value {
+			measure.Value = len(trail)
+			measure.Path = fmt.Sprintf("steps[%d]", i)
+			measure.Trail = trail
+		}
+	}
+	return measure
+}
+
+func measureExpandedSteps(steps []interface{}) Measure {
+	measure := Measure{Name: MeasureExpandedSteps, Value: len(steps), Path: "steps"}
+	most := 0
+	for i, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := fmt.Sprintf("steps[%d]", i)
+		inline := 0
+		walkInlineSteps(path, step, func(string, map[string]interface{}) { inline++ })
+		measure.Value += inline
+		if inline > most {
+			most = inline
+			measure.Path = path
+			measure.Trail = []string{stepName(step)}
+		}
+	}
+	return measure
+}
+
+func measureParallelBranches(steps []interface{}) Measure {
+	measure := Measure{Name: MeasureParallelBranches}
+	visit := func(path string, step map[string]interface{}) {
+		if step["type"] != "parallel" {
+			return
+		}
+		config, _ := step["config"].(map[string]interface{})
+		branches, _ := config["branches"].([]interface{})
+		if len(branches) > measure.Value {
+			measure.Value = len(branches)
+			measure.Path = joinPath(path, "config.branches")
+			measure.Trail = []string{stepName(step)}
+		}
+	}
+	for i, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := fmt.Sprintf("steps[%d]", i)
+		visit(path, step)
+		walkInlineSteps(path, step, visit)
+	}
+	return measure
+}
+
+func measureDefinitionBytes(definition map[string]interface{}, steps []interface{}) Measure {
+	measure := Measure{Name: MeasureDefinitionBytes, Value: encodedSize(definition)}
+	largest := 0
+	for i, stepInterface := range steps {
+		if size := encodedSize(stepInterface); size > largest {
+			largest = size
+			measure.Path = fmt.Sprintf("steps[%d]", i)
+			if step, ok := stepInterface.(map[string]interface{}); ok {
+				measure.Trail = []string{stepName(step)}
+			}
+		}
+	}
+	return measure
+}
+
+func measureExpressionLength(definition map[string]interface{}, steps []interface{}) Measure {
+	measure := Measure{Name: MeasureExpressionLength}
+	for i, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := fmt.Sprintf("steps[%d]", i)
+		for _, field := range expressionFields {
+			if value, exists := step[field]; exists {
+				longestExpression(&measure, joinPath(path, field), value)
+			}
+		}
+	}
+	if outputMapping, exists := definition["output_mapping"]; exists {
+		longestExpression(&measure, "output_mapping", outputMapping)
+	}
+	return measure
+}
+
+// longestExpression records the longest ${...} expression of the strings
+// of a value, and of the bare expressions of conditions, in measure
+func longestExpression(measure *Measure, path string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		for _, source := range expressions.EmbeddedAll(v) {
+			if len(source) > measure.Value {
+				measure.Value = len(source)
+				measure.Path = path
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			item := v[key]
+			if source, ok := item.(string); ok && key == "expression" && v["operator"] == "expression" {
+				if len(source) > measure.Value {
+					measure.Value = len(source)
+					measure.Path = joinPath(path, key)
+				}
+				continue
+			}
+			longestExpression(measure, joinPath(path, key), item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			longestExpression(measure, joinPath(path, fmt.Sprintf("[%d]", i)), item)
+		}
+	}
+}
+
+// walkInlineSteps visits the steps defined inline in a loop or parallel
+// step, and in those, with their paths
+func walkInlineSteps(path string, step map[string]interface{}, visit func(path string, step map[string]interface{})) {
+	for _, child := range nestedSteps(path, step) {
+		if inline, ok := child.step.(map[string]interface{}); ok {
+			visit(child.path, inline)
+			walkInlineSteps(child.path, inline, visit)
+		}
+	}
+}
+
+// encodedSize returns the size of a value encoded as JSON
+func encodedSize(value interface{}) int {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// stepName returns the name of a step, or its type for nameless inline
+// steps
+func stepName(step map[string]interface{}) string {
+	if name, ok := step["name"].(string); ok && name != "" {
+		return name
+	}
+	stepType, _ := step["type"].(string)
+	return stepType
+}
+
+// namespaceOf returns the namespace of a definition from its namespace
+// label, or the namespace of its workflow without one
+func namespaceOf(definition map[string]interface{}, workflow *models.Workflow) string {
+	metadata, _ := definition["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	if namespace, _ := labels["namespace"].(string); namespace != "" {
+		return namespace
+	}
+	if workflow != nil {
+		return policies.Namespace(workflow.Definition)
+	}
+	return policies.DefaultNamespace
+}
+
+// complexityBreach is a measure of a definition over one of its limits
+type complexityBreach struct {
+	measure Measure
+	limit   int
+	hard    bool
+}
+
+func (b complexityBreach) message() string {
+	kind := "the soft limit"
+	if b.hard {
+		kind = "the limit"
+	}
+	return fmt.Sprintf("%s %d exceeds %s of %d, worst at %s",
+		measureLabels[b.measure.Name], b.measure.Value, kind, b.limit, b.measure.location())
+}
+
+// checkComplexity measures a definition against the complexity limits of a
+// namespace. Measures over their hard limit are not reported over their
+// soft limit as well.
+func (v *Validator) checkComplexity(definition map[string]interface{}, namespace string) []complexityBreach {
+	limits := v.config.Complexity.For(namespace)
+
+	var breaches []complexityBreach
+	for _, measure := range MeasureComplexity(definition) {
+		limit := limits.limit(measure.Name)
+		switch {
+		case limit.Hard > 0 && measure.Value > limit.Hard:
+			breaches = append(breaches, complexityBreach{measure: measure, limit: limit.Hard, hard: true})
+		case limit.Soft > 0 && measure.Value > limit.Soft:
+			breaches = append(breaches, complexityBreach{measure: measure, limit: limit.Soft})
+		}
+	}
+	return breaches
+}
+
+// validateComplexity returns the measures of a definition over their hard
+// limit as LIMIT_EXCEEDED problems on the path of their worst offender.
+// Every breach, soft or hard, is counted in the
+// definition_complexity_exceeded_total metric.
+func (v *Validator) validateComplexity(definition map[string]interface{}, namespace string) error {
+	errs := &ValidationError{}
+	for _, breach := range v.checkComplexity(definition, namespace) {
+		v.recordBreach(namespace, breach)
+		if breach.hard {
+			errs.add(breach.measure.Path, CodeLimitExceeded, breach.message())
+		}
+	}
+	return errs.err()
+}
+
+func (v *Validator) recordBreach(namespace string, breach complexityBreach) {
+	if v.metrics == nil {
+		return
+	}
+	limit := "soft"
+	if breach.hard {
+		limit = "hard"
+	}
+	v.metrics.RecordMetric("definition_complexity_exceeded_total", 1, map[string]string{
+		"namespace": namespace,
+		"measure":   breach.measure.Name,
+		"limit":     limit,
+	})
+}
+
+// ComplexityWarnings returns the measures of a definition over their soft
+// limit in a namespace
+func (v *Validator) ComplexityWarnings(definition map[string]interface{}, namespace string) []string {
+	var warnings []string
+	for _, breach := range v.checkComplexity(definition, namespace) {
+		if !breach.hard {
+			warnings = append(warnings, breach.message())
+		}
+	}
+	return warnings
+}
+
+// SetMetrics sets the recorder of the definition_complexity_exceeded_total
+// metric
+func (v *Validator) SetMetrics(metrics MetricsRecorder) {
+	v.metrics = metrics
+}
@@ -0,0 +1,295 @@
+package versioning
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// recordedMetrics keeps the labels of the metrics recorded by the validator
+type recordedMetrics struct {
+	labels []map[string]string
+}
+
+func (m *recordedMetrics) RecordMetric(name string, value float64, labels map[string]string) {
+	m.labels = append(m.labels, labels)
+}
+
+func generated(steps ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"name": "generated", "steps": steps}
+}
+
+// nestedParallels generates a definition nesting parallel steps inline,
+// p1 running p2 and so on down to a custom step
+func nestedParallels(depth int) map[string]interface{} {
+	var step interface{} = map[string]interface{}{"name": "work", "type": "custom"}
+	for level := depth; level >= 1; level-- {
+		step = map[string]interface{}{
+			"name":   fmt.Sprintf("p%d", level),
+			"type":   "parallel",
+			"config": map[string]interface{}{"branches": []interface{}{step}},
+		}
+	}
+	return generated(step)
+}
+
+// fanOut generates a definition running n custom steps defined inline in
+// the branches of a parallel step
+func fanOut(n int) map[string]interface{} {
+	branches := make([]interface{}, n)
+	for i := range branches {
+		branches[i] = map[string]interface{}{"name": fmt.Sprintf("s%d", i), "type": "custom"}
+	}
+	return generated(map[string]interface{}{
+		"name":   "fan-out",
+		"type":   "parallel",
+		"config": map[string]interface{}{"branches": branches},
+	})
+}
+
+// wide generates a definition running a custom step in n branches of a
+// parallel step
+func wide(n int) map[string]interface{} {
+	branches := make([]interface{}, n)
+	for i := range branches {
+		branches[i] = "work"
+	}
+	return generated(
+		map[string]interface{}{"name": "fan", "type": "parallel", "config": map[string]interface{}{"branches": branches}},
+		map[string]interface{}{"name": "work", "type": "custom"},
+	)
+}
+
+// longExpression generates a definition whose step input holds an
+// expression of n characters
+func longExpression(n int) map[string]interface{} {
+	return generated(map[string]interface{}{
+		"name":  "render",
+		"type":  "custom",
+		"input": map[string]interface{}{"label": "${" + strings.Repeat("x", n) + "}"},
+	})
+}
+
+func complexityValidator(limits ComplexityLimits) *Validator {
+	config := DefaultValidationConfig()
+	config.Complexity = ComplexityConfig{Default: limits}
+	return NewValidator(config)
+}
+
+func requireProblems(t *testing.T, err error) []FieldError {
+	t.Helper()
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+	return validationErr.Errors
+}
+
+func TestComplexityLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		limits  ComplexityLimits
+		within  map[string]interface{}
+		warning string
+		over    map[string]interface{}
+		problem FieldError
+	}{
+		{
+			name:    "nesting depth",
+			limits:  ComplexityLimits{NestingDepth: Limit{Soft: 2, Hard: 3}},
+			within:  nestedParallels(3),
+			warning: "nesting depth 3 exceeds the soft limit of 2, worst at steps[0] (p1 > p2 > p3)",
+			over:    nestedParallels(4),
+			problem: FieldError{Field: "steps[0]", Message: "nesting depth 4 exceeds the limit of 3, worst at steps[0] (p1 > p2 > p3 > p4)", Code: CodeLimitExceeded},
+		},
+		{
+			name:    "expanded steps",
+			limits:  ComplexityLimits{ExpandedSteps: Limit{Soft: 4, Hard: 5}},
+			within:  fanOut(4),
+			warning: "expanded step count 5 exceeds the soft limit of 4, worst at steps[0] (fan-out)",
+			over:    fanOut(5),
+			problem: FieldError{Field: "steps[0]", Message: "expanded step count 6 exceeds the limit of 5, worst at steps[0] (fan-out)", Code: CodeLimitExceeded},
+		},
+		{
+			name:    "parallel branches",
+			limits:  ComplexityLimits{ParallelBranches: Limit{Soft: 3, Hard: 4}},
+			within:  wide(4),
+			warning: "parallel branch count 4 exceeds the soft limit of 3, worst at steps[0].config.branches (fan)",
+			over:    wide(5),
+			problem: FieldError{Field: "steps[0].config.branches", Message: "parallel branch count 5 exceeds the limit of 4, worst at steps[0].config.branches (fan)", Code: CodeLimitExceeded},
+		},
+		{
+			name:    "expression length",
+			limits:  ComplexityLimits{ExpressionLength: Limit{Soft: 15, Hard: 16}},
+			within:  longExpression(16),
+			warning: "expression length 16 exceeds the soft limit of 15, worst at steps[0].input.label",
+			over:    longExpression(17),
+			problem: FieldError{Field: "steps[0].input.label", Message: "expression length 17 exceeds the limit of 16, worst at steps[0].input.label", Code: CodeLimitExceeded},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			validator := complexityValidator(tc.limits)
+
+			// At the hard limit definitions are accepted with a warning
+			require.NoError(t, validator.ValidateDefinition(context.Background(), tc.within))
+			assert.Equal(t, []string{tc.warning}, validator.ComplexityWarnings(tc.within, "default"))
+
+			// Past it they are rejected on their worst offender
+			err := validator.ValidateDefinition(context.Background(), tc.over)
+			assert.Equal(t, []FieldError{tc.problem}, requireProblems(t, err))
+			assert.Empty(t, validator.ComplexityWarnings(tc.over, "default"), "hard breaches are not warned about")
+		})
+	}
+
+	t.Run("definition bytes", func(t *testing.T) {
+		definition := fanOut(3)
+		definition["description"] = strings.Repeat("d", 1000)
+		encoded, err := json.Marshal(definition)
+		require.NoError(t, err)
+		size := len(encoded)
+
+		require.NoError(t, complexityValidator(ComplexityLimits{DefinitionBytes: Limit{Hard: size}}).ValidateDefinition(context.Background(), definition))
+		err = complexityValidator(ComplexityLimits{DefinitionBytes: Limit{Hard: size - 1}}).ValidateDefinition(context.Background(), definition)
+		assert.Equal(t, []FieldError{{
+			Field:   "steps[0]",
+			Message: fmt.Sprintf("definition size in bytes %d exceeds the limit of %d, worst at steps[0] (fan-out)", size, size-1),
+			Code:    CodeLimitExceeded,
+		}}, requireProblems(t, err))
+	})
+}
+
+func TestComplexityLimitsPerNamespace(t *testing.T) {
+	config := DefaultValidationConfig()
+	config.Complexity = ComplexityConfig{
+		Default: ComplexityLimits{ExpandedSteps: Limit{Soft: 4, Hard: 5}},
+		Namespaces: map[string]ComplexityLimits{
+			"batch": {ExpandedSteps: Limit{Hard: 50}},
+		},
+	}
+	validator := NewValidator(config)
+	metrics := &recordedMetrics{}
+	validator.SetMetrics(metrics)
+
+	assert.Equal(t, Limit{Soft: 4, Hard: 50}, config.Complexity.For("batch").ExpandedSteps, "unset thresholds fall back to the defaults")
+	assert.Equal(t, Limit{Soft: 4, Hard: 5}, config.Complexity.For("payments").ExpandedSteps)
+
+	// The namespace label of the definition selects its limits
+	definition := fanOut(9)
+	definition["metadata"] = map[string]interface{}{"labels": map[string]interface{}{"namespace": "batch"}}
+	require.NoError(t, validator.ValidateDefinition(context.Background(), definition))
+
+	// Versions fall back to the namespace of their workflow
+	workflow := &models.Workflow{Name: "generated"}
+	workflow.Definition.Metadata.Labels = map[string]string{"namespace": "batch"}
+	changes := VersionChanges{ChangeType: ChangeTypeMinor, NewDefinition: fanOut(9)}
+	require.NoError(t, validator.ValidateVersion(context.Background(), workflow, changes))
+
+	workflow.Definition.Metadata.Labels = nil
+	err := validator.ValidateVersion(context.Background(), workflow, changes)
+	assert.Equal(t, []FieldError{
+		{Field: "definition.steps[0]", Message: "expanded step count 10 exceeds the limit of 5, worst at steps[0] (fan-out)", Code: CodeLimitExceeded},
+	}, requireProblems(t, err))
+
+	assert.Equal(t, []map[string]string{
+		{"namespace": "batch", "measure": MeasureExpandedSteps, "limit": "soft"},
+		{"namespace": "batch", "measure": MeasureExpandedSteps, "limit": "soft"},
+		{"namespace": "default", "measure": MeasureExpandedSteps, "limit": "hard"},
+	}, metrics.labels)
+}
+
+func TestComplexityRejectsBeforeValidating(t *testing.T) {
+	definition := fanOut(5)
+	definition["name"] = "not a name"
+
+	err := complexityValidator(ComplexityLimits{ExpandedSteps: Limit{Hard: 5}}).ValidateDefinition(context.Background(), definition)
+	assert.Equal(t, []FieldError{
+		{Field: "steps[0]", Message: "expanded step count 6 exceeds the limit of 5, worst at steps[0] (fan-out)", Code: CodeLimitExceeded},
+	}, requireProblems(t, err), "the other problems of pathological definitions are not reported")
+}
+
+func TestNestingDepthOfSharedSteps(t *testing.T) {
+	// Every level runs both steps of the next one in its branches, making
+	// 2^60 paths down to the work step
+	const levels = 60
+	steps := []interface{}{map[string]interface{}{"name": "work", "type": "custom"}}
+	for level := 0; level < levels; level++ {
+		next := []interface{}{fmt.Sprintf("a%d", level+1), fmt.Sprintf("b%d", level+1)}
+		if level == levels-1 {
+			next = []interface{}{"work"}
+		}
+		for _, name := range []string{"a", "b"} {
+			steps = append(steps, map[string]interface{}{
+				"name":   fmt.Sprintf("%s%d", name, level),
+				"type":   "parallel",
+				"config": map[string]interface{}{"branches": next},
+			})
+		}
+	}
+
+	measures := MeasureComplexity(generated(steps...))
+	require.Equal(t, MeasureNestingDepth, measures[0].Name)
+	assert.Equal(t, levels, measures[0].Value)
+	assert.Equal(t, "steps[1]", measures[0].Path)
+	assert.Equal(t, "a0", measures[0].Trail[0])
+	assert.Equal(t, "a59", measures[0].Trail[levels-1])
+}
+
+func TestBuildGraph(t *testing.T) {
+	definition := generated(
+		map[string]interface{}{"name": "fetch", "type": "custom"},
+		map[string]interface{}{"name": "price", "type": "custom", "input": map[string]interface{}{"order": "${fetch.order}"}},
+		map[string]interface{}{"name": "audit", "type": "custom", "priority": "background", "depends_on": []interface{}{"fetch"}},
+	)
+	definition["output_mapping"] = map[string]interface{}{"total": "${price.total}"}
+
+	graph, err := BuildGraph(definition, DefaultViewLimits())
+	require.NoError(t, err)
+	assert.False(t, graph.Summarized)
+	assert.Equal(t, []GraphNode{
+		{Name: "fetch", Priority: models.StepPriority("normal"), DependsOn: []string{}, Critical: true},
+		{Name: "price", Priority: models.StepPriority("normal"), DependsOn: []string{"fetch"}, Critical: true},
+		{Name: "audit", Priority: models.StepPriority("background"), DependsOn: []string{"fetch"}},
+	}, graph.Nodes)
+	assert.Equal(t, 3, graph.Summary.Steps)
+	assert.Equal(t, 2, graph.Summary.Dependencies)
+	assert.Equal(t, 2, graph.Summary.CriticalSteps)
+
+	// Past the limit the graph is summarized
+	graph, err = BuildGraph(definition, ViewLimits{MaxGraphElements: 4})
+	require.NoError(t, err)
+	assert.True(t, graph.Summarized)
+	assert.Nil(t, graph.Nodes)
+	assert.Equal(t, "graph of 3 steps and 2 dependencies exceeds the limit of 4 elements", graph.SummaryReason)
+	assert.Equal(t, 3, graph.Summary.Steps)
+	require.Len(t, graph.Summary.Complexity, 5)
+	assert.Equal(t, Measure{Name: MeasureExpandedSteps, Value: 3, Path: "steps"}, graph.Summary.Complexity[1])
+}
+
+func TestComparisonOverLimit(t *testing.T) {
+	small, large := fanOut(1), fanOut(200)
+
+	_, over := comparisonOverLimit(small, small, DefaultViewLimits())
+	assert.False(t, over)
+
+	limits := ViewLimits{MaxComparisonBytes: 2 * encodedSize(small)}
+	_, over = comparisonOverLimit(small, small, limits)
+	assert.False(t, over, "definitions at the limit are compared in full")
+	reason, over := comparisonOverLimit(small, large, limits)
+	assert.True(t, over)
+	assert.Equal(t, fmt.Sprintf("definitions of %d bytes exceed the limit of %d bytes", encodedSize(small)+encodedSize(large), limits.MaxComparisonBytes), reason)
+
+	summary := summarizeDifferences([]VersionDifference{
+		{Type: DifferenceTypeModified, Path: "steps", Impact: ImpactLevel("high")},
+		{Type: DifferenceTypeAdded, Path: "steps[3]"},
+		{Type: DifferenceTypeModified, Path: "timeout", Impact: ImpactLevel("low")},
+	})
+	assert.Equal(t, 3, summary.TotalDifferences)
+	assert.Equal(t, map[DifferenceType]int{DifferenceTypeModified: 2, DifferenceTypeAdded: 1}, summary.ByType)
+	assert.Equal(t, map[ImpactLevel]int{"high": 1, "low": 1}, summary.ByImpact)
+}
@@ -0,0 +1,109 @@
+package versioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrUnknownCustomValidator is returned when a configured custom validator
+// is not registered
+var ErrUnknownCustomValidator = errors.New("unknown custom validator")
+
+// CustomValidator enforces a bespoke business rule on new versions of a
+// workflow. It returns nil for versions following the rule. A
+// *ValidationError reports problems on fields of the version definition,
+// such as metadata.owner; any other error is reported on the definition.
+type CustomValidator func(ctx context.Context, workflow *models.Workflow, changes VersionChanges) error
+
+// CustomValidatorRegistry maps names to custom validators, which
+// ValidationConfig.CustomValidators enables by name
+type CustomValidatorRegistry struct {
+	mu         sync.RWMutex
+	validators map[string]CustomValidator
+}
+
+// NewCustomValidatorRegistry creates an empty custom validator registry
+func NewCustomValidatorRegistry() *CustomValidatorRegistry {
+	return &CustomValidatorRegistry{validators: make(map[string]CustomValidator)}
+}
+
+// Register registers a custom validator under a name, replacing the
+// validator registered under it before
+func (r *CustomValidatorRegistry) Register(name string, validator CustomValidator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.validators[name] = validator
+}
+
+// Get returns the custom validator registered under a name
+func (r *CustomValidatorRegistry) Get(name string) (CustomValidator, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	validator, exists := r.validators[name]
+	return validator, exists
+}
+
+// Names returns the registered names in sorted order
+func (r *CustomValidatorRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.validators))
+	for name := range r.validators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetCustomValidatorRegistry sets the registry the custom validators named
+// in the validation config are looked up in
+func (v *Validator) SetCustomValidatorRegistry(registry *CustomValidatorRegistry) {
+	v.customValidators = registry
+}
+
+// UseCustomValidators enables custom validators by name. They run, in
+// order, with the business rules of every new version. Names must be
+// registered in the custom validator registry.
+func (v *Validator) UseCustomValidators(names ...string) error {
+	for _, name := range names {
+		if _, exists := v.customValidators.Get(name); !exists {
+			return fmt.Errorf("%w: %s", ErrUnknownCustomValidator, name)
+		}
+	}
+	v.config.CustomValidators = names
+	return nil
+}
+
+// UseCustomValidators sets the registry of custom validators and enables
+// the named ones for the versions the manager creates
+func (m *Manager) UseCustomValidators(registry *CustomValidatorRegistry, names ...string) error {
+	m.validator.SetCustomValidatorRegistry(registry)
+	return m.validator.UseCustomValidators(names...)
+}
+
+// runCustomValidators runs the configured custom validators, returning their
+// problems as a *ValidationError on the version definition
+func (v *Validator) runCustomValidators(ctx context.Context, workflow *models.Workflow, changes VersionChanges) error {
+	errs := &ValidationError{}
+	for _, name := range v.config.CustomValidators {
+		validator, exists := v.customValidators.Get(name)
+		if !exists {
+			errs.add("", CodeInvalidConfig, fmt.Sprintf("%v: %s", ErrUnknownCustomValidator, name))
+			continue
+		}
+
+		err := validator(ctx, workflow, changes)
+		var validationErr *ValidationError
+		if err != nil && !errors.As(err, &validationErr) {
+			err = fmt.Errorf("%s: %w", name, err)
+		}
+		errs.merge("", err)
+	}
+	return errs.err()
+}
@@ -0,0 +1,113 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Codes of validation field errors
+const (
+	// CodeRequired is returned for missing fields
+	CodeRequired = "REQUIRED"
+	// CodeInvalidType is returned for fields of the wrong JSON type
+	CodeInvalidType = "INVALID_TYPE"
+	// CodeInvalidValue is returned for fields holding a value they do not
+	// accept, such as a name with invalid characters
+	CodeInvalidValue = "INVALID_VALUE"
+	// CodeLimitExceeded is returned for fields longer or larger than allowed
+	CodeLimitExceeded = "LIMIT_EXCEEDED"
+	// CodeDuplicate is returned for step names used by several steps
+	CodeDuplicate = "DUPLICATE"
+	// CodeUnsupported is returned for step types that are not allowed
+	CodeUnsupported = "UNSUPPORTED"
+	// CodeInvalidConfig is returned for step configs failing their schema
+	CodeInvalidConfig = "INVALID_CONFIG"
+	// CodeInvalidGraph is returned for step graphs that cannot be scheduled,
+	// such as cycles or critical steps depending on background ones
+	CodeInvalidGraph = "INVALID_GRAPH"
+	// CodeInvalidScript is returned for script steps failing their static
+	// checks, unless the sandbox reports a more specific code
+	CodeInvalidScript = "INVALID_SCRIPT"
+	// CodeInvalidExpression is returned for ${...} expressions that do not
+	// parse, such as calls of unknown functions or with the wrong number of
+	// arguments
+	CodeInvalidExpression = "INVALID_EXPRESSION"
+	// CodeUnknownField is returned in strict mode for fields a definition
+	// or a step does not have, such as a misspelled stpes
+	CodeUnknownField = "UNKNOWN_FIELD"
+	// CodeInvalidExample is returned for example payloads that do not
+	// validate against the declared inputs or outputs
+	CodeInvalidExample = "INVALID_EXAMPLE"
+	// CodeIncompatible is returned for changes breaking the schema or the
+	// running executions of the current version
+	CodeIncompatible = "INCOMPATIBLE"
+)
+
+// FieldError is a problem of one field. Field is a path into the validated
+// value, such as steps[2].config.url.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+// ValidationError lists every problem found while validating a definition
+// or a version, so clients can report each on its field
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		if fieldErr.Field == "" {
+			messages[i] = fieldErr.Message
+			continue
+		}
+		messages[i] = fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field, code, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message, Code: code})
+}
+
+// merge adds the problems of err under path. Errors other than validation
+// errors are added as an invalid value of path itself.
+func (e *ValidationError) merge(path string, err error) {
+	if err == nil {
+		return
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		e.add(path, CodeInvalidValue, err.Error())
+		return
+	}
+	for _, fieldErr := range validationErr.Errors {
+		e.add(joinPath(path, fieldErr.Field), fieldErr.Code, fieldErr.Message)
+	}
+}
+
+// err returns the validation error, or nil when no problem was found
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// joinPath appends a field or an [index] to a field path
+func joinPath(path, field string) string {
+	switch {
+	case path == "":
+		return field
+	case field == "":
+		return path
+	case strings.HasPrefix(field, "["):
+		return path + field
+	default:
+		return path + "." + field
+	}
+}
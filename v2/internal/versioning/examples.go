@@ -0,0 +1,142 @@
+package versioning
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// exampleFields are the fields of a workflow example
+var exampleFields = []string{"name", "description", "input", "output"}
+
+// validateExamples checks the example payloads of a definition against its
+// inputs and outputs, so the examples shown in generated docs and used to
+// simulate executions stay truthful. Example inputs must hold every
+// required input and nothing undeclared; example outputs are checked the
+// same way. Definitions without inputs or outputs accept any object.
+// Fields whose declaration is invalid are reported by validateInputsOutputs
+// and are not checked here.
+func validateExamples(errs *ValidationError, path string, value, inputs, outputs interface{}) {
+	examples, ok := value.([]interface{})
+	if !ok {
+		errs.add(path, CodeInvalidType, "examples must be an array")
+		return
+	}
+
+	names := make(map[string]bool)
+	for i, item := range examples {
+		examplePath := fmt.Sprintf("%s[%d]", path, i)
+		example, ok := item.(map[string]interface{})
+		if !ok {
+			errs.add(examplePath, CodeInvalidType, "example must be an object")
+			continue
+		}
+		validateKnownFields(errs, examplePath, example, exampleFields)
+
+		if name, ok := example["name"].(string); ok && name != "" {
+			if names[name] {
+				errs.add(joinPath(examplePath, "name"), CodeDuplicate, fmt.Sprintf("duplicate example name: %s", name))
+			}
+			names[name] = true
+		}
+
+		input, exists := example["input"]
+		if !exists {
+			errs.add(joinPath(examplePath, "input"), CodeRequired, "example input is required")
+		} else {
+			validateExamplePayload(errs, joinPath(examplePath, "input"), input, inputs, "input")
+		}
+		if output, exists := example["output"]; exists {
+			validateExamplePayload(errs, joinPath(examplePath, "output"), output, outputs, "output")
+		}
+	}
+}
+
+// validateExamplePayload checks an example payload against the fields of
+// an inputs or outputs declaration
+func validateExamplePayload(errs *ValidationError, path string, value, declaration interface{}, kind string) {
+	payload, ok := value.(map[string]interface{})
+	if !ok {
+		errs.add(path, CodeInvalidExample, fmt.Sprintf("example %s must be an object", kind))
+		return
+	}
+	fields, ok := declaration.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field, _ := fields[name].(map[string]interface{})
+		fieldValue, exists := payload[name]
+		if !exists {
+			if required, _ := field["required"].(bool); required {
+				errs.add(joinPath(path, name), CodeInvalidExample, fmt.Sprintf("example %s is missing required field %s", kind, name))
+			}
+			continue
+		}
+		if fieldType, _ := field["type"].(string); !matchesFieldType(fieldValue, fieldType) {
+			errs.add(joinPath(path, name), CodeInvalidExample, fmt.Sprintf("example %s field %s must be of type %s", kind, name, fieldType))
+		}
+	}
+
+	var undeclared []string
+	for name := range payload {
+		if _, declared := fields[name]; !declared {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		errs.add(joinPath(path, name), CodeInvalidExample, fmt.Sprintf("example %s field %s is not declared in the workflow %ss", kind, name, kind))
+	}
+}
+
+// matchesFieldType reports whether a decoded JSON or YAML value is of a
+// declared field type. Unknown types match any value, nulls match none.
+func matchesFieldType(value interface{}, fieldType string) bool {
+	switch fieldType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		number, ok := toFloat(value)
+		return ok && number == math.Trunc(number)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	default:
+		return true
+	}
+}
+
+// toFloat converts the numbers decoded from JSON and YAML definitions
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
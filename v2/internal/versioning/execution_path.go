@@ -0,0 +1,61 @@
+package versioning
+
+import (
+	"fmt"
+
+	"magic-flow/v2/pkg/models"
+)
+
+// DecideExecutionPath decides the execution mode of a version from its
+// definition. Definitions asking for the lightweight mode run in it unless
+// a step, or a step defined inline in a loop, uses a feature lightweight
+// executions cannot run, in which case the version falls back to the
+// standard mode and the offending steps are recorded.
+func DecideExecutionPath(definition map[string]interface{}) *models.ExecutionPath {
+	requested := models.ExecutionModeStandard
+	if mode, _ := definition["execution_mode"].(string); mode != "" {
+		requested = models.ExecutionMode(mode)
+	}
+	path := &models.ExecutionPath{Requested: requested, Mode: models.ExecutionModeStandard}
+	if requested != models.ExecutionModeLightweight {
+		return path
+	}
+
+	visit := func(stepPath string, step map[string]interface{}) {
+		stepType, _ := step["type"].(string)
+		if feature := models.LightweightIncompatibility(stepType); feature != "" {
+			path.Fallbacks = append(path.Fallbacks, fmt.Sprintf("%s (%s): %s", stepPath, stepName(step), feature))
+		}
+	}
+	steps, _ := definition["steps"].([]interface{})
+	for i, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stepPath := fmt.Sprintf("steps[%d]", i)
+		visit(stepPath, step)
+		walkInlineSteps(stepPath, step, visit)
+	}
+
+	if len(path.Fallbacks) == 0 {
+		path.Mode = models.ExecutionModeLightweight
+	}
+	return path
+}
+
+// validateExecutionMode validates the execution mode of a definition
+func validateExecutionMode(errs *ValidationError, definition map[string]interface{}) {
+	value, exists := definition["execution_mode"]
+	if !exists {
+		return
+	}
+	mode, ok := value.(string)
+	if !ok {
+		errs.add("execution_mode", CodeInvalidType, "execution_mode must be a string")
+		return
+	}
+	if err := models.ValidateExecutionMode(models.ExecutionMode(mode)); err != nil {
+		errs.add("execution_mode", CodeInvalidValue, err.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package versioning
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"magic-flow/v2/internal/expressions"
+)
+
+// expressionFields are the step fields holding ${...} expressions
+var expressionFields = []string{"input", "config", "condition", "output", "data_mapping"}
+
+// referencePath matches the references that are paths rather than
+// expressions, such as ${fetch-customer.items[0]}, whose names may hold
+// dashes
+var referencePath = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+|\[[0-9]+\])*$`)
+
+// validateStepExpressions adds a problem on every expression of a step that
+// does not parse
+func validateStepExpressions(errs *ValidationError, path string, step map[string]interface{}) {
+	for _, field := range expressionFields {
+		if value, exists := step[field]; exists {
+			validateExpressions(errs, joinPath(path, field), value)
+		}
+	}
+}
+
+// validateExpressions checks the ${...} expressions of the strings of a
+// value, walking maps and slices, and the bare expressions of conditions
+// with the expression operator. Function names and argument counts are
+// checked when expressions are parsed.
+func validateExpressions(errs *ValidationError, path string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		for _, source := range expressions.EmbeddedAll(v) {
+			if referencePath.MatchString(source) {
+				continue
+			}
+			if _, err := expressions.Parse(source); err != nil {
+				errs.add(path, CodeInvalidExpression, fmt.Sprintf("invalid expression ${%s}: %v", source, err))
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if source, ok := v[key].(string); ok && key == "expression" && v["operator"] == "expression" {
+				if _, err := expressions.Parse(source); err != nil {
+					errs.add(joinPath(path, key), CodeInvalidExpression, fmt.Sprintf("invalid expression %q: %v", source, err))
+				}
+				continue
+			}
+			validateExpressions(errs, joinPath(path, key), v[key])
+		}
+	case []interface{}:
+		for i, item := range v {
+			validateExpressions(errs, joinPath(path, fmt.Sprintf("[%d]", i)), item)
+		}
+	}
+}
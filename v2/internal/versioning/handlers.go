@@ -2,6 +2,7 @@ package versioning
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -10,6 +11,8 @@ import (
 	"github.com/google/uuid"
 
 	"magic-flow/v2/internal/database"
+	"magic-flow/v2/internal/gates"
+	"magic-flow/v2/internal/policies"
 	"magic-flow/v2/pkg/models"
 )
 
@@ -25,6 +28,16 @@ func NewHandlers(repoManager database.RepositoryManager) *Handlers {
 	}
 }
 
+// SetGates sets the checker of the activation gates of versions
+func (h *Handlers) SetGates(checker *gates.Checker) {
+	h.manager.SetGates(checker)
+}
+
+// SetWatch sets where the versions created and activated are published
+func (h *Handlers) SetWatch(watch VersionWatch) {
+	h.manager.SetWatch(watch)
+}
+
 // CreateVersionRequest represents a request to create a new version
 type CreateVersionRequest struct {
 	ChangeType    ChangeType             `json:"change_type" binding:"required"`
@@ -37,6 +50,9 @@ type CreateVersionRequest struct {
 // ActivateVersionRequest represents a request to activate a version
 type ActivateVersionRequest struct {
 	VersionID uuid.UUID `json:"version_id" binding:"required"`
+	// OverrideJustification overrides unsatisfied activation gates, for
+	// users permitted to
+	OverrideJustification string `json:"override_justification,omitempty"`
 }
 
 // RollbackRequest represents a request to rollback to a previous version
@@ -94,6 +110,9 @@ func (h *Handlers) CreateVersion(c *gin.Context) {
 	// Create the version
 	version, err := h.manager.CreateVersion(c.Request.Context(), workflowID, changes)
 	if err != nil {
+		if validationErrorResponse(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -192,9 +211,41 @@ func (h *Handlers) GetVersion(c *gin.Context) {
 	})
 }
 
+// GetVersionGraph gets the step graph of a version
+// @Summary Get workflow version graph
+// @Description Get the steps of a version and their dependencies, summarized when the graph is over the view limits
+// @Tags versioning
+// @Produce json
+// @Param workflow_id path string true "Workflow ID"
+// @Param version_id path string true "Version ID"
+// @Success 200 {object} VersionGraph
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/v1/workflows/{workflow_id}/versions/{version_id}/graph [get]
+func (h *Handlers) GetVersionGraph(c *gin.Context) {
+	workflowID, err := uuid.Parse(c.Param("workflow_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+		return
+	}
+	versionID, err := uuid.Parse(c.Param("version_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version ID"})
+		return
+	}
+
+	graph, err := h.manager.GetVersionGraph(c.Request.Context(), workflowID, versionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
+
 // ActivateVersion activates a specific version
 // @Summary Activate workflow version
-// @Description Activate a specific version of a workflow
+// @Description Activate a specific version of a workflow. Versions failing the activation gates of their namespace are rejected with the checklist, unless overridden with a justification by a permitted user.
 // @Tags versioning
 // @Accept json
 // @Produce json
@@ -202,7 +253,9 @@ func (h *Handlers) GetVersion(c *gin.Context) {
 // @Param request body ActivateVersionRequest true "Version activation request"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/v1/workflows/{workflow_id}/versions/activate [post]
 func (h *Handlers) ActivateVersion(c *gin.Context) {
@@ -212,18 +265,45 @@ func (h *Handlers) ActivateVersion(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+	if req.OverrideJustification != "" {
+		ctx = gates.WithOverride(ctx, c.GetHeader("X-User-ID"), req.OverrideJustification)
+	}
+
 	// Activate the version
-	err := h.manager.ActivateVersion(c.Request.Context(), req.VersionID)
+	policyResult, err := h.manager.ActivateVersion(ctx, req.VersionID)
+	var denied *policies.DeniedError
+	if errors.As(err, &denied) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "policy": denied.Result})
+		return
+	}
+	var blocked *gates.BlockedError
+	if errors.As(err, &blocked) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "gates": blocked.Report})
+		return
+	}
+	switch {
+	case errors.Is(err, gates.ErrJustificationRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, gates.ErrOverrideForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "Version activated successfully",
 		"version_id": req.VersionID,
 		"activated_at": time.Now(),
-	})
+	}
+	if policyResult != nil && policyResult.Decision == policies.DecisionWarn {
+		response["policy"] = policyResult
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // RollbackToVersion rolls back a workflow to a previous version
@@ -415,6 +495,9 @@ func (h *Handlers) ValidateVersion(c *gin.Context) {
 	// Validate the version
 	err = h.manager.ValidateVersion(c.Request.Context(), workflowID, changes)
 	if err != nil {
+		if validationErrorResponse(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"valid": false,
 			"error": err.Error(),
@@ -425,7 +508,23 @@ func (h *Handlers) ValidateVersion(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"valid": true,
 		"message": "Version definition is valid",
+		"warnings": h.manager.Warnings(c.Request.Context(), workflowID, changes.NewDefinition),
+	})
+}
+
+// validationErrorResponse responds with the field errors of a validation
+// error as a 400, reporting whether err was one
+func validationErrorResponse(c *gin.Context, err error) bool {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"valid":  false,
+		"error":  err.Error(),
+		"errors": validationErr.Errors,
 	})
+	return true
 }
 
 // GetVersionMetrics gets metrics for version management
@@ -527,6 +626,7 @@ func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
 				versions.POST("", h.CreateVersion)
 				versions.GET("", h.GetVersionHistory)
 				versions.GET("/:version_id", h.GetVersion)
+				versions.GET("/:version_id/graph", h.GetVersionGraph)
 				versions.POST("/activate", h.ActivateVersion)
 				versions.POST("/rollback", h.RollbackToVersion)
 				versions.POST("/compare", h.CompareVersions)
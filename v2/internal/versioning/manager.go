@@ -2,6 +2,7 @@ package versioning
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,6 +10,9 @@ import (
 	"gorm.io/gorm"
 
 	"magic-flow/v2/internal/database"
+	"magic-flow/v2/internal/gates"
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/internal/scripting"
 	"magic-flow/v2/pkg/models"
 )
 
@@ -17,6 +21,28 @@ type Manager struct {
 	repoManager database.RepositoryManager
 	migrator    *Migrator
 	validator   *Validator
+	modules     *scripting.ModuleRegistry
+	policies    *policies.Manager
+	gates       *gates.Checker
+	warmer      VersionWarmer
+	flags       FlagLinter
+	viewLimits  ViewLimits
+	deps        DependencyRecorder
+	watch       VersionWatch
+}
+
+// VersionWarmer prepares the executors of the steps of activated versions.
+// It is satisfied by the engine.
+type VersionWarmer interface {
+	// WarmVersion must return at once, warming up in the background
+	WarmVersion(version *models.WorkflowVersion)
+}
+
+// VersionWatch publishes the versions created and activated to the
+// watchers of workflow definitions. The watch Hub implements it.
+type VersionWatch interface {
+	VersionCreated(ctx context.Context, version *models.WorkflowVersion)
+	VersionActivated(ctx context.Context, version *models.WorkflowVersion)
 }
 
 // NewManager creates a new versioning manager
@@ -24,10 +50,67 @@ func NewManager(repoManager database.RepositoryManager) *Manager {
 	return &Manager{
 		repoManager: repoManager,
 		migrator:    NewMigrator(repoManager),
-		validator:   NewValidator(),
+		validator:   NewValidator(nil),
+		viewLimits:  DefaultViewLimits(),
 	}
 }
 
+// SetPolicies sets the manager evaluating the version activation policies
+func (m *Manager) SetPolicies(manager *policies.Manager) {
+	m.policies = manager
+}
+
+// SetGates sets the checker of the activation gates of versions
+func (m *Manager) SetGates(checker *gates.Checker) {
+	m.gates = checker
+}
+
+// FlagLinter reports the feature flags a definition references that are not
+// defined for its workflow. It is satisfied by flags.Manager.
+type FlagLinter interface {
+	Lint(ctx context.Context, workflowID uuid.UUID, namespace string, definition interface{}) ([]string, error)
+}
+
+// SetFlagLinter sets the linter of the feature flag references of
+// definitions
+func (m *Manager) SetFlagLinter(linter FlagLinter) {
+	m.flags = linter
+}
+
+// DependencyRecorder records the workflows the definition of a version
+// depends on. It is satisfied by dependencies.Graph.
+type DependencyRecorder interface {
+	RecordVersion(ctx context.Context, version *models.WorkflowVersion) error
+}
+
+// SetDependencies sets the recorder of the dependencies of new versions
+func (m *Manager) SetDependencies(recorder DependencyRecorder) {
+	m.deps = recorder
+}
+
+// SetViewLimits sets the limits over which version graphs and comparisons
+// are summarized
+func (m *Manager) SetViewLimits(limits ViewLimits) {
+	m.viewLimits = limits
+}
+
+// SetMetrics sets the recorder of the complexity metrics of the definitions
+// of new versions
+func (m *Manager) SetMetrics(metrics MetricsRecorder) {
+	m.validator.SetMetrics(metrics)
+}
+
+// SetWarmer sets the warmer of activated versions
+func (m *Manager) SetWarmer(warmer VersionWarmer) {
+	m.warmer = warmer
+}
+
+// SetWatch sets where the versions created and activated are published.
+// Rollbacks are published as activations of the target version.
+func (m *Manager) SetWatch(watch VersionWatch) {
+	m.watch = watch
+}
+
 // CreateVersion creates a new version of a workflow
 func (m *Manager) CreateVersion(ctx context.Context, workflowID uuid.UUID, changes VersionChanges) (*models.WorkflowVersion, error) {
 	workflowRepo := m.repoManager.WorkflowRepository()
@@ -56,6 +139,13 @@ func (m *Manager) CreateVersion(ctx context.Context, workflowID uuid.UUID, chang
 		return nil, fmt.Errorf("version validation failed: %w", err)
 	}
 
+	// Pin the modules required by script steps
+	if m.modules != nil {
+		if err := pinScriptModules(ctx, m.modules, changes.NewDefinition); err != nil {
+			return nil, fmt.Errorf("failed to pin script modules: %w", err)
+		}
+	}
+
 	// Create new version
 	newVersion := &models.WorkflowVersion{
 		WorkflowID:    workflowID,
@@ -67,6 +157,9 @@ func (m *Manager) CreateVersion(ctx context.Context, workflowID uuid.UUID, chang
 		CreatedBy:     changes.CreatedBy,
 		IsActive:      false, // Will be activated after successful migration
 		Metadata:      changes.Metadata,
+		// Versions asking for the lightweight execution mode fall back to
+		// the standard one when they use features it cannot run
+		ExecutionPath: DecideExecutionPath(changes.NewDefinition),
 	}
 
 	// Save the new version
@@ -89,31 +182,72 @@ func (m *Manager) CreateVersion(ctx context.Context, workflowID uuid.UUID, chang
 		return nil, fmt.Errorf("failed to update version with migration plan: %w", err)
 	}
 
+	// Record the workflows the new definition depends on
+	if m.deps != nil {
+		if err := m.deps.RecordVersion(ctx, newVersion); err != nil {
+			return nil, fmt.Errorf("failed to record version dependencies: %w", err)
+		}
+	}
+
+	if m.watch != nil {
+		m.watch.VersionCreated(ctx, newVersion)
+	}
+
 	return newVersion, nil
 }
 
-// ActivateVersion activates a specific version of a workflow
-func (m *Manager) ActivateVersion(ctx context.Context, versionID uuid.UUID) error {
+// ActivateVersion activates a specific version of a workflow. The version
+// activation policies are evaluated first: the activation fails with a
+// policies.DeniedError when they deny it, and the returned result lists
+// their warnings otherwise. The activation gates are evaluated next and the
+// activation fails with a gates.BlockedError when some are unsatisfied,
+// unless the context carries a gates.WithOverride. Once activated, the
+// executors of its steps warm up in the background.
+func (m *Manager) ActivateVersion(ctx context.Context, versionID uuid.UUID) (*policies.Result, error) {
 	versionRepo := m.repoManager.WorkflowVersionRepository()
 	workflowRepo := m.repoManager.WorkflowRepository()
 
 	// Get the version to activate
 	version, err := versionRepo.GetByID(ctx, versionID)
 	if err != nil {
-		return fmt.Errorf("failed to get version: %w", err)
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+
+	workflow, err := workflowRepo.GetByID(ctx, version.WorkflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+
+	// Evaluate the version activation policies before migrating anything
+	var policyResult *policies.Result
+	if m.policies != nil {
+		policyResult, err = m.policies.EvaluateActivation(ctx, &policies.ActivationRequest{Workflow: workflow, Version: version})
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate activation policies: %w", err)
+		}
+		if err := policyResult.Err(); err != nil {
+			return policyResult, err
+		}
+	}
+
+	// Evaluate the activation gates afresh
+	if m.gates != nil {
+		if _, err := m.gates.CheckActivation(ctx, versionID); err != nil {
+			return policyResult, err
+		}
 	}
 
 	// Get current active version
 	currentVersion, err := versionRepo.GetActiveVersion(ctx, version.WorkflowID)
 	if err != nil && err != gorm.ErrRecordNotFound {
-		return fmt.Errorf("failed to get current active version: %w", err)
+		return nil, fmt.Errorf("failed to get current active version: %w", err)
 	}
 
 	// Execute migration if needed
 	if currentVersion != nil {
 		err = m.migrator.ExecuteMigration(ctx, currentVersion, version)
 		if err != nil {
-			return fmt.Errorf("migration failed: %w", err)
+			return nil, fmt.Errorf("migration failed: %w", err)
 		}
 	}
 
@@ -133,7 +267,7 @@ func (m *Manager) ActivateVersion(ctx context.Context, versionID uuid.UUID) erro
 		err = versionRepo.UpdateWithTx(ctx, tx, currentVersion)
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to deactivate current version: %w", err)
+			return nil, fmt.Errorf("failed to deactivate current version: %w", err)
 		}
 	}
 
@@ -144,16 +278,10 @@ func (m *Manager) ActivateVersion(ctx context.Context, versionID uuid.UUID) erro
 	err = versionRepo.UpdateWithTx(ctx, tx, version)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to activate new version: %w", err)
+		return nil, fmt.Errorf("failed to activate new version: %w", err)
 	}
 
 	// Update workflow with new definition
-	workflow, err := workflowRepo.GetByID(ctx, version.WorkflowID)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to get workflow: %w", err)
-	}
-
 	workflow.Definition = version.Definition
 	workflow.Version = version.Version
 	workflow.UpdatedAt = time.Now()
@@ -161,16 +289,25 @@ func (m *Manager) ActivateVersion(ctx context.Context, versionID uuid.UUID) erro
 	err = workflowRepo.UpdateWithTx(ctx, tx, workflow)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to update workflow: %w", err)
+		return nil, fmt.Errorf("failed to update workflow: %w", err)
 	}
 
 	// Commit transaction
 	err = tx.Commit().Error
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
+	// Warm the executors up for the first executions of the version
+	if m.warmer != nil {
+		m.warmer.WarmVersion(version)
+	}
+
+	if m.watch != nil {
+		m.watch.VersionActivated(ctx, version)
+	}
+
+	return policyResult, nil
 }
 
 // RollbackToVersion rolls back a workflow to a previous version
@@ -230,7 +367,7 @@ func (m *Manager) RollbackToVersion(ctx context.Context, workflowID uuid.UUID, t
 	}
 
 	// Activate target version
-	err = m.ActivateVersion(ctx, targetVersionID)
+	_, err = m.ActivateVersion(ctx, targetVersionID)
 	if err != nil {
 		return fmt.Errorf("failed to activate target version: %w", err)
 	}
@@ -238,6 +375,15 @@ func (m *Manager) RollbackToVersion(ctx context.Context, workflowID uuid.UUID, t
 	return nil
 }
 
+// GetVersion returns a specific version of a workflow
+func (m *Manager) GetVersion(ctx context.Context, versionID uuid.UUID) (*models.WorkflowVersion, error) {
+	version, err := m.repoManager.WorkflowVersionRepository().GetByID(ctx, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+	return version, nil
+}
+
 // GetVersionHistory returns the version history for a workflow
 func (m *Manager) GetVersionHistory(ctx context.Context, workflowID uuid.UUID) ([]*models.WorkflowVersion, error) {
 	versionRepo := m.repoManager.WorkflowVersionRepository()
@@ -265,16 +411,55 @@ func (m *Manager) CompareVersions(ctx context.Context, version1ID, version2ID uu
 	}
 
 	// Compare definitions
+	differences := m.calculateDifferences(version1.Definition, version2.Definition)
+	summary := summarizeDifferences(differences)
+	summary.Compatibility = m.calculateCompatibility(version1, version2)
 	comparison := &VersionComparison{
 		Version1:    version1,
 		Version2:    version2,
-		Differences: m.calculateDifferences(version1.Definition, version2.Definition),
+		Differences: differences,
+		Summary:     summary,
 		GeneratedAt: time.Now(),
 	}
 
+	// Leave large definitions out, keeping the differences
+	if reason, over := comparisonOverLimit(version1.Definition, version2.Definition, m.viewLimits); over {
+		comparison.Version1 = withoutDefinition(version1)
+		comparison.Version2 = withoutDefinition(version2)
+		comparison.Summarized = true
+		comparison.SummaryReason = reason
+	}
+
 	return comparison, nil
 }
 
+// GetVersionGraph returns the step graph of a version of a workflow,
+// summarized when over the view limits
+func (m *Manager) GetVersionGraph(ctx context.Context, workflowID, versionID uuid.UUID) (*VersionGraph, error) {
+	version, err := m.repoManager.WorkflowVersionRepository().GetByID(ctx, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+	if version.WorkflowID != workflowID {
+		return nil, fmt.Errorf("version does not belong to the specified workflow")
+	}
+
+	graph, err := BuildGraph(version.Definition, m.viewLimits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build version graph: %w", err)
+	}
+	graph.VersionID = version.ID
+	graph.Version = version.Version
+	return graph, nil
+}
+
+// withoutDefinition returns a copy of a version without its definition
+func withoutDefinition(version *models.WorkflowVersion) *models.WorkflowVersion {
+	trimmed := *version
+	trimmed.Definition = nil
+	return &trimmed
+}
+
 // GetCompatibilityMatrix returns compatibility information between versions
 func (m *Manager) GetCompatibilityMatrix(ctx context.Context, workflowID uuid.UUID) (*CompatibilityMatrix, error) {
 	versions, err := m.GetVersionHistory(ctx, workflowID)
@@ -334,6 +519,78 @@ func (m *Manager) ValidateVersion(ctx context.Context, workflowID uuid.UUID, cha
 	return m.validator.ValidateVersion(ctx, workflow, changes)
 }
 
+// StepConfigWarnings returns non-fatal step config problems of a definition
+func (m *Manager) StepConfigWarnings(definition map[string]interface{}) []string {
+	return m.validator.StepConfigWarnings(definition)
+}
+
+// Warnings returns the non-fatal problems of a definition of a workflow: its
+// step config problems, the complexity measures over their soft limit and
+// its references to undefined feature flags
+func (m *Manager) Warnings(ctx context.Context, workflowID uuid.UUID, definition map[string]interface{}) []string {
+	var workflow *models.Workflow
+	if found, err := m.repoManager.WorkflowRepository().GetByID(ctx, workflowID); err == nil {
+		workflow = found
+	}
+	namespace := namespaceOf(definition, workflow)
+
+	warnings := m.StepConfigWarnings(definition)
+	warnings = append(warnings, m.validator.ComplexityWarnings(definition, namespace)...)
+	if m.flags == nil {
+		return warnings
+	}
+
+	flagWarnings, err := m.flags.Lint(ctx, workflowID, namespace, definition)
+	if err != nil {
+		return append(warnings, fmt.Sprintf("feature flag references could not be checked: %v", err))
+	}
+	return append(warnings, flagWarnings...)
+}
+
+// GateVersion returns the version activation gates are evaluated for
+func (m *Manager) GateVersion(ctx context.Context, versionID uuid.UUID) (*gates.Version, error) {
+	version, err := m.repoManager.WorkflowVersionRepository().GetByID(ctx, versionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, gates.ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+
+	var workflow *models.Workflow
+	if found, err := m.repoManager.WorkflowRepository().GetByID(ctx, version.WorkflowID); err == nil {
+		workflow = found
+	}
+	return &gates.Version{
+		ID:         version.ID,
+		WorkflowID: version.WorkflowID,
+		Version:    version.Version,
+		Namespace:  namespaceOf(version.Definition, workflow),
+		Author:     version.CreatedBy,
+	}, nil
+}
+
+// LintVersion returns the validation errors and the warnings of the
+// definition of a version, for lint-clean activation gates
+func (m *Manager) LintVersion(ctx context.Context, versionID uuid.UUID) ([]string, error) {
+	version, err := m.repoManager.WorkflowVersionRepository().GetByID(ctx, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+
+	var issues []string
+	if err := m.validator.ValidateDefinition(ctx, version.Definition); err != nil {
+		var validation *ValidationError
+		if !errors.As(err, &validation) {
+			return nil, err
+		}
+		for _, fieldError := range validation.Errors {
+			issues = append(issues, fmt.Sprintf("%s: %s", fieldError.Field, fieldError.Message))
+		}
+	}
+	return append(issues, m.Warnings(ctx, version.WorkflowID, version.Definition)...), nil
+}
+
 // Helper methods
 
 func (m *Manager) calculateNextVersion(currentVersion string, changeType ChangeType) string {
@@ -0,0 +1,122 @@
+package versioning
+
+import (
+	"context"
+	"fmt"
+
+	"magic-flow/v2/internal/scripting"
+)
+
+// SetModuleRegistry sets the script module registry used to check that the
+// modules required by javascript script steps exist
+func (v *Validator) SetModuleRegistry(modules *scripting.ModuleRegistry) {
+	v.modules = modules
+}
+
+// SetModuleRegistry sets the script module registry used to validate and
+// pin the modules required by javascript script steps
+func (m *Manager) SetModuleRegistry(modules *scripting.ModuleRegistry) {
+	m.modules = modules
+	m.validator.SetModuleRegistry(modules)
+}
+
+// validateScripts statically checks javascript script steps against the host
+// function allowlist of the definition and the published modules, returning
+// the problems as a *ValidationError on the command of each step
+func (v *Validator) validateScripts(ctx context.Context, definition map[string]interface{}) error {
+	allowed := allowedHostFunctions(definition)
+
+	errs := &ValidationError{}
+	for _, script := range javascriptSteps(definition) {
+		path := fmt.Sprintf("steps[%d].config.command", script.index)
+		analysis := scripting.Analyze(script.source)
+		if err := scripting.CheckHostFunctions(analysis, allowed); err != nil {
+			errs.add(path, scriptErrorCode(err), fmt.Sprintf("step %s: %v", script.name, err))
+		}
+
+		if v.modules == nil {
+			continue
+		}
+		for _, spec := range analysis.Requires {
+			if _, err := v.modules.Resolve(ctx, spec); err != nil {
+				errs.add(path, scriptErrorCode(err), fmt.Sprintf("step %s: %v", script.name, err))
+			}
+		}
+	}
+
+	return errs.err()
+}
+
+// scriptErrorCode returns the sandbox code of a script error, or
+// CodeInvalidScript
+func scriptErrorCode(err error) string {
+	if code := scripting.ErrorCode(err); code != "" {
+		return code
+	}
+	return CodeInvalidScript
+}
+
+// pinScriptModules resolves the modules required by javascript script steps
+// and records the exact versions in the step configs, freezing module
+// resolution for the version being created
+func pinScriptModules(ctx context.Context, modules *scripting.ModuleRegistry, definition map[string]interface{}) error {
+	for _, script := range javascriptSteps(definition) {
+		pins, err := modules.Pin(ctx, scripting.Analyze(script.source).Requires)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", script.name, err)
+		}
+
+		if len(pins) == 0 {
+			delete(script.config, "modules")
+			continue
+		}
+		pinned := make(map[string]interface{}, len(pins))
+		for spec, ref := range pins {
+			pinned[spec] = ref
+		}
+		script.config["modules"] = pinned
+	}
+
+	return nil
+}
+
+type javascriptStep struct {
+	index  int
+	name   string
+	source string
+	config map[string]interface{}
+}
+
+func javascriptSteps(definition map[string]interface{}) []javascriptStep {
+	steps, _ := definition["steps"].([]interface{})
+
+	var scripts []javascriptStep
+	for i, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok || step["type"] != "script" {
+			continue
+		}
+		config, ok := step["config"].(map[string]interface{})
+		if !ok || config["language"] != "javascript" {
+			continue
+		}
+		name, _ := step["name"].(string)
+		source, _ := config["command"].(string)
+		scripts = append(scripts, javascriptStep{index: i, name: name, source: source, config: config})
+	}
+
+	return scripts
+}
+
+func allowedHostFunctions(definition map[string]interface{}) []string {
+	scripts, _ := definition["scripts"].(map[string]interface{})
+	names, _ := scripts["allowed_host_functions"].([]interface{})
+
+	allowed := make([]string, 0, len(names))
+	for _, name := range names {
+		if s, ok := name.(string); ok {
+			allowed = append(allowed, s)
+		}
+	}
+	return allowed
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 
 	"magic-flow/v2/internal/database"
+	"magic-flow/v2/internal/policies"
 	"magic-flow/v2/pkg/models"
 )
 
@@ -49,10 +50,15 @@ func NewService(repoManager database.RepositoryManager, config *VersioningConfig
 		}
 	}
 
+	// The manager validates the versions it creates against the same limits
+	validator := NewValidator(config.Validation)
+	manager := NewManager(repoManager)
+	manager.validator = validator
+
 	return &Service{
-		manager:   NewManager(repoManager),
+		manager:   manager,
 		migrator:  NewMigrator(repoManager),
-		validator: NewValidator(),
+		validator: validator,
 		config:    config,
 	}
 }
@@ -83,21 +89,22 @@ func (s *Service) CreateVersion(ctx context.Context, workflowID uuid.UUID, chang
 	return version, nil
 }
 
-// ActivateVersion activates a version with migration and notifications
-func (s *Service) ActivateVersion(ctx context.Context, versionID uuid.UUID) error {
+// ActivateVersion activates a version with migration and notifications. The
+// returned result lists the warnings of the activation policies.
+func (s *Service) ActivateVersion(ctx context.Context, versionID uuid.UUID) (*policies.Result, error) {
 	// Send migration start notification
 	if s.config.NotificationSettings.Enabled && s.config.NotificationSettings.OnMigrationStart {
 		go s.sendMigrationStartNotification(ctx, versionID)
 	}
 
 	// Activate the version
-	err := s.manager.ActivateVersion(ctx, versionID)
+	policyResult, err := s.manager.ActivateVersion(ctx, versionID)
 	if err != nil {
 		// Send migration failed notification
 		if s.config.NotificationSettings.Enabled && s.config.NotificationSettings.OnMigrationFailed {
 			go s.sendMigrationFailedNotification(ctx, versionID, err)
 		}
-		return fmt.Errorf("failed to activate version: %w", err)
+		return policyResult, fmt.Errorf("failed to activate version: %w", err)
 	}
 
 	// Send activation and migration complete notifications
@@ -110,7 +117,7 @@ func (s *Service) ActivateVersion(ctx context.Context, versionID uuid.UUID) erro
 		}
 	}
 
-	return nil
+	return policyResult, nil
 }
 
 // RollbackToVersion performs a rollback with validation and notifications
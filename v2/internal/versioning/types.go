@@ -109,6 +109,10 @@ type VersionComparison struct {
 	Differences []VersionDifference     `json:"differences"`
 	Summary     ComparisonSummary       `json:"summary"`
 	GeneratedAt time.Time               `json:"generated_at"`
+	// Summarized is set when the definitions of the versions were left out
+	// for being over the view limits, SummaryReason telling why
+	Summarized    bool   `json:"summarized,omitempty"`
+	SummaryReason string `json:"summary_reason,omitempty"`
 }
 
 // VersionDifference represents a difference between two versions
@@ -254,6 +258,7 @@ type VersioningConfig struct {
 	MaxRollbackDepth     int                    `json:"max_rollback_depth"`
 	BackupBeforeMigration bool                   `json:"backup_before_migration"`
 	ValidationRules      []ValidationRule       `json:"validation_rules"`
+	Validation           *ValidationConfig      `json:"validation,omitempty"`
 	NotificationSettings NotificationSettings   `json:"notification_settings"`
 	RetentionPolicy      RetentionPolicy        `json:"retention_policy"`
 }
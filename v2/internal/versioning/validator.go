@@ -2,16 +2,28 @@ package versioning
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/internal/scripting"
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/internal/tabular"
 	"magic-flow/v2/pkg/models"
 )
 
 // Validator handles validation of workflow versions and migrations
 type Validator struct {
-	config *ValidationConfig
+	config           *ValidationConfig
+	schemas          *stepconfig.Registry
+	modules          *scripting.ModuleRegistry
+	customValidators *CustomValidatorRegistry
+	metrics          MetricsRecorder
 }
 
 // ValidationConfig contains configuration for validation
@@ -19,50 +31,123 @@ type ValidationConfig struct {
 	StrictMode          bool     `json:"strict_mode"`
 	AllowedStepTypes    []string `json:"allowed_step_types"`
 	MaxStepsPerWorkflow int      `json:"max_steps_per_workflow"`
+	MaxNestingDepth     int      `json:"max_nesting_depth"`
 	RequiredFields      []string `json:"required_fields"`
 	CustomValidators    []string `json:"custom_validators"`
+	// Complexity bounds the complexity of definitions per namespace
+	Complexity ComplexityConfig `json:"complexity"`
+}
+
+// DefaultValidationConfig returns the default validation config
+func DefaultValidationConfig() *ValidationConfig {
+	return &ValidationConfig{
+		StrictMode:          false,
+		AllowedStepTypes:    []string{"http", "script", "condition", "loop", "parallel", "transform", "notify", "lock", "unlock", "parse_table", "custom"},
+		MaxStepsPerWorkflow: 100,
+		MaxNestingDepth:     5,
+		RequiredFields:      []string{"name", "steps"},
+		Complexity:          DefaultComplexityConfig(),
+	}
 }
 
-// NewValidator creates a new validator instance
-func NewValidator() *Validator {
+// NewValidator creates a new validator instance validating against a
+// config, the default config when nil
+func NewValidator(config *ValidationConfig) *Validator {
+	if config == nil {
+		config = DefaultValidationConfig()
+	}
 	return &Validator{
-		config: &ValidationConfig{
-			StrictMode:          false,
-			AllowedStepTypes:    []string{"http", "script", "condition", "loop", "parallel", "custom"},
-			MaxStepsPerWorkflow: 100,
-			RequiredFields:      []string{"name", "steps"},
-		},
+		config:           config,
+		schemas:          stepconfig.Builtin(),
+		customValidators: NewCustomValidatorRegistry(),
+	}
+}
+
+// SetSchemaRegistry sets the step config schemas used to validate step
+// configs, typically the schemas of the engine's registered executors
+func (v *Validator) SetSchemaRegistry(schemas *stepconfig.Registry) {
+	v.schemas = schemas
+}
+
+// StepConfigWarnings returns the warnings raised while validating the step
+// configs of a definition, such as unknown fields outside of strict mode
+func (v *Validator) StepConfigWarnings(definition map[string]interface{}) []string {
+	steps, _ := definition["steps"].([]interface{})
+
+	var warnings []string
+	for _, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stepType, _ := step["type"].(string)
+		stepWarnings, _ := v.checkStepConfig(step, stepType)
+		name, _ := step["name"].(string)
+		for _, warning := range stepWarnings {
+			warnings = append(warnings, fmt.Sprintf("step %s: %s", name, warning))
+		}
+	}
+
+	return warnings
+}
+
+// ValidateDefinition validates a workflow definition on its own, without
+// comparing it to the current version of the workflow. Problems are
+// reported together as a *ValidationError. Definitions over a hard
+// complexity limit of their namespace are rejected with those problems
+// alone, without validating further.
+func (v *Validator) ValidateDefinition(ctx context.Context, definition map[string]interface{}) error {
+	if err := v.validateComplexity(definition, namespaceOf(definition, nil)); err != nil {
+		return err
 	}
+
+	errs := &ValidationError{}
+	errs.merge("", v.validateWorkflowDefinition(definition))
+	errs.merge("", v.validateScripts(ctx, definition))
+	return errs.err()
 }
 
-// ValidateVersion validates a new version before creation
+// ValidateVersion validates a new version before creation. Problems are
+// reported together as a *ValidationError, their fields being paths into
+// the version request, such as definition.steps[0].name. Definitions over a
+// hard complexity limit of their namespace are not validated further.
 func (v *Validator) ValidateVersion(ctx context.Context, workflow *models.Workflow, changes VersionChanges) error {
+	errs := &ValidationError{}
+
 	// Validate change type
 	if err := v.validateChangeType(changes.ChangeType); err != nil {
-		return fmt.Errorf("invalid change type: %w", err)
+		errs.add("change_type", CodeInvalidValue, err.Error())
+	}
+
+	// Reject pathological definitions before validating them takes long
+	if err := v.validateComplexity(changes.NewDefinition, namespaceOf(changes.NewDefinition, workflow)); err != nil {
+		errs.merge("definition", err)
+		return errs
 	}
 
 	// Validate workflow definition
-	if err := v.validateWorkflowDefinition(changes.NewDefinition); err != nil {
-		return fmt.Errorf("invalid workflow definition: %w", err)
+	errs.merge("definition", v.validateWorkflowDefinition(changes.NewDefinition))
+
+	// Validate script steps against the host function allowlist and modules
+	errs.merge("definition", v.validateScripts(ctx, changes.NewDefinition))
+
+	// Compatibility is only checked for valid versions
+	if len(errs.Errors) > 0 {
+		return errs
 	}
 
 	// Validate compatibility with existing executions
 	if err := v.validateExecutionCompatibility(ctx, workflow, changes); err != nil {
-		return fmt.Errorf("execution compatibility check failed: %w", err)
+		errs.add("change_type", CodeIncompatible, err.Error())
 	}
 
 	// Validate schema changes
-	if err := v.validateSchemaChanges(workflow.Definition, changes.NewDefinition, changes.ChangeType); err != nil {
-		return fmt.Errorf("schema validation failed: %w", err)
-	}
+	errs.merge("definition", v.validateSchemaChanges(workflow.Definition, changes.NewDefinition, changes.ChangeType))
 
 	// Validate business rules
-	if err := v.validateBusinessRules(ctx, workflow, changes); err != nil {
-		return fmt.Errorf("business rule validation failed: %w", err)
-	}
+	errs.merge("definition", v.validateBusinessRules(ctx, workflow, changes))
 
-	return nil
+	return errs.err()
 }
 
 // ValidateMigrationPlan validates a migration plan before execution
@@ -126,148 +211,440 @@ func (v *Validator) validateChangeType(changeType ChangeType) error {
 	return fmt.Errorf("invalid change type: %s", changeType)
 }
 
+// definitionFields are the top-level fields of a workflow definition
+var definitionFields = []string{
+	"name", "description", "version", "steps", "inputs", "outputs", "input_schema", "output_schema",
+	"output_mapping", "error_handling", "retry_policy", "timeout", "feature_flags", "scripts",
+	"examples", "shutdown_policy", "compensation_incomplete", "execution_mode",
+}
+
+// stepFields are the fields of a workflow step
+var stepFields = []string{
+	"name", "type", "description", "depends_on", "condition", "config", "input", "output",
+	"data_mapping", "error_handling", "retry_policy", "timeout", "priority",
+}
+
+// validateWorkflowDefinition returns every problem of a definition as a
+// *ValidationError, their fields being paths into the definition
 func (v *Validator) validateWorkflowDefinition(definition map[string]interface{}) error {
+	errs := &ValidationError{}
+
+	// Reject misspelled fields in strict mode, lenient mode ignores them
+	if v.config.StrictMode {
+		validateKnownFields(errs, "", definition, definitionFields)
+	}
+
 	// Validate required fields
 	for _, field := range v.config.RequiredFields {
 		if _, exists := definition[field]; !exists {
-			return fmt.Errorf("required field missing: %s", field)
+			errs.add(field, CodeRequired, fmt.Sprintf("required field missing: %s", field))
 		}
 	}
 
 	// Validate workflow name
-	name, ok := definition["name"].(string)
-	if !ok {
-		return fmt.Errorf("workflow name must be a string")
-	}
-	if err := v.validateWorkflowName(name); err != nil {
-		return fmt.Errorf("invalid workflow name: %w", err)
+	if value, exists := definition["name"]; exists {
+		if name, ok := value.(string); !ok {
+			errs.add("name", CodeInvalidType, "workflow name must be a string")
+		} else {
+			v.validateWorkflowName(errs, "name", name)
+		}
 	}
 
 	// Validate steps
-	steps, ok := definition["steps"].([]interface{})
-	if !ok {
-		return fmt.Errorf("steps must be an array")
+	if value, exists := definition["steps"]; exists {
+		if steps, ok := value.([]interface{}); !ok {
+			errs.add("steps", CodeInvalidType, "steps must be an array")
+		} else {
+			problems := len(errs.Errors)
+			v.validateSteps(errs, "steps", steps)
+
+			// Validate the step graph: dependencies, priorities and the
+			// output mapping, which must not depend on background steps
+			if len(errs.Errors) == problems {
+				if _, err := dataflow.Analyze(definition); err != nil {
+					errs.add("steps", CodeInvalidGraph, err.Error())
+				}
+			}
+		}
 	}
-	if err := v.validateSteps(steps); err != nil {
-		return fmt.Errorf("invalid steps: %w", err)
+
+	// Validate the expressions of the output mapping
+	if outputMapping, exists := definition["output_mapping"]; exists {
+		validateExpressions(errs, "output_mapping", outputMapping)
 	}
 
 	// Validate inputs if present
 	if inputs, exists := definition["inputs"]; exists {
-		if err := v.validateInputsOutputs(inputs, "inputs"); err != nil {
-			return fmt.Errorf("invalid inputs: %w", err)
-		}
+		v.validateInputsOutputs(errs, "inputs", inputs)
 	}
 
 	// Validate outputs if present
 	if outputs, exists := definition["outputs"]; exists {
-		if err := v.validateInputsOutputs(outputs, "outputs"); err != nil {
-			return fmt.Errorf("invalid outputs: %w", err)
-		}
+		v.validateInputsOutputs(errs, "outputs", outputs)
 	}
 
-	return nil
+	// Validate the examples against the inputs and outputs
+	if examples, exists := definition["examples"]; exists {
+		validateExamples(errs, "examples", examples, definition["inputs"], definition["outputs"])
+	}
+
+	// Validate the shutdown policy and execution mode
+	validateShutdownPolicy(errs, definition)
+	validateExecutionMode(errs, definition)
+
+	return errs.err()
+}
+
+// validateShutdownPolicy validates the shutdown policy of a definition,
+// which cannot be interruptible when its compensation is incomplete
+func validateShutdownPolicy(errs *ValidationError, definition map[string]interface{}) {
+	var policy models.ShutdownPolicy
+	if value, exists := definition["shutdown_policy"]; exists {
+		name, ok := value.(string)
+		if !ok {
+			errs.add("shutdown_policy", CodeInvalidType, "shutdown_policy must be a string")
+			return
+		}
+		policy = models.ShutdownPolicy(name)
+	}
+	incomplete := false
+	if value, exists := definition["compensation_incomplete"]; exists {
+		flag, ok := value.(bool)
+		if !ok {
+			errs.add("compensation_incomplete", CodeInvalidType, "compensation_incomplete must be a boolean")
+			return
+		}
+		incomplete = flag
+	}
+	if err := models.ValidateShutdownPolicy(policy, incomplete); err != nil {
+		errs.add("shutdown_policy", CodeInvalidValue, err.Error())
+	}
 }
 
-func (v *Validator) validateWorkflowName(name string) error {
+func (v *Validator) validateWorkflowName(errs *ValidationError, path, name string) {
 	if len(name) == 0 {
-		return fmt.Errorf("workflow name cannot be empty")
+		errs.add(path, CodeRequired, "workflow name cannot be empty")
+		return
 	}
 	if len(name) > 100 {
-		return fmt.Errorf("workflow name too long (max 100 characters)")
+		errs.add(path, CodeLimitExceeded, "workflow name too long (max 100 characters)")
+		return
 	}
 
 	// Check for valid characters
 	validName := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 	if !validName.MatchString(name) {
-		return fmt.Errorf("workflow name contains invalid characters")
+		errs.add(path, CodeInvalidValue, "workflow name contains invalid characters")
 	}
-
-	return nil
 }
 
-func (v *Validator) validateSteps(steps []interface{}) error {
+func (v *Validator) validateSteps(errs *ValidationError, path string, steps []interface{}) {
 	if len(steps) == 0 {
-		return fmt.Errorf("workflow must have at least one step")
+		errs.add(path, CodeRequired, "workflow must have at least one step")
+		return
 	}
 	if len(steps) > v.config.MaxStepsPerWorkflow {
-		return fmt.Errorf("too many steps (max %d)", v.config.MaxStepsPerWorkflow)
+		errs.add(path, CodeLimitExceeded, fmt.Sprintf("too many steps (max %d)", v.config.MaxStepsPerWorkflow))
 	}
 
 	stepNames := make(map[string]bool)
 	for i, stepInterface := range steps {
+		stepPath := joinPath(path, fmt.Sprintf("[%d]", i))
 		step, ok := stepInterface.(map[string]interface{})
 		if !ok {
-			return fmt.Errorf("step %d is not a valid object", i)
+			errs.add(stepPath, CodeInvalidType, fmt.Sprintf("step %d is not a valid object", i))
+			continue
 		}
 
 		// Validate step structure
-		if err := v.validateStep(step, i); err != nil {
-			return fmt.Errorf("step %d validation failed: %w", i, err)
-		}
+		v.validateStep(errs, stepPath, step)
 
 		// Check for duplicate step names
 		if name, exists := step["name"].(string); exists {
 			if stepNames[name] {
-				return fmt.Errorf("duplicate step name: %s", name)
+				errs.add(joinPath(stepPath, "name"), CodeDuplicate, fmt.Sprintf("duplicate step name: %s", name))
 			}
 			stepNames[name] = true
 		}
 	}
 
+	v.validateNestingDepth(errs, path, steps)
+}
+
+// validateNestingDepth adds a problem on every outermost loop or parallel
+// step nesting more levels of loops and parallels than MaxNestingDepth.
+// Nested steps are either referenced by name or defined inline.
+func (v *Validator) validateNestingDepth(errs *ValidationError, path string, steps []interface{}) {
+	if v.config.MaxNestingDepth <= 0 {
+		return
+	}
+
+	index := newNestingIndex(steps)
+	for i, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := step["name"].(string)
+		if index.nested[name] {
+			continue
+		}
+		if depth := len(index.trail(step)); depth > v.config.MaxNestingDepth {
+			errs.add(joinPath(path, fmt.Sprintf("[%d]", i)), CodeLimitExceeded,
+				fmt.Sprintf("step %s nests %d levels of loops and parallels (max %d)", name, depth, v.config.MaxNestingDepth))
+		}
+	}
+}
+
+// nestingIndex measures how deep the loop and parallel steps of a
+// definition nest, following the steps they reference by name. The nesting
+// of named steps is memoized, so steps shared by many branches are measured
+// once.
+type nestingIndex struct {
+	byName map[string]map[string]interface{}
+	// nested holds the steps other steps reference by name
+	nested   map[string]bool
+	trails   map[string][]string
+	visiting map[string]bool
+}
+
+func newNestingIndex(steps []interface{}) *nestingIndex {
+	index := &nestingIndex{
+		byName:   make(map[string]map[string]interface{}),
+		nested:   make(map[string]bool),
+		trails:   make(map[string][]string),
+		visiting: make(map[string]bool),
+	}
+	for _, stepInterface := range steps {
+		step, ok := stepInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, ok := step["name"].(string); ok {
+			index.byName[name] = step
+		}
+		for _, child := range nestedSteps("", step) {
+			if name, ok := child.step.(string); ok {
+				index.nested[name] = true
+			}
+		}
+	}
+	return index
+}
+
+// trail returns the names of the loops and parallels of the deepest
+// nesting of a step, from the step itself, none for other steps. Cycles of
+// step references are not followed.
+func (n *nestingIndex) trail(step map[string]interface{}) []string {
+	stepType, _ := step["type"].(string)
+	if stepType != "loop" && stepType != "parallel" {
+		return nil
+	}
+	name, named := step["name"].(string)
+	if named {
+		if trail, ok := n.trails[name]; ok {
+			return trail
+		}
+		if n.visiting[name] {
+			return nil
+		}
+		n.visiting[name] = true
+		defer delete(n.visiting, name)
+	}
+
+	var deepest []string
+	for _, child := range nestedSteps("", step) {
+		var childStep map[string]interface{}
+		switch c := child.step.(type) {
+		case string:
+			childStep = n.byName[c]
+		case map[string]interface{}:
+			childStep = c
+		}
+		if childStep == nil {
+			continue
+		}
+		if trail := n.trail(childStep); len(trail) > len(deepest) {
+			deepest = trail
+		}
+	}
+
+	trail := append([]string{stepName(step)}, deepest...)
+	if named {
+		n.trails[name] = trail
+	}
+	return trail
+}
+
+// nestedStep is a step a loop or parallel step runs, a name or an inline
+// step definition, and its path
+type nestedStep struct {
+	path string
+	step interface{}
+}
+
+// nestedSteps returns the steps a loop or parallel step at path runs. Loops
+// list them in steps; parallel branches are a step, a list of steps or an
+// object listing them in steps.
+func nestedSteps(path string, step map[string]interface{}) []nestedStep {
+	config, _ := step["config"].(map[string]interface{})
+	switch step["type"] {
+	case "loop":
+		steps, _ := config["steps"].([]interface{})
+		nested := make([]nestedStep, len(steps))
+		for i, child := range steps {
+			nested[i] = nestedStep{path: joinPath(path, fmt.Sprintf("config.steps[%d]", i)), step: child}
+		}
+		return nested
+	case "parallel":
+		branches, _ := config["branches"].([]interface{})
+		var nested []nestedStep
+		for i, branch := range branches {
+			branchPath := joinPath(path, fmt.Sprintf("config.branches[%d]", i))
+			switch b := branch.(type) {
+			case []interface{}:
+				for j, child := range b {
+					nested = append(nested, nestedStep{path: joinPath(branchPath, fmt.Sprintf("[%d]", j)), step: child})
+				}
+			case map[string]interface{}:
+				if _, inline := b["type"]; inline {
+					nested = append(nested, nestedStep{path: branchPath, step: b})
+				} else if branchSteps, ok := b["steps"].([]interface{}); ok {
+					for j, child := range branchSteps {
+						nested = append(nested, nestedStep{path: joinPath(branchPath, fmt.Sprintf("steps[%d]", j)), step: child})
+					}
+				}
+			default:
+				nested = append(nested, nestedStep{path: branchPath, step: b})
+			}
+		}
+		return nested
+	}
 	return nil
 }
 
-func (v *Validator) validateStep(step map[string]interface{}, index int) error {
+func (v *Validator) validateStep(errs *ValidationError, path string, step map[string]interface{}) {
+	if v.config.StrictMode {
+		validateKnownFields(errs, path, step, stepFields)
+	}
+
 	// Validate required step fields
 	requiredStepFields := []string{"name", "type"}
 	for _, field := range requiredStepFields {
 		if _, exists := step[field]; !exists {
-			return fmt.Errorf("required field missing: %s", field)
+			errs.add(joinPath(path, field), CodeRequired, fmt.Sprintf("required field missing: %s", field))
 		}
 	}
 
 	// Validate step name
-	name, ok := step["name"].(string)
-	if !ok {
-		return fmt.Errorf("step name must be a string")
-	}
-	if err := v.validateStepName(name); err != nil {
-		return fmt.Errorf("invalid step name: %w", err)
+	if value, exists := step["name"]; exists {
+		if name, ok := value.(string); !ok {
+			errs.add(joinPath(path, "name"), CodeInvalidType, "step name must be a string")
+		} else {
+			v.validateStepName(errs, joinPath(path, "name"), name)
+		}
 	}
 
+	// Validate the expressions of the step mappings, config and condition
+	validateStepExpressions(errs, path, step)
+
 	// Validate step type
-	stepType, ok := step["type"].(string)
+	value, exists := step["type"]
+	if !exists {
+		return
+	}
+	stepType, ok := value.(string)
 	if !ok {
-		return fmt.Errorf("step type must be a string")
+		errs.add(joinPath(path, "type"), CodeInvalidType, "step type must be a string")
+		return
 	}
 	if err := v.validateStepType(stepType); err != nil {
-		return fmt.Errorf("invalid step type: %w", err)
+		errs.add(joinPath(path, "type"), CodeUnsupported, err.Error())
+		return
 	}
 
 	// Validate step-specific configuration
-	if err := v.validateStepConfiguration(step, stepType); err != nil {
-		return fmt.Errorf("invalid step configuration: %w", err)
+	v.validateStepConfiguration(errs, joinPath(path, "config"), step, stepType)
+}
+
+// validateKnownFields reports the fields of value that are not known, in
+// key order, suggesting the known field a misspelled one is closest to
+func validateKnownFields(errs *ValidationError, path string, value map[string]interface{}, known []string) {
+	fields := make(map[string]bool, len(known))
+	for _, field := range known {
+		fields[field] = true
+	}
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		if !fields[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		message := fmt.Sprintf("unknown field: %s", key)
+		if suggestion := closestField(key, known); suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %s?)", suggestion)
+		}
+		errs.add(joinPath(path, key), CodeUnknownField, message)
 	}
+}
 
-	return nil
+// closestField returns the known field within two edits of a field, empty
+// when there is none
+func closestField(field string, known []string) string {
+	closest, best := "", 3
+	for _, candidate := range known {
+		if distance := editDistance(field, candidate); distance < best {
+			closest, best = candidate, distance
+		}
+	}
+	return closest
 }
 
-func (v *Validator) validateStepName(name string) error {
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (v *Validator) validateStepName(errs *ValidationError, path, name string) {
 	if len(name) == 0 {
-		return fmt.Errorf("step name cannot be empty")
+		errs.add(path, CodeRequired, "step name cannot be empty")
+		return
 	}
 	if len(name) > 50 {
-		return fmt.Errorf("step name too long (max 50 characters)")
+		errs.add(path, CodeLimitExceeded, "step name too long (max 50 characters)")
+		return
 	}
 
 	// Check for valid characters
 	validName := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 	if !validName.MatchString(name) {
-		return fmt.Errorf("step name contains invalid characters")
+		errs.add(path, CodeInvalidValue, "step name contains invalid characters")
 	}
-
-	return nil
 }
 
 func (v *Validator) validateStepType(stepType string) error {
@@ -279,167 +656,131 @@ func (v *Validator) validateStepType(stepType string) error {
 	return fmt.Errorf("unsupported step type: %s", stepType)
 }
 
-func (v *Validator) validateStepConfiguration(step map[string]interface{}, stepType string) error {
-	switch stepType {
-	case "http":
-		return v.validateHTTPStep(step)
-	case "script":
-		return v.validateScriptStep(step)
-	case "condition":
-		return v.validateConditionStep(step)
-	case "loop":
-		return v.validateLoopStep(step)
-	case "parallel":
-		return v.validateParallelStep(step)
-	default:
-		return nil // Custom steps don't have specific validation
-	}
-}
-
-func (v *Validator) validateHTTPStep(step map[string]interface{}) error {
-	config, exists := step["config"]
-	if !exists {
-		return fmt.Errorf("HTTP step requires config")
-	}
-
-	configMap, ok := config.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("HTTP step config must be an object")
+// validateStepConfiguration adds the problems of a step config, each
+// schema problem on the field of the config it concerns
+func (v *Validator) validateStepConfiguration(errs *ValidationError, path string, step map[string]interface{}, stepType string) {
+	if stepType == "parallel" {
+		v.validateParallelStep(errs, path, step)
+		return
 	}
 
-	// Validate required HTTP fields
-	if _, exists := configMap["url"]; !exists {
-		return fmt.Errorf("HTTP step requires url")
+	if _, err := v.checkStepConfig(step, stepType); err != nil {
+		var configErr *stepconfig.ConfigError
+		if !errors.As(err, &configErr) {
+			errs.add(path, CodeInvalidConfig, err.Error())
+			return
+		}
+		for _, problem := range configErr.Problems {
+			errs.add(joinPath(path, problem.Field), CodeInvalidConfig, problem.Message)
+		}
+		return
 	}
-	if _, exists := configMap["method"]; !exists {
-		return fmt.Errorf("HTTP step requires method")
+	if stepType == "parse_table" {
+		if err := v.validateParseTableStep(step); err != nil {
+			errs.add(path, CodeInvalidConfig, err.Error())
+		}
 	}
-
-	return nil
 }
 
-func (v *Validator) validateScriptStep(step map[string]interface{}) error {
-	config, exists := step["config"]
-	if !exists {
-		return fmt.Errorf("script step requires config")
-	}
-
-	configMap, ok := config.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("script step config must be an object")
+// validateParseTableStep checks the coercion rules and reader options of a
+// parse_table step, which its schema cannot express
+func (v *Validator) validateParseTableStep(step map[string]interface{}) error {
+	config, _ := step["config"].(map[string]interface{})
+	typed, err := stepconfig.ParseTableSchema.Decode(stepconfig.Section("parse_table", config))
+	if err != nil {
+		return err
 	}
-
-	// Validate required script fields
-	if _, exists := configMap["script"]; !exists {
-		return fmt.Errorf("script step requires script")
+	if _, err := tabular.OptionsFromConfig(typed.(*stepconfig.ParseTableConfig)); err != nil {
+		return fmt.Errorf("parse_table step config: %w", err)
 	}
-
 	return nil
 }
 
-func (v *Validator) validateConditionStep(step map[string]interface{}) error {
-	config, exists := step["config"]
+// checkStepConfig validates a step config against the schema of its step
+// type. Step types without a schema, such as custom steps, are not checked.
+func (v *Validator) checkStepConfig(step map[string]interface{}, stepType string) ([]string, error) {
+	schema, exists := v.schemas.Get(stepType)
 	if !exists {
-		return fmt.Errorf("condition step requires config")
-	}
-
-	configMap, ok := config.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("condition step config must be an object")
-	}
-
-	// Validate required condition fields
-	if _, exists := configMap["condition"]; !exists {
-		return fmt.Errorf("condition step requires condition")
+		return nil, nil
 	}
 
-	return nil
-}
-
-func (v *Validator) validateLoopStep(step map[string]interface{}) error {
 	config, exists := step["config"]
 	if !exists {
-		return fmt.Errorf("loop step requires config")
+		return nil, fmt.Errorf("%s step requires config", stepType)
 	}
 
 	configMap, ok := config.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("loop step config must be an object")
+		return nil, fmt.Errorf("%s step config must be an object", stepType)
 	}
 
-	// Validate required loop fields
-	if _, exists := configMap["items"]; !exists {
-		return fmt.Errorf("loop step requires items")
-	}
-
-	return nil
+	return schema.Validate(stepconfig.Section(stepType, configMap), v.config.StrictMode)
 }
 
-func (v *Validator) validateParallelStep(step map[string]interface{}) error {
+func (v *Validator) validateParallelStep(errs *ValidationError, path string, step map[string]interface{}) {
 	config, exists := step["config"]
 	if !exists {
-		return fmt.Errorf("parallel step requires config")
+		errs.add(path, CodeRequired, "parallel step requires config")
+		return
 	}
 
 	configMap, ok := config.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("parallel step config must be an object")
+		errs.add(path, CodeInvalidType, "parallel step config must be an object")
+		return
 	}
 
 	// Validate required parallel fields
 	if _, exists := configMap["branches"]; !exists {
-		return fmt.Errorf("parallel step requires branches")
+		errs.add(joinPath(path, "branches"), CodeRequired, "parallel step requires branches")
 	}
-
-	return nil
 }
 
-func (v *Validator) validateInputsOutputs(schema interface{}, schemaType string) error {
+func (v *Validator) validateInputsOutputs(errs *ValidationError, path string, schema interface{}) {
 	schemaMap, ok := schema.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("%s must be an object", schemaType)
+		errs.add(path, CodeInvalidType, fmt.Sprintf("%s must be an object", path))
+		return
 	}
 
-	// Validate each field in the schema
-	for fieldName, fieldDef := range schemaMap {
-		if err := v.validateSchemaField(fieldName, fieldDef); err != nil {
-			return fmt.Errorf("invalid field %s: %w", fieldName, err)
-		}
+	// Validate each field in the schema, in a stable order
+	fieldNames := make([]string, 0, len(schemaMap))
+	for fieldName := range schemaMap {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+	for _, fieldName := range fieldNames {
+		v.validateSchemaField(errs, joinPath(path, fieldName), schemaMap[fieldName])
 	}
-
-	return nil
 }
 
-func (v *Validator) validateSchemaField(fieldName string, fieldDef interface{}) error {
+func (v *Validator) validateSchemaField(errs *ValidationError, path string, fieldDef interface{}) {
 	fieldMap, ok := fieldDef.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("field definition must be an object")
+		errs.add(path, CodeInvalidType, "field definition must be an object")
+		return
 	}
 
 	// Validate field type
 	fieldType, exists := fieldMap["type"]
 	if !exists {
-		return fmt.Errorf("field type is required")
+		errs.add(joinPath(path, "type"), CodeRequired, "field type is required")
+		return
 	}
 
 	fieldTypeStr, ok := fieldType.(string)
 	if !ok {
-		return fmt.Errorf("field type must be a string")
+		errs.add(joinPath(path, "type"), CodeInvalidType, "field type must be a string")
+		return
 	}
 
 	validTypes := []string{"string", "number", "integer", "boolean", "array", "object"}
-	validType := false
 	for _, vt := range validTypes {
 		if fieldTypeStr == vt {
-			validType = true
-			break
+			return
 		}
 	}
-	if !validType {
-		return fmt.Errorf("invalid field type: %s", fieldTypeStr)
-	}
-
-	return nil
+	errs.add(joinPath(path, "type"), CodeInvalidValue, fmt.Sprintf("invalid field type: %s", fieldTypeStr))
 }
 
 func (v *Validator) validateExecutionCompatibility(ctx context.Context, workflow *models.Workflow, changes VersionChanges) error {
@@ -455,18 +796,22 @@ func (v *Validator) validateExecutionCompatibility(ctx context.Context, workflow
 	return nil
 }
 
+// validateSchemaChanges returns the incompatible input and output schema
+// changes as a *ValidationError
 func (v *Validator) validateSchemaChanges(oldDef, newDef map[string]interface{}, changeType ChangeType) error {
+	errs := &ValidationError{}
+
 	// Validate input schema changes
 	if err := v.validateSchemaCompatibility(oldDef["inputs"], newDef["inputs"], "inputs", changeType); err != nil {
-		return fmt.Errorf("input schema compatibility check failed: %w", err)
+		errs.add("inputs", CodeIncompatible, err.Error())
 	}
 
 	// Validate output schema changes
 	if err := v.validateSchemaCompatibility(oldDef["outputs"], newDef["outputs"], "outputs", changeType); err != nil {
-		return fmt.Errorf("output schema compatibility check failed: %w", err)
+		errs.add("outputs", CodeIncompatible, err.Error())
 	}
 
-	return nil
+	return errs.err()
 }
 
 func (v *Validator) validateSchemaCompatibility(oldSchema, newSchema interface{}, schemaType string, changeType ChangeType) error {
@@ -544,16 +889,10 @@ func (v *Validator) areFieldTypesCompatible(oldField, newField interface{}) bool
 	return oldType == newType
 }
 
+// validateBusinessRules runs the org-specific rules of new versions, which
+// are registered as custom validators
 func (v *Validator) validateBusinessRules(ctx context.Context, workflow *models.Workflow, changes VersionChanges) error {
-	// Implement business-specific validation rules
-	// This could include checks for:
-	// - Workflow naming conventions
-	// - Step count limits
-	// - Resource usage constraints
-	// - Security requirements
-	// - Compliance requirements
-
-	return nil
+	return v.runCustomValidators(ctx, workflow, changes)
 }
 
 func (v *Validator) validatePlanStructure(plan *MigrationPlan) error {
@@ -0,0 +1,397 @@
+package versioning
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func TestValidateDefinitionReportsEveryProblem(t *testing.T) {
+	definition := map[string]interface{}{
+		"name": "orders",
+		"steps": []interface{}{
+			map[string]interface{}{
+				"name":   "fetch",
+				"type":   "http",
+				"config": map[string]interface{}{"method": "GET"},
+			},
+			map[string]interface{}{"name": "bad name", "type": "custom"},
+		},
+		"inputs": map[string]interface{}{
+			"amount": map[string]interface{}{"type": "money"},
+		},
+	}
+
+	err := NewValidator(nil).ValidateDefinition(context.Background(), definition)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+	assert.Equal(t, []FieldError{
+		{Field: "steps[0].config.url", Message: `missing required field "url"`, Code: CodeInvalidConfig},
+		{Field: "steps[1].name", Message: "step name contains invalid characters", Code: CodeInvalidValue},
+		{Field: "inputs.amount.type", Message: "invalid field type: money", Code: CodeInvalidValue},
+	}, validationErr.Errors)
+	assert.Contains(t, err.Error(), "steps[1].name: step name contains invalid characters")
+}
+
+func TestValidateVersionPrefixesDefinitionPaths(t *testing.T) {
+	changes := VersionChanges{
+		ChangeType: ChangeType("huge"),
+		NewDefinition: map[string]interface{}{
+			"steps": []interface{}{
+				map[string]interface{}{"name": "a", "type": "teleport"},
+				map[string]interface{}{"name": "a", "type": "custom"},
+			},
+		},
+	}
+
+	err := NewValidator(nil).ValidateVersion(context.Background(), &models.Workflow{}, changes)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+	assert.Equal(t, []FieldError{
+		{Field: "change_type", Message: "invalid change type: huge", Code: CodeInvalidValue},
+		{Field: "definition.name", Message: "required field missing: name", Code: CodeRequired},
+		{Field: "definition.steps[0].type", Message: "unsupported step type: teleport", Code: CodeUnsupported},
+		{Field: "definition.steps[1].name", Message: "duplicate step name: a", Code: CodeDuplicate},
+	}, validationErr.Errors)
+}
+
+func TestValidateDefinitionAcceptsValidDefinition(t *testing.T) {
+	definition := map[string]interface{}{
+		"name": "orders",
+		"steps": []interface{}{
+			map[string]interface{}{
+				"name":   "fetch",
+				"type":   "http",
+				"config": map[string]interface{}{"url": "https://example.com/orders"},
+			},
+		},
+	}
+
+	assert.NoError(t, NewValidator(nil).ValidateDefinition(context.Background(), definition))
+}
+
+func TestValidateDefinitionLimits(t *testing.T) {
+	step := func(name, stepType string, config map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"name": name, "type": stepType, "config": config}
+	}
+	loop := func(name string, steps ...interface{}) map[string]interface{} {
+		return step(name, "loop", map[string]interface{}{"items": []interface{}{1, 2}, "steps": steps})
+	}
+	validator := func(maxSteps, maxDepth int) *Validator {
+		config := DefaultValidationConfig()
+		config.MaxStepsPerWorkflow = maxSteps
+		config.MaxNestingDepth = maxDepth
+		return NewValidator(config)
+	}
+
+	// outer runs middle in a branch and an inline loop in another, middle
+	// runs inner and inner runs work: three levels of nesting
+	definition := map[string]interface{}{
+		"name": "orders",
+		"steps": []interface{}{
+			step("outer", "parallel", map[string]interface{}{
+				"branches": []interface{}{
+					map[string]interface{}{"steps": []interface{}{"middle"}},
+					loop("inline", "work"),
+				},
+			}),
+			loop("middle", "inner"),
+			loop("inner", "work"),
+			step("work", "custom", nil),
+		},
+	}
+
+	t.Run("step count", func(t *testing.T) {
+		err := validator(3, 5).ValidateDefinition(context.Background(), definition)
+
+		var validationErr *ValidationError
+		require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+		assert.Equal(t, []FieldError{
+			{Field: "steps", Message: "too many steps (max 3)", Code: CodeLimitExceeded},
+		}, validationErr.Errors)
+	})
+
+	t.Run("nesting depth", func(t *testing.T) {
+		err := validator(100, 2).ValidateDefinition(context.Background(), definition)
+
+		var validationErr *ValidationError
+		require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+		assert.Equal(t, []FieldError{
+			{Field: "steps[0]", Message: "step outer nests 3 levels of loops and parallels (max 2)", Code: CodeLimitExceeded},
+		}, validationErr.Errors)
+	})
+
+	t.Run("within limits", func(t *testing.T) {
+		assert.NoError(t, validator(4, 3).ValidateDefinition(context.Background(), definition))
+	})
+
+	t.Run("reference cycles", func(t *testing.T) {
+		cyclic := map[string]interface{}{
+			"name":  "orders",
+			"steps": []interface{}{loop("ping", "pong"), loop("pong", "ping")},
+		}
+		assert.NoError(t, validator(100, 2).ValidateDefinition(context.Background(), cyclic))
+	})
+}
+
+// requireOwner rejects versions whose definition has no owner metadata
+func requireOwner(ctx context.Context, workflow *models.Workflow, changes VersionChanges) error {
+	metadata, _ := changes.NewDefinition["metadata"].(map[string]interface{})
+	if owner, _ := metadata["owner"].(string); owner != "" {
+		return nil
+	}
+	return &ValidationError{Errors: []FieldError{
+		{Field: "metadata.owner", Message: "workflow " + workflow.Name + " must name an owner", Code: CodeRequired},
+	}}
+}
+
+func TestValidateDefinitionExpressions(t *testing.T) {
+	definition := map[string]interface{}{
+		"name": "orders",
+		"steps": []interface{}{
+			map[string]interface{}{
+				"name": "schedule",
+				"type": "custom",
+				"input": map[string]interface{}{
+					"customer": "${fetch-customer.name}",
+					"due":      "${addBusinessDays(now(), 3, \"holidays\")}",
+					"late":     "${addBusinessDays(now())}",
+					"label":    "order ${order.id} due ${format(due, \"date\")} at ${soon()}",
+				},
+				"condition": map[string]interface{}{
+					"operator": "and",
+					"conditions": []interface{}{
+						map[string]interface{}{"operator": "expression", "expression": "round(total, 2) > max(1, limit)"},
+						map[string]interface{}{"operator": "expression", "expression": "now(1) > due"},
+					},
+				},
+			},
+		},
+		"output_mapping": map[string]interface{}{"total": "${round()}"},
+	}
+
+	err := NewValidator(nil).ValidateDefinition(context.Background(), definition)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+	assert.Equal(t, []FieldError{
+		{Field: "steps[0].input.label", Message: `invalid expression ${soon()}: unknown function "soon" at position 1`, Code: CodeInvalidExpression},
+		{Field: "steps[0].input.late", Message: "invalid expression ${addBusinessDays(now())}: addBusinessDays expects 2 to 3 arguments, got 1", Code: CodeInvalidExpression},
+		{Field: "steps[0].condition.conditions[1].expression", Message: `invalid expression "now(1) > due": now expects 0 arguments, got 1`, Code: CodeInvalidExpression},
+		{Field: "output_mapping.total", Message: "invalid expression ${round()}: round expects 1 to 2 arguments, got 0", Code: CodeInvalidExpression},
+	}, validationErr.Errors)
+}
+
+func TestValidateDefinitionStrictMode(t *testing.T) {
+	definition := map[string]interface{}{
+		"name": "orders",
+		"steps": []interface{}{
+			map[string]interface{}{"name": "fetch", "type": "custom", "confg": map[string]interface{}{}},
+		},
+		"stpes": []interface{}{
+			map[string]interface{}{"name": "notify", "type": "notify"},
+		},
+		"owner": "payments",
+	}
+
+	require.NoError(t, NewValidator(nil).ValidateDefinition(context.Background(), definition))
+
+	config := DefaultValidationConfig()
+	config.StrictMode = true
+	err := NewValidator(config).ValidateDefinition(context.Background(), definition)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+	assert.Equal(t, []FieldError{
+		{Field: "owner", Message: "unknown field: owner", Code: CodeUnknownField},
+		{Field: "stpes", Message: "unknown field: stpes (did you mean steps?)", Code: CodeUnknownField},
+		{Field: "steps[0].confg", Message: "unknown field: confg (did you mean config?)", Code: CodeUnknownField},
+	}, validationErr.Errors)
+}
+
+func TestValidateDefinitionShutdownPolicy(t *testing.T) {
+	definition := func(fields map[string]interface{}) map[string]interface{} {
+		definition := map[string]interface{}{
+			"name":  "orders",
+			"steps": []interface{}{map[string]interface{}{"name": "charge", "type": "custom"}},
+		}
+		for key, value := range fields {
+			definition[key] = value
+		}
+		return definition
+	}
+	validate := func(fields map[string]interface{}) error {
+		config := DefaultValidationConfig()
+		config.StrictMode = true
+		return NewValidator(config).ValidateDefinition(context.Background(), definition(fields))
+	}
+
+	assert.NoError(t, validate(nil))
+	assert.NoError(t, validate(map[string]interface{}{"shutdown_policy": "checkpoint_after_current_step", "compensation_incomplete": true}))
+	assert.NoError(t, validate(map[string]interface{}{"shutdown_policy": "interruptible"}))
+
+	var validationErr *ValidationError
+	err := validate(map[string]interface{}{"shutdown_policy": "interruptible", "compensation_incomplete": true})
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+	require.Len(t, validationErr.Errors, 1)
+	assert.Equal(t, "shutdown_policy", validationErr.Errors[0].Field)
+	assert.Equal(t, CodeInvalidValue, validationErr.Errors[0].Code)
+	assert.Contains(t, validationErr.Errors[0].Message, "compensation_incomplete")
+
+	err = validate(map[string]interface{}{"shutdown_policy": "whenever"})
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+	assert.Equal(t, CodeInvalidValue, validationErr.Errors[0].Code)
+}
+
+func TestExecutionPath(t *testing.T) {
+	definition := func(mode string, steps ...interface{}) map[string]interface{} {
+		definition := map[string]interface{}{"name": "orders", "steps": steps}
+		if mode != "" {
+			definition["execution_mode"] = mode
+		}
+		return definition
+	}
+	http := map[string]interface{}{"name": "forward", "type": "http"}
+
+	path := DecideExecutionPath(definition("lightweight", http))
+	assert.Equal(t, models.ExecutionModeLightweight, path.Mode)
+	assert.Empty(t, path.Fallbacks)
+
+	path = DecideExecutionPath(definition("", http))
+	assert.Equal(t, models.ExecutionModeStandard, path.Requested)
+	assert.Equal(t, models.ExecutionModeStandard, path.Mode)
+
+	// Steps lightweight executions cannot run fall the version back,
+	// inline ones too
+	path = DecideExecutionPath(definition("lightweight", http,
+		map[string]interface{}{"name": "review", "type": "approval"},
+		map[string]interface{}{"name": "each", "type": "loop", "config": map[string]interface{}{
+			"steps": []interface{}{map[string]interface{}{"type": "sub_workflow"}},
+		}},
+	))
+	assert.Equal(t, models.ExecutionModeLightweight, path.Requested)
+	assert.Equal(t, models.ExecutionModeStandard, path.Mode)
+	assert.Equal(t, []string{
+		"steps[1] (review): manual step",
+		"steps[2].config.steps[0] (sub_workflow): sub-workflow",
+	}, path.Fallbacks)
+
+	validate := func(mode interface{}) error {
+		fields := definition("", map[string]interface{}{"name": "charge", "type": "custom"})
+		fields["execution_mode"] = mode
+		return NewValidator(DefaultValidationConfig()).ValidateDefinition(context.Background(), fields)
+	}
+	assert.NoError(t, validate("lightweight"))
+	var validationErr *ValidationError
+	for mode, code := range map[interface{}]string{"fast": CodeInvalidValue, true: CodeInvalidType} {
+		err := validate(mode)
+		require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+		assert.Equal(t, "execution_mode", validationErr.Errors[0].Field)
+		assert.Equal(t, code, validationErr.Errors[0].Code)
+	}
+}
+
+func TestValidateDefinitionExamples(t *testing.T) {
+	definition := func(examples ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"name": "orders",
+			"steps": []interface{}{
+				map[string]interface{}{"name": "fetch", "type": "custom"},
+			},
+			"inputs": map[string]interface{}{
+				"order_id": map[string]interface{}{"type": "string", "required": true},
+				"quantity": map[string]interface{}{"type": "integer"},
+			},
+			"outputs": map[string]interface{}{
+				"status": map[string]interface{}{"type": "string", "required": true},
+			},
+			"examples": examples,
+		}
+	}
+	validator := NewValidator(nil)
+
+	t.Run("conforming examples pass", func(t *testing.T) {
+		require.NoError(t, validator.ValidateDefinition(context.Background(), definition(
+			map[string]interface{}{
+				"name":   "paid order",
+				"input":  map[string]interface{}{"order_id": "ord-42", "quantity": float64(2)},
+				"output": map[string]interface{}{"status": "paid"},
+			},
+			map[string]interface{}{
+				"name":  "input only",
+				"input": map[string]interface{}{"order_id": "ord-43"},
+			},
+		)))
+	})
+
+	t.Run("non-conforming examples fail", func(t *testing.T) {
+		err := validator.ValidateDefinition(context.Background(), definition(
+			map[string]interface{}{
+				"name":   "stale",
+				"input":  map[string]interface{}{"quantity": 1.5, "customer": "c-1"},
+				"output": map[string]interface{}{"status": true},
+			},
+			map[string]interface{}{"name": "stale"},
+		))
+
+		var validationErr *ValidationError
+		require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+		assert.Equal(t, []FieldError{
+			{Field: "examples[0].input.order_id", Message: "example input is missing required field order_id", Code: CodeInvalidExample},
+			{Field: "examples[0].input.quantity", Message: "example input field quantity must be of type integer", Code: CodeInvalidExample},
+			{Field: "examples[0].input.customer", Message: "example input field customer is not declared in the workflow inputs", Code: CodeInvalidExample},
+			{Field: "examples[0].output.status", Message: "example output field status must be of type string", Code: CodeInvalidExample},
+			{Field: "examples[1].name", Message: "duplicate example name: stale", Code: CodeDuplicate},
+			{Field: "examples[1].input", Message: "example input is required", Code: CodeRequired},
+		}, validationErr.Errors)
+	})
+}
+
+func TestCustomValidators(t *testing.T) {
+	registry := NewCustomValidatorRegistry()
+	registry.Register("require-owner", requireOwner)
+	registry.Register("no-drafts", func(ctx context.Context, workflow *models.Workflow, changes VersionChanges) error {
+		if changes.Summary == "draft" {
+			return errors.New("draft versions cannot be created")
+		}
+		return nil
+	})
+	changes := func(metadata map[string]interface{}) VersionChanges {
+		return VersionChanges{
+			ChangeType: ChangeTypeMinor,
+			Summary:    "draft",
+			NewDefinition: map[string]interface{}{
+				"name":     "orders",
+				"metadata": metadata,
+				"steps":    []interface{}{map[string]interface{}{"name": "a", "type": "custom"}},
+			},
+		}
+	}
+	workflow := &models.Workflow{Name: "orders"}
+
+	validator := NewValidator(nil)
+	validator.SetCustomValidatorRegistry(registry)
+	require.NoError(t, validator.ValidateVersion(context.Background(), workflow, changes(nil)), "custom validators only run once enabled")
+
+	require.NoError(t, validator.UseCustomValidators("require-owner", "no-drafts"))
+	err := validator.ValidateVersion(context.Background(), workflow, changes(map[string]interface{}{"team": "payments"}))
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+	assert.Equal(t, []FieldError{
+		{Field: "definition.metadata.owner", Message: "workflow orders must name an owner", Code: CodeRequired},
+		{Field: "definition", Message: "no-drafts: draft versions cannot be created", Code: CodeInvalidValue},
+	}, validationErr.Errors)
+
+	require.NoError(t, validator.UseCustomValidators("require-owner"))
+	assert.NoError(t, validator.ValidateVersion(context.Background(), workflow, changes(map[string]interface{}{"owner": "payments"})))
+
+	assert.ErrorIs(t, validator.UseCustomValidators("require-owner", "missing"), ErrUnknownCustomValidator)
+	assert.Equal(t, []string{"no-drafts", "require-owner"}, registry.Names())
+}
@@ -0,0 +1,128 @@
+package versioning
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/dataflow"
+	"magic-flow/v2/pkg/models"
+)
+
+// ViewLimits bound the views of versions served by the graph and compare
+// endpoints. Views over a limit degrade to a summary rather than taking too
+// long to build and send.
+type ViewLimits struct {
+	// MaxGraphElements bounds the steps plus dependencies of step graphs
+	MaxGraphElements int `json:"max_graph_elements"`
+	// MaxComparisonBytes bounds the size, encoded as JSON, of the
+	// definitions of compared versions
+	MaxComparisonBytes int `json:"max_comparison_bytes"`
+}
+
+// DefaultViewLimits returns the default view limits
+func DefaultViewLimits() ViewLimits {
+	return ViewLimits{
+		MaxGraphElements:   2000,
+		MaxComparisonBytes: 512 * 1024,
+	}
+}
+
+// VersionGraph is the step graph of a version. Graphs over the view limits
+// are summarized: their nodes are left out.
+type VersionGraph struct {
+	VersionID     uuid.UUID    `json:"version_id"`
+	Version       string       `json:"version"`
+	Nodes         []GraphNode  `json:"nodes,omitempty"`
+	Summary       GraphSummary `json:"summary"`
+	Summarized    bool         `json:"summarized"`
+	SummaryReason string       `json:"summary_reason,omitempty"`
+}
+
+// GraphNode is a step of a version graph
+type GraphNode struct {
+	Name      string              `json:"name"`
+	Priority  models.StepPriority `json:"priority,omitempty"`
+	DependsOn []string            `json:"depends_on,omitempty"`
+	// Critical is set for the steps the response waits on
+	Critical bool `json:"critical"`
+}
+
+// GraphSummary sums a version graph up, and is all summarized graphs hold
+type GraphSummary struct {
+	Steps        int `json:"steps"`
+	Dependencies int `json:"dependencies"`
+	// CriticalSteps is the number of steps the response waits on
+	CriticalSteps int `json:"critical_steps"`
+	// Complexity holds the complexity measures of the definition
+	Complexity []Measure `json:"complexity"`
+}
+
+// BuildGraph builds the step graph of a version definition, summarized
+// when its steps and dependencies are more than MaxGraphElements
+func BuildGraph(definition map[string]interface{}, limits ViewLimits) (*VersionGraph, error) {
+	graph, err := dataflow.Analyze(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := graph.Steps()
+	nodes := make([]GraphNode, len(steps))
+	dependencies := 0
+	for i, step := range steps {
+		nodes[i] = GraphNode{
+			Name:      step,
+			Priority:  graph.Priority(step),
+			DependsOn: graph.Dependencies(step),
+			Critical:  graph.OnCriticalPath(step),
+		}
+		dependencies += len(nodes[i].DependsOn)
+	}
+
+	view := &VersionGraph{
+		Nodes: nodes,
+		Summary: GraphSummary{
+			Steps:         len(steps),
+			Dependencies:  dependencies,
+			CriticalSteps: len(graph.CriticalPath()),
+			Complexity:    MeasureComplexity(definition),
+		},
+	}
+	if elements := len(steps) + dependencies; limits.MaxGraphElements > 0 && elements > limits.MaxGraphElements {
+		view.Nodes = nil
+		view.Summarized = true
+		view.SummaryReason = fmt.Sprintf("graph of %d steps and %d dependencies exceeds the limit of %d elements",
+			len(steps), dependencies, limits.MaxGraphElements)
+	}
+	return view, nil
+}
+
+// comparisonOverLimit reports why the definitions of compared versions are
+// over MaxComparisonBytes, if they are
+func comparisonOverLimit(definition1, definition2 interface{}, limits ViewLimits) (string, bool) {
+	if limits.MaxComparisonBytes <= 0 {
+		return "", false
+	}
+	size := encodedSize(definition1) + encodedSize(definition2)
+	if size <= limits.MaxComparisonBytes {
+		return "", false
+	}
+	return fmt.Sprintf("definitions of %d bytes exceed the limit of %d bytes", size, limits.MaxComparisonBytes), true
+}
+
+// summarizeDifferences counts the differences between versions by type and
+// impact
+func summarizeDifferences(differences []VersionDifference) ComparisonSummary {
+	summary := ComparisonSummary{
+		TotalDifferences: len(differences),
+		ByType:           make(map[DifferenceType]int),
+		ByImpact:         make(map[ImpactLevel]int),
+	}
+	for _, difference := range differences {
+		summary.ByType[difference.Type]++
+		if difference.Impact != "" {
+			summary.ByImpact[difference.Impact]++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,84 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+)
+
+// WarmHosts opens connections to hosts ahead of the steps calling them,
+// perHost at a time so as many are left idle on the transport of client.
+// Each connection is opened with a HEAD request to the root of the host,
+// paying DNS resolution and the TLS handshake; the response status does
+// not matter. It returns the errors of the hosts that could not be reached.
+func WarmHosts(ctx context.Context, client *http.Client, hosts []string, perHost int) error {
+	if perHost <= 0 {
+		perHost = 1
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, host := range hosts {
+		for i := 0; i < perHost; i++ {
+			wg.Add(1)
+			go func(host string) {
+				defer wg.Done()
+				if err := warmHost(ctx, client, host); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}(host)
+		}
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func warmHost(ctx context.Context, client *http.Client, host string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, host+"/", nil)
+	if err != nil {
+		return fmt.Errorf("warm %s: %w", host, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("warm %s: %w", host, err)
+	}
+	// Drain the response so the connection is returned to the idle pool
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// ConnTrace reports whether a request was sent on a connection reused from
+// the idle pool
+type ConnTrace struct {
+	got    atomic.Bool
+	reused atomic.Bool
+}
+
+// WithConnTrace returns a context tracing the first connection the requests
+// sent with it get. Retried requests report the connection of their first
+// attempt.
+func WithConnTrace(ctx context.Context) (context.Context, *ConnTrace) {
+	trace := &ConnTrace{}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if trace.got.CompareAndSwap(false, true) {
+				trace.reused.Store(info.Reused)
+			}
+		},
+	}), trace
+}
+
+// Reused reports whether the first connection was reused
+func (t *ConnTrace) Reused() bool {
+	return t.reused.Load()
+}
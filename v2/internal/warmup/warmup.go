@@ -0,0 +1,169 @@
+// Package warmup prepares step executors for the workflow versions they are
+// about to run, so the first steps of an execution do not pay connection
+// setup and interpreter initialization. Hints are derived from a version
+// when it is activated, and executors warm up in the background: warm-up
+// never delays the activation and fails silently when the hints are wrong.
+package warmup
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"magic-flow/v2/internal/stepconfig"
+	"magic-flow/v2/pkg/models"
+)
+
+// Hints describe what the steps of a workflow version will need
+type Hints struct {
+	// Hosts are the origins the http steps call, such as
+	// https://orders.internal:443
+	Hosts []string
+	// ModuleSets are the pinned modules of the javascript script steps,
+	// one set per step
+	ModuleSets []map[string]string
+}
+
+// Empty reports whether the hints hold nothing to warm
+func (h *Hints) Empty() bool {
+	return h == nil || (len(h.Hosts) == 0 && len(h.ModuleSets) == 0)
+}
+
+// HintsFromDefinition derives the hints of a workflow definition. URLs whose
+// host is templated, such as https://${region}.orders.internal, are skipped.
+func HintsFromDefinition(definition *models.WorkflowDefinition) *Hints {
+	hints := &Hints{}
+	seen := make(map[string]bool)
+	for _, step := range definition.Spec.Steps {
+		switch step.Type {
+		case "http":
+			rawURL, _ := stepconfig.Section("http", step.Config)["url"].(string)
+			if origin, ok := Origin(rawURL); ok && !seen[origin] {
+				seen[origin] = true
+				hints.Hosts = append(hints.Hosts, origin)
+			}
+		case "script":
+			config := stepconfig.Section("script", step.Config)
+			if language, _ := config["language"].(string); language != "javascript" {
+				continue
+			}
+			set := make(map[string]string)
+			switch modules := config["modules"].(type) {
+			case map[string]string:
+				for spec, ref := range modules {
+					set[spec] = ref
+				}
+			case map[string]interface{}:
+				for spec, ref := range modules {
+					if s, ok := ref.(string); ok {
+						set[spec] = s
+					}
+				}
+			}
+			hints.ModuleSets = append(hints.ModuleSets, set)
+		}
+	}
+	sort.Strings(hints.Hosts)
+	return hints
+}
+
+// Origin returns the scheme, host and port of an http or https URL, the
+// port defaulting to the one of the scheme. URLs holding ${...} references
+// in their scheme or host have no origin.
+func Origin(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || strings.Contains(u.Host, "${") {
+		return "", false
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return "", false
+	}
+	return u.Scheme + "://" + net.JoinHostPort(u.Hostname(), port), true
+}
+
+// Config bounds warm-up and the pools it fills
+type Config struct {
+	// Enabled turns warm-up on activation on
+	Enabled bool
+	// ConnectionsPerHost is the number of connections opened to each host
+	// of the http steps
+	ConnectionsPerHost int
+	// MaxIdleConnsPerHost is the number of idle connections kept open to a
+	// host, warm or left by previous steps
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes connections idle for longer
+	IdleConnTimeout time.Duration
+	// InterpreterPoolSize is the number of initialized script interpreters
+	// kept ready
+	InterpreterPoolSize int
+	// InterpreterTTL discards ready interpreters unused for longer
+	InterpreterTTL time.Duration
+	// Timeout bounds the warm-up of one version by one executor
+	Timeout time.Duration
+}
+
+// DefaultConfig returns the default warm-up config
+func DefaultConfig() Config {
+	return Config{
+		Enabled:             true,
+		ConnectionsPerHost:  2,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+		InterpreterPoolSize: 4,
+		InterpreterTTL:      5 * time.Minute,
+		Timeout:             10 * time.Second,
+	}
+}
+
+// NewTransport creates the HTTP transport shared by the steps of every
+// execution, keeping connections to each host alive so later steps reuse
+// the connections warm-up and earlier steps opened
+func NewTransport(config Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+		if transport.MaxIdleConns < config.MaxIdleConnsPerHost {
+			transport.MaxIdleConns = config.MaxIdleConnsPerHost
+		}
+	}
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+	return transport
+}
+
+// MetricsRecorder records warm-up metrics. It is satisfied by the engine
+// metrics collectors.
+type MetricsRecorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// RecordStart records whether a step of an executor started warm, on a
+// reused connection or a ready interpreter, or cold, in the
+// executor_starts_total metric
+func RecordStart(metrics MetricsRecorder, executor string, warm bool) {
+	if metrics == nil {
+		return
+	}
+	start := "cold"
+	if warm {
+		start = "warm"
+	}
+	metrics.RecordMetric("executor_starts_total", 1, map[string]string{
+		"executor": executor,
+		"start":    start,
+	})
+}
@@ -0,0 +1,155 @@
+package warmup
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"magic-flow/v2/pkg/models"
+)
+
+func TestHintsFromDefinition(t *testing.T) {
+	definition := &models.WorkflowDefinition{
+		Spec: models.WorkflowSpec{
+			Steps: []models.WorkflowStep{
+				{Name: "fetch", Type: "http", Config: map[string]interface{}{"url": "https://orders.internal/orders/${order_id}"}},
+				{Name: "refund", Type: "http", Config: map[string]interface{}{"http": map[string]interface{}{"url": "http://payments.internal:8080/refunds"}}},
+				{Name: "again", Type: "http", Config: map[string]interface{}{"url": "https://orders.internal:443/status"}},
+				{Name: "regional", Type: "http", Config: map[string]interface{}{"url": "https://${region}.orders.internal/orders"}},
+				{Name: "score", Type: "script", Config: map[string]interface{}{
+					"language": "javascript",
+					"command":  "return require('utils').score(input)",
+					"modules":  map[string]interface{}{"utils": "utils@1.2.0"},
+				}},
+				{Name: "cleanup", Type: "script", Config: map[string]interface{}{"command": "rm -rf /tmp/orders"}},
+			},
+		},
+	}
+
+	hints := HintsFromDefinition(definition)
+	assert.Equal(t, []string{"http://payments.internal:8080", "https://orders.internal:443"}, hints.Hosts)
+	assert.Equal(t, []map[string]string{{"utils": "utils@1.2.0"}}, hints.ModuleSets)
+	assert.False(t, hints.Empty())
+	assert.True(t, HintsFromDefinition(&models.WorkflowDefinition{}).Empty())
+}
+
+// newTestClient returns a client of the shared transport trusting server
+func newTestClient(server *httptest.Server) *http.Client {
+	transport := NewTransport(DefaultConfig())
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	return &http.Client{Transport: transport}
+}
+
+// firstRequest sends the first request of a step and reports whether it
+// reused a connection
+func firstRequest(t testing.TB, client *http.Client, url string) bool {
+	ctx, trace := WithConnTrace(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return trace.Reused()
+}
+
+func TestWarmHosts(t *testing.T) {
+	var connections atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	origin, ok := Origin(server.URL + "/orders")
+	require.True(t, ok)
+
+	t.Run("cold clients open a connection", func(t *testing.T) {
+		assert.False(t, firstRequest(t, newTestClient(server), server.URL+"/orders"))
+	})
+
+	t.Run("warm clients reuse one", func(t *testing.T) {
+		client := newTestClient(server)
+		before := connections.Load()
+		require.NoError(t, WarmHosts(context.Background(), client, []string{origin}, 3))
+		assert.Equal(t, int64(3), connections.Load()-before)
+		assert.True(t, firstRequest(t, client, server.URL+"/orders"))
+		assert.Equal(t, int64(3), connections.Load()-before)
+	})
+
+	t.Run("unreachable hosts fail without blocking the others", func(t *testing.T) {
+		client := newTestClient(server)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		err := WarmHosts(ctx, client, []string{"https://127.0.0.1:1", origin}, 1)
+		assert.ErrorContains(t, err, "warm https://127.0.0.1:1")
+		assert.True(t, firstRequest(t, client, server.URL+"/orders"))
+	})
+}
+
+func TestOrigin(t *testing.T) {
+	for rawURL, want := range map[string]string{
+		"https://orders.internal/orders?id=1": "https://orders.internal:443",
+		"http://orders.internal/orders":       "http://orders.internal:80",
+		"http://[::1]:8080/orders":            "http://[::1]:8080",
+		"ftp://orders.internal/orders":        "",
+		"/orders":                             "",
+		"https://${host}/orders":              "",
+	} {
+		origin, ok := Origin(rawURL)
+		assert.Equal(t, want, origin, rawURL)
+		assert.Equal(t, want != "", ok, rawURL)
+	}
+}
+
+// BenchmarkFirstRequest measures the first http step of an execution of a
+// fixture workflow calling one TLS host, on a new transport and on one
+// warmed up when the version was activated
+func BenchmarkFirstRequest(b *testing.B) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"paid"}`))
+	}))
+	defer server.Close()
+
+	definition := &models.WorkflowDefinition{
+		Spec: models.WorkflowSpec{
+			Steps: []models.WorkflowStep{
+				{Name: "fetch", Type: "http", Config: map[string]interface{}{"url": server.URL + "/orders/42"}},
+			},
+		},
+	}
+	hints := HintsFromDefinition(definition)
+
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			client := newTestClient(server)
+			firstRequest(b, client, server.URL+"/orders/42")
+			client.CloseIdleConnections()
+		}
+	})
+
+	b.Run("warm", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			client := newTestClient(server)
+			if err := WarmHosts(context.Background(), client, hints.Hosts, 1); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+			firstRequest(b, client, server.URL+"/orders/42")
+			client.CloseIdleConnections()
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/policies"
+	"magic-flow/v2/pkg/models"
+)
+
+// Types of definition change events
+const (
+	EventWorkflowCreated    = "workflow.created"
+	EventVersionCreated     = "workflow.version_created"
+	EventVersionActivated   = "workflow.version_activated"
+	EventWorkflowDeprecated = "workflow.deprecated"
+	EventWorkflowDeleted    = "workflow.deleted"
+)
+
+// EventTypes lists the types of definition change events
+var EventTypes = []string{
+	EventWorkflowCreated,
+	EventVersionCreated,
+	EventVersionActivated,
+	EventWorkflowDeprecated,
+	EventWorkflowDeleted,
+}
+
+// ErrInvalidToken is returned for resume tokens that were not issued by the
+// watch API
+var ErrInvalidToken = errors.New("invalid resume token")
+
+// ErrInvalidFilter is returned for filters naming unknown event types or
+// malformed label selectors
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Event is a change to a workflow definition. Events are persisted in the
+// order they happened, their sequence numbering them across restarts.
+type Event struct {
+	// Sequence orders events, watchers resume after the sequence of the last
+	// event they received
+	Sequence     uint64     `json:"sequence" gorm:"primaryKey;autoIncrement"`
+	Type         string     `json:"type" gorm:"not null;index"`
+	WorkflowID   uuid.UUID  `json:"workflow_id" gorm:"type:uuid;not null;index"`
+	WorkflowName string     `json:"workflow_name"`
+	VersionID    *uuid.UUID `json:"version_id,omitempty" gorm:"type:uuid"`
+	Version      string     `json:"version,omitempty"`
+	// Namespace and Labels are those of the definition the event is about
+	Namespace string            `json:"namespace" gorm:"index"`
+	Labels    map[string]string `json:"labels,omitempty" gorm:"serializer:json"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// TableName returns the table name for the Event model
+func (Event) TableName() string {
+	return "workflow_definition_events"
+}
+
+// Token returns the token resuming a watch after the event
+func (e *Event) Token() string {
+	return FormatToken(e.Sequence)
+}
+
+// FormatToken returns the token resuming a watch after a sequence
+func FormatToken(sequence uint64) string {
+	return strconv.FormatUint(sequence, 10)
+}
+
+// ParseToken returns the sequence a resume token resumes after
+func ParseToken(token string) (uint64, error) {
+	sequence, err := strconv.ParseUint(token, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidToken, token)
+	}
+	return sequence, nil
+}
+
+// newWorkflowEvent returns an event about a workflow
+func newWorkflowEvent(eventType string, workflow *models.Workflow) *Event {
+	return &Event{
+		Type:         eventType,
+		WorkflowID:   workflow.ID,
+		WorkflowName: workflow.Name,
+		Version:      workflow.Version,
+		Namespace:    policies.Namespace(workflow.Definition),
+		Labels:       workflow.Definition.Metadata.Labels,
+	}
+}
+
+// newVersionEvent returns an event about a version of a workflow. Versions
+// are named after the workflow of their definition.
+func newVersionEvent(eventType string, version *models.WorkflowVersion) *Event {
+	versionID := version.ID
+	return &Event{
+		Type:         eventType,
+		WorkflowID:   version.WorkflowID,
+		WorkflowName: version.Definition.Metadata.Name,
+		VersionID:    &versionID,
+		Version:      version.Version,
+		Namespace:    policies.Namespace(version.Definition),
+		Labels:       version.Definition.Metadata.Labels,
+	}
+}
+
+// Filter selects the events a watcher or subscription receives. Empty
+// fields select every event.
+type Filter struct {
+	// Namespace selects the events of the definitions of a namespace
+	Namespace string `json:"namespace,omitempty"`
+	// Labels selects the events of the definitions with all of the labels
+	Labels map[string]string `json:"labels,omitempty"`
+	// Types selects events by type
+	Types []string `json:"types,omitempty"`
+}
+
+// Validate checks that the filter names known event types
+func (f Filter) Validate() error {
+	for _, eventType := range f.Types {
+		if !isEventType(eventType) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidFilter, eventType)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the filter selects an event
+func (f Filter) Matches(event *Event) bool {
+	if f.Namespace != "" && f.Namespace != event.Namespace {
+		return false
+	}
+	for key, value := range f.Labels {
+		if event.Labels[key] != value {
+			return false
+		}
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, eventType := range f.Types {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLabelSelector parses label selectors of the form key=value, as given
+// in the label query parameter of the watch API
+func ParseLabelSelector(selectors []string) (map[string]string, error) {
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(selectors))
+	for _, selector := range selectors {
+		key, value, ok := strings.Cut(selector, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w: label selector %q is not key=value", ErrInvalidFilter, selector)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+func isEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultPollTimeout is how long long-poll requests wait for events
+	// unless they set a timeout
+	defaultPollTimeout = 30 * time.Second
+	// maxPollTimeout bounds the timeout of long-poll requests
+	maxPollTimeout = 5 * time.Minute
+)
+
+// Handlers provides HTTP handlers for watching workflow definition changes
+type Handlers struct {
+	hub *Hub
+}
+
+// NewHandlers creates new watch handlers
+func NewHandlers(hub *Hub) *Handlers {
+	return &Handlers{hub: hub}
+}
+
+// RegisterRoutes registers watch routes
+func (h *Handlers) RegisterRoutes(router *gin.RouterGroup) {
+	v1 := router.Group("/v1")
+	{
+		v1.GET("/workflows/watch", h.Watch)
+		v1.POST("/workflows/watch/subscriptions", h.CreateSubscription)
+		v1.GET("/workflows/watch/subscriptions", h.ListSubscriptions)
+		v1.GET("/workflows/watch/subscriptions/:id", h.GetSubscription)
+		v1.DELETE("/workflows/watch/subscriptions/:id", h.DeleteSubscription)
+	}
+}
+
+// Watch streams workflow definition changes
+// @Summary Watch workflow definition changes
+// @Description Returns the definition change events after a resume token, as server-sent events when the request accepts text/event-stream and as a long-poll response otherwise. Without a token the watch starts at the current end of the event sequence.
+// @Tags watch
+// @Produce json
+// @Produce text/event-stream
+// @Param namespace query string false "Namespace of the definitions"
+// @Param label query []string false "Label selector, key=value" collectionFormat(multi)
+// @Param type query []string false "Event type" collectionFormat(multi)
+// @Param after query string false "Resume token, also read from the Last-Event-ID header"
+// @Param timeout query string false "Long-poll timeout, such as 30s"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/workflows/watch [get]
+func (h *Handlers) Watch(c *gin.Context) {
+	labels, err := ParseLabelSelector(c.QueryArray("label"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := Filter{
+		Namespace: c.Query("namespace"),
+		Labels:    labels,
+		Types:     c.QueryArray("type"),
+	}
+	if err := filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	after, err := h.resumeFrom(c)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidToken) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		h.stream(c, filter, after)
+		return
+	}
+	h.poll(c, filter, after)
+}
+
+// resumeFrom returns the sequence a watch resumes after: that of the resume
+// token of the request, or the current end of the event sequence
+func (h *Handlers) resumeFrom(c *gin.Context) (uint64, error) {
+	token := c.Query("after")
+	if token == "" {
+		token = c.GetHeader("Last-Event-ID")
+	}
+	if token == "" {
+		return h.hub.Latest(c.Request.Context())
+	}
+	return ParseToken(token)
+}
+
+// poll responds with the next events, or with none when the timeout
+// expires first. The token of the response resumes the watch.
+func (h *Handlers) poll(c *gin.Context, filter Filter, after uint64) {
+	timeout := defaultPollTimeout
+	if value := c.Query("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid timeout %q", value)})
+			return
+		}
+		timeout = parsed
+	}
+	if timeout > maxPollTimeout {
+		timeout = maxPollTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	events, next, err := h.hub.Next(ctx, filter, after)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if events == nil {
+		events = []*Event{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"token":  FormatToken(next),
+	})
+}
+
+// stream sends events as server-sent events until the client disconnects.
+// The ID of each event is its resume token, so reconnecting clients resume
+// through Last-Event-ID.
+func (h *Handlers) stream(c *gin.Context, filter Filter, after uint64) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	c.Stream(func(w io.Writer) bool {
+		events, next, err := h.hub.Next(ctx, filter, after)
+		if err != nil {
+			return false
+		}
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return false
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Token(), event.Type, data); err != nil {
+				return false
+			}
+		}
+		after = next
+		return true
+	})
+}
+
+// CreateSubscription creates a webhook subscription
+// @Summary Create a webhook subscription
+// @Description Delivers the definition change events the subscription selects to a webhook, signed with its secret and retried like the webhooks of execution events
+// @Tags watch
+// @Accept json
+// @Produce json
+// @Param subscription body Subscription true "Subscription"
+// @Success 201 {object} Subscription
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/workflows/watch/subscriptions [post]
+func (h *Handlers) CreateSubscription(c *gin.Context) {
+	var subscription Subscription
+	if err := c.ShouldBindJSON(&subscription); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.hub.CreateSubscription(c.Request.Context(), &subscription)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, created.redacted())
+}
+
+// ListSubscriptions lists the webhook subscriptions
+// @Summary List webhook subscriptions
+// @Tags watch
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/workflows/watch/subscriptions [get]
+func (h *Handlers) ListSubscriptions(c *gin.Context) {
+	subscriptions, err := h.hub.ListSubscriptions(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	redacted := make([]*Subscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		redacted = append(redacted, subscription.redacted())
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": redacted})
+}
+
+// GetSubscription returns a webhook subscription
+// @Summary Get a webhook subscription
+// @Tags watch
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} Subscription
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/watch/subscriptions/{id} [get]
+func (h *Handlers) GetSubscription(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return
+	}
+
+	subscription, err := h.hub.GetSubscription(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subscription.redacted())
+}
+
+// DeleteSubscription deletes a webhook subscription
+// @Summary Delete a webhook subscription
+// @Tags watch
+// @Param id path string true "Subscription ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/workflows/watch/subscriptions/{id} [delete]
+func (h *Handlers) DeleteSubscription(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return
+	}
+
+	if err := h.hub.DeleteSubscription(c.Request.Context(), id); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handlers) handleError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidSubscription):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrSubscriptionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrSubscriptionsDisabled):
+		status = http.StatusNotImplemented
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
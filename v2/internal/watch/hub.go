@@ -0,0 +1,314 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"magic-flow/v2/internal/delivery"
+	"magic-flow/v2/pkg/models"
+)
+
+// ErrInvalidSubscription is returned when a webhook subscription is invalid
+var ErrInvalidSubscription = errors.New("invalid subscription")
+
+// ErrSubscriptionsDisabled is returned when webhook subscriptions are
+// managed on a hub without a subscription store
+var ErrSubscriptionsDisabled = errors.New("webhook subscriptions are not enabled")
+
+// Config configures the watch hub
+type Config struct {
+	// PollInterval is how often waiting watchers check the store for the
+	// events published by other servers. Events published by this server
+	// wake them immediately.
+	PollInterval time.Duration
+	// BatchSize bounds the events read from the store at once, and so the
+	// events a watcher receives at once
+	BatchSize int
+}
+
+// DefaultConfig returns the default watch configuration
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: 2 * time.Second,
+		BatchSize:    100,
+	}
+}
+
+// Hub records definition change events and hands them to watchers and
+// webhook subscriptions.
+//
+// Events are persisted before they are handed out, so watchers resume from
+// the sequence of the last event they received across restarts, and
+// watchers connected to one server receive the events published by others.
+type Hub struct {
+	config        Config
+	store         Store
+	subscriptions SubscriptionStore
+	dispatcher    *delivery.Dispatcher
+	logger        *logrus.Logger
+	now           func() time.Time
+
+	mu sync.Mutex
+	// wake is closed when an event is published, waking the waiting
+	// watchers
+	wake chan struct{}
+	// webhooks holds the delivery handler of each subscription wrapped by
+	// the dispatcher
+	webhooks map[uuid.UUID]*webhookHandler
+}
+
+// NewHub creates a watch hub
+func NewHub(config Config, store Store, logger *logrus.Logger) *Hub {
+	defaults := DefaultConfig()
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &Hub{
+		config:   config,
+		store:    store,
+		logger:   logger,
+		now:      time.Now,
+		wake:     make(chan struct{}),
+		webhooks: make(map[uuid.UUID]*webhookHandler),
+	}
+}
+
+// SetSubscriptions enables webhook subscriptions. Events are delivered to
+// the subscriptions through the dispatcher, which retries failed deliveries
+// and parks the events a webhook keeps failing.
+func (h *Hub) SetSubscriptions(store SubscriptionStore, dispatcher *delivery.Dispatcher) {
+	h.subscriptions = store
+	h.dispatcher = dispatcher
+}
+
+// RegisterSubscriptions registers the stored subscriptions with the
+// dispatcher, so the events parked before a restart can be re-driven
+func (h *Hub) RegisterSubscriptions(ctx context.Context) error {
+	if h.subscriptions == nil {
+		return nil
+	}
+	subscriptions, err := h.subscriptions.ListSubscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	for _, subscription := range subscriptions {
+		h.consumer(subscription)
+	}
+	return nil
+}
+
+// Publish records an event and hands it to the watchers and subscriptions
+// its filters select
+func (h *Hub) Publish(ctx context.Context, event *Event) error {
+	event.Timestamp = h.now().UTC()
+	if err := h.store.Append(ctx, event); err != nil {
+		return fmt.Errorf("failed to record %s event: %w", event.Type, err)
+	}
+
+	h.mu.Lock()
+	close(h.wake)
+	h.wake = make(chan struct{})
+	h.mu.Unlock()
+
+	h.deliver(ctx, event)
+	return nil
+}
+
+// WorkflowCreated publishes the creation of a workflow
+func (h *Hub) WorkflowCreated(ctx context.Context, workflow *models.Workflow) {
+	h.publish(ctx, newWorkflowEvent(EventWorkflowCreated, workflow))
+}
+
+// VersionCreated publishes the creation of a workflow version
+func (h *Hub) VersionCreated(ctx context.Context, version *models.WorkflowVersion) {
+	h.publish(ctx, newVersionEvent(EventVersionCreated, version))
+}
+
+// VersionActivated publishes the activation of a workflow version,
+// including rollbacks to earlier versions
+func (h *Hub) VersionActivated(ctx context.Context, version *models.WorkflowVersion) {
+	h.publish(ctx, newVersionEvent(EventVersionActivated, version))
+}
+
+// WorkflowDeprecated publishes the deprecation of a workflow
+func (h *Hub) WorkflowDeprecated(ctx context.Context, workflow *models.Workflow) {
+	h.publish(ctx, newWorkflowEvent(EventWorkflowDeprecated, workflow))
+}
+
+// WorkflowDeleted publishes the deletion of a workflow
+func (h *Hub) WorkflowDeleted(ctx context.Context, workflow *models.Workflow) {
+	h.publish(ctx, newWorkflowEvent(EventWorkflowDeleted, workflow))
+}
+
+// publish publishes an event on behalf of a change that is already made.
+// The change stands regardless of failures, which are logged.
+func (h *Hub) publish(ctx context.Context, event *Event) {
+	if err := h.Publish(ctx, event); err != nil {
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type":  event.Type,
+			"workflow_id": event.WorkflowID,
+		}).Error("Failed to publish definition change event")
+	}
+}
+
+// Latest returns the sequence of the last event, where watches without a
+// resume token start
+func (h *Hub) Latest(ctx context.Context) (uint64, error) {
+	return h.store.Latest(ctx)
+}
+
+// Next returns the events after a sequence that the filter selects, waiting
+// until there is one. It also returns the sequence to resume from, which
+// is past the events the filter skipped so they are not read again. When
+// ctx ends first it returns no events, the sequence to resume from and the
+// error of ctx.
+func (h *Hub) Next(ctx context.Context, filter Filter, after uint64) ([]*Event, uint64, error) {
+	ticker := time.NewTicker(h.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Take the wake channel before reading, so events published
+		// meanwhile are not missed
+		h.mu.Lock()
+		wake := h.wake
+		h.mu.Unlock()
+
+		events, err := h.store.After(ctx, after, h.config.BatchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, after, ctx.Err()
+			}
+			return nil, after, fmt.Errorf("failed to read events: %w", err)
+		}
+
+		var selected []*Event
+		for _, event := range events {
+			after = event.Sequence
+			if filter.Matches(event) {
+				selected = append(selected, event)
+			}
+		}
+		if len(selected) > 0 {
+			return selected, after, nil
+		}
+		if len(events) == h.config.BatchSize {
+			continue
+		}
+
+		select {
+		case <-wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, after, ctx.Err()
+		}
+	}
+}
+
+// CreateSubscription creates a webhook subscription
+func (h *Hub) CreateSubscription(ctx context.Context, subscription *Subscription) (*Subscription, error) {
+	if h.subscriptions == nil {
+		return nil, ErrSubscriptionsDisabled
+	}
+	if err := validateSubscription(subscription); err != nil {
+		return nil, err
+	}
+
+	subscription.ID = uuid.New()
+	subscription.CreatedAt = h.now().UTC()
+	if err := h.subscriptions.CreateSubscription(ctx, subscription); err != nil {
+		return nil, fmt.Errorf("failed to create subscription: %w", err)
+	}
+	h.consumer(subscription)
+	return subscription, nil
+}
+
+// GetSubscription returns a webhook subscription
+func (h *Hub) GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	if h.subscriptions == nil {
+		return nil, ErrSubscriptionsDisabled
+	}
+	return h.subscriptions.GetSubscription(ctx, id)
+}
+
+// ListSubscriptions returns the webhook subscriptions, oldest first
+func (h *Hub) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	if h.subscriptions == nil {
+		return nil, ErrSubscriptionsDisabled
+	}
+	return h.subscriptions.ListSubscriptions(ctx)
+}
+
+// DeleteSubscription deletes a webhook subscription. The events still
+// queued for it are dropped.
+func (h *Hub) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	if h.subscriptions == nil {
+		return ErrSubscriptionsDisabled
+	}
+	if err := h.subscriptions.DeleteSubscription(ctx, id); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if handler, exists := h.webhooks[id]; exists {
+		handler.deleted.Store(true)
+	}
+	return nil
+}
+
+// deliver queues an event for the subscriptions selecting it. Subscriptions
+// are read from the store, so those created on other servers are included.
+func (h *Hub) deliver(ctx context.Context, event *Event) {
+	if h.subscriptions == nil {
+		return
+	}
+	subscriptions, err := h.subscriptions.ListSubscriptions(ctx)
+	if err != nil {
+		h.logger.WithError(err).WithField("sequence", event.Sequence).Error("Failed to list subscriptions, event not delivered to webhooks")
+		return
+	}
+	for _, subscription := range subscriptions {
+		if subscription.Filter().Matches(event) {
+			h.consumer(subscription).Enqueue(deliveryEvent(event))
+		}
+	}
+}
+
+// consumer returns the dispatcher consumer of a subscription, wrapping its
+// webhook the first time
+func (h *Hub) consumer(subscription *Subscription) *delivery.Consumer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	handler, exists := h.webhooks[subscription.ID]
+	if !exists {
+		handler = newWebhookHandler(subscription)
+		h.webhooks[subscription.ID] = handler
+		handler.consumer = h.dispatcher.Wrap(subscription.handlerName(), handler)
+	}
+	return handler.consumer
+}
+
+func validateSubscription(subscription *Subscription) error {
+	target, err := url.Parse(subscription.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidSubscription)
+	}
+	if err := subscription.Filter().Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrSubscriptionNotFound is returned when a webhook subscription does not
+// exist
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// Store persists definition change events
+type Store interface {
+	// Append stores an event, assigning it the next sequence
+	Append(ctx context.Context, event *Event) error
+	// After returns up to limit events with a sequence greater than
+	// sequence, in sequence order
+	After(ctx context.Context, sequence uint64, limit int) ([]*Event, error)
+	// Latest returns the sequence of the last event, 0 when there are none
+	Latest(ctx context.Context) (uint64, error)
+}
+
+// SubscriptionStore persists webhook subscriptions
+type SubscriptionStore interface {
+	CreateSubscription(ctx context.Context, subscription *Subscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	// ListSubscriptions returns the subscriptions, oldest first
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+}
+
+// MemoryStore is an in-memory Store and SubscriptionStore
+type MemoryStore struct {
+	mu            sync.Mutex
+	events        []*Event
+	subscriptions map[uuid.UUID]*Subscription
+}
+
+// NewMemoryStore creates an in-memory event and subscription store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{subscriptions: make(map[uuid.UUID]*Subscription)}
+}
+
+// Append stores an event, assigning it the next sequence
+func (s *MemoryStore) Append(ctx context.Context, event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.Sequence = uint64(len(s.events)) + 1
+	stored := *event
+	s.events = append(s.events, &stored)
+	return nil
+}
+
+// After returns up to limit events with a sequence greater than sequence
+func (s *MemoryStore) After(ctx context.Context, sequence uint64, limit int) ([]*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*Event
+	for i := sequence; i < uint64(len(s.events)) && len(events) < limit; i++ {
+		event := *s.events[i]
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// Latest returns the sequence of the last event
+func (s *MemoryStore) Latest(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return uint64(len(s.events)), nil
+}
+
+// CreateSubscription stores a subscription
+func (s *MemoryStore) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *subscription
+	s.subscriptions[subscription.ID] = &stored
+	return nil
+}
+
+// GetSubscription returns a subscription
+func (s *MemoryStore) GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription, exists := s.subscriptions[id]
+	if !exists {
+		return nil, ErrSubscriptionNotFound
+	}
+	found := *subscription
+	return &found, nil
+}
+
+// ListSubscriptions returns the subscriptions, oldest first
+func (s *MemoryStore) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriptions := make([]*Subscription, 0, len(s.subscriptions))
+	for _, subscription := range s.subscriptions {
+		found := *subscription
+		subscriptions = append(subscriptions, &found)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+		}
+		return subscriptions[i].ID.String() < subscriptions[j].ID.String()
+	})
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes a subscription
+func (s *MemoryStore) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.subscriptions[id]; !exists {
+		return ErrSubscriptionNotFound
+	}
+	delete(s.subscriptions, id)
+	return nil
+}
+
+// GormStore is a Store and SubscriptionStore backed by the application
+// database
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database event and subscription store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Migrate creates the definition events and subscriptions tables
+func (s *GormStore) Migrate() error {
+	return s.db.AutoMigrate(&Event{}, &Subscription{})
+}
+
+// Append stores an event, assigning it the next sequence
+func (s *GormStore) Append(ctx context.Context, event *Event) error {
+	return s.db.WithContext(ctx).Create(event).Error
+}
+
+// After returns up to limit events with a sequence greater than sequence
+func (s *GormStore) After(ctx context.Context, sequence uint64, limit int) ([]*Event, error) {
+	var events []*Event
+	err := s.db.WithContext(ctx).
+		Where("sequence > ?", sequence).
+		Order("sequence").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// Latest returns the sequence of the last event
+func (s *GormStore) Latest(ctx context.Context) (uint64, error) {
+	var sequence uint64
+	err := s.db.WithContext(ctx).Model(&Event{}).Select("COALESCE(MAX(sequence), 0)").Scan(&sequence).Error
+	return sequence, err
+}
+
+// CreateSubscription stores a subscription
+func (s *GormStore) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	return s.db.WithContext(ctx).Create(subscription).Error
+}
+
+// GetSubscription returns a subscription
+func (s *GormStore) GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	var subscription Subscription
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// ListSubscriptions returns the subscriptions, oldest first
+func (s *GormStore) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	var subscriptions []*Subscription
+	err := s.db.WithContext(ctx).Order("created_at, id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// DeleteSubscription removes a subscription
+func (s *GormStore) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Where("id = ?", id).Delete(&Subscription{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"magic-flow/v2/internal/delivery"
+	"magic-flow/v2/internal/engine"
+)
+
+// EventHeader carries the type of the definition change event of webhook
+// deliveries
+const EventHeader = "X-Magic-Flow-Event"
+
+// Subscription delivers the definition change events its filter selects to
+// a webhook. Deliveries are signed with the secret of the subscription, if
+// any, like the webhooks of execution events.
+type Subscription struct {
+	ID  uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	URL string    `json:"url" gorm:"not null"`
+	// Secret signs the deliveries, it is never returned by the API
+	Secret    string            `json:"secret,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty" gorm:"serializer:json"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" gorm:"serializer:json"`
+	Types     []string          `json:"types,omitempty" gorm:"serializer:json"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// TableName returns the table name for the Subscription model
+func (Subscription) TableName() string {
+	return "workflow_watch_subscriptions"
+}
+
+// Filter returns the filter selecting the events of the subscription
+func (s *Subscription) Filter() Filter {
+	return Filter{Namespace: s.Namespace, Labels: s.Labels, Types: s.Types}
+}
+
+// handlerName names the delivery handler of the subscription in parked
+// events
+func (s *Subscription) handlerName() string {
+	return "watch:" + s.ID.String()
+}
+
+// redacted returns a copy of the subscription without its secret
+func (s *Subscription) redacted() *Subscription {
+	redacted := *s
+	redacted.Secret = ""
+	return &redacted
+}
+
+// deliveryEvent converts a definition change event to the engine event the
+// delivery dispatcher queues. Definition events belong to no execution, so
+// a subscription receives them in sequence order.
+func deliveryEvent(event *Event) *engine.WorkflowEvent {
+	return &engine.WorkflowEvent{
+		Type:       event.Type,
+		WorkflowID: event.WorkflowID,
+		Timestamp:  event.Timestamp,
+		Sequence:   event.Sequence,
+		Data:       map[string]interface{}{"event": event},
+	}
+}
+
+// webhookHandler sends the definition change events of a subscription to
+// its webhook. It is wrapped by the delivery dispatcher, which retries
+// failed deliveries and parks the events failing repeatedly.
+type webhookHandler struct {
+	subscription *Subscription
+	client       *http.Client
+	// consumer queues the events of the subscription for the handler
+	consumer *delivery.Consumer
+	// deleted drops the events still queued for a deleted subscription
+	deleted atomic.Bool
+}
+
+func newWebhookHandler(subscription *Subscription) *webhookHandler {
+	return &webhookHandler{
+		subscription: subscription,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Handle posts the event to the webhook. Re-driven parked events hold the
+// decoded event, which is sent as is.
+func (h *webhookHandler) Handle(event *engine.WorkflowEvent) error {
+	if h.deleted.Load() {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"subscription_id": h.subscription.ID,
+		"event":           event.Data["event"],
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.subscription.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for key, value := range h.subscription.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Magic-Flow-Webhook/1.0")
+	req.Header.Set(EventHeader, event.Type)
+	if h.subscription.Secret != "" {
+		req.Header.Set(engine.SignatureHeader, engine.SignPayload(payload, h.subscription.Secret))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request to %s failed: %w", h.subscription.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %d", h.subscription.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// GetEventTypes returns the types of definition change events
+func (h *webhookHandler) GetEventTypes() []string {
+	return EventTypes
+}
@@ -0,0 +1,318 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"magic-flow/v2/internal/delivery"
+	"magic-flow/v2/internal/engine"
+	"magic-flow/v2/pkg/models"
+)
+
+func newWorkflow(name, namespace string, labels map[string]string) *models.Workflow {
+	if namespace != "" {
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels["namespace"] = namespace
+	}
+	return &models.Workflow{
+		ID:         uuid.New(),
+		Name:       name,
+		Version:    "1.0.0",
+		Definition: models.WorkflowDefinition{Metadata: models.WorkflowMetadata{Name: name, Labels: labels}},
+	}
+}
+
+func newVersion(workflow *models.Workflow, version string) *models.WorkflowVersion {
+	return &models.WorkflowVersion{
+		ID:         uuid.New(),
+		WorkflowID: workflow.ID,
+		Version:    version,
+		Definition: workflow.Definition,
+	}
+}
+
+// openStore opens a database store on a sqlite file, as a server does on
+// each start
+func openStore(t *testing.T, path string) *GormStore {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	store := NewGormStore(db)
+	require.NoError(t, store.Migrate())
+	return store
+}
+
+func next(t *testing.T, hub *Hub, filter Filter, after uint64) ([]*Event, uint64) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	events, cursor, err := hub.Next(ctx, filter, after)
+	if err != nil {
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	return events, cursor
+}
+
+func eventTypes(events []*Event) []string {
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestResumeTokenAcrossRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "watch.db")
+	config := Config{PollInterval: 10 * time.Millisecond, BatchSize: 2}
+	orders := newWorkflow("orders", "", nil)
+	v2 := newVersion(orders, "2.0.0")
+
+	hub := NewHub(config, openStore(t, path), logrus.New())
+	hub.WorkflowCreated(ctx, orders)
+	hub.VersionCreated(ctx, v2)
+	hub.VersionActivated(ctx, v2)
+
+	events, cursor := next(t, hub, Filter{}, 0)
+	require.Equal(t, []string{EventWorkflowCreated, EventVersionCreated}, eventTypes(events), "events are read in batches")
+	token := events[1].Token()
+	assert.Equal(t, FormatToken(cursor), token)
+
+	// The server restarts on the same database and more changes are made
+	restarted := NewHub(config, openStore(t, path), logrus.New())
+	restarted.WorkflowDeprecated(ctx, orders)
+
+	after, err := ParseToken(token)
+	require.NoError(t, err)
+	events, cursor = next(t, restarted, Filter{}, after)
+	require.Equal(t, []string{EventVersionActivated, EventWorkflowDeprecated}, eventTypes(events))
+	assert.Equal(t, v2.ID, *events[0].VersionID)
+	assert.Equal(t, "2.0.0", events[0].Version)
+	assert.Equal(t, "orders", events[1].WorkflowName)
+	assert.Equal(t, uint64(4), cursor)
+
+	latest, err := restarted.Latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), latest)
+	events, cursor = next(t, restarted, Filter{}, latest)
+	assert.Empty(t, events, "nothing happened after the latest event")
+	assert.Equal(t, uint64(4), cursor)
+
+	_, err = ParseToken("abc")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestFilters(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub(Config{PollInterval: 10 * time.Millisecond}, NewMemoryStore(), logrus.New())
+
+	orders := newWorkflow("orders", "payments", map[string]string{"team": "checkout"})
+	refunds := newWorkflow("refunds", "payments", map[string]string{"team": "support"})
+	reports := newWorkflow("reports", "", map[string]string{"team": "checkout"})
+	hub.WorkflowCreated(ctx, orders)
+	hub.WorkflowCreated(ctx, refunds)
+	hub.WorkflowCreated(ctx, reports)
+	hub.VersionActivated(ctx, newVersion(orders, "1.1.0"))
+	hub.WorkflowDeleted(ctx, reports)
+
+	names := func(events []*Event) []string {
+		var names []string
+		for _, event := range events {
+			names = append(names, event.Type+" "+event.WorkflowName)
+		}
+		return names
+	}
+
+	t.Run("namespace", func(t *testing.T) {
+		events, _ := next(t, hub, Filter{Namespace: "payments"}, 0)
+		assert.Equal(t, []string{"workflow.created orders", "workflow.created refunds", "workflow.version_activated orders"}, names(events))
+
+		events, _ = next(t, hub, Filter{Namespace: "default"}, 0)
+		assert.Equal(t, []string{"workflow.created reports", "workflow.deleted reports"}, names(events), "definitions without a namespace are in the default namespace")
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		events, _ := next(t, hub, Filter{Labels: map[string]string{"team": "checkout"}}, 0)
+		assert.Equal(t, []string{"workflow.created orders", "workflow.created reports", "workflow.version_activated orders", "workflow.deleted reports"}, names(events))
+
+		events, _ = next(t, hub, Filter{Namespace: "payments", Labels: map[string]string{"team": "checkout"}}, 0)
+		assert.Equal(t, []string{"workflow.created orders", "workflow.version_activated orders"}, names(events))
+	})
+
+	t.Run("types", func(t *testing.T) {
+		events, cursor := next(t, hub, Filter{Types: []string{EventVersionActivated}}, 0)
+		assert.Equal(t, []string{"workflow.version_activated orders"}, names(events))
+		assert.Equal(t, uint64(4), cursor)
+
+		// The cursor skips the events the filter skipped
+		events, cursor = next(t, hub, Filter{Types: []string{EventVersionActivated}}, cursor)
+		assert.Empty(t, events)
+		assert.Equal(t, uint64(5), cursor)
+
+		assert.ErrorIs(t, Filter{Types: []string{"execution.started"}}.Validate(), ErrInvalidFilter)
+	})
+
+	t.Run("label selectors", func(t *testing.T) {
+		labels, err := ParseLabelSelector([]string{"team=checkout", "tier="})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"team": "checkout", "tier": ""}, labels)
+
+		_, err = ParseLabelSelector([]string{"team"})
+		assert.ErrorIs(t, err, ErrInvalidFilter)
+	})
+
+	t.Run("waits for a matching event", func(t *testing.T) {
+		done := make(chan []*Event)
+		go func() {
+			events, _, _ := hub.Next(ctx, Filter{Namespace: "payments", Types: []string{EventWorkflowDeprecated}}, 5)
+			done <- events
+		}()
+
+		hub.WorkflowDeprecated(ctx, reports)
+		hub.WorkflowDeprecated(ctx, refunds)
+
+		select {
+		case events := <-done:
+			assert.Equal(t, []string{"workflow.deprecated refunds"}, names(events))
+		case <-time.After(5 * time.Second):
+			t.Fatal("watcher was not woken by the published event")
+		}
+	})
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var bodies [][]byte
+	var signatures []string
+	failures := 1
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, body)
+		signatures = append(signatures, r.Header.Get(engine.SignatureHeader))
+		assert.Equal(t, "payments", r.Header.Get("X-Team"))
+	}))
+	defer webhook.Close()
+
+	dispatcher := delivery.NewDispatcher(delivery.Config{MaxAttempts: 3, RetryBackoff: time.Millisecond}, delivery.NewMemoryStore(), nil, nil, logrus.New())
+	defer dispatcher.Stop()
+	store := NewMemoryStore()
+	hub := NewHub(Config{}, store, logrus.New())
+	hub.SetSubscriptions(store, dispatcher)
+
+	_, err := hub.CreateSubscription(ctx, &Subscription{URL: "ftp://example.com"})
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+
+	subscription, err := hub.CreateSubscription(ctx, &Subscription{
+		URL:       webhook.URL,
+		Secret:    "s3cret",
+		Headers:   map[string]string{"X-Team": "payments"},
+		Namespace: "payments",
+		Types:     []string{EventVersionActivated},
+	})
+	require.NoError(t, err)
+
+	orders := newWorkflow("orders", "payments", nil)
+	v2 := newVersion(orders, "2.0.0")
+	hub.VersionCreated(ctx, v2)
+	hub.VersionActivated(ctx, newVersion(newWorkflow("reports", "", nil), "1.0.0"))
+	hub.VersionActivated(ctx, v2)
+
+	// The first delivery fails and is retried
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(bodies) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, engine.SignPayload(bodies[0], "s3cret"), signatures[0])
+	var payload struct {
+		SubscriptionID uuid.UUID `json:"subscription_id"`
+		Event          Event     `json:"event"`
+	}
+	require.NoError(t, json.Unmarshal(bodies[0], &payload))
+	mu.Unlock()
+	assert.Equal(t, subscription.ID, payload.SubscriptionID)
+	assert.Equal(t, EventVersionActivated, payload.Event.Type)
+	assert.Equal(t, uint64(3), payload.Event.Sequence)
+	assert.Equal(t, v2.ID, *payload.Event.VersionID)
+
+	// Deleted subscriptions receive no further events
+	require.NoError(t, hub.DeleteSubscription(ctx, subscription.ID))
+	hub.VersionActivated(ctx, v2)
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	assert.Len(t, bodies, 1)
+	mu.Unlock()
+	assert.ErrorIs(t, hub.DeleteSubscription(ctx, subscription.ID), ErrSubscriptionNotFound)
+}
+
+func TestWatchLongPoll(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	hub := NewHub(Config{PollInterval: 10 * time.Millisecond}, NewMemoryStore(), logrus.New())
+	router := gin.New()
+	NewHandlers(hub).RegisterRoutes(router.Group("/api"))
+
+	orders := newWorkflow("orders", "payments", map[string]string{"team": "checkout"})
+	hub.WorkflowCreated(ctx, orders)
+	hub.WorkflowCreated(ctx, newWorkflow("reports", "", nil))
+
+	get := func(target string) (int, map[string]interface{}) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		return recorder.Code, body
+	}
+
+	code, body := get("/api/v1/workflows/watch?after=0&label=team=checkout")
+	require.Equal(t, http.StatusOK, code, body)
+	require.Len(t, body["events"], 1)
+	assert.Equal(t, "orders", body["events"].([]interface{})[0].(map[string]interface{})["workflow_name"])
+	assert.Equal(t, "1", body["token"])
+
+	// Without a token the watch starts at the end of the events and times
+	// out with the token to resume from
+	code, body = get("/api/v1/workflows/watch?timeout=20ms")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Empty(t, body["events"])
+	assert.Equal(t, "2", body["token"])
+
+	code, _ = get("/api/v1/workflows/watch?after=abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/api/v1/workflows/watch?type=workflow.renamed")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,11 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_workflow_caller_usages_last_executed_at;
+DROP INDEX IF EXISTS idx_workflow_versions_deprecation;
+DROP INDEX IF EXISTS idx_workflows_deprecation;
+
+-- Drop workflow caller usages table
+DROP TABLE IF EXISTS workflow_caller_usages;
+
+-- Drop deprecation state
+ALTER TABLE workflow_versions DROP COLUMN IF EXISTS deprecation;
+ALTER TABLE workflows DROP COLUMN IF EXISTS deprecation;
@@ -0,0 +1,18 @@
+-- Add deprecation state to workflows and workflow versions
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS deprecation JSONB;
+ALTER TABLE workflow_versions ADD COLUMN IF NOT EXISTS deprecation JSONB;
+
+-- Create workflow caller usages table
+CREATE TABLE IF NOT EXISTS workflow_caller_usages (
+    caller VARCHAR(255) NOT NULL,
+    workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    version VARCHAR(100) NOT NULL DEFAULT '',
+    executions BIGINT NOT NULL DEFAULT 0,
+    last_executed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (caller, workflow_id, version)
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_workflows_deprecation ON workflows((deprecation IS NOT NULL));
+CREATE INDEX IF NOT EXISTS idx_workflow_versions_deprecation ON workflow_versions((deprecation IS NOT NULL));
+CREATE INDEX IF NOT EXISTS idx_workflow_caller_usages_last_executed_at ON workflow_caller_usages(last_executed_at);
@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_changesets_applied_at;
+DROP INDEX IF EXISTS idx_changesets_author;
+
+-- Drop changesets table
+DROP TABLE IF EXISTS changesets;
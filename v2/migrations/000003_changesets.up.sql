@@ -0,0 +1,13 @@
+-- Create changesets table
+CREATE TABLE IF NOT EXISTS changesets (
+    id UUID PRIMARY KEY,
+    description TEXT,
+    author VARCHAR(255),
+    operations JSONB NOT NULL,
+    results JSONB NOT NULL,
+    applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_changesets_author ON changesets(author);
+CREATE INDEX IF NOT EXISTS idx_changesets_applied_at ON changesets(applied_at);
@@ -0,0 +1,3 @@
+-- Convert execution and step durations back to whole seconds
+UPDATE step_executions SET duration = duration / 1000 WHERE duration IS NOT NULL;
+UPDATE executions SET duration = duration / 1000 WHERE duration IS NOT NULL;
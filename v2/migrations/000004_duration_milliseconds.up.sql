@@ -0,0 +1,3 @@
+-- Convert execution and step durations recorded in whole seconds to milliseconds
+UPDATE executions SET duration = duration * 1000 WHERE duration IS NOT NULL;
+UPDATE step_executions SET duration = duration * 1000 WHERE duration IS NOT NULL;
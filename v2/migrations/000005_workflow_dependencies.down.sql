@@ -0,0 +1,7 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_workflow_dependencies_depends_on;
+DROP INDEX IF EXISTS idx_workflow_dependencies_version_id;
+DROP INDEX IF EXISTS idx_workflow_dependencies_workflow_id;
+
+-- Drop workflow dependencies table
+DROP TABLE IF EXISTS workflow_dependencies;
@@ -0,0 +1,15 @@
+-- Create workflow dependencies table
+CREATE TABLE IF NOT EXISTS workflow_dependencies (
+    id UUID PRIMARY KEY,
+    workflow_id UUID NOT NULL,
+    version_id UUID,
+    depends_on UUID NOT NULL,
+    kind VARCHAR(50) NOT NULL,
+    path TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_workflow_dependencies_workflow_id ON workflow_dependencies(workflow_id);
+CREATE INDEX IF NOT EXISTS idx_workflow_dependencies_version_id ON workflow_dependencies(version_id);
+CREATE INDEX IF NOT EXISTS idx_workflow_dependencies_depends_on ON workflow_dependencies(depends_on);
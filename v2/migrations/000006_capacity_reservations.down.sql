@@ -0,0 +1,9 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_capacity_reservations_ends_at;
+DROP INDEX IF EXISTS idx_capacity_reservations_starts_at;
+DROP INDEX IF EXISTS idx_capacity_reservations_workflow_id;
+DROP INDEX IF EXISTS idx_capacity_reservations_namespace;
+DROP INDEX IF EXISTS idx_capacity_reservations_token;
+
+-- Drop capacity reservations table
+DROP TABLE IF EXISTS capacity_reservations;
@@ -0,0 +1,21 @@
+-- Create capacity reservations table
+CREATE TABLE IF NOT EXISTS capacity_reservations (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    namespace VARCHAR(255),
+    workflow_id UUID,
+    token VARCHAR(64) NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    slots INTEGER NOT NULL,
+    executions INTEGER NOT NULL,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Create indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_capacity_reservations_token ON capacity_reservations(token);
+CREATE INDEX IF NOT EXISTS idx_capacity_reservations_namespace ON capacity_reservations(namespace);
+CREATE INDEX IF NOT EXISTS idx_capacity_reservations_workflow_id ON capacity_reservations(workflow_id);
+CREATE INDEX IF NOT EXISTS idx_capacity_reservations_starts_at ON capacity_reservations(starts_at);
+CREATE INDEX IF NOT EXISTS idx_capacity_reservations_ends_at ON capacity_reservations(ends_at);
@@ -0,0 +1,11 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_approval_delegations_delegate;
+DROP INDEX IF EXISTS idx_approval_delegations_delegator;
+DROP INDEX IF EXISTS idx_approval_requests_expires_at;
+DROP INDEX IF EXISTS idx_approval_requests_status;
+DROP INDEX IF EXISTS idx_approval_requests_workflow_id;
+DROP INDEX IF EXISTS idx_approval_requests_execution_id;
+
+-- Drop approval tables
+DROP TABLE IF EXISTS approval_delegations;
+DROP TABLE IF EXISTS approval_requests;
@@ -0,0 +1,37 @@
+-- Create approval requests table
+CREATE TABLE IF NOT EXISTS approval_requests (
+    id UUID PRIMARY KEY,
+    execution_id UUID NOT NULL,
+    workflow_id UUID,
+    step VARCHAR(255) NOT NULL,
+    message TEXT,
+    submitter VARCHAR(255),
+    policy JSONB,
+    approvals JSONB,
+    status VARCHAR(20) NOT NULL,
+    reminders_sent INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create approval delegations table
+CREATE TABLE IF NOT EXISTS approval_delegations (
+    id UUID PRIMARY KEY,
+    delegator VARCHAR(255) NOT NULL,
+    delegate VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_by VARCHAR(255)
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_approval_requests_execution_id ON approval_requests(execution_id);
+CREATE INDEX IF NOT EXISTS idx_approval_requests_workflow_id ON approval_requests(workflow_id);
+CREATE INDEX IF NOT EXISTS idx_approval_requests_status ON approval_requests(status);
+CREATE INDEX IF NOT EXISTS idx_approval_requests_expires_at ON approval_requests(expires_at);
+CREATE INDEX IF NOT EXISTS idx_approval_delegations_delegator ON approval_delegations(delegator);
+CREATE INDEX IF NOT EXISTS idx_approval_delegations_delegate ON approval_delegations(delegate);
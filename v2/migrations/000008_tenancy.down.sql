@@ -0,0 +1,11 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_executions_tenant_id;
+
+-- Restore globally unique workflow names. It fails while tenants share a
+-- workflow name.
+DROP INDEX IF EXISTS idx_workflows_tenant_name;
+ALTER TABLE workflows ADD CONSTRAINT workflows_name_key UNIQUE (name);
+
+-- Drop tenant columns
+ALTER TABLE executions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE workflows DROP COLUMN IF EXISTS tenant_id;
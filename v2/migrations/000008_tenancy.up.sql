@@ -0,0 +1,11 @@
+-- Add the owning tenant to workflows and executions. Records of
+-- single-tenant deployments have no tenant.
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Make workflow names unique per tenant rather than globally
+ALTER TABLE workflows DROP CONSTRAINT IF EXISTS workflows_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflows_tenant_name ON workflows(tenant_id, name);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_executions_tenant_id ON executions(tenant_id);
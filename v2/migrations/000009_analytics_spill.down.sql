@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_analytics_spill_sink_sequence;
+
+-- Drop analytics spill table
+DROP TABLE IF EXISTS analytics_spill;
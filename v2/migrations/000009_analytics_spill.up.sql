@@ -0,0 +1,11 @@
+-- Create analytics spill table
+CREATE TABLE IF NOT EXISTS analytics_spill (
+    id BIGSERIAL PRIMARY KEY,
+    sink VARCHAR(255) NOT NULL,
+    sequence BIGINT NOT NULL,
+    record TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_analytics_spill_sink_sequence ON analytics_spill(sink, sequence);
@@ -0,0 +1,8 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_lock_audit_correlation_id;
+DROP INDEX IF EXISTS idx_lock_audit_lock_name;
+DROP INDEX IF EXISTS idx_execution_locks_holder;
+
+-- Drop lock tables
+DROP TABLE IF EXISTS lock_audit;
+DROP TABLE IF EXISTS execution_locks;
@@ -0,0 +1,27 @@
+-- Create execution locks table
+CREATE TABLE IF NOT EXISTS execution_locks (
+    name VARCHAR(255) PRIMARY KEY,
+    holder VARCHAR(255),
+    correlation_id VARCHAR(255),
+    token BIGINT NOT NULL,
+    acquired_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create lock audit table
+CREATE TABLE IF NOT EXISTS lock_audit (
+    id BIGSERIAL PRIMARY KEY,
+    lock_name VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    holder VARCHAR(255),
+    correlation_id VARCHAR(255),
+    token BIGINT,
+    actor VARCHAR(255),
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_execution_locks_holder ON execution_locks(holder);
+CREATE INDEX IF NOT EXISTS idx_lock_audit_lock_name ON lock_audit(lock_name);
+CREATE INDEX IF NOT EXISTS idx_lock_audit_correlation_id ON lock_audit(correlation_id);
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_script_module_version;
+
+-- Drop script modules table
+DROP TABLE IF EXISTS script_modules;
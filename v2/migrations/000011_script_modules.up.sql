@@ -0,0 +1,14 @@
+-- Create script modules table
+CREATE TABLE IF NOT EXISTS script_modules (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    version VARCHAR(100) NOT NULL,
+    description TEXT,
+    source TEXT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_script_module_version ON script_modules(name, version);
@@ -0,0 +1,11 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_execution_events_correlation_id;
+DROP INDEX IF EXISTS idx_step_executions_correlation_id;
+DROP INDEX IF EXISTS idx_executions_parent_execution_id;
+DROP INDEX IF EXISTS idx_executions_correlation_id;
+
+-- Drop correlation columns
+ALTER TABLE execution_events DROP COLUMN IF EXISTS correlation_id;
+ALTER TABLE step_executions DROP COLUMN IF EXISTS correlation_id;
+ALTER TABLE executions DROP COLUMN IF EXISTS parent_execution_id;
+ALTER TABLE executions DROP COLUMN IF EXISTS correlation_id;
@@ -0,0 +1,12 @@
+-- Add correlation IDs to executions, step executions and execution events,
+-- and the execution spawning an execution
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(255);
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS parent_execution_id UUID;
+ALTER TABLE step_executions ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(255);
+ALTER TABLE execution_events ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(255);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_executions_correlation_id ON executions(correlation_id);
+CREATE INDEX IF NOT EXISTS idx_executions_parent_execution_id ON executions(parent_execution_id);
+CREATE INDEX IF NOT EXISTS idx_step_executions_correlation_id ON step_executions(correlation_id);
+CREATE INDEX IF NOT EXISTS idx_execution_events_correlation_id ON execution_events(correlation_id);
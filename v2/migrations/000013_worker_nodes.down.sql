@@ -0,0 +1,13 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_executions_node_id;
+DROP INDEX IF EXISTS idx_execution_placements_node_id;
+DROP INDEX IF EXISTS idx_execution_placements_execution_id;
+DROP INDEX IF EXISTS idx_worker_nodes_last_heartbeat;
+DROP INDEX IF EXISTS idx_worker_nodes_status;
+
+-- Drop the node of executions
+ALTER TABLE executions DROP COLUMN IF EXISTS node_id;
+
+-- Drop node tables
+DROP TABLE IF EXISTS execution_placements;
+DROP TABLE IF EXISTS worker_nodes;
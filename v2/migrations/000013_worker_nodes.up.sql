@@ -0,0 +1,35 @@
+-- Create worker nodes table
+CREATE TABLE IF NOT EXISTS worker_nodes (
+    id VARCHAR(255) PRIMARY KEY,
+    hostname VARCHAR(255),
+    version VARCHAR(100),
+    capacity INTEGER,
+    executors JSONB,
+    status VARCHAR(50) NOT NULL,
+    status_reason TEXT,
+    status_changed_by VARCHAR(255),
+    started_at TIMESTAMP WITH TIME ZONE,
+    last_heartbeat TIMESTAMP WITH TIME ZONE,
+    running_executions INTEGER,
+    queue_depth INTEGER
+);
+
+-- Create execution placements table
+CREATE TABLE IF NOT EXISTS execution_placements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    execution_id UUID NOT NULL REFERENCES executions(id) ON DELETE CASCADE,
+    node_id VARCHAR(255) NOT NULL,
+    hop VARCHAR(50) NOT NULL,
+    placed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Add the node running an execution
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS node_id VARCHAR(255);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_worker_nodes_status ON worker_nodes(status);
+CREATE INDEX IF NOT EXISTS idx_worker_nodes_last_heartbeat ON worker_nodes(last_heartbeat);
+CREATE INDEX IF NOT EXISTS idx_execution_placements_execution_id ON execution_placements(execution_id);
+CREATE INDEX IF NOT EXISTS idx_execution_placements_node_id ON execution_placements(node_id);
+CREATE INDEX IF NOT EXISTS idx_executions_node_id ON executions(node_id);
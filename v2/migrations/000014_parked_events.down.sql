@@ -0,0 +1,7 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_parked_events_execution_id;
+DROP INDEX IF EXISTS idx_parked_events_ordering_key;
+DROP INDEX IF EXISTS idx_parked_events_handler;
+
+-- Drop parked events table
+DROP TABLE IF EXISTS parked_events;
@@ -0,0 +1,20 @@
+-- Create parked events table
+CREATE TABLE IF NOT EXISTS parked_events (
+    id VARCHAR(255) PRIMARY KEY,
+    handler VARCHAR(255) NOT NULL,
+    ordering_key VARCHAR(255),
+    event_type VARCHAR(100) NOT NULL,
+    execution_id VARCHAR(255),
+    workflow_id VARCHAR(255),
+    payload TEXT NOT NULL,
+    attempts INTEGER,
+    last_error TEXT,
+    holds_order BOOLEAN,
+    parked_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_parked_events_handler ON parked_events(handler);
+CREATE INDEX IF NOT EXISTS idx_parked_events_ordering_key ON parked_events(ordering_key);
+CREATE INDEX IF NOT EXISTS idx_parked_events_execution_id ON parked_events(execution_id);
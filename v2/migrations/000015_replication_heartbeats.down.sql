@@ -0,0 +1,2 @@
+-- Drop replication heartbeats table
+DROP TABLE IF EXISTS replication_heartbeats;
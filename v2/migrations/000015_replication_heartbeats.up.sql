@@ -0,0 +1,6 @@
+-- Create replication heartbeats table, replica lag is measured from the
+-- heartbeat the primary writes
+CREATE TABLE IF NOT EXISTS replication_heartbeats (
+    id INTEGER PRIMARY KEY,
+    beat_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
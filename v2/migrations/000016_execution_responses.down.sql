@@ -0,0 +1,4 @@
+-- Drop response columns
+ALTER TABLE step_executions DROP COLUMN IF EXISTS after_response;
+ALTER TABLE executions DROP COLUMN IF EXISTS warnings;
+ALTER TABLE executions DROP COLUMN IF EXISTS responded_at;
@@ -0,0 +1,5 @@
+-- Add the response time and background step warnings to executions, and
+-- mark the steps completed after the response
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS responded_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS warnings JSONB;
+ALTER TABLE step_executions ADD COLUMN IF NOT EXISTS after_response BOOLEAN NOT NULL DEFAULT FALSE;
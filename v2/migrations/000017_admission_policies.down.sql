@@ -0,0 +1,12 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_policy_decisions_evaluated_at;
+DROP INDEX IF EXISTS idx_policy_decisions_decision;
+DROP INDEX IF EXISTS idx_policy_decisions_workflow_id;
+DROP INDEX IF EXISTS idx_policy_decisions_hook;
+DROP INDEX IF EXISTS idx_policy_decisions_policy_id;
+DROP INDEX IF EXISTS idx_admission_policies_namespace;
+DROP INDEX IF EXISTS idx_admission_policies_name;
+
+-- Drop policy tables
+DROP TABLE IF EXISTS policy_decisions;
+DROP TABLE IF EXISTS admission_policies;
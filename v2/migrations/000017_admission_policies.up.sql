@@ -0,0 +1,40 @@
+-- Create admission policies table
+CREATE TABLE IF NOT EXISTS admission_policies (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    namespace VARCHAR(255),
+    hooks JSONB,
+    rules JSONB,
+    timeout_ms INTEGER,
+    failure_mode VARCHAR(50),
+    time_zone VARCHAR(100),
+    enabled BOOLEAN,
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create policy decisions table
+CREATE TABLE IF NOT EXISTS policy_decisions (
+    id BIGSERIAL PRIMARY KEY,
+    policy_id UUID,
+    policy_name VARCHAR(255),
+    hook VARCHAR(50),
+    namespace VARCHAR(255),
+    workflow_id UUID,
+    version_id UUID,
+    decision VARCHAR(50),
+    reason TEXT,
+    error TEXT,
+    actor VARCHAR(255),
+    evaluated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_admission_policies_name ON admission_policies(name);
+CREATE INDEX IF NOT EXISTS idx_admission_policies_namespace ON admission_policies(namespace);
+CREATE INDEX IF NOT EXISTS idx_policy_decisions_policy_id ON policy_decisions(policy_id);
+CREATE INDEX IF NOT EXISTS idx_policy_decisions_hook ON policy_decisions(hook);
+CREATE INDEX IF NOT EXISTS idx_policy_decisions_workflow_id ON policy_decisions(workflow_id);
+CREATE INDEX IF NOT EXISTS idx_policy_decisions_decision ON policy_decisions(decision);
+CREATE INDEX IF NOT EXISTS idx_policy_decisions_evaluated_at ON policy_decisions(evaluated_at);
@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_executions_triage_class;
+
+-- Drop triage columns
+ALTER TABLE executions DROP COLUMN IF EXISTS triage;
+ALTER TABLE executions DROP COLUMN IF EXISTS triage_class;
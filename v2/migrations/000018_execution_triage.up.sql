@@ -0,0 +1,6 @@
+-- Add the triage classification of failed executions
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS triage_class VARCHAR(100);
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS triage JSONB;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_executions_triage_class ON executions(triage_class);
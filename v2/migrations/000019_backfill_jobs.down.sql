@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_backfill_jobs_status;
+
+-- Drop backfill jobs table
+DROP TABLE IF EXISTS backfill_jobs;
@@ -0,0 +1,19 @@
+-- Create backfill jobs table
+CREATE TABLE IF NOT EXISTS backfill_jobs (
+    id UUID PRIMARY KEY,
+    processor VARCHAR(255) NOT NULL,
+    target JSONB,
+    batch_size INTEGER,
+    rate_limit INTEGER,
+    status VARCHAR(50),
+    cursor JSONB,
+    report JSONB,
+    error TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_backfill_jobs_status ON backfill_jobs(status);
@@ -0,0 +1,10 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_slo_audit_workflow_id;
+DROP INDEX IF EXISTS idx_slo_audit_slo_id;
+DROP INDEX IF EXISTS idx_slo_statuses_workflow_id;
+DROP INDEX IF EXISTS idx_slos_workflow_name;
+
+-- Drop SLO tables
+DROP TABLE IF EXISTS slo_audit;
+DROP TABLE IF EXISTS slo_statuses;
+DROP TABLE IF EXISTS slos;
@@ -0,0 +1,56 @@
+-- Create SLOs table
+CREATE TABLE IF NOT EXISTS slos (
+    id UUID PRIMARY KEY,
+    workflow_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    step VARCHAR(255),
+    type VARCHAR(50) NOT NULL,
+    threshold VARCHAR(100),
+    target DOUBLE PRECISION NOT NULL,
+    "window" VARCHAR(100) NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    window_start TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create SLO statuses table
+CREATE TABLE IF NOT EXISTS slo_statuses (
+    slo_id UUID PRIMARY KEY,
+    workflow_id UUID NOT NULL,
+    name VARCHAR(255),
+    step VARCHAR(255),
+    type VARCHAR(50),
+    target DOUBLE PRECISION,
+    window_start TIMESTAMP WITH TIME ZONE,
+    evaluated_at TIMESTAMP WITH TIME ZONE,
+    total BIGINT,
+    bad BIGINT,
+    compliance DOUBLE PRECISION,
+    budget_remaining DOUBLE PRECISION,
+    fast_burn_rate DOUBLE PRECISION,
+    slow_burn_rate DOUBLE PRECISION,
+    alert VARCHAR(50),
+    notified VARCHAR(50),
+    suppressed_by VARCHAR(255)
+);
+
+-- Create SLO audit table
+CREATE TABLE IF NOT EXISTS slo_audit (
+    id BIGSERIAL PRIMARY KEY,
+    slo_id UUID NOT NULL,
+    workflow_id UUID NOT NULL,
+    name VARCHAR(255),
+    action VARCHAR(50) NOT NULL,
+    changes TEXT,
+    window_start TIMESTAMP WITH TIME ZONE,
+    actor VARCHAR(255),
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_slos_workflow_name ON slos(workflow_id, name);
+CREATE INDEX IF NOT EXISTS idx_slo_statuses_workflow_id ON slo_statuses(workflow_id);
+CREATE INDEX IF NOT EXISTS idx_slo_audit_slo_id ON slo_audit(slo_id);
+CREATE INDEX IF NOT EXISTS idx_slo_audit_workflow_id ON slo_audit(workflow_id);
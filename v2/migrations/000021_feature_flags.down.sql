@@ -0,0 +1,10 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_feature_flags_workflow_id;
+DROP INDEX IF EXISTS idx_feature_flags_namespace;
+DROP INDEX IF EXISTS idx_feature_flags_scope_key;
+
+-- Drop the flag values of executions
+ALTER TABLE executions DROP COLUMN IF EXISTS flags;
+
+-- Drop feature flags table
+DROP TABLE IF EXISTS feature_flags;
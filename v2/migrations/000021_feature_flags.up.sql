@@ -0,0 +1,25 @@
+-- Create feature flags table
+CREATE TABLE IF NOT EXISTS feature_flags (
+    id UUID PRIMARY KEY,
+    key VARCHAR(255) NOT NULL,
+    namespace VARCHAR(255),
+    workflow_id UUID,
+    description TEXT,
+    kind VARCHAR(50),
+    enabled BOOLEAN,
+    percentage DOUBLE PRECISION,
+    routing_key VARCHAR(255),
+    rules JSONB,
+    "default" BOOLEAN,
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE,
+    scope VARCHAR(255) NOT NULL
+);
+
+-- Add the flag values executions were evaluated with
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS flags JSONB;
+
+-- Create indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_feature_flags_scope_key ON feature_flags(scope, key);
+CREATE INDEX IF NOT EXISTS idx_feature_flags_namespace ON feature_flags(namespace);
+CREATE INDEX IF NOT EXISTS idx_feature_flags_workflow_id ON feature_flags(workflow_id);
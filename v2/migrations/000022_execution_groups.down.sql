@@ -0,0 +1,13 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_executions_group_id;
+DROP INDEX IF EXISTS idx_execution_group_members_group_id;
+DROP INDEX IF EXISTS idx_execution_groups_status;
+DROP INDEX IF EXISTS idx_execution_groups_correlation_id;
+
+-- Drop the group and labels of executions
+ALTER TABLE executions DROP COLUMN IF EXISTS labels;
+ALTER TABLE executions DROP COLUMN IF EXISTS group_id;
+
+-- Drop execution group tables
+DROP TABLE IF EXISTS execution_group_members;
+DROP TABLE IF EXISTS execution_groups;
@@ -0,0 +1,34 @@
+-- Create execution groups table
+CREATE TABLE IF NOT EXISTS execution_groups (
+    id UUID PRIMARY KEY,
+    policy VARCHAR(50) NOT NULL,
+    correlation_id VARCHAR(255),
+    labels JSONB,
+    status VARCHAR(50) NOT NULL,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE,
+    ended_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create execution group members table
+CREATE TABLE IF NOT EXISTS execution_group_members (
+    execution_id UUID PRIMARY KEY,
+    group_id UUID NOT NULL REFERENCES execution_groups(id) ON DELETE CASCADE,
+    position INTEGER,
+    workflow_id UUID NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    error TEXT,
+    cancelled_by_group BOOLEAN,
+    joined_at TIMESTAMP WITH TIME ZONE,
+    ended_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Add the group and labels of executions
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS group_id UUID;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS labels JSONB;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_execution_groups_correlation_id ON execution_groups(correlation_id);
+CREATE INDEX IF NOT EXISTS idx_execution_groups_status ON execution_groups(status);
+CREATE INDEX IF NOT EXISTS idx_execution_group_members_group_id ON execution_group_members(group_id);
+CREATE INDEX IF NOT EXISTS idx_executions_group_id ON executions(group_id);
@@ -0,0 +1,9 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_held_webhooks_created_at;
+DROP INDEX IF EXISTS idx_system_freeze_audit_freeze_id;
+DROP INDEX IF EXISTS idx_system_freezes_ended_at;
+
+-- Drop freeze tables
+DROP TABLE IF EXISTS held_webhooks;
+DROP TABLE IF EXISTS system_freeze_audit;
+DROP TABLE IF EXISTS system_freezes;
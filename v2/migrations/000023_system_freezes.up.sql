@@ -0,0 +1,37 @@
+-- Create system freezes table
+CREATE TABLE IF NOT EXISTS system_freezes (
+    id UUID PRIMARY KEY,
+    scope VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL,
+    actor VARCHAR(255),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    ended_by VARCHAR(255)
+);
+
+-- Create system freeze audit table
+CREATE TABLE IF NOT EXISTS system_freeze_audit (
+    id BIGSERIAL PRIMARY KEY,
+    freeze_id UUID NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    scope VARCHAR(255),
+    reason TEXT,
+    actor VARCHAR(255),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create held webhooks table, the webhooks received while executions are
+-- frozen
+CREATE TABLE IF NOT EXISTS held_webhooks (
+    id UUID PRIMARY KEY,
+    trigger VARCHAR(255) NOT NULL,
+    input TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_system_freezes_ended_at ON system_freezes(ended_at);
+CREATE INDEX IF NOT EXISTS idx_system_freeze_audit_freeze_id ON system_freeze_audit(freeze_id);
+CREATE INDEX IF NOT EXISTS idx_held_webhooks_created_at ON held_webhooks(created_at);
@@ -0,0 +1,13 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_activation_gate_overrides_created_at;
+DROP INDEX IF EXISTS idx_activation_gate_overrides_workflow_id;
+DROP INDEX IF EXISTS idx_activation_gate_overrides_version_id;
+DROP INDEX IF EXISTS idx_activation_gate_impact_notifications_version_id;
+DROP INDEX IF EXISTS idx_activation_gate_reviews_version_id;
+DROP INDEX IF EXISTS idx_activation_gate_simulations_version_id;
+
+-- Drop activation gate tables
+DROP TABLE IF EXISTS activation_gate_overrides;
+DROP TABLE IF EXISTS activation_gate_impact_notifications;
+DROP TABLE IF EXISTS activation_gate_reviews;
+DROP TABLE IF EXISTS activation_gate_simulations;
@@ -0,0 +1,51 @@
+-- Create activation gate simulations table
+CREATE TABLE IF NOT EXISTS activation_gate_simulations (
+    id UUID PRIMARY KEY,
+    version_id UUID NOT NULL,
+    suite VARCHAR(255),
+    passed BOOLEAN,
+    cases INTEGER,
+    failures INTEGER,
+    results_url TEXT,
+    ran_by VARCHAR(255),
+    ran_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create activation gate reviews table
+CREATE TABLE IF NOT EXISTS activation_gate_reviews (
+    id UUID PRIMARY KEY,
+    version_id UUID NOT NULL,
+    reviewer VARCHAR(255) NOT NULL,
+    approved BOOLEAN,
+    comment TEXT,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create activation gate impact notifications table
+CREATE TABLE IF NOT EXISTS activation_gate_impact_notifications (
+    id UUID PRIMARY KEY,
+    version_id UUID NOT NULL,
+    recipients JSONB,
+    message TEXT,
+    sent_by VARCHAR(255),
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create activation gate overrides table
+CREATE TABLE IF NOT EXISTS activation_gate_overrides (
+    id UUID PRIMARY KEY,
+    version_id UUID NOT NULL,
+    workflow_id UUID,
+    actor VARCHAR(255) NOT NULL,
+    justification TEXT NOT NULL,
+    unsatisfied JSONB,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_activation_gate_simulations_version_id ON activation_gate_simulations(version_id);
+CREATE INDEX IF NOT EXISTS idx_activation_gate_reviews_version_id ON activation_gate_reviews(version_id);
+CREATE INDEX IF NOT EXISTS idx_activation_gate_impact_notifications_version_id ON activation_gate_impact_notifications(version_id);
+CREATE INDEX IF NOT EXISTS idx_activation_gate_overrides_version_id ON activation_gate_overrides(version_id);
+CREATE INDEX IF NOT EXISTS idx_activation_gate_overrides_workflow_id ON activation_gate_overrides(workflow_id);
+CREATE INDEX IF NOT EXISTS idx_activation_gate_overrides_created_at ON activation_gate_overrides(created_at);
@@ -0,0 +1,8 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_workflow_definition_events_namespace;
+DROP INDEX IF EXISTS idx_workflow_definition_events_workflow_id;
+DROP INDEX IF EXISTS idx_workflow_definition_events_type;
+
+-- Drop workflow watch tables
+DROP TABLE IF EXISTS workflow_watch_subscriptions;
+DROP TABLE IF EXISTS workflow_definition_events;
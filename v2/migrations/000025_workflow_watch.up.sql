@@ -0,0 +1,29 @@
+-- Create workflow definition events table
+CREATE TABLE IF NOT EXISTS workflow_definition_events (
+    sequence BIGSERIAL PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    workflow_id UUID NOT NULL,
+    workflow_name VARCHAR(255),
+    version_id UUID,
+    version VARCHAR(100),
+    namespace VARCHAR(255),
+    labels TEXT,
+    timestamp TIMESTAMP WITH TIME ZONE
+);
+
+-- Create workflow watch subscriptions table
+CREATE TABLE IF NOT EXISTS workflow_watch_subscriptions (
+    id UUID PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret VARCHAR(255),
+    headers TEXT,
+    namespace VARCHAR(255),
+    labels TEXT,
+    types TEXT,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_workflow_definition_events_type ON workflow_definition_events(type);
+CREATE INDEX IF NOT EXISTS idx_workflow_definition_events_workflow_id ON workflow_definition_events(workflow_id);
+CREATE INDEX IF NOT EXISTS idx_workflow_definition_events_namespace ON workflow_definition_events(namespace);
@@ -0,0 +1,8 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_spike_guard_triggers_triggered_at;
+DROP INDEX IF EXISTS idx_spike_guard_triggers_subject;
+
+-- Drop spike guard tables
+DROP TABLE IF EXISTS spike_guard_overrides;
+DROP TABLE IF EXISTS spike_guard_triggers;
+DROP TABLE IF EXISTS submission_counts;
@@ -0,0 +1,36 @@
+-- Create submission counts table, the hourly submissions baselines are
+-- averaged from
+CREATE TABLE IF NOT EXISTS submission_counts (
+    subject VARCHAR(255) NOT NULL,
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    count BIGINT,
+    PRIMARY KEY (subject, hour)
+);
+
+-- Create spike guard triggers table
+CREATE TABLE IF NOT EXISTS spike_guard_triggers (
+    id UUID PRIMARY KEY,
+    subject VARCHAR(255) NOT NULL,
+    workflow_id UUID,
+    action VARCHAR(50),
+    baseline DOUBLE PRECISION,
+    threshold DOUBLE PRECISION,
+    rate DOUBLE PRECISION,
+    triggered_at TIMESTAMP WITH TIME ZONE,
+    reset_at TIMESTAMP WITH TIME ZONE,
+    reset_reason TEXT,
+    reset_by VARCHAR(255)
+);
+
+-- Create spike guard overrides table
+CREATE TABLE IF NOT EXISTS spike_guard_overrides (
+    subject VARCHAR(255) PRIMARY KEY,
+    until TIMESTAMP WITH TIME ZONE,
+    reason TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_spike_guard_triggers_subject ON spike_guard_triggers(subject);
+CREATE INDEX IF NOT EXISTS idx_spike_guard_triggers_triggered_at ON spike_guard_triggers(triggered_at);
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_pending_events_handler;
+
+-- Drop pending events table
+DROP TABLE IF EXISTS pending_events;
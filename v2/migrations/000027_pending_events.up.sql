@@ -0,0 +1,14 @@
+-- Create pending events table, the journal of the events queued for
+-- acknowledged handlers
+CREATE TABLE IF NOT EXISTS pending_events (
+    position BIGSERIAL PRIMARY KEY,
+    handler VARCHAR(255) NOT NULL,
+    ordering_key VARCHAR(255),
+    event_type VARCHAR(100) NOT NULL,
+    execution_id VARCHAR(255),
+    payload TEXT NOT NULL,
+    enqueued_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_pending_events_handler ON pending_events(handler);
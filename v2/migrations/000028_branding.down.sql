@@ -0,0 +1,3 @@
+-- Drop branding tables
+DROP TABLE IF EXISTS message_catalog_entries;
+DROP TABLE IF EXISTS branding_profiles;
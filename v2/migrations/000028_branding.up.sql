@@ -0,0 +1,22 @@
+-- Create branding profiles table
+CREATE TABLE IF NOT EXISTS branding_profiles (
+    namespace VARCHAR(255) PRIMARY KEY,
+    product_name VARCHAR(255),
+    support_url TEXT,
+    contact_email VARCHAR(255),
+    logo_ref TEXT,
+    default_locale VARCHAR(35),
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create message catalog entries table
+CREATE TABLE IF NOT EXISTS message_catalog_entries (
+    namespace VARCHAR(255) NOT NULL,
+    locale VARCHAR(35) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    value TEXT NOT NULL,
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (namespace, locale, key)
+);
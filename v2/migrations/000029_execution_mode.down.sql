@@ -0,0 +1,2 @@
+-- Drop the execution mode
+ALTER TABLE executions DROP COLUMN IF EXISTS execution_mode;
@@ -0,0 +1,2 @@
+-- Add the mode executions ran in, standard or lightweight
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS execution_mode VARCHAR(50);
@@ -2,9 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/spf13/viper"
 )
 
@@ -17,6 +22,59 @@ type Config struct {
 	Metrics  MetricsConfig  `mapstructure:"metrics"`
 	Logging  LoggingConfig  `mapstructure:"logging"`
 	Features FeatureConfig  `mapstructure:"features"`
+	Analytics AnalyticsConfig `mapstructure:"analytics"`
+	Scripts  ScriptsConfig  `mapstructure:"scripts"`
+	Cluster  ClusterConfig  `mapstructure:"cluster"`
+	Delivery DeliveryConfig `mapstructure:"delivery"`
+	Admission AdmissionConfig `mapstructure:"admission"`
+	Deprecation DeprecationConfig `mapstructure:"deprecation"`
+	DebugBundles DebugBundleConfig `mapstructure:"debug_bundles"`
+	Artifacts ArtifactsConfig `mapstructure:"artifacts"`
+	Policies PoliciesConfig `mapstructure:"policies"`
+	Versioning VersioningConfig `mapstructure:"versioning"`
+	Warmup   WarmupConfig   `mapstructure:"warmup"`
+	Triage   TriageConfig   `mapstructure:"triage"`
+	Quotas   QuotasConfig   `mapstructure:"quotas"`
+	Backfill BackfillConfig `mapstructure:"backfill"`
+	Tenancy  TenancyConfig  `mapstructure:"tenancy"`
+	SLO      SLOConfig      `mapstructure:"slo"`
+	Triggers TriggersConfig `mapstructure:"triggers"`
+	Flags    FlagsConfig    `mapstructure:"flags"`
+	Dependencies DependenciesConfig `mapstructure:"dependencies"`
+	Reservations ReservationsConfig `mapstructure:"reservations"`
+	Approvals ApprovalsConfig `mapstructure:"approvals"`
+	Secrets  SecretsConfig  `mapstructure:"secrets"`
+	Freeze   FreezeConfig   `mapstructure:"freeze"`
+	Watch    WatchConfig    `mapstructure:"watch"`
+	Codegen  CodegenConfig  `mapstructure:"codegen"`
+	Spikes   SpikesConfig   `mapstructure:"spikes"`
+	// Environment is the deployment environment: development, staging or
+	// production. It selects the profile overlay merged over the config
+	// file.
+	Environment string `mapstructure:"environment" default:"development"`
+}
+
+// profiles maps environments to the profile naming their overlay file
+var profiles = map[string]string{
+	"development": "dev",
+	"staging":     "staging",
+	"production":  "prod",
+}
+
+// Profile returns the profile of an environment, the environment itself
+// for environments without a profile of their own
+func Profile(environment string) string {
+	if profile, ok := profiles[environment]; ok {
+		return profile
+	}
+	return environment
+}
+
+// OverlayPath returns the overlay file of a profile next to a config file,
+// config.prod.yaml for config.yaml and the prod profile
+func OverlayPath(configPath, profile string) string {
+	ext := filepath.Ext(configPath)
+	return strings.TrimSuffix(configPath, ext) + "." + profile + ext
 }
 
 // ServerConfig contains HTTP server configuration
@@ -28,6 +86,12 @@ type ServerConfig struct {
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout" default:"60s"`
 	TLS          TLSConfig     `mapstructure:"tls"`
 	CORS         CORSConfig    `mapstructure:"cors"`
+	// MaxBodyBytes is the largest request body of the execution endpoints,
+	// compressed and decompressed
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes" default:"10485760"`
+	// CompressMinBytes is the smallest response of the execution endpoints
+	// gzip compressed for callers accepting it
+	CompressMinBytes int `mapstructure:"compress_min_bytes" default:"1024"`
 }
 
 // TLSConfig contains TLS configuration
@@ -58,6 +122,40 @@ type DatabaseConfig struct {
 	MaxIdleConns    int           `mapstructure:"max_idle_conns" default:"5"`
 	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime" default:"5m"`
 	Migrations      MigrationConfig `mapstructure:"migrations"`
+	// Replicas serve the dashboard, metrics and list reads that tolerate
+	// replication lag. Without replicas every read goes to the primary.
+	Replicas []ReplicaConfig `mapstructure:"replicas"`
+	// ReplicaHeartbeatInterval is how often the primary writes the heartbeat
+	// replica lag is measured from
+	ReplicaHeartbeatInterval time.Duration `mapstructure:"replica_heartbeat_interval" default:"1s"`
+	// Compression configures the compression of the execution payloads
+	// persisted as JSON
+	Compression CompressionConfig `mapstructure:"compression"`
+}
+
+// CompressionConfig contains the compression of the payload columns of
+// executions, step executions and execution events. Compressed rows are
+// read whether compression is enabled or not.
+type CompressionConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"true"`
+	// Algorithm is zstd or gzip
+	Algorithm string `mapstructure:"algorithm" default:"zstd"`
+	// Threshold is the size of the payloads, in bytes of JSON, above which
+	// they are compressed
+	Threshold int `mapstructure:"threshold" default:"4096"`
+	// Skip lists the payload columns never compressed, as table.column,
+	// such as those queried in SQL by reports
+	Skip []string `mapstructure:"skip"`
+}
+
+// ReplicaConfig contains the connection settings of a read replica. The
+// driver, database, credentials and SSL mode are those of the primary.
+type ReplicaConfig struct {
+	Name         string `mapstructure:"name"`
+	Host         string `mapstructure:"host"`
+	Port         int    `mapstructure:"port"`
+	MaxOpenConns int    `mapstructure:"max_open_conns"`
+	MaxIdleConns int    `mapstructure:"max_idle_conns"`
 }
 
 // MigrationConfig contains database migration configuration
@@ -127,6 +225,19 @@ type LoggingConfig struct {
 	Format string `mapstructure:"format" default:"json"`
 	Output string `mapstructure:"output" default:"stdout"`
 	File   string `mapstructure:"file"`
+	// StepSampling thins the entries the engine logs for each step
+	StepSampling StepSamplingConfig `mapstructure:"step_sampling"`
+}
+
+// StepSamplingConfig contains the sampling of the entries logged for
+// successful steps. Failed and slow steps are always logged.
+type StepSamplingConfig struct {
+	// Every logs one in Every successful steps; 0 logs only failed and
+	// slow steps
+	Every int `mapstructure:"every" default:"1"`
+	// SlowThreshold is the duration from which steps are logged as slow;
+	// 0 disables it
+	SlowThreshold time.Duration `mapstructure:"slow_threshold" default:"10s"`
 }
 
 // FeatureConfig contains feature flags
@@ -138,8 +249,558 @@ type FeatureConfig struct {
 	Metrics        bool `mapstructure:"metrics" default:"true"`
 }
 
-// Load loads configuration from file and environment variables
+// AnalyticsConfig contains analytics export configuration
+type AnalyticsConfig struct {
+	Enabled       bool                  `mapstructure:"enabled" default:"false"`
+	BufferSize    int                   `mapstructure:"buffer_size" default:"1000"`
+	BatchSize     int                   `mapstructure:"batch_size" default:"100"`
+	FlushInterval time.Duration         `mapstructure:"flush_interval" default:"5s"`
+	Sinks         []AnalyticsSinkConfig `mapstructure:"sinks"`
+}
+
+// AnalyticsSinkConfig contains the configuration of a single analytics sink
+type AnalyticsSinkConfig struct {
+	Name          string   `mapstructure:"name"`
+	Type          string   `mapstructure:"type"` // jsonl, kafka
+	Path          string   `mapstructure:"path"`
+	Prefix        string   `mapstructure:"prefix"`
+	Topic         string   `mapstructure:"topic"`
+	Namespaces    []string `mapstructure:"namespaces"`
+	Workflows     []string `mapstructure:"workflows"`
+	IncludeFields []string `mapstructure:"include_fields"`
+	ExcludeFields []string `mapstructure:"exclude_fields"`
+}
+
+// ScriptsConfig contains the resource limits of javascript script steps
+type ScriptsConfig struct {
+	Limits     ScriptLimits            `mapstructure:"limits"`
+	Namespaces map[string]ScriptLimits `mapstructure:"namespaces"`
+}
+
+// ScriptLimits bounds the resources of a script step, zero means no limit
+type ScriptLimits struct {
+	MaxMemoryBytes int64         `mapstructure:"max_memory_bytes" default:"16777216"`
+	MaxOps         int64         `mapstructure:"max_ops" default:"1000"`
+	Timeout        time.Duration `mapstructure:"timeout" default:"30s"`
+}
+
+// ClusterConfig contains the worker node settings of clustered deployments
+type ClusterConfig struct {
+	// NodeID identifies this node, generated from the hostname when empty
+	NodeID            string        `mapstructure:"node_id"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval" default:"10s"`
+	// HeartbeatTimeout is how long a node can miss heartbeats before it is
+	// marked dead and its executions are reclaimed
+	HeartbeatTimeout time.Duration `mapstructure:"heartbeat_timeout" default:"60s"`
+	// MaxConcurrentSteps is how many steps run at once on this node, the
+	// parallel steps of every execution drawing from one pool, zero for no
+	// limit. Ready steps start by priority.
+	MaxConcurrentSteps int `mapstructure:"max_concurrent_steps" default:"1000"`
+	// FastLaneConcurrency is how many lightweight executions run at once on
+	// this node outside the limit of concurrent executions, zero to run them
+	// in regular slots
+	FastLaneConcurrency int `mapstructure:"fast_lane_concurrency" default:"100"`
+	// MaxVariableBytes bounds the size of the variables of each execution
+	// on this node, encoded as JSON, zero for no limit. Executions whose
+	// input or step outputs take them over it fail.
+	MaxVariableBytes int64 `mapstructure:"max_variable_bytes" default:"67108864"`
+	// DrainDeadline is how long a drain lets executions follow the shutdown
+	// policy of their workflow before checkpointing those still running
+	// after their current step
+	DrainDeadline time.Duration `mapstructure:"drain_deadline" default:"5m"`
+	// DrainTimeout bounds the whole drain, after which the executions
+	// still running are cancelled
+	DrainTimeout time.Duration `mapstructure:"drain_timeout" default:"10m"`
+	// ResumeInterval is how often parked executions are resumed on this
+	// node when it has free capacity
+	ResumeInterval time.Duration `mapstructure:"resume_interval" default:"30s"`
+}
+
+// DeliveryConfig contains the configuration of engine event delivery to
+// event handlers
+type DeliveryConfig struct {
+	// MaxAttempts is the number of failed deliveries of an event to a handler
+	// after which the event is parked
+	MaxAttempts     int           `mapstructure:"max_attempts" default:"5"`
+	RetryBackoff    time.Duration `mapstructure:"retry_backoff" default:"1s"`
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff" default:"1m"`
+	// OrderingPolicy is hold-order to hold the later events of an execution
+	// while one of its events is parked, or skip-and-continue to deliver them
+	OrderingPolicy string `mapstructure:"ordering_policy" default:"skip-and-continue"`
+	// AcknowledgedHandlers names the handlers events are delivered to at
+	// least once, journaled until processed and recovered after a restart.
+	// A name ending in * matches the handlers it prefixes.
+	AcknowledgedHandlers []string `mapstructure:"acknowledged_handlers"`
+	// BufferSize bounds the events of each handler that are queued or
+	// being delivered
+	BufferSize int `mapstructure:"buffer_size" default:"10000"`
+	// OverflowPolicy is block to make executions wait for a handler whose
+	// buffer is full, or drop-oldest or drop-newest to drop an event
+	OverflowPolicy string `mapstructure:"overflow_policy" default:"block"`
+	// HandlerBuffers override the buffer of the handlers they name
+	HandlerBuffers []HandlerBufferConfig `mapstructure:"handler_buffers"`
+}
+
+// HandlerBufferConfig sets the buffer of the event handlers it names
+type HandlerBufferConfig struct {
+	// Handler names the handlers, a name ending in * matching the handlers
+	// it prefixes
+	Handler        string `mapstructure:"handler"`
+	Size           int    `mapstructure:"size"`
+	OverflowPolicy string `mapstructure:"overflow_policy"`
+}
+
+// AdmissionConfig contains the configuration of the checks executions pass
+// before they are admitted
+type AdmissionConfig struct {
+	// AverageExecutionTime estimates how long an execution waits for each
+	// execution queued ahead of it
+	AverageExecutionTime time.Duration       `mapstructure:"average_execution_time" default:"30s"`
+	MaintenanceWindows   []MaintenanceWindow `mapstructure:"maintenance_windows"`
+}
+
+// DeprecationConfig contains the configuration of the notifications sent to
+// the callers of deprecated workflows
+type DeprecationConfig struct {
+	// NotifyWindow is how far back an execution makes its caller a
+	// dependent of a deprecated workflow
+	NotifyWindow time.Duration `mapstructure:"notify_window" default:"720h"`
+	// DigestInterval is how often dependents are sent a digest of their
+	// deprecated dependencies
+	DigestInterval time.Duration `mapstructure:"digest_interval" default:"24h"`
+}
+
+// DebugBundleConfig contains the configuration of execution debug bundles
+type DebugBundleConfig struct {
+	// AsyncEventThreshold is the number of events above which a bundle is
+	// built by a background job rather than during the request
+	AsyncEventThreshold int64 `mapstructure:"async_event_threshold" default:"5000"`
+	// JobTTL is how long the bundle built by a job can be downloaded
+	JobTTL time.Duration `mapstructure:"job_ttl" default:"1h"`
+	// DebugKeys are the API keys holding the debug permission. Their
+	// callers get full bundles, every other caller a reduced one.
+	DebugKeys []string `mapstructure:"debug_keys"`
+}
+
+// ArtifactsConfig contains the storage of artifacts, the large payloads
+// steps exchange by reference, such as parsed tables
+type ArtifactsConfig struct {
+	// Dir is the directory artifacts are stored in
+	Dir string `mapstructure:"dir" default:"./data/artifacts"`
+	// MaxScriptReadBytes is the size of the largest artifact javascript
+	// steps can read with mf.readArtifact
+	MaxScriptReadBytes int64 `mapstructure:"max_script_read_bytes" default:"8388608"`
+	// Scratch configures the scratch areas of executions, kept in the
+	// artifact directory
+	Scratch ScratchConfig `mapstructure:"scratch"`
+	// Extraction configures the extraction of the binaries embedded in
+	// execution inputs into artifacts
+	Extraction ExtractionConfig `mapstructure:"extraction"`
+}
+
+// ExtractionConfig contains the detection of the base64 strings and data
+// URIs of execution inputs extracted into artifacts at submission
+type ExtractionConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"true"`
+	// Threshold is the length of the encoded strings above which they are
+	// extracted
+	Threshold int `mapstructure:"threshold" default:"65536"`
+	// Allow restricts the extraction to the fields of these dot separated
+	// paths, without array indexes, when it is not empty; * matches any key
+	Allow []string `mapstructure:"allow"`
+	// Deny excludes the fields of these paths from the extraction
+	Deny []string `mapstructure:"deny"`
+	// InlineLimit is the size of the largest binaries inlined again when
+	// executions are read with ?inline=true
+	InlineLimit int64 `mapstructure:"inline_limit" default:"1048576"`
+}
+
+// ScratchConfig contains the limits and cleanup of the scratch areas
+// executions keep the intermediate files of their steps in
+type ScratchConfig struct {
+	// MaxBytes caps the size of the files of each execution
+	MaxBytes int64 `mapstructure:"max_bytes" default:"268435456"`
+	// GracePeriod is how long the area of an execution is kept once it
+	// ended
+	GracePeriod time.Duration `mapstructure:"grace_period" default:"1h"`
+	// DebugSampleEvery keeps the area of one in DebugSampleEvery executions
+	// for DebugRetention, 0 for none
+	DebugSampleEvery int `mapstructure:"debug_sample_every" default:"0"`
+	// DebugRetention is how long the areas of sampled executions are kept
+	DebugRetention time.Duration `mapstructure:"debug_retention" default:"168h"`
+	// CleanupInterval is how often the areas of ended executions are
+	// removed
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval" default:"10m"`
+}
+
+// PoliciesConfig contains the evaluation settings of admission policies
+type PoliciesConfig struct {
+	// DefaultTimeout bounds the evaluation of policies that do not set a
+	// timeout
+	DefaultTimeout time.Duration `mapstructure:"default_timeout" default:"100ms"`
+}
+
+// VersioningConfig contains the limits new workflow versions are validated
+// against
+type VersioningConfig struct {
+	// MaxSteps is the maximum number of steps of a workflow
+	MaxSteps int `mapstructure:"max_steps" default:"100"`
+	// MaxNestingDepth is the maximum number of loop and parallel steps
+	// nested in one another
+	MaxNestingDepth int `mapstructure:"max_nesting_depth" default:"5"`
+	// StrictMode rejects definitions and steps with unknown fields, such as
+	// misspelled ones
+	StrictMode bool `mapstructure:"strict_mode" default:"false"`
+	// Complexity bounds the complexity of definitions in every namespace
+	Complexity ComplexityLimits `mapstructure:"complexity"`
+	// Namespaces overrides complexity limits per namespace
+	Namespaces map[string]ComplexityLimits `mapstructure:"namespaces"`
+	// Gates are the checklists versions must satisfy before they are
+	// activated
+	Gates ActivationGatesConfig `mapstructure:"gates"`
+}
+
+// ActivationGatesConfig contains the checklists of activation gates of the
+// namespaces
+type ActivationGatesConfig struct {
+	// Checklist applies to the namespaces without a checklist of their own
+	Checklist []GateConfig `mapstructure:"checklist"`
+	// Namespaces overrides the checklist per namespace, an empty checklist
+	// leaving the namespace ungated
+	Namespaces map[string][]GateConfig `mapstructure:"namespaces"`
+	// Overriders may activate versions failing their gates with a
+	// justification, as user:, group: and role: references
+	Overriders []string `mapstructure:"overriders"`
+	// WebhookTimeout bounds the calls of webhook gates without a timeout
+	// of their own; a timed out call fails its gate
+	WebhookTimeout time.Duration `mapstructure:"webhook_timeout" default:"10s"`
+}
+
+// GateConfig is an activation gate: lint-clean, simulation-passed,
+// second-person-review, impact-notification-sent or webhook
+type GateConfig struct {
+	Name string `mapstructure:"name"`
+	Type string `mapstructure:"type"`
+	// Suite is the simulation suite of simulation-passed gates
+	Suite string `mapstructure:"suite"`
+	// URL and Timeout are those of webhook gates
+	URL     string        `mapstructure:"url"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ComplexityLimits bound the complexity of workflow definitions
+type ComplexityLimits struct {
+	NestingDepth     ComplexityLimit `mapstructure:"nesting_depth"`
+	ExpandedSteps    ComplexityLimit `mapstructure:"expanded_steps"`
+	ParallelBranches ComplexityLimit `mapstructure:"parallel_branches"`
+	DefinitionBytes  ComplexityLimit `mapstructure:"definition_bytes"`
+	ExpressionLength ComplexityLimit `mapstructure:"expression_length"`
+}
+
+// ComplexityLimit is the threshold over which definitions are accepted with
+// a warning and the one over which they are rejected, zero for none
+type ComplexityLimit struct {
+	Soft int `mapstructure:"soft"`
+	Hard int `mapstructure:"hard"`
+}
+
+// WarmupConfig contains the warm-up of step executors when workflow
+// versions are activated, and the pools of connections and interpreters it
+// fills
+type WarmupConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"true"`
+	// ConnectionsPerHost is the number of connections opened to each host
+	// of the http steps of an activated version
+	ConnectionsPerHost int `mapstructure:"connections_per_host" default:"2"`
+	// MaxIdleConnsPerHost is the number of idle connections kept alive to a
+	// host
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host" default:"16"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout" default:"90s"`
+	// InterpreterPoolSize is the number of script interpreters initialized
+	// ahead of javascript steps
+	InterpreterPoolSize int           `mapstructure:"interpreter_pool_size" default:"4"`
+	InterpreterTTL      time.Duration `mapstructure:"interpreter_ttl" default:"5m"`
+	// Timeout bounds the warm-up of an activated version
+	Timeout time.Duration `mapstructure:"timeout" default:"10s"`
+}
+
+// TriageConfig contains the classification of failed executions
+type TriageConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"true"`
+	// RecentWindow is how far back the recent failures of a workflow are
+	// counted when classifying a failure
+	RecentWindow time.Duration `mapstructure:"recent_window" default:"1h"`
+	// RecentLimit caps the number of recent failures compared with a
+	// failure
+	RecentLimit int `mapstructure:"recent_limit" default:"100"`
+	// Timeout bounds the evaluation of the rules of one failure
+	Timeout time.Duration `mapstructure:"timeout" default:"100ms"`
+	// Namespaces maps namespaces to their rules, evaluated before the
+	// default ones
+	Namespaces map[string][]TriageRule `mapstructure:"namespaces"`
+}
+
+// TriageRule assigns a triage class to the failures matching its condition
+type TriageRule struct {
+	Name       string        `mapstructure:"name"`
+	Class      string        `mapstructure:"class"`
+	When       string        `mapstructure:"when"`
+	Confidence float64       `mapstructure:"confidence"`
+	Boosts     []TriageBoost `mapstructure:"boosts"`
+	Action     string        `mapstructure:"action"`
+	Priority   int           `mapstructure:"priority"`
+}
+
+// TriageBoost raises the confidence of a matching triage rule when its
+// condition holds as well
+type TriageBoost struct {
+	When   string  `mapstructure:"when"`
+	Weight float64 `mapstructure:"weight"`
+}
+
+// QuotasConfig contains the executions each tenant, the namespace of a
+// workflow, may start per period
+type QuotasConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"false"`
+	// Default is the quota of tenants without their own
+	Default QuotaLimit `mapstructure:"default"`
+	// Tenants maps tenants to their quota
+	Tenants map[string]QuotaLimit `mapstructure:"tenants"`
+}
+
+// QuotaLimit is the execution quota of a tenant. A quota without
+// executions is unlimited.
+type QuotaLimit struct {
+	Executions int           `mapstructure:"executions"`
+	Period     time.Duration `mapstructure:"period"`
+	// Burst is the number of executions that may start at once, executions
+	// when zero
+	Burst int `mapstructure:"burst"`
+}
+
+// BackfillConfig contains the runner of the jobs applying processors, such
+// as triage, to historical executions
+type BackfillConfig struct {
+	// BatchSize is the batch size of jobs that do not set one
+	BatchSize int `mapstructure:"batch_size" default:"100"`
+	// MaxConcurrency caps the executions processed at once by all jobs
+	MaxConcurrency int `mapstructure:"max_concurrency" default:"4"`
+	// Share is the share of the engine capacity backfills may use
+	Share        float64       `mapstructure:"share" default:"0.2"`
+	PollInterval time.Duration `mapstructure:"poll_interval" default:"1s"`
+}
+
+// TenancyConfig contains the isolation of the tenants of multi-tenant
+// deployments
+type TenancyConfig struct {
+	// MultiTenant scopes workflows and executions to the tenant of the API
+	// key of requests. Queries without a tenant fail.
+	MultiTenant bool           `mapstructure:"multi_tenant" default:"false"`
+	Tenants     []TenantConfig `mapstructure:"tenants"`
+}
+
+// TenantConfig is a tenant and the API keys, sent in the security.api
+// header, of its callers
+type TenantConfig struct {
+	Name    string   `mapstructure:"name"`
+	APIKeys []string `mapstructure:"api_keys"`
+}
+
+// SLOConfig contains the evaluation of the SLOs of workflows. An alert is
+// raised when the error budget burns faster than a burn rate over its
+// window: the fast burn catches sudden outages, the slow burn gradual
+// degradations.
+type SLOConfig struct {
+	EvaluationInterval time.Duration `mapstructure:"evaluation_interval" default:"1m"`
+	FastBurnWindow     time.Duration `mapstructure:"fast_burn_window" default:"1h"`
+	FastBurnRate       float64       `mapstructure:"fast_burn_rate" default:"14.4"`
+	SlowBurnWindow     time.Duration `mapstructure:"slow_burn_window" default:"6h"`
+	SlowBurnRate       float64       `mapstructure:"slow_burn_rate" default:"6"`
+}
+
+// TriggersConfig contains the webhook triggers starting workflows from the
+// webhooks of external services
+type TriggersConfig struct {
+	// MaxBodyBytes is the largest webhook payload accepted
+	MaxBodyBytes int64                  `mapstructure:"max_body_bytes" default:"1048576"`
+	Webhooks     []WebhookTriggerConfig `mapstructure:"webhooks"`
+}
+
+// WebhookTriggerConfig is a webhook trigger, received on
+// /api/v1/triggers/webhooks/<name>, and how its sender signs payloads
+type WebhookTriggerConfig struct {
+	Name       string `mapstructure:"name"`
+	WorkflowID string `mapstructure:"workflow_id"`
+	// Scheme is the signature scheme of a common sender: github, stripe,
+	// shopify or hmac-sha256. Header, Algorithm, Encoding, Prefix and
+	// Tolerance override it, or describe the scheme of other senders.
+	Scheme    string        `mapstructure:"scheme"`
+	Header    string        `mapstructure:"header"`
+	Algorithm string        `mapstructure:"algorithm"`
+	Encoding  string        `mapstructure:"encoding"`
+	Prefix    string        `mapstructure:"prefix"`
+	Tolerance time.Duration `mapstructure:"tolerance"`
+	Secret    string        `mapstructure:"secret"`
+}
+
+// FlagsConfig contains the configuration of workflow feature flags
+type FlagsConfig struct {
+	// StaleCheckInterval is how often the flags referenced by production
+	// versions are checked for flags that are not defined
+	StaleCheckInterval time.Duration `mapstructure:"stale_check_interval" default:"1h"`
+}
+
+// DependenciesConfig contains the configuration of the workflow dependency
+// graph
+type DependenciesConfig struct {
+	// ServerURLs are the base URLs this server is reached at, such as
+	// https://flows.example.com. http steps calling the execute endpoint
+	// under one of them depend on the workflow they execute; with none, the
+	// endpoint path alone is matched.
+	ServerURLs []string `mapstructure:"server_urls"`
+	// MaxDepth bounds the depth of dependency traversals
+	MaxDepth int `mapstructure:"max_depth" default:"10"`
+}
+
+// ReservationsConfig contains the configuration of capacity reservations
+type ReservationsConfig struct {
+	// GracePeriod is how long a reservation holds the slots it leaves
+	// unused, from the start of its window or its last execution
+	GracePeriod time.Duration `mapstructure:"grace_period" default:"2m"`
+	// ReleasePeriod is how long releasing the unused slots takes once the
+	// grace period is over
+	ReleasePeriod time.Duration `mapstructure:"release_period" default:"10m"`
+	// MaxReservedShare bounds the share of the engine capacity
+	// reservations may hold at once
+	MaxReservedShare float64 `mapstructure:"max_reserved_share" default:"0.8"`
+}
+
+// ApprovalsConfig contains the configuration of approval steps
+type ApprovalsConfig struct {
+	// Timeout is how long approval steps wait for their approvals when
+	// they set no timeout
+	Timeout time.Duration `mapstructure:"timeout" default:"24h"`
+	// SweepInterval is how often reminders due are sent and approval
+	// requests past their timeout are expired
+	SweepInterval time.Duration `mapstructure:"sweep_interval" default:"1m"`
+	// Groups and Roles map the groups and roles approval policies
+	// reference to the users they hold
+	Groups map[string][]string `mapstructure:"groups"`
+	Roles  map[string][]string `mapstructure:"roles"`
+}
+
+// FreezeConfig contains the configuration of system freezes
+type FreezeConfig struct {
+	// RefreshInterval is how often freezes made on other servers are
+	// loaded and expired freezes ended
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" default:"5s"`
+	// HeldWebhookLimit bounds the webhooks held while executions are
+	// frozen; further webhooks are rejected so that their senders retry
+	HeldWebhookLimit int `mapstructure:"held_webhook_limit" default:"1000"`
+	// ScheduleCatchUpLimit bounds the fires of a fire_all schedule
+	// caught up once executions are unfrozen, or missed while the
+	// scheduler was down
+	ScheduleCatchUpLimit int `mapstructure:"schedule_catch_up_limit" default:"10"`
+}
+
+// WatchConfig contains the configuration of the watch API of workflow
+// definition changes
+type WatchConfig struct {
+	// PollInterval is how often waiting watchers check for the changes
+	// made on other servers
+	PollInterval time.Duration `mapstructure:"poll_interval" default:"2s"`
+	// BatchSize bounds the events a watcher receives at once
+	BatchSize int `mapstructure:"batch_size" default:"100"`
+}
+
+// CodegenConfig contains the configuration of client code generation
+type CodegenConfig struct {
+	AutoRegenerate AutoRegenerateConfig `mapstructure:"auto_regenerate"`
+}
+
+// AutoRegenerateConfig configures the regeneration of clients when their
+// workflow is created or a version of it is activated
+type AutoRegenerateConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"false"`
+	// OutputDir holds a directory per workflow and language, such as
+	// generated/orders/go
+	OutputDir string             `mapstructure:"output_dir" default:"./generated"`
+	Targets   []RegenerateTarget `mapstructure:"targets"`
+}
+
+// RegenerateTarget is a client regenerated automatically
+type RegenerateTarget struct {
+	// Workflow is the name or ID of the workflow
+	Workflow    string `mapstructure:"workflow"`
+	Language    string `mapstructure:"language"`
+	PackageName string `mapstructure:"package_name"`
+}
+
+// SpikesConfig contains the guards against submission spikes of workflows
+// and API keys. A guard triggers when the rate of submissions exceeds
+// multiplier times the baseline rate, averaged over the hourly submissions
+// of the baseline window, and at least min_rate.
+type SpikesConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"false"`
+	// Action is what guards do with further submissions: notify, confirm
+	// or throttle
+	Action     string  `mapstructure:"action" default:"notify"`
+	Multiplier float64 `mapstructure:"multiplier" default:"10"`
+	// MinRate is the lowest rate, in submissions per hour, triggering a
+	// guard
+	MinRate float64 `mapstructure:"min_rate" default:"1000"`
+	// Window is the period the current rate is measured over
+	Window         time.Duration `mapstructure:"window" default:"10m"`
+	BaselineWindow time.Duration `mapstructure:"baseline_window" default:"168h"`
+	// CoolDown is how long the rate must stay normal before a guard resets
+	CoolDown      time.Duration `mapstructure:"cool_down" default:"30m"`
+	SweepInterval time.Duration `mapstructure:"sweep_interval" default:"1m"`
+}
+
+// MaintenanceWindow is a period during which new executions are rejected.
+// Start and End are RFC 3339 times.
+type MaintenanceWindow struct {
+	Name   string `mapstructure:"name"`
+	Start  string `mapstructure:"start"`
+	End    string `mapstructure:"end"`
+	Reason string `mapstructure:"reason"`
+}
+
+// Period returns the start and end of the maintenance window
+func (w MaintenanceWindow) Period() (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, w.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start of maintenance window %s: %w", w.Name, err)
+	}
+	end, err := time.Parse(time.RFC3339, w.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end of maintenance window %s: %w", w.Name, err)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("maintenance window %s must end after it starts", w.Name)
+	}
+	return start, end, nil
+}
+
+// Load loads configuration from file and environment variables. The
+// overlay of the environment's profile, such as config.prod.yaml for
+// config.yaml in production, is merged over the config file.
 func Load(configPath string) (*Config, error) {
+	config, report, err := Diagnose(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := report.Err(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
+}
+
+// Diagnose loads configuration like Load and validates it, reporting every
+// issue found rather than failing on the first one. Files that cannot be
+// read fail; values that cannot be decoded, such as invalid durations, are
+// reported.
+func Diagnose(configPath string) (*Config, *Report, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	
@@ -161,32 +822,105 @@ func Load(configPath string) (*Config, error) {
 	// Read config file
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("failed to read config file: %w", err)
+			return nil, nil, fmt.Errorf("failed to read config file: %w", err)
 		}
 		// Config file not found, use defaults and environment variables
 	}
 	
+	// Merge the overlay of the environment's profile over the config file,
+	// so an environment only sets what differs from the base config
+	if err := mergeProfileOverlay(); err != nil {
+		return nil, nil, err
+	}
+	
+	// Values that cannot be decoded are reported and keep their zero value,
+	// so the rest of the config is still validated
+	report := &Report{}
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		config = Config{}
+		decodeFields(reflect.ValueOf(&config).Elem(), "", report)
 	}
 	
 	// Validate configuration
-	if err := validate(&config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+	validate(&config, report)
+	
+	return &config, report, nil
+}
+
+// decodeFields decodes the config keys of the fields of a config section one
+// by one, reporting the keys whose value cannot be decoded. Sections of this
+// package are decoded field by field; other fields, maps and lists included,
+// are decoded from their key as a whole.
+func decodeFields(section reflect.Value, prefix string, report *Report) {
+	sectionType := section.Type()
+	for i := 0; i < sectionType.NumField(); i++ {
+		field := sectionType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() == sectionType.PkgPath() {
+			decodeFields(section.Field(i), key, report)
+			continue
+		}
+		value := reflect.New(field.Type)
+		if err := viper.UnmarshalKey(key, value.Interface()); err != nil {
+			report.errorf(key, "invalid value %v, expected %s", viper.Get(key), field.Type)
+			continue
+		}
+		section.Field(i).Set(value.Elem())
 	}
+}
+
+// mergeProfileOverlay deep merges the overlay file of the profile of the
+// configured environment, if there is one, over the config file. Overlay
+// values win, maps are merged key by key and lists are replaced.
+func mergeProfileOverlay() error {
+	configPath := viper.ConfigFileUsed()
+	if configPath == "" {
+		return nil
+	}
+	overlayPath := OverlayPath(configPath, Profile(viper.GetString("environment")))
+	overlay, err := os.Open(overlayPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config overlay: %w", err)
+	}
+	defer overlay.Close()
 	
-	return &config, nil
+	if err := viper.MergeConfig(overlay); err != nil {
+		return fmt.Errorf("failed to merge config overlay %s: %w", overlayPath, err)
+	}
+	return nil
 }
 
 // setDefaults sets default configuration values
 func setDefaults() {
+	// Environment defaults
+	viper.SetDefault("environment", "development")
+	
 	// Server defaults
 	viper.SetDefault("server.host", "0.0.0.0")
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.read_timeout", "30s")
 	viper.SetDefault("server.write_timeout", "30s")
 	viper.SetDefault("server.idle_timeout", "60s")
+	viper.SetDefault("server.max_body_bytes", 10485760)
+	viper.SetDefault("server.compress_min_bytes", 1024)
 	
 	// Database defaults
 	viper.SetDefault("database.driver", "postgres")
@@ -198,6 +932,10 @@ func setDefaults() {
 	viper.SetDefault("database.max_open_conns", 25)
 	viper.SetDefault("database.max_idle_conns", 5)
 	viper.SetDefault("database.conn_max_lifetime", "5m")
+	viper.SetDefault("database.replica_heartbeat_interval", "1s")
+	viper.SetDefault("database.compression.enabled", true)
+	viper.SetDefault("database.compression.algorithm", "zstd")
+	viper.SetDefault("database.compression.threshold", 4096)
 	
 	// Cache defaults
 	viper.SetDefault("cache.enabled", true)
@@ -213,6 +951,7 @@ func setDefaults() {
 	viper.SetDefault("security.rate_limit.enabled", true)
 	viper.SetDefault("security.rate_limit.rps", 100)
 	viper.SetDefault("security.rate_limit.burst", 200)
+	viper.SetDefault("security.api.header", "X-API-Key")
 	
 	// Metrics defaults
 	viper.SetDefault("metrics.enabled", true)
@@ -226,6 +965,8 @@ func setDefaults() {
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 	viper.SetDefault("logging.output", "stdout")
+	viper.SetDefault("logging.step_sampling.every", 1)
+	viper.SetDefault("logging.step_sampling.slow_threshold", "10s")
 	
 	// Feature flags defaults
 	viper.SetDefault("features.code_generation", true)
@@ -233,33 +974,412 @@ func setDefaults() {
 	viper.SetDefault("features.versioning", true)
 	viper.SetDefault("features.webhooks", true)
 	viper.SetDefault("features.metrics", true)
+	
+	// Analytics defaults
+	viper.SetDefault("analytics.enabled", false)
+	viper.SetDefault("analytics.buffer_size", 1000)
+	viper.SetDefault("analytics.batch_size", 100)
+	viper.SetDefault("analytics.flush_interval", "5s")
+	
+	// Script sandbox defaults
+	viper.SetDefault("scripts.limits.max_memory_bytes", 16*1024*1024)
+	viper.SetDefault("scripts.limits.max_ops", 1000)
+	viper.SetDefault("scripts.limits.timeout", "30s")
+	
+	// Cluster defaults
+	viper.SetDefault("cluster.heartbeat_interval", "10s")
+	viper.SetDefault("cluster.heartbeat_timeout", "60s")
+	viper.SetDefault("cluster.max_concurrent_steps", 1000)
+	viper.SetDefault("cluster.fast_lane_concurrency", 100)
+	viper.SetDefault("cluster.max_variable_bytes", 64*1024*1024)
+	viper.SetDefault("cluster.drain_deadline", "5m")
+	viper.SetDefault("cluster.drain_timeout", "10m")
+	viper.SetDefault("cluster.resume_interval", "30s")
+	
+	// Event delivery defaults
+	viper.SetDefault("delivery.max_attempts", 5)
+	viper.SetDefault("delivery.retry_backoff", "1s")
+	viper.SetDefault("delivery.max_retry_backoff", "1m")
+	viper.SetDefault("delivery.ordering_policy", "skip-and-continue")
+	viper.SetDefault("delivery.acknowledged_handlers", []string{"analytics", "reservations"})
+	viper.SetDefault("delivery.buffer_size", 10000)
+	viper.SetDefault("delivery.overflow_policy", "block")
+	
+	// Admission defaults
+	viper.SetDefault("admission.average_execution_time", "30s")
+	
+	// Deprecation defaults
+	viper.SetDefault("deprecation.notify_window", "720h")
+	viper.SetDefault("deprecation.digest_interval", "24h")
+	
+	// Debug bundle defaults
+	viper.SetDefault("debug_bundles.async_event_threshold", 5000)
+	viper.SetDefault("debug_bundles.job_ttl", "1h")
+	
+	// Artifact defaults
+	viper.SetDefault("artifacts.dir", "./data/artifacts")
+	viper.SetDefault("artifacts.max_script_read_bytes", 8<<20)
+	viper.SetDefault("artifacts.scratch.max_bytes", 256<<20)
+	viper.SetDefault("artifacts.scratch.grace_period", "1h")
+	viper.SetDefault("artifacts.scratch.debug_sample_every", 0)
+	viper.SetDefault("artifacts.scratch.debug_retention", "168h")
+	viper.SetDefault("artifacts.scratch.cleanup_interval", "10m")
+	viper.SetDefault("artifacts.extraction.enabled", true)
+	viper.SetDefault("artifacts.extraction.threshold", 64<<10)
+	viper.SetDefault("artifacts.extraction.inline_limit", 1<<20)
+	
+	// Policy defaults
+	viper.SetDefault("policies.default_timeout", "100ms")
+	
+	// Versioning defaults
+	viper.SetDefault("versioning.max_steps", 100)
+	viper.SetDefault("versioning.max_nesting_depth", 5)
+	viper.SetDefault("versioning.strict_mode", false)
+	viper.SetDefault("versioning.complexity.nesting_depth.soft", 4)
+	viper.SetDefault("versioning.complexity.expanded_steps.soft", 200)
+	viper.SetDefault("versioning.complexity.expanded_steps.hard", 1000)
+	viper.SetDefault("versioning.complexity.parallel_branches.soft", 20)
+	viper.SetDefault("versioning.complexity.parallel_branches.hard", 100)
+	viper.SetDefault("versioning.complexity.definition_bytes.soft", 256*1024)
+	viper.SetDefault("versioning.complexity.definition_bytes.hard", 1024*1024)
+	viper.SetDefault("versioning.complexity.expression_length.soft", 500)
+	viper.SetDefault("versioning.complexity.expression_length.hard", 2000)
+	viper.SetDefault("versioning.gates.webhook_timeout", "10s")
+
+	// Warm-up defaults
+	viper.SetDefault("warmup.enabled", true)
+	viper.SetDefault("warmup.connections_per_host", 2)
+	viper.SetDefault("warmup.max_idle_conns_per_host", 16)
+	viper.SetDefault("warmup.idle_conn_timeout", "90s")
+	viper.SetDefault("warmup.interpreter_pool_size", 4)
+	viper.SetDefault("warmup.interpreter_ttl", "5m")
+	viper.SetDefault("warmup.timeout", "10s")
+
+	// Triage defaults
+	viper.SetDefault("triage.enabled", true)
+	viper.SetDefault("triage.recent_window", "1h")
+	viper.SetDefault("triage.recent_limit", 100)
+	viper.SetDefault("triage.timeout", "100ms")
+
+	// Quota defaults
+	viper.SetDefault("quotas.enabled", false)
+
+	// Backfill defaults
+	viper.SetDefault("backfill.batch_size", 100)
+	viper.SetDefault("backfill.max_concurrency", 4)
+	viper.SetDefault("backfill.share", 0.2)
+	viper.SetDefault("backfill.poll_interval", "1s")
+
+	// Tenancy defaults
+	viper.SetDefault("tenancy.multi_tenant", false)
+
+	// SLO defaults
+	viper.SetDefault("slo.evaluation_interval", "1m")
+	viper.SetDefault("slo.fast_burn_window", "1h")
+	viper.SetDefault("slo.fast_burn_rate", 14.4)
+	viper.SetDefault("slo.slow_burn_window", "6h")
+	viper.SetDefault("slo.slow_burn_rate", 6)
+
+	// Trigger defaults
+	viper.SetDefault("triggers.max_body_bytes", 1048576)
+
+	// Feature flag defaults
+	viper.SetDefault("flags.stale_check_interval", "1h")
+
+	// Dependency graph defaults
+	viper.SetDefault("dependencies.max_depth", 10)
+
+	// Capacity reservation defaults
+	viper.SetDefault("reservations.grace_period", "2m")
+	viper.SetDefault("reservations.release_period", "10m")
+	viper.SetDefault("reservations.max_reserved_share", 0.8)
+
+	// Approval defaults
+	viper.SetDefault("approvals.timeout", "24h")
+	viper.SetDefault("approvals.sweep_interval", "1m")
+
+	// Secret provider defaults
+	viper.SetDefault("secrets.provider", "env")
+	viper.SetDefault("secrets.env_prefix", "MAGICFLOW_SECRET_")
+	viper.SetDefault("secrets.vault.mount", "secret")
+	viper.SetDefault("secrets.vault.timeout", "10s")
+
+	// Freeze defaults
+	viper.SetDefault("freeze.refresh_interval", "5s")
+	viper.SetDefault("freeze.held_webhook_limit", 1000)
+	viper.SetDefault("freeze.schedule_catch_up_limit", 10)
+
+	// Watch defaults
+	viper.SetDefault("watch.poll_interval", "2s")
+	viper.SetDefault("watch.batch_size", 100)
+
+	// Code generation defaults
+	viper.SetDefault("codegen.auto_regenerate.enabled", false)
+	viper.SetDefault("codegen.auto_regenerate.output_dir", "./generated")
+
+	// Spike guard defaults
+	viper.SetDefault("spikes.enabled", false)
+	viper.SetDefault("spikes.action", "notify")
+	viper.SetDefault("spikes.multiplier", 10)
+	viper.SetDefault("spikes.min_rate", 1000)
+	viper.SetDefault("spikes.window", "10m")
+	viper.SetDefault("spikes.baseline_window", "168h")
+	viper.SetDefault("spikes.cool_down", "30m")
+	viper.SetDefault("spikes.sweep_interval", "1m")
 }
 
-// validate validates the configuration
-func validate(config *Config) error {
+// validate validates the configuration, reporting every issue it finds
+func validate(config *Config, report *Report) {
 	// Validate server configuration
 	if config.Server.Port <= 0 || config.Server.Port > 65535 {
-		return fmt.Errorf("invalid server port: %d", config.Server.Port)
+		report.errorf("server.port", "invalid server port: %d", config.Server.Port)
+	}
+	if config.Server.MaxBodyBytes <= 0 {
+		report.errorf("server.max_body_bytes", "server max body bytes must be positive")
+	}
+	if config.Server.CompressMinBytes < 0 {
+		report.errorf("server.compress_min_bytes", "server compress min bytes must not be negative")
 	}
 	
 	// Validate database configuration
 	if config.Database.Driver != "postgres" && config.Database.Driver != "mysql" {
-		return fmt.Errorf("unsupported database driver: %s", config.Database.Driver)
+		report.errorf("database.driver", "unsupported database driver: %s", config.Database.Driver)
 	}
 	
 	if config.Database.Database == "" {
-		return fmt.Errorf("database name is required")
+		report.errorf("database.database", "database name is required")
+	}
+	
+	// Validate read replicas
+	replicaNames := make(map[string]bool)
+	for _, replica := range config.Database.Replicas {
+		if replica.Name == "" || replica.Host == "" {
+			report.errorf("database.replicas", "database replica name and host are required")
+			continue
+		}
+		if replicaNames[replica.Name] {
+			report.errorf("database.replicas", "duplicate database replica: %s", replica.Name)
+		}
+		replicaNames[replica.Name] = true
+	}
+	if len(config.Database.Replicas) > 0 && config.Database.ReplicaHeartbeatInterval <= 0 {
+		report.errorf("database.replica_heartbeat_interval", "database replica heartbeat interval must be positive")
+	}
+	
+	// Validate step log sampling
+	if config.Logging.StepSampling.Every < 0 || config.Logging.StepSampling.SlowThreshold < 0 {
+		report.errorf("logging.step_sampling", "step log sampling must not be negative")
+	}
+	
+	// Validate analytics sinks
+	for _, sink := range config.Analytics.Sinks {
+		if sink.Name == "" {
+			report.errorf("analytics.sinks", "analytics sink name is required")
+		}
+		if sink.Type != "jsonl" && sink.Type != "kafka" {
+			report.errorf("analytics.sinks", "unsupported analytics sink type: %s", sink.Type)
+		}
+	}
+	
+	// Validate event delivery
+	if config.Delivery.OrderingPolicy != "hold-order" && config.Delivery.OrderingPolicy != "skip-and-continue" {
+		report.errorf("delivery.ordering_policy", "unsupported delivery ordering policy: %s", config.Delivery.OrderingPolicy)
+	}
+	for _, name := range config.Delivery.AcknowledgedHandlers {
+		if strings.TrimSuffix(name, "*") == "" {
+			report.errorf("delivery.acknowledged_handlers", "acknowledged handler names must not be empty")
+		}
+	}
+	if config.Delivery.BufferSize <= 0 {
+		report.errorf("delivery.buffer_size", "delivery buffer size must be positive")
+	}
+	if !validOverflowPolicy(config.Delivery.OverflowPolicy) {
+		report.errorf("delivery.overflow_policy", "unsupported delivery overflow policy: %s", config.Delivery.OverflowPolicy)
+	}
+	for _, buffer := range config.Delivery.HandlerBuffers {
+		if strings.TrimSuffix(buffer.Handler, "*") == "" {
+			report.errorf("delivery.handler_buffers", "handler buffer names must not be empty")
+		}
+		if buffer.Size < 0 {
+			report.errorf("delivery.handler_buffers", "buffer size of %s must not be negative", buffer.Handler)
+		}
+		if buffer.OverflowPolicy != "" && !validOverflowPolicy(buffer.OverflowPolicy) {
+			report.errorf("delivery.handler_buffers", "unsupported overflow policy of %s: %s", buffer.Handler, buffer.OverflowPolicy)
+		}
+	}
+	
+	// Validate maintenance windows
+	for _, window := range config.Admission.MaintenanceWindows {
+		if _, _, err := window.Period(); err != nil {
+			report.errorf("admission.maintenance_windows", "%v", err)
+		}
+	}
+	
+	// Validate deprecation notifications
+	if config.Deprecation.DigestInterval <= 0 {
+		report.errorf("deprecation.digest_interval", "deprecation digest interval must be positive")
+	}
+	
+	// Validate debug bundles
+	if config.DebugBundles.AsyncEventThreshold <= 0 {
+		report.errorf("debug_bundles.async_event_threshold", "debug bundle async event threshold must be positive")
+	}
+	if config.DebugBundles.JobTTL <= 0 {
+		report.errorf("debug_bundles.job_ttl", "debug bundle job TTL must be positive")
+	}
+	
+	// Validate versioning limits
+	if config.Versioning.MaxSteps <= 0 {
+		report.errorf("versioning.max_steps", "versioning max steps must be positive")
+	}
+	if config.Versioning.MaxNestingDepth <= 0 {
+		report.errorf("versioning.max_nesting_depth", "versioning max nesting depth must be positive")
+	}
+	validateActivationGates(report, config.Versioning.Gates)
+
+	// Validate warm-up pools
+	if config.Warmup.ConnectionsPerHost < 0 || config.Warmup.MaxIdleConnsPerHost < 0 || config.Warmup.InterpreterPoolSize < 0 {
+		report.errorf("warmup", "warmup pool sizes cannot be negative")
+	}
+
+	// Validate triage
+	if config.Triage.Enabled && (config.Triage.RecentWindow <= 0 || config.Triage.RecentLimit <= 0) {
+		report.errorf("triage", "triage recent window and limit must be positive")
+	}
+
+	// Validate quotas
+	for _, tenant := range quotaTenants(config.Quotas.Tenants) {
+		limit := config.Quotas.Tenants[tenant]
+		if limit.Executions < 0 || limit.Period < 0 || limit.Burst < 0 {
+			report.errorf("quotas.tenants."+tenant, "quota of tenant %s cannot be negative", tenant)
+		}
+	}
+	if config.Quotas.Default.Executions < 0 || config.Quotas.Default.Period < 0 || config.Quotas.Default.Burst < 0 {
+		report.errorf("quotas.default", "default quota cannot be negative")
+	}
+
+	// Validate backfill
+	if config.Backfill.BatchSize <= 0 || config.Backfill.MaxConcurrency <= 0 {
+		report.errorf("backfill", "backfill batch size and concurrency must be positive")
+	}
+	if config.Backfill.Share <= 0 || config.Backfill.Share > 1 {
+		report.errorf("backfill.share", "backfill share must be between 0 and 1")
+	}
+
+	// Validate tenancy
+	if config.Tenancy.MultiTenant && len(config.Tenancy.Tenants) == 0 {
+		report.errorf("tenancy.tenants", "multi-tenant mode requires tenants")
+	}
+	tenantKeys := make(map[string]string)
+	for _, tenant := range config.Tenancy.Tenants {
+		if tenant.Name == "" {
+			report.errorf("tenancy.tenants", "tenant name is required")
+			continue
+		}
+		for _, key := range tenant.APIKeys {
+			if key == "" {
+				report.errorf("tenancy.tenants", "API key of tenant %s cannot be empty", tenant.Name)
+				continue
+			}
+			if other, exists := tenantKeys[key]; exists && other != tenant.Name {
+				report.errorf("tenancy.tenants", "API key of tenant %s is also a key of tenant %s", tenant.Name, other)
+			}
+			tenantKeys[key] = tenant.Name
+		}
+	}
+
+	// Validate SLOs
+	if config.SLO.EvaluationInterval <= 0 || config.SLO.FastBurnWindow <= 0 || config.SLO.SlowBurnWindow <= 0 {
+		report.errorf("slo", "SLO evaluation interval and burn windows must be positive")
+	} else if config.SLO.FastBurnWindow >= config.SLO.SlowBurnWindow {
+		report.errorf("slo.fast_burn_window", "SLO fast burn window must be shorter than the slow burn window")
+	}
+	if config.SLO.FastBurnRate <= 0 || config.SLO.SlowBurnRate <= 0 {
+		report.errorf("slo", "SLO burn rates must be positive")
+	}
+
+	// Validate webhook triggers
+	if config.Triggers.MaxBodyBytes <= 0 {
+		report.errorf("triggers.max_body_bytes", "trigger max body bytes must be positive")
+	}
+	triggerNames := make(map[string]bool)
+	for _, trigger := range config.Triggers.Webhooks {
+		if trigger.Name == "" {
+			report.errorf("triggers.webhooks", "webhook trigger name is required")
+			continue
+		}
+		if triggerNames[trigger.Name] {
+			report.errorf("triggers.webhooks", "duplicate webhook trigger %s", trigger.Name)
+		}
+		triggerNames[trigger.Name] = true
+		if _, err := uuid.Parse(trigger.WorkflowID); err != nil {
+			report.errorf("triggers.webhooks", "invalid workflow ID of webhook trigger %s: %v", trigger.Name, err)
+		}
+		if trigger.Secret == "" {
+			report.errorf("triggers.webhooks", "secret of webhook trigger %s is required", trigger.Name)
+		}
+	}
+	
+	// Validate feature flags
+	if config.Flags.StaleCheckInterval <= 0 {
+		report.errorf("flags.stale_check_interval", "flag stale check interval must be positive")
+	}
+
+	// Validate the dependency graph
+	if config.Dependencies.MaxDepth <= 0 {
+		report.errorf("dependencies.max_depth", "dependency max depth must be positive")
+	}
+	for _, serverURL := range config.Dependencies.ServerURLs {
+		if parsed, err := url.Parse(serverURL); err != nil || parsed.Host == "" {
+			report.errorf("dependencies.server_urls", "invalid dependency server URL %q", serverURL)
+		}
+	}
+
+	// Validate capacity reservations
+	if config.Reservations.GracePeriod < 0 || config.Reservations.ReleasePeriod < 0 {
+		report.errorf("reservations", "reservation grace and release periods must not be negative")
+	}
+	if config.Reservations.MaxReservedShare <= 0 || config.Reservations.MaxReservedShare > 1 {
+		report.errorf("reservations.max_reserved_share", "reservation max reserved share must be within (0, 1]")
+	}
+
+	// Validate approvals
+	if config.Approvals.Timeout <= 0 || config.Approvals.SweepInterval <= 0 {
+		report.errorf("approvals", "approval timeout and sweep interval must be positive")
+	}
+	
+	// Validate the secret provider and the secret references
+	checkSecrets(config, report)
+
+	// Validate freezes
+	if config.Freeze.RefreshInterval <= 0 {
+		report.errorf("freeze.refresh_interval", "freeze refresh interval must be positive")
+	}
+	if config.Freeze.HeldWebhookLimit <= 0 || config.Freeze.ScheduleCatchUpLimit <= 0 {
+		report.errorf("freeze", "freeze held webhook and schedule catch-up limits must be positive")
 	}
 	
 	// Validate JWT secret if JWT is used
 	if config.Security.JWT.Secret == "" {
 		config.Security.JWT.Secret = os.Getenv("JWT_SECRET")
 		if config.Security.JWT.Secret == "" {
-			return fmt.Errorf("JWT secret is required")
+			report.errorf("security.jwt.secret", "JWT secret is required")
 		}
 	}
 	
-	return nil
+	// Check that settings agree with each other and with the files they
+	// reference
+	checkConsistency(config, report)
+}
+
+// validOverflowPolicy reports whether an event handler buffer overflow
+// policy is supported
+func validOverflowPolicy(policy string) bool {
+	switch policy {
+	case "block", "drop-oldest", "drop-newest":
+		return true
+	}
+	return false
 }
 
 // GetDSN returns the database connection string
@@ -276,6 +1396,16 @@ func (c *DatabaseConfig) GetDSN() string {
 	}
 }
 
+// GetReplicaDSN returns the connection string of a read replica
+func (c *DatabaseConfig) GetReplicaDSN(replica ReplicaConfig) string {
+	replicaConfig := *c
+	replicaConfig.Host = replica.Host
+	if replica.Port != 0 {
+		replicaConfig.Port = replica.Port
+	}
+	return replicaConfig.GetDSN()
+}
+
 // GetRedisAddr returns the Redis connection address
 func (c *CacheConfig) GetRedisAddr() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
@@ -0,0 +1,342 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseConfig = `
+server:
+  port: 8080
+database:
+  host: db.internal
+  port: 5432
+  database: magicflow
+  max_open_conns: 25
+logging:
+  level: info
+  format: json
+features:
+  dashboard: true
+  code_generation: true
+admission:
+  maintenance_windows:
+    - name: base-window
+      start: "2024-03-01T02:00:00Z"
+      end: "2024-03-01T04:00:00Z"
+security:
+  jwt:
+    secret: base-secret
+`
+
+const prodOverlay = `
+database:
+  host: db.prod.internal
+  max_open_conns: 100
+logging:
+  level: warn
+features:
+  dashboard: false
+admission:
+  maintenance_windows:
+    - name: prod-window
+      start: "2024-04-01T02:00:00Z"
+      end: "2024-04-01T03:00:00Z"
+`
+
+func writeConfigs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+func load(t *testing.T, path string) *Config {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestLoadProfileOverlay(t *testing.T) {
+	t.Run("overlay values win and base values are retained", func(t *testing.T) {
+		path := writeConfigs(t, map[string]string{
+			"config.yaml":      baseConfig + "environment: production\n",
+			"config.prod.yaml": prodOverlay,
+		})
+		cfg := load(t, path)
+
+		assert.Equal(t, "production", cfg.Environment)
+		assert.Equal(t, "db.prod.internal", cfg.Database.Host)
+		assert.Equal(t, 100, cfg.Database.MaxOpenConns)
+		assert.Equal(t, "warn", cfg.Logging.Level)
+		assert.False(t, cfg.Features.Dashboard)
+
+		// Keys the overlay does not set keep their base values, nested ones
+		// included
+		assert.Equal(t, 5432, cfg.Database.Port)
+		assert.Equal(t, "magicflow", cfg.Database.Database)
+		assert.Equal(t, "json", cfg.Logging.Format)
+		assert.True(t, cfg.Features.CodeGeneration)
+		assert.Equal(t, "base-secret", cfg.Security.JWT.Secret)
+
+		// Lists are replaced, not appended to
+		require.Len(t, cfg.Admission.MaintenanceWindows, 1)
+		assert.Equal(t, "prod-window", cfg.Admission.MaintenanceWindows[0].Name)
+
+		// Defaults still apply below both files
+		assert.Equal(t, 5*time.Minute, cfg.Database.ConnMaxLifetime)
+	})
+
+	t.Run("environment from the environment variable", func(t *testing.T) {
+		t.Setenv("MAGICFLOW_ENVIRONMENT", "production")
+		path := writeConfigs(t, map[string]string{
+			"config.yaml":      baseConfig,
+			"config.prod.yaml": prodOverlay,
+		})
+		cfg := load(t, path)
+
+		assert.Equal(t, "production", cfg.Environment)
+		assert.Equal(t, "db.prod.internal", cfg.Database.Host)
+	})
+
+	t.Run("only the overlay of the environment is merged", func(t *testing.T) {
+		path := writeConfigs(t, map[string]string{
+			"config.yaml":      baseConfig,
+			"config.dev.yaml":  "logging:\n  level: debug\n",
+			"config.prod.yaml": prodOverlay,
+		})
+		cfg := load(t, path)
+
+		assert.Equal(t, "development", cfg.Environment)
+		assert.Equal(t, "debug", cfg.Logging.Level)
+		assert.Equal(t, "db.internal", cfg.Database.Host)
+	})
+
+	t.Run("environment without an overlay", func(t *testing.T) {
+		path := writeConfigs(t, map[string]string{
+			"config.yaml":      baseConfig + "environment: staging\n",
+			"config.prod.yaml": prodOverlay,
+		})
+		cfg := load(t, path)
+
+		assert.Equal(t, "staging", cfg.Environment)
+		assert.Equal(t, "db.internal", cfg.Database.Host)
+		assert.Equal(t, "info", cfg.Logging.Level)
+	})
+
+	t.Run("invalid overlay", func(t *testing.T) {
+		path := writeConfigs(t, map[string]string{
+			"config.yaml":         baseConfig + "environment: staging\n",
+			"config.staging.yaml": "database: [\n",
+		})
+		viper.Reset()
+		t.Cleanup(viper.Reset)
+		_, err := Load(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "config.staging.yaml")
+	})
+}
+
+func TestOverlayPath(t *testing.T) {
+	assert.Equal(t, "/etc/magicflow/config.prod.yaml", OverlayPath("/etc/magicflow/config.yaml", Profile("production")))
+	assert.Equal(t, "config.dev.yml", OverlayPath("config.yml", Profile("development")))
+	assert.Equal(t, "config.qa.yaml", OverlayPath("config.yaml", Profile("qa")))
+}
+
+func diagnose(t *testing.T, path string) (*Config, *Report) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	cfg, report, err := Diagnose(path)
+	require.NoError(t, err)
+	return cfg, report
+}
+
+func TestDiagnoseReportsEveryIssue(t *testing.T) {
+	_, report := diagnose(t, "testdata/invalid.yaml")
+
+	var found []string
+	for _, issue := range report.Issues {
+		found = append(found, string(issue.Severity)+" "+issue.Key)
+	}
+	assert.ElementsMatch(t, []string{
+		"error server.read_timeout",
+		"error server.port",
+		"error delivery.ordering_policy",
+		"error slo.fast_burn_window",
+		"error server.tls.cert_file",
+		"error server.tls.key_file",
+		"error database.migrations.directory",
+		"error security.api.keys",
+		"warning analytics.sinks",
+		"warning analytics.sinks",
+	}, found)
+	assert.Equal(t, "8 errors, 2 warnings", report.Summary())
+	// Values that cannot be decoded are reported under their key
+	assert.Contains(t, report.Errors(), Issue{
+		Severity: SeverityError,
+		Key:      "server.read_timeout",
+		Message:  "invalid value 30 seconds, expected time.Duration",
+	})
+
+	// Load fails with every error, not only the first one
+	viper.Reset()
+	_, err := Load("testdata/invalid.yaml")
+	require.Error(t, err)
+	for _, issue := range report.Errors() {
+		assert.Contains(t, err.Error(), issue.String())
+	}
+}
+
+func TestDiagnoseValidConfig(t *testing.T) {
+	path := writeConfigs(t, map[string]string{"config.yaml": baseConfig})
+	_, report := diagnose(t, path)
+
+	assert.Empty(t, report.Issues)
+	assert.NoError(t, report.Err())
+}
+
+func TestReportOutput(t *testing.T) {
+	report := &Report{}
+	report.errorf("server.port", "invalid server port: %d", 0)
+	report.warnf("", "config file not found")
+
+	var text strings.Builder
+	require.NoError(t, report.WriteText(&text))
+	assert.Equal(t, "ERROR   server.port: invalid server port: 0\nWARNING config file not found\n1 error, 1 warning\n", text.String())
+
+	var document strings.Builder
+	require.NoError(t, report.WriteJSON(&document))
+	assert.JSONEq(t, `{
+		"valid": false,
+		"errors": 1,
+		"warnings": 1,
+		"issues": [
+			{"severity": "error", "key": "server.port", "message": "invalid server port: 0"},
+			{"severity": "warning", "message": "config file not found"}
+		]
+	}`, document.String())
+}
+
+func TestProbe(t *testing.T) {
+	// A port nothing listens on any more
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().(*net.TCPAddr)
+	require.NoError(t, listener.Close())
+
+	// A database that accepts connections
+	database, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer database.Close()
+	databaseAddr := database.Addr().(*net.TCPAddr)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o644))
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o644))
+
+	cfg := &Config{
+		Server: ServerConfig{TLS: TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile}},
+		Database: DatabaseConfig{
+			Host:     "127.0.0.1",
+			Port:     databaseAddr.Port,
+			Replicas: []ReplicaConfig{{Name: "reports", Host: "127.0.0.1", Port: closedAddr.Port}},
+		},
+		Artifacts: ArtifactsConfig{Dir: filepath.Join(dir, "artifacts")},
+	}
+	issues := Probe(context.Background(), cfg, time.Second)
+
+	require.Len(t, issues, 2)
+	assert.Equal(t, SeverityWarning, issues[0].Severity)
+	assert.Equal(t, "database.replicas.reports", issues[0].Key)
+	assert.Equal(t, SeverityError, issues[1].Severity)
+	assert.Equal(t, "server.tls", issues[1].Key)
+	assert.DirExists(t, filepath.Join(dir, "artifacts"))
+}
+
+// secretStore is a secret provider holding fixed secrets
+type secretStore map[string]string
+
+func (s secretStore) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := s[name]
+	if !ok {
+		return "", errors.New("secret not found")
+	}
+	return value, nil
+}
+
+func TestResolveSecrets(t *testing.T) {
+	cfg := &Config{}
+	cfg.Database.Password = "secret:database_password"
+	cfg.Cache.Password = "literal-password"
+	cfg.Security.JWT.Secret = "secret:jwt_secret"
+	cfg.Security.API.Keys = []string{"plain-key", "secret:ci#api_key"}
+	cfg.Triggers.Webhooks = []WebhookTriggerConfig{{Name: "github", Secret: "secret:missing"}}
+
+	err := cfg.ResolveSecrets(context.Background(), secretStore{
+		"database_password": "db-pass",
+		"jwt_secret":        "jwt-pass",
+		"ci#api_key":        "ci-key",
+	})
+
+	// References are resolved, other values are kept
+	assert.Equal(t, "db-pass", cfg.Database.Password)
+	assert.Equal(t, "literal-password", cfg.Cache.Password)
+	assert.Equal(t, "jwt-pass", cfg.Security.JWT.Secret)
+	assert.Equal(t, []string{"plain-key", "ci-key"}, cfg.Security.API.Keys)
+
+	// Unresolved references are reported with their key and keep their
+	// reference
+	require.Error(t, err)
+	assert.Equal(t, "triggers.webhooks[0].secret: failed to resolve secret missing: secret not found", err.Error())
+	assert.Equal(t, "secret:missing", cfg.Triggers.Webhooks[0].Secret)
+}
+
+func TestDiagnoseSecretProvider(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+	path := writeConfigs(t, map[string]string{"config.yaml": baseConfig + `
+  api:
+    keys: ["secret:"]
+secrets:
+  provider: vault
+`})
+	cfg, report := diagnose(t, path)
+
+	var found []string
+	for _, issue := range report.Issues {
+		found = append(found, issue.Key)
+	}
+	assert.ElementsMatch(t, []string{"secrets.vault.address", "secrets.vault.token", "security.api.keys[0]"}, found)
+	assert.Equal(t, "secret", cfg.Secrets.Vault.Mount)
+	assert.Equal(t, 10*time.Second, cfg.Secrets.Vault.Timeout)
+
+	// The token falls back to VAULT_TOKEN
+	t.Setenv("VAULT_TOKEN", "s.token")
+	path = writeConfigs(t, map[string]string{"config.yaml": baseConfig + `
+secrets:
+  provider: vault
+  vault:
+    address: https://vault.internal:8200
+    path: magic-flow
+`})
+	cfg, report = diagnose(t, path)
+	assert.Empty(t, report.Issues)
+	assert.Equal(t, "s.token", cfg.Secrets.Vault.Token)
+}
@@ -0,0 +1,392 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkConsistency reports the settings that are valid on their own but
+// contradict each other, and the files they reference that are missing
+func checkConsistency(config *Config, report *Report) {
+	// TLS needs its certificate and key
+	if tlsConfig := config.Server.TLS; tlsConfig.Enabled {
+		checkFile(report, "server.tls.cert_file", tlsConfig.CertFile, "TLS certificate")
+		checkFile(report, "server.tls.key_file", tlsConfig.KeyFile, "TLS key")
+	}
+
+	// Migrations are read from their directory
+	if migrations := config.Database.Migrations; migrations.Enabled && migrations.Directory != "" {
+		if _, err := os.Stat(migrations.Directory); err != nil {
+			if migrations.AutoRun {
+				report.errorf("database.migrations.directory", "migrations run at startup but their directory cannot be read: %v", err)
+			} else {
+				report.warnf("database.migrations.directory", "migrations directory cannot be read: %v", err)
+			}
+		}
+	}
+
+	validateCompression(report, config.Database.Compression)
+
+	// Log files are opened in an existing directory, else the server logs
+	// to stdout
+	if output := config.Logging.Output; output != "" && output != "stdout" && output != "stderr" {
+		if info, err := os.Stat(filepath.Dir(output)); err != nil || !info.IsDir() {
+			report.warnf("logging.output", "directory of log file %s does not exist, logs go to stdout", output)
+		}
+	}
+	if format := config.Logging.Format; format != "json" && format != "text" {
+		report.warnf("logging.format", "unknown log format %q, logs are written as text", format)
+	}
+
+	// Artifacts are stored in a directory, created at startup
+	if info, err := os.Stat(config.Artifacts.Dir); err == nil && !info.IsDir() {
+		report.errorf("artifacts.dir", "artifact directory %s is a file", config.Artifacts.Dir)
+	}
+	validateExtraction(report, config.Artifacts.Extraction)
+
+	if config.Watch.PollInterval <= 0 || config.Watch.BatchSize <= 0 {
+		report.errorf("watch", "watch poll interval and batch size must be positive")
+	}
+	validateAutoRegenerate(report, config.Codegen.AutoRegenerate)
+	validateSpikes(report, config.Spikes)
+
+	// API key authentication needs keys
+	if config.Security.API.Enabled && len(config.Security.API.Keys) == 0 && !hasTenantKeys(config.Tenancy) {
+		report.errorf("security.api.keys", "API key authentication is enabled but no API key is configured, in security.api.keys or tenancy.tenants")
+	}
+	if config.Cache.Enabled && config.Cache.Host == "" {
+		report.errorf("cache.host", "cache is enabled but has no host")
+	}
+
+	if config.Cluster.MaxVariableBytes < 0 {
+		report.errorf("cluster.max_variable_bytes", "variable budget must not be negative")
+	}
+
+	// Quotas are counted in memory by each node
+	if config.Quotas.Enabled && config.Cluster.NodeID != "" {
+		report.warnf("quotas", "quotas are counted by each node without a shared store: in a cluster, tenants may start their quota on every node")
+	}
+
+	// Settings of disabled features
+	if !config.Analytics.Enabled && len(config.Analytics.Sinks) > 0 {
+		report.warnf("analytics.sinks", "analytics sinks are configured but analytics is disabled")
+	}
+	for _, sink := range config.Analytics.Sinks {
+		switch {
+		case sink.Type == "jsonl" && sink.Path == "":
+			report.errorf("analytics.sinks", "path of jsonl analytics sink %s is required", sink.Name)
+		case sink.Type == "kafka":
+			report.warnf("analytics.sinks", "kafka analytics sink %s is skipped: no Kafka producer is configured", sink.Name)
+		}
+	}
+	if !config.Quotas.Enabled && (len(config.Quotas.Tenants) > 0 || config.Quotas.Default.Executions > 0) {
+		report.warnf("quotas", "quotas are configured but quotas are disabled")
+	}
+	if !config.Tenancy.MultiTenant && len(config.Tenancy.Tenants) > 0 {
+		report.warnf("tenancy.tenants", "tenants are configured but tenancy.multi_tenant is disabled")
+	}
+	if !config.Features.Webhooks && len(config.Triggers.Webhooks) > 0 {
+		report.warnf("triggers.webhooks", "webhook triggers are configured but features.webhooks is disabled")
+	}
+}
+
+// checkFile reports a file setting that is empty or names a missing file
+func checkFile(report *Report, key, path, description string) {
+	if path == "" {
+		report.errorf(key, "%s is required", description)
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		report.errorf(key, "%s cannot be read: %v", description, err)
+	}
+}
+
+func hasTenantKeys(tenancy TenancyConfig) bool {
+	for _, tenant := range tenancy.Tenants {
+		if len(tenant.APIKeys) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaTenants returns the tenants with a quota, sorted
+func quotaTenants(tenants map[string]QuotaLimit) []string {
+	names := make([]string, 0, len(tenants))
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateCompression reports the algorithms and thresholds of payload
+// compression that cannot be applied, and the skipped columns not named as
+// table.column
+func validateCompression(report *Report, compression CompressionConfig) {
+	if compression.Enabled {
+		if compression.Algorithm != "zstd" && compression.Algorithm != "gzip" {
+			report.errorf("database.compression.algorithm", "unknown compression algorithm %q, expected zstd or gzip", compression.Algorithm)
+		}
+		if compression.Threshold <= 0 {
+			report.errorf("database.compression.threshold", "compression threshold must be positive")
+		}
+	}
+	for i, column := range compression.Skip {
+		if parts := strings.Split(column, "."); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			report.errorf(fmt.Sprintf("database.compression.skip[%d]", i), "column %q is not named as table.column", column)
+		}
+	}
+}
+
+// validateExtraction reports the thresholds and field paths of input
+// extraction that cannot be applied
+func validateExtraction(report *Report, extraction ExtractionConfig) {
+	if extraction.Enabled && extraction.Threshold <= 0 {
+		report.errorf("artifacts.extraction.threshold", "extraction threshold must be positive")
+	}
+	if extraction.InlineLimit < 0 {
+		report.errorf("artifacts.extraction.inline_limit", "inline limit must not be negative")
+	}
+	for _, list := range []struct {
+		key   string
+		paths []string
+	}{{"artifacts.extraction.allow", extraction.Allow}, {"artifacts.extraction.deny", extraction.Deny}} {
+		for i, path := range list.paths {
+			for _, segment := range strings.Split(path, ".") {
+				if segment == "" {
+					report.errorf(fmt.Sprintf("%s[%d]", list.key, i), "field path %q has an empty segment", path)
+					break
+				}
+			}
+		}
+	}
+}
+
+// generatedLanguages are the languages clients are generated in
+var generatedLanguages = map[string]bool{
+	"go": true, "typescript": true, "python": true, "java": true,
+	"kotlin": true, "swift": true, "ruby": true, "grpc": true,
+}
+
+// validateAutoRegenerate reports the regenerated clients without a workflow
+// or in unknown languages, and an output directory that is a file
+func validateAutoRegenerate(report *Report, regenerate AutoRegenerateConfig) {
+	if !regenerate.Enabled {
+		return
+	}
+	if regenerate.OutputDir == "" {
+		report.errorf("codegen.auto_regenerate.output_dir", "auto-regeneration needs an output directory")
+	} else if info, err := os.Stat(regenerate.OutputDir); err == nil && !info.IsDir() {
+		report.errorf("codegen.auto_regenerate.output_dir", "output directory %s is a file", regenerate.OutputDir)
+	}
+	if len(regenerate.Targets) == 0 {
+		report.warnf("codegen.auto_regenerate.targets", "auto-regeneration is enabled but has no targets")
+	}
+	for i, target := range regenerate.Targets {
+		key := fmt.Sprintf("codegen.auto_regenerate.targets[%d]", i)
+		if target.Workflow == "" {
+			report.errorf(key, "regenerated client has no workflow")
+		}
+		if !generatedLanguages[target.Language] {
+			report.errorf(key, "unsupported client language %q", target.Language)
+		}
+	}
+}
+
+// validateSpikes reports unknown spike guard actions and rates or periods
+// that are not positive
+func validateSpikes(report *Report, spikes SpikesConfig) {
+	if !spikes.Enabled {
+		return
+	}
+	switch spikes.Action {
+	case "notify", "confirm", "throttle":
+	default:
+		report.errorf("spikes.action", "unknown spike guard action %q, expected notify, confirm or throttle", spikes.Action)
+	}
+	if spikes.Multiplier <= 1 {
+		report.errorf("spikes.multiplier", "spike guard multiplier must be greater than 1")
+	}
+	if spikes.MinRate <= 0 {
+		report.errorf("spikes.min_rate", "spike guard minimum rate must be positive")
+	}
+	if spikes.Window <= 0 || spikes.CoolDown <= 0 || spikes.SweepInterval <= 0 {
+		report.errorf("spikes", "spike guard window, cool-down and sweep interval must be positive")
+	}
+	if spikes.BaselineWindow < time.Hour {
+		report.errorf("spikes.baseline_window", "spike guard baseline window must be at least an hour")
+	} else if spikes.Window >= spikes.BaselineWindow {
+		report.errorf("spikes.window", "spike guard window must be shorter than the baseline window")
+	}
+}
+
+// validateActivationGates reports the gates of unknown types, the webhook
+// gates without an http URL and the malformed overriders
+func validateActivationGates(report *Report, gates ActivationGatesConfig) {
+	if gates.WebhookTimeout <= 0 {
+		report.errorf("versioning.gates.webhook_timeout", "activation gate webhook timeout must be positive")
+	}
+
+	checklists := map[string][]GateConfig{"versioning.gates.checklist": gates.Checklist}
+	for namespace, checklist := range gates.Namespaces {
+		checklists["versioning.gates.namespaces."+namespace] = checklist
+	}
+	keys := make([]string, 0, len(checklists))
+	for key := range checklists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for i, gate := range checklists[key] {
+			gateKey := fmt.Sprintf("%s[%d]", key, i)
+			switch gate.Type {
+			case "lint-clean", "simulation-passed", "second-person-review", "impact-notification-sent":
+			case "webhook":
+				parsed, err := url.Parse(gate.URL)
+				if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+					report.errorf(gateKey+".url", "webhook gate needs an http or https URL")
+				}
+			default:
+				report.errorf(gateKey+".type", "unknown activation gate type %q", gate.Type)
+			}
+			if gate.Timeout < 0 {
+				report.errorf(gateKey+".timeout", "activation gate timeout must not be negative")
+			}
+		}
+	}
+
+	for i, overrider := range gates.Overriders {
+		valid := false
+		for _, prefix := range []string{"user:", "group:", "role:"} {
+			if strings.HasPrefix(overrider, prefix) && strings.TrimSpace(strings.TrimPrefix(overrider, prefix)) != "" {
+				valid = true
+			}
+		}
+		if !valid {
+			report.errorf(fmt.Sprintf("versioning.gates.overriders[%d]", i), "overrider %q must be a user:, group: or role: reference", overrider)
+		}
+	}
+}
+
+// probe checks that an external resource a config references can be used
+type probe struct {
+	key      string
+	severity Severity
+	check    func(ctx context.Context) error
+}
+
+// Probe checks that the external resources a config references can be
+// used: the database and the cache are reachable, the TLS files parse and
+// the artifact directory is writable. Each probe is bounded by the timeout.
+// The issues are returned in a stable order.
+func Probe(ctx context.Context, config *Config, timeout time.Duration) []Issue {
+	probes := []probe{{
+		key:      "database",
+		severity: SeverityError,
+		check:    dial(net.JoinHostPort(config.Database.Host, strconv.Itoa(config.Database.Port))),
+	}}
+	for _, replica := range config.Database.Replicas {
+		port := replica.Port
+		if port == 0 {
+			port = config.Database.Port
+		}
+		probes = append(probes, probe{
+			key:      "database.replicas." + replica.Name,
+			severity: SeverityWarning,
+			check:    dial(net.JoinHostPort(replica.Host, strconv.Itoa(port))),
+		})
+	}
+	if config.Cache.Enabled {
+		probes = append(probes, probe{
+			key:      "cache",
+			severity: SeverityWarning,
+			check:    dial(config.Cache.GetRedisAddr()),
+		})
+	}
+	if tlsConfig := config.Server.TLS; tlsConfig.Enabled && tlsConfig.CertFile != "" && tlsConfig.KeyFile != "" {
+		probes = append(probes, probe{
+			key:      "server.tls",
+			severity: SeverityError,
+			check: func(ctx context.Context) error {
+				_, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+				return err
+			},
+		})
+	}
+	probes = append(probes, probe{
+		key:      "artifacts.dir",
+		severity: SeverityError,
+		check:    writable(config.Artifacts.Dir),
+	})
+
+	issues := make([]*Issue, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func(i int, p probe) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			err := make(chan error, 1)
+			go func() { err <- p.check(probeCtx) }()
+			select {
+			case probeErr := <-err:
+				if probeErr != nil {
+					issues[i] = &Issue{Severity: p.severity, Key: p.key, Message: fmt.Sprintf("probe failed: %v", probeErr)}
+				}
+			case <-probeCtx.Done():
+				issues[i] = &Issue{Severity: p.severity, Key: p.key, Message: fmt.Sprintf("probe timed out after %s", timeout)}
+			}
+		}(i, p)
+	}
+	wg.Wait()
+
+	var found []Issue
+	for _, issue := range issues {
+		if issue != nil {
+			found = append(found, *issue)
+		}
+	}
+	return found
+}
+
+// dial returns a probe connecting to a TCP address
+func dial(address string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// writable returns a probe creating, like the server, and writing to a
+// directory
+func writable(dir string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		file, err := os.CreateTemp(dir, ".probe-*")
+		if err != nil {
+			return err
+		}
+		file.Close()
+		return os.Remove(file.Name())
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Severity is the severity of a config issue
+type Severity string
+
+const (
+	// SeverityError issues keep the server from starting
+	SeverityError Severity = "error"
+	// SeverityWarning issues are reported, the server still starts
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem found in a config
+type Issue struct {
+	Severity Severity `json:"severity"`
+	// Key is the config key of the issue, such as server.tls.cert_file, or
+	// empty for issues of the config as a whole
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	if i.Key == "" {
+		return i.Message
+	}
+	return i.Key + ": " + i.Message
+}
+
+// Report lists every issue found in a config, in the order they were found
+type Report struct {
+	Issues []Issue `json:"issues"`
+}
+
+// Add adds issues to the report
+func (r *Report) Add(issues ...Issue) {
+	r.Issues = append(r.Issues, issues...)
+}
+
+func (r *Report) errorf(key, format string, args ...interface{}) {
+	r.Add(Issue{Severity: SeverityError, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) warnf(key, format string, args ...interface{}) {
+	r.Add(Issue{Severity: SeverityWarning, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// Errors returns the error issues
+func (r *Report) Errors() []Issue {
+	return r.filter(SeverityError)
+}
+
+// Warnings returns the warning issues
+func (r *Report) Warnings() []Issue {
+	return r.filter(SeverityWarning)
+}
+
+func (r *Report) filter(severity Severity) []Issue {
+	var issues []Issue
+	for _, issue := range r.Issues {
+		if issue.Severity == severity {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// HasErrors reports whether the report holds errors
+func (r *Report) HasErrors() bool {
+	return len(r.Errors()) > 0
+}
+
+// Err returns the errors of the report as one error, nil without errors
+func (r *Report) Err() error {
+	issues := r.Errors()
+	if len(issues) == 0 {
+		return nil
+	}
+	messages := make([]string, len(issues))
+	for i, issue := range issues {
+		messages[i] = issue.String()
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// Summary returns the number of errors and warnings of the report
+func (r *Report) Summary() string {
+	return fmt.Sprintf("%s, %s", plural(len(r.Errors()), "error"), plural(len(r.Warnings()), "warning"))
+}
+
+// WriteText writes the report for humans, one issue per line followed by
+// the summary
+func (r *Report) WriteText(w io.Writer) error {
+	for _, issue := range r.Issues {
+		if _, err := fmt.Fprintf(w, "%-7s %s\n", strings.ToUpper(string(issue.Severity)), issue); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, r.Summary())
+	return err
+}
+
+// WriteJSON writes the report as a JSON document
+func (r *Report) WriteJSON(w io.Writer) error {
+	issues := r.Issues
+	if issues == nil {
+		issues = []Issue{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Valid    bool    `json:"valid"`
+		Errors   int     `json:"errors"`
+		Warnings int     `json:"warnings"`
+		Issues   []Issue `json:"issues"`
+	}{
+		Valid:    !r.HasErrors(),
+		Errors:   len(r.Errors()),
+		Warnings: len(r.Warnings()),
+		Issues:   issues,
+	})
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
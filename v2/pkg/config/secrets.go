@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SecretRefPrefix prefixes the config values naming a secret of the secret
+// provider rather than holding it, such as secret:database_password
+const SecretRefPrefix = "secret:"
+
+// SecretsConfig contains the configuration of the secret provider, which
+// resolves the secret references of the config and the secrets steps read
+// with secret()
+type SecretsConfig struct {
+	// Provider is env or vault. Vault is read first, with environment
+	// variables as the fallback.
+	Provider string `mapstructure:"provider" default:"env"`
+	// EnvPrefix prefixes the environment variables secrets are read from:
+	// the secret database_password is MAGICFLOW_SECRET_DATABASE_PASSWORD
+	EnvPrefix string      `mapstructure:"env_prefix" default:"MAGICFLOW_SECRET_"`
+	Vault     VaultConfig `mapstructure:"vault"`
+}
+
+// VaultConfig contains the configuration of the HashiCorp Vault provider
+type VaultConfig struct {
+	Address string `mapstructure:"address"`
+	// Token authenticates with Vault, read from VAULT_TOKEN when empty
+	Token string `mapstructure:"token"`
+	// Mount is the mount path of the KV version 2 secrets engine
+	Mount string `mapstructure:"mount" default:"secret"`
+	// Path is the secret holding the keys of names without a path;
+	// payments/stripe#api_key names the api_key key of payments/stripe
+	Path    string        `mapstructure:"path"`
+	Timeout time.Duration `mapstructure:"timeout" default:"10s"`
+}
+
+// SecretProvider reads secrets by name. secrets.Provider implements it.
+type SecretProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// secretField is a config value that may reference a secret
+type secretField struct {
+	key   string
+	value *string
+}
+
+// secretFields returns the config values that may reference a secret
+func (c *Config) secretFields() []secretField {
+	fields := []secretField{
+		{"database.password", &c.Database.Password},
+		{"cache.password", &c.Cache.Password},
+		{"security.jwt.secret", &c.Security.JWT.Secret},
+	}
+	for i := range c.Security.API.Keys {
+		fields = append(fields, secretField{fmt.Sprintf("security.api.keys[%d]", i), &c.Security.API.Keys[i]})
+	}
+	for i := range c.Triggers.Webhooks {
+		fields = append(fields, secretField{fmt.Sprintf("triggers.webhooks[%d].secret", i), &c.Triggers.Webhooks[i].Secret})
+	}
+	return fields
+}
+
+// ResolveSecrets replaces the secret references of the config, values such
+// as secret:jwt_secret, with the secrets the provider holds. Only referenced
+// secrets are read, once the server starts. Every reference that cannot be
+// resolved is reported.
+func (c *Config) ResolveSecrets(ctx context.Context, provider SecretProvider) error {
+	var errs []error
+	for _, field := range c.secretFields() {
+		name, ok := secretRef(*field.value)
+		if !ok {
+			continue
+		}
+		value, err := provider.GetSecret(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to resolve secret %s: %w", field.key, name, err))
+			continue
+		}
+		*field.value = value
+	}
+	return errors.Join(errs...)
+}
+
+// secretRef returns the secret name of a secret reference
+func secretRef(value string) (string, bool) {
+	if !strings.HasPrefix(value, SecretRefPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(value, SecretRefPrefix)), true
+}
+
+// checkSecrets validates the secret provider and the secret references of
+// the config
+func checkSecrets(config *Config, report *Report) {
+	secrets := &config.Secrets
+	switch secrets.Provider {
+	case "", "env":
+	case "vault":
+		if secrets.Vault.Token == "" {
+			secrets.Vault.Token = os.Getenv("VAULT_TOKEN")
+		}
+		if secrets.Vault.Address == "" {
+			report.errorf("secrets.vault.address", "vault address is required with the vault secret provider")
+		} else if _, err := url.ParseRequestURI(secrets.Vault.Address); err != nil {
+			report.errorf("secrets.vault.address", "invalid vault address: %v", err)
+		}
+		if secrets.Vault.Token == "" {
+			report.errorf("secrets.vault.token", "vault token is required with the vault secret provider, set it or VAULT_TOKEN")
+		}
+		if secrets.Vault.Timeout <= 0 {
+			report.errorf("secrets.vault.timeout", "vault timeout must be positive")
+		}
+	default:
+		report.errorf("secrets.provider", "unknown secret provider %q, expected env or vault", secrets.Provider)
+	}
+
+	for _, field := range config.secretFields() {
+		if name, ok := secretRef(*field.value); ok && name == "" {
+			report.errorf(field.key, "secret reference names no secret")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SunsetPolicy is what happens to new executions of a deprecated workflow
+// after its sunset date
+type SunsetPolicy string
+
+const (
+	// SunsetPolicyWarn keeps executing the workflow with a deprecation warning
+	SunsetPolicyWarn SunsetPolicy = "warn"
+	// SunsetPolicyReject rejects new executions, pointing at the replacement
+	SunsetPolicyReject SunsetPolicy = "reject"
+	// SunsetPolicyForward executes the replacement workflow with the mapped
+	// input instead
+	SunsetPolicyForward SunsetPolicy = "forward"
+)
+
+// Deprecation marks a workflow or workflow version as deprecated. It is
+// stored and exported with the workflow or version it deprecates.
+type Deprecation struct {
+	DeprecatedAt time.Time `json:"deprecated_at"`
+	// SunsetAt is when the sunset policy starts to apply. Deprecations
+	// without a sunset date only warn.
+	SunsetAt     *time.Time   `json:"sunset_at,omitempty"`
+	Reason       string       `json:"reason,omitempty"`
+	Replacement  *Replacement `json:"replacement,omitempty"`
+	SunsetPolicy SunsetPolicy `json:"sunset_policy"`
+}
+
+// Replacement is the workflow that replaces a deprecated workflow or version
+type Replacement struct {
+	WorkflowID uuid.UUID `json:"workflow_id"`
+	// VersionID pins the replacement to a version of the workflow
+	VersionID *uuid.UUID `json:"version_id,omitempty"`
+	// InputMapping maps the input fields of the replacement to dot separated
+	// paths in the input of the deprecated workflow. Executions are only
+	// forwarded when it is set.
+	InputMapping map[string]string `json:"input_mapping,omitempty"`
+}
+
+// IsSunset returns true if the sunset date has passed at a time
+func (d *Deprecation) IsSunset(at time.Time) bool {
+	return d.SunsetAt != nil && !at.Before(*d.SunsetAt)
+}
+
+// Validate validates the deprecation
+func (d *Deprecation) Validate() error {
+	switch d.SunsetPolicy {
+	case SunsetPolicyWarn, SunsetPolicyReject:
+	case SunsetPolicyForward:
+		if d.Replacement == nil || len(d.Replacement.InputMapping) == 0 {
+			return errors.New("the forward sunset policy requires a replacement with an input mapping")
+		}
+	default:
+		return errors.New("sunset policy must be warn, reject or forward")
+	}
+
+	if d.SunsetAt != nil && d.SunsetAt.Before(d.DeprecatedAt) {
+		return errors.New("sunset date must not be before the deprecation date")
+	}
+	if d.Replacement != nil && d.Replacement.WorkflowID == uuid.Nil {
+		return errors.New("replacement workflow ID is required")
+	}
+	return nil
+}
@@ -16,10 +16,16 @@ const (
 	ExecutionStatusPending   ExecutionStatus = "pending"
 	ExecutionStatusRunning   ExecutionStatus = "running"
 	ExecutionStatusCompleted ExecutionStatus = "completed"
+	// ExecutionStatusCompletedWithWarnings is the status of executions that
+	// completed although background steps failed
+	ExecutionStatusCompletedWithWarnings ExecutionStatus = "completed_with_warnings"
 	ExecutionStatusFailed    ExecutionStatus = "failed"
 	ExecutionStatusCancelled ExecutionStatus = "cancelled"
 	ExecutionStatusTimeout   ExecutionStatus = "timeout"
 	ExecutionStatusPaused    ExecutionStatus = "paused"
+	// ExecutionStatusParked is the status of executions checkpointed when
+	// the node running them drained, waiting to resume on another node
+	ExecutionStatusParked ExecutionStatus = "parked"
 )
 
 // StepStatus represents the status of a workflow step execution
@@ -43,6 +49,9 @@ const (
 	TriggerTypeScheduled TriggerType = "scheduled"
 	TriggerTypeWebhook   TriggerType = "webhook"
 	TriggerTypeEvent     TriggerType = "event"
+	// TriggerTypeReplay executions replay the recorded step outputs of the
+	// execution they record as their parent
+	TriggerTypeReplay TriggerType = "replay"
 )
 
 // Execution represents a workflow execution instance
@@ -51,26 +60,64 @@ type Execution struct {
 	WorkflowID uuid.UUID       `json:"workflow_id" gorm:"type:uuid;not null;index"`
 	Status     ExecutionStatus `json:"status" gorm:"default:'pending';index"`
 	
+	// Tenant owning the workflow of the execution in multi-tenant
+	// deployments, empty otherwise
+	TenantID string `json:"tenant_id,omitempty" gorm:"index"`
+	
 	// Trigger information
 	TriggerType TriggerType            `json:"trigger_type" gorm:"not null"`
 	TriggerBy   string                 `json:"trigger_by"`
-	TriggerData map[string]interface{} `json:"trigger_data" gorm:"type:jsonb"`
+	TriggerData map[string]interface{} `json:"trigger_data" gorm:"type:jsonb;serializer:compressed"`
 	
-	// Input and output data
-	InputData  map[string]interface{} `json:"input_data" gorm:"type:jsonb"`
-	OutputData map[string]interface{} `json:"output_data" gorm:"type:jsonb"`
+	// Input and output data. Payload columns, which are not queried in
+	// SQL, are compressed once payload compression is enabled.
+	InputData  map[string]interface{} `json:"input_data" gorm:"type:jsonb;serializer:compressed"`
+	OutputData map[string]interface{} `json:"output_data" gorm:"type:jsonb;serializer:compressed"`
 	
 	// Execution context
-	Context ExecutionContext `json:"context" gorm:"type:jsonb"`
+	Context ExecutionContext `json:"context" gorm:"type:jsonb;serializer:compressed"`
+	
+	// Correlation, shared by every execution of one business transaction.
+	// Child executions record the execution that spawned them.
+	CorrelationID     string     `json:"correlation_id" gorm:"index"`
+	ParentExecutionID *uuid.UUID `json:"parent_execution_id,omitempty" gorm:"type:uuid;index"`
+	// GroupID is the execution group the execution is a member of, whose
+	// labels it carries
+	GroupID *uuid.UUID        `json:"group_id,omitempty" gorm:"type:uuid;index"`
+	Labels  map[string]string `json:"labels,omitempty" gorm:"type:jsonb;serializer:json"`
+	
+	// Worker node that last ran the execution. Placements records every
+	// node it ran on.
+	NodeID string `json:"node_id,omitempty" gorm:"index"`
 	
 	// Timing information
 	StartedAt   *time.Time `json:"started_at"`
 	CompletedAt *time.Time `json:"completed_at"`
 	Duration    int64      `json:"duration"` // Duration in milliseconds
+	// RespondedAt is when the steps the response depends on completed and
+	// callers waiting on the execution were answered. Background steps may
+	// complete later.
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
 	
 	// Error information
 	Error     string `json:"error,omitempty"`
 	ErrorCode string `json:"error_code,omitempty"`
+	// Warnings lists the failures of background steps
+	Warnings []string `json:"warnings,omitempty" gorm:"type:jsonb;serializer:json"`
+	
+	// Flags are the feature flags the definition references, evaluated once
+	// when the execution started
+	Flags map[string]bool `json:"flags,omitempty" gorm:"type:jsonb;serializer:json"`
+	
+	// ExecutionMode is the mode the execution ran in. The per-step events
+	// of lightweight executions are not stored, they are synthesized from
+	// their step executions when queried.
+	ExecutionMode ExecutionMode `json:"execution_mode,omitempty"`
+	
+	// Triage classification of failed executions. TriageClass repeats the
+	// class of Triage so executions can be grouped and filtered by it.
+	TriageClass string  `json:"triage_class,omitempty" gorm:"index"`
+	Triage      *Triage `json:"triage,omitempty" gorm:"type:jsonb;serializer:json"`
 	
 	// Metadata
 	Metadata map[string]interface{} `json:"metadata" gorm:"type:jsonb"`
@@ -84,6 +131,21 @@ type Execution struct {
 	Workflow  Workflow       `json:"workflow,omitempty" gorm:"foreignKey:WorkflowID"`
 	Steps     []StepExecution `json:"steps,omitempty" gorm:"foreignKey:ExecutionID"`
 	Events    []ExecutionEvent `json:"events,omitempty" gorm:"foreignKey:ExecutionID"`
+	Placements []ExecutionPlacement `json:"placements,omitempty" gorm:"foreignKey:ExecutionID"`
+}
+
+// Triage is the outcome classification of a failed execution, telling
+// on-call what kind of failure it is and what to do about it
+type Triage struct {
+	// Class is the triage class, such as downstream_5xx or bad_input
+	Class string `json:"class"`
+	// Confidence is how sure the classification is, between 0 and 1
+	Confidence float64 `json:"confidence"`
+	// Rule is the name of the rule that assigned the class
+	Rule string `json:"rule,omitempty"`
+	// Action is the action the rule suggests
+	Action       string    `json:"action,omitempty"`
+	ClassifiedAt time.Time `json:"classified_at"`
 }
 
 // ExecutionContext represents the execution context
@@ -106,15 +168,22 @@ type StepExecution struct {
 	StepType    string     `json:"step_type" gorm:"not null"`
 	Status      StepStatus `json:"status" gorm:"default:'pending'"`
 	
+	// Correlation ID of the execution
+	CorrelationID string `json:"correlation_id" gorm:"index"`
+	
 	// Input and output data
-	InputData  map[string]interface{} `json:"input_data" gorm:"type:jsonb"`
-	OutputData map[string]interface{} `json:"output_data" gorm:"type:jsonb"`
+	InputData  map[string]interface{} `json:"input_data" gorm:"type:jsonb;serializer:compressed"`
+	OutputData map[string]interface{} `json:"output_data" gorm:"type:jsonb;serializer:compressed"`
 	
 	// Timing information
 	StartedAt   *time.Time `json:"started_at"`
 	CompletedAt *time.Time `json:"completed_at"`
 	Duration    int64      `json:"duration"` // Duration in milliseconds
 	
+	// AfterResponse is set for steps that completed after the response of
+	// the execution was returned
+	AfterResponse bool `json:"after_response,omitempty"`
+	
 	// Retry information
 	Attempt     int `json:"attempt" gorm:"default:1"`
 	MaxAttempts int `json:"max_attempts" gorm:"default:1"`
@@ -142,8 +211,11 @@ type ExecutionEvent struct {
 	EventType   string    `json:"event_type" gorm:"not null;index"`
 	StepName    string    `json:"step_name,omitempty" gorm:"index"`
 	
+	// Correlation ID of the execution
+	CorrelationID string `json:"correlation_id" gorm:"index"`
+	
 	// Event data
-	Data map[string]interface{} `json:"data" gorm:"type:jsonb"`
+	Data map[string]interface{} `json:"data" gorm:"type:jsonb;serializer:compressed"`
 	
 	// Timing
 	Timestamp time.Time `json:"timestamp" gorm:"not null;index"`
@@ -155,6 +227,28 @@ type ExecutionEvent struct {
 	Execution Execution `json:"-" gorm:"foreignKey:ExecutionID"`
 }
 
+// PlacementHop is the reason an execution was placed on a worker node
+type PlacementHop string
+
+const (
+	PlacementHopStart   PlacementHop = "start"
+	PlacementHopResume  PlacementHop = "resume"
+	PlacementHopRetry   PlacementHop = "retry"
+	PlacementHopReclaim PlacementHop = "reclaim"
+)
+
+// ExecutionPlacement records a worker node running an execution. An
+// execution gets a placement when it starts and at each resume, retry or
+// reclaim hop; the placement is finished when the execution leaves the node.
+type ExecutionPlacement struct {
+	ID          uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ExecutionID uuid.UUID    `json:"execution_id" gorm:"type:uuid;not null;index"`
+	NodeID      string       `json:"node_id" gorm:"not null;index"`
+	Hop         PlacementHop `json:"hop" gorm:"not null"`
+	PlacedAt    time.Time    `json:"placed_at" gorm:"not null"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+}
+
 // ExecutionMetrics represents execution metrics
 type ExecutionMetrics struct {
 	TotalExecutions     int64   `json:"total_executions"`
@@ -252,9 +346,16 @@ func (e *Execution) IsRunning() bool {
 	return e.Status == ExecutionStatusRunning
 }
 
-// IsCompleted returns true if the execution is completed
+// IsCompleted returns true if the execution is completed, with or without
+// warnings
 func (e *Execution) IsCompleted() bool {
-	return e.Status == ExecutionStatusCompleted
+	return e.Status == ExecutionStatusCompleted || e.Status == ExecutionStatusCompletedWithWarnings
+}
+
+// IsResponded returns true once the steps the response of the execution
+// depends on completed, even if background steps are still running
+func (e *Execution) IsResponded() bool {
+	return e.RespondedAt != nil
 }
 
 // IsFailed returns true if the execution failed
@@ -267,6 +368,11 @@ func (e *Execution) IsCancelled() bool {
 	return e.Status == ExecutionStatusCancelled
 }
 
+// IsParked returns true if the execution waits to resume after a drain
+func (e *Execution) IsParked() bool {
+	return e.Status == ExecutionStatusParked
+}
+
 // IsFinished returns true if the execution is in a terminal state
 func (e *Execution) IsFinished() bool {
 	return e.IsCompleted() || e.IsFailed() || e.IsCancelled() || e.Status == ExecutionStatusTimeout
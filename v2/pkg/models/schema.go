@@ -0,0 +1,107 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Validate validates an input against the required fields, property types
+// and additional properties of the schema. Artifact reference objects
+// satisfy the properties of the binary format. It returns one error message
+// per violation, sorted by field name.
+func (s JSONSchema) Validate(input map[string]interface{}) []string {
+	var errs []string
+	for _, name := range s.Required {
+		if _, ok := input[name]; !ok {
+			errs = append(errs, fmt.Sprintf("missing required field %s", name))
+		}
+	}
+
+	names := make([]string, 0, len(input))
+	for name := range input {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, defined := s.Properties[name]
+		if !defined {
+			if additional, ok := s.AdditionalProperties.(bool); ok && !additional {
+				errs = append(errs, fmt.Sprintf("unknown field %s", name))
+			}
+			continue
+		}
+
+		definition, _ := property.(map[string]interface{})
+		expected, _ := definition["type"].(string)
+		if format, _ := definition["format"].(string); format == "binary" && isArtifactReference(input[name]) {
+			// Binaries extracted from inputs into artifacts satisfy string
+			// fields of the binary format
+			continue
+		}
+		if expected != "" && !hasJSONType(input[name], expected) {
+			errs = append(errs, fmt.Sprintf("field %s must be of type %s", name, expected))
+		}
+	}
+
+	return errs
+}
+
+// isArtifactReference reports whether a value is the reference object of
+// an artifact, {"$artifact": "artifact://<id>/<name>", ...}, standing for a
+// binary extracted from an input
+func isArtifactReference(value interface{}) bool {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	ref, ok := object["$artifact"].(string)
+	return ok && strings.HasPrefix(ref, "artifact://")
+}
+
+// hasJSONType reports whether a decoded JSON value has a JSON schema type
+func hasJSONType(value interface{}, expected string) bool {
+	switch expected {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		number, ok := toFloat(value)
+		return ok && number == math.Trunc(number)
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return true
+	}
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
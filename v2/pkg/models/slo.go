@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SLOType is what a service level objective measures
+type SLOType string
+
+const (
+	// SLOTypeLatency holds the target percentage of runs to a duration
+	// threshold, such as 99% of runs within 30s
+	SLOTypeLatency SLOType = "latency"
+	// SLOTypeSuccessRate holds the target percentage of runs to succeed
+	SLOTypeSuccessRate SLOType = "success_rate"
+)
+
+// SLODefinition is a service level objective of a workflow, or of one of
+// its steps, over a rolling window
+type SLODefinition struct {
+	Name string `json:"name" yaml:"name"`
+	// Step is the step the objective applies to, the whole workflow when
+	// empty
+	Step string  `json:"step,omitempty" yaml:"step,omitempty"`
+	Type SLOType `json:"type" yaml:"type"`
+	// Threshold is the duration latency objectives hold runs to, such as
+	// 30s. A latency objective with a target of 99 is a 99th percentile.
+	Threshold string `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	// Target is the percentage of runs that must meet the objective,
+	// below 100
+	Target float64 `json:"target" yaml:"target"`
+	// Window is the rolling window the objective is measured over, such
+	// as 720h
+	Window string `json:"window" yaml:"window"`
+}
+
+// ThresholdDuration returns the threshold of a latency objective
+func (d *SLODefinition) ThresholdDuration() time.Duration {
+	threshold, _ := time.ParseDuration(d.Threshold)
+	return threshold
+}
+
+// WindowDuration returns the rolling window of the objective
+func (d *SLODefinition) WindowDuration() time.Duration {
+	window, _ := time.ParseDuration(d.Window)
+	return window
+}
+
+// Validate validates the objective
+func (d *SLODefinition) Validate() error {
+	if d.Name == "" {
+		return errors.New("SLO name is required")
+	}
+
+	switch d.Type {
+	case SLOTypeLatency:
+		threshold, err := time.ParseDuration(d.Threshold)
+		if err != nil || threshold <= 0 {
+			return fmt.Errorf("SLO %s: latency objectives require a positive threshold duration", d.Name)
+		}
+	case SLOTypeSuccessRate:
+		if d.Threshold != "" {
+			return fmt.Errorf("SLO %s: success rate objectives have no threshold", d.Name)
+		}
+	default:
+		return fmt.Errorf("SLO %s: type must be latency or success_rate", d.Name)
+	}
+
+	if d.Target <= 0 || d.Target >= 100 {
+		return fmt.Errorf("SLO %s: target must be a percentage between 0 and 100, leaving an error budget", d.Name)
+	}
+	window, err := time.ParseDuration(d.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("SLO %s: window must be a positive duration", d.Name)
+	}
+	return nil
+}
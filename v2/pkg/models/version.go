@@ -64,6 +64,13 @@ type WorkflowVersion struct {
 	// Dependencies
 	Dependencies []Dependency `json:"dependencies" gorm:"type:jsonb"`
 	
+	// Deprecation
+	Deprecation *Deprecation `json:"deprecation,omitempty" gorm:"type:jsonb;serializer:json"`
+	
+	// ExecutionPath is the execution mode of the executions of the
+	// version, decided as it was created
+	ExecutionPath *ExecutionPath `json:"execution_path,omitempty" gorm:"type:jsonb;serializer:json"`
+	
 	// Rollback information
 	Rollback RollbackInfo `json:"rollback" gorm:"type:jsonb"`
 	
@@ -22,11 +22,15 @@ const (
 // Workflow represents a workflow definition
 type Workflow struct {
 	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Name        string         `json:"name" gorm:"uniqueIndex;not null" validate:"required,min=1,max=255"`
+	Name        string         `json:"name" gorm:"uniqueIndex:idx_workflows_tenant_name,priority:2;not null" validate:"required,min=1,max=255"`
 	Description string         `json:"description" gorm:"type:text"`
 	Version     string         `json:"version" gorm:"not null" validate:"required"`
 	Status      WorkflowStatus `json:"status" gorm:"default:'draft'" validate:"required"`
 	
+	// Tenant owning the workflow in multi-tenant deployments, empty
+	// otherwise. Names are unique per tenant.
+	TenantID string `json:"tenant_id,omitempty" gorm:"uniqueIndex:idx_workflows_tenant_name,priority:1"`
+	
 	// Metadata
 	Tags      []string `json:"tags" gorm:"type:text[]"`
 	Owner     string   `json:"owner" validate:"required"`
@@ -45,6 +49,9 @@ type Workflow struct {
 	// Versioning
 	VersionInfo VersionInfo `json:"version_info" gorm:"type:jsonb"`
 	
+	// Deprecation
+	Deprecation *Deprecation `json:"deprecation,omitempty" gorm:"type:jsonb;serializer:json"`
+	
 	// Timestamps
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -81,6 +88,165 @@ type WorkflowSpec struct {
 	RetryPolicy   RetryPolicy   `json:"retry_policy,omitempty" yaml:"retry_policy,omitempty"`
 	Timeout       string        `json:"timeout,omitempty" yaml:"timeout,omitempty"`
 	FeatureFlags  map[string]bool `json:"feature_flags,omitempty" yaml:"feature_flags,omitempty"`
+	// Environment is the shared configuration of the steps, such as base
+	// URLs, read as ${env.KEY}. It is not the environment of the server
+	// process.
+	Environment map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Scripts       *ScriptPolicy   `json:"scripts,omitempty" yaml:"scripts,omitempty"`
+	// OutputMapping maps the output fields of an execution to ${references}
+	// to step results and variables
+	OutputMapping map[string]string `json:"output_mapping,omitempty" yaml:"output_mapping,omitempty"`
+	// Examples are example payloads of the workflow, validated against its
+	// inputs and outputs and shown in generated docs
+	Examples []WorkflowExample `json:"examples,omitempty" yaml:"examples,omitempty"`
+	// SLOs are the service level objectives of the workflow and of its
+	// steps
+	SLOs []SLODefinition `json:"slos,omitempty" yaml:"slos,omitempty"`
+	// ShutdownPolicy is what happens to the running executions of the
+	// workflow when the node running them drains. Defaults to
+	// run_to_completion.
+	ShutdownPolicy ShutdownPolicy `json:"shutdown_policy,omitempty" yaml:"shutdown_policy,omitempty"`
+	// CompensationIncomplete declares that compensating the steps of an
+	// execution cannot undo all of their side effects, so executions must
+	// not be interrupted midway
+	CompensationIncomplete bool `json:"compensation_incomplete,omitempty" yaml:"compensation_incomplete,omitempty"`
+	// ExecutionMode is how the executions of the workflow are run.
+	// Defaults to standard.
+	ExecutionMode ExecutionMode `json:"execution_mode,omitempty" yaml:"execution_mode,omitempty"`
+}
+
+// ShutdownPolicy is what the engine does with a running execution when the
+// node running it drains
+type ShutdownPolicy string
+
+const (
+	// ShutdownRunToCompletion executions run until they end, delaying the
+	// drain
+	ShutdownRunToCompletion ShutdownPolicy = "run_to_completion"
+	// ShutdownCheckpointAfterCurrentStep executions finish their running
+	// steps and are parked, to resume with their next steps on another node
+	ShutdownCheckpointAfterCurrentStep ShutdownPolicy = "checkpoint_after_current_step"
+	// ShutdownInterruptible executions are cancelled at once, midway
+	// through their steps
+	ShutdownInterruptible ShutdownPolicy = "interruptible"
+)
+
+// ShutdownPolicies are the valid shutdown policies
+var ShutdownPolicies = []ShutdownPolicy{ShutdownRunToCompletion, ShutdownCheckpointAfterCurrentStep, ShutdownInterruptible}
+
+// Shutdown returns the shutdown policy of the workflow, defaulting to
+// run_to_completion
+func (s *WorkflowSpec) Shutdown() ShutdownPolicy {
+	if s.ShutdownPolicy == "" {
+		return ShutdownRunToCompletion
+	}
+	return s.ShutdownPolicy
+}
+
+// ValidateShutdownPolicy checks a shutdown policy. Interrupting workflows
+// whose compensation is incomplete could leave partial side effects, so
+// they cannot be interruptible.
+func ValidateShutdownPolicy(policy ShutdownPolicy, compensationIncomplete bool) error {
+	if policy == "" {
+		return nil
+	}
+	known := false
+	for _, valid := range ShutdownPolicies {
+		known = known || policy == valid
+	}
+	if !known {
+		return fmt.Errorf("invalid shutdown policy %q, expected one of %v", policy, ShutdownPolicies)
+	}
+	if policy == ShutdownInterruptible && compensationIncomplete {
+		return fmt.Errorf("shutdown policy interruptible is not allowed for workflows declaring compensation_incomplete, use %s or %s",
+			ShutdownRunToCompletion, ShutdownCheckpointAfterCurrentStep)
+	}
+	return nil
+}
+
+// ExecutionMode is how the engine runs the executions of a workflow
+type ExecutionMode string
+
+const (
+	// ExecutionModeStandard executions persist each step and emit an
+	// event for each step
+	ExecutionModeStandard ExecutionMode = "standard"
+	// ExecutionModeLightweight executions buffer their steps and persist
+	// them in one batch when they end, and only emit the events starting
+	// and ending them. They run in the fast lane of the engine.
+	ExecutionModeLightweight ExecutionMode = "lightweight"
+)
+
+// ExecutionModes are the valid execution modes
+var ExecutionModes = []ExecutionMode{ExecutionModeStandard, ExecutionModeLightweight}
+
+// Mode returns the execution mode of the workflow, defaulting to standard
+func (s *WorkflowSpec) Mode() ExecutionMode {
+	if s.ExecutionMode == "" {
+		return ExecutionModeStandard
+	}
+	return s.ExecutionMode
+}
+
+// ValidateExecutionMode checks an execution mode
+func ValidateExecutionMode(mode ExecutionMode) error {
+	if mode == "" {
+		return nil
+	}
+	for _, valid := range ExecutionModes {
+		if mode == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid execution mode %q, expected one of %v", mode, ExecutionModes)
+}
+
+// lightweightIncompatibleSteps are the step types lightweight executions
+// cannot run, by the feature they use: manual steps wait on people,
+// sub-workflows start executions of their own, and parallel steps branch
+// out
+var lightweightIncompatibleSteps = map[string]string{
+	"approval":     "manual step",
+	"manual":       "manual step",
+	"sub_workflow": "sub-workflow",
+	"parallel":     "parallel branches",
+}
+
+// LightweightIncompatibility returns the feature of a step type that keeps
+// a workflow from running in the lightweight execution mode, or an empty
+// string for step types lightweight executions can run
+func LightweightIncompatibility(stepType string) string {
+	return lightweightIncompatibleSteps[stepType]
+}
+
+// ExecutionPath records the execution mode a workflow version runs in,
+// decided as the version is created. Versions asking for the lightweight
+// mode fall back to the standard one when their definition uses features
+// lightweight executions cannot run.
+type ExecutionPath struct {
+	// Requested is the execution mode the definition asks for
+	Requested ExecutionMode `json:"requested"`
+	// Mode is the execution mode the executions of the version run in
+	Mode ExecutionMode `json:"mode"`
+	// Fallbacks lists the features that made the version fall back to
+	// the standard mode, such as "steps[2] (review): manual step"
+	Fallbacks []string `json:"fallbacks,omitempty"`
+}
+
+// WorkflowExample is an example input of a workflow and the output it
+// produces
+type WorkflowExample struct {
+	Name        string                 `json:"name" yaml:"name"`
+	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Input       map[string]interface{} `json:"input" yaml:"input"`
+	Output      map[string]interface{} `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// ScriptPolicy controls what the sandboxed script steps of a workflow may do
+type ScriptPolicy struct {
+	// AllowedHostFunctions lists the host functions scripts may call as
+	// mf.<name>. Scripts of workflows without a policy may call none.
+	AllowedHostFunctions []string `json:"allowed_host_functions,omitempty" yaml:"allowed_host_functions,omitempty"`
 }
 
 // WorkflowStep represents a single step in the workflow
@@ -90,13 +256,32 @@ type WorkflowStep struct {
 	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
 	DependsOn   []string               `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
 	Condition   string                 `json:"condition,omitempty" yaml:"condition,omitempty"`
+	// When is an expression evaluated against the execution variables
+	// before the step runs. The step is skipped when it is false, and the
+	// steps depending on it still run.
+	When string `json:"when,omitempty" yaml:"when,omitempty"`
 	Config      map[string]interface{} `json:"config" yaml:"config"`
 	DataMapping DataMapping            `json:"data_mapping,omitempty" yaml:"data_mapping,omitempty"`
 	ErrorHandling ErrorHandling        `json:"error_handling,omitempty" yaml:"error_handling,omitempty"`
 	RetryPolicy RetryPolicy            `json:"retry_policy,omitempty" yaml:"retry_policy,omitempty"`
 	Timeout     string                 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Priority orders the ready steps of an execution when steps wait for
+	// worker capacity. Defaults to normal.
+	Priority StepPriority `json:"priority,omitempty" yaml:"priority,omitempty"`
 }
 
+// StepPriority is the priority of a workflow step
+type StepPriority string
+
+const (
+	// StepPriorityCritical steps gate the response the caller waits on
+	StepPriorityCritical StepPriority = "critical"
+	StepPriorityNormal   StepPriority = "normal"
+	// StepPriorityBackground steps are best-effort: they may run after the
+	// response was returned and their failure only warns
+	StepPriorityBackground StepPriority = "background"
+)
+
 // DataMapping represents data transformation between steps
 type DataMapping struct {
 	Input  map[string]string `json:"input,omitempty" yaml:"input,omitempty"`
@@ -144,6 +329,7 @@ type Notification struct {
 	Events    []string          `json:"events"`
 	Config    map[string]string `json:"config"`
 	Enabled   bool              `json:"enabled"`
+	Template  *PayloadTemplate  `json:"template,omitempty"`
 }
 
 // Webhook represents a webhook configuration
@@ -153,6 +339,20 @@ type Webhook struct {
 	Headers map[string]string `json:"headers,omitempty"`
 	Events  []string          `json:"events"`
 	Enabled bool              `json:"enabled"`
+	// Template replaces the default event payload with a rendered one
+	Template *PayloadTemplate `json:"template,omitempty"`
+}
+
+// PayloadTemplate customizes the body of webhook and notification
+// deliveries. Set either Name, selecting a built-in template (slack-basic,
+// pagerduty-v2 or teams-card), or Body, a Go text/template rendered against
+// the event and a summary of its execution.
+type PayloadTemplate struct {
+	Name string `json:"name,omitempty"`
+	Body string `json:"body,omitempty"`
+	// Params are values templates read as .Params, such as the routing_key
+	// of pagerduty-v2
+	Params map[string]string `json:"params,omitempty"`
 }
 
 // VersionInfo represents version-specific information
@@ -225,6 +425,31 @@ func (w *Workflow) Validate() error {
 		return fmt.Errorf("workflow must have at least one step")
 	}
 	
+	// Validate service level objectives
+	steps := make(map[string]bool, len(w.Definition.Spec.Steps))
+	for _, step := range w.Definition.Spec.Steps {
+		steps[step.Name] = true
+	}
+	names := make(map[string]bool, len(w.Definition.Spec.SLOs))
+	for i := range w.Definition.Spec.SLOs {
+		slo := &w.Definition.Spec.SLOs[i]
+		if err := slo.Validate(); err != nil {
+			return err
+		}
+		if names[slo.Name] {
+			return fmt.Errorf("duplicate SLO %s", slo.Name)
+		}
+		names[slo.Name] = true
+		if slo.Step != "" && !steps[slo.Step] {
+			return fmt.Errorf("SLO %s: unknown step %s", slo.Name, slo.Step)
+		}
+	}
+	
+	// Validate the shutdown policy
+	if err := ValidateShutdownPolicy(w.Definition.Spec.ShutdownPolicy, w.Definition.Spec.CompensationIncomplete); err != nil {
+		return err
+	}
+	
 	return nil
 }
 